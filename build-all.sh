@@ -65,6 +65,14 @@ $CXX -c $WARNING_FLAGS                        -std=c++11 -x c++ \
 $CXX -c $WARNING_FLAGS -DWUFFS_IMPLEMENTATION -std=c++11 -x c++ \
     release/c/wuffs-unsupported-snapshot.c -o /dev/null
 
+# -Wpedantic is omitted, as gnu89 (but not ISO C90) allows // comments.
+echo "Checking -ctarget=c89 snapshot compiles cleanly"
+wuffs gen -ctarget=c89
+$CC -c ${WARNING_FLAGS/-Wpedantic /} -DWUFFS_IMPLEMENTATION -std=gnu89 \
+    -Wdeclaration-after-statement \
+    release/c/wuffs-unsupported-snapshot.c -o /dev/null
+wuffs gen
+
 wuffs genlib -skipgen
 wuffs test   -skipgen -mimic
 wuffs bench  -skipgen -mimic -reps=1 -iterscale=1
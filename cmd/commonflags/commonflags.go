@@ -27,15 +27,42 @@ import (
 )
 
 const (
+	AllocatorDefault = false
+	AllocatorUsage   = `whether to generate alloc_with functions that take a wuffs_base__allocator, and route the other alloc functions through them`
+
+	APIJSONDefault = ""
+	APIJSONUsage   = `if non-empty, the filename to write a JSON summary of the package's public consts (such as limits), status strings and public field bounds to`
+
+	Audit32Default = false
+	Audit32Usage   = `whether to fail code generation when a Wuffs value, converted to size_t, might not fit in 32 bits`
+
+	AutovecDefault = false
+	AutovecUsage   = `whether to shape the portable (non-cpu_arch) iterate loops for compilers' auto-vectorizers`
+
 	CcompilersDefault = "clang-9,gcc"
 	CcompilersUsage   = `comma-separated list of C compilers`
 
+	CTargetDefault = "c99"
+	CTargetUsage   = `the generated C code's target dialect: "c99", or "c89" or "msvc" (which declare all local variables at the start of a block, for older compilers)`
+
+	FlamegraphDefault = ""
+	FlamegraphUsage   = `if non-empty, the directory to write one flamegraph SVG per benchmark to, profiling with perf (on Linux) or dtrace (elsewhere)`
+
 	FocusDefault = ""
 	FocusUsage   = `comma-separated list of tests or benchmarks (name prefixes) to focus on, e.g. "wuffs_gif_decode"`
 
+	GenlangDefault = "c"
+	GenlangUsage   = `the generated code's language, "c" or "c++" (a header of C++ classes that wrap the C API)`
+
 	GenlinenumDefault = false
 	GenlinenumUsage   = `whether to generate filename:line_number comments`
 
+	HdronlyDefault = false
+	HdronlyUsage   = `whether to generate only the public API header, omitting struct definitions and function implementations`
+
+	InstrumentDefault = false
+	InstrumentUsage   = `whether to call the WUFFS_BASE__INSTRUMENT__ETC hook macros (compiled out unless defined) on suspension, on status return and on each while loop iteration`
+
 	IterscaleDefault = 100
 	IterscaleMin     = 0
 	IterscaleMax     = 1000000
@@ -44,11 +71,32 @@ const (
 	MimicDefault = false
 	MimicUsage   = `whether to compare Wuffs' output with other libraries' output`
 
+	OptimizeDefault = "speed"
+	OptimizeUsage   = `what the generated C code should favor, "speed" or "size" (smaller code, for tight flash budgets)`
+
+	PatchDefault = ""
+	PatchUsage   = `if non-empty, the previous output file: functions whose Wuffs code is unchanged are copied from it byte-for-byte`
+
 	RepsDefault = 5
 	RepsMin     = 0
 	RepsMax     = 1000000
 	RepsUsage   = `the number of repetitions per benchmark`
 
+	SizeReportDefault = ""
+	SizeReportUsage   = `if non-empty, the filename to write a report of each generated C function's code size (and coroutine state size) to`
+
+	SnapshotDefault = false
+	SnapshotUsage   = `whether to compare each test's observable behavior (output hashes, statuses, workbuf lengths) against a golden snapshot file`
+
+	StatustableDefault = false
+	StatustableUsage   = `whether to pack each package's status messages into one shared string table, shrinking read-only data`
+
+	SymbolmapDefault = ""
+	SymbolmapUsage   = `if non-empty, the filename to write a JSON map from generated C symbols to their Wuffs declarations`
+
+	UpdateDefault = false
+	UpdateUsage   = `whether to update, instead of compare against, the -snapshot golden files`
+
 	VersionDefault = "0.0.0"
 	VersionUsage   = `version string, e.g. "1.2.3-beta.4"`
 )
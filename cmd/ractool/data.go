@@ -40,9 +40,11 @@ stdout.
 The flags should include exactly one of -decode or -encode.
 
 By default, a RAC file's chunks are decoded in parallel, using more total CPU
-time to substantially reduce the real (wall clock) time taken. Batch (instead
-of interactive) processing of many RAC files may want to pass -singlethreaded
-to prefer minimizing total CPU time.
+time to substantially reduce the real (wall clock) time taken. Likewise, when
+encoding with a fixed -dchunksize (including the default), chunks are
+compressed in parallel. The output does not depend on the parallelism. Batch
+(instead of interactive) processing of many RAC files may want to pass
+-singlethreaded to prefer minimizing total CPU time.
 
 When encoding, the input is partitioned into chunks and each chunk is
 compressed independently. You can specify the target chunk size in terms of
@@ -90,7 +92,7 @@ Decode-Related Flags:
     -drange
         the "i..j" range to decompress, "..8" means the first 8 bytes
     -singlethreaded
-        whether to decode on a single execution thread
+        whether to decode (or encode) on a single execution thread
 
 Encode-Related Flags:
 
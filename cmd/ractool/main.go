@@ -41,9 +41,11 @@ stdout.
 The flags should include exactly one of -decode or -encode.
 
 By default, a RAC file's chunks are decoded in parallel, using more total CPU
-time to substantially reduce the real (wall clock) time taken. Batch (instead
-of interactive) processing of many RAC files may want to pass -singlethreaded
-to prefer minimizing total CPU time.
+time to substantially reduce the real (wall clock) time taken. Likewise, when
+encoding with a fixed -dchunksize (including the default), chunks are
+compressed in parallel. The output does not depend on the parallelism. Batch
+(instead of interactive) processing of many RAC files may want to pass
+-singlethreaded to prefer minimizing total CPU time.
 
 When encoding, the input is partitioned into chunks and each chunk is
 compressed independently. You can specify the target chunk size in terms of
@@ -91,7 +93,7 @@ Decode-Related Flags:
     -drange
         the "i..j" range to decompress, "..8" means the first 8 bytes
     -singlethreaded
-        whether to decode on a single execution thread
+        whether to decode (or encode) on a single execution thread
 
 Encode-Related Flags:
 
@@ -272,7 +274,7 @@ var (
 	drangeFlag = flag.String("drange", "..",
 		"the \"i..j\" range to decompress, \"..8\" means the first 8 bytes")
 	singlethreadedFlag = flag.Bool("singlethreaded", false,
-		"whether to decode on a single execution thread")
+		"whether to decode (or encode) on a single execution thread")
 
 	// Encode-related flags.
 	codecFlag         = flag.String("codec", "zstd", "the compression codec")
@@ -403,6 +405,21 @@ func parseRange(s string) (i int64, j int64, ok bool) {
 	return i, j, true
 }
 
+// concurrency returns the number of worker goroutines to decode or encode
+// with, or zero if -singlethreaded.
+func concurrency() int {
+	if *singlethreadedFlag {
+		return 0
+	}
+	n := runtime.NumCPU()
+	// After 16 workers, we see diminishing speed returns, but still face
+	// increasing memory costs.
+	if n > 16 {
+		n = 16
+	}
+	return n
+}
+
 func decode(inFile *os.File) error {
 	i, j, ok := parseRange(*drangeFlag)
 	if !ok {
@@ -459,15 +476,7 @@ func decode(inFile *os.File) error {
 	// hold that up, so we call CloseWithoutWaiting instead of Close.
 	defer r.CloseWithoutWaiting()
 
-	if !*singlethreadedFlag {
-		n := runtime.NumCPU()
-		// After 16 workers, we see diminishing speed returns, but still face
-		// increasing memory costs.
-		if n > 16 {
-			n = 16
-		}
-		r.Concurrency = n
-	}
+	r.Concurrency = concurrency()
 	if err := r.SeekRange(i, j); err != nil {
 		return err
 	}
@@ -518,6 +527,7 @@ func encode(r io.Reader) error {
 		CPageSize:     uint64(cpagesize),
 		CChunkSize:    uint64(cchunksize),
 		DChunkSize:    uint64(dchunksize),
+		Concurrency:   concurrency(),
 	}
 	switch *codecFlag {
 	case "lz4":
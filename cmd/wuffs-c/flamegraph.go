@@ -0,0 +1,457 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// This file implements "wuffs-c bench -flamegraph", which runs each benchmark
+// under a sampling profiler (perf on Linux, dtrace elsewhere) and renders the
+// sampled call stacks as one flamegraph SVG per benchmark.
+//
+// The C function names in those call stacks are mapped back to the Wuffs
+// declarations that they came from, using the symbol maps (see "wuffs-c gen
+// -symbolmap") that "wuffs bench -flamegraph" writes to the Wuffs root's gen/c
+// directory. For example, "wuffs_gif__decoder__decode_frame" is shown as "gif:
+// decoder.decode_frame".
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/wuffs/lang/wuffsroot"
+)
+
+// doFlamegraphs runs each of the out program's benchmarks (those in the
+// filename+".c" source code that match the focus) once, under a profiler,
+// writing the flamegraphs to the dir directory.
+func doFlamegraphs(filename string, out string, workDir string, dir string, cc string,
+	focus string, iterscale int, mimic bool, reps int) (failed bool, err error) {
+
+	root, err := wuffsroot.Value()
+	if err != nil {
+		return false, err
+	}
+	names, err := findBenchNames(filename+".c", mimic)
+	if err != nil {
+		return false, err
+	}
+	symbols, err := loadSymbolMaps(filepath.Join(root, "gen", "c"))
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, err
+	}
+
+	for _, name := range names {
+		if !matchesFocus(name, focus) {
+			continue
+		}
+		outArgs := []string{
+			"-bench",
+			fmt.Sprintf("-iterscale=%d", iterscale),
+			fmt.Sprintf("-reps=%d", reps),
+			// The trailing '$' means an exact match, not a prefix match.
+			fmt.Sprintf("-focus=%s$", name),
+		}
+		stacks, err := profile(root, workDir, out, outArgs)
+		if err == nil {
+			// No-op.
+		} else if _, ok := err.(*exec.ExitError); ok {
+			failed = true
+			continue
+		} else {
+			return false, err
+		}
+
+		svg := renderFlamegraph(fmt.Sprintf("%s (%s)", name, cc), buildFlameTree(stacks, symbols))
+		svgFilename := filepath.Join(dir, strings.TrimPrefix(name, "bench_")+"."+cc+".svg")
+		if err := ioutil.WriteFile(svgFilename, svg, 0644); err != nil {
+			return false, err
+		}
+		fmt.Printf("wrote %s\n", svgFilename)
+	}
+	return failed, nil
+}
+
+// findBenchNames returns the function names listed in the g_benches array of
+// a C test program, such as "bench_wuffs_gif_decode_20k". Those under "#ifdef
+// WUFFS_MIMIC" are only returned if mimic is true.
+func findBenchNames(filename string, mimic bool) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names := []string(nil)
+	inBenches, inMimic := false, false
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if !inBenches {
+			inBenches = strings.HasPrefix(line, "proc g_benches[] = {")
+			continue
+		}
+		switch {
+		case line == "};":
+			return names, nil
+		case line == "#ifdef WUFFS_MIMIC":
+			inMimic = true
+		case strings.HasPrefix(line, "#endif"):
+			inMimic = false
+		case strings.HasPrefix(line, "bench_") && strings.HasSuffix(line, ","):
+			if mimic || !inMimic {
+				names = append(names, line[:len(line)-1])
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("could not find g_benches in %s", filename)
+}
+
+// matchesFocus returns whether the C testlib's check_focus function would
+// select the named benchmark.
+func matchesFocus(name string, focus string) bool {
+	if focus == "" {
+		return true
+	}
+	for _, f := range strings.Split(focus, ",") {
+		if i := strings.IndexByte(f, '/'); i >= 0 {
+			f = f[:i]
+		}
+		if f == "" {
+			continue
+		}
+		f = strings.TrimPrefix(f, "Benchmark")
+		if strings.HasPrefix(name, f) || strings.HasPrefix(strings.TrimPrefix(name, "bench_"), f) {
+			return true
+		}
+	}
+	return false
+}
+
+// symbolMapEntry is the subset of a "wuffs-c gen -symbolmap" entry that a
+// flamegraph uses.
+type symbolMapEntry struct {
+	Symbol  string `json:"symbol"`
+	Package string `json:"package"`
+	Decl    string `json:"decl"`
+	CPUArch string `json:"cpu_arch"`
+}
+
+// loadSymbolMaps loads the "*.symbols.json" files in dir, keyed by C symbol.
+// A missing dir is not an error, as the flamegraphs can still show the C
+// names.
+func loadSymbolMaps(dir string) (map[string]symbolMapEntry, error) {
+	filenames, err := filepath.Glob(filepath.Join(dir, "*.symbols.json"))
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]symbolMapEntry{}
+	for _, filename := range filenames {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		entries := []symbolMapEntry(nil)
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		for _, e := range entries {
+			m[e.Symbol] = e
+		}
+	}
+	return m, nil
+}
+
+// profile runs the out program, sampling its call stacks. It returns how
+// often each stack was seen, keyed by the stack's C function names, outermost
+// first and separated by semi-colons.
+func profile(root string, workDir string, out string, outArgs []string) (map[string]uint64, error) {
+	if runtime.GOOS == "linux" {
+		return profilePerf(root, workDir, out, outArgs)
+	}
+	return profileDTrace(root, workDir, out, outArgs)
+}
+
+func profilePerf(root string, workDir string, out string, outArgs []string) (map[string]uint64, error) {
+	data := filepath.Join(workDir, "perf.data")
+	args := append([]string{"record", "-q", "-F", "999", "-g", "-o", data, "--", out}, outArgs...)
+	cmd := exec.Command("perf", args...)
+	cmd.Dir = root
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	cmd = exec.Command("perf", "script", "-i", data, "-F", "ip,sym")
+	cmd.Stderr = os.Stderr
+	script, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return parsePerfScript(script), nil
+}
+
+// parsePerfScript parses "perf script -F ip,sym" output: one block per sample,
+// separated by blank lines, with one "address symbol" line per frame,
+// innermost first.
+func parsePerfScript(script []byte) map[string]uint64 {
+	stacks := map[string]uint64{}
+	frames := []string(nil)
+	flush := func() {
+		if len(frames) > 0 {
+			stacks[joinFrames(frames)]++
+			frames = frames[:0]
+		}
+	}
+	for _, line := range strings.Split(string(script), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			flush()
+		} else if len(fields) >= 2 {
+			frames = append(frames, trimFrameOffset(fields[1]))
+		}
+	}
+	flush()
+	return stacks
+}
+
+func profileDTrace(root string, workDir string, out string, outArgs []string) (map[string]uint64, error) {
+	data := filepath.Join(workDir, "dtrace.txt")
+	cmd := exec.Command("dtrace", "-q",
+		"-x", "ustackframes=100",
+		"-n", "profile-997 /pid == $target/ { @[ustack()] = count(); }",
+		"-o", data,
+		"-c", strings.Join(append([]string{out}, outArgs...), " "),
+	)
+	cmd.Dir = root
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	aggregation, err := ioutil.ReadFile(data)
+	if err != nil {
+		return nil, err
+	}
+	return parseDTraceAggregation(aggregation), nil
+}
+
+// parseDTraceAggregation parses a "@[ustack()] = count()" aggregation: one
+// block per stack, separated by blank lines, with one "module`symbol+offset"
+// line per frame, innermost first, followed by the count.
+func parseDTraceAggregation(aggregation []byte) map[string]uint64 {
+	stacks := map[string]uint64{}
+	frames := []string(nil)
+	for _, line := range strings.Split(string(aggregation), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			frames = frames[:0]
+		} else if n, err := strconv.ParseUint(line, 10, 64); err == nil {
+			if len(frames) > 0 {
+				stacks[joinFrames(frames)] += n
+			}
+			frames = frames[:0]
+		} else {
+			if i := strings.IndexByte(line, '`'); i >= 0 {
+				line = line[i+1:]
+			}
+			frames = append(frames, trimFrameOffset(line))
+		}
+	}
+	return stacks
+}
+
+// joinFrames joins innermost-first frames into an outermost-first key.
+func joinFrames(frames []string) string {
+	reversed := make([]string, len(frames))
+	for i, f := range frames {
+		reversed[len(frames)-1-i] = f
+	}
+	return strings.Join(reversed, ";")
+}
+
+func trimFrameOffset(frame string) string {
+	if i := strings.Index(frame, "+0x"); i > 0 {
+		return frame[:i]
+	}
+	return frame
+}
+
+// flameNode is a node in a flamegraph's tree of call stacks.
+type flameNode struct {
+	label    string
+	wuffs    bool
+	count    uint64
+	children map[string]*flameNode
+}
+
+func (n *flameNode) child(label string, wuffs bool) *flameNode {
+	if n.children == nil {
+		n.children = map[string]*flameNode{}
+	}
+	c := n.children[label]
+	if c == nil {
+		c = &flameNode{label: label, wuffs: wuffs}
+		n.children[label] = c
+	}
+	return c
+}
+
+func (n *flameNode) sortedChildren() []*flameNode {
+	ret := make([]*flameNode, 0, len(n.children))
+	for _, c := range n.children {
+		ret = append(ret, c)
+	}
+	sort.Slice(ret, func(i int, j int) bool { return ret[i].label < ret[j].label })
+	return ret
+}
+
+func (n *flameNode) depth() int {
+	d := 0
+	for _, c := range n.children {
+		if cd := c.depth() + 1; d < cd {
+			d = cd
+		}
+	}
+	return d
+}
+
+func buildFlameTree(stacks map[string]uint64, symbols map[string]symbolMapEntry) *flameNode {
+	root := &flameNode{label: "all"}
+	for stack, count := range stacks {
+		root.count += count
+		n := root
+		for _, frame := range strings.Split(stack, ";") {
+			label, wuffs := frameLabel(frame, symbols)
+			n = n.child(label, wuffs)
+			n.count += count
+		}
+	}
+	return root
+}
+
+// frameLabel returns the Wuffs declaration that the C function came from,
+// such as "gif: decoder.decode_frame", or the C function name if unknown.
+func frameLabel(frame string, symbols map[string]symbolMapEntry) (label string, wuffs bool) {
+	cName := frame
+	// Strip any compiler suffix, such as gcc's ".constprop.0" or ".isra.0".
+	if i := strings.IndexByte(cName, '.'); i > 0 {
+		cName = cName[:i]
+	}
+	e, ok := symbols[cName]
+	if !ok {
+		return frame, false
+	}
+	label = e.Package + ": " + e.Decl
+	if e.CPUArch != "" {
+		label += " (" + e.CPUArch + ")"
+	}
+	return label, true
+}
+
+const (
+	flameWidth       = 1200
+	flameMargin      = 10
+	flameTitleHeight = 32
+	flameFrameHeight = 16
+	flameCharWidth   = 7
+)
+
+// renderFlamegraph returns an SVG image with one box per flameNode, whose
+// width is proportional to its count. Callers are below their callees.
+func renderFlamegraph(title string, root *flameNode) []byte {
+	depth := root.depth()
+	height := flameTitleHeight + ((depth + 1) * flameFrameHeight) + flameMargin
+
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "<?xml version=\"1.0\" standalone=\"no\"?>\n")
+	fmt.Fprintf(b, "<svg version=\"1.1\" width=\"%d\" height=\"%d\" "+
+		"xmlns=\"http://www.w3.org/2000/svg\" font-family=\"monospace\" font-size=\"12\">\n",
+		flameWidth+(2*flameMargin), height)
+	fmt.Fprintf(b, "<rect width=\"100%%\" height=\"100%%\" fill=\"rgb(250,250,240)\"/>\n")
+	fmt.Fprintf(b, "<text x=\"%d\" y=\"20\" text-anchor=\"middle\" font-size=\"16\">%s, %d samples</text>\n",
+		(flameWidth/2)+flameMargin, html.EscapeString(title), root.count)
+
+	if root.count > 0 {
+		var draw func(n *flameNode, x float64, d int)
+		draw = func(n *flameNode, x float64, d int) {
+			w := float64(n.count) * flameWidth / float64(root.count)
+			if w < 0.5 {
+				return
+			}
+			y := flameTitleHeight + ((depth - d) * flameFrameHeight)
+			label := html.EscapeString(n.label)
+			fmt.Fprintf(b, "<g><title>%s (%d samples, %.2f%%)</title>"+
+				"<rect x=\"%.1f\" y=\"%d\" width=\"%.1f\" height=\"%d\" fill=\"%s\" rx=\"2\"/>",
+				label, n.count, float64(n.count)*100/float64(root.count),
+				x+flameMargin, y, w, flameFrameHeight-1, flameColor(n))
+			if text := fitFlameLabel(n.label, w); text != "" {
+				fmt.Fprintf(b, "<text x=\"%.1f\" y=\"%d\">%s</text>",
+					x+flameMargin+3, y+flameFrameHeight-4, html.EscapeString(text))
+			}
+			b.WriteString("</g>\n")
+			for _, c := range n.sortedChildren() {
+				draw(c, x, d+1)
+				x += float64(c.count) * flameWidth / float64(root.count)
+			}
+		}
+		draw(root, 0, 0)
+	}
+
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
+
+// flameColor returns warm colors for Wuffs code and cool colors for everything
+// else (such as the C test harness and libc), varying by label so that
+// adjacent boxes are distinguishable.
+func flameColor(n *flameNode) string {
+	h := fnv.New32a()
+	h.Write([]byte(n.label))
+	v := h.Sum32()
+	if n.wuffs {
+		return fmt.Sprintf("rgb(%d,%d,%d)", 220+(v%36), 100+((v>>8)%100), 40+((v>>16)%30))
+	}
+	return fmt.Sprintf("rgb(%d,%d,%d)", 150+(v%40), 170+((v>>8)%40), 200+((v>>16)%40))
+}
+
+// fitFlameLabel returns label, truncated to fit in a box of the given width,
+// or "" if there is not enough room.
+func fitFlameLabel(label string, width float64) string {
+	n := int(width-6) / flameCharWidth
+	if n >= len(label) {
+		return label
+	} else if n < 4 {
+		return ""
+	}
+	return label[:n-2] + ".."
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"strings"
+
+	"github.com/google/wuffs/lang/generate"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// doGengo generates Go source code that wraps, via cgo, the generated C code's
+// image decoders in an API similar to the Go standard library's image
+// package: Decode and DecodeConfig functions, suitable for image.RegisterFormat,
+// plus a Decoder type that iterates over an animated image's frames.
+//
+// All of the generated .go files (one per Wuffs package, plus one for the
+// "base" package) belong in the same Go package. The "base" one holds the code
+// shared by all image decoders, and is the only one that compiles the C
+// implementation (the cinclude file is compiled once, with
+// WUFFS_IMPLEMENTATION defined, instead of once per Wuffs package, to avoid
+// duplicate symbols at link time). The other ones contain Go functions like
+// DecodeGIF, DecodeConfigGIF and NewGIFDecoder.
+func doGengo(args []string) error {
+	flags := flag.FlagSet{}
+	cincludeFlag := flags.String("cinclude", "wuffs-unsupported-snapshot.c", `the C file to #include, relative to the generated Go package's directory: a single-file release such as "wuffs-unsupported-snapshot.c"`)
+	gopackageFlag := flags.String("gopackage", "wuffsimage", "the package name of the Go output code")
+
+	return generate.Do(&flags, args, func(pkgName string, tm *t.Map, files []*a.File) ([]byte, error) {
+		return gengo(pkgName, tm, files, *cincludeFlag, *gopackageFlag)
+	})
+}
+
+// gengo returns the gofmt'ed Go source code for one Wuffs package (or for the
+// "base" package).
+func gengo(pkgName string, tm *t.Map, files []*a.File, cinclude string, gopackage string) ([]byte, error) {
+	if !token.IsIdentifier(gopackage) {
+		return nil, fmt.Errorf("bad -gopackage flag value %q", gopackage)
+	}
+	if (cinclude == "") || strings.ContainsAny(cinclude, "\"\n") {
+		return nil, fmt.Errorf("bad -cinclude flag value %q", cinclude)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "// Code generated by \"wuffs-c gengo\"; DO NOT EDIT.\n\n")
+	if pkgName == "base" {
+		if len(files) != 0 {
+			return nil, fmt.Errorf("base package shouldn't have any .wuffs files")
+		}
+		src := strings.Replace(gengoBase, "WUFFS_GENGO_CINCLUDE", cinclude, -1)
+		src = strings.Replace(src, "WUFFS_GENGO_GOPACKAGE", gopackage, -1)
+		buf.WriteString(src)
+
+	} else {
+		if err := gengoPackage(buf, pkgName, tm, files, cinclude, gopackage); err != nil {
+			return nil, err
+		}
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+func gengoPackage(buf *bytes.Buffer, pkgName string, tm *t.Map, files []*a.File,
+	cinclude string, gopackage string) error {
+
+	structNames := []string(nil)
+	for _, file := range files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KStruct {
+				continue
+			}
+			n := tld.AsStruct()
+			if !n.Public() {
+				continue
+			}
+			for _, impl := range n.Implements() {
+				iQID := impl.AsTypeExpr().QID()
+				if (iQID[0] == t.IDBase) && (iQID[1].Str(tm) == "image_decoder") {
+					structNames = append(structNames, n.QID().Str(tm))
+					break
+				}
+			}
+		}
+	}
+	if len(structNames) == 0 {
+		return fmt.Errorf("package %q has no public struct that implements base.image_decoder", pkgName)
+	}
+
+	fmt.Fprintf(buf, "package %s\n\n", gopackage)
+	fmt.Fprintf(buf, "/*\n#include %q\n*/\nimport \"C\"\n\n", cinclude)
+	fmt.Fprintf(buf, "import (\n\"image\"\n\"io\"\n)\n\n")
+
+	for _, structName := range structNames {
+		// For a Wuffs package "gif" and struct "decoder", goName is "GIF". For
+		// a struct "foo_decoder", it is "GIFFoo".
+		goName := strings.ToUpper(pkgName)
+		for _, s := range strings.Split(strings.TrimSuffix(structName, "decoder"), "_") {
+			if s != "" {
+				goName += strings.ToUpper(s[:1]) + s[1:]
+			}
+		}
+		if !token.IsIdentifier(goName) {
+			return fmt.Errorf("cannot derive a Go name for %s.%s", pkgName, structName)
+		}
+		cName := "wuffs_" + pkgName + "__" + structName
+
+		fmt.Fprintf(buf, "// Decode%s decodes the first frame of an image, using Wuffs' %s.%s.\n"+
+			"// Its signature matches what image.RegisterFormat expects.\n"+
+			"func Decode%s(r io.Reader) (image.Image, error) {\n"+
+			"return decode(New%sDecoder(r))\n}\n\n",
+			goName, pkgName, structName, goName, goName)
+
+		fmt.Fprintf(buf, "// DecodeConfig%s returns the color model and dimensions of an image,\n"+
+			"// using Wuffs' %s.%s, without decoding the entire image.\n"+
+			"// Its signature matches what image.RegisterFormat expects.\n"+
+			"func DecodeConfig%s(r io.Reader) (image.Config, error) {\n"+
+			"return decodeConfig(New%sDecoder(r))\n}\n\n",
+			goName, pkgName, structName, goName, goName)
+
+		fmt.Fprintf(buf, "// New%sDecoder returns a Decoder that uses Wuffs' %s.%s.\n"+
+			"// Any error is deferred until the first method call on the Decoder.\n"+
+			"func New%sDecoder(r io.Reader) *Decoder {\n"+
+			"return newDecoder(r, C.%s__alloc_as__wuffs_base__image_decoder())\n}\n\n",
+			goName, pkgName, structName, goName, cName)
+	}
+	return nil
+}
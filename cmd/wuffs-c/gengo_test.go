@@ -0,0 +1,213 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/generate"
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func stdFilenames(tt *testing.T, pkgName string) []string {
+	tt.Helper()
+	filenames, err := filepath.Glob(filepath.Join("..", "..", "std", pkgName, "*.wuffs"))
+	if err != nil {
+		tt.Fatalf("Glob: %v", err)
+	} else if len(filenames) == 0 {
+		tt.Fatalf("no std/%s files", pkgName)
+	}
+	return filenames
+}
+
+// parseStd parses and checks the std/pkgName Wuffs package. Used packages are
+// summarized from their std source files instead of "wuffs gen"'s output.
+func parseStd(tt *testing.T, pkgName string) (*t.Map, []*a.File) {
+	tt.Helper()
+	resolveUse := func(usePath string) ([]byte, error) {
+		usePkgName := strings.TrimSuffix(strings.TrimPrefix(usePath, "std/"), ".wuffs")
+		tm := &t.Map{}
+		files, err := generate.ParseFiles(tm, stdFilenames(tt, usePkgName), &parse.Options{
+			AllowDoubleUnderscoreNames: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return generate.Summarize(tm, files)
+	}
+
+	tm := &t.Map{}
+	files, err := generate.ParseFiles(tm, stdFilenames(tt, pkgName), nil)
+	if err != nil {
+		tt.Fatalf("ParseFiles: %v", err)
+	}
+	if _, err := check.Check(tm, files, resolveUse, nil); err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	return tm, files
+}
+
+// gengoTest is a Go test, run against the generated Go package, that compares
+// its decoded images with the standard library's image/gif package.
+const gengoTest = `package wuffsimage
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func toRGBA(m image.Image) *image.RGBA {
+	dst := image.NewRGBA(m.Bounds())
+	draw.Draw(dst, dst.Bounds(), m, m.Bounds().Min, draw.Src)
+	return dst
+}
+
+func TestDecodeGIF(tt *testing.T) {
+	for _, filename := range []string{"bricks-dither.gif", "hat.gif", "hippopotamus.interlaced.gif"} {
+		data, err := ioutil.ReadFile(filepath.Join(testDataDir, filename))
+		if err != nil {
+			tt.Fatalf("ReadFile: %v", err)
+		}
+		want, err := gif.Decode(bytes.NewReader(data))
+		if err != nil {
+			tt.Fatalf("%s: gif.Decode: %v", filename, err)
+		}
+
+		config, err := DecodeConfigGIF(bytes.NewReader(data))
+		if err != nil {
+			tt.Fatalf("%s: DecodeConfigGIF: %v", filename, err)
+		}
+		if b := want.Bounds(); (config.Width != b.Dx()) || (config.Height != b.Dy()) {
+			tt.Fatalf("%s: DecodeConfigGIF: got %dx%d, want %dx%d",
+				filename, config.Width, config.Height, b.Dx(), b.Dy())
+		}
+
+		got, err := DecodeGIF(bytes.NewReader(data))
+		if err != nil {
+			tt.Fatalf("%s: DecodeGIF: %v", filename, err)
+		}
+		if g, w := got.(*image.RGBA), toRGBA(want); !bytes.Equal(g.Pix, w.Pix) {
+			tt.Fatalf("%s: DecodeGIF: pixels differ from image/gif's", filename)
+		}
+	}
+}
+
+func TestDecoderFrames(tt *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join(testDataDir, "animated-red-blue.gif"))
+	if err != nil {
+		tt.Fatalf("ReadFile: %v", err)
+	}
+	want, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		tt.Fatalf("gif.DecodeAll: %v", err)
+	}
+
+	d := NewGIFDecoder(bytes.NewReader(data))
+	defer d.Close()
+	n := 0
+	for ; ; n++ {
+		if _, err := d.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			tt.Fatalf("Next: %v", err)
+		}
+	}
+	if n != len(want.Image) {
+		tt.Fatalf("number of frames: got %d, want %d", n, len(want.Image))
+	}
+}
+`
+
+func TestGengoGIF(tt *testing.T) {
+	if testing.Short() {
+		tt.Skip("skipping test that runs the go tool in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		tt.Skip("skipping test: no go tool")
+	}
+	if out, err := exec.Command(goTool, "env", "CGO_ENABLED").Output(); (err != nil) ||
+		(strings.TrimSpace(string(out)) != "1") {
+		tt.Skip("skipping test: cgo is not enabled")
+	}
+
+	cinclude, err := filepath.Abs(filepath.Join("..", "..", "release", "c", "wuffs-unsupported-snapshot.c"))
+	if err != nil {
+		tt.Fatalf("Abs: %v", err)
+	}
+	testDataDir, err := filepath.Abs(filepath.Join("..", "..", "test", "data"))
+	if err != nil {
+		tt.Fatalf("Abs: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "gengo_test")
+	if err != nil {
+		tt.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	baseSrc, err := gengo("base", nil, nil, cinclude, "wuffsimage")
+	if err != nil {
+		tt.Fatalf("gengo base: %v", err)
+	}
+	tm, files := parseStd(tt, "gif")
+	gifSrc, err := gengo("gif", tm, files, cinclude, "wuffsimage")
+	if err != nil {
+		tt.Fatalf("gengo gif: %v", err)
+	}
+	testSrc := gengoTest + "\nconst testDataDir = " + `"` + filepath.ToSlash(testDataDir) + `"` + "\n"
+
+	for filename, src := range map[string][]byte{
+		"go.mod":             []byte("module wuffsimage\n"),
+		"base.go":            baseSrc,
+		"gif.go":             gifSrc,
+		"wuffsimage_test.go": []byte(testSrc),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, filename), src, 0644); err != nil {
+			tt.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	cmd := exec.Command(goTool, "test", "./...")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GO111MODULE=on", "CGO_ENABLED=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		tt.Fatalf("go test: %v\n%s", err, out)
+	}
+}
+
+func TestGengoRejectsNonImageDecoderPackages(tt *testing.T) {
+	tm, files := parseStd(tt, "crc32")
+	if _, err := gengo("crc32", tm, files, "wuffs.c", "wuffsimage"); err == nil {
+		tt.Fatalf("gengo: got nil error, want a base.image_decoder error")
+	} else if !strings.Contains(err.Error(), "base.image_decoder") {
+		tt.Fatalf("gengo: got %q, want a base.image_decoder error", err)
+	}
+}
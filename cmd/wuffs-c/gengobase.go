@@ -0,0 +1,482 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// gengoBase is the "wuffs-c gengo -package_name=base" output, after replacing
+// WUFFS_GENGO_CINCLUDE and WUFFS_GENGO_GOPACKAGE.
+//
+// The decoding loop is similar to example/convert-to-nia's, other than that
+// the decoded frames are Go image.RGBA values instead of NIA/NIE bytes.
+const gengoBase = `// Package WUFFS_GENGO_GOPACKAGE wraps, via cgo, Wuffs' C image decoders.
+//
+// The DecodeFoo and DecodeConfigFoo functions (for image formats Foo) can be
+// passed to the image.RegisterFormat function in the Go standard library. The
+// Decoder type gives access to every frame of an animated image.
+//
+// Decoded images are always *image.RGBA values (with premultiplied alpha),
+// regardless of the source image's pixel format.
+package WUFFS_GENGO_GOPACKAGE
+
+/*
+#define WUFFS_IMPLEMENTATION
+#include "WUFFS_GENGO_CINCLUDE"
+
+#include <stdlib.h>
+#include <string.h>
+
+#define WUFFS_GENGO__OK 0
+#define WUFFS_GENGO__SHORT_READ 1
+#define WUFFS_GENGO__END_OF_DATA 2
+#define WUFFS_GENGO__ERROR 3
+
+typedef struct {
+  wuffs_base__image_decoder* dec;
+  wuffs_base__io_buffer src;
+  wuffs_base__image_config image_config;
+  wuffs_base__frame_config frame_config;
+  wuffs_base__pixel_buffer pixbuf;
+  wuffs_base__slice_u8 pixbuf_slice;
+  wuffs_base__slice_u8 backup_slice;
+  wuffs_base__slice_u8 workbuf_slice;
+  const char* message;
+} wuffs_gengo__state;
+
+static int  //
+wuffs_gengo__classify(wuffs_gengo__state* s, wuffs_base__status status) {
+  if (status.repr == NULL) {
+    return WUFFS_GENGO__OK;
+  } else if (status.repr == wuffs_base__suspension__short_read) {
+    return WUFFS_GENGO__SHORT_READ;
+  } else if (status.repr == wuffs_base__note__end_of_data) {
+    return WUFFS_GENGO__END_OF_DATA;
+  }
+  s->message = wuffs_base__status__message(&status);
+  if (!s->message) {
+    s->message = "wuffs: unexpected status";
+  }
+  return WUFFS_GENGO__ERROR;
+}
+
+static wuffs_gengo__state*  //
+wuffs_gengo__state__new(wuffs_base__image_decoder* dec, size_t src_len) {
+  if (!dec) {
+    return NULL;
+  }
+  wuffs_gengo__state* s = calloc(1, sizeof(wuffs_gengo__state));
+  uint8_t* src_ptr = malloc(src_len);
+  if (!s || !src_ptr) {
+    free(s);
+    free(src_ptr);
+    free(dec);
+    return NULL;
+  }
+  s->dec = dec;
+  s->src = wuffs_base__ptr_u8__writer(src_ptr, src_len);
+  return s;
+}
+
+static void  //
+wuffs_gengo__state__free(wuffs_gengo__state* s) {
+  free(s->dec);
+  free(s->src.data.ptr);
+  free(s->pixbuf_slice.ptr);
+  free(s->backup_slice.ptr);
+  free(s->workbuf_slice.ptr);
+  free(s);
+}
+
+static int  //
+wuffs_gengo__state__decode_image_config(wuffs_gengo__state* s) {
+  wuffs_base__status status = wuffs_base__image_decoder__decode_image_config(
+      s->dec, &s->image_config, &s->src);
+  if (status.repr == wuffs_base__note__i_o_redirect) {
+    s->message = "wuffs: unsupported I/O redirect";
+    return WUFFS_GENGO__ERROR;
+  }
+  return wuffs_gengo__classify(s, status);
+}
+
+// wuffs_gengo__state__allocate sets the pixel format to RGBA_PREMUL and
+// allocates the pixel and work buffers.
+static int  //
+wuffs_gengo__state__allocate(wuffs_gengo__state* s) {
+  uint32_t w = wuffs_base__pixel_config__width(&s->image_config.pixcfg);
+  uint32_t h = wuffs_base__pixel_config__height(&s->image_config.pixcfg);
+  wuffs_base__pixel_config__set(&s->image_config.pixcfg,
+                                WUFFS_BASE__PIXEL_FORMAT__RGBA_PREMUL,
+                                WUFFS_BASE__PIXEL_SUBSAMPLING__NONE, w, h);
+
+  uint64_t pixbuf_len = ((uint64_t)w) * ((uint64_t)h) * 4;
+  uint64_t workbuf_len =
+      wuffs_base__image_decoder__workbuf_len(s->dec).max_incl;
+  if ((pixbuf_len > SIZE_MAX) || (workbuf_len > SIZE_MAX)) {
+    s->message = "wuffs: image is too large";
+    return WUFFS_GENGO__ERROR;
+  }
+  s->pixbuf_slice.ptr = calloc(1, pixbuf_len ? pixbuf_len : 1);
+  s->pixbuf_slice.len = pixbuf_len;
+  s->workbuf_slice.ptr = malloc(workbuf_len ? workbuf_len : 1);
+  s->workbuf_slice.len = workbuf_len;
+  if (!s->pixbuf_slice.ptr || !s->workbuf_slice.ptr) {
+    s->message = "wuffs: out of memory";
+    return WUFFS_GENGO__ERROR;
+  }
+
+  wuffs_base__status status = wuffs_base__pixel_buffer__set_from_slice(
+      &s->pixbuf, &s->image_config.pixcfg, s->pixbuf_slice);
+  return wuffs_gengo__classify(s, status);
+}
+
+static int  //
+wuffs_gengo__state__decode_frame_config(wuffs_gengo__state* s) {
+  wuffs_base__status status = wuffs_base__image_decoder__decode_frame_config(
+      s->dec, &s->frame_config, &s->src);
+  return wuffs_gengo__classify(s, status);
+}
+
+static void  //
+wuffs_gengo__state__fill_rect(wuffs_gengo__state* s,
+                              wuffs_base__rect_ie_u32 rect,
+                              wuffs_base__color_u32_argb_premul color) {
+  rect = wuffs_base__rect_ie_u32__intersect(
+      &rect, wuffs_base__pixel_config__bounds(&s->image_config.pixcfg));
+  uint8_t rgba[4];
+  rgba[0] = (uint8_t)(color >> 16);
+  rgba[1] = (uint8_t)(color >> 8);
+  rgba[2] = (uint8_t)(color >> 0);
+  rgba[3] = (uint8_t)(color >> 24);
+  wuffs_base__table_u8 tab = wuffs_base__pixel_buffer__plane(&s->pixbuf, 0);
+  uint32_t y;
+  for (y = rect.min_incl_y; y < rect.max_excl_y; y++) {
+    uint8_t* p = tab.ptr + (y * tab.stride) + (rect.min_incl_x * 4);
+    uint32_t x;
+    for (x = rect.min_incl_x; x < rect.max_excl_x; x++) {
+      memcpy(p, rgba, 4);
+      p += 4;
+    }
+  }
+}
+
+// wuffs_gengo__state__before_frame prepares the pixel buffer (the canvas) for
+// the frame whose wuffs_base__frame_config was just decoded.
+static int  //
+wuffs_gengo__state__before_frame(wuffs_gengo__state* s) {
+  if (wuffs_base__frame_config__index(&s->frame_config) == 0) {
+    wuffs_gengo__state__fill_rect(
+        s, wuffs_base__pixel_config__bounds(&s->image_config.pixcfg),
+        wuffs_base__frame_config__background_color(&s->frame_config));
+  }
+  if (wuffs_base__frame_config__disposal(&s->frame_config) ==
+      WUFFS_BASE__ANIMATION_DISPOSAL__RESTORE_PREVIOUS) {
+    if (!s->backup_slice.ptr) {
+      s->backup_slice.ptr = malloc(s->pixbuf_slice.len ? s->pixbuf_slice.len : 1);
+      s->backup_slice.len = s->pixbuf_slice.len;
+      if (!s->backup_slice.ptr) {
+        s->message = "wuffs: out of memory";
+        return WUFFS_GENGO__ERROR;
+      }
+    }
+    memcpy(s->backup_slice.ptr, s->pixbuf_slice.ptr, s->pixbuf_slice.len);
+  }
+  return WUFFS_GENGO__OK;
+}
+
+static int  //
+wuffs_gengo__state__decode_frame(wuffs_gengo__state* s) {
+  wuffs_base__status status = wuffs_base__image_decoder__decode_frame(
+      s->dec, &s->pixbuf, &s->src,
+      wuffs_base__frame_config__overwrite_instead_of_blend(&s->frame_config)
+          ? WUFFS_BASE__PIXEL_BLEND__SRC
+          : WUFFS_BASE__PIXEL_BLEND__SRC_OVER,
+      s->workbuf_slice, NULL);
+  return wuffs_gengo__classify(s, status);
+}
+
+// wuffs_gengo__state__after_frame applies the frame's disposal, after the
+// composited canvas was copied out of the pixel buffer.
+static void  //
+wuffs_gengo__state__after_frame(wuffs_gengo__state* s) {
+  switch (wuffs_base__frame_config__disposal(&s->frame_config)) {
+    case WUFFS_BASE__ANIMATION_DISPOSAL__RESTORE_BACKGROUND:
+      wuffs_gengo__state__fill_rect(
+          s, wuffs_base__frame_config__bounds(&s->frame_config),
+          wuffs_base__frame_config__background_color(&s->frame_config));
+      break;
+    case WUFFS_BASE__ANIMATION_DISPOSAL__RESTORE_PREVIOUS:
+      memcpy(s->pixbuf_slice.ptr, s->backup_slice.ptr, s->pixbuf_slice.len);
+      break;
+  }
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"runtime"
+	"time"
+	"unsafe"
+)
+
+const (
+	// srcLen is the size of the C buffer that holds bytes read from the
+	// io.Reader but not yet consumed by the C image decoder.
+	srcLen = 64 * 1024
+
+	// maxPixbufLen is the maximum size, in bytes, of a decoded frame.
+	maxPixbufLen = 1 << 30
+
+	// flicksPerSecond is the number of flicks (Wuffs' unit of time, for
+	// animation frame durations) in one second.
+	flicksPerSecond = 705600000
+)
+
+var (
+	errClosed          = errors.New("wuffs: Decoder is closed")
+	errOutOfMemory     = errors.New("wuffs: out of memory")
+	errSrcBufferIsFull = errors.New("wuffs: source buffer is full")
+)
+
+// Frame is a decoded animation frame. A still (non-animated) image has exactly
+// one frame.
+type Frame struct {
+	// Image is the whole canvas, as of after this frame was composited onto
+	// the previous frames. It does not alias any later Frame's Image.
+	Image *image.RGBA
+
+	// Bounds is the part of the canvas that this frame updated.
+	Bounds image.Rectangle
+
+	// Duration is how long this frame should be displayed for.
+	Duration time.Duration
+}
+
+// Decoder decodes an image, possibly animated, one frame at a time. It holds C
+// memory, so call Close when done with it.
+type Decoder struct {
+	r     io.Reader
+	state *C.wuffs_gengo__state
+	err   error
+
+	configDecoded bool
+	allocated     bool
+	config        image.Config
+}
+
+func newDecoder(r io.Reader, dec *C.wuffs_base__image_decoder) *Decoder {
+	d := &Decoder{
+		r:     r,
+		state: C.wuffs_gengo__state__new(dec, srcLen),
+	}
+	if d.state == nil {
+		d.err = errOutOfMemory
+		return d
+	}
+	runtime.SetFinalizer(d, (*Decoder).Close)
+	return d
+}
+
+// Close frees the Decoder's C memory. Calling any other method after Close
+// returns an error.
+func (d *Decoder) Close() error {
+	if d.state != nil {
+		C.wuffs_gengo__state__free(d.state)
+		d.state = nil
+		runtime.SetFinalizer(d, nil)
+	}
+	if d.err == nil {
+		d.err = errClosed
+	}
+	return nil
+}
+
+// Config returns the image's color model and dimensions.
+func (d *Decoder) Config() (image.Config, error) {
+	if err := d.decodeConfig(); err != nil {
+		return image.Config{}, err
+	}
+	return d.config, nil
+}
+
+// NumAnimationLoops returns the number of times that an animated image should
+// be played. Zero means to loop forever.
+//
+// Its value is only guaranteed to be valid after Next has returned io.EOF.
+func (d *Decoder) NumAnimationLoops() (int, error) {
+	if err := d.decodeConfig(); err != nil {
+		return 0, err
+	}
+	return int(C.wuffs_base__image_decoder__num_animation_loops(d.state.dec)), nil
+}
+
+// Next decodes the next frame. It returns io.EOF after the last frame.
+func (d *Decoder) Next() (*Frame, error) {
+	if err := d.decodeConfig(); err != nil {
+		return nil, err
+	} else if d.err != nil {
+		return nil, d.err
+	}
+	if !d.allocated {
+		d.allocated = true
+		if err := d.check(C.wuffs_gengo__state__allocate(d.state)); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		code := C.wuffs_gengo__state__decode_frame_config(d.state)
+		if code == C.WUFFS_GENGO__END_OF_DATA {
+			d.err = io.EOF
+			return nil, d.err
+		} else if code != C.WUFFS_GENGO__SHORT_READ {
+			if err := d.check(code); err != nil {
+				return nil, err
+			}
+			break
+		} else if err := d.readMore(); err != nil {
+			return nil, err
+		}
+	}
+
+	fc := &d.state.frame_config
+	flicks := int64(C.wuffs_base__frame_config__duration(fc))
+	r := C.wuffs_base__frame_config__bounds(fc)
+	f := &Frame{
+		Bounds: image.Rect(
+			int(r.min_incl_x), int(r.min_incl_y), int(r.max_excl_x), int(r.max_excl_y)),
+		Duration: (time.Duration(flicks/flicksPerSecond) * time.Second) +
+			time.Duration((flicks%flicksPerSecond)*1e9/flicksPerSecond),
+	}
+
+	if err := d.check(C.wuffs_gengo__state__before_frame(d.state)); err != nil {
+		return nil, err
+	}
+	for {
+		code := C.wuffs_gengo__state__decode_frame(d.state)
+		if code != C.WUFFS_GENGO__SHORT_READ {
+			if err := d.check(code); err != nil {
+				return nil, err
+			}
+			break
+		} else if err := d.readMore(); err != nil {
+			return nil, err
+		}
+	}
+
+	w, h := d.config.Width, d.config.Height
+	pix := make([]byte, 4*w*h)
+	copy(pix, (*[maxPixbufLen]byte)(unsafe.Pointer(d.state.pixbuf_slice.ptr))[:len(pix):len(pix)])
+	f.Image = &image.RGBA{
+		Pix:    pix,
+		Stride: 4 * w,
+		Rect:   image.Rect(0, 0, w, h),
+	}
+	C.wuffs_gengo__state__after_frame(d.state)
+	return f, nil
+}
+
+func (d *Decoder) decodeConfig() error {
+	if d.state == nil {
+		return d.err
+	} else if d.configDecoded {
+		return nil
+	} else if d.err != nil {
+		return d.err
+	}
+	for {
+		code := C.wuffs_gengo__state__decode_image_config(d.state)
+		if code != C.WUFFS_GENGO__SHORT_READ {
+			if err := d.check(code); err != nil {
+				return err
+			}
+			break
+		} else if err := d.readMore(); err != nil {
+			return err
+		}
+	}
+	pixcfg := &d.state.image_config.pixcfg
+	w := uint64(C.wuffs_base__pixel_config__width(pixcfg))
+	h := uint64(C.wuffs_base__pixel_config__height(pixcfg))
+	if (w > 0xFFFFFF) || (h > 0xFFFFFF) || ((w * h) > (maxPixbufLen / 4)) {
+		d.err = errors.New("wuffs: image is too large")
+		return d.err
+	}
+	d.configDecoded = true
+	d.config = image.Config{
+		ColorModel: color.RGBAModel,
+		Width:      int(w),
+		Height:     int(h),
+	}
+	return nil
+}
+
+// check converts a WUFFS_GENGO__ETC code to an error, which is sticky.
+func (d *Decoder) check(code C.int) error {
+	switch code {
+	case C.WUFFS_GENGO__OK:
+		return nil
+	case C.WUFFS_GENGO__END_OF_DATA:
+		d.err = io.ErrUnexpectedEOF
+	case C.WUFFS_GENGO__SHORT_READ:
+		d.err = io.ErrUnexpectedEOF
+	default:
+		d.err = errors.New(C.GoString(d.state.message))
+	}
+	return d.err
+}
+
+// readMore compacts the C source buffer and then fills it (partially) from the
+// io.Reader.
+func (d *Decoder) readMore() error {
+	src := &d.state.src
+	if src.meta.closed {
+		d.err = io.ErrUnexpectedEOF
+		return d.err
+	}
+	C.wuffs_base__io_buffer__compact(src)
+	if src.meta.wi >= src.data.len {
+		d.err = errSrcBufferIsFull
+		return d.err
+	}
+	buf := (*[srcLen]byte)(unsafe.Pointer(src.data.ptr))[src.meta.wi:src.data.len]
+	n, err := d.r.Read(buf)
+	src.meta.wi += C.size_t(n)
+	if err == io.EOF {
+		src.meta.closed = true
+	} else if err != nil {
+		d.err = err
+		return d.err
+	}
+	return nil
+}
+
+func decode(d *Decoder) (image.Image, error) {
+	defer d.Close()
+	f, err := d.Next()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+	return f.Image, nil
+}
+
+func decodeConfig(d *Decoder) (image.Config, error) {
+	defer d.Close()
+	return d.Config()
+}
+`
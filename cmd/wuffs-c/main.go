@@ -22,11 +22,14 @@ import (
 	"os"
 
 	"github.com/google/wuffs/internal/cgen"
+	"github.com/google/wuffs/lang/diagnostic"
 )
 
 func main() {
 	if err := main1(); err != nil {
-		os.Stderr.WriteString(err.Error() + "\n")
+		if err != diagnostic.ErrReported {
+			os.Stderr.WriteString(err.Error() + "\n")
+		}
 		os.Exit(1)
 	}
 }
@@ -43,6 +46,8 @@ func main1() error {
 		return cgen.Do(args)
 	case "genlib":
 		return doGenlib(args)
+	case "gengo":
+		return doGengo(args)
 	case "genrelease":
 		return doGenrelease(args)
 	case "test":
@@ -0,0 +1,105 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// This file mangles a single file release so that it can be vendored
+// alongside other, independently generated, Wuffs releases, even in the same
+// translation unit (a "unity build"). With a prefix "acme", every "wuffs_" or
+// "WUFFS_" identifier becomes "acme_wuffs_" or "ACME_WUFFS_". This covers
+// every C function, type, global variable and macro, the include guard and
+// the C++ namespaces. It also covers the configuration macros, so that a
+// mangled release is configured by e.g. "ACME_WUFFS_IMPLEMENTATION" instead
+// of "WUFFS_IMPLEMENTATION".
+//
+// The mangled release also #define's "ACME_WUFFS_CONFIG__STATIC_FUNCTIONS",
+// giving every function internal linkage. The remaining global variables
+// (such as status message strings) still have external linkage, as they are
+// declared before they are defined, but their names are uniquely prefixed.
+
+import (
+	"bytes"
+	"fmt"
+)
+
+var (
+	mgLower = []byte("wuffs_")
+	mgUpper = []byte("WUFFS_")
+)
+
+// checkManglePrefix returns an error if prefix is not a valid -mangleprefix:
+// a lower case ASCII letter followed by lower case ASCII letters, digits or
+// underscores.
+func checkManglePrefix(prefix string) error {
+	for i := 0; i < len(prefix); i++ {
+		c := prefix[i]
+		if ('a' <= c) && (c <= 'z') {
+			continue
+		} else if (i > 0) && ((('0' <= c) && (c <= '9')) || (c == '_')) {
+			continue
+		}
+		return fmt.Errorf("bad -mangleprefix flag value %q", prefix)
+	}
+	return nil
+}
+
+// mangleRelease returns src, a single file release, with every "wuffs_" and
+// "WUFFS_" identifier prefixed by prefix (in lower or upper case). An
+// identifier is also mangled when it follows "__", as in the generated
+// "sizeof__wuffs_foo__bar" functions and "vtable_for__wuffs_etc" fields.
+func mangleRelease(src []byte, prefix string) []byte {
+	lower := []byte(prefix + "_")
+	upper := bytes.ToUpper(lower)
+
+	dst := make([]byte, 0, len(src)+len(src)/16)
+	for i := 0; i < len(src); {
+		if mgIsIdentifierStart(src, i) {
+			if bytes.HasPrefix(src[i:], mgLower) {
+				dst = append(dst, lower...)
+			} else if bytes.HasPrefix(src[i:], mgUpper) {
+				dst = append(dst, upper...)
+			}
+		}
+		dst = append(dst, src[i])
+		i++
+	}
+
+	// Give every function internal linkage, just inside the include guard.
+	guard := append(append([]byte("#define "), upper...), "WUFFS_INCLUDE_GUARD\n"...)
+	if i := bytes.Index(dst, guard); i >= 0 {
+		i += len(guard)
+		static := append(append([]byte("\n#define "), upper...), "WUFFS_CONFIG__STATIC_FUNCTIONS\n"...)
+		dst = append(dst[:i], append(static, dst[i:]...)...)
+	}
+	return dst
+}
+
+// mgIsIdentifierStart returns whether a "wuffs_" or "WUFFS_" at src[i] would
+// start a (possibly nested) Wuffs identifier: it does not follow another
+// identifier byte, other than a "__" separator.
+func mgIsIdentifierStart(src []byte, i int) bool {
+	if i == 0 {
+		return true
+	} else if !mgIsIdentifierByte(src[i-1]) {
+		return true
+	}
+	return (i >= 2) && (src[i-1] == '_') && (src[i-2] == '_')
+}
+
+func mgIsIdentifierByte(c byte) bool {
+	return (('0' <= c) && (c <= '9')) ||
+		(('A' <= c) && (c <= 'Z')) ||
+		(('a' <= c) && (c <= 'z')) ||
+		(c == '_')
+}
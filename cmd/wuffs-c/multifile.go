@@ -0,0 +1,351 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// This file splits a single file release into a multi-file release: a
+// dispatch file (the single file release, minus any CPU architecture specific
+// function definitions) and one file per CPU architecture, such as
+// "x86_sse42", holding those function definitions.
+//
+// The split is guided by "‼ WUFFS MULTI-FILE SECTION" markers. A section
+// named after a CPU architecture (e.g. "+x86_sse42" ... "-x86_sse42") is moved
+// to that architecture's file, leaving only function prototypes behind. A
+// section named "shared" (e.g. private helper functions and consts) is copied
+// to every architecture's file. Each section is copied along with any
+// enclosing #if directives, such as WUFFS_CONFIG__MODULE__ETC guards.
+//
+// Functions are "static" in a single file release. In a multi-file release,
+// the moved functions are defined in a different translation unit to their
+// callers, so they have external linkage instead.
+
+import (
+	"bytes"
+	"fmt"
+)
+
+var (
+	mfHeaderEnds   = []byte("// ‼ WUFFS C HEADER ENDS HERE.\n")
+	mfImplGuard    = []byte("#ifdef WUFFS_IMPLEMENTATION\n")
+	mfSectionStart = []byte("// ‼ WUFFS MULTI-FILE SECTION +")
+	mfSectionEnd   = []byte("// ‼ WUFFS MULTI-FILE SECTION -")
+	mfStatic       = []byte("static ")
+)
+
+// mfSkipImpl is #define'd by the per-architecture files, which need the
+// dispatch file's struct definitions (which require WUFFS_IMPLEMENTATION) but
+// not its implementation.
+const mfSkipImpl = "WUFFS_BASE__MULTI_FILE__SKIP_IMPLEMENTATION"
+
+// mfCompilerFlags are the suggested (GCC or Clang) compiler flags for each CPU
+// architecture's file. They match the WUFFS_BASE__MAYBE_ATTRIBUTE_TARGET
+// arguments in the generated code.
+var mfCompilerFlags = map[string]string{
+	"arm_crc32": "-march=armv8-a+crc",
+	"arm_neon":  "-mfpu=neon",
+	"arm_sve":   "-march=armv8-a+sve",
+	"riscv_v":   "-march=rv64gcv",
+	"x86_sse42": "-mpclmul -mpopcnt -msse4.2",
+}
+
+// mfSection is a "‼ WUFFS MULTI-FILE SECTION".
+type mfSection struct {
+	name string
+	// directives are the enclosing #if (or #ifdef or #ifndef) directives.
+	directives [][]byte
+	lines      [][]byte
+}
+
+// mfFrame is an #if directive (or #ifdef or #ifndef) that is yet to be
+// closed by a matching #endif.
+type mfFrame struct {
+	directive []byte
+	// inElse is whether we are past a matching #else or #elif.
+	inElse bool
+}
+
+// splitMultiFile splits src, a single file release, into a dispatch file and
+// one file per CPU architecture. The per-architecture files #include the
+// dispatch file, whose filename is dispatchFilename.
+func splitMultiFile(src []byte, dispatchFilename string) (dispatch []byte, archFiles map[string][]byte, retErr error) {
+	lines := mfSplitLines(src)
+	dispatchBuf := &bytes.Buffer{}
+	sections := []*mfSection(nil)
+	frames := []mfFrame(nil)
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if !bytes.HasPrefix(line, mfSectionStart) {
+			j := i
+			if err := mfUpdateFrames(&frames, lines, &i); err != nil {
+				return nil, nil, err
+			}
+			for _, line := range lines[j : i+1] {
+				if bytes.Equal(line, mfImplGuard) && (j > 0) && bytes.Equal(lines[j-1], mfHeaderEnds) {
+					line = []byte("#if defined(WUFFS_IMPLEMENTATION) && !defined(" + mfSkipImpl + ")\n")
+				}
+				dispatchBuf.Write(line)
+			}
+			continue
+		}
+
+		s := &mfSection{
+			name: string(bytes.TrimSpace(line[len(mfSectionStart):])),
+		}
+		for _, f := range frames {
+			if f.inElse {
+				return nil, nil, fmt.Errorf("multi-file section %q is inside an #else", s.name)
+			}
+			if mfIsReleaseGuard(f.directive) {
+				continue
+			}
+			s.directives = append(s.directives, f.directive)
+		}
+
+		outerFrames := len(frames)
+		for i++; ; i++ {
+			if i >= len(lines) {
+				return nil, nil, fmt.Errorf("multi-file section %q is not closed", s.name)
+			} else if bytes.HasPrefix(lines[i], mfSectionEnd) {
+				if name := string(bytes.TrimSpace(lines[i][len(mfSectionEnd):])); name != s.name {
+					return nil, nil, fmt.Errorf("multi-file section %q is closed as %q", s.name, name)
+				}
+				break
+			}
+			j := i
+			if err := mfUpdateFrames(&frames, lines, &i); err != nil {
+				return nil, nil, err
+			}
+			s.lines = append(s.lines, lines[j:i+1]...)
+		}
+		if len(frames) != outerFrames {
+			return nil, nil, fmt.Errorf("multi-file section %q has unbalanced #if directives", s.name)
+		}
+		sections = append(sections, s)
+
+		if s.name == "shared" {
+			for _, line := range s.lines {
+				dispatchBuf.Write(line)
+			}
+			continue
+		}
+		prototypes, err := mfPrototypes(s.lines)
+		if err != nil {
+			return nil, nil, fmt.Errorf("multi-file section %q: %v", s.name, err)
+		}
+		for _, line := range prototypes {
+			dispatchBuf.Write(line)
+		}
+	}
+
+	// Give the moved functions external linkage in the dispatch file, where
+	// they may also have (static) prototypes outside of the sections.
+	names := map[string]bool{}
+	for _, s := range sections {
+		if s.name == "shared" {
+			continue
+		}
+		for _, n := range mfFunctionNames(s.lines) {
+			names[n] = true
+		}
+	}
+	dispatch = mfRemoveStatic(mfSplitLines(dispatchBuf.Bytes()), names)
+
+	archFiles = map[string][]byte{}
+	for _, s := range sections {
+		if (s.name == "shared") || (archFiles[s.name] != nil) {
+			continue
+		}
+		archFiles[s.name] = genArchFile(s.name, sections, dispatchFilename)
+	}
+	return dispatch, archFiles, nil
+}
+
+func genArchFile(arch string, sections []*mfSection, dispatchFilename string) []byte {
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "// This file holds the %s specific part of a multi-file Wuffs release.\n", arch)
+	fmt.Fprintf(out, "//\n")
+	fmt.Fprintf(out, "// Compile it with the same WUFFS_CONFIG__ETC macros as %q, plus\n", dispatchFilename)
+	fmt.Fprintf(out, "// the %s compiler flags (such as %q for\n", arch, mfCompilerFlags[arch])
+	fmt.Fprintf(out, "// GCC or Clang), and link it with %q compiled with\n", dispatchFilename)
+	fmt.Fprintf(out, "// WUFFS_IMPLEMENTATION. Whether to call this file's code is decided at run\n")
+	fmt.Fprintf(out, "// time, by CPU feature detection in %q.\n\n", dispatchFilename)
+
+	out.WriteString("#if !defined(WUFFS_IMPLEMENTATION)\n#define WUFFS_IMPLEMENTATION\n#endif\n")
+	out.WriteString("#define " + mfSkipImpl + "\n")
+	fmt.Fprintf(out, "#include \"%s\"\n", dispatchFilename)
+	out.WriteString(grPragmaPush)
+	out.WriteString("#ifdef __cplusplus\nextern \"C\" {\n#endif\n\n")
+
+	for _, s := range sections {
+		if (s.name != "shared") && (s.name != arch) {
+			continue
+		}
+		for _, d := range s.directives {
+			out.Write(d)
+		}
+		lines := s.lines
+		if s.name != "shared" {
+			lines = mfSplitLines(mfRemoveStatic(lines, nil))
+		}
+		for _, line := range lines {
+			out.Write(line)
+		}
+		for i := len(s.directives) - 1; i >= 0; i-- {
+			out.WriteString("#endif\n")
+		}
+		out.WriteString("\n")
+	}
+
+	out.WriteString("#ifdef __cplusplus\n}  // extern \"C\"\n#endif\n")
+	out.WriteString(grPragmaPop)
+	return out.Bytes()
+}
+
+// mfUpdateFrames updates frames for the preprocessor directive (if any) at
+// lines[*i], incrementing *i past any line continuations.
+func mfUpdateFrames(frames *[]mfFrame, lines [][]byte, i *int) error {
+	line := lines[*i]
+	if (len(line) == 0) || (line[0] != '#') {
+		return nil
+	}
+	start := *i
+	for (*i+1 < len(lines)) && bytes.HasSuffix(bytes.TrimRight(lines[*i], "\n"), []byte("\\")) {
+		*i++
+	}
+
+	switch {
+	case bytes.HasPrefix(line, []byte("#if")):
+		*frames = append(*frames, mfFrame{directive: bytes.Join(lines[start:*i+1], nil)})
+	case bytes.HasPrefix(line, []byte("#el")):
+		if len(*frames) == 0 {
+			return fmt.Errorf("unbalanced #else or #elif")
+		}
+		(*frames)[len(*frames)-1].inElse = true
+	case bytes.HasPrefix(line, []byte("#endif")):
+		if len(*frames) == 0 {
+			return fmt.Errorf("unbalanced #endif")
+		}
+		*frames = (*frames)[:len(*frames)-1]
+	}
+	return nil
+}
+
+// mfIsReleaseGuard returns whether directive is the single file release's
+// include guard or implementation guard. The per-architecture files provide
+// their own equivalents.
+func mfIsReleaseGuard(directive []byte) bool {
+	s := string(bytes.TrimSpace(directive))
+	return (s == "#ifndef WUFFS_INCLUDE_GUARD") || (s == "#ifdef WUFFS_IMPLEMENTATION")
+}
+
+// mfPrototypes returns a section's lines with every function definition
+// replaced by its prototype. A function definition starts with a "static etc"
+// line, then a "name(etc" line and ends with a "}" line.
+func mfPrototypes(lines [][]byte) (prototypes [][]byte, retErr error) {
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if !bytes.HasPrefix(line, mfStatic) || (i+1 >= len(lines)) || (mfFunctionName(lines[i+1]) == "") {
+			prototypes = append(prototypes, line)
+			continue
+		}
+
+		// Find the end of the signature.
+		j := i + 1
+		for ; (j < len(lines)) && !bytes.HasSuffix(lines[j], []byte("{\n")); j++ {
+			if bytes.HasSuffix(lines[j], []byte(";\n")) {
+				break
+			}
+		}
+		if j == len(lines) {
+			return nil, fmt.Errorf("could not find the end of %s's signature", mfFunctionName(lines[i+1]))
+		}
+		prototypes = append(prototypes, lines[i:j]...)
+		if bytes.HasSuffix(lines[j], []byte(";\n")) {
+			prototypes = append(prototypes, lines[j])
+			i = j
+			continue
+		}
+		sig := bytes.TrimRight(lines[j][:len(lines[j])-2], " ")
+		prototypes = append(prototypes, append(append([]byte(nil), sig...), ";\n"...))
+
+		// Skip the function body.
+		for j++; (j < len(lines)) && (string(lines[j]) != "}\n"); j++ {
+		}
+		if j == len(lines) {
+			return nil, fmt.Errorf("could not find the end of %s's body", mfFunctionName(lines[i+1]))
+		}
+		i = j
+	}
+	return prototypes, nil
+}
+
+// mfFunctionName returns the "name" in a "name(etc" line, or "" if line
+// doesn't look like that.
+func mfFunctionName(line []byte) string {
+	i := bytes.IndexByte(line, '(')
+	if i <= 0 {
+		return ""
+	}
+	for _, c := range line[:i] {
+		if !(('0' <= c && c <= '9') || ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || (c == '_')) {
+			return ""
+		}
+	}
+	return string(line[:i])
+}
+
+// mfFunctionNames returns the names of the functions (or function prototypes)
+// in lines.
+func mfFunctionNames(lines [][]byte) (names []string) {
+	for i := 0; i+1 < len(lines); i++ {
+		if bytes.HasPrefix(lines[i], mfStatic) {
+			if n := mfFunctionName(lines[i+1]); n != "" {
+				names = append(names, n)
+			}
+		}
+	}
+	return names
+}
+
+// mfRemoveStatic removes the "static " from "static etc" lines that are
+// followed by a "name(" line, for every name in names. A nil names means
+// every name.
+func mfRemoveStatic(lines [][]byte, names map[string]bool) []byte {
+	out := &bytes.Buffer{}
+	for i, line := range lines {
+		if bytes.HasPrefix(line, mfStatic) && (i+1 < len(lines)) {
+			if n := mfFunctionName(lines[i+1]); (n != "") && ((names == nil) || names[n]) {
+				line = line[len(mfStatic):]
+			}
+		}
+		out.Write(line)
+	}
+	return out.Bytes()
+}
+
+// mfSplitLines splits s into lines, each including its trailing '\n' (if any).
+func mfSplitLines(s []byte) [][]byte {
+	lines := [][]byte(nil)
+	for len(s) > 0 {
+		i := bytes.IndexByte(s, '\n')
+		if i < 0 {
+			lines = append(lines, s)
+			break
+		}
+		lines = append(lines, s[:i+1])
+		s = s[i+1:]
+	}
+	return lines
+}
@@ -0,0 +1,199 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitMultiFile(tt *testing.T) {
+	const sse = "x86_sse42"
+	const fooSSE = "static void\nfoo_sse42(int x) {\n  bar(x);\n}\n"
+
+	testCases := []struct {
+		name string
+		src  string
+		// wantDispatch and wantArch are substrings of the dispatch file and
+		// of the x86_sse42 file. notDispatch must not be in the dispatch file.
+		wantDispatch []string
+		notDispatch  []string
+		wantArch     []string
+		wantErr      string
+	}{{
+		name: "plain section",
+		src: "#ifdef WUFFS_IMPLEMENTATION\n" +
+			"// ‼ WUFFS MULTI-FILE SECTION +x86_sse42\n" +
+			fooSSE +
+			"// ‼ WUFFS MULTI-FILE SECTION -x86_sse42\n" +
+			"#endif\n",
+		wantDispatch: []string{"void\nfoo_sse42(int x);\n"},
+		notDispatch:  []string{"static void\nfoo_sse42", "bar(x);"},
+		wantArch:     []string{"\nvoid\nfoo_sse42(int x) {\n  bar(x);\n}\n"},
+	}, {
+		name: "nested #if",
+		src: "#ifdef WUFFS_IMPLEMENTATION\n" +
+			"#if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__CRC32)\n" +
+			"#if defined(WUFFS_BASE__CPU_ARCH__X86_64)\n" +
+			"// ‼ WUFFS MULTI-FILE SECTION +x86_sse42\n" +
+			fooSSE +
+			"// ‼ WUFFS MULTI-FILE SECTION -x86_sse42\n" +
+			"#endif  // defined(WUFFS_BASE__CPU_ARCH__X86_64)\n" +
+			"#endif  // WUFFS_CONFIG__MODULE__CRC32\n" +
+			"#endif\n",
+		wantDispatch: []string{"void\nfoo_sse42(int x);\n"},
+		wantArch: []string{
+			"#if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__CRC32)\n" +
+				"#if defined(WUFFS_BASE__CPU_ARCH__X86_64)\n" +
+				"void\nfoo_sse42(int x) {\n  bar(x);\n}\n" +
+				"#endif\n#endif\n",
+		},
+	}, {
+		name: "#if inside a section",
+		src: "// ‼ WUFFS MULTI-FILE SECTION +x86_sse42\n" +
+			"#if defined(FOO)\n" +
+			fooSSE +
+			"#endif\n" +
+			"// ‼ WUFFS MULTI-FILE SECTION -x86_sse42\n",
+		wantDispatch: []string{"#if defined(FOO)\nvoid\nfoo_sse42(int x);\n#endif\n"},
+		wantArch:     []string{"#if defined(FOO)\nvoid\nfoo_sse42(int x) {\n"},
+	}, {
+		name: "multi-line #if",
+		src: "#if defined(FOO) || \\\n    defined(BAR)\n" +
+			"// ‼ WUFFS MULTI-FILE SECTION +x86_sse42\n" +
+			fooSSE +
+			"// ‼ WUFFS MULTI-FILE SECTION -x86_sse42\n" +
+			"#endif\n",
+		wantArch: []string{"#if defined(FOO) || \\\n    defined(BAR)\nvoid\nfoo_sse42(int x) {\n"},
+	}, {
+		name: "shared section",
+		src: "// ‼ WUFFS MULTI-FILE SECTION +shared\n" +
+			"static const int table[2] = {3, 4};\n" +
+			"// ‼ WUFFS MULTI-FILE SECTION -shared\n" +
+			"// ‼ WUFFS MULTI-FILE SECTION +x86_sse42\n" +
+			fooSSE +
+			"// ‼ WUFFS MULTI-FILE SECTION -x86_sse42\n",
+		wantDispatch: []string{"static const int table[2] = {3, 4};\n"},
+		wantArch:     []string{"static const int table[2] = {3, 4};\n"},
+	}, {
+		name: "#else before a section",
+		src: "#if defined(FOO)\nint a;\n#else\nint b;\n#endif\n" +
+			"// ‼ WUFFS MULTI-FILE SECTION +x86_sse42\n" +
+			fooSSE +
+			"// ‼ WUFFS MULTI-FILE SECTION -x86_sse42\n",
+		wantDispatch: []string{"#if defined(FOO)\nint a;\n#else\nint b;\n#endif\n"},
+		wantArch:     []string{"\nvoid\nfoo_sse42(int x) {\n"},
+	}, {
+		name: "section inside an #else",
+		src: "#if defined(FOO)\n#else\n" +
+			"// ‼ WUFFS MULTI-FILE SECTION +x86_sse42\n" +
+			fooSSE +
+			"// ‼ WUFFS MULTI-FILE SECTION -x86_sse42\n" +
+			"#endif\n",
+		wantErr: `multi-file section "x86_sse42" is inside an #else`,
+	}, {
+		name: "section inside an #elif",
+		src: "#if defined(FOO)\n#elif defined(BAR)\n" +
+			"// ‼ WUFFS MULTI-FILE SECTION +x86_sse42\n" +
+			fooSSE +
+			"// ‼ WUFFS MULTI-FILE SECTION -x86_sse42\n" +
+			"#endif\n",
+		wantErr: `multi-file section "x86_sse42" is inside an #else`,
+	}, {
+		name:    "unbalanced #endif",
+		src:     "int a;\n#endif\n",
+		wantErr: "unbalanced #endif",
+	}, {
+		name:    "unbalanced #else",
+		src:     "#else\n",
+		wantErr: "unbalanced #else or #elif",
+	}, {
+		name: "unbalanced #endif inside a section",
+		src: "// ‼ WUFFS MULTI-FILE SECTION +x86_sse42\n" +
+			fooSSE +
+			"#endif\n" +
+			"// ‼ WUFFS MULTI-FILE SECTION -x86_sse42\n",
+		wantErr: "unbalanced #endif",
+	}, {
+		name: "guard opened before and closed inside a section",
+		src: "#if defined(FOO)\n" +
+			"// ‼ WUFFS MULTI-FILE SECTION +x86_sse42\n" +
+			fooSSE +
+			"#endif\n" +
+			"// ‼ WUFFS MULTI-FILE SECTION -x86_sse42\n",
+		wantErr: `multi-file section "x86_sse42" has unbalanced #if directives`,
+	}, {
+		name: "guard opened inside and closed after a section",
+		src: "// ‼ WUFFS MULTI-FILE SECTION +x86_sse42\n" +
+			"#if defined(FOO)\n" +
+			fooSSE +
+			"// ‼ WUFFS MULTI-FILE SECTION -x86_sse42\n" +
+			"#endif\n",
+		wantErr: `multi-file section "x86_sse42" has unbalanced #if directives`,
+	}, {
+		name: "unclosed section",
+		src: "// ‼ WUFFS MULTI-FILE SECTION +x86_sse42\n" +
+			fooSSE,
+		wantErr: `multi-file section "x86_sse42" is not closed`,
+	}, {
+		name: "mismatched section",
+		src: "// ‼ WUFFS MULTI-FILE SECTION +x86_sse42\n" +
+			fooSSE +
+			"// ‼ WUFFS MULTI-FILE SECTION -arm_neon\n",
+		wantErr: `multi-file section "x86_sse42" is closed as "arm_neon"`,
+	}}
+
+	for _, tc := range testCases {
+		dispatch, archFiles, err := splitMultiFile([]byte(tc.src), "wuffs.c")
+		if tc.wantErr != "" {
+			if err == nil {
+				tt.Errorf("%s: got nil error, want %q", tc.name, tc.wantErr)
+			} else if err.Error() != tc.wantErr {
+				tt.Errorf("%s: got error %q, want %q", tc.name, err, tc.wantErr)
+			}
+			continue
+		} else if err != nil {
+			tt.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+
+		for _, s := range tc.wantDispatch {
+			if !strings.Contains(string(dispatch), s) {
+				tt.Errorf("%s: dispatch file does not contain %q:\n%s", tc.name, s, dispatch)
+			}
+		}
+		for _, s := range tc.notDispatch {
+			if strings.Contains(string(dispatch), s) {
+				tt.Errorf("%s: dispatch file contains %q:\n%s", tc.name, s, dispatch)
+			}
+		}
+		if len(archFiles) != 1 {
+			tt.Errorf("%s: got %d architecture files, want 1", tc.name, len(archFiles))
+			continue
+		}
+		arch := string(archFiles[sse])
+		if !strings.Contains(arch, "#include \"wuffs.c\"\n") {
+			tt.Errorf("%s: %s file does not #include the dispatch file", tc.name, sse)
+		}
+		for _, s := range tc.wantArch {
+			if !strings.Contains(arch, s) {
+				tt.Errorf("%s: %s file does not contain %q:\n%s", tc.name, sse, s, arch)
+			}
+		}
+		if strings.Contains(arch, "WUFFS_INCLUDE_GUARD") || strings.Contains(arch, "#ifdef WUFFS_IMPLEMENTATION") {
+			tt.Errorf("%s: %s file copied a release guard", tc.name, sse)
+		}
+	}
+}
@@ -33,7 +33,12 @@ func doGenrelease(args []string) error {
 	flags := flag.FlagSet{}
 	commitDateFlag := flags.String("commitdate", "", "git commit date the release was built from")
 	gitRevListCountFlag := flags.Int("gitrevlistcount", 0, `git "rev-list --count" that the release was built from`)
+	mangleprefixFlag := flags.String("mangleprefix", "", `if non-empty, prefix every "wuffs_" and "WUFFS_" identifier (e.g. "acme" gives "acme_wuffs_" and "ACME_WUFFS_") and make every function static`)
+	multifileFlag := flags.String("multifile", "", `if non-empty, write a multi-file release (instead of a single file to stdout): a dispatch file named multifile+".c" and per-CPU-architecture files named multifile+"--"+arch+".c"`)
+	packageFlag := flags.String("package", "", `if non-empty, only release that std package (e.g. "gif") and the packages it depends on`)
 	revisionFlag := flags.String("revision", "", "git revision the release was built from")
+	splitheaderFlag := flags.String("splitheader", "", `if non-empty, write a header and implementation pair (instead of a single file to stdout): a header named splitheader+".h" and an implementation file named splitheader+".c"`)
+	splitmodulesFlag := flags.Bool("splitmodules", false, `with -splitheader, write one implementation file per module, named splitheader+"--"+module+".c", instead of splitheader+".c"`)
 	versionFlag := flags.String("version", cf.VersionDefault, cf.VersionUsage)
 
 	if err := flags.Parse(args); err != nil {
@@ -48,6 +53,21 @@ func doGenrelease(args []string) error {
 	if !cf.IsAlphaNumericIsh(*revisionFlag) {
 		return fmt.Errorf("bad -revision flag value %q", *revisionFlag)
 	}
+	if err := checkManglePrefix(*mangleprefixFlag); err != nil {
+		return err
+	}
+	if *splitheaderFlag != "" {
+		if *mangleprefixFlag != "" {
+			return fmt.Errorf("-splitheader is not supported with -mangleprefix")
+		} else if *multifileFlag != "" {
+			return fmt.Errorf("-splitheader is not supported with -multifile")
+		}
+	} else if *splitmodulesFlag {
+		return fmt.Errorf("-splitmodules requires -splitheader")
+	}
+	if !cf.IsAlphaNumericIsh(*packageFlag) {
+		return fmt.Errorf("bad -package flag value %q", *packageFlag)
+	}
 	v, ok := cf.ParseVersion(*versionFlag)
 	if !ok {
 		return fmt.Errorf("bad -version flag value %q", *versionFlag)
@@ -94,6 +114,19 @@ func doGenrelease(args []string) error {
 	}
 	sort.Strings(h.filesList)
 
+	// The C++ auxiliary code for e.g. "std/json" requires that package, so a
+	// single package release only has the base package's auxiliary code.
+	auxNonBaseHhFiles := data.AuxNonBaseHhFiles
+	auxNonBaseCcFiles := data.AuxNonBaseCcFiles
+	if *packageFlag != "" {
+		relFilename := "wuffs-std-" + *packageFlag + ".c"
+		if _, ok := h.filesMap[relFilename]; !ok {
+			return fmt.Errorf("could not find %q for the -package flag", relFilename)
+		}
+		h.filesList = []string{relFilename}
+		auxNonBaseHhFiles, auxNonBaseCcFiles = nil, nil
+	}
+
 	out := bytes.NewBuffer(nil)
 	out.WriteString("#ifndef WUFFS_INCLUDE_GUARD\n")
 	out.WriteString("#define WUFFS_INCLUDE_GUARD\n\n")
@@ -110,7 +143,7 @@ func doGenrelease(args []string) error {
 	out.WriteString("#if defined(__cplusplus) && defined(WUFFS_BASE__HAVE_UNIQUE_PTR)\n\n")
 	out.WriteString(data.AuxBaseHh)
 	out.WriteString("\n")
-	for _, f := range data.AuxNonBaseHhFiles {
+	for _, f := range auxNonBaseHhFiles {
 		out.WriteString(f)
 		out.WriteString("\n")
 	}
@@ -126,20 +159,49 @@ func doGenrelease(args []string) error {
 		}
 	}
 
-	out.WriteString("#if defined(__cplusplus) && defined(WUFFS_BASE__HAVE_UNIQUE_PTR)\n\n")
-	out.WriteString(data.AuxBaseCc)
-	out.WriteString("\n")
-	for _, f := range data.AuxNonBaseCcFiles {
-		out.WriteString(f)
-		out.WriteString("\n")
+	auxCc := bytes.NewBuffer(nil)
+	auxCc.WriteString("#if defined(__cplusplus) && defined(WUFFS_BASE__HAVE_UNIQUE_PTR)\n\n")
+	auxCc.WriteString(data.AuxBaseCc)
+	auxCc.WriteString("\n")
+	for _, f := range auxNonBaseCcFiles {
+		auxCc.WriteString(f)
+		auxCc.WriteString("\n")
 	}
-	out.WriteString("#endif  // defined(__cplusplus) && defined(WUFFS_BASE__HAVE_UNIQUE_PTR)\n\n")
+	auxCc.WriteString("#endif  // defined(__cplusplus) && defined(WUFFS_BASE__HAVE_UNIQUE_PTR)\n\n")
+	out.Write(auxCc.Bytes())
 
 	out.Write(grImplEndsHere)
 	out.WriteString(grPragmaPop)
 	out.WriteString("#endif  // WUFFS_INCLUDE_GUARD\n")
 
-	os.Stdout.Write(out.Bytes())
+	src := out.Bytes()
+	if *mangleprefixFlag != "" {
+		src = mangleRelease(src, *mangleprefixFlag)
+	}
+	if *multifileFlag != "" {
+		return writeMultiFile(*multifileFlag, src)
+	}
+	if *splitheaderFlag != "" {
+		return h.writeSplitHeader(*splitheaderFlag, src, *splitmodulesFlag, auxCc.Bytes())
+	}
+	os.Stdout.Write(src)
+	return nil
+}
+
+func writeMultiFile(prefix string, src []byte) error {
+	dispatchFilename := prefix + ".c"
+	dispatch, archFiles, err := splitMultiFile(src, filepath.Base(dispatchFilename))
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(dispatchFilename, dispatch, 0644); err != nil {
+		return err
+	}
+	for arch, contents := range archFiles {
+		if err := ioutil.WriteFile(prefix+"--"+arch+".c", contents, 0644); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,143 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// This file splits a single file release into a traditional header and
+// implementation pair, for build systems and code review policies that cannot
+// consume a "header file library": a header file (everything above the "‼
+// WUFFS C HEADER ENDS HERE" line) and an implementation file that #include's
+// that header. Neither file is configured by WUFFS_IMPLEMENTATION: the header
+// is always just a header and the implementation file #define's it itself.
+//
+// With -splitmodules, the implementation is further split into one file per
+// module, such as "base" or "std-gif", so that each module can be compiled
+// (or reviewed, or left out) separately. The base module's private helpers
+// (its "‼ WUFFS MULTI-FILE SECTION +shared" section) are static inline
+// functions and macros, so they are copied to every other module's file.
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	shSharedStart = []byte("// ‼ WUFFS MULTI-FILE SECTION +shared\n")
+	shSharedEnd   = []byte("// ‼ WUFFS MULTI-FILE SECTION -shared\n")
+)
+
+const shImplPreamble = "#if !defined(WUFFS_IMPLEMENTATION)\n#define WUFFS_IMPLEMENTATION\n#endif\n"
+
+const shGuidance = `
+// This file is the header half of a Wuffs release that was split (by
+// "wuffs-c genrelease -splitheader") into a "foo.h"-like header and separate
+// "foo.c"-like implementation files. Unlike the single file release, this
+// header never contains the implementation, whether or not
+// WUFFS_IMPLEMENTATION is #define'd.
+
+`
+
+// writeSplitHeader writes src, a single file release, as prefix+".h" and
+// either prefix+".c" or, if splitModules, one prefix+"--"+module+".c" file per
+// module. auxCc is the C++ auxiliary code's implementation, which goes in the
+// base module's file.
+func (h *genReleaseHelper) writeSplitHeader(prefix string, src []byte, splitModules bool, auxCc []byte) error {
+	i := bytes.Index(src, grImplStartsHere)
+	if i < 0 {
+		return fmt.Errorf("could not find %q", grImplStartsHere)
+	}
+	j := bytes.LastIndex(src, grImplEndsHere)
+	if j < i {
+		return fmt.Errorf("could not find %q", grImplEndsHere)
+	}
+	headerFilename := prefix + ".h"
+
+	header := append([]byte(nil), src[:i]...)
+	header = bytes.Replace(header, []byte(grSingleFileGuidance[1:]), []byte(shGuidance[1:]), 1)
+	header = append(header, src[j+len(grImplEndsHere):]...)
+	if err := ioutil.WriteFile(headerFilename, header, 0644); err != nil {
+		return err
+	}
+
+	if !splitModules {
+		impl := genSplitImplFile("", filepath.Base(headerFilename), src[i+len(grImplStartsHere):j])
+		return ioutil.WriteFile(prefix+".c", impl, 0644)
+	}
+
+	base, ok := h.filesMap["wuffs-base.c"]
+	if !ok {
+		return fmt.Errorf("could not find %q", "wuffs-base.c")
+	}
+	shared := []byte(nil)
+	if k := bytes.Index(base.fragments[1], shSharedStart); k < 0 {
+		return fmt.Errorf("could not find the base module's %q", shSharedStart)
+	} else if l := bytes.Index(base.fragments[1][k:], shSharedEnd); l < 0 {
+		return fmt.Errorf("could not find the base module's %q", shSharedEnd)
+	} else {
+		shared = base.fragments[1][k+len(shSharedStart) : k+l]
+	}
+
+	modules := []string(nil)
+	for relFilename := range h.seen {
+		modules = append(modules, relFilename)
+	}
+	sort.Strings(modules)
+
+	for _, relFilename := range modules {
+		module := strings.TrimSuffix(strings.TrimPrefix(relFilename, "wuffs-"), ".c")
+		body := &bytes.Buffer{}
+		if module != "base" {
+			body.WriteString("#ifdef __cplusplus\nextern \"C\" {\n#endif\n\n")
+			body.Write(shared)
+			body.WriteString("\n#ifdef __cplusplus\n}  // extern \"C\"\n#endif\n\n")
+		}
+		body.Write(h.filesMap[relFilename].fragments[1])
+		body.WriteString("\n\n")
+		if module == "base" {
+			body.Write(auxCc)
+		}
+		impl := genSplitImplFile(module, filepath.Base(headerFilename), body.Bytes())
+		if err := ioutil.WriteFile(prefix+"--"+module+".c", impl, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// genSplitImplFile returns an implementation file, holding body, that
+// #include's the headerFilename header. module is empty for the whole
+// release's implementation, instead of just one module's.
+func genSplitImplFile(module string, headerFilename string, body []byte) []byte {
+	out := &bytes.Buffer{}
+	what := "the whole implementation"
+	if module != "" {
+		what = "the " + module + " module's implementation"
+	}
+	fmt.Fprintf(out, "// This file is part of a Wuffs release that was split (by \"wuffs-c\n")
+	fmt.Fprintf(out, "// genrelease -splitheader\") into a header, %q, and implementation\n", headerFilename)
+	fmt.Fprintf(out, "// files. It holds %s. Compile it with the same\n", what)
+	fmt.Fprintf(out, "// WUFFS_CONFIG__ETC macros as everything else that #include's that header.\n\n")
+
+	out.WriteString(shImplPreamble)
+	fmt.Fprintf(out, "#include \"%s\"\n", headerFilename)
+	out.WriteString(grPragmaPush)
+	out.Write(bytes.TrimSpace(body))
+	out.WriteString("\n")
+	out.WriteString(grPragmaPop)
+	return out.Bytes()
+}
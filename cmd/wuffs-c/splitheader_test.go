@@ -0,0 +1,201 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// splitHeaderTestFiles are minimal "wuffs gen" outputs for a base package and
+// a std/foo package.
+var splitHeaderTestFiles = map[string]string{
+	"wuffs-base.c": "" +
+		"// ¡ WUFFS MONOLITHIC RELEASE DISCARDS EVERYTHING ABOVE.\n\n" +
+		"int base_decl(void);\n\n" +
+		"// ‼ WUFFS C HEADER ENDS HERE.\n#ifdef WUFFS_IMPLEMENTATION\n\n" +
+		"// ‼ WUFFS MULTI-FILE SECTION +shared\n" +
+		"static inline int base_shared_helper(void) { return 1; }\n" +
+		"// ‼ WUFFS MULTI-FILE SECTION -shared\n\n" +
+		"int base_decl(void) { return base_shared_helper(); }\n\n" +
+		"#endif  // WUFFS_IMPLEMENTATION\n\n" +
+		"// ¡ WUFFS MONOLITHIC RELEASE DISCARDS EVERYTHING BELOW.\n",
+	"wuffs-std-foo.c": "" +
+		"#include \"./wuffs-base.c\"\n\n" +
+		"// ¡ WUFFS MONOLITHIC RELEASE DISCARDS EVERYTHING ABOVE.\n\n" +
+		"int foo_decl(void);\n\n" +
+		"// ‼ WUFFS C HEADER ENDS HERE.\n#ifdef WUFFS_IMPLEMENTATION\n\n" +
+		"int foo_decl(void) { return base_shared_helper() + 1; }\n\n" +
+		"#endif  // WUFFS_IMPLEMENTATION\n\n" +
+		"// ¡ WUFFS MONOLITHIC RELEASE DISCARDS EVERYTHING BELOW.\n",
+}
+
+// genSplitHeader runs "wuffs-c genrelease" on the splitHeaderTestFiles, with
+// the extra flags, and returns the files that it wrote, keyed by their base
+// names.
+func genSplitHeader(tt *testing.T, flags ...string) map[string]string {
+	tt.Helper()
+	dir, err := ioutil.TempDir("", "splitheader_test")
+	if err != nil {
+		tt.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	inDir, outDir := filepath.Join(dir, "in"), filepath.Join(dir, "out")
+	for _, d := range []string{inDir, outDir} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			tt.Fatalf("Mkdir: %v", err)
+		}
+	}
+	args := append(flags, "-splitheader", filepath.Join(outDir, "wuffs"))
+	for filename, contents := range splitHeaderTestFiles {
+		filename = filepath.Join(inDir, filename)
+		if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+			tt.Fatalf("WriteFile: %v", err)
+		}
+		args = append(args, filename)
+	}
+	if err := doGenrelease(args); err != nil {
+		tt.Fatalf("doGenrelease: %v", err)
+	}
+
+	infos, err := ioutil.ReadDir(outDir)
+	if err != nil {
+		tt.Fatalf("ReadDir: %v", err)
+	}
+	ret := map[string]string{}
+	for _, info := range infos {
+		contents, err := ioutil.ReadFile(filepath.Join(outDir, info.Name()))
+		if err != nil {
+			tt.Fatalf("ReadFile: %v", err)
+		}
+		ret[info.Name()] = string(contents)
+	}
+	return ret
+}
+
+// checkSplitFile checks that the named file exists, contains every want and
+// does not contain any unwanted.
+func checkSplitFile(tt *testing.T, files map[string]string, name string, want []string, unwanted []string) {
+	tt.Helper()
+	contents, ok := files[name]
+	if !ok {
+		tt.Fatalf("no %q file", name)
+	}
+	for _, s := range want {
+		if !strings.Contains(contents, s) {
+			tt.Errorf("%s does not contain %q", name, s)
+		}
+	}
+	for _, s := range unwanted {
+		if strings.Contains(contents, s) {
+			tt.Errorf("%s contains %q", name, s)
+		}
+	}
+}
+
+func TestSplitHeader(tt *testing.T) {
+	files := genSplitHeader(tt)
+	if len(files) != 2 {
+		tt.Fatalf("got %d files, want 2 (wuffs.h and wuffs.c)", len(files))
+	}
+
+	checkSplitFile(tt, files, "wuffs.h",
+		[]string{
+			"int base_decl(void);\n",
+			"int foo_decl(void);\n",
+			shGuidance[1:],
+			"#endif  // WUFFS_INCLUDE_GUARD\n",
+		},
+		[]string{
+			grSingleFileGuidance[1:],
+			"#ifdef WUFFS_IMPLEMENTATION",
+			"base_shared_helper",
+		},
+	)
+
+	checkSplitFile(tt, files, "wuffs.c",
+		[]string{
+			shImplPreamble + "#include \"wuffs.h\"\n",
+			"static inline int base_shared_helper(void) { return 1; }\n",
+			"int base_decl(void) { return base_shared_helper(); }\n",
+			"int foo_decl(void) { return base_shared_helper() + 1; }\n",
+		},
+		[]string{
+			"int base_decl(void);\n",
+			"#ifdef WUFFS_IMPLEMENTATION",
+			"#endif  // WUFFS_IMPLEMENTATION",
+		},
+	)
+}
+
+func TestSplitHeaderSplitModules(tt *testing.T) {
+	files := genSplitHeader(tt, "-splitmodules")
+	if len(files) != 3 {
+		tt.Fatalf("got %d files, want 3 (wuffs.h, wuffs--base.c and wuffs--std-foo.c)", len(files))
+	}
+
+	checkSplitFile(tt, files, "wuffs.h",
+		[]string{"int base_decl(void);\n", "int foo_decl(void);\n"},
+		[]string{"base_shared_helper"},
+	)
+
+	checkSplitFile(tt, files, "wuffs--base.c",
+		[]string{
+			shImplPreamble + "#include \"wuffs.h\"\n",
+			"the base module's implementation",
+			"int base_decl(void) { return base_shared_helper(); }\n",
+		},
+		[]string{"foo_decl"},
+	)
+
+	// The base module's shared helpers are copied to the other modules.
+	checkSplitFile(tt, files, "wuffs--std-foo.c",
+		[]string{
+			shImplPreamble + "#include \"wuffs.h\"\n",
+			"the std-foo module's implementation",
+			"static inline int base_shared_helper(void) { return 1; }\n",
+			"int foo_decl(void) { return base_shared_helper() + 1; }\n",
+		},
+		[]string{"base_decl"},
+	)
+}
+
+func TestSplitHeaderBadFlags(tt *testing.T) {
+	testCases := []struct {
+		args    []string
+		wantErr string
+	}{{
+		args:    []string{"-splitmodules"},
+		wantErr: "-splitmodules requires -splitheader",
+	}, {
+		args:    []string{"-splitheader=wuffs", "-mangleprefix=acme"},
+		wantErr: "-splitheader is not supported with -mangleprefix",
+	}, {
+		args:    []string{"-splitheader=wuffs", "-multifile=wuffs"},
+		wantErr: "-splitheader is not supported with -multifile",
+	}}
+
+	for _, tc := range testCases {
+		if err := doGenrelease(tc.args); err == nil {
+			tt.Errorf("%q: got nil error, want %q", tc.args, tc.wantErr)
+		} else if got := err.Error(); got != tc.wantErr {
+			tt.Errorf("%q: got %q, want %q", tc.args, got, tc.wantErr)
+		}
+	}
+}
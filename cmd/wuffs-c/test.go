@@ -16,6 +16,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -35,10 +36,13 @@ func doTest(args []string) error  { return doBenchTest(args, false) }
 func doBenchTest(args []string, bench bool) error {
 	flags := flag.FlagSet{}
 	ccompilersFlag := flags.String("ccompilers", cf.CcompilersDefault, cf.CcompilersUsage)
+	flamegraphFlag := flags.String("flamegraph", cf.FlamegraphDefault, cf.FlamegraphUsage)
 	focusFlag := flags.String("focus", cf.FocusDefault, cf.FocusUsage)
 	iterscaleFlag := flags.Int("iterscale", cf.IterscaleDefault, cf.IterscaleUsage)
 	mimicFlag := flags.Bool("mimic", cf.MimicDefault, cf.MimicUsage)
 	repsFlag := flags.Int("reps", cf.RepsDefault, cf.RepsUsage)
+	snapshotFlag := flags.Bool("snapshot", cf.SnapshotDefault, cf.SnapshotUsage)
+	updateFlag := flags.Bool("update", cf.UpdateDefault, cf.UpdateUsage)
 
 	if err := flags.Parse(args); err != nil {
 		return err
@@ -58,13 +62,26 @@ func doBenchTest(args []string, bench bool) error {
 		return fmt.Errorf("bad -reps flag value %d, outside the range [%d ..= %d]",
 			*repsFlag, cf.RepsMin, cf.RepsMax)
 	}
+	if bench && *snapshotFlag {
+		return fmt.Errorf("cannot combine bench and -snapshot")
+	}
+	if !bench && (*flamegraphFlag != cf.FlamegraphDefault) {
+		return fmt.Errorf("cannot combine test and -flamegraph")
+	}
+	if *updateFlag {
+		if !*snapshotFlag {
+			return fmt.Errorf("cannot use -update without -snapshot")
+		} else if *focusFlag != "" {
+			return fmt.Errorf("cannot combine -focus and -update")
+		}
+	}
 
 	args = flags.Args()
 
 	failed := false
 	for _, arg := range args {
-		f, err := doBenchTest1(arg, bench,
-			*ccompilersFlag, *focusFlag, *iterscaleFlag, *mimicFlag, *repsFlag)
+		f, err := doBenchTest1(arg, bench, *ccompilersFlag, *flamegraphFlag, *focusFlag,
+			*iterscaleFlag, *mimicFlag, *repsFlag, *snapshotFlag, *updateFlag)
 		if err != nil {
 			return err
 		}
@@ -80,8 +97,8 @@ func doBenchTest(args []string, bench bool) error {
 	return nil
 }
 
-func doBenchTest1(filename string, bench bool, ccompilers string, focus string,
-	iterscale int, mimic bool, reps int) (failed bool, err error) {
+func doBenchTest1(filename string, bench bool, ccompilers string, flamegraph string, focus string,
+	iterscale int, mimic bool, reps int, snapshot bool, update bool) (failed bool, err error) {
 
 	workDir, err := ioutil.TempDir("", "wuffs-c")
 	if err != nil {
@@ -91,11 +108,18 @@ func doBenchTest1(filename string, bench bool, ccompilers string, focus string,
 
 	in := filename + ".c"
 	out := filepath.Join(workDir, "a.out")
+	snapshotHave := filepath.Join(workDir, "snapshot.txt")
+	snapshotWant := filename + ".snapshot"
 
 	ccArgs := []string(nil)
 	if bench {
 		ccArgs = append(ccArgs, "-O3")
 	}
+	if flamegraph != "" {
+		// Keep the frame pointers and symbols that the profiler needs to
+		// walk and name the call stacks.
+		ccArgs = append(ccArgs, "-g", "-fno-omit-frame-pointer")
+	}
 	ccArgs = append(ccArgs, "-Wall", "-std=c99", "-o", out, in)
 	if mimic {
 		extra, err := findWuffsMimicCflags(in)
@@ -118,6 +142,15 @@ func doBenchTest1(filename string, bench bool, ccompilers string, focus string,
 			return false, err
 		}
 
+		if flamegraph != "" {
+			f, err := doFlamegraphs(filename, out, workDir, flamegraph, cc, focus, iterscale, mimic, reps)
+			if err != nil {
+				return false, err
+			}
+			failed = failed || f
+			continue
+		}
+
 		outArgs := []string(nil)
 		if bench {
 			outArgs = append(outArgs, "-bench",
@@ -128,6 +161,9 @@ func doBenchTest1(filename string, bench bool, ccompilers string, focus string,
 		if focus != "" {
 			outArgs = append(outArgs, fmt.Sprintf("-focus=%s", focus))
 		}
+		if snapshot {
+			outArgs = append(outArgs, fmt.Sprintf("-snapshot=%s", snapshotHave))
+		}
 		outCmd := exec.Command(out, outArgs...)
 		outCmd.Stdout = os.Stdout
 		outCmd.Stderr = os.Stderr
@@ -138,13 +174,114 @@ func doBenchTest1(filename string, bench bool, ccompilers string, focus string,
 			// No-op.
 		} else if _, ok := err.(*exec.ExitError); ok {
 			failed = true
+			continue
 		} else {
 			return false, err
 		}
+
+		if !snapshot {
+			continue
+		} else if update {
+			// Only the first C compiler updates the golden file. Any others
+			// compare against it, so that they cannot silently disagree.
+			update = false
+			if err := updateSnapshot(snapshotWant, snapshotHave); err != nil {
+				return false, err
+			}
+		} else if f, err := compareSnapshot(snapshotWant, snapshotHave, cc, focus != ""); err != nil {
+			return false, err
+		} else {
+			failed = failed || f
+		}
 	}
 	return failed, nil
 }
 
+func updateSnapshot(wantFilename string, haveFilename string) error {
+	have, err := ioutil.ReadFile(haveFilename)
+	if err != nil {
+		return err
+	}
+	if want, err := ioutil.ReadFile(wantFilename); (err == nil) && bytes.Equal(have, want) {
+		return nil
+	}
+	if err := ioutil.WriteFile(wantFilename, have, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\n", wantFilename)
+	return nil
+}
+
+// compareSnapshot compares the snapshot lines (see the C testlib's
+// g_snapshot_file) that a test program wrote to haveFilename against the
+// golden wantFilename. If focused, only some tests were run, so golden lines
+// for other tests are ignored.
+func compareSnapshot(wantFilename string, haveFilename string, cc string, focused bool) (failed bool, err error) {
+	have, err := readSnapshotLines(haveFilename)
+	if err != nil {
+		return false, err
+	}
+	want, err := readSnapshotLines(wantFilename)
+	if os.IsNotExist(err) {
+		fmt.Printf("%s: FAIL snapshot: no golden file %s (use -update to create it)\n", cc, wantFilename)
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if focused {
+		funcNames := map[string]bool{}
+		for _, line := range have {
+			funcNames[snapshotFuncName(line)] = true
+		}
+		filtered := []string(nil)
+		for _, line := range want {
+			if funcNames[snapshotFuncName(line)] {
+				filtered = append(filtered, line)
+			}
+		}
+		want = filtered
+	}
+
+	for i := 0; (i < len(have)) || (i < len(want)); i++ {
+		h, w := "(none)", "(none)"
+		if i < len(have) {
+			h = have[i]
+		}
+		if i < len(want) {
+			w = want[i]
+		}
+		if h != w {
+			fmt.Printf("%s: FAIL snapshot: %s line %d differs (use -update if this is expected)\n"+
+				"  have: %s\n  want: %s\n", cc, wantFilename, i+1, h, w)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func readSnapshotLines(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines := []string(nil)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	return lines, s.Err()
+}
+
+func snapshotFuncName(line string) string {
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
 func findWuffsMimicCflags(filename string) ([]string, error) {
 	f, err := os.Open(filename)
 	if err != nil {
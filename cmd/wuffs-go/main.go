@@ -0,0 +1,95 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// ----------------
+
+// wuffs-go handles the Go language specific parts of the wuffs tool.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/wuffs/internal/gogen"
+	"github.com/google/wuffs/lang/diagnostic"
+
+	cf "github.com/google/wuffs/cmd/commonflags"
+)
+
+func main() {
+	if err := main1(); err != nil {
+		if err != diagnostic.ErrReported {
+			os.Stderr.WriteString(err.Error() + "\n")
+		}
+		os.Exit(1)
+	}
+}
+
+func main1() error {
+	if len(os.Args) < 2 {
+		return fmt.Errorf("no sub-command given")
+	}
+	args := os.Args[2:]
+	switch os.Args[1] {
+	case "gen":
+		return gogen.Do(args)
+	case "genlib":
+		// Go code is compiled by the go tool, not ahead of time.
+		return nil
+	case "genrelease":
+		return doGenrelease(args)
+	}
+	return fmt.Errorf("bad sub-command %q", os.Args[1])
+}
+
+// doGenrelease writes the version of the generated Go code. Unlike C's, the Go
+// packages cannot be amalgamated into a single file, as each is its own Go
+// package, so the release is just that version.
+func doGenrelease(args []string) error {
+	flags := flag.FlagSet{}
+	commitDateFlag := flags.String("commitdate", "", "git commit date the release was built from")
+	gitRevListCountFlag := flags.Int("gitrevlistcount", 0, `git "rev-list --count" that the release was built from`)
+	revisionFlag := flags.String("revision", "", "git revision the release was built from")
+	versionFlag := flags.String("version", cf.VersionDefault, cf.VersionUsage)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if (*gitRevListCountFlag < 0) || (0x7FFFFFFF < *gitRevListCountFlag) {
+		return fmt.Errorf("bad -gitrevlistcount flag value %d", *gitRevListCountFlag)
+	}
+	if !cf.IsAlphaNumericIsh(*commitDateFlag) {
+		return fmt.Errorf("bad -commitdate flag value %q", *commitDateFlag)
+	}
+	if !cf.IsAlphaNumericIsh(*revisionFlag) {
+		return fmt.Errorf("bad -revision flag value %q", *revisionFlag)
+	}
+	v, ok := cf.ParseVersion(*versionFlag)
+	if !ok {
+		return fmt.Errorf("bad -version flag value %q", *versionFlag)
+	}
+
+	_, err := fmt.Fprintf(os.Stdout, "// Code generated by \"wuffs-go genrelease\"; DO NOT EDIT.\n\n"+
+		"// Package wuffs records the version of the Wuffs packages transpiled to Go.\n"+
+		"package wuffs\n\n"+
+		"const (\n"+
+		"\tVersion         = %q\n"+
+		"\tRevision        = %q\n"+
+		"\tCommitDate      = %q\n"+
+		"\tGitRevListCount = %d\n"+
+		")\n",
+		v.String(), *revisionFlag, *commitDateFlag, *gitRevListCountFlag)
+	return err
+}
@@ -0,0 +1,592 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/generate"
+
+	cf "github.com/google/wuffs/cmd/commonflags"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+const (
+	exampleIncludeDefault = "wuffs-unsupported-snapshot.c"
+	exampleIncludeUsage   = `the #include path of the single file C library, e.g. "../../release/c/wuffs-unsupported-snapshot.c"`
+
+	exampleLangDefault = "c"
+	exampleLangUsage   = `the example program's language: "c" or "cpp"`
+
+	exampleStructDefault = ""
+	exampleStructUsage   = `the public struct to use, if the package has more than one that implements a base interface`
+)
+
+// exampleBodies are the example programs' decode functions, keyed by the base
+// interface that the struct implements. "{{foo}}(etc)" calls the struct's foo
+// method on g_dec, in the style of the target language.
+var exampleBodies = map[string]string{
+	"hasher_u32":     exampleBodyHasherU32,
+	"image_decoder":  exampleBodyImageDecoder,
+	"io_transformer": exampleBodyIOTransformer,
+	"token_decoder":  exampleBodyTokenDecoder,
+}
+
+func doExample(wuffsRoot string, args []string) error {
+	flags := flag.NewFlagSet("example", flag.ExitOnError)
+	includeFlag := flags.String("include", exampleIncludeDefault, exampleIncludeUsage)
+	langFlag := flags.String("lang", exampleLangDefault, exampleLangUsage)
+	skipgendepsFlag := flags.Bool("skipgendeps", skipgendepsDefault, skipgendepsUsage)
+	structFlag := flags.String("struct", exampleStructDefault, exampleStructUsage)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) != 1 {
+		return errors.New("example: usage: wuffs example [flags] std/foo")
+	}
+	if (*langFlag != "c") && (*langFlag != "cpp") {
+		return fmt.Errorf("example: bad -lang flag value %q", *langFlag)
+	}
+	if strings.ContainsAny(*includeFlag, "\"\n") {
+		return fmt.Errorf("example: bad -include flag value %q", *includeFlag)
+	}
+	dirname := strings.TrimRight(args[0], "/")
+	if !cf.IsValidUsePath(dirname) {
+		return fmt.Errorf("example: invalid package path %q", dirname)
+	}
+
+	h := exampleHelper{
+		wuffsRoot: wuffsRoot,
+		dirname:   dirname,
+		pkgName:   path.Base(dirname),
+		cpp:       *langFlag == "cpp",
+		include:   *includeFlag,
+	}
+	if err := h.load(*skipgendepsFlag); err != nil {
+		return err
+	}
+	if err := h.findStruct(*structFlag); err != nil {
+		return err
+	}
+	modules, err := h.modules()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.WriteString(h.program(modules))
+	return err
+}
+
+type exampleHelper struct {
+	wuffsRoot string
+	dirname   string
+	pkgName   string
+	cpp       bool
+	include   string
+
+	tm    t.Map
+	files []*a.File
+
+	// structName is the C name of the chosen struct, such as
+	// "wuffs_gzip__decoder", and iface is the base interface that it
+	// implements, such as "io_transformer".
+	structName string
+	iface      string
+}
+
+// load parses and checks the package, so that the example is only ever
+// generated for a package that would also generate valid C code.
+func (h *exampleHelper) load(skipgendeps bool) error {
+	qualFilenames, _, err := listDir(
+		filepath.Join(h.wuffsRoot, filepath.FromSlash(h.dirname)), ".wuffs", false)
+	if err != nil {
+		return err
+	}
+	if len(qualFilenames) == 0 {
+		return fmt.Errorf("example: no .wuffs files in %s", h.dirname)
+	}
+	if !skipgendeps {
+		// Stdout is for the example program.
+		genLog = os.Stderr
+		gh := genHelper{
+			wuffsRoot: h.wuffsRoot,
+			langs:     []string{langsDefault},
+		}
+		if err := gh.genDirDependencies(qualFilenames); err != nil {
+			return err
+		}
+	}
+	h.files, err = generate.ParseFiles(&h.tm, qualFilenames, nil)
+	if err != nil {
+		return err
+	}
+	_, err = check.Check(&h.tm, h.files, func(usePath string) ([]byte, error) {
+		return ioutil.ReadFile(filepath.Join(h.wuffsRoot, "gen", "wuffs", filepath.FromSlash(usePath)))
+	}, nil)
+	return err
+}
+
+// findStruct finds the public struct, implementing one of the base interfaces
+// that the example programs know how to drive, to build the example around.
+func (h *exampleHelper) findStruct(want string) error {
+	candidates := []string(nil)
+	for _, f := range h.files {
+		for _, n := range f.TopLevelDecls() {
+			if n.Kind() != a.KStruct {
+				continue
+			}
+			s := n.AsStruct()
+			if !s.Public() {
+				continue
+			}
+			name := s.QID()[1].Str(&h.tm)
+			if (want != "") && (want != name) {
+				continue
+			}
+			for _, o := range s.Implements() {
+				qid := o.AsTypeExpr().QID()
+				if qid[0] != t.IDBase {
+					continue
+				}
+				iface := qid[1].Str(&h.tm)
+				if _, ok := exampleBodies[iface]; !ok {
+					continue
+				}
+				candidates = append(candidates, name)
+				h.structName = "wuffs_" + h.pkgName + "__" + name
+				h.iface = iface
+				break
+			}
+		}
+	}
+
+	if len(candidates) == 1 {
+		return nil
+	} else if len(candidates) > 1 {
+		return fmt.Errorf("example: %s has more than one candidate struct (%s): use the -struct flag",
+			h.dirname, strings.Join(candidates, ", "))
+	} else if want != "" {
+		return fmt.Errorf("example: %s has no public struct %q that implements a supported base interface",
+			h.dirname, want)
+	}
+	ifaces := []string(nil)
+	for k := range exampleBodies {
+		ifaces = append(ifaces, "base."+k)
+	}
+	sort.Strings(ifaces)
+	return fmt.Errorf("example: %s has no public struct that implements any of %s",
+		h.dirname, strings.Join(ifaces, ", "))
+}
+
+// modules returns the package and its transitive dependencies, upper-cased,
+// for the WUFFS_CONFIG__MODULE__ETC macros.
+func (h *exampleHelper) modules() ([]string, error) {
+	seen := map[string]bool{}
+	if err := h.modules1(seen, h.dirname, h.files); err != nil {
+		return nil, err
+	}
+	ret := []string{"BASE"}
+	for k := range seen {
+		ret = append(ret, strings.ToUpper(path.Base(k)))
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func (h *exampleHelper) modules1(seen map[string]bool, dirname string, files []*a.File) error {
+	seen[dirname] = true
+	for _, f := range files {
+		for _, n := range f.TopLevelDecls() {
+			if n.Kind() != a.KUse {
+				continue
+			}
+			useDirname, _ := t.Unescape(n.AsUse().Path().Str(&h.tm))
+			if seen[useDirname] {
+				continue
+			}
+			qualFilenames, _, err := listDir(
+				filepath.Join(h.wuffsRoot, filepath.FromSlash(useDirname)), ".wuffs", false)
+			if err != nil {
+				return err
+			}
+			useFiles, err := generate.ParseFiles(&h.tm, qualFilenames, nil)
+			if err != nil {
+				return err
+			}
+			if err := h.modules1(seen, useDirname, useFiles); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// exampleActions describe, for each base interface, what its example program
+// does.
+var exampleActions = map[string]string{
+	"hasher_u32":     "prints the checksum of the file named by its argument.",
+	"image_decoder":  "decodes the image file named by its argument, printing its\ndimensions and number of frames.",
+	"io_transformer": "decodes the file named by its argument, writing the result to\nstdout.",
+	"token_decoder":  "decodes the file named by its argument, printing its number of\ntokens.",
+}
+
+func (h *exampleHelper) program(modules []string) string {
+	b := &strings.Builder{}
+	lang, compiler, ext := "c", "$CC", "c"
+	if h.cpp {
+		lang, compiler, ext = "cpp", "$CXX", "cc"
+	}
+	fmt.Fprintf(b, "// Code generated by \"wuffs example -lang=%s %s\".\n\n", lang, h.dirname)
+	fmt.Fprintf(b, "/*\nPackage: %s\nStruct:  %s (a base.%s)\n\n", h.dirname, h.structName, h.iface)
+	fmt.Fprintf(b, "This program %s To run:\n\n", exampleActions[h.iface])
+	fmt.Fprintf(b, "%s example.%s && ./a.out filename; rm -f a.out\n\n", compiler, ext)
+	fmt.Fprintf(b, "It #include's Wuffs' single file C library from the path below. Edit that\n"+
+		"line, or re-run \"wuffs example\" with an -include flag, if it lives elsewhere,\n"+
+		"such as under the Wuffs repository's release/c directory.\n*/\n\n")
+
+	b.WriteString(exampleIncludes)
+	b.WriteString("\n#define WUFFS_IMPLEMENTATION\n\n#define WUFFS_CONFIG__MODULES\n")
+	for _, m := range modules {
+		fmt.Fprintf(b, "#define WUFFS_CONFIG__MODULE__%s\n", m)
+	}
+	fmt.Fprintf(b, "\n#include %q\n\n", h.include)
+
+	if h.cpp {
+		fmt.Fprintf(b, "%s::unique_ptr g_dec(nullptr, &free);\n", h.structName)
+	} else {
+		fmt.Fprintf(b, "%s* g_dec = NULL;\n", h.structName)
+	}
+	b.WriteString(exampleCommon)
+	b.WriteString(h.expandCalls(exampleBodies[h.iface]))
+
+	alloc := h.structName + "__alloc()"
+	if h.cpp {
+		alloc = h.structName + "::alloc()"
+	}
+	b.WriteString(strings.Replace(exampleMain, "{{alloc}}", alloc, -1))
+	if !h.cpp {
+		b.WriteString(exampleMainFreeC)
+	}
+	b.WriteString(exampleMainEnd)
+	return b.String()
+}
+
+// expandCalls replaces "{{foo}}(etc)" with "wuffs_pkg__struct__foo(g_dec,
+// etc)" in C or with "g_dec->foo(etc)" in C++.
+func (h *exampleHelper) expandCalls(s string) string {
+	b := &strings.Builder{}
+	for {
+		i := strings.Index(s, "{{")
+		if i < 0 {
+			break
+		}
+		j := strings.Index(s[i:], "}}(")
+		if j < 0 {
+			break
+		}
+		j += i
+		b.WriteString(s[:i])
+		method := s[i+2 : j]
+		s = s[j+3:]
+		if h.cpp {
+			fmt.Fprintf(b, "g_dec->%s(", method)
+		} else if strings.HasPrefix(s, ")") {
+			fmt.Fprintf(b, "%s__%s(g_dec", h.structName, method)
+		} else {
+			fmt.Fprintf(b, "%s__%s(g_dec, ", h.structName, method)
+		}
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+const exampleIncludes = `#include <inttypes.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+`
+
+const exampleCommon = `
+#ifndef SRC_BUFFER_ARRAY_SIZE
+#define SRC_BUFFER_ARRAY_SIZE (64 * 1024)
+#endif
+
+#define TRY(error_msg)         \
+  do {                         \
+    const char* z = error_msg; \
+    if (z) {                   \
+      return z;                \
+    }                          \
+  } while (false)
+
+FILE* g_file = NULL;
+uint8_t g_src_array[SRC_BUFFER_ARRAY_SIZE];
+wuffs_base__io_buffer g_src;
+wuffs_base__slice_u8 g_workbuf;
+
+// read_more_src compacts g_src and then reads more of g_file into it. When a
+// Wuffs function returns a "$short read" suspension, call read_more_src and
+// then call that Wuffs function again, resuming where it left off.
+const char*  //
+read_more_src() {
+  if (g_src.meta.closed) {
+    return "main: unexpected end of file";
+  }
+  wuffs_base__io_buffer__compact(&g_src);
+  if (g_src.meta.wi == g_src.data.len) {
+    return "main: internal error: no I/O progress possible";
+  }
+  size_t n = fread(g_src.data.ptr + g_src.meta.wi, 1,
+                   g_src.data.len - g_src.meta.wi, g_file);
+  g_src.meta.wi += n;
+  if (feof(g_file)) {
+    g_src.meta.closed = true;
+  } else if (ferror(g_file)) {
+    return "main: could not read file";
+  }
+  return NULL;
+}
+
+// alloc_workbuf sets g_workbuf to a newly allocated work buffer. Pass the
+// max_incl of the decoder's workbuf_len, a range whose bounds can differ.
+const char*  //
+alloc_workbuf(uint64_t len) {
+  if (len > SIZE_MAX) {
+    return "main: work buffer is too large";
+  }
+  // malloc(0) may return NULL, so allocate at least 1 byte.
+  g_workbuf.ptr = (uint8_t*)malloc(len ? ((size_t)len) : 1);
+  if (!g_workbuf.ptr) {
+    return "main: out of memory";
+  }
+  g_workbuf.len = (size_t)len;
+  return NULL;
+}
+`
+
+const exampleBodyHasherU32 = `
+const char*  //
+decode() {
+  uint32_t checksum = 0;
+  while (!g_src.meta.closed) {
+    TRY(read_more_src());
+    checksum = {{update_u32}}(wuffs_base__io_buffer__reader_slice(&g_src));
+    g_src.meta.ri = g_src.meta.wi;
+  }
+  printf("%08" PRIx32 "\n", checksum);
+  return NULL;
+}
+`
+
+const exampleBodyIOTransformer = `
+#ifndef DST_BUFFER_ARRAY_SIZE
+#define DST_BUFFER_ARRAY_SIZE (64 * 1024)
+#endif
+
+uint8_t g_dst_array[DST_BUFFER_ARRAY_SIZE];
+
+const char*  //
+decode() {
+  TRY(alloc_workbuf({{workbuf_len}}().max_incl));
+  wuffs_base__io_buffer dst =
+      wuffs_base__ptr_u8__writer(g_dst_array, DST_BUFFER_ARRAY_SIZE);
+  while (true) {
+    wuffs_base__status status = {{transform_io}}(&dst, &g_src, g_workbuf);
+
+    if (dst.meta.wi > dst.meta.ri) {
+      size_t n = dst.meta.wi - dst.meta.ri;
+      if (fwrite(dst.data.ptr + dst.meta.ri, 1, n, stdout) != n) {
+        return "main: could not write to stdout";
+      }
+      dst.meta.ri = dst.meta.wi;
+      wuffs_base__io_buffer__compact(&dst);
+    }
+
+    if (status.repr == NULL) {
+      return NULL;
+    } else if (status.repr == wuffs_base__suspension__short_read) {
+      TRY(read_more_src());
+    } else if (status.repr != wuffs_base__suspension__short_write) {
+      return wuffs_base__status__message(&status);
+    }
+  }
+}
+`
+
+const exampleBodyImageDecoder = `
+#ifndef MAX_INCL_DIMENSION
+#define MAX_INCL_DIMENSION 16384
+#endif
+
+#define BYTES_PER_PIXEL 4
+
+wuffs_base__slice_u8 g_pixbuf_slice;
+
+const char*  //
+decode() {
+  wuffs_base__image_config ic = wuffs_base__null_image_config();
+  while (true) {
+    wuffs_base__status status = {{decode_image_config}}(&ic, &g_src);
+    if (status.repr == NULL) {
+      break;
+    } else if (status.repr != wuffs_base__suspension__short_read) {
+      return wuffs_base__status__message(&status);
+    }
+    TRY(read_more_src());
+  }
+
+  uint32_t w = wuffs_base__pixel_config__width(&ic.pixcfg);
+  uint32_t h = wuffs_base__pixel_config__height(&ic.pixcfg);
+  if ((w > MAX_INCL_DIMENSION) || (h > MAX_INCL_DIMENSION)) {
+    return "main: image is too large";
+  }
+  // Override the image's native pixel format to be BGRA_NONPREMUL.
+  wuffs_base__pixel_config__set(&ic.pixcfg,
+                                WUFFS_BASE__PIXEL_FORMAT__BGRA_NONPREMUL,
+                                WUFFS_BASE__PIXEL_SUBSAMPLING__NONE, w, h);
+
+  TRY(alloc_workbuf({{workbuf_len}}().max_incl));
+  size_t pixbuf_len = ((size_t)w) * ((size_t)h) * BYTES_PER_PIXEL;
+  g_pixbuf_slice.ptr = (uint8_t*)malloc(pixbuf_len ? pixbuf_len : 1);
+  if (!g_pixbuf_slice.ptr) {
+    return "main: out of memory";
+  }
+  g_pixbuf_slice.len = pixbuf_len;
+  wuffs_base__pixel_buffer pb = wuffs_base__null_pixel_buffer();
+  wuffs_base__status status =
+      wuffs_base__pixel_buffer__set_from_slice(&pb, &ic.pixcfg, g_pixbuf_slice);
+  TRY(wuffs_base__status__message(&status));
+
+  uint64_t num_frames = 0;
+  while (true) {
+    wuffs_base__frame_config fc = wuffs_base__null_frame_config();
+    status = {{decode_frame_config}}(&fc, &g_src);
+    if (status.repr == wuffs_base__note__end_of_data) {
+      break;
+    } else if (status.repr == wuffs_base__suspension__short_read) {
+      TRY(read_more_src());
+      continue;
+    } else if (status.repr != NULL) {
+      return wuffs_base__status__message(&status);
+    }
+
+    while (true) {
+      status = {{decode_frame}}(&pb, &g_src, WUFFS_BASE__PIXEL_BLEND__SRC,
+                                g_workbuf, NULL);
+      if (status.repr == NULL) {
+        break;
+      } else if (status.repr != wuffs_base__suspension__short_read) {
+        return wuffs_base__status__message(&status);
+      }
+      TRY(read_more_src());
+    }
+    num_frames++;
+  }
+
+  printf("%" PRIu32 " x %" PRIu32 ", %" PRIu64 " frame(s)\n", w, h,
+         num_frames);
+  return NULL;
+}
+`
+
+const exampleBodyTokenDecoder = `
+#ifndef TOKEN_BUFFER_ARRAY_SIZE
+#define TOKEN_BUFFER_ARRAY_SIZE (4 * 1024)
+#endif
+
+wuffs_base__token g_tok_array[TOKEN_BUFFER_ARRAY_SIZE];
+
+const char*  //
+decode() {
+  TRY(alloc_workbuf({{workbuf_len}}().max_incl));
+  wuffs_base__token_buffer tok = wuffs_base__slice_token__writer(
+      wuffs_base__make_slice_token(g_tok_array, TOKEN_BUFFER_ARRAY_SIZE));
+  uint64_t num_tokens = 0;
+  while (true) {
+    wuffs_base__status status = {{decode_tokens}}(&tok, &g_src, g_workbuf);
+
+    // A real program would look at each token here. A long string can be
+    // split over multiple tokens, so their number depends on buffer sizes.
+    num_tokens += tok.meta.wi - tok.meta.ri;
+    tok.meta.ri = tok.meta.wi;
+    wuffs_base__token_buffer__compact(&tok);
+
+    if (status.repr == NULL) {
+      break;
+    } else if (status.repr == wuffs_base__suspension__short_read) {
+      TRY(read_more_src());
+    } else if (status.repr != wuffs_base__suspension__short_write) {
+      return wuffs_base__status__message(&status);
+    }
+  }
+
+  printf("%" PRIu64 " token(s)\n", num_tokens);
+  return NULL;
+}
+`
+
+const exampleMain = `
+const char*  //
+main1(int argc, char** argv) {
+  if (argc != 2) {
+    return "usage: a.out filename";
+  }
+  g_file = fopen(argv[1], "rb");
+  if (!g_file) {
+    return "main: could not open file";
+  }
+  g_src = wuffs_base__ptr_u8__writer(g_src_array, SRC_BUFFER_ARRAY_SIZE);
+
+  // The alloc function returns an already initialized struct.
+  g_dec = {{alloc}};
+  if (!g_dec) {
+    return "main: out of memory";
+  }
+  return decode();
+}
+
+int  //
+main(int argc, char** argv) {
+  const char* status_msg = main1(argc, argv);
+  if (g_file) {
+    fclose(g_file);
+  }
+  free(g_workbuf.ptr);
+`
+
+const exampleMainFreeC = `  free(g_dec);
+`
+
+const exampleMainEnd = `  if (!status_msg) {
+    return 0;
+  }
+  fprintf(stderr, "%s\n", status_msg);
+  // Return an exit code of 2 for internal (exceptional) errors and 1 for
+  // regular (foreseen) errors, such as badly formatted input.
+  return strstr(status_msg, "internal error:") ? 2 : 1;
+}
+`
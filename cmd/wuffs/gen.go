@@ -18,12 +18,14 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
 
+	"github.com/google/wuffs/lang/diagnostic"
 	"github.com/google/wuffs/lang/generate"
 	"github.com/google/wuffs/lang/parse"
 
@@ -38,9 +40,27 @@ func doGenlib(wuffsRoot string, args []string) error { return doGenGenlib(wuffsR
 
 func doGenGenlib(wuffsRoot string, args []string, genlib bool) error {
 	flags := flag.NewFlagSet("gen", flag.ExitOnError)
+	allocatorFlag := flags.Bool("allocator", cf.AllocatorDefault, cf.AllocatorUsage)
+	apijsonFlag := flags.Bool("api-json", apijsonDefault, apijsonUsage)
+	audit32Flag := flags.Bool("audit32", cf.Audit32Default, cf.Audit32Usage)
+	autovecFlag := flags.Bool("autovec", cf.AutovecDefault, cf.AutovecUsage)
+	checkcachedirFlag := flags.String("checkcachedir", checkcachedirDefault, checkcachedirUsage)
+	checkcacheurlFlag := flags.String("checkcacheurl", checkcacheurlDefault, checkcacheurlUsage)
+	checkcacheversionFlag := flags.String("checkcacheversion", checkcacheversionDefault, checkcacheversionUsage)
+	ctargetFlag := flags.String("ctarget", cf.CTargetDefault, cf.CTargetUsage)
+	failfastFlag := flags.Bool("failfast", failfastDefault, failfastUsage)
 	genlinenumFlag := flags.Bool("genlinenum", cf.GenlinenumDefault, cf.GenlinenumUsage)
+	instrumentFlag := flags.Bool("instrument", cf.InstrumentDefault, cf.InstrumentUsage)
+	jsonerrorsFlag := flags.Bool("json-errors", jsonerrorsDefault, jsonerrorsUsage)
 	langsFlag := flags.String("langs", langsDefault, langsUsage)
+	maxerrorsFlag := flags.Int("maxerrors", maxerrorsDefault, maxerrorsUsage)
+	optimizeFlag := flags.String("optimize", cf.OptimizeDefault, cf.OptimizeUsage)
+	patchFlag := flags.Bool("patch", patchDefault, patchUsage)
+	sizereportFlag := flags.Bool("size-report", sizereportDefault, sizereportUsage)
 	skipgendepsFlag := flags.Bool("skipgendeps", skipgendepsDefault, skipgendepsUsage)
+	statustableFlag := flags.Bool("statustable", cf.StatustableDefault, cf.StatustableUsage)
+	stdinmapFlag := flags.Bool("stdin-map", stdinmapDefault, stdinmapUsage)
+	outdirFlag := flags.String("outdir", outdirDefault, outdirUsage)
 
 	ccompilersFlag := (*string)(nil)
 	skipgenFlag := (*bool)(nil)
@@ -55,6 +75,9 @@ func doGenGenlib(wuffsRoot string, args []string, genlib bool) error {
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
+	if !cf.IsAlphaNumericIsh(*optimizeFlag) {
+		return fmt.Errorf("bad -optimize flag value %q", *optimizeFlag)
+	}
 	if genlib {
 		if !cf.IsAlphaNumericIsh(*ccompilersFlag) {
 			return fmt.Errorf("bad -ccompilers flag value %q", *ccompilersFlag)
@@ -77,12 +100,44 @@ func doGenGenlib(wuffsRoot string, args []string, genlib bool) error {
 		args = []string{"base", "std/..."}
 	}
 
+	workDir := ""
+	if *stdinmapFlag != (*outdirFlag != "") {
+		return fmt.Errorf("the -stdin-map and -outdir flags must be used together")
+	} else if *stdinmapFlag {
+		root, err := ioutil.TempDir("", "wuffs-gen-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(root)
+		if err := readStdinMap(root, os.Stdin); err != nil {
+			return err
+		}
+		wuffsRoot, workDir = root, root
+	}
+
 	h := genHelper{
-		wuffsRoot:   wuffsRoot,
-		langs:       langs,
-		genlinenum:  *genlinenumFlag,
-		skipgen:     genlib && *skipgenFlag,
-		skipgendeps: *skipgendepsFlag,
+		wuffsRoot:         wuffsRoot,
+		langs:             langs,
+		allocator:         *allocatorFlag,
+		apijson:           *apijsonFlag,
+		audit32:           *audit32Flag,
+		autovec:           *autovecFlag,
+		checkcachedir:     *checkcachedirFlag,
+		checkcacheurl:     *checkcacheurlFlag,
+		checkcacheversion: *checkcacheversionFlag,
+		ctarget:           *ctargetFlag,
+		failfast:          *failfastFlag,
+		genlinenum:        *genlinenumFlag,
+		instrument:        *instrumentFlag,
+		jsonerrors:        *jsonerrorsFlag,
+		maxerrors:         *maxerrorsFlag,
+		optimize:          *optimizeFlag,
+		patch:             *patchFlag,
+		sizereport:        *sizereportFlag,
+		skipgen:           genlib && *skipgenFlag,
+		skipgendeps:       *skipgendepsFlag,
+		statustable:       *statustableFlag,
+		workDir:           workDir,
 	}
 	if genlib {
 		h.ccompilers = *ccompilersFlag
@@ -103,18 +158,44 @@ func doGenGenlib(wuffsRoot string, args []string, genlib bool) error {
 	}
 
 	if genlib {
-		return h.genlibAffected()
+		err = h.genlibAffected()
+	} else {
+		err = genrelease(wuffsRoot, langs, v)
+	}
+	if (err == nil) && *stdinmapFlag {
+		err = copyStdinMapOutputs(wuffsRoot, *outdirFlag)
 	}
-	return genrelease(wuffsRoot, langs, v)
+	return err
 }
 
 type genHelper struct {
-	wuffsRoot   string
-	langs       []string
-	ccompilers  string
-	genlinenum  bool
-	skipgen     bool
-	skipgendeps bool
+	wuffsRoot         string
+	langs             []string
+	ccompilers        string
+	allocator         bool
+	apijson           bool
+	audit32           bool
+	autovec           bool
+	checkcachedir     string
+	checkcacheurl     string
+	checkcacheversion string
+	ctarget           string
+	failfast          bool
+	genlinenum        bool
+	instrument        bool
+	jsonerrors        bool
+	maxerrors         int
+	optimize          string
+	patch             bool
+	sizereport        bool
+	symbolmap         bool
+	skipgen           bool
+	skipgendeps       bool
+	statustable       bool
+
+	// workDir, if non-empty, is the working directory for the wuffs-lang
+	// commands, so that they find the -stdin-map's Wuffs root directory.
+	workDir string
 
 	affected []string
 	seen     map[string]struct{}
@@ -187,29 +268,105 @@ func (h *genHelper) genDir(dirname string, qualFilenames []string) error {
 	for _, lang := range h.langs {
 		command := "wuffs-" + lang
 		cmdArgs := []string{"gen", "-package_name", packageName}
+		if h.checkcachedir != checkcachedirDefault {
+			cmdArgs = append(cmdArgs, "-checkcachedir="+h.checkcachedir)
+		}
+		if h.checkcacheurl != checkcacheurlDefault {
+			cmdArgs = append(cmdArgs, "-checkcacheurl="+h.checkcacheurl)
+		}
+		if h.checkcacheversion != checkcacheversionDefault {
+			cmdArgs = append(cmdArgs, "-checkcacheversion="+h.checkcacheversion)
+		}
+		if h.autovec != cf.AutovecDefault {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("-autovec=%t", h.autovec))
+		}
 		if h.genlinenum != cf.GenlinenumDefault {
 			cmdArgs = append(cmdArgs, fmt.Sprintf("-genlinenum=%t", h.genlinenum))
 		}
+		if h.jsonerrors != jsonerrorsDefault {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("-json-errors=%t", h.jsonerrors))
+		}
+		if h.failfast != failfastDefault {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("-failfast=%t", h.failfast))
+		}
+		if h.maxerrors != maxerrorsDefault {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("-maxerrors=%d", h.maxerrors))
+		}
+		if h.statustable && (lang == "c") {
+			cmdArgs = append(cmdArgs, "-statustable")
+		}
+		if h.allocator && (lang == "c") {
+			cmdArgs = append(cmdArgs, "-allocator")
+		}
+		if h.audit32 && (lang == "c") {
+			cmdArgs = append(cmdArgs, "-audit32")
+		}
+		if h.instrument && (lang == "c") {
+			cmdArgs = append(cmdArgs, "-instrument")
+		}
+		if (h.ctarget != "") && (h.ctarget != cf.CTargetDefault) && (lang == "c") {
+			cmdArgs = append(cmdArgs, "-ctarget="+h.ctarget)
+		}
+		if (h.optimize != "") && (h.optimize != cf.OptimizeDefault) && (lang == "c") {
+			cmdArgs = append(cmdArgs, "-optimize="+h.optimize)
+		}
+		flatDirname := fmt.Sprintf("wuffs-%s", strings.Replace(dirname, "/", "-", -1))
+		if h.patch && (lang == "c") && (packageName != "base") {
+			cmdArgs = append(cmdArgs, "-patch="+h.genFilename(flatDirname, lang))
+		}
+		if h.apijson && (lang == "c") && (packageName != "base") {
+			filename := h.apijsonFilename(flatDirname)
+			if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+				return err
+			}
+			cmdArgs = append(cmdArgs, "-api-json="+filename)
+		}
+		if h.symbolmap && (lang == "c") && (packageName != "base") {
+			filename := h.symbolmapFilename(flatDirname)
+			if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+				return err
+			}
+			cmdArgs = append(cmdArgs, "-symbolmap="+filename)
+		}
+		sizereportFilename := ""
+		if h.sizereport && (lang == "c") && (packageName != "base") {
+			sizereportFilename = h.sizereportFilename(flatDirname)
+			if err := os.MkdirAll(filepath.Dir(sizereportFilename), 0755); err != nil {
+				return err
+			}
+			cmdArgs = append(cmdArgs, "-size-report="+sizereportFilename)
+		}
 		cmdArgs = append(cmdArgs, qualFilenames...)
 		stdout := &bytes.Buffer{}
 
 		cmd := exec.Command(command, cmdArgs...)
+		cmd.Dir = h.workDir
 		cmd.Stdin = nil
 		cmd.Stdout = stdout
 		cmd.Stderr = os.Stderr
 		if err := cmd.Run(); err == nil {
 			// No-op.
 		} else if _, ok := err.(*exec.ExitError); ok {
+			if h.jsonerrors {
+				// The command has already written its errors as JSON.
+				return diagnostic.ErrReported
+			}
 			return fmt.Errorf("%s: failed", command)
 		} else {
 			return err
 		}
 		out := stdout.Bytes()
 
-		flatDirname := fmt.Sprintf("wuffs-%s", strings.Replace(dirname, "/", "-", -1))
 		if err := h.genFile(flatDirname, lang, out); err != nil {
 			return err
 		}
+		if sizereportFilename != "" {
+			report, err := ioutil.ReadFile(sizereportFilename)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(genLog, "gen size report: %s\n%s\n", sizereportFilename, report)
+		}
 	}
 	if len(h.langs) > 0 && packageName != "base" {
 		if err := h.genWuffs(dirname, qualFilenames); err != nil {
@@ -239,11 +396,32 @@ func (h *genHelper) genDirDependencies(qualifiedFilenames []string) error {
 	return h.gen("base", false)
 }
 
+// symbolmapFilename is where "wuffs-c gen -symbolmap" writes a package's
+// symbol map, next to its generated C code. The "wuffs-c bench -flamegraph"
+// command looks for "*.symbols.json" files in that directory.
+func (h *genHelper) symbolmapFilename(dirname string) string {
+	return filepath.Join(h.wuffsRoot, "gen", "c", filepath.FromSlash(dirname)+".symbols.json")
+}
+
+// apijsonFilename is where "wuffs-c gen -api-json" writes a package's JSON
+// summary of its public consts, statuses and public field bounds, next to its
+// generated C code.
+func (h *genHelper) apijsonFilename(dirname string) string {
+	return filepath.Join(h.wuffsRoot, "gen", "c", filepath.FromSlash(dirname)+".api.json")
+}
+
+// sizereportFilename is where "wuffs-c gen -size-report" writes a package's
+// size report, next to its generated C code.
+func (h *genHelper) sizereportFilename(dirname string) string {
+	return filepath.Join(h.wuffsRoot, "gen", "c", filepath.FromSlash(dirname)+".size-report.txt")
+}
+
 func (h *genHelper) genFile(dirname string, lang string, out []byte) error {
-	return writeFile(
-		filepath.Join(h.wuffsRoot, "gen", lang, filepath.FromSlash(dirname)+"."+lang),
-		out,
-	)
+	return writeFile(h.genFilename(dirname, lang), out)
+}
+
+func (h *genHelper) genFilename(dirname string, lang string) string {
+	return filepath.Join(h.wuffsRoot, "gen", lang, filepath.FromSlash(dirname)+"."+lang)
 }
 
 func (h *genHelper) genWuffs(dirname string, qualifiedFilenames []string) error {
@@ -254,75 +432,11 @@ func (h *genHelper) genWuffs(dirname string, qualifiedFilenames []string) error
 		return err
 	}
 
-	out := &bytes.Buffer{}
-	fmt.Fprintf(out, "// Code generated by running \"wuffs gen\". DO NOT EDIT.\n\n")
-
-	for _, f := range files {
-		for _, n := range f.TopLevelDecls() {
-			switch n.Kind() {
-			case a.KConst:
-				n := n.AsConst()
-				if !n.Public() {
-					continue
-				}
-				fmt.Fprintf(out, "pub const %s : %s = %v\n",
-					n.QID().Str(&h.tm), n.XType().Str(&h.tm), n.Value().Str(&h.tm))
-
-			case a.KFunc:
-				n := n.AsFunc()
-				if !n.Public() {
-					continue
-				}
-				if n.Receiver().IsZero() {
-					return fmt.Errorf("TODO: genWuffs for a free-standing function")
-				}
-				// TODO: look at n.Asserts().
-				fmt.Fprintf(out, "pub func %s.%s%v(", n.Receiver().Str(&h.tm), n.FuncName().Str(&h.tm), n.Effect())
-				for i, field := range n.In().Fields() {
-					field := field.AsField()
-					if i > 0 {
-						fmt.Fprintf(out, ", ")
-					}
-					// TODO: what happens if the XType is from another package?
-					// Similarly for the out-param.
-					fmt.Fprintf(out, "%s: %s", field.Name().Str(&h.tm), field.XType().Str(&h.tm))
-				}
-				fmt.Fprintf(out, ") ")
-				if o := n.Out(); o != nil {
-					fmt.Fprintf(out, "%s", o.Str(&h.tm))
-				}
-				fmt.Fprintf(out, " { }\n")
-
-			case a.KStatus:
-				n := n.AsStatus()
-				if !n.Public() {
-					continue
-				}
-				fmt.Fprintf(out, "pub status %s\n", n.QID().Str(&h.tm))
-
-			case a.KStruct:
-				n := n.AsStruct()
-				if !n.Public() {
-					continue
-				}
-				fmt.Fprintf(out, "pub struct %s", n.QID().Str(&h.tm))
-				if n.Classy() {
-					fmt.Fprintf(out, "?")
-				}
-				if imps := n.Implements(); len(imps) > 0 {
-					fmt.Fprintf(out, " implements ")
-					for i, imp := range imps {
-						if i > 0 {
-							fmt.Fprintf(out, ", ")
-						}
-						fmt.Fprintf(out, "%s", imp.AsTypeExpr().Str(&h.tm))
-					}
-				}
-				fmt.Fprintf(out, "()\n")
-			}
-		}
+	out, err := generate.Summarize(&h.tm, files)
+	if err != nil {
+		return err
 	}
-	return h.genFile(dirname, "wuffs", out.Bytes())
+	return h.genFile(dirname, "wuffs", out)
 }
 
 func (h *genHelper) genlibAffected() error {
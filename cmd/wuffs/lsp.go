@@ -0,0 +1,47 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/lsp"
+)
+
+func doLsp(wuffsRoot string, args []string) error {
+	flags := flag.NewFlagSet("lsp", flag.ExitOnError)
+	checkcachedirFlag := flags.String("checkcachedir", checkcachedirDefault, checkcachedirUsage)
+	maxerrorsFlag := flags.Int("maxerrors", maxerrorsDefault, maxerrorsUsage)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errors.New("lsp: unexpected arguments")
+	}
+
+	// The Language Server Protocol is spoken over stdin and stdout.
+	return lsp.Serve(os.Stdin, os.Stdout, &lsp.Options{
+		WuffsRoot: wuffsRoot,
+		Check: check.Options{
+			CacheDir:   *checkcachedirFlag,
+			TrackFacts: true,
+			MaxErrors:  *maxerrorsFlag,
+		},
+	})
+}
@@ -21,12 +21,14 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 
+	"github.com/google/wuffs/lang/diagnostic"
 	"github.com/google/wuffs/lang/wuffsroot"
 )
 
@@ -35,9 +37,14 @@ var commands = []struct {
 	do   func(wuffsRoot string, args []string) error
 }{
 	{"bench", doBench},
+	{"example", doExample},
 	{"gen", doGen},
 	{"genlib", doGenlib},
+	{"lsp", doLsp},
+	{"query", doQuery},
 	{"test", doTest},
+	{"trace", doTrace},
+	{"vet", doVet},
 }
 
 func usage() {
@@ -50,15 +57,22 @@ Usage:
 The commands are:
 
 	bench   benchmark packages
+	example print an example program that uses a package
 	gen     generate code for packages and dependencies
 	genlib  generate software libraries
+	lsp     run a Language Server Protocol server on stdin and stdout
+	query   print what the checker knows at a source position
 	test    test packages
+	trace   step through a function's fact trace, from "wuffs vet -facttrace"
+	vet     report suspicious constructs, such as dead stores, in packages
 `)
 }
 
 func main() {
 	if err := main1(); err != nil {
-		os.Stderr.WriteString(err.Error() + "\n")
+		if err != diagnostic.ErrReported {
+			os.Stderr.WriteString(err.Error() + "\n")
+		}
 		os.Exit(1)
 	}
 }
@@ -68,7 +82,7 @@ func main1() error {
 	flag.Parse()
 
 	wuffsRoot, err := wuffsroot.Value()
-	if err != nil {
+	if (err != nil) && !usesStdinMap(flag.Args()) {
 		return err
 	}
 	if args := flag.Args(); len(args) > 0 {
@@ -141,9 +155,13 @@ func appendDir(dstQF []string, qualDirname string, suffix string, returnSubdirs
 	return dstQF, relDirnames, nil
 }
 
+// genLog is where writeFile reports what it wrote. Commands whose stdout is
+// their output, such as "wuffs example", redirect it to stderr.
+var genLog io.Writer = os.Stdout
+
 func writeFile(filename string, contents []byte) error {
 	if existing, err := ioutil.ReadFile(filename); err == nil && bytes.Equal(existing, contents) {
-		fmt.Println("gen unchanged: ", filename)
+		fmt.Fprintln(genLog, "gen unchanged: ", filename)
 		return nil
 	}
 	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
@@ -152,19 +170,67 @@ func writeFile(filename string, contents []byte) error {
 	if err := ioutil.WriteFile(filename, contents, 0644); err != nil {
 		return err
 	}
-	fmt.Println("gen wrote:     ", filename)
+	fmt.Fprintln(genLog, "gen wrote:     ", filename)
 	return nil
 }
 
 const (
+	checkcachedirDefault = ""
+	checkcachedirUsage   = `if non-empty, the directory in which to cache which functions have already been bounds checked`
+
+	checkcacheurlDefault = ""
+	checkcacheurlUsage   = `if non-empty, the base URL of a remote (HTTP GET/PUT) cache of which functions have already been bounds checked, shared between machines`
+
+	checkcacheversionDefault = ""
+	checkcacheversionUsage   = `if non-empty, the version stamp identifying the checker for the -checkcacheurl cache; empty means a hash of the wuffs-c executable`
+
+	failfastDefault = false
+	failfastUsage   = `whether to stop at the first parse or check error, instead of carrying on to report more`
+
+	jsonerrorsDefault = false
+	jsonerrorsUsage   = `whether to write errors and warnings to stderr as JSON diagnostics, one per line`
+
+	maxerrorsDefault = 10
+	maxerrorsUsage   = `the maximum number of parse or check errors to report per package`
+
 	langsDefault = "c"
-	langsUsage   = `comma-separated list of target languages (file extensions), e.g. "c,go,rs"`
+	langsUsage   = `comma-separated list of target languages (file extensions), e.g. "c,go,rs"; "go" and "wasm" are experimental and only support some packages, such as std/crc32`
+
+	patchDefault = false
+	patchUsage   = `whether to patch the existing generated C files, re-generating only the functions whose Wuffs code changed`
 
 	skipgenDefault = false
 	skipgenUsage   = `whether to skip automatically generating code when testing`
 
 	skipgendepsDefault = false
 	skipgendepsUsage   = `whether to skip automatically generating packages' dependencies`
+
+	stdinmapDefault = false
+	stdinmapUsage   = `whether to read the Wuffs source files from stdin (as a tar stream or a JSON object mapping paths to contents), instead of from the Wuffs root directory, for hermetic build systems; requires -outdir`
+
+	outdirDefault = ""
+	outdirUsage   = `the directory to write generated files to, when using -stdin-map`
+
+	apijsonDefault = false
+	apijsonUsage   = `whether to also write a JSON summary of each package's public consts (such as limits), status strings and public field bounds, next to its generated C code`
+
+	sizereportDefault = false
+	sizereportUsage   = `whether to also write (and print) a report of each package's generated C function sizes, next to its generated C code`
+
+	assertcoverageDefault = false
+	assertcoverageUsage   = `whether to also print, for every assert statement, whether later proofs need it`
+
+	explainDefault = false
+	explainUsage   = `whether to also print the prover's reasoning for every proof obligation (and for every expression bounds check that fails)`
+
+	facttraceDefault = ""
+	facttraceUsage   = `if non-empty, the filename to write a trace of every fact that bounds checking inserts, drops or refines to, for "wuffs trace"`
+
+	reportDefault = ""
+	reportUsage   = `if non-empty, the filename to write an HTML report of any check failure to, showing where each fact was established or dropped`
+
+	suggestDefault = false
+	suggestUsage   = `whether to also print suggested refinements, for numeric variables and fields that provably stay within a tighter range than their type`
 )
 
 func parseLangs(commaSeparated string) ([]string, error) {
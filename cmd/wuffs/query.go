@@ -0,0 +1,127 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/generate"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+func doQuery(wuffsRoot string, args []string) error {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	skipgendepsFlag := flags.Bool("skipgendeps", skipgendepsDefault, skipgendepsUsage)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if (len(args) != 2) || (args[0] != "bounds") {
+		return errors.New("query: usage: wuffs query bounds file.wuffs:line:column")
+	}
+	filename, line, column, err := parsePosition(args[1])
+	if err != nil {
+		return fmt.Errorf("query: %v", err)
+	}
+
+	// The query's package is every *.wuffs file in the same directory.
+	qualFilenames, _, err := listDir(filepath.Dir(filename), ".wuffs", false)
+	if err != nil {
+		return err
+	}
+	if !*skipgendepsFlag {
+		gh := genHelper{
+			wuffsRoot: wuffsRoot,
+			langs:     []string{langsDefault},
+		}
+		if err := gh.genDirDependencies(qualFilenames); err != nil {
+			return err
+		}
+	}
+
+	tm := &t.Map{}
+	files, err := generate.ParseFiles(tm, qualFilenames, nil)
+	if err != nil {
+		return err
+	}
+	z := &check.Query{Filename: filename, Line: line, Column: column}
+	_, checkErr := check.Check(tm, files, func(usePath string) ([]byte, error) {
+		return ioutil.ReadFile(filepath.Join(wuffsRoot, "gen", "wuffs", filepath.FromSlash(usePath)))
+	}, &check.Options{Query: z})
+
+	// A check failure, such as a failed proof, is printed after what the
+	// checker knew, since that is often what the query is trying to explain.
+	if z.Stmt == nil {
+		if checkErr != nil {
+			return checkErr
+		}
+		return fmt.Errorf("query: no statement at %s", args[1])
+	}
+	if z.Expr == nil {
+		fmt.Printf("expr:   none\n")
+	} else {
+		typ := z.Expr.MType()
+		fmt.Printf("expr:   %s\n", z.Expr.Str(tm))
+		fmt.Printf("type:   %s\n", typ.Str(tm))
+		// Only numbers have meaningful bounds.
+		if typ.IsNumTypeOrIdeal() {
+			bounds := "unknown"
+			if b := z.Expr.MBounds(); (b[0] != nil) && (b[1] != nil) {
+				bounds = b.String()
+			}
+			fmt.Printf("bounds: %s\n", bounds)
+		}
+	}
+	_, stmtLine := z.Stmt.AsRaw().FilenameLine()
+	facts := []string(nil)
+	for _, x := range z.Facts {
+		facts = append(facts, x.Str(tm))
+	}
+	sort.Strings(facts)
+	fmt.Printf("facts at the start of line %d:\n", stmtLine)
+	for _, f := range facts {
+		fmt.Printf("\t%s\n", f)
+	}
+	return checkErr
+}
+
+// parsePosition parses a "file.wuffs:line:column" position, where the line
+// and column are 1-based and the column counts bytes.
+func parsePosition(s string) (filename string, line uint32, column uint32, err error) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return "", 0, 0, fmt.Errorf("invalid position %q", s)
+	}
+	j := strings.LastIndexByte(s[:i], ':')
+	if j < 0 {
+		return "", 0, 0, fmt.Errorf("invalid position %q", s)
+	}
+	l, err0 := strconv.ParseUint(s[j+1:i], 10, 32)
+	c, err1 := strconv.ParseUint(s[i+1:], 10, 32)
+	if (err0 != nil) || (err1 != nil) || (l == 0) || (c == 0) {
+		return "", 0, 0, fmt.Errorf("invalid position %q", s)
+	}
+	return filepath.Clean(s[:j]), uint32(l), uint32(c), nil
+}
@@ -30,6 +30,12 @@ func genrelease(wuffsRoot string, langs []string, v cf.Version) error {
 		"--quiet", "--date=format-local:%Y-%m-%d", "--format=%cd")
 	gitRevListCount := runGitCommand(wuffsRoot, "rev-list", "--count", "HEAD")
 	for _, lang := range langs {
+		// Each package's WebAssembly module is freestanding, and they cannot be
+		// combined into a single release module without a linker, so there is
+		// no WebAssembly release. Use the gen/wasm modules instead.
+		if lang == "wasm" {
+			continue
+		}
 		filename, contents, err := genreleaseLang(wuffsRoot, revision, commitDate, gitRevListCount, v, lang)
 		if err != nil {
 			return err
@@ -0,0 +1,155 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// This file implements "wuffs gen -stdin-map -outdir=foo", for hermetic build
+// systems (such as Bazel or Buck) whose sandboxes only expose declared inputs
+// and outputs, not a whole Wuffs root directory to scan.
+//
+// Stdin holds the inputs, as a virtual Wuffs root directory: either a tar
+// stream or, if its first non-space byte is '{', a JSON object mapping virtual
+// paths to file contents, such as:
+//
+//   {"std/adler32/common_adler32.wuffs": "// Copyright etc"}
+//
+// Virtual paths are relative to the Wuffs root directory and are slash
+// separated, such as "std/gif/decode_gif.wuffs" or, for a dependency whose
+// code is not generated again (see -skipgendeps), "gen/wuffs/std/lzw.wuffs".
+// They cannot be absolute or contain ".." elements.
+//
+// The command writes those files to a new temporary directory, generates code
+// there as usual and then copies that directory's outputs (its "gen" and
+// "release" trees) to the outdir, with the same layout, such as
+// "foo/gen/c/wuffs-std-gif.c". It does not read any other directory, other than to
+// run the wuffs-c (or other wuffs-lang) commands.
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// usesStdinMap returns whether args (the command line arguments after the
+// global flags) are for "wuffs gen -stdin-map" or "wuffs genlib -stdin-map",
+// which do not need an existing Wuffs root directory.
+func usesStdinMap(args []string) bool {
+	if (len(args) == 0) || ((args[0] != "gen") && (args[0] != "genlib")) {
+		return false
+	}
+	for _, arg := range args[1:] {
+		if (arg == "--") || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		arg = strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if (arg == "stdin-map") || (arg == "stdin-map=true") {
+			return true
+		}
+	}
+	return false
+}
+
+// readStdinMap reads a virtual Wuffs root directory, as a tar stream or a JSON
+// object, from r and writes it to the real root directory.
+func readStdinMap(root string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if trimmed := bytes.TrimSpace(data); (len(trimmed) > 0) && (trimmed[0] == '{') {
+		m := map[string]string{}
+		if err := json.Unmarshal(trimmed, &m); err != nil {
+			return fmt.Errorf("-stdin-map: %v", err)
+		}
+		for virtualPath, contents := range m {
+			if err := writeStdinMapFile(root, virtualPath, []byte(contents)); err != nil {
+				return err
+			}
+		}
+	} else {
+		tr := tar.NewReader(bytes.NewReader(data))
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("-stdin-map: %v", err)
+			}
+			switch hdr.Typeflag {
+			case tar.TypeDir:
+				continue
+			case tar.TypeReg, tar.TypeRegA:
+				// No-op.
+			default:
+				return fmt.Errorf("-stdin-map: %q is not a regular file or directory", hdr.Name)
+			}
+			contents, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return fmt.Errorf("-stdin-map: %v", err)
+			}
+			if err := writeStdinMapFile(root, strings.TrimPrefix(hdr.Name, "./"), contents); err != nil {
+				return err
+			}
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(root, "wuffs-root-directory.txt"), nil, 0644)
+}
+
+func writeStdinMapFile(root string, virtualPath string, contents []byte) error {
+	if (virtualPath == "") || (virtualPath == ".") || (virtualPath == "..") ||
+		path.IsAbs(virtualPath) || (path.Clean(virtualPath) != virtualPath) ||
+		strings.HasPrefix(virtualPath, "../") || strings.Contains(virtualPath, `\`) {
+		return fmt.Errorf("-stdin-map: invalid virtual path %q", virtualPath)
+	}
+	filename := filepath.Join(root, filepath.FromSlash(virtualPath))
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, contents, 0644)
+}
+
+// copyStdinMapOutputs copies the generated files, under the real root
+// directory, to the outdir.
+func copyStdinMapOutputs(root string, outdir string) error {
+	for _, dirname := range []string{"gen", "release"} {
+		src := filepath.Join(root, dirname)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		if err := filepath.Walk(src, func(filename string, info os.FileInfo, err error) error {
+			if (err != nil) || info.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(root, filename)
+			if err != nil {
+				return err
+			}
+			contents, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return err
+			}
+			return writeFile(filepath.Join(outdir, rel), contents)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
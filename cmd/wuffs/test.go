@@ -17,12 +17,18 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/generate"
+
 	cf "github.com/google/wuffs/cmd/commonflags"
+
+	t "github.com/google/wuffs/lang/token"
 )
 
 func doBench(wuffsRoot string, args []string) error { return doBenchTest(wuffsRoot, args, true) }
@@ -31,6 +37,7 @@ func doTest(wuffsRoot string, args []string) error  { return doBenchTest(wuffsRo
 func doBenchTest(wuffsRoot string, args []string, bench bool) error {
 	flags := flag.NewFlagSet("test", flag.ExitOnError)
 	ccompilersFlag := flags.String("ccompilers", cf.CcompilersDefault, cf.CcompilersUsage)
+	flamegraphFlag := flags.String("flamegraph", cf.FlamegraphDefault, cf.FlamegraphUsage)
 	focusFlag := flags.String("focus", cf.FocusDefault, cf.FocusUsage)
 	iterscaleFlag := flags.Int("iterscale", cf.IterscaleDefault, cf.IterscaleUsage)
 	langsFlag := flags.String("langs", langsDefault, langsUsage)
@@ -38,11 +45,20 @@ func doBenchTest(wuffsRoot string, args []string, bench bool) error {
 	repsFlag := flags.Int("reps", cf.RepsDefault, cf.RepsUsage)
 	skipgenFlag := flags.Bool("skipgen", skipgenDefault, skipgenUsage)
 	skipgendepsFlag := flags.Bool("skipgendeps", skipgendepsDefault, skipgendepsUsage)
+	snapshotFlag := flags.Bool("snapshot", cf.SnapshotDefault, cf.SnapshotUsage)
+	updateFlag := flags.Bool("update", cf.UpdateDefault, cf.UpdateUsage)
 
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
 
+	if bench && *snapshotFlag {
+		return fmt.Errorf("cannot combine bench and -snapshot")
+	}
+	if !bench && (*flamegraphFlag != cf.FlamegraphDefault) {
+		return fmt.Errorf("cannot combine test and -flamegraph")
+	}
+
 	langs, err := parseLangs(*langsFlag)
 	if err != nil {
 		return err
@@ -73,8 +89,23 @@ func doBenchTest(wuffsRoot string, args []string, bench bool) error {
 			fmt.Sprintf("-iterscale=%d", *iterscaleFlag),
 			fmt.Sprintf("-reps=%d", *repsFlag),
 		)
+		if *flamegraphFlag != cf.FlamegraphDefault {
+			// The bench programs run in the Wuffs root directory, so make the
+			// flamegraph directory absolute.
+			dir, err := filepath.Abs(*flamegraphFlag)
+			if err != nil {
+				return err
+			}
+			cmdArgs = append(cmdArgs, "-flamegraph="+dir)
+		}
 	} else {
 		cmdArgs = append(cmdArgs, "test")
+		if *snapshotFlag {
+			cmdArgs = append(cmdArgs, "-snapshot")
+		}
+		if *updateFlag {
+			cmdArgs = append(cmdArgs, "-update")
+		}
 	}
 	if *focusFlag != "" {
 		cmdArgs = append(cmdArgs, fmt.Sprintf("-focus=%s", *focusFlag))
@@ -88,6 +119,8 @@ func doBenchTest(wuffsRoot string, args []string, bench bool) error {
 		langs:      langs,
 		cmdArgs:    cmdArgs,
 		ccompilers: *ccompilersFlag,
+		// The -focus flag selects C test functions, not test blocks.
+		runTestBlocks: !bench && (*focusFlag == ""),
 	}
 
 	// Ensure that we are testing the latest version of the generated code.
@@ -95,6 +128,7 @@ func doBenchTest(wuffsRoot string, args []string, bench bool) error {
 		gh := genHelper{
 			wuffsRoot:   wuffsRoot,
 			langs:       langs,
+			symbolmap:   *flamegraphFlag != cf.FlamegraphDefault,
 			skipgen:     *skipgenFlag,
 			skipgendeps: *skipgendepsFlag,
 		}
@@ -144,10 +178,11 @@ func doBenchTest(wuffsRoot string, args []string, bench bool) error {
 }
 
 type testHelper struct {
-	wuffsRoot  string
-	langs      []string
-	cmdArgs    []string
-	ccompilers string
+	wuffsRoot     string
+	langs         []string
+	cmdArgs       []string
+	ccompilers    string
+	runTestBlocks bool
 }
 
 func (h *testHelper) benchTest(dirname string, recursive bool) (failed bool, err error) {
@@ -160,6 +195,13 @@ func (h *testHelper) benchTest(dirname string, recursive bool) (failed bool, err
 		return false, err
 	}
 	if len(qualFilenames) > 0 {
+		if h.runTestBlocks {
+			f, err := h.testBlocksDir(dirname, qualFilenames)
+			if err != nil {
+				return false, err
+			}
+			failed = failed || f
+		}
 		f, err := h.benchTestDir(dirname)
 		if err != nil {
 			return false, err
@@ -204,3 +246,32 @@ func (h *testHelper) benchTestDir(dirname string) (failed bool, err error) {
 	}
 	return failed, nil
 }
+
+// testBlocksDir runs the `test "name" { etc }` blocks in a package's Wuffs
+// source files, printing the results in the same format as the C tests.
+func (h *testHelper) testBlocksDir(dirname string, qualFilenames []string) (failed bool, err error) {
+	tm := &t.Map{}
+	files, err := generate.ParseFiles(tm, qualFilenames, nil)
+	if err != nil {
+		return false, err
+	}
+	c, err := check.Check(tm, files, func(usePath string) ([]byte, error) {
+		return ioutil.ReadFile(filepath.Join(h.wuffsRoot, "gen", "wuffs", filepath.FromSlash(usePath)))
+	}, nil)
+	if err != nil {
+		return false, err
+	}
+
+	tests := c.Tests()
+	if len(tests) == 0 {
+		return false, nil
+	}
+	for _, n := range tests {
+		if err := c.RunTest(n); err != nil {
+			fmt.Printf("%-16s%-8sFAIL %v\n", dirname, "wuffs", err)
+			return true, nil
+		}
+	}
+	fmt.Printf("%-16s%-8sPASS (%d tests)\n", dirname, "wuffs", len(tests))
+	return false, nil
+}
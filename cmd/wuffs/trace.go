@@ -0,0 +1,170 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/wuffs/lang/check"
+)
+
+const traceHelp = `Commands:
+	<enter>, n  step forward
+	p           step backward
+	g N         go to step N
+	f TEXT      go forward to the next step whose fact contains TEXT
+	b TEXT      go backward to the previous step whose fact contains TEXT
+	q           quit
+`
+
+// doTrace steps through a function's fact trace, as written by "wuffs vet
+// -facttrace". See lang/check/trace.go.
+func doTrace(wuffsRoot string, args []string) error {
+	flags := flag.NewFlagSet("trace", flag.ExitOnError)
+	funcFlag := flags.String("func", "", `the function to step through, such as "decoder.decode_frame"`)
+	htmlFlag := flags.String("html", "", `if non-empty, the filename to write an HTML page that steps through the trace to, instead of stepping through it interactively`)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) != 1 {
+		return errors.New("trace: usage: wuffs trace [-func=name] [-html=filename] trace.jsonl")
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	events, err := check.ReadFactTrace(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	funcName := *funcFlag
+	if funcName == "" {
+		funcs := check.FactTraceFuncs(events)
+		if len(funcs) != 1 {
+			return fmt.Errorf("trace: the trace has %d functions, so use -func to pick one of:\n\t%s",
+				len(funcs), strings.Join(funcs, "\n\t"))
+		}
+		funcName = funcs[0]
+	}
+	steps, err := check.ReplayFactTrace(events, funcName)
+	if err != nil {
+		return err
+	}
+	// A missing source file only omits the source lines.
+	src, _ := ioutil.ReadFile(steps[0].File)
+
+	if *htmlFlag != "" {
+		buf := &bytes.Buffer{}
+		if err := check.WriteHTMLFactTrace(buf, steps, src); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(*htmlFlag, buf.Bytes(), 0644)
+	}
+	return stepTrace(os.Stdout, os.Stdin, steps, bytes.Split(src, []byte("\n")))
+}
+
+func stepTrace(w io.Writer, r io.Reader, steps []check.FactTraceStep, srcLines [][]byte) error {
+	fmt.Fprintf(w, "%s: %d steps.\n%s", steps[0].Event.Func, len(steps), traceHelp)
+	i := 0
+	showTraceStep(w, steps, i, srcLines)
+	scanner := bufio.NewScanner(r)
+	for fmt.Fprint(w, "> "); scanner.Scan(); fmt.Fprint(w, "> ") {
+		cmd, arg := scanner.Text(), ""
+		if j := strings.IndexByte(cmd, ' '); j >= 0 {
+			cmd, arg = cmd[:j], strings.TrimSpace(cmd[j+1:])
+		}
+		j := i
+		switch cmd {
+		case "", "n":
+			j = i + 1
+		case "p":
+			j = i - 1
+		case "g":
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				fmt.Fprintf(w, "bad step number %q\n", arg)
+				continue
+			}
+			j = n - 1
+		case "f", "b":
+			j = findTraceStep(steps, i, arg, cmd == "f")
+			if j < 0 {
+				fmt.Fprintf(w, "no such step\n")
+				continue
+			}
+		case "q":
+			return nil
+		default:
+			fmt.Fprint(w, traceHelp)
+			continue
+		}
+		if (j < 0) || (len(steps) <= j) {
+			fmt.Fprintf(w, "no such step\n")
+			continue
+		}
+		i = j
+		showTraceStep(w, steps, i, srcLines)
+	}
+	fmt.Fprintln(w)
+	return scanner.Err()
+}
+
+// findTraceStep returns the index of the next (or previous, if not forward)
+// step after (or before) i whose fact contains text, or -1 if there is none.
+func findTraceStep(steps []check.FactTraceStep, i int, text string, forward bool) int {
+	delta := +1
+	if !forward {
+		delta = -1
+	}
+	for j := i + delta; (0 <= j) && (j < len(steps)); j += delta {
+		e := steps[j].Event
+		if strings.Contains(e.Fact, text) || ((e.From != "") && strings.Contains(e.From, text)) {
+			return j
+		}
+	}
+	return -1
+}
+
+func showTraceStep(w io.Writer, steps []check.FactTraceStep, i int, srcLines [][]byte) {
+	e := steps[i].Event
+	fmt.Fprintf(w, "\nstep %d/%d, line %d: %s", i+1, len(steps), e.Line, e.Op)
+	if e.Fact != "" {
+		fmt.Fprintf(w, " %s", e.Fact)
+	}
+	if e.From != "" {
+		fmt.Fprintf(w, " (was %s)", e.From)
+	}
+	fmt.Fprintln(w)
+	if (e.Line > 0) && (int(e.Line) <= len(srcLines)) {
+		fmt.Fprintf(w, "%6d | %s\n", e.Line, bytes.TrimRight(srcLines[e.Line-1], " \t\r"))
+	}
+	fmt.Fprintf(w, "facts:\n")
+	for _, f := range steps[i].Facts {
+		fmt.Fprintf(w, "\t%s\n", f)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/generate"
+
+	cf "github.com/google/wuffs/cmd/commonflags"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+func doVet(wuffsRoot string, args []string) error {
+	flags := flag.NewFlagSet("vet", flag.ExitOnError)
+	assertcoverageFlag := flags.Bool("assertcoverage", assertcoverageDefault, assertcoverageUsage)
+	skipgendepsFlag := flags.Bool("skipgendeps", skipgendepsDefault, skipgendepsUsage)
+	suggestFlag := flags.Bool("suggest", suggestDefault, suggestUsage)
+	explainFlag := flags.Bool("explain", explainDefault, explainUsage)
+	reportFlag := flags.String("report", reportDefault, reportUsage)
+	facttraceFlag := flags.String("facttrace", facttraceDefault, facttraceUsage)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		args = []string{"std/..."}
+	}
+
+	facttrace := (*bufio.Writer)(nil)
+	if *facttraceFlag != "" {
+		f, err := os.Create(*facttraceFlag)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		facttrace = bufio.NewWriter(f)
+		defer facttrace.Flush()
+	}
+
+	h := vetHelper{
+		gh: genHelper{
+			wuffsRoot:   wuffsRoot,
+			langs:       []string{langsDefault},
+			skipgendeps: *skipgendepsFlag,
+		},
+		suggest:        *suggestFlag,
+		explain:        *explainFlag,
+		report:         *reportFlag,
+		assertcoverage: *assertcoverageFlag,
+		facttrace:      facttrace,
+	}
+	for _, arg := range args {
+		recursive := strings.HasSuffix(arg, "/...")
+		if recursive {
+			arg = arg[:len(arg)-4]
+		}
+		if arg == "" {
+			continue
+		}
+
+		if err := h.vet(arg, recursive); err != nil {
+			return err
+		}
+	}
+
+	// Warnings are advisory: like suggestions, they do not make vet fail. Only
+	// parse and check errors do.
+	if h.numWarnings > 0 {
+		fmt.Printf("vet: %d warning(s)\n", h.numWarnings)
+	}
+	return nil
+}
+
+type vetHelper struct {
+	gh             genHelper
+	suggest        bool
+	explain        bool
+	report         string
+	assertcoverage bool
+	facttrace      *bufio.Writer
+	numWarnings    int
+}
+
+func (h *vetHelper) vet(dirname string, recursive bool) error {
+	for len(dirname) > 0 && dirname[len(dirname)-1] == '/' {
+		dirname = dirname[:len(dirname)-1]
+	}
+	if !cf.IsValidUsePath(dirname) {
+		return fmt.Errorf("invalid package path %q", dirname)
+	}
+
+	qualFilenames, dirnames, err := listDir(
+		filepath.Join(h.gh.wuffsRoot, filepath.FromSlash(dirname)), ".wuffs", recursive)
+	if err != nil {
+		return err
+	}
+	if len(qualFilenames) > 0 {
+		if err := h.vetDir(dirname, qualFilenames); err != nil {
+			return err
+		}
+	}
+	for _, d := range dirnames {
+		if err := h.vet(dirname+"/"+d, recursive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *vetHelper) vetDir(dirname string, qualFilenames []string) error {
+	// The checker resolves a package's dependencies via their generated
+	// "gen/wuffs" files, so make sure that those are up to date.
+	if !h.gh.skipgendeps {
+		if err := h.gh.genDirDependencies(qualFilenames); err != nil {
+			return err
+		}
+	}
+
+	tm := &t.Map{}
+	files, err := generate.ParseFiles(tm, qualFilenames, nil)
+	if err != nil {
+		return err
+	}
+	opts := &check.Options{
+		Suggest:        h.suggest,
+		TrackFacts:     h.report != "",
+		AssertCoverage: h.assertcoverage,
+	}
+	if h.explain {
+		opts.Explain = os.Stdout
+	}
+	if h.facttrace != nil {
+		opts.FactTrace = h.facttrace
+	}
+	c, err := check.Check(tm, files, func(usePath string) ([]byte, error) {
+		return ioutil.ReadFile(filepath.Join(h.gh.wuffsRoot, "gen", "wuffs", filepath.FromSlash(usePath)))
+	}, opts)
+	if err != nil {
+		if e, ok := err.(*check.Error); ok && (h.report != "") {
+			if rErr := writeCheckReport(h.report, e); rErr != nil {
+				return rErr
+			}
+		}
+		return err
+	}
+	for _, w := range c.Warnings() {
+		fmt.Println(w.String())
+		h.numWarnings++
+	}
+	// Suggestions are not warnings, and are printed after them.
+	for _, s := range c.Suggestions() {
+		fmt.Println(s.String())
+	}
+	if vs := c.AssertCoverage(); len(vs) > 0 {
+		for _, v := range vs {
+			fmt.Println(v.String())
+		}
+		fmt.Printf("check: %s assert coverage: %s", dirname, check.SummarizeAssertCoverage(vs))
+	}
+	return nil
+}
+
+// writeCheckReport writes e as an HTML report to the named file.
+func writeCheckReport(filename string, e *check.Error) error {
+	// A missing source file only omits the report's source excerpt.
+	src, _ := ioutil.ReadFile(e.Filename)
+	buf := &bytes.Buffer{}
+	if err := check.WriteHTMLReport(buf, e, src); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), 0644)
+}
@@ -21,6 +21,10 @@
 // place) or both flags must be given. Given a file path, it operates on that
 // file; given a directory path, it operates on all *.wuffs files in that
 // directory, recursively. File paths starting with a period are ignored.
+//
+// With the -serve flag, it instead reads formatting requests from standard
+// input and writes the responses to standard output, one line of JSON each,
+// for editor plugins. See the lang/format package's Serve function.
 package main
 
 import (
@@ -35,15 +39,13 @@ import (
 	"runtime"
 	"strings"
 
-	"github.com/google/wuffs/lang/parse"
-	"github.com/google/wuffs/lang/render"
-
-	t "github.com/google/wuffs/lang/token"
+	"github.com/google/wuffs/lang/format"
 )
 
 var (
-	lFlag = flag.Bool("l", false, "list files whose formatting differs from wuffsfmt's")
-	wFlag = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	lFlag     = flag.Bool("l", false, "list files whose formatting differs from wuffsfmt's")
+	serveFlag = flag.Bool("serve", false, "serve JSON formatting requests on stdin, instead of formatting files")
+	wFlag     = flag.Bool("w", false, "write result to (source) file instead of stdout")
 )
 
 func usage() {
@@ -62,6 +64,13 @@ func main1() error {
 	flag.Usage = usage
 	flag.Parse()
 
+	if *serveFlag {
+		if *lFlag || *wFlag || (flag.NArg() != 0) {
+			return errors.New("cannot use -l, -w or paths with -serve")
+		}
+		return format.Serve(os.Stdin, os.Stdout)
+	}
+
 	if flag.NArg() == 0 {
 		if *lFlag {
 			return errors.New("cannot use -l with standard input")
@@ -121,23 +130,10 @@ func do(r io.Reader, filename string) error {
 		return err
 	}
 
-	tm := &t.Map{}
-	tokens, comments, err := t.Tokenize(tm, filename, src)
+	dst, err := format.Source(filename, src, nil)
 	if err != nil {
 		return err
 	}
-	// We don't need the AST node to pretty-print, but it's worth rejecting
-	// syntax errors early. This is just a parse, not a full type check.
-	if _, err := parse.Parse(tm, filename, tokens, &parse.Options{
-		AllowDoubleUnderscoreNames: true,
-	}); err != nil {
-		return err
-	}
-	buf := &bytes.Buffer{}
-	if err := render.Render(buf, tm, tokens, comments); err != nil {
-		return err
-	}
-	dst := buf.Bytes()
 
 	if r != nil {
 		if _, err := os.Stdout.Write(dst); err != nil {
@@ -0,0 +1,256 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// ----------------
+
+// Silence the nested slash-star warning for the next comment's command line.
+#pragma clang diagnostic push
+#pragma clang diagnostic ignored "-Wcomment"
+
+/*
+This fuzzer (the fuzz function) is typically run indirectly, by a framework
+such as https://github.com/google/oss-fuzz calling LLVMFuzzerTestOneInput.
+
+When working on the fuzz implementation, or as a coherence check, defining
+WUFFS_CONFIG__FUZZLIB_MAIN will let you manually run fuzz over a set of files:
+
+gcc -DWUFFS_CONFIG__FUZZLIB_MAIN cpu_arch_fuzzer.c
+./a.out ../../../test/data/*.png
+rm -f ./a.out
+
+It should print "PASS", amongst other information, and exit(0).
+*/
+
+#pragma clang diagnostic pop
+
+// This is a differential fuzzer. Unlike the other fuzzers, which exercise
+// whichever choosy function variants the CPU dispatches to, it runs the same
+// input through the portable variants (initializing with
+// WUFFS_INITIALIZE__AVOID_CPU_ARCH) and then through each CPU-architecture-
+// specific variant that this CPU supports, one at a time. Any difference in
+// their output is an internal error.
+//
+// It covers the packages that have choosy functions: adler32, crc32 and png.
+
+// Wuffs ships as a "single file C library" or "header file library" as per
+// https://github.com/nothings/stb/blob/master/docs/stb_howto.txt
+//
+// To use that single file as a "foo.c"-like implementation, instead of a
+// "foo.h"-like header, #define WUFFS_IMPLEMENTATION before #include'ing or
+// compiling it.
+#define WUFFS_IMPLEMENTATION
+
+// Defining the WUFFS_CONFIG__MODULE* macros are optional, but it lets users of
+// release/c/etc.c choose which parts of Wuffs to build. That file contains the
+// entire Wuffs standard library, implementing a variety of codecs and file
+// formats. Without this macro definition, an optimizing compiler or linker may
+// very well discard Wuffs code for unused codecs, but listing the Wuffs
+// modules we use makes that process explicit. Preprocessing means that such
+// code simply isn't compiled.
+#define WUFFS_CONFIG__MODULES
+#define WUFFS_CONFIG__MODULE__ADLER32
+#define WUFFS_CONFIG__MODULE__BASE
+#define WUFFS_CONFIG__MODULE__CRC32
+#define WUFFS_CONFIG__MODULE__DEFLATE
+#define WUFFS_CONFIG__MODULE__PNG
+#define WUFFS_CONFIG__MODULE__ZLIB
+
+// If building this program in an environment that doesn't easily accommodate
+// relative includes, you can use the script/inline-c-relative-includes.go
+// program to generate a stand-alone C file.
+#include "../../../release/c/wuffs-unsupported-snapshot.c"
+#include "../fuzzlib/fuzzlib.c"
+
+// cpu_arch_result is what each set of variants computes. They should agree.
+typedef struct {
+  uint32_t adler32;
+  uint32_t crc32;
+  uint32_t png_pixel_hash;
+  const char* png_status;
+} cpu_arch_result;
+
+static const struct {
+  uint32_t avoid_bit;
+  bool (*have)();
+} g_cpu_archs[] = {
+    {WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_CRC32,
+     &wuffs_base__cpu_arch__have_arm_crc32},
+    {WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_NEON,
+     &wuffs_base__cpu_arch__have_arm_neon},
+    {WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_SVE,
+     &wuffs_base__cpu_arch__have_arm_sve},
+    {WUFFS_INITIALIZE__AVOID_CPU_ARCH__RISCV_V,
+     &wuffs_base__cpu_arch__have_riscv_v},
+    {WUFFS_INITIALIZE__AVOID_CPU_ARCH__X86_SSE42,
+     &wuffs_base__cpu_arch__have_x86_sse42},
+};
+
+// hash_in_two_parts updates the hasher with the data, split in two at a
+// hash-dependent point, so that the variants see varying lengths and
+// alignments.
+static uint32_t  //
+hash_in_two_parts(wuffs_base__hasher_u32* hasher,
+                  wuffs_base__slice_u8 data,
+                  uint64_t hash) {
+  size_t split = (size_t)(hash % (((uint64_t)data.len) + 1));
+  wuffs_base__hasher_u32__update_u32(
+      hasher, wuffs_base__make_slice_u8(data.ptr, split));
+  return wuffs_base__hasher_u32__update_u32(
+      hasher, wuffs_base__make_slice_u8(data.ptr + split, data.len - split));
+}
+
+static const char*  //
+decode_png(uint32_t* pixel_hash,
+           wuffs_base__io_buffer src,
+           uint32_t options) {
+  const char* ret = NULL;
+  wuffs_base__slice_u8 pixbuf = ((wuffs_base__slice_u8){});
+  wuffs_base__slice_u8 workbuf = ((wuffs_base__slice_u8){});
+
+  // Use a {} code block so that "goto exit" doesn't trigger "jump bypasses
+  // variable initialization" warnings.
+  {
+    wuffs_png__decoder dec;
+    wuffs_base__status status =
+        wuffs_png__decoder__initialize(&dec, sizeof dec, WUFFS_VERSION, options);
+    if (!wuffs_base__status__is_ok(&status)) {
+      ret = wuffs_base__status__message(&status);
+      goto exit;
+    }
+
+    wuffs_base__image_config ic = ((wuffs_base__image_config){});
+    status = wuffs_png__decoder__decode_image_config(&dec, &ic, &src);
+    if (!wuffs_base__status__is_ok(&status)) {
+      ret = wuffs_base__status__message(&status);
+      goto exit;
+    }
+    wuffs_base__pixel_config__set(
+        &ic.pixcfg, WUFFS_BASE__PIXEL_FORMAT__BGRA_PREMUL,
+        WUFFS_BASE__PIXEL_SUBSAMPLING__NONE,
+        wuffs_base__pixel_config__width(&ic.pixcfg),
+        wuffs_base__pixel_config__height(&ic.pixcfg));
+
+    uint64_t n = wuffs_png__decoder__workbuf_len(&dec).max_incl;
+    if (n > 64 * 1024 * 1024) {  // Don't allocate more than 64 MiB.
+      ret = "image too large";
+      goto exit;
+    }
+    if (n > 0) {
+      workbuf = wuffs_base__malloc_slice_u8(malloc, n);
+      if (!workbuf.ptr) {
+        ret = "out of memory";
+        goto exit;
+      }
+    }
+
+    n = wuffs_base__pixel_config__pixbuf_len(&ic.pixcfg);
+    if (n > 64 * 1024 * 1024) {  // Don't allocate more than 64 MiB.
+      ret = "image too large";
+      goto exit;
+    }
+    if (n > 0) {
+      pixbuf = wuffs_base__malloc_slice_u8(malloc, n);
+      if (!pixbuf.ptr) {
+        ret = "out of memory";
+        goto exit;
+      }
+      memset(pixbuf.ptr, 0, pixbuf.len);
+    }
+
+    wuffs_base__pixel_buffer pb = ((wuffs_base__pixel_buffer){});
+    status = wuffs_base__pixel_buffer__set_from_slice(&pb, &ic.pixcfg, pixbuf);
+    if (!wuffs_base__status__is_ok(&status)) {
+      ret = wuffs_base__status__message(&status);
+      goto exit;
+    }
+
+    status = wuffs_png__decoder__decode_frame(
+        &dec, &pb, &src, WUFFS_BASE__PIXEL_BLEND__SRC, workbuf, NULL);
+    ret = wuffs_base__status__message(&status);
+    *pixel_hash = jenkins_hash_u32(pixbuf.ptr, pixbuf.len);
+  }
+
+exit:
+  free(workbuf.ptr);
+  free(pixbuf.ptr);
+  return ret;
+}
+
+static const char*  //
+compute(cpu_arch_result* result,
+        wuffs_base__io_buffer* src,
+        uint64_t hash,
+        uint32_t options) {
+  wuffs_base__slice_u8 data = wuffs_base__make_slice_u8(
+      src->data.ptr + src->meta.ri, src->meta.wi - src->meta.ri);
+
+  wuffs_adler32__hasher adler32;
+  wuffs_base__status status = wuffs_adler32__hasher__initialize(
+      &adler32, sizeof adler32, WUFFS_VERSION, options);
+  if (!wuffs_base__status__is_ok(&status)) {
+    return wuffs_base__status__message(&status);
+  }
+  result->adler32 = hash_in_two_parts(
+      wuffs_adler32__hasher__upcast_as__wuffs_base__hasher_u32(&adler32), data,
+      hash);
+
+  wuffs_crc32__ieee_hasher crc32;
+  status = wuffs_crc32__ieee_hasher__initialize(&crc32, sizeof crc32,
+                                                WUFFS_VERSION, options);
+  if (!wuffs_base__status__is_ok(&status)) {
+    return wuffs_base__status__message(&status);
+  }
+  result->crc32 = hash_in_two_parts(
+      wuffs_crc32__ieee_hasher__upcast_as__wuffs_base__hasher_u32(&crc32),
+      data, hash >> 32);
+
+  result->png_pixel_hash = 0;
+  result->png_status = decode_png(&result->png_pixel_hash, *src, options);
+  return NULL;
+}
+
+const char*  //
+fuzz(wuffs_base__io_buffer* src, uint64_t hash) {
+  cpu_arch_result want = ((cpu_arch_result){});
+  const char* msg = compute(&want, src, hash, WUFFS_INITIALIZE__AVOID_CPU_ARCH);
+  if (msg) {
+    return msg;
+  }
+
+  size_t i;
+  for (i = 0; i < sizeof(g_cpu_archs) / sizeof(g_cpu_archs[0]); i++) {
+    if (!(*g_cpu_archs[i].have)()) {
+      continue;
+    }
+    cpu_arch_result got = ((cpu_arch_result){});
+    msg = compute(&got, src, hash,
+                  WUFFS_INITIALIZE__AVOID_CPU_ARCH & ~g_cpu_archs[i].avoid_bit);
+    if (msg) {
+      return msg;
+    }
+
+    if (got.adler32 != want.adler32) {
+      return "internal error: cpu_arch variants disagree on adler32";
+    } else if (got.crc32 != want.crc32) {
+      return "internal error: cpu_arch variants disagree on crc32";
+    } else if ((got.png_status != want.png_status) &&
+               (!got.png_status || !want.png_status ||
+                strcmp(got.png_status, want.png_status))) {
+      return "internal error: cpu_arch variants disagree on png status";
+    } else if (got.png_pixel_hash != want.png_pixel_hash) {
+      return "internal error: cpu_arch variants disagree on png pixels";
+    }
+  }
+  return want.png_status;
+}
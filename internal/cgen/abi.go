@@ -0,0 +1,70 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with compile-time ABI checks. The base package defines
+// WUFFS_BASE__ABI_HASH and every other package's header asserts (with
+// WUFFS_BASE__STATIC_ASSERT) that it has the value that that package was
+// generated with. The hand-written base headers also assert the sizes and
+// field offsets of the public base types, such as wuffs_base__io_buffer.
+//
+// The hash covers the public base headers and the built-in interfaces (whose
+// vtables the generated code fills in). It is conservative: even a comment
+// change to those headers changes it, requiring every package to be
+// regenerated, which "wuffs gen" does anyway.
+
+import (
+	"hash/fnv"
+	"strings"
+
+	"github.com/google/wuffs/internal/cgen/data"
+	"github.com/google/wuffs/lang/builtin"
+)
+
+var baseABIHash = func() uint32 {
+	h := fnv.New32a()
+	for _, s := range [...]string{
+		data.BaseFundamentalPublicH,
+		data.BaseRangePublicH,
+		data.BaseIOPublicH,
+		data.BaseTokenPublicH,
+		data.BaseMemoryPublicH,
+		data.BaseImagePublicH,
+		data.BaseStrConvPublicH,
+	} {
+		h.Write([]byte(s))
+	}
+	for _, s := range builtin.InterfaceFuncs {
+		h.Write([]byte(s))
+		h.Write([]byte{'\n'})
+	}
+	return h.Sum32()
+}()
+
+func insertBaseABIHash(b *buffer) error {
+	b.printf("#define WUFFS_BASE__ABI_HASH 0x%08X\n", baseABIHash)
+	return nil
+}
+
+// writeABIChecks writes the package header's assertions that it is being
+// compiled against a compatible base package.
+func (g *gen) writeABIChecks(b *buffer) {
+	b.writes("// ---------------- ABI Checks\n\n")
+	b.writes("#if !defined(WUFFS_BASE__ABI_HASH)\n")
+	b.printf("#error \"%s needs a newer wuffs_base\"\n", strings.TrimSuffix(g.pkgPrefix, "__"))
+	b.writes("#endif\n")
+	b.printf("WUFFS_BASE__STATIC_ASSERT(WUFFS_BASE__ABI_HASH == 0x%08X,\n"+
+		"%s_base_abi_hash);\n\n", baseABIHash, g.pkgName)
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with the -allocator flag. By default, each public struct's
+// wuffs_foo__bar__alloc function calls calloc, and the C++ convenience methods
+// free with the C stdlib's free. With the flag, each public struct also gets a
+// wuffs_foo__bar__alloc_with function (and alloc_as__etc_with functions) that
+// takes a wuffs_base__allocator, a vtable of alloc and free function pointers
+// plus userdata, so that embedded users can supply arena or pool allocators.
+// The plain alloc functions become alloc_with(NULL), where NULL means the
+// default (malloc and free) allocator, so that every allocation goes through
+// the one allocation site.
+//
+// The C++ convenience methods gain matching alloc_with methods, returning a
+// std::unique_ptr<T, wuffs_base__allocator__deleter>, and the -genlang=c++
+// classes take an optional allocator in their constructor.
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// writeAllocWithComment writes the Allocs section's -allocator paragraph.
+func (g *gen) writeAllocWithComment(b *buffer) {
+	b.writes("// The alloc_with functions are like the alloc functions but they allocate\n")
+	b.writes("// memory via the given wuffs_base__allocator (NULL means the default, malloc\n")
+	b.writes("// and free). The caller is responsible for eventually calling\n")
+	b.writes("// wuffs_base__allocator__free, with the same allocator, on the returned\n")
+	b.writes("// pointer. The alloc functions are equivalent to alloc_with(NULL).\n\n")
+}
+
+// writeAllocWithPrototypes writes the declarations of the n public struct's
+// alloc_with and alloc_as__etc_with functions.
+func (g *gen) writeAllocWithPrototypes(b *buffer, n *a.Struct) error {
+	if err := g.writeAllocWithSignature(b, n); err != nil {
+		return err
+	}
+	b.writes(";\n\n")
+	structName := n.QID().Str(g.tm)
+	for _, impl := range n.Implements() {
+		iQID := impl.AsTypeExpr().QID()
+		iName := fmt.Sprintf("wuffs_%s__%s", iQID[0].Str(g.tm), iQID[1].Str(g.tm))
+		b.printf("static inline %s*\n", iName)
+		b.printf("%s%s__alloc_as__%s_with(\nconst wuffs_base__allocator* allocator) {\n",
+			g.pkgPrefix, structName, iName)
+		b.printf("return (%s*)(%s%s__alloc_with(allocator));\n", iName, g.pkgPrefix, structName)
+		b.printf("}\n\n")
+	}
+	return nil
+}
+
+func (g *gen) writeAllocWithSignature(b *buffer, n *a.Struct) error {
+	structName := n.QID().Str(g.tm)
+	b.printf("WUFFS_BASE__MAYBE_STATIC %s%s*\n%s%s__alloc_with(\nconst wuffs_base__allocator* allocator)",
+		g.pkgPrefix, structName, g.pkgPrefix, structName)
+	return nil
+}
+
+// writeAllocWithImpl writes the definition of the n public struct's
+// alloc_with function. The allocator's memory need not be zeroed, so unlike
+// the calloc based alloc function, it does not pass
+// WUFFS_INITIALIZE__ALREADY_ZEROED.
+func (g *gen) writeAllocWithImpl(b *buffer, n *a.Struct) error {
+	structName := n.QID().Str(g.tm)
+	if err := g.writeAllocWithSignature(b, n); err != nil {
+		return err
+	}
+	b.writes(" {\n")
+	b.printf("%s%s* x =\n(%s%s*)(wuffs_base__allocator__alloc(allocator, sizeof(%s%s)));\n",
+		g.pkgPrefix, structName, g.pkgPrefix, structName, g.pkgPrefix, structName)
+	b.writes("if (!x) {\nreturn NULL;\n}\n")
+	b.printf("if (%s%s__initialize(\nx, sizeof(%s%s), WUFFS_VERSION, 0).repr) {\n",
+		g.pkgPrefix, structName, g.pkgPrefix, structName)
+	b.writes("wuffs_base__allocator__free(allocator, x);\nreturn NULL;\n}\n")
+	b.writes("return x;\n")
+	b.writes("}\n\n")
+	return nil
+}
+
+// writeCppAllocWithMethods writes the n public struct's C++ alloc_with
+// convenience methods.
+func (g *gen) writeCppAllocWithMethods(b *buffer, n *a.Struct) {
+	structName := n.QID().Str(g.tm)
+	b.printf("\nusing unique_ptr_with_allocator =\n"+
+		"std::unique_ptr<%s%s, wuffs_base__allocator__deleter>;\n\n", g.pkgPrefix, structName)
+	b.writes("static inline unique_ptr_with_allocator\n")
+	b.writes("alloc_with(const wuffs_base__allocator* allocator) {\n")
+	b.printf("return unique_ptr_with_allocator(\n%s%s__alloc_with(allocator),\n"+
+		"wuffs_base__allocator__deleter(allocator));\n", g.pkgPrefix, structName)
+	b.writes("}\n")
+	for _, impl := range n.Implements() {
+		iQID := impl.AsTypeExpr().QID()
+		iName := fmt.Sprintf("wuffs_%s__%s", iQID[0].Str(g.tm), iQID[1].Str(g.tm))
+		b.printf("\nstatic inline std::unique_ptr<%s, wuffs_base__allocator__deleter>\n", iName)
+		b.printf("alloc_as__%s_with(const wuffs_base__allocator* allocator) {\n", iName)
+		b.printf("return std::unique_ptr<%s, wuffs_base__allocator__deleter>(\n"+
+			"%s%s__alloc_as__%s_with(allocator),\nwuffs_base__allocator__deleter(allocator));\n",
+			iName, g.pkgPrefix, structName, iName)
+		b.printf("}\n")
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with the -api-json sidecar: a machine-readable summary of a
+// package's public consts (such as DECODER_WORKBUF_LEN_MAX_INCL_WORST_CASE),
+// status strings and public field bounds, for consumers (such as config
+// systems and documentation sites) that would otherwise parse the C header.
+//
+// Integer values are JSON strings, not numbers, as a base.u64 value might not
+// fit in a JSON number's (a float64's) 53 bits of precision.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+)
+
+type apiJSON struct {
+	Package  string          `json:"package"`
+	Consts   []apiJSONConst  `json:"consts"`
+	Statuses []apiJSONStatus `json:"statuses"`
+	Fields   []apiJSONField  `json:"fields"`
+}
+
+// apiJSONConst is a public const. Its Kind is "limit" (for names like
+// FOO_MAX_INCL), "quirk" (for names like QUIRK_FOO) or "const".
+type apiJSONConst struct {
+	Name  string `json:"name"`
+	CName string `json:"c_name"`
+	Kind  string `json:"kind"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// apiJSONStatus is a public status. Its Kind is "error", "suspension" or
+// "note" and its Message is the C string, such as "#gif: bad block".
+type apiJSONStatus struct {
+	CName   string `json:"c_name"`
+	Kind    string `json:"kind"`
+	Class   string `json:"class,omitempty"`
+	Message string `json:"message"`
+}
+
+// apiJSONField is a public field (see pubfield.go). Min and Max are its
+// refinement bounds, if it is not a bool.
+type apiJSONField struct {
+	Struct string `json:"struct"`
+	Name   string `json:"name"`
+	Getter string `json:"getter"`
+	Type   string `json:"type"`
+	Min    string `json:"min,omitempty"`
+	Max    string `json:"max,omitempty"`
+}
+
+var apiJSONLimitSuffixes = []string{
+	"_MAX_INCL",
+	"_MAX_EXCL",
+	"_MIN_INCL",
+	"_MIN_EXCL",
+	"_MAX_INCL_WORST_CASE",
+}
+
+func apiJSONConstKind(name string) string {
+	if strings.HasPrefix(name, "QUIRK_") {
+		return "quirk"
+	}
+	for _, s := range apiJSONLimitSuffixes {
+		if strings.HasSuffix(name, s) {
+			return "limit"
+		}
+	}
+	return "const"
+}
+
+// writeAPIJSON writes the -api-json sidecar. It must be called after
+// g.generate.
+func (g *gen) writeAPIJSON(w io.Writer) error {
+	r := apiJSON{
+		Package:  g.pkgName,
+		Consts:   []apiJSONConst{},
+		Statuses: []apiJSONStatus{},
+		Fields:   []apiJSONField{},
+	}
+
+	if err := g.forEachConst(nil, pubOnly, func(g *gen, b *buffer, n *a.Const) error {
+		name := n.QID()[1].Str(g.tm)
+		cv := n.Value().ConstValue()
+		if cv == nil {
+			return fmt.Errorf("api-json: unsupported non-scalar const %q", name)
+		}
+		r.Consts = append(r.Consts, apiJSONConst{
+			Name:  name,
+			CName: g.PKGPREFIX + name,
+			Kind:  apiJSONConstKind(name),
+			Type:  n.XType().Str(g.tm),
+			Value: cv.String(),
+		})
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, z := range g.statusList {
+		if !z.fromThisPkg || !z.public {
+			continue
+		}
+		kind := "note"
+		if statusMsgIsError(z.msg) {
+			kind = "error"
+		} else if statusMsgIsSuspension(z.msg) {
+			kind = "suspension"
+		}
+		r.Statuses = append(r.Statuses, apiJSONStatus{
+			CName:   z.cName,
+			Kind:    kind,
+			Class:   z.class,
+			Message: g.statusRepr(z),
+		})
+	}
+
+	for _, n := range g.structList {
+		structName := n.QID().Str(g.tm)
+		for _, o := range pubFields(n) {
+			fieldName := o.Name().Str(g.tm)
+			f := apiJSONField{
+				Struct: structName,
+				Name:   fieldName,
+				Getter: g.pkgPrefix + structName + "__get_" + fieldName,
+				Type:   o.XType().Str(g.tm),
+			}
+			if lo, hi, ok := pubFieldBounds(o); ok {
+				f.Min, f.Max = lo, hi
+			}
+			r.Fields = append(r.Fields, f)
+		}
+	}
+
+	data, err := json.MarshalIndent(&r, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
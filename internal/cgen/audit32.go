@@ -0,0 +1,81 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with the -audit32 flag. Wuffs values can be 64 bits wide but
+// C's array lengths, slice lengths and pointer offsets are size_t, which is
+// only 32 bits wide on 32-bit targets. Where the generated C code converts a
+// Wuffs value to size_t, it is usually obvious (or clamped, such as by a
+// wuffs_base__u64__min with a pointer difference) that nothing is lost, but
+// anything else would only misbehave on 32-bit targets, which are tested less
+// often than 64-bit ones.
+//
+// With the flag, each such conversion of a value that might not fit in 32 bits
+// (based on the checker's bounds, for non-constant values) fails the
+// generation, with an error that points to the Wuffs expression. Without the
+// flag, the conversions are not audited.
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/google/wuffs/lang/diagnostic"
+
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// audit32 records, if the -audit32 flag is set, an error if the Wuffs
+// expression n, converted to the C type cType as the what (such as "array
+// length"), might not fit in 32 bits. ub is n's value or, if nil, n's
+// constant value or, if n is not constant, its upper bound.
+func (g *gen) audit32(n *a.Expr, ub *big.Int, cType string, what string) {
+	if !g.audit32Enabled {
+		return
+	}
+	exact := true
+	if ub == nil {
+		if cv := n.ConstValue(); cv != nil {
+			ub = cv
+		} else {
+			ub, exact = n.MBounds()[1], false
+		}
+	}
+	if (ub != nil) && (ub.Cmp(maxUint32) <= 0) {
+		return
+	}
+
+	if g.audit32Seen == nil {
+		g.audit32Seen = map[*a.Expr]struct{}{}
+	}
+	if _, ok := g.audit32Seen[n]; ok {
+		return
+	}
+	g.audit32Seen[n] = struct{}{}
+
+	bound := "unbounded"
+	if exact {
+		bound = ub.String()
+	} else if ub != nil {
+		bound = "up to " + ub.String()
+	}
+	g.audit32Errs = append(g.audit32Errs, errorAt(n.AsNode(), fmt.Errorf(
+		"cgen: -audit32: %s %q (%s) is converted to %s, which may truncate on 32-bit targets",
+		what, n.Str(g.tm), bound, cType)))
+}
+
+// audit32Err returns the -audit32 errors, if any.
+func (g *gen) audit32Err() error {
+	return diagnostic.ErrorList(g.audit32Errs).Err()
+}
@@ -27,6 +27,7 @@
 // ¡ INSERT base/copyright
 
 #include <stdbool.h>
+#include <stddef.h>
 #include <stdint.h>
 #include <stdlib.h>
 #include <string.h>
@@ -61,7 +62,9 @@ extern "C" {
 extern "C" {
 #endif
 
+// ‼ WUFFS MULTI-FILE SECTION +shared
 // ¡ INSERT base/all-private.h.
+// ‼ WUFFS MULTI-FILE SECTION -shared
 
 // ----------------
 
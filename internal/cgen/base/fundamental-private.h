@@ -70,6 +70,36 @@
 #define WUFFS_BASE__UNLIKELY(expr) (expr)
 #endif
 
+// WUFFS_BASE__TELEMETRY__BEGIN and WUFFS_BASE__TELEMETRY__END bracket each
+// public coroutine method call, given the total I/O positions of its io_reader
+// and io_writer arguments. Unless WUFFS_CONFIG__TELEMETRY is defined, they
+// expand to nothing, so that telemetry costs nothing.
+#if defined(WUFFS_CONFIG__TELEMETRY)
+#define WUFFS_BASE__TELEMETRY__BEGIN(consumed, produced) \
+  uint64_t telemetry_consumed = (consumed);              \
+  uint64_t telemetry_produced = (produced);
+#define WUFFS_BASE__TELEMETRY__END(t, consumed, produced, status) \
+  wuffs_base__telemetry__record(t, (consumed)-telemetry_consumed, \
+                                (produced)-telemetry_produced, status);
+#else
+#define WUFFS_BASE__TELEMETRY__BEGIN(consumed, produced)
+#define WUFFS_BASE__TELEMETRY__END(t, consumed, produced, status)
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
+
+static inline void  //
+wuffs_base__telemetry__record(wuffs_base__telemetry* t,
+                              uint64_t consumed,
+                              uint64_t produced,
+                              const wuffs_base__status* status) {
+  t->bytes_consumed += consumed;
+  t->bytes_produced += produced;
+  if (wuffs_base__status__is_suspension(status)) {
+    t->suspensions++;
+  } else if (wuffs_base__status__is_error(status)) {
+    t->errors++;
+  }
+}
+
 // --------
 
 static inline wuffs_base__empty_struct  //
@@ -181,6 +211,48 @@ wuffs_base__u64__sat_sub_indirect(uint64_t* x, uint64_t y) {
   *x = wuffs_base__u64__sat_sub(*x, y);
 }
 
+// --------
+
+static inline void  //
+wuffs_base__u8__mod_shift_left_indirect(uint8_t* x, uint64_t n) {
+  *x = wuffs_base__u8__mod_shift_left(*x, n);
+}
+
+static inline void  //
+wuffs_base__u8__mod_shift_right_indirect(uint8_t* x, uint64_t n) {
+  *x = wuffs_base__u8__mod_shift_right(*x, n);
+}
+
+static inline void  //
+wuffs_base__u16__mod_shift_left_indirect(uint16_t* x, uint64_t n) {
+  *x = wuffs_base__u16__mod_shift_left(*x, n);
+}
+
+static inline void  //
+wuffs_base__u16__mod_shift_right_indirect(uint16_t* x, uint64_t n) {
+  *x = wuffs_base__u16__mod_shift_right(*x, n);
+}
+
+static inline void  //
+wuffs_base__u32__mod_shift_left_indirect(uint32_t* x, uint64_t n) {
+  *x = wuffs_base__u32__mod_shift_left(*x, n);
+}
+
+static inline void  //
+wuffs_base__u32__mod_shift_right_indirect(uint32_t* x, uint64_t n) {
+  *x = wuffs_base__u32__mod_shift_right(*x, n);
+}
+
+static inline void  //
+wuffs_base__u64__mod_shift_left_indirect(uint64_t* x, uint64_t n) {
+  *x = wuffs_base__u64__mod_shift_left(*x, n);
+}
+
+static inline void  //
+wuffs_base__u64__mod_shift_right_indirect(uint64_t* x, uint64_t n) {
+  *x = wuffs_base__u64__mod_shift_right(*x, n);
+}
+
 // ---------------- Slices and Tables
 
 // wuffs_base__slice_u8__prefix returns up to the first up_to bytes of s.
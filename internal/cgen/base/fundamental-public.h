@@ -72,8 +72,20 @@
 #include <arm_neon.h>
 #define WUFFS_BASE__CPU_ARCH__ARM_NEON
 #endif  // defined(__ARM_NEON)
+#if defined(__ARM_FEATURE_SVE)
+#include <arm_sve.h>
+#define WUFFS_BASE__CPU_ARCH__ARM_SVE
+#endif  // defined(__ARM_FEATURE_SVE)
 #endif  // defined(__ARM_FEATURE_UNALIGNED) etc
 
+// "cpu_arch >= riscv_v" requires the ratified (v1.0) vector extension and the
+// "__riscv_"-prefixed (v0.12 or later) intrinsics.
+#if defined(__riscv_vector) && defined(__riscv_v_intrinsic) && \
+    (__riscv_v_intrinsic >= 12000)
+#include <riscv_vector.h>
+#define WUFFS_BASE__CPU_ARCH__RISCV_V
+#endif  // defined(__riscv_vector) etc
+
 // Similarly, "cpu_arch >= x86_sse42" requires SSE4.2 but also PCLMUL and
 // POPCNT. This is checked at runtime via cpuid, not at compile time.
 #if defined(__x86_64__)
@@ -128,6 +140,141 @@
 #define WUFFS_BASE__MAYBE_STATIC
 #endif  // defined(WUFFS_CONFIG__STATIC_FUNCTIONS)
 
+// --------
+
+// Define WUFFS_CONFIG__STATUS_MAPPINGS to declare (and define) each package's
+// wuffs_foo__status_http_code and wuffs_foo__status_errno functions. They map
+// that package's error statuses that were declared with a class, such as
+// corrupt, to suggested HTTP response status codes and errno values, such as
+// 422 and EBADMSG. Other statuses map to zero.
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+#include <errno.h>
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+// --------
+
+// Define WUFFS_CONFIG__STATUS_ENUMS to declare (and define) each package's
+// WUFFS_FOO__STATUS_ENUM__ETC macros, numbering that package's statuses from
+// 1, and its wuffs_foo__status__from_enum and wuffs_foo__status__to_enum
+// functions, converting between those numbers and status reprs. Zero means a
+// status that is not that package's, such as ok.
+
+// --------
+
+// Define WUFFS_CONFIG__THREAD_SAFETY_ANNOTATIONS to annotate the generated
+// code for Clang's -Wthread-safety analysis. Wuffs structs (such as
+// wuffs_foo__decoder) are not thread-safe: concurrent calls on the same struct
+// must be externally synchronized. With this macro, each public struct is a
+// capability and each public method requires holding its receiver, exclusively
+// (or, for const methods, shared). Callers tell the analysis how they hold it,
+// by annotating their own locking functions, such as with
+// __attribute__((acquire_capability(dec))), or with assert_capability.
+//
+// The macro has no effect on other compilers, or on the base package's
+// interface functions (such as wuffs_base__image_decoder__decode_frame).
+#if defined(WUFFS_CONFIG__THREAD_SAFETY_ANNOTATIONS) && defined(__clang__)
+#define WUFFS_BASE__CAPABILITY __attribute__((capability("wuffs_struct")))
+#define WUFFS_BASE__REQUIRES(x) __attribute__((requires_capability(x)))
+#define WUFFS_BASE__REQUIRES_SHARED(x) \
+  __attribute__((requires_shared_capability(x)))
+#define WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS \
+  __attribute__((no_thread_safety_analysis))
+#else
+#define WUFFS_BASE__CAPABILITY
+#define WUFFS_BASE__REQUIRES(x)
+#define WUFFS_BASE__REQUIRES_SHARED(x)
+#define WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
+#endif  // defined(WUFFS_CONFIG__THREAD_SAFETY_ANNOTATIONS) && etc
+
+// --------
+
+// Define WUFFS_CONFIG__TELEMETRY to collect each struct's wuffs_base__telemetry
+// counters, such as the number of bytes consumed and of error statuses
+// returned, readable via each package's wuffs_foo__bar__telemetry functions.
+
+// --------
+
+// Define WUFFS_CONFIG__AUTOVEC to shape the base package's portable copy loops
+// (those that copy from an io_writer's history) for compilers'
+// auto-vectorizers. The std packages' portable loops are shaped by the wuffs
+// gen -autovec flag instead, as that code is generated.
+
+// --------
+
+// Code generated with the wuffs gen -instrument flag calls these hooks when a
+// coroutine suspends, when a function returns a status and at the start of
+// each while loop iteration. Define them (before #include'ing this file) to
+// observe a decoder's progress, e.g. for fuzzer feedback or profiling. The
+// self argument is the receiver (or NULL) and func is the C function name, as
+// a string literal. Otherwise, they expand to nothing.
+#if !defined(WUFFS_BASE__INSTRUMENT__SUSPEND)
+#define WUFFS_BASE__INSTRUMENT__SUSPEND(self, func, point, status) ((void)0)
+#endif
+#if !defined(WUFFS_BASE__INSTRUMENT__RETURN)
+#define WUFFS_BASE__INSTRUMENT__RETURN(self, func, status) ((void)0)
+#endif
+#if !defined(WUFFS_BASE__INSTRUMENT__LOOP)
+#define WUFFS_BASE__INSTRUMENT__LOOP(self, func, line) ((void)0)
+#endif
+
+// --------
+
+// Define WUFFS_CONFIG__MEMCPY_PEEK_POKE to make the wuffs_base__peek_etc and
+// wuffs_base__poke_etc functions access memory only via fixed-size memcpy
+// calls (to or from a local array), never by dereferencing a pointer.
+// Compilers typically optimize those memcpy calls to single loads or stores,
+// and sanitizers (such as UBSan's -fsanitize=alignment) see no unaligned or
+// type-punned accesses.
+
+// ---------------- Static Assertions
+
+// WUFFS_BASE__STATIC_ASSERT(cond, name) fails to compile if cond, an integer
+// constant expression, is false. The name is a C identifier, unique within the
+// header that uses it, that older compilers (those without static_assert)
+// show in their error message.
+#if defined(__cplusplus) && ((__cplusplus >= 201103L) || defined(_MSC_VER))
+#define WUFFS_BASE__STATIC_ASSERT(cond, name) static_assert(cond, #name)
+#elif defined(__STDC_VERSION__) && (__STDC_VERSION__ >= 201112L)
+#define WUFFS_BASE__STATIC_ASSERT(cond, name) _Static_assert(cond, #name)
+#else
+#define WUFFS_BASE__STATIC_ASSERT(cond, name) \
+  typedef char wuffs_base__static_assert__##name[(cond) ? 1 : -1]
+#endif
+
+// WUFFS_BASE__ABI_HASH identifies the layout of the base package's public
+// types. Each generated package's header asserts that it matches the value
+// that the package was generated with. Mixing a package with a wuffs-base.c
+// from an incompatible Wuffs version then fails at compile time, instead of at
+// run time (such as with "#base: bad sizeof receiver") or not at all.
+//
+// ¡ INSERT ABI hash.
+
+// The CPU-architecture-specific code (see WUFFS_BASE__CPU_ARCH__ETC) assumes a
+// little-endian CPU.
+#if (defined(WUFFS_BASE__CPU_ARCH__ARM_CRC32) ||  \
+     defined(WUFFS_BASE__CPU_ARCH__ARM_NEON) ||   \
+     defined(WUFFS_BASE__CPU_ARCH__ARM_SVE) ||    \
+     defined(WUFFS_BASE__CPU_ARCH__RISCV_V) ||    \
+     defined(WUFFS_BASE__CPU_ARCH__X86_64)) &&    \
+    defined(__BYTE_ORDER__) && defined(__ORDER_LITTLE_ENDIAN__)
+WUFFS_BASE__STATIC_ASSERT(__BYTE_ORDER__ == __ORDER_LITTLE_ENDIAN__,
+                          cpu_arch_is_little_endian);
+#endif
+
+// WUFFS_BASE__INLINE is C99's inline keyword, spelled so that it also works
+// for older C compilers, which support it as an extension. Code generated with
+// the wuffs gen -ctarget=c89 (or -ctarget=msvc) flag uses it.
+#if defined(__cplusplus) || \
+    (defined(__STDC_VERSION__) && (__STDC_VERSION__ >= 199901L))
+#define WUFFS_BASE__INLINE inline
+#elif defined(__GNUC__)
+#define WUFFS_BASE__INLINE __inline__
+#elif defined(_MSC_VER)
+#define WUFFS_BASE__INLINE __inline
+#else
+#define WUFFS_BASE__INLINE
+#endif
+
 // ---------------- CPU Architecture
 
 static inline bool  //
@@ -148,6 +295,24 @@ wuffs_base__cpu_arch__have_arm_neon() {
 #endif  // defined(WUFFS_BASE__CPU_ARCH__ARM_NEON)
 }
 
+static inline bool  //
+wuffs_base__cpu_arch__have_arm_sve() {
+#if defined(WUFFS_BASE__CPU_ARCH__ARM_SVE)
+  return true;
+#else
+  return false;
+#endif  // defined(WUFFS_BASE__CPU_ARCH__ARM_SVE)
+}
+
+static inline bool  //
+wuffs_base__cpu_arch__have_riscv_v() {
+#if defined(WUFFS_BASE__CPU_ARCH__RISCV_V)
+  return true;
+#else
+  return false;
+#endif  // defined(WUFFS_BASE__CPU_ARCH__RISCV_V)
+}
+
 static inline bool  //
 wuffs_base__cpu_arch__have_x86_sse42() {
 #if defined(WUFFS_BASE__CPU_ARCH__X86_64)
@@ -197,6 +362,16 @@ wuffs_base__cpu_arch__have_x86_sse42() {
 #define WUFFS_BASE__WARN_UNUSED_RESULT
 #endif
 
+// WUFFS_BASE__RESTRICT is C99's restrict qualifier, spelled so that it also
+// works for C++ compilers, which support it as an extension.
+#if defined(__GNUC__)
+#define WUFFS_BASE__RESTRICT __restrict__
+#elif defined(_MSC_VER)
+#define WUFFS_BASE__RESTRICT __restrict
+#else
+#define WUFFS_BASE__RESTRICT
+#endif
+
 // --------
 
 // Options (bitwise or'ed together) for wuffs_foo__bar__initialize functions.
@@ -219,6 +394,36 @@ wuffs_base__cpu_arch__have_x86_sse42() {
 #define WUFFS_INITIALIZE__LEAVE_INTERNAL_BUFFERS_UNINITIALIZED \
   ((uint32_t)0x00000002)
 
+// WUFFS_INITIALIZE__WORKBUF_LESS means that the caller will not provide a work
+// buffer: workbuf_len will return zero and methods that take a workbuf will
+// ignore it, running a workbuf-less variant instead. That variant might be
+// slower, or support fewer features, than the default.
+//
+// Only some structs support this. Those that do not (but otherwise take a
+// workbuf) will fail to initialize, returning
+// wuffs_base__error__unsupported_option, and the caller can then initialize
+// again without this option (and provide a work buffer). Structs that never
+// take a workbuf will accept and ignore it.
+#define WUFFS_INITIALIZE__WORKBUF_LESS ((uint32_t)0x00000004)
+
+// WUFFS_INITIALIZE__AVOID_CPU_ARCH__ETC means that choosy functions (those
+// with CPU-architecture-specific variants, such as SIMD implementations) will
+// not choose that CPU architecture's variants, even if the CPU supports them.
+// Sub-structs (such as a PNG decoder's zlib decoder) are initialized with the
+// same options.
+//
+// Setting all of them (WUFFS_INITIALIZE__AVOID_CPU_ARCH) means always using
+// the portable variants. Comparing the output of differently initialized
+// structs, on the same input, is differential testing: it catches a variant
+// that diverges from the others (see fuzz/c/std/cpu_arch_fuzzer.c), which
+// ordinary fuzzing would attribute to whichever variant the CPU dispatched to.
+#define WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_CRC32 ((uint32_t)0x00000100)
+#define WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_NEON ((uint32_t)0x00000200)
+#define WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_SVE ((uint32_t)0x00000400)
+#define WUFFS_INITIALIZE__AVOID_CPU_ARCH__RISCV_V ((uint32_t)0x00000800)
+#define WUFFS_INITIALIZE__AVOID_CPU_ARCH__X86_SSE42 ((uint32_t)0x00001000)
+#define WUFFS_INITIALIZE__AVOID_CPU_ARCH ((uint32_t)0x00001F00)
+
 // --------
 
 // wuffs_base__empty_struct is used when a Wuffs function returns an empty
@@ -362,6 +567,35 @@ wuffs_base__status::message() const {
 
 // --------
 
+// wuffs_base__telemetry holds a struct's counters, summed over its public
+// coroutine method calls (such as a decoder's decode_frame) since it was
+// initialized, so that services can export decoder health metrics. They are
+// only collected if WUFFS_CONFIG__TELEMETRY is defined. Otherwise, they cost
+// nothing and the wuffs_foo__bar__telemetry functions return all zeroes.
+//
+// bytes_consumed and bytes_produced count the bytes read from io_reader
+// arguments (such as src) and written to io_writer arguments (such as dst).
+// suspensions and errors count the calls that returned a suspension status
+// (such as "$short read") and an error status.
+typedef struct wuffs_base__telemetry__struct {
+  uint64_t bytes_consumed;
+  uint64_t bytes_produced;
+  uint64_t suspensions;
+  uint64_t errors;
+} wuffs_base__telemetry;
+
+static inline wuffs_base__telemetry  //
+wuffs_base__empty_telemetry() {
+  wuffs_base__telemetry ret;
+  ret.bytes_consumed = 0;
+  ret.bytes_produced = 0;
+  ret.suspensions = 0;
+  ret.errors = 0;
+  return ret;
+}
+
+// --------
+
 // WUFFS_BASE__RESULT is a result type: either a status (an error) or a value.
 //
 // A result with all fields NULL or zero is as valid as a zero-valued T.
@@ -562,6 +796,203 @@ wuffs_base__u64__sat_sub(uint64_t x, uint64_t y) {
   return res;
 }
 
+// The signed sat_add and sat_sub functions also work on the unsigned
+// (modular) bit patterns. Addition overflows if and only if x and y have the
+// same sign but res has a different sign. Subtraction overflows if and only if
+// x and y have different signs and res's sign differs from x's. On overflow,
+// the result saturates towards x's sign: ((ux >> (N-1)) + INTN_MAX) is
+// INTN_MAX for non-negative x and INTN_MIN for negative x.
+
+static inline int8_t  //
+wuffs_base__i8__sat_add(int8_t x, int8_t y) {
+  uint8_t ux = (uint8_t)x;
+  uint8_t uy = (uint8_t)y;
+  uint8_t res = (uint8_t)(ux + uy);
+  if ((int8_t)((ux ^ res) & (uy ^ res)) < 0) {
+    return (int8_t)((uint8_t)(ux >> 7) + INT8_MAX);
+  }
+  return (int8_t)res;
+}
+
+static inline int8_t  //
+wuffs_base__i8__sat_sub(int8_t x, int8_t y) {
+  uint8_t ux = (uint8_t)x;
+  uint8_t uy = (uint8_t)y;
+  uint8_t res = (uint8_t)(ux - uy);
+  if ((int8_t)((ux ^ uy) & (ux ^ res)) < 0) {
+    return (int8_t)((uint8_t)(ux >> 7) + INT8_MAX);
+  }
+  return (int8_t)res;
+}
+
+static inline int16_t  //
+wuffs_base__i16__sat_add(int16_t x, int16_t y) {
+  uint16_t ux = (uint16_t)x;
+  uint16_t uy = (uint16_t)y;
+  uint16_t res = (uint16_t)(ux + uy);
+  if ((int16_t)((ux ^ res) & (uy ^ res)) < 0) {
+    return (int16_t)((uint16_t)(ux >> 15) + INT16_MAX);
+  }
+  return (int16_t)res;
+}
+
+static inline int16_t  //
+wuffs_base__i16__sat_sub(int16_t x, int16_t y) {
+  uint16_t ux = (uint16_t)x;
+  uint16_t uy = (uint16_t)y;
+  uint16_t res = (uint16_t)(ux - uy);
+  if ((int16_t)((ux ^ uy) & (ux ^ res)) < 0) {
+    return (int16_t)((uint16_t)(ux >> 15) + INT16_MAX);
+  }
+  return (int16_t)res;
+}
+
+static inline int32_t  //
+wuffs_base__i32__sat_add(int32_t x, int32_t y) {
+  uint32_t ux = (uint32_t)x;
+  uint32_t uy = (uint32_t)y;
+  uint32_t res = (uint32_t)(ux + uy);
+  if ((int32_t)((ux ^ res) & (uy ^ res)) < 0) {
+    return (int32_t)((uint32_t)(ux >> 31) + INT32_MAX);
+  }
+  return (int32_t)res;
+}
+
+static inline int32_t  //
+wuffs_base__i32__sat_sub(int32_t x, int32_t y) {
+  uint32_t ux = (uint32_t)x;
+  uint32_t uy = (uint32_t)y;
+  uint32_t res = (uint32_t)(ux - uy);
+  if ((int32_t)((ux ^ uy) & (ux ^ res)) < 0) {
+    return (int32_t)((uint32_t)(ux >> 31) + INT32_MAX);
+  }
+  return (int32_t)res;
+}
+
+static inline int64_t  //
+wuffs_base__i64__sat_add(int64_t x, int64_t y) {
+  uint64_t ux = (uint64_t)x;
+  uint64_t uy = (uint64_t)y;
+  uint64_t res = (uint64_t)(ux + uy);
+  if ((int64_t)((ux ^ res) & (uy ^ res)) < 0) {
+    return (int64_t)((uint64_t)(ux >> 63) + INT64_MAX);
+  }
+  return (int64_t)res;
+}
+
+static inline int64_t  //
+wuffs_base__i64__sat_sub(int64_t x, int64_t y) {
+  uint64_t ux = (uint64_t)x;
+  uint64_t uy = (uint64_t)y;
+  uint64_t res = (uint64_t)(ux - uy);
+  if ((int64_t)((ux ^ uy) & (ux ^ res)) < 0) {
+    return (int64_t)((uint64_t)(ux >> 63) + INT64_MAX);
+  }
+  return (int64_t)res;
+}
+
+// --------
+
+// The mod_shift functions return (x << n) or (x >> n), modulo the type's
+// range. Unlike C's "<<" and ">>" operators, their behavior is defined for
+// every n: n at or above the type's bit width gives zero. The shift is masked
+// to be less than that bit width and then the result is masked to be zero if
+// the original n was too large, which avoids any branches.
+
+static inline uint8_t  //
+wuffs_base__u8__mod_shift_left(uint8_t x, uint64_t n) {
+  uint8_t mask = (uint8_t)(-(uint32_t)(n < 8));
+  return (uint8_t)(((uint8_t)(x << (n & 7))) & mask);
+}
+
+static inline uint8_t  //
+wuffs_base__u8__mod_shift_right(uint8_t x, uint64_t n) {
+  uint8_t mask = (uint8_t)(-(uint32_t)(n < 8));
+  return (uint8_t)(((uint8_t)(x >> (n & 7))) & mask);
+}
+
+static inline uint16_t  //
+wuffs_base__u16__mod_shift_left(uint16_t x, uint64_t n) {
+  uint16_t mask = (uint16_t)(-(uint32_t)(n < 16));
+  return (uint16_t)(((uint16_t)(x << (n & 15))) & mask);
+}
+
+static inline uint16_t  //
+wuffs_base__u16__mod_shift_right(uint16_t x, uint64_t n) {
+  uint16_t mask = (uint16_t)(-(uint32_t)(n < 16));
+  return (uint16_t)(((uint16_t)(x >> (n & 15))) & mask);
+}
+
+static inline uint32_t  //
+wuffs_base__u32__mod_shift_left(uint32_t x, uint64_t n) {
+  uint32_t mask = -(uint32_t)(n < 32);
+  return (x << (n & 31)) & mask;
+}
+
+static inline uint32_t  //
+wuffs_base__u32__mod_shift_right(uint32_t x, uint64_t n) {
+  uint32_t mask = -(uint32_t)(n < 32);
+  return (x >> (n & 31)) & mask;
+}
+
+static inline uint64_t  //
+wuffs_base__u64__mod_shift_left(uint64_t x, uint64_t n) {
+  uint64_t mask = -(uint64_t)(n < 64);
+  return (x << (n & 63)) & mask;
+}
+
+static inline uint64_t  //
+wuffs_base__u64__mod_shift_right(uint64_t x, uint64_t n) {
+  uint64_t mask = -(uint64_t)(n < 64);
+  return (x >> (n & 63)) & mask;
+}
+
+// The signed mod_shift_left functions shift the unsigned (two's complement)
+// bit pattern. The signed mod_shift_right functions are arithmetic shifts: n
+// at or above the type's bit width gives the sign fill (0 or -1). Like the
+// generated code for the ">>" operator, they assume that the C compiler's
+// ">>" on a negative signed integer is an arithmetic shift.
+
+static inline int8_t  //
+wuffs_base__i8__mod_shift_left(int8_t x, uint64_t n) {
+  return (int8_t)wuffs_base__u8__mod_shift_left((uint8_t)x, n);
+}
+
+static inline int8_t  //
+wuffs_base__i8__mod_shift_right(int8_t x, uint64_t n) {
+  return (int8_t)(x >> ((n < 7) ? n : 7));
+}
+
+static inline int16_t  //
+wuffs_base__i16__mod_shift_left(int16_t x, uint64_t n) {
+  return (int16_t)wuffs_base__u16__mod_shift_left((uint16_t)x, n);
+}
+
+static inline int16_t  //
+wuffs_base__i16__mod_shift_right(int16_t x, uint64_t n) {
+  return (int16_t)(x >> ((n < 15) ? n : 15));
+}
+
+static inline int32_t  //
+wuffs_base__i32__mod_shift_left(int32_t x, uint64_t n) {
+  return (int32_t)wuffs_base__u32__mod_shift_left((uint32_t)x, n);
+}
+
+static inline int32_t  //
+wuffs_base__i32__mod_shift_right(int32_t x, uint64_t n) {
+  return (int32_t)(x >> ((n < 31) ? n : 31));
+}
+
+static inline int64_t  //
+wuffs_base__i64__mod_shift_left(int64_t x, uint64_t n) {
+  return (int64_t)wuffs_base__u64__mod_shift_left((uint64_t)x, n);
+}
+
+static inline int64_t  //
+wuffs_base__i64__mod_shift_right(int64_t x, uint64_t n) {
+  return (int64_t)(x >> ((n < 63) ? n : 63));
+}
+
 // --------
 
 typedef struct wuffs_base__multiply_u64__output__struct {
@@ -600,6 +1031,92 @@ wuffs_base__multiply_u64(uint64_t x, uint64_t y) {
 
 // --------
 
+// The mul_qN_round functions return ((x * y) / (1 << N)), rounded to nearest
+// (with ties rounding up): the product of x and y in Q-format fixed point,
+// with N fractional bits. The intermediate product does not overflow, but the
+// result is truncated to the return type. Wuffs code that calls these
+// functions has proved that that truncation is a no-op.
+
+static inline uint8_t  //
+wuffs_base__u8__mul_q8_round(uint8_t x, uint8_t y) {
+  return (uint8_t)(((((uint32_t)x) * ((uint32_t)y)) + 0x80) >> 8);
+}
+
+static inline uint16_t  //
+wuffs_base__u16__mul_q8_round(uint16_t x, uint16_t y) {
+  return (uint16_t)(((((uint32_t)x) * ((uint32_t)y)) + 0x80) >> 8);
+}
+
+static inline uint16_t  //
+wuffs_base__u16__mul_q16_round(uint16_t x, uint16_t y) {
+  return (uint16_t)(((((uint32_t)x) * ((uint32_t)y)) + 0x8000) >> 16);
+}
+
+static inline uint32_t  //
+wuffs_base__u32__mul_q8_round(uint32_t x, uint32_t y) {
+  return (uint32_t)(((((uint64_t)x) * ((uint64_t)y)) + 0x80) >> 8);
+}
+
+static inline uint32_t  //
+wuffs_base__u32__mul_q16_round(uint32_t x, uint32_t y) {
+  return (uint32_t)(((((uint64_t)x) * ((uint64_t)y)) + 0x8000) >> 16);
+}
+
+static inline uint64_t  //
+wuffs_base__u64__mul_q8_round(uint64_t x, uint64_t y) {
+  wuffs_base__multiply_u64__output o = wuffs_base__multiply_u64(x, y);
+  uint64_t lo = o.lo + 0x80;
+  uint64_t hi = o.hi + (lo < 0x80);
+  return (lo >> 8) | (hi << 56);
+}
+
+static inline uint64_t  //
+wuffs_base__u64__mul_q16_round(uint64_t x, uint64_t y) {
+  wuffs_base__multiply_u64__output o = wuffs_base__multiply_u64(x, y);
+  uint64_t lo = o.lo + 0x8000;
+  uint64_t hi = o.hi + (lo < 0x8000);
+  return (lo >> 16) | (hi << 48);
+}
+
+// --------
+
+// wuffs_base__optional_u32 is a u32 value that may or may not be present. If
+// ok is false then value is zero.
+typedef struct wuffs_base__optional_u32__struct {
+  uint32_t value;
+  bool ok;
+} wuffs_base__optional_u32;
+
+static inline wuffs_base__optional_u32  //
+wuffs_base__empty_optional_u32() {
+  wuffs_base__optional_u32 ret;
+  ret.value = 0;
+  ret.ok = false;
+  return ret;
+}
+
+static inline bool  //
+wuffs_base__optional_u32__is_ok(const wuffs_base__optional_u32* o) {
+  return o->ok;
+}
+
+static inline uint32_t  //
+wuffs_base__optional_u32__value(const wuffs_base__optional_u32* o) {
+  return o->value;
+}
+
+// wuffs_base__u64__to_u32_checked returns x as an optional u32, which is ok
+// if and only if x fits in a uint32_t.
+static inline wuffs_base__optional_u32  //
+wuffs_base__u64__to_u32_checked(uint64_t x) {
+  wuffs_base__optional_u32 ret;
+  ret.ok = x <= 0xFFFFFFFF;
+  ret.value = ret.ok ? ((uint32_t)x) : 0;
+  return ret;
+}
+
+// --------
+
 #if defined(__GNUC__) && (__SIZEOF_LONG__ == 8)
 
 static inline uint32_t  //
@@ -648,6 +1165,79 @@ wuffs_base__count_leading_zeroes_u64(uint64_t u) {
 
 // --------
 
+// The floor_log2 functions return the index of x's highest set bit. Wuffs code
+// that calls these functions has proved that x is non-zero.
+
+static inline uint32_t  //
+wuffs_base__u8__floor_log2(uint8_t x) {
+  return 63 - wuffs_base__count_leading_zeroes_u64((uint64_t)x);
+}
+
+static inline uint32_t  //
+wuffs_base__u16__floor_log2(uint16_t x) {
+  return 63 - wuffs_base__count_leading_zeroes_u64((uint64_t)x);
+}
+
+static inline uint32_t  //
+wuffs_base__u32__floor_log2(uint32_t x) {
+  return 63 - wuffs_base__count_leading_zeroes_u64((uint64_t)x);
+}
+
+static inline uint32_t  //
+wuffs_base__u64__floor_log2(uint64_t x) {
+  return 63 - wuffs_base__count_leading_zeroes_u64((uint64_t)x);
+}
+
+// The ceil_div_pow2 functions return (x / (1 << n)), rounded up. Unlike
+// ((x + (1 << n) - 1) >> n), there is no intermediate overflow. Wuffs code
+// that calls these functions has proved that n is less than x's bit width.
+
+static inline uint8_t  //
+wuffs_base__u8__ceil_div_pow2(uint8_t x, uint32_t n) {
+  return (uint8_t)((x >> n) + ((x & ((((uint32_t)1) << n) - 1)) != 0));
+}
+
+static inline uint16_t  //
+wuffs_base__u16__ceil_div_pow2(uint16_t x, uint32_t n) {
+  return (uint16_t)((x >> n) + ((x & ((((uint32_t)1) << n) - 1)) != 0));
+}
+
+static inline uint32_t  //
+wuffs_base__u32__ceil_div_pow2(uint32_t x, uint32_t n) {
+  return (uint32_t)((x >> n) + ((x & ((((uint32_t)1) << n) - 1)) != 0));
+}
+
+static inline uint64_t  //
+wuffs_base__u64__ceil_div_pow2(uint64_t x, uint32_t n) {
+  return (uint64_t)((x >> n) + ((x & ((((uint64_t)1) << n) - 1)) != 0));
+}
+
+// --------
+
+// The peek and poke functions read and write N-bit unsigned integers, in
+// big-endian (be) or little-endian (le) order, without bounds checking. The
+// caller must ensure that the N/8 bytes starting at p are valid.
+//
+// Only the "primitive" 8, 16, 32 and 64 bit functions touch that memory. The
+// other widths (24, 40, 48 and 56 bits) are combinations of primitives, each
+// of which accesses exactly its own bytes. Those primitives are where
+// WUFFS_CONFIG__MEMCPY_PEEK_POKE applies.
+#if defined(WUFFS_CONFIG__MEMCPY_PEEK_POKE)
+#define WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(n) \
+  uint8_t peek_poke_array[n];                 \
+  memcpy(peek_poke_array, p, n);              \
+  p = peek_poke_array
+#define WUFFS_BASE__PEEK_POKE__BEGIN_POKE(n) \
+  uint8_t peek_poke_array[n];                 \
+  uint8_t* peek_poke_dst = p;                 \
+  p = peek_poke_array
+#define WUFFS_BASE__PEEK_POKE__END_POKE(n) memcpy(peek_poke_dst, p, n)
+#else
+#define WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(n)
+#define WUFFS_BASE__PEEK_POKE__BEGIN_POKE(n)
+#define WUFFS_BASE__PEEK_POKE__END_POKE(n)
+#endif  // defined(WUFFS_CONFIG__MEMCPY_PEEK_POKE)
+
 #define wuffs_base__peek_u8be__no_bounds_check \
   wuffs_base__peek_u8__no_bounds_check
 #define wuffs_base__peek_u8le__no_bounds_check \
@@ -655,101 +1245,100 @@ wuffs_base__count_leading_zeroes_u64(uint64_t u) {
 
 static inline uint8_t  //
 wuffs_base__peek_u8__no_bounds_check(const uint8_t* p) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(1);
   return p[0];
 }
 
 static inline uint16_t  //
 wuffs_base__peek_u16be__no_bounds_check(const uint8_t* p) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(2);
   return (uint16_t)(((uint16_t)(p[0]) << 8) | ((uint16_t)(p[1]) << 0));
 }
 
 static inline uint16_t  //
 wuffs_base__peek_u16le__no_bounds_check(const uint8_t* p) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(2);
   return (uint16_t)(((uint16_t)(p[0]) << 0) | ((uint16_t)(p[1]) << 8));
 }
 
-static inline uint32_t  //
-wuffs_base__peek_u24be__no_bounds_check(const uint8_t* p) {
-  return ((uint32_t)(p[0]) << 16) | ((uint32_t)(p[1]) << 8) |
-         ((uint32_t)(p[2]) << 0);
-}
-
-static inline uint32_t  //
-wuffs_base__peek_u24le__no_bounds_check(const uint8_t* p) {
-  return ((uint32_t)(p[0]) << 0) | ((uint32_t)(p[1]) << 8) |
-         ((uint32_t)(p[2]) << 16);
-}
-
 static inline uint32_t  //
 wuffs_base__peek_u32be__no_bounds_check(const uint8_t* p) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(4);
   return ((uint32_t)(p[0]) << 24) | ((uint32_t)(p[1]) << 16) |
          ((uint32_t)(p[2]) << 8) | ((uint32_t)(p[3]) << 0);
 }
 
 static inline uint32_t  //
 wuffs_base__peek_u32le__no_bounds_check(const uint8_t* p) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(4);
   return ((uint32_t)(p[0]) << 0) | ((uint32_t)(p[1]) << 8) |
          ((uint32_t)(p[2]) << 16) | ((uint32_t)(p[3]) << 24);
 }
 
 static inline uint64_t  //
-wuffs_base__peek_u40be__no_bounds_check(const uint8_t* p) {
-  return ((uint64_t)(p[0]) << 32) | ((uint64_t)(p[1]) << 24) |
-         ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 8) |
-         ((uint64_t)(p[4]) << 0);
+wuffs_base__peek_u64be__no_bounds_check(const uint8_t* p) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(8);
+  return ((uint64_t)(p[0]) << 56) | ((uint64_t)(p[1]) << 48) |
+         ((uint64_t)(p[2]) << 40) | ((uint64_t)(p[3]) << 32) |
+         ((uint64_t)(p[4]) << 24) | ((uint64_t)(p[5]) << 16) |
+         ((uint64_t)(p[6]) << 8) | ((uint64_t)(p[7]) << 0);
 }
 
 static inline uint64_t  //
-wuffs_base__peek_u40le__no_bounds_check(const uint8_t* p) {
+wuffs_base__peek_u64le__no_bounds_check(const uint8_t* p) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(8);
   return ((uint64_t)(p[0]) << 0) | ((uint64_t)(p[1]) << 8) |
          ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 24) |
-         ((uint64_t)(p[4]) << 32);
+         ((uint64_t)(p[4]) << 32) | ((uint64_t)(p[5]) << 40) |
+         ((uint64_t)(p[6]) << 48) | ((uint64_t)(p[7]) << 56);
+}
+
+static inline uint32_t  //
+wuffs_base__peek_u24be__no_bounds_check(const uint8_t* p) {
+  return ((uint32_t)(wuffs_base__peek_u16be__no_bounds_check(p)) << 8) |
+         ((uint32_t)(wuffs_base__peek_u8be__no_bounds_check(p + 2)) << 0);
+}
+
+static inline uint32_t  //
+wuffs_base__peek_u24le__no_bounds_check(const uint8_t* p) {
+  return ((uint32_t)(wuffs_base__peek_u16le__no_bounds_check(p)) << 0) |
+         ((uint32_t)(wuffs_base__peek_u8le__no_bounds_check(p + 2)) << 16);
 }
 
 static inline uint64_t  //
-wuffs_base__peek_u48be__no_bounds_check(const uint8_t* p) {
-  return ((uint64_t)(p[0]) << 40) | ((uint64_t)(p[1]) << 32) |
-         ((uint64_t)(p[2]) << 24) | ((uint64_t)(p[3]) << 16) |
-         ((uint64_t)(p[4]) << 8) | ((uint64_t)(p[5]) << 0);
+wuffs_base__peek_u40be__no_bounds_check(const uint8_t* p) {
+  return ((uint64_t)(wuffs_base__peek_u32be__no_bounds_check(p)) << 8) |
+         ((uint64_t)(wuffs_base__peek_u8be__no_bounds_check(p + 4)) << 0);
 }
 
 static inline uint64_t  //
-wuffs_base__peek_u48le__no_bounds_check(const uint8_t* p) {
-  return ((uint64_t)(p[0]) << 0) | ((uint64_t)(p[1]) << 8) |
-         ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 24) |
-         ((uint64_t)(p[4]) << 32) | ((uint64_t)(p[5]) << 40);
+wuffs_base__peek_u40le__no_bounds_check(const uint8_t* p) {
+  return ((uint64_t)(wuffs_base__peek_u32le__no_bounds_check(p)) << 0) |
+         ((uint64_t)(wuffs_base__peek_u8le__no_bounds_check(p + 4)) << 32);
 }
 
 static inline uint64_t  //
-wuffs_base__peek_u56be__no_bounds_check(const uint8_t* p) {
-  return ((uint64_t)(p[0]) << 48) | ((uint64_t)(p[1]) << 40) |
-         ((uint64_t)(p[2]) << 32) | ((uint64_t)(p[3]) << 24) |
-         ((uint64_t)(p[4]) << 16) | ((uint64_t)(p[5]) << 8) |
-         ((uint64_t)(p[6]) << 0);
+wuffs_base__peek_u48be__no_bounds_check(const uint8_t* p) {
+  return ((uint64_t)(wuffs_base__peek_u32be__no_bounds_check(p)) << 16) |
+         ((uint64_t)(wuffs_base__peek_u16be__no_bounds_check(p + 4)) << 0);
 }
 
 static inline uint64_t  //
-wuffs_base__peek_u56le__no_bounds_check(const uint8_t* p) {
-  return ((uint64_t)(p[0]) << 0) | ((uint64_t)(p[1]) << 8) |
-         ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 24) |
-         ((uint64_t)(p[4]) << 32) | ((uint64_t)(p[5]) << 40) |
-         ((uint64_t)(p[6]) << 48);
+wuffs_base__peek_u48le__no_bounds_check(const uint8_t* p) {
+  return ((uint64_t)(wuffs_base__peek_u32le__no_bounds_check(p)) << 0) |
+         ((uint64_t)(wuffs_base__peek_u16le__no_bounds_check(p + 4)) << 32);
 }
 
 static inline uint64_t  //
-wuffs_base__peek_u64be__no_bounds_check(const uint8_t* p) {
-  return ((uint64_t)(p[0]) << 56) | ((uint64_t)(p[1]) << 48) |
-         ((uint64_t)(p[2]) << 40) | ((uint64_t)(p[3]) << 32) |
-         ((uint64_t)(p[4]) << 24) | ((uint64_t)(p[5]) << 16) |
-         ((uint64_t)(p[6]) << 8) | ((uint64_t)(p[7]) << 0);
+wuffs_base__peek_u56be__no_bounds_check(const uint8_t* p) {
+  return ((uint64_t)(wuffs_base__peek_u32be__no_bounds_check(p)) << 24) |
+         ((uint64_t)(wuffs_base__peek_u24be__no_bounds_check(p + 4)) << 0);
 }
 
 static inline uint64_t  //
-wuffs_base__peek_u64le__no_bounds_check(const uint8_t* p) {
-  return ((uint64_t)(p[0]) << 0) | ((uint64_t)(p[1]) << 8) |
-         ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 24) |
-         ((uint64_t)(p[4]) << 32) | ((uint64_t)(p[5]) << 40) |
-         ((uint64_t)(p[6]) << 48) | ((uint64_t)(p[7]) << 56);
+wuffs_base__peek_u56le__no_bounds_check(const uint8_t* p) {
+  return ((uint64_t)(wuffs_base__peek_u32le__no_bounds_check(p)) << 0) |
+         ((uint64_t)(wuffs_base__peek_u24le__no_bounds_check(p + 4)) << 32);
 }
 
 // --------
@@ -761,13 +1350,17 @@ wuffs_base__peek_u64le__no_bounds_check(const uint8_t* p) {
 
 static inline void  //
 wuffs_base__poke_u8__no_bounds_check(uint8_t* p, uint8_t x) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(1);
   p[0] = x;
+  WUFFS_BASE__PEEK_POKE__END_POKE(1);
 }
 
 static inline void  //
 wuffs_base__poke_u16be__no_bounds_check(uint8_t* p, uint16_t x) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(2);
   p[0] = (uint8_t)(x >> 8);
   p[1] = (uint8_t)(x >> 0);
+  WUFFS_BASE__PEEK_POKE__END_POKE(2);
 }
 
 static inline void  //
@@ -777,31 +1370,21 @@ wuffs_base__poke_u16le__no_bounds_check(uint8_t* p, uint16_t x) {
   // defines "__GNUC__".
   memcpy(p, &x, 2);
 #else
+  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(2);
   p[0] = (uint8_t)(x >> 0);
   p[1] = (uint8_t)(x >> 8);
+  WUFFS_BASE__PEEK_POKE__END_POKE(2);
 #endif
 }
 
-static inline void  //
-wuffs_base__poke_u24be__no_bounds_check(uint8_t* p, uint32_t x) {
-  p[0] = (uint8_t)(x >> 16);
-  p[1] = (uint8_t)(x >> 8);
-  p[2] = (uint8_t)(x >> 0);
-}
-
-static inline void  //
-wuffs_base__poke_u24le__no_bounds_check(uint8_t* p, uint32_t x) {
-  p[0] = (uint8_t)(x >> 0);
-  p[1] = (uint8_t)(x >> 8);
-  p[2] = (uint8_t)(x >> 16);
-}
-
 static inline void  //
 wuffs_base__poke_u32be__no_bounds_check(uint8_t* p, uint32_t x) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(4);
   p[0] = (uint8_t)(x >> 24);
   p[1] = (uint8_t)(x >> 16);
   p[2] = (uint8_t)(x >> 8);
   p[3] = (uint8_t)(x >> 0);
+  WUFFS_BASE__PEEK_POKE__END_POKE(4);
 }
 
 static inline void  //
@@ -811,75 +1394,18 @@ wuffs_base__poke_u32le__no_bounds_check(uint8_t* p, uint32_t x) {
   // defines "__GNUC__".
   memcpy(p, &x, 4);
 #else
+  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(4);
   p[0] = (uint8_t)(x >> 0);
   p[1] = (uint8_t)(x >> 8);
   p[2] = (uint8_t)(x >> 16);
   p[3] = (uint8_t)(x >> 24);
+  WUFFS_BASE__PEEK_POKE__END_POKE(4);
 #endif
 }
 
-static inline void  //
-wuffs_base__poke_u40be__no_bounds_check(uint8_t* p, uint64_t x) {
-  p[0] = (uint8_t)(x >> 32);
-  p[1] = (uint8_t)(x >> 24);
-  p[2] = (uint8_t)(x >> 16);
-  p[3] = (uint8_t)(x >> 8);
-  p[4] = (uint8_t)(x >> 0);
-}
-
-static inline void  //
-wuffs_base__poke_u40le__no_bounds_check(uint8_t* p, uint64_t x) {
-  p[0] = (uint8_t)(x >> 0);
-  p[1] = (uint8_t)(x >> 8);
-  p[2] = (uint8_t)(x >> 16);
-  p[3] = (uint8_t)(x >> 24);
-  p[4] = (uint8_t)(x >> 32);
-}
-
-static inline void  //
-wuffs_base__poke_u48be__no_bounds_check(uint8_t* p, uint64_t x) {
-  p[0] = (uint8_t)(x >> 40);
-  p[1] = (uint8_t)(x >> 32);
-  p[2] = (uint8_t)(x >> 24);
-  p[3] = (uint8_t)(x >> 16);
-  p[4] = (uint8_t)(x >> 8);
-  p[5] = (uint8_t)(x >> 0);
-}
-
-static inline void  //
-wuffs_base__poke_u48le__no_bounds_check(uint8_t* p, uint64_t x) {
-  p[0] = (uint8_t)(x >> 0);
-  p[1] = (uint8_t)(x >> 8);
-  p[2] = (uint8_t)(x >> 16);
-  p[3] = (uint8_t)(x >> 24);
-  p[4] = (uint8_t)(x >> 32);
-  p[5] = (uint8_t)(x >> 40);
-}
-
-static inline void  //
-wuffs_base__poke_u56be__no_bounds_check(uint8_t* p, uint64_t x) {
-  p[0] = (uint8_t)(x >> 48);
-  p[1] = (uint8_t)(x >> 40);
-  p[2] = (uint8_t)(x >> 32);
-  p[3] = (uint8_t)(x >> 24);
-  p[4] = (uint8_t)(x >> 16);
-  p[5] = (uint8_t)(x >> 8);
-  p[6] = (uint8_t)(x >> 0);
-}
-
-static inline void  //
-wuffs_base__poke_u56le__no_bounds_check(uint8_t* p, uint64_t x) {
-  p[0] = (uint8_t)(x >> 0);
-  p[1] = (uint8_t)(x >> 8);
-  p[2] = (uint8_t)(x >> 16);
-  p[3] = (uint8_t)(x >> 24);
-  p[4] = (uint8_t)(x >> 32);
-  p[5] = (uint8_t)(x >> 40);
-  p[6] = (uint8_t)(x >> 48);
-}
-
 static inline void  //
 wuffs_base__poke_u64be__no_bounds_check(uint8_t* p, uint64_t x) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(8);
   p[0] = (uint8_t)(x >> 56);
   p[1] = (uint8_t)(x >> 48);
   p[2] = (uint8_t)(x >> 40);
@@ -888,6 +1414,7 @@ wuffs_base__poke_u64be__no_bounds_check(uint8_t* p, uint64_t x) {
   p[5] = (uint8_t)(x >> 16);
   p[6] = (uint8_t)(x >> 8);
   p[7] = (uint8_t)(x >> 0);
+  WUFFS_BASE__PEEK_POKE__END_POKE(8);
 }
 
 static inline void  //
@@ -897,6 +1424,7 @@ wuffs_base__poke_u64le__no_bounds_check(uint8_t* p, uint64_t x) {
   // defines "__GNUC__".
   memcpy(p, &x, 8);
 #else
+  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(8);
   p[0] = (uint8_t)(x >> 0);
   p[1] = (uint8_t)(x >> 8);
   p[2] = (uint8_t)(x >> 16);
@@ -905,9 +1433,95 @@ wuffs_base__poke_u64le__no_bounds_check(uint8_t* p, uint64_t x) {
   p[5] = (uint8_t)(x >> 40);
   p[6] = (uint8_t)(x >> 48);
   p[7] = (uint8_t)(x >> 56);
+  WUFFS_BASE__PEEK_POKE__END_POKE(8);
 #endif
 }
 
+static inline void  //
+wuffs_base__poke_u24be__no_bounds_check(uint8_t* p, uint32_t x) {
+  wuffs_base__poke_u16be__no_bounds_check(p, (uint16_t)(x >> 8));
+  wuffs_base__poke_u8be__no_bounds_check(p + 2, (uint8_t)(x >> 0));
+}
+
+static inline void  //
+wuffs_base__poke_u24le__no_bounds_check(uint8_t* p, uint32_t x) {
+  wuffs_base__poke_u16le__no_bounds_check(p, (uint16_t)(x >> 0));
+  wuffs_base__poke_u8le__no_bounds_check(p + 2, (uint8_t)(x >> 16));
+}
+
+static inline void  //
+wuffs_base__poke_u40be__no_bounds_check(uint8_t* p, uint64_t x) {
+  wuffs_base__poke_u32be__no_bounds_check(p, (uint32_t)(x >> 8));
+  wuffs_base__poke_u8be__no_bounds_check(p + 4, (uint8_t)(x >> 0));
+}
+
+static inline void  //
+wuffs_base__poke_u40le__no_bounds_check(uint8_t* p, uint64_t x) {
+  wuffs_base__poke_u32le__no_bounds_check(p, (uint32_t)(x >> 0));
+  wuffs_base__poke_u8le__no_bounds_check(p + 4, (uint8_t)(x >> 32));
+}
+
+static inline void  //
+wuffs_base__poke_u48be__no_bounds_check(uint8_t* p, uint64_t x) {
+  wuffs_base__poke_u32be__no_bounds_check(p, (uint32_t)(x >> 16));
+  wuffs_base__poke_u16be__no_bounds_check(p + 4, (uint16_t)(x >> 0));
+}
+
+static inline void  //
+wuffs_base__poke_u48le__no_bounds_check(uint8_t* p, uint64_t x) {
+  wuffs_base__poke_u32le__no_bounds_check(p, (uint32_t)(x >> 0));
+  wuffs_base__poke_u16le__no_bounds_check(p + 4, (uint16_t)(x >> 32));
+}
+
+static inline void  //
+wuffs_base__poke_u56be__no_bounds_check(uint8_t* p, uint64_t x) {
+  wuffs_base__poke_u32be__no_bounds_check(p, (uint32_t)(x >> 24));
+  wuffs_base__poke_u24be__no_bounds_check(p + 4, (uint32_t)(x >> 0));
+}
+
+static inline void  //
+wuffs_base__poke_u56le__no_bounds_check(uint8_t* p, uint64_t x) {
+  wuffs_base__poke_u32le__no_bounds_check(p, (uint32_t)(x >> 0));
+  wuffs_base__poke_u24le__no_bounds_check(p + 4, (uint32_t)(x >> 32));
+}
+
+// --------
+
+// With C11, the wuffs_base__peek_be__no_bounds_check (and _le) macros pick the
+// width from a type, one of uint8_t, uint16_t, uint32_t or uint64_t, and the
+// wuffs_base__poke_be__no_bounds_check (and _le) macros pick the width from
+// the type of x. Other types, including int, fail to compile. For example:
+//
+//  uint32_t x = wuffs_base__peek_le__no_bounds_check(p, uint32_t);
+//  wuffs_base__poke_be__no_bounds_check(q, x);
+#if defined(__STDC_VERSION__) && (__STDC_VERSION__ >= 201112L) && \
+    !defined(__cplusplus)
+#define wuffs_base__peek_be__no_bounds_check(p, T)               \
+  _Generic((T)0,                                                 \
+           uint8_t: wuffs_base__peek_u8be__no_bounds_check,      \
+           uint16_t: wuffs_base__peek_u16be__no_bounds_check,    \
+           uint32_t: wuffs_base__peek_u32be__no_bounds_check,    \
+           uint64_t: wuffs_base__peek_u64be__no_bounds_check)(p)
+#define wuffs_base__peek_le__no_bounds_check(p, T)               \
+  _Generic((T)0,                                                 \
+           uint8_t: wuffs_base__peek_u8le__no_bounds_check,      \
+           uint16_t: wuffs_base__peek_u16le__no_bounds_check,    \
+           uint32_t: wuffs_base__peek_u32le__no_bounds_check,    \
+           uint64_t: wuffs_base__peek_u64le__no_bounds_check)(p)
+#define wuffs_base__poke_be__no_bounds_check(p, x)                  \
+  _Generic((x),                                                     \
+           uint8_t: wuffs_base__poke_u8be__no_bounds_check,         \
+           uint16_t: wuffs_base__poke_u16be__no_bounds_check,       \
+           uint32_t: wuffs_base__poke_u32be__no_bounds_check,       \
+           uint64_t: wuffs_base__poke_u64be__no_bounds_check)(p, x)
+#define wuffs_base__poke_le__no_bounds_check(p, x)                  \
+  _Generic((x),                                                     \
+           uint8_t: wuffs_base__poke_u8le__no_bounds_check,         \
+           uint16_t: wuffs_base__poke_u16le__no_bounds_check,       \
+           uint32_t: wuffs_base__poke_u32le__no_bounds_check,       \
+           uint64_t: wuffs_base__poke_u64le__no_bounds_check)(p, x)
+#endif  // __STDC_VERSION__ >= 201112L && !defined(__cplusplus)
+
 // --------
 
 // Load and Store functions are deprecated. Use Peek and Poke instead.
@@ -1011,6 +1625,18 @@ typedef WUFFS_BASE__TABLE(uint16_t) wuffs_base__table_u16;
 typedef WUFFS_BASE__TABLE(uint32_t) wuffs_base__table_u32;
 typedef WUFFS_BASE__TABLE(uint64_t) wuffs_base__table_u64;
 
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__slice_u8, ptr) == 0,
+                          slice_u8_ptr_offset);
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__slice_u8, len) ==
+                              sizeof(uint8_t*),
+                          slice_u8_len_offset);
+WUFFS_BASE__STATIC_ASSERT(sizeof(wuffs_base__slice_u8) ==
+                              (sizeof(uint8_t*) + sizeof(size_t)),
+                          slice_u8_sizeof);
+WUFFS_BASE__STATIC_ASSERT(sizeof(wuffs_base__table_u8) ==
+                              (sizeof(uint8_t*) + (3 * sizeof(size_t))),
+                          table_u8_sizeof);
+
 static inline wuffs_base__slice_u8  //
 wuffs_base__make_slice_u8(uint8_t* ptr, size_t len) {
   wuffs_base__slice_u8 ret;
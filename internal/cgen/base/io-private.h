@@ -159,6 +159,35 @@ wuffs_base__io_writer__limit(uint8_t** ptr_io2_w,
   }
 }
 
+#if defined(WUFFS_CONFIG__AUTOVEC)
+// wuffs_base__io_writer__autovec_copy copies n bytes from src to dst, which
+// must not overlap. It is shaped for compilers' auto-vectorizers: byte copies
+// until dst is 8-byte aligned, then a loop unrolled by 8, then the tail.
+static inline void  //
+wuffs_base__io_writer__autovec_copy(uint8_t* WUFFS_BASE__RESTRICT dst,
+                                    const uint8_t* WUFFS_BASE__RESTRICT src,
+                                    size_t n) {
+  for (; (n > 0) && (((uintptr_t)(dst)) & 7); n--) {
+    *dst++ = *src++;
+  }
+  for (; n >= 8; n -= 8) {
+    dst[0] = src[0];
+    dst[1] = src[1];
+    dst[2] = src[2];
+    dst[3] = src[3];
+    dst[4] = src[4];
+    dst[5] = src[5];
+    dst[6] = src[6];
+    dst[7] = src[7];
+    dst += 8;
+    src += 8;
+  }
+  for (; n > 0; n--) {
+    *dst++ = *src++;
+  }
+}
+#endif  // defined(WUFFS_CONFIG__AUTOVEC)
+
 static inline uint32_t  //
 wuffs_base__io_writer__limited_copy_u32_from_history(uint8_t** ptr_iop_w,
                                                      uint8_t* io1_w,
@@ -179,6 +208,13 @@ wuffs_base__io_writer__limited_copy_u32_from_history(uint8_t** ptr_iop_w,
   } else {
     n = (size_t)(length);
   }
+#if defined(WUFFS_CONFIG__AUTOVEC)
+  if ((size_t)(distance) >= n) {
+    wuffs_base__io_writer__autovec_copy(p, q, n);
+    *ptr_iop_w = p + n;
+    return length;
+  }
+#endif  // defined(WUFFS_CONFIG__AUTOVEC)
   // TODO: unrolling by 3 seems best for the std/deflate benchmarks, but that
   // is mostly because 3 is the minimum length for the deflate format. This
   // function implementation shouldn't overfit to that one format. Perhaps the
@@ -216,6 +252,13 @@ wuffs_base__io_writer__limited_copy_u32_from_history_fast(uint8_t** ptr_iop_w,
   uint8_t* p = *ptr_iop_w;
   uint8_t* q = p - distance;
   uint32_t n = length;
+#if defined(WUFFS_CONFIG__AUTOVEC)
+  if (distance >= n) {
+    wuffs_base__io_writer__autovec_copy(p, q, n);
+    *ptr_iop_w = p + n;
+    return length;
+  }
+#endif  // defined(WUFFS_CONFIG__AUTOVEC)
   for (; n >= 3; n -= 3) {
     *p++ = *q++;
     *p++ = *q++;
@@ -55,6 +55,27 @@ typedef struct wuffs_base__io_buffer__struct {
 
 } wuffs_base__io_buffer;
 
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer_meta, wi) == 0,
+                          io_buffer_meta_wi_offset);
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer_meta, ri) ==
+                              sizeof(size_t),
+                          io_buffer_meta_ri_offset);
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer_meta, pos) ==
+                              (2 * sizeof(size_t)),
+                          io_buffer_meta_pos_offset);
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer_meta, closed) ==
+                              ((2 * sizeof(size_t)) + sizeof(uint64_t)),
+                          io_buffer_meta_closed_offset);
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer, data) == 0,
+                          io_buffer_data_offset);
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer, meta) ==
+                              sizeof(wuffs_base__slice_u8),
+                          io_buffer_meta_offset);
+WUFFS_BASE__STATIC_ASSERT(sizeof(wuffs_base__io_buffer) ==
+                              (sizeof(wuffs_base__slice_u8) +
+                               sizeof(wuffs_base__io_buffer_meta)),
+                          io_buffer_sizeof);
+
 static inline wuffs_base__io_buffer  //
 wuffs_base__make_io_buffer(wuffs_base__slice_u8 data,
                            wuffs_base__io_buffer_meta meta) {
@@ -294,3 +315,249 @@ wuffs_base__io_buffer::writer_slice() const {
 }
 
 #endif  // __cplusplus
+
+// ---------------- I/O Read Callbacks
+
+// wuffs_base__io_read_func is the type of a pull-style callback that supplies
+// input bytes in place, such as the next mapped window of a memory-mapped
+// file or the next contiguous run of a ring buffer, instead of the caller
+// copying them into an io_buffer. It returns those bytes, which must remain
+// valid and unmodified until the next call, and sets *closed to whether no
+// further bytes follow them. Returning an empty slice, with *closed false,
+// means that no bytes are available yet.
+typedef wuffs_base__slice_u8 (*wuffs_base__io_read_func)(void* context,
+                                                         bool* closed);
+
+// wuffs_base__io_read_callback is a wuffs_base__io_read_func and its context,
+// plus the state for wuffs_base__io_buffer__refill. Make one with
+// wuffs_base__make_io_read_callback.
+//
+// The stitch slice, owned by the caller, is only used when a decoder suspends
+// with unread bytes, such as the first half of a multi-byte field at the end
+// of one run of bytes. Those are joined with the start of the next run, which
+// is otherwise returned to the decoder in place. The stitch length bounds how
+// many unread bytes can be carried over. A few dozen bytes is typically
+// enough but a longer stitch means fewer, larger copies.
+typedef struct wuffs_base__io_read_callback__struct {
+  wuffs_base__io_read_func func;
+  void* context;
+  wuffs_base__slice_u8 stitch;
+
+  // Do not access the private_impl's fields directly. There is no API/ABI
+  // compatibility or safety guarantee if you do so.
+  struct {
+    // pending holds the bytes returned by func but not yet passed on.
+    wuffs_base__slice_u8 pending;
+    bool closed;
+  } private_impl;
+} wuffs_base__io_read_callback;
+
+static inline wuffs_base__io_read_callback  //
+wuffs_base__make_io_read_callback(wuffs_base__io_read_func func,
+                                  void* context,
+                                  wuffs_base__slice_u8 stitch) {
+  wuffs_base__io_read_callback ret;
+  ret.func = func;
+  ret.context = context;
+  ret.stitch = stitch;
+  ret.private_impl.pending = wuffs_base__empty_slice_u8();
+  ret.private_impl.closed = false;
+  return ret;
+}
+
+// wuffs_base__io_buffer__refill gives buf, a source io_buffer that a decoder
+// has (partially) read, more bytes from cb. Call it after a "$short read"
+// suspension and then call the decoder again, with the same buf.
+//
+// If buf has no unread bytes then it is re-pointed at cb's next bytes, without
+// copying them. Otherwise, its unread bytes and (as many as fit) the next
+// bytes are copied into cb's stitch slice and buf is re-pointed at that.
+// Either way, buf's reader position is unchanged.
+//
+// It returns a "$short read" suspension if cb had no further bytes (and is not
+// closed) and a "#bad argument (length too short)" error if buf's unread
+// bytes do not fit in the stitch slice with room to spare.
+static inline wuffs_base__status  //
+wuffs_base__io_buffer__refill(wuffs_base__io_buffer* buf,
+                              wuffs_base__io_read_callback* cb) {
+  if (!buf || !cb || !cb->func) {
+    return wuffs_base__make_status(wuffs_base__error__bad_argument);
+  }
+  size_t n = buf->meta.wi - buf->meta.ri;
+  uint64_t pos = wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.ri);
+
+  // Copy any unread bytes before calling cb->func, which can invalidate them.
+  if (n > 0) {
+    if (n >= cb->stitch.len) {
+      return wuffs_base__make_status(
+          wuffs_base__error__bad_argument_length_too_short);
+    }
+    memmove(cb->stitch.ptr, buf->data.ptr + buf->meta.ri, n);
+  }
+
+  wuffs_base__slice_u8* pending = &cb->private_impl.pending;
+  if ((pending->len == 0) && !cb->private_impl.closed) {
+    *pending = (*cb->func)(cb->context, &cb->private_impl.closed);
+  }
+
+  size_t m = pending->len;
+  if (n == 0) {
+    buf->data = *pending;
+  } else {
+    if (m > (cb->stitch.len - n)) {
+      m = cb->stitch.len - n;
+    }
+    if (m > 0) {
+      memcpy(cb->stitch.ptr + n, pending->ptr, m);
+    }
+    buf->data = cb->stitch;
+  }
+  *pending = wuffs_base__slice_u8__subslice_i(*pending, m);
+
+  bool closed = cb->private_impl.closed && (pending->len == 0);
+  buf->meta = wuffs_base__make_io_buffer_meta(n + m, 0, pos, closed);
+  if ((m == 0) && !closed) {
+    return wuffs_base__make_status(wuffs_base__suspension__short_read);
+  }
+  return wuffs_base__make_status(NULL);
+}
+
+// ---------------- Metadata Chunks
+
+// wuffs_base__metadata_chunk_func is the type of a callback that receives
+// metadata (such as an ICC profile or XMP) in chunks, as it is decoded. The
+// fourcc identifies the metadata and io_position is the I/O position of the
+// chunk's first byte. Returning a non-OK status stops the visit and that
+// status is passed back to the visitor's caller.
+//
+// The chunk's bytes are only valid for the duration of the call.
+typedef wuffs_base__status (*wuffs_base__metadata_chunk_func)(
+    void* context,
+    uint32_t fourcc,
+    uint64_t io_position,
+    wuffs_base__slice_u8 chunk);
+
+// wuffs_base__more_information__deliver_metadata passes the bytes of src that
+// lie within m's range to callback, advancing src's read index past them. It
+// does nothing if m does not have the METADATA flavor or if src's reader
+// position is outside of m's range.
+//
+// It returns OK once it reaches the end of the range, or a "$short read"
+// suspension (or, if src is closed, a "#not enough data" error) if src runs
+// out of bytes first. The caller can re-fill src and call it again, as m is
+// not modified: progress is tracked by src's reader position.
+//
+// This is typically called by a generated wuffs_foo__bar__visit_metadata
+// function, which alternates it with calls to wuffs_foo__bar__tell_me_more.
+static inline wuffs_base__status  //
+wuffs_base__more_information__deliver_metadata(
+    const wuffs_base__more_information* m,
+    wuffs_base__io_buffer* src,
+    wuffs_base__metadata_chunk_func callback,
+    void* context) {
+  if (!m || (m->flavor != WUFFS_BASE__MORE_INFORMATION__FLAVOR__METADATA) ||
+      !src) {
+    return wuffs_base__make_status(NULL);
+  }
+  if (!callback) {
+    return wuffs_base__make_status(wuffs_base__error__bad_argument);
+  }
+  while (true) {
+    uint64_t pos = wuffs_base__io_buffer__reader_position(src);
+    if ((pos < m->y) || (pos >= m->z)) {
+      return wuffs_base__make_status(NULL);
+    }
+    size_t n = wuffs_base__io_buffer__reader_length(src);
+    if (n == 0) {
+      return wuffs_base__make_status(src->meta.closed
+                                         ? wuffs_base__error__not_enough_data
+                                         : wuffs_base__suspension__short_read);
+    }
+    if (n > (m->z - pos)) {
+      n = (size_t)(m->z - pos);
+    }
+    wuffs_base__status status = (*callback)(
+        context, m->w, pos,
+        wuffs_base__make_slice_u8(wuffs_base__io_buffer__reader_pointer(src),
+                                  n));
+    if (status.repr) {
+      return status;
+    }
+    src->meta.ri += n;
+  }
+}
+
+// wuffs_base__metadata_reader is a pull-style alternative to a
+// wuffs_base__metadata_chunk_func callback. A generated
+// wuffs_foo__bar__read_metadata_chunk function sets its fourcc, io_position
+// and chunk fields to the next chunk of metadata. The chunk's bytes alias src
+// (no memory is allocated) and are only valid until src is next modified.
+//
+// The minfo field holds the tell_me_more state. Callers should not modify it,
+// other than to read an "I/O seek" position after a "$mispositioned read".
+typedef struct wuffs_base__metadata_reader__struct {
+  uint32_t fourcc;
+  uint64_t io_position;
+  wuffs_base__slice_u8 chunk;
+  wuffs_base__more_information minfo;
+} wuffs_base__metadata_reader;
+
+static inline wuffs_base__metadata_reader  //
+wuffs_base__empty_metadata_reader() {
+  wuffs_base__metadata_reader ret;
+  ret.fourcc = 0;
+  ret.io_position = 0;
+  ret.chunk = wuffs_base__empty_slice_u8();
+  ret.minfo = wuffs_base__empty_more_information();
+  return ret;
+}
+
+// wuffs_base__metadata_reader__next_chunk advances src's read index past r's
+// previous chunk, if src still holds it, and then sets r's chunk to the bytes
+// of src that lie within r's minfo's range. The chunk is empty if r's minfo
+// does not have the METADATA flavor or if src's reader position is outside of
+// that range.
+//
+// Like wuffs_base__more_information__deliver_metadata, it returns a "$short
+// read" suspension (or, if src is closed, a "#not enough data" error) if src
+// has no bytes (within that range) left.
+//
+// This is typically called by a generated wuffs_foo__bar__read_metadata_chunk
+// function, which alternates it with calls to wuffs_foo__bar__tell_me_more.
+static inline wuffs_base__status  //
+wuffs_base__metadata_reader__next_chunk(wuffs_base__metadata_reader* r,
+                                        wuffs_base__io_buffer* src) {
+  if (!r) {
+    return wuffs_base__make_status(wuffs_base__error__bad_argument);
+  } else if (!src) {
+    return wuffs_base__make_status(NULL);
+  }
+  if ((r->chunk.len > 0) &&
+      (wuffs_base__io_buffer__reader_position(src) == r->io_position) &&
+      (r->chunk.len <= wuffs_base__io_buffer__reader_length(src))) {
+    src->meta.ri += r->chunk.len;
+  }
+  r->chunk = wuffs_base__empty_slice_u8();
+
+  if (r->minfo.flavor != WUFFS_BASE__MORE_INFORMATION__FLAVOR__METADATA) {
+    return wuffs_base__make_status(NULL);
+  }
+  uint64_t pos = wuffs_base__io_buffer__reader_position(src);
+  if ((pos < r->minfo.y) || (pos >= r->minfo.z)) {
+    return wuffs_base__make_status(NULL);
+  }
+  size_t n = wuffs_base__io_buffer__reader_length(src);
+  if (n == 0) {
+    return wuffs_base__make_status(src->meta.closed
+                                       ? wuffs_base__error__not_enough_data
+                                       : wuffs_base__suspension__short_read);
+  }
+  if (n > (r->minfo.z - pos)) {
+    n = (size_t)(r->minfo.z - pos);
+  }
+  r->fourcc = r->minfo.w;
+  r->io_position = pos;
+  r->chunk =
+      wuffs_base__make_slice_u8(wuffs_base__io_buffer__reader_pointer(src), n);
+  return wuffs_base__make_status(NULL);
+}
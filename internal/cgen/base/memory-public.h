@@ -72,3 +72,81 @@ wuffs_base__malloc_slice_u64(void* (*malloc_func)(size_t), uint64_t num_u64) {
   }
   return wuffs_base__make_slice_u64(NULL, 0);
 }
+
+// --------
+
+// wuffs_base__allocator is a memory allocator: a pair of function pointers
+// and the userdata passed to them. It lets embedded users supply arena or pool
+// allocators to the wuffs_foo__bar__alloc_with functions, which wuffs-c
+// generates when given the -allocator flag.
+//
+// The alloc function returns a pointer to len bytes (or NULL on failure).
+// That memory does not have to be zeroed. The free function releases what
+// alloc returned, and is never passed a NULL ptr.
+typedef struct wuffs_base__allocator__struct {
+  void* (*alloc)(void* userdata, size_t len);
+  void (*free)(void* userdata, void* ptr);
+  void* userdata;
+} wuffs_base__allocator;
+
+static inline void*  //
+wuffs_base__default_allocator__alloc(void* userdata, size_t len) {
+  return malloc(len);
+}
+
+static inline void  //
+wuffs_base__default_allocator__free(void* userdata, void* ptr) {
+  free(ptr);
+}
+
+// wuffs_base__default_allocator returns an allocator that calls the C
+// stdlib's malloc and free. A NULL allocator argument to the functions below,
+// or to the generated alloc_with functions, means this default allocator.
+static inline const wuffs_base__allocator*  //
+wuffs_base__default_allocator() {
+  static const wuffs_base__allocator a = {
+      &wuffs_base__default_allocator__alloc,
+      &wuffs_base__default_allocator__free,
+      NULL,
+  };
+  return &a;
+}
+
+static inline void*  //
+wuffs_base__allocator__alloc(const wuffs_base__allocator* a, size_t len) {
+  if (!a) {
+    a = wuffs_base__default_allocator();
+  }
+  return (*a->alloc)(a->userdata, len);
+}
+
+// wuffs_base__allocator__free frees ptr, which must have been returned by the
+// same allocator (or by an alloc_with function given that allocator). It is a
+// no-op if ptr is NULL.
+static inline void  //
+wuffs_base__allocator__free(const wuffs_base__allocator* a, void* ptr) {
+  if (!ptr) {
+    return;
+  }
+  if (!a) {
+    a = wuffs_base__default_allocator();
+  }
+  (*a->free)(a->userdata, ptr);
+}
+
+#if defined(__cplusplus) && defined(WUFFS_BASE__HAVE_UNIQUE_PTR)
+// wuffs_base__allocator__deleter is a std::unique_ptr deleter that frees via
+// a wuffs_base__allocator. The C++ alloc_with methods return a
+// std::unique_ptr<T, wuffs_base__allocator__deleter>.
+struct wuffs_base__allocator__deleter {
+  explicit wuffs_base__allocator__deleter(
+      const wuffs_base__allocator* allocator = nullptr)
+      : m_allocator(allocator) {}
+
+  void operator()(void* ptr) const {
+    wuffs_base__allocator__free(m_allocator, ptr);
+  }
+
+  const wuffs_base__allocator* m_allocator;
+};
+#endif  // defined(__cplusplus) && defined(WUFFS_BASE__HAVE_UNIQUE_PTR)
@@ -832,6 +832,9 @@ typedef struct wuffs_base__more_information__struct {
   inline uint64_t io_seek__position() const;
   inline uint32_t metadata__fourcc() const;
   inline wuffs_base__range_ie_u64 metadata__range() const;
+  inline void set_metadata(uint32_t fourcc_arg,
+                           uint64_t min_incl_arg,
+                           uint64_t max_excl_arg);
 #endif  // __cplusplus
 
 } wuffs_base__more_information;
@@ -868,6 +871,19 @@ wuffs_base__more_information__set(wuffs_base__more_information* m,
   m->z = z;
 }
 
+// wuffs_base__more_information__set_metadata is equivalent to
+// wuffs_base__more_information__set with the METADATA flavor. The metadata's
+// bytes are those in the half-open I/O position range [min_incl, max_excl).
+static inline void  //
+wuffs_base__more_information__set_metadata(wuffs_base__more_information* m,
+                                           uint32_t fourcc,
+                                           uint64_t min_incl,
+                                           uint64_t max_excl) {
+  wuffs_base__more_information__set(
+      m, WUFFS_BASE__MORE_INFORMATION__FLAVOR__METADATA, fourcc, 0, min_incl,
+      max_excl);
+}
+
 static inline uint32_t  //
 wuffs_base__more_information__io_redirect__fourcc(
     const wuffs_base__more_information* m) {
@@ -941,4 +957,12 @@ wuffs_base__more_information::metadata__range() const {
   return wuffs_base__more_information__metadata__range(this);
 }
 
+inline void  //
+wuffs_base__more_information::set_metadata(uint32_t fourcc_arg,
+                                           uint64_t min_incl_arg,
+                                           uint64_t max_excl_arg) {
+  wuffs_base__more_information__set_metadata(this, fourcc_arg, min_incl_arg,
+                                             max_excl_arg);
+}
+
 #endif  // __cplusplus
@@ -36,6 +36,9 @@ typedef struct wuffs_base__token__struct {
 
 } wuffs_base__token;
 
+WUFFS_BASE__STATIC_ASSERT(sizeof(wuffs_base__token) == sizeof(uint64_t),
+                          token_sizeof);
+
 static inline wuffs_base__token  //
 wuffs_base__make_token(uint64_t repr) {
   wuffs_base__token ret;
@@ -335,6 +338,14 @@ typedef struct wuffs_base__token_buffer__struct {
 
 } wuffs_base__token_buffer;
 
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__token_buffer, meta) ==
+                              sizeof(wuffs_base__slice_token),
+                          token_buffer_meta_offset);
+WUFFS_BASE__STATIC_ASSERT(sizeof(wuffs_base__token_buffer) ==
+                              (sizeof(wuffs_base__slice_token) +
+                               sizeof(wuffs_base__token_buffer_meta)),
+                          token_buffer_sizeof);
+
 static inline wuffs_base__token_buffer  //
 wuffs_base__make_token_buffer(wuffs_base__slice_token data,
                               wuffs_base__token_buffer_meta meta) {
@@ -184,6 +184,8 @@ func (g *gen) writeBuiltinIOReader(b *buffer, recv *a.Expr, method t.ID, args []
 
 	switch method {
 	case t.IDValidUTF8Length:
+		// The wuffs_base__u64__min with a pointer difference means that this
+		// size_t conversion cannot truncate, so -audit32 does not flag it.
 		b.printf("((uint64_t)(wuffs_base__utf_8__longest_valid_prefix(%s%s,\n"+
 			"((size_t)(wuffs_base__u64__min(((uint64_t)(%s%s - %s%s)), ",
 			iopPrefix, recvName, io2Prefix, recvName, iopPrefix, recvName)
@@ -451,6 +453,10 @@ func (g *gen) writeBuiltinCPUArch(b *buffer, recv *a.Expr, method t.ID, args []*
 		return g.writeBuiltinCPUArchARMCRC32(b, recv, method, args, sideEffectsOnly, depth)
 	case id.IsBuiltInCPUArchARMNeon():
 		return g.writeBuiltinCPUArchARMNeon(b, recv, method, args, sideEffectsOnly, depth)
+	case id == t.IDARMSVEUtility, id == t.IDARMSVEU8:
+		return g.writeBuiltinCPUArchScalable(b, recv, method, args, sideEffectsOnly, depth, &cpuArchScalableARMSVE)
+	case id == t.IDRISCVVUtility, id == t.IDRISCVVU8:
+		return g.writeBuiltinCPUArchScalable(b, recv, method, args, sideEffectsOnly, depth, &cpuArchScalableRISCVV)
 	case id == t.IDX86SSE42Utility, id == t.IDX86M128I:
 		return g.writeBuiltinCPUArchX86(b, recv, method, args, sideEffectsOnly, depth)
 	}
@@ -600,6 +606,137 @@ func (g *gen) writeBuiltinCPUArchARMNeon(b *buffer, recv *a.Expr, method t.ID, a
 	return nil
 }
 
+// cpuArchScalable holds the C intrinsics for a scalable vector cpu_arch: one
+// whose vector length is only known at run time. SVE intrinsics take a
+// predicate as their first argument and RVV intrinsics take a vector length
+// as their last argument.
+type cpuArchScalable struct {
+	predFirst bool
+	// allLanes is the predicate or vector length that covers every lane.
+	allLanes string
+	// firstLanes is like allLanes but covers only the first N lanes, where N
+	// is the minimum of the %s argument and the vector length. RVV's vsetvl
+	// only guarantees that for an AVL (application vector length) of at most
+	// VLMAX, so the RVV form clamps the argument to VLMAX first.
+	firstLanes string
+	// lengthU8 is the vector length, in bytes.
+	lengthU8 string
+
+	repeatU8 string
+	loadU8   string
+	storeU8  string
+
+	// An op method like "svadd_u8" or "vadd_vv_u8m1" calls the intrinsic
+	// named opPrefix + methodName + opSuffix.
+	opPrefix string
+	opSuffix string
+}
+
+var cpuArchScalableARMSVE = cpuArchScalable{
+	predFirst:  true,
+	allLanes:   "svptrue_b8()",
+	firstLanes: "svwhilelt_b8_u64(0, %s)",
+	lengthU8:   "svcntb()",
+	repeatU8:   "svdup_n_u8",
+	loadU8:     "svld1_u8",
+	storeU8:    "svst1_u8",
+	opSuffix:   "_x",
+}
+
+var cpuArchScalableRISCVV = cpuArchScalable{
+	predFirst:  false,
+	allLanes:   "__riscv_vsetvlmax_e8m1()",
+	firstLanes: "__riscv_vsetvl_e8m1(wuffs_base__u64__min(%s, __riscv_vsetvlmax_e8m1()))",
+	lengthU8:   "__riscv_vsetvlmax_e8m1()",
+	repeatU8:   "__riscv_vmv_v_x_u8m1",
+	loadU8:     "__riscv_vle8_v_u8m1",
+	storeU8:    "__riscv_vse8_v_u8m1",
+	opPrefix:   "__riscv_",
+}
+
+func (g *gen) writeBuiltinCPUArchScalable(b *buffer, recv *a.Expr, method t.ID, args []*a.Node, sideEffectsOnly bool, depth uint32, s *cpuArchScalable) error {
+	cArgs := []string(nil)
+	for _, o := range args {
+		arg := buffer(nil)
+		if err := g.writeExpr(&arg, o.AsArg().Value(), false, depth); err != nil {
+			return err
+		}
+		cArgs = append(cArgs, string(arg))
+	}
+
+	// The "_slicevl" methods are predicated (SVE) or length-limited (RVV) to
+	// the slice's length, so they never read or write past its end.
+	slicePtrAndLanes := func() (ptr string, lanes string, err error) {
+		buf := buffer(nil)
+		if err := g.writeExprDotPtr(&buf, args[0].AsArg().Value(), false, depth); err != nil {
+			return "", "", err
+		}
+		return string(buf), fmt.Sprintf(s.firstLanes, "((uint64_t)("+cArgs[0]+".len))"), nil
+	}
+
+	fName, lanes, cRecv := "", "", ""
+	if !recv.MType().IsEtcUtilityType() {
+		buf := buffer(nil)
+		if err := g.writeExpr(&buf, recv, false, depth); err != nil {
+			return err
+		}
+		cRecv = string(buf)
+	}
+
+	methodStr := method.Str(g.tm)
+	switch methodStr {
+	case "length_u8":
+		b.printf("((uint64_t)(%s))", s.lengthU8)
+		return nil
+
+	case "make_u8_repeat":
+		fName = s.repeatU8
+		if !s.predFirst {
+			lanes = s.allLanes
+		}
+
+	case "make_u8_slicevl":
+		ptr, l, err := slicePtrAndLanes()
+		if err != nil {
+			return err
+		}
+		fName, lanes, cArgs = s.loadU8, l, []string{ptr}
+
+	case "store_slicevl":
+		ptr, l, err := slicePtrAndLanes()
+		if err != nil {
+			return err
+		}
+		fName, lanes, cArgs = s.storeU8, l, []string{ptr, cRecv}
+
+	default:
+		if cRecv == "" {
+			return fmt.Errorf("internal error: unsupported cpu_arch method %q", methodStr)
+		}
+		fName, lanes, cArgs = s.opPrefix+methodStr+s.opSuffix, s.allLanes, append([]string{cRecv}, cArgs...)
+	}
+
+	if lanes != "" {
+		if s.predFirst {
+			cArgs = append([]string{lanes}, cArgs...)
+		} else {
+			cArgs = append(cArgs, lanes)
+		}
+	}
+
+	isStore := methodStr == "store_slicevl"
+	if isStore && !sideEffectsOnly {
+		// As for writeBuiltinCPUArchX86's store methods, use the comma
+		// operator to give the expression an empty struct value.
+		b.writes("(")
+	}
+	b.printf("%s(%s)", fName, strings.Join(cArgs, ", "))
+	if isStore && !sideEffectsOnly {
+		b.writes(", wuffs_base__make_empty_struct())")
+	}
+	return nil
+}
+
 func (g *gen) writeBuiltinCPUArchX86(b *buffer, recv *a.Expr, method t.ID, args []*a.Node, sideEffectsOnly bool, depth uint32) error {
 	methodStr := method.Str(g.tm)
 	if strings.HasPrefix(methodStr, "make_") {
@@ -805,7 +942,12 @@ func (g *gen) writeBuiltinNumType(b *buffer, recv *a.Expr, method t.ID, args []*
 		return nil
 
 	case t.IDMax:
-		b.writes("wuffs_base__u")
+		b.writes("wuffs_base__")
+		if recv.MType().IsSignedInteger() {
+			b.writeb('i')
+		} else {
+			b.writeb('u')
+		}
 		if sz, err := g.sizeof(recv.MType()); err != nil {
 			return err
 		} else {
@@ -823,7 +965,12 @@ func (g *gen) writeBuiltinNumType(b *buffer, recv *a.Expr, method t.ID, args []*
 		return nil
 
 	case t.IDMin:
-		b.writes("wuffs_base__u")
+		b.writes("wuffs_base__")
+		if recv.MType().IsSignedInteger() {
+			b.writeb('i')
+		} else {
+			b.writeb('u')
+		}
 		if sz, err := g.sizeof(recv.MType()); err != nil {
 			return err
 		} else {
@@ -839,6 +986,36 @@ func (g *gen) writeBuiltinNumType(b *buffer, recv *a.Expr, method t.ID, args []*
 		}
 		b.writes(")")
 		return nil
+
+	case t.IDCeilDivPow2, t.IDFloorLog2, t.IDMulQ16Round, t.IDMulQ8Round:
+		// The bounds checker has proved that the result fits in recv's type
+		// and, for floor_log2, that recv is non-zero.
+		b.writes("wuffs_base__u")
+		if sz, err := g.sizeof(recv.MType()); err != nil {
+			return err
+		} else {
+			b.printf("%d", 8*sz)
+		}
+		b.printf("__%s(", method.Str(g.tm))
+		if err := g.writeExpr(b, recv, false, depth); err != nil {
+			return err
+		}
+		for _, o := range args {
+			b.writes(", ")
+			if err := g.writeExpr(b, o.AsArg().Value(), false, depth); err != nil {
+				return err
+			}
+		}
+		b.writes(")")
+		return nil
+
+	case t.IDToU32Checked:
+		b.writes("wuffs_base__u64__to_u32_checked(")
+		if err := g.writeExpr(b, recv, false, depth); err != nil {
+			return err
+		}
+		b.writes(")")
+		return nil
 	}
 	return errNoSuchBuiltin
 }
@@ -1098,9 +1275,8 @@ func (g *gen) writeBuiltinQuestionCall(b *buffer, n *a.Expr, depth uint32) error
 			}
 
 			g.currFunk.usesScratch = true
-			// TODO: don't hard-code [0], and allow recursive coroutines.
-			scratchName := fmt.Sprintf("self->private_data.%s%s[0].scratch",
-				sPrefix, g.currFunk.astFunc.FuncName().Str(g.tm))
+			scratchName := fmt.Sprintf("self->private_data.%s%s%s.scratch",
+				sPrefix, g.currFunk.astFunc.FuncName().Str(g.tm), g.coroFrame())
 
 			b.printf("%s = ", scratchName)
 			if err := g.writeExpr(b, x, false, depth); err != nil {
@@ -1136,9 +1312,8 @@ func (g *gen) writeBuiltinQuestionCall(b *buffer, n *a.Expr, depth uint32) error
 		switch method.Ident() {
 		case t.IDWriteU8:
 			g.currFunk.usesScratch = true
-			// TODO: don't hard-code [0], and allow recursive coroutines.
-			scratchName := fmt.Sprintf("self->private_data.%s%s[0].scratch",
-				sPrefix, g.currFunk.astFunc.FuncName().Str(g.tm))
+			scratchName := fmt.Sprintf("self->private_data.%s%s%s.scratch",
+				sPrefix, g.currFunk.astFunc.FuncName().Str(g.tm), g.coroFrame())
 
 			b.printf("%s = ", scratchName)
 			x := n.Args()[0].AsArg().Value()
@@ -1189,21 +1364,23 @@ func (g *gen) writeReadUxxAsUyy(b *buffer, n *a.Expr, preName string, xx uint8,
 	}
 
 	g.currFunk.usesScratch = true
-	// TODO: don't hard-code [0], and allow recursive coroutines.
-	scratchName := fmt.Sprintf("self->private_data.%s%s[0].scratch",
-		sPrefix, g.currFunk.astFunc.FuncName().Str(g.tm))
-
-	b.printf("if (WUFFS_BASE__LIKELY(io2_%s - iop_%s >= %d)) {\n", recvName, recvName, xx/8)
-	b.printf("%s%d = ", tPrefix, temp)
-	if xx != yy {
-		b.printf("((uint%d_t)(", yy)
+	scratchName := fmt.Sprintf("self->private_data.%s%s%s.scratch",
+		sPrefix, g.currFunk.astFunc.FuncName().Str(g.tm), g.coroFrame())
+
+	// With -optimize=size, there is no fast path, only the slow path below.
+	if !g.optimizeSize {
+		b.printf("if (WUFFS_BASE__LIKELY(io2_%s - iop_%s >= %d)) {\n", recvName, recvName, xx/8)
+		b.printf("%s%d = ", tPrefix, temp)
+		if xx != yy {
+			b.printf("((uint%d_t)(", yy)
+		}
+		b.printf("wuffs_base__peek_u%d%ce__no_bounds_check(iop_%s)", xx, endianness, recvName)
+		if xx != yy {
+			b.writes("))")
+		}
+		b.printf(";\niop_%s += %d;\n", recvName, xx/8)
+		b.printf("} else {\n")
 	}
-	b.printf("wuffs_base__peek_u%d%ce__no_bounds_check(iop_%s)", xx, endianness, recvName)
-	if xx != yy {
-		b.writes("))")
-	}
-	b.printf(";\niop_%s += %d;\n", recvName, xx/8)
-	b.printf("} else {\n")
 
 	b.printf("%s = 0;\n", scratchName)
 	if err := g.writeCoroSuspPoint(b, false); err != nil {
@@ -1246,7 +1423,10 @@ func (g *gen) writeReadUxxAsUyy(b *buffer, n *a.Expr, preName string, xx uint8,
 		b.printf("*scratch |= ((uint64_t)(num_bits_%d)) << 56;\n", temp)
 	}
 
-	b.writes("}\n}\n")
+	b.writes("}\n")
+	if !g.optimizeSize {
+		b.writes("}\n")
+	}
 	return nil
 }
 
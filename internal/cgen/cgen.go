@@ -15,15 +15,20 @@
 package cgen
 
 import (
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math/big"
+	"os"
 	"sort"
 	"strings"
 
 	"github.com/google/wuffs/internal/cgen/data"
 	"github.com/google/wuffs/lang/builtin"
+	"github.com/google/wuffs/lang/diagnostic"
 	"github.com/google/wuffs/lang/generate"
 	"github.com/google/wuffs/lib/dumbindent"
 
@@ -41,9 +46,12 @@ var (
 
 	mibi = big.NewInt(1 << 20)
 
-	maxInt64 = big.NewInt((1 << 63) - 1)
+	maxInt64  = big.NewInt((1 << 63) - 1)
+	maxUint32 = big.NewInt(0xFFFFFFFF)
 
 	typeExprARMCRC32U32   = a.NewTypeExpr(0, t.IDBase, t.IDARMCRC32U32, nil, nil, nil)
+	typeExprARMSVEU8      = a.NewTypeExpr(0, t.IDBase, t.IDARMSVEU8, nil, nil, nil)
+	typeExprRISCVVU8      = a.NewTypeExpr(0, t.IDBase, t.IDRISCVVU8, nil, nil, nil)
 	typeExprPixelSwizzler = a.NewTypeExpr(0, t.IDBase, t.IDPixelSwizzler, nil, nil, nil)
 )
 
@@ -110,85 +118,411 @@ var BaseSubModules = []string{
 // The arguments list the source Wuffs files. If no arguments are given, it
 // reads from stdin.
 //
-// The generated program is written to stdout.
+// The generated program is written to stdout. If the -symbolmap flag is set,
+// a JSON map from each generated C symbol to its Wuffs declaration is also
+// written to that file. Likewise, if the -size-report flag is set, a report of
+// each generated function's size is written to that file, and if the
+// -api-json flag is set, a JSON summary of the package's public consts,
+// statuses and public field bounds is written to that file.
 func Do(args []string) error {
 	flags := flag.FlagSet{}
-	genlinenumFlag := flags.Bool("genlinenum", cf.GenlinenumDefault, cf.GenlinenumUsage)
+	return generate.DoBackend(&flags, args, newBackend(&flags))
+}
 
-	return generate.Do(&flags, args, func(pkgName string, tm *t.Map, files []*a.File) ([]byte, error) {
-		unformatted := []byte(nil)
-		if pkgName == "base" {
-			if len(files) != 0 {
-				return nil, fmt.Errorf("base package shouldn't have any .wuffs files")
-			}
-			buf := make(buffer, 0, 128*1024)
-			if err := expandBangBangInsert(&buf, data.BaseAllImplC, map[string]func(*buffer) error{
-				"// ¡ INSERT InterfaceDeclarations.\n":      insertInterfaceDeclarations,
-				"// ¡ INSERT InterfaceDefinitions.\n":       insertInterfaceDefinitions,
-				"// ¡ INSERT base/all-private.h.\n":         insertBaseAllPrivateH,
-				"// ¡ INSERT base/all-public.h.\n":          insertBaseAllPublicH,
-				"// ¡ INSERT base/copyright\n":              insertBaseCopyright,
-				"// ¡ INSERT base/floatconv-submodule.c.\n": insertBaseFloatConvSubmoduleC,
-				"// ¡ INSERT base/intconv-submodule.c.\n":   insertBaseIntConvSubmoduleC,
-				"// ¡ INSERT base/magic-submodule.c.\n":     insertBaseMagicSubmoduleC,
-				"// ¡ INSERT base/pixconv-submodule.c.\n":   insertBasePixConvSubmoduleC,
-				"// ¡ INSERT base/utf8-submodule.c.\n":      insertBaseUTF8SubmoduleC,
-				"// ¡ INSERT vtable names.\n": func(b *buffer) error {
-					for _, n := range builtin.Interfaces {
-						buf.printf("const char wuffs_base__%s__vtable_name[] = "+
-							"\"{vtable}wuffs_base__%s\";\n", n, n)
+func init() {
+	generate.Register(newBackend)
+}
+
+// backend is the generate.Backend for C. Its generated code is a single file,
+// so it has no separate Header.
+type backend struct {
+	allocatorFlag   *bool
+	apijsonFlag     *string
+	audit32Flag     *bool
+	autovecFlag     *bool
+	ctargetFlag     *string
+	genlangFlag     *string
+	genlinenumFlag  *bool
+	hdronlyFlag     *bool
+	instrumentFlag  *bool
+	optimizeFlag    *string
+	patchFlag       *string
+	sizereportFlag  *string
+	statustableFlag *bool
+	symbolmapFlag   *string
+
+	apiJSON    bytes.Buffer
+	sizeReport bytes.Buffer
+	symbolMap  []byte
+}
+
+func newBackend(flags *flag.FlagSet) generate.Backend {
+	return &backend{
+		allocatorFlag:   flags.Bool("allocator", cf.AllocatorDefault, cf.AllocatorUsage),
+		apijsonFlag:     flags.String("api-json", cf.APIJSONDefault, cf.APIJSONUsage),
+		audit32Flag:     flags.Bool("audit32", cf.Audit32Default, cf.Audit32Usage),
+		autovecFlag:     flags.Bool("autovec", cf.AutovecDefault, cf.AutovecUsage),
+		ctargetFlag:     flags.String("ctarget", cf.CTargetDefault, cf.CTargetUsage),
+		genlangFlag:     flags.String("genlang", cf.GenlangDefault, cf.GenlangUsage),
+		genlinenumFlag:  flags.Bool("genlinenum", cf.GenlinenumDefault, cf.GenlinenumUsage),
+		hdronlyFlag:     flags.Bool("hdronly", cf.HdronlyDefault, cf.HdronlyUsage),
+		instrumentFlag:  flags.Bool("instrument", cf.InstrumentDefault, cf.InstrumentUsage),
+		optimizeFlag:    flags.String("optimize", cf.OptimizeDefault, cf.OptimizeUsage),
+		patchFlag:       flags.String("patch", cf.PatchDefault, cf.PatchUsage),
+		sizereportFlag:  flags.String("size-report", cf.SizeReportDefault, cf.SizeReportUsage),
+		statustableFlag: flags.Bool("statustable", cf.StatustableDefault, cf.StatustableUsage),
+		symbolmapFlag:   flags.String("symbolmap", cf.SymbolmapDefault, cf.SymbolmapUsage),
+	}
+}
+
+func (b *backend) FileExtension() string                      { return "c" }
+func (b *backend) Header(p *generate.Package) ([]byte, error) { return nil, nil }
+
+func (b *backend) Impl(p *generate.Package) ([]byte, error) {
+	patch := []byte(nil)
+	if *b.patchFlag != "" {
+		// A missing file is like a file without markers: every function is
+		// re-generated.
+		patch = []byte{}
+		if src, err := ioutil.ReadFile(*b.patchFlag); err == nil {
+			patch = src
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	sizeReport := io.Writer(nil)
+	if *b.sizereportFlag != "" {
+		sizeReport = &b.sizeReport
+	}
+	apiJSON := io.Writer(nil)
+	if *b.apijsonFlag != "" {
+		apiJSON = &b.apiJSON
+	}
+	out, symbolMap, err := Generate(p.Name, p.TM, p.Files, &Options{
+		Allocator:   *b.allocatorFlag,
+		APIJSON:     apiJSON,
+		Audit32:     *b.audit32Flag,
+		Autovec:     *b.autovecFlag,
+		CTarget:     *b.ctargetFlag,
+		Genlang:     *b.genlangFlag,
+		Genlinenum:  *b.genlinenumFlag,
+		Hdronly:     *b.hdronlyFlag,
+		Instrument:  *b.instrumentFlag,
+		Optimize:    *b.optimizeFlag,
+		Patch:       patch,
+		ResolveUse:  generate.ResolveUse,
+		SizeReport:  sizeReport,
+		Statustable: *b.statustableFlag,
+		SymbolMap:   *b.symbolmapFlag != "",
+	})
+	b.symbolMap = symbolMap
+	return out, err
+}
+
+func (b *backend) AuxFiles(p *generate.Package) (map[string][]byte, error) {
+	m := map[string][]byte(nil)
+	if *b.symbolmapFlag != "" {
+		m = map[string][]byte{*b.symbolmapFlag: b.symbolMap}
+	}
+	if *b.sizereportFlag != "" {
+		if m == nil {
+			m = map[string][]byte{}
+		}
+		m[*b.sizereportFlag] = b.sizeReport.Bytes()
+	}
+	if *b.apijsonFlag != "" {
+		if m == nil {
+			m = map[string][]byte{}
+		}
+		m[*b.apijsonFlag] = b.apiJSON.Bytes()
+	}
+	return m, nil
+}
+
+// Options are optional arguments to Generate. A nil *Options is valid and
+// means the zero value.
+type Options struct {
+	// Allocator, Audit32, Autovec, Genlinenum, Hdronly and Instrument are
+	// the -allocator, -audit32, -autovec, -genlinenum, -hdronly and
+	// -instrument flags.
+	Allocator  bool
+	Audit32    bool
+	Autovec    bool
+	Genlinenum bool
+	Hdronly    bool
+	Instrument bool
+
+	// CTarget is the -ctarget flag: CTargetC99 (or, equivalently, ""),
+	// CTargetC89 or CTargetMSVC. See ctarget.go.
+	CTarget string
+
+	// Genlang is the -genlang flag: GenlangC (or, equivalently, "") or
+	// GenlangCpp.
+	Genlang string
+
+	// Optimize is the -optimize flag: OptimizeSpeed (or, equivalently, "")
+	// or OptimizeSize. See sizereport.go.
+	Optimize string
+
+	// Patch, if non-nil, is the previous output, for the -patch flag. Each
+	// function implementation is delimited by markers, and those functions
+	// that are unchanged since Patch are copied from it byte-for-byte. See
+	// patch.go.
+	Patch []byte
+
+	// ResolveUse, if non-nil, returns the summary of a used package, like
+	// check.Check's resolveUse argument. With Patch, each function's digest
+	// covers those summaries, so that changing a used package re-generates
+	// every function. If nil, the digests cover only the used packages' paths.
+	ResolveUse func(usePath string) ([]byte, error)
+
+	// SizeReport, if non-nil, is where to write a report of each generated
+	// function's size, as for the -size-report flag. See sizereport.go.
+	SizeReport io.Writer
+
+	// APIJSON, if non-nil, is where to write the package's public consts,
+	// statuses and public field bounds, as for the -api-json flag. See
+	// apijson.go.
+	APIJSON io.Writer
+
+	// Statustable is the -statustable flag.
+	Statustable bool
+
+	// SymbolMap is whether to also return the symbol map, as for the
+	// -symbolmap flag.
+	SymbolMap bool
+
+	// Interrupt, if non-nil, is called before each function is generated.
+	// Generation stops early if it returns a non-nil error, which Generate
+	// then returns. For example, it can return a context.Context's Err.
+	Interrupt func() error
+}
+
+// Error is a code generation error, annotated with the Wuffs statement (or, if
+// there is none, the function) being generated.
+type Error struct {
+	Err      error
+	Filename string
+	Line     uint32
+
+	// Column, if non-zero, is the 1-based byte offset within the Line of the
+	// start of that statement.
+	Column uint32
+}
+
+func (e *Error) Error() string {
+	if e.Column == 0 {
+		return fmt.Sprintf("%s at %s:%d", e.message(), e.Filename, e.Line)
+	}
+	return fmt.Sprintf("%s at %s:%d:%d", e.message(), e.Filename, e.Line, e.Column)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// message is e.Err's message, prefixed by "cgen: " if it isn't already.
+func (e *Error) message() string {
+	msg := e.Err.Error()
+	if !strings.HasPrefix(msg, "cgen: ") {
+		msg = "cgen: " + msg
+	}
+	return msg
+}
+
+// Diagnostic implements diagnostic.Diagnoser.
+func (e *Error) Diagnostic() diagnostic.Diagnostic {
+	msg := e.message()
+	return diagnostic.Diagnostic{
+		Severity: diagnostic.SeverityError,
+		Code:     diagnostic.Code(msg),
+		Message:  msg,
+		Filename: e.Filename,
+		Line:     e.Line,
+		Column:   int(e.Column),
+	}
+}
+
+// errorAt annotates err, if non-nil, with n's location, unless err has already
+// been annotated (with a more specific location).
+func errorAt(n *a.Node, err error) error {
+	if err == nil {
+		return nil
+	} else if _, ok := err.(*Error); ok {
+		return err
+	}
+	filename, line := n.AsRaw().FilenameLine()
+	return &Error{Err: err, Filename: filename, Line: line, Column: n.AsRaw().Span().Column}
+}
+
+// Generate is like Do, but its input is a checked Wuffs package, and it
+// returns the C program (and, if opts.SymbolMap, the symbol map) instead of
+// writing them out. The base package has a pkgName of "base" and no files.
+func Generate(pkgName string, tm *t.Map, files []*a.File, opts *Options) (out []byte, symbolMap []byte, err error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	switch opts.Optimize {
+	case "", OptimizeSpeed, OptimizeSize:
+		// No-op.
+	default:
+		return nil, nil, fmt.Errorf("unsupported -optimize %q", opts.Optimize)
+	}
+
+	switch opts.CTarget {
+	case "", CTargetC99, CTargetC89, CTargetMSVC:
+		// No-op.
+	default:
+		return nil, nil, fmt.Errorf("unsupported -ctarget %q", opts.CTarget)
+	}
+	hoistDecls := (opts.CTarget == CTargetC89) || (opts.CTarget == CTargetMSVC)
+
+	switch opts.Genlang {
+	case "", GenlangC:
+		// No-op.
+	case GenlangCpp:
+		if hoistDecls {
+			return nil, nil, fmt.Errorf("-ctarget is not supported for -genlang=c++")
+		} else if opts.Hdronly {
+			return nil, nil, fmt.Errorf("-hdronly is not supported for -genlang=c++")
+		} else if opts.SymbolMap {
+			return nil, nil, fmt.Errorf("-symbolmap is not supported for -genlang=c++")
+		} else if opts.Patch != nil {
+			return nil, nil, fmt.Errorf("-patch is not supported for -genlang=c++")
+		} else if opts.SizeReport != nil {
+			return nil, nil, fmt.Errorf("-size-report is not supported for -genlang=c++")
+		} else if opts.APIJSON != nil {
+			return nil, nil, fmt.Errorf("-api-json is not supported for -genlang=c++")
+		}
+		unformatted, err := generateCppAPI(pkgName, tm, files, opts.Allocator)
+		if err != nil {
+			return nil, nil, err
+		}
+		return dumbindent.FormatBytes(nil, unformatted, nil), nil, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported -genlang %q", opts.Genlang)
+	}
+
+	unformatted := []byte(nil)
+	if pkgName == "base" {
+		if len(files) != 0 {
+			return nil, nil, fmt.Errorf("base package shouldn't have any .wuffs files")
+		} else if opts.Hdronly {
+			return nil, nil, fmt.Errorf("-hdronly is not supported for the base package")
+		} else if opts.SymbolMap {
+			return nil, nil, fmt.Errorf("-symbolmap is not supported for the base package")
+		} else if opts.SizeReport != nil {
+			return nil, nil, fmt.Errorf("-size-report is not supported for the base package")
+		} else if opts.APIJSON != nil {
+			return nil, nil, fmt.Errorf("-api-json is not supported for the base package")
+		}
+		buf := make(buffer, 0, 128*1024)
+		if err := expandBangBangInsert(&buf, data.BaseAllImplC, map[string]func(*buffer) error{
+			"// ¡ INSERT InterfaceDeclarations.\n":      insertInterfaceDeclarations,
+			"// ¡ INSERT InterfaceDefinitions.\n":       insertInterfaceDefinitions,
+			"// ¡ INSERT base/all-private.h.\n":         insertBaseAllPrivateH,
+			"// ¡ INSERT base/all-public.h.\n":          insertBaseAllPublicH,
+			"// ¡ INSERT base/copyright\n":              insertBaseCopyright,
+			"// ¡ INSERT base/floatconv-submodule.c.\n": insertBaseFloatConvSubmoduleC,
+			"// ¡ INSERT base/intconv-submodule.c.\n":   insertBaseIntConvSubmoduleC,
+			"// ¡ INSERT base/magic-submodule.c.\n":     insertBaseMagicSubmoduleC,
+			"// ¡ INSERT base/pixconv-submodule.c.\n":   insertBasePixConvSubmoduleC,
+			"// ¡ INSERT base/utf8-submodule.c.\n":      insertBaseUTF8SubmoduleC,
+			"// ¡ INSERT vtable names.\n": func(b *buffer) error {
+				for _, n := range builtin.Interfaces {
+					buf.printf("const char wuffs_base__%s__vtable_name[] = "+
+						"\"{vtable}wuffs_base__%s\";\n", n, n)
+				}
+				return nil
+			},
+			"// ¡ INSERT wuffs_base__status strings.\n": func(b *buffer) error {
+				for _, z := range builtin.Statuses {
+					msg, _ := t.Unescape(z)
+					if msg == "" {
+						continue
 					}
-					return nil
-				},
-				"// ¡ INSERT wuffs_base__status strings.\n": func(b *buffer) error {
-					for _, z := range builtin.Statuses {
-						msg, _ := t.Unescape(z)
-						if msg == "" {
-							continue
-						}
-						pre := "note"
-						if msg[0] == '$' {
-							pre = "suspension"
-						} else if msg[0] == '#' {
-							pre = "error"
-						}
-						b.printf("const char wuffs_base__%s__%s[] = \"%sbase: %s\";\n",
-							pre, cName(msg, ""), msg[:1], msg[1:])
+					pre := "note"
+					if msg[0] == '$' {
+						pre = "suspension"
+					} else if msg[0] == '#' {
+						pre = "error"
 					}
-					return nil
-				},
-			}); err != nil {
-				return nil, err
-			}
-			unformatted = []byte(buf)
+					b.printf("const char wuffs_base__%s__%s[] = \"%sbase: %s\";\n",
+						pre, cName(msg, ""), msg[:1], msg[1:])
+				}
+				return nil
+			},
+		}); err != nil {
+			return nil, nil, err
+		}
+		unformatted = []byte(buf)
 
-		} else {
-			g := &gen{
-				PKGPREFIX:  "WUFFS_" + strings.ToUpper(pkgName) + "__",
-				PKGNAME:    strings.ToUpper(pkgName),
-				pkgPrefix:  "wuffs_" + pkgName + "__",
-				pkgName:    pkgName,
-				tm:         tm,
-				files:      files,
-				genlinenum: *genlinenumFlag,
-			}
-			var err error
-			unformatted, err = g.generate()
+	} else {
+		g := &gen{
+			PKGPREFIX:      "WUFFS_" + strings.ToUpper(pkgName) + "__",
+			PKGNAME:        strings.ToUpper(pkgName),
+			pkgPrefix:      "wuffs_" + pkgName + "__",
+			pkgName:        pkgName,
+			tm:             tm,
+			files:          files,
+			allocator:      opts.Allocator,
+			audit32Enabled: opts.Audit32,
+			autovec:        opts.Autovec,
+			cTarget:        opts.CTarget,
+			genlinenum:     opts.Genlinenum,
+			hdronly:        opts.Hdronly,
+			instrument:     opts.Instrument,
+			optimizeSize:   opts.Optimize == OptimizeSize,
+			patch:          opts.Patch != nil,
+			resolveUse:     opts.ResolveUse,
+			sizeReport:     opts.SizeReport != nil,
+			statustable:    opts.Statustable,
+			interrupt:      opts.Interrupt,
+		}
+		unformatted, err = g.generate()
+		if err != nil {
+			return nil, nil, err
+		}
+		if opts.SymbolMap {
+			symbolMap, err = g.genSymbolMap()
 			if err != nil {
-				return nil, err
+				return nil, nil, err
+			}
+		}
+		if opts.SizeReport != nil {
+			if err := g.writeSizeReport(opts.SizeReport); err != nil {
+				return nil, nil, err
 			}
 		}
+		if opts.APIJSON != nil {
+			if err := g.writeAPIJSON(opts.APIJSON); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
 
-		// The base package is largely hand-written C, not transpiled from
-		// Wuffs, and that part is presumably already formatted. The rest is
-		// generated by this package. We take care here to print well indented
-		// C code, so further C formatting is unnecessary.
-		if pkgName == "base" {
-			return unformatted, nil
+	// The base package is largely hand-written C, not transpiled from
+	// Wuffs, and that part is presumably already formatted. The rest is
+	// generated by this package. We take care here to print well indented
+	// C code, so further C formatting is unnecessary.
+	if pkgName == "base" {
+		if hoistDecls {
+			if unformatted, err = hoistCTargetDecls(unformatted); err != nil {
+				return nil, nil, err
+			}
 		}
+		return unformatted, nil, nil
+	}
 
-		return dumbindent.FormatBytes(nil, unformatted, nil), nil
-	})
+	out = dumbindent.FormatBytes(nil, unformatted, nil)
+	if hoistDecls {
+		if out, err = hoistCTargetDecls(out); err != nil {
+			return nil, nil, err
+		}
+	}
+	if opts.Patch != nil {
+		out = applyPatch(out, opts.Patch)
+	}
+	return out, symbolMap, nil
 }
 
 type visibility uint32
@@ -207,6 +541,7 @@ const (
 type status struct {
 	cName       string
 	msg         string
+	class       string
 	fromThisPkg bool
 	public      bool
 }
@@ -288,6 +623,7 @@ func insertBaseAllPrivateH(buf *buffer) error {
 
 func insertBaseAllPublicH(buf *buffer) error {
 	if err := expandBangBangInsert(buf, data.BaseFundamentalPublicH, map[string]func(*buffer) error{
+		"// ¡ INSERT ABI hash.\n": insertBaseABIHash,
 		"// ¡ INSERT FourCCs.\n": func(b *buffer) error {
 			for i, z := range builtin.FourCCs {
 				if i != 0 {
@@ -545,7 +881,7 @@ func parseBuiltInInterfaceMethods() error {
 	if len(builtInInterfaceMethods) != 0 {
 		return nil
 	}
-	return builtin.ParseFuncs(&builtInTokenMap, builtin.InterfaceFuncs, func(f *a.Func) error {
+	return builtin.ParseFuncs(&builtInTokenMap, nil, builtin.InterfaceFuncs, func(f *a.Func) error {
 		qid := f.Receiver()
 		builtInInterfaceMethods[qid] = append(builtInInterfaceMethods[qid], f)
 		return nil
@@ -561,12 +897,71 @@ type gen struct {
 	tm    *t.Map
 	files []*a.File
 
+	// allocator is whether to generate alloc_with functions, which take a
+	// wuffs_base__allocator. See allocator.go.
+	allocator bool
+
+	// audit32Enabled is whether to report conversions to size_t that may
+	// truncate on 32-bit targets. See audit32.go.
+	audit32Enabled bool
+	audit32Errs    []error
+	audit32Seen    map[*a.Expr]struct{}
+
+	// autovec is whether to shape the iterate loops of functions without a
+	// cpu_arch precondition for compilers' auto-vectorizers. Such loops are
+	// the portable fallbacks, such as the CRC-32 and Adler-32 hashers' up
+	// methods, that run when no SIMD version applies.
+	//
+	// It has no effect on the base package, whose portable loops are
+	// hand-written C. Those are instead shaped by defining the
+	// WUFFS_CONFIG__AUTOVEC C macro.
+	autovec bool
+
+	// cTarget is the -ctarget flag. See ctarget.go.
+	cTarget string
+
 	// genlinenum is whether to print "// foo.wuffs:123" comments in the
 	// generated C code. This can be useful for debugging, although it is not
 	// enabled by default as it can lead to many spurious changes in the
 	// generated C code (due to line numbers changing) when editing Wuffs code.
 	genlinenum bool
 
+	// hdronly is whether to generate only the public API header: the status
+	// codes, public consts, opaque struct declarations and public function
+	// prototypes. This skips generating the function implementations (and
+	// the struct definitions, which depend on them), making it much faster
+	// than a full generation. It is useful for IDE indexing or generating FFI
+	// bindings.
+	hdronly bool
+
+	// instrument is whether to call the WUFFS_BASE__INSTRUMENT__ETC hook
+	// macros on suspension, on status return and on each while loop
+	// iteration. See instrument.go.
+	instrument bool
+
+	// optimizeSize is whether to prefer smaller code to faster code. See
+	// sizereport.go.
+	optimizeSize bool
+
+	// patch is whether to delimit each function implementation by "‼ WUFFS
+	// PATCH" markers, keyed by patchDigests. See patch.go.
+	patch        bool
+	patchDigests map[string]string
+	resolveUse   func(usePath string) ([]byte, error)
+
+	// sizeReport is whether to record each function's size, in funcSizes. See
+	// sizereport.go.
+	sizeReport bool
+	funcSizes  map[string]int
+
+	// statustable is whether to pack this package's status messages into one
+	// shared string table, instead of one array per status. See
+	// statustable.go.
+	statustable bool
+
+	// interrupt, if non-nil, is polled before generating each function.
+	interrupt func() error
+
 	privateDataFields map[t.QQID]struct{}
 	scalarConstsMap   map[t.QID]*a.Const
 	statusList        []status
@@ -574,6 +969,10 @@ type gen struct {
 	structList        []*a.Struct
 	structMap         map[t.QID]*a.Struct
 
+	// initChooses are the choose statements that the initialize function
+	// runs, keyed by their choosy function. See gatherInitChooses.
+	initChooses map[t.QQID]*a.Choose
+
 	currFunk funk
 	funks    map[t.QQID]funk
 
@@ -583,6 +982,13 @@ type gen struct {
 func (g *gen) generate() ([]byte, error) {
 	b := new(buffer)
 
+	if g.patch {
+		var err error
+		if g.patchDigests, err = g.calcPatchDigests(); err != nil {
+			return nil, err
+		}
+	}
+
 	g.statusMap = map[t.QID]status{}
 	if err := g.forEachStatus(b, bothPubPri, (*gen).gatherStatuses); err != nil {
 		return nil, err
@@ -596,7 +1002,7 @@ func (g *gen) generate() ([]byte, error) {
 		if msg == "" {
 			return nil, fmt.Errorf("bad built-in status %q", z)
 		}
-		if err := g.addStatus(t.QID{t.IDBase, id}, msg, true); err != nil {
+		if err := g.addStatus(t.QID{t.IDBase, id}, msg, "", true); err != nil {
 			return nil, err
 		}
 	}
@@ -634,11 +1040,17 @@ func (g *gen) generate() ([]byte, error) {
 		}
 	}
 
-	g.funks = map[t.QQID]funk{}
-	if err := g.forEachFunc(nil, bothPubPri, (*gen).gatherFuncImpl); err != nil {
+	if err := g.gatherInitChooses(); err != nil {
 		return nil, err
 	}
 
+	g.funks = map[t.QQID]funk{}
+	if !g.hdronly {
+		if err := g.forEachFunc(nil, bothPubPri, (*gen).gatherFuncImpl); err != nil {
+			return nil, err
+		}
+	}
+
 	includeGuard := "WUFFS_INCLUDE_GUARD__" + g.PKGNAME
 	b.printf("#ifndef %s\n#define %s\n\n", includeGuard, includeGuard)
 
@@ -648,18 +1060,27 @@ func (g *gen) generate() ([]byte, error) {
 
 	b.writes("// ¡ WUFFS MONOLITHIC RELEASE DISCARDS EVERYTHING ABOVE.\n\n")
 
-	if err := g.genHeader(b); err != nil {
-		return nil, err
-	}
-	b.writex(wiStartImpl)
-	if err := g.genImpl(b); err != nil {
-		return nil, err
+	if g.hdronly {
+		if err := g.genHeaderPrototypes(b); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := g.genHeader(b); err != nil {
+			return nil, err
+		}
+		b.writex(wiStartImpl)
+		if err := g.genImpl(b); err != nil {
+			return nil, err
+		}
+		b.writex(wiEnd)
 	}
-	b.writex(wiEnd)
 
 	b.writes("// ¡ WUFFS MONOLITHIC RELEASE DISCARDS EVERYTHING BELOW.\n\n")
 
 	b.printf("#endif  // %s\n\n", includeGuard)
+	if err := g.audit32Err(); err != nil {
+		return nil, err
+	}
 	return *b, nil
 }
 
@@ -707,28 +1128,48 @@ func (g *gen) genIncludes(b *buffer) error {
 }
 
 func (g *gen) genHeader(b *buffer) error {
+	if err := g.genHeaderPrototypes(b); err != nil {
+		return err
+	}
+	return g.genHeaderStructDefinitions(b)
+}
+
+// genHeaderPrototypes writes the public API: everything in the header other
+// than the struct definitions.
+func (g *gen) genHeaderPrototypes(b *buffer) error {
 	b.writes("\n")
+	g.writeABIChecks(b)
+
 	b.writes("// ---------------- Status Codes\n\n")
 
-	wroteStatus := false
-	for _, z := range g.statusList {
-		if !z.fromThisPkg || !z.public {
-			continue
+	if g.statustable {
+		g.writeStatusTablePrototypes(b)
+	} else {
+		wroteStatus := false
+		for _, z := range g.statusList {
+			if !z.fromThisPkg || !z.public {
+				continue
+			}
+			b.printf("extern const char %s[];\n", z.cName)
+			wroteStatus = true
+		}
+		if wroteStatus {
+			b.writes("\n")
 		}
-		b.printf("extern const char %s[];\n", z.cName)
-		wroteStatus = true
-	}
-	if wroteStatus {
-		b.writes("\n")
 	}
 
 	b.writes("// ---------------- Public Consts\n\n")
 	if err := g.forEachConst(b, pubOnly, (*gen).writeConst); err != nil {
 		return err
 	}
+	g.writeFeatures(b)
 
 	b.writes("// ---------------- Struct Declarations\n\n")
+	b.writes(ownershipLegend)
 	for _, n := range g.structList {
+		if n.Public() {
+			g.writeOwnership(b, n)
+		}
 		structName := n.QID().Str(g.tm)
 		b.printf("typedef struct %s%s__struct %s%s;\n\n", g.pkgPrefix, structName, g.pkgPrefix, structName)
 	}
@@ -756,6 +1197,9 @@ func (g *gen) genHeader(b *buffer) error {
 	b.writes("// wuffs_foo__bar__initialize, but the caller is responsible for eventually\n")
 	b.writes("// calling free on the returned pointer. That pointer is effectively a C++\n")
 	b.writes("// std::unique_ptr<T, decltype(&free)>.\n\n")
+	if g.allocator {
+		g.writeAllocWithComment(b)
+	}
 
 	for _, n := range g.structList {
 		if !n.Public() {
@@ -774,6 +1218,11 @@ func (g *gen) genHeader(b *buffer) error {
 			b.printf("return (%s*)(%s%s__alloc());\n", iName, g.pkgPrefix, structName)
 			b.printf("}\n\n")
 		}
+		if g.allocator {
+			if err := g.writeAllocWithPrototypes(b, n); err != nil {
+				return err
+			}
+		}
 	}
 
 	b.writes("// ---------------- Upcasts\n\n")
@@ -794,9 +1243,27 @@ func (g *gen) genHeader(b *buffer) error {
 	if err := g.forEachFunc(b, pubOnly, (*gen).writeFuncPrototype); err != nil {
 		return err
 	}
+	g.writeStatusMappings(b, false)
+	g.writeStatusEnumPrototypes(b)
+	g.writeMetadataVisitors(b, false)
+	g.writeMetadataReaders(b, false)
+	if err := g.writeProbes(b, false); err != nil {
+		return err
+	}
+	g.writeSeekFrames(b, false)
+	if err := g.writeTokenBatches(b, false); err != nil {
+		return err
+	}
+	g.writeTelemetryAccessors(b, false)
+	if err := g.writePubFieldGetters(b, false); err != nil {
+		return err
+	}
 
 	b.writes("#ifdef __cplusplus\n}  // extern \"C\"\n#endif\n\n")
+	return nil
+}
 
+func (g *gen) genHeaderStructDefinitions(b *buffer) error {
 	b.writes("// ---------------- Struct Definitions\n\n")
 	b.writes("// These structs' fields, and the sizeof them, are private implementation\n")
 	b.writes("// details that aren't guaranteed to be stable across Wuffs versions.\n")
@@ -820,22 +1287,46 @@ func (g *gen) genImpl(b *buffer) error {
 
 	b.writes("// ---------------- Status Codes Implementations\n\n")
 
-	wroteStatus := false
-	for _, z := range g.statusList {
-		if !z.fromThisPkg || z.msg == "" {
-			continue
+	if g.statustable {
+		g.writeStatusTableImpl(b)
+	} else {
+		wroteStatus := false
+		for _, z := range g.statusList {
+			if !z.fromThisPkg || z.msg == "" {
+				continue
+			}
+			b.printf("const char %s[] = \"%s%s: %s\";\n", z.cName, z.msg[:1], g.pkgName, z.msg[1:])
+			wroteStatus = true
+		}
+		if wroteStatus {
+			b.writes("\n")
 		}
-		b.printf("const char %s[] = \"%s%s: %s\";\n", z.cName, z.msg[:1], g.pkgName, z.msg[1:])
-		wroteStatus = true
 	}
-	if wroteStatus {
-		b.writes("\n")
+	g.writeStatusMappings(b, true)
+	g.writeStatusEnumImpl(b)
+
+	// Any CPU-architecture-specific functions can be split out into separate
+	// files (see "wuffs-c genrelease -multifile"), and those files also need
+	// the private consts.
+	hasCPUArchFuncs := false
+	if err := g.forEachFunc(nil, bothPubPri, func(g *gen, b *buffer, n *a.Func) error {
+		_, caName, _, err := cpuArchCNames(n.Asserts())
+		hasCPUArchFuncs = hasCPUArchFuncs || (caName != "")
+		return err
+	}); err != nil {
+		return err
 	}
 
+	if hasCPUArchFuncs {
+		b.writes("// ‼ WUFFS MULTI-FILE SECTION +shared\n")
+	}
 	b.writes("// ---------------- Private Consts\n\n")
 	if err := g.forEachConst(b, priOnly, (*gen).writeConst); err != nil {
 		return err
 	}
+	if hasCPUArchFuncs {
+		b.writes("// ‼ WUFFS MULTI-FILE SECTION -shared\n\n")
+	}
 
 	b.writes("// ---------------- Private Initializer Prototypes\n\n")
 	for _, n := range g.structList {
@@ -869,6 +1360,19 @@ func (g *gen) genImpl(b *buffer) error {
 	if err := g.forEachFunc(b, bothPubPri, (*gen).writeFuncImpl); err != nil {
 		return err
 	}
+	g.writeMetadataVisitors(b, true)
+	g.writeMetadataReaders(b, true)
+	if err := g.writeProbes(b, true); err != nil {
+		return err
+	}
+	g.writeSeekFrames(b, true)
+	if err := g.writeTokenBatches(b, true); err != nil {
+		return err
+	}
+	g.writeTelemetryAccessors(b, true)
+	if err := g.writePubFieldGetters(b, true); err != nil {
+		return err
+	}
 
 	b.printf("#endif  // %s\n\n", module)
 	return nil
@@ -974,11 +1478,30 @@ func uintBits(qid t.QID) uint32 {
 	return 0
 }
 
+func sintBits(qid t.QID) uint32 {
+	if qid[0] == t.IDBase {
+		switch qid[1] {
+		case t.IDI8:
+			return 8
+		case t.IDI16:
+			return 16
+		case t.IDI32:
+			return 32
+		case t.IDI64:
+			return 64
+		}
+	}
+	return 0
+}
+
 func (g *gen) sizeof(typ *a.TypeExpr) (uint32, error) {
 	if typ.Decorator() == 0 {
 		if n := uintBits(typ.QID()); n != 0 {
 			return n / 8, nil
 		}
+		if n := sintBits(typ.QID()); n != 0 {
+			return n / 8, nil
+		}
 	}
 	return 0, fmt.Errorf("unknown sizeof for %q", typ.Str(g.tm))
 }
@@ -989,10 +1512,14 @@ func (g *gen) gatherStatuses(b *buffer, n *a.Status) error {
 	if !ok || msg == "" {
 		return fmt.Errorf("bad status message %q", raw)
 	}
-	return g.addStatus(n.QID(), msg, n.Public())
+	class := ""
+	if n.Class() != 0 {
+		class = n.Class().Str(g.tm)
+	}
+	return g.addStatus(n.QID(), msg, class, n.Public())
 }
 
-func (g *gen) addStatus(qid t.QID, msg string, public bool) error {
+func (g *gen) addStatus(qid t.QID, msg string, class string, public bool) error {
 	category := "note__"
 	if msg[0] == '$' {
 		category = "suspension__"
@@ -1002,6 +1529,7 @@ func (g *gen) addStatus(qid t.QID, msg string, public bool) error {
 	z := status{
 		cName:       g.packagePrefix(qid) + category + cName(msg, ""),
 		msg:         msg,
+		class:       class,
 		fromThisPkg: qid[0] == 0,
 		public:      public,
 	}
@@ -1010,6 +1538,200 @@ func (g *gen) addStatus(qid t.QID, msg string, public bool) error {
 	return nil
 }
 
+// classifiedStatuses returns this package's statuses that have a class, which
+// the status mapping functions map.
+func (g *gen) classifiedStatuses() []status {
+	ret := []status(nil)
+	for _, z := range g.statusList {
+		if z.fromThisPkg && (z.class != "") {
+			ret = append(ret, z)
+		}
+	}
+	return ret
+}
+
+// statusMappings are the status mapping functions, named "pkg__status_name".
+var statusMappings = [...]struct {
+	name string
+	doc  string
+	val  func(i int) string
+}{
+	{"http_code", "HTTP response status code", func(i int) string {
+		return fmt.Sprint(builtin.StatusClasses[i].HTTPCode)
+	}},
+	{"errno", "errno value", func(i int) string {
+		return builtin.StatusClasses[i].Errno
+	}},
+}
+
+// writeStatusMappings writes the declarations (or, if impl, the definitions) of
+// the functions that map this package's classified error statuses to suggested
+// HTTP response status codes and errno values. It writes nothing if no status
+// has a class.
+func (g *gen) writeStatusMappings(b *buffer, impl bool) {
+	classes := map[string]int{}
+	for i, z := range builtin.StatusClasses {
+		classes[z.Name] = i
+	}
+	classified := g.classifiedStatuses()
+	if len(classified) == 0 {
+		return
+	}
+
+	b.writes("#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)\n\n")
+	for _, m := range statusMappings {
+		if !impl {
+			b.printf("// %sstatus_%s returns a suggested %s\n"+
+				"// (or 0) for one of this package's error statuses.\n", g.pkgPrefix, m.name, m.doc)
+		}
+		b.printf("WUFFS_BASE__MAYBE_STATIC int32_t  //\n%sstatus_%s(const char* repr)", g.pkgPrefix, m.name)
+		if !impl {
+			b.writes(";\n\n")
+			continue
+		}
+		b.writes(" {\n")
+		for _, z := range classified {
+			b.printf("if (repr == %s) {\nreturn %s;\n}\n", z.cName, m.val(classes[z.class]))
+		}
+		b.writes("return 0;\n}\n\n")
+	}
+	b.writes("#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)\n\n")
+}
+
+// tellMeMoreFunc returns the public struct n's public tell_me_more method, or
+// nil if it has no such method.
+func (g *gen) tellMeMoreFunc(n *a.Struct) *a.Func {
+	id := g.tm.ByName("tell_me_more")
+	if (id == 0) || !n.Public() {
+		return nil
+	}
+	qid := n.QID()
+	if f := g.findAstFunc(t.QQID{qid[0], qid[1], id}); (f != nil) && f.Public() {
+		return f
+	}
+	return nil
+}
+
+// writeMetadataVisitors writes the declarations (or, if impl, the definitions)
+// of the visit_metadata functions, one per struct with a tell_me_more method.
+// Each one alternates calling tell_me_more and passing the reported metadata's
+// bytes, in chunks, to a wuffs_base__metadata_chunk_func callback.
+func (g *gen) writeMetadataVisitors(b *buffer, impl bool) {
+	wroteHeading := false
+	for _, n := range g.structList {
+		f := g.tellMeMoreFunc(n)
+		if f == nil {
+			continue
+		}
+		if !impl && !wroteHeading {
+			wroteHeading = true
+			b.writes("// ---------------- Metadata Visitors\n\n")
+			b.writes("// wuffs_foo__bar__visit_metadata passes the metadata that\n")
+			b.writes("// wuffs_foo__bar__tell_me_more reports, such as an ICC profile or XMP, to\n")
+			b.writes("// callback in chunks, as the metadata is decoded. Call it after a decode\n")
+			b.writes("// method returns a \"@metadata reported\" note, with a minfo that starts as\n")
+			b.writes("// wuffs_base__empty_more_information(). It returns OK once that metadata is\n")
+			b.writes("// exhausted. Like tell_me_more, it can also return a suspension status (such\n")
+			b.writes("// as \"$short read\") and, after the caller addresses it (such as by\n")
+			b.writes("// re-filling src or, for \"$mispositioned read\", seeking to the minfo's I/O\n")
+			b.writes("// position), it should be called again with the same minfo.\n\n")
+		}
+
+		structName := n.QID().Str(g.tm)
+		b.printf("WUFFS_BASE__MAYBE_STATIC wuffs_base__status\n"+
+			"%s%s__visit_metadata(\n"+
+			"    %s%s* self,\n"+
+			"    wuffs_base__io_buffer* a_dst,\n"+
+			"    wuffs_base__more_information* a_minfo,\n"+
+			"    wuffs_base__io_buffer* a_src,\n"+
+			"    wuffs_base__metadata_chunk_func a_callback,\n"+
+			"    void* a_context)", g.pkgPrefix, structName, g.pkgPrefix, structName)
+		if !impl {
+			b.writes(";\n\n")
+			continue
+		}
+		b.writes(" {\n")
+		b.writes("if (!a_minfo) {\nreturn wuffs_base__make_status(wuffs_base__error__bad_argument);\n}\n")
+		b.writes("while (true) {\n")
+		b.writes("wuffs_base__status status = wuffs_base__more_information__deliver_metadata(\n" +
+			"a_minfo, a_src, a_callback, a_context);\n")
+		b.writes("if (status.repr) {\nreturn status;\n}\n")
+		b.printf("status = %s(self, a_dst, a_minfo, a_src);\n", g.funcCName(f))
+		b.writes("if (status.repr != wuffs_base__suspension__even_more_information) {\nreturn status;\n}\n")
+		b.writes("}\n}\n\n")
+	}
+}
+
+// probeFunc returns the public struct n's probe method, or nil if it has no
+// such method. The checker ensures that there is at most one.
+func (g *gen) probeFunc(n *a.Struct) *a.Func {
+	if !n.Public() {
+		return nil
+	}
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KFunc {
+				continue
+			}
+			if f := tld.AsFunc(); f.Probe() && (f.Receiver() == n.QID()) {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// writeProbes writes the declarations (or, if impl, the definitions) of the
+// probe functions, one per struct with a probe method. Each one calls that
+// method and, once it completes, the workbuf_len method.
+func (g *gen) writeProbes(b *buffer, impl bool) error {
+	wroteHeading := false
+	for _, n := range g.structList {
+		f := g.probeFunc(n)
+		if f == nil {
+			continue
+		}
+		if !impl && !wroteHeading {
+			wroteHeading = true
+			b.writes("// ---------------- Probes\n\n")
+			b.writes("// wuffs_foo__bar__probe is the first pass of a two-pass decode. It calls the\n")
+			b.writes("// header-only method (the Wuffs code's \"probe\" method, such as\n")
+			b.writes("// decode_image_config) that needs no workbuf. Once that returns OK, it also\n")
+			b.writes("// sets *a_workbuf_len (if a_workbuf_len is non-NULL) to the workbuf_len, so\n")
+			b.writes("// that the caller can allocate the workbuf for the second pass. Like that\n")
+			b.writes("// method, it can return a suspension status (such as \"$short read\") and,\n")
+			b.writes("// after the caller addresses it, it should be called again.\n\n")
+		}
+
+		structName := n.QID().Str(g.tm)
+		b.printf("WUFFS_BASE__MAYBE_STATIC wuffs_base__status\n"+
+			"%s%s__probe(\n"+
+			"    %s%s* self", g.pkgPrefix, structName, g.pkgPrefix, structName)
+		for _, o := range f.In().Fields() {
+			o := o.AsField()
+			b.writes(",\n    ")
+			if err := g.writeCTypeName(b, o.XType(), aPrefix, o.Name().Str(g.tm)); err != nil {
+				return err
+			}
+		}
+		b.writes(",\n    wuffs_base__range_ii_u64* a_workbuf_len)")
+		if !impl {
+			b.writes(";\n\n")
+			continue
+		}
+		b.writes(" {\n")
+		b.printf("wuffs_base__status status = %s(self", g.funcCName(f))
+		for _, o := range f.In().Fields() {
+			b.printf(", %s%s", aPrefix, o.AsField().Name().Str(g.tm))
+		}
+		b.writes(");\n")
+		b.writes("if (!status.repr && a_workbuf_len) {\n")
+		b.printf("*a_workbuf_len = %s%s__workbuf_len(self);\n", g.pkgPrefix, structName)
+		b.writes("}\nreturn status;\n}\n\n")
+	}
+	return nil
+}
+
 func (g *gen) gatherScalarConsts(b *buffer, n *a.Const) error {
 	if cv := n.Value().ConstValue(); cv != nil {
 		g.scalarConstsMap[n.QID()] = n
@@ -1034,6 +1756,28 @@ func (g *gen) writeConst(b *buffer, n *a.Const) error {
 	return nil
 }
 
+// writeFeatures writes a macro for each of the package's features, so that C
+// code can check for them with "#ifdef".
+func (g *gen) writeFeatures(b *buffer) {
+	wrote := false
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KFeature {
+				continue
+			}
+			if !wrote {
+				b.writes("// ---------------- Features\n\n")
+				wrote = true
+			}
+			b.printf("#define %sFEATURE__%s 1\n", g.PKGPREFIX,
+				strings.ToUpper(tld.AsFeature().QID()[1].Str(g.tm)))
+		}
+	}
+	if wrote {
+		b.writes("\n")
+	}
+}
+
 func (g *gen) writeConstList(b *buffer, n *a.Expr) error {
 	if args, ok := n.IsList(); ok {
 		b.writeb('{')
@@ -1056,9 +1800,6 @@ func (g *gen) writeConstList(b *buffer, n *a.Expr) error {
 }
 
 func (g *gen) writeStructPrivateImpl(b *buffer, n *a.Struct) error {
-	// TODO: allow max depth > 1 for recursive coroutines.
-	const maxDepth = 1
-
 	b.writes("// Do not access the private_impl's or private_data's fields directly. There\n")
 	b.writes("// is no API/ABI compatibility or safety guarantee if you do so. Instead, use\n")
 	b.writes("// the wuffs_foo__bar__baz functions.\n")
@@ -1076,6 +1817,23 @@ func (g *gen) writeStructPrivateImpl(b *buffer, n *a.Struct) error {
 				qid[0].Str(g.tm), qid[1].Str(g.tm))
 		}
 		b.writes("wuffs_base__vtable null_vtable;\n")
+		if g.hasTelemetry(n) {
+			b.writes("#if defined(WUFFS_CONFIG__TELEMETRY)\n")
+			b.writes("wuffs_base__telemetry telemetry;\n")
+			b.writes("#endif  // defined(WUFFS_CONFIG__TELEMETRY)\n")
+		}
+		if g.seekableFunc(n) != nil {
+			b.writes("wuffs_base__slice_u64 frame_io_positions;\n")
+		}
+		if len(g.tokenBatchFuncs(n)) > 0 {
+			b.writes("uint64_t tokens_needed;\n")
+		}
+		if g.hasChoosy(n) {
+			b.writes("uint32_t avoid_cpu_arch;\n")
+		}
+		if has, _ := g.workbufLessMode(n); has {
+			b.writes("bool workbuf_less;\n")
+		}
 		b.writes("\n")
 	}
 
@@ -1110,7 +1868,7 @@ func (g *gen) writeStructPrivateImpl(b *buffer, n *a.Struct) error {
 						needEmptyLine = false
 						b.writeb('\n')
 					}
-					b.printf("uint32_t %s%s[%d];\n", pPrefix, o.FuncName().Str(g.tm), maxDepth)
+					b.printf("uint32_t %s%s[%d];\n", pPrefix, o.FuncName().Str(g.tm), g.coroMaxDepth(o))
 
 				} else if o.Choosy() {
 					if needEmptyLine {
@@ -1175,7 +1933,7 @@ func (g *gen) writeStructPrivateImpl(b *buffer, n *a.Struct) error {
 					b.writes("uint64_t scratch;\n")
 				}
 				if oldInnerLenB1 != len(*b) {
-					b.printf("} %s%s[%d];\n", sPrefix, o.FuncName().Str(g.tm), maxDepth)
+					b.printf("} %s%s[%d];\n", sPrefix, o.FuncName().Str(g.tm), g.coroMaxDepth(o))
 				} else {
 					*b = (*b)[:oldInnerLenB0]
 					needEmptyLine = oldNeedEmptyLine
@@ -1196,7 +1954,11 @@ func (g *gen) writeStructPrivateImpl(b *buffer, n *a.Struct) error {
 func (g *gen) writeStruct(b *buffer, n *a.Struct) error {
 	structName := n.QID().Str(g.tm)
 	fullStructName := g.pkgPrefix + structName + "__struct"
-	b.printf("struct %s {\n", fullStructName)
+	if n.Public() {
+		b.printf("struct WUFFS_BASE__CAPABILITY %s {\n", fullStructName)
+	} else {
+		b.printf("struct %s {\n", fullStructName)
+	}
 
 	if err := g.writeStructPrivateImpl(b, n); err != nil {
 		return err
@@ -1233,6 +1995,9 @@ func (g *gen) writeCppMethods(b *buffer, n *a.Struct) error {
 			iName, g.pkgPrefix, structName, iName)
 		b.printf("}\n")
 	}
+	if g.allocator {
+		g.writeCppAllocWithMethods(b, n)
+	}
 	b.writes("#endif  // defined(WUFFS_BASE__HAVE_UNIQUE_PTR)\n\n")
 
 	b.writes("#if defined(WUFFS_BASE__HAVE_EQ_DELETE) && !defined(WUFFS_IMPLEMENTATION)\n")
@@ -1293,7 +2058,7 @@ func (g *gen) writeCppMethods(b *buffer, n *a.Struct) error {
 			if err := g.writeFuncSignature(b, f, wfsCppDecl); err != nil {
 				return err
 			}
-			b.writes(" {\n    return ")
+			b.printf(" %s(this) {\n    return ", threadSafetyRequires(f))
 			b.writes(g.funcCName(f))
 			b.writes("(this")
 			for _, o := range f.In().Fields() {
@@ -1305,6 +2070,81 @@ func (g *gen) writeCppMethods(b *buffer, n *a.Struct) error {
 		}
 	}
 
+	if g.tellMeMoreFunc(n) != nil {
+		b.writes("  inline wuffs_base__status\n" +
+			"  visit_metadata(\n" +
+			"      wuffs_base__io_buffer* a_dst,\n" +
+			"      wuffs_base__more_information* a_minfo,\n" +
+			"      wuffs_base__io_buffer* a_src,\n" +
+			"      wuffs_base__metadata_chunk_func a_callback,\n" +
+			"      void* a_context) {\n")
+		b.printf("    return %s%s__visit_metadata(\n"+
+			"this, a_dst, a_minfo, a_src, a_callback, a_context);\n  }\n\n", g.pkgPrefix, structName)
+
+		b.writes("  inline wuffs_base__status\n" +
+			"  read_metadata_chunk(\n" +
+			"      wuffs_base__io_buffer* a_dst,\n" +
+			"      wuffs_base__metadata_reader* a_reader,\n" +
+			"      wuffs_base__io_buffer* a_src) {\n")
+		b.printf("    return %s%s__read_metadata_chunk(\n"+
+			"this, a_dst, a_reader, a_src);\n  }\n\n", g.pkgPrefix, structName)
+	}
+
+	if g.hasTelemetry(n) {
+		b.writes("  inline wuffs_base__telemetry\n  telemetry() const {\n")
+		b.printf("    return %s%s__telemetry(this);\n  }\n\n", g.pkgPrefix, structName)
+	}
+
+	if err := g.writeCppPubFieldGetters(b, n); err != nil {
+		return err
+	}
+
+	if f := g.probeFunc(n); f != nil {
+		b.writes("  inline wuffs_base__status\n  probe(")
+		for _, o := range f.In().Fields() {
+			o := o.AsField()
+			b.writes("\n      ")
+			if err := g.writeCTypeName(b, o.XType(), aPrefix, o.Name().Str(g.tm)); err != nil {
+				return err
+			}
+			b.writes(",")
+		}
+		b.writes("\n      wuffs_base__range_ii_u64* a_workbuf_len) {\n")
+		b.printf("    return %s%s__probe(\nthis", g.pkgPrefix, structName)
+		for _, o := range f.In().Fields() {
+			b.printf(", %s%s", aPrefix, o.AsField().Name().Str(g.tm))
+		}
+		b.writes(", a_workbuf_len);\n  }\n\n")
+	}
+
+	if g.seekableFunc(n) != nil {
+		b.writes("  inline wuffs_base__empty_struct\n" +
+			"  set_frame_io_positions(\n      wuffs_base__slice_u64 a_table) {\n")
+		b.printf("    return %s%s__set_frame_io_positions(this, a_table);\n  }\n\n", g.pkgPrefix, structName)
+		b.writes("  inline wuffs_base__status\n" +
+			"  seek_frame(\n      uint64_t a_index,\n      uint64_t* a_io_position) {\n")
+		b.printf("    return %s%s__seek_frame(this, a_index, a_io_position);\n  }\n\n", g.pkgPrefix, structName)
+	}
+
+	for _, f := range g.tokenBatchFuncs(n) {
+		funcName := f.FuncName().Str(g.tm)
+		b.printf("  inline wuffs_base__status\n  %s_batch(", funcName)
+		for _, o := range f.In().Fields() {
+			o := o.AsField()
+			b.writes("\n      ")
+			if err := g.writeCTypeName(b, o.XType(), aPrefix, o.Name().Str(g.tm)); err != nil {
+				return err
+			}
+			b.writes(",")
+		}
+		b.writes("\n      uint64_t* a_tokens_needed) {\n")
+		b.printf("    return %s%s__%s_batch(\nthis", g.pkgPrefix, structName, funcName)
+		for _, o := range f.In().Fields() {
+			b.printf(", %s%s", aPrefix, o.AsField().Name().Str(g.tm))
+		}
+		b.writes(", a_tokens_needed);\n  }\n\n")
+	}
+
 	b.writes("#endif  // __cplusplus\n")
 	return nil
 }
@@ -1350,7 +2190,7 @@ func (g *gen) writeVTableImpl(b *buffer, n *a.Struct) error {
 
 func (g *gen) writeInitializerSignature(b *buffer, n *a.Struct, public bool) error {
 	structName := n.QID().Str(g.tm)
-	b.printf("wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT\n"+
+	b.printf("WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT\n"+
 		"%s%s__initialize(\n"+
 		"    %s%s* self,\n"+
 		"    size_t sizeof_star_self,\n"+
@@ -1362,13 +2202,13 @@ func (g *gen) writeInitializerSignature(b *buffer, n *a.Struct, public bool) err
 
 func (g *gen) writeAllocSignature(b *buffer, n *a.Struct) error {
 	structName := n.QID().Str(g.tm)
-	b.printf("%s%s*\n%s%s__alloc()", g.pkgPrefix, structName, g.pkgPrefix, structName)
+	b.printf("WUFFS_BASE__MAYBE_STATIC %s%s*\n%s%s__alloc()", g.pkgPrefix, structName, g.pkgPrefix, structName)
 	return nil
 }
 
 func (g *gen) writeSizeofSignature(b *buffer, n *a.Struct) error {
 	structName := n.QID().Str(g.tm)
-	b.printf("size_t\nsizeof__%s%s()", g.pkgPrefix, structName)
+	b.printf("WUFFS_BASE__MAYBE_STATIC size_t\nsizeof__%s%s()", g.pkgPrefix, structName)
 	return nil
 }
 
@@ -1432,8 +2272,13 @@ func (g *gen) writeInitializerImpl(b *buffer, n *a.Struct) error {
 	b.writes("  }\n")
 	b.writes("}\n\n")
 
+	g.writeWorkbufLessInit(b, n)
+
 	// Initialize any choosy function pointers.
-	hasChoosy := false
+	hasChoosy := g.hasChoosy(n)
+	if hasChoosy {
+		b.writes("self->private_impl.avoid_cpu_arch = options & WUFFS_INITIALIZE__AVOID_CPU_ARCH;\n")
+	}
 	for _, file := range g.files {
 		for _, tld := range file.TopLevelDecls() {
 			if tld.Kind() != a.KFunc {
@@ -1443,9 +2288,13 @@ func (g *gen) writeInitializerImpl(b *buffer, n *a.Struct) error {
 			if (o.Receiver() != n.QID()) || !o.Choosy() {
 				continue
 			}
-			hasChoosy = true
 			b.printf("self->private_impl.choosy_%s = &%s__choosy_default;\n",
 				o.FuncName().Str(g.tm), g.funcCName(o))
+			if c := g.initChooses[o.QQID()]; c != nil {
+				if err := g.writeChoose(b, n.QID(), c); err != nil {
+					return err
+				}
+			}
 		}
 	}
 	if hasChoosy {
@@ -1501,15 +2350,22 @@ func (g *gen) writeInitializerImpl(b *buffer, n *a.Struct) error {
 			return err
 		}
 		b.writes(" {\n")
-		b.printf("%s%s* x =\n(%s%s*)(calloc(sizeof(%s%s), 1));\n",
-			g.pkgPrefix, structName, g.pkgPrefix, structName, g.pkgPrefix, structName)
-		b.writes("if (!x) {\nreturn NULL;\n}\n")
-		b.printf("if (%s%s__initialize(\nx, sizeof(%s%s), "+
-			"WUFFS_VERSION, WUFFS_INITIALIZE__ALREADY_ZEROED).repr) {\n",
-			g.pkgPrefix, structName, g.pkgPrefix, structName)
-		b.writes("free(x);\nreturn NULL;\n}\n")
-		b.writes("return x;\n")
-		b.writes("}\n\n")
+		if g.allocator {
+			b.printf("return %s%s__alloc_with(NULL);\n}\n\n", g.pkgPrefix, structName)
+			if err := g.writeAllocWithImpl(b, n); err != nil {
+				return err
+			}
+		} else {
+			b.printf("%s%s* x =\n(%s%s*)(calloc(sizeof(%s%s), 1));\n",
+				g.pkgPrefix, structName, g.pkgPrefix, structName, g.pkgPrefix, structName)
+			b.writes("if (!x) {\nreturn NULL;\n}\n")
+			b.printf("if (%s%s__initialize(\nx, sizeof(%s%s), "+
+				"WUFFS_VERSION, WUFFS_INITIALIZE__ALREADY_ZEROED).repr) {\n",
+				g.pkgPrefix, structName, g.pkgPrefix, structName)
+			b.writes("free(x);\nreturn NULL;\n}\n")
+			b.writes("return x;\n")
+			b.writes("}\n\n")
+		}
 
 		if err := g.writeSizeofSignature(b, n); err != nil {
 			return err
@@ -0,0 +1,185 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/generate"
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// checkSource parses and checks src, a single file package named "test".
+func checkSource(tt *testing.T, src string, resolveUse func(usePath string) ([]byte, error)) (*t.Map, []*a.File) {
+	tt.Helper()
+	const filename = "test.wuffs"
+	src = strings.TrimSpace(src) + "\n"
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	file, err := parse.Parse(tm, filename, tokens, nil)
+	if err != nil {
+		tt.Fatalf("Parse: %v", err)
+	}
+	files := []*a.File{file}
+	if _, err := check.Check(tm, files, resolveUse, nil); err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	return tm, files
+}
+
+// generateSource checks src, a single file package named "test", and returns
+// its generated C code.
+func generateSource(tt *testing.T, src string, resolveUse func(usePath string) ([]byte, error), opts *Options) []byte {
+	tt.Helper()
+	tm, files := checkSource(tt, src, resolveUse)
+	out, _, err := Generate("test", tm, files, opts)
+	if err != nil {
+		tt.Fatalf("Generate: %v", err)
+	}
+	return out
+}
+
+// stdFilenames returns the source files of the std/pkgName Wuffs package.
+func stdFilenames(tt *testing.T, pkgName string) []string {
+	tt.Helper()
+	filenames, err := filepath.Glob(filepath.Join("..", "..", "std", pkgName, "*.wuffs"))
+	if err != nil {
+		tt.Fatalf("Glob: %v", err)
+	} else if len(filenames) == 0 {
+		tt.Fatalf("no std/%s files", pkgName)
+	}
+	return filenames
+}
+
+// resolveStdUse is like generate.ResolveUse, but it summarizes the used std
+// package's source files instead of reading "wuffs gen"'s summary.
+func resolveStdUse(tt *testing.T) func(usePath string) ([]byte, error) {
+	return func(usePath string) ([]byte, error) {
+		pkgName := strings.TrimSuffix(strings.TrimPrefix(usePath, "std/"), ".wuffs")
+		tm := &t.Map{}
+		files, err := generate.ParseFiles(tm, stdFilenames(tt, pkgName), &parse.Options{
+			AllowDoubleUnderscoreNames: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return generate.Summarize(tm, files)
+	}
+}
+
+// generateStd checks the std/pkgName Wuffs package and returns its generated C
+// code and symbol map.
+func generateStd(tt *testing.T, pkgName string, opts *Options) (out []byte, symbolMap []byte) {
+	tt.Helper()
+	tm := &t.Map{}
+	files, err := generate.ParseFiles(tm, stdFilenames(tt, pkgName), nil)
+	if err != nil {
+		tt.Fatalf("ParseFiles: %v", err)
+	}
+	if _, err := check.Check(tm, files, resolveStdUse(tt), nil); err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	out, symbolMap, err = Generate(pkgName, tm, files, opts)
+	if err != nil {
+		tt.Fatalf("Generate: %v", err)
+	}
+	return out, symbolMap
+}
+
+func TestHdronly(tt *testing.T) {
+	full, _ := generateStd(tt, "gif", nil)
+	hdr, _ := generateStd(tt, "gif", &Options{Hdronly: true})
+
+	for _, unwanted := range []string{
+		"#ifdef WUFFS_IMPLEMENTATION",
+		"#endif  // WUFFS_IMPLEMENTATION",
+		"// ---------------- Struct Definitions",
+		"// ---------------- Function Implementations",
+	} {
+		if strings.Contains(string(hdr), unwanted) {
+			tt.Errorf("-hdronly output contains %q", unwanted)
+		}
+	}
+
+	// Every public function declared by the full output's header is also
+	// declared by the -hdronly output.
+	i := bytes.Index(full, []byte("\n#ifdef WUFFS_IMPLEMENTATION\n"))
+	if i < 0 {
+		tt.Fatalf("full output has no WUFFS_IMPLEMENTATION section")
+	}
+	matches := publicFuncRegexp.FindAllSubmatch(full[:i], -1)
+	if len(matches) == 0 {
+		tt.Fatalf("full output declares no public functions")
+	}
+	for _, m := range matches {
+		if decl := m[0]; !bytes.Contains(hdr, decl) {
+			tt.Errorf("-hdronly output does not declare %q", m[1])
+		}
+	}
+}
+
+func TestScalableVectorSliceLanes(tt *testing.T) {
+	const src = `
+pri struct foo?(
+	dummy : base.u8,
+)
+
+pri func foo.up_arm_sve!(x: slice base.u8),
+	choose cpu_arch >= arm_sve,
+{
+	var util : base.arm_sve_utility
+	var v    : base.arm_sve_u8
+	v = util.make_u8_slicevl(a: args.x)
+	v.store_slicevl!(a: args.x)
+}
+
+pri func foo.up_riscv_v!(x: slice base.u8),
+	choose cpu_arch >= riscv_v,
+{
+	var util : base.riscv_v_utility
+	var v    : base.riscv_v_u8
+	v = util.make_u8_slicevl(a: args.x)
+	v.store_slicevl!(a: args.x)
+}
+`
+	out := string(generateSource(tt, src, nil, nil))
+
+	// RVV's vsetvl can return fewer than VLMAX lanes for an AVL (application
+	// vector length) between VLMAX and twice that, so the slice length is
+	// clamped to VLMAX.
+	for _, want := range []string{
+		"svld1_u8(svwhilelt_b8_u64(0, ((uint64_t)(a_x.len))), a_x.ptr)",
+		"svst1_u8(svwhilelt_b8_u64(0, ((uint64_t)(a_x.len))), a_x.ptr, v_v)",
+		"__riscv_vle8_v_u8m1(a_x.ptr, __riscv_vsetvl_e8m1(" +
+			"wuffs_base__u64__min(((uint64_t)(a_x.len)), __riscv_vsetvlmax_e8m1())))",
+		"__riscv_vse8_v_u8m1(a_x.ptr, v_v, __riscv_vsetvl_e8m1(" +
+			"wuffs_base__u64__min(((uint64_t)(a_x.len)), __riscv_vsetvlmax_e8m1())))",
+	} {
+		if !strings.Contains(out, want) {
+			tt.Errorf("output does not contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with the -genlang=c++ flag. By default, the generated C code
+// gives each public struct some inline C++ methods (see writeCppMethods) that
+// forward on "this", but the struct is still a C struct: it is heap allocated
+// by hand and its methods return a plain wuffs_base__status. With the flag,
+// wuffs-c instead generates a separate C++ header, to be #include'd after the
+// C code, that wraps each public struct in a move-only RAII class in a
+// "wuffs::foo" namespace. Its methods return a [[nodiscard]] wuffs::result,
+// which throws a wuffs::error (for error statuses) if WUFFS_CPP__USE_EXCEPTIONS
+// is #define'd, and slice arguments also accept a C++20 std::span. With the
+// -allocator flag, each class's constructor also takes an optional
+// wuffs_base__allocator (see allocator.go).
+
+import (
+	"fmt"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Genlang flag values.
+const (
+	GenlangC   = "c"
+	GenlangCpp = "c++"
+)
+
+// generateCppAPI returns the -genlang=c++ header. For the base package, that
+// is only the wuffs::result and wuffs::error types that every other package's
+// header also contains (once-only guarded).
+func generateCppAPI(pkgName string, tm *t.Map, files []*a.File, allocator bool) ([]byte, error) {
+	b := new(buffer)
+	guard := "WUFFS_INCLUDE_GUARD__CPP__" + strings.ToUpper(pkgName)
+	b.printf("#ifndef %s\n#define %s\n\n", guard, guard)
+	b.writes("// Code generated by wuffs-c -genlang=c++. DO NOT EDIT.\n\n")
+	b.printf("// This C++ header wraps the C API of the Wuffs %q package. It does not\n", pkgName)
+	b.writes("// contain that C code, which (e.g. wuffs-unsupported-snapshot.c) must be\n")
+	b.writes("// #include'd first.\n\n")
+	b.writes("#ifndef __cplusplus\n#error \"This Wuffs header requires C++\"\n#endif\n\n")
+	b.writes(cppAPIBase)
+
+	if pkgName != "base" {
+		g := &gen{
+			pkgPrefix: "wuffs_" + pkgName + "__",
+			pkgName:   pkgName,
+			tm:        tm,
+			files:     files,
+			allocator: allocator,
+		}
+		b.printf("\nnamespace wuffs {\nnamespace %s {\n", pkgName)
+		for _, file := range files {
+			for _, tld := range file.TopLevelDecls() {
+				if tld.Kind() != a.KStruct {
+					continue
+				}
+				if n := tld.AsStruct(); n.Public() && n.Classy() {
+					if err := g.writeCppClass(b, n); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+		b.printf("\n}  // namespace %s\n}  // namespace wuffs\n", pkgName)
+	}
+
+	b.printf("\n#endif  // %s\n", guard)
+	return []byte(*b), nil
+}
+
+// writeCppClass writes the RAII class that wraps the n public struct.
+func (g *gen) writeCppClass(b *buffer, n *a.Struct) error {
+	structName := n.QID().Str(g.tm)
+	cName := g.pkgPrefix + structName
+
+	b.printf("\n// %s owns a heap allocated, initialized %s.\n", structName, cName)
+	b.printf("class %s {\npublic:\n", structName)
+	b.writes("// On allocation failure, valid() is false or, if\n")
+	b.writes("// WUFFS_CPP__USE_EXCEPTIONS is #define'd, std::bad_alloc is thrown.\n")
+	if g.allocator {
+		b.writes("// A nullptr allocator means the default, malloc and free.\n")
+		b.printf("%s() : %s(nullptr) {}\n\n", structName, structName)
+		b.printf("explicit %s(const wuffs_base__allocator* allocator)\n", structName)
+		b.printf(": m_ptr(%s__alloc_with(allocator),\n"+
+			"wuffs_base__allocator__deleter(allocator)) {\n", cName)
+	} else {
+		b.printf("%s() : m_ptr(%s__alloc(), &free) {\n", structName, cName)
+	}
+	b.writes("#if defined(WUFFS_CPP__USE_EXCEPTIONS)\n")
+	b.writes("if (!m_ptr) {\nthrow std::bad_alloc();\n}\n")
+	b.writes("#endif  // defined(WUFFS_CPP__USE_EXCEPTIONS)\n")
+	b.writes("}\n\n")
+	b.printf("%s(%s&&) = default;\n", structName, structName)
+	b.printf("%s& operator=(%s&&) = default;\n\n", structName, structName)
+
+	b.writes("bool valid() const {\nreturn m_ptr != nullptr;\n}\n\n")
+	b.printf("%s* c_ptr() {\nreturn m_ptr.get();\n}\n\n", cName)
+	b.printf("const %s* c_ptr() const {\nreturn m_ptr.get();\n}\n\n", cName)
+
+	for _, impl := range n.Implements() {
+		iQID := impl.AsTypeExpr().QID()
+		iName := fmt.Sprintf("wuffs_%s__%s", iQID[0].Str(g.tm), iQID[1].Str(g.tm))
+		b.printf("%s* upcast_as__%s() {\n", iName, iName)
+		b.printf("return %s__upcast_as__%s(m_ptr.get());\n}\n\n", cName, iName)
+	}
+
+	structID := n.QID()[1]
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if (tld.Kind() != a.KFunc) || !tld.AsFunc().Public() {
+				continue
+			}
+			f := tld.AsFunc()
+			if f.QQID()[1] != structID {
+				continue
+			}
+			if err := g.writeCppClassMethod(b, f, false); err != nil {
+				return err
+			}
+			b.writes("\n")
+			if cppHasSliceArg(f) {
+				b.writes("#if defined(WUFFS_CPP__HAVE_SPAN)\n")
+				if err := g.writeCppClassMethod(b, f, true); err != nil {
+					return err
+				}
+				b.writes("#endif  // defined(WUFFS_CPP__HAVE_SPAN)\n\n")
+			}
+		}
+	}
+
+	for _, o := range pubFields(n) {
+		if err := g.writeCTypeName(b, o.XType(), "", ""); err != nil {
+			return err
+		}
+		b.printf("\nget_%s() const {\n", o.Name().Str(g.tm))
+		b.printf("return %s__get_%s(m_ptr.get());\n}\n\n", cName, o.Name().Str(g.tm))
+	}
+
+	if g.seekableFunc(n) != nil {
+		b.writes("void\nset_frame_io_positions(wuffs_base__slice_u64 a_table) {\n")
+		b.printf("%s__set_frame_io_positions(m_ptr.get(), a_table);\n}\n\n", cName)
+		b.writes("result\nseek_frame(uint64_t a_index, uint64_t* a_io_position) {\n")
+		b.printf("return result(%s__seek_frame(m_ptr.get(), a_index, a_io_position));\n}\n\n", cName)
+	}
+
+	for _, f := range g.tokenBatchFuncs(n) {
+		b.printf("result\n%s_batch(", f.FuncName().Str(g.tm))
+		for _, o := range f.In().Fields() {
+			o := o.AsField()
+			if err := g.writeCTypeName(b, o.XType(), aPrefix, o.Name().Str(g.tm)); err != nil {
+				return err
+			}
+			b.writes(", ")
+		}
+		b.printf("uint64_t* a_tokens_needed) {\nreturn result(%s_batch(m_ptr.get()", g.funcCName(f))
+		for _, o := range f.In().Fields() {
+			b.printf(", %s%s", aPrefix, o.AsField().Name().Str(g.tm))
+		}
+		b.writes(", a_tokens_needed));\n}\n\n")
+	}
+
+	if g.allocator {
+		b.printf("private:\nstd::unique_ptr<%s, wuffs_base__allocator__deleter> m_ptr;\n", cName)
+	} else {
+		b.printf("private:\nstd::unique_ptr<%s, decltype(&free)> m_ptr;\n", cName)
+	}
+	b.printf("};  // class %s\n", structName)
+	return nil
+}
+
+// writeCppClassMethod writes a class method that forwards to the C function
+// f. If span is true, its slice arguments are std::span's instead.
+func (g *gen) writeCppClassMethod(b *buffer, f *a.Func, span bool) error {
+	retResult, retVoid := f.Effect().Coroutine(), false
+	if retResult {
+		b.writes("result")
+	} else if out := f.Out(); out == nil {
+		b.writes("void")
+		retVoid = true
+	} else if out.IsStatus() {
+		b.writes("result")
+		retResult = true
+	} else if err := g.writeCTypeName(b, out, "", ""); err != nil {
+		return err
+	}
+
+	b.printf("\n%s(", f.FuncName().Str(g.tm))
+	for i, o := range f.In().Fields() {
+		if i > 0 {
+			b.writes(", ")
+		}
+		o := o.AsField()
+		if span && o.XType().IsSliceType() {
+			b.printf("std::span<uint8_t> %s%s", aPrefix, o.Name().Str(g.tm))
+		} else if err := g.writeCTypeName(b, o.XType(), aPrefix, o.Name().Str(g.tm)); err != nil {
+			return err
+		}
+	}
+	b.writes(")")
+	if f.Effect().Pure() {
+		b.writes(" const")
+	}
+	b.writes(" {\n")
+
+	if retResult {
+		b.writes("return result(")
+	} else if !retVoid {
+		b.writes("return ")
+	}
+	b.printf("%s(m_ptr.get()", g.funcCName(f))
+	for _, o := range f.In().Fields() {
+		o := o.AsField()
+		name := aPrefix + o.Name().Str(g.tm)
+		if span && o.XType().IsSliceType() {
+			b.printf(", wuffs_base__make_slice_u8(%s.data(), %s.size())", name, name)
+		} else {
+			b.printf(", %s", name)
+		}
+	}
+	if retResult {
+		b.writes(")")
+	}
+	b.writes(");\n}\n")
+	return nil
+}
+
+func cppHasSliceArg(f *a.Func) bool {
+	for _, o := range f.In().Fields() {
+		if o.AsField().XType().IsSliceType() {
+			return true
+		}
+	}
+	return false
+}
+
+// cppAPIBase is the part of the -genlang=c++ header that is shared by every
+// package.
+const cppAPIBase = `#ifndef WUFFS_INCLUDE_GUARD__CPP__BASE_TYPES
+#define WUFFS_INCLUDE_GUARD__CPP__BASE_TYPES
+
+#include <cstdlib>
+#include <memory>
+
+#if defined(WUFFS_CPP__USE_EXCEPTIONS)
+#include <new>
+#include <stdexcept>
+#endif  // defined(WUFFS_CPP__USE_EXCEPTIONS)
+
+#if defined(__has_include)
+#if __has_include(<span>) && (__cplusplus >= 202002L)
+#include <span>
+#define WUFFS_CPP__HAVE_SPAN
+#endif
+#endif
+
+#if __cplusplus >= 201703L
+#define WUFFS_CPP__NODISCARD [[nodiscard]]
+#else
+#define WUFFS_CPP__NODISCARD
+#endif
+
+namespace wuffs {
+
+#if defined(WUFFS_CPP__USE_EXCEPTIONS)
+// error is thrown, instead of a result being returned, for error statuses.
+class error : public std::runtime_error {
+ public:
+  explicit error(wuffs_base__status status) : std::runtime_error(status.repr), m_status(status) {}
+
+  wuffs_base__status status() const { return m_status; }
+
+ private:
+  wuffs_base__status m_status;
+};
+#endif  // defined(WUFFS_CPP__USE_EXCEPTIONS)
+
+// result wraps the wuffs_base__status returned by a method. Ignoring it is a
+// compiler warning (in C++17 or later), as it can be a suspension that asks
+// the caller to provide more input or output.
+class WUFFS_CPP__NODISCARD result {
+ public:
+  explicit result(wuffs_base__status status) : m_status(status) {
+#if defined(WUFFS_CPP__USE_EXCEPTIONS)
+    if (wuffs_base__status__is_error(&m_status)) {
+      throw error(m_status);
+    }
+#endif  // defined(WUFFS_CPP__USE_EXCEPTIONS)
+  }
+
+  bool is_complete() const { return wuffs_base__status__is_complete(&m_status); }
+  bool is_error() const { return wuffs_base__status__is_error(&m_status); }
+  bool is_note() const { return wuffs_base__status__is_note(&m_status); }
+  bool is_ok() const { return wuffs_base__status__is_ok(&m_status); }
+  bool is_suspension() const {
+    return wuffs_base__status__is_suspension(&m_status);
+  }
+
+  // message returns nullptr for an ok status.
+  const char* message() const { return wuffs_base__status__message(&m_status); }
+
+  wuffs_base__status status() const { return m_status; }
+
+  explicit operator bool() const { return is_ok(); }
+
+ private:
+  wuffs_base__status m_status;
+};
+
+}  // namespace wuffs
+
+#endif  // WUFFS_INCLUDE_GUARD__CPP__BASE_TYPES
+`
@@ -0,0 +1,247 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with the -ctarget flag. The default, CTargetC99, generates
+// C99 code. CTargetC89 and CTargetMSVC post-process that code for older
+// compilers (such as MSVC before Visual Studio 2013) that only accept
+// declarations at the start of a block, and whose C dialect spells inline
+// differently:
+//
+//   - A declaration that follows a statement, in the same block, starts a
+//     new nested block, closed at the end of the enclosing block. Gotos and
+//     case labels (such as coroutine suspension points) can jump into that
+//     nested block, as they could jump past the declaration before.
+//   - "static inline" becomes "static WUFFS_BASE__INLINE".
+//
+// It applies to the whole output, including the base package's hand-written
+// C. The generated code has no variable length arrays in either mode.
+//
+// The result compiles cleanly with GCC's -std=gnu89 (which, unlike -std=c89,
+// allows // comments, which are everywhere) and -Wdeclaration-after-statement.
+// The build-all.sh script checks that.
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// CTarget flag values.
+const (
+	CTargetC99  = "c99"
+	CTargetC89  = "c89"
+	CTargetMSVC = "msvc"
+)
+
+// cTargetDeclRegexp matches a line (with leading whitespace trimmed) that
+// starts a variable declaration, such as "uint32_t v_x = 0;" or
+// "const uint8_t* p;". It only recognizes the types that Wuffs uses.
+var cTargetDeclRegexp = regexp.MustCompile(`^(static\s+)?(const\s+)?` +
+	`(bool|char|int|unsigned|unsigned\s+int|long|double|float|size_t|uintptr_t|u?int(8|16|32|64)_t|wuffs_[a-z0-9_]+)` +
+	`(\s+const)?[\s*]+(const\s+)?[A-Za-z_][A-Za-z0-9_]*(\[[^\]]*\])*\s*(=.*|;|,.*)$`)
+
+// cTargetPPCond is an open (unclosed) preprocessor conditional, such as
+// "#if". Each of its branches starts with the same state: that of the
+// innermost brace, when the "#if" occurred.
+type cTargetPPCond struct {
+	numFrames     int
+	seenStatement bool
+	anyStatement  bool
+}
+
+// cTargetFrame is an open (unclosed) curly brace.
+type cTargetFrame struct {
+	// code is whether the braces contain statements (such as a function body)
+	// instead of e.g. struct fields or an array's initializer.
+	code bool
+	// seenStatement is whether a statement has occurred in this block.
+	seenStatement bool
+	// synthetic is whether the brace was added by hoistCTargetDecls.
+	synthetic bool
+}
+
+// hoistCTargetDecls applies the -ctarget=c89 transformations to src, C code
+// with one statement or declaration per line (or more than one line).
+func hoistCTargetDecls(src []byte) ([]byte, error) {
+	dst := make([]byte, 0, len(src)+len(src)/16)
+	frames := []cTargetFrame(nil)
+	ppConds := []cTargetPPCond(nil)
+	inBlockComment := false
+	inPreprocessor := false
+
+	for lineNum := 1; len(src) > 0; lineNum++ {
+		line := src
+		if i := bytes.IndexByte(src, '\n'); i >= 0 {
+			line, src = src[:i+1], src[i+1:]
+		} else {
+			src = nil
+		}
+		trimmed := bytes.TrimSpace(line)
+
+		// Preprocessor directives, including their "\\" continuation lines,
+		// are copied verbatim. Their braces (e.g. in a multi-line #define)
+		// are not counted.
+		if inPreprocessor || (!inBlockComment && (len(trimmed) > 0) && (trimmed[0] == '#')) {
+			if !inPreprocessor {
+				ppConds = cTargetPreprocess(ppConds, frames, trimmed)
+			}
+			inPreprocessor = bytes.HasSuffix(trimmed, []byte("\\"))
+			dst = append(dst, line...)
+			continue
+		}
+
+		if !inBlockComment && (len(trimmed) > 0) && !bytes.HasPrefix(trimmed, []byte("//")) &&
+			(len(frames) > 0) && frames[len(frames)-1].code && (trimmed[0] != '}') {
+			top := &frames[len(frames)-1]
+			if !cTargetDeclRegexp.Match(trimmed) {
+				top.seenStatement = true
+			} else if top.seenStatement &&
+				((len(ppConds) == 0) || (ppConds[len(ppConds)-1].numFrames < len(frames))) {
+				// The new brace can only be closed (at the end of the
+				// innermost brace) in the same preprocessor branch if the
+				// innermost brace was opened in it.
+				dst = append(dst, "{\n"...)
+				frames = append(frames, cTargetFrame{code: true, synthetic: true})
+			}
+		}
+
+		// Scan for braces, skipping comments and string and char literals.
+		lineStart := len(dst)
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			if inBlockComment {
+				if (c == '*') && (i+1 < len(line)) && (line[i+1] == '/') {
+					inBlockComment = false
+					dst = append(dst, '*')
+					i++
+					c = '/'
+				}
+				dst = append(dst, c)
+				continue
+			}
+			switch c {
+			case '/':
+				if i+1 < len(line) {
+					if line[i+1] == '/' {
+						dst = append(dst, line[i:]...)
+						i = len(line)
+						continue
+					} else if line[i+1] == '*' {
+						inBlockComment = true
+						dst = append(dst, '/', '*')
+						i++
+						continue
+					}
+				}
+			case '"', '\'':
+				j := i + 1
+				for ; (j < len(line)) && (line[j] != c); j++ {
+					if line[j] == '\\' {
+						j++
+					}
+				}
+				if j >= len(line) {
+					return nil, fmt.Errorf("ctarget: unterminated literal at line %d", lineNum)
+				}
+				dst = append(dst, line[i:j+1]...)
+				i = j
+				continue
+			case '{':
+				parentCode := (len(frames) > 0) && frames[len(frames)-1].code
+				frames = append(frames, cTargetFrame{
+					code: cTargetIsCodeBrace(dst[lineStart:], parentCode),
+				})
+			case '}':
+				for (len(frames) > 0) && frames[len(frames)-1].synthetic {
+					frames = frames[:len(frames)-1]
+					dst = append(dst, "} "...)
+				}
+				if len(frames) == 0 {
+					return nil, fmt.Errorf("ctarget: unbalanced '}' at line %d", lineNum)
+				}
+				frames = frames[:len(frames)-1]
+			}
+			dst = append(dst, c)
+		}
+	}
+
+	if len(frames) != 0 {
+		return nil, fmt.Errorf("ctarget: unbalanced '{'")
+	}
+	return bytes.Replace(dst, []byte("static inline "), []byte("static WUFFS_BASE__INLINE "), -1), nil
+}
+
+// cTargetPreprocess updates ppConds for the preprocessor directive line.
+func cTargetPreprocess(ppConds []cTargetPPCond, frames []cTargetFrame, line []byte) []cTargetPPCond {
+	line = bytes.TrimSpace(line[1:])
+	seen := (len(frames) > 0) && frames[len(frames)-1].seenStatement
+	restore := func(c *cTargetPPCond) {
+		c.anyStatement = c.anyStatement || seen
+		if (len(frames) > 0) && (len(frames) == c.numFrames) {
+			frames[len(frames)-1].seenStatement = c.seenStatement
+		}
+	}
+
+	switch {
+	case bytes.HasPrefix(line, []byte("if")):
+		return append(ppConds, cTargetPPCond{
+			numFrames:     len(frames),
+			seenStatement: seen,
+		})
+	case bytes.HasPrefix(line, []byte("el")):
+		if len(ppConds) > 0 {
+			restore(&ppConds[len(ppConds)-1])
+		}
+	case bytes.HasPrefix(line, []byte("endif")):
+		if len(ppConds) > 0 {
+			c := &ppConds[len(ppConds)-1]
+			restore(c)
+			if (len(frames) > 0) && (len(frames) == c.numFrames) {
+				frames[len(frames)-1].seenStatement = c.anyStatement
+			}
+			return ppConds[:len(ppConds)-1]
+		}
+	}
+	return ppConds
+}
+
+// cTargetIsCodeBrace returns whether a '{', preceded on its line by prefix,
+// opens a block of statements.
+func cTargetIsCodeBrace(prefix []byte, parentCode bool) bool {
+	prefix = bytes.TrimSpace(prefix)
+	if i := bytes.LastIndexByte(prefix, '}'); i >= 0 {
+		prefix = bytes.TrimSpace(prefix[i+1:])
+	}
+	switch {
+	case len(prefix) == 0:
+		return parentCode
+	case bytes.HasSuffix(prefix, []byte("=")),
+		bytes.HasPrefix(prefix, []byte("struct")),
+		bytes.HasPrefix(prefix, []byte("typedef")),
+		bytes.HasPrefix(prefix, []byte("union")),
+		bytes.HasPrefix(prefix, []byte("enum")),
+		bytes.HasPrefix(prefix, []byte("class")),
+		bytes.HasPrefix(prefix, []byte("namespace")),
+		bytes.HasPrefix(prefix, []byte("extern")):
+		return false
+	}
+	for _, s := range [...]string{")", "else", "do", "const", "override", "noexcept"} {
+		if bytes.HasSuffix(prefix, []byte(s)) {
+			return true
+		}
+	}
+	return parentCode
+}
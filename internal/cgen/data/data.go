@@ -17,9 +17,9 @@
 package data
 
 const BaseAllImplC = "" +
-	"#ifndef WUFFS_INCLUDE_GUARD__BASE\n#define WUFFS_INCLUDE_GUARD__BASE\n\n#if defined(WUFFS_IMPLEMENTATION) && !defined(WUFFS_CONFIG__MODULES)\n#define WUFFS_CONFIG__MODULES\n#define WUFFS_CONFIG__MODULE__BASE\n#endif\n\n// ¡ WUFFS MONOLITHIC RELEASE DISCARDS EVERYTHING ABOVE.\n\n// ¡ INSERT base/copyright\n\n#include <stdbool.h>\n#include <stdint.h>\n#include <stdlib.h>\n#include <string.h>\n\n// Note that Clang also defines __GNUC__.\n#ifdef __cplusplus\n#if (__cplusplus >= 201103L) || defined(_MSC_VER)\n#include <memory>\n#define WUFFS_BASE__HAVE_EQ_DELETE\n#define WUFFS_BASE__HAVE_UNIQUE_PTR\n#elif defined(__GNUC__)\n#warning \"Wuffs' C++ code expects -std=c++11 or later\"\n#endif\n\nextern \"C\" {\n#endif\n\n// ¡ INSERT base/all-public.h.\n\n// ¡ INSERT InterfaceDeclarations.\n\n" +
+	"#ifndef WUFFS_INCLUDE_GUARD__BASE\n#define WUFFS_INCLUDE_GUARD__BASE\n\n#if defined(WUFFS_IMPLEMENTATION) && !defined(WUFFS_CONFIG__MODULES)\n#define WUFFS_CONFIG__MODULES\n#define WUFFS_CONFIG__MODULE__BASE\n#endif\n\n// ¡ WUFFS MONOLITHIC RELEASE DISCARDS EVERYTHING ABOVE.\n\n// ¡ INSERT base/copyright\n\n#include <stdbool.h>\n#include <stddef.h>\n#include <stdint.h>\n#include <stdlib.h>\n#include <string.h>\n\n// Note that Clang also defines __GNUC__.\n#ifdef __cplusplus\n#if (__cplusplus >= 201103L) || defined(_MSC_VER)\n#include <memory>\n#define WUFFS_BASE__HAVE_EQ_DELETE\n#define WUFFS_BASE__HAVE_UNIQUE_PTR\n#elif defined(__GNUC__)\n#warning \"Wuffs' C++ code expects -std=c++11 or later\"\n#endif\n\nextern \"C\" {\n#endif\n\n// ¡ INSERT base/all-public.h.\n\n// ¡ INSERT InterfaceDeclarations.\n\n" +
 	"" +
-	"// ----------------\n\n#ifdef __cplusplus\n}  // extern \"C\"\n#endif\n\n// ‼ WUFFS C HEADER ENDS HERE.\n#ifdef WUFFS_IMPLEMENTATION\n\n#ifdef __cplusplus\nextern \"C\" {\n#endif\n\n// ¡ INSERT base/all-private.h.\n\n" +
+	"// ----------------\n\n#ifdef __cplusplus\n}  // extern \"C\"\n#endif\n\n// ‼ WUFFS C HEADER ENDS HERE.\n#ifdef WUFFS_IMPLEMENTATION\n\n#ifdef __cplusplus\nextern \"C\" {\n#endif\n\n// ‼ WUFFS MULTI-FILE SECTION +shared\n// ¡ INSERT base/all-private.h.\n// ‼ WUFFS MULTI-FILE SECTION -shared\n\n" +
 	"" +
 	"// ----------------\n\n#if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__BASE) || \\\n    defined(WUFFS_CONFIG__MODULE__BASE__CORE)\n\nconst uint8_t wuffs_base__low_bits_mask__u8[8] = {\n    0x00, 0x01, 0x03, 0x07, 0x0F, 0x1F, 0x3F, 0x7F,\n};\n\nconst uint16_t wuffs_base__low_bits_mask__u16[16] = {\n    0x0000, 0x0001, 0x0003, 0x0007, 0x000F, 0x001F, 0x003F, 0x007F,\n    0x00FF, 0x01FF, 0x03FF, 0x07FF, 0x0FFF, 0x1FFF, 0x3FFF, 0x7FFF,\n};\n\nconst uint32_t wuffs_base__low_bits_mask__u32[32] = {\n    0x00000000, 0x00000001, 0x00000003, 0x00000007, 0x0000000F, 0x0000001F,\n    0x0000003F, 0x0000007F, 0x000000FF, 0x000001FF, 0x000003FF, 0x000007FF,\n    0x00000FFF, 0x00001FFF, 0x00003FFF, 0x00007FFF, 0x0000FFFF, 0x0001FFFF,\n    0x0003FFFF, 0x0007FFFF, 0x000FFFFF, 0x001FFFFF, 0x003FFFFF, 0x007FFFFF,\n    0x00FFFFFF, 0x01FFFFFF, 0x03FFFFFF, 0x07FFFFFF, 0x0FFFFFFF, 0x1FFFFFFF,\n    0x3FFFFFFF, 0x7FFFFFFF,\n};\n\nconst uint64_t wuffs_base__low_bits_mask__u64[64] = {\n    0x0000000000000000, 0x0000000000000001, 0x000000000" +
 	"0000003,\n    0x0000000000000007, 0x000000000000000F, 0x000000000000001F,\n    0x000000000000003F, 0x000000000000007F, 0x00000000000000FF,\n    0x00000000000001FF, 0x00000000000003FF, 0x00000000000007FF,\n    0x0000000000000FFF, 0x0000000000001FFF, 0x0000000000003FFF,\n    0x0000000000007FFF, 0x000000000000FFFF, 0x000000000001FFFF,\n    0x000000000003FFFF, 0x000000000007FFFF, 0x00000000000FFFFF,\n    0x00000000001FFFFF, 0x00000000003FFFFF, 0x00000000007FFFFF,\n    0x0000000000FFFFFF, 0x0000000001FFFFFF, 0x0000000003FFFFFF,\n    0x0000000007FFFFFF, 0x000000000FFFFFFF, 0x000000001FFFFFFF,\n    0x000000003FFFFFFF, 0x000000007FFFFFFF, 0x00000000FFFFFFFF,\n    0x00000001FFFFFFFF, 0x00000003FFFFFFFF, 0x00000007FFFFFFFF,\n    0x0000000FFFFFFFFF, 0x0000001FFFFFFFFF, 0x0000003FFFFFFFFF,\n    0x0000007FFFFFFFFF, 0x000000FFFFFFFFFF, 0x000001FFFFFFFFFF,\n    0x000003FFFFFFFFFF, 0x000007FFFFFFFFFF, 0x00000FFFFFFFFFFF,\n    0x00001FFFFFFFFFFF, 0x00003FFFFFFFFFFF, 0x00007FFFFFFFFFFF,\n    0x0000FFFFFFFFFFFF, 0x0001FFFFFFFFFFFF, 0x0003FFFFF" +
@@ -31,7 +31,8 @@ const BaseAllImplC = "" +
 const BaseFundamentalPrivateH = "" +
 	"// ---------------- Fundamentals\n\n// WUFFS_BASE__MAGIC is a magic number to check that initializers are called.\n// It's not foolproof, given C doesn't automatically zero memory before use,\n// but it should catch 99.99% of cases.\n//\n// Its (non-zero) value is arbitrary, based on md5sum(\"wuffs\").\n#define WUFFS_BASE__MAGIC ((uint32_t)0x3CCB6C71)\n\n// WUFFS_BASE__DISABLED is a magic number to indicate that a non-recoverable\n// error was previously encountered.\n//\n// Its (non-zero) value is arbitrary, based on md5sum(\"disabled\").\n#define WUFFS_BASE__DISABLED ((uint32_t)0x075AE3D2)\n\n// Denote intentional fallthroughs for -Wimplicit-fallthrough.\n//\n// The order matters here. Clang also defines \"__GNUC__\".\n#if defined(__clang__) && defined(__cplusplus) && (__cplusplus >= 201103L)\n#define WUFFS_BASE__FALLTHROUGH [[clang::fallthrough]]\n#elif !defined(__clang__) && defined(__GNUC__) && (__GNUC__ >= 7)\n#define WUFFS_BASE__FALLTHROUGH __attribute__((fallthrough))\n#else\n#define WUFFS_BASE__FALLTHROUGH\n#endif\n\n// Use switch " +
 	"cases for coroutine suspension points, similar to the technique\n// in https://www.chiark.greenend.org.uk/~sgtatham/coroutines.html\n//\n// We use trivial macros instead of an explicit assignment and case statement\n// so that clang-format doesn't get confused by the unusual \"case\"s.\n#define WUFFS_BASE__COROUTINE_SUSPENSION_POINT_0 case 0:;\n#define WUFFS_BASE__COROUTINE_SUSPENSION_POINT(n) \\\n  coro_susp_point = n;                            \\\n  WUFFS_BASE__FALLTHROUGH;                        \\\n  case n:;\n\n#define WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(n) \\\n  if (!status.repr) {                                           \\\n    goto ok;                                                    \\\n  } else if (*status.repr != '$') {                             \\\n    goto exit;                                                  \\\n  }                                                             \\\n  coro_susp_point = n;                                          \\\n  goto suspend;                                        " +
-	"         \\\n  case n:;\n\n// Clang also defines \"__GNUC__\".\n#if defined(__GNUC__)\n#define WUFFS_BASE__LIKELY(expr) (__builtin_expect(!!(expr), 1))\n#define WUFFS_BASE__UNLIKELY(expr) (__builtin_expect(!!(expr), 0))\n#else\n#define WUFFS_BASE__LIKELY(expr) (expr)\n#define WUFFS_BASE__UNLIKELY(expr) (expr)\n#endif\n\n" +
+	"         \\\n  case n:;\n\n// Clang also defines \"__GNUC__\".\n#if defined(__GNUC__)\n#define WUFFS_BASE__LIKELY(expr) (__builtin_expect(!!(expr), 1))\n#define WUFFS_BASE__UNLIKELY(expr) (__builtin_expect(!!(expr), 0))\n#else\n#define WUFFS_BASE__LIKELY(expr) (expr)\n#define WUFFS_BASE__UNLIKELY(expr) (expr)\n#endif\n\n// WUFFS_BASE__TELEMETRY__BEGIN and WUFFS_BASE__TELEMETRY__END bracket each\n// public coroutine method call, given the total I/O positions of its io_reader\n// and io_writer arguments. Unless WUFFS_CONFIG__TELEMETRY is defined, they\n// expand to nothing, so that telemetry costs nothing.\n#if defined(WUFFS_CONFIG__TELEMETRY)\n#define WUFFS_BASE__TELEMETRY__BEGIN(consumed, produced) \\\n  uint64_t telemetry_consumed = (consumed);              \\\n  uint64_t telemetry_produced = (produced);\n#define WUFFS_BASE__TELEMETRY__END(t, consumed, produced, status) \\\n  wuffs_base__telemetry__record(t, (consumed)-telemetry_consumed, \\\n                                (produced)-telemetry_produced, status);\n#else\n#define WUFFS_BAS" +
+	"E__TELEMETRY__BEGIN(consumed, produced)\n#define WUFFS_BASE__TELEMETRY__END(t, consumed, produced, status)\n#endif  // defined(WUFFS_CONFIG__TELEMETRY)\n\nstatic inline void  //\nwuffs_base__telemetry__record(wuffs_base__telemetry* t,\n                              uint64_t consumed,\n                              uint64_t produced,\n                              const wuffs_base__status* status) {\n  t->bytes_consumed += consumed;\n  t->bytes_produced += produced;\n  if (wuffs_base__status__is_suspension(status)) {\n    t->suspensions++;\n  } else if (wuffs_base__status__is_error(status)) {\n    t->errors++;\n  }\n}\n\n" +
 	"" +
 	"// --------\n\nstatic inline wuffs_base__empty_struct  //\nwuffs_base__ignore_status(wuffs_base__status z) {\n  return wuffs_base__make_empty_struct();\n}\n\nstatic inline wuffs_base__status  //\nwuffs_base__status__ensure_not_a_suspension(wuffs_base__status z) {\n  if (z.repr && (*z.repr == '$')) {\n    z.repr = wuffs_base__error__cannot_return_a_suspension;\n  }\n  return z;\n}\n\n" +
 	"" +
@@ -42,6 +43,9 @@ const BaseFundamentalPrivateH = "" +
 	"" +
 	"// --------\n\nstatic inline void  //\nwuffs_base__u8__sat_add_indirect(uint8_t* x, uint8_t y) {\n  *x = wuffs_base__u8__sat_add(*x, y);\n}\n\nstatic inline void  //\nwuffs_base__u8__sat_sub_indirect(uint8_t* x, uint8_t y) {\n  *x = wuffs_base__u8__sat_sub(*x, y);\n}\n\nstatic inline void  //\nwuffs_base__u16__sat_add_indirect(uint16_t* x, uint16_t y) {\n  *x = wuffs_base__u16__sat_add(*x, y);\n}\n\nstatic inline void  //\nwuffs_base__u16__sat_sub_indirect(uint16_t* x, uint16_t y) {\n  *x = wuffs_base__u16__sat_sub(*x, y);\n}\n\nstatic inline void  //\nwuffs_base__u32__sat_add_indirect(uint32_t* x, uint32_t y) {\n  *x = wuffs_base__u32__sat_add(*x, y);\n}\n\nstatic inline void  //\nwuffs_base__u32__sat_sub_indirect(uint32_t* x, uint32_t y) {\n  *x = wuffs_base__u32__sat_sub(*x, y);\n}\n\nstatic inline void  //\nwuffs_base__u64__sat_add_indirect(uint64_t* x, uint64_t y) {\n  *x = wuffs_base__u64__sat_add(*x, y);\n}\n\nstatic inline void  //\nwuffs_base__u64__sat_sub_indirect(uint64_t* x, uint64_t y) {\n  *x = wuffs_base__u64__sat_sub(*x, y);\n}\n\n" +
 	"" +
+	"// --------\n\nstatic inline void  //\nwuffs_base__u8__mod_shift_left_indirect(uint8_t* x, uint64_t n) {\n  *x = wuffs_base__u8__mod_shift_left(*x, n);\n}\n\nstatic inline void  //\nwuffs_base__u8__mod_shift_right_indirect(uint8_t* x, uint64_t n) {\n  *x = wuffs_base__u8__mod_shift_right(*x, n);\n}\n\nstatic inline void  //\nwuffs_base__u16__mod_shift_left_indirect(uint16_t* x, uint64_t n) {\n  *x = wuffs_base__u16__mod_shift_left(*x, n);\n}\n\nstatic inline void  //\nwuffs_base__u16__mod_shift_right_indirect(uint16_t* x, uint64_t n) {\n  *x = wuffs_base__u16__mod_shift_right(*x, n);\n}\n\nstatic inline void  //\nwuffs_base__u32__mod_shift_left_indirect(uint32_t* x, uint64_t n) {\n  *x = wuffs_base__u32__mod_shift_left(*x, n);\n}\n\nstatic inline void  //\nwuffs_base__u32__mod_shift_right_indirect(uint32_t* x, uint64_t n) {\n  *x = wuffs_base__u32__mod_shift_right(*x, n);\n}\n\nstatic inline void  //\nwuffs_base__u64__mod_shift_left_indirect(uint64_t* x, uint64_t n) {\n  *x = wuffs_base__u64__mod_shift_left(*x, n);\n}\n\nstatic inline void  //\nw" +
+	"uffs_base__u64__mod_shift_right_indirect(uint64_t* x, uint64_t n) {\n  *x = wuffs_base__u64__mod_shift_right(*x, n);\n}\n\n" +
+	"" +
 	"// ---------------- Slices and Tables\n\n// wuffs_base__slice_u8__prefix returns up to the first up_to bytes of s.\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__slice_u8__prefix(wuffs_base__slice_u8 s, uint64_t up_to) {\n  if (((uint64_t)(s.len)) > up_to) {\n    s.len = ((size_t)up_to);\n  }\n  return s;\n}\n\n// wuffs_base__slice_u8__suffix returns up to the last up_to bytes of s.\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__slice_u8__suffix(wuffs_base__slice_u8 s, uint64_t up_to) {\n  if (((uint64_t)(s.len)) > up_to) {\n    s.ptr += ((uint64_t)(s.len)) - up_to;\n    s.len = ((size_t)up_to);\n  }\n  return s;\n}\n\n// wuffs_base__slice_u8__copy_from_slice calls memmove(dst.ptr, src.ptr, len)\n// where len is the minimum of dst.len and src.len.\n//\n// Passing a wuffs_base__slice_u8 with all fields NULL or zero (a valid, empty\n// slice) is valid and results in a no-op.\nstatic inline uint64_t  //\nwuffs_base__slice_u8__copy_from_slice(wuffs_base__slice_u8 dst,\n                                      wuffs_base__slice_u8 s" +
 	"rc) {\n  size_t len = dst.len < src.len ? dst.len : src.len;\n  if (len > 0) {\n    memmove(dst.ptr, src.ptr, len);\n  }\n  return len;\n}\n\n" +
 	"" +
@@ -55,17 +59,39 @@ const BaseFundamentalPublicH = "" +
 	"fine WUFFS_VERSION_PRE_RELEASE_LABEL \"work.in.progress\"\n#define WUFFS_VERSION_BUILD_METADATA_COMMIT_COUNT 0\n#define WUFFS_VERSION_BUILD_METADATA_COMMIT_DATE 0\n#define WUFFS_VERSION_STRING \"0.0.0+0.00000000\"\n\n" +
 	"" +
 	"// ---------------- Configuration\n\n// Define WUFFS_CONFIG__AVOID_CPU_ARCH to avoid any code tied to a specific CPU\n// architecture, such as SSE SIMD for the x86 CPU family.\n#if defined(WUFFS_CONFIG__AVOID_CPU_ARCH)  // (#if-chain ref AVOID_CPU_ARCH_0)\n// No-op.\n#else  // (#if-chain ref AVOID_CPU_ARCH_0)\n\n// The \"defined(__clang__)\" isn't redundant. While vanilla clang defines\n// __GNUC__, clang-cl (which mimics MSVC's cl.exe) does not.\n#if defined(__GNUC__) || defined(__clang__)\n#define WUFFS_BASE__MAYBE_ATTRIBUTE_TARGET(arg) __attribute__((target(arg)))\n#else\n#define WUFFS_BASE__MAYBE_ATTRIBUTE_TARGET(arg)\n#endif  // defined(__GNUC__) || defined(__clang__)\n\n#if defined(__GNUC__)  // (#if-chain ref AVOID_CPU_ARCH_1)\n\n// To simplify Wuffs code, \"cpu_arch >= arm_xxx\" requires xxx but also\n// unaligned little-endian load/stores.\n#if defined(__ARM_FEATURE_UNALIGNED) && defined(__BYTE_ORDER__) && \\\n    (__BYTE_ORDER__ == __ORDER_LITTLE_ENDIAN__)\n// Not all gcc versions define __ARM_ACLE, even if they support crc32" +
-	"\n// intrinsics. Look for __ARM_FEATURE_CRC32 instead.\n#if defined(__ARM_FEATURE_CRC32)\n#include <arm_acle.h>\n#define WUFFS_BASE__CPU_ARCH__ARM_CRC32\n#endif  // defined(__ARM_FEATURE_CRC32)\n#if defined(__ARM_NEON)\n#include <arm_neon.h>\n#define WUFFS_BASE__CPU_ARCH__ARM_NEON\n#endif  // defined(__ARM_NEON)\n#endif  // defined(__ARM_FEATURE_UNALIGNED) etc\n\n// Similarly, \"cpu_arch >= x86_sse42\" requires SSE4.2 but also PCLMUL and\n// POPCNT. This is checked at runtime via cpuid, not at compile time.\n#if defined(__x86_64__)\n#include <cpuid.h>\n#include <x86intrin.h>\n#define WUFFS_BASE__CPU_ARCH__X86_64\n#endif  // defined(__x86_64__)\n\n#elif defined(_MSC_VER)  // (#if-chain ref AVOID_CPU_ARCH_1)\n\n#if defined(_M_X64)\n#if defined(__AVX__) || defined(__clang__)\n\n// We need <intrin.h> for the __cpuid function.\n#include <intrin.h>\n// That's not enough for X64 SIMD, with clang-cl, if we want to use\n// \"__attribute__((target(arg)))\" without e.g. \"/arch:AVX\".\n//\n// Some web pages suggest that <immintrin.h> is all you need, as i" +
-	"t pulls in\n// the earlier SIMD families like SSE4.2, but that doesn't seem to work in\n// practice, possibly for the same reason that just <intrin.h> doesn't work.\n#include <immintrin.h>  // AVX, AVX2, FMA, POPCNT\n#include <nmmintrin.h>  // SSE4.2\n#include <wmmintrin.h>  // AES, PCLMUL\n#define WUFFS_BASE__CPU_ARCH__X86_64\n\n#else  // defined(__AVX__) || defined(__clang__)\n\n// clang-cl (which defines both __clang__ and _MSC_VER) supports\n// \"__attribute__((target(arg)))\".\n//\n// For MSVC's cl.exe (unlike clang or gcc), SIMD capability is a compile-time\n// property of the source file (e.g. a /arch:AVX or -mavx compiler flag), not\n// of individual functions (that can be conditionally selected at runtime).\n#pragma message(\"Wuffs with MSVC+X64 needs /arch:AVX for best performance\")\n\n#endif  // defined(__AVX__) || defined(__clang__)\n#endif  // defined(_M_X64)\n\n#endif  // (#if-chain ref AVOID_CPU_ARCH_1)\n#endif  // (#if-chain ref AVOID_CPU_ARCH_0)\n\n" +
+	"\n// intrinsics. Look for __ARM_FEATURE_CRC32 instead.\n#if defined(__ARM_FEATURE_CRC32)\n#include <arm_acle.h>\n#define WUFFS_BASE__CPU_ARCH__ARM_CRC32\n#endif  // defined(__ARM_FEATURE_CRC32)\n#if defined(__ARM_NEON)\n#include <arm_neon.h>\n#define WUFFS_BASE__CPU_ARCH__ARM_NEON\n#endif  // defined(__ARM_NEON)\n#if defined(__ARM_FEATURE_SVE)\n#include <arm_sve.h>\n#define WUFFS_BASE__CPU_ARCH__ARM_SVE\n#endif  // defined(__ARM_FEATURE_SVE)\n#endif  // defined(__ARM_FEATURE_UNALIGNED) etc\n\n// \"cpu_arch >= riscv_v\" requires the ratified (v1.0) vector extension and the\n// \"__riscv_\"-prefixed (v0.12 or later) intrinsics.\n#if defined(__riscv_vector) && defined(__riscv_v_intrinsic) && \\\n    (__riscv_v_intrinsic >= 12000)\n#include <riscv_vector.h>\n#define WUFFS_BASE__CPU_ARCH__RISCV_V\n#endif  // defined(__riscv_vector) etc\n\n// Similarly, \"cpu_arch >= x86_sse42\" requires SSE4.2 but also PCLMUL and\n// POPCNT. This is checked at runtime via cpuid, not at compile time.\n#if defined(__x86_64__)\n#include <cpuid.h>\n#include <x86intrin." +
+	"h>\n#define WUFFS_BASE__CPU_ARCH__X86_64\n#endif  // defined(__x86_64__)\n\n#elif defined(_MSC_VER)  // (#if-chain ref AVOID_CPU_ARCH_1)\n\n#if defined(_M_X64)\n#if defined(__AVX__) || defined(__clang__)\n\n// We need <intrin.h> for the __cpuid function.\n#include <intrin.h>\n// That's not enough for X64 SIMD, with clang-cl, if we want to use\n// \"__attribute__((target(arg)))\" without e.g. \"/arch:AVX\".\n//\n// Some web pages suggest that <immintrin.h> is all you need, as it pulls in\n// the earlier SIMD families like SSE4.2, but that doesn't seem to work in\n// practice, possibly for the same reason that just <intrin.h> doesn't work.\n#include <immintrin.h>  // AVX, AVX2, FMA, POPCNT\n#include <nmmintrin.h>  // SSE4.2\n#include <wmmintrin.h>  // AES, PCLMUL\n#define WUFFS_BASE__CPU_ARCH__X86_64\n\n#else  // defined(__AVX__) || defined(__clang__)\n\n// clang-cl (which defines both __clang__ and _MSC_VER) supports\n// \"__attribute__((target(arg)))\".\n//\n// For MSVC's cl.exe (unlike clang or gcc), SIMD capability is a compile-time\n// pro" +
+	"perty of the source file (e.g. a /arch:AVX or -mavx compiler flag), not\n// of individual functions (that can be conditionally selected at runtime).\n#pragma message(\"Wuffs with MSVC+X64 needs /arch:AVX for best performance\")\n\n#endif  // defined(__AVX__) || defined(__clang__)\n#endif  // defined(_M_X64)\n\n#endif  // (#if-chain ref AVOID_CPU_ARCH_1)\n#endif  // (#if-chain ref AVOID_CPU_ARCH_0)\n\n" +
 	"" +
 	"// --------\n\n// Define WUFFS_CONFIG__STATIC_FUNCTIONS to make all of Wuffs' functions have\n// static storage. The motivation is discussed in the \"ALLOW STATIC\n// IMPLEMENTATION\" section of\n// https://raw.githubusercontent.com/nothings/stb/master/docs/stb_howto.txt\n#if defined(WUFFS_CONFIG__STATIC_FUNCTIONS)\n#define WUFFS_BASE__MAYBE_STATIC static\n#else\n#define WUFFS_BASE__MAYBE_STATIC\n#endif  // defined(WUFFS_CONFIG__STATIC_FUNCTIONS)\n\n" +
 	"" +
-	"// ---------------- CPU Architecture\n\nstatic inline bool  //\nwuffs_base__cpu_arch__have_arm_crc32() {\n#if defined(WUFFS_BASE__CPU_ARCH__ARM_CRC32)\n  return true;\n#else\n  return false;\n#endif  // defined(WUFFS_BASE__CPU_ARCH__ARM_CRC32)\n}\n\nstatic inline bool  //\nwuffs_base__cpu_arch__have_arm_neon() {\n#if defined(WUFFS_BASE__CPU_ARCH__ARM_NEON)\n  return true;\n#else\n  return false;\n#endif  // defined(WUFFS_BASE__CPU_ARCH__ARM_NEON)\n}\n\nstatic inline bool  //\nwuffs_base__cpu_arch__have_x86_sse42() {\n#if defined(WUFFS_BASE__CPU_ARCH__X86_64)\n  // GCC defines these macros but MSVC does not.\n  //  - bit_PCLMUL = (1 <<  1)\n  //  - bit_POPCNT = (1 << 23)\n  //  - bit_SSE4_2 = (1 << 20)\n  const unsigned int sse42_ecx1 = 0x00900002;\n\n  // clang defines __GNUC__ and clang-cl defines _MSC_VER (but not __GNUC__).\n#if defined(__GNUC__)\n  unsigned int eax1 = 0;\n  unsigned int ebx1 = 0;\n  unsigned int ecx1 = 0;\n  unsigned int edx1 = 0;\n  if (__get_cpuid(1, &eax1, &ebx1, &ecx1, &edx1)) {\n    return (ecx1 & sse42_ecx1) == sse42_" +
-	"ecx1;\n  }\n#elif defined(_MSC_VER)  // defined(__GNUC__)\n  int x[4];\n  __cpuid(x, 1);\n  return (((unsigned int)(x[2])) & sse42_ecx1) == sse42_ecx1;\n#else\n#error \"WUFFS_BASE__CPU_ARCH__ETC combined with an unsupported compiler\"\n#endif  // defined(__GNUC__); defined(_MSC_VER)\n#endif  // defined(WUFFS_BASE__CPU_ARCH__X86_64)\n  return false;\n}\n\n" +
+	"// --------\n\n// Define WUFFS_CONFIG__STATUS_MAPPINGS to declare (and define) each package's\n// wuffs_foo__status_http_code and wuffs_foo__status_errno functions. They map\n// that package's error statuses that were declared with a class, such as\n// corrupt, to suggested HTTP response status codes and errno values, such as\n// 422 and EBADMSG. Other statuses map to zero.\n#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)\n#include <errno.h>\n#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)\n\n" +
+	"" +
+	"// --------\n\n// Define WUFFS_CONFIG__STATUS_ENUMS to declare (and define) each package's\n// WUFFS_FOO__STATUS_ENUM__ETC macros, numbering that package's statuses from\n// 1, and its wuffs_foo__status__from_enum and wuffs_foo__status__to_enum\n// functions, converting between those numbers and status reprs. Zero means a\n// status that is not that package's, such as ok.\n\n" +
+	"" +
+	"// --------\n\n// Define WUFFS_CONFIG__THREAD_SAFETY_ANNOTATIONS to annotate the generated\n// code for Clang's -Wthread-safety analysis. Wuffs structs (such as\n// wuffs_foo__decoder) are not thread-safe: concurrent calls on the same struct\n// must be externally synchronized. With this macro, each public struct is a\n// capability and each public method requires holding its receiver, exclusively\n// (or, for const methods, shared). Callers tell the analysis how they hold it,\n// by annotating their own locking functions, such as with\n// __attribute__((acquire_capability(dec))), or with assert_capability.\n//\n// The macro has no effect on other compilers, or on the base package's\n// interface functions (such as wuffs_base__image_decoder__decode_frame).\n#if defined(WUFFS_CONFIG__THREAD_SAFETY_ANNOTATIONS) && defined(__clang__)\n#define WUFFS_BASE__CAPABILITY __attribute__((capability(\"wuffs_struct\")))\n#define WUFFS_BASE__REQUIRES(x) __attribute__((requires_capability(x)))\n#define WUFFS_BASE__REQUIRES_SHARED(x) \\\n  __at" +
+	"tribute__((requires_shared_capability(x)))\n#define WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS \\\n  __attribute__((no_thread_safety_analysis))\n#else\n#define WUFFS_BASE__CAPABILITY\n#define WUFFS_BASE__REQUIRES(x)\n#define WUFFS_BASE__REQUIRES_SHARED(x)\n#define WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS\n#endif  // defined(WUFFS_CONFIG__THREAD_SAFETY_ANNOTATIONS) && etc\n\n" +
+	"" +
+	"// --------\n\n// Define WUFFS_CONFIG__TELEMETRY to collect each struct's wuffs_base__telemetry\n// counters, such as the number of bytes consumed and of error statuses\n// returned, readable via each package's wuffs_foo__bar__telemetry functions.\n\n" +
+	"" +
+	"// --------\n\n// Define WUFFS_CONFIG__AUTOVEC to shape the base package's portable copy loops\n// (those that copy from an io_writer's history) for compilers'\n// auto-vectorizers. The std packages' portable loops are shaped by the wuffs\n// gen -autovec flag instead, as that code is generated.\n\n" +
+	"" +
+	"// --------\n\n// Code generated with the wuffs gen -instrument flag calls these hooks when a\n// coroutine suspends, when a function returns a status and at the start of\n// each while loop iteration. Define them (before #include'ing this file) to\n// observe a decoder's progress, e.g. for fuzzer feedback or profiling. The\n// self argument is the receiver (or NULL) and func is the C function name, as\n// a string literal. Otherwise, they expand to nothing.\n#if !defined(WUFFS_BASE__INSTRUMENT__SUSPEND)\n#define WUFFS_BASE__INSTRUMENT__SUSPEND(self, func, point, status) ((void)0)\n#endif\n#if !defined(WUFFS_BASE__INSTRUMENT__RETURN)\n#define WUFFS_BASE__INSTRUMENT__RETURN(self, func, status) ((void)0)\n#endif\n#if !defined(WUFFS_BASE__INSTRUMENT__LOOP)\n#define WUFFS_BASE__INSTRUMENT__LOOP(self, func, line) ((void)0)\n#endif\n\n" +
+	"" +
+	"// --------\n\n// Define WUFFS_CONFIG__MEMCPY_PEEK_POKE to make the wuffs_base__peek_etc and\n// wuffs_base__poke_etc functions access memory only via fixed-size memcpy\n// calls (to or from a local array), never by dereferencing a pointer.\n// Compilers typically optimize those memcpy calls to single loads or stores,\n// and sanitizers (such as UBSan's -fsanitize=alignment) see no unaligned or\n// type-punned accesses.\n\n" +
+	"" +
+	"// ---------------- Static Assertions\n\n// WUFFS_BASE__STATIC_ASSERT(cond, name) fails to compile if cond, an integer\n// constant expression, is false. The name is a C identifier, unique within the\n// header that uses it, that older compilers (those without static_assert)\n// show in their error message.\n#if defined(__cplusplus) && ((__cplusplus >= 201103L) || defined(_MSC_VER))\n#define WUFFS_BASE__STATIC_ASSERT(cond, name) static_assert(cond, #name)\n#elif defined(__STDC_VERSION__) && (__STDC_VERSION__ >= 201112L)\n#define WUFFS_BASE__STATIC_ASSERT(cond, name) _Static_assert(cond, #name)\n#else\n#define WUFFS_BASE__STATIC_ASSERT(cond, name) \\\n  typedef char wuffs_base__static_assert__##name[(cond) ? 1 : -1]\n#endif\n\n// WUFFS_BASE__ABI_HASH identifies the layout of the base package's public\n// types. Each generated package's header asserts that it matches the value\n// that the package was generated with. Mixing a package with a wuffs-base.c\n// from an incompatible Wuffs version then fails at compile time, instead of" +
+	" at\n// run time (such as with \"#base: bad sizeof receiver\") or not at all.\n//\n// ¡ INSERT ABI hash.\n\n// The CPU-architecture-specific code (see WUFFS_BASE__CPU_ARCH__ETC) assumes a\n// little-endian CPU.\n#if (defined(WUFFS_BASE__CPU_ARCH__ARM_CRC32) ||  \\\n     defined(WUFFS_BASE__CPU_ARCH__ARM_NEON) ||   \\\n     defined(WUFFS_BASE__CPU_ARCH__ARM_SVE) ||    \\\n     defined(WUFFS_BASE__CPU_ARCH__RISCV_V) ||    \\\n     defined(WUFFS_BASE__CPU_ARCH__X86_64)) &&    \\\n    defined(__BYTE_ORDER__) && defined(__ORDER_LITTLE_ENDIAN__)\nWUFFS_BASE__STATIC_ASSERT(__BYTE_ORDER__ == __ORDER_LITTLE_ENDIAN__,\n                          cpu_arch_is_little_endian);\n#endif\n\n// WUFFS_BASE__INLINE is C99's inline keyword, spelled so that it also works\n// for older C compilers, which support it as an extension. Code generated with\n// the wuffs gen -ctarget=c89 (or -ctarget=msvc) flag uses it.\n#if defined(__cplusplus) || \\\n    (defined(__STDC_VERSION__) && (__STDC_VERSION__ >= 199901L))\n#define WUFFS_BASE__INLINE inline\n#elif defined(__" +
+	"GNUC__)\n#define WUFFS_BASE__INLINE __inline__\n#elif defined(_MSC_VER)\n#define WUFFS_BASE__INLINE __inline\n#else\n#define WUFFS_BASE__INLINE\n#endif\n\n" +
 	"" +
-	"// ---------------- Fundamentals\n\n// Wuffs assumes that:\n//  - converting a uint32_t to a size_t will never overflow.\n//  - converting a size_t to a uint64_t will never overflow.\n#if defined(__WORDSIZE)\n#if (__WORDSIZE != 32) && (__WORDSIZE != 64)\n#error \"Wuffs requires a word size of either 32 or 64 bits\"\n#endif\n#endif\n\n// Clang also defines \"__GNUC__\".\n#if defined(__GNUC__)\n#define WUFFS_BASE__POTENTIALLY_UNUSED __attribute__((unused))\n#define WUFFS_BASE__WARN_UNUSED_RESULT __attribute__((warn_unused_result))\n#else\n#define WUFFS_BASE__POTENTIALLY_UNUSED\n#define WUFFS_BASE__WARN_UNUSED_RESULT\n#endif\n\n" +
+	"// ---------------- CPU Architecture\n\nstatic inline bool  //\nwuffs_base__cpu_arch__have_arm_crc32() {\n#if defined(WUFFS_BASE__CPU_ARCH__ARM_CRC32)\n  return true;\n#else\n  return false;\n#endif  // defined(WUFFS_BASE__CPU_ARCH__ARM_CRC32)\n}\n\nstatic inline bool  //\nwuffs_base__cpu_arch__have_arm_neon() {\n#if defined(WUFFS_BASE__CPU_ARCH__ARM_NEON)\n  return true;\n#else\n  return false;\n#endif  // defined(WUFFS_BASE__CPU_ARCH__ARM_NEON)\n}\n\nstatic inline bool  //\nwuffs_base__cpu_arch__have_arm_sve() {\n#if defined(WUFFS_BASE__CPU_ARCH__ARM_SVE)\n  return true;\n#else\n  return false;\n#endif  // defined(WUFFS_BASE__CPU_ARCH__ARM_SVE)\n}\n\nstatic inline bool  //\nwuffs_base__cpu_arch__have_riscv_v() {\n#if defined(WUFFS_BASE__CPU_ARCH__RISCV_V)\n  return true;\n#else\n  return false;\n#endif  // defined(WUFFS_BASE__CPU_ARCH__RISCV_V)\n}\n\nstatic inline bool  //\nwuffs_base__cpu_arch__have_x86_sse42() {\n#if defined(WUFFS_BASE__CPU_ARCH__X86_64)\n  // GCC defines these macros but MSVC does not.\n  //  - bit_PCLMUL = (1 <<  1)\n  //  - bit" +
+	"_POPCNT = (1 << 23)\n  //  - bit_SSE4_2 = (1 << 20)\n  const unsigned int sse42_ecx1 = 0x00900002;\n\n  // clang defines __GNUC__ and clang-cl defines _MSC_VER (but not __GNUC__).\n#if defined(__GNUC__)\n  unsigned int eax1 = 0;\n  unsigned int ebx1 = 0;\n  unsigned int ecx1 = 0;\n  unsigned int edx1 = 0;\n  if (__get_cpuid(1, &eax1, &ebx1, &ecx1, &edx1)) {\n    return (ecx1 & sse42_ecx1) == sse42_ecx1;\n  }\n#elif defined(_MSC_VER)  // defined(__GNUC__)\n  int x[4];\n  __cpuid(x, 1);\n  return (((unsigned int)(x[2])) & sse42_ecx1) == sse42_ecx1;\n#else\n#error \"WUFFS_BASE__CPU_ARCH__ETC combined with an unsupported compiler\"\n#endif  // defined(__GNUC__); defined(_MSC_VER)\n#endif  // defined(WUFFS_BASE__CPU_ARCH__X86_64)\n  return false;\n}\n\n" +
 	"" +
-	"// --------\n\n// Options (bitwise or'ed together) for wuffs_foo__bar__initialize functions.\n\n#define WUFFS_INITIALIZE__DEFAULT_OPTIONS ((uint32_t)0x00000000)\n\n// WUFFS_INITIALIZE__ALREADY_ZEROED means that the \"self\" receiver struct value\n// has already been set to all zeroes.\n#define WUFFS_INITIALIZE__ALREADY_ZEROED ((uint32_t)0x00000001)\n\n// WUFFS_INITIALIZE__LEAVE_INTERNAL_BUFFERS_UNINITIALIZED means that, absent\n// WUFFS_INITIALIZE__ALREADY_ZEROED, only some of the \"self\" receiver struct\n// value will be set to all zeroes. Internal buffers, which tend to be a large\n// proportion of the struct's size, will be left uninitialized. Internal means\n// that the buffer is contained by the receiver struct, as opposed to being\n// passed as a separately allocated \"work buffer\".\n//\n// For more detail, see:\n// https://github.com/google/wuffs/blob/main/doc/note/initialization.md\n#define WUFFS_INITIALIZE__LEAVE_INTERNAL_BUFFERS_UNINITIALIZED \\\n  ((uint32_t)0x00000002)\n\n" +
+	"// ---------------- Fundamentals\n\n// Wuffs assumes that:\n//  - converting a uint32_t to a size_t will never overflow.\n//  - converting a size_t to a uint64_t will never overflow.\n#if defined(__WORDSIZE)\n#if (__WORDSIZE != 32) && (__WORDSIZE != 64)\n#error \"Wuffs requires a word size of either 32 or 64 bits\"\n#endif\n#endif\n\n// Clang also defines \"__GNUC__\".\n#if defined(__GNUC__)\n#define WUFFS_BASE__POTENTIALLY_UNUSED __attribute__((unused))\n#define WUFFS_BASE__WARN_UNUSED_RESULT __attribute__((warn_unused_result))\n#else\n#define WUFFS_BASE__POTENTIALLY_UNUSED\n#define WUFFS_BASE__WARN_UNUSED_RESULT\n#endif\n\n// WUFFS_BASE__RESTRICT is C99's restrict qualifier, spelled so that it also\n// works for C++ compilers, which support it as an extension.\n#if defined(__GNUC__)\n#define WUFFS_BASE__RESTRICT __restrict__\n#elif defined(_MSC_VER)\n#define WUFFS_BASE__RESTRICT __restrict\n#else\n#define WUFFS_BASE__RESTRICT\n#endif\n\n" +
+	"" +
+	"// --------\n\n// Options (bitwise or'ed together) for wuffs_foo__bar__initialize functions.\n\n#define WUFFS_INITIALIZE__DEFAULT_OPTIONS ((uint32_t)0x00000000)\n\n// WUFFS_INITIALIZE__ALREADY_ZEROED means that the \"self\" receiver struct value\n// has already been set to all zeroes.\n#define WUFFS_INITIALIZE__ALREADY_ZEROED ((uint32_t)0x00000001)\n\n// WUFFS_INITIALIZE__LEAVE_INTERNAL_BUFFERS_UNINITIALIZED means that, absent\n// WUFFS_INITIALIZE__ALREADY_ZEROED, only some of the \"self\" receiver struct\n// value will be set to all zeroes. Internal buffers, which tend to be a large\n// proportion of the struct's size, will be left uninitialized. Internal means\n// that the buffer is contained by the receiver struct, as opposed to being\n// passed as a separately allocated \"work buffer\".\n//\n// For more detail, see:\n// https://github.com/google/wuffs/blob/main/doc/note/initialization.md\n#define WUFFS_INITIALIZE__LEAVE_INTERNAL_BUFFERS_UNINITIALIZED \\\n  ((uint32_t)0x00000002)\n\n// WUFFS_INITIALIZE__WORKBUF_LESS means that the cal" +
+	"ler will not provide a work\n// buffer: workbuf_len will return zero and methods that take a workbuf will\n// ignore it, running a workbuf-less variant instead. That variant might be\n// slower, or support fewer features, than the default.\n//\n// Only some structs support this. Those that do not (but otherwise take a\n// workbuf) will fail to initialize, returning\n// wuffs_base__error__unsupported_option, and the caller can then initialize\n// again without this option (and provide a work buffer). Structs that never\n// take a workbuf will accept and ignore it.\n#define WUFFS_INITIALIZE__WORKBUF_LESS ((uint32_t)0x00000004)\n\n// WUFFS_INITIALIZE__AVOID_CPU_ARCH__ETC means that choosy functions (those\n// with CPU-architecture-specific variants, such as SIMD implementations) will\n// not choose that CPU architecture's variants, even if the CPU supports them.\n// Sub-structs (such as a PNG decoder's zlib decoder) are initialized with the\n// same options.\n//\n// Setting all of them (WUFFS_INITIALIZE__AVOID_CPU_ARCH) means alw" +
+	"ays using\n// the portable variants. Comparing the output of differently initialized\n// structs, on the same input, is differential testing: it catches a variant\n// that diverges from the others (see fuzz/c/std/cpu_arch_fuzzer.c), which\n// ordinary fuzzing would attribute to whichever variant the CPU dispatched to.\n#define WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_CRC32 ((uint32_t)0x00000100)\n#define WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_NEON ((uint32_t)0x00000200)\n#define WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_SVE ((uint32_t)0x00000400)\n#define WUFFS_INITIALIZE__AVOID_CPU_ARCH__RISCV_V ((uint32_t)0x00000800)\n#define WUFFS_INITIALIZE__AVOID_CPU_ARCH__X86_SSE42 ((uint32_t)0x00001000)\n#define WUFFS_INITIALIZE__AVOID_CPU_ARCH ((uint32_t)0x00001F00)\n\n" +
 	"" +
 	"// --------\n\n// wuffs_base__empty_struct is used when a Wuffs function returns an empty\n// struct. In C, if a function f returns void, you can't say \"x = f()\", but in\n// Wuffs, if a function g returns empty, you can say \"y = g()\".\ntypedef struct wuffs_base__empty_struct__struct {\n  // private_impl is a placeholder field. It isn't explicitly used, except that\n  // without it, the sizeof a struct with no fields can differ across C/C++\n  // compilers, and it is undefined behavior in C99. For example, gcc says that\n  // the sizeof an empty struct is 0, and g++ says that it is 1. This leads to\n  // ABI incompatibility if a Wuffs .c file is processed by one compiler and\n  // its .h file with another compiler.\n  //\n  // Instead, we explicitly insert an otherwise unused field, so that the\n  // sizeof this struct is always 1.\n  uint8_t private_impl;\n} wuffs_base__empty_struct;\n\nstatic inline wuffs_base__empty_struct  //\nwuffs_base__make_empty_struct() {\n  wuffs_base__empty_struct ret;\n  ret.private_impl = 0;\n  return " +
 	"ret;\n}\n\n// wuffs_base__utility is a placeholder receiver type. It enables what Java\n// calls static methods, as opposed to regular methods.\ntypedef struct wuffs_base__utility__struct {\n  // private_impl is a placeholder field. It isn't explicitly used, except that\n  // without it, the sizeof a struct with no fields can differ across C/C++\n  // compilers, and it is undefined behavior in C99. For example, gcc says that\n  // the sizeof an empty struct is 0, and g++ says that it is 1. This leads to\n  // ABI incompatibility if a Wuffs .c file is processed by one compiler and\n  // its .h file with another compiler.\n  //\n  // Instead, we explicitly insert an otherwise unused field, so that the\n  // sizeof this struct is always 1.\n  uint8_t private_impl;\n} wuffs_base__utility;\n\ntypedef struct wuffs_base__vtable__struct {\n  const char* vtable_name;\n  const void* function_pointers;\n} wuffs_base__vtable;\n\n" +
@@ -74,6 +100,9 @@ const BaseFundamentalPublicH = "" +
 	"static inline bool  //\nwuffs_base__status__is_ok(const wuffs_base__status* z) {\n  return z->repr == NULL;\n}\n\nstatic inline bool  //\nwuffs_base__status__is_suspension(const wuffs_base__status* z) {\n  return z->repr && (*z->repr == '$');\n}\n\n// wuffs_base__status__message strips the leading '$', '#' or '@'.\nstatic inline const char*  //\nwuffs_base__status__message(const wuffs_base__status* z) {\n  if (z->repr) {\n    if ((*z->repr == '$') || (*z->repr == '#') || (*z->repr == '@')) {\n      return z->repr + 1;\n    }\n  }\n  return z->repr;\n}\n\n#ifdef __cplusplus\n\ninline bool  //\nwuffs_base__status::is_complete() const {\n  return wuffs_base__status__is_complete(this);\n}\n\ninline bool  //\nwuffs_base__status::is_error() const {\n  return wuffs_base__status__is_error(this);\n}\n\ninline bool  //\nwuffs_base__status::is_note() const {\n  return wuffs_base__status__is_note(this);\n}\n\ninline bool  //\nwuffs_base__status::is_ok() const {\n  return wuffs_base__status__is_ok(this);\n}\n\ninline bool  //\nwuffs_base__status::is_suspension() co" +
 	"nst {\n  return wuffs_base__status__is_suspension(this);\n}\n\ninline const char*  //\nwuffs_base__status::message() const {\n  return wuffs_base__status__message(this);\n}\n\n#endif  // __cplusplus\n\n" +
 	"" +
+	"// --------\n\n// wuffs_base__telemetry holds a struct's counters, summed over its public\n// coroutine method calls (such as a decoder's decode_frame) since it was\n// initialized, so that services can export decoder health metrics. They are\n// only collected if WUFFS_CONFIG__TELEMETRY is defined. Otherwise, they cost\n// nothing and the wuffs_foo__bar__telemetry functions return all zeroes.\n//\n// bytes_consumed and bytes_produced count the bytes read from io_reader\n// arguments (such as src) and written to io_writer arguments (such as dst).\n// suspensions and errors count the calls that returned a suspension status\n// (such as \"$short read\") and an error status.\ntypedef struct wuffs_base__telemetry__struct {\n  uint64_t bytes_consumed;\n  uint64_t bytes_produced;\n  uint64_t suspensions;\n  uint64_t errors;\n} wuffs_base__telemetry;\n\nstatic inline wuffs_base__telemetry  //\nwuffs_base__empty_telemetry() {\n  wuffs_base__telemetry ret;\n  ret.bytes_consumed = 0;\n  ret.bytes_produced = 0;\n  ret.suspensions = 0;\n  ret.erro" +
+	"rs = 0;\n  return ret;\n}\n\n" +
+	"" +
 	"// --------\n\n// WUFFS_BASE__RESULT is a result type: either a status (an error) or a value.\n//\n// A result with all fields NULL or zero is as valid as a zero-valued T.\n#define WUFFS_BASE__RESULT(T)  \\\n  struct {                     \\\n    wuffs_base__status status; \\\n    T value;                   \\\n  }\n\ntypedef WUFFS_BASE__RESULT(double) wuffs_base__result_f64;\ntypedef WUFFS_BASE__RESULT(int64_t) wuffs_base__result_i64;\ntypedef WUFFS_BASE__RESULT(uint64_t) wuffs_base__result_u64;\n\n" +
 	"" +
 	"// --------\n\n// wuffs_base__transform__output is the result of transforming from a src slice\n// to a dst slice.\ntypedef struct wuffs_base__transform__output__struct {\n  wuffs_base__status status;\n  size_t num_dst;\n  size_t num_src;\n} wuffs_base__transform__output;\n\n" +
@@ -89,35 +118,57 @@ const BaseFundamentalPublicH = "" +
 	"ax(uint64_t x, uint64_t y) {\n  return x > y ? x : y;\n}\n\n" +
 	"" +
 	"// --------\n\n// Saturating arithmetic (sat_add, sat_sub) branchless bit-twiddling algorithms\n// are per https://locklessinc.com/articles/sat_arithmetic/\n//\n// It is important that the underlying types are unsigned integers, as signed\n// integer arithmetic overflow is undefined behavior in C.\n\nstatic inline uint8_t  //\nwuffs_base__u8__sat_add(uint8_t x, uint8_t y) {\n  uint8_t res = (uint8_t)(x + y);\n  res |= (uint8_t)(-(res < x));\n  return res;\n}\n\nstatic inline uint8_t  //\nwuffs_base__u8__sat_sub(uint8_t x, uint8_t y) {\n  uint8_t res = (uint8_t)(x - y);\n  res &= (uint8_t)(-(res <= x));\n  return res;\n}\n\nstatic inline uint16_t  //\nwuffs_base__u16__sat_add(uint16_t x, uint16_t y) {\n  uint16_t res = (uint16_t)(x + y);\n  res |= (uint16_t)(-(res < x));\n  return res;\n}\n\nstatic inline uint16_t  //\nwuffs_base__u16__sat_sub(uint16_t x, uint16_t y) {\n  uint16_t res = (uint16_t)(x - y);\n  res &= (uint16_t)(-(res <= x));\n  return res;\n}\n\nstatic inline uint32_t  //\nwuffs_base__u32__sat_add(uint32_t x, uint32_t y) {\n  uint32" +
-	"_t res = (uint32_t)(x + y);\n  res |= (uint32_t)(-(res < x));\n  return res;\n}\n\nstatic inline uint32_t  //\nwuffs_base__u32__sat_sub(uint32_t x, uint32_t y) {\n  uint32_t res = (uint32_t)(x - y);\n  res &= (uint32_t)(-(res <= x));\n  return res;\n}\n\nstatic inline uint64_t  //\nwuffs_base__u64__sat_add(uint64_t x, uint64_t y) {\n  uint64_t res = (uint64_t)(x + y);\n  res |= (uint64_t)(-(res < x));\n  return res;\n}\n\nstatic inline uint64_t  //\nwuffs_base__u64__sat_sub(uint64_t x, uint64_t y) {\n  uint64_t res = (uint64_t)(x - y);\n  res &= (uint64_t)(-(res <= x));\n  return res;\n}\n\n" +
+	"_t res = (uint32_t)(x + y);\n  res |= (uint32_t)(-(res < x));\n  return res;\n}\n\nstatic inline uint32_t  //\nwuffs_base__u32__sat_sub(uint32_t x, uint32_t y) {\n  uint32_t res = (uint32_t)(x - y);\n  res &= (uint32_t)(-(res <= x));\n  return res;\n}\n\nstatic inline uint64_t  //\nwuffs_base__u64__sat_add(uint64_t x, uint64_t y) {\n  uint64_t res = (uint64_t)(x + y);\n  res |= (uint64_t)(-(res < x));\n  return res;\n}\n\nstatic inline uint64_t  //\nwuffs_base__u64__sat_sub(uint64_t x, uint64_t y) {\n  uint64_t res = (uint64_t)(x - y);\n  res &= (uint64_t)(-(res <= x));\n  return res;\n}\n\n// The signed sat_add and sat_sub functions also work on the unsigned\n// (modular) bit patterns. Addition overflows if and only if x and y have the\n// same sign but res has a different sign. Subtraction overflows if and only if\n// x and y have different signs and res's sign differs from x's. On overflow,\n// the result saturates towards x's sign: ((ux >> (N-1)) + INTN_MAX) is\n// INTN_MAX for non-negative x and INTN_MIN for negative x.\n\nstatic inline" +
+	" int8_t  //\nwuffs_base__i8__sat_add(int8_t x, int8_t y) {\n  uint8_t ux = (uint8_t)x;\n  uint8_t uy = (uint8_t)y;\n  uint8_t res = (uint8_t)(ux + uy);\n  if ((int8_t)((ux ^ res) & (uy ^ res)) < 0) {\n    return (int8_t)((uint8_t)(ux >> 7) + INT8_MAX);\n  }\n  return (int8_t)res;\n}\n\nstatic inline int8_t  //\nwuffs_base__i8__sat_sub(int8_t x, int8_t y) {\n  uint8_t ux = (uint8_t)x;\n  uint8_t uy = (uint8_t)y;\n  uint8_t res = (uint8_t)(ux - uy);\n  if ((int8_t)((ux ^ uy) & (ux ^ res)) < 0) {\n    return (int8_t)((uint8_t)(ux >> 7) + INT8_MAX);\n  }\n  return (int8_t)res;\n}\n\nstatic inline int16_t  //\nwuffs_base__i16__sat_add(int16_t x, int16_t y) {\n  uint16_t ux = (uint16_t)x;\n  uint16_t uy = (uint16_t)y;\n  uint16_t res = (uint16_t)(ux + uy);\n  if ((int16_t)((ux ^ res) & (uy ^ res)) < 0) {\n    return (int16_t)((uint16_t)(ux >> 15) + INT16_MAX);\n  }\n  return (int16_t)res;\n}\n\nstatic inline int16_t  //\nwuffs_base__i16__sat_sub(int16_t x, int16_t y) {\n  uint16_t ux = (uint16_t)x;\n  uint16_t uy = (uint16_t)y;\n  uint16_t res = (uint" +
+	"16_t)(ux - uy);\n  if ((int16_t)((ux ^ uy) & (ux ^ res)) < 0) {\n    return (int16_t)((uint16_t)(ux >> 15) + INT16_MAX);\n  }\n  return (int16_t)res;\n}\n\nstatic inline int32_t  //\nwuffs_base__i32__sat_add(int32_t x, int32_t y) {\n  uint32_t ux = (uint32_t)x;\n  uint32_t uy = (uint32_t)y;\n  uint32_t res = (uint32_t)(ux + uy);\n  if ((int32_t)((ux ^ res) & (uy ^ res)) < 0) {\n    return (int32_t)((uint32_t)(ux >> 31) + INT32_MAX);\n  }\n  return (int32_t)res;\n}\n\nstatic inline int32_t  //\nwuffs_base__i32__sat_sub(int32_t x, int32_t y) {\n  uint32_t ux = (uint32_t)x;\n  uint32_t uy = (uint32_t)y;\n  uint32_t res = (uint32_t)(ux - uy);\n  if ((int32_t)((ux ^ uy) & (ux ^ res)) < 0) {\n    return (int32_t)((uint32_t)(ux >> 31) + INT32_MAX);\n  }\n  return (int32_t)res;\n}\n\nstatic inline int64_t  //\nwuffs_base__i64__sat_add(int64_t x, int64_t y) {\n  uint64_t ux = (uint64_t)x;\n  uint64_t uy = (uint64_t)y;\n  uint64_t res = (uint64_t)(ux + uy);\n  if ((int64_t)((ux ^ res) & (uy ^ res)) < 0) {\n    return (int64_t)((uint64_t)(ux >> 63) + INT" +
+	"64_MAX);\n  }\n  return (int64_t)res;\n}\n\nstatic inline int64_t  //\nwuffs_base__i64__sat_sub(int64_t x, int64_t y) {\n  uint64_t ux = (uint64_t)x;\n  uint64_t uy = (uint64_t)y;\n  uint64_t res = (uint64_t)(ux - uy);\n  if ((int64_t)((ux ^ uy) & (ux ^ res)) < 0) {\n    return (int64_t)((uint64_t)(ux >> 63) + INT64_MAX);\n  }\n  return (int64_t)res;\n}\n\n" +
+	"" +
+	"// --------\n\n// The mod_shift functions return (x << n) or (x >> n), modulo the type's\n// range. Unlike C's \"<<\" and \">>\" operators, their behavior is defined for\n// every n: n at or above the type's bit width gives zero. The shift is masked\n// to be less than that bit width and then the result is masked to be zero if\n// the original n was too large, which avoids any branches.\n\nstatic inline uint8_t  //\nwuffs_base__u8__mod_shift_left(uint8_t x, uint64_t n) {\n  uint8_t mask = (uint8_t)(-(uint32_t)(n < 8));\n  return (uint8_t)(((uint8_t)(x << (n & 7))) & mask);\n}\n\nstatic inline uint8_t  //\nwuffs_base__u8__mod_shift_right(uint8_t x, uint64_t n) {\n  uint8_t mask = (uint8_t)(-(uint32_t)(n < 8));\n  return (uint8_t)(((uint8_t)(x >> (n & 7))) & mask);\n}\n\nstatic inline uint16_t  //\nwuffs_base__u16__mod_shift_left(uint16_t x, uint64_t n) {\n  uint16_t mask = (uint16_t)(-(uint32_t)(n < 16));\n  return (uint16_t)(((uint16_t)(x << (n & 15))) & mask);\n}\n\nstatic inline uint16_t  //\nwuffs_base__u16__mod_shift_right(uint16_t x, " +
+	"uint64_t n) {\n  uint16_t mask = (uint16_t)(-(uint32_t)(n < 16));\n  return (uint16_t)(((uint16_t)(x >> (n & 15))) & mask);\n}\n\nstatic inline uint32_t  //\nwuffs_base__u32__mod_shift_left(uint32_t x, uint64_t n) {\n  uint32_t mask = -(uint32_t)(n < 32);\n  return (x << (n & 31)) & mask;\n}\n\nstatic inline uint32_t  //\nwuffs_base__u32__mod_shift_right(uint32_t x, uint64_t n) {\n  uint32_t mask = -(uint32_t)(n < 32);\n  return (x >> (n & 31)) & mask;\n}\n\nstatic inline uint64_t  //\nwuffs_base__u64__mod_shift_left(uint64_t x, uint64_t n) {\n  uint64_t mask = -(uint64_t)(n < 64);\n  return (x << (n & 63)) & mask;\n}\n\nstatic inline uint64_t  //\nwuffs_base__u64__mod_shift_right(uint64_t x, uint64_t n) {\n  uint64_t mask = -(uint64_t)(n < 64);\n  return (x >> (n & 63)) & mask;\n}\n\n// The signed mod_shift_left functions shift the unsigned (two's complement)\n// bit pattern. The signed mod_shift_right functions are arithmetic shifts: n\n// at or above the type's bit width gives the sign fill (0 or -1). Like the\n// generated code for the " +
+	"\">>\" operator, they assume that the C compiler's\n// \">>\" on a negative signed integer is an arithmetic shift.\n\nstatic inline int8_t  //\nwuffs_base__i8__mod_shift_left(int8_t x, uint64_t n) {\n  return (int8_t)wuffs_base__u8__mod_shift_left((uint8_t)x, n);\n}\n\nstatic inline int8_t  //\nwuffs_base__i8__mod_shift_right(int8_t x, uint64_t n) {\n  return (int8_t)(x >> ((n < 7) ? n : 7));\n}\n\nstatic inline int16_t  //\nwuffs_base__i16__mod_shift_left(int16_t x, uint64_t n) {\n  return (int16_t)wuffs_base__u16__mod_shift_left((uint16_t)x, n);\n}\n\nstatic inline int16_t  //\nwuffs_base__i16__mod_shift_right(int16_t x, uint64_t n) {\n  return (int16_t)(x >> ((n < 15) ? n : 15));\n}\n\nstatic inline int32_t  //\nwuffs_base__i32__mod_shift_left(int32_t x, uint64_t n) {\n  return (int32_t)wuffs_base__u32__mod_shift_left((uint32_t)x, n);\n}\n\nstatic inline int32_t  //\nwuffs_base__i32__mod_shift_right(int32_t x, uint64_t n) {\n  return (int32_t)(x >> ((n < 31) ? n : 31));\n}\n\nstatic inline int64_t  //\nwuffs_base__i64__mod_shift_left(int64_t x" +
+	", uint64_t n) {\n  return (int64_t)wuffs_base__u64__mod_shift_left((uint64_t)x, n);\n}\n\nstatic inline int64_t  //\nwuffs_base__i64__mod_shift_right(int64_t x, uint64_t n) {\n  return (int64_t)(x >> ((n < 63) ? n : 63));\n}\n\n" +
 	"" +
 	"// --------\n\ntypedef struct wuffs_base__multiply_u64__output__struct {\n  uint64_t lo;\n  uint64_t hi;\n} wuffs_base__multiply_u64__output;\n\n// wuffs_base__multiply_u64 returns x*y as a 128-bit value.\n//\n// The maximum inclusive output hi_lo is 0xFFFFFFFFFFFFFFFE_0000000000000001.\nstatic inline wuffs_base__multiply_u64__output  //\nwuffs_base__multiply_u64(uint64_t x, uint64_t y) {\n#if defined(__SIZEOF_INT128__)\n  __uint128_t z = ((__uint128_t)x) * ((__uint128_t)y);\n  wuffs_base__multiply_u64__output o;\n  o.lo = ((uint64_t)(z));\n  o.hi = ((uint64_t)(z >> 64));\n  return o;\n#else\n  // TODO: consider using the _mul128 intrinsic if defined(_MSC_VER).\n  uint64_t x0 = x & 0xFFFFFFFF;\n  uint64_t x1 = x >> 32;\n  uint64_t y0 = y & 0xFFFFFFFF;\n  uint64_t y1 = y >> 32;\n  uint64_t w0 = x0 * y0;\n  uint64_t t = (x1 * y0) + (w0 >> 32);\n  uint64_t w1 = t & 0xFFFFFFFF;\n  uint64_t w2 = t >> 32;\n  w1 += x0 * y1;\n  wuffs_base__multiply_u64__output o;\n  o.lo = x * y;\n  o.hi = (x1 * y1) + w2 + (w1 >> 32);\n  return o;\n#endif\n}\n\n" +
 	"" +
+	"// --------\n\n// The mul_qN_round functions return ((x * y) / (1 << N)), rounded to nearest\n// (with ties rounding up): the product of x and y in Q-format fixed point,\n// with N fractional bits. The intermediate product does not overflow, but the\n// result is truncated to the return type. Wuffs code that calls these\n// functions has proved that that truncation is a no-op.\n\nstatic inline uint8_t  //\nwuffs_base__u8__mul_q8_round(uint8_t x, uint8_t y) {\n  return (uint8_t)(((((uint32_t)x) * ((uint32_t)y)) + 0x80) >> 8);\n}\n\nstatic inline uint16_t  //\nwuffs_base__u16__mul_q8_round(uint16_t x, uint16_t y) {\n  return (uint16_t)(((((uint32_t)x) * ((uint32_t)y)) + 0x80) >> 8);\n}\n\nstatic inline uint16_t  //\nwuffs_base__u16__mul_q16_round(uint16_t x, uint16_t y) {\n  return (uint16_t)(((((uint32_t)x) * ((uint32_t)y)) + 0x8000) >> 16);\n}\n\nstatic inline uint32_t  //\nwuffs_base__u32__mul_q8_round(uint32_t x, uint32_t y) {\n  return (uint32_t)(((((uint64_t)x) * ((uint64_t)y)) + 0x80) >> 8);\n}\n\nstatic inline uint32_t  //\nwuffs_b" +
+	"ase__u32__mul_q16_round(uint32_t x, uint32_t y) {\n  return (uint32_t)(((((uint64_t)x) * ((uint64_t)y)) + 0x8000) >> 16);\n}\n\nstatic inline uint64_t  //\nwuffs_base__u64__mul_q8_round(uint64_t x, uint64_t y) {\n  wuffs_base__multiply_u64__output o = wuffs_base__multiply_u64(x, y);\n  uint64_t lo = o.lo + 0x80;\n  uint64_t hi = o.hi + (lo < 0x80);\n  return (lo >> 8) | (hi << 56);\n}\n\nstatic inline uint64_t  //\nwuffs_base__u64__mul_q16_round(uint64_t x, uint64_t y) {\n  wuffs_base__multiply_u64__output o = wuffs_base__multiply_u64(x, y);\n  uint64_t lo = o.lo + 0x8000;\n  uint64_t hi = o.hi + (lo < 0x8000);\n  return (lo >> 16) | (hi << 48);\n}\n\n" +
+	"" +
+	"// --------\n\n// wuffs_base__optional_u32 is a u32 value that may or may not be present. If\n// ok is false then value is zero.\ntypedef struct wuffs_base__optional_u32__struct {\n  uint32_t value;\n  bool ok;\n} wuffs_base__optional_u32;\n\nstatic inline wuffs_base__optional_u32  //\nwuffs_base__empty_optional_u32() {\n  wuffs_base__optional_u32 ret;\n  ret.value = 0;\n  ret.ok = false;\n  return ret;\n}\n\nstatic inline bool  //\nwuffs_base__optional_u32__is_ok(const wuffs_base__optional_u32* o) {\n  return o->ok;\n}\n\nstatic inline uint32_t  //\nwuffs_base__optional_u32__value(const wuffs_base__optional_u32* o) {\n  return o->value;\n}\n\n// wuffs_base__u64__to_u32_checked returns x as an optional u32, which is ok\n// if and only if x fits in a uint32_t.\nstatic inline wuffs_base__optional_u32  //\nwuffs_base__u64__to_u32_checked(uint64_t x) {\n  wuffs_base__optional_u32 ret;\n  ret.ok = x <= 0xFFFFFFFF;\n  ret.value = ret.ok ? ((uint32_t)x) : 0;\n  return ret;\n}\n\n" +
+	"" +
 	"// --------\n\n#if defined(__GNUC__) && (__SIZEOF_LONG__ == 8)\n\nstatic inline uint32_t  //\nwuffs_base__count_leading_zeroes_u64(uint64_t u) {\n  return u ? ((uint32_t)(__builtin_clzl(u))) : 64u;\n}\n\n#else\n// TODO: consider using the _BitScanReverse intrinsic if defined(_MSC_VER).\n\nstatic inline uint32_t  //\nwuffs_base__count_leading_zeroes_u64(uint64_t u) {\n  if (u == 0) {\n    return 64;\n  }\n\n  uint32_t n = 0;\n  if ((u >> 32) == 0) {\n    n |= 32;\n    u <<= 32;\n  }\n  if ((u >> 48) == 0) {\n    n |= 16;\n    u <<= 16;\n  }\n  if ((u >> 56) == 0) {\n    n |= 8;\n    u <<= 8;\n  }\n  if ((u >> 60) == 0) {\n    n |= 4;\n    u <<= 4;\n  }\n  if ((u >> 62) == 0) {\n    n |= 2;\n    u <<= 2;\n  }\n  if ((u >> 63) == 0) {\n    n |= 1;\n    u <<= 1;\n  }\n  return n;\n}\n\n#endif  // defined(__GNUC__) && (__SIZEOF_LONG__ == 8)\n\n" +
 	"" +
-	"// --------\n\n#define wuffs_base__peek_u8be__no_bounds_check \\\n  wuffs_base__peek_u8__no_bounds_check\n#define wuffs_base__peek_u8le__no_bounds_check \\\n  wuffs_base__peek_u8__no_bounds_check\n\nstatic inline uint8_t  //\nwuffs_base__peek_u8__no_bounds_check(const uint8_t* p) {\n  return p[0];\n}\n\nstatic inline uint16_t  //\nwuffs_base__peek_u16be__no_bounds_check(const uint8_t* p) {\n  return (uint16_t)(((uint16_t)(p[0]) << 8) | ((uint16_t)(p[1]) << 0));\n}\n\nstatic inline uint16_t  //\nwuffs_base__peek_u16le__no_bounds_check(const uint8_t* p) {\n  return (uint16_t)(((uint16_t)(p[0]) << 0) | ((uint16_t)(p[1]) << 8));\n}\n\nstatic inline uint32_t  //\nwuffs_base__peek_u24be__no_bounds_check(const uint8_t* p) {\n  return ((uint32_t)(p[0]) << 16) | ((uint32_t)(p[1]) << 8) |\n         ((uint32_t)(p[2]) << 0);\n}\n\nstatic inline uint32_t  //\nwuffs_base__peek_u24le__no_bounds_check(const uint8_t* p) {\n  return ((uint32_t)(p[0]) << 0) | ((uint32_t)(p[1]) << 8) |\n         ((uint32_t)(p[2]) << 16);\n}\n\nstatic inline uint32_t  //\nwuffs_base" +
-	"__peek_u32be__no_bounds_check(const uint8_t* p) {\n  return ((uint32_t)(p[0]) << 24) | ((uint32_t)(p[1]) << 16) |\n         ((uint32_t)(p[2]) << 8) | ((uint32_t)(p[3]) << 0);\n}\n\nstatic inline uint32_t  //\nwuffs_base__peek_u32le__no_bounds_check(const uint8_t* p) {\n  return ((uint32_t)(p[0]) << 0) | ((uint32_t)(p[1]) << 8) |\n         ((uint32_t)(p[2]) << 16) | ((uint32_t)(p[3]) << 24);\n}\n\nstatic inline uint64_t  //\nwuffs_base__peek_u40be__no_bounds_check(const uint8_t* p) {\n  return ((uint64_t)(p[0]) << 32) | ((uint64_t)(p[1]) << 24) |\n         ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 8) |\n         ((uint64_t)(p[4]) << 0);\n}\n\nstatic inline uint64_t  //\nwuffs_base__peek_u40le__no_bounds_check(const uint8_t* p) {\n  return ((uint64_t)(p[0]) << 0) | ((uint64_t)(p[1]) << 8) |\n         ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 24) |\n         ((uint64_t)(p[4]) << 32);\n}\n\nstatic inline uint64_t  //\nwuffs_base__peek_u48be__no_bounds_check(const uint8_t* p) {\n  return ((uint64_t)(p[0]) << 40) | ((uint64_t)(p[" +
-	"1]) << 32) |\n         ((uint64_t)(p[2]) << 24) | ((uint64_t)(p[3]) << 16) |\n         ((uint64_t)(p[4]) << 8) | ((uint64_t)(p[5]) << 0);\n}\n\nstatic inline uint64_t  //\nwuffs_base__peek_u48le__no_bounds_check(const uint8_t* p) {\n  return ((uint64_t)(p[0]) << 0) | ((uint64_t)(p[1]) << 8) |\n         ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 24) |\n         ((uint64_t)(p[4]) << 32) | ((uint64_t)(p[5]) << 40);\n}\n\nstatic inline uint64_t  //\nwuffs_base__peek_u56be__no_bounds_check(const uint8_t* p) {\n  return ((uint64_t)(p[0]) << 48) | ((uint64_t)(p[1]) << 40) |\n         ((uint64_t)(p[2]) << 32) | ((uint64_t)(p[3]) << 24) |\n         ((uint64_t)(p[4]) << 16) | ((uint64_t)(p[5]) << 8) |\n         ((uint64_t)(p[6]) << 0);\n}\n\nstatic inline uint64_t  //\nwuffs_base__peek_u56le__no_bounds_check(const uint8_t* p) {\n  return ((uint64_t)(p[0]) << 0) | ((uint64_t)(p[1]) << 8) |\n         ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 24) |\n         ((uint64_t)(p[4]) << 32) | ((uint64_t)(p[5]) << 40) |\n         ((uint64_t)(p[" +
-	"6]) << 48);\n}\n\nstatic inline uint64_t  //\nwuffs_base__peek_u64be__no_bounds_check(const uint8_t* p) {\n  return ((uint64_t)(p[0]) << 56) | ((uint64_t)(p[1]) << 48) |\n         ((uint64_t)(p[2]) << 40) | ((uint64_t)(p[3]) << 32) |\n         ((uint64_t)(p[4]) << 24) | ((uint64_t)(p[5]) << 16) |\n         ((uint64_t)(p[6]) << 8) | ((uint64_t)(p[7]) << 0);\n}\n\nstatic inline uint64_t  //\nwuffs_base__peek_u64le__no_bounds_check(const uint8_t* p) {\n  return ((uint64_t)(p[0]) << 0) | ((uint64_t)(p[1]) << 8) |\n         ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 24) |\n         ((uint64_t)(p[4]) << 32) | ((uint64_t)(p[5]) << 40) |\n         ((uint64_t)(p[6]) << 48) | ((uint64_t)(p[7]) << 56);\n}\n\n" +
+	"// --------\n\n// The floor_log2 functions return the index of x's highest set bit. Wuffs code\n// that calls these functions has proved that x is non-zero.\n\nstatic inline uint32_t  //\nwuffs_base__u8__floor_log2(uint8_t x) {\n  return 63 - wuffs_base__count_leading_zeroes_u64((uint64_t)x);\n}\n\nstatic inline uint32_t  //\nwuffs_base__u16__floor_log2(uint16_t x) {\n  return 63 - wuffs_base__count_leading_zeroes_u64((uint64_t)x);\n}\n\nstatic inline uint32_t  //\nwuffs_base__u32__floor_log2(uint32_t x) {\n  return 63 - wuffs_base__count_leading_zeroes_u64((uint64_t)x);\n}\n\nstatic inline uint32_t  //\nwuffs_base__u64__floor_log2(uint64_t x) {\n  return 63 - wuffs_base__count_leading_zeroes_u64((uint64_t)x);\n}\n\n// The ceil_div_pow2 functions return (x / (1 << n)), rounded up. Unlike\n// ((x + (1 << n) - 1) >> n), there is no intermediate overflow. Wuffs code\n// that calls these functions has proved that n is less than x's bit width.\n\nstatic inline uint8_t  //\nwuffs_base__u8__ceil_div_pow2(uint8_t x, uint32_t n) {\n  return (uint8_" +
+	"t)((x >> n) + ((x & ((((uint32_t)1) << n) - 1)) != 0));\n}\n\nstatic inline uint16_t  //\nwuffs_base__u16__ceil_div_pow2(uint16_t x, uint32_t n) {\n  return (uint16_t)((x >> n) + ((x & ((((uint32_t)1) << n) - 1)) != 0));\n}\n\nstatic inline uint32_t  //\nwuffs_base__u32__ceil_div_pow2(uint32_t x, uint32_t n) {\n  return (uint32_t)((x >> n) + ((x & ((((uint32_t)1) << n) - 1)) != 0));\n}\n\nstatic inline uint64_t  //\nwuffs_base__u64__ceil_div_pow2(uint64_t x, uint32_t n) {\n  return (uint64_t)((x >> n) + ((x & ((((uint64_t)1) << n) - 1)) != 0));\n}\n\n" +
+	"" +
+	"// --------\n\n// The peek and poke functions read and write N-bit unsigned integers, in\n// big-endian (be) or little-endian (le) order, without bounds checking. The\n// caller must ensure that the N/8 bytes starting at p are valid.\n//\n// Only the \"primitive\" 8, 16, 32 and 64 bit functions touch that memory. The\n// other widths (24, 40, 48 and 56 bits) are combinations of primitives, each\n// of which accesses exactly its own bytes. Those primitives are where\n// WUFFS_CONFIG__MEMCPY_PEEK_POKE applies.\n#if defined(WUFFS_CONFIG__MEMCPY_PEEK_POKE)\n#define WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(n) \\\n  uint8_t peek_poke_array[n];                 \\\n  memcpy(peek_poke_array, p, n);              \\\n  p = peek_poke_array\n#define WUFFS_BASE__PEEK_POKE__BEGIN_POKE(n) \\\n  uint8_t peek_poke_array[n];                 \\\n  uint8_t* peek_poke_dst = p;                 \\\n  p = peek_poke_array\n#define WUFFS_BASE__PEEK_POKE__END_POKE(n) memcpy(peek_poke_dst, p, n)\n#else\n#define WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(n)\n#define WUFFS_BASE__PEEK_" +
+	"POKE__BEGIN_POKE(n)\n#define WUFFS_BASE__PEEK_POKE__END_POKE(n)\n#endif  // defined(WUFFS_CONFIG__MEMCPY_PEEK_POKE)\n\n#define wuffs_base__peek_u8be__no_bounds_check \\\n  wuffs_base__peek_u8__no_bounds_check\n#define wuffs_base__peek_u8le__no_bounds_check \\\n  wuffs_base__peek_u8__no_bounds_check\n\nstatic inline uint8_t  //\nwuffs_base__peek_u8__no_bounds_check(const uint8_t* p) {\n  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(1);\n  return p[0];\n}\n\nstatic inline uint16_t  //\nwuffs_base__peek_u16be__no_bounds_check(const uint8_t* p) {\n  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(2);\n  return (uint16_t)(((uint16_t)(p[0]) << 8) | ((uint16_t)(p[1]) << 0));\n}\n\nstatic inline uint16_t  //\nwuffs_base__peek_u16le__no_bounds_check(const uint8_t* p) {\n  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(2);\n  return (uint16_t)(((uint16_t)(p[0]) << 0) | ((uint16_t)(p[1]) << 8));\n}\n\nstatic inline uint32_t  //\nwuffs_base__peek_u32be__no_bounds_check(const uint8_t* p) {\n  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(4);\n  return ((uint32_t)(p[0]) << 24) | ((uint32_t)(p[1]) << 16)" +
+	" |\n         ((uint32_t)(p[2]) << 8) | ((uint32_t)(p[3]) << 0);\n}\n\nstatic inline uint32_t  //\nwuffs_base__peek_u32le__no_bounds_check(const uint8_t* p) {\n  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(4);\n  return ((uint32_t)(p[0]) << 0) | ((uint32_t)(p[1]) << 8) |\n         ((uint32_t)(p[2]) << 16) | ((uint32_t)(p[3]) << 24);\n}\n\nstatic inline uint64_t  //\nwuffs_base__peek_u64be__no_bounds_check(const uint8_t* p) {\n  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(8);\n  return ((uint64_t)(p[0]) << 56) | ((uint64_t)(p[1]) << 48) |\n         ((uint64_t)(p[2]) << 40) | ((uint64_t)(p[3]) << 32) |\n         ((uint64_t)(p[4]) << 24) | ((uint64_t)(p[5]) << 16) |\n         ((uint64_t)(p[6]) << 8) | ((uint64_t)(p[7]) << 0);\n}\n\nstatic inline uint64_t  //\nwuffs_base__peek_u64le__no_bounds_check(const uint8_t* p) {\n  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(8);\n  return ((uint64_t)(p[0]) << 0) | ((uint64_t)(p[1]) << 8) |\n         ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 24) |\n         ((uint64_t)(p[4]) << 32) | ((uint64_t)(p[5]) << 40) |\n         ((u" +
+	"int64_t)(p[6]) << 48) | ((uint64_t)(p[7]) << 56);\n}\n\nstatic inline uint32_t  //\nwuffs_base__peek_u24be__no_bounds_check(const uint8_t* p) {\n  return ((uint32_t)(wuffs_base__peek_u16be__no_bounds_check(p)) << 8) |\n         ((uint32_t)(wuffs_base__peek_u8be__no_bounds_check(p + 2)) << 0);\n}\n\nstatic inline uint32_t  //\nwuffs_base__peek_u24le__no_bounds_check(const uint8_t* p) {\n  return ((uint32_t)(wuffs_base__peek_u16le__no_bounds_check(p)) << 0) |\n         ((uint32_t)(wuffs_base__peek_u8le__no_bounds_check(p + 2)) << 16);\n}\n\nstatic inline uint64_t  //\nwuffs_base__peek_u40be__no_bounds_check(const uint8_t* p) {\n  return ((uint64_t)(wuffs_base__peek_u32be__no_bounds_check(p)) << 8) |\n         ((uint64_t)(wuffs_base__peek_u8be__no_bounds_check(p + 4)) << 0);\n}\n\nstatic inline uint64_t  //\nwuffs_base__peek_u40le__no_bounds_check(const uint8_t* p) {\n  return ((uint64_t)(wuffs_base__peek_u32le__no_bounds_check(p)) << 0) |\n         ((uint64_t)(wuffs_base__peek_u8le__no_bounds_check(p + 4)) << 32);\n}\n\nstatic inline uin" +
+	"t64_t  //\nwuffs_base__peek_u48be__no_bounds_check(const uint8_t* p) {\n  return ((uint64_t)(wuffs_base__peek_u32be__no_bounds_check(p)) << 16) |\n         ((uint64_t)(wuffs_base__peek_u16be__no_bounds_check(p + 4)) << 0);\n}\n\nstatic inline uint64_t  //\nwuffs_base__peek_u48le__no_bounds_check(const uint8_t* p) {\n  return ((uint64_t)(wuffs_base__peek_u32le__no_bounds_check(p)) << 0) |\n         ((uint64_t)(wuffs_base__peek_u16le__no_bounds_check(p + 4)) << 32);\n}\n\nstatic inline uint64_t  //\nwuffs_base__peek_u56be__no_bounds_check(const uint8_t* p) {\n  return ((uint64_t)(wuffs_base__peek_u32be__no_bounds_check(p)) << 24) |\n         ((uint64_t)(wuffs_base__peek_u24be__no_bounds_check(p + 4)) << 0);\n}\n\nstatic inline uint64_t  //\nwuffs_base__peek_u56le__no_bounds_check(const uint8_t* p) {\n  return ((uint64_t)(wuffs_base__peek_u32le__no_bounds_check(p)) << 0) |\n         ((uint64_t)(wuffs_base__peek_u24le__no_bounds_check(p + 4)) << 32);\n}\n\n" +
 	"" +
-	"// --------\n\n#define wuffs_base__poke_u8be__no_bounds_check \\\n  wuffs_base__poke_u8__no_bounds_check\n#define wuffs_base__poke_u8le__no_bounds_check \\\n  wuffs_base__poke_u8__no_bounds_check\n\nstatic inline void  //\nwuffs_base__poke_u8__no_bounds_check(uint8_t* p, uint8_t x) {\n  p[0] = x;\n}\n\nstatic inline void  //\nwuffs_base__poke_u16be__no_bounds_check(uint8_t* p, uint16_t x) {\n  p[0] = (uint8_t)(x >> 8);\n  p[1] = (uint8_t)(x >> 0);\n}\n\nstatic inline void  //\nwuffs_base__poke_u16le__no_bounds_check(uint8_t* p, uint16_t x) {\n#if defined(__GNUC__) && !defined(__clang__) && defined(__x86_64__)\n  // This seems to perform better on gcc 10 (but not clang 9). Clang also\n  // defines \"__GNUC__\".\n  memcpy(p, &x, 2);\n#else\n  p[0] = (uint8_t)(x >> 0);\n  p[1] = (uint8_t)(x >> 8);\n#endif\n}\n\nstatic inline void  //\nwuffs_base__poke_u24be__no_bounds_check(uint8_t* p, uint32_t x) {\n  p[0] = (uint8_t)(x >> 16);\n  p[1] = (uint8_t)(x >> 8);\n  p[2] = (uint8_t)(x >> 0);\n}\n\nstatic inline void  //\nwuffs_base__poke_u24le__no_bounds_chec" +
-	"k(uint8_t* p, uint32_t x) {\n  p[0] = (uint8_t)(x >> 0);\n  p[1] = (uint8_t)(x >> 8);\n  p[2] = (uint8_t)(x >> 16);\n}\n\nstatic inline void  //\nwuffs_base__poke_u32be__no_bounds_check(uint8_t* p, uint32_t x) {\n  p[0] = (uint8_t)(x >> 24);\n  p[1] = (uint8_t)(x >> 16);\n  p[2] = (uint8_t)(x >> 8);\n  p[3] = (uint8_t)(x >> 0);\n}\n\nstatic inline void  //\nwuffs_base__poke_u32le__no_bounds_check(uint8_t* p, uint32_t x) {\n#if defined(__GNUC__) && !defined(__clang__) && defined(__x86_64__)\n  // This seems to perform better on gcc 10 (but not clang 9). Clang also\n  // defines \"__GNUC__\".\n  memcpy(p, &x, 4);\n#else\n  p[0] = (uint8_t)(x >> 0);\n  p[1] = (uint8_t)(x >> 8);\n  p[2] = (uint8_t)(x >> 16);\n  p[3] = (uint8_t)(x >> 24);\n#endif\n}\n\nstatic inline void  //\nwuffs_base__poke_u40be__no_bounds_check(uint8_t* p, uint64_t x) {\n  p[0] = (uint8_t)(x >> 32);\n  p[1] = (uint8_t)(x >> 24);\n  p[2] = (uint8_t)(x >> 16);\n  p[3] = (uint8_t)(x >> 8);\n  p[4] = (uint8_t)(x >> 0);\n}\n\nstatic inline void  //\nwuffs_base__poke_u40le__no_bounds_chec" +
-	"k(uint8_t* p, uint64_t x) {\n  p[0] = (uint8_t)(x >> 0);\n  p[1] = (uint8_t)(x >> 8);\n  p[2] = (uint8_t)(x >> 16);\n  p[3] = (uint8_t)(x >> 24);\n  p[4] = (uint8_t)(x >> 32);\n}\n\nstatic inline void  //\nwuffs_base__poke_u48be__no_bounds_check(uint8_t* p, uint64_t x) {\n  p[0] = (uint8_t)(x >> 40);\n  p[1] = (uint8_t)(x >> 32);\n  p[2] = (uint8_t)(x >> 24);\n  p[3] = (uint8_t)(x >> 16);\n  p[4] = (uint8_t)(x >> 8);\n  p[5] = (uint8_t)(x >> 0);\n}\n\nstatic inline void  //\nwuffs_base__poke_u48le__no_bounds_check(uint8_t* p, uint64_t x) {\n  p[0] = (uint8_t)(x >> 0);\n  p[1] = (uint8_t)(x >> 8);\n  p[2] = (uint8_t)(x >> 16);\n  p[3] = (uint8_t)(x >> 24);\n  p[4] = (uint8_t)(x >> 32);\n  p[5] = (uint8_t)(x >> 40);\n}\n\nstatic inline void  //\nwuffs_base__poke_u56be__no_bounds_check(uint8_t* p, uint64_t x) {\n  p[0] = (uint8_t)(x >> 48);\n  p[1] = (uint8_t)(x >> 40);\n  p[2] = (uint8_t)(x >> 32);\n  p[3] = (uint8_t)(x >> 24);\n  p[4] = (uint8_t)(x >> 16);\n  p[5] = (uint8_t)(x >> 8);\n  p[6] = (uint8_t)(x >> 0);\n}\n\nstatic inline void  //\nwuffs_" +
-	"base__poke_u56le__no_bounds_check(uint8_t* p, uint64_t x) {\n  p[0] = (uint8_t)(x >> 0);\n  p[1] = (uint8_t)(x >> 8);\n  p[2] = (uint8_t)(x >> 16);\n  p[3] = (uint8_t)(x >> 24);\n  p[4] = (uint8_t)(x >> 32);\n  p[5] = (uint8_t)(x >> 40);\n  p[6] = (uint8_t)(x >> 48);\n}\n\nstatic inline void  //\nwuffs_base__poke_u64be__no_bounds_check(uint8_t* p, uint64_t x) {\n  p[0] = (uint8_t)(x >> 56);\n  p[1] = (uint8_t)(x >> 48);\n  p[2] = (uint8_t)(x >> 40);\n  p[3] = (uint8_t)(x >> 32);\n  p[4] = (uint8_t)(x >> 24);\n  p[5] = (uint8_t)(x >> 16);\n  p[6] = (uint8_t)(x >> 8);\n  p[7] = (uint8_t)(x >> 0);\n}\n\nstatic inline void  //\nwuffs_base__poke_u64le__no_bounds_check(uint8_t* p, uint64_t x) {\n#if defined(__GNUC__) && !defined(__clang__) && defined(__x86_64__)\n  // This seems to perform better on gcc 10 (but not clang 9). Clang also\n  // defines \"__GNUC__\".\n  memcpy(p, &x, 8);\n#else\n  p[0] = (uint8_t)(x >> 0);\n  p[1] = (uint8_t)(x >> 8);\n  p[2] = (uint8_t)(x >> 16);\n  p[3] = (uint8_t)(x >> 24);\n  p[4] = (uint8_t)(x >> 32);\n  p[5] = (uin" +
-	"t8_t)(x >> 40);\n  p[6] = (uint8_t)(x >> 48);\n  p[7] = (uint8_t)(x >> 56);\n#endif\n}\n\n" +
+	"// --------\n\n#define wuffs_base__poke_u8be__no_bounds_check \\\n  wuffs_base__poke_u8__no_bounds_check\n#define wuffs_base__poke_u8le__no_bounds_check \\\n  wuffs_base__poke_u8__no_bounds_check\n\nstatic inline void  //\nwuffs_base__poke_u8__no_bounds_check(uint8_t* p, uint8_t x) {\n  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(1);\n  p[0] = x;\n  WUFFS_BASE__PEEK_POKE__END_POKE(1);\n}\n\nstatic inline void  //\nwuffs_base__poke_u16be__no_bounds_check(uint8_t* p, uint16_t x) {\n  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(2);\n  p[0] = (uint8_t)(x >> 8);\n  p[1] = (uint8_t)(x >> 0);\n  WUFFS_BASE__PEEK_POKE__END_POKE(2);\n}\n\nstatic inline void  //\nwuffs_base__poke_u16le__no_bounds_check(uint8_t* p, uint16_t x) {\n#if defined(__GNUC__) && !defined(__clang__) && defined(__x86_64__)\n  // This seems to perform better on gcc 10 (but not clang 9). Clang also\n  // defines \"__GNUC__\".\n  memcpy(p, &x, 2);\n#else\n  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(2);\n  p[0] = (uint8_t)(x >> 0);\n  p[1] = (uint8_t)(x >> 8);\n  WUFFS_BASE__PEEK_POKE__END_POKE(2);\n#endif\n}\n\nstat" +
+	"ic inline void  //\nwuffs_base__poke_u32be__no_bounds_check(uint8_t* p, uint32_t x) {\n  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(4);\n  p[0] = (uint8_t)(x >> 24);\n  p[1] = (uint8_t)(x >> 16);\n  p[2] = (uint8_t)(x >> 8);\n  p[3] = (uint8_t)(x >> 0);\n  WUFFS_BASE__PEEK_POKE__END_POKE(4);\n}\n\nstatic inline void  //\nwuffs_base__poke_u32le__no_bounds_check(uint8_t* p, uint32_t x) {\n#if defined(__GNUC__) && !defined(__clang__) && defined(__x86_64__)\n  // This seems to perform better on gcc 10 (but not clang 9). Clang also\n  // defines \"__GNUC__\".\n  memcpy(p, &x, 4);\n#else\n  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(4);\n  p[0] = (uint8_t)(x >> 0);\n  p[1] = (uint8_t)(x >> 8);\n  p[2] = (uint8_t)(x >> 16);\n  p[3] = (uint8_t)(x >> 24);\n  WUFFS_BASE__PEEK_POKE__END_POKE(4);\n#endif\n}\n\nstatic inline void  //\nwuffs_base__poke_u64be__no_bounds_check(uint8_t* p, uint64_t x) {\n  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(8);\n  p[0] = (uint8_t)(x >> 56);\n  p[1] = (uint8_t)(x >> 48);\n  p[2] = (uint8_t)(x >> 40);\n  p[3] = (uint8_t)(x >> 32);\n  p[4] = (uint8" +
+	"_t)(x >> 24);\n  p[5] = (uint8_t)(x >> 16);\n  p[6] = (uint8_t)(x >> 8);\n  p[7] = (uint8_t)(x >> 0);\n  WUFFS_BASE__PEEK_POKE__END_POKE(8);\n}\n\nstatic inline void  //\nwuffs_base__poke_u64le__no_bounds_check(uint8_t* p, uint64_t x) {\n#if defined(__GNUC__) && !defined(__clang__) && defined(__x86_64__)\n  // This seems to perform better on gcc 10 (but not clang 9). Clang also\n  // defines \"__GNUC__\".\n  memcpy(p, &x, 8);\n#else\n  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(8);\n  p[0] = (uint8_t)(x >> 0);\n  p[1] = (uint8_t)(x >> 8);\n  p[2] = (uint8_t)(x >> 16);\n  p[3] = (uint8_t)(x >> 24);\n  p[4] = (uint8_t)(x >> 32);\n  p[5] = (uint8_t)(x >> 40);\n  p[6] = (uint8_t)(x >> 48);\n  p[7] = (uint8_t)(x >> 56);\n  WUFFS_BASE__PEEK_POKE__END_POKE(8);\n#endif\n}\n\nstatic inline void  //\nwuffs_base__poke_u24be__no_bounds_check(uint8_t* p, uint32_t x) {\n  wuffs_base__poke_u16be__no_bounds_check(p, (uint16_t)(x >> 8));\n  wuffs_base__poke_u8be__no_bounds_check(p + 2, (uint8_t)(x >> 0));\n}\n\nstatic inline void  //\nwuffs_base__poke_u24le__no_bounds_c" +
+	"heck(uint8_t* p, uint32_t x) {\n  wuffs_base__poke_u16le__no_bounds_check(p, (uint16_t)(x >> 0));\n  wuffs_base__poke_u8le__no_bounds_check(p + 2, (uint8_t)(x >> 16));\n}\n\nstatic inline void  //\nwuffs_base__poke_u40be__no_bounds_check(uint8_t* p, uint64_t x) {\n  wuffs_base__poke_u32be__no_bounds_check(p, (uint32_t)(x >> 8));\n  wuffs_base__poke_u8be__no_bounds_check(p + 4, (uint8_t)(x >> 0));\n}\n\nstatic inline void  //\nwuffs_base__poke_u40le__no_bounds_check(uint8_t* p, uint64_t x) {\n  wuffs_base__poke_u32le__no_bounds_check(p, (uint32_t)(x >> 0));\n  wuffs_base__poke_u8le__no_bounds_check(p + 4, (uint8_t)(x >> 32));\n}\n\nstatic inline void  //\nwuffs_base__poke_u48be__no_bounds_check(uint8_t* p, uint64_t x) {\n  wuffs_base__poke_u32be__no_bounds_check(p, (uint32_t)(x >> 16));\n  wuffs_base__poke_u16be__no_bounds_check(p + 4, (uint16_t)(x >> 0));\n}\n\nstatic inline void  //\nwuffs_base__poke_u48le__no_bounds_check(uint8_t* p, uint64_t x) {\n  wuffs_base__poke_u32le__no_bounds_check(p, (uint32_t)(x >> 0));\n  wuffs_base__poke" +
+	"_u16le__no_bounds_check(p + 4, (uint16_t)(x >> 32));\n}\n\nstatic inline void  //\nwuffs_base__poke_u56be__no_bounds_check(uint8_t* p, uint64_t x) {\n  wuffs_base__poke_u32be__no_bounds_check(p, (uint32_t)(x >> 24));\n  wuffs_base__poke_u24be__no_bounds_check(p + 4, (uint32_t)(x >> 0));\n}\n\nstatic inline void  //\nwuffs_base__poke_u56le__no_bounds_check(uint8_t* p, uint64_t x) {\n  wuffs_base__poke_u32le__no_bounds_check(p, (uint32_t)(x >> 0));\n  wuffs_base__poke_u24le__no_bounds_check(p + 4, (uint32_t)(x >> 32));\n}\n\n" +
+	"" +
+	"// --------\n\n// With C11, the wuffs_base__peek_be__no_bounds_check (and _le) macros pick the\n// width from a type, one of uint8_t, uint16_t, uint32_t or uint64_t, and the\n// wuffs_base__poke_be__no_bounds_check (and _le) macros pick the width from\n// the type of x. Other types, including int, fail to compile. For example:\n//\n//  uint32_t x = wuffs_base__peek_le__no_bounds_check(p, uint32_t);\n//  wuffs_base__poke_be__no_bounds_check(q, x);\n#if defined(__STDC_VERSION__) && (__STDC_VERSION__ >= 201112L) && \\\n    !defined(__cplusplus)\n#define wuffs_base__peek_be__no_bounds_check(p, T)               \\\n  _Generic((T)0,                                                 \\\n           uint8_t: wuffs_base__peek_u8be__no_bounds_check,      \\\n           uint16_t: wuffs_base__peek_u16be__no_bounds_check,    \\\n           uint32_t: wuffs_base__peek_u32be__no_bounds_check,    \\\n           uint64_t: wuffs_base__peek_u64be__no_bounds_check)(p)\n#define wuffs_base__peek_le__no_bounds_check(p, T)               \\\n  _Generic((T)0,    " +
+	"                                             \\\n           uint8_t: wuffs_base__peek_u8le__no_bounds_check,      \\\n           uint16_t: wuffs_base__peek_u16le__no_bounds_check,    \\\n           uint32_t: wuffs_base__peek_u32le__no_bounds_check,    \\\n           uint64_t: wuffs_base__peek_u64le__no_bounds_check)(p)\n#define wuffs_base__poke_be__no_bounds_check(p, x)                  \\\n  _Generic((x),                                                     \\\n           uint8_t: wuffs_base__poke_u8be__no_bounds_check,         \\\n           uint16_t: wuffs_base__poke_u16be__no_bounds_check,       \\\n           uint32_t: wuffs_base__poke_u32be__no_bounds_check,       \\\n           uint64_t: wuffs_base__poke_u64be__no_bounds_check)(p, x)\n#define wuffs_base__poke_le__no_bounds_check(p, x)                  \\\n  _Generic((x),                                                     \\\n           uint8_t: wuffs_base__poke_u8le__no_bounds_check,         \\\n           uint16_t: wuffs_base__poke_u16le__no_bounds_check,       \\\n           ui" +
+	"nt32_t: wuffs_base__poke_u32le__no_bounds_check,       \\\n           uint64_t: wuffs_base__poke_u64le__no_bounds_check)(p, x)\n#endif  // __STDC_VERSION__ >= 201112L && !defined(__cplusplus)\n\n" +
 	"" +
 	"// --------\n\n// Load and Store functions are deprecated. Use Peek and Poke instead.\n\n#define wuffs_base__load_u8__no_bounds_check \\\n  wuffs_base__peek_u8__no_bounds_check\n#define wuffs_base__load_u16be__no_bounds_check \\\n  wuffs_base__peek_u16be__no_bounds_check\n#define wuffs_base__load_u16le__no_bounds_check \\\n  wuffs_base__peek_u16le__no_bounds_check\n#define wuffs_base__load_u24be__no_bounds_check \\\n  wuffs_base__peek_u24be__no_bounds_check\n#define wuffs_base__load_u24le__no_bounds_check \\\n  wuffs_base__peek_u24le__no_bounds_check\n#define wuffs_base__load_u32be__no_bounds_check \\\n  wuffs_base__peek_u32be__no_bounds_check\n#define wuffs_base__load_u32le__no_bounds_check \\\n  wuffs_base__peek_u32le__no_bounds_check\n#define wuffs_base__load_u40be__no_bounds_check \\\n  wuffs_base__peek_u40be__no_bounds_check\n#define wuffs_base__load_u40le__no_bounds_check \\\n  wuffs_base__peek_u40le__no_bounds_check\n#define wuffs_base__load_u48be__no_bounds_check \\\n  wuffs_base__peek_u48be__no_bounds_check\n#define wuffs_base__load_" +
 	"u48le__no_bounds_check \\\n  wuffs_base__peek_u48le__no_bounds_check\n#define wuffs_base__load_u56be__no_bounds_check \\\n  wuffs_base__peek_u56be__no_bounds_check\n#define wuffs_base__load_u56le__no_bounds_check \\\n  wuffs_base__peek_u56le__no_bounds_check\n#define wuffs_base__load_u64be__no_bounds_check \\\n  wuffs_base__peek_u64be__no_bounds_check\n#define wuffs_base__load_u64le__no_bounds_check \\\n  wuffs_base__peek_u64le__no_bounds_check\n\n#define wuffs_base__store_u8__no_bounds_check \\\n  wuffs_base__poke_u8__no_bounds_check\n#define wuffs_base__store_u16be__no_bounds_check \\\n  wuffs_base__poke_u16be__no_bounds_check\n#define wuffs_base__store_u16le__no_bounds_check \\\n  wuffs_base__poke_u16le__no_bounds_check\n#define wuffs_base__store_u24be__no_bounds_check \\\n  wuffs_base__poke_u24be__no_bounds_check\n#define wuffs_base__store_u24le__no_bounds_check \\\n  wuffs_base__poke_u24le__no_bounds_check\n#define wuffs_base__store_u32be__no_bounds_check \\\n  wuffs_base__poke_u32be__no_bounds_check\n#define wuffs_base__store_u32le__no_" +
 	"bounds_check \\\n  wuffs_base__poke_u32le__no_bounds_check\n#define wuffs_base__store_u40be__no_bounds_check \\\n  wuffs_base__poke_u40be__no_bounds_check\n#define wuffs_base__store_u40le__no_bounds_check \\\n  wuffs_base__poke_u40le__no_bounds_check\n#define wuffs_base__store_u48be__no_bounds_check \\\n  wuffs_base__poke_u48be__no_bounds_check\n#define wuffs_base__store_u48le__no_bounds_check \\\n  wuffs_base__poke_u48le__no_bounds_check\n#define wuffs_base__store_u56be__no_bounds_check \\\n  wuffs_base__poke_u56be__no_bounds_check\n#define wuffs_base__store_u56le__no_bounds_check \\\n  wuffs_base__poke_u56le__no_bounds_check\n#define wuffs_base__store_u64be__no_bounds_check \\\n  wuffs_base__poke_u64be__no_bounds_check\n#define wuffs_base__store_u64le__no_bounds_check \\\n  wuffs_base__poke_u64le__no_bounds_check\n\n" +
 	"" +
 	"// ---------------- Slices and Tables\n\n// WUFFS_BASE__SLICE is a 1-dimensional buffer.\n//\n// len measures a number of elements, not necessarily a size in bytes.\n//\n// A value with all fields NULL or zero is a valid, empty slice.\n#define WUFFS_BASE__SLICE(T) \\\n  struct {                   \\\n    T* ptr;                  \\\n    size_t len;              \\\n  }\n\n// WUFFS_BASE__TABLE is a 2-dimensional buffer.\n//\n// width, height and stride measure a number of elements, not necessarily a\n// size in bytes.\n//\n// A value with all fields NULL or zero is a valid, empty table.\n#define WUFFS_BASE__TABLE(T) \\\n  struct {                   \\\n    T* ptr;                  \\\n    size_t width;            \\\n    size_t height;           \\\n    size_t stride;           \\\n  }\n\ntypedef WUFFS_BASE__SLICE(uint8_t) wuffs_base__slice_u8;\ntypedef WUFFS_BASE__SLICE(uint16_t) wuffs_base__slice_u16;\ntypedef WUFFS_BASE__SLICE(uint32_t) wuffs_base__slice_u32;\ntypedef WUFFS_BASE__SLICE(uint64_t) wuffs_base__slice_u64;\n\ntypedef WUFFS_BASE__TABLE(u" +
-	"int8_t) wuffs_base__table_u8;\ntypedef WUFFS_BASE__TABLE(uint16_t) wuffs_base__table_u16;\ntypedef WUFFS_BASE__TABLE(uint32_t) wuffs_base__table_u32;\ntypedef WUFFS_BASE__TABLE(uint64_t) wuffs_base__table_u64;\n\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__make_slice_u8(uint8_t* ptr, size_t len) {\n  wuffs_base__slice_u8 ret;\n  ret.ptr = ptr;\n  ret.len = len;\n  return ret;\n}\n\nstatic inline wuffs_base__slice_u16  //\nwuffs_base__make_slice_u16(uint16_t* ptr, size_t len) {\n  wuffs_base__slice_u16 ret;\n  ret.ptr = ptr;\n  ret.len = len;\n  return ret;\n}\n\nstatic inline wuffs_base__slice_u32  //\nwuffs_base__make_slice_u32(uint32_t* ptr, size_t len) {\n  wuffs_base__slice_u32 ret;\n  ret.ptr = ptr;\n  ret.len = len;\n  return ret;\n}\n\nstatic inline wuffs_base__slice_u64  //\nwuffs_base__make_slice_u64(uint64_t* ptr, size_t len) {\n  wuffs_base__slice_u64 ret;\n  ret.ptr = ptr;\n  ret.len = len;\n  return ret;\n}\n\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__empty_slice_u8() {\n  wuffs_base__slice_u8 ret;\n  ret.ptr = NULL;\n" +
-	"  ret.len = 0;\n  return ret;\n}\n\nstatic inline wuffs_base__slice_u16  //\nwuffs_base__empty_slice_u16() {\n  wuffs_base__slice_u16 ret;\n  ret.ptr = NULL;\n  ret.len = 0;\n  return ret;\n}\n\nstatic inline wuffs_base__slice_u32  //\nwuffs_base__empty_slice_u32() {\n  wuffs_base__slice_u32 ret;\n  ret.ptr = NULL;\n  ret.len = 0;\n  return ret;\n}\n\nstatic inline wuffs_base__slice_u64  //\nwuffs_base__empty_slice_u64() {\n  wuffs_base__slice_u64 ret;\n  ret.ptr = NULL;\n  ret.len = 0;\n  return ret;\n}\n\nstatic inline wuffs_base__table_u8  //\nwuffs_base__make_table_u8(uint8_t* ptr,\n                          size_t width,\n                          size_t height,\n                          size_t stride) {\n  wuffs_base__table_u8 ret;\n  ret.ptr = ptr;\n  ret.width = width;\n  ret.height = height;\n  ret.stride = stride;\n  return ret;\n}\n\nstatic inline wuffs_base__table_u16  //\nwuffs_base__make_table_u16(uint16_t* ptr,\n                           size_t width,\n                           size_t height,\n                           size_t stride) " +
-	"{\n  wuffs_base__table_u16 ret;\n  ret.ptr = ptr;\n  ret.width = width;\n  ret.height = height;\n  ret.stride = stride;\n  return ret;\n}\n\nstatic inline wuffs_base__table_u32  //\nwuffs_base__make_table_u32(uint32_t* ptr,\n                           size_t width,\n                           size_t height,\n                           size_t stride) {\n  wuffs_base__table_u32 ret;\n  ret.ptr = ptr;\n  ret.width = width;\n  ret.height = height;\n  ret.stride = stride;\n  return ret;\n}\n\nstatic inline wuffs_base__table_u64  //\nwuffs_base__make_table_u64(uint64_t* ptr,\n                           size_t width,\n                           size_t height,\n                           size_t stride) {\n  wuffs_base__table_u64 ret;\n  ret.ptr = ptr;\n  ret.width = width;\n  ret.height = height;\n  ret.stride = stride;\n  return ret;\n}\n\nstatic inline wuffs_base__table_u8  //\nwuffs_base__empty_table_u8() {\n  wuffs_base__table_u8 ret;\n  ret.ptr = NULL;\n  ret.width = 0;\n  ret.height = 0;\n  ret.stride = 0;\n  return ret;\n}\n\nstatic inline wuffs_base__ta" +
-	"ble_u16  //\nwuffs_base__empty_table_u16() {\n  wuffs_base__table_u16 ret;\n  ret.ptr = NULL;\n  ret.width = 0;\n  ret.height = 0;\n  ret.stride = 0;\n  return ret;\n}\n\nstatic inline wuffs_base__table_u32  //\nwuffs_base__empty_table_u32() {\n  wuffs_base__table_u32 ret;\n  ret.ptr = NULL;\n  ret.width = 0;\n  ret.height = 0;\n  ret.stride = 0;\n  return ret;\n}\n\nstatic inline wuffs_base__table_u64  //\nwuffs_base__empty_table_u64() {\n  wuffs_base__table_u64 ret;\n  ret.ptr = NULL;\n  ret.width = 0;\n  ret.height = 0;\n  ret.stride = 0;\n  return ret;\n}\n\nstatic inline bool  //\nwuffs_base__slice_u8__overlaps(wuffs_base__slice_u8 s, wuffs_base__slice_u8 t) {\n  return ((s.ptr <= t.ptr) && (t.ptr < (s.ptr + s.len))) ||\n         ((t.ptr <= s.ptr) && (s.ptr < (t.ptr + t.len)));\n}\n\n// wuffs_base__slice_u8__subslice_i returns s[i:].\n//\n// It returns an empty slice if i is out of bounds.\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__slice_u8__subslice_i(wuffs_base__slice_u8 s, uint64_t i) {\n  if ((i <= SIZE_MAX) && (i <= s.len)) {\n   " +
-	" return wuffs_base__make_slice_u8(s.ptr + i, ((size_t)(s.len - i)));\n  }\n  return wuffs_base__make_slice_u8(NULL, 0);\n}\n\n// wuffs_base__slice_u8__subslice_j returns s[:j].\n//\n// It returns an empty slice if j is out of bounds.\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__slice_u8__subslice_j(wuffs_base__slice_u8 s, uint64_t j) {\n  if ((j <= SIZE_MAX) && (j <= s.len)) {\n    return wuffs_base__make_slice_u8(s.ptr, ((size_t)j));\n  }\n  return wuffs_base__make_slice_u8(NULL, 0);\n}\n\n// wuffs_base__slice_u8__subslice_ij returns s[i:j].\n//\n// It returns an empty slice if i or j is out of bounds.\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__slice_u8__subslice_ij(wuffs_base__slice_u8 s,\n                                  uint64_t i,\n                                  uint64_t j) {\n  if ((i <= j) && (j <= SIZE_MAX) && (j <= s.len)) {\n    return wuffs_base__make_slice_u8(s.ptr + i, ((size_t)(j - i)));\n  }\n  return wuffs_base__make_slice_u8(NULL, 0);\n}\n\n// wuffs_base__table__flattened_length returns the number o" +
-	"f elements covered\n// by the 1-dimensional span that backs a 2-dimensional table. This counts the\n// elements inside the table and, when width != stride, the elements outside\n// the table but between its rows.\n//\n// For example, consider a width 10, height 4, stride 10 table. Mark its first\n// and last (inclusive) elements with 'a' and 'z'. This function returns 40.\n//\n//    a123456789\n//    0123456789\n//    0123456789\n//    012345678z\n//\n// Now consider the sub-table of that from (2, 1) inclusive to (8, 4) exclusive.\n//\n//    a123456789\n//    01iiiiiioo\n//    ooiiiiiioo\n//    ooiiiiii8z\n//\n// This function (called with width 6, height 3, stride 10) returns 26: 18 'i'\n// inside elements plus 8 'o' outside elements. Note that 26 is less than a\n// naive (height * stride = 30) computation. Indeed, advancing 29 elements from\n// the first 'i' would venture past 'z', out of bounds of the original table.\n//\n// It does not check for overflow, but if the arguments come from a table that\n// exists in memory and each el" +
-	"ement occupies a positive number of bytes then\n// the result should be bounded by the amount of allocatable memory (which\n// shouldn't overflow SIZE_MAX).\nstatic inline size_t  //\nwuffs_base__table__flattened_length(size_t width,\n                                    size_t height,\n                                    size_t stride) {\n  if (height == 0) {\n    return 0;\n  }\n  return ((height - 1) * stride) + width;\n}\n\n" +
+	"int8_t) wuffs_base__table_u8;\ntypedef WUFFS_BASE__TABLE(uint16_t) wuffs_base__table_u16;\ntypedef WUFFS_BASE__TABLE(uint32_t) wuffs_base__table_u32;\ntypedef WUFFS_BASE__TABLE(uint64_t) wuffs_base__table_u64;\n\nWUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__slice_u8, ptr) == 0,\n                          slice_u8_ptr_offset);\nWUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__slice_u8, len) ==\n                              sizeof(uint8_t*),\n                          slice_u8_len_offset);\nWUFFS_BASE__STATIC_ASSERT(sizeof(wuffs_base__slice_u8) ==\n                              (sizeof(uint8_t*) + sizeof(size_t)),\n                          slice_u8_sizeof);\nWUFFS_BASE__STATIC_ASSERT(sizeof(wuffs_base__table_u8) ==\n                              (sizeof(uint8_t*) + (3 * sizeof(size_t))),\n                          table_u8_sizeof);\n\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__make_slice_u8(uint8_t* ptr, size_t len) {\n  wuffs_base__slice_u8 ret;\n  ret.ptr = ptr;\n  ret.len = len;\n  return ret;\n}\n\nstatic inline wuffs_ba" +
+	"se__slice_u16  //\nwuffs_base__make_slice_u16(uint16_t* ptr, size_t len) {\n  wuffs_base__slice_u16 ret;\n  ret.ptr = ptr;\n  ret.len = len;\n  return ret;\n}\n\nstatic inline wuffs_base__slice_u32  //\nwuffs_base__make_slice_u32(uint32_t* ptr, size_t len) {\n  wuffs_base__slice_u32 ret;\n  ret.ptr = ptr;\n  ret.len = len;\n  return ret;\n}\n\nstatic inline wuffs_base__slice_u64  //\nwuffs_base__make_slice_u64(uint64_t* ptr, size_t len) {\n  wuffs_base__slice_u64 ret;\n  ret.ptr = ptr;\n  ret.len = len;\n  return ret;\n}\n\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__empty_slice_u8() {\n  wuffs_base__slice_u8 ret;\n  ret.ptr = NULL;\n  ret.len = 0;\n  return ret;\n}\n\nstatic inline wuffs_base__slice_u16  //\nwuffs_base__empty_slice_u16() {\n  wuffs_base__slice_u16 ret;\n  ret.ptr = NULL;\n  ret.len = 0;\n  return ret;\n}\n\nstatic inline wuffs_base__slice_u32  //\nwuffs_base__empty_slice_u32() {\n  wuffs_base__slice_u32 ret;\n  ret.ptr = NULL;\n  ret.len = 0;\n  return ret;\n}\n\nstatic inline wuffs_base__slice_u64  //\nwuffs_base__empty_slice_u64(" +
+	") {\n  wuffs_base__slice_u64 ret;\n  ret.ptr = NULL;\n  ret.len = 0;\n  return ret;\n}\n\nstatic inline wuffs_base__table_u8  //\nwuffs_base__make_table_u8(uint8_t* ptr,\n                          size_t width,\n                          size_t height,\n                          size_t stride) {\n  wuffs_base__table_u8 ret;\n  ret.ptr = ptr;\n  ret.width = width;\n  ret.height = height;\n  ret.stride = stride;\n  return ret;\n}\n\nstatic inline wuffs_base__table_u16  //\nwuffs_base__make_table_u16(uint16_t* ptr,\n                           size_t width,\n                           size_t height,\n                           size_t stride) {\n  wuffs_base__table_u16 ret;\n  ret.ptr = ptr;\n  ret.width = width;\n  ret.height = height;\n  ret.stride = stride;\n  return ret;\n}\n\nstatic inline wuffs_base__table_u32  //\nwuffs_base__make_table_u32(uint32_t* ptr,\n                           size_t width,\n                           size_t height,\n                           size_t stride) {\n  wuffs_base__table_u32 ret;\n  ret.ptr = ptr;\n  ret.width = w" +
+	"idth;\n  ret.height = height;\n  ret.stride = stride;\n  return ret;\n}\n\nstatic inline wuffs_base__table_u64  //\nwuffs_base__make_table_u64(uint64_t* ptr,\n                           size_t width,\n                           size_t height,\n                           size_t stride) {\n  wuffs_base__table_u64 ret;\n  ret.ptr = ptr;\n  ret.width = width;\n  ret.height = height;\n  ret.stride = stride;\n  return ret;\n}\n\nstatic inline wuffs_base__table_u8  //\nwuffs_base__empty_table_u8() {\n  wuffs_base__table_u8 ret;\n  ret.ptr = NULL;\n  ret.width = 0;\n  ret.height = 0;\n  ret.stride = 0;\n  return ret;\n}\n\nstatic inline wuffs_base__table_u16  //\nwuffs_base__empty_table_u16() {\n  wuffs_base__table_u16 ret;\n  ret.ptr = NULL;\n  ret.width = 0;\n  ret.height = 0;\n  ret.stride = 0;\n  return ret;\n}\n\nstatic inline wuffs_base__table_u32  //\nwuffs_base__empty_table_u32() {\n  wuffs_base__table_u32 ret;\n  ret.ptr = NULL;\n  ret.width = 0;\n  ret.height = 0;\n  ret.stride = 0;\n  return ret;\n}\n\nstatic inline wuffs_base__table_u64  //\nwuffs_base__" +
+	"empty_table_u64() {\n  wuffs_base__table_u64 ret;\n  ret.ptr = NULL;\n  ret.width = 0;\n  ret.height = 0;\n  ret.stride = 0;\n  return ret;\n}\n\nstatic inline bool  //\nwuffs_base__slice_u8__overlaps(wuffs_base__slice_u8 s, wuffs_base__slice_u8 t) {\n  return ((s.ptr <= t.ptr) && (t.ptr < (s.ptr + s.len))) ||\n         ((t.ptr <= s.ptr) && (s.ptr < (t.ptr + t.len)));\n}\n\n// wuffs_base__slice_u8__subslice_i returns s[i:].\n//\n// It returns an empty slice if i is out of bounds.\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__slice_u8__subslice_i(wuffs_base__slice_u8 s, uint64_t i) {\n  if ((i <= SIZE_MAX) && (i <= s.len)) {\n    return wuffs_base__make_slice_u8(s.ptr + i, ((size_t)(s.len - i)));\n  }\n  return wuffs_base__make_slice_u8(NULL, 0);\n}\n\n// wuffs_base__slice_u8__subslice_j returns s[:j].\n//\n// It returns an empty slice if j is out of bounds.\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__slice_u8__subslice_j(wuffs_base__slice_u8 s, uint64_t j) {\n  if ((j <= SIZE_MAX) && (j <= s.len)) {\n    return wuffs_base__m" +
+	"ake_slice_u8(s.ptr, ((size_t)j));\n  }\n  return wuffs_base__make_slice_u8(NULL, 0);\n}\n\n// wuffs_base__slice_u8__subslice_ij returns s[i:j].\n//\n// It returns an empty slice if i or j is out of bounds.\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__slice_u8__subslice_ij(wuffs_base__slice_u8 s,\n                                  uint64_t i,\n                                  uint64_t j) {\n  if ((i <= j) && (j <= SIZE_MAX) && (j <= s.len)) {\n    return wuffs_base__make_slice_u8(s.ptr + i, ((size_t)(j - i)));\n  }\n  return wuffs_base__make_slice_u8(NULL, 0);\n}\n\n// wuffs_base__table__flattened_length returns the number of elements covered\n// by the 1-dimensional span that backs a 2-dimensional table. This counts the\n// elements inside the table and, when width != stride, the elements outside\n// the table but between its rows.\n//\n// For example, consider a width 10, height 4, stride 10 table. Mark its first\n// and last (inclusive) elements with 'a' and 'z'. This function returns 40.\n//\n//    a123456789\n//    0123456" +
+	"789\n//    0123456789\n//    012345678z\n//\n// Now consider the sub-table of that from (2, 1) inclusive to (8, 4) exclusive.\n//\n//    a123456789\n//    01iiiiiioo\n//    ooiiiiiioo\n//    ooiiiiii8z\n//\n// This function (called with width 6, height 3, stride 10) returns 26: 18 'i'\n// inside elements plus 8 'o' outside elements. Note that 26 is less than a\n// naive (height * stride = 30) computation. Indeed, advancing 29 elements from\n// the first 'i' would venture past 'z', out of bounds of the original table.\n//\n// It does not check for overflow, but if the arguments come from a table that\n// exists in memory and each element occupies a positive number of bytes then\n// the result should be bounded by the amount of allocatable memory (which\n// shouldn't overflow SIZE_MAX).\nstatic inline size_t  //\nwuffs_base__table__flattened_length(size_t width,\n                                    size_t height,\n                                    size_t stride) {\n  if (height == 0) {\n    return 0;\n  }\n  return ((height - 1) * stri" +
+	"de) + width;\n}\n\n" +
 	"" +
 	"// ---------------- Magic Numbers\n\n// wuffs_base__magic_number_guess_fourcc guesses the file format of some data,\n// given its opening bytes. It returns a positive FourCC value on success.\n//\n// It returns zero if nothing matches its hard-coded list of 'magic numbers'.\n//\n// It returns a negative value if a longer prefix is required for a conclusive\n// result. For example, seeing a single 'B' byte is not enough to discriminate\n// the BMP and BPG image file formats.\n//\n// It does not do a full validity check. Like any guess made from a short\n// prefix of the data, it may return false positives. Data that starts with 99\n// bytes of valid JPEG followed by corruption or truncation is an invalid JPEG\n// image overall, but this function will still return WUFFS_BASE__FOURCC__JPEG.\n//\n// Another source of false positives is that some 'magic numbers' are valid\n// ASCII data. A file starting with \"GIF87a and GIF89a are the two versions of\n// GIF\" will match GIF's 'magic number' even if it's plain text, not an image.\n//" +
 	"\n// For modular builds that divide the base module into sub-modules, using this\n// function requires the WUFFS_CONFIG__MODULE__BASE__MAGIC sub-module, not just\n// WUFFS_CONFIG__MODULE__BASE__CORE.\nWUFFS_BASE__MAYBE_STATIC int32_t  //\nwuffs_base__magic_number_guess_fourcc(wuffs_base__slice_u8 prefix);\n" +
@@ -130,7 +181,11 @@ const BaseMemoryPrivateH = "" +
 const BaseMemoryPublicH = "" +
 	"// ---------------- Memory Allocation\n\n// The memory allocation related functions in this section aren't used by Wuffs\n// per se, but they may be helpful to the code that uses Wuffs.\n\n// wuffs_base__malloc_slice_uxx wraps calling a malloc-like function, except\n// that it takes a uint64_t number of elements instead of a size_t size in\n// bytes, and it returns a slice (a pointer and a length) instead of just a\n// pointer.\n//\n// You can pass the C stdlib's malloc as the malloc_func.\n//\n// It returns an empty slice (containing a NULL ptr field) if (num_uxx *\n// sizeof(uintxx_t)) would overflow SIZE_MAX.\n\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__malloc_slice_u8(void* (*malloc_func)(size_t), uint64_t num_u8) {\n  if (malloc_func && (num_u8 <= (SIZE_MAX / sizeof(uint8_t)))) {\n    void* p = (*malloc_func)((size_t)(num_u8 * sizeof(uint8_t)));\n    if (p) {\n      return wuffs_base__make_slice_u8((uint8_t*)(p), (size_t)num_u8);\n    }\n  }\n  return wuffs_base__make_slice_u8(NULL, 0);\n}\n\nstatic inline wuffs_base__s" +
 	"lice_u16  //\nwuffs_base__malloc_slice_u16(void* (*malloc_func)(size_t), uint64_t num_u16) {\n  if (malloc_func && (num_u16 <= (SIZE_MAX / sizeof(uint16_t)))) {\n    void* p = (*malloc_func)((size_t)(num_u16 * sizeof(uint16_t)));\n    if (p) {\n      return wuffs_base__make_slice_u16((uint16_t*)(p), (size_t)num_u16);\n    }\n  }\n  return wuffs_base__make_slice_u16(NULL, 0);\n}\n\nstatic inline wuffs_base__slice_u32  //\nwuffs_base__malloc_slice_u32(void* (*malloc_func)(size_t), uint64_t num_u32) {\n  if (malloc_func && (num_u32 <= (SIZE_MAX / sizeof(uint32_t)))) {\n    void* p = (*malloc_func)((size_t)(num_u32 * sizeof(uint32_t)));\n    if (p) {\n      return wuffs_base__make_slice_u32((uint32_t*)(p), (size_t)num_u32);\n    }\n  }\n  return wuffs_base__make_slice_u32(NULL, 0);\n}\n\nstatic inline wuffs_base__slice_u64  //\nwuffs_base__malloc_slice_u64(void* (*malloc_func)(size_t), uint64_t num_u64) {\n  if (malloc_func && (num_u64 <= (SIZE_MAX / sizeof(uint64_t)))) {\n    void* p = (*malloc_func)((size_t)(num_u64 * sizeof(uint64_t))" +
-	");\n    if (p) {\n      return wuffs_base__make_slice_u64((uint64_t*)(p), (size_t)num_u64);\n    }\n  }\n  return wuffs_base__make_slice_u64(NULL, 0);\n}\n" +
+	");\n    if (p) {\n      return wuffs_base__make_slice_u64((uint64_t*)(p), (size_t)num_u64);\n    }\n  }\n  return wuffs_base__make_slice_u64(NULL, 0);\n}\n\n" +
+	"" +
+	"// --------\n\n// wuffs_base__allocator is a memory allocator: a pair of function pointers\n// and the userdata passed to them. It lets embedded users supply arena or pool\n// allocators to the wuffs_foo__bar__alloc_with functions, which wuffs-c\n// generates when given the -allocator flag.\n//\n// The alloc function returns a pointer to len bytes (or NULL on failure).\n// That memory does not have to be zeroed. The free function releases what\n// alloc returned, and is never passed a NULL ptr.\ntypedef struct wuffs_base__allocator__struct {\n  void* (*alloc)(void* userdata, size_t len);\n  void (*free)(void* userdata, void* ptr);\n  void* userdata;\n} wuffs_base__allocator;\n\nstatic inline void*  //\nwuffs_base__default_allocator__alloc(void* userdata, size_t len) {\n  return malloc(len);\n}\n\nstatic inline void  //\nwuffs_base__default_allocator__free(void* userdata, void* ptr) {\n  free(ptr);\n}\n\n// wuffs_base__default_allocator returns an allocator that calls the C\n// stdlib's malloc and free. A NULL allocator argument to the " +
+	"functions below,\n// or to the generated alloc_with functions, means this default allocator.\nstatic inline const wuffs_base__allocator*  //\nwuffs_base__default_allocator() {\n  static const wuffs_base__allocator a = {\n      &wuffs_base__default_allocator__alloc,\n      &wuffs_base__default_allocator__free,\n      NULL,\n  };\n  return &a;\n}\n\nstatic inline void*  //\nwuffs_base__allocator__alloc(const wuffs_base__allocator* a, size_t len) {\n  if (!a) {\n    a = wuffs_base__default_allocator();\n  }\n  return (*a->alloc)(a->userdata, len);\n}\n\n// wuffs_base__allocator__free frees ptr, which must have been returned by the\n// same allocator (or by an alloc_with function given that allocator). It is a\n// no-op if ptr is NULL.\nstatic inline void  //\nwuffs_base__allocator__free(const wuffs_base__allocator* a, void* ptr) {\n  if (!ptr) {\n    return;\n  }\n  if (!a) {\n    a = wuffs_base__default_allocator();\n  }\n  (*a->free)(a->userdata, ptr);\n}\n\n#if defined(__cplusplus) && defined(WUFFS_BASE__HAVE_UNIQUE_PTR)\n// wuffs_base__alloca" +
+	"tor__deleter is a std::unique_ptr deleter that frees via\n// a wuffs_base__allocator. The C++ alloc_with methods return a\n// std::unique_ptr<T, wuffs_base__allocator__deleter>.\nstruct wuffs_base__allocator__deleter {\n  explicit wuffs_base__allocator__deleter(\n      const wuffs_base__allocator* allocator = nullptr)\n      : m_allocator(allocator) {}\n\n  void operator()(void* ptr) const {\n    wuffs_base__allocator__free(m_allocator, ptr);\n  }\n\n  const wuffs_base__allocator* m_allocator;\n};\n#endif  // defined(__cplusplus) && defined(WUFFS_BASE__HAVE_UNIQUE_PTR)\n" +
 	""
 
 const BaseImagePrivateH = "" +
@@ -220,25 +275,41 @@ const BaseIOPrivateH = "" +
 	"// read-like, in that there are no side-effects.\n//\n// The low 3 bits of a hold the prefix length, n.\n//\n// The high 56 bits of a hold the prefix itself, in little-endian order. The\n// first prefix byte is in bits 8..=15, the second prefix byte is in bits\n// 16..=23, etc. The high (8 * (7 - n)) bits are ignored.\n//\n// There are three possible return values:\n//  - 0 means success.\n//  - 1 means inconclusive, equivalent to \"$short read\".\n//  - 2 means failure.\nstatic inline uint32_t  //\nwuffs_base__io_reader__match7(const uint8_t* iop_r,\n                              const uint8_t* io2_r,\n                              wuffs_base__io_buffer* r,\n                              uint64_t a) {\n  uint32_t n = a & 7;\n  a >>= 8;\n  if ((io2_r - iop_r) >= 8) {\n    uint64_t x = wuffs_base__peek_u64le__no_bounds_check(iop_r);\n    uint32_t shift = 8 * (8 - n);\n    return ((a << shift) == (x << shift)) ? 0 : 2;\n  }\n  for (; n > 0; n--) {\n    if (iop_r >= io2_r) {\n      return (r && r->meta.closed) ? 2 : 1;\n    } else if (*iop_" +
 	"r != ((uint8_t)(a))) {\n      return 2;\n    }\n    iop_r++;\n    a >>= 8;\n  }\n  return 0;\n}\n\nstatic inline wuffs_base__io_buffer*  //\nwuffs_base__io_reader__set(wuffs_base__io_buffer* b,\n                           const uint8_t** ptr_iop_r,\n                           const uint8_t** ptr_io0_r,\n                           const uint8_t** ptr_io1_r,\n                           const uint8_t** ptr_io2_r,\n                           wuffs_base__slice_u8 data) {\n  b->data = data;\n  b->meta.wi = data.len;\n  b->meta.ri = 0;\n  b->meta.pos = 0;\n  b->meta.closed = false;\n\n  *ptr_iop_r = data.ptr;\n  *ptr_io0_r = data.ptr;\n  *ptr_io1_r = data.ptr;\n  *ptr_io2_r = data.ptr + data.len;\n\n  return b;\n}\n\n" +
 	"" +
-	"// --------\n\nstatic inline uint64_t  //\nwuffs_base__io_writer__copy_from_slice(uint8_t** ptr_iop_w,\n                                       uint8_t* io2_w,\n                                       wuffs_base__slice_u8 src) {\n  uint8_t* iop_w = *ptr_iop_w;\n  size_t n = src.len;\n  if (n > ((size_t)(io2_w - iop_w))) {\n    n = (size_t)(io2_w - iop_w);\n  }\n  if (n > 0) {\n    memmove(iop_w, src.ptr, n);\n    *ptr_iop_w += n;\n  }\n  return (uint64_t)(n);\n}\n\nstatic inline void  //\nwuffs_base__io_writer__limit(uint8_t** ptr_io2_w,\n                             uint8_t* iop_w,\n                             uint64_t limit) {\n  if (((uint64_t)(*ptr_io2_w - iop_w)) > limit) {\n    *ptr_io2_w = iop_w + limit;\n  }\n}\n\nstatic inline uint32_t  //\nwuffs_base__io_writer__limited_copy_u32_from_history(uint8_t** ptr_iop_w,\n                                                     uint8_t* io1_w,\n                                                     uint8_t* io2_w,\n                                                     uint32_t length,\n           " +
-	"                                          uint32_t distance) {\n  if (!distance) {\n    return 0;\n  }\n  uint8_t* p = *ptr_iop_w;\n  if ((size_t)(p - io1_w) < (size_t)(distance)) {\n    return 0;\n  }\n  uint8_t* q = p - distance;\n  size_t n = (size_t)(io2_w - p);\n  if ((size_t)(length) > n) {\n    length = (uint32_t)(n);\n  } else {\n    n = (size_t)(length);\n  }\n  // TODO: unrolling by 3 seems best for the std/deflate benchmarks, but that\n  // is mostly because 3 is the minimum length for the deflate format. This\n  // function implementation shouldn't overfit to that one format. Perhaps the\n  // limited_copy_u32_from_history Wuffs method should also take an unroll hint\n  // argument, and the cgen can look if that argument is the constant\n  // expression '3'.\n  //\n  // See also wuffs_base__io_writer__limited_copy_u32_from_history_fast below.\n  for (; n >= 3; n -= 3) {\n    *p++ = *q++;\n    *p++ = *q++;\n    *p++ = *q++;\n  }\n  for (; n; n--) {\n    *p++ = *q++;\n  }\n  *ptr_iop_w = p;\n  return length;\n}\n\n// wuffs_base__io_w" +
-	"riter__limited_copy_u32_from_history_fast is like the\n// wuffs_base__io_writer__limited_copy_u32_from_history function above, but has\n// stronger pre-conditions.\n//\n// The caller needs to prove that:\n//  - length   <= (io2_w      - *ptr_iop_w)\n//  - distance >= 1\n//  - distance <= (*ptr_iop_w - io1_w)\nstatic inline uint32_t  //\nwuffs_base__io_writer__limited_copy_u32_from_history_fast(uint8_t** ptr_iop_w,\n                                                          uint8_t* io1_w,\n                                                          uint8_t* io2_w,\n                                                          uint32_t length,\n                                                          uint32_t distance) {\n  uint8_t* p = *ptr_iop_w;\n  uint8_t* q = p - distance;\n  uint32_t n = length;\n  for (; n >= 3; n -= 3) {\n    *p++ = *q++;\n    *p++ = *q++;\n    *p++ = *q++;\n  }\n  for (; n; n--) {\n    *p++ = *q++;\n  }\n  *ptr_iop_w = p;\n  return length;\n}\n\n// wuffs_base__io_writer__limited_copy_u32_from_history_8_byte_chunks_fast" +
-	" is\n// like the wuffs_base__io_writer__limited_copy_u32_from_history_fast function\n// above, but copies 8 byte chunks at a time.\n//\n// In terms of number of bytes copied, length is rounded up to a multiple of 8.\n// As a special case, a zero length rounds up to 8 (even though 0 is already a\n// multiple of 8), since there is always at least one 8 byte chunk copied.\n//\n// In terms of advancing *ptr_iop_w, length is not rounded up.\n//\n// The caller needs to prove that:\n//  - (length + 8) <= (io2_w      - *ptr_iop_w)\n//  - distance     >= 8\n//  - distance     <= (*ptr_iop_w - io1_w)\nstatic inline uint32_t  //\nwuffs_base__io_writer__limited_copy_u32_from_history_8_byte_chunks_fast(\n    uint8_t** ptr_iop_w,\n    uint8_t* io1_w,\n    uint8_t* io2_w,\n    uint32_t length,\n    uint32_t distance) {\n  uint8_t* p = *ptr_iop_w;\n  uint8_t* q = p - distance;\n  uint32_t n = length;\n  while (1) {\n    memcpy(p, q, 8);\n    if (n <= 8) {\n      p += n;\n      break;\n    }\n    p += 8;\n    q += 8;\n    n -= 8;\n  }\n  *ptr_iop_w = p;\n  ret" +
-	"urn length;\n}\n\nstatic inline uint32_t  //\nwuffs_base__io_writer__limited_copy_u32_from_reader(uint8_t** ptr_iop_w,\n                                                    uint8_t* io2_w,\n                                                    uint32_t length,\n                                                    const uint8_t** ptr_iop_r,\n                                                    const uint8_t* io2_r) {\n  uint8_t* iop_w = *ptr_iop_w;\n  size_t n = length;\n  if (n > ((size_t)(io2_w - iop_w))) {\n    n = (size_t)(io2_w - iop_w);\n  }\n  const uint8_t* iop_r = *ptr_iop_r;\n  if (n > ((size_t)(io2_r - iop_r))) {\n    n = (size_t)(io2_r - iop_r);\n  }\n  if (n > 0) {\n    memmove(iop_w, iop_r, n);\n    *ptr_iop_w += n;\n    *ptr_iop_r += n;\n  }\n  return (uint32_t)(n);\n}\n\nstatic inline uint32_t  //\nwuffs_base__io_writer__limited_copy_u32_from_slice(uint8_t** ptr_iop_w,\n                                                   uint8_t* io2_w,\n                                                   uint32_t length,\n                        " +
-	"                           wuffs_base__slice_u8 src) {\n  uint8_t* iop_w = *ptr_iop_w;\n  size_t n = src.len;\n  if (n > length) {\n    n = length;\n  }\n  if (n > ((size_t)(io2_w - iop_w))) {\n    n = (size_t)(io2_w - iop_w);\n  }\n  if (n > 0) {\n    memmove(iop_w, src.ptr, n);\n    *ptr_iop_w += n;\n  }\n  return (uint32_t)(n);\n}\n\nstatic inline wuffs_base__io_buffer*  //\nwuffs_base__io_writer__set(wuffs_base__io_buffer* b,\n                           uint8_t** ptr_iop_w,\n                           uint8_t** ptr_io0_w,\n                           uint8_t** ptr_io1_w,\n                           uint8_t** ptr_io2_w,\n                           wuffs_base__slice_u8 data) {\n  b->data = data;\n  b->meta.wi = 0;\n  b->meta.ri = 0;\n  b->meta.pos = 0;\n  b->meta.closed = false;\n\n  *ptr_iop_w = data.ptr;\n  *ptr_io0_w = data.ptr;\n  *ptr_io1_w = data.ptr;\n  *ptr_io2_w = data.ptr + data.len;\n\n  return b;\n}\n\n" +
+	"// --------\n\nstatic inline uint64_t  //\nwuffs_base__io_writer__copy_from_slice(uint8_t** ptr_iop_w,\n                                       uint8_t* io2_w,\n                                       wuffs_base__slice_u8 src) {\n  uint8_t* iop_w = *ptr_iop_w;\n  size_t n = src.len;\n  if (n > ((size_t)(io2_w - iop_w))) {\n    n = (size_t)(io2_w - iop_w);\n  }\n  if (n > 0) {\n    memmove(iop_w, src.ptr, n);\n    *ptr_iop_w += n;\n  }\n  return (uint64_t)(n);\n}\n\nstatic inline void  //\nwuffs_base__io_writer__limit(uint8_t** ptr_io2_w,\n                             uint8_t* iop_w,\n                             uint64_t limit) {\n  if (((uint64_t)(*ptr_io2_w - iop_w)) > limit) {\n    *ptr_io2_w = iop_w + limit;\n  }\n}\n\n#if defined(WUFFS_CONFIG__AUTOVEC)\n// wuffs_base__io_writer__autovec_copy copies n bytes from src to dst, which\n// must not overlap. It is shaped for compilers' auto-vectorizers: byte copies\n// until dst is 8-byte aligned, then a loop unrolled by 8, then the tail.\nstatic inline void  //\nwuffs_base__io_writer__autovec_c" +
+	"opy(uint8_t* WUFFS_BASE__RESTRICT dst,\n                                    const uint8_t* WUFFS_BASE__RESTRICT src,\n                                    size_t n) {\n  for (; (n > 0) && (((uintptr_t)(dst)) & 7); n--) {\n    *dst++ = *src++;\n  }\n  for (; n >= 8; n -= 8) {\n    dst[0] = src[0];\n    dst[1] = src[1];\n    dst[2] = src[2];\n    dst[3] = src[3];\n    dst[4] = src[4];\n    dst[5] = src[5];\n    dst[6] = src[6];\n    dst[7] = src[7];\n    dst += 8;\n    src += 8;\n  }\n  for (; n > 0; n--) {\n    *dst++ = *src++;\n  }\n}\n#endif  // defined(WUFFS_CONFIG__AUTOVEC)\n\nstatic inline uint32_t  //\nwuffs_base__io_writer__limited_copy_u32_from_history(uint8_t** ptr_iop_w,\n                                                     uint8_t* io1_w,\n                                                     uint8_t* io2_w,\n                                                     uint32_t length,\n                                                     uint32_t distance) {\n  if (!distance) {\n    return 0;\n  }\n  uint8_t* p = *ptr_iop_w;\n  if ((size_t)(" +
+	"p - io1_w) < (size_t)(distance)) {\n    return 0;\n  }\n  uint8_t* q = p - distance;\n  size_t n = (size_t)(io2_w - p);\n  if ((size_t)(length) > n) {\n    length = (uint32_t)(n);\n  } else {\n    n = (size_t)(length);\n  }\n#if defined(WUFFS_CONFIG__AUTOVEC)\n  if ((size_t)(distance) >= n) {\n    wuffs_base__io_writer__autovec_copy(p, q, n);\n    *ptr_iop_w = p + n;\n    return length;\n  }\n#endif  // defined(WUFFS_CONFIG__AUTOVEC)\n  // TODO: unrolling by 3 seems best for the std/deflate benchmarks, but that\n  // is mostly because 3 is the minimum length for the deflate format. This\n  // function implementation shouldn't overfit to that one format. Perhaps the\n  // limited_copy_u32_from_history Wuffs method should also take an unroll hint\n  // argument, and the cgen can look if that argument is the constant\n  // expression '3'.\n  //\n  // See also wuffs_base__io_writer__limited_copy_u32_from_history_fast below.\n  for (; n >= 3; n -= 3) {\n    *p++ = *q++;\n    *p++ = *q++;\n    *p++ = *q++;\n  }\n  for (; n; n--) {\n    *p++ = *q" +
+	"++;\n  }\n  *ptr_iop_w = p;\n  return length;\n}\n\n// wuffs_base__io_writer__limited_copy_u32_from_history_fast is like the\n// wuffs_base__io_writer__limited_copy_u32_from_history function above, but has\n// stronger pre-conditions.\n//\n// The caller needs to prove that:\n//  - length   <= (io2_w      - *ptr_iop_w)\n//  - distance >= 1\n//  - distance <= (*ptr_iop_w - io1_w)\nstatic inline uint32_t  //\nwuffs_base__io_writer__limited_copy_u32_from_history_fast(uint8_t** ptr_iop_w,\n                                                          uint8_t* io1_w,\n                                                          uint8_t* io2_w,\n                                                          uint32_t length,\n                                                          uint32_t distance) {\n  uint8_t* p = *ptr_iop_w;\n  uint8_t* q = p - distance;\n  uint32_t n = length;\n#if defined(WUFFS_CONFIG__AUTOVEC)\n  if (distance >= n) {\n    wuffs_base__io_writer__autovec_copy(p, q, n);\n    *ptr_iop_w = p + n;\n    return length;\n  }\n#endif  // def" +
+	"ined(WUFFS_CONFIG__AUTOVEC)\n  for (; n >= 3; n -= 3) {\n    *p++ = *q++;\n    *p++ = *q++;\n    *p++ = *q++;\n  }\n  for (; n; n--) {\n    *p++ = *q++;\n  }\n  *ptr_iop_w = p;\n  return length;\n}\n\n// wuffs_base__io_writer__limited_copy_u32_from_history_8_byte_chunks_fast is\n// like the wuffs_base__io_writer__limited_copy_u32_from_history_fast function\n// above, but copies 8 byte chunks at a time.\n//\n// In terms of number of bytes copied, length is rounded up to a multiple of 8.\n// As a special case, a zero length rounds up to 8 (even though 0 is already a\n// multiple of 8), since there is always at least one 8 byte chunk copied.\n//\n// In terms of advancing *ptr_iop_w, length is not rounded up.\n//\n// The caller needs to prove that:\n//  - (length + 8) <= (io2_w      - *ptr_iop_w)\n//  - distance     >= 8\n//  - distance     <= (*ptr_iop_w - io1_w)\nstatic inline uint32_t  //\nwuffs_base__io_writer__limited_copy_u32_from_history_8_byte_chunks_fast(\n    uint8_t** ptr_iop_w,\n    uint8_t* io1_w,\n    uint8_t* io2_w,\n    uint32_t" +
+	" length,\n    uint32_t distance) {\n  uint8_t* p = *ptr_iop_w;\n  uint8_t* q = p - distance;\n  uint32_t n = length;\n  while (1) {\n    memcpy(p, q, 8);\n    if (n <= 8) {\n      p += n;\n      break;\n    }\n    p += 8;\n    q += 8;\n    n -= 8;\n  }\n  *ptr_iop_w = p;\n  return length;\n}\n\nstatic inline uint32_t  //\nwuffs_base__io_writer__limited_copy_u32_from_reader(uint8_t** ptr_iop_w,\n                                                    uint8_t* io2_w,\n                                                    uint32_t length,\n                                                    const uint8_t** ptr_iop_r,\n                                                    const uint8_t* io2_r) {\n  uint8_t* iop_w = *ptr_iop_w;\n  size_t n = length;\n  if (n > ((size_t)(io2_w - iop_w))) {\n    n = (size_t)(io2_w - iop_w);\n  }\n  const uint8_t* iop_r = *ptr_iop_r;\n  if (n > ((size_t)(io2_r - iop_r))) {\n    n = (size_t)(io2_r - iop_r);\n  }\n  if (n > 0) {\n    memmove(iop_w, iop_r, n);\n    *ptr_iop_w += n;\n    *ptr_iop_r += n;\n  }\n  return (uint32_t)(n);" +
+	"\n}\n\nstatic inline uint32_t  //\nwuffs_base__io_writer__limited_copy_u32_from_slice(uint8_t** ptr_iop_w,\n                                                   uint8_t* io2_w,\n                                                   uint32_t length,\n                                                   wuffs_base__slice_u8 src) {\n  uint8_t* iop_w = *ptr_iop_w;\n  size_t n = src.len;\n  if (n > length) {\n    n = length;\n  }\n  if (n > ((size_t)(io2_w - iop_w))) {\n    n = (size_t)(io2_w - iop_w);\n  }\n  if (n > 0) {\n    memmove(iop_w, src.ptr, n);\n    *ptr_iop_w += n;\n  }\n  return (uint32_t)(n);\n}\n\nstatic inline wuffs_base__io_buffer*  //\nwuffs_base__io_writer__set(wuffs_base__io_buffer* b,\n                           uint8_t** ptr_iop_w,\n                           uint8_t** ptr_io0_w,\n                           uint8_t** ptr_io1_w,\n                           uint8_t** ptr_io2_w,\n                           wuffs_base__slice_u8 data) {\n  b->data = data;\n  b->meta.wi = 0;\n  b->meta.ri = 0;\n  b->meta.pos = 0;\n  b->meta.closed = false" +
+	";\n\n  *ptr_iop_w = data.ptr;\n  *ptr_io0_w = data.ptr;\n  *ptr_io1_w = data.ptr;\n  *ptr_io2_w = data.ptr + data.len;\n\n  return b;\n}\n\n" +
 	"" +
 	"// ---------------- I/O (Utility)\n\n#define wuffs_base__utility__empty_io_reader wuffs_base__empty_io_reader\n#define wuffs_base__utility__empty_io_writer wuffs_base__empty_io_writer\n" +
 	""
 
 const BaseIOPublicH = "" +
 	"// ---------------- I/O\n//\n// See (/doc/note/io-input-output.md).\n\n// wuffs_base__io_buffer_meta is the metadata for a wuffs_base__io_buffer's\n// data.\ntypedef struct wuffs_base__io_buffer_meta__struct {\n  size_t wi;     // Write index. Invariant: wi <= len.\n  size_t ri;     // Read  index. Invariant: ri <= wi.\n  uint64_t pos;  // Buffer position (relative to the start of stream).\n  bool closed;   // No further writes are expected.\n} wuffs_base__io_buffer_meta;\n\n// wuffs_base__io_buffer is a 1-dimensional buffer (a pointer and length) plus\n// additional metadata.\n//\n// A value with all fields zero is a valid, empty buffer.\ntypedef struct wuffs_base__io_buffer__struct {\n  wuffs_base__slice_u8 data;\n  wuffs_base__io_buffer_meta meta;\n\n#ifdef __cplusplus\n  inline bool is_valid() const;\n  inline void compact();\n  inline size_t reader_length() const;\n  inline uint8_t* reader_pointer() const;\n  inline uint64_t reader_position() const;\n  inline wuffs_base__slice_u8 reader_slice() const;\n  inline size_t writer_length" +
-	"() const;\n  inline uint8_t* writer_pointer() const;\n  inline uint64_t writer_position() const;\n  inline wuffs_base__slice_u8 writer_slice() const;\n\n  // Deprecated: use reader_position.\n  inline uint64_t reader_io_position() const;\n  // Deprecated: use writer_position.\n  inline uint64_t writer_io_position() const;\n#endif  // __cplusplus\n\n} wuffs_base__io_buffer;\n\nstatic inline wuffs_base__io_buffer  //\nwuffs_base__make_io_buffer(wuffs_base__slice_u8 data,\n                           wuffs_base__io_buffer_meta meta) {\n  wuffs_base__io_buffer ret;\n  ret.data = data;\n  ret.meta = meta;\n  return ret;\n}\n\nstatic inline wuffs_base__io_buffer_meta  //\nwuffs_base__make_io_buffer_meta(size_t wi,\n                                size_t ri,\n                                uint64_t pos,\n                                bool closed) {\n  wuffs_base__io_buffer_meta ret;\n  ret.wi = wi;\n  ret.ri = ri;\n  ret.pos = pos;\n  ret.closed = closed;\n  return ret;\n}\n\nstatic inline wuffs_base__io_buffer  //\nwuffs_base__ptr_u8__reader(uint8_" +
-	"t* ptr, size_t len, bool closed) {\n  wuffs_base__io_buffer ret;\n  ret.data.ptr = ptr;\n  ret.data.len = len;\n  ret.meta.wi = len;\n  ret.meta.ri = 0;\n  ret.meta.pos = 0;\n  ret.meta.closed = closed;\n  return ret;\n}\n\nstatic inline wuffs_base__io_buffer  //\nwuffs_base__ptr_u8__writer(uint8_t* ptr, size_t len) {\n  wuffs_base__io_buffer ret;\n  ret.data.ptr = ptr;\n  ret.data.len = len;\n  ret.meta.wi = 0;\n  ret.meta.ri = 0;\n  ret.meta.pos = 0;\n  ret.meta.closed = false;\n  return ret;\n}\n\nstatic inline wuffs_base__io_buffer  //\nwuffs_base__slice_u8__reader(wuffs_base__slice_u8 s, bool closed) {\n  wuffs_base__io_buffer ret;\n  ret.data.ptr = s.ptr;\n  ret.data.len = s.len;\n  ret.meta.wi = s.len;\n  ret.meta.ri = 0;\n  ret.meta.pos = 0;\n  ret.meta.closed = closed;\n  return ret;\n}\n\nstatic inline wuffs_base__io_buffer  //\nwuffs_base__slice_u8__writer(wuffs_base__slice_u8 s) {\n  wuffs_base__io_buffer ret;\n  ret.data.ptr = s.ptr;\n  ret.data.len = s.len;\n  ret.meta.wi = 0;\n  ret.meta.ri = 0;\n  ret.meta.pos = 0;\n  ret.meta.closed =" +
-	" false;\n  return ret;\n}\n\nstatic inline wuffs_base__io_buffer  //\nwuffs_base__empty_io_buffer() {\n  wuffs_base__io_buffer ret;\n  ret.data.ptr = NULL;\n  ret.data.len = 0;\n  ret.meta.wi = 0;\n  ret.meta.ri = 0;\n  ret.meta.pos = 0;\n  ret.meta.closed = false;\n  return ret;\n}\n\nstatic inline wuffs_base__io_buffer_meta  //\nwuffs_base__empty_io_buffer_meta() {\n  wuffs_base__io_buffer_meta ret;\n  ret.wi = 0;\n  ret.ri = 0;\n  ret.pos = 0;\n  ret.closed = false;\n  return ret;\n}\n\nstatic inline bool  //\nwuffs_base__io_buffer__is_valid(const wuffs_base__io_buffer* buf) {\n  if (buf) {\n    if (buf->data.ptr) {\n      return (buf->meta.ri <= buf->meta.wi) && (buf->meta.wi <= buf->data.len);\n    } else {\n      return (buf->meta.ri == 0) && (buf->meta.wi == 0) && (buf->data.len == 0);\n    }\n  }\n  return false;\n}\n\n// wuffs_base__io_buffer__compact moves any written but unread bytes to the\n// start of the buffer.\nstatic inline void  //\nwuffs_base__io_buffer__compact(wuffs_base__io_buffer* buf) {\n  if (!buf || (buf->meta.ri == 0)) {\n  " +
-	"  return;\n  }\n  buf->meta.pos = wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.ri);\n  size_t n = buf->meta.wi - buf->meta.ri;\n  if (n != 0) {\n    memmove(buf->data.ptr, buf->data.ptr + buf->meta.ri, n);\n  }\n  buf->meta.wi = n;\n  buf->meta.ri = 0;\n}\n\n// Deprecated. Use wuffs_base__io_buffer__reader_position.\nstatic inline uint64_t  //\nwuffs_base__io_buffer__reader_io_position(const wuffs_base__io_buffer* buf) {\n  return buf ? wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.ri) : 0;\n}\n\nstatic inline size_t  //\nwuffs_base__io_buffer__reader_length(const wuffs_base__io_buffer* buf) {\n  return buf ? buf->meta.wi - buf->meta.ri : 0;\n}\n\nstatic inline uint8_t*  //\nwuffs_base__io_buffer__reader_pointer(const wuffs_base__io_buffer* buf) {\n  return buf ? (buf->data.ptr + buf->meta.ri) : NULL;\n}\n\nstatic inline uint64_t  //\nwuffs_base__io_buffer__reader_position(const wuffs_base__io_buffer* buf) {\n  return buf ? wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.ri) : 0;\n}\n\nstatic inline wuffs_base__slice_u8  //\nwuffs" +
-	"_base__io_buffer__reader_slice(const wuffs_base__io_buffer* buf) {\n  return buf ? wuffs_base__make_slice_u8(buf->data.ptr + buf->meta.ri,\n                                         buf->meta.wi - buf->meta.ri)\n             : wuffs_base__empty_slice_u8();\n}\n\n// Deprecated. Use wuffs_base__io_buffer__writer_position.\nstatic inline uint64_t  //\nwuffs_base__io_buffer__writer_io_position(const wuffs_base__io_buffer* buf) {\n  return buf ? wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.wi) : 0;\n}\n\nstatic inline size_t  //\nwuffs_base__io_buffer__writer_length(const wuffs_base__io_buffer* buf) {\n  return buf ? buf->data.len - buf->meta.wi : 0;\n}\n\nstatic inline uint8_t*  //\nwuffs_base__io_buffer__writer_pointer(const wuffs_base__io_buffer* buf) {\n  return buf ? (buf->data.ptr + buf->meta.wi) : NULL;\n}\n\nstatic inline uint64_t  //\nwuffs_base__io_buffer__writer_position(const wuffs_base__io_buffer* buf) {\n  return buf ? wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.wi) : 0;\n}\n\nstatic inline wuffs_base__slice_u8  //\nw" +
-	"uffs_base__io_buffer__writer_slice(const wuffs_base__io_buffer* buf) {\n  return buf ? wuffs_base__make_slice_u8(buf->data.ptr + buf->meta.wi,\n                                         buf->data.len - buf->meta.wi)\n             : wuffs_base__empty_slice_u8();\n}\n\n#ifdef __cplusplus\n\ninline bool  //\nwuffs_base__io_buffer::is_valid() const {\n  return wuffs_base__io_buffer__is_valid(this);\n}\n\ninline void  //\nwuffs_base__io_buffer::compact() {\n  wuffs_base__io_buffer__compact(this);\n}\n\ninline uint64_t  //\nwuffs_base__io_buffer::reader_io_position() const {\n  return wuffs_base__io_buffer__reader_io_position(this);\n}\n\ninline size_t  //\nwuffs_base__io_buffer::reader_length() const {\n  return wuffs_base__io_buffer__reader_length(this);\n}\n\ninline uint8_t*  //\nwuffs_base__io_buffer::reader_pointer() const {\n  return wuffs_base__io_buffer__reader_pointer(this);\n}\n\ninline uint64_t  //\nwuffs_base__io_buffer::reader_position() const {\n  return wuffs_base__io_buffer__reader_position(this);\n}\n\ninline wuffs_base__slice_u8  //\nwu" +
-	"ffs_base__io_buffer::reader_slice() const {\n  return wuffs_base__io_buffer__reader_slice(this);\n}\n\ninline uint64_t  //\nwuffs_base__io_buffer::writer_io_position() const {\n  return wuffs_base__io_buffer__writer_io_position(this);\n}\n\ninline size_t  //\nwuffs_base__io_buffer::writer_length() const {\n  return wuffs_base__io_buffer__writer_length(this);\n}\n\ninline uint8_t*  //\nwuffs_base__io_buffer::writer_pointer() const {\n  return wuffs_base__io_buffer__writer_pointer(this);\n}\n\ninline uint64_t  //\nwuffs_base__io_buffer::writer_position() const {\n  return wuffs_base__io_buffer__writer_position(this);\n}\n\ninline wuffs_base__slice_u8  //\nwuffs_base__io_buffer::writer_slice() const {\n  return wuffs_base__io_buffer__writer_slice(this);\n}\n\n#endif  // __cplusplus\n" +
+	"() const;\n  inline uint8_t* writer_pointer() const;\n  inline uint64_t writer_position() const;\n  inline wuffs_base__slice_u8 writer_slice() const;\n\n  // Deprecated: use reader_position.\n  inline uint64_t reader_io_position() const;\n  // Deprecated: use writer_position.\n  inline uint64_t writer_io_position() const;\n#endif  // __cplusplus\n\n} wuffs_base__io_buffer;\n\nWUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer_meta, wi) == 0,\n                          io_buffer_meta_wi_offset);\nWUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer_meta, ri) ==\n                              sizeof(size_t),\n                          io_buffer_meta_ri_offset);\nWUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer_meta, pos) ==\n                              (2 * sizeof(size_t)),\n                          io_buffer_meta_pos_offset);\nWUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer_meta, closed) ==\n                              ((2 * sizeof(size_t)) + sizeof(uint64_t)),\n                          io_buffer_met" +
+	"a_closed_offset);\nWUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer, data) == 0,\n                          io_buffer_data_offset);\nWUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer, meta) ==\n                              sizeof(wuffs_base__slice_u8),\n                          io_buffer_meta_offset);\nWUFFS_BASE__STATIC_ASSERT(sizeof(wuffs_base__io_buffer) ==\n                              (sizeof(wuffs_base__slice_u8) +\n                               sizeof(wuffs_base__io_buffer_meta)),\n                          io_buffer_sizeof);\n\nstatic inline wuffs_base__io_buffer  //\nwuffs_base__make_io_buffer(wuffs_base__slice_u8 data,\n                           wuffs_base__io_buffer_meta meta) {\n  wuffs_base__io_buffer ret;\n  ret.data = data;\n  ret.meta = meta;\n  return ret;\n}\n\nstatic inline wuffs_base__io_buffer_meta  //\nwuffs_base__make_io_buffer_meta(size_t wi,\n                                size_t ri,\n                                uint64_t pos,\n                                bool closed) {\n  wuffs_ba" +
+	"se__io_buffer_meta ret;\n  ret.wi = wi;\n  ret.ri = ri;\n  ret.pos = pos;\n  ret.closed = closed;\n  return ret;\n}\n\nstatic inline wuffs_base__io_buffer  //\nwuffs_base__ptr_u8__reader(uint8_t* ptr, size_t len, bool closed) {\n  wuffs_base__io_buffer ret;\n  ret.data.ptr = ptr;\n  ret.data.len = len;\n  ret.meta.wi = len;\n  ret.meta.ri = 0;\n  ret.meta.pos = 0;\n  ret.meta.closed = closed;\n  return ret;\n}\n\nstatic inline wuffs_base__io_buffer  //\nwuffs_base__ptr_u8__writer(uint8_t* ptr, size_t len) {\n  wuffs_base__io_buffer ret;\n  ret.data.ptr = ptr;\n  ret.data.len = len;\n  ret.meta.wi = 0;\n  ret.meta.ri = 0;\n  ret.meta.pos = 0;\n  ret.meta.closed = false;\n  return ret;\n}\n\nstatic inline wuffs_base__io_buffer  //\nwuffs_base__slice_u8__reader(wuffs_base__slice_u8 s, bool closed) {\n  wuffs_base__io_buffer ret;\n  ret.data.ptr = s.ptr;\n  ret.data.len = s.len;\n  ret.meta.wi = s.len;\n  ret.meta.ri = 0;\n  ret.meta.pos = 0;\n  ret.meta.closed = closed;\n  return ret;\n}\n\nstatic inline wuffs_base__io_buffer  //\nwuffs_base__slice_u8__wri" +
+	"ter(wuffs_base__slice_u8 s) {\n  wuffs_base__io_buffer ret;\n  ret.data.ptr = s.ptr;\n  ret.data.len = s.len;\n  ret.meta.wi = 0;\n  ret.meta.ri = 0;\n  ret.meta.pos = 0;\n  ret.meta.closed = false;\n  return ret;\n}\n\nstatic inline wuffs_base__io_buffer  //\nwuffs_base__empty_io_buffer() {\n  wuffs_base__io_buffer ret;\n  ret.data.ptr = NULL;\n  ret.data.len = 0;\n  ret.meta.wi = 0;\n  ret.meta.ri = 0;\n  ret.meta.pos = 0;\n  ret.meta.closed = false;\n  return ret;\n}\n\nstatic inline wuffs_base__io_buffer_meta  //\nwuffs_base__empty_io_buffer_meta() {\n  wuffs_base__io_buffer_meta ret;\n  ret.wi = 0;\n  ret.ri = 0;\n  ret.pos = 0;\n  ret.closed = false;\n  return ret;\n}\n\nstatic inline bool  //\nwuffs_base__io_buffer__is_valid(const wuffs_base__io_buffer* buf) {\n  if (buf) {\n    if (buf->data.ptr) {\n      return (buf->meta.ri <= buf->meta.wi) && (buf->meta.wi <= buf->data.len);\n    } else {\n      return (buf->meta.ri == 0) && (buf->meta.wi == 0) && (buf->data.len == 0);\n    }\n  }\n  return false;\n}\n\n// wuffs_base__io_buffer__compact moves" +
+	" any written but unread bytes to the\n// start of the buffer.\nstatic inline void  //\nwuffs_base__io_buffer__compact(wuffs_base__io_buffer* buf) {\n  if (!buf || (buf->meta.ri == 0)) {\n    return;\n  }\n  buf->meta.pos = wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.ri);\n  size_t n = buf->meta.wi - buf->meta.ri;\n  if (n != 0) {\n    memmove(buf->data.ptr, buf->data.ptr + buf->meta.ri, n);\n  }\n  buf->meta.wi = n;\n  buf->meta.ri = 0;\n}\n\n// Deprecated. Use wuffs_base__io_buffer__reader_position.\nstatic inline uint64_t  //\nwuffs_base__io_buffer__reader_io_position(const wuffs_base__io_buffer* buf) {\n  return buf ? wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.ri) : 0;\n}\n\nstatic inline size_t  //\nwuffs_base__io_buffer__reader_length(const wuffs_base__io_buffer* buf) {\n  return buf ? buf->meta.wi - buf->meta.ri : 0;\n}\n\nstatic inline uint8_t*  //\nwuffs_base__io_buffer__reader_pointer(const wuffs_base__io_buffer* buf) {\n  return buf ? (buf->data.ptr + buf->meta.ri) : NULL;\n}\n\nstatic inline uint64_t  //\nwuffs_base__" +
+	"io_buffer__reader_position(const wuffs_base__io_buffer* buf) {\n  return buf ? wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.ri) : 0;\n}\n\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__io_buffer__reader_slice(const wuffs_base__io_buffer* buf) {\n  return buf ? wuffs_base__make_slice_u8(buf->data.ptr + buf->meta.ri,\n                                         buf->meta.wi - buf->meta.ri)\n             : wuffs_base__empty_slice_u8();\n}\n\n// Deprecated. Use wuffs_base__io_buffer__writer_position.\nstatic inline uint64_t  //\nwuffs_base__io_buffer__writer_io_position(const wuffs_base__io_buffer* buf) {\n  return buf ? wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.wi) : 0;\n}\n\nstatic inline size_t  //\nwuffs_base__io_buffer__writer_length(const wuffs_base__io_buffer* buf) {\n  return buf ? buf->data.len - buf->meta.wi : 0;\n}\n\nstatic inline uint8_t*  //\nwuffs_base__io_buffer__writer_pointer(const wuffs_base__io_buffer* buf) {\n  return buf ? (buf->data.ptr + buf->meta.wi) : NULL;\n}\n\nstatic inline uint64_t  //\nwuffs_ba" +
+	"se__io_buffer__writer_position(const wuffs_base__io_buffer* buf) {\n  return buf ? wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.wi) : 0;\n}\n\nstatic inline wuffs_base__slice_u8  //\nwuffs_base__io_buffer__writer_slice(const wuffs_base__io_buffer* buf) {\n  return buf ? wuffs_base__make_slice_u8(buf->data.ptr + buf->meta.wi,\n                                         buf->data.len - buf->meta.wi)\n             : wuffs_base__empty_slice_u8();\n}\n\n#ifdef __cplusplus\n\ninline bool  //\nwuffs_base__io_buffer::is_valid() const {\n  return wuffs_base__io_buffer__is_valid(this);\n}\n\ninline void  //\nwuffs_base__io_buffer::compact() {\n  wuffs_base__io_buffer__compact(this);\n}\n\ninline uint64_t  //\nwuffs_base__io_buffer::reader_io_position() const {\n  return wuffs_base__io_buffer__reader_io_position(this);\n}\n\ninline size_t  //\nwuffs_base__io_buffer::reader_length() const {\n  return wuffs_base__io_buffer__reader_length(this);\n}\n\ninline uint8_t*  //\nwuffs_base__io_buffer::reader_pointer() const {\n  return wuffs_base__io_buffer__re" +
+	"ader_pointer(this);\n}\n\ninline uint64_t  //\nwuffs_base__io_buffer::reader_position() const {\n  return wuffs_base__io_buffer__reader_position(this);\n}\n\ninline wuffs_base__slice_u8  //\nwuffs_base__io_buffer::reader_slice() const {\n  return wuffs_base__io_buffer__reader_slice(this);\n}\n\ninline uint64_t  //\nwuffs_base__io_buffer::writer_io_position() const {\n  return wuffs_base__io_buffer__writer_io_position(this);\n}\n\ninline size_t  //\nwuffs_base__io_buffer::writer_length() const {\n  return wuffs_base__io_buffer__writer_length(this);\n}\n\ninline uint8_t*  //\nwuffs_base__io_buffer::writer_pointer() const {\n  return wuffs_base__io_buffer__writer_pointer(this);\n}\n\ninline uint64_t  //\nwuffs_base__io_buffer::writer_position() const {\n  return wuffs_base__io_buffer__writer_position(this);\n}\n\ninline wuffs_base__slice_u8  //\nwuffs_base__io_buffer::writer_slice() const {\n  return wuffs_base__io_buffer__writer_slice(this);\n}\n\n#endif  // __cplusplus\n\n" +
+	"" +
+	"// ---------------- I/O Read Callbacks\n\n// wuffs_base__io_read_func is the type of a pull-style callback that supplies\n// input bytes in place, such as the next mapped window of a memory-mapped\n// file or the next contiguous run of a ring buffer, instead of the caller\n// copying them into an io_buffer. It returns those bytes, which must remain\n// valid and unmodified until the next call, and sets *closed to whether no\n// further bytes follow them. Returning an empty slice, with *closed false,\n// means that no bytes are available yet.\ntypedef wuffs_base__slice_u8 (*wuffs_base__io_read_func)(void* context,\n                                                         bool* closed);\n\n// wuffs_base__io_read_callback is a wuffs_base__io_read_func and its context,\n// plus the state for wuffs_base__io_buffer__refill. Make one with\n// wuffs_base__make_io_read_callback.\n//\n// The stitch slice, owned by the caller, is only used when a decoder suspends\n// with unread bytes, such as the first half of a multi-byte field at the" +
+	" end\n// of one run of bytes. Those are joined with the start of the next run, which\n// is otherwise returned to the decoder in place. The stitch length bounds how\n// many unread bytes can be carried over. A few dozen bytes is typically\n// enough but a longer stitch means fewer, larger copies.\ntypedef struct wuffs_base__io_read_callback__struct {\n  wuffs_base__io_read_func func;\n  void* context;\n  wuffs_base__slice_u8 stitch;\n\n  // Do not access the private_impl's fields directly. There is no API/ABI\n  // compatibility or safety guarantee if you do so.\n  struct {\n    // pending holds the bytes returned by func but not yet passed on.\n    wuffs_base__slice_u8 pending;\n    bool closed;\n  } private_impl;\n} wuffs_base__io_read_callback;\n\nstatic inline wuffs_base__io_read_callback  //\nwuffs_base__make_io_read_callback(wuffs_base__io_read_func func,\n                                  void* context,\n                                  wuffs_base__slice_u8 stitch) {\n  wuffs_base__io_read_callback ret;\n  ret.func = func;\n " +
+	" ret.context = context;\n  ret.stitch = stitch;\n  ret.private_impl.pending = wuffs_base__empty_slice_u8();\n  ret.private_impl.closed = false;\n  return ret;\n}\n\n// wuffs_base__io_buffer__refill gives buf, a source io_buffer that a decoder\n// has (partially) read, more bytes from cb. Call it after a \"$short read\"\n// suspension and then call the decoder again, with the same buf.\n//\n// If buf has no unread bytes then it is re-pointed at cb's next bytes, without\n// copying them. Otherwise, its unread bytes and (as many as fit) the next\n// bytes are copied into cb's stitch slice and buf is re-pointed at that.\n// Either way, buf's reader position is unchanged.\n//\n// It returns a \"$short read\" suspension if cb had no further bytes (and is not\n// closed) and a \"#bad argument (length too short)\" error if buf's unread\n// bytes do not fit in the stitch slice with room to spare.\nstatic inline wuffs_base__status  //\nwuffs_base__io_buffer__refill(wuffs_base__io_buffer* buf,\n                              wuffs_base__io_read_ca" +
+	"llback* cb) {\n  if (!buf || !cb || !cb->func) {\n    return wuffs_base__make_status(wuffs_base__error__bad_argument);\n  }\n  size_t n = buf->meta.wi - buf->meta.ri;\n  uint64_t pos = wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.ri);\n\n  // Copy any unread bytes before calling cb->func, which can invalidate them.\n  if (n > 0) {\n    if (n >= cb->stitch.len) {\n      return wuffs_base__make_status(\n          wuffs_base__error__bad_argument_length_too_short);\n    }\n    memmove(cb->stitch.ptr, buf->data.ptr + buf->meta.ri, n);\n  }\n\n  wuffs_base__slice_u8* pending = &cb->private_impl.pending;\n  if ((pending->len == 0) && !cb->private_impl.closed) {\n    *pending = (*cb->func)(cb->context, &cb->private_impl.closed);\n  }\n\n  size_t m = pending->len;\n  if (n == 0) {\n    buf->data = *pending;\n  } else {\n    if (m > (cb->stitch.len - n)) {\n      m = cb->stitch.len - n;\n    }\n    if (m > 0) {\n      memcpy(cb->stitch.ptr + n, pending->ptr, m);\n    }\n    buf->data = cb->stitch;\n  }\n  *pending = wuffs_base__slice_u8__subslice" +
+	"_i(*pending, m);\n\n  bool closed = cb->private_impl.closed && (pending->len == 0);\n  buf->meta = wuffs_base__make_io_buffer_meta(n + m, 0, pos, closed);\n  if ((m == 0) && !closed) {\n    return wuffs_base__make_status(wuffs_base__suspension__short_read);\n  }\n  return wuffs_base__make_status(NULL);\n}\n\n" +
+	"" +
+	"// ---------------- Metadata Chunks\n\n// wuffs_base__metadata_chunk_func is the type of a callback that receives\n// metadata (such as an ICC profile or XMP) in chunks, as it is decoded. The\n// fourcc identifies the metadata and io_position is the I/O position of the\n// chunk's first byte. Returning a non-OK status stops the visit and that\n// status is passed back to the visitor's caller.\n//\n// The chunk's bytes are only valid for the duration of the call.\ntypedef wuffs_base__status (*wuffs_base__metadata_chunk_func)(\n    void* context,\n    uint32_t fourcc,\n    uint64_t io_position,\n    wuffs_base__slice_u8 chunk);\n\n// wuffs_base__more_information__deliver_metadata passes the bytes of src that\n// lie within m's range to callback, advancing src's read index past them. It\n// does nothing if m does not have the METADATA flavor or if src's reader\n// position is outside of m's range.\n//\n// It returns OK once it reaches the end of the range, or a \"$short read\"\n// suspension (or, if src is closed, a \"#not enough data\"" +
+	" error) if src runs\n// out of bytes first. The caller can re-fill src and call it again, as m is\n// not modified: progress is tracked by src's reader position.\n//\n// This is typically called by a generated wuffs_foo__bar__visit_metadata\n// function, which alternates it with calls to wuffs_foo__bar__tell_me_more.\nstatic inline wuffs_base__status  //\nwuffs_base__more_information__deliver_metadata(\n    const wuffs_base__more_information* m,\n    wuffs_base__io_buffer* src,\n    wuffs_base__metadata_chunk_func callback,\n    void* context) {\n  if (!m || (m->flavor != WUFFS_BASE__MORE_INFORMATION__FLAVOR__METADATA) ||\n      !src) {\n    return wuffs_base__make_status(NULL);\n  }\n  if (!callback) {\n    return wuffs_base__make_status(wuffs_base__error__bad_argument);\n  }\n  while (true) {\n    uint64_t pos = wuffs_base__io_buffer__reader_position(src);\n    if ((pos < m->y) || (pos >= m->z)) {\n      return wuffs_base__make_status(NULL);\n    }\n    size_t n = wuffs_base__io_buffer__reader_length(src);\n    if (n == 0) {\n      " +
+	"return wuffs_base__make_status(src->meta.closed\n                                         ? wuffs_base__error__not_enough_data\n                                         : wuffs_base__suspension__short_read);\n    }\n    if (n > (m->z - pos)) {\n      n = (size_t)(m->z - pos);\n    }\n    wuffs_base__status status = (*callback)(\n        context, m->w, pos,\n        wuffs_base__make_slice_u8(wuffs_base__io_buffer__reader_pointer(src),\n                                  n));\n    if (status.repr) {\n      return status;\n    }\n    src->meta.ri += n;\n  }\n}\n\n// wuffs_base__metadata_reader is a pull-style alternative to a\n// wuffs_base__metadata_chunk_func callback. A generated\n// wuffs_foo__bar__read_metadata_chunk function sets its fourcc, io_position\n// and chunk fields to the next chunk of metadata. The chunk's bytes alias src\n// (no memory is allocated) and are only valid until src is next modified.\n//\n// The minfo field holds the tell_me_more state. Callers should not modify it,\n// other than to read an \"I/O seek\" positi" +
+	"on after a \"$mispositioned read\".\ntypedef struct wuffs_base__metadata_reader__struct {\n  uint32_t fourcc;\n  uint64_t io_position;\n  wuffs_base__slice_u8 chunk;\n  wuffs_base__more_information minfo;\n} wuffs_base__metadata_reader;\n\nstatic inline wuffs_base__metadata_reader  //\nwuffs_base__empty_metadata_reader() {\n  wuffs_base__metadata_reader ret;\n  ret.fourcc = 0;\n  ret.io_position = 0;\n  ret.chunk = wuffs_base__empty_slice_u8();\n  ret.minfo = wuffs_base__empty_more_information();\n  return ret;\n}\n\n// wuffs_base__metadata_reader__next_chunk advances src's read index past r's\n// previous chunk, if src still holds it, and then sets r's chunk to the bytes\n// of src that lie within r's minfo's range. The chunk is empty if r's minfo\n// does not have the METADATA flavor or if src's reader position is outside of\n// that range.\n//\n// Like wuffs_base__more_information__deliver_metadata, it returns a \"$short\n// read\" suspension (or, if src is closed, a \"#not enough data\" error) if src\n// has no bytes (within that range)" +
+	" left.\n//\n// This is typically called by a generated wuffs_foo__bar__read_metadata_chunk\n// function, which alternates it with calls to wuffs_foo__bar__tell_me_more.\nstatic inline wuffs_base__status  //\nwuffs_base__metadata_reader__next_chunk(wuffs_base__metadata_reader* r,\n                                        wuffs_base__io_buffer* src) {\n  if (!r) {\n    return wuffs_base__make_status(wuffs_base__error__bad_argument);\n  } else if (!src) {\n    return wuffs_base__make_status(NULL);\n  }\n  if ((r->chunk.len > 0) &&\n      (wuffs_base__io_buffer__reader_position(src) == r->io_position) &&\n      (r->chunk.len <= wuffs_base__io_buffer__reader_length(src))) {\n    src->meta.ri += r->chunk.len;\n  }\n  r->chunk = wuffs_base__empty_slice_u8();\n\n  if (r->minfo.flavor != WUFFS_BASE__MORE_INFORMATION__FLAVOR__METADATA) {\n    return wuffs_base__make_status(NULL);\n  }\n  uint64_t pos = wuffs_base__io_buffer__reader_position(src);\n  if ((pos < r->minfo.y) || (pos >= r->minfo.z)) {\n    return wuffs_base__make_status(NULL);\n  }" +
+	"\n  size_t n = wuffs_base__io_buffer__reader_length(src);\n  if (n == 0) {\n    return wuffs_base__make_status(src->meta.closed\n                                       ? wuffs_base__error__not_enough_data\n                                       : wuffs_base__suspension__short_read);\n  }\n  if (n > (r->minfo.z - pos)) {\n    n = (size_t)(r->minfo.z - pos);\n  }\n  r->fourcc = r->minfo.w;\n  r->io_position = pos;\n  r->chunk =\n      wuffs_base__make_slice_u8(wuffs_base__io_buffer__reader_pointer(src), n);\n  return wuffs_base__make_status(NULL);\n}\n" +
 	""
 
 const BaseRangePrivateH = "" +
@@ -281,10 +352,11 @@ const BaseRangePublicH = "" +
 	"tains(const wuffs_base__rect_ie_u32* r,\n                                  uint32_t x,\n                                  uint32_t y) {\n  return (r->min_incl_x <= x) && (x < r->max_excl_x) && (r->min_incl_y <= y) &&\n         (y < r->max_excl_y);\n}\n\nstatic inline bool  //\nwuffs_base__rect_ie_u32__contains_rect(const wuffs_base__rect_ie_u32* r,\n                                       wuffs_base__rect_ie_u32 s) {\n  return wuffs_base__rect_ie_u32__equals(\n      &s, wuffs_base__rect_ie_u32__intersect(r, s));\n}\n\nstatic inline uint32_t  //\nwuffs_base__rect_ie_u32__width(const wuffs_base__rect_ie_u32* r) {\n  return wuffs_base__u32__sat_sub(r->max_excl_x, r->min_incl_x);\n}\n\nstatic inline uint32_t  //\nwuffs_base__rect_ie_u32__height(const wuffs_base__rect_ie_u32* r) {\n  return wuffs_base__u32__sat_sub(r->max_excl_y, r->min_incl_y);\n}\n\n#ifdef __cplusplus\n\ninline bool  //\nwuffs_base__rect_ie_u32::is_empty() const {\n  return wuffs_base__rect_ie_u32__is_empty(this);\n}\n\ninline bool  //\nwuffs_base__rect_ie_u32::equals(wuffs_bas" +
 	"e__rect_ie_u32 s) const {\n  return wuffs_base__rect_ie_u32__equals(this, s);\n}\n\ninline wuffs_base__rect_ie_u32  //\nwuffs_base__rect_ie_u32::intersect(wuffs_base__rect_ie_u32 s) const {\n  return wuffs_base__rect_ie_u32__intersect(this, s);\n}\n\ninline wuffs_base__rect_ie_u32  //\nwuffs_base__rect_ie_u32::unite(wuffs_base__rect_ie_u32 s) const {\n  return wuffs_base__rect_ie_u32__unite(this, s);\n}\n\ninline bool  //\nwuffs_base__rect_ie_u32::contains(uint32_t x, uint32_t y) const {\n  return wuffs_base__rect_ie_u32__contains(this, x, y);\n}\n\ninline bool  //\nwuffs_base__rect_ie_u32::contains_rect(wuffs_base__rect_ie_u32 s) const {\n  return wuffs_base__rect_ie_u32__contains_rect(this, s);\n}\n\ninline uint32_t  //\nwuffs_base__rect_ie_u32::width() const {\n  return wuffs_base__rect_ie_u32__width(this);\n}\n\ninline uint32_t  //\nwuffs_base__rect_ie_u32::height() const {\n  return wuffs_base__rect_ie_u32__height(this);\n}\n\n#endif  // __cplusplus\n\n" +
 	"" +
-	"// ---------------- More Information\n\n// wuffs_base__more_information holds additional fields, typically when a Wuffs\n// method returns a [note status](/doc/note/statuses.md).\n//\n// The flavor field follows the base38 namespace\n// convention](/doc/note/base38-and-fourcc.md). The other fields' semantics\n// depends on the flavor.\ntypedef struct wuffs_base__more_information__struct {\n  uint32_t flavor;\n  uint32_t w;\n  uint64_t x;\n  uint64_t y;\n  uint64_t z;\n\n#ifdef __cplusplus\n  inline void set(uint32_t flavor_arg,\n                  uint32_t w_arg,\n                  uint64_t x_arg,\n                  uint64_t y_arg,\n                  uint64_t z_arg);\n  inline uint32_t io_redirect__fourcc() const;\n  inline wuffs_base__range_ie_u64 io_redirect__range() const;\n  inline uint64_t io_seek__position() const;\n  inline uint32_t metadata__fourcc() const;\n  inline wuffs_base__range_ie_u64 metadata__range() const;\n#endif  // __cplusplus\n\n} wuffs_base__more_information;\n\n#define WUFFS_BASE__MORE_INFORMATION__FLAVOR__IO_REDIRE" +
-	"CT 1\n#define WUFFS_BASE__MORE_INFORMATION__FLAVOR__IO_SEEK 2\n#define WUFFS_BASE__MORE_INFORMATION__FLAVOR__METADATA 3\n\nstatic inline wuffs_base__more_information  //\nwuffs_base__empty_more_information() {\n  wuffs_base__more_information ret;\n  ret.flavor = 0;\n  ret.w = 0;\n  ret.x = 0;\n  ret.y = 0;\n  ret.z = 0;\n  return ret;\n}\n\nstatic inline void  //\nwuffs_base__more_information__set(wuffs_base__more_information* m,\n                                  uint32_t flavor,\n                                  uint32_t w,\n                                  uint64_t x,\n                                  uint64_t y,\n                                  uint64_t z) {\n  if (!m) {\n    return;\n  }\n  m->flavor = flavor;\n  m->w = w;\n  m->x = x;\n  m->y = y;\n  m->z = z;\n}\n\nstatic inline uint32_t  //\nwuffs_base__more_information__io_redirect__fourcc(\n    const wuffs_base__more_information* m) {\n  return m->w;\n}\n\nstatic inline wuffs_base__range_ie_u64  //\nwuffs_base__more_information__io_redirect__range(\n    const wuffs_base__more_informa" +
-	"tion* m) {\n  wuffs_base__range_ie_u64 ret;\n  ret.min_incl = m->y;\n  ret.max_excl = m->z;\n  return ret;\n}\n\nstatic inline uint64_t  //\nwuffs_base__more_information__io_seek__position(\n    const wuffs_base__more_information* m) {\n  return m->x;\n}\n\nstatic inline uint32_t  //\nwuffs_base__more_information__metadata__fourcc(\n    const wuffs_base__more_information* m) {\n  return m->w;\n}\n\nstatic inline wuffs_base__range_ie_u64  //\nwuffs_base__more_information__metadata__range(\n    const wuffs_base__more_information* m) {\n  wuffs_base__range_ie_u64 ret;\n  ret.min_incl = m->y;\n  ret.max_excl = m->z;\n  return ret;\n}\n\n#ifdef __cplusplus\n\ninline void  //\nwuffs_base__more_information::set(uint32_t flavor_arg,\n                                  uint32_t w_arg,\n                                  uint64_t x_arg,\n                                  uint64_t y_arg,\n                                  uint64_t z_arg) {\n  wuffs_base__more_information__set(this, flavor_arg, w_arg, x_arg, y_arg,\n                                    z_arg);" +
-	"\n}\n\ninline uint32_t  //\nwuffs_base__more_information::io_redirect__fourcc() const {\n  return wuffs_base__more_information__io_redirect__fourcc(this);\n}\n\ninline wuffs_base__range_ie_u64  //\nwuffs_base__more_information::io_redirect__range() const {\n  return wuffs_base__more_information__io_redirect__range(this);\n}\n\ninline uint64_t  //\nwuffs_base__more_information::io_seek__position() const {\n  return wuffs_base__more_information__io_seek__position(this);\n}\n\ninline uint32_t  //\nwuffs_base__more_information::metadata__fourcc() const {\n  return wuffs_base__more_information__metadata__fourcc(this);\n}\n\ninline wuffs_base__range_ie_u64  //\nwuffs_base__more_information::metadata__range() const {\n  return wuffs_base__more_information__metadata__range(this);\n}\n\n#endif  // __cplusplus\n" +
+	"// ---------------- More Information\n\n// wuffs_base__more_information holds additional fields, typically when a Wuffs\n// method returns a [note status](/doc/note/statuses.md).\n//\n// The flavor field follows the base38 namespace\n// convention](/doc/note/base38-and-fourcc.md). The other fields' semantics\n// depends on the flavor.\ntypedef struct wuffs_base__more_information__struct {\n  uint32_t flavor;\n  uint32_t w;\n  uint64_t x;\n  uint64_t y;\n  uint64_t z;\n\n#ifdef __cplusplus\n  inline void set(uint32_t flavor_arg,\n                  uint32_t w_arg,\n                  uint64_t x_arg,\n                  uint64_t y_arg,\n                  uint64_t z_arg);\n  inline uint32_t io_redirect__fourcc() const;\n  inline wuffs_base__range_ie_u64 io_redirect__range() const;\n  inline uint64_t io_seek__position() const;\n  inline uint32_t metadata__fourcc() const;\n  inline wuffs_base__range_ie_u64 metadata__range() const;\n  inline void set_metadata(uint32_t fourcc_arg,\n                           uint64_t min_incl_arg,\n              " +
+	"             uint64_t max_excl_arg);\n#endif  // __cplusplus\n\n} wuffs_base__more_information;\n\n#define WUFFS_BASE__MORE_INFORMATION__FLAVOR__IO_REDIRECT 1\n#define WUFFS_BASE__MORE_INFORMATION__FLAVOR__IO_SEEK 2\n#define WUFFS_BASE__MORE_INFORMATION__FLAVOR__METADATA 3\n\nstatic inline wuffs_base__more_information  //\nwuffs_base__empty_more_information() {\n  wuffs_base__more_information ret;\n  ret.flavor = 0;\n  ret.w = 0;\n  ret.x = 0;\n  ret.y = 0;\n  ret.z = 0;\n  return ret;\n}\n\nstatic inline void  //\nwuffs_base__more_information__set(wuffs_base__more_information* m,\n                                  uint32_t flavor,\n                                  uint32_t w,\n                                  uint64_t x,\n                                  uint64_t y,\n                                  uint64_t z) {\n  if (!m) {\n    return;\n  }\n  m->flavor = flavor;\n  m->w = w;\n  m->x = x;\n  m->y = y;\n  m->z = z;\n}\n\n// wuffs_base__more_information__set_metadata is equivalent to\n// wuffs_base__more_information__set with the METADATA f" +
+	"lavor. The metadata's\n// bytes are those in the half-open I/O position range [min_incl, max_excl).\nstatic inline void  //\nwuffs_base__more_information__set_metadata(wuffs_base__more_information* m,\n                                           uint32_t fourcc,\n                                           uint64_t min_incl,\n                                           uint64_t max_excl) {\n  wuffs_base__more_information__set(\n      m, WUFFS_BASE__MORE_INFORMATION__FLAVOR__METADATA, fourcc, 0, min_incl,\n      max_excl);\n}\n\nstatic inline uint32_t  //\nwuffs_base__more_information__io_redirect__fourcc(\n    const wuffs_base__more_information* m) {\n  return m->w;\n}\n\nstatic inline wuffs_base__range_ie_u64  //\nwuffs_base__more_information__io_redirect__range(\n    const wuffs_base__more_information* m) {\n  wuffs_base__range_ie_u64 ret;\n  ret.min_incl = m->y;\n  ret.max_excl = m->z;\n  return ret;\n}\n\nstatic inline uint64_t  //\nwuffs_base__more_information__io_seek__position(\n    const wuffs_base__more_information* m) {\n  return m" +
+	"->x;\n}\n\nstatic inline uint32_t  //\nwuffs_base__more_information__metadata__fourcc(\n    const wuffs_base__more_information* m) {\n  return m->w;\n}\n\nstatic inline wuffs_base__range_ie_u64  //\nwuffs_base__more_information__metadata__range(\n    const wuffs_base__more_information* m) {\n  wuffs_base__range_ie_u64 ret;\n  ret.min_incl = m->y;\n  ret.max_excl = m->z;\n  return ret;\n}\n\n#ifdef __cplusplus\n\ninline void  //\nwuffs_base__more_information::set(uint32_t flavor_arg,\n                                  uint32_t w_arg,\n                                  uint64_t x_arg,\n                                  uint64_t y_arg,\n                                  uint64_t z_arg) {\n  wuffs_base__more_information__set(this, flavor_arg, w_arg, x_arg, y_arg,\n                                    z_arg);\n}\n\ninline uint32_t  //\nwuffs_base__more_information::io_redirect__fourcc() const {\n  return wuffs_base__more_information__io_redirect__fourcc(this);\n}\n\ninline wuffs_base__range_ie_u64  //\nwuffs_base__more_information::io_redirect__range" +
+	"() const {\n  return wuffs_base__more_information__io_redirect__range(this);\n}\n\ninline uint64_t  //\nwuffs_base__more_information::io_seek__position() const {\n  return wuffs_base__more_information__io_seek__position(this);\n}\n\ninline uint32_t  //\nwuffs_base__more_information::metadata__fourcc() const {\n  return wuffs_base__more_information__metadata__fourcc(this);\n}\n\ninline wuffs_base__range_ie_u64  //\nwuffs_base__more_information::metadata__range() const {\n  return wuffs_base__more_information__metadata__range(this);\n}\n\ninline void  //\nwuffs_base__more_information::set_metadata(uint32_t fourcc_arg,\n                                           uint64_t min_incl_arg,\n                                           uint64_t max_excl_arg) {\n  wuffs_base__more_information__set_metadata(this, fourcc_arg, min_incl_arg,\n                                             max_excl_arg);\n}\n\n#endif  // __cplusplus\n" +
 	""
 
 const BaseStrConvPrivateH = "" +
@@ -344,7 +416,7 @@ const BaseTokenPrivateH = "" +
 	""
 
 const BaseTokenPublicH = "" +
-	"// ---------------- Tokens\n\n// wuffs_base__token is an element of a byte stream's tokenization.\n//\n// See https://github.com/google/wuffs/blob/main/doc/note/tokens.md\ntypedef struct wuffs_base__token__struct {\n  uint64_t repr;\n\n#ifdef __cplusplus\n  inline int64_t value() const;\n  inline int64_t value_extension() const;\n  inline int64_t value_major() const;\n  inline int64_t value_base_category() const;\n  inline uint64_t value_minor() const;\n  inline uint64_t value_base_detail() const;\n  inline int64_t value_base_detail__sign_extended() const;\n  inline bool continued() const;\n  inline uint64_t length() const;\n#endif  // __cplusplus\n\n} wuffs_base__token;\n\nstatic inline wuffs_base__token  //\nwuffs_base__make_token(uint64_t repr) {\n  wuffs_base__token ret;\n  ret.repr = repr;\n  return ret;\n}\n\n" +
+	"// ---------------- Tokens\n\n// wuffs_base__token is an element of a byte stream's tokenization.\n//\n// See https://github.com/google/wuffs/blob/main/doc/note/tokens.md\ntypedef struct wuffs_base__token__struct {\n  uint64_t repr;\n\n#ifdef __cplusplus\n  inline int64_t value() const;\n  inline int64_t value_extension() const;\n  inline int64_t value_major() const;\n  inline int64_t value_base_category() const;\n  inline uint64_t value_minor() const;\n  inline uint64_t value_base_detail() const;\n  inline int64_t value_base_detail__sign_extended() const;\n  inline bool continued() const;\n  inline uint64_t length() const;\n#endif  // __cplusplus\n\n} wuffs_base__token;\n\nWUFFS_BASE__STATIC_ASSERT(sizeof(wuffs_base__token) == sizeof(uint64_t),\n                          token_sizeof);\n\nstatic inline wuffs_base__token  //\nwuffs_base__make_token(uint64_t repr) {\n  wuffs_base__token ret;\n  ret.repr = repr;\n  return ret;\n}\n\n" +
 	"" +
 	"// --------\n\n#define WUFFS_BASE__TOKEN__LENGTH__MAX_INCL 0xFFFF\n\n#define WUFFS_BASE__TOKEN__VALUE__SHIFT 17\n#define WUFFS_BASE__TOKEN__VALUE_EXTENSION__SHIFT 17\n#define WUFFS_BASE__TOKEN__VALUE_MAJOR__SHIFT 42\n#define WUFFS_BASE__TOKEN__VALUE_MINOR__SHIFT 17\n#define WUFFS_BASE__TOKEN__VALUE_BASE_CATEGORY__SHIFT 38\n#define WUFFS_BASE__TOKEN__VALUE_BASE_DETAIL__SHIFT 17\n#define WUFFS_BASE__TOKEN__CONTINUED__SHIFT 16\n#define WUFFS_BASE__TOKEN__LENGTH__SHIFT 0\n\n#define WUFFS_BASE__TOKEN__VALUE_EXTENSION__NUM_BITS 46\n\n" +
 	"" +
@@ -371,12 +443,13 @@ const BaseTokenPublicH = "" +
 	"// --------\n\ntypedef WUFFS_BASE__SLICE(wuffs_base__token) wuffs_base__slice_token;\n\nstatic inline wuffs_base__slice_token  //\nwuffs_base__make_slice_token(wuffs_base__token* ptr, size_t len) {\n  wuffs_base__slice_token ret;\n  ret.ptr = ptr;\n  ret.len = len;\n  return ret;\n}\n\nstatic inline wuffs_base__slice_token  //\nwuffs_base__empty_slice_token() {\n  wuffs_base__slice_token ret;\n  ret.ptr = NULL;\n  ret.len = 0;\n  return ret;\n}\n\n" +
 	"" +
 	"// --------\n\n// wuffs_base__token_buffer_meta is the metadata for a\n// wuffs_base__token_buffer's data.\ntypedef struct wuffs_base__token_buffer_meta__struct {\n  size_t wi;     // Write index. Invariant: wi <= len.\n  size_t ri;     // Read  index. Invariant: ri <= wi.\n  uint64_t pos;  // Position of the buffer start relative to the stream start.\n  bool closed;   // No further writes are expected.\n} wuffs_base__token_buffer_meta;\n\n// wuffs_base__token_buffer is a 1-dimensional buffer (a pointer and length)\n// plus additional metadata.\n//\n// A value with all fields zero is a valid, empty buffer.\ntypedef struct wuffs_base__token_buffer__struct {\n  wuffs_base__slice_token data;\n  wuffs_base__token_buffer_meta meta;\n\n#ifdef __cplusplus\n  inline bool is_valid() const;\n  inline void compact();\n  inline uint64_t reader_length() const;\n  inline wuffs_base__token* reader_pointer() const;\n  inline wuffs_base__slice_token reader_slice() const;\n  inline uint64_t reader_token_position() const;\n  inline uint64_t writer_lengt" +
-	"h() const;\n  inline uint64_t writer_token_position() const;\n  inline wuffs_base__token* writer_pointer() const;\n  inline wuffs_base__slice_token writer_slice() const;\n#endif  // __cplusplus\n\n} wuffs_base__token_buffer;\n\nstatic inline wuffs_base__token_buffer  //\nwuffs_base__make_token_buffer(wuffs_base__slice_token data,\n                              wuffs_base__token_buffer_meta meta) {\n  wuffs_base__token_buffer ret;\n  ret.data = data;\n  ret.meta = meta;\n  return ret;\n}\n\nstatic inline wuffs_base__token_buffer_meta  //\nwuffs_base__make_token_buffer_meta(size_t wi,\n                                   size_t ri,\n                                   uint64_t pos,\n                                   bool closed) {\n  wuffs_base__token_buffer_meta ret;\n  ret.wi = wi;\n  ret.ri = ri;\n  ret.pos = pos;\n  ret.closed = closed;\n  return ret;\n}\n\nstatic inline wuffs_base__token_buffer  //\nwuffs_base__slice_token__reader(wuffs_base__slice_token s, bool closed) {\n  wuffs_base__token_buffer ret;\n  ret.data.ptr = s.ptr;\n  ret.data" +
-	".len = s.len;\n  ret.meta.wi = s.len;\n  ret.meta.ri = 0;\n  ret.meta.pos = 0;\n  ret.meta.closed = closed;\n  return ret;\n}\n\nstatic inline wuffs_base__token_buffer  //\nwuffs_base__slice_token__writer(wuffs_base__slice_token s) {\n  wuffs_base__token_buffer ret;\n  ret.data.ptr = s.ptr;\n  ret.data.len = s.len;\n  ret.meta.wi = 0;\n  ret.meta.ri = 0;\n  ret.meta.pos = 0;\n  ret.meta.closed = false;\n  return ret;\n}\n\nstatic inline wuffs_base__token_buffer  //\nwuffs_base__empty_token_buffer() {\n  wuffs_base__token_buffer ret;\n  ret.data.ptr = NULL;\n  ret.data.len = 0;\n  ret.meta.wi = 0;\n  ret.meta.ri = 0;\n  ret.meta.pos = 0;\n  ret.meta.closed = false;\n  return ret;\n}\n\nstatic inline wuffs_base__token_buffer_meta  //\nwuffs_base__empty_token_buffer_meta() {\n  wuffs_base__token_buffer_meta ret;\n  ret.wi = 0;\n  ret.ri = 0;\n  ret.pos = 0;\n  ret.closed = false;\n  return ret;\n}\n\nstatic inline bool  //\nwuffs_base__token_buffer__is_valid(const wuffs_base__token_buffer* buf) {\n  if (buf) {\n    if (buf->data.ptr) {\n      return (buf->m" +
-	"eta.ri <= buf->meta.wi) && (buf->meta.wi <= buf->data.len);\n    } else {\n      return (buf->meta.ri == 0) && (buf->meta.wi == 0) && (buf->data.len == 0);\n    }\n  }\n  return false;\n}\n\n// wuffs_base__token_buffer__compact moves any written but unread tokens to the\n// start of the buffer.\nstatic inline void  //\nwuffs_base__token_buffer__compact(wuffs_base__token_buffer* buf) {\n  if (!buf || (buf->meta.ri == 0)) {\n    return;\n  }\n  buf->meta.pos = wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.ri);\n  size_t n = buf->meta.wi - buf->meta.ri;\n  if (n != 0) {\n    memmove(buf->data.ptr, buf->data.ptr + buf->meta.ri,\n            n * sizeof(wuffs_base__token));\n  }\n  buf->meta.wi = n;\n  buf->meta.ri = 0;\n}\n\nstatic inline uint64_t  //\nwuffs_base__token_buffer__reader_length(const wuffs_base__token_buffer* buf) {\n  return buf ? buf->meta.wi - buf->meta.ri : 0;\n}\n\nstatic inline wuffs_base__token*  //\nwuffs_base__token_buffer__reader_pointer(const wuffs_base__token_buffer* buf) {\n  return buf ? (buf->data.ptr + buf->meta" +
-	".ri) : NULL;\n}\n\nstatic inline wuffs_base__slice_token  //\nwuffs_base__token_buffer__reader_slice(const wuffs_base__token_buffer* buf) {\n  return buf ? wuffs_base__make_slice_token(buf->data.ptr + buf->meta.ri,\n                                            buf->meta.wi - buf->meta.ri)\n             : wuffs_base__empty_slice_token();\n}\n\nstatic inline uint64_t  //\nwuffs_base__token_buffer__reader_token_position(\n    const wuffs_base__token_buffer* buf) {\n  return buf ? wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.ri) : 0;\n}\n\nstatic inline uint64_t  //\nwuffs_base__token_buffer__writer_length(const wuffs_base__token_buffer* buf) {\n  return buf ? buf->data.len - buf->meta.wi : 0;\n}\n\nstatic inline wuffs_base__token*  //\nwuffs_base__token_buffer__writer_pointer(const wuffs_base__token_buffer* buf) {\n  return buf ? (buf->data.ptr + buf->meta.wi) : NULL;\n}\n\nstatic inline wuffs_base__slice_token  //\nwuffs_base__token_buffer__writer_slice(const wuffs_base__token_buffer* buf) {\n  return buf ? wuffs_base__make_slice_toke" +
-	"n(buf->data.ptr + buf->meta.wi,\n                                            buf->data.len - buf->meta.wi)\n             : wuffs_base__empty_slice_token();\n}\n\nstatic inline uint64_t  //\nwuffs_base__token_buffer__writer_token_position(\n    const wuffs_base__token_buffer* buf) {\n  return buf ? wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.wi) : 0;\n}\n\n#ifdef __cplusplus\n\ninline bool  //\nwuffs_base__token_buffer::is_valid() const {\n  return wuffs_base__token_buffer__is_valid(this);\n}\n\ninline void  //\nwuffs_base__token_buffer::compact() {\n  wuffs_base__token_buffer__compact(this);\n}\n\ninline uint64_t  //\nwuffs_base__token_buffer::reader_length() const {\n  return wuffs_base__token_buffer__reader_length(this);\n}\n\ninline wuffs_base__token*  //\nwuffs_base__token_buffer::reader_pointer() const {\n  return wuffs_base__token_buffer__reader_pointer(this);\n}\n\ninline wuffs_base__slice_token  //\nwuffs_base__token_buffer::reader_slice() const {\n  return wuffs_base__token_buffer__reader_slice(this);\n}\n\ninline uint64_t  //\nwuff" +
-	"s_base__token_buffer::reader_token_position() const {\n  return wuffs_base__token_buffer__reader_token_position(this);\n}\n\ninline uint64_t  //\nwuffs_base__token_buffer::writer_length() const {\n  return wuffs_base__token_buffer__writer_length(this);\n}\n\ninline wuffs_base__token*  //\nwuffs_base__token_buffer::writer_pointer() const {\n  return wuffs_base__token_buffer__writer_pointer(this);\n}\n\ninline wuffs_base__slice_token  //\nwuffs_base__token_buffer::writer_slice() const {\n  return wuffs_base__token_buffer__writer_slice(this);\n}\n\ninline uint64_t  //\nwuffs_base__token_buffer::writer_token_position() const {\n  return wuffs_base__token_buffer__writer_token_position(this);\n}\n\n#endif  // __cplusplus\n" +
+	"h() const;\n  inline uint64_t writer_token_position() const;\n  inline wuffs_base__token* writer_pointer() const;\n  inline wuffs_base__slice_token writer_slice() const;\n#endif  // __cplusplus\n\n} wuffs_base__token_buffer;\n\nWUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__token_buffer, meta) ==\n                              sizeof(wuffs_base__slice_token),\n                          token_buffer_meta_offset);\nWUFFS_BASE__STATIC_ASSERT(sizeof(wuffs_base__token_buffer) ==\n                              (sizeof(wuffs_base__slice_token) +\n                               sizeof(wuffs_base__token_buffer_meta)),\n                          token_buffer_sizeof);\n\nstatic inline wuffs_base__token_buffer  //\nwuffs_base__make_token_buffer(wuffs_base__slice_token data,\n                              wuffs_base__token_buffer_meta meta) {\n  wuffs_base__token_buffer ret;\n  ret.data = data;\n  ret.meta = meta;\n  return ret;\n}\n\nstatic inline wuffs_base__token_buffer_meta  //\nwuffs_base__make_token_buffer_meta(size_t wi,\n                   " +
+	"                size_t ri,\n                                   uint64_t pos,\n                                   bool closed) {\n  wuffs_base__token_buffer_meta ret;\n  ret.wi = wi;\n  ret.ri = ri;\n  ret.pos = pos;\n  ret.closed = closed;\n  return ret;\n}\n\nstatic inline wuffs_base__token_buffer  //\nwuffs_base__slice_token__reader(wuffs_base__slice_token s, bool closed) {\n  wuffs_base__token_buffer ret;\n  ret.data.ptr = s.ptr;\n  ret.data.len = s.len;\n  ret.meta.wi = s.len;\n  ret.meta.ri = 0;\n  ret.meta.pos = 0;\n  ret.meta.closed = closed;\n  return ret;\n}\n\nstatic inline wuffs_base__token_buffer  //\nwuffs_base__slice_token__writer(wuffs_base__slice_token s) {\n  wuffs_base__token_buffer ret;\n  ret.data.ptr = s.ptr;\n  ret.data.len = s.len;\n  ret.meta.wi = 0;\n  ret.meta.ri = 0;\n  ret.meta.pos = 0;\n  ret.meta.closed = false;\n  return ret;\n}\n\nstatic inline wuffs_base__token_buffer  //\nwuffs_base__empty_token_buffer() {\n  wuffs_base__token_buffer ret;\n  ret.data.ptr = NULL;\n  ret.data.len = 0;\n  ret.meta.wi = 0;\n  ret.meta.r" +
+	"i = 0;\n  ret.meta.pos = 0;\n  ret.meta.closed = false;\n  return ret;\n}\n\nstatic inline wuffs_base__token_buffer_meta  //\nwuffs_base__empty_token_buffer_meta() {\n  wuffs_base__token_buffer_meta ret;\n  ret.wi = 0;\n  ret.ri = 0;\n  ret.pos = 0;\n  ret.closed = false;\n  return ret;\n}\n\nstatic inline bool  //\nwuffs_base__token_buffer__is_valid(const wuffs_base__token_buffer* buf) {\n  if (buf) {\n    if (buf->data.ptr) {\n      return (buf->meta.ri <= buf->meta.wi) && (buf->meta.wi <= buf->data.len);\n    } else {\n      return (buf->meta.ri == 0) && (buf->meta.wi == 0) && (buf->data.len == 0);\n    }\n  }\n  return false;\n}\n\n// wuffs_base__token_buffer__compact moves any written but unread tokens to the\n// start of the buffer.\nstatic inline void  //\nwuffs_base__token_buffer__compact(wuffs_base__token_buffer* buf) {\n  if (!buf || (buf->meta.ri == 0)) {\n    return;\n  }\n  buf->meta.pos = wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.ri);\n  size_t n = buf->meta.wi - buf->meta.ri;\n  if (n != 0) {\n    memmove(buf->data.ptr, buf" +
+	"->data.ptr + buf->meta.ri,\n            n * sizeof(wuffs_base__token));\n  }\n  buf->meta.wi = n;\n  buf->meta.ri = 0;\n}\n\nstatic inline uint64_t  //\nwuffs_base__token_buffer__reader_length(const wuffs_base__token_buffer* buf) {\n  return buf ? buf->meta.wi - buf->meta.ri : 0;\n}\n\nstatic inline wuffs_base__token*  //\nwuffs_base__token_buffer__reader_pointer(const wuffs_base__token_buffer* buf) {\n  return buf ? (buf->data.ptr + buf->meta.ri) : NULL;\n}\n\nstatic inline wuffs_base__slice_token  //\nwuffs_base__token_buffer__reader_slice(const wuffs_base__token_buffer* buf) {\n  return buf ? wuffs_base__make_slice_token(buf->data.ptr + buf->meta.ri,\n                                            buf->meta.wi - buf->meta.ri)\n             : wuffs_base__empty_slice_token();\n}\n\nstatic inline uint64_t  //\nwuffs_base__token_buffer__reader_token_position(\n    const wuffs_base__token_buffer* buf) {\n  return buf ? wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.ri) : 0;\n}\n\nstatic inline uint64_t  //\nwuffs_base__token_buffer__writer_l" +
+	"ength(const wuffs_base__token_buffer* buf) {\n  return buf ? buf->data.len - buf->meta.wi : 0;\n}\n\nstatic inline wuffs_base__token*  //\nwuffs_base__token_buffer__writer_pointer(const wuffs_base__token_buffer* buf) {\n  return buf ? (buf->data.ptr + buf->meta.wi) : NULL;\n}\n\nstatic inline wuffs_base__slice_token  //\nwuffs_base__token_buffer__writer_slice(const wuffs_base__token_buffer* buf) {\n  return buf ? wuffs_base__make_slice_token(buf->data.ptr + buf->meta.wi,\n                                            buf->data.len - buf->meta.wi)\n             : wuffs_base__empty_slice_token();\n}\n\nstatic inline uint64_t  //\nwuffs_base__token_buffer__writer_token_position(\n    const wuffs_base__token_buffer* buf) {\n  return buf ? wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.wi) : 0;\n}\n\n#ifdef __cplusplus\n\ninline bool  //\nwuffs_base__token_buffer::is_valid() const {\n  return wuffs_base__token_buffer__is_valid(this);\n}\n\ninline void  //\nwuffs_base__token_buffer::compact() {\n  wuffs_base__token_buffer__compact(this);\n}\n\ninl" +
+	"ine uint64_t  //\nwuffs_base__token_buffer::reader_length() const {\n  return wuffs_base__token_buffer__reader_length(this);\n}\n\ninline wuffs_base__token*  //\nwuffs_base__token_buffer::reader_pointer() const {\n  return wuffs_base__token_buffer__reader_pointer(this);\n}\n\ninline wuffs_base__slice_token  //\nwuffs_base__token_buffer::reader_slice() const {\n  return wuffs_base__token_buffer__reader_slice(this);\n}\n\ninline uint64_t  //\nwuffs_base__token_buffer::reader_token_position() const {\n  return wuffs_base__token_buffer__reader_token_position(this);\n}\n\ninline uint64_t  //\nwuffs_base__token_buffer::writer_length() const {\n  return wuffs_base__token_buffer__writer_length(this);\n}\n\ninline wuffs_base__token*  //\nwuffs_base__token_buffer::writer_pointer() const {\n  return wuffs_base__token_buffer__writer_pointer(this);\n}\n\ninline wuffs_base__slice_token  //\nwuffs_base__token_buffer::writer_slice() const {\n  return wuffs_base__token_buffer__writer_slice(this);\n}\n\ninline uint64_t  //\nwuffs_base__token_buffer::writer_token" +
+	"_position() const {\n  return wuffs_base__token_buffer__writer_token_position(this);\n}\n\n#endif  // __cplusplus\n" +
 	""
 
 const BaseFloatConvSubmoduleCodeC = "" +
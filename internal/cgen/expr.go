@@ -70,9 +70,8 @@ func (g *gen) writeExprOther(b *buffer, n *a.Expr, sideEffectsOnly bool, depth u
 
 		} else if ident == t.IDCoroutineResumed {
 			if g.currFunk.astFunc.Effect().Coroutine() {
-				// TODO: don't hard-code [0], and allow recursive coroutines.
-				b.printf("(self->private_impl.%s%s[0] != 0)",
-					pPrefix, g.currFunk.astFunc.FuncName().Str(g.tm))
+				b.printf("(self->private_impl.%s%s%s != 0)",
+					pPrefix, g.currFunk.astFunc.FuncName().Str(g.tm), g.coroFrame())
 			} else {
 				b.writes("false")
 			}
@@ -205,6 +204,7 @@ func (g *gen) writeExprOther(b *buffer, n *a.Expr, sideEffectsOnly bool, depth u
 			if mcv != nil {
 				length = big.NewInt(0).Sub(length, mcv)
 			}
+			g.audit32(n, length, "size_t", "length of the slice")
 			b.writes(length.String())
 			b.writeb(')')
 		}
@@ -284,37 +284,110 @@ func (g *gen) writeExprUnaryOp(b *buffer, n *a.Expr, depth uint32) error {
 	return g.writeExpr(b, n.RHS().AsExpr(), false, depth)
 }
 
+// shiftCountIsSmall returns whether the "x ~mod<< n" or "x ~mod>> n" shift
+// count n is known to be less than uBits, the bit width of x's type, so that
+// the C "<<" or ">>" operator's behavior is defined. It only looks at n's
+// constant value, type and syntax, not at n's bounds (which depend on facts)
+// so that the generated code does not depend on whether bounds checking used
+// a cache.
+func shiftCountIsSmall(n *a.Expr, uBits uint32) bool {
+	limit := big.NewInt(int64(uBits))
+	if cv := n.ConstValue(); cv != nil {
+		return cv.Cmp(limit) < 0
+	}
+	if n.Operator() == t.IDXBinaryAmp {
+		return shiftCountIsSmall(n.LHS().AsExpr(), uBits) ||
+			shiftCountIsSmall(n.RHS().AsExpr(), uBits)
+	}
+	if typ := n.MType(); typ.IsRefined() {
+		if m := typ.Max(); (m != nil) && (m.ConstValue() != nil) {
+			return m.ConstValue().Cmp(limit) < 0
+		}
+	}
+	return false
+}
+
+// tildeOpPrefix returns the "u8", "i32", etc. part of the C helper function
+// names (such as "wuffs_base__u8__sat_add") for the tilde-operators on typ,
+// along with typ's bit width. It returns zero bits for unsupported types.
+func tildeOpPrefix(typ *a.TypeExpr) (prefix string, bits uint32) {
+	if bits = uintBits(typ.QID()); bits != 0 {
+		return "u", bits
+	}
+	if bits = sintBits(typ.QID()); bits != 0 {
+		return "i", bits
+	}
+	return "", 0
+}
+
 func (g *gen) writeExprBinaryOp(b *buffer, n *a.Expr, depth uint32) error {
 	opName, lhsCast, tildeMod := "", false, false
 
+	// uCast is non-zero for signed integer ops that could overflow (in C, if
+	// not in Wuffs). It is the bit width of the unsigned C type that the
+	// arguments are converted to, as signed integer overflow (and left
+	// shifting a negative value) is undefined behavior in C but unsigned
+	// integer arithmetic wraps around. It is at least 32 so that the C integer
+	// promotions don't convert back to a (signed) int.
+	uCast, uCastRHS := uint32(0), false
+	if sBits := sintBits(n.MType().QID()); sBits > 32 {
+		uCast = 64
+	} else if sBits > 0 {
+		uCast = 32
+	}
+
 	op := n.Operator()
 	switch op {
 	case t.IDXBinaryTildeSatPlus, t.IDXBinaryTildeSatMinus:
-		uBits := uintBits(n.MType().QID())
-		if uBits == 0 {
+		prefix, xBits := tildeOpPrefix(n.MType())
+		if xBits == 0 {
 			return fmt.Errorf("unsupported tilde-operator type %q", n.MType().Str(g.tm))
 		}
 		uOp := "add"
 		if op != t.IDXBinaryTildeSatPlus {
 			uOp = "sub"
 		}
-		b.printf("wuffs_base__u%d__sat_%s", uBits, uOp)
-		opName = ", "
+		b.printf("wuffs_base__%s%d__sat_%s", prefix, xBits, uOp)
+		opName, uCast = ", ", 0
 
 	case t.IDXBinaryAs:
 		return g.writeExprAs(b, n.LHS().AsExpr(), n.RHS().AsTypeExpr(), depth)
 
 	case t.IDXBinaryTildeModPlus, t.IDXBinaryTildeModMinus, t.IDXBinaryTildeModStar:
-		tildeMod = true
+		tildeMod, uCastRHS = true, true
 
-	case t.IDXBinaryTildeModShiftL:
-		tildeMod = true
+	case t.IDXBinaryTildeModShiftL, t.IDXBinaryTildeModShiftR:
+		prefix, xBits := tildeOpPrefix(n.MType())
+		if xBits == 0 {
+			return fmt.Errorf("unsupported tilde-operator type %q", n.MType().Str(g.tm))
+		}
+		if !shiftCountIsSmall(n.RHS().AsExpr(), xBits) {
+			uOp := "left"
+			if op != t.IDXBinaryTildeModShiftL {
+				uOp = "right"
+			}
+			b.printf("wuffs_base__%s%d__mod_shift_%s", prefix, xBits, uOp)
+			opName, uCast = ", ", 0
+			break
+		}
+		tildeMod = op == t.IDXBinaryTildeModShiftL
 		fallthrough
 
 	case t.IDXBinaryShiftL, t.IDXBinaryShiftR:
 		if lhs := n.LHS().AsExpr(); lhs.ConstValue() != nil {
 			lhsCast = true
 		}
+		if op == t.IDXBinaryShiftL {
+			tildeMod = uCast != 0
+		} else if !tildeMod {
+			// Signed ">>" is an arithmetic shift. C leaves right shifting a
+			// negative value as implementation-defined, but every C compiler
+			// that Wuffs supports does an arithmetic shift.
+			uCast = 0
+		}
+
+	default:
+		uCast = 0
 	}
 
 	if opName == "" {
@@ -333,7 +406,9 @@ func (g *gen) writeExprBinaryOp(b *buffer, n *a.Expr, depth uint32) error {
 		b.writes(")(")
 	}
 
-	if lhsCast {
+	if uCast != 0 {
+		b.printf("((uint%d_t)(", uCast)
+	} else if lhsCast {
 		b.writes("((")
 		if err := g.writeCTypeName(b, n.LHS().AsExpr().MType(), "", ""); err != nil {
 			return err
@@ -343,15 +418,21 @@ func (g *gen) writeExprBinaryOp(b *buffer, n *a.Expr, depth uint32) error {
 	if err := g.writeExprRepr(b, n.LHS().AsExpr(), depth); err != nil {
 		return err
 	}
-	if lhsCast {
+	if (uCast != 0) || lhsCast {
 		b.writes("))")
 	}
 
 	b.writes(opName)
 
+	if uCastRHS && (uCast != 0) {
+		b.printf("((uint%d_t)(", uCast)
+	}
 	if err := g.writeExprRepr(b, n.RHS().AsExpr(), depth); err != nil {
 		return err
 	}
+	if uCastRHS && (uCast != 0) {
+		b.writes("))")
+	}
 
 	if tildeMod {
 		b.writeb(')')
@@ -408,10 +489,29 @@ func (g *gen) writeExprAssociativeOp(b *buffer, n *a.Expr, depth uint32) error {
 		opName = strings.TrimRight(opName, " ") + "\n"
 	}
 
+	// If the arguments have mixed types, the checker implicitly widens them
+	// all to n's type. C evaluates "a + b + c" left to right, as "(a + b) +
+	// c", so that converting the first argument to n's type means that the
+	// partial results are also computed with (at least) n's type.
+	castFirst := false
+	if nTyp := n.MType(); nTyp.IsNumType() {
+		for _, o := range n.Args() {
+			if oTyp := o.AsExpr().MType(); !oTyp.IsIdeal() && !oTyp.EqIgnoringRefinements(nTyp) {
+				castFirst = !n.Args()[0].AsExpr().MType().EqIgnoringRefinements(nTyp)
+				break
+			}
+		}
+	}
+
 	b.writeb('(')
 	for i, o := range n.Args() {
 		if i != 0 {
 			b.writes(opName)
+		} else if castFirst {
+			if err := g.writeExprAs(b, o.AsExpr(), n.MType(), depth); err != nil {
+				return err
+			}
+			continue
 		}
 		if err := g.writeExpr(b, o.AsExpr(), false, depth); err != nil {
 			return err
@@ -524,6 +624,7 @@ func (g *gen) writeCTypeName(b *buffer, n *a.TypeExpr, varNamePrefix string, var
 
 	x = n
 	for ; x != nil && x.IsArrayType(); x = x.Inner() {
+		g.audit32(x.ArrayLength(), nil, "size_t", "array length")
 		b.writeb('[')
 		b.writes(x.ArrayLength().ConstValue().String())
 		b.writeb(']')
@@ -586,6 +687,8 @@ var cTypeNames = [...]string{
 	t.IDARMNeonU16x8: "uint16x8_t",
 	t.IDARMNeonU32x4: "uint32x4_t",
 	t.IDARMNeonU64x2: "uint64x2_t",
+	t.IDARMSVEU8:     "svuint8_t",
+	t.IDRISCVVU8:     "vuint8m1_t",
 	t.IDX86M128I:     "__m128i",
 }
 
@@ -615,6 +718,7 @@ var cOpNames = [...]string{
 	t.IDTildeModMinusEq:  " -= ",
 	t.IDTildeModStarEq:   " *= ",
 	t.IDTildeModShiftLEq: " <<= ",
+	t.IDTildeModShiftREq: " >>= ",
 	t.IDTildeSatPlusEq:   noSuchCOperator,
 	t.IDTildeSatMinusEq:  noSuchCOperator,
 
@@ -635,6 +739,7 @@ var cOpNames = [...]string{
 	t.IDXBinaryTildeModMinus:  " - ",
 	t.IDXBinaryTildeModStar:   " * ",
 	t.IDXBinaryTildeModShiftL: " << ",
+	t.IDXBinaryTildeModShiftR: " >> ",
 	t.IDXBinaryTildeSatPlus:   noSuchCOperator,
 	t.IDXBinaryTildeSatMinus:  noSuchCOperator,
 	t.IDXBinaryNotEq:          " != ",
@@ -212,6 +212,9 @@ func (g *gen) writeFuncPrototype(b *buffer, n *a.Func) error {
 	if err := g.writeFuncSignature(b, n, wfsCDecl); err != nil {
 		return err
 	}
+	if n.Public() && !n.Receiver().IsZero() {
+		b.printf("\n%s(self)", threadSafetyRequires(n))
+	}
 	b.writes(";\n")
 	if caMacro != "" {
 		b.printf("#endif  // defined(WUFFS_BASE__CPU_ARCH__%s)\n", caMacro)
@@ -226,6 +229,15 @@ func (g *gen) writeFuncPrototype(b *buffer, n *a.Func) error {
 	return nil
 }
 
+// threadSafetyRequires returns the macro that annotates that the method n
+// requires holding its receiver. See WUFFS_CONFIG__THREAD_SAFETY_ANNOTATIONS.
+func threadSafetyRequires(n *a.Func) string {
+	if n.Effect().Pure() {
+		return "WUFFS_BASE__REQUIRES_SHARED"
+	}
+	return "WUFFS_BASE__REQUIRES"
+}
+
 func (g *gen) writeFuncImpl(b *buffer, n *a.Func) error {
 	k := g.funks[n.QQID()]
 
@@ -236,6 +248,10 @@ func (g *gen) writeFuncImpl(b *buffer, n *a.Func) error {
 	if caName != "" {
 		b.printf("// ‼ WUFFS MULTI-FILE SECTION +%s\n", caName)
 	}
+	if g.patch {
+		b.printf("// ‼ WUFFS PATCH +%s %s\n", k.cName, g.patchDigests[k.cName])
+	}
+	implStart := len(*b)
 	b.printf("// -------- func %s.%s\n\n", g.pkgName, n.QQID().Str(g.tm))
 	if caMacro != "" {
 		b.printf("#if defined(WUFFS_BASE__CPU_ARCH__%s)\n", caMacro)
@@ -243,11 +259,17 @@ func (g *gen) writeFuncImpl(b *buffer, n *a.Func) error {
 	if caAttribute != "" {
 		b.printf("%s\n", caAttribute)
 	}
+	if !n.Receiver().IsZero() {
+		// Calling sub-structs' methods doesn't acquire them. The analysis is
+		// for Wuffs' callers, not Wuffs' implementation.
+		b.writes("WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS\n")
+	}
 
 	if err := g.writeFuncSignature(b, n, wfsCDecl); err != nil {
 		return err
 	}
 	b.writes(" {\n")
+	g.writeWorkbufLessDispatch(b, n)
 
 	if n.Choosy() {
 		b.printf("return (*self->private_impl.choosy_%s)(self", n.FuncName().Str(g.tm))
@@ -256,6 +278,7 @@ func (g *gen) writeFuncImpl(b *buffer, n *a.Func) error {
 		}
 		b.writes(");\n}\n\n")
 
+		b.writes("WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS\n")
 		if err := g.writeFuncSignature(b, n, wfsCDeclChoosy); err != nil {
 			return err
 		}
@@ -280,6 +303,10 @@ func (g *gen) writeFuncImpl(b *buffer, n *a.Func) error {
 	if caMacro != "" {
 		b.printf("#endif  // defined(WUFFS_BASE__CPU_ARCH__%s)\n", caMacro)
 	}
+	g.recordFuncSize(n, (*b)[implStart:])
+	if g.patch {
+		b.printf("// ‼ WUFFS PATCH -%s\n", k.cName)
+	}
 	if caName != "" {
 		b.printf("// ‼ WUFFS MULTI-FILE SECTION -%s\n", caName)
 	}
@@ -288,6 +315,16 @@ func (g *gen) writeFuncImpl(b *buffer, n *a.Func) error {
 }
 
 func (g *gen) gatherFuncImpl(_ *buffer, n *a.Func) error {
+	if g.interrupt != nil {
+		if err := g.interrupt(); err != nil {
+			return err
+		}
+	}
+	return errorAt(n.AsNode(), g.gatherFuncImpl1(n))
+}
+
+func (g *gen) gatherFuncImpl1(n *a.Func) error {
+
 	coroID := uint32(0)
 	if n.Public() && n.Effect().Coroutine() {
 		g.numPublicCoroutines[n.Receiver()]++
@@ -364,6 +401,9 @@ func writeOutParamZeroValue(b *buffer, tm *t.Map, typ *a.TypeExpr) error {
 		case t.IDRectIIU32:
 			b.writes("wuffs_base__utility__empty_rect_ii_u32()")
 			return nil
+		case t.IDOptionalU32:
+			b.writes("wuffs_base__empty_optional_u32()")
+			return nil
 		}
 	}
 	return fmt.Errorf("internal error: cannot write the zero value of type %q", typ.Str(tm))
@@ -436,6 +476,10 @@ func (g *gen) writeFuncImplPrologue(b *buffer) error {
 		b.printf("wuffs_base__status status = wuffs_base__make_status(NULL);\n")
 	}
 
+	if funcHasTelemetry(g.currFunk.astFunc) {
+		g.writeTelemetryBegin(b, g.currFunk.astFunc)
+	}
+
 	if oldLenB != len(*b) {
 		b.writes("\n")
 	}
@@ -465,9 +509,8 @@ func (g *gen) writeFuncImplPrologue(b *buffer) error {
 
 func (g *gen) writeFuncImplBodyResume(b *buffer) error {
 	if g.currFunk.coroSuspPoint > 0 {
-		// TODO: don't hard-code [0], and allow recursive coroutines.
-		b.printf("uint32_t coro_susp_point = self->private_impl.%s%s[0];\n",
-			pPrefix, g.currFunk.astFunc.FuncName().Str(g.tm))
+		b.printf("uint32_t coro_susp_point = self->private_impl.%s%s%s;\n",
+			pPrefix, g.currFunk.astFunc.FuncName().Str(g.tm), g.coroFrame())
 
 		resumeBuffer := buffer{}
 		if err := g.writeResumeSuspend(&resumeBuffer, &g.currFunk, false); err != nil {
@@ -503,15 +546,16 @@ func (g *gen) writeFuncImplBodySuspend(b *buffer) error {
 		// suspension point so that the next call to this function starts at
 		// the top.
 		b.writes("\ngoto ok;\nok:\n") // The goto avoids the "unused label" warning.
-		b.printf("self->private_impl.%s%s[0] = 0;\n",
-			pPrefix, g.currFunk.astFunc.FuncName().Str(g.tm))
+		b.printf("self->private_impl.%s%s%s = 0;\n",
+			pPrefix, g.currFunk.astFunc.FuncName().Str(g.tm), g.coroFrame())
 		b.writes("goto exit;\n}\n\n") // Close the coroutine switch.
 
 		b.writes("goto suspend;\nsuspend:\n") // The goto avoids the "unused label" warning.
+		b.writes(g.instrumentSuspend())
 
-		b.printf("self->private_impl.%s%s[0] = "+
+		b.printf("self->private_impl.%s%s%s = "+
 			"wuffs_base__status__is_suspension(&status) ? coro_susp_point : 0;\n",
-			pPrefix, g.currFunk.astFunc.FuncName().Str(g.tm))
+			pPrefix, g.currFunk.astFunc.FuncName().Str(g.tm), g.coroFrame())
 		if g.currFunk.astFunc.Public() {
 			b.printf("self->private_impl.active_coroutine = "+
 				"wuffs_base__status__is_suspension(&status) ? %d : 0;\n", g.currFunk.coroID)
@@ -534,12 +578,19 @@ func (g *gen) writeFuncImplEpilogue(b *buffer) error {
 
 		b.writes("goto exit;\nexit:\n") // The goto avoids the "unused label" warning.
 
+		epilogue = g.instrumentReturn()
 		if g.currFunk.astFunc.Public() {
-			epilogue = "if (wuffs_base__status__is_error(&status)) {\n" +
+			if funcHasTelemetry(g.currFunk.astFunc) {
+				epilogue += g.telemetryEnd(g.currFunk.astFunc)
+			}
+			if g.funcRecordsFrameIOPosition(g.currFunk.astFunc) {
+				epilogue += g.frameIOPositionRecord()
+			}
+			epilogue += "if (wuffs_base__status__is_error(&status)) {\n" +
 				"self->private_impl.magic = WUFFS_BASE__DISABLED;\n}\n" +
 				"return status;\n"
 		} else {
-			epilogue = "return status;\n"
+			epilogue += "return status;\n"
 		}
 	} else if g.currFunk.astFunc.Out() == nil {
 		epilogue = "return wuffs_base__make_empty_struct();\n"
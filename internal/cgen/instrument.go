@@ -0,0 +1,72 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with the -instrument flag. With it, the generated code calls
+// these C macros, whose first two arguments are the receiver (or NULL, for
+// functions without one) and the function's C name, as a string literal:
+//
+//   - WUFFS_BASE__INSTRUMENT__SUSPEND(self, func, point, status) when a
+//     coroutine suspends, at the given coro_susp_point.
+//   - WUFFS_BASE__INSTRUMENT__RETURN(self, func, status) when a function that
+//     returns a status (such as a coroutine) returns.
+//   - WUFFS_BASE__INSTRUMENT__LOOP(self, func, line) at the start of each
+//     while loop iteration, where line is the loop's Wuffs source line.
+//
+// The base package defines each macro to expand to nothing, unless the user
+// has already defined it, so that fuzzers and profilers can observe a
+// decoder's progress without editing the generated code. Iterate loops are
+// not instrumented, as they are typically the innermost, hottest loops.
+
+import (
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// instrumentArgs returns the first two arguments of the current function's
+// WUFFS_BASE__INSTRUMENT__ETC calls.
+func (g *gen) instrumentArgs() string {
+	self := "NULL"
+	if !g.currFunk.astFunc.Receiver().IsZero() {
+		self = "self"
+	}
+	return self + ", \"" + g.funcCName(g.currFunk.astFunc) + "\""
+}
+
+// instrumentSuspend returns the code, if any, that runs at the current
+// coroutine's suspend label, which is reached on suspensions and on errors.
+func (g *gen) instrumentSuspend() string {
+	if !g.instrument {
+		return ""
+	}
+	return "if (wuffs_base__status__is_suspension(&status)) {\n" +
+		"WUFFS_BASE__INSTRUMENT__SUSPEND(" + g.instrumentArgs() + ", coro_susp_point, status);\n}\n"
+}
+
+// instrumentReturn returns the code, if any, that runs when the current
+// function returns its status local variable.
+func (g *gen) instrumentReturn() string {
+	if !g.instrument {
+		return ""
+	}
+	return "WUFFS_BASE__INSTRUMENT__RETURN(" + g.instrumentArgs() + ", status);\n"
+}
+
+func (g *gen) writeInstrumentLoop(b *buffer, n *a.While) {
+	if !g.instrument {
+		return
+	}
+	_, line := n.AsNode().AsRaw().FilenameLine()
+	b.printf("WUFFS_BASE__INSTRUMENT__LOOP(%s, %du);\n", g.instrumentArgs(), line)
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with the read_metadata_chunk functions, one per struct with
+// a tell_me_more method. Like visit_metadata, they stream metadata (such as an
+// ICC profile or XMP) without buffering it all, but they are pull-style: each
+// call returns the next chunk in a wuffs_base__metadata_reader instead of
+// passing it to a callback. The chunks alias the src buffer, so that neither
+// allocates memory.
+
+// writeMetadataReaders writes the declarations (or, if impl, the definitions)
+// of the read_metadata_chunk functions. Each one alternates calling
+// wuffs_base__metadata_reader__next_chunk and tell_me_more until the former
+// finds a non-empty chunk or the latter returns something other than "$even
+// more information".
+func (g *gen) writeMetadataReaders(b *buffer, impl bool) {
+	wroteDoc := false
+	for _, n := range g.structList {
+		f := g.tellMeMoreFunc(n)
+		if f == nil {
+			continue
+		}
+		if !impl && !wroteDoc {
+			wroteDoc = true
+			b.writes("// wuffs_foo__bar__read_metadata_chunk sets reader's chunk to the next chunk\n")
+			b.writes("// of the metadata that wuffs_foo__bar__tell_me_more reports. Call it after a\n")
+			b.writes("// decode method returns a \"@metadata reported\" note, with a reader that\n")
+			b.writes("// starts as wuffs_base__empty_metadata_reader(), and keep calling it (without\n")
+			b.writes("// otherwise reading from src) while it returns OK with a non-empty chunk. OK\n")
+			b.writes("// with an empty chunk means that that metadata is exhausted. Like\n")
+			b.writes("// visit_metadata, it can also return a suspension status and, after the\n")
+			b.writes("// caller addresses it, it should be called again with the same reader.\n\n")
+		}
+
+		structName := n.QID().Str(g.tm)
+		b.printf("WUFFS_BASE__MAYBE_STATIC wuffs_base__status\n"+
+			"%s%s__read_metadata_chunk(\n"+
+			"    %s%s* self,\n"+
+			"    wuffs_base__io_buffer* a_dst,\n"+
+			"    wuffs_base__metadata_reader* a_reader,\n"+
+			"    wuffs_base__io_buffer* a_src)", g.pkgPrefix, structName, g.pkgPrefix, structName)
+		if !impl {
+			b.writes(";\n\n")
+			continue
+		}
+		b.writes(" {\n")
+		b.writes("if (!a_reader) {\nreturn wuffs_base__make_status(wuffs_base__error__bad_argument);\n}\n")
+		b.writes("while (true) {\n")
+		b.writes("wuffs_base__status status = wuffs_base__metadata_reader__next_chunk(a_reader, a_src);\n")
+		b.writes("if (status.repr || (a_reader->chunk.len > 0)) {\nreturn status;\n}\n")
+		b.printf("status = %s(self, a_dst, &a_reader->minfo, a_src);\n", g.funcCName(f))
+		b.writes("if (status.repr != wuffs_base__suspension__even_more_information) {\nreturn status;\n}\n")
+		b.writes("}\n}\n\n")
+	}
+}
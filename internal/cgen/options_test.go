@@ -0,0 +1,330 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+// optionsTestSrc exercises the generated code that the Options flags change:
+// statuses, consts, a public struct with a public field and a coroutine with
+// a while loop (on line 13) and a multi-byte read.
+const optionsTestSrc = `
+pub status "#bad foo"
+pri status "#bad bar"
+
+pub const FOO_MAX_INCL : base.u32 = 100
+pub const QUIRK_FOO : base.u32 = 0x1000
+
+pub struct foo?(
+	pub width : base.u32[..= 100],
+	x         : base.u32,
+)
+
+pub func foo.decode?(src: base.io_reader) {
+	while true {
+		this.x = args.src.read_u32le?()
+		if this.x == 0 {
+			return "#bad bar"
+		}
+	} endwhile
+}
+
+pri func foo.get_x() base.u32 {
+	return this.x
+}
+`
+
+// optionsTestCases lists, for each flag, what it adds to and removes from the
+// default output.
+var optionsTestCases = []struct {
+	name string
+	opts Options
+
+	// added are in the output with opts but not in the default output.
+	// removed are in the default output but not in the output with opts.
+	added   []string
+	removed []string
+}{{
+	name: "allocator",
+	opts: Options{Allocator: true},
+	added: []string{
+		"WUFFS_BASE__MAYBE_STATIC wuffs_test__foo*\n" +
+			"wuffs_test__foo__alloc_with(\n" +
+			"    const wuffs_base__allocator* allocator);\n",
+		"  return wuffs_test__foo__alloc_with(NULL);\n",
+		"(wuffs_test__foo*)(wuffs_base__allocator__alloc(allocator, sizeof(wuffs_test__foo)));\n",
+		"    wuffs_base__allocator__free(allocator, x);\n",
+		"  alloc_with(const wuffs_base__allocator* allocator) {\n",
+	},
+	removed: []string{
+		"(wuffs_test__foo*)(calloc(sizeof(wuffs_test__foo), 1));\n",
+	},
+}, {
+	name: "instrument",
+	opts: Options{Instrument: true},
+	added: []string{
+		`WUFFS_BASE__INSTRUMENT__LOOP(self, "wuffs_test__foo__decode", 13u);`,
+		`WUFFS_BASE__INSTRUMENT__SUSPEND(self, "wuffs_test__foo__decode", coro_susp_point, status);`,
+		`WUFFS_BASE__INSTRUMENT__RETURN(self, "wuffs_test__foo__decode", status);`,
+	},
+}, {
+	name: "optimize=size",
+	opts: Options{Optimize: OptimizeSize},
+	removed: []string{
+		"if (WUFFS_BASE__LIKELY(io2_a_src - iop_a_src >= 4)) {\n",
+		"wuffs_base__peek_u32le__no_bounds_check(iop_a_src)",
+	},
+}, {
+	name: "statustable",
+	opts: Options{Statustable: true},
+	added: []string{
+		"extern const char* const wuffs_test__status__ptrs[];\n\n" +
+			"#define wuffs_test__error__bad_foo (wuffs_test__status__ptrs[0])\n",
+		"static const char wuffs_test__status__table[] =\n" +
+			"    \"#test: bad foo\\0\"\n" +
+			"\"#test: bad bar\\0\"\n" +
+			";\n",
+		"const char* const wuffs_test__status__ptrs[2] = {\n" +
+			"  wuffs_test__status__table + 0,  // wuffs_test__error__bad_foo\n" +
+			"  wuffs_test__status__table + 15,  // wuffs_test__error__bad_bar\n" +
+			"};\n",
+		"#define wuffs_test__error__bad_bar (wuffs_test__status__ptrs[1])\n",
+	},
+	removed: []string{
+		"extern const char wuffs_test__error__bad_foo[];\n",
+		"const char wuffs_test__error__bad_foo[] = \"#test: bad foo\";\n",
+		"const char wuffs_test__error__bad_bar[] = \"#test: bad bar\";\n",
+	},
+}}
+
+func TestOptions(tt *testing.T) {
+	plain := string(generateSource(tt, optionsTestSrc, nil, nil))
+	for _, tc := range optionsTestCases {
+		opts := tc.opts
+		got := string(generateSource(tt, optionsTestSrc, nil, &opts))
+		for _, s := range tc.added {
+			if strings.Contains(plain, s) {
+				tt.Errorf("%s: default output contains %q", tc.name, s)
+			} else if !strings.Contains(got, s) {
+				tt.Errorf("%s: output does not contain %q", tc.name, s)
+			}
+		}
+		for _, s := range tc.removed {
+			if !strings.Contains(plain, s) {
+				tt.Errorf("%s: default output does not contain %q", tc.name, s)
+			} else if strings.Contains(got, s) {
+				tt.Errorf("%s: output contains %q", tc.name, s)
+			}
+		}
+	}
+}
+
+func TestOptionsCompile(tt *testing.T) {
+	if testing.Short() {
+		tt.Skip("skipping test that runs the C compiler in short mode")
+	}
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		tt.Skip("skipping test: no C compiler")
+	}
+
+	dir, err := ioutil.TempDir("", "cgen_test")
+	if err != nil {
+		tt.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	base, _, err := Generate("base", &t.Map{}, nil, nil)
+	if err != nil {
+		tt.Fatalf("Generate base: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "wuffs-base.c"), base, 0644); err != nil {
+		tt.Fatalf("WriteFile: %v", err)
+	}
+
+	compile := func(src []byte) ([]byte, error) {
+		filename := filepath.Join(dir, "wuffs-test.c")
+		if err := ioutil.WriteFile(filename, src, 0644); err != nil {
+			tt.Fatalf("WriteFile: %v", err)
+		}
+		return exec.Command(cc, "-std=c99", "-fsyntax-only", "-DWUFFS_IMPLEMENTATION", filename).CombinedOutput()
+	}
+
+	if out, err := compile(generateSource(tt, optionsTestSrc, nil, nil)); err != nil {
+		tt.Fatalf("default: cc: %v\n%s", err, out)
+	}
+	for _, tc := range optionsTestCases {
+		opts := tc.opts
+		if out, err := compile(generateSource(tt, optionsTestSrc, nil, &opts)); err != nil {
+			tt.Errorf("%s: cc: %v\n%s", tc.name, err, out)
+		}
+	}
+
+	// A package generated against an incompatible base package, with a
+	// different ABI hash, fails to compile.
+	src := generateSource(tt, optionsTestSrc, nil, nil)
+	hash := []byte(fmt.Sprintf("WUFFS_BASE__ABI_HASH == 0x%08X", baseABIHash))
+	if !bytes.Contains(src, hash) {
+		tt.Fatalf("output does not contain %q", hash)
+	}
+	src = bytes.Replace(src, hash, []byte(fmt.Sprintf("WUFFS_BASE__ABI_HASH == 0x%08X", baseABIHash^1)), 1)
+	if out, err := compile(src); err == nil {
+		tt.Errorf("ABI hash mismatch: cc: got nil error, want non-nil")
+	} else if !bytes.Contains(out, []byte("test_base_abi_hash")) {
+		tt.Errorf("ABI hash mismatch: cc: got %q, want a test_base_abi_hash error", out)
+	}
+}
+
+func TestABIHash(tt *testing.T) {
+	base, _, err := Generate("base", &t.Map{}, nil, nil)
+	if err != nil {
+		tt.Fatalf("Generate base: %v", err)
+	}
+	if want := fmt.Sprintf("\n#define WUFFS_BASE__ABI_HASH 0x%08X\n", baseABIHash); !bytes.Contains(base, []byte(want)) {
+		tt.Errorf("base output does not contain %q", want)
+	}
+
+	src := generateSource(tt, optionsTestSrc, nil, nil)
+	if want := fmt.Sprintf("WUFFS_BASE__STATIC_ASSERT(WUFFS_BASE__ABI_HASH == 0x%08X,\n"+
+		"    test_base_abi_hash);\n", baseABIHash); !bytes.Contains(src, []byte(want)) {
+		tt.Errorf("output does not contain %q", want)
+	}
+}
+
+func TestAudit32(tt *testing.T) {
+	const src = `
+pub struct foo?(
+	a : array[0x1_0000_0000] base.u8,
+	b : array[0xFFFF_FFFF] base.u8,
+)
+`
+	tm, files := checkSource(tt, src, nil)
+	if _, _, err := Generate("test", tm, files, nil); err != nil {
+		tt.Fatalf("Generate without -audit32: %v", err)
+	}
+
+	_, _, err := Generate("test", tm, files, &Options{Audit32: true})
+	if err == nil {
+		tt.Fatalf("Generate: got nil error, want an -audit32 error")
+	}
+	// Only the "a" array's length does not fit in 32 bits.
+	const want = `cgen: -audit32: array length "0x1_0000_0000" (4294967296) is converted to size_t, ` +
+		`which may truncate on 32-bit targets at test.wuffs:2:12`
+	if got := err.Error(); got != want {
+		tt.Fatalf("Generate:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestPackStatusTable(tt *testing.T) {
+	strs := []string{"#x: bad", "#x: really bad", "bad", "#x: bad"}
+	table, offsets := packStatusTable(strs)
+	if want := "#x: really bad\x00#x: bad\x00"; table != want {
+		tt.Errorf("table: got %q, want %q", table, want)
+	}
+	for i, s := range strs {
+		if o := offsets[i]; !strings.HasPrefix(table[o:], s+"\x00") {
+			tt.Errorf("offsets[%d]: %d does not locate %q", i, o, s)
+		}
+	}
+	if offsets[0] != offsets[3] {
+		tt.Errorf("duplicates: got offsets %d and %d, want equal", offsets[0], offsets[3])
+	}
+}
+
+func TestSizeReport(tt *testing.T) {
+	buf := &bytes.Buffer{}
+	generateSource(tt, optionsTestSrc, nil, &Options{SizeReport: buf})
+	got := buf.String()
+
+	for _, re := range []string{
+		`(?m)^# Generated code size report for package test\.$`,
+		// The coroutine has two suspension points (one for the read_u32le?
+		// call and one for its byte-at-a-time loop) and its state struct
+		// holds the 8 byte scratch.
+		`(?m)^ +[0-9]+      2       8  wuffs_test__foo__decode \(foo\.decode\)$`,
+		`(?m)^ +[0-9]+      -       -  wuffs_test__foo__get_x \(foo\.get_x\)$`,
+		`(?m)^ +[0-9]+              8  total$`,
+	} {
+		if !regexp.MustCompile(re).MatchString(got) {
+			tt.Errorf("report does not match %q:\n%s", re, got)
+		}
+	}
+
+	// The decode function is listed first, as it is the larger one.
+	if i, j := strings.Index(got, "wuffs_test__foo__decode"), strings.Index(got, "wuffs_test__foo__get_x"); i > j {
+		tt.Errorf("report is not sorted by code size:\n%s", got)
+	}
+
+	tm, files := checkSource(tt, optionsTestSrc, nil)
+	if _, _, err := Generate("test", tm, files, &Options{Optimize: "fast"}); err == nil {
+		tt.Errorf("Generate with -optimize=fast: got nil error, want non-nil")
+	}
+}
+
+func TestAPIJSON(tt *testing.T) {
+	buf := &bytes.Buffer{}
+	generateSource(tt, optionsTestSrc, nil, &Options{APIJSON: buf})
+
+	got := apiJSON{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		tt.Fatalf("Unmarshal: %v", err)
+	}
+	want := apiJSON{
+		Package: "test",
+		Consts: []apiJSONConst{{
+			Name:  "FOO_MAX_INCL",
+			CName: "WUFFS_TEST__FOO_MAX_INCL",
+			Kind:  "limit",
+			Type:  "base.u32",
+			Value: "100",
+		}, {
+			Name:  "QUIRK_FOO",
+			CName: "WUFFS_TEST__QUIRK_FOO",
+			Kind:  "quirk",
+			Type:  "base.u32",
+			Value: "4096",
+		}},
+		// The pri status is not listed.
+		Statuses: []apiJSONStatus{{
+			CName:   "wuffs_test__error__bad_foo",
+			Kind:    "error",
+			Message: "#test: bad foo",
+		}},
+		Fields: []apiJSONField{{
+			Struct: "foo",
+			Name:   "width",
+			Getter: "wuffs_test__foo__get_width",
+			Type:   "base.u32[..= 100]",
+			Min:    "0",
+			Max:    "100",
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		tt.Errorf("got:\n%+v\nwant:\n%+v", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with documenting memory ownership in the generated header.
+// The checker bans pointer-containing types (pointers, slices, tables and I/O
+// types) for struct fields, so a Wuffs struct never owns or retains caller
+// memory. Each public method only borrows its pointer-containing arguments,
+// and for how long depends on the argument's type and the method's effect.
+
+import (
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// ownershipLegend explains the "Memory ownership" comments written by
+// writeOwnership.
+const ownershipLegend = "" +
+	"// Memory ownership: Wuffs structs never hold pointers to caller-owned\n" +
+	"// memory between calls, as their fields cannot be pointers, slices, tables\n" +
+	"// or I/O types. Instead, the caller owns every buffer and each method\n" +
+	"// borrows its pointer-containing arguments, listed below per struct, for:\n" +
+	"//  - \"until return\": the duration of that one call.\n" +
+	"//  - \"until complete\": for a coroutine, until it returns a status that is\n" +
+	"//    not a suspension. Resuming a suspended coroutine must pass the same\n" +
+	"//    memory (e.g. the same workbuf, with its contents unmodified).\n" +
+	"//\n" +
+	"// I/O and token buffers are always borrowed \"until return\": a suspended\n" +
+	"// coroutine can be resumed with different buffers, as long as any data not\n" +
+	"// yet read is still there.\n\n"
+
+// writeOwnership writes a comment listing, for each of n's public methods,
+// the arguments that it borrows and for how long, as per ownershipLegend.
+func (g *gen) writeOwnership(b *buffer, n *a.Struct) {
+	lines := []string(nil)
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if (tld.Kind() != a.KFunc) || !tld.AsFunc().Public() {
+				continue
+			}
+			f := tld.AsFunc()
+			if f.Receiver() != n.QID() {
+				continue
+			}
+
+			untilReturn, untilComplete := []string(nil), []string(nil)
+			for _, o := range f.In().Fields() {
+				o := o.AsField()
+				typ := o.XType()
+				if !typ.HasPointers() && !typ.IsTokenType() {
+					continue
+				}
+				name := o.Name().Str(g.tm)
+				if f.Effect().Coroutine() && !typ.IsIOTokenType() {
+					untilComplete = append(untilComplete, name)
+				} else {
+					untilReturn = append(untilReturn, name)
+				}
+			}
+
+			borrows := []string(nil)
+			if len(untilComplete) > 0 {
+				borrows = append(borrows, strings.Join(untilComplete, ", ")+" until complete")
+			}
+			if len(untilReturn) > 0 {
+				borrows = append(borrows, strings.Join(untilReturn, ", ")+" until return")
+			}
+			if len(borrows) > 0 {
+				lines = append(lines, f.FuncName().Str(g.tm)+": "+strings.Join(borrows, "; ")+".")
+			}
+		}
+	}
+
+	b.printf("// Memory ownership of %s%s:", g.pkgPrefix, n.QID().Str(g.tm))
+	if len(lines) == 0 {
+		b.writes(" it borrows no arguments.\n")
+		return
+	}
+	b.writes("\n")
+	for _, line := range lines {
+		b.printf("//  - %s\n", line)
+	}
+}
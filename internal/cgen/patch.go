@@ -0,0 +1,305 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with the -patch flag, for generated C files that are checked
+// into other repositories. Regenerating such a file can change many functions
+// that a Wuffs edit did not touch, such as their "// foo.wuffs:123" comments
+// (with -genlinenum) when an earlier function grows or shrinks. With the flag,
+// each function implementation is delimited by "‼ WUFFS PATCH" markers that
+// record a hash of that function's AST, and each function whose hash is the
+// same as in the previous output (the flag's file) is copied from there
+// byte-for-byte, so that the diff is limited to the functions that changed.
+//
+// A function's hash also covers everything outside of function bodies (such
+// as struct and const declarations and every function's signature), the other
+// code generation flags, the summaries of the packages that this one uses, the
+// base package's C code and the code generator itself, as they can also affect
+// a function's C code. Changing any of those re-generates every function.
+//
+// The first run, on a file without markers, re-generates every function.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/google/wuffs/internal/cgen/data"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+var (
+	patchStart = []byte("// ‼ WUFFS PATCH +")
+	patchEnd   = []byte("// ‼ WUFFS PATCH -")
+)
+
+var (
+	cgenBuildDigestOnce sync.Once
+	cgenBuildDigestHash []byte
+)
+
+// cgenBuildDigest returns a hash of the running executable, which contains the
+// code generator. If the executable cannot be read, it returns nil, and the
+// patch digests do not notice code generator changes.
+func cgenBuildDigest() []byte {
+	cgenBuildDigestOnce.Do(func() {
+		exe, err := os.Executable()
+		if err != nil {
+			return
+		}
+		f, err := os.Open(exe)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return
+		}
+		cgenBuildDigestHash = h.Sum(nil)
+	})
+	return cgenBuildDigestHash
+}
+
+// baseDigest returns a hash of the base package's C code, which the generated
+// code calls and whose macros it uses.
+func baseDigest() []byte {
+	h := sha256.New()
+	for _, s := range [...]string{
+		data.BaseAllImplC,
+		data.BaseFundamentalPrivateH,
+		data.BaseFundamentalPublicH,
+		data.BaseMemoryPrivateH,
+		data.BaseMemoryPublicH,
+		data.BaseImagePrivateH,
+		data.BaseImagePublicH,
+		data.BaseIOPrivateH,
+		data.BaseIOPublicH,
+		data.BaseRangePrivateH,
+		data.BaseRangePublicH,
+		data.BaseStrConvPrivateH,
+		data.BaseStrConvPublicH,
+		data.BaseTokenPrivateH,
+		data.BaseTokenPublicH,
+		data.BaseFloatConvSubmoduleCodeC,
+		data.BaseFloatConvSubmoduleDataC,
+		data.BaseIntConvSubmoduleC,
+		data.BaseMagicSubmoduleC,
+		data.BasePixConvSubmoduleC,
+		data.BaseUTF8SubmoduleC,
+	} {
+		h.Write(appendPatchString(nil, s))
+	}
+	return h.Sum(nil)
+}
+
+// usesDigest returns a hash of the summaries of the packages that g's package
+// uses, as returned by g.resolveUse. If that is nil, it hashes only their
+// paths.
+func (g *gen) usesDigest() ([]byte, error) {
+	usePaths := []string(nil)
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() == a.KUse {
+				usePath, _ := t.Unescape(g.tm.ByID(tld.AsUse().Path()))
+				usePaths = append(usePaths, usePath)
+			}
+		}
+	}
+	sort.Strings(usePaths)
+
+	h := sha256.New()
+	buf := []byte(nil)
+	for i, usePath := range usePaths {
+		if (i > 0) && (usePath == usePaths[i-1]) {
+			continue
+		}
+		buf = appendPatchString(buf[:0], usePath)
+		if g.resolveUse != nil {
+			summary, err := g.resolveUse(usePath)
+			if err != nil {
+				return nil, fmt.Errorf("-patch: could not resolve %q: %v", usePath, err)
+			}
+			u := sha256.Sum256(summary)
+			buf = append(buf, u[:]...)
+		}
+		h.Write(buf)
+	}
+	return h.Sum(nil), nil
+}
+
+// calcPatchDigests returns the hex-encoded hash of each function's AST, keyed by
+// the function's C name.
+func (g *gen) calcPatchDigests() (map[string]string, error) {
+	uses, err := g.usesDigest()
+	if err != nil {
+		return nil, err
+	}
+	pkg := sha256.New()
+	pkg.Write(cgenBuildDigest())
+	pkg.Write(baseDigest())
+	pkg.Write(uses)
+	fmt.Fprintf(pkg, "%t\x00%t\x00%s\x00%t\x00%t\x00%t\x00%t\x00",
+		g.allocator, g.autovec, g.cTarget, g.genlinenum, g.instrument, g.optimizeSize, g.statustable)
+	buf := []byte(nil)
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() == a.KFunc {
+				buf = appendPatchFuncSignature(buf[:0], g.tm, tld.AsFunc())
+			} else {
+				buf = appendPatchNode(buf[:0], g.tm, tld)
+			}
+			pkg.Write(buf)
+		}
+	}
+	pkgDigest := pkg.Sum(nil)
+
+	m := map[string]string{}
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KFunc {
+				continue
+			}
+			buf = appendPatchNode(buf[:0], g.tm, tld)
+			h := sha256.New()
+			h.Write(pkgDigest)
+			h.Write(buf)
+			m[g.funcCName(tld.AsFunc())] = hex.EncodeToString(h.Sum(nil)[:16])
+		}
+	}
+	return m, nil
+}
+
+// appendPatchNode appends a canonical form of n. Like the checker's cache
+// keys, it uses names instead of token IDs, as those depend on tokenization
+// order, and omits filenames and line numbers.
+func appendPatchNode(b []byte, tm *t.Map, n *a.Node) []byte {
+	if n == nil {
+		return appendPatchUint(b, 0)
+	}
+	r := n.AsRaw()
+	b = appendPatchUint(b, uint64(n.Kind()))
+	b = appendPatchUint(b, uint64(r.Flags()))
+	for _, id := range r.IDs() {
+		b = appendPatchString(b, id.Str(tm))
+	}
+	for _, o := range r.SubNodes() {
+		b = appendPatchNode(b, tm, o)
+	}
+	for _, l := range r.SubLists() {
+		b = appendPatchUint(b, uint64(len(l)))
+		for _, o := range l {
+			b = appendPatchNode(b, tm, o)
+		}
+	}
+	return b
+}
+
+func appendPatchFuncSignature(b []byte, tm *t.Map, n *a.Func) []byte {
+	r := n.AsNode().AsRaw()
+	b = appendPatchUint(b, uint64(a.KFunc))
+	b = appendPatchUint(b, uint64(r.Flags()))
+	for _, id := range r.IDs() {
+		b = appendPatchString(b, id.Str(tm))
+	}
+	b = appendPatchNode(b, tm, n.In().AsNode())
+	b = appendPatchNode(b, tm, n.Out().AsNode())
+	b = appendPatchUint(b, uint64(len(n.Asserts())))
+	for _, o := range n.Asserts() {
+		b = appendPatchNode(b, tm, o)
+	}
+	return b
+}
+
+func appendPatchString(b []byte, s string) []byte {
+	return append(appendPatchUint(b, uint64(len(s))), s...)
+}
+
+func appendPatchUint(b []byte, x uint64) []byte {
+	buf := [binary.MaxVarintLen64]byte{}
+	return append(b, buf[:binary.PutUvarint(buf[:], x)]...)
+}
+
+// patchSection is a "‼ WUFFS PATCH" section: src[start:end] holds the lines
+// from its start marker to its end marker, inclusive.
+type patchSection struct {
+	name   string
+	digest string
+	start  int
+	end    int
+}
+
+// findPatchSections returns src's sections, in order. It ignores malformed or
+// unterminated sections.
+func findPatchSections(src []byte) (ret []patchSection) {
+	for pos := 0; ; {
+		i := bytes.Index(src[pos:], patchStart)
+		if i < 0 {
+			break
+		}
+		start := pos + i
+		eol := bytes.IndexByte(src[start:], '\n')
+		if eol < 0 {
+			break
+		}
+		pos = start + eol
+		fields := bytes.Fields(src[start+len(patchStart) : pos])
+		if len(fields) != 2 {
+			continue
+		}
+		end := append(append(append([]byte(nil), patchEnd...), fields[0]...), '\n')
+		j := bytes.Index(src[pos:], end)
+		if j < 0 {
+			break
+		}
+		pos += j + len(end)
+		ret = append(ret, patchSection{
+			name:   string(fields[0]),
+			digest: string(fields[1]),
+			start:  start,
+			end:    pos,
+		})
+	}
+	return ret
+}
+
+// applyPatch returns out with each of its sections replaced by old's section
+// of the same name, if that has the same digest.
+func applyPatch(out []byte, old []byte) []byte {
+	oldSections := map[string]patchSection{}
+	for _, o := range findPatchSections(old) {
+		oldSections[o.name] = o
+	}
+	if len(oldSections) == 0 {
+		return out
+	}
+	dst, prev := make([]byte, 0, len(out)), 0
+	for _, s := range findPatchSections(out) {
+		if o, ok := oldSections[s.name]; ok && (o.digest == s.digest) {
+			dst = append(dst, out[prev:s.start]...)
+			dst = append(dst, old[o.start:o.end]...)
+			prev = s.end
+		}
+	}
+	return append(dst, out[prev:]...)
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const patchTestSrc = `
+use "std/dep"
+
+pub struct foo?(
+	x : base.u32,
+)
+
+pri func foo.alpha!() {
+	this.x = %ALPHA%
+}
+
+pri func foo.beta!() {
+	this.x = 2
+}
+`
+
+const patchTestMarker = "// patch test marker\n"
+
+// generatePatchTest generates the C code for patchTestSrc, with the given
+// alpha value, dep summary and previous output.
+func generatePatchTest(tt *testing.T, alpha string, dep string, patch []byte) []byte {
+	tt.Helper()
+	src := strings.Replace(patchTestSrc, "%ALPHA%", alpha, 1)
+	resolveUse := func(usePath string) ([]byte, error) {
+		return []byte(dep), nil
+	}
+	if patch == nil {
+		patch = []byte{}
+	}
+	return generateSource(tt, src, resolveUse, &Options{
+		Patch:      patch,
+		ResolveUse: resolveUse,
+	})
+}
+
+// markPatchSections returns src with a marker line added to the end of each
+// "‼ WUFFS PATCH" section. A section copied from the result keeps its marker.
+func markPatchSections(src []byte) []byte {
+	dst, prev := []byte(nil), 0
+	for _, s := range findPatchSections(src) {
+		i := s.start + bytes.Index(src[s.start:s.end], patchEnd)
+		dst = append(dst, src[prev:i]...)
+		dst = append(dst, patchTestMarker...)
+		prev = i
+	}
+	return append(dst, src[prev:]...)
+}
+
+// copiedPatchSections returns the names of out's sections that have a marker.
+func copiedPatchSections(out []byte) (ret []string) {
+	for _, s := range findPatchSections(out) {
+		if bytes.Contains(out[s.start:s.end], []byte(patchTestMarker)) {
+			ret = append(ret, s.name)
+		}
+	}
+	return ret
+}
+
+func TestPatch(tt *testing.T) {
+	const dep = "pub const LIMIT : base.u32 = 100\n"
+	old := markPatchSections(generatePatchTest(tt, "1", dep, nil))
+	if got := copiedPatchSections(old); len(got) != 2 {
+		tt.Fatalf("sections: got %q, want 2 sections", got)
+	}
+
+	testCases := []struct {
+		desc  string
+		alpha string
+		dep   string
+		want  string
+	}{
+		{"hit", "1", dep, "wuffs_test__foo__alpha wuffs_test__foo__beta"},
+		{"miss", "3", dep, "wuffs_test__foo__beta"},
+		{"dependency change", "1", "pub const LIMIT : base.u32 = 200\n", ""},
+	}
+
+	for _, tc := range testCases {
+		out := generatePatchTest(tt, tc.alpha, tc.dep, old)
+		if got := strings.Join(copiedPatchSections(out), " "); got != tc.want {
+			tt.Errorf("%s: copied sections: got %q, want %q", tc.desc, got, tc.want)
+		}
+		if n := len(findPatchSections(out)); n != 2 {
+			tt.Errorf("%s: got %d sections, want 2", tc.desc, n)
+		}
+	}
+}
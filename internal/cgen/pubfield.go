@@ -0,0 +1,126 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with public struct fields (see lang/check/pubfield.go).
+// Each one gets a getter function, such as wuffs_foo__bar__get_width, and a
+// matching C++ method. Unlike the struct's layout, the getters are part of the
+// stable API. Each getter's comment documents the field's refinement bounds,
+// which the checker has verified.
+
+import (
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// pubFields returns the struct n's public fields.
+func pubFields(n *a.Struct) (ret []*a.Field) {
+	if (n == nil) || !n.Public() {
+		return nil
+	}
+	for _, o := range n.Fields() {
+		if o := o.AsField(); o.Public() {
+			ret = append(ret, o)
+		}
+	}
+	return ret
+}
+
+// pubFieldBounds returns the field o's (inclusive) bounds. It returns ok false
+// if o is a bool.
+func pubFieldBounds(o *a.Field) (lo string, hi string, ok bool) {
+	typ := o.XType()
+	if typ.IsBool() {
+		return "", "", false
+	}
+	fb := typ.Innermost().AsNode().MBounds()
+	if (fb[0] == nil) || (fb[1] == nil) {
+		return "", "", false
+	}
+	return fb[0].String(), fb[1].String(), true
+}
+
+// pubFieldBoundsComment returns the getter comment's sentence about the field
+// o's bounds, or "" if o is a bool.
+func (g *gen) pubFieldBoundsComment(o *a.Field) string {
+	lo, hi, ok := pubFieldBounds(o)
+	if !ok {
+		return ""
+	}
+	return "// Its value is within [" + lo + " ..= " + hi + "].\n"
+}
+
+// writePubFieldGetters writes the declarations (or, if impl, the definitions)
+// of the getter functions, one per public field.
+func (g *gen) writePubFieldGetters(b *buffer, impl bool) error {
+	wroteHeading := false
+	for _, n := range g.structList {
+		fields := pubFields(n)
+		if len(fields) == 0 {
+			continue
+		}
+		if !impl && !wroteHeading {
+			wroteHeading = true
+			b.writes("// ---------------- Public Field Getters\n\n")
+			b.writes("// wuffs_foo__bar__get_baz returns the bar's baz field, or zero (or false) if\n")
+			b.writes("// self is NULL or not initialized. The getters are part of the stable API,\n")
+			b.writes("// even though the struct's fields and layout are not.\n\n")
+		}
+
+		structName := n.QID().Str(g.tm)
+		for _, o := range fields {
+			fieldName := o.Name().Str(g.tm)
+			if !impl {
+				b.printf("// %s%s__get_%s returns the %s field.\n", g.pkgPrefix, structName, fieldName, fieldName)
+				b.writes(g.pubFieldBoundsComment(o))
+			}
+			b.writes("WUFFS_BASE__MAYBE_STATIC ")
+			if err := g.writeCTypeName(b, o.XType(), "", ""); err != nil {
+				return err
+			}
+			b.printf("\n%s%s__get_%s(\n"+
+				"    const %s%s* self)", g.pkgPrefix, structName, fieldName, g.pkgPrefix, structName)
+			if !impl {
+				b.writes(";\n\n")
+				continue
+			}
+			b.writes(" {\n")
+			b.writes("if (!self ||\n((self->private_impl.magic != WUFFS_BASE__MAGIC) &&\n" +
+				"(self->private_impl.magic != WUFFS_BASE__DISABLED))) {\n")
+			if o.XType().IsBool() {
+				b.writes("return false;\n}\n")
+			} else {
+				b.writes("return 0;\n}\n")
+			}
+			b.printf("return self->private_impl.%s%s;\n}\n\n", fPrefix, fieldName)
+		}
+	}
+	return nil
+}
+
+// writeCppPubFieldGetters writes the C++ methods that forward on "this" to the
+// struct n's getter functions.
+func (g *gen) writeCppPubFieldGetters(b *buffer, n *a.Struct) error {
+	structName := n.QID().Str(g.tm)
+	for _, o := range pubFields(n) {
+		fieldName := o.Name().Str(g.tm)
+		b.writes("  inline ")
+		if err := g.writeCTypeName(b, o.XType(), "", ""); err != nil {
+			return err
+		}
+		b.printf("\n  get_%s() const {\n", fieldName)
+		b.printf("    return %s%s__get_%s(this);\n  }\n\n", g.pkgPrefix, structName, fieldName)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with recursive coroutines (see lang/check/recursive.go). A
+// coroutine's suspension point, p_foo, and its state struct, s_foo, are arrays
+// with one element per stack frame. For most coroutines, that is one element,
+// always indexed by [0]. For a recursive coroutine, it is the maximum depth,
+// indexed by the depth argument, a_depth, which the checker proves is greater
+// than the caller's for every recursive call.
+
+import (
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// coroMaxDepth returns how many stack frames the coroutine n can have at once.
+func (g *gen) coroMaxDepth(n *a.Func) uint64 {
+	if d := n.RecursionDepth(g.tm); d > 0 {
+		return d
+	}
+	return 1
+}
+
+// coroFrame returns the current coroutine's stack frame's index, such as
+// "[0]", into its p_foo and s_foo arrays.
+func (g *gen) coroFrame() string {
+	if g.currFunk.astFunc.RecursionDepth(g.tm) > 0 {
+		return "[" + aPrefix + "depth]"
+	}
+	return "[0]"
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with seekable decoders: public structs whose restart_frame
+// method is marked "seekable" (see lang/check/seekable.go). Each one gets a
+// private_impl.frame_io_positions field, a caller-owned table (empty by
+// default) that the decode_frame_config method fills in, mapping each frame's
+// index to its io_position, and two functions. The set_frame_io_positions
+// function gives the decoder that table and the seek_frame function looks a
+// frame up in it and calls restart_frame.
+
+import (
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// seekableFunc returns the public struct n's seekable method, or nil if it
+// has no such method. The checker ensures that there is at most one.
+func (g *gen) seekableFunc(n *a.Struct) *a.Func {
+	if (n == nil) || !n.Public() {
+		return nil
+	}
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KFunc {
+				continue
+			}
+			if f := tld.AsFunc(); f.Seekable() && (f.Receiver() == n.QID()) {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// funcRecordsFrameIOPosition returns whether f is a seekable struct's
+// decode_frame_config method.
+func (g *gen) funcRecordsFrameIOPosition(f *a.Func) bool {
+	return f.Public() && (f.FuncName().Str(g.tm) == "decode_frame_config") &&
+		(g.seekableFunc(g.structMap[f.Receiver()]) != nil)
+}
+
+// frameIOPositionRecord returns the end of a seekable struct's
+// decode_frame_config method, recording the frame's io_position in the table.
+func (g *gen) frameIOPositionRecord() string {
+	return "if (!status.repr && a_dst) {\n" +
+		"uint64_t i = wuffs_base__frame_config__index(a_dst);\n" +
+		"if (i < self->private_impl.frame_io_positions.len) {\n" +
+		"self->private_impl.frame_io_positions.ptr[i] = " +
+		"wuffs_base__frame_config__io_position(a_dst);\n" +
+		"}\n}\n"
+}
+
+// writeSeekFrames writes the declarations (or, if impl, the definitions) of
+// the set_frame_io_positions and seek_frame functions, for each struct with a
+// seekable method.
+func (g *gen) writeSeekFrames(b *buffer, impl bool) {
+	wroteHeading := false
+	for _, n := range g.structList {
+		f := g.seekableFunc(n)
+		if f == nil {
+			continue
+		}
+		if !impl && !wroteHeading {
+			wroteHeading = true
+			b.writes("// ---------------- Frame Seeking\n\n")
+			b.writes("// wuffs_foo__bar__set_frame_io_positions gives a seekable decoder a table,\n")
+			b.writes("// owned by the caller, that each successful decode_frame_config call fills in,\n")
+			b.writes("// mapping the frame's index to its io_position. It marks every element as\n")
+			b.writes("// unknown (UINT64_MAX). Passing an empty table stops the recording.\n")
+			b.writes("//\n")
+			b.writes("// wuffs_foo__bar__seek_frame looks up the frame's io_position in that table\n")
+			b.writes("// and, if it is known, calls restart_frame with it and, on success, sets\n")
+			b.writes("// *a_io_position (if a_io_position is non-NULL) to it. The caller should then\n")
+			b.writes("// reposition its source io_buffer to that position before calling\n")
+			b.writes("// decode_frame_config again. An unknown frame is a \"#base: bad argument\".\n\n")
+		}
+
+		structName := n.QID().Str(g.tm)
+		b.printf("WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct\n"+
+			"%s%s__set_frame_io_positions(\n"+
+			"    %s%s* self,\n"+
+			"    wuffs_base__slice_u64 a_table)", g.pkgPrefix, structName, g.pkgPrefix, structName)
+		if !impl {
+			b.writes(";\n\n")
+		} else {
+			b.writes(" {\n")
+			b.writes("if (!self) {\nreturn wuffs_base__make_empty_struct();\n}\n")
+			b.writes("size_t i;\nfor (i = 0; i < a_table.len; i++) {\na_table.ptr[i] = UINT64_MAX;\n}\n")
+			b.writes("self->private_impl.frame_io_positions = a_table;\n")
+			b.writes("return wuffs_base__make_empty_struct();\n}\n\n")
+		}
+
+		b.printf("WUFFS_BASE__MAYBE_STATIC wuffs_base__status\n"+
+			"%s%s__seek_frame(\n"+
+			"    %s%s* self,\n"+
+			"    uint64_t a_index,\n"+
+			"    uint64_t* a_io_position)", g.pkgPrefix, structName, g.pkgPrefix, structName)
+		if !impl {
+			b.writes(";\n\n")
+			continue
+		}
+		b.writes(" {\n")
+		b.writes("if (!self) {\nreturn wuffs_base__make_status(wuffs_base__error__bad_receiver);\n}\n")
+		b.writes("if ((a_index >= self->private_impl.frame_io_positions.len) ||\n" +
+			"(self->private_impl.frame_io_positions.ptr[a_index] == UINT64_MAX)) {\n" +
+			"return wuffs_base__make_status(wuffs_base__error__bad_argument);\n}\n")
+		b.writes("uint64_t io_position = self->private_impl.frame_io_positions.ptr[a_index];\n")
+		b.printf("wuffs_base__status status = %s(self, a_index, io_position);\n", g.funcCName(f))
+		b.writes("if (!status.repr && a_io_position) {\n*a_io_position = io_position;\n}\n")
+		b.writes("return status;\n}\n\n")
+	}
+}
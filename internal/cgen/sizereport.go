@@ -0,0 +1,153 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with the -size-report and -optimize flags, for users (such
+// as on microcontrollers) with tight flash and RAM budgets.
+//
+// With -size-report, the generator also writes a plain text report listing,
+// for each function, how many bytes of (formatted) C code it generated and,
+// for coroutines, how many suspension points it has and how many bytes its
+// state struct (the per-coroutine part of the private_data struct, holding
+// the local variables that live across suspension points) adds to each
+// decoder (or other struct) value. Byte counts of C code are only a proxy for
+// the compiled code's size, but they are stable across compilers and are good
+// enough to find the biggest functions. State struct sizes ignore padding.
+//
+// With -optimize=size, the generator prefers smaller code to faster code. For
+// now, this affects multi-byte reads, such as read_u32le?, whose fast path
+// (when there are enough bytes buffered) is dropped, collapsing them into
+// their byte-at-a-time slow path, which is otherwise rarely taken.
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/google/wuffs/lib/dumbindent"
+
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// Optimize flag values.
+const (
+	OptimizeSpeed = "speed"
+	OptimizeSize  = "size"
+)
+
+// sizeReportFunc is a function's entry in the -size-report report.
+type sizeReportFunc struct {
+	cName      string
+	qqid       string
+	codeBytes  int
+	coroutine  bool
+	suspPoints uint32
+	stateBytes uint64
+}
+
+// recordFuncSize records, for the -size-report flag, that the function n's
+// implementation is the unformatted C code in impl.
+func (g *gen) recordFuncSize(n *a.Func, impl []byte) {
+	if !g.sizeReport {
+		return
+	}
+	if g.funcSizes == nil {
+		g.funcSizes = map[string]int{}
+	}
+	g.funcSizes[g.funcCName(n)] = len(dumbindent.FormatBytes(nil, impl, nil))
+}
+
+// writeSizeReport writes the -size-report report to w. It must be called
+// after g.generate.
+func (g *gen) writeSizeReport(w io.Writer) error {
+	funcs := []sizeReportFunc(nil)
+	totalCode, totalState := 0, uint64(0)
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KFunc {
+				continue
+			}
+			n := tld.AsFunc()
+			k := g.funks[n.QQID()]
+			f := sizeReportFunc{
+				cName:     g.funcCName(n),
+				qqid:      n.QQID().Str(g.tm),
+				codeBytes: g.funcSizes[g.funcCName(n)],
+				coroutine: n.Effect().Coroutine(),
+			}
+			if f.coroutine {
+				f.suspPoints = k.coroSuspPoint
+				f.stateBytes = g.coroStateBytes(&k)
+			}
+			totalCode += f.codeBytes
+			totalState += f.stateBytes
+			funcs = append(funcs, f)
+		}
+	}
+	sort.SliceStable(funcs, func(i, j int) bool {
+		return funcs[i].codeBytes > funcs[j].codeBytes
+	})
+
+	fmt.Fprintf(w, "# Generated code size report for package %s.\n", g.pkgName)
+	fmt.Fprintf(w, "#\n")
+	fmt.Fprintf(w, "# code:  bytes of formatted C code for the function's implementation.\n")
+	fmt.Fprintf(w, "# susp:  number of coroutine suspension points.\n")
+	fmt.Fprintf(w, "# state: bytes (ignoring padding) of the coroutine's state struct.\n")
+	fmt.Fprintf(w, "\n%8s  %5s  %6s  %s\n", "code", "susp", "state", "function")
+	for _, f := range funcs {
+		susp, state := "-", "-"
+		if f.coroutine {
+			susp, state = fmt.Sprint(f.suspPoints), fmt.Sprint(f.stateBytes)
+		}
+		fmt.Fprintf(w, "%8d  %5s  %6s  %s (%s)\n", f.codeBytes, susp, state, f.cName, f.qqid)
+	}
+	_, err := fmt.Fprintf(w, "\n%8d  %5s  %6d  total\n", totalCode, "", totalState)
+	return err
+}
+
+// coroStateBytes returns the size, ignoring padding, of the coroutine k's
+// state structs, one per stack frame (see coroMaxDepth). It mirrors
+// writeStructPrivateImpl, which writes those structs.
+func (g *gen) coroStateBytes(k *funk) (ret uint64) {
+	if k.coroSuspPoint != 0 {
+		for _, n := range k.varList {
+			typ := n.XType()
+			if typ.Innermost().IsEtcUtilityType() || typ.HasPointers() ||
+				(k.varResumables == nil) || !k.varResumables[n.Name()] {
+				continue
+			}
+			ret += g.stateSizeof(typ)
+		}
+	}
+	if k.usesScratch {
+		ret += 8
+	}
+	return ret * g.coroMaxDepth(k.astFunc)
+}
+
+// stateSizeof returns the size of a state struct field of type typ. Types
+// other than numbers, bools and arrays of those are estimated as 8 bytes.
+func (g *gen) stateSizeof(typ *a.TypeExpr) uint64 {
+	if typ.IsArrayType() {
+		if cv := typ.ArrayLength().ConstValue(); (cv != nil) && cv.IsUint64() {
+			return cv.Uint64() * g.stateSizeof(typ.Inner())
+		}
+	} else if typ.IsBool() {
+		return 1
+	} else if sz, err := g.sizeof(typ.Unrefined()); err == nil {
+		return uint64(sz)
+	}
+	return 8
+}
@@ -16,6 +16,7 @@ package cgen
 
 import (
 	"fmt"
+	"math/big"
 	"strconv"
 	"strings"
 
@@ -24,6 +25,10 @@ import (
 )
 
 func (g *gen) writeStatement(b *buffer, n *a.Node, depth uint32) error {
+	return errorAt(n, g.writeStatement1(b, n, depth))
+}
+
+func (g *gen) writeStatement1(b *buffer, n *a.Node, depth uint32) error {
 	if depth > a.MaxBodyDepth {
 		return fmt.Errorf("body recursion depth too large")
 	}
@@ -98,6 +103,12 @@ func (g *gen) writeStatementAssign(b *buffer, op t.ID, lhs *a.Expr, rhs *a.Expr,
 		}
 	}
 
+	if (rhs.Operator() == t.IDXBinaryAs) && rhs.AsExclam() {
+		if err := g.writeAsExclamCheck(b, rhs, depth); err != nil {
+			return err
+		}
+	}
+
 	couldSuspend, skipRHS := false, false
 	if rhs.Effect().Coroutine() {
 		if err := g.writeBuiltinQuestionCall(b, rhs, 0); err == nil {
@@ -127,6 +138,73 @@ func (g *gen) writeStatementAssign(b *buffer, op t.ID, lhs *a.Expr, rhs *a.Expr,
 	return nil
 }
 
+// writeAsExclamCheck writes the run time range check for the "x as! T"
+// expression n. The checker sets n's MBounds to x's bounds clamped to T's, so
+// only the ends where those differ need checking.
+func (g *gen) writeAsExclamCheck(b *buffer, n *a.Expr, depth uint32) error {
+	lhs := n.LHS().AsExpr()
+	lb, nb := lhs.MBounds(), n.MBounds()
+	if (lb[0] == nil) || (nb[0] == nil) {
+		return fmt.Errorf("missing bounds for %q", n.Str(g.tm))
+	}
+	checkMin := lb[0].Cmp(nb[0]) < 0
+	checkMax := lb[1].Cmp(nb[1]) > 0
+	if !checkMin && !checkMax {
+		return nil
+	}
+
+	paren := checkMin && checkMax
+	writeCmp := func(cOp string, cv *big.Int) error {
+		if paren {
+			b.writeb('(')
+		}
+		if err := g.writeExpr(b, lhs, false, depth); err != nil {
+			return err
+		}
+		b.writes(cOp)
+		b.writes(cv.String())
+		if cv.Cmp(maxInt64) > 0 {
+			b.writeb('u')
+		}
+		if paren {
+			b.writeb(')')
+		}
+		return nil
+	}
+
+	b.writes("if (")
+	if checkMin {
+		if err := writeCmp(" < ", nb[0]); err != nil {
+			return err
+		}
+	}
+	if paren {
+		b.writes(" || ")
+	}
+	if checkMax {
+		if err := writeCmp(" > ", nb[1]); err != nil {
+			return err
+		}
+	}
+	b.writes(") {\nstatus = wuffs_base__make_status(wuffs_base__error__conversion_out_of_range);\n" +
+		"goto exit;\n}\n")
+	return nil
+}
+
+// isSignedCompoundAssignOp returns whether, for signed integer types,
+// writeStatementAssign1 expands the compound assignment operator op to a plain
+// assignment of a binary op.
+func isSignedCompoundAssignOp(op t.ID) bool {
+	switch op {
+	case t.IDShiftLEq,
+		t.IDTildeModPlusEq, t.IDTildeModMinusEq, t.IDTildeModStarEq,
+		t.IDTildeModShiftLEq, t.IDTildeModShiftREq,
+		t.IDTildeSatPlusEq, t.IDTildeSatMinusEq:
+		return true
+	}
+	return false
+}
+
 func (g *gen) writeStatementAssign1(b *buffer, op t.ID, lhs *a.Expr, rhs *a.Expr, skipRHS bool) error {
 	lhsBuf := buffer(nil)
 	opName, closer, disableWconversion := "", "", false
@@ -140,6 +218,14 @@ func (g *gen) writeStatementAssign1(b *buffer, op t.ID, lhs *a.Expr, rhs *a.Expr
 			b.writes("memcpy(")
 			opName, closer = ",", fmt.Sprintf(", sizeof(%s))", lhsBuf)
 
+		} else if isSignedCompoundAssignOp(op) && (sintBits(lTyp.QID()) != 0) {
+			// Write "x ~mod+= y" as "x = <x ~mod+ y>", for signed integer x,
+			// as writeExprBinaryOp knows how to avoid C's undefined behavior
+			// on signed integer overflow.
+			rhs = a.NewExpr(0, op.BinaryForm(), 0, lhs.AsNode(), nil, rhs.AsNode(), nil)
+			rhs.SetMType(lTyp.Unrefined())
+			opName = cOpName(t.IDEq)
+
 		} else {
 			switch op {
 			case t.IDEqQuestion:
@@ -169,6 +255,22 @@ func (g *gen) writeStatementAssign1(b *buffer, op t.ID, lhs *a.Expr, rhs *a.Expr
 				b.printf("wuffs_base__u%d__sat_%s_indirect(&", uBits, uOp)
 				opName, closer = ", ", ")"
 
+			case t.IDTildeModShiftLEq, t.IDTildeModShiftREq:
+				uBits := uintBits(lTyp.QID())
+				if uBits == 0 {
+					return fmt.Errorf("unsupported tilde-operator type %q", lTyp.Str(g.tm))
+				}
+				if shiftCountIsSmall(rhs, uBits) {
+					opName = cOpName(op)
+					break
+				}
+				uOp := "left"
+				if op != t.IDTildeModShiftLEq {
+					uOp = "right"
+				}
+				b.printf("wuffs_base__u%d__mod_shift_%s_indirect(&", uBits, uOp)
+				opName, closer = ", ", ")"
+
 			case t.IDPlusEq, t.IDMinusEq:
 				if lTyp.IsNumType() {
 					if u := lTyp.QID()[1]; u == t.IDU8 || u == t.IDU16 {
@@ -225,6 +327,16 @@ func (g *gen) writeStatementAssign1(b *buffer, op t.ID, lhs *a.Expr, rhs *a.Expr
 
 func (g *gen) writeStatementChoose(b *buffer, n *a.Choose, depth uint32) error {
 	recv := g.currFunk.astFunc.Receiver()
+	if g.initChooses[t.QQID{recv[0], recv[1], n.Name()}] == n {
+		b.printf("// choose %s: done once, by the initialize function.\n", n.Name().Str(g.tm))
+		return nil
+	}
+	return g.writeChoose(b, recv, n)
+}
+
+// writeChoose writes the C code that sets a choosy function pointer. The
+// function pointer's struct is recv and the C variable "self" points to it.
+func (g *gen) writeChoose(b *buffer, recv t.QID, n *a.Choose) error {
 	args := n.Args()
 	if len(args) == 0 {
 		return nil
@@ -248,9 +360,10 @@ func (g *gen) writeStatementChoose(b *buffer, n *a.Choose, depth uint32) error {
 			break
 		}
 		b.printf("#if defined(WUFFS_BASE__CPU_ARCH__%s)\n"+
-			"wuffs_base__cpu_arch__have_%s() ? &%s%s__%s%s :\n"+
+			"(((self->private_impl.avoid_cpu_arch & WUFFS_INITIALIZE__AVOID_CPU_ARCH__%s) == 0) &&\n"+
+			"wuffs_base__cpu_arch__have_%s()) ? &%s%s__%s%s :\n"+
 			"#endif\n",
-			caMacro, caName, g.pkgPrefix, recv.Str(g.tm), id.Str(g.tm), suffix)
+			caMacro, strings.ToUpper(caName), caName, g.pkgPrefix, recv.Str(g.tm), id.Str(g.tm), suffix)
 	}
 
 	if !conclusive {
@@ -260,6 +373,76 @@ func (g *gen) writeStatementChoose(b *buffer, n *a.Choose, depth uint32) error {
 	return nil
 }
 
+// hasChoosy returns whether n has a choosy method. If so, its private_impl
+// holds the WUFFS_INITIALIZE__AVOID_CPU_ARCH__ETC bits that it was initialized
+// with, which its choose statements consult.
+func (g *gen) hasChoosy(n *a.Struct) bool {
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KFunc {
+				continue
+			}
+			if o := tld.AsFunc(); (o.Receiver() == n.QID()) && o.Choosy() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// gatherInitChooses finds the choose statements that the initialize function
+// runs, once, instead of them running (and repeating their cpu_arch queries,
+// such as x86's CPUID instruction) each time their Wuffs function is called.
+//
+// These are each choosy function's only choose statement, if there is only
+// one, when that statement's every candidate has a cpu_arch precondition (or
+// is the choosy default), so that the candidates differ only in which CPU
+// instructions they use, not in when they apply.
+func (g *gen) gatherInitChooses() error {
+	g.initChooses = map[t.QQID]*a.Choose{}
+	counts := map[t.QQID]int{}
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KFunc {
+				continue
+			}
+			recv := tld.AsFunc().Receiver()
+			if recv.IsZero() {
+				continue
+			}
+			tld.Walk(func(o *a.Node) error {
+				if o.Kind() == a.KChoose {
+					qqid := t.QQID{recv[0], recv[1], o.AsChoose().Name()}
+					counts[qqid]++
+					g.initChooses[qqid] = o.AsChoose()
+				}
+				return nil
+			})
+		}
+	}
+
+	for qqid, n := range g.initChooses {
+		if (counts[qqid] != 1) || (len(n.Args()) == 0) {
+			delete(g.initChooses, qqid)
+			continue
+		}
+		for _, o := range n.Args() {
+			id := o.AsExpr().Ident()
+			if id == qqid[2] {
+				continue
+			}
+			caMacro, _, _, err := cpuArchCNames(g.findAstFunc(t.QQID{qqid[0], qqid[1], id}).Asserts())
+			if err != nil {
+				return err
+			} else if caMacro == "" {
+				delete(g.initChooses, qqid)
+				break
+			}
+		}
+	}
+	return nil
+}
+
 func cpuArchCNames(asserts []*a.Node) (caMacro string, caName string, caAttribute string, retErr error) {
 	match := false
 	for _, o := range asserts {
@@ -275,6 +458,10 @@ func cpuArchCNames(asserts []*a.Node) (caMacro string, caName string, caAttribut
 				caMacro, caName, caAttribute = "ARM_CRC32", "arm_crc32", ""
 			case t.IDARMNeon:
 				caMacro, caName, caAttribute = "ARM_NEON", "arm_neon", ""
+			case t.IDARMSVE:
+				caMacro, caName, caAttribute = "ARM_SVE", "arm_sve", ""
+			case t.IDRISCVV:
+				caMacro, caName, caAttribute = "RISCV_V", "riscv_v", ""
 			case t.IDX86SSE42:
 				caMacro, caName, caAttribute =
 					"X86_64", "x86_sse42",
@@ -463,8 +650,17 @@ func (g *gen) writeStatementIterate(b *buffer, n *a.Iterate, depth uint32) error
 	}
 	// TODO: look at n.HasContinue() and n.HasBreak().
 
+	autovec := false
+	if g.autovec {
+		caMacro, _, _, err := cpuArchCNames(g.currFunk.astFunc.Asserts())
+		if err != nil {
+			return err
+		}
+		autovec = caMacro == ""
+	}
+
 	round := uint32(0)
-	for ; n != nil; n = n.ElseIterate() {
+	for first := true; n != nil; n, first = n.ElseIterate(), false {
 		length, err := strconv.Atoi(n.Length().Str(g.tm))
 		if err != nil {
 			return err
@@ -477,6 +673,21 @@ func (g *gen) writeStatementIterate(b *buffer, n *a.Iterate, depth uint32) error
 		if err != nil {
 			return err
 		}
+		// Shaping only the first (the widest) round for auto-vectorizers is
+		// enough, as the else-iterate rounds handle just the last few bytes.
+		if autovec && first {
+			if (length == 1) && (advance == 1) {
+				if err := g.writeIteratePeelRound(b, assigns, n.Body(), round, depth); err != nil {
+					return err
+				}
+				round++
+				if unroll < 8 {
+					unroll = 8
+				}
+			} else if unroll < 4 {
+				unroll = 4
+			}
+		}
 		for {
 			if err := g.writeIterateRound(b, assigns, n.Body(), round, depth, length, advance, unroll); err != nil {
 				return err
@@ -534,6 +745,7 @@ func (g *gen) writeStatementRet(b *buffer, n *a.Ret, depth uint32) error {
 		b.writes(";\n")
 
 		if n.Keyword() == t.IDYield {
+			g.writeTokensNeeded(b, n)
 			return g.writeCoroSuspPoint(b, true)
 		}
 
@@ -606,6 +818,7 @@ func (g *gen) writeStatementWhile(b *buffer, n *a.While, depth uint32) error {
 	}
 	// Calling trimParens avoids clang's -Wparentheses-equality warning.
 	b.printf("while (%s) {\n", trimParens(condition))
+	g.writeInstrumentLoop(b, n)
 	for _, o := range n.Body() {
 		if err := g.writeStatement(b, o, depth); err != nil {
 			return err
@@ -660,6 +873,33 @@ func (g *gen) writeIterateRound(b *buffer, assigns []*a.Node, body []*a.Node, ro
 	return nil
 }
 
+// writeIteratePeelRound is like writeIterateRound with a length, advance and
+// unroll of 1, except that it stops as soon as the first iterate variable's
+// pointer is 8-byte aligned, so that the (unrolled) round after it works on
+// aligned memory.
+func (g *gen) writeIteratePeelRound(b *buffer, assigns []*a.Node, body []*a.Node, round uint32, depth uint32) error {
+	for _, o := range assigns {
+		name := o.AsAssign().LHS().Ident().Str(g.tm)
+		b.printf("%s%s.len = 1;\n", vPrefix, name)
+	}
+	name0 := assigns[0].AsAssign().LHS().Ident().Str(g.tm)
+	b.printf("uint8_t* %send%d_%s = %sslice_%s.ptr + %sslice_%s.len;\n",
+		iPrefix, round, name0, iPrefix, name0, iPrefix, name0)
+	b.printf("while ((%s%s.ptr < %send%d_%s) && (((uintptr_t)(%s%s.ptr)) & 7)) {\n",
+		vPrefix, name0, iPrefix, round, name0, vPrefix, name0)
+	for _, o := range body {
+		if err := g.writeStatement(b, o, depth); err != nil {
+			return err
+		}
+	}
+	for _, o := range assigns {
+		name := o.AsAssign().LHS().Ident().Str(g.tm)
+		b.printf("%s%s.ptr += 1;\n", vPrefix, name)
+	}
+	b.writes("}\n")
+	return nil
+}
+
 func (g *gen) writeCoroSuspPoint(b *buffer, maybeSuspend bool) error {
 	const maxCoroSuspPoint = 0xFFFFFFFF
 	g.currFunk.coroSuspPoint++
@@ -0,0 +1,131 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with status enums, generated when compiling with
+// WUFFS_CONFIG__STATUS_ENUMS defined. A package's own statuses (those of
+// g.tableStatuses, in declaration order) are numbered from 1, such as
+// WUFFS_GIF__STATUS_ENUM__ERROR__BAD_HEADER, up to
+// WUFFS_GIF__STATUS_ENUM__MAX_INCL. Zero means a status (such as ok, or
+// another package's) that is not one of them. Two functions convert:
+//
+//   - wuffs_gif__status__from_enum maps a number to a status repr, by
+//     indexing a table (or, with -statustable, the wuffs_gif__status__ptrs
+//     array). Out of range numbers map to NULL.
+//   - wuffs_gif__status__to_enum maps a string to a number, by binary search
+//     over the reprs, sorted at generation time. The string need not be a
+//     canonical repr pointer: it can e.g. be read from a log or config file.
+//
+// Static assertions check that the tables have exactly one element per
+// status, so that they cannot get out of sync with the macros.
+
+import (
+	"sort"
+	"strings"
+)
+
+// statusEnumName returns the C macro name for z's enum value, such as
+// "WUFFS_GIF__STATUS_ENUM__ERROR__BAD_HEADER".
+func (g *gen) statusEnumName(z status) string {
+	return g.PKGPREFIX + "STATUS_ENUM__" + strings.ToUpper(strings.TrimPrefix(z.cName, g.pkgPrefix))
+}
+
+// writeStatusEnumPrototypes writes the header's enum macros and function
+// declarations.
+func (g *gen) writeStatusEnumPrototypes(b *buffer) {
+	zs := g.tableStatuses()
+	if len(zs) == 0 {
+		return
+	}
+
+	b.writes("#if defined(WUFFS_CONFIG__STATUS_ENUMS)\n\n")
+	b.printf("#define %sSTATUS_ENUM__MAX_INCL %d\n\n", g.PKGPREFIX, len(zs))
+	for i, z := range zs {
+		b.printf("#define %s %d\n", g.statusEnumName(z), i+1)
+	}
+	b.writes("\n")
+
+	b.printf("// %sstatus__from_enum returns the status repr for one of the\n"+
+		"// %sSTATUS_ENUM__ETC values, or NULL if e is out of range.\n", g.pkgPrefix, g.PKGPREFIX)
+	b.printf("WUFFS_BASE__MAYBE_STATIC const char*  //\n%sstatus__from_enum(uint32_t e);\n\n", g.pkgPrefix)
+	b.printf("// %sstatus__to_enum returns the %sSTATUS_ENUM__ETC value\n"+
+		"// for a string equal to one of this package's status reprs, or 0.\n", g.pkgPrefix, g.PKGPREFIX)
+	b.printf("WUFFS_BASE__MAYBE_STATIC uint32_t  //\n%sstatus__to_enum(const char* repr);\n\n", g.pkgPrefix)
+	b.writes("#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)\n\n")
+}
+
+// writeStatusEnumImpl writes the tables and function definitions. It must
+// come after the status definitions (or, with -statustable, after the
+// wuffs_foo__status__ptrs array).
+func (g *gen) writeStatusEnumImpl(b *buffer) {
+	zs := g.tableStatuses()
+	if len(zs) == 0 {
+		return
+	}
+	maxIncl := g.PKGPREFIX + "STATUS_ENUM__MAX_INCL"
+
+	b.writes("#if defined(WUFFS_CONFIG__STATUS_ENUMS)\n\n")
+
+	// With -statustable, the status names are not address constants, but the
+	// pointer array is already in enum order.
+	table := g.pkgPrefix + "status__ptrs"
+	if !g.statustable {
+		table = g.pkgPrefix + "status__enum_table"
+		b.printf("static const char* const %s[] = {\n", table)
+		for _, z := range zs {
+			b.printf("%s,\n", z.cName)
+		}
+		b.writes("};\n\n")
+	}
+	b.printf("WUFFS_BASE__STATIC_ASSERT(\n(sizeof(%s) / sizeof(%s[0])) == %s,\n%sstatus__enum_table_is_complete);\n\n",
+		table, table, maxIncl, g.pkgPrefix)
+
+	sorted := make([]int, len(zs))
+	for i := range sorted {
+		sorted[i] = i
+	}
+	// Go's string comparison, like strcmp's, is by unsigned byte values.
+	sort.Slice(sorted, func(i int, j int) bool {
+		return g.statusRepr(zs[sorted[i]]) < g.statusRepr(zs[sorted[j]])
+	})
+	elemType := "uint8_t"
+	if len(zs) > 0xFF {
+		elemType = "uint16_t"
+	}
+	b.printf("static const %s %sstatus__enum_sorted[] = {\n", elemType, g.pkgPrefix)
+	for _, i := range sorted {
+		b.printf("%d,  // %s\n", i+1, g.statusEnumName(zs[i]))
+	}
+	b.writes("};\n\n")
+	b.printf("WUFFS_BASE__STATIC_ASSERT(\n(sizeof(%sstatus__enum_sorted) / sizeof(%sstatus__enum_sorted[0])) == %s,\n"+
+		"%sstatus__enum_sorted_is_complete);\n\n", g.pkgPrefix, g.pkgPrefix, maxIncl, g.pkgPrefix)
+
+	b.printf("WUFFS_BASE__MAYBE_STATIC const char*  //\n%sstatus__from_enum(uint32_t e) {\n", g.pkgPrefix)
+	b.printf("if ((e == 0) || (e > %s)) {\nreturn NULL;\n}\n", maxIncl)
+	b.printf("return %s[e - 1];\n}\n\n", table)
+
+	b.printf("WUFFS_BASE__MAYBE_STATIC uint32_t  //\n%sstatus__to_enum(const char* repr) {\n", g.pkgPrefix)
+	b.writes("uint32_t lo = 0;\n")
+	b.printf("uint32_t hi = %s;\n", maxIncl)
+	b.writes("if (!repr) {\nreturn 0;\n}\n")
+	b.writes("while (lo < hi) {\n")
+	b.writes("uint32_t mid = lo + ((hi - lo) / 2);\n")
+	b.printf("uint32_t e = %sstatus__enum_sorted[mid];\n", g.pkgPrefix)
+	b.printf("int c = strcmp(repr, %s[e - 1]);\n", table)
+	b.writes("if (c == 0) {\nreturn e;\n} else if (c < 0) {\nhi = mid;\n} else {\nlo = mid + 1;\n}\n")
+	b.writes("}\nreturn 0;\n}\n\n")
+
+	b.writes("#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)\n\n")
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with the -statustable flag. By default, each status message
+// is its own "const char wuffs_foo__error__bar[]" array, each with its own
+// linker symbol and alignment padding. With the flag, a package's messages
+// are instead packed into one "wuffs_foo__status__table" string, with a
+// message that is a suffix of another message sharing its bytes, and the
+// "wuffs_foo__error__bar" names become macros that index a
+// "wuffs_foo__status__ptrs" array of pointers into that table.
+//
+// Status reprs are still compared by pointer, as each status has exactly one
+// entry in that pointer array. But the status names are no longer address
+// constants, so that they cannot be used in static initializers.
+
+import (
+	"sort"
+	"strings"
+)
+
+// tableStatuses returns the statuses that are defined by this package, in the
+// order of their wuffs_foo__status__ptrs elements.
+func (g *gen) tableStatuses() []status {
+	ret := []status(nil)
+	for _, z := range g.statusList {
+		if z.fromThisPkg && (z.msg != "") {
+			ret = append(ret, z)
+		}
+	}
+	return ret
+}
+
+// statusRepr returns the C string for the status z, such as
+// "#deflate: bad Huffman code".
+func (g *gen) statusRepr(z status) string {
+	return z.msg[:1] + g.pkgName + ": " + z.msg[1:]
+}
+
+// packStatusTable returns the concatenation of the NUL-terminated strs, where
+// a str that is a suffix of another str (or is a duplicate) does not add any
+// bytes of its own. It also returns each str's offset in that concatenation.
+func packStatusTable(strs []string) (table string, offsets []int) {
+	// Place the longer strings first, so that the shorter ones can find them.
+	order := make([]int, len(strs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i int, j int) bool {
+		return len(strs[order[i]]) > len(strs[order[j]])
+	})
+
+	buf := strings.Builder{}
+	offsets = make([]int, len(strs))
+	for _, i := range order {
+		s := strs[i] + "\x00"
+		if j := strings.Index(buf.String(), s); j >= 0 {
+			offsets[i] = j
+			continue
+		}
+		offsets[i] = buf.Len()
+		buf.WriteString(s)
+	}
+	return buf.String(), offsets
+}
+
+// writeStatusTablePrototypes writes the header's declaration of the pointer
+// array and the macros for the public statuses.
+func (g *gen) writeStatusTablePrototypes(b *buffer) {
+	zs := g.tableStatuses()
+	if len(zs) == 0 {
+		return
+	}
+	b.printf("extern const char* const %sstatus__ptrs[];\n\n", g.pkgPrefix)
+	for i, z := range zs {
+		if z.public {
+			b.printf("#define %s (%sstatus__ptrs[%d])\n", z.cName, g.pkgPrefix, i)
+		}
+	}
+	b.writes("\n")
+}
+
+// writeStatusTableImpl writes the string table, the pointer array and the
+// macros for the private statuses.
+func (g *gen) writeStatusTableImpl(b *buffer) {
+	zs := g.tableStatuses()
+	if len(zs) == 0 {
+		return
+	}
+	strs := make([]string, len(zs))
+	unpacked := 0
+	for i, z := range zs {
+		strs[i] = g.statusRepr(z)
+		unpacked += len(strs[i]) + 1
+	}
+	table, offsets := packStatusTable(strs)
+
+	b.printf("// %d status messages in %d bytes, instead of %d.\n", len(zs), len(table), unpacked)
+	b.printf("static const char %sstatus__table[] =\n", g.pkgPrefix)
+	for _, s := range strings.SplitAfter(table, "\x00") {
+		if s != "" {
+			b.printf("    \"%s\\0\"\n", s[:len(s)-1])
+		}
+	}
+	b.writes(";\n\n")
+
+	b.printf("const char* const %sstatus__ptrs[%d] = {\n", g.pkgPrefix, len(zs))
+	for i, z := range zs {
+		b.printf("%sstatus__table + %d,  // %s\n", g.pkgPrefix, offsets[i], z.cName)
+	}
+	b.writes("};\n\n")
+
+	wroteDefine := false
+	for i, z := range zs {
+		if !z.public {
+			b.printf("#define %s (%sstatus__ptrs[%d])\n", z.cName, g.pkgPrefix, i)
+			wroteDefine = true
+		}
+	}
+	if wroteDefine {
+		b.writes("\n")
+	}
+}
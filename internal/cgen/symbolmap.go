@@ -0,0 +1,155 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// symbol is an entry in the symbol map: a C symbol (a function or data
+// definition, not a macro) in the generated C code and the Wuffs declaration
+// that it came from.
+//
+// Multiple C symbols can come from the same Wuffs declaration. For example, a
+// public struct has "__initialize", "__alloc" and "sizeof__etc" functions, and
+// a choosy function also has a "__choosy_default" variant. Some C symbols,
+// such as the "__status__to_enum" function, come from the package as a whole,
+// not from any one declaration, and have an empty Decl and Filename.
+type symbol struct {
+	Symbol   string `json:"symbol"`
+	Kind     string `json:"kind"`
+	Package  string `json:"package"`
+	Decl     string `json:"decl"`
+	Filename string `json:"filename"`
+	Line     uint32 `json:"line"`
+	Public   bool   `json:"public"`
+	CPUArch  string `json:"cpu_arch,omitempty"`
+}
+
+// genSymbolMap returns a JSON list, sorted by symbol name, mapping every C
+// symbol in the generated C code to its originating Wuffs package, top level
+// declaration and source line. It must be called after g.generate.
+func (g *gen) genSymbolMap() ([]byte, error) {
+	symbols := []symbol(nil)
+	add := func(cName string, kind string, decl string, filename string, line uint32, public bool) {
+		symbols = append(symbols, symbol{
+			Symbol:   cName,
+			Kind:     kind,
+			Package:  g.pkgName,
+			Decl:     decl,
+			Filename: filename,
+			Line:     line,
+			Public:   public,
+		})
+	}
+
+	if err := g.forEachStatus(nil, bothPubPri, func(g *gen, b *buffer, n *a.Status) error {
+		z, ok := g.statusMap[n.QID()]
+		if !ok {
+			return fmt.Errorf("no status for %q", n.QID().Str(g.tm))
+		}
+		add(z.cName, "status", n.QID().Str(g.tm), n.Filename(), n.Line(), n.Public())
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if len(g.classifiedStatuses()) > 0 {
+		for _, m := range statusMappings {
+			add(g.pkgPrefix+"status_"+m.name, "status_mapping", "", "", 0, true)
+		}
+	}
+	if len(g.tableStatuses()) > 0 {
+		add(g.pkgPrefix+"status__from_enum", "status_enum", "", "", 0, true)
+		add(g.pkgPrefix+"status__to_enum", "status_enum", "", "", 0, true)
+	}
+
+	for _, n := range g.structList {
+		structName := n.QID().Str(g.tm)
+		if n.Classy() {
+			add(g.pkgPrefix+structName+"__initialize",
+				"initializer", structName, n.Filename(), n.Line(), n.Public())
+			if n.Public() {
+				add("sizeof__"+g.pkgPrefix+structName,
+					"sizeof", structName, n.Filename(), n.Line(), true)
+			}
+		}
+		if n.Public() {
+			add(g.pkgPrefix+structName+"__alloc",
+				"alloc", structName, n.Filename(), n.Line(), true)
+		}
+		if n.Public() && g.hasTelemetry(n) {
+			add(g.pkgPrefix+structName+"__telemetry",
+				"telemetry", structName, n.Filename(), n.Line(), true)
+		}
+		for _, o := range pubFields(n) {
+			add(g.pkgPrefix+structName+"__get_"+o.Name().Str(g.tm),
+				"getter", structName, n.Filename(), n.Line(), true)
+		}
+		if f := g.tellMeMoreFunc(n); f != nil {
+			decl := f.QQID().Str(g.tm)
+			add(g.pkgPrefix+structName+"__visit_metadata",
+				"func", decl, f.Filename(), f.Line(), true)
+			add(g.pkgPrefix+structName+"__read_metadata_chunk",
+				"func", decl, f.Filename(), f.Line(), true)
+		}
+		for _, impl := range n.Implements() {
+			iQID := impl.AsTypeExpr().QID()
+			add(fmt.Sprintf("%s%s__func_ptrs_for__wuffs_%s__%s",
+				g.pkgPrefix, structName, iQID[0].Str(g.tm), iQID[1].Str(g.tm)),
+				"vtable", structName, n.Filename(), n.Line(), false)
+		}
+	}
+
+	if err := g.forEachFunc(nil, bothPubPri, func(g *gen, b *buffer, n *a.Func) error {
+		_, caName, _, err := cpuArchCNames(n.Asserts())
+		if err != nil {
+			return err
+		}
+		decl := n.QQID().Str(g.tm)
+		add(g.funcCName(n), "func", decl, n.Filename(), n.Line(), n.Public())
+		symbols[len(symbols)-1].CPUArch = caName
+		if n.Choosy() {
+			add(g.funcCName(n)+"__choosy_default", "func", decl, n.Filename(), n.Line(), false)
+		}
+		if n.Probe() {
+			add(g.pkgPrefix+n.Receiver()[1].Str(g.tm)+"__probe", "func", decl, n.Filename(), n.Line(), true)
+		}
+		if n.Seekable() {
+			recv := g.pkgPrefix + n.Receiver()[1].Str(g.tm)
+			add(recv+"__seek_frame", "func", decl, n.Filename(), n.Line(), true)
+			add(recv+"__set_frame_io_positions", "func", decl, n.Filename(), n.Line(), true)
+		}
+		if n.Public() && n.Effect().Coroutine() && funcHasTokenWriterArg(n) &&
+			(len(g.tokenBatchFuncs(g.structMap[n.Receiver()])) > 0) {
+			add(g.funcCName(n)+"_batch", "func", decl, n.Filename(), n.Line(), true)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(symbols, func(i int, j int) bool {
+		return symbols[i].Symbol < symbols[j].Symbol
+	})
+	ret, err := json.MarshalIndent(symbols, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(ret, '\n'), nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// publicFuncRegexp matches a public function declaration in the C header,
+// capturing its name and package.
+var publicFuncRegexp = regexp.MustCompile(
+	`(?m)^WUFFS_BASE__MAYBE_STATIC [^\n]*\n((?:sizeof__)?wuffs_([a-z0-9_]+?)__[a-z0-9_]+)\(`)
+
+func TestSymbolMapCoversHeader(tt *testing.T) {
+	snapshot, err := ioutil.ReadFile(filepath.Join("..", "..", "release", "c", "wuffs-unsupported-snapshot.c"))
+	if err != nil {
+		tt.Fatalf("ReadFile: %v", err)
+	}
+	header := snapshot
+	if i := bytes.Index(snapshot, []byte("\n#ifdef WUFFS_IMPLEMENTATION\n")); i >= 0 {
+		header = snapshot[:i]
+	}
+
+	// The base package has no symbol map.
+	wants := map[string][]string{}
+	for _, m := range publicFuncRegexp.FindAllSubmatch(header, -1) {
+		if pkgName := string(m[2]); pkgName != "base" {
+			wants[pkgName] = append(wants[pkgName], string(m[1]))
+		}
+	}
+	if len(wants) == 0 {
+		tt.Fatalf("no public functions found in the snapshot header")
+	}
+
+	for pkgName, want := range wants {
+		_, symbolMap := generateStd(tt, pkgName, &Options{SymbolMap: true})
+		symbols := []symbol(nil)
+		if err := json.Unmarshal(symbolMap, &symbols); err != nil {
+			tt.Fatalf("%s: Unmarshal: %v", pkgName, err)
+		}
+		got := map[string]bool{}
+		for _, s := range symbols {
+			got[s.Symbol] = true
+		}
+		for _, w := range want {
+			if !got[w] {
+				tt.Errorf("%s: symbol map does not contain %q", pkgName, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with the optional telemetry counters (bytes consumed and
+// produced, suspensions and errors) of each public struct with a public
+// coroutine method. Each such method's call is bracketed by the
+// WUFFS_BASE__TELEMETRY__BEGIN and WUFFS_BASE__TELEMETRY__END macros, which
+// expand to nothing unless WUFFS_CONFIG__TELEMETRY is defined. Likewise, the
+// struct's private_impl.telemetry field only exists if it is defined. The
+// wuffs_foo__bar__telemetry functions always exist, so that callers do not
+// need to care, but they return all zeroes when telemetry is off.
+
+import (
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// funcHasTelemetry returns whether f is a public coroutine method.
+func funcHasTelemetry(f *a.Func) bool {
+	return f.Public() && f.Effect().Coroutine() && !f.Receiver().IsZero()
+}
+
+// hasTelemetry returns whether n has a public coroutine method.
+func (g *gen) hasTelemetry(n *a.Struct) bool {
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KFunc {
+				continue
+			}
+			if f := tld.AsFunc(); funcHasTelemetry(f) && (f.Receiver() == n.QID()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// telemetryPositions returns the C expressions for the sum of f's io_reader
+// arguments' reader positions and the sum of its io_writer arguments' writer
+// positions.
+func (g *gen) telemetryPositions(f *a.Func) (consumed string, produced string) {
+	readers, writers := []string(nil), []string(nil)
+	for _, o := range f.In().Fields() {
+		o := o.AsField()
+		typ := o.XType()
+		if (typ.Decorator() != 0) || (typ.QID()[0] != t.IDBase) {
+			continue
+		}
+		switch typ.QID()[1] {
+		case t.IDIOReader:
+			readers = append(readers,
+				"wuffs_base__io_buffer__reader_position("+aPrefix+o.Name().Str(g.tm)+")")
+		case t.IDIOWriter:
+			writers = append(writers,
+				"wuffs_base__io_buffer__writer_position("+aPrefix+o.Name().Str(g.tm)+")")
+		}
+	}
+	return telemetrySum(readers), telemetrySum(writers)
+}
+
+func telemetrySum(terms []string) string {
+	if len(terms) == 0 {
+		return "0"
+	}
+	return strings.Join(terms, " + ")
+}
+
+// writeTelemetryBegin writes the start of a public coroutine method's
+// telemetry. The matching end is in writeFuncImplEpilogue.
+func (g *gen) writeTelemetryBegin(b *buffer, f *a.Func) {
+	consumed, produced := g.telemetryPositions(f)
+	b.printf("WUFFS_BASE__TELEMETRY__BEGIN(\n%s,\n%s)\n", consumed, produced)
+}
+
+// telemetryEnd returns the end of a public coroutine method's telemetry,
+// recording the I/O positions' progress and the status.
+func (g *gen) telemetryEnd(f *a.Func) string {
+	consumed, produced := g.telemetryPositions(f)
+	return "WUFFS_BASE__TELEMETRY__END(\n&self->private_impl.telemetry,\n" +
+		consumed + ",\n" + produced + ",\n&status)\n"
+}
+
+// writeTelemetryAccessors writes the declarations (or, if impl, the
+// definitions) of the telemetry functions, one per struct with telemetry.
+func (g *gen) writeTelemetryAccessors(b *buffer, impl bool) {
+	wroteHeading := false
+	for _, n := range g.structList {
+		if !n.Public() || !g.hasTelemetry(n) {
+			continue
+		}
+		if !impl && !wroteHeading {
+			wroteHeading = true
+			b.writes("// ---------------- Telemetry\n\n")
+			b.writes("// wuffs_foo__bar__telemetry returns the counters, summed over all of the\n")
+			b.writes("// public coroutine method calls since self was initialized. They are all\n")
+			b.writes("// zero unless WUFFS_CONFIG__TELEMETRY is defined. See wuffs_base__telemetry.\n\n")
+		}
+
+		structName := n.QID().Str(g.tm)
+		b.printf("WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry\n"+
+			"%s%s__telemetry(\n"+
+			"    const %s%s* self)", g.pkgPrefix, structName, g.pkgPrefix, structName)
+		if !impl {
+			b.writes(";\n\n")
+			continue
+		}
+		b.writes(" {\n")
+		b.writes("#if defined(WUFFS_CONFIG__TELEMETRY)\n")
+		b.writes("if (self &&\n((self->private_impl.magic == WUFFS_BASE__MAGIC) ||\n" +
+			"(self->private_impl.magic == WUFFS_BASE__DISABLED))) {\n")
+		b.writes("return self->private_impl.telemetry;\n}\n")
+		b.writes("#endif  // defined(WUFFS_CONFIG__TELEMETRY)\n")
+		b.writes("return wuffs_base__empty_telemetry();\n}\n\n")
+	}
+}
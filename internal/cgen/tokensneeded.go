@@ -0,0 +1,122 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with token decoders' "$short write" suspensions. The checker
+// derives how many tokens each such suspension needs room for (see
+// lang/check/tokensneeded.go and ast.Ret.TokensNeeded). A public struct with a
+// public coroutine that writes tokens, such as decode_tokens, gets a
+// private_impl.tokens_needed field, set just before each such suspension, and
+// a batch variant of each such coroutine, such as decode_tokens_batch, that
+// also reports that number to the caller.
+
+import (
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// tokenBatchFuncs returns the public struct n's public coroutine methods that
+// have a base.token_writer argument.
+func (g *gen) tokenBatchFuncs(n *a.Struct) (ret []*a.Func) {
+	if (n == nil) || !n.Public() || !n.Classy() {
+		return nil
+	}
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KFunc {
+				continue
+			}
+			if f := tld.AsFunc(); f.Public() && f.Effect().Coroutine() &&
+				(f.Receiver() == n.QID()) && funcHasTokenWriterArg(f) {
+				ret = append(ret, f)
+			}
+		}
+	}
+	return ret
+}
+
+func funcHasTokenWriterArg(f *a.Func) bool {
+	for _, o := range f.In().Fields() {
+		if typ := o.AsField().XType(); (typ.Decorator() == 0) &&
+			(typ.QID() == t.QID{t.IDBase, t.IDTokenWriter}) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeTokensNeeded writes, if n yields a "$short write" with a TokensNeeded,
+// the statement that records it.
+func (g *gen) writeTokensNeeded(b *buffer, n *a.Ret) {
+	tn := n.TokensNeeded()
+	if tn == nil {
+		return
+	}
+	if len(g.tokenBatchFuncs(g.structMap[g.currFunk.astFunc.Receiver()])) == 0 {
+		return
+	}
+	b.printf("self->private_impl.tokens_needed = %s;\n", tn)
+}
+
+// writeTokenBatches writes the declarations (or, if impl, the definitions) of
+// the batch functions, one per public coroutine that writes tokens. Each one
+// calls that coroutine and, if it suspends with "$short write", reports how
+// many tokens it needs room for.
+func (g *gen) writeTokenBatches(b *buffer, impl bool) error {
+	wroteHeading := false
+	for _, n := range g.structList {
+		for _, f := range g.tokenBatchFuncs(n) {
+			if !impl && !wroteHeading {
+				wroteHeading = true
+				b.writes("// ---------------- Token Batches\n\n")
+				b.writes("// wuffs_foo__bar__decode_tokens_batch is like decode_tokens but, when it\n")
+				b.writes("// returns a \"$short write\" suspension, it also sets *a_tokens_needed (if\n")
+				b.writes("// a_tokens_needed is non-NULL) to how many tokens the decoder needs room for\n")
+				b.writes("// (in a_dst->data.len - a_dst->meta.wi) to make progress. The caller can then\n")
+				b.writes("// compact or grow a_dst by enough before calling it again, instead of\n")
+				b.writes("// guessing. For other statuses, it sets *a_tokens_needed to zero.\n\n")
+			}
+
+			structName := n.QID().Str(g.tm)
+			funcName := f.FuncName().Str(g.tm)
+			b.printf("WUFFS_BASE__MAYBE_STATIC wuffs_base__status\n"+
+				"%s%s__%s_batch(\n"+
+				"    %s%s* self", g.pkgPrefix, structName, funcName, g.pkgPrefix, structName)
+			for _, o := range f.In().Fields() {
+				o := o.AsField()
+				b.writes(",\n    ")
+				if err := g.writeCTypeName(b, o.XType(), aPrefix, o.Name().Str(g.tm)); err != nil {
+					return err
+				}
+			}
+			b.writes(",\n    uint64_t* a_tokens_needed)")
+			if !impl {
+				b.writes(";\n\n")
+				continue
+			}
+			b.writes(" {\n")
+			b.printf("wuffs_base__status status = %s(self", g.funcCName(f))
+			for _, o := range f.In().Fields() {
+				b.printf(", %s%s", aPrefix, o.AsField().Name().Str(g.tm))
+			}
+			b.writes(");\n")
+			b.writes("if (a_tokens_needed) {\n*a_tokens_needed = 0;\n")
+			b.writes("if (self && (status.repr == wuffs_base__suspension__short_write)) {\n")
+			b.writes("*a_tokens_needed = self->private_impl.tokens_needed;\n}\n}\n")
+			b.writes("return status;\n}\n\n")
+		}
+	}
+	return nil
+}
@@ -281,8 +281,8 @@ func (g *gen) writeResumeSuspend1(b *buffer, f *funk, n *a.Var, suspend bool) er
 	} else {
 		local := fmt.Sprintf("%s%s", vPrefix, n.Name().Str(g.tm))
 		lhs := local
-		// TODO: don't hard-code [0], and allow recursive coroutines.
-		rhs := fmt.Sprintf("self->private_data.%s%s[0].%s", sPrefix, g.currFunk.astFunc.FuncName().Str(g.tm), lhs)
+		rhs := fmt.Sprintf("self->private_data.%s%s%s.%s",
+			sPrefix, g.currFunk.astFunc.FuncName().Str(g.tm), g.coroFrame(), lhs)
 		if suspend {
 			lhs, rhs = rhs, lhs
 		}
@@ -354,6 +354,11 @@ func (g *gen) writeVars(b *buffer, f *funk, inStructDecl bool) error {
 			b.printf(" = &%s%s;\n", uPrefix, name)
 		} else if typ.Eq(typeExprARMCRC32U32) {
 			b.writes(" = 0;\n")
+		} else if typ.Eq(typeExprARMSVEU8) {
+			// Scalable vector types cannot be brace-initialized.
+			b.writes(" = svdup_n_u8(0);\n")
+		} else if typ.Eq(typeExprRISCVVU8) {
+			b.writes(" = __riscv_vmv_v_x_u8m1(0, __riscv_vsetvlmax_e8m1());\n")
 		} else {
 			b.writes(" = {0};\n")
 		}
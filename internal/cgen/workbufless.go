@@ -0,0 +1,126 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgen
+
+// This file deals with workbuf-less modes: structs with methods marked
+// "workbuf_less" (see lang/check/workbufless.go). Each one gets a
+// private_impl.workbuf_less field, set by initializing with the
+// WUFFS_INITIALIZE__WORKBUF_LESS option. In that mode, workbuf_len returns
+// zero and each method that takes a workbuf calls its workbuf-less variant.
+//
+// Structs with no such methods, but with public methods that take a workbuf,
+// fail to initialize with that option.
+
+import (
+	a "github.com/google/wuffs/lang/ast"
+)
+
+const workbufLessSuffix = "_workbuf_less"
+
+// workbufLessFunc returns the workbuf_less variant of f, or nil if it has no
+// such variant.
+func (g *gen) workbufLessFunc(f *a.Func) *a.Func {
+	if !f.Public() || f.Receiver().IsZero() {
+		return nil
+	}
+	name := f.FuncName().Str(g.tm) + workbufLessSuffix
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KFunc {
+				continue
+			}
+			if o := tld.AsFunc(); o.WorkbufLess() && (o.Receiver() == f.Receiver()) &&
+				(o.FuncName().Str(g.tm) == name) {
+				return o
+			}
+		}
+	}
+	return nil
+}
+
+// workbufLessMode returns whether n has a workbuf-less mode (true, true),
+// does not need one, as no public method takes a workbuf (false, true), or
+// does not support one (false, false).
+func (g *gen) workbufLessMode(n *a.Struct) (has bool, ok bool) {
+	ok = true
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != a.KFunc {
+				continue
+			}
+			o := tld.AsFunc()
+			if o.Receiver() != n.QID() {
+				continue
+			} else if o.WorkbufLess() {
+				has = true
+			} else if o.Public() && g.funcHasWorkbufArg(o) {
+				ok = false
+			}
+		}
+	}
+	return has, has || ok
+}
+
+func (g *gen) funcHasWorkbufArg(f *a.Func) bool {
+	for _, o := range f.In().Fields() {
+		if o.AsField().Name().Str(g.tm) == "workbuf" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeWorkbufLessDispatch writes the start of a public method of a struct
+// with a workbuf-less mode: workbuf_len returns zero and methods with a
+// workbuf_less variant call it.
+func (g *gen) writeWorkbufLessDispatch(b *buffer, n *a.Func) {
+	if !n.Public() || n.Receiver().IsZero() {
+		return
+	} else if has, _ := g.workbufLessMode(g.structMap[n.Receiver()]); !has {
+		return
+	}
+
+	if n.FuncName().Str(g.tm) == "workbuf_len" {
+		b.writes("if (self && self->private_impl.workbuf_less) {\n" +
+			"return wuffs_base__utility__empty_range_ii_u64();\n}\n")
+		return
+	}
+	v := g.workbufLessFunc(n)
+	if v == nil {
+		return
+	}
+	b.writes("if (self && self->private_impl.workbuf_less) {\n")
+	b.printf("return %s(self", g.funcCName(v))
+	for _, o := range v.In().Fields() {
+		b.printf(", %s%s", aPrefix, o.AsField().Name().Str(g.tm))
+	}
+	b.writes(");\n}\n")
+}
+
+// writeWorkbufLessInit writes the part of n's initialize function that
+// handles the WUFFS_INITIALIZE__WORKBUF_LESS option. Sub-structs are
+// initialized without it, as n passes them its own (possibly empty) workbuf.
+func (g *gen) writeWorkbufLessInit(b *buffer, n *a.Struct) {
+	if has, ok := g.workbufLessMode(n); !ok {
+		b.writes("if ((options & WUFFS_INITIALIZE__WORKBUF_LESS) != 0) {\n" +
+			"  return wuffs_base__make_status(wuffs_base__error__unsupported_option);\n" +
+			"}\n\n")
+	} else if has {
+		b.writes("if ((options & WUFFS_INITIALIZE__WORKBUF_LESS) != 0) {\n" +
+			"  self->private_impl.workbuf_less = true;\n" +
+			"  options &= ~WUFFS_INITIALIZE__WORKBUF_LESS;\n" +
+			"}\n\n")
+	}
+}
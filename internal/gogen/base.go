@@ -0,0 +1,205 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gogen
+
+import (
+	"fmt"
+
+	"github.com/google/wuffs/lang/builtin"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+// writeBase writes the Go equivalent of the base package: the parts of
+// wuffs_base__etc that the generated Go code needs, followed by the helper
+// functions that it uses.
+func (g *gen) writeBase(b *buffer) error {
+	b.writes(baseStatus)
+	b.writes("const (\n")
+	for _, z := range builtin.Statuses {
+		msg, _ := t.Unescape(z)
+		b.printf("Base%s = Status(%q)\n", statusGoName(msg, true), msg[:1]+"base: "+msg[1:])
+	}
+	b.writes(")\n\n")
+	b.writes(baseIOBuffer)
+
+	if len(g.helpers) > 0 {
+		b.writes("// ---------------- Helpers\n\n")
+		for _, name := range g.sortedHelpers() {
+			src, ok := helperSource(name)
+			if !ok {
+				return fmt.Errorf("gogen: internal error: unknown helper %q", name)
+			}
+			b.writes(src)
+		}
+	}
+	return nil
+}
+
+const baseStatus = `// ---------------- Base: Status
+
+// Status is a Wuffs status other than ok, which is instead a nil error. Its
+// first byte is '#' for an error, '$' for a suspension and '@' for a note.
+type Status string
+
+// Error implements the error interface. Like the C code's
+// wuffs_base__status__message, it drops the first byte.
+func (s Status) Error() string { return string(s[1:]) }
+
+// IsError returns whether s is an error, such as "#base: bad argument".
+func (s Status) IsError() bool { return s[0] == '#' }
+
+// IsNote returns whether s is a note, such as "@base: end of data".
+func (s Status) IsNote() bool { return (s[0] != '$') && (s[0] != '#') }
+
+// IsSuspension returns whether s is a suspension, such as "$base: short read".
+func (s Status) IsSuspension() bool { return s[0] == '$' }
+
+func statusIsError(err error) bool {
+	if s, ok := err.(Status); ok {
+		return s.IsError()
+	}
+	return err != nil
+}
+
+func statusIsSuspension(err error) bool {
+	s, ok := err.(Status)
+	return ok && s.IsSuspension()
+}
+
+`
+
+const baseIOBuffer = `// ---------------- Base: I/O
+
+// IOBuffer is a Data slice and its Meta state: the Go equivalent of the C
+// code's wuffs_base__io_buffer. An io_reader reads from Data[Meta.RI:Meta.WI]
+// and an io_writer writes to Data[Meta.WI:].
+type IOBuffer struct {
+	Data []byte
+	Meta IOBufferMeta
+}
+
+// IOBufferMeta is an IOBuffer's state, other than its Data.
+type IOBufferMeta struct {
+	WI     uint64 // Write index. Invariant: WI <= len(Data).
+	RI     uint64 // Read index. Invariant: RI <= WI.
+	Pos    uint64 // Position of Data[0] relative to the start of the stream.
+	Closed bool   // No further writes are expected.
+}
+
+// ReaderLength returns the number of bytes that can be read.
+func (b *IOBuffer) ReaderLength() uint64 { return b.Meta.WI - b.Meta.RI }
+
+// ReaderPosition returns the stream position of the next byte to read.
+func (b *IOBuffer) ReaderPosition() uint64 { return b.Meta.Pos + b.Meta.RI }
+
+// WriterLength returns the number of bytes that can be written.
+func (b *IOBuffer) WriterLength() uint64 { return uint64(len(b.Data)) - b.Meta.WI }
+
+// WriterPosition returns the stream position of the next byte to write.
+func (b *IOBuffer) WriterPosition() uint64 { return b.Meta.Pos + b.Meta.WI }
+
+// Compact moves any written but unread bytes to the start of Data.
+func (b *IOBuffer) Compact() {
+	if b.Meta.RI == 0 {
+		return
+	}
+	b.Meta.Pos += b.Meta.RI
+	n := copy(b.Data, b.Data[b.Meta.RI:b.Meta.WI])
+	b.Meta.WI = uint64(n)
+	b.Meta.RI = 0
+}
+
+`
+
+// helperSource returns the Go source code for the named helper function, such
+// as "u32Min" or "u8SatAdd".
+func helperSource(name string) (string, bool) {
+	for _, z := range helperTypes {
+		switch name {
+		case z.prefix + "Min":
+			return fmt.Sprintf("func %s(x %s, y %s) %s {\nif x < y {\nreturn x\n}\nreturn y\n}\n\n",
+				name, z.goType, z.goType, z.goType), true
+		case z.prefix + "Max":
+			return fmt.Sprintf("func %s(x %s, y %s) %s {\nif x > y {\nreturn x\n}\nreturn y\n}\n\n",
+				name, z.goType, z.goType, z.goType), true
+		case z.prefix + "SatAdd":
+			if z.max == "" {
+				break
+			}
+			return fmt.Sprintf("func %s(x %s, y %s) %s {\nif z := x + y; z >= x {\nreturn z\n}\nreturn %s\n}\n\n",
+				name, z.goType, z.goType, z.goType, z.max), true
+		case z.prefix + "SatSub":
+			if z.max == "" {
+				break
+			}
+			return fmt.Sprintf("func %s(x %s, y %s) %s {\nif x >= y {\nreturn x - y\n}\nreturn 0\n}\n\n",
+				name, z.goType, z.goType, z.goType), true
+		case z.prefix + "CeilDivPow2":
+			if z.max == "" {
+				break
+			}
+			return fmt.Sprintf("func %s(x %s, n uint32) %s {\nz := x >> n\nif (z << n) != x {\nz++\n}\nreturn z\n}\n\n",
+				name, z.goType, z.goType), true
+		case z.prefix + "FloorLog2":
+			if z.max == "" {
+				break
+			}
+			return fmt.Sprintf("func %s(x %s) uint32 {\nn := uint32(0)\nfor ; x > 1; x >>= 1 {\nn++\n}\nreturn n\n}\n\n",
+				name, z.goType), true
+		}
+	}
+	return "", false
+}
+
+// helperTypes are the Go types that helper functions are generated for. The
+// saturating arithmetic, ceil_div_pow2 and floor_log2 helpers are only for the
+// unsigned types, which have a non-empty max.
+var helperTypes = [...]struct {
+	prefix string
+	goType string
+	bits   uint32
+	max    string
+}{
+	{"u8", "uint8", 8, "0xFF"},
+	{"u16", "uint16", 16, "0xFFFF"},
+	{"u32", "uint32", 32, "0xFFFFFFFF"},
+	{"u64", "uint64", 64, "0xFFFFFFFFFFFFFFFF"},
+	{"i8", "int8", 8, ""},
+	{"i16", "int16", 16, ""},
+	{"i32", "int32", 32, ""},
+	{"i64", "int64", 64, ""},
+}
+
+// helperPrefix returns the "u32", "i8", etc. prefix of the helper function
+// names for the Go type goType.
+func helperPrefix(goType string) string {
+	for _, z := range helperTypes {
+		if z.goType == goType {
+			return z.prefix
+		}
+	}
+	return ""
+}
+
+// helperBits returns the bit width of the Go integer type goType.
+func helperBits(goType string) uint32 {
+	for _, z := range helperTypes {
+		if z.goType == goType {
+			return z.bits
+		}
+	}
+	return 0
+}
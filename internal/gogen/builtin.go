@@ -0,0 +1,185 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gogen
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// writeBuiltinCall writes the built-in method call n. It returns
+// errNoSuchBuiltin if n is not a built-in method call.
+func (g *gen) writeBuiltinCall(b *buffer, n *a.Expr, sideEffectsOnly bool, depth uint32) error {
+	method := n.LHS().AsExpr()
+	recv := method.LHS().AsExpr()
+	recvTyp := recv.MType()
+
+	switch {
+	case recvTyp.IsArrayType() || recvTyp.IsSliceType():
+		return g.writeBuiltinSlice(b, recv, method.Ident(), n.Args(), sideEffectsOnly, depth)
+	case recvTyp.IsNumType():
+		return g.writeBuiltinNumType(b, recv, method.Ident(), n.Args(), depth)
+	case recvTyp.IsStatus():
+		return g.writeBuiltinStatus(b, recv, method.Ident(), depth)
+	case recvTyp.Decorator() == 0 && recvTyp.QID()[0] == t.IDBase:
+		return fmt.Errorf("TODO: built-in %s", n.Str(g.tm))
+	}
+	return errNoSuchBuiltin
+}
+
+func (g *gen) writeBuiltinSlice(b *buffer, recv *a.Expr, method t.ID, args []*a.Node, sideEffectsOnly bool, depth uint32) error {
+	switch method {
+	case t.IDLength:
+		b.writes("uint64(len(")
+		if err := g.writeExpr(b, recv, depth); err != nil {
+			return err
+		}
+		b.writes("))")
+		return nil
+
+	case t.IDCopyFromSlice:
+		if !sideEffectsOnly {
+			b.writes("uint64(")
+		}
+		b.writes("copy(")
+		if err := g.writeExprSliced(b, recv, depth); err != nil {
+			return err
+		}
+		b.writes(", ")
+		if err := g.writeExprSliced(b, args[0].AsArg().Value(), depth); err != nil {
+			return err
+		}
+		b.writeb(')')
+		if !sideEffectsOnly {
+			b.writeb(')')
+		}
+		return nil
+	}
+	return fmt.Errorf("TODO: built-in %s.%s", recv.Str(g.tm), method.Str(g.tm))
+}
+
+// writeExprSliced writes n, an array or slice, as a Go slice.
+func (g *gen) writeExprSliced(b *buffer, n *a.Expr, depth uint32) error {
+	if err := g.writeExpr(b, n, depth); err != nil {
+		return err
+	}
+	if n.MType().IsArrayType() {
+		b.writes("[:]")
+	}
+	return nil
+}
+
+func (g *gen) writeBuiltinNumType(b *buffer, recv *a.Expr, method t.ID, args []*a.Node, depth uint32) error {
+	goType, err := g.goTypeName(recv.MType())
+	if err != nil {
+		return err
+	}
+
+	switch method {
+	case t.IDLowBits:
+		// "x.low_bits(n: n)" is "x & ((1 << n) - 1)".
+		b.writes("(")
+		if err := g.writeExpr(b, recv, depth); err != nil {
+			return err
+		}
+		b.printf(" & ((%s(1) << ", goType)
+		if err := g.writeExpr(b, args[0].AsArg().Value(), depth); err != nil {
+			return err
+		}
+		b.writes(") - 1))")
+		return nil
+
+	case t.IDHighBits:
+		// "x.high_bits(n: n)" is "x >> (bitWidth - n)".
+		b.writes("(")
+		if err := g.writeExpr(b, recv, depth); err != nil {
+			return err
+		}
+		b.printf(" >> (%d - ", helperBits(goType))
+		if err := g.writeExpr(b, args[0].AsArg().Value(), depth); err != nil {
+			return err
+		}
+		b.writes("))")
+		return nil
+
+	case t.IDMax, t.IDMin:
+		name := helperPrefix(goType) + "Max"
+		if method == t.IDMin {
+			name = helperPrefix(goType) + "Min"
+		}
+		if _, ok := helperSource(name); !ok {
+			break
+		}
+		g.helpers[name] = true
+		b.printf("%s(", name)
+		if err := g.writeExpr(b, recv, depth); err != nil {
+			return err
+		}
+		b.writes(", ")
+		if err := g.writeExprConverted(b, args[0].AsArg().Value(), recv.MType(), depth); err != nil {
+			return err
+		}
+		b.writeb(')')
+		return nil
+
+	case t.IDCeilDivPow2, t.IDFloorLog2:
+		name := helperPrefix(goType) + "CeilDivPow2"
+		if method == t.IDFloorLog2 {
+			name = helperPrefix(goType) + "FloorLog2"
+		}
+		if _, ok := helperSource(name); !ok {
+			break
+		}
+		g.helpers[name] = true
+		b.printf("%s(", name)
+		if err := g.writeExpr(b, recv, depth); err != nil {
+			return err
+		}
+		for _, o := range args {
+			b.writes(", ")
+			if err := g.writeExpr(b, o.AsArg().Value(), depth); err != nil {
+				return err
+			}
+		}
+		b.writeb(')')
+		return nil
+	}
+	return fmt.Errorf("TODO: built-in %s.%s", recv.Str(g.tm), method.Str(g.tm))
+}
+
+func (g *gen) writeBuiltinStatus(b *buffer, recv *a.Expr, method t.ID, depth uint32) error {
+	switch method {
+	case t.IDIsOK:
+		b.writes("(")
+		if err := g.writeExpr(b, recv, depth); err != nil {
+			return err
+		}
+		b.writes(" == nil)")
+		return nil
+	case t.IDIsError:
+		b.writes("statusIsError(")
+	case t.IDIsSuspension:
+		b.writes("statusIsSuspension(")
+	default:
+		return fmt.Errorf("TODO: built-in %s.%s", recv.Str(g.tm), method.Str(g.tm))
+	}
+	if err := g.writeExpr(b, recv, depth); err != nil {
+		return err
+	}
+	b.writeb(')')
+	return nil
+}
@@ -0,0 +1,409 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gogen
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func (g *gen) writeExpr(b *buffer, n *a.Expr, depth uint32) error {
+	return g.writeExpr1(b, n, false, depth)
+}
+
+// writeExprSideEffectsOnly is like writeExpr but for an expression statement,
+// whose value (if any) is discarded.
+func (g *gen) writeExprSideEffectsOnly(b *buffer, n *a.Expr, depth uint32) error {
+	return g.writeExpr1(b, n, true, depth)
+}
+
+func (g *gen) writeExpr1(b *buffer, n *a.Expr, sideEffectsOnly bool, depth uint32) error {
+	if depth > a.MaxExprDepth {
+		return fmt.Errorf("expression recursion depth too large")
+	}
+	depth++
+
+	if cv := n.ConstValue(); cv != nil {
+		if typ := n.MType(); typ.IsNumTypeOrIdeal() {
+			b.writes(cv.String())
+		} else if typ.IsStatus() {
+			b.writes("nil")
+		} else if !typ.IsBool() {
+			return fmt.Errorf("cannot generate Go expression for %v constant of type %q", n.Str(g.tm), n.MType().Str(g.tm))
+		} else if cv.Cmp(zero) == 0 {
+			b.writes("false")
+		} else if cv.Cmp(one) == 0 {
+			b.writes("true")
+		} else {
+			return fmt.Errorf("%v has type bool but constant value %v is neither 0 or 1", n.Str(g.tm), cv)
+		}
+		return nil
+	}
+
+	switch op := n.Operator(); {
+	case op.IsXUnaryOp():
+		return g.writeExprUnaryOp(b, n, depth)
+	case op.IsXBinaryOp():
+		return g.writeExprBinaryOp(b, n, depth)
+	case op.IsXAssociativeOp():
+		return g.writeExprAssociativeOp(b, n, depth)
+	}
+	return g.writeExprOther(b, n, sideEffectsOnly, depth)
+}
+
+func (g *gen) writeExprOther(b *buffer, n *a.Expr, sideEffectsOnly bool, depth uint32) error {
+	switch n.Operator() {
+	case 0:
+		if ident := n.Ident(); ident == t.IDThis {
+			b.writes("self")
+
+		} else if ident == t.IDCoroutineResumed {
+			// Only non-suspendible coroutines are generated, and they are
+			// never resumed.
+			b.writes("false")
+
+		} else if ident.IsDQStrLiteral(g.tm) {
+			if name := g.statusMap[t.QID{0, ident}]; name != "" {
+				b.writes(name)
+				return nil
+			}
+			return fmt.Errorf("unrecognized status %s", n.Str(g.tm))
+
+		} else if n.GlobalIdent() {
+			c := g.consts[t.QID{0, ident}]
+			if c == nil {
+				return fmt.Errorf("unrecognized global identifier %s", n.Str(g.tm))
+			}
+			b.writes(g.constName(c))
+
+		} else {
+			b.writes(vPrefix)
+			b.writes(ident.Str(g.tm))
+		}
+		return nil
+
+	case t.IDOpenParen:
+		// n is a function call.
+		if err := g.writeBuiltinCall(b, n, sideEffectsOnly, depth); err != errNoSuchBuiltin {
+			return err
+		}
+		return g.writeExprUserDefinedCall(b, n, depth)
+
+	case t.IDOpenBracket:
+		// n is an index.
+		if err := g.writeExpr(b, n.LHS().AsExpr(), depth); err != nil {
+			return err
+		}
+		b.writeb('[')
+		if err := g.writeExpr(b, n.RHS().AsExpr(), depth); err != nil {
+			return err
+		}
+		b.writeb(']')
+		return nil
+
+	case t.IDDotDot:
+		// n is a slice.
+		if err := g.writeExpr(b, n.LHS().AsExpr(), depth); err != nil {
+			return err
+		}
+		b.writeb('[')
+		if mhs := n.MHS().AsExpr(); mhs != nil {
+			if err := g.writeExpr(b, mhs, depth); err != nil {
+				return err
+			}
+		}
+		b.writeb(':')
+		if rhs := n.RHS().AsExpr(); rhs != nil {
+			if err := g.writeExpr(b, rhs, depth); err != nil {
+				return err
+			}
+		}
+		b.writeb(']')
+		return nil
+
+	case t.IDDot:
+		lhs := n.LHS().AsExpr()
+		if lhs.Ident() == t.IDArgs {
+			b.writes(aPrefix)
+			b.writes(n.Ident().Str(g.tm))
+			return nil
+		} else if (lhs.Operator() == 0) && n.Ident().IsDQStrLiteral(g.tm) {
+			if name := g.statusMap[t.QID{lhs.Ident(), n.Ident()}]; name != "" {
+				b.writes(name)
+				return nil
+			}
+			return fmt.Errorf("TODO: status %s", n.Str(g.tm))
+		}
+
+		// Go's "." works for both structs and pointers to structs.
+		if err := g.writeExpr(b, lhs, depth); err != nil {
+			return err
+		}
+		b.writeb('.')
+		b.writes(fPrefix)
+		b.writes(n.Ident().Str(g.tm))
+		return nil
+	}
+	return fmt.Errorf("unrecognized token (0x%X) for writeExprOther", n.Operator())
+}
+
+func (g *gen) writeExprUnaryOp(b *buffer, n *a.Expr, depth uint32) error {
+	op := n.Operator()
+	opName := goOpName(op)
+	if opName == "" {
+		return fmt.Errorf("unrecognized operator %q", op.AmbiguousForm().Str(g.tm))
+	}
+	b.writes(opName)
+	return g.writeExpr(b, n.RHS().AsExpr(), depth)
+}
+
+func (g *gen) writeExprBinaryOp(b *buffer, n *a.Expr, depth uint32) error {
+	op := n.Operator()
+	lhs, rhs := n.LHS().AsExpr(), n.RHS().AsExpr()
+	switch op {
+	case t.IDXBinaryAs:
+		if n.Effect() != 0 {
+			return fmt.Errorf("TODO: %s", n.Str(g.tm))
+		}
+		return g.writeExprAs(b, lhs, n.RHS().AsTypeExpr(), depth)
+
+	case t.IDXBinaryTildeSatPlus, t.IDXBinaryTildeSatMinus:
+		helper, err := g.satHelper(n.MType(), op == t.IDXBinaryTildeSatPlus)
+		if err != nil {
+			return err
+		}
+		b.printf("%s(", helper)
+		if err := g.writeExprConverted(b, lhs, n.MType(), depth); err != nil {
+			return err
+		}
+		b.writes(", ")
+		if err := g.writeExprConverted(b, rhs, n.MType(), depth); err != nil {
+			return err
+		}
+		b.writeb(')')
+		return nil
+	}
+
+	opName := goOpName(op)
+	if opName == "" {
+		return fmt.Errorf("unrecognized operator %q", op.AmbiguousForm().Str(g.tm))
+	}
+
+	b.writeb('(')
+	switch op {
+	case t.IDXBinaryShiftL, t.IDXBinaryShiftR, t.IDXBinaryTildeModShiftL, t.IDXBinaryTildeModShiftR:
+		// Go converts a constant shift operand to the type that the shift's
+		// context needs, which (unlike in Wuffs) might be int. Shifting by a
+		// count at least the operand's bit width gives zero in Go, which is
+		// what the "~mod" shifts need.
+		if lhs.ConstValue() != nil {
+			if err := g.writeExprAs(b, lhs, n.MType(), depth); err != nil {
+				return err
+			}
+		} else if err := g.writeExpr(b, lhs, depth); err != nil {
+			return err
+		}
+		b.writes(opName)
+		if err := g.writeExpr(b, rhs, depth); err != nil {
+			return err
+		}
+
+	case t.IDXBinaryNotEq, t.IDXBinaryLessThan, t.IDXBinaryLessEq,
+		t.IDXBinaryEqEq, t.IDXBinaryGreaterEq, t.IDXBinaryGreaterThan,
+		t.IDXBinaryAnd, t.IDXBinaryOr:
+		if err := g.writeExpr(b, lhs, depth); err != nil {
+			return err
+		}
+		b.writes(opName)
+		if err := g.writeExpr(b, rhs, depth); err != nil {
+			return err
+		}
+
+	default:
+		// Go's unsigned and signed arithmetic both wrap around, so the
+		// "~mod" operators need no special treatment.
+		if err := g.writeExprConverted(b, lhs, n.MType(), depth); err != nil {
+			return err
+		}
+		b.writes(opName)
+		if err := g.writeExprConverted(b, rhs, n.MType(), depth); err != nil {
+			return err
+		}
+	}
+	b.writeb(')')
+	return nil
+}
+
+func (g *gen) writeExprAs(b *buffer, lhs *a.Expr, rhs *a.TypeExpr, depth uint32) error {
+	typ, err := g.goTypeName(rhs)
+	if err != nil {
+		return err
+	}
+	b.printf("%s(", typ)
+	if err := g.writeExpr(b, lhs, depth); err != nil {
+		return err
+	}
+	b.writeb(')')
+	return nil
+}
+
+// writeExprConverted writes n, converted to typ if n has a different (and
+// non-ideal) type. The checker implicitly widens mixed-type arguments, but Go
+// requires the explicit conversion.
+func (g *gen) writeExprConverted(b *buffer, n *a.Expr, typ *a.TypeExpr, depth uint32) error {
+	if nTyp := n.MType(); typ.IsNumType() && !nTyp.IsIdeal() && !nTyp.EqIgnoringRefinements(typ) {
+		return g.writeExprAs(b, n, typ, depth)
+	}
+	return g.writeExpr(b, n, depth)
+}
+
+func (g *gen) writeExprAssociativeOp(b *buffer, n *a.Expr, depth uint32) error {
+	op := n.Operator()
+	opName := goOpName(op)
+	if opName == "" {
+		return fmt.Errorf("unrecognized operator %q", op.AmbiguousForm().Str(g.tm))
+	}
+	b.writeb('(')
+	for i, o := range n.Args() {
+		if i != 0 {
+			b.writes(opName)
+		}
+		if err := g.writeExprConverted(b, o.AsExpr(), n.MType(), depth); err != nil {
+			return err
+		}
+	}
+	b.writeb(')')
+	return nil
+}
+
+func (g *gen) writeExprUserDefinedCall(b *buffer, n *a.Expr, depth uint32) error {
+	method := n.LHS().AsExpr()
+	recv := method.LHS().AsExpr()
+	recvTyp := recv.MType().Pointee()
+	if recvTyp.Decorator() != 0 {
+		return fmt.Errorf("cannot generate user-defined method call %q for receiver type %q",
+			n.Str(g.tm), recv.MType().Str(g.tm))
+	}
+	qid := recvTyp.QID()
+	f := g.funcs[t.QQID{qid[0], qid[1], method.Ident()}]
+	if f == nil {
+		return fmt.Errorf("TODO: call %s", n.Str(g.tm))
+	}
+	if err := g.writeExpr(b, recv, depth); err != nil {
+		return err
+	}
+	b.printf(".%s(", g.funcName(f))
+	if err := g.writeArgs(b, n.Args(), depth); err != nil {
+		return err
+	}
+	b.writeb(')')
+	return nil
+}
+
+func (g *gen) writeArgs(b *buffer, args []*a.Node, depth uint32) error {
+	for i, o := range args {
+		if i > 0 {
+			b.writes(", ")
+		}
+		if err := g.writeExpr(b, o.AsArg().Value(), depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// satHelper returns the name of the helper function for typ's "~sat+" (if
+// plus) or "~sat-" operator.
+func (g *gen) satHelper(typ *a.TypeExpr, plus bool) (string, error) {
+	goType, err := g.goTypeName(typ)
+	if err != nil {
+		return "", err
+	}
+	name := helperPrefix(goType) + "SatSub"
+	if plus {
+		name = helperPrefix(goType) + "SatAdd"
+	}
+	if _, ok := helperSource(name); !ok {
+		return "", fmt.Errorf("TODO: saturating arithmetic for %q", typ.Str(g.tm))
+	}
+	g.helpers[name] = true
+	return name, nil
+}
+
+func goOpName(x t.ID) string {
+	if x < t.ID(len(goOpNames)) {
+		return goOpNames[x]
+	}
+	return ""
+}
+
+var goOpNames = [...]string{
+	t.IDPlusEq:           " += ",
+	t.IDMinusEq:          " -= ",
+	t.IDStarEq:           " *= ",
+	t.IDSlashEq:          " /= ",
+	t.IDShiftLEq:         " <<= ",
+	t.IDShiftREq:         " >>= ",
+	t.IDAmpEq:            " &= ",
+	t.IDPipeEq:           " |= ",
+	t.IDHatEq:            " ^= ",
+	t.IDPercentEq:        " %= ",
+	t.IDTildeModPlusEq:   " += ",
+	t.IDTildeModMinusEq:  " -= ",
+	t.IDTildeModStarEq:   " *= ",
+	t.IDTildeModShiftLEq: " <<= ",
+	t.IDTildeModShiftREq: " >>= ",
+
+	t.IDEq:         " = ",
+	t.IDEqQuestion: " = ",
+
+	t.IDXBinaryPlus:           " + ",
+	t.IDXBinaryMinus:          " - ",
+	t.IDXBinaryStar:           " * ",
+	t.IDXBinarySlash:          " / ",
+	t.IDXBinaryShiftL:         " << ",
+	t.IDXBinaryShiftR:         " >> ",
+	t.IDXBinaryAmp:            " & ",
+	t.IDXBinaryPipe:           " | ",
+	t.IDXBinaryHat:            " ^ ",
+	t.IDXBinaryPercent:        " % ",
+	t.IDXBinaryTildeModPlus:   " + ",
+	t.IDXBinaryTildeModMinus:  " - ",
+	t.IDXBinaryTildeModStar:   " * ",
+	t.IDXBinaryTildeModShiftL: " << ",
+	t.IDXBinaryTildeModShiftR: " >> ",
+	t.IDXBinaryNotEq:          " != ",
+	t.IDXBinaryLessThan:       " < ",
+	t.IDXBinaryLessEq:         " <= ",
+	t.IDXBinaryEqEq:           " == ",
+	t.IDXBinaryGreaterEq:      " >= ",
+	t.IDXBinaryGreaterThan:    " > ",
+	t.IDXBinaryAnd:            " && ",
+	t.IDXBinaryOr:             " || ",
+
+	t.IDXAssociativePlus: " + ",
+	t.IDXAssociativeStar: " * ",
+	t.IDXAssociativeAmp:  " & ",
+	t.IDXAssociativePipe: " | ",
+	t.IDXAssociativeHat:  " ^ ",
+	t.IDXAssociativeAnd:  " && ",
+	t.IDXAssociativeOr:   " || ",
+
+	t.IDXUnaryPlus:  "+",
+	t.IDXUnaryMinus: "-",
+	t.IDXUnaryNot:   "!",
+}
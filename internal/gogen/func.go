@@ -0,0 +1,477 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gogen
+
+import (
+	"fmt"
+	"strconv"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// findSuspendible sets g.suspendible to the coroutines that can suspend: those
+// that yield, that call a built-in (such as an io_reader method) or another
+// package's coroutine, or that call one of this package's suspendible
+// coroutines.
+func (g *gen) findSuspendible() {
+	g.suspendible = map[t.QQID]bool{}
+	callees := map[t.QQID][]t.QQID{}
+	for qqid, f := range g.funcs {
+		if !f.Effect().Coroutine() {
+			continue
+		}
+		for _, o := range f.Body() {
+			o.Walk(func(n *a.Node) error {
+				if (n.Kind() == a.KRet) && (n.AsRet().Keyword() == t.IDYield) {
+					g.suspendible[qqid] = true
+				} else if n.Kind() == a.KExpr {
+					if callee, ok := g.coroutineCallee(n.AsExpr()); !ok {
+						// No-op.
+					} else if g.funcs[callee] == nil {
+						g.suspendible[qqid] = true
+					} else {
+						callees[qqid] = append(callees[qqid], callee)
+					}
+				}
+				return nil
+			})
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for qqid, cs := range callees {
+			if g.suspendible[qqid] {
+				continue
+			}
+			for _, c := range cs {
+				if g.suspendible[c] {
+					g.suspendible[qqid] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+}
+
+// coroutineCallee returns the function called by n, if n is a coroutine call.
+func (g *gen) coroutineCallee(n *a.Expr) (callee t.QQID, ok bool) {
+	if (n.Operator() != a.ExprOperatorCall) || !n.Effect().Coroutine() {
+		return t.QQID{}, false
+	}
+	method := n.LHS().AsExpr()
+	recvTyp := method.LHS().AsExpr().MType().Pointee()
+	if recvTyp.Decorator() != 0 {
+		return t.QQID{}, true
+	}
+	qid := recvTyp.QID()
+	return t.QQID{qid[0], qid[1], method.Ident()}, true
+}
+
+func (g *gen) writeFunc(b *buffer, n *a.Func) error {
+	// The Go code always uses the portable implementation, so a function
+	// that needs a particular CPU architecture is never called.
+	if n.HasChooseCPUArch() {
+		return nil
+	}
+	if n.Effect().Coroutine() && g.suspendible[n.QQID()] {
+		return fmt.Errorf("TODO: suspendible coroutine %s", n.QQID().Str(g.tm))
+	}
+	g.currFunk = funk{
+		astFunc:    n,
+		loopLabels: map[a.Loop]string{},
+	}
+
+	name := g.funcName(n)
+	if n.Public() {
+		if n.Receiver().IsZero() {
+			b.printf("// %s is the Wuffs %s function.\n", name, n.FuncName().Str(g.tm))
+		} else {
+			b.printf("// %s is the Wuffs %s.%s method.\n",
+				name, n.Receiver()[1].Str(g.tm), n.FuncName().Str(g.tm))
+		}
+	}
+	b.writes("func ")
+	if !n.Receiver().IsZero() {
+		b.printf("(self *%s) ", g.structName(n.Receiver()))
+	}
+	b.printf("%s(", name)
+	for i, o := range n.In().Fields() {
+		o := o.AsField()
+		typ, err := g.goTypeName(o.XType())
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			b.writes(", ")
+		}
+		b.printf("%s%s %s", aPrefix, o.Name().Str(g.tm), typ)
+	}
+	b.writes(") ")
+	if n.Effect().Coroutine() {
+		b.writes("error ")
+	} else if out := n.Out(); out != nil {
+		typ, err := g.goTypeName(out)
+		if err != nil {
+			return err
+		}
+		b.printf("%s ", typ)
+	}
+	b.writes("{\n")
+
+	if err := g.writeVars(b, n.Body()); err != nil {
+		return err
+	}
+	if err := g.writeBlock(b, n.Body(), 0); err != nil {
+		return err
+	}
+	if n.Effect().Coroutine() && !n.BodyEndsWithReturn() {
+		b.writes("return nil\n")
+	}
+	b.writes("}\n\n")
+	return nil
+}
+
+// writeVars declares the local variables, at the start of the function, as
+// Wuffs variables are in scope for the whole function. A variable that is
+// never read is also assigned to the blank identifier, as otherwise the Go
+// compiler rejects it as unused.
+func (g *gen) writeVars(b *buffer, body []*a.Node) error {
+	for _, o := range body {
+		if err := o.Walk(func(n *a.Node) error {
+			if n.Kind() != a.KVar {
+				return nil
+			}
+			v := n.AsVar()
+			typ, err := g.goTypeName(v.XType())
+			if err != nil {
+				return errorAt(n, err)
+			}
+			name := vPrefix + v.Name().Str(g.tm)
+			b.printf("var %s %s\n", name, typ)
+			if !blockReadsVar(body, v.Name()) {
+				b.printf("_ = %s\n", name)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func blockReadsVar(block []*a.Node, name t.ID) bool {
+	for _, o := range block {
+		if nodeReadsVar(o, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeReadsVar returns whether n reads the local variable with the given name.
+// Being assigned to is not reading.
+func nodeReadsVar(n *a.Node, name t.ID) bool {
+	if n == nil {
+		return false
+	}
+	switch n.Kind() {
+	case a.KAssign:
+		return nodeReadsVar(n.AsAssign().RHS().AsNode(), name)
+	case a.KExpr:
+		if e := n.AsExpr(); (e.Operator() == 0) && (e.Ident() == name) && !e.GlobalIdent() {
+			return true
+		}
+	case a.KVar:
+		return false
+	}
+	for _, o := range n.AsRaw().SubNodes() {
+		if nodeReadsVar(o, name) {
+			return true
+		}
+	}
+	for _, l := range n.AsRaw().SubLists() {
+		if blockReadsVar(l, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *gen) writeBlock(b *buffer, block []*a.Node, depth uint32) error {
+	for _, o := range block {
+		if err := g.writeStatement(b, o, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *gen) writeStatement(b *buffer, n *a.Node, depth uint32) error {
+	return errorAt(n, g.writeStatement1(b, n, depth))
+}
+
+func (g *gen) writeStatement1(b *buffer, n *a.Node, depth uint32) error {
+	if depth > a.MaxBodyDepth {
+		return fmt.Errorf("body recursion depth too large")
+	}
+	depth++
+
+	switch n.Kind() {
+	case a.KAssert:
+		// Assertions only apply at compile-time.
+		return nil
+	case a.KAssign:
+		n := n.AsAssign()
+		return g.writeStatementAssign(b, n.Operator(), n.LHS(), n.RHS(), depth)
+	case a.KChoose:
+		return g.writeStatementChoose(b, n.AsChoose())
+	case a.KIOBind:
+		return fmt.Errorf("TODO: io_bind and io_limit")
+	case a.KIf:
+		return g.writeStatementIf(b, n.AsIf(), depth)
+	case a.KIterate:
+		return g.writeStatementIterate(b, n.AsIterate(), depth)
+	case a.KJump:
+		return g.writeStatementJump(b, n.AsJump())
+	case a.KRet:
+		return g.writeStatementRet(b, n.AsRet(), depth)
+	case a.KVar:
+		// Variables are declared by writeVars.
+		return nil
+	case a.KWhile:
+		return g.writeStatementWhile(b, n.AsWhile(), depth)
+	}
+	return fmt.Errorf("unrecognized ast.Kind (%s) for writeStatement", n.Kind())
+}
+
+func (g *gen) writeStatementAssign(b *buffer, op t.ID, lhs *a.Expr, rhs *a.Expr, depth uint32) error {
+	if lhs == nil {
+		if rhs.Effect().Coroutine() {
+			// The callee is one of this package's non-suspendible coroutines,
+			// so any non-ok status, even a note, returns immediately.
+			b.writes("if status := ")
+			if err := g.writeExpr(b, rhs, depth); err != nil {
+				return err
+			}
+			b.writes("; status != nil {\nreturn status\n}\n")
+			return nil
+		}
+		if err := g.writeExprSideEffectsOnly(b, rhs, depth); err != nil {
+			return err
+		}
+		b.writeb('\n')
+		return nil
+	}
+
+	if err := g.writeExpr(b, lhs, depth); err != nil {
+		return err
+	}
+
+	switch op {
+	case t.IDTildeSatPlusEq, t.IDTildeSatMinusEq:
+		helper, err := g.satHelper(lhs.MType(), op == t.IDTildeSatPlusEq)
+		if err != nil {
+			return err
+		}
+		b.printf(" = %s(", helper)
+		if err := g.writeExpr(b, lhs, depth); err != nil {
+			return err
+		}
+		b.writes(", ")
+		if err := g.writeExpr(b, rhs, depth); err != nil {
+			return err
+		}
+		b.writes(")\n")
+		return nil
+	}
+
+	opName := goOpName(op)
+	if opName == "" {
+		return fmt.Errorf("unrecognized operator %q", op.AmbiguousForm().Str(g.tm))
+	}
+	b.writes(opName)
+	if err := g.writeExpr(b, rhs, depth); err != nil {
+		return err
+	}
+	b.writeb('\n')
+	return nil
+}
+
+func (g *gen) writeStatementChoose(b *buffer, n *a.Choose) error {
+	recv := g.currFunk.astFunc.Receiver()
+	for _, o := range n.Args() {
+		f := g.funcs[t.QQID{recv[0], recv[1], o.AsExpr().Ident()}]
+		if (f == nil) || !f.HasChooseCPUArch() {
+			return fmt.Errorf("TODO: choose %s without a choose-cpu_arch precondition",
+				o.AsExpr().Ident().Str(g.tm))
+		}
+	}
+	b.printf("// No-op: choose %s. Go always uses the portable implementation.\n", n.Name().Str(g.tm))
+	return nil
+}
+
+func (g *gen) writeStatementIf(b *buffer, n *a.If, depth uint32) error {
+	for {
+		b.writes("if ")
+		if err := g.writeExpr(b, n.Condition(), 0); err != nil {
+			return err
+		}
+		b.writes(" {\n")
+		if err := g.writeBlock(b, n.BodyIfTrue(), depth); err != nil {
+			return err
+		}
+		if bif := n.BodyIfFalse(); len(bif) > 0 {
+			b.writes("} else {\n")
+			if err := g.writeBlock(b, bif, depth); err != nil {
+				return err
+			}
+			break
+		}
+		n = n.ElseIf()
+		if n == nil {
+			break
+		}
+		b.writes("} else ")
+	}
+	b.writes("}\n")
+	return nil
+}
+
+// writeStatementIterate writes an iterate loop. The Go code does not unroll
+// it, as the Go compiler's bounds check elimination works better with the
+// simple loops.
+func (g *gen) writeStatementIterate(b *buffer, n *a.Iterate, depth uint32) error {
+	assigns := n.Assigns()
+	if len(assigns) == 0 {
+		return nil
+	}
+	if n.HasBreak() || n.HasContinue() {
+		return fmt.Errorf("TODO: break or continue for an iterate loop")
+	}
+	b.writes("{\n")
+	for _, o := range assigns {
+		o := o.AsAssign()
+		b.printf("%sslice_%s := ", iPrefix, o.LHS().Ident().Str(g.tm))
+		if err := g.writeExpr(b, o.RHS(), 0); err != nil {
+			return err
+		}
+		b.writeb('\n')
+	}
+
+	for ; n != nil; n = n.ElseIterate() {
+		length, err := strconv.Atoi(n.Length().Str(g.tm))
+		if err != nil {
+			return err
+		}
+		advance, err := strconv.Atoi(n.Advance().Str(g.tm))
+		if err != nil {
+			return err
+		}
+		if advance > length {
+			return fmt.Errorf("TODO: iterate advance %d greater than its length %d", advance, length)
+		}
+
+		b.writes("for ")
+		for i, o := range assigns {
+			if i > 0 {
+				b.writes(" && ")
+			}
+			b.printf("(len(%sslice_%s) >= %d)", iPrefix, o.AsAssign().LHS().Ident().Str(g.tm), length)
+		}
+		b.writes(" {\n")
+		for _, o := range assigns {
+			name := o.AsAssign().LHS().Ident().Str(g.tm)
+			b.printf("%s%s = %sslice_%s[:%d]\n", vPrefix, name, iPrefix, name, length)
+		}
+		if err := g.writeBlock(b, n.Body(), depth); err != nil {
+			return err
+		}
+		for _, o := range assigns {
+			name := o.AsAssign().LHS().Ident().Str(g.tm)
+			b.printf("%sslice_%s = %sslice_%s[%d:]\n", iPrefix, name, iPrefix, name, advance)
+		}
+		b.writes("}\n")
+	}
+
+	for _, o := range assigns {
+		b.printf("%s%s = nil\n", vPrefix, o.AsAssign().LHS().Ident().Str(g.tm))
+	}
+	b.writes("}\n")
+	return nil
+}
+
+func (g *gen) writeStatementJump(b *buffer, n *a.Jump) error {
+	label := g.currFunk.loopLabels[n.JumpTarget()]
+	if label == "" {
+		return fmt.Errorf("TODO: jump to a %s loop", n.JumpTarget().Keyword().Str(g.tm))
+	}
+	keyword := "continue"
+	if n.Keyword() == t.IDBreak {
+		keyword = "break"
+	}
+	b.printf("%s %s\n", keyword, label)
+	return nil
+}
+
+func (g *gen) writeStatementRet(b *buffer, n *a.Ret, depth uint32) error {
+	if n.Keyword() != t.IDReturn {
+		return fmt.Errorf("TODO: %s", n.Keyword().Str(g.tm))
+	}
+	retExpr := n.Value()
+	if retExpr == nil {
+		b.writes("return\n")
+		return nil
+	}
+	if g.currFunk.astFunc.Effect().Coroutine() &&
+		(retExpr.Operator() == 0) && (retExpr.Ident() == t.IDOk) {
+		b.writes("return nil\n")
+		return nil
+	}
+	b.writes("return ")
+	if err := g.writeExpr(b, retExpr, depth); err != nil {
+		return err
+	}
+	b.writeb('\n')
+	return nil
+}
+
+// writeStatementWhile writes a while loop. Every break or continue uses a Go
+// label, so that it jumps to the right loop even from within a nested one.
+func (g *gen) writeStatementWhile(b *buffer, n *a.While, depth uint32) error {
+	if n.HasBreak() || n.HasContinue() {
+		label := fmt.Sprintf("label_%d", len(g.currFunk.loopLabels))
+		g.currFunk.loopLabels[n] = label
+		b.printf("%s:\n", label)
+	}
+	if n.IsWhileTrue() {
+		// A Go "for {}" loop, unlike a "for true {}" one, is a terminating
+		// statement if there is no break.
+		b.writes("for {\n")
+	} else {
+		b.writes("for ")
+		if err := g.writeExpr(b, n.Condition(), 0); err != nil {
+			return err
+		}
+		b.writes(" {\n")
+	}
+	if err := g.writeBlock(b, n.Body(), depth); err != nil {
+		return err
+	}
+	b.writes("}\n")
+	return nil
+}
@@ -0,0 +1,490 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gogen transpiles Wuffs packages to pure Go: no cgo and no unsafe.
+//
+// Each generated Go package is self-contained. It has its own copy of the
+// base package's Go code: the IOBuffer type, which is the Go equivalent of
+// C's wuffs_base__io_buffer, and the Status type, whose values are the
+// package's (and the base package's) non-ok statuses. An ok status is a nil
+// error.
+//
+// Not every Wuffs construct is supported yet. In particular, coroutines that
+// can suspend (and hence the I/O methods that can suspend) are not, as Go has
+// no equivalent of the C code's switch-into-the-middle-of-a-loop resumption.
+// Functions that have a choose-cpu_arch precondition are not generated at
+// all: the Go code always uses the portable (non-SIMD) implementation.
+package gogen
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/google/wuffs/lang/builtin"
+	"github.com/google/wuffs/lang/generate"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Prefixes are prepended to names to form a namespace and to avoid e.g.
+// "type" being a valid Wuffs variable name but not a valid Go one. Public
+// names are instead converted to exported CamelCase names, such as
+// "update_u32" becoming "UpdateU32".
+const (
+	aPrefix = "a_" // Function argument.
+	cPrefix = "c_" // Private const.
+	fPrefix = "f_" // Struct field.
+	iPrefix = "i_" // Iterate variable.
+	mPrefix = "m_" // Private function or method.
+	sPrefix = "s_" // Private struct.
+	vPrefix = "v_" // Local variable.
+)
+
+var (
+	zero = big.NewInt(0)
+	one  = big.NewInt(1)
+)
+
+var (
+	errFound         = errors.New("gogen: internal error: found")
+	errNoSuchBuiltin = errors.New("gogen: internal error: no such built-in")
+)
+
+// Do transpiles a Wuffs program to a Go program.
+//
+// The arguments list the source Wuffs files. If no arguments are given, it
+// reads from stdin.
+//
+// The generated program is written to stdout.
+func Do(args []string) error {
+	flags := flag.FlagSet{}
+	return generate.DoBackend(&flags, args, newBackend(&flags))
+}
+
+func init() {
+	generate.Register(newBackend)
+}
+
+// backend is the generate.Backend for Go, which has no separate declarations.
+type backend struct{}
+
+func newBackend(flags *flag.FlagSet) generate.Backend { return backend{} }
+
+func (backend) FileExtension() string                                   { return "go" }
+func (backend) Header(p *generate.Package) ([]byte, error)              { return nil, nil }
+func (backend) Impl(p *generate.Package) ([]byte, error)                { return Generate(p.Name, p.TM, p.Files) }
+func (backend) AuxFiles(p *generate.Package) (map[string][]byte, error) { return nil, nil }
+
+// Generate is like Do, but its input is a checked Wuffs package, and it
+// returns the Go program instead of writing it out. The base package has a
+// pkgName of "base" and no files.
+func Generate(pkgName string, tm *t.Map, files []*a.File) ([]byte, error) {
+	g := &gen{
+		pkgName:   pkgName,
+		tm:        tm,
+		files:     files,
+		consts:    map[t.QID]*a.Const{},
+		funcs:     map[t.QQID]*a.Func{},
+		statusMap: map[t.QID]string{},
+		structMap: map[t.QID]*a.Struct{},
+		helpers:   map[string]bool{},
+	}
+	b := &buffer{}
+	if pkgName == "base" {
+		if len(files) != 0 {
+			return nil, fmt.Errorf("base package shouldn't have any .wuffs files")
+		}
+		b.writes("// Code generated by \"wuffs-go gen\"; DO NOT EDIT.\n\n")
+		b.writes("// Package base is the Go code that every generated Go package has its own\n")
+		b.writes("// copy of.\n")
+		b.writes("package base\n\n")
+		if err := g.writeBase(b); err != nil {
+			return nil, err
+		}
+	} else if err := g.generate(b); err != nil {
+		return nil, err
+	}
+
+	out, err := format.Source(*b)
+	if err != nil {
+		return nil, fmt.Errorf("gogen: invalid generated Go code: %v", err)
+	}
+	return out, nil
+}
+
+type buffer []byte
+
+func (b *buffer) Write(p []byte) (int, error) {
+	*b = append(*b, p...)
+	return len(p), nil
+}
+
+func (b *buffer) printf(format string, args ...interface{}) { fmt.Fprintf(b, format, args...) }
+func (b *buffer) writeb(x byte)                             { *b = append(*b, x) }
+func (b *buffer) writes(s string)                           { *b = append(*b, s...) }
+
+// Error is a code generation error, annotated with the Wuffs statement (or, if
+// there is none, the function) being generated.
+type Error struct {
+	Err      error
+	Filename string
+	Line     uint32
+}
+
+func (e *Error) Error() string {
+	msg := e.Err.Error()
+	if !strings.HasPrefix(msg, "gogen: ") {
+		msg = "gogen: " + msg
+	}
+	return fmt.Sprintf("%s at %s:%d", msg, e.Filename, e.Line)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func errorAt(n *a.Node, err error) error {
+	if err == nil {
+		return nil
+	} else if _, ok := err.(*Error); ok {
+		return err
+	}
+	filename, line := n.AsRaw().FilenameLine()
+	return &Error{Err: err, Filename: filename, Line: line}
+}
+
+type gen struct {
+	pkgName string
+	tm      *t.Map
+	files   []*a.File
+
+	consts    map[t.QID]*a.Const
+	funcs     map[t.QQID]*a.Func
+	statusMap map[t.QID]string
+	structMap map[t.QID]*a.Struct
+
+	// suspendible is the set of coroutines that can suspend, directly or
+	// indirectly, as per findSuspendible.
+	suspendible map[t.QQID]bool
+
+	// helpers is the set of helper functions, such as "u32Min", that the
+	// generated code uses. They are written after the rest of the package.
+	helpers map[string]bool
+
+	currFunk funk
+}
+
+// funk is the state for the function currently being generated.
+type funk struct {
+	astFunc    *a.Func
+	loopLabels map[a.Loop]string
+}
+
+func (g *gen) forEachTopLevelDecl(kind a.Kind, f func(n *a.Node) error) error {
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != kind {
+				continue
+			}
+			if err := f(tld); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (g *gen) generate(b *buffer) error {
+	if err := g.forEachTopLevelDecl(a.KConst, func(n *a.Node) error {
+		g.consts[n.AsConst().QID()] = n.AsConst()
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := g.forEachTopLevelDecl(a.KFunc, func(n *a.Node) error {
+		g.funcs[n.AsFunc().QQID()] = n.AsFunc()
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := g.forEachTopLevelDecl(a.KStruct, func(n *a.Node) error {
+		g.structMap[n.AsStruct().QID()] = n.AsStruct()
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, z := range builtin.Statuses {
+		id, err := g.tm.Insert(z)
+		if err != nil {
+			return err
+		}
+		msg, _ := t.Unescape(z)
+		g.statusMap[t.QID{t.IDBase, id}] = "Base" + statusGoName(msg, true)
+	}
+	if err := g.forEachTopLevelDecl(a.KStatus, func(n *a.Node) error {
+		n0 := n.AsStatus()
+		msg, _ := t.Unescape(n0.QID()[1].Str(g.tm))
+		g.statusMap[n0.QID()] = statusGoName(msg, n0.Public())
+		return nil
+	}); err != nil {
+		return err
+	}
+	g.findSuspendible()
+
+	b.writes("// Code generated by \"wuffs-go gen\"; DO NOT EDIT.\n\n")
+	b.printf("// Package %s is the Wuffs %s package, transpiled to Go.\n", g.pkgName, g.pkgName)
+	b.printf("package %s\n\n", g.pkgName)
+
+	if err := g.writeStatuses(b); err != nil {
+		return err
+	}
+	b.writes("// ---------------- Consts\n\n")
+	if err := g.forEachTopLevelDecl(a.KConst, func(n *a.Node) error {
+		return errorAt(n, g.writeConst(b, n.AsConst()))
+	}); err != nil {
+		return err
+	}
+	b.writes("// ---------------- Structs\n\n")
+	if err := g.forEachTopLevelDecl(a.KStruct, func(n *a.Node) error {
+		return errorAt(n, g.writeStruct(b, n.AsStruct()))
+	}); err != nil {
+		return err
+	}
+	b.writes("// ---------------- Functions\n\n")
+	if err := g.forEachTopLevelDecl(a.KFunc, func(n *a.Node) error {
+		return errorAt(n, g.writeFunc(b, n.AsFunc()))
+	}); err != nil {
+		return err
+	}
+	return g.writeBase(b)
+}
+
+func (g *gen) writeStatuses(b *buffer) error {
+	if g.forEachTopLevelDecl(a.KStatus, func(n *a.Node) error { return errFound }) == nil {
+		return nil
+	}
+	b.writes("// ---------------- Status Codes\n\n")
+	b.writes("const (\n")
+	if err := g.forEachTopLevelDecl(a.KStatus, func(n *a.Node) error {
+		n0 := n.AsStatus()
+		msg, _ := t.Unescape(n0.QID()[1].Str(g.tm))
+		if msg == "" {
+			return errorAt(n, fmt.Errorf("invalid status %q", msg))
+		}
+		b.printf("%s = Status(%q)\n", g.statusMap[n0.QID()], msg[:1]+g.pkgName+": "+msg[1:])
+		return nil
+	}); err != nil {
+		return err
+	}
+	b.writes(")\n\n")
+	return nil
+}
+
+func (g *gen) writeConst(b *buffer, n *a.Const) error {
+	name := g.constName(n)
+	if cv := n.Value().ConstValue(); cv != nil {
+		if n.XType().IsBool() {
+			b.printf("const %s = %t\n\n", name, cv.Cmp(zero) != 0)
+			return nil
+		}
+		typ, err := g.goTypeName(n.XType())
+		if err != nil {
+			return err
+		}
+		b.printf("const %s %s = %v\n\n", name, typ, cv)
+		return nil
+	}
+	typ, err := g.goTypeName(n.XType())
+	if err != nil {
+		return err
+	}
+	b.printf("var %s = %s", name, typ)
+	if err := g.writeConstList(b, n.Value()); err != nil {
+		return err
+	}
+	b.writes("\n\n")
+	return nil
+}
+
+func (g *gen) writeConstList(b *buffer, n *a.Expr) error {
+	if args, ok := n.IsList(); ok {
+		b.writeb('{')
+		for i, o := range args {
+			if i&7 == 0 {
+				b.writeb('\n')
+			}
+			if err := g.writeConstList(b, o.AsExpr()); err != nil {
+				return err
+			}
+			b.writes(", ")
+		}
+		b.writes("\n}")
+	} else if cv := n.ConstValue(); cv != nil {
+		b.writes(cv.String())
+	} else {
+		return fmt.Errorf("invalid const value %q", n.Str(g.tm))
+	}
+	return nil
+}
+
+func (g *gen) writeStruct(b *buffer, n *a.Struct) error {
+	name := g.structName(n.QID())
+	if n.Public() {
+		b.printf("// %s is the Wuffs %s.%s struct. Its zero value is ready to use.\n",
+			name, g.pkgName, n.QID()[1].Str(g.tm))
+	}
+	b.printf("type %s struct {\n", name)
+	for _, o := range n.Fields() {
+		o := o.AsField()
+		typ, err := g.goTypeName(o.XType())
+		if err != nil {
+			return err
+		}
+		b.printf("%s%s %s\n", fPrefix, o.Name().Str(g.tm), typ)
+	}
+	b.writes("}\n\n")
+	return nil
+}
+
+// goTypeName returns the Go type for the Wuffs type n.
+func (g *gen) goTypeName(n *a.TypeExpr) (string, error) {
+	switch n.Decorator() {
+	case 0:
+		// No-op.
+	case t.IDArray:
+		inner, err := g.goTypeName(n.Inner())
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("[%v]%s", n.ArrayLength().ConstValue(), inner), nil
+	case t.IDSlice:
+		inner, err := g.goTypeName(n.Inner())
+		if err != nil {
+			return "", err
+		}
+		return "[]" + inner, nil
+	case t.IDNptr, t.IDPtr:
+		inner, err := g.goTypeName(n.Inner())
+		if err != nil {
+			return "", err
+		}
+		return "*" + inner, nil
+	default:
+		return "", fmt.Errorf("TODO: Go type for %q", n.Str(g.tm))
+	}
+
+	qid := n.QID()
+	if qid[0] == t.IDBase {
+		switch qid[1] {
+		case t.IDU8:
+			return "uint8", nil
+		case t.IDU16:
+			return "uint16", nil
+		case t.IDU32:
+			return "uint32", nil
+		case t.IDU64:
+			return "uint64", nil
+		case t.IDI8:
+			return "int8", nil
+		case t.IDI16:
+			return "int16", nil
+		case t.IDI32:
+			return "int32", nil
+		case t.IDI64:
+			return "int64", nil
+		case t.IDBool:
+			return "bool", nil
+		case t.IDStatus:
+			return "error", nil
+		case t.IDIOReader, t.IDIOWriter:
+			return "*IOBuffer", nil
+		}
+	} else if (qid[0] == 0) && (g.structMap[qid] != nil) {
+		return g.structName(qid), nil
+	}
+	return "", fmt.Errorf("TODO: Go type for %q", n.Str(g.tm))
+}
+
+func (g *gen) constName(n *a.Const) string {
+	if n.Public() {
+		return goName(n.QID()[1].Str(g.tm))
+	}
+	return cPrefix + n.QID()[1].Str(g.tm)
+}
+
+func (g *gen) structName(qid t.QID) string {
+	if s := g.structMap[qid]; (s != nil) && s.Public() {
+		return goName(qid[1].Str(g.tm))
+	}
+	return sPrefix + qid[1].Str(g.tm)
+}
+
+func (g *gen) funcName(f *a.Func) string {
+	if f.Public() {
+		return goName(f.FuncName().Str(g.tm))
+	}
+	return mPrefix + f.FuncName().Str(g.tm)
+}
+
+// goName converts a snake_case (or SCREAMING_SNAKE_CASE) Wuffs name, such as
+// "update_u32", to an exported Go name, such as "UpdateU32".
+func goName(s string) string {
+	return camelCase(strings.ToLower(s), true)
+}
+
+// statusGoName converts a status message, such as "#bad header", to a Go
+// name, such as "ErrorBadHeader" or (if not public) "errorBadHeader".
+func statusGoName(msg string, public bool) string {
+	category := "note"
+	if msg[0] == '$' {
+		category = "suspension"
+	} else if msg[0] == '#' {
+		category = "error"
+	}
+	if msg[0] == '$' || msg[0] == '#' || msg[0] == '@' {
+		msg = msg[1:]
+	}
+	return camelCase(category+" "+strings.ToLower(msg), public)
+}
+
+// camelCase joins the alphanumeric words of s, capitalizing all but (if not
+// upper) the first one.
+func camelCase(s string, upper bool) string {
+	words := strings.FieldsFunc(s, func(c rune) bool {
+		return !(('0' <= c && c <= '9') || ('a' <= c && c <= 'z'))
+	})
+	out := []byte(nil)
+	for i, w := range words {
+		if (i > 0) || upper {
+			w = strings.ToUpper(w[:1]) + w[1:]
+		}
+		out = append(out, w...)
+	}
+	return string(out)
+}
+
+// sortedHelpers returns the names of the helper functions that the generated
+// code uses.
+func (g *gen) sortedHelpers() []string {
+	names := make([]string, 0, len(g.helpers))
+	for name := range g.helpers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gogen
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/generate"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+// generateStd transpiles the std/pkgName Wuffs package to Go.
+func generateStd(tt *testing.T, pkgName string) ([]byte, error) {
+	filenames, err := filepath.Glob(filepath.Join("..", "..", "std", pkgName, "*.wuffs"))
+	if err != nil {
+		tt.Fatalf("Glob: %v", err)
+	} else if len(filenames) == 0 {
+		tt.Fatalf("no std/%s files", pkgName)
+	}
+	tm := &t.Map{}
+	files, err := generate.ParseFiles(tm, filenames, nil)
+	if err != nil {
+		tt.Fatalf("ParseFiles: %v", err)
+	}
+	if _, err := check.Check(tm, files, nil, nil); err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	return Generate(pkgName, tm, files)
+}
+
+// hashTests are Go tests, run against the generated Go code, that compare it
+// with the standard library's implementations. They hash random inputs, split
+// into random chunks to exercise the hashers' state between calls.
+var hashTests = map[string]string{
+	"adler32": `
+		func TestAgainstStdlib(tt *testing.T) {
+			testAgainstStdlib(tt, func(chunks [][]byte) (got uint32, want uint32) {
+				h, w := &Hasher{}, stdlib.New()
+				for _, c := range chunks {
+					got = h.UpdateU32(c)
+					w.Write(c)
+				}
+				return got, w.Sum32()
+			})
+		}
+	`,
+	"crc32": `
+		func TestAgainstStdlib(tt *testing.T) {
+			testAgainstStdlib(tt, func(chunks [][]byte) (got uint32, want uint32) {
+				h, w := &IeeeHasher{}, stdlib.NewIEEE()
+				for _, c := range chunks {
+					got = h.UpdateU32(c)
+					w.Write(c)
+				}
+				return got, w.Sum32()
+			})
+		}
+	`,
+}
+
+const hashTestsPrelude = `
+import (
+	"math/rand"
+	"testing"
+
+	stdlib "hash/%s"
+)
+
+func testAgainstStdlib(tt *testing.T, f func(chunks [][]byte) (got uint32, want uint32)) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		data := make([]byte, rng.Intn(10000))
+		rng.Read(data)
+		chunks := [][]byte(nil)
+		for rem := data; len(rem) > 0; {
+			n := 1 + rng.Intn(len(rem))
+			chunks = append(chunks, rem[:n])
+			rem = rem[n:]
+		}
+		if got, want := f(chunks); got != want {
+			tt.Fatalf("i=%d, len(data)=%d, len(chunks)=%d: got 0x%08X, want 0x%08X",
+				i, len(data), len(chunks), got, want)
+		}
+	}
+}
+`
+
+func TestHashesMatchStdlib(tt *testing.T) {
+	if testing.Short() {
+		tt.Skip("skipping test that runs the go tool in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		tt.Skip("skipping test: no go tool")
+	}
+
+	dir, err := ioutil.TempDir("", "gogen_test")
+	if err != nil {
+		tt.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module gogentest\n"), 0644); err != nil {
+		tt.Fatalf("WriteFile: %v", err)
+	}
+
+	for pkgName, test := range hashTests {
+		pkgDir := filepath.Join(dir, pkgName)
+		if err := os.Mkdir(pkgDir, 0755); err != nil {
+			tt.Fatalf("Mkdir: %v", err)
+		}
+		src, err := generateStd(tt, pkgName)
+		if err != nil {
+			tt.Fatalf("Generate: %v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(pkgDir, pkgName+".go"), src, 0644); err != nil {
+			tt.Fatalf("WriteFile: %v", err)
+		}
+		testSrc := "package " + pkgName + "\n" + strings.Replace(hashTestsPrelude, "%s", pkgName, 1) + test
+		if err := ioutil.WriteFile(filepath.Join(pkgDir, pkgName+"_test.go"), []byte(testSrc), 0644); err != nil {
+			tt.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	cmd := exec.Command(goTool, "test", "./...")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GO111MODULE=on")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		tt.Fatalf("go test: %v\n%s", err, out)
+	}
+}
+
+func TestUnsupportedIsAnError(tt *testing.T) {
+	// Packages with coroutines that can suspend are not supported yet.
+	if _, err := generateStd(tt, "deflate"); err == nil {
+		tt.Fatalf("Generate: got nil error, want a gogen: TODO error")
+	} else if !strings.Contains(err.Error(), "gogen: TODO") {
+		tt.Fatalf("Generate: got %q, want a gogen: TODO error", err)
+	}
+}
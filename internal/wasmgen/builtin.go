@@ -0,0 +1,281 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasmgen
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// writeBuiltinCall writes the built-in method call n. It returns
+// errNoSuchBuiltin if n is not a built-in method call.
+func (g *gen) writeBuiltinCall(n *a.Expr, sideEffectsOnly bool, depth uint32) error {
+	method := n.LHS().AsExpr()
+	recv := method.LHS().AsExpr()
+	recvTyp := recv.MType()
+
+	switch {
+	case recvTyp.IsArrayType() || recvTyp.IsSliceType():
+		return g.writeBuiltinSlice(recv, method.Ident(), n.Args(), sideEffectsOnly, depth)
+	case recvTyp.IsNumType():
+		return g.writeBuiltinNumType(recv, method.Ident(), n.Args(), depth)
+	case recvTyp.IsStatus():
+		return g.writeBuiltinStatus(recv, method.Ident(), depth)
+	case recvTyp.Decorator() == 0 && recvTyp.QID()[0] == t.IDBase:
+		return fmt.Errorf("TODO: built-in %s", n.Str(g.tm))
+	}
+	return errNoSuchBuiltin
+}
+
+// arrayOrSliceLocals is like sliceLocals, but n may also be an array.
+func (g *gen) arrayOrSliceLocals(n *a.Expr, depth uint32) (ptr int64, length int64, err error) {
+	if typ := n.MType(); typ.IsArrayType() {
+		offset, err := g.writeAddr(n, depth)
+		if err != nil {
+			return 0, 0, err
+		}
+		if offset != 0 {
+			g.emitI32Const(int64(offset))
+			g.emit(opI32Add, 0)
+		}
+		ptr, length = g.newTemp(i32), g.newTemp(i32)
+		g.emit(opLocalSet, ptr)
+		g.emitI32Const(typ.ArrayLength().ConstValue().Int64())
+		g.emit(opLocalSet, length)
+		return ptr, length, nil
+	}
+	return g.sliceLocals(n, depth)
+}
+
+func (g *gen) writeBuiltinSlice(recv *a.Expr, method t.ID, args []*a.Node, sideEffectsOnly bool, depth uint32) error {
+	switch method {
+	case t.IDLength:
+		if typ := recv.MType(); typ.IsArrayType() {
+			g.emit(opI64Const, typ.ArrayLength().ConstValue().Int64())
+			return nil
+		}
+		_, length, err := g.sliceLocals(recv, depth)
+		if err != nil {
+			return err
+		}
+		g.emit(opLocalGet, length)
+		g.emit(opI64ExtendI32U, 0)
+		return nil
+
+	case t.IDCopyFromSlice:
+		// n = min(dst.length, src.length), then copy n elements.
+		size, _, err := g.sizeAlign(recv.MType().Inner())
+		if err != nil {
+			return err
+		}
+		dstPtr, dstLen, err := g.arrayOrSliceLocals(recv, depth)
+		if err != nil {
+			return err
+		}
+		srcPtr, srcLen, err := g.arrayOrSliceLocals(args[0].AsArg().Value(), depth)
+		if err != nil {
+			return err
+		}
+		count := g.newTemp(i32)
+		g.emit(opLocalGet, dstLen)
+		g.emit(opLocalGet, srcLen)
+		g.emit(opLocalGet, dstLen)
+		g.emit(opLocalGet, srcLen)
+		g.emit(opI32LtU, 0)
+		g.emit(opSelect, 0)
+		g.emit(opLocalSet, count)
+
+		g.emit(opLocalGet, dstPtr)
+		g.emit(opLocalGet, srcPtr)
+		g.emit(opLocalGet, count)
+		if size != 1 {
+			g.emitI32Const(int64(size))
+			g.emit(opI32Mul, 0)
+		}
+		g.emit(opMemoryCopy, 0)
+		if !sideEffectsOnly {
+			g.emit(opLocalGet, count)
+			g.emit(opI64ExtendI32U, 0)
+		}
+		return nil
+	}
+	return fmt.Errorf("TODO: built-in %s.%s", recv.Str(g.tm), method.Str(g.tm))
+}
+
+func (g *gen) writeBuiltinNumType(recv *a.Expr, method t.ID, args []*a.Node, depth uint32) error {
+	typ := recv.MType()
+	vt, err := g.wasmType(typ)
+	if err != nil {
+		return err
+	}
+	and, shl, shrU, sub := opI32And, opI32Shl, opI32ShrU, opI32Sub
+	if vt == i64 {
+		and, shl, shrU, sub = opI64And, opI64Shl, opI64ShrU, opI64Sub
+	}
+	bits := int64(numBits(typ))
+
+	switch method {
+	case t.IDLowBits:
+		// "x.low_bits(n: n)" is "x & ((1 << n) - 1)". WebAssembly shifts
+		// are modulo the bit width, so a constant n is handled separately.
+		if err := g.writeExpr(recv, depth); err != nil {
+			return err
+		}
+		arg := args[0].AsArg().Value()
+		if cv := arg.ConstValue(); cv != nil {
+			mask := int64(-1)
+			if n := cv.Int64(); n < 64 {
+				mask = (int64(1) << uint(n)) - 1
+			}
+			g.emitConst(vt, mask)
+		} else {
+			g.emitConst(vt, 1)
+			if err := g.writeExprConverted(arg, typ, depth); err != nil {
+				return err
+			}
+			g.emit(shl, 0)
+			g.emitConst(vt, 1)
+			g.emit(sub, 0)
+		}
+		g.emit(and, 0)
+		return nil
+
+	case t.IDHighBits:
+		// "x.high_bits(n: n)" is "x >> (bitWidth - n)".
+		arg := args[0].AsArg().Value()
+		if cv := arg.ConstValue(); (cv != nil) && (cv.Sign() == 0) {
+			g.emitConst(vt, 0)
+			return nil
+		}
+		if err := g.writeExpr(recv, depth); err != nil {
+			return err
+		}
+		g.emitConst(vt, bits)
+		if err := g.writeExprConverted(arg, typ, depth); err != nil {
+			return err
+		}
+		g.emit(sub, 0)
+		g.emit(shrU, 0)
+		return nil
+
+	case t.IDMax, t.IDMin:
+		// select(x, y, x < y) for min, or x > y for max.
+		cmp := t.IDXBinaryLessThan
+		if method == t.IDMax {
+			cmp = t.IDXBinaryGreaterThan
+		}
+		cmpOp, err := g.binaryOpcode(cmp, typ)
+		if err != nil {
+			return err
+		}
+		x, y := g.newTemp(vt), g.newTemp(vt)
+		if err := g.writeExpr(recv, depth); err != nil {
+			return err
+		}
+		g.emit(opLocalSet, x)
+		if err := g.writeExprConverted(args[0].AsArg().Value(), typ, depth); err != nil {
+			return err
+		}
+		g.emit(opLocalSet, y)
+		g.emit(opLocalGet, x)
+		g.emit(opLocalGet, y)
+		g.emit(opLocalGet, x)
+		g.emit(opLocalGet, y)
+		g.emit(cmpOp, 0)
+		g.emit(opSelect, 0)
+		return nil
+
+	case t.IDFloorLog2:
+		// "x.floor_log2()" is "(wasmBits - 1) - clz(x)", as a u32. The u8
+		// and u16 types are zero-extended to i32, so their leading zeroes
+		// are counted as an i32's. The bounds checker has proved that x is
+		// non-zero.
+		if vt == i64 {
+			g.emitConst(i64, 63)
+		} else {
+			g.emitConst(i32, 31)
+		}
+		if err := g.writeExpr(recv, depth); err != nil {
+			return err
+		}
+		if vt == i64 {
+			g.emit(opI64Clz, 0)
+			g.emit(opI64Sub, 0)
+			g.emit(opI32WrapI64, 0)
+		} else {
+			g.emit(opI32Clz, 0)
+			g.emit(opI32Sub, 0)
+		}
+		return nil
+
+	case t.IDCeilDivPow2:
+		// "x.ceil_div_pow2(n: n)" is "(x >> n) + ((x & ((1 << n) - 1)) != 0)".
+		x, n := g.newTemp(vt), g.newTemp(vt)
+		if err := g.writeExpr(recv, depth); err != nil {
+			return err
+		}
+		g.emit(opLocalTee, x)
+		if err := g.writeExprConverted(args[0].AsArg().Value(), typ, depth); err != nil {
+			return err
+		}
+		g.emit(opLocalTee, n)
+		g.emit(shrU, 0)
+		g.emit(opLocalGet, x)
+		g.emitConst(vt, 1)
+		g.emit(opLocalGet, n)
+		g.emit(shl, 0)
+		g.emitConst(vt, 1)
+		g.emit(sub, 0)
+		g.emit(and, 0)
+		if vt == i64 {
+			g.emit(opI64Eqz, 0)
+			g.emit(opI32Eqz, 0)
+			g.emit(opI64ExtendI32U, 0)
+			g.emit(opI64Add, 0)
+		} else {
+			g.emit(opI32Eqz, 0)
+			g.emit(opI32Eqz, 0)
+			g.emit(opI32Add, 0)
+		}
+		return nil
+	}
+	return fmt.Errorf("TODO: built-in %s.%s", recv.Str(g.tm), method.Str(g.tm))
+}
+
+func (g *gen) writeBuiltinStatus(recv *a.Expr, method t.ID, depth uint32) error {
+	if err := g.writeExpr(recv, depth); err != nil {
+		return err
+	}
+	switch method {
+	case t.IDIsOK:
+		g.emit(opI32Eqz, 0)
+		return nil
+	case t.IDIsError:
+		// A status' first byte is its category. Address zero (the ok status)
+		// always holds a zero byte.
+		g.emit(opI32Load8U, 0)
+		g.emitI32Const('#')
+		g.emit(opI32Eq, 0)
+		return nil
+	case t.IDIsSuspension:
+		g.emit(opI32Load8U, 0)
+		g.emitI32Const('$')
+		g.emit(opI32Eq, 0)
+		return nil
+	}
+	return fmt.Errorf("TODO: built-in %s.%s", recv.Str(g.tm), method.Str(g.tm))
+}
@@ -0,0 +1,810 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasmgen
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// An integer type narrower than 32 bits is held in an i32, zero-extended (if
+// unsigned) or sign-extended (if signed). The Wuffs checker proves that most
+// arithmetic does not overflow, so only the "~mod" operators and conversions
+// need to re-normalize the wider i32 result.
+
+// writeExpr pushes the value of the scalar (not an array, slice or struct)
+// expression n.
+func (g *gen) writeExpr(n *a.Expr, depth uint32) error {
+	return g.writeExpr1(n, false, depth)
+}
+
+// writeExprSideEffectsOnly is like writeExpr but for an expression statement,
+// whose value (if any) is discarded.
+func (g *gen) writeExprSideEffectsOnly(n *a.Expr, depth uint32) error {
+	return g.writeExpr1(n, true, depth)
+}
+
+func (g *gen) writeExpr1(n *a.Expr, sideEffectsOnly bool, depth uint32) error {
+	if depth > a.MaxExprDepth {
+		return fmt.Errorf("expression recursion depth too large")
+	}
+	depth++
+
+	if cv := n.ConstValue(); cv != nil {
+		typ := n.MType()
+		if typ.IsIdeal() {
+			return fmt.Errorf("wasmgen: internal error: untyped constant %s", n.Str(g.tm))
+		} else if typ.IsStatus() {
+			g.emitI32Const(0)
+			return nil
+		} else if typ.IsBool() {
+			if (cv.Cmp(zero) != 0) && (cv.Cmp(one) != 0) {
+				return fmt.Errorf("%v has type bool but constant value %v is neither 0 or 1", n.Str(g.tm), cv)
+			}
+			g.emitI32Const(cv.Int64())
+			return nil
+		}
+		vt, err := g.wasmType(typ)
+		if err != nil {
+			return err
+		}
+		g.emitConst(vt, constInt64(cv))
+		return nil
+	}
+
+	switch op := n.Operator(); {
+	case op.IsXUnaryOp():
+		return g.writeExprUnaryOp(n, depth)
+	case op.IsXBinaryOp():
+		return g.writeExprBinaryOp(n, depth)
+	case op.IsXAssociativeOp():
+		return g.writeExprAssociativeOp(n, depth)
+	}
+	return g.writeExprOther(n, sideEffectsOnly, depth)
+}
+
+func (g *gen) writeExprOther(n *a.Expr, sideEffectsOnly bool, depth uint32) error {
+	switch n.Operator() {
+	case 0:
+		if ident := n.Ident(); ident == t.IDThis {
+			g.emit(opLocalGet, 0)
+
+		} else if ident == t.IDCoroutineResumed {
+			// Only non-suspendible coroutines are generated, and they are
+			// never resumed.
+			g.emitI32Const(0)
+
+		} else if ident.IsDQStrLiteral(g.tm) {
+			addr, err := g.statusAddr(t.QID{0, ident})
+			if err != nil {
+				return err
+			}
+			g.emitI32Const(addr)
+
+		} else if n.GlobalIdent() {
+			return fmt.Errorf("TODO: global identifier %s", n.Str(g.tm))
+
+		} else if v := g.currFunk.vars[ident]; len(v) == 1 {
+			g.emit(opLocalGet, v[0])
+
+		} else {
+			return fmt.Errorf("unrecognized identifier %s", n.Str(g.tm))
+		}
+		return nil
+
+	case t.IDOpenParen:
+		// n is a function call.
+		if err := g.writeBuiltinCall(n, sideEffectsOnly, depth); err != errNoSuchBuiltin {
+			return err
+		}
+		return g.writeExprUserDefinedCall(n, sideEffectsOnly, depth)
+
+	case t.IDOpenBracket:
+		// n is an index.
+		return g.writeLoad(n, depth)
+
+	case t.IDDot:
+		lhs := n.LHS().AsExpr()
+		if lhs.Ident() == t.IDArgs {
+			if v := g.currFunk.args[n.Ident()]; len(v) == 1 {
+				g.emit(opLocalGet, v[0])
+				return nil
+			}
+			return fmt.Errorf("unrecognized argument %s", n.Str(g.tm))
+		} else if (lhs.Operator() == 0) && n.Ident().IsDQStrLiteral(g.tm) {
+			addr, err := g.statusAddr(t.QID{lhs.Ident(), n.Ident()})
+			if err != nil {
+				return err
+			}
+			g.emitI32Const(addr)
+			return nil
+		}
+		return g.writeLoad(n, depth)
+	}
+	return fmt.Errorf("unrecognized token (0x%X) for writeExprOther", n.Operator())
+}
+
+// writeExprConverted pushes n's value, converted to typ. The checker
+// implicitly widens mixed-type arguments and constants are untyped, but
+// WebAssembly needs the explicit conversion.
+func (g *gen) writeExprConverted(n *a.Expr, typ *a.TypeExpr, depth uint32) error {
+	if cv := n.ConstValue(); (cv != nil) && (numBits(typ) > 0) {
+		vt, err := g.wasmType(typ)
+		if err != nil {
+			return err
+		}
+		g.emitConst(vt, constInt64(cv))
+		return nil
+	}
+	if err := g.writeExpr(n, depth); err != nil {
+		return err
+	}
+	if nTyp := n.MType(); (numBits(typ) > 0) && (numBits(nTyp) > 0) && !nTyp.EqIgnoringRefinements(typ) {
+		g.writeConversion(nTyp, typ)
+	}
+	return nil
+}
+
+// writeConversion converts the integer on top of the stack from type from to
+// type to.
+func (g *gen) writeConversion(from *a.TypeExpr, to *a.TypeExpr) {
+	fromBits, toBits := numBits(from), numBits(to)
+	fromSigned, toSigned := from.IsSignedInteger(), to.IsSignedInteger()
+	if (fromBits <= 32) && (toBits == 64) {
+		if fromSigned {
+			g.emit(opI64ExtendI32S, 0)
+		} else {
+			g.emit(opI64ExtendI32U, 0)
+		}
+	} else if (fromBits == 64) && (toBits <= 32) {
+		g.emit(opI32WrapI64, 0)
+	}
+
+	// Widening to a type that can hold every value of the old type is a no-op.
+	if (fromBits < toBits) && (toSigned || !fromSigned) {
+		return
+	} else if (fromBits == toBits) && (toSigned == fromSigned) {
+		return
+	}
+	g.writeNormalization(to)
+}
+
+// writeNormalization re-normalizes the i32 on top of the stack to the integer
+// type typ, if it is narrower than 32 bits.
+func (g *gen) writeNormalization(typ *a.TypeExpr) {
+	bits := numBits(typ)
+	if (bits == 0) || (bits >= 32) {
+		return
+	}
+	if typ.IsSignedInteger() {
+		g.emitI32Const(int64(32 - bits))
+		g.emit(opI32Shl, 0)
+		g.emitI32Const(int64(32 - bits))
+		g.emit(opI32ShrS, 0)
+	} else {
+		g.emitI32Const((1 << bits) - 1)
+		g.emit(opI32And, 0)
+	}
+}
+
+func (g *gen) writeExprUnaryOp(n *a.Expr, depth uint32) error {
+	rhs := n.RHS().AsExpr()
+	switch n.Operator() {
+	case t.IDXUnaryNot:
+		if err := g.writeExpr(rhs, depth); err != nil {
+			return err
+		}
+		g.emit(opI32Eqz, 0)
+		return nil
+
+	case t.IDXUnaryPlus:
+		return g.writeExprConverted(rhs, n.MType(), depth)
+
+	case t.IDXUnaryMinus:
+		vt, err := g.wasmType(n.MType())
+		if err != nil {
+			return err
+		}
+		g.emitConst(vt, 0)
+		if err := g.writeExprConverted(rhs, n.MType(), depth); err != nil {
+			return err
+		}
+		if vt == i64 {
+			g.emit(opI64Sub, 0)
+		} else {
+			g.emit(opI32Sub, 0)
+		}
+		return nil
+	}
+	return fmt.Errorf("unrecognized operator %q", n.Operator().AmbiguousForm().Str(g.tm))
+}
+
+func (g *gen) writeExprBinaryOp(n *a.Expr, depth uint32) error {
+	op := n.Operator()
+	lhs, rhs := n.LHS().AsExpr(), n.RHS().AsExpr()
+	switch op {
+	case t.IDXBinaryAs:
+		if err := g.writeExpr(lhs, depth); err != nil {
+			return err
+		}
+		if rTyp := n.RHS().AsTypeExpr(); !lhs.MType().EqIgnoringRefinements(rTyp) {
+			g.writeConversion(lhs.MType(), rTyp)
+		}
+		return nil
+
+	case t.IDXBinaryAnd, t.IDXBinaryOr:
+		return g.writeShortCircuit(op == t.IDXBinaryAnd, []*a.Expr{lhs, rhs}, depth)
+
+	case t.IDXBinaryTildeSatPlus, t.IDXBinaryTildeSatMinus:
+		return g.writeSatOp(lhs, rhs, n.MType(), op == t.IDXBinaryTildeSatPlus, depth)
+
+	case t.IDXBinaryNotEq, t.IDXBinaryLessThan, t.IDXBinaryLessEq,
+		t.IDXBinaryEqEq, t.IDXBinaryGreaterEq, t.IDXBinaryGreaterThan:
+		// The operands' type is the non-constant one's.
+		typ := lhs.MType()
+		if typ.IsIdeal() {
+			typ = rhs.MType()
+		}
+		return g.writeBinaryOp(op, lhs, rhs, typ, depth)
+	}
+	return g.writeBinaryOp(op, lhs, rhs, n.MType(), depth)
+}
+
+// writeBinaryOp pushes "lhs op rhs", with both operands converted to typ.
+func (g *gen) writeBinaryOp(op t.ID, lhs *a.Expr, rhs *a.Expr, typ *a.TypeExpr, depth uint32) error {
+	wop, err := g.binaryOpcode(op, typ)
+	if err != nil {
+		return err
+	}
+	if err := g.writeExprConverted(lhs, typ, depth); err != nil {
+		return err
+	}
+	if err := g.writeExprConverted(rhs, typ, depth); err != nil {
+		return err
+	}
+	g.emit(wop, 0)
+	switch op {
+	case t.IDXBinaryTildeModPlus, t.IDXBinaryTildeModMinus,
+		t.IDXBinaryTildeModStar, t.IDXBinaryTildeModShiftL:
+		g.writeNormalization(typ)
+	}
+	return nil
+}
+
+// binaryOpcode returns the WebAssembly instruction for the binary operator op
+// on operands of type typ.
+func (g *gen) binaryOpcode(op t.ID, typ *a.TypeExpr) (opcode, error) {
+	vt, err := g.wasmType(typ)
+	if err != nil {
+		return 0, err
+	}
+	z := binaryOpcodes[op]
+	if z[0] == 0 {
+		return 0, fmt.Errorf("unrecognized operator %q", op.AmbiguousForm().Str(g.tm))
+	}
+	i := 0
+	if typ.IsSignedInteger() {
+		i = 1
+	}
+	if vt == i64 {
+		i += 2
+	}
+	return z[i], nil
+}
+
+// binaryOpcodes are the i32 unsigned, i32 signed, i64 unsigned and i64 signed
+// instructions for each binary operator. Booleans and statuses are unsigned
+// i32s.
+var binaryOpcodes = map[t.ID][4]opcode{
+	t.IDXBinaryPlus:           {opI32Add, opI32Add, opI64Add, opI64Add},
+	t.IDXBinaryMinus:          {opI32Sub, opI32Sub, opI64Sub, opI64Sub},
+	t.IDXBinaryStar:           {opI32Mul, opI32Mul, opI64Mul, opI64Mul},
+	t.IDXBinarySlash:          {opI32DivU, opI32DivS, opI64DivU, opI64DivS},
+	t.IDXBinaryShiftL:         {opI32Shl, opI32Shl, opI64Shl, opI64Shl},
+	t.IDXBinaryShiftR:         {opI32ShrU, opI32ShrS, opI64ShrU, opI64ShrS},
+	t.IDXBinaryAmp:            {opI32And, opI32And, opI64And, opI64And},
+	t.IDXBinaryPipe:           {opI32Or, opI32Or, opI64Or, opI64Or},
+	t.IDXBinaryHat:            {opI32Xor, opI32Xor, opI64Xor, opI64Xor},
+	t.IDXBinaryPercent:        {opI32RemU, opI32RemS, opI64RemU, opI64RemS},
+	t.IDXBinaryTildeModPlus:   {opI32Add, opI32Add, opI64Add, opI64Add},
+	t.IDXBinaryTildeModMinus:  {opI32Sub, opI32Sub, opI64Sub, opI64Sub},
+	t.IDXBinaryTildeModStar:   {opI32Mul, opI32Mul, opI64Mul, opI64Mul},
+	t.IDXBinaryTildeModShiftL: {opI32Shl, opI32Shl, opI64Shl, opI64Shl},
+	t.IDXBinaryTildeModShiftR: {opI32ShrU, opI32ShrS, opI64ShrU, opI64ShrS},
+	t.IDXBinaryNotEq:          {opI32Ne, opI32Ne, opI64Ne, opI64Ne},
+	t.IDXBinaryLessThan:       {opI32LtU, opI32LtS, opI64LtU, opI64LtS},
+	t.IDXBinaryLessEq:         {opI32LeU, opI32LeS, opI64LeU, opI64LeS},
+	t.IDXBinaryEqEq:           {opI32Eq, opI32Eq, opI64Eq, opI64Eq},
+	t.IDXBinaryGreaterEq:      {opI32GeU, opI32GeS, opI64GeU, opI64GeS},
+	t.IDXBinaryGreaterThan:    {opI32GtU, opI32GtS, opI64GtU, opI64GtS},
+
+	t.IDXAssociativePlus: {opI32Add, opI32Add, opI64Add, opI64Add},
+	t.IDXAssociativeStar: {opI32Mul, opI32Mul, opI64Mul, opI64Mul},
+	t.IDXAssociativeAmp:  {opI32And, opI32And, opI64And, opI64And},
+	t.IDXAssociativePipe: {opI32Or, opI32Or, opI64Or, opI64Or},
+	t.IDXAssociativeHat:  {opI32Xor, opI32Xor, opI64Xor, opI64Xor},
+}
+
+// writeSatOp pushes "lhs ~sat+ rhs" (if plus) or "lhs ~sat- rhs", for the
+// unsigned type typ.
+func (g *gen) writeSatOp(lhs *a.Expr, rhs *a.Expr, typ *a.TypeExpr, plus bool, depth uint32) error {
+	bits := numBits(typ)
+	if (bits == 0) || typ.IsSignedInteger() {
+		return fmt.Errorf("TODO: saturating arithmetic for %q", typ.Str(g.tm))
+	}
+	vt, err := g.wasmType(typ)
+	if err != nil {
+		return err
+	}
+	add, sub, ltU, geU := opI32Add, opI32Sub, opI32LtU, opI32GeU
+	if vt == i64 {
+		add, sub, ltU, geU = opI64Add, opI64Sub, opI64LtU, opI64GeU
+	}
+
+	x, y := g.newTemp(vt), g.newTemp(vt)
+	if err := g.writeExprConverted(lhs, typ, depth); err != nil {
+		return err
+	}
+	g.emit(opLocalSet, x)
+	if err := g.writeExprConverted(rhs, typ, depth); err != nil {
+		return err
+	}
+	g.emit(opLocalSet, y)
+
+	if !plus {
+		// select(x - y, 0, x >= y).
+		g.emit(opLocalGet, x)
+		g.emit(opLocalGet, y)
+		g.emit(sub, 0)
+		g.emitConst(vt, 0)
+		g.emit(opLocalGet, x)
+		g.emit(opLocalGet, y)
+		g.emit(geU, 0)
+		g.emit(opSelect, 0)
+		return nil
+	}
+
+	// select(max, x + y, (x + y) overflowed). A type narrower than 32 bits
+	// overflows past max. A wider one wraps around, to less than x.
+	max := int64(-1)
+	if bits < 32 {
+		max = (1 << bits) - 1
+	}
+	z := g.newTemp(vt)
+	g.emitConst(vt, max)
+	g.emit(opLocalGet, x)
+	g.emit(opLocalGet, y)
+	g.emit(add, 0)
+	g.emit(opLocalTee, z)
+	g.emit(opLocalGet, z)
+	if bits < 32 {
+		g.emitI32Const(max)
+		g.emit(opI32GtU, 0)
+	} else {
+		g.emit(opLocalGet, x)
+		g.emit(ltU, 0)
+	}
+	// The stack is now max, z, overflowed.
+	g.emit(opSelect, 0)
+	return nil
+}
+
+// writeShortCircuit pushes the "and" (if and) or "or" of the boolean
+// expressions args, evaluating them left to right and no further than needed.
+func (g *gen) writeShortCircuit(and bool, args []*a.Expr, depth uint32) error {
+	if err := g.writeExpr(args[0], depth); err != nil {
+		return err
+	}
+	for _, o := range args[1:] {
+		g.emit(opIf, int64(i32))
+		if and {
+			if err := g.writeExpr(o, depth); err != nil {
+				return err
+			}
+			g.emit(opElse, 0)
+			g.emitI32Const(0)
+		} else {
+			g.emitI32Const(1)
+			g.emit(opElse, 0)
+			if err := g.writeExpr(o, depth); err != nil {
+				return err
+			}
+		}
+		g.emit(opEnd, 0)
+	}
+	return nil
+}
+
+func (g *gen) writeExprAssociativeOp(n *a.Expr, depth uint32) error {
+	op := n.Operator()
+	args := make([]*a.Expr, len(n.Args()))
+	for i, o := range n.Args() {
+		args[i] = o.AsExpr()
+	}
+	if (op == t.IDXAssociativeAnd) || (op == t.IDXAssociativeOr) {
+		return g.writeShortCircuit(op == t.IDXAssociativeAnd, args, depth)
+	}
+
+	wop, err := g.binaryOpcode(op, n.MType())
+	if err != nil {
+		return err
+	}
+	for i, o := range args {
+		if err := g.writeExprConverted(o, n.MType(), depth); err != nil {
+			return err
+		}
+		if i > 0 {
+			g.emit(wop, 0)
+		}
+	}
+	return nil
+}
+
+// lvalue is where a scalar value is stored: either a local variable or, if
+// isMemory, an address (already pushed) plus an offset.
+type lvalue struct {
+	local    int64
+	isMemory bool
+	offset   uint32
+	typ      *a.TypeExpr
+}
+
+// writeLValue returns where n is stored, pushing its address if it is in
+// memory.
+func (g *gen) writeLValue(n *a.Expr, depth uint32) (lvalue, error) {
+	switch n.Operator() {
+	case 0:
+		if v := g.currFunk.vars[n.Ident()]; (len(v) == 1) && !n.GlobalIdent() {
+			return lvalue{local: v[0], typ: n.MType()}, nil
+		}
+	case t.IDDot:
+		if n.LHS().AsExpr().Ident() == t.IDArgs {
+			if v := g.currFunk.args[n.Ident()]; len(v) == 1 {
+				return lvalue{local: v[0], typ: n.MType()}, nil
+			}
+			break
+		}
+		offset, err := g.writeFieldAddr(n, depth)
+		if err != nil {
+			return lvalue{}, err
+		}
+		return lvalue{isMemory: true, offset: offset, typ: n.MType()}, nil
+	case t.IDOpenBracket:
+		offset, err := g.writeElementAddr(n, depth)
+		if err != nil {
+			return lvalue{}, err
+		}
+		return lvalue{isMemory: true, offset: offset, typ: n.MType()}, nil
+	}
+	return lvalue{}, fmt.Errorf("TODO: assign to %s", n.Str(g.tm))
+}
+
+// writeStore stores the value on top of the stack to lv.
+func (g *gen) writeStore(lv lvalue) error {
+	if !lv.isMemory {
+		g.emit(opLocalSet, lv.local)
+		return nil
+	}
+	size, _, err := g.sizeAlign(lv.typ)
+	if err != nil {
+		return err
+	}
+	switch size {
+	case 1:
+		g.emit(opI32Store8, int64(lv.offset))
+	case 2:
+		g.emit(opI32Store16, int64(lv.offset))
+	case 4:
+		g.emit(opI32Store, int64(lv.offset))
+	case 8:
+		g.emit(opI64Store, int64(lv.offset))
+	default:
+		return fmt.Errorf("TODO: store a %q", lv.typ.Str(g.tm))
+	}
+	return nil
+}
+
+// writeLoad pushes the value of the struct field or array or slice element n.
+func (g *gen) writeLoad(n *a.Expr, depth uint32) error {
+	offset := uint32(0)
+	err := error(nil)
+	if n.Operator() == t.IDDot {
+		offset, err = g.writeFieldAddr(n, depth)
+	} else {
+		offset, err = g.writeElementAddr(n, depth)
+	}
+	if err != nil {
+		return err
+	}
+
+	typ := n.MType()
+	op := opcode(0)
+	switch numBits(typ) {
+	case 8:
+		op = opI32Load8U
+		if typ.IsSignedInteger() {
+			op = opI32Load8S
+		}
+	case 16:
+		op = opI32Load16U
+		if typ.IsSignedInteger() {
+			op = opI32Load16S
+		}
+	case 32:
+		op = opI32Load
+	case 64:
+		op = opI64Load
+	default:
+		if typ.IsBool() {
+			op = opI32Load8U
+		} else if typ.IsStatus() || typ.IsPointerType() {
+			op = opI32Load
+		} else {
+			return fmt.Errorf("TODO: load a %q", typ.Str(g.tm))
+		}
+	}
+	g.emit(op, int64(offset))
+	return nil
+}
+
+// writeAddr pushes the address of the struct or array n, or of the struct
+// that the pointer n points to. It returns a constant offset, not yet added.
+func (g *gen) writeAddr(n *a.Expr, depth uint32) (offset uint32, err error) {
+	switch n.Operator() {
+	case 0:
+		if n.Ident() == t.IDThis {
+			g.emit(opLocalGet, 0)
+			return 0, nil
+		} else if n.GlobalIdent() {
+			addr, err := g.constAddr(t.QID{0, n.Ident()})
+			if err != nil {
+				return 0, err
+			}
+			g.emitI32Const(addr)
+			return 0, nil
+		}
+	case t.IDDot:
+		return g.writeFieldAddr(n, depth)
+	case t.IDOpenBracket:
+		return g.writeElementAddr(n, depth)
+	}
+	return 0, fmt.Errorf("TODO: address of %s", n.Str(g.tm))
+}
+
+// writeFieldAddr is like writeAddr for the address of the struct field n.
+func (g *gen) writeFieldAddr(n *a.Expr, depth uint32) (offset uint32, err error) {
+	lhs := n.LHS().AsExpr()
+	typ := lhs.MType()
+	if typ.IsPointerType() {
+		typ = typ.Pointee()
+	}
+	if typ.Decorator() != 0 {
+		return 0, fmt.Errorf("TODO: field of %q", typ.Str(g.tm))
+	}
+	l, err := g.structLayout(typ.QID())
+	if err != nil {
+		return 0, err
+	}
+	fieldOffset, ok := l.fields[n.Ident()]
+	if !ok {
+		return 0, fmt.Errorf("unrecognized field %s", n.Str(g.tm))
+	}
+	offset, err = g.writeAddr(lhs, depth)
+	if err != nil {
+		return 0, err
+	}
+	return offset + fieldOffset, nil
+}
+
+// writeElementAddr is like writeAddr for the address of the array or slice
+// element n.
+func (g *gen) writeElementAddr(n *a.Expr, depth uint32) (offset uint32, err error) {
+	lhs, index := n.LHS().AsExpr(), n.RHS().AsExpr()
+	size, _, err := g.sizeAlign(n.MType())
+	if err != nil {
+		return 0, err
+	}
+	if typ := lhs.MType(); typ.IsSliceType() {
+		ptr, _, err := g.sliceLocals(lhs, depth)
+		if err != nil {
+			return 0, err
+		}
+		g.emit(opLocalGet, ptr)
+	} else if typ.IsArrayType() {
+		offset, err = g.writeAddr(lhs, depth)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		return 0, fmt.Errorf("TODO: index %s", n.Str(g.tm))
+	}
+
+	if cv := index.ConstValue(); cv != nil {
+		return offset + (uint32(cv.Int64()) * size), nil
+	}
+	if err := g.writeIndex(index, depth); err != nil {
+		return 0, err
+	}
+	if size != 1 {
+		g.emitI32Const(int64(size))
+		g.emit(opI32Mul, 0)
+	}
+	g.emit(opI32Add, 0)
+	return offset, nil
+}
+
+// writeIndex pushes the array or slice index (or length) n as an i32.
+func (g *gen) writeIndex(n *a.Expr, depth uint32) error {
+	if cv := n.ConstValue(); cv != nil {
+		g.emitI32Const(cv.Int64())
+		return nil
+	}
+	if err := g.writeExpr(n, depth); err != nil {
+		return err
+	}
+	if numBits(n.MType()) == 64 {
+		g.emit(opI32WrapI64, 0)
+	}
+	return nil
+}
+
+// sliceLocals returns the local variables that hold the slice n's pointer and
+// length, computing them into temporary local variables if needed.
+func (g *gen) sliceLocals(n *a.Expr, depth uint32) (ptr int64, length int64, err error) {
+	switch n.Operator() {
+	case 0:
+		if v := g.currFunk.vars[n.Ident()]; (len(v) == 2) && !n.GlobalIdent() {
+			return v[0], v[1], nil
+		}
+	case t.IDDot:
+		if n.LHS().AsExpr().Ident() == t.IDArgs {
+			if v := g.currFunk.args[n.Ident()]; len(v) == 2 {
+				return v[0], v[1], nil
+			}
+		}
+	case t.IDDotDot:
+		return g.sliceLocalsDotDot(n, depth)
+	}
+	return 0, 0, fmt.Errorf("TODO: slice %s", n.Str(g.tm))
+}
+
+// sliceLocalsDotDot is like sliceLocals for "lhs[mhs .. rhs]", where lhs is an
+// array or slice and mhs and rhs are both optional.
+func (g *gen) sliceLocalsDotDot(n *a.Expr, depth uint32) (ptr int64, length int64, err error) {
+	lhs, mhs, rhs := n.LHS().AsExpr(), n.MHS().AsExpr(), n.RHS().AsExpr()
+	size, _, err := g.sizeAlign(n.MType().Inner())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	basePtr, baseLen := int64(0), int64(0)
+	if typ := lhs.MType(); typ.IsSliceType() {
+		basePtr, baseLen, err = g.sliceLocals(lhs, depth)
+		if err != nil {
+			return 0, 0, err
+		}
+	} else if typ.IsArrayType() {
+		offset, err := g.writeAddr(lhs, depth)
+		if err != nil {
+			return 0, 0, err
+		}
+		if offset != 0 {
+			g.emitI32Const(int64(offset))
+			g.emit(opI32Add, 0)
+		}
+		basePtr, baseLen = g.newTemp(i32), g.newTemp(i32)
+		g.emit(opLocalSet, basePtr)
+		g.emitI32Const(typ.ArrayLength().ConstValue().Int64())
+		g.emit(opLocalSet, baseLen)
+	} else {
+		return 0, 0, fmt.Errorf("TODO: slice %s", n.Str(g.tm))
+	}
+
+	ptr, length = g.newTemp(i32), g.newTemp(i32)
+	g.emit(opLocalGet, basePtr)
+	if mhs != nil {
+		if err := g.writeIndex(mhs, depth); err != nil {
+			return 0, 0, err
+		}
+		if size != 1 {
+			g.emitI32Const(int64(size))
+			g.emit(opI32Mul, 0)
+		}
+		g.emit(opI32Add, 0)
+	}
+	g.emit(opLocalSet, ptr)
+
+	if rhs != nil {
+		if err := g.writeIndex(rhs, depth); err != nil {
+			return 0, 0, err
+		}
+	} else {
+		g.emit(opLocalGet, baseLen)
+	}
+	if mhs != nil {
+		if err := g.writeIndex(mhs, depth); err != nil {
+			return 0, 0, err
+		}
+		g.emit(opI32Sub, 0)
+	}
+	g.emit(opLocalSet, length)
+	return ptr, length, nil
+}
+
+// sliceLocalsLHS returns the local variables of the slice n being assigned
+// to.
+func (g *gen) sliceLocalsLHS(n *a.Expr) ([]int64, error) {
+	switch n.Operator() {
+	case 0:
+		if v := g.currFunk.vars[n.Ident()]; (len(v) == 2) && !n.GlobalIdent() {
+			return v, nil
+		}
+	case t.IDDot:
+		if n.LHS().AsExpr().Ident() == t.IDArgs {
+			if v := g.currFunk.args[n.Ident()]; len(v) == 2 {
+				return v, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("TODO: assign to slice %s", n.Str(g.tm))
+}
+
+func (g *gen) writeExprUserDefinedCall(n *a.Expr, sideEffectsOnly bool, depth uint32) error {
+	method := n.LHS().AsExpr()
+	recv := method.LHS().AsExpr()
+	recvTyp := recv.MType().Pointee()
+	if recvTyp.Decorator() != 0 {
+		return fmt.Errorf("cannot generate user-defined method call %q for receiver type %q",
+			n.Str(g.tm), recv.MType().Str(g.tm))
+	}
+	qid := recvTyp.QID()
+	qqid := t.QQID{qid[0], qid[1], method.Ident()}
+	f := g.funcs[qqid]
+	index, ok := g.funcIndexes[qqid]
+	if (f == nil) || !ok {
+		return fmt.Errorf("TODO: call %s", n.Str(g.tm))
+	}
+
+	offset, err := g.writeAddr(recv, depth)
+	if err != nil {
+		return err
+	}
+	if offset != 0 {
+		g.emitI32Const(int64(offset))
+		g.emit(opI32Add, 0)
+	}
+	for i, o := range n.Args() {
+		param := f.In().Fields()[i].AsField()
+		v := o.AsArg().Value()
+		if param.XType().IsSliceType() {
+			ptr, length, err := g.sliceLocals(v, depth)
+			if err != nil {
+				return err
+			}
+			g.emit(opLocalGet, ptr)
+			g.emit(opLocalGet, length)
+		} else if err := g.writeExprConverted(v, param.XType(), depth); err != nil {
+			return err
+		}
+	}
+	g.emit(opCall, int64(index))
+
+	if sideEffectsOnly && (len(g.mod.funcs[index].result) > 0) {
+		g.emit(opDrop, 0)
+	}
+	return nil
+}
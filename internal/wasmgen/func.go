@@ -0,0 +1,793 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasmgen
+
+import (
+	"fmt"
+	"strconv"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// funk is the state for the function currently being generated.
+type funk struct {
+	astFunc *a.Func
+	fn      *function
+
+	// args and vars map a Wuffs argument or variable to its WebAssembly local
+	// variable indexes: one for a scalar and two (pointer and length) for a
+	// slice.
+	args map[t.ID][]int64
+	vars map[t.ID][]int64
+
+	// ctrls is the stack of enclosing blocks, loops and ifs, for computing
+	// br and br_if's relative depths.
+	ctrls []ctrl
+
+	// statusLocal is the local variable that holds the status to return, for
+	// a public coroutine. Its return statements branch to the outermost
+	// block, whose end disables the receiver if that status is an error.
+	hasExit     bool
+	statusLocal int64
+
+	numTemps int
+}
+
+// ctrl is a block, loop or if. For a Wuffs while loop, the WebAssembly block
+// is the break target and the WebAssembly loop is the continue target.
+type ctrl struct {
+	loop   a.Loop
+	isCont bool
+	isExit bool
+}
+
+func (g *gen) emit(op opcode, imm int64) {
+	g.currFunk.fn.body = append(g.currFunk.fn.body, insn{op: op, imm: imm})
+}
+
+func (g *gen) emitI32Const(x int64) { g.emit(opI32Const, x) }
+
+func (g *gen) emitConst(typ valType, x int64) {
+	if typ == i64 {
+		g.emit(opI64Const, x)
+	} else {
+		g.emit(opI32Const, x)
+	}
+}
+
+// pushCtrl emits a block, loop or if (with no result) and pushes c.
+func (g *gen) pushCtrl(op opcode, c ctrl) {
+	g.emit(op, blockEmpty)
+	g.currFunk.ctrls = append(g.currFunk.ctrls, c)
+}
+
+// popCtrl emits the end of the innermost block, loop or if.
+func (g *gen) popCtrl() {
+	g.emit(opEnd, 0)
+	g.currFunk.ctrls = g.currFunk.ctrls[:len(g.currFunk.ctrls)-1]
+}
+
+// emitBr emits a br (or, if conditional, a br_if) to the innermost ctrl that
+// matches.
+func (g *gen) emitBr(conditional bool, match func(c ctrl) bool) error {
+	ctrls := g.currFunk.ctrls
+	for i := len(ctrls) - 1; i >= 0; i-- {
+		if match(ctrls[i]) {
+			if conditional {
+				g.emit(opBrIf, int64(len(ctrls)-1-i))
+			} else {
+				g.emit(opBr, int64(len(ctrls)-1-i))
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("wasmgen: internal error: no branch target")
+}
+
+func (g *gen) newLocal(name string, typ valType) int64 {
+	fn := g.currFunk.fn
+	fn.locals = append(fn.locals, local{name: name, typ: typ})
+	return int64(len(fn.params) + len(fn.locals) - 1)
+}
+
+func (g *gen) newTemp(typ valType) int64 {
+	g.currFunk.numTemps++
+	return g.newLocal(fmt.Sprintf("%s%d", tPrefix, g.currFunk.numTemps), typ)
+}
+
+// findSuspendible sets g.suspendible to the coroutines that can suspend: those
+// that yield, that call a built-in (such as an io_reader method) or another
+// package's coroutine, or that call one of this package's suspendible
+// coroutines.
+func (g *gen) findSuspendible() {
+	g.suspendible = map[t.QQID]bool{}
+	callees := map[t.QQID][]t.QQID{}
+	for qqid, f := range g.funcs {
+		if !f.Effect().Coroutine() {
+			continue
+		}
+		for _, o := range f.Body() {
+			o.Walk(func(n *a.Node) error {
+				if (n.Kind() == a.KRet) && (n.AsRet().Keyword() == t.IDYield) {
+					g.suspendible[qqid] = true
+				} else if n.Kind() == a.KExpr {
+					if callee, ok := g.coroutineCallee(n.AsExpr()); !ok {
+						// No-op.
+					} else if g.funcs[callee] == nil {
+						g.suspendible[qqid] = true
+					} else {
+						callees[qqid] = append(callees[qqid], callee)
+					}
+				}
+				return nil
+			})
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for qqid, cs := range callees {
+			if g.suspendible[qqid] {
+				continue
+			}
+			for _, c := range cs {
+				if g.suspendible[c] {
+					g.suspendible[qqid] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+}
+
+// coroutineCallee returns the function called by n, if n is a coroutine call.
+func (g *gen) coroutineCallee(n *a.Expr) (callee t.QQID, ok bool) {
+	if (n.Operator() != a.ExprOperatorCall) || !n.Effect().Coroutine() {
+		return t.QQID{}, false
+	}
+	method := n.LHS().AsExpr()
+	recvTyp := method.LHS().AsExpr().MType().Pointee()
+	if recvTyp.Decorator() != 0 {
+		return t.QQID{}, true
+	}
+	qid := recvTyp.QID()
+	return t.QQID{qid[0], qid[1], method.Ident()}, true
+}
+
+// declareFunc returns the WebAssembly function for n, with its signature but
+// not yet its body.
+func (g *gen) declareFunc(n *a.Func) (*function, error) {
+	fn := &function{export: n.Public()}
+	if n.Receiver().IsZero() {
+		fn.name = g.pkgPrefix + n.FuncName().Str(g.tm)
+	} else {
+		fn.name = g.structCName(n.Receiver()) + "__" + n.FuncName().Str(g.tm)
+		fn.params = append(fn.params, local{name: "self", typ: i32})
+	}
+	for _, o := range n.In().Fields() {
+		o := o.AsField()
+		name := aPrefix + o.Name().Str(g.tm)
+		if o.XType().IsSliceType() {
+			fn.params = append(fn.params,
+				local{name: name + ".ptr", typ: i32},
+				local{name: name + ".len", typ: i32})
+			continue
+		}
+		typ, err := g.wasmType(o.XType())
+		if err != nil {
+			return nil, err
+		}
+		fn.params = append(fn.params, local{name: name, typ: typ})
+	}
+	if n.Effect().Coroutine() {
+		fn.result = []valType{i32}
+	} else if out := n.Out(); out != nil {
+		typ, err := g.wasmType(out)
+		if err != nil {
+			return nil, err
+		}
+		fn.result = []valType{typ}
+	}
+	return fn, nil
+}
+
+func (g *gen) writeFunc(n *a.Func) error {
+	fn := g.mod.funcs[g.funcIndexes[n.QQID()]]
+	g.currFunk = funk{
+		astFunc: n,
+		fn:      fn,
+		args:    map[t.ID][]int64{},
+		vars:    map[t.ID][]int64{},
+	}
+
+	i := int64(0)
+	if !n.Receiver().IsZero() {
+		i++
+	}
+	for _, o := range n.In().Fields() {
+		o := o.AsField()
+		if o.XType().IsSliceType() {
+			g.currFunk.args[o.Name()] = []int64{i, i + 1}
+			i += 2
+		} else {
+			g.currFunk.args[o.Name()] = []int64{i}
+			i++
+		}
+	}
+	if err := g.declareVars(n.Body()); err != nil {
+		return err
+	}
+
+	if n.Public() && !n.Receiver().IsZero() {
+		if err := g.writeFuncPrologue(n); err != nil {
+			return err
+		}
+	}
+	if n.Public() && n.Effect().Coroutine() {
+		g.currFunk.hasExit = true
+		g.currFunk.statusLocal = g.newLocal("status", i32)
+		g.pushCtrl(opBlock, ctrl{isExit: true})
+	}
+
+	if err := g.writeBlock(n.Body(), 0); err != nil {
+		return err
+	}
+
+	if g.currFunk.hasExit {
+		g.popCtrl()
+		// If the status is an error, disable the receiver. The status is
+		// zero (ok) or the address of a message whose first byte is its
+		// category. Address zero always holds a zero byte.
+		g.emit(opLocalGet, g.currFunk.statusLocal)
+		g.emit(opI32Load8U, 0)
+		g.emitI32Const('#')
+		g.emit(opI32Eq, 0)
+		g.emit(opIf, blockEmpty)
+		g.emit(opLocalGet, 0)
+		g.emitI32Const(disabled)
+		g.emit(opI32Store, 0)
+		g.emit(opEnd, 0)
+		g.emit(opLocalGet, g.currFunk.statusLocal)
+	} else if n.Effect().Coroutine() {
+		g.emitI32Const(0)
+	} else if len(fn.result) > 0 {
+		// The Wuffs checker ensures that control never falls off the end of
+		// a function with a result, but the WebAssembly validator doesn't
+		// know that.
+		g.emit(opUnreachable, 0)
+	}
+	return nil
+}
+
+// writeFuncPrologue writes a public method's receiver checks, the same as the
+// C code's. A method that returns a status returns a bad receiver (or, if the
+// receiver is disabled, a disabled by previous error) status. Any other method
+// returns zero.
+func (g *gen) writeFuncPrologue(n *a.Func) error {
+	fn := g.currFunk.fn
+	returnZero := func() {
+		if len(fn.result) > 0 {
+			g.emitConst(fn.result[0], 0)
+		}
+		g.emit(opReturn, 0)
+	}
+
+	g.emit(opLocalGet, 0)
+	g.emit(opI32Eqz, 0)
+	g.emit(opIf, blockEmpty)
+	if n.Effect().Coroutine() {
+		addr, err := g.baseStatusAddr("#bad receiver")
+		if err != nil {
+			return err
+		}
+		g.emitI32Const(addr)
+		g.emit(opReturn, 0)
+	} else {
+		returnZero()
+	}
+	g.emit(opEnd, 0)
+
+	g.emit(opLocalGet, 0)
+	g.emit(opI32Load, 0)
+	g.emitI32Const(magic)
+	g.emit(opI32Ne, 0)
+	g.emit(opIf, blockEmpty)
+	if n.Effect().Coroutine() {
+		disabledAddr, err := g.baseStatusAddr("#disabled by previous error")
+		if err != nil {
+			return err
+		}
+		notCalledAddr, err := g.baseStatusAddr("#initialize not called")
+		if err != nil {
+			return err
+		}
+		g.emitI32Const(disabledAddr)
+		g.emitI32Const(notCalledAddr)
+		g.emit(opLocalGet, 0)
+		g.emit(opI32Load, 0)
+		g.emitI32Const(disabled)
+		g.emit(opI32Eq, 0)
+		g.emit(opSelect, 0)
+		g.emit(opReturn, 0)
+	} else {
+		returnZero()
+	}
+	g.emit(opEnd, 0)
+	return nil
+}
+
+// declareVars declares the local variables, as Wuffs variables are in scope
+// for the whole function. Like Wuffs variables, WebAssembly locals start at
+// zero.
+func (g *gen) declareVars(body []*a.Node) error {
+	for _, o := range body {
+		if err := o.Walk(func(n *a.Node) error {
+			if n.Kind() != a.KVar {
+				return nil
+			}
+			v := n.AsVar()
+			name := vPrefix + v.Name().Str(g.tm)
+			if v.XType().IsSliceType() {
+				g.currFunk.vars[v.Name()] = []int64{
+					g.newLocal(name+".ptr", i32),
+					g.newLocal(name+".len", i32),
+				}
+				return nil
+			}
+			typ, err := g.wasmType(v.XType())
+			if err != nil {
+				return errorAt(n, err)
+			}
+			g.currFunk.vars[v.Name()] = []int64{g.newLocal(name, typ)}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *gen) writeBlock(block []*a.Node, depth uint32) error {
+	for _, o := range block {
+		if err := g.writeStatement(o, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *gen) writeStatement(n *a.Node, depth uint32) error {
+	return errorAt(n, g.writeStatement1(n, depth))
+}
+
+func (g *gen) writeStatement1(n *a.Node, depth uint32) error {
+	if depth > a.MaxBodyDepth {
+		return fmt.Errorf("body recursion depth too large")
+	}
+	depth++
+
+	switch n.Kind() {
+	case a.KAssert:
+		// Assertions only apply at compile-time.
+		return nil
+	case a.KAssign:
+		n := n.AsAssign()
+		return g.writeStatementAssign(n.Operator(), n.LHS(), n.RHS())
+	case a.KChoose:
+		return g.writeStatementChoose(n.AsChoose())
+	case a.KIOBind:
+		return fmt.Errorf("TODO: io_bind and io_limit")
+	case a.KIf:
+		return g.writeStatementIf(n.AsIf(), depth)
+	case a.KIterate:
+		return g.writeStatementIterate(n.AsIterate(), depth)
+	case a.KJump:
+		return g.writeStatementJump(n.AsJump())
+	case a.KRet:
+		return g.writeStatementRet(n.AsRet())
+	case a.KVar:
+		// Variables are declared by declareVars.
+		return nil
+	case a.KWhile:
+		return g.writeStatementWhile(n.AsWhile(), depth)
+	}
+	return fmt.Errorf("unrecognized ast.Kind (%s) for writeStatement", n.Kind())
+}
+
+func (g *gen) writeStatementAssign(op t.ID, lhs *a.Expr, rhs *a.Expr) error {
+	if lhs == nil {
+		if rhs.Effect().Coroutine() {
+			// The callee is one of this package's non-suspendible coroutines,
+			// so any non-ok status, even a note, returns immediately.
+			if err := g.writeExpr(rhs, 0); err != nil {
+				return err
+			}
+			tmp := g.newTemp(i32)
+			g.emit(opLocalTee, tmp)
+			g.pushCtrl(opIf, ctrl{})
+			g.emit(opLocalGet, tmp)
+			if err := g.writeReturnStatus(); err != nil {
+				return err
+			}
+			g.popCtrl()
+			return nil
+		}
+		return g.writeExprSideEffectsOnly(rhs, 0)
+	}
+
+	lTyp := lhs.MType()
+	if lTyp.IsSliceType() {
+		if op != t.IDEq {
+			return fmt.Errorf("unrecognized slice assignment operator %q", op.AmbiguousForm().Str(g.tm))
+		}
+		dst, err := g.sliceLocalsLHS(lhs)
+		if err != nil {
+			return err
+		}
+		ptr, length, err := g.sliceLocals(rhs, 0)
+		if err != nil {
+			return err
+		}
+		g.emit(opLocalGet, ptr)
+		g.emit(opLocalSet, dst[0])
+		g.emit(opLocalGet, length)
+		g.emit(opLocalSet, dst[1])
+		return nil
+	}
+
+	// Push the address (for a memory lvalue), then the value, then store it.
+	lv, err := g.writeLValue(lhs, 0)
+	if err != nil {
+		return err
+	}
+	switch op {
+	case t.IDEq, t.IDEqQuestion:
+		if err := g.writeExprConverted(rhs, lTyp, 0); err != nil {
+			return err
+		}
+
+	case t.IDTildeSatPlusEq, t.IDTildeSatMinusEq:
+		if err := g.writeSatOp(lhs, rhs, lTyp, op == t.IDTildeSatPlusEq, 0); err != nil {
+			return err
+		}
+
+	default:
+		binOp := assignBinaryOps[op]
+		if binOp == 0 {
+			return fmt.Errorf("unrecognized operator %q", op.AmbiguousForm().Str(g.tm))
+		}
+		if err := g.writeBinaryOp(binOp, lhs, rhs, lTyp, 0); err != nil {
+			return err
+		}
+	}
+	return g.writeStore(lv)
+}
+
+// assignBinaryOps maps each compound assignment operator, such as "+=", to its
+// binary operator, such as "+".
+var assignBinaryOps = map[t.ID]t.ID{
+	t.IDPlusEq:           t.IDXBinaryPlus,
+	t.IDMinusEq:          t.IDXBinaryMinus,
+	t.IDStarEq:           t.IDXBinaryStar,
+	t.IDSlashEq:          t.IDXBinarySlash,
+	t.IDShiftLEq:         t.IDXBinaryShiftL,
+	t.IDShiftREq:         t.IDXBinaryShiftR,
+	t.IDAmpEq:            t.IDXBinaryAmp,
+	t.IDPipeEq:           t.IDXBinaryPipe,
+	t.IDHatEq:            t.IDXBinaryHat,
+	t.IDPercentEq:        t.IDXBinaryPercent,
+	t.IDTildeModPlusEq:   t.IDXBinaryTildeModPlus,
+	t.IDTildeModMinusEq:  t.IDXBinaryTildeModMinus,
+	t.IDTildeModStarEq:   t.IDXBinaryTildeModStar,
+	t.IDTildeModShiftLEq: t.IDXBinaryTildeModShiftL,
+	t.IDTildeModShiftREq: t.IDXBinaryTildeModShiftR,
+}
+
+func (g *gen) writeStatementChoose(n *a.Choose) error {
+	recv := g.currFunk.astFunc.Receiver()
+	for _, o := range n.Args() {
+		f := g.funcs[t.QQID{recv[0], recv[1], o.AsExpr().Ident()}]
+		if (f == nil) || !f.HasChooseCPUArch() {
+			return fmt.Errorf("TODO: choose %s without a choose-cpu_arch precondition",
+				o.AsExpr().Ident().Str(g.tm))
+		}
+	}
+	// No-op. The WebAssembly code always uses the portable implementation.
+	return nil
+}
+
+func (g *gen) writeStatementIf(n *a.If, depth uint32) error {
+	if err := g.writeExpr(n.Condition(), 0); err != nil {
+		return err
+	}
+	g.pushCtrl(opIf, ctrl{})
+	if err := g.writeBlock(n.BodyIfTrue(), depth); err != nil {
+		return err
+	}
+	if bif := n.BodyIfFalse(); len(bif) > 0 {
+		g.emit(opElse, 0)
+		if err := g.writeBlock(bif, depth); err != nil {
+			return err
+		}
+	} else if eif := n.ElseIf(); eif != nil {
+		g.emit(opElse, 0)
+		if err := g.writeStatementIf(eif, depth); err != nil {
+			return err
+		}
+	}
+	g.popCtrl()
+	return nil
+}
+
+// writeStatementIterate writes an iterate loop. Like the Go code, it does not
+// unroll it.
+func (g *gen) writeStatementIterate(n *a.Iterate, depth uint32) error {
+	assigns := n.Assigns()
+	if len(assigns) == 0 {
+		return nil
+	}
+	if n.HasBreak() || n.HasContinue() {
+		return fmt.Errorf("TODO: break or continue for an iterate loop")
+	}
+
+	// The remaining slices are held in the iterate variables.
+	remaining := make([][2]int64, len(assigns))
+	for i, o := range assigns {
+		o := o.AsAssign()
+		name := iPrefix + o.LHS().Ident().Str(g.tm)
+		ptr, length, err := g.sliceLocals(o.RHS(), 0)
+		if err != nil {
+			return err
+		}
+		remaining[i] = [2]int64{g.newLocal(name+".ptr", i32), g.newLocal(name+".len", i32)}
+		g.emit(opLocalGet, ptr)
+		g.emit(opLocalSet, remaining[i][0])
+		g.emit(opLocalGet, length)
+		g.emit(opLocalSet, remaining[i][1])
+	}
+
+	for ; n != nil; n = n.ElseIterate() {
+		length, err := strconv.Atoi(n.Length().Str(g.tm))
+		if err != nil {
+			return err
+		}
+		advance, err := strconv.Atoi(n.Advance().Str(g.tm))
+		if err != nil {
+			return err
+		}
+		if advance > length {
+			return fmt.Errorf("TODO: iterate advance %d greater than its length %d", advance, length)
+		}
+
+		g.pushCtrl(opBlock, ctrl{})
+		g.pushCtrl(opLoop, ctrl{})
+		for _, r := range remaining {
+			g.emit(opLocalGet, r[1])
+			g.emitI32Const(int64(length))
+			g.emit(opI32LtU, 0)
+			g.emit(opBrIf, 1)
+		}
+		for i, o := range assigns {
+			v := g.currFunk.vars[o.AsAssign().LHS().Ident()]
+			g.emit(opLocalGet, remaining[i][0])
+			g.emit(opLocalSet, v[0])
+			g.emitI32Const(int64(length))
+			g.emit(opLocalSet, v[1])
+		}
+		if err := g.writeBlock(n.Body(), depth); err != nil {
+			return err
+		}
+		for _, r := range remaining {
+			g.emit(opLocalGet, r[0])
+			g.emitI32Const(int64(advance))
+			g.emit(opI32Add, 0)
+			g.emit(opLocalSet, r[0])
+			g.emit(opLocalGet, r[1])
+			g.emitI32Const(int64(advance))
+			g.emit(opI32Sub, 0)
+			g.emit(opLocalSet, r[1])
+		}
+		g.emit(opBr, 0)
+		g.popCtrl()
+		g.popCtrl()
+	}
+
+	for _, o := range assigns {
+		for _, v := range g.currFunk.vars[o.AsAssign().LHS().Ident()] {
+			g.emitI32Const(0)
+			g.emit(opLocalSet, v)
+		}
+	}
+	return nil
+}
+
+func (g *gen) writeStatementJump(n *a.Jump) error {
+	target := n.JumpTarget()
+	isCont := n.Keyword() == t.IDContinue
+	return g.emitBr(false, func(c ctrl) bool {
+		return (c.loop == target) && (c.isCont == isCont)
+	})
+}
+
+func (g *gen) writeStatementRet(n *a.Ret) error {
+	if n.Keyword() != t.IDReturn {
+		return fmt.Errorf("TODO: %s", n.Keyword().Str(g.tm))
+	}
+	retExpr := n.Value()
+	if g.currFunk.astFunc.Effect().Coroutine() {
+		if retExpr == nil {
+			g.emitI32Const(0)
+		} else if err := g.writeExpr(retExpr, 0); err != nil {
+			return err
+		}
+		return g.writeReturnStatus()
+	}
+	if retExpr != nil {
+		if err := g.writeExprConverted(retExpr, g.currFunk.astFunc.Out(), 0); err != nil {
+			return err
+		}
+	}
+	g.emit(opReturn, 0)
+	return nil
+}
+
+// writeReturnStatus returns the status on top of the stack, branching to the
+// exit block if there is one.
+func (g *gen) writeReturnStatus() error {
+	if !g.currFunk.hasExit {
+		g.emit(opReturn, 0)
+		return nil
+	}
+	g.emit(opLocalSet, g.currFunk.statusLocal)
+	return g.emitBr(false, func(c ctrl) bool { return c.isExit })
+}
+
+func (g *gen) writeStatementWhile(n *a.While, depth uint32) error {
+	g.pushCtrl(opBlock, ctrl{loop: n})
+	g.pushCtrl(opLoop, ctrl{loop: n, isCont: true})
+	if !n.IsWhileTrue() {
+		if err := g.writeExpr(n.Condition(), 0); err != nil {
+			return err
+		}
+		g.emit(opI32Eqz, 0)
+		g.emit(opBrIf, 1)
+	}
+	if err := g.writeBlock(n.Body(), depth); err != nil {
+		return err
+	}
+	g.emit(opBr, 0)
+	g.popCtrl()
+	g.popCtrl()
+	return nil
+}
+
+// writeStructFuncs writes the public struct n's sizeof and initialize
+// functions. Like the C code's, initialize checks the receiver, its size and
+// the Wuffs version, zeroes the receiver (unless the options say that it
+// already is) and then sets its magic field.
+func (g *gen) writeStructFuncs(n *a.Struct) error {
+	l, err := g.structLayout(n.QID())
+	if err != nil {
+		return err
+	}
+	name := g.structCName(n.QID())
+
+	g.currFunk = funk{fn: &function{
+		name:   "sizeof__" + name,
+		export: true,
+		result: []valType{i32},
+	}}
+	g.emitI32Const(int64(l.size))
+	g.mod.funcs = append(g.mod.funcs, g.currFunk.fn)
+
+	g.currFunk = funk{fn: &function{
+		name:   name + "__initialize",
+		export: true,
+		params: []local{
+			{name: "self", typ: i32},
+			{name: "sizeof_star_self", typ: i32},
+			{name: "wuffs_version", typ: i64},
+			{name: "options", typ: i32},
+		},
+		result: []valType{i32},
+	}}
+	returnStatus := func(msg string) error {
+		addr, err := g.baseStatusAddr(msg)
+		if err != nil {
+			return err
+		}
+		g.emit(opIf, blockEmpty)
+		g.emitI32Const(addr)
+		g.emit(opReturn, 0)
+		g.emit(opEnd, 0)
+		return nil
+	}
+
+	g.emit(opLocalGet, 0)
+	g.emit(opI32Eqz, 0)
+	if err := returnStatus("#bad receiver"); err != nil {
+		return err
+	}
+
+	g.emit(opLocalGet, 1)
+	g.emitI32Const(int64(l.size))
+	g.emit(opI32Ne, 0)
+	if err := returnStatus("#bad sizeof receiver"); err != nil {
+		return err
+	}
+
+	g.emit(opLocalGet, 2)
+	g.emit(opI64Const, 32)
+	g.emit(opI64ShrU, 0)
+	g.emit(opI64Const, int64(g.version.Major))
+	g.emit(opI64Ne, 0)
+	g.emit(opLocalGet, 2)
+	g.emit(opI64Const, 16)
+	g.emit(opI64ShrU, 0)
+	g.emit(opI64Const, 0xFFFF)
+	g.emit(opI64And, 0)
+	g.emit(opI64Const, int64(g.version.Minor))
+	g.emit(opI64GtU, 0)
+	g.emit(opI32Or, 0)
+	if err := returnStatus("#bad wuffs version"); err != nil {
+		return err
+	}
+
+	g.emit(opLocalGet, 3)
+	g.emitI32Const(alreadyZeroed)
+	g.emit(opI32And, 0)
+	g.emit(opIf, blockEmpty)
+	g.emit(opLocalGet, 0)
+	g.emit(opI32Load, 0)
+	if err := returnStatus("#initialize falsely claimed already zeroed"); err != nil {
+		return err
+	}
+	g.emit(opElse, 0)
+	g.emit(opLocalGet, 0)
+	g.emitI32Const(0)
+	g.emitI32Const(int64(l.size))
+	g.emit(opMemoryFill, 0)
+	g.emit(opEnd, 0)
+
+	if err := g.writeSetMagic(n.QID(), 0); err != nil {
+		return err
+	}
+	g.emitI32Const(0)
+	g.mod.funcs = append(g.mod.funcs, g.currFunk.fn)
+	return nil
+}
+
+// writeSetMagic sets the magic field of the struct qid at offset from self,
+// and of its struct-typed fields, as the C code initializes them too.
+func (g *gen) writeSetMagic(qid t.QID, offset uint32) error {
+	l, err := g.structLayout(qid)
+	if err != nil {
+		return err
+	}
+	g.emit(opLocalGet, 0)
+	g.emitI32Const(magic)
+	g.emit(opI32Store, int64(offset))
+	for _, o := range g.structMap[qid].Fields() {
+		o := o.AsField()
+		if typ := o.XType(); (typ.Decorator() == 0) && (typ.QID()[0] == 0) && (g.structMap[typ.QID()] != nil) {
+			if err := g.writeSetMagic(typ.QID(), offset+l.fields[o.Name()]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
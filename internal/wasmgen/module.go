@@ -0,0 +1,614 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasmgen
+
+// This file deals with the WebAssembly module itself: its functions, globals,
+// linear memory and data, and encoding all of that in the binary or the text
+// format. It knows nothing about Wuffs.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dataBase is the linear memory address of the start of the data segment. The
+// bytes below it are always zero, so that no status message or table has the
+// null address, which means an ok status.
+const dataBase = 16
+
+// pageSize is the WebAssembly linear memory page size.
+const pageSize = 65536
+
+type valType byte
+
+const (
+	i32 valType = 0x7F
+	i64 valType = 0x7E
+
+	// blockEmpty is the block type of a block, loop or if with no result.
+	blockEmpty = 0x40
+)
+
+func (v valType) String() string {
+	switch v {
+	case i32:
+		return "i32"
+	case i64:
+		return "i64"
+	}
+	return fmt.Sprintf("valType(0x%02X)", byte(v))
+}
+
+type opcode uint16
+
+// These are the instructions that the generated code uses, with their binary
+// encoding. The 0xFCxx ones are prefixed, from the bulk memory operations.
+const (
+	opUnreachable opcode = 0x00
+	opBlock       opcode = 0x02
+	opLoop        opcode = 0x03
+	opIf          opcode = 0x04
+	opElse        opcode = 0x05
+	opEnd         opcode = 0x0B
+	opBr          opcode = 0x0C
+	opBrIf        opcode = 0x0D
+	opReturn      opcode = 0x0F
+	opCall        opcode = 0x10
+	opDrop        opcode = 0x1A
+	opSelect      opcode = 0x1B
+
+	opLocalGet  opcode = 0x20
+	opLocalSet  opcode = 0x21
+	opLocalTee  opcode = 0x22
+	opGlobalGet opcode = 0x23
+
+	opI32Load    opcode = 0x28
+	opI64Load    opcode = 0x29
+	opI32Load8S  opcode = 0x2C
+	opI32Load8U  opcode = 0x2D
+	opI32Load16S opcode = 0x2E
+	opI32Load16U opcode = 0x2F
+	opI32Store   opcode = 0x36
+	opI64Store   opcode = 0x37
+	opI32Store8  opcode = 0x3A
+	opI32Store16 opcode = 0x3B
+
+	opI32Const opcode = 0x41
+	opI64Const opcode = 0x42
+
+	opI32Eqz opcode = 0x45
+	opI32Eq  opcode = 0x46
+	opI32Ne  opcode = 0x47
+	opI32LtS opcode = 0x48
+	opI32LtU opcode = 0x49
+	opI32GtS opcode = 0x4A
+	opI32GtU opcode = 0x4B
+	opI32LeS opcode = 0x4C
+	opI32LeU opcode = 0x4D
+	opI32GeS opcode = 0x4E
+	opI32GeU opcode = 0x4F
+
+	opI64Eqz opcode = 0x50
+	opI64Eq  opcode = 0x51
+	opI64Ne  opcode = 0x52
+	opI64LtS opcode = 0x53
+	opI64LtU opcode = 0x54
+	opI64GtS opcode = 0x55
+	opI64GtU opcode = 0x56
+	opI64LeS opcode = 0x57
+	opI64LeU opcode = 0x58
+	opI64GeS opcode = 0x59
+	opI64GeU opcode = 0x5A
+
+	opI32Clz opcode = 0x67
+
+	opI32Add  opcode = 0x6A
+	opI32Sub  opcode = 0x6B
+	opI32Mul  opcode = 0x6C
+	opI32DivS opcode = 0x6D
+	opI32DivU opcode = 0x6E
+	opI32RemS opcode = 0x6F
+	opI32RemU opcode = 0x70
+	opI32And  opcode = 0x71
+	opI32Or   opcode = 0x72
+	opI32Xor  opcode = 0x73
+	opI32Shl  opcode = 0x74
+	opI32ShrS opcode = 0x75
+	opI32ShrU opcode = 0x76
+
+	opI64Clz opcode = 0x79
+
+	opI64Add  opcode = 0x7C
+	opI64Sub  opcode = 0x7D
+	opI64Mul  opcode = 0x7E
+	opI64DivS opcode = 0x7F
+	opI64DivU opcode = 0x80
+	opI64RemS opcode = 0x81
+	opI64RemU opcode = 0x82
+	opI64And  opcode = 0x83
+	opI64Or   opcode = 0x84
+	opI64Xor  opcode = 0x85
+	opI64Shl  opcode = 0x86
+	opI64ShrS opcode = 0x87
+	opI64ShrU opcode = 0x88
+
+	opI32WrapI64    opcode = 0xA7
+	opI64ExtendI32S opcode = 0xAC
+	opI64ExtendI32U opcode = 0xAD
+
+	opFirstPrefixed opcode = 0xFC00
+	opMemoryCopy    opcode = 0xFC0A
+	opMemoryFill    opcode = 0xFC0B
+)
+
+type immKind uint8
+
+const (
+	immNone      immKind = iota
+	immBlockType         // A block, loop or if's block type.
+	immLabel             // A br or br_if's relative depth.
+	immFunc              // A call's function index.
+	immLocal             // A local variable index.
+	immGlobal            // A global variable index.
+	immMemArg            // A load or store's alignment and offset.
+	immI32               // A signed 32-bit constant.
+	immI64               // A signed 64-bit constant.
+	immMemory            // A memory index, which is always zero.
+	immMemories          // Two memory indexes (destination, source), both zero.
+)
+
+// opInfo is an instruction's text format name, immediate kind and, for loads
+// and stores, the log2 of its natural alignment.
+type opInfo struct {
+	name  string
+	imm   immKind
+	align uint32
+}
+
+var opInfos = map[opcode]opInfo{
+	opUnreachable: {"unreachable", immNone, 0},
+	opBlock:       {"block", immBlockType, 0},
+	opLoop:        {"loop", immBlockType, 0},
+	opIf:          {"if", immBlockType, 0},
+	opElse:        {"else", immNone, 0},
+	opEnd:         {"end", immNone, 0},
+	opBr:          {"br", immLabel, 0},
+	opBrIf:        {"br_if", immLabel, 0},
+	opReturn:      {"return", immNone, 0},
+	opCall:        {"call", immFunc, 0},
+	opDrop:        {"drop", immNone, 0},
+	opSelect:      {"select", immNone, 0},
+
+	opLocalGet:  {"local.get", immLocal, 0},
+	opLocalSet:  {"local.set", immLocal, 0},
+	opLocalTee:  {"local.tee", immLocal, 0},
+	opGlobalGet: {"global.get", immGlobal, 0},
+
+	opI32Load:    {"i32.load", immMemArg, 2},
+	opI64Load:    {"i64.load", immMemArg, 3},
+	opI32Load8S:  {"i32.load8_s", immMemArg, 0},
+	opI32Load8U:  {"i32.load8_u", immMemArg, 0},
+	opI32Load16S: {"i32.load16_s", immMemArg, 1},
+	opI32Load16U: {"i32.load16_u", immMemArg, 1},
+	opI32Store:   {"i32.store", immMemArg, 2},
+	opI64Store:   {"i64.store", immMemArg, 3},
+	opI32Store8:  {"i32.store8", immMemArg, 0},
+	opI32Store16: {"i32.store16", immMemArg, 1},
+
+	opI32Const: {"i32.const", immI32, 0},
+	opI64Const: {"i64.const", immI64, 0},
+
+	opI32Eqz: {"i32.eqz", immNone, 0},
+	opI32Eq:  {"i32.eq", immNone, 0},
+	opI32Ne:  {"i32.ne", immNone, 0},
+	opI32LtS: {"i32.lt_s", immNone, 0},
+	opI32LtU: {"i32.lt_u", immNone, 0},
+	opI32GtS: {"i32.gt_s", immNone, 0},
+	opI32GtU: {"i32.gt_u", immNone, 0},
+	opI32LeS: {"i32.le_s", immNone, 0},
+	opI32LeU: {"i32.le_u", immNone, 0},
+	opI32GeS: {"i32.ge_s", immNone, 0},
+	opI32GeU: {"i32.ge_u", immNone, 0},
+
+	opI64Eqz: {"i64.eqz", immNone, 0},
+	opI64Eq:  {"i64.eq", immNone, 0},
+	opI64Ne:  {"i64.ne", immNone, 0},
+	opI64LtS: {"i64.lt_s", immNone, 0},
+	opI64LtU: {"i64.lt_u", immNone, 0},
+	opI64GtS: {"i64.gt_s", immNone, 0},
+	opI64GtU: {"i64.gt_u", immNone, 0},
+	opI64LeS: {"i64.le_s", immNone, 0},
+	opI64LeU: {"i64.le_u", immNone, 0},
+	opI64GeS: {"i64.ge_s", immNone, 0},
+	opI64GeU: {"i64.ge_u", immNone, 0},
+
+	opI32Clz: {"i32.clz", immNone, 0},
+
+	opI32Add:  {"i32.add", immNone, 0},
+	opI32Sub:  {"i32.sub", immNone, 0},
+	opI32Mul:  {"i32.mul", immNone, 0},
+	opI32DivS: {"i32.div_s", immNone, 0},
+	opI32DivU: {"i32.div_u", immNone, 0},
+	opI32RemS: {"i32.rem_s", immNone, 0},
+	opI32RemU: {"i32.rem_u", immNone, 0},
+	opI32And:  {"i32.and", immNone, 0},
+	opI32Or:   {"i32.or", immNone, 0},
+	opI32Xor:  {"i32.xor", immNone, 0},
+	opI32Shl:  {"i32.shl", immNone, 0},
+	opI32ShrS: {"i32.shr_s", immNone, 0},
+	opI32ShrU: {"i32.shr_u", immNone, 0},
+
+	opI64Clz: {"i64.clz", immNone, 0},
+
+	opI64Add:  {"i64.add", immNone, 0},
+	opI64Sub:  {"i64.sub", immNone, 0},
+	opI64Mul:  {"i64.mul", immNone, 0},
+	opI64DivS: {"i64.div_s", immNone, 0},
+	opI64DivU: {"i64.div_u", immNone, 0},
+	opI64RemS: {"i64.rem_s", immNone, 0},
+	opI64RemU: {"i64.rem_u", immNone, 0},
+	opI64And:  {"i64.and", immNone, 0},
+	opI64Or:   {"i64.or", immNone, 0},
+	opI64Xor:  {"i64.xor", immNone, 0},
+	opI64Shl:  {"i64.shl", immNone, 0},
+	opI64ShrS: {"i64.shr_s", immNone, 0},
+	opI64ShrU: {"i64.shr_u", immNone, 0},
+
+	opI32WrapI64:    {"i32.wrap_i64", immNone, 0},
+	opI64ExtendI32S: {"i64.extend_i32_s", immNone, 0},
+	opI64ExtendI32U: {"i64.extend_i32_u", immNone, 0},
+	opMemoryCopy:    {"memory.copy", immMemories, 0},
+	opMemoryFill:    {"memory.fill", immMemory, 0},
+}
+
+// insn is an instruction. What imm means depends on the opcode's immKind. For
+// immMemArg, imm is the offset.
+type insn struct {
+	op  opcode
+	imm int64
+}
+
+type local struct {
+	name string
+	typ  valType
+}
+
+type function struct {
+	name   string
+	export bool
+	params []local
+	locals []local
+	result []valType
+	body   []insn
+}
+
+func (f *function) typeKey() string {
+	s := []byte(nil)
+	for _, o := range f.params {
+		s = append(s, byte(o.typ))
+	}
+	s = append(s, ':')
+	for _, o := range f.result {
+		s = append(s, byte(o))
+	}
+	return string(s)
+}
+
+func (f *function) localName(i int64) string {
+	if i < int64(len(f.params)) {
+		return f.params[i].name
+	}
+	return f.locals[i-int64(len(f.params))].name
+}
+
+// global is an immutable global variable.
+type global struct {
+	name   string
+	export bool
+	typ    valType
+	value  int64
+}
+
+type module struct {
+	funcs   []*function
+	globals []*global
+	data    []byte
+}
+
+// heapBase is the first linear memory address after the data, aligned to 16
+// bytes. The host can use the memory from there on.
+func (m *module) heapBase() int64 {
+	return (dataBase + int64(len(m.data)) + 15) &^ 15
+}
+
+// encodeText returns m in the WebAssembly text format.
+func (m *module) encodeText() []byte {
+	b := &buffer{}
+	b.writes("(module\n")
+	for _, f := range m.funcs {
+		b.printf("  (func $%s", f.name)
+		if f.export {
+			b.printf(" (export %q)", f.name)
+		}
+		for _, o := range f.params {
+			b.printf(" (param $%s %v)", o.name, o.typ)
+		}
+		for _, o := range f.result {
+			b.printf(" (result %v)", o)
+		}
+		b.writeb('\n')
+		for _, o := range f.locals {
+			b.printf("    (local $%s %v)\n", o.name, o.typ)
+		}
+		indent := 2
+		for _, o := range f.body {
+			if (o.op == opEnd) || (o.op == opElse) {
+				indent--
+			}
+			b.writes(strings.Repeat("  ", indent))
+			m.encodeTextInsn(b, f, o)
+			b.writeb('\n')
+			if (o.op == opBlock) || (o.op == opLoop) || (o.op == opIf) || (o.op == opElse) {
+				indent++
+			}
+		}
+		b.writes("  )\n")
+	}
+	b.printf("  (memory (export \"memory\") %d)\n", m.memoryPages())
+	for _, o := range m.globals {
+		b.printf("  (global $%s", o.name)
+		if o.export {
+			b.printf(" (export %q)", o.name)
+		}
+		b.printf(" %v (%v.const %d))\n", o.typ, o.typ, o.value)
+	}
+	if len(m.data) > 0 {
+		b.printf("  (data (i32.const %d)\n", dataBase)
+		for i := 0; i < len(m.data); i += 32 {
+			j := i + 32
+			if j > len(m.data) {
+				j = len(m.data)
+			}
+			b.writes("    \"")
+			for _, c := range m.data[i:j] {
+				b.printf("\\%02x", c)
+			}
+			b.writes("\"\n")
+		}
+		b.writes("  )\n")
+	}
+	b.writes(")\n")
+	return *b
+}
+
+func (m *module) encodeTextInsn(b *buffer, f *function, o insn) {
+	info := opInfos[o.op]
+	b.writes(info.name)
+	switch info.imm {
+	case immBlockType:
+		if o.imm != blockEmpty {
+			b.printf(" (result %v)", valType(o.imm))
+		}
+	case immLabel:
+		b.printf(" %d", o.imm)
+	case immFunc:
+		b.printf(" $%s", m.funcs[o.imm].name)
+	case immLocal:
+		b.printf(" $%s", f.localName(o.imm))
+	case immGlobal:
+		b.printf(" $%s", m.globals[o.imm].name)
+	case immMemArg:
+		if o.imm != 0 {
+			b.printf(" offset=%d", o.imm)
+		}
+	case immI32:
+		b.printf(" %d", int32(o.imm))
+	case immI64:
+		b.printf(" %d", o.imm)
+	}
+}
+
+// encodeBinary returns m in the WebAssembly binary format.
+func (m *module) encodeBinary() []byte {
+	b := &buffer{}
+	b.writes("\x00asm\x01\x00\x00\x00")
+
+	// Type section.
+	typeIndexes := map[string]int{}
+	types := &buffer{}
+	for _, f := range m.funcs {
+		key := f.typeKey()
+		if _, ok := typeIndexes[key]; ok {
+			continue
+		}
+		typeIndexes[key] = len(typeIndexes)
+		types.writeb(0x60)
+		types.writeU(uint64(len(f.params)))
+		for _, o := range f.params {
+			types.writeb(byte(o.typ))
+		}
+		types.writeU(uint64(len(f.result)))
+		for _, o := range f.result {
+			types.writeb(byte(o))
+		}
+	}
+	b.writeSection(1, len(typeIndexes), *types)
+
+	// Function section.
+	funcs := &buffer{}
+	for _, f := range m.funcs {
+		funcs.writeU(uint64(typeIndexes[f.typeKey()]))
+	}
+	b.writeSection(3, len(m.funcs), *funcs)
+
+	// Memory section.
+	memory := &buffer{}
+	memory.writeb(0x00)
+	memory.writeU(uint64(m.memoryPages()))
+	b.writeSection(5, 1, *memory)
+
+	// Global section.
+	globals := &buffer{}
+	for _, o := range m.globals {
+		globals.writeb(byte(o.typ))
+		globals.writeb(0x00)
+		if o.typ == i32 {
+			globals.writeb(byte(opI32Const))
+		} else {
+			globals.writeb(byte(opI64Const))
+		}
+		globals.writeS(o.value)
+		globals.writeb(byte(opEnd))
+	}
+	b.writeSection(6, len(m.globals), *globals)
+
+	// Export section.
+	exports, numExports := &buffer{}, 0
+	for i, f := range m.funcs {
+		if f.export {
+			exports.writeName(f.name)
+			exports.writeb(0x00)
+			exports.writeU(uint64(i))
+			numExports++
+		}
+	}
+	exports.writeName("memory")
+	exports.writeb(0x02)
+	exports.writeU(0)
+	numExports++
+	for i, o := range m.globals {
+		if o.export {
+			exports.writeName(o.name)
+			exports.writeb(0x03)
+			exports.writeU(uint64(i))
+			numExports++
+		}
+	}
+	b.writeSection(7, numExports, *exports)
+
+	// Code section.
+	code := &buffer{}
+	for _, f := range m.funcs {
+		body := &buffer{}
+		groups := [][2]uint64(nil)
+		for _, o := range f.locals {
+			if n := len(groups); (n > 0) && (groups[n-1][1] == uint64(o.typ)) {
+				groups[n-1][0]++
+			} else {
+				groups = append(groups, [2]uint64{1, uint64(o.typ)})
+			}
+		}
+		body.writeU(uint64(len(groups)))
+		for _, o := range groups {
+			body.writeU(o[0])
+			body.writeb(byte(o[1]))
+		}
+		for _, o := range f.body {
+			body.encodeBinaryInsn(o)
+		}
+		body.writeb(byte(opEnd))
+		code.writeU(uint64(len(*body)))
+		code.writes(string(*body))
+	}
+	b.writeSection(10, len(m.funcs), *code)
+
+	// Data section.
+	if len(m.data) > 0 {
+		data := &buffer{}
+		data.writeb(0x00)
+		data.writeb(byte(opI32Const))
+		data.writeS(dataBase)
+		data.writeb(byte(opEnd))
+		data.writeU(uint64(len(m.data)))
+		data.writes(string(m.data))
+		b.writeSection(11, 1, *data)
+	}
+	return *b
+}
+
+func (b *buffer) encodeBinaryInsn(o insn) {
+	info := opInfos[o.op]
+	if o.op >= opFirstPrefixed {
+		b.writeb(byte(o.op >> 8))
+		b.writeU(uint64(o.op & 0xFF))
+	} else {
+		b.writeb(byte(o.op))
+	}
+	switch info.imm {
+	case immBlockType:
+		b.writeb(byte(o.imm))
+	case immLabel, immFunc, immLocal, immGlobal:
+		b.writeU(uint64(o.imm))
+	case immMemArg:
+		b.writeU(uint64(info.align))
+		b.writeU(uint64(o.imm))
+	case immI32:
+		b.writeS(int64(int32(o.imm)))
+	case immI64:
+		b.writeS(o.imm)
+	case immMemory:
+		b.writeb(0x00)
+	case immMemories:
+		b.writeb(0x00)
+		b.writeb(0x00)
+	}
+}
+
+func (m *module) memoryPages() int64 {
+	return (m.heapBase() + pageSize - 1) / pageSize
+}
+
+func (b *buffer) writeSection(id byte, count int, contents []byte) {
+	if count == 0 {
+		return
+	}
+	payload := &buffer{}
+	payload.writeU(uint64(count))
+	payload.writes(string(contents))
+	b.writeb(id)
+	b.writeU(uint64(len(*payload)))
+	b.writes(string(*payload))
+}
+
+func (b *buffer) writeName(s string) {
+	b.writeU(uint64(len(s)))
+	b.writes(s)
+}
+
+// writeU writes x as an unsigned LEB128 number.
+func (b *buffer) writeU(x uint64) {
+	for {
+		c := byte(x & 0x7F)
+		x >>= 7
+		if x == 0 {
+			b.writeb(c)
+			return
+		}
+		b.writeb(c | 0x80)
+	}
+}
+
+// writeS writes x as a signed LEB128 number.
+func (b *buffer) writeS(x int64) {
+	for {
+		c := byte(x & 0x7F)
+		x >>= 7
+		if ((x == 0) && (c&0x40 == 0)) || ((x == -1) && (c&0x40 != 0)) {
+			b.writeb(c)
+			return
+		}
+		b.writeb(c | 0x80)
+	}
+}
@@ -0,0 +1,584 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wasmgen transpiles Wuffs packages to freestanding WebAssembly
+// modules, without going through a C compiler.
+//
+// Each generated module has no imports. It exports its linear memory, as
+// "memory", and the same functions as the C code, with the same names, such as
+// "sizeof__wuffs_crc32__ieee_hasher", "wuffs_crc32__ieee_hasher__initialize"
+// and "wuffs_crc32__ieee_hasher__update_u32". A pointer is an i32 linear
+// memory address and a slice is two i32 arguments: its pointer and length. A
+// status is the address of its NUL-terminated message, such as "#base: bad
+// receiver", or zero for ok. Like the C code, status addresses can be compared
+// for equality, and each status (such as "wuffs_base__error__bad_receiver") is
+// also an exported i32 global. The host owns the linear memory from the
+// exported "__heap_base" global onwards, growing it as needed.
+//
+// Not every Wuffs construct is supported yet. In particular, coroutines that
+// can suspend (and hence the I/O methods that can suspend) are not, as
+// WebAssembly's structured control flow has no equivalent of the C code's
+// switch-into-the-middle-of-a-loop resumption. Functions that have a
+// choose-cpu_arch precondition are not generated at all: the WebAssembly code
+// always uses the portable (non-SIMD) implementation.
+package wasmgen
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/google/wuffs/lang/builtin"
+	"github.com/google/wuffs/lang/generate"
+
+	cf "github.com/google/wuffs/cmd/commonflags"
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Prefixes are prepended to local variable names, in the text format, to
+// avoid e.g. a Wuffs argument and a Wuffs variable having the same name.
+const (
+	aPrefix = "a_" // Function argument.
+	iPrefix = "i_" // Iterate variable.
+	tPrefix = "t_" // Temporary variable.
+	vPrefix = "v_" // Local variable.
+)
+
+// These are the base package's WUFFS_BASE__MAGIC, WUFFS_BASE__DISABLED and
+// WUFFS_INITIALIZE__ALREADY_ZEROED values.
+const (
+	magic         = 0x3CCB6C71
+	disabled      = 0x075AE3D2
+	alreadyZeroed = 0x00000001
+)
+
+// magicSize is the size of the magic field at the start of every struct.
+const magicSize = 4
+
+var (
+	zero = big.NewInt(0)
+	one  = big.NewInt(1)
+)
+
+var errNoSuchBuiltin = errors.New("wasmgen: internal error: no such built-in")
+
+// Do transpiles a Wuffs program to a WebAssembly module.
+//
+// The arguments list the source Wuffs files. If no arguments are given, it
+// reads from stdin.
+//
+// The generated module is written to stdout, in the binary format or, if the
+// -wat flag is set, in the text format.
+func Do(args []string) error {
+	flags := flag.FlagSet{}
+	return generate.DoBackend(&flags, args, newBackend(&flags))
+}
+
+func init() {
+	generate.Register(newBackend)
+}
+
+// backend is the generate.Backend for WebAssembly. Each package is one
+// module, so it has no separate Header.
+type backend struct {
+	versionFlag *string
+	watFlag     *bool
+}
+
+func newBackend(flags *flag.FlagSet) generate.Backend {
+	return &backend{
+		versionFlag: flags.String("version", cf.VersionDefault, cf.VersionUsage),
+		watFlag:     flags.Bool("wat", false, "whether to write the WebAssembly text format instead of the binary format"),
+	}
+}
+
+func (b *backend) FileExtension() string                                   { return "wasm" }
+func (b *backend) Header(p *generate.Package) ([]byte, error)              { return nil, nil }
+func (b *backend) AuxFiles(p *generate.Package) (map[string][]byte, error) { return nil, nil }
+
+func (b *backend) Impl(p *generate.Package) ([]byte, error) {
+	v, ok := cf.ParseVersion(*b.versionFlag)
+	if !ok {
+		return nil, fmt.Errorf("bad -version flag value %q", *b.versionFlag)
+	}
+	return Generate(p.Name, p.TM, p.Files, &Options{
+		Version: v,
+		Text:    *b.watFlag,
+	})
+}
+
+// Options are optional arguments to Generate. A nil *Options is valid and
+// means the zero value.
+type Options struct {
+	// Version is the Wuffs version that the initialize functions check their
+	// wuffs_version argument against.
+	Version cf.Version
+
+	// Text is whether to return the WebAssembly text format instead of the
+	// binary format.
+	Text bool
+}
+
+// Generate is like Do, but its input is a checked Wuffs package, and it
+// returns the WebAssembly module instead of writing it out. The base package
+// has a pkgName of "base" and no files. Its module only has the base
+// package's statuses.
+func Generate(pkgName string, tm *t.Map, files []*a.File, opts *Options) ([]byte, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if tm == nil {
+		tm = &t.Map{}
+	}
+	g := &gen{
+		pkgName:       pkgName,
+		pkgPrefix:     "wuffs_" + pkgName + "__",
+		tm:            tm,
+		files:         files,
+		version:       opts.Version,
+		consts:        map[t.QID]*a.Const{},
+		constAddrs:    map[t.QID]int64{},
+		funcs:         map[t.QQID]*a.Func{},
+		funcIndexes:   map[t.QQID]int{},
+		statusAddrs:   map[t.QID]int64{},
+		structMap:     map[t.QID]*a.Struct{},
+		structLayouts: map[t.QID]*layout{},
+	}
+	if pkgName == "base" {
+		if len(files) != 0 {
+			return nil, fmt.Errorf("base package shouldn't have any .wuffs files")
+		}
+		for _, z := range builtin.Statuses {
+			id, err := g.tm.Insert(z)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := g.statusAddr(t.QID{t.IDBase, id}); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := g.generate(); err != nil {
+		return nil, err
+	}
+
+	g.mod.globals = append(g.mod.globals, &global{
+		name:   "__heap_base",
+		export: true,
+		typ:    i32,
+		value:  g.mod.heapBase(),
+	})
+	if opts.Text {
+		return g.mod.encodeText(), nil
+	}
+	return g.mod.encodeBinary(), nil
+}
+
+type buffer []byte
+
+func (b *buffer) Write(p []byte) (int, error) {
+	*b = append(*b, p...)
+	return len(p), nil
+}
+
+func (b *buffer) printf(format string, args ...interface{}) { fmt.Fprintf(b, format, args...) }
+func (b *buffer) writeb(x byte)                             { *b = append(*b, x) }
+func (b *buffer) writes(s string)                           { *b = append(*b, s...) }
+
+// Error is a code generation error, annotated with the Wuffs statement (or, if
+// there is none, the function) being generated.
+type Error struct {
+	Err      error
+	Filename string
+	Line     uint32
+}
+
+func (e *Error) Error() string {
+	msg := e.Err.Error()
+	if !strings.HasPrefix(msg, "wasmgen: ") {
+		msg = "wasmgen: " + msg
+	}
+	return fmt.Sprintf("%s at %s:%d", msg, e.Filename, e.Line)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func errorAt(n *a.Node, err error) error {
+	if err == nil {
+		return nil
+	} else if _, ok := err.(*Error); ok {
+		return err
+	}
+	filename, line := n.AsRaw().FilenameLine()
+	return &Error{Err: err, Filename: filename, Line: line}
+}
+
+type gen struct {
+	pkgName   string
+	pkgPrefix string
+	tm        *t.Map
+	files     []*a.File
+	version   cf.Version
+
+	mod module
+
+	consts        map[t.QID]*a.Const
+	constAddrs    map[t.QID]int64
+	funcs         map[t.QQID]*a.Func
+	funcIndexes   map[t.QQID]int
+	statusAddrs   map[t.QID]int64
+	structMap     map[t.QID]*a.Struct
+	structLayouts map[t.QID]*layout
+
+	// suspendible is the set of coroutines that can suspend, directly or
+	// indirectly, as per findSuspendible.
+	suspendible map[t.QQID]bool
+
+	currFunk funk
+}
+
+// layout is where a struct's fields are in linear memory, relative to the
+// struct's address. Every struct starts with a magicSize magic field.
+type layout struct {
+	size   uint32
+	align  uint32
+	fields map[t.ID]uint32
+}
+
+func (g *gen) forEachTopLevelDecl(kind a.Kind, f func(n *a.Node) error) error {
+	for _, file := range g.files {
+		for _, tld := range file.TopLevelDecls() {
+			if tld.Kind() != kind {
+				continue
+			}
+			if err := f(tld); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (g *gen) generate() error {
+	if err := g.forEachTopLevelDecl(a.KConst, func(n *a.Node) error {
+		g.consts[n.AsConst().QID()] = n.AsConst()
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := g.forEachTopLevelDecl(a.KStruct, func(n *a.Node) error {
+		g.structMap[n.AsStruct().QID()] = n.AsStruct()
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := g.forEachTopLevelDecl(a.KStruct, func(n *a.Node) error {
+		_, err := g.structLayout(n.AsStruct().QID())
+		return errorAt(n, err)
+	}); err != nil {
+		return err
+	}
+	if err := g.forEachTopLevelDecl(a.KFunc, func(n *a.Node) error {
+		g.funcs[n.AsFunc().QQID()] = n.AsFunc()
+		return nil
+	}); err != nil {
+		return err
+	}
+	g.findSuspendible()
+
+	// Public statuses are exported even if this package's code never refers
+	// to them.
+	if err := g.forEachTopLevelDecl(a.KStatus, func(n *a.Node) error {
+		if n.AsStatus().Public() {
+			_, err := g.statusAddr(n.AsStatus().QID())
+			return errorAt(n, err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Declare every function before generating any of their bodies, so that
+	// calls can refer to functions later in the source.
+	funcs := []*a.Func(nil)
+	if err := g.forEachTopLevelDecl(a.KFunc, func(n *a.Node) error {
+		f := n.AsFunc()
+		// The WebAssembly code always uses the portable implementation, so a
+		// function that needs a particular CPU architecture is never called.
+		if f.HasChooseCPUArch() {
+			return nil
+		}
+		if f.Effect().Coroutine() && g.suspendible[f.QQID()] {
+			return errorAt(n, fmt.Errorf("TODO: suspendible coroutine %s", f.QQID().Str(g.tm)))
+		}
+		fn, err := g.declareFunc(f)
+		if err != nil {
+			return errorAt(n, err)
+		}
+		g.funcIndexes[f.QQID()] = len(g.mod.funcs)
+		g.mod.funcs = append(g.mod.funcs, fn)
+		funcs = append(funcs, f)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, f := range funcs {
+		if err := errorAt(f.AsNode(), g.writeFunc(f)); err != nil {
+			return err
+		}
+	}
+
+	return g.forEachTopLevelDecl(a.KStruct, func(n *a.Node) error {
+		if n.AsStruct().Public() {
+			return errorAt(n, g.writeStructFuncs(n.AsStruct()))
+		}
+		return nil
+	})
+}
+
+func (g *gen) structCName(qid t.QID) string {
+	return g.pkgPrefix + qid[1].Str(g.tm)
+}
+
+// structLayout returns the layout of this package's struct qid. Fields are
+// placed in declaration order, each at its natural alignment.
+func (g *gen) structLayout(qid t.QID) (*layout, error) {
+	if l := g.structLayouts[qid]; l != nil {
+		if l.size == 0 {
+			return nil, fmt.Errorf("recursive struct %s", qid.Str(g.tm))
+		}
+		return l, nil
+	}
+	n := g.structMap[qid]
+	if (qid[0] != 0) || (n == nil) {
+		return nil, fmt.Errorf("TODO: struct %s from another package", qid.Str(g.tm))
+	}
+	l := &layout{align: magicSize, fields: map[t.ID]uint32{}}
+	g.structLayouts[qid] = l
+	offset := uint32(magicSize)
+	for _, o := range n.Fields() {
+		o := o.AsField()
+		size, align, err := g.sizeAlign(o.XType())
+		if err != nil {
+			return nil, err
+		}
+		offset = (offset + align - 1) &^ (align - 1)
+		l.fields[o.Name()] = offset
+		offset += size
+		if l.align < align {
+			l.align = align
+		}
+	}
+	l.size = (offset + l.align - 1) &^ (l.align - 1)
+	return l, nil
+}
+
+// sizeAlign returns the size and alignment, in linear memory, of a value of
+// type typ.
+func (g *gen) sizeAlign(typ *a.TypeExpr) (size uint32, align uint32, err error) {
+	switch typ.Decorator() {
+	case 0:
+		// No-op.
+	case t.IDArray:
+		size, align, err := g.sizeAlign(typ.Inner())
+		if err != nil {
+			return 0, 0, err
+		}
+		return size * uint32(typ.ArrayLength().ConstValue().Int64()), align, nil
+	case t.IDSlice:
+		return 8, 4, nil
+	case t.IDNptr, t.IDPtr:
+		return 4, 4, nil
+	default:
+		return 0, 0, fmt.Errorf("TODO: WebAssembly layout for %q", typ.Str(g.tm))
+	}
+
+	if bits := numBits(typ); bits > 0 {
+		return bits / 8, bits / 8, nil
+	} else if typ.IsBool() {
+		return 1, 1, nil
+	} else if typ.IsStatus() {
+		return 4, 4, nil
+	} else if l, err := g.structLayout(typ.QID()); err != nil {
+		return 0, 0, err
+	} else {
+		return l.size, l.align, nil
+	}
+}
+
+// numBits returns the bit width of the integer type typ, or zero if it isn't
+// an integer type.
+func numBits(typ *a.TypeExpr) uint32 {
+	if (typ.Decorator() != 0) || (typ.QID()[0] != t.IDBase) {
+		return 0
+	}
+	switch typ.QID()[1] {
+	case t.IDU8, t.IDI8:
+		return 8
+	case t.IDU16, t.IDI16:
+		return 16
+	case t.IDU32, t.IDI32:
+		return 32
+	case t.IDU64, t.IDI64:
+		return 64
+	}
+	return 0
+}
+
+// wasmType returns the WebAssembly value type of a scalar (not an array,
+// slice or struct) value of type typ.
+func (g *gen) wasmType(typ *a.TypeExpr) (valType, error) {
+	if typ.Decorator() == 0 {
+		if bits := numBits(typ); bits == 64 {
+			return i64, nil
+		} else if (bits > 0) || typ.IsBool() || typ.IsStatus() {
+			return i32, nil
+		}
+	} else if typ.IsPointerType() {
+		return i32, nil
+	}
+	return 0, fmt.Errorf("TODO: WebAssembly type for %q", typ.Str(g.tm))
+}
+
+// appendData appends p to the data, aligned to align bytes, and returns its
+// linear memory address.
+func (g *gen) appendData(p []byte, align int) int64 {
+	for len(g.mod.data)%align != 0 {
+		g.mod.data = append(g.mod.data, 0)
+	}
+	addr := dataBase + int64(len(g.mod.data))
+	g.mod.data = append(g.mod.data, p...)
+	return addr
+}
+
+// statusAddr returns the linear memory address of the status qid's message.
+// The first time it is called for a status, it appends the message to the
+// data and exports its address as a global, named like the C code's.
+func (g *gen) statusAddr(qid t.QID) (int64, error) {
+	if addr, ok := g.statusAddrs[qid]; ok {
+		return addr, nil
+	}
+	pkgName := g.pkgName
+	if qid[0] == t.IDBase {
+		pkgName = "base"
+	} else if qid[0] != 0 {
+		return 0, fmt.Errorf("TODO: status %s from another package", qid.Str(g.tm))
+	}
+	msg, _ := t.Unescape(qid[1].Str(g.tm))
+	if msg == "" {
+		return 0, fmt.Errorf("invalid status %q", msg)
+	}
+	category := "note__"
+	if msg[0] == '$' {
+		category = "suspension__"
+	} else if msg[0] == '#' {
+		category = "error__"
+	}
+
+	addr := g.appendData([]byte(msg[:1]+pkgName+": "+msg[1:]+"\x00"), 1)
+	g.statusAddrs[qid] = addr
+	g.mod.globals = append(g.mod.globals, &global{
+		name:   "wuffs_" + pkgName + "__" + category + cName(msg),
+		export: true,
+		typ:    i32,
+		value:  addr,
+	})
+	return addr, nil
+}
+
+// baseStatusAddr is like statusAddr for a base package status, such as "#bad
+// receiver".
+func (g *gen) baseStatusAddr(msg string) (int64, error) {
+	id, err := g.tm.Insert(`"` + msg + `"`)
+	if err != nil {
+		return 0, err
+	}
+	return g.statusAddr(t.QID{t.IDBase, id})
+}
+
+// constAddr returns the linear memory address of the array-typed const qid.
+func (g *gen) constAddr(qid t.QID) (int64, error) {
+	if addr, ok := g.constAddrs[qid]; ok {
+		return addr, nil
+	}
+	n := g.consts[qid]
+	if n == nil {
+		return 0, fmt.Errorf("unrecognized const %s", qid.Str(g.tm))
+	}
+	innermost := n.XType().Innermost()
+	bits := numBits(innermost)
+	if bits == 0 {
+		return 0, fmt.Errorf("TODO: const %s of type %q", qid.Str(g.tm), n.XType().Str(g.tm))
+	}
+	p := []byte(nil)
+	if err := g.appendConstList(&p, n.Value(), bits); err != nil {
+		return 0, err
+	}
+	addr := g.appendData(p, int(bits/8))
+	g.constAddrs[qid] = addr
+	return addr, nil
+}
+
+func (g *gen) appendConstList(p *[]byte, n *a.Expr, bits uint32) error {
+	if args, ok := n.IsList(); ok {
+		for _, o := range args {
+			if err := g.appendConstList(p, o.AsExpr(), bits); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	cv := n.ConstValue()
+	if cv == nil {
+		return fmt.Errorf("invalid const value %q", n.Str(g.tm))
+	}
+	x := [8]byte{}
+	binary.LittleEndian.PutUint64(x[:], uint64(constInt64(cv)))
+	*p = append(*p, x[:bits/8]...)
+	return nil
+}
+
+// constInt64 returns cv's low 64 bits, as a two's complement number.
+func constInt64(cv *big.Int) int64 {
+	if cv.IsInt64() {
+		return cv.Int64()
+	}
+	return int64(cv.Uint64())
+}
+
+// cName converts a status message, such as "#bad header", to the C code's
+// snake_case name, such as "bad_header".
+func cName(msg string) string {
+	s := []byte(nil)
+	underscore := true
+	for _, r := range msg {
+		if 'A' <= r && r <= 'Z' {
+			s = append(s, byte(r+'a'-'A'))
+			underscore = false
+		} else if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			s = append(s, byte(r))
+			underscore = false
+		} else if !underscore {
+			s = append(s, '_')
+			underscore = true
+		}
+	}
+	if underscore && (len(s) > 0) {
+		s = s[:len(s)-1]
+	}
+	return string(s)
+}
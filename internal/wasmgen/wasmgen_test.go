@@ -0,0 +1,242 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasmgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/adler32"
+	"hash/crc32"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/generate"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+// generateStd transpiles the std/pkgName Wuffs package to a WebAssembly
+// module, in the binary format.
+func generateStd(tt *testing.T, pkgName string) ([]byte, error) {
+	filenames, err := filepath.Glob(filepath.Join("..", "..", "std", pkgName, "*.wuffs"))
+	if err != nil {
+		tt.Fatalf("Glob: %v", err)
+	} else if len(filenames) == 0 {
+		tt.Fatalf("no std/%s files", pkgName)
+	}
+	tm := &t.Map{}
+	files, err := generate.ParseFiles(tm, filenames, nil)
+	if err != nil {
+		tt.Fatalf("ParseFiles: %v", err)
+	}
+	if _, err := check.Check(tm, files, nil, nil); err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	return Generate(pkgName, tm, files, nil)
+}
+
+// readULEB128 returns the unsigned LEB128 number at the start of b and its
+// length, or a zero length if b does not start with one.
+func readULEB128(b []byte) (x uint32, n int) {
+	for shift := uint(0); (n < len(b)) && (n < 5); shift += 7 {
+		c := b[n]
+		n++
+		x |= uint32(c&0x7F) << shift
+		if c < 0x80 {
+			return x, n
+		}
+	}
+	return 0, 0
+}
+
+// checkStructure checks a binary module's preamble and section framing: the
+// known sections are in order and every section's length is exact.
+func checkStructure(m []byte) error {
+	if (len(m) < 8) || (string(m[:8]) != "\x00asm\x01\x00\x00\x00") {
+		return fmt.Errorf("bad preamble")
+	}
+	prevID := byte(0)
+	for m = m[8:]; len(m) > 0; {
+		id := m[0]
+		if id > 12 {
+			return fmt.Errorf("bad section ID %d", id)
+		} else if (id != 0) && (id <= prevID) {
+			return fmt.Errorf("section ID %d follows section ID %d", id, prevID)
+		} else if id != 0 {
+			prevID = id
+		}
+		length, n := readULEB128(m[1:])
+		if (n == 0) || (uint64(length) > uint64(len(m)-1-n)) {
+			return fmt.Errorf("bad section %d length", id)
+		}
+		m = m[1+n+int(length):]
+	}
+	return nil
+}
+
+func TestStructure(tt *testing.T) {
+	for _, pkgName := range []string{"adler32", "crc32"} {
+		m, err := generateStd(tt, pkgName)
+		if err != nil {
+			tt.Errorf("%s: Generate: %v", pkgName, err)
+			continue
+		}
+		if err := checkStructure(m); err != nil {
+			tt.Errorf("%s: %v", pkgName, err)
+		}
+	}
+
+	m, err := Generate("base", nil, nil, nil)
+	if err != nil {
+		tt.Fatalf("base: Generate: %v", err)
+	}
+	if err := checkStructure(m); err != nil {
+		tt.Errorf("base: %v", err)
+	}
+}
+
+func TestUnsupportedIsAnError(tt *testing.T) {
+	// Packages with coroutines that can suspend are not supported yet.
+	if _, err := generateStd(tt, "deflate"); err == nil {
+		tt.Fatalf("Generate: got nil error, want a wasmgen: TODO error")
+	} else if !strings.Contains(err.Error(), "wasmgen: TODO") {
+		tt.Fatalf("Generate: got %q, want a wasmgen: TODO error", err)
+	}
+}
+
+// nodeScript validates and instantiates the module named by argv[2] and then,
+// for each of the JSON-encoded byte arrays in the file named by argv[4], hashes
+// it with the argv[3] struct's update_u32 method. It prints the hashes as a
+// JSON array.
+const nodeScript = `
+const fs = require("fs");
+const [, , moduleFilename, structName, inputsFilename] = process.argv;
+const bytes = fs.readFileSync(moduleFilename);
+if (!WebAssembly.validate(bytes)) {
+  throw new Error("WebAssembly.validate failed");
+}
+const e = new WebAssembly.Instance(new WebAssembly.Module(bytes), {}).exports;
+const inputs = JSON.parse(fs.readFileSync(inputsFilename, "utf8"));
+
+const self = e.__heap_base.value;
+const size = e["sizeof__" + structName]();
+const data = (self + size + 15) & ~15;
+const maxLen = Math.max(0, ...inputs.map((x) => x.length));
+const need = data + maxLen - e.memory.buffer.byteLength;
+if (need > 0) {
+  e.memory.grow(Math.ceil(need / 65536));
+}
+
+const hashes = [];
+for (const input of inputs) {
+  const status = e[structName + "__initialize"](self, size, 0n, 0);
+  if (status !== 0) {
+    throw new Error("initialize failed: status address " + status);
+  }
+  new Uint8Array(e.memory.buffer, data, input.length).set(input);
+  hashes.push(e[structName + "__update_u32"](self, data, input.length) >>> 0);
+}
+console.log(JSON.stringify(hashes));
+`
+
+func TestRunWithNode(tt *testing.T) {
+	if testing.Short() {
+		tt.Skip("skipping test that runs node in short mode")
+	}
+	nodeTool, err := exec.LookPath("node")
+	if err != nil {
+		tt.Skip("skipping test: no node")
+	}
+
+	dir, err := ioutil.TempDir("", "wasmgen_test")
+	if err != nil {
+		tt.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	scriptFilename := filepath.Join(dir, "run.js")
+	if err := ioutil.WriteFile(scriptFilename, []byte(nodeScript), 0644); err != nil {
+		tt.Fatalf("WriteFile: %v", err)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	inputs := [][]int(nil)
+	for i := 0; i < 100; i++ {
+		input := make([]int, rng.Intn(10000))
+		for j := range input {
+			input[j] = rng.Intn(256)
+		}
+		inputs = append(inputs, input)
+	}
+	inputsJSON, err := json.Marshal(inputs)
+	if err != nil {
+		tt.Fatalf("json.Marshal: %v", err)
+	}
+	inputsFilename := filepath.Join(dir, "inputs.json")
+	if err := ioutil.WriteFile(inputsFilename, inputsJSON, 0644); err != nil {
+		tt.Fatalf("WriteFile: %v", err)
+	}
+
+	testCases := []struct {
+		pkgName    string
+		structName string
+		hash       func([]byte) uint32
+	}{
+		{"adler32", "wuffs_adler32__hasher", adler32.Checksum},
+		{"crc32", "wuffs_crc32__ieee_hasher", crc32.ChecksumIEEE},
+	}
+
+	for _, tc := range testCases {
+		m, err := generateStd(tt, tc.pkgName)
+		if err != nil {
+			tt.Errorf("%s: Generate: %v", tc.pkgName, err)
+			continue
+		}
+		moduleFilename := filepath.Join(dir, tc.pkgName+".wasm")
+		if err := ioutil.WriteFile(moduleFilename, m, 0644); err != nil {
+			tt.Fatalf("WriteFile: %v", err)
+		}
+
+		out, err := exec.Command(nodeTool, scriptFilename, moduleFilename, tc.structName, inputsFilename).CombinedOutput()
+		if err != nil {
+			tt.Errorf("%s: node: %v\n%s", tc.pkgName, err, out)
+			continue
+		}
+		got := []uint32(nil)
+		if err := json.Unmarshal(out, &got); err != nil {
+			tt.Errorf("%s: json.Unmarshal: %v\n%s", tc.pkgName, err, out)
+			continue
+		} else if len(got) != len(inputs) {
+			tt.Errorf("%s: got %d hashes, want %d", tc.pkgName, len(got), len(inputs))
+			continue
+		}
+		for i, input := range inputs {
+			b := make([]byte, len(input))
+			for j, x := range input {
+				b[j] = byte(x)
+			}
+			if want := tc.hash(b); got[i] != want {
+				tt.Errorf("%s: input #%d (length %d): got 0x%08X, want 0x%08X",
+					tc.pkgName, i, len(b), got[i], want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast
+
+// arenaChunkLen is the number of Nodes in each of an Arena's chunks.
+const arenaChunkLen = 1024
+
+// Arena allocates Nodes in chunks, instead of one at a time, so that building
+// the AST of a large package makes fewer, larger heap allocations. This
+// reduces the work for the garbage collector, both while compiling and when
+// the AST is no longer needed.
+//
+// Every Node in a chunk is live for as long as any one of them is. An Arena
+// is therefore meant to be used for one compilation (parsing, checking and
+// generating code for one package), after which its Nodes are all dropped
+// together. Holding on to a single Node from that compilation holds on to its
+// whole chunk.
+//
+// An Arena is not safe for concurrent use. The zero value is an empty Arena,
+// ready to use. A nil *Arena is also valid: its NewEtc methods allocate each
+// Node separately, like the package-level NewEtc functions.
+type Arena struct {
+	chunk []Node
+}
+
+// NewArena returns a new, empty Arena.
+func NewArena() *Arena {
+	return &Arena{}
+}
+
+func (z *Arena) alloc() *Node {
+	if z == nil {
+		return &Node{}
+	}
+	if len(z.chunk) == 0 {
+		z.chunk = make([]Node, arenaChunkLen)
+	}
+	n := &z.chunk[0]
+	z.chunk = z.chunk[1:]
+	return n
+}
@@ -43,6 +43,7 @@ const (
 	KChoose
 	KConst
 	KExpr
+	KFeature
 	KField
 	KFile
 	KFunc
@@ -50,9 +51,12 @@ const (
 	KIf
 	KIterate
 	KJump
+	KLemma
+	KPragma
 	KRet
 	KStatus
 	KStruct
+	KTest
 	KTypeExpr
 	KUse
 	KVar
@@ -75,6 +79,7 @@ var kindStrings = [...]string{
 	KChoose:   "KChoose",
 	KConst:    "KConst",
 	KExpr:     "KExpr",
+	KFeature:  "KFeature",
 	KField:    "KField",
 	KFile:     "KFile",
 	KFunc:     "KFunc",
@@ -82,9 +87,12 @@ var kindStrings = [...]string{
 	KIf:       "KIf",
 	KIterate:  "KIterate",
 	KJump:     "KJump",
+	KLemma:    "KLemma",
+	KPragma:   "KPragma",
 	KRet:      "KRet",
 	KStatus:   "KStatus",
 	KStruct:   "KStruct",
+	KTest:     "KTest",
 	KTypeExpr: "KTypeExpr",
 	KUse:      "KUse",
 	KVar:      "KVar",
@@ -107,6 +115,12 @@ const (
 	FlagsPrivateData      = Flags(0x00008000)
 	FlagsChoosy           = Flags(0x00010000)
 	FlagsHasChooseCPUArch = Flags(0x00020000)
+	FlagsSpecialized      = Flags(0x00040000)
+	FlagsProbe            = Flags(0x00080000)
+	FlagsSeekable         = Flags(0x00100000)
+	FlagsRecursive        = Flags(0x00200000)
+	FlagsWorkbufLess      = Flags(0x00400000)
+	FlagsAsExclam         = Flags(0x00800000)
 )
 
 func (f Flags) AsEffect() Effect { return Effect(f) }
@@ -156,6 +170,13 @@ type Node struct {
 	filename string
 	line     uint32
 
+	// column, endLine and endColumn complete, with line, the node's source
+	// span. They are zero if unknown, such as for nodes that were created by
+	// the checker instead of the parser.
+	column    uint32
+	endLine   uint32
+	endColumn uint32
+
 	// The idX fields' meaning depend on what kind of node it is.
 	//
 	// kind          id0           id1           id2           kind
@@ -173,9 +194,11 @@ type Node struct {
 	// If            .             .             .             If
 	// Iterate       advance       label         length        Iterate
 	// Jump          keyword       label         .             Jump
+	// Pragma        .             key           value         Pragma
 	// Ret           keyword       .             .             Ret
 	// Status        keyword       pkg           lit(message)  Status
 	// Struct        .             pkg           name          Struct
+	// Test          .             .             lit(name)     Test
 	// TypeExpr      decorator     pkg           name          TypeExpr
 	// Use           .             .             lit(path)     Use
 	// Var           operator      .             name          Var
@@ -205,6 +228,7 @@ func (n *Node) AsAssign() *Assign     { return (*Assign)(n) }
 func (n *Node) AsChoose() *Choose     { return (*Choose)(n) }
 func (n *Node) AsConst() *Const       { return (*Const)(n) }
 func (n *Node) AsExpr() *Expr         { return (*Expr)(n) }
+func (n *Node) AsFeature() *Feature   { return (*Feature)(n) }
 func (n *Node) AsField() *Field       { return (*Field)(n) }
 func (n *Node) AsFile() *File         { return (*File)(n) }
 func (n *Node) AsFunc() *Func         { return (*Func)(n) }
@@ -212,10 +236,13 @@ func (n *Node) AsIOBind() *IOBind     { return (*IOBind)(n) }
 func (n *Node) AsIf() *If             { return (*If)(n) }
 func (n *Node) AsIterate() *Iterate   { return (*Iterate)(n) }
 func (n *Node) AsJump() *Jump         { return (*Jump)(n) }
+func (n *Node) AsLemma() *Lemma       { return (*Lemma)(n) }
+func (n *Node) AsPragma() *Pragma     { return (*Pragma)(n) }
 func (n *Node) AsRaw() *Raw           { return (*Raw)(n) }
 func (n *Node) AsRet() *Ret           { return (*Ret)(n) }
 func (n *Node) AsStatus() *Status     { return (*Status)(n) }
 func (n *Node) AsStruct() *Struct     { return (*Struct)(n) }
+func (n *Node) AsTest() *Test         { return (*Test)(n) }
 func (n *Node) AsTypeExpr() *TypeExpr { return (*TypeExpr)(n) }
 func (n *Node) AsUse() *Use           { return (*Use)(n) }
 func (n *Node) AsVar() *Var           { return (*Var)(n) }
@@ -242,8 +269,81 @@ func (n *Node) Walk(f func(*Node) error) error {
 	return nil
 }
 
+// Clone returns a deep copy of n. If replace is non-nil, it is called on each
+// node before copying it and, if it returns non-nil, that result is used
+// (without copying) instead. The copy's Jump nodes target the copied loops.
+// Clone is intended for ASTs that have not yet been type checked: the MType,
+// MBounds and constant values are not copied.
+func (n *Node) Clone(replace func(*Node) *Node) *Node {
+	loops := map[*Node]*Node{}
+	ret := n.clone(replace, loops)
+	ret.Walk(func(o *Node) error {
+		if o.kind == KJump && o.jumpTarget != nil {
+			if l := loops[o.jumpTarget.AsNode()]; l != nil {
+				o.jumpTarget = l.asLoop()
+			}
+		}
+		return nil
+	})
+	return ret
+}
+
+func (n *Node) clone(replace func(*Node) *Node, loops map[*Node]*Node) *Node {
+	if n == nil {
+		return nil
+	}
+	if replace != nil {
+		if o := replace(n); o != nil {
+			return o
+		}
+	}
+	ret := &Node{
+		kind:       n.kind,
+		flags:      n.flags,
+		jumpTarget: n.jumpTarget,
+		filename:   n.filename,
+		line:       n.line,
+		column:     n.column,
+		endLine:    n.endLine,
+		endColumn:  n.endColumn,
+		id0:        n.id0,
+		id1:        n.id1,
+		id2:        n.id2,
+		lhs:        n.lhs.clone(replace, loops),
+		mhs:        n.mhs.clone(replace, loops),
+		rhs:        n.rhs.clone(replace, loops),
+		list0:      cloneList(n.list0, replace, loops),
+		list1:      cloneList(n.list1, replace, loops),
+		list2:      cloneList(n.list2, replace, loops),
+	}
+	if (n.kind == KIterate) || (n.kind == KWhile) {
+		loops[n] = ret
+	}
+	return ret
+}
+
+func cloneList(l []*Node, replace func(*Node) *Node, loops map[*Node]*Node) []*Node {
+	if l == nil {
+		return nil
+	}
+	ret := make([]*Node, len(l))
+	for i, o := range l {
+		ret[i] = o.clone(replace, loops)
+	}
+	return ret
+}
+
+func (n *Node) asLoop() Loop {
+	if n.kind == KIterate {
+		return n.AsIterate()
+	}
+	return n.AsWhile()
+}
+
 func dropExprCachedMBounds(n *Node) error {
-	if n.kind == KExpr {
+	// A constant's bounds cannot change. Leaving them be also means that an
+	// assertion can share a constant expression with other goroutines.
+	if (n.kind == KExpr) && (n.constValue == nil) {
 		n.mBounds = interval.IntRange{nil, nil}
 	}
 	return nil
@@ -287,10 +387,24 @@ type Raw Node
 func (n *Raw) AsNode() *Node                  { return (*Node)(n) }
 func (n *Raw) Flags() Flags                   { return n.flags }
 func (n *Raw) FilenameLine() (string, uint32) { return n.filename, n.line }
+func (n *Raw) IDs() [3]t.ID                   { return [3]t.ID{n.id0, n.id1, n.id2} }
 func (n *Raw) SubNodes() [3]*Node             { return [3]*Node{n.lhs, n.mhs, n.rhs} }
 func (n *Raw) SubLists() [3][]*Node           { return [3][]*Node{n.list0, n.list1, n.list2} }
 
 func (n *Raw) SetFilenameLine(f string, l uint32) { n.filename, n.line = f, l }
+func (n *Raw) SetSubNodes(x [3]*Node)             { n.lhs, n.mhs, n.rhs = x[0], x[1], x[2] }
+func (n *Raw) SetSubLists(x [3][]*Node)           { n.list0, n.list1, n.list2 = x[0], x[1], x[2] }
+
+// Span returns the node's source span. Its Line is the same as that returned
+// by FilenameLine. Its Column is zero if only the line is known.
+func (n *Raw) Span() t.Span {
+	return t.Span{Line: n.line, Column: n.column, EndLine: n.endLine, EndColumn: n.endColumn}
+}
+
+// SetSpan sets the node's source span, including its line.
+func (n *Raw) SetSpan(s t.Span) {
+	n.line, n.column, n.endLine, n.endColumn = s.Line, s.Column, s.EndLine, s.EndColumn
+}
 
 func (n *Raw) SetPackage(tm *t.Map, pkg t.ID) error {
 	return n.AsNode().Walk(func(o *Node) error {
@@ -298,7 +412,7 @@ func (n *Raw) SetPackage(tm *t.Map, pkg t.ID) error {
 		default:
 			return nil
 
-		case KConst, KFunc, KStatus, KStruct:
+		case KConst, KFeature, KFunc, KStatus, KStruct:
 			// No-op.
 
 		case KExpr:
@@ -355,7 +469,13 @@ const MaxExprDepth = 255
 //
 // For selectors, like "LHS.ID2", ID0 is IDDot.
 //
+// For conversions, like "LHS as RHS" or "LHS as! RHS", ID0 is IDXBinaryAs and
+// RHS is a TypeExpr. The "as!" form also has the FlagsAsExclam flag.
+//
 // For lists, like "[0, 1, 2]", ID0 is IDComma.
+//
+// For feature queries, like "feature LHS.ID2" or "feature ID2", ID0 is
+// IDFeature and LHS, if non-nil, is the package.
 type Expr Node
 
 const (
@@ -367,6 +487,7 @@ const (
 )
 
 func (n *Expr) AsNode() *Node              { return (*Node)(n) }
+func (n *Expr) AsExclam() bool             { return n.flags&FlagsAsExclam != 0 }
 func (n *Expr) Effect() Effect             { return Effect(n.flags) }
 func (n *Expr) GlobalIdent() bool          { return n.flags&FlagsGlobalIdent != 0 }
 func (n *Expr) SubExprHasEffect() bool     { return n.flags&FlagsSubExprHasEffect != 0 }
@@ -385,6 +506,8 @@ func (n *Expr) SetGlobalIdent()                { n.flags |= FlagsGlobalIdent }
 func (n *Expr) SetMBounds(x interval.IntRange) { n.mBounds = x }
 func (n *Expr) SetMType(x *TypeExpr)           { n.mType = x }
 
+func (n *Expr) DropCachedMBounds() error { return n.AsNode().Walk(dropExprCachedMBounds) }
+
 func (n *Expr) IsArgsDotFoo() (foo t.ID) {
 	if n.id0 == t.IDDot {
 		if (n.lhs.id0 == 0) && (n.lhs.id2 == t.IDArgs) {
@@ -432,6 +555,10 @@ func (n *Expr) IsSlice() (arrayOrSlice *Expr, lo *Expr, hi *Expr, ok bool) {
 }
 
 func NewExpr(flags Flags, operator t.ID, ident t.ID, lhs *Node, mhs *Node, rhs *Node, args []*Node) *Expr {
+	return (*Arena)(nil).NewExpr(flags, operator, ident, lhs, mhs, rhs, args)
+}
+
+func (z *Arena) NewExpr(flags Flags, operator t.ID, ident t.ID, lhs *Node, mhs *Node, rhs *Node, args []*Node) *Expr {
 	subExprEffect := Flags(0)
 	if lhs != nil {
 		subExprEffect |= lhs.flags & Flags(effectMask)
@@ -449,7 +576,8 @@ func NewExpr(flags Flags, operator t.ID, ident t.ID, lhs *Node, mhs *Node, rhs *
 		flags |= subExprEffect | FlagsSubExprHasEffect
 	}
 
-	return &Expr{
+	x := (*Expr)(z.alloc())
+	*x = Expr{
 		kind:  KExpr,
 		flags: flags,
 		id0:   operator,
@@ -459,6 +587,7 @@ func NewExpr(flags Flags, operator t.ID, ident t.ID, lhs *Node, mhs *Node, rhs *
 		rhs:   rhs,
 		list0: args,
 	}
+	return x
 }
 
 // Assert is "assert RHS via ID2(args)", "choose etc", "pre etc", "inv etc" or
@@ -491,20 +620,26 @@ func (n *Assert) IsChooseCPUArch() bool {
 		return false
 	}
 	switch rhs.Ident() {
-	case t.IDARMCRC32, t.IDARMNeon, t.IDX86SSE42, t.IDX86AVX2:
+	case t.IDARMCRC32, t.IDARMNeon, t.IDARMSVE, t.IDRISCVV, t.IDX86SSE42, t.IDX86AVX2:
 		return true
 	}
 	return false
 }
 
 func NewAssert(keyword t.ID, condition *Expr, reason t.ID, args []*Node) *Assert {
-	return &Assert{
+	return (*Arena)(nil).NewAssert(keyword, condition, reason, args)
+}
+
+func (z *Arena) NewAssert(keyword t.ID, condition *Expr, reason t.ID, args []*Node) *Assert {
+	x := (*Assert)(z.alloc())
+	*x = Assert{
 		kind:  KAssert,
 		id0:   keyword,
 		id2:   reason,
 		rhs:   condition.AsNode(),
 		list0: args,
 	}
+	return x
 }
 
 // Arg is "name:value".
@@ -512,16 +647,25 @@ func NewAssert(keyword t.ID, condition *Expr, reason t.ID, args []*Node) *Assert
 //  - RHS:   <Expr> value
 type Arg Node
 
-func (n *Arg) AsNode() *Node { return (*Node)(n) }
-func (n *Arg) Name() t.ID    { return n.id2 }
-func (n *Arg) Value() *Expr  { return n.rhs.AsExpr() }
+func (n *Arg) AsNode() *Node     { return (*Node)(n) }
+func (n *Arg) Specialized() bool { return n.flags&FlagsSpecialized != 0 }
+func (n *Arg) Name() t.ID        { return n.id2 }
+func (n *Arg) Value() *Expr      { return n.rhs.AsExpr() }
+
+func (n *Arg) SetSpecialized() { n.flags |= FlagsSpecialized }
 
 func NewArg(name t.ID, value *Expr) *Arg {
-	return &Arg{
+	return (*Arena)(nil).NewArg(name, value)
+}
+
+func (z *Arena) NewArg(name t.ID, value *Expr) *Arg {
+	x := (*Arg)(z.alloc())
+	*x = Arg{
 		kind: KArg,
 		id2:  name,
 		rhs:  value.AsNode(),
 	}
+	return x
 }
 
 // Assign is "LHS = RHS" or "LHS op= RHS" or "RHS":
@@ -536,12 +680,18 @@ func (n *Assign) LHS() *Expr     { return n.lhs.AsExpr() }
 func (n *Assign) RHS() *Expr     { return n.rhs.AsExpr() }
 
 func NewAssign(operator t.ID, lhs *Expr, rhs *Expr) *Assign {
-	return &Assign{
+	return (*Arena)(nil).NewAssign(operator, lhs, rhs)
+}
+
+func (z *Arena) NewAssign(operator t.ID, lhs *Expr, rhs *Expr) *Assign {
+	x := (*Assign)(z.alloc())
+	*x = Assign{
 		kind: KAssign,
 		id0:  operator,
 		lhs:  lhs.AsNode(),
 		rhs:  rhs.AsNode(),
 	}
+	return x
 }
 
 // Var is "var ID2 LHS":
@@ -556,31 +706,45 @@ func (n *Var) Name() t.ID       { return n.id2 }
 func (n *Var) XType() *TypeExpr { return n.lhs.AsTypeExpr() }
 
 func NewVar(name t.ID, xType *TypeExpr) *Var {
-	return &Var{
+	return (*Arena)(nil).NewVar(name, xType)
+}
+
+func (z *Arena) NewVar(name t.ID, xType *TypeExpr) *Var {
+	x := (*Var)(z.alloc())
+	*x = Var{
 		kind: KVar,
 		id2:  name,
 		lhs:  xType.AsNode(),
 	}
+	return x
 }
 
 // Field is a "name : type" struct field:
+//  - FlagsPublic      is "pub name : type", a field with a generated getter.
 //  - FlagsPrivateData is the initializer need not explicitly memset to zero.
 //  - ID2:   name
 //  - LHS:   <TypeExpr>
 type Field Node
 
 func (n *Field) AsNode() *Node     { return (*Node)(n) }
+func (n *Field) Public() bool      { return n.flags&FlagsPublic != 0 }
 func (n *Field) PrivateData() bool { return n.flags&FlagsPrivateData != 0 }
 func (n *Field) Name() t.ID        { return n.id2 }
 func (n *Field) XType() *TypeExpr  { return n.lhs.AsTypeExpr() }
 
 func NewField(flags Flags, name t.ID, xType *TypeExpr) *Field {
-	return &Field{
+	return (*Arena)(nil).NewField(flags, name, xType)
+}
+
+func (z *Arena) NewField(flags Flags, name t.ID, xType *TypeExpr) *Field {
+	x := (*Field)(z.alloc())
+	*x = Field{
 		kind:  KField,
 		flags: flags,
 		id2:   name,
 		lhs:   xType.AsNode(),
 	}
+	return x
 }
 
 // IOBind is "io_bind (io:LHS, data:MHS) { List2 }" or "io_limit (io:LHS,
@@ -598,13 +762,19 @@ func (n *IOBind) Arg1() *Expr   { return n.mhs.AsExpr() }
 func (n *IOBind) Body() []*Node { return n.list2 }
 
 func NewIOBind(keyword t.ID, io *Expr, arg1 *Expr, body []*Node) *IOBind {
-	return &IOBind{
+	return (*Arena)(nil).NewIOBind(keyword, io, arg1, body)
+}
+
+func (z *Arena) NewIOBind(keyword t.ID, io *Expr, arg1 *Expr, body []*Node) *IOBind {
+	x := (*IOBind)(z.alloc())
+	*x = IOBind{
 		kind:  KIOBind,
 		id0:   keyword,
 		lhs:   io.AsNode(),
 		mhs:   arg1.AsNode(),
 		list2: body,
 	}
+	return x
 }
 
 // Iterate is
@@ -641,7 +811,12 @@ func (n *Iterate) SetHasBreak()              { n.flags |= FlagsHasBreak }
 func (n *Iterate) SetHasContinue()           { n.flags |= FlagsHasContinue }
 
 func NewIterate(label t.ID, assigns []*Node, length t.ID, advance t.ID, unroll t.ID, asserts []*Node) *Iterate {
-	return &Iterate{
+	return (*Arena)(nil).NewIterate(label, assigns, length, advance, unroll, asserts)
+}
+
+func (z *Arena) NewIterate(label t.ID, assigns []*Node, length t.ID, advance t.ID, unroll t.ID, asserts []*Node) *Iterate {
+	x := (*Iterate)(z.alloc())
+	*x = Iterate{
 		kind:  KIterate,
 		id0:   advance,
 		id1:   label,
@@ -650,13 +825,15 @@ func NewIterate(label t.ID, assigns []*Node, length t.ID, advance t.ID, unroll t
 		list0: assigns,
 		list1: asserts,
 	}
+	return x
 }
 
-// While is "while.ID1 MHS, List1 { List2 } endwhile.ID1":
+// While is "while.ID1 MHS, decreases RHS, List1 { List2 } endwhile.ID1":
 //  - FlagsHasBreak    is the while has an explicit break
 //  - FlagsHasContinue is the while has an explicit continue
 //  - ID1:   <0|label>
 //  - MHS:   <Expr>
+//  - RHS:   <nil|Expr> decreases
 //  - List1: <Assert> asserts
 //  - List2: <Statement> body
 //
@@ -669,6 +846,7 @@ func (n *While) HasContinue() bool { return n.flags&FlagsHasContinue != 0 }
 func (n *While) Keyword() t.ID     { return t.IDWhile }
 func (n *While) Label() t.ID       { return n.id1 }
 func (n *While) Condition() *Expr  { return n.mhs.AsExpr() }
+func (n *While) Decreases() *Expr  { return n.rhs.AsExpr() }
 func (n *While) Asserts() []*Node  { return n.list1 }
 func (n *While) Body() []*Node     { return n.list2 }
 
@@ -681,13 +859,20 @@ func (n *While) IsWhileTrue() bool {
 	return (condition.Operator() == 0) && (condition.Ident() == t.IDTrue)
 }
 
-func NewWhile(label t.ID, condition *Expr, asserts []*Node) *While {
-	return &While{
+func NewWhile(label t.ID, condition *Expr, decreases *Expr, asserts []*Node) *While {
+	return (*Arena)(nil).NewWhile(label, condition, decreases, asserts)
+}
+
+func (z *Arena) NewWhile(label t.ID, condition *Expr, decreases *Expr, asserts []*Node) *While {
+	x := (*While)(z.alloc())
+	*x = While{
 		kind:  KWhile,
 		id1:   label,
 		mhs:   condition.AsNode(),
+		rhs:   decreases.AsNode(),
 		list1: asserts,
 	}
+	return x
 }
 
 // If is "if MHS { List2 } else RHS" or "if MHS { List2 } else { List1 }":
@@ -704,13 +889,19 @@ func (n *If) BodyIfTrue() []*Node  { return n.list2 }
 func (n *If) BodyIfFalse() []*Node { return n.list1 }
 
 func NewIf(condition *Expr, bodyIfTrue []*Node, bodyIfFalse []*Node, elseIf *If) *If {
-	return &If{
+	return (*Arena)(nil).NewIf(condition, bodyIfTrue, bodyIfFalse, elseIf)
+}
+
+func (z *Arena) NewIf(condition *Expr, bodyIfTrue []*Node, bodyIfFalse []*Node, elseIf *If) *If {
+	x := (*If)(z.alloc())
+	*x = If{
 		kind:  KIf,
 		mhs:   condition.AsNode(),
 		rhs:   elseIf.AsNode(),
 		list1: bodyIfFalse,
 		list2: bodyIfTrue,
 	}
+	return x
 }
 
 // Choose is "choose ID2: List0":
@@ -723,17 +914,25 @@ func (n *Choose) Name() t.ID    { return n.id2 }
 func (n *Choose) Args() []*Node { return n.list0 }
 
 func NewChoose(name t.ID, args []*Node) *Choose {
-	return &Choose{
+	return (*Arena)(nil).NewChoose(name, args)
+}
+
+func (z *Arena) NewChoose(name t.ID, args []*Node) *Choose {
+	x := (*Choose)(z.alloc())
+	*x = Choose{
 		kind:  KChoose,
 		id2:   name,
 		list0: args,
 	}
+	return x
 }
 
 // Ret is "return LHS" or "yield LHS":
 //  - FlagsReturnsError LHS is an error status
 //  - ID0:   <IDReturn|IDYield>
 //  - LHS:   <Expr>
+//
+// The checker records a yield's TokensNeeded in the node's constValue field.
 type Ret Node
 
 func (n *Ret) AsNode() *Node   { return (*Node)(n) }
@@ -743,12 +942,26 @@ func (n *Ret) Value() *Expr    { return n.lhs.AsExpr() }
 
 func (n *Ret) SetRetsError() { n.flags |= FlagsRetsError }
 
+// TokensNeeded is, for a yield of "$short write" in a coroutine that writes
+// tokens, how many tokens the coroutine needs room for, in its
+// base.token_writer, to make progress. The checker derives it from the facts
+// guarding that yield. It is nil otherwise.
+func (n *Ret) TokensNeeded() *big.Int { return n.constValue }
+
+func (n *Ret) SetTokensNeeded(x *big.Int) { n.constValue = x }
+
 func NewRet(keyword t.ID, value *Expr) *Ret {
-	return &Ret{
+	return (*Arena)(nil).NewRet(keyword, value)
+}
+
+func (z *Arena) NewRet(keyword t.ID, value *Expr) *Ret {
+	x := (*Ret)(z.alloc())
+	*x = Ret{
 		kind: KRet,
 		id0:  keyword,
 		lhs:  value.AsNode(),
 	}
+	return x
 }
 
 // Jump is "break" or "continue", with an optional label, "break.label":
@@ -764,11 +977,17 @@ func (n *Jump) Label() t.ID      { return n.id1 }
 func (n *Jump) SetJumpTarget(o Loop) { n.jumpTarget = o }
 
 func NewJump(keyword t.ID, label t.ID) *Jump {
-	return &Jump{
+	return (*Arena)(nil).NewJump(keyword, label)
+}
+
+func (z *Arena) NewJump(keyword t.ID, label t.ID) *Jump {
+	x := (*Jump)(z.alloc())
+	*x = Jump{
 		kind: KJump,
 		id0:  keyword,
 		id1:  label,
 	}
+	return x
 }
 
 // MaxTypeExprDepth is an advisory limit for a TypeExpr's recursion depth.
@@ -901,6 +1120,11 @@ func (n *TypeExpr) IsTableType() bool {
 	return n.id0 == t.IDTable
 }
 
+func (n *TypeExpr) IsSignedInteger() bool {
+	return n.id0 == 0 && n.id1 == t.IDBase &&
+		(n.id2 == t.IDI8 || n.id2 == t.IDI16 || n.id2 == t.IDI32 || n.id2 == t.IDI64)
+}
+
 func (n *TypeExpr) IsUnsignedInteger() bool {
 	return n.id0 == 0 && n.id1 == t.IDBase &&
 		(n.id2 == t.IDU8 || n.id2 == t.IDU16 || n.id2 == t.IDU32 || n.id2 == t.IDU64)
@@ -935,7 +1159,12 @@ func (n *TypeExpr) Unrefined() *TypeExpr {
 }
 
 func NewTypeExpr(decorator t.ID, pkg t.ID, name t.ID, alenRecvMin *Node, max *Expr, inner *TypeExpr) *TypeExpr {
-	return &TypeExpr{
+	return (*Arena)(nil).NewTypeExpr(decorator, pkg, name, alenRecvMin, max, inner)
+}
+
+func (z *Arena) NewTypeExpr(decorator t.ID, pkg t.ID, name t.ID, alenRecvMin *Node, max *Expr, inner *TypeExpr) *TypeExpr {
+	x := (*TypeExpr)(z.alloc())
+	*x = TypeExpr{
 		kind: KTypeExpr,
 		id0:  decorator,
 		id1:  pkg,
@@ -944,11 +1173,15 @@ func NewTypeExpr(decorator t.ID, pkg t.ID, name t.ID, alenRecvMin *Node, max *Ex
 		mhs:  max.AsNode(),
 		rhs:  inner.AsNode(),
 	}
+	return x
 }
 
 // MaxBodyDepth is an advisory limit for a function body's recursion depth.
 const MaxBodyDepth = 255
 
+// MaxRecursionDepth is the limit for a recursive coroutine's maximum depth.
+const MaxRecursionDepth = 256
+
 // Func is "func ID2.ID0(LHS)(RHS) { List2 }":
 //  - FlagsPublic      is "pub" vs "pri"
 //  - ID0:   funcName
@@ -964,7 +1197,11 @@ func (n *Func) AsNode() *Node          { return (*Node)(n) }
 func (n *Func) Choosy() bool           { return n.flags&FlagsChoosy != 0 }
 func (n *Func) Effect() Effect         { return Effect(n.flags) }
 func (n *Func) HasChooseCPUArch() bool { return n.flags&FlagsHasChooseCPUArch != 0 }
+func (n *Func) Probe() bool            { return n.flags&FlagsProbe != 0 }
 func (n *Func) Public() bool           { return n.flags&FlagsPublic != 0 }
+func (n *Func) Seekable() bool         { return n.flags&FlagsSeekable != 0 }
+func (n *Func) Recursive() bool        { return n.flags&FlagsRecursive != 0 }
+func (n *Func) WorkbufLess() bool      { return n.flags&FlagsWorkbufLess != 0 }
 func (n *Func) Filename() string       { return n.filename }
 func (n *Func) Line() uint32           { return n.line }
 func (n *Func) QQID() t.QQID           { return t.QQID{n.id1, n.id2, n.id0} }
@@ -975,6 +1212,31 @@ func (n *Func) Out() *TypeExpr         { return n.rhs.AsTypeExpr() }
 func (n *Func) Asserts() []*Node       { return n.list1 }
 func (n *Func) Body() []*Node          { return n.list2 }
 
+// RecursionDepth returns the maximum depth of a recursive coroutine: one more
+// than its "depth" in-param's (checked) upper bound. It returns zero if n is
+// not recursive or that in-param is missing or unsuitable.
+func (n *Func) RecursionDepth(tm *t.Map) uint64 {
+	if !n.Recursive() {
+		return 0
+	}
+	depth := tm.ByName("depth")
+	for _, o := range n.In().Fields() {
+		o := o.AsField()
+		if (depth == 0) || (o.Name() != depth) {
+			continue
+		}
+		typ := o.XType()
+		if !typ.IsUnsignedInteger() || (typ.Max() == nil) {
+			return 0
+		}
+		if cv := typ.Max().ConstValue(); (cv != nil) && cv.IsUint64() && (cv.Uint64() < MaxRecursionDepth) {
+			return cv.Uint64() + 1
+		}
+		return 0
+	}
+	return 0
+}
+
 func (n *Func) BodyEndsWithReturn() bool {
 	if len(n.list2) == 0 {
 		return false
@@ -1010,7 +1272,12 @@ func (n *Func) CheckChooseCompatible(o *Func) error {
 }
 
 func NewFunc(flags Flags, filename string, line uint32, receiverName t.ID, funcName t.ID, in *Struct, out *TypeExpr, asserts []*Node, body []*Node) *Func {
-	return &Func{
+	return (*Arena)(nil).NewFunc(flags, filename, line, receiverName, funcName, in, out, asserts, body)
+}
+
+func (z *Arena) NewFunc(flags Flags, filename string, line uint32, receiverName t.ID, funcName t.ID, in *Struct, out *TypeExpr, asserts []*Node, body []*Node) *Func {
+	x := (*Func)(z.alloc())
+	*x = Func{
 		kind:     KFunc,
 		flags:    flags,
 		filename: filename,
@@ -1022,10 +1289,12 @@ func NewFunc(flags Flags, filename string, line uint32, receiverName t.ID, funcN
 		list1:    asserts,
 		list2:    body,
 	}
+	return x
 }
 
-// Status is "error (RHS) ID2" or "suspension (RHS) ID2":
+// Status is "status ID2" or "status ID2 as ID0":
 //  - FlagsPublic      is "pub" vs "pri"
+//  - ID0:   <0|class>
 //  - ID1:   <0|pkg> (set by calling SetPackage)
 //  - ID2:   message
 type Status Node
@@ -1034,16 +1303,24 @@ func (n *Status) AsNode() *Node    { return (*Node)(n) }
 func (n *Status) Public() bool     { return n.flags&FlagsPublic != 0 }
 func (n *Status) Filename() string { return n.filename }
 func (n *Status) Line() uint32     { return n.line }
+func (n *Status) Class() t.ID      { return n.id0 }
 func (n *Status) QID() t.QID       { return t.QID{n.id1, n.id2} }
 
-func NewStatus(flags Flags, filename string, line uint32, message t.ID) *Status {
-	return &Status{
+func NewStatus(flags Flags, filename string, line uint32, message t.ID, class t.ID) *Status {
+	return (*Arena)(nil).NewStatus(flags, filename, line, message, class)
+}
+
+func (z *Arena) NewStatus(flags Flags, filename string, line uint32, message t.ID, class t.ID) *Status {
+	x := (*Status)(z.alloc())
+	*x = Status{
 		kind:     KStatus,
 		flags:    flags,
 		filename: filename,
 		line:     line,
+		id0:      class,
 		id2:      message,
 	}
+	return x
 }
 
 // Const is "const ID2 LHS = RHS":
@@ -1063,7 +1340,12 @@ func (n *Const) XType() *TypeExpr { return n.lhs.AsTypeExpr() }
 func (n *Const) Value() *Expr     { return n.rhs.AsExpr() }
 
 func NewConst(flags Flags, filename string, line uint32, name t.ID, xType *TypeExpr, value *Expr) *Const {
-	return &Const{
+	return (*Arena)(nil).NewConst(flags, filename, line, name, xType, value)
+}
+
+func (z *Arena) NewConst(flags Flags, filename string, line uint32, name t.ID, xType *TypeExpr, value *Expr) *Const {
+	x := (*Const)(z.alloc())
+	*x = Const{
 		kind:     KConst,
 		flags:    flags,
 		filename: filename,
@@ -1072,6 +1354,7 @@ func NewConst(flags Flags, filename string, line uint32, name t.ID, xType *TypeE
 		lhs:      xType.AsNode(),
 		rhs:      value.AsNode(),
 	}
+	return x
 }
 
 // MaxImplements is an advisory limit for the number of interfaces a Struct can
@@ -1100,7 +1383,12 @@ func (n *Struct) Implements() []*Node { return n.list0 }
 func (n *Struct) Fields() []*Node     { return n.list1 }
 
 func NewStruct(flags Flags, filename string, line uint32, name t.ID, implements []*Node, fields []*Node) *Struct {
-	return &Struct{
+	return (*Arena)(nil).NewStruct(flags, filename, line, name, implements, fields)
+}
+
+func (z *Arena) NewStruct(flags Flags, filename string, line uint32, name t.ID, implements []*Node, fields []*Node) *Struct {
+	x := (*Struct)(z.alloc())
+	*x = Struct{
 		kind:     KStruct,
 		flags:    flags,
 		filename: filename,
@@ -1109,6 +1397,7 @@ func NewStruct(flags Flags, filename string, line uint32, name t.ID, implements
 		list0:    implements,
 		list1:    fields,
 	}
+	return x
 }
 
 // Use is "use ID2":
@@ -1121,16 +1410,141 @@ func (n *Use) Line() uint32     { return n.line }
 func (n *Use) Path() t.ID       { return n.id2 }
 
 func NewUse(filename string, line uint32, path t.ID) *Use {
-	return &Use{
+	return (*Arena)(nil).NewUse(filename, line, path)
+}
+
+func (z *Arena) NewUse(filename string, line uint32, path t.ID) *Use {
+	x := (*Use)(z.alloc())
+	*x = Use{
 		kind:     KUse,
 		filename: filename,
 		line:     line,
 		id2:      path,
 	}
+	return x
+}
+
+// Feature is "feature ID2":
+//  - FlagsPublic      is "pub" vs "pri"
+//  - ID1:   <0|pkg> (set by calling SetPackage)
+//  - ID2:   name
+//
+// A feature is a capability, such as "progressive" decoding, that a package
+// declares for its dependents to query at check time and for C code to query
+// at compile time.
+type Feature Node
+
+func (n *Feature) AsNode() *Node    { return (*Node)(n) }
+func (n *Feature) Public() bool     { return n.flags&FlagsPublic != 0 }
+func (n *Feature) Filename() string { return n.filename }
+func (n *Feature) Line() uint32     { return n.line }
+func (n *Feature) QID() t.QID       { return t.QID{n.id1, n.id2} }
+
+func NewFeature(flags Flags, filename string, line uint32, name t.ID) *Feature {
+	return (*Arena)(nil).NewFeature(flags, filename, line, name)
+}
+
+func (z *Arena) NewFeature(flags Flags, filename string, line uint32, name t.ID) *Feature {
+	x := (*Feature)(z.alloc())
+	*x = Feature{
+		kind:     KFeature,
+		flags:    flags,
+		filename: filename,
+		line:     line,
+		id2:      name,
+	}
+	return x
+}
+
+// Pragma is "pragma ID1 ID2":
+//  - ID1:   <ident> key, such as "strictness"
+//  - ID2:   <ident> value, such as "strict"
+type Pragma Node
+
+func (n *Pragma) AsNode() *Node    { return (*Node)(n) }
+func (n *Pragma) Filename() string { return n.filename }
+func (n *Pragma) Line() uint32     { return n.line }
+func (n *Pragma) Key() t.ID        { return n.id1 }
+func (n *Pragma) Value() t.ID      { return n.id2 }
+
+func NewPragma(filename string, line uint32, key t.ID, value t.ID) *Pragma {
+	return (*Arena)(nil).NewPragma(filename, line, key, value)
+}
+
+func (z *Arena) NewPragma(filename string, line uint32, key t.ID, value t.ID) *Pragma {
+	x := (*Pragma)(z.alloc())
+	*x = Pragma{
+		kind:     KPragma,
+		filename: filename,
+		line:     line,
+		id1:      key,
+		id2:      value,
+	}
+	return x
+}
+
+// Test is "test ID2 { List2 }":
+//  - ID2:   lit(name)
+//  - List2: <Statement> body
+type Test Node
+
+func (n *Test) AsNode() *Node    { return (*Node)(n) }
+func (n *Test) Filename() string { return n.filename }
+func (n *Test) Line() uint32     { return n.line }
+func (n *Test) Name() t.ID       { return n.id2 }
+func (n *Test) Body() []*Node    { return n.list2 }
+
+func NewTest(filename string, line uint32, name t.ID, body []*Node) *Test {
+	return (*Arena)(nil).NewTest(filename, line, name, body)
+}
+
+func (z *Arena) NewTest(filename string, line uint32, name t.ID, body []*Node) *Test {
+	x := (*Test)(z.alloc())
+	*x = Test{
+		kind:     KTest,
+		filename: filename,
+		line:     line,
+		id2:      name,
+		list2:    body,
+	}
+	return x
+}
+
+// Lemma is "lemma ID2(List0), List1 { List2 }":
+//  - ID2:   lit(name)
+//  - List0: <Field> parameters
+//  - List1: <Assert> pre and post conditions
+//  - List2: <Assert> body
+type Lemma Node
+
+func (n *Lemma) AsNode() *Node    { return (*Node)(n) }
+func (n *Lemma) Filename() string { return n.filename }
+func (n *Lemma) Line() uint32     { return n.line }
+func (n *Lemma) Name() t.ID       { return n.id2 }
+func (n *Lemma) Params() []*Node  { return n.list0 }
+func (n *Lemma) Asserts() []*Node { return n.list1 }
+func (n *Lemma) Body() []*Node    { return n.list2 }
+
+func NewLemma(filename string, line uint32, name t.ID, params []*Node, asserts []*Node, body []*Node) *Lemma {
+	return (*Arena)(nil).NewLemma(filename, line, name, params, asserts, body)
+}
+
+func (z *Arena) NewLemma(filename string, line uint32, name t.ID, params []*Node, asserts []*Node, body []*Node) *Lemma {
+	x := (*Lemma)(z.alloc())
+	*x = Lemma{
+		kind:     KLemma,
+		filename: filename,
+		line:     line,
+		id2:      name,
+		list0:    params,
+		list1:    asserts,
+		list2:    body,
+	}
+	return x
 }
 
 // File is a file of source code:
-//  - List0: <Const|Func|Status|Struct|Use> top-level declarations
+//  - List0: <Const|Func|Lemma|Pragma|Status|Struct|Test|Use> top-level declarations
 type File Node
 
 func (n *File) AsNode() *Node          { return (*Node)(n) }
@@ -1138,11 +1552,17 @@ func (n *File) Filename() string       { return n.filename }
 func (n *File) TopLevelDecls() []*Node { return n.list0 }
 
 func NewFile(filename string, topLevelDecls []*Node) *File {
-	return &File{
+	return (*Arena)(nil).NewFile(filename, topLevelDecls)
+}
+
+func (z *Arena) NewFile(filename string, topLevelDecls []*Node) *File {
+	x := (*File)(z.alloc())
+	*x = File{
 		kind:     KFile,
 		filename: filename,
 		list0:    topLevelDecls,
 	}
+	return x
 }
 
 // Statement means one of:
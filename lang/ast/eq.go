@@ -18,6 +18,54 @@ import (
 	t "github.com/google/wuffs/lang/token"
 )
 
+// Hash returns a hash of n that is consistent with Eq: if n.Eq(o) then
+// n.Hash() == o.Hash(), provided that constant expressions have had their
+// ConstValue set (which type checking does). Like Eq, it ignores MBounds and
+// MType.
+func (n *Expr) Hash() uint64 {
+	return n.hash(hashOffset)
+}
+
+const (
+	hashOffset = 0xCBF29CE484222325
+	hashPrime  = 0x00000100000001B3
+)
+
+func hashMix(h uint64, x uint64) uint64 {
+	return (h ^ x) * hashPrime
+}
+
+func (n *Expr) hash(h uint64) uint64 {
+	if n == nil {
+		return hashMix(h, 0)
+	}
+	if n.constValue != nil {
+		h = hashMix(h, uint64(n.constValue.Sign()+2))
+		for _, w := range n.constValue.Bits() {
+			h = hashMix(h, uint64(w))
+		}
+		return h
+	}
+
+	h = hashMix(h, uint64(n.flags))
+	h = hashMix(h, uint64(n.id0))
+	h = hashMix(h, uint64(n.id1))
+	h = hashMix(h, uint64(n.id2))
+	h = n.lhs.AsExpr().hash(h)
+	h = n.mhs.AsExpr().hash(h)
+	if n.id0 == t.IDXBinaryAs {
+		// The TypeExpr is not hashed, only compared by Eq.
+		h = hashMix(h, 1)
+	} else {
+		h = n.rhs.AsExpr().hash(h)
+	}
+	h = hashMix(h, uint64(len(n.list0)))
+	for _, x := range n.list0 {
+		h = x.AsExpr().hash(h)
+	}
+	return h
+}
+
 // Eq returns whether n and o are equal.
 //
 // It may return false negatives. In general, it will not report that "x + y"
@@ -0,0 +1,68 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func TestHash(tt *testing.T) {
+	const filename = "test.wuffs"
+	testCases := []struct {
+		x, y string
+		eq   bool
+	}{
+		{"x", "x", true},
+		{"x", "y", false},
+		{"x + 1", "x + 1", true},
+		{"x + 1", "1 + x", false},
+		{"x < n", "x <= n", false},
+		{"f(a: i, b: j)", "f(a: i, b: j)", true},
+		{"f(a: i, b: j)", "f(a: j, b: i)", false},
+		{"x[i .. j]", "x[i .. j]", true},
+		{"(x & 7) == 0", "(x & 7) == 0", true},
+		{"x as base.u32", "x as base.u32", true},
+		{"x as base.u32", "x as base.u64", false},
+	}
+
+	tm := &t.Map{}
+	parseExpr := func(s string) *a.Expr {
+		tokens, _, err := t.Tokenize(tm, filename, []byte(s))
+		if err != nil {
+			tt.Fatalf("Tokenize(%q): %v", s, err)
+		}
+		expr, err := parse.ParseExpr(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Fatalf("ParseExpr(%q): %v", s, err)
+		}
+		return expr
+	}
+
+	for _, tc := range testCases {
+		x, y := parseExpr(tc.x), parseExpr(tc.y)
+		if got := x.Eq(y); got != tc.eq {
+			tt.Errorf("%q.Eq(%q): got %t, want %t", tc.x, tc.y, got, tc.eq)
+			continue
+		}
+		if tc.eq && (x.Hash() != y.Hash()) {
+			tt.Errorf("%q and %q: Eq but different hashes", tc.x, tc.y)
+		}
+	}
+}
@@ -50,10 +50,15 @@ func (n *Expr) appendStr(buf []byte, tm *t.Map, parenthesize bool, depth uint32)
 				buf = append(buf, '(')
 			}
 			buf = n.lhs.AsExpr().appendStr(buf, tm, true, depth)
-			buf = append(buf, opString(n.id0)...)
 			if n.id0 == t.IDXBinaryAs {
+				if n.AsExclam() {
+					buf = append(buf, " as! "...)
+				} else {
+					buf = append(buf, " as "...)
+				}
 				buf = append(buf, n.rhs.AsTypeExpr().Str(tm)...)
 			} else {
+				buf = append(buf, opString(n.id0)...)
 				buf = n.rhs.AsExpr().appendStr(buf, tm, true, depth)
 			}
 			if parenthesize {
@@ -95,6 +100,9 @@ func (n *Expr) appendStr(buf []byte, tm *t.Map, parenthesize bool, depth uint32)
 				}
 				buf = append(buf, tm.ByID(o.AsArg().Name())...)
 				buf = append(buf, ": "...)
+				if o.AsArg().Specialized() {
+					buf = append(buf, "const "...)
+				}
 				buf = o.AsArg().Value().appendStr(buf, tm, false, depth)
 			}
 			buf = append(buf, ')')
@@ -124,6 +132,14 @@ func (n *Expr) appendStr(buf []byte, tm *t.Map, parenthesize bool, depth uint32)
 			buf = append(buf, '.')
 			buf = append(buf, tm.ByID(n.id2)...)
 
+		case t.IDFeature:
+			buf = append(buf, "feature "...)
+			if n.lhs != nil {
+				buf = n.lhs.AsExpr().appendStr(buf, tm, true, depth)
+				buf = append(buf, '.')
+			}
+			buf = append(buf, tm.ByID(n.id2)...)
+
 		case t.IDComma:
 			buf = append(buf, '[')
 			for i, o := range n.list0 {
@@ -163,6 +179,7 @@ var opStrings = [...]string{
 	t.IDXBinaryTildeModMinus:  " ~mod- ",
 	t.IDXBinaryTildeModStar:   " ~mod* ",
 	t.IDXBinaryTildeModShiftL: " ~mod<< ",
+	t.IDXBinaryTildeModShiftR: " ~mod>> ",
 	t.IDXBinaryTildeSatPlus:   " ~sat+ ",
 	t.IDXBinaryTildeSatMinus:  " ~sat- ",
 	t.IDXBinaryNotEq:          " <> ",
@@ -19,6 +19,7 @@ import (
 
 	"github.com/google/wuffs/lang/parse"
 
+	a "github.com/google/wuffs/lang/ast"
 	t "github.com/google/wuffs/lang/token"
 )
 
@@ -90,3 +91,43 @@ func TestString(tt *testing.T) {
 		}
 	}
 }
+
+func TestStringAsExclam(tt *testing.T) {
+	const filename = "test.wuffs"
+	tm := &t.Map{}
+	parseExpr := func(s string) *a.Expr {
+		tokens, _, err := t.Tokenize(tm, filename, []byte(s))
+		if err != nil {
+			tt.Fatalf("Tokenize(%q): %v", s, err)
+		}
+		expr, err := parse.ParseExpr(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Fatalf("ParseExpr(%q): %v", s, err)
+		}
+		return expr
+	}
+	typ := parseExpr("x as base.u32").RHS()
+
+	testCases := []struct {
+		flags    a.Flags
+		operand  string
+		want     string
+		asExclam bool
+	}{
+		{0, "x", "x as base.u32", false},
+		{a.EffectImpure.AsFlags() | a.FlagsAsExclam, "x", "x as! base.u32", true},
+		// An impure operand makes the conversion impure, but it is still a
+		// plain "as".
+		{0, "this.g!()", "this.g!() as base.u32", false},
+	}
+
+	for _, tc := range testCases {
+		n := a.NewExpr(tc.flags, t.IDXBinaryAs, 0, parseExpr(tc.operand).AsNode(), nil, typ, nil)
+		if got := n.Str(tm); got != tc.want {
+			tt.Errorf("%q: Str: got %q, want %q", tc.operand, got, tc.want)
+		}
+		if got := n.AsExclam(); got != tc.asExclam {
+			tt.Errorf("%q: AsExclam: got %t, want %t", tc.want, got, tc.asExclam)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast
+
+// Substitute returns a copy of n, where f is called on n and then (pre-order)
+// on its sub-expressions, including call arguments. If f returns a non-nil
+// expression, that expression is used as is, in place of the sub-expression,
+// and is not walked any further. Otherwise, that sub-expression is copied, and
+// its own sub-expressions are substituted likewise. A nil f means to return a
+// deep copy of n.
+//
+// Copies keep the original's flags, ConstValue and MType, but not its MBounds.
+func (n *Expr) Substitute(f func(*Expr) *Expr) *Expr {
+	if n == nil {
+		return nil
+	}
+	if f != nil {
+		if x := f(n); x != nil {
+			return x
+		}
+	}
+
+	sub := [3]*Node{}
+	for i, o := range n.AsNode().AsRaw().SubNodes() {
+		if (o != nil) && (o.Kind() == KExpr) {
+			o = o.AsExpr().Substitute(f).AsNode()
+		}
+		sub[i] = o
+	}
+
+	list := []*Node(nil)
+	for _, o := range n.Args() {
+		switch o.Kind() {
+		case KArg:
+			o = NewArg(o.AsArg().Name(), o.AsArg().Value().Substitute(f)).AsNode()
+		case KExpr:
+			o = o.AsExpr().Substitute(f).AsNode()
+		}
+		list = append(list, o)
+	}
+
+	ret := NewExpr(n.AsNode().AsRaw().Flags(), n.Operator(), n.Ident(), sub[0], sub[1], sub[2], list)
+	ret.SetConstValue(n.ConstValue())
+	ret.SetMType(n.MType())
+	return ret
+}
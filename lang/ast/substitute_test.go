@@ -0,0 +1,70 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func TestSubstitute(tt *testing.T) {
+	const filename = "test.wuffs"
+	testCases := []struct {
+		src, from, to, want string
+	}{
+		{"x + 1", "x", "y", "y + 1"},
+		{"(x + 1) * x", "x", "(y - 2)", "((y - 2) + 1) * (y - 2)"},
+		{"(x + 1) * x", "x + 1", "z", "z * x"},
+		{"f(a: x, b: x[i .. j])", "x", "y", "f(a: y, b: y[i .. j])"},
+		{"x < n", "m", "y", "x < n"},
+	}
+
+	tm := &t.Map{}
+	parseExpr := func(s string) *a.Expr {
+		tokens, _, err := t.Tokenize(tm, filename, []byte(s))
+		if err != nil {
+			tt.Fatalf("Tokenize(%q): %v", s, err)
+		}
+		expr, err := parse.ParseExpr(tm, filename, tokens, nil)
+		if err != nil {
+			tt.Fatalf("ParseExpr(%q): %v", s, err)
+		}
+		return expr
+	}
+
+	for _, tc := range testCases {
+		src, from, to := parseExpr(tc.src), parseExpr(tc.from), parseExpr(tc.to)
+		got := src.Substitute(func(x *a.Expr) *a.Expr {
+			if x.Eq(from) {
+				return to
+			}
+			return nil
+		})
+		if want := parseExpr(tc.want); !got.Eq(want) {
+			tt.Errorf("%q with %q replaced by %q: got %q, want %q",
+				tc.src, tc.from, tc.to, got.Str(tm), tc.want)
+		}
+		if src.Str(tm) != parseExpr(tc.src).Str(tm) {
+			tt.Errorf("%q: Substitute modified the original", tc.src)
+		}
+		if cp := src.Substitute(nil); (cp == src) || !cp.Eq(src) {
+			tt.Errorf("%q: Substitute(nil) is not a distinct, equal copy", tc.src)
+		}
+	}
+}
@@ -236,6 +236,7 @@ var Statuses = [...]string{
 	`"#bad workbuf length"`,
 	`"#bad wuffs version"`,
 	`"#cannot return a suspension"`,
+	`"#conversion out of range"`,
 	`"#disabled by previous error"`,
 	`"#initialize falsely claimed already zeroed"`,
 	`"#initialize not called"`,
@@ -249,6 +250,24 @@ var Statuses = [...]string{
 	`"#too much data"`,
 }
 
+// StatusClasses are the classes that an error status can be annotated with,
+// such as:
+//
+//	pub status "#bad header" as corrupt
+//
+// Each class suggests an HTTP response status code and a POSIX errno name, so
+// that programs (such as network services) embedding Wuffs can consistently
+// translate Wuffs errors to those other error spaces.
+var StatusClasses = [...]struct {
+	Name     string
+	HTTPCode int
+	Errno    string
+}{
+	{"corrupt", 422, "EBADMSG"},
+	{"resource_limit", 413, "EFBIG"},
+	{"unsupported", 415, "ENOTSUP"},
+}
+
 // TODO: a collection of forbidden variable names like and, or, not, as, false,
 // true, in, out, this, u8, u16, etc?
 
@@ -270,6 +289,8 @@ var Types = []string{
 	"rect_ie_u32",
 	"rect_ii_u32",
 
+	"optional_u32",
+
 	"more_information",
 
 	"status",
@@ -304,6 +325,12 @@ var Types = []string{
 	"arm_neon_u32x4",
 	"arm_neon_u64x2",
 
+	"arm_sve_utility",
+	"arm_sve_u8",
+
+	"riscv_v_utility",
+	"riscv_v_u8",
+
 	"x86_sse42_utility",
 	"x86_m128i",
 }
@@ -314,25 +341,59 @@ var Funcs = [][]string{
 }
 
 var funcsOther = [...]string{
+	"i8.max(a: i8) i8",
+	"i8.min(a: i8) i8",
+
+	"i16.max(a: i16) i16",
+	"i16.min(a: i16) i16",
+
+	"i32.max(a: i32) i32",
+	"i32.min(a: i32) i32",
+
+	"i64.max(a: i64) i64",
+	"i64.min(a: i64) i64",
+
+	// ceil_div_pow2 divides by (1 << n), rounding up, without the overflow of
+	// ((x + (1 << n) - 1) >> n). floor_log2 is the index of the highest set bit:
+	// the bounds checker requires a non-zero receiver.
+	"u8.ceil_div_pow2(n: u32[..= 7]) u8",
+	"u8.floor_log2() u32[..= 7]",
 	"u8.high_bits(n: u32[..= 7]) u8",
 	"u8.low_bits(n: u32[..= 7]) u8",
 	"u8.max(a: u8) u8",
 	"u8.min(a: u8) u8",
+	"u8.mul_q8_round(a: u8) u8",
 
+	"u16.ceil_div_pow2(n: u32[..= 15]) u16",
+	"u16.floor_log2() u32[..= 15]",
 	"u16.high_bits(n: u32[..= 15]) u16",
 	"u16.low_bits(n: u32[..= 15]) u16",
 	"u16.max(a: u16) u16",
 	"u16.min(a: u16) u16",
+	"u16.mul_q16_round(a: u16) u16",
+	"u16.mul_q8_round(a: u16) u16",
 
+	"u32.ceil_div_pow2(n: u32[..= 31]) u32",
+	"u32.floor_log2() u32[..= 31]",
 	"u32.high_bits(n: u32[..= 31]) u32",
 	"u32.low_bits(n: u32[..= 31]) u32",
 	"u32.max(a: u32) u32",
 	"u32.min(a: u32) u32",
+	"u32.mul_q16_round(a: u32) u32",
+	"u32.mul_q8_round(a: u32) u32",
 
+	"u64.ceil_div_pow2(n: u32[..= 63]) u64",
+	"u64.floor_log2() u32[..= 63]",
 	"u64.high_bits(n: u32[..= 63]) u64",
 	"u64.low_bits(n: u32[..= 63]) u64",
 	"u64.max(a: u64) u64",
 	"u64.min(a: u64) u64",
+	"u64.mul_q16_round(a: u64) u64",
+	"u64.mul_q8_round(a: u64) u64",
+
+	// to_u32_checked converts to a u32, if it fits. The bounds checker knows
+	// that, when is_ok() is true, value() is equal to the receiver.
+	"u64.to_u32_checked() optional_u32",
 
 	// ---- utility
 
@@ -378,10 +439,20 @@ var funcsOther = [...]string{
 	"range_ii_u64.intersect(r: range_ii_u64) range_ii_u64",
 	"range_ii_u64.unite(r: range_ii_u64) range_ii_u64",
 
+	// ---- optional_u32
+
+	"optional_u32.is_ok() bool",
+	"optional_u32.value() u32",
+
 	// ---- more_information
 
 	"more_information.set!(flavor: u32, w: u32, x: u64, y: u64, z: u64)",
 
+	// set_metadata! is equivalent to set! with the METADATA flavor, but the
+	// bounds checker also proves the pre-condition "min_incl <= max_excl", so
+	// that a metadata chunk's length is never negative.
+	"more_information.set_metadata!(fourcc: u32, min_incl: u64, max_excl: u64)",
+
 	// ---- status
 
 	// TODO: should we add is_complete?
@@ -671,6 +742,48 @@ var funcsOther = [...]string{
 	"arm_neon_u32x4.as_u8x16() arm_neon_u8x16",
 	"arm_neon_u64x2.as_u8x16() arm_neon_u8x16",
 
+	// ---- arm_sve_utility
+
+	// The length (in bytes) of ARM SVE and RISC-V V vectors is only known at
+	// run time. The "_slicevl" methods load or store the first N elements,
+	// where N is the minimum of the slice length and the vector length.
+
+	"arm_sve_utility.length_u8() u64[16 ..= 256]",
+
+	"arm_sve_utility.make_u8_repeat(a: u8) arm_sve_u8",
+	"arm_sve_utility.make_u8_slicevl(a: slice base.u8) arm_sve_u8",
+
+	// ---- arm_sve_u8
+
+	"arm_sve_u8.store_slicevl!(a: slice base.u8)",
+
+	"arm_sve_u8.svadd_u8(b: arm_sve_u8) arm_sve_u8",
+	"arm_sve_u8.svand_u8(b: arm_sve_u8) arm_sve_u8",
+	"arm_sve_u8.sveor_u8(b: arm_sve_u8) arm_sve_u8",
+	"arm_sve_u8.svmax_u8(b: arm_sve_u8) arm_sve_u8",
+	"arm_sve_u8.svmin_u8(b: arm_sve_u8) arm_sve_u8",
+	"arm_sve_u8.svorr_u8(b: arm_sve_u8) arm_sve_u8",
+	"arm_sve_u8.svsub_u8(b: arm_sve_u8) arm_sve_u8",
+
+	// ---- riscv_v_utility
+
+	"riscv_v_utility.length_u8() u64[16 ..= 8192]",
+
+	"riscv_v_utility.make_u8_repeat(a: u8) riscv_v_u8",
+	"riscv_v_utility.make_u8_slicevl(a: slice base.u8) riscv_v_u8",
+
+	// ---- riscv_v_u8
+
+	"riscv_v_u8.store_slicevl!(a: slice base.u8)",
+
+	"riscv_v_u8.vadd_vv_u8m1(b: riscv_v_u8) riscv_v_u8",
+	"riscv_v_u8.vand_vv_u8m1(b: riscv_v_u8) riscv_v_u8",
+	"riscv_v_u8.vmaxu_vv_u8m1(b: riscv_v_u8) riscv_v_u8",
+	"riscv_v_u8.vminu_vv_u8m1(b: riscv_v_u8) riscv_v_u8",
+	"riscv_v_u8.vor_vv_u8m1(b: riscv_v_u8) riscv_v_u8",
+	"riscv_v_u8.vsub_vv_u8m1(b: riscv_v_u8) riscv_v_u8",
+	"riscv_v_u8.vxor_vv_u8m1(b: riscv_v_u8) riscv_v_u8",
+
 	// ---- x86_sse42_utility
 
 	"x86_sse42_utility.make_m128i_multiple_u8(" +
@@ -831,6 +944,7 @@ const (
 )
 
 var SliceFuncs = []string{
+	"GENERIC T1.all_le(bound: u64) bool",
 	"GENERIC T1.copy_from_slice!(s: T1) u64",
 	"GENERIC T1.length() u64",
 	"GENERIC T1.prefix(up_to: u64) T1",
@@ -880,7 +994,9 @@ var TableFuncs = []string{
 	"GENERIC T2.row(y: u32) T1",
 }
 
-func ParseFuncs(tm *t.Map, ss []string, callback func(*a.Func) error) error {
+// ParseFuncs parses the built-in funcs ss, such as SliceFuncs, calling callback
+// on each one. The arena, if non-nil, allocates the AST nodes.
+func ParseFuncs(tm *t.Map, arena *a.Arena, ss []string, callback func(*a.Func) error) error {
 	if len(ss) == 0 {
 		return nil
 	}
@@ -915,6 +1031,7 @@ func ParseFuncs(tm *t.Map, ss []string, callback func(*a.Func) error) error {
 
 	file, err := parse.Parse(tm, filename, tokens, &parse.Options{
 		AllowBuiltInNames: true,
+		Arena:             arena,
 	})
 	if err != nil {
 		return fmt.Errorf("could not parse built-in funcs: %v", err)
@@ -17,6 +17,7 @@ package check
 import (
 	"errors"
 	"fmt"
+	"math/big"
 
 	a "github.com/google/wuffs/lang/ast"
 	t "github.com/google/wuffs/lang/token"
@@ -55,7 +56,84 @@ func otherHandSide(n *a.Expr, thisHS *a.Expr) (op t.ID, thatHS *a.Expr) {
 	return 0, nil
 }
 
-type facts []*a.Expr
+// facts is the set of boolean expressions known to be true at a point in a
+// function body. It keeps the facts in insertion order, for deterministic
+// iteration and error messages, but it also indexes them by their structural
+// hash (see a.Expr.Hash) and by the hashes of their binary operator's
+// operands. Adding a fact (which ignores duplicates) and finding the facts
+// about a given expression therefore do not need a linear scan, which matters
+// for long coroutine functions with many facts.
+//
+// Hashing has its own overhead, so the indexes are only built once there are
+// more than factsIndexThreshold facts. Until then, a linear scan is cheaper.
+type facts struct {
+	list []*a.Expr
+
+	byHash    map[uint64][]*a.Expr
+	byOperand map[uint64][]*a.Expr
+
+	// diffs caches the difference bounds implied by the facts. It is nil if
+	// they have not been built since the facts last changed. See
+	// difference.go.
+	diffs *diffTerms
+
+	// log is nil unless Options.TrackFacts or Options.FactTrace is set.
+	log *factLog
+}
+
+const factsIndexThreshold = 16
+
+// exprs returns the facts, in insertion order. The caller should not modify
+// the returned slice.
+func (z *facts) exprs() []*a.Expr { return z.list }
+
+// contains returns whether fact is one of the facts.
+func (z *facts) contains(fact *a.Expr) bool {
+	candidates := z.list
+	if z.byHash != nil {
+		candidates = z.byHash[fact.Hash()]
+	}
+	for _, x := range candidates {
+		if x.Eq(fact) {
+			return true
+		}
+	}
+	return false
+}
+
+// about returns the binary-op facts, such as "n < 10" or "x == n", that
+// possibly have n as an operand, in insertion order. It may return false
+// positives (but not false negatives), so callers should still check, e.g.
+// with otherHandSide. The caller should not modify the returned slice.
+func (z *facts) about(n *a.Expr) []*a.Expr {
+	if z.byOperand == nil {
+		return z.list
+	}
+	return z.byOperand[n.Hash()]
+}
+
+// clear removes all of the facts.
+func (z *facts) clear() {
+	for i, x := range z.list {
+		if z.log != nil {
+			z.log.drop(x)
+		}
+		z.list[i] = nil
+	}
+	z.list = z.list[:0]
+	z.byHash = nil
+	z.byOperand = nil
+	z.diffs = nil
+}
+
+// reset replaces the facts with a copy of list, such as one returned by the
+// snapshot function.
+func (z *facts) reset(list []*a.Expr) {
+	z.clear()
+	for _, x := range list {
+		z.appendFact(x)
+	}
+}
 
 func (z *facts) appendBinaryOpFact(op t.ID, lhs *a.Expr, rhs *a.Expr) {
 	o := a.NewExpr(0, op, 0, lhs.AsNode(), nil, rhs.AsNode(), nil)
@@ -65,11 +143,8 @@ func (z *facts) appendBinaryOpFact(op t.ID, lhs *a.Expr, rhs *a.Expr) {
 }
 
 func (z *facts) appendFact(fact *a.Expr) {
-	// TODO: make this faster than O(N) by keeping facts sorted somehow?
-	for _, x := range *z {
-		if x.Eq(fact) {
-			return
-		}
+	if z.contains(fact) {
+		return
 	}
 
 	switch fact.Operator() {
@@ -84,36 +159,108 @@ func (z *facts) appendFact(fact *a.Expr) {
 		return
 	}
 
-	*z = append(*z, fact)
+	z.push(fact)
+}
+
+// push adds fact, which is not already one of the facts, building or updating
+// the indexes as needed.
+func (z *facts) push(fact *a.Expr) {
+	if z.log != nil {
+		z.log.establish(fact)
+	}
+	z.add(fact)
+}
+
+// add is like push but does not log the fact as established.
+func (z *facts) add(fact *a.Expr) {
+	z.list = append(z.list, fact)
+	z.diffs = nil
+	if z.byHash != nil {
+		z.index(fact)
+	} else if len(z.list) > factsIndexThreshold {
+		z.byHash = map[uint64][]*a.Expr{}
+		z.byOperand = map[uint64][]*a.Expr{}
+		for _, x := range z.list {
+			z.index(x)
+		}
+	}
+}
+
+func (z *facts) index(fact *a.Expr) {
+	h := fact.Hash()
+	z.byHash[h] = append(z.byHash[h], fact)
+
+	if op, lhs, rhs := parseBinaryOp(fact); op != 0 {
+		lh := lhs.Hash()
+		z.byOperand[lh] = append(z.byOperand[lh], fact)
+		if rh := rhs.Hash(); rh != lh {
+			z.byOperand[rh] = append(z.byOperand[rh], fact)
+		}
+	}
 }
 
 // update applies f to each fact, replacing the slice element with the result
 // of the function call. The slice is then compacted to remove all nils.
 func (z *facts) update(f func(*a.Expr) (*a.Expr, error)) error {
+	changed := false
+	defer func() {
+		if changed {
+			z.reindex()
+		}
+	}()
+
 	i := 0
-	for _, x := range *z {
-		x, err := f(x)
+	for _, x := range z.list {
+		y, err := f(x)
 		if err != nil {
 			return err
 		}
-		if x != nil {
-			(*z)[i] = x
+		if y != x {
+			changed = true
+			if z.log != nil {
+				z.log.replace(x, y)
+			}
+		}
+		if y != nil {
+			z.list[i] = y
 			i++
 		}
 	}
-	for j := i; j < len(*z); j++ {
-		(*z)[j] = nil
+	for j := i; j < len(z.list); j++ {
+		z.list[j] = nil
 	}
-	*z = (*z)[:i]
+	z.list = z.list[:i]
 	return nil
 }
 
-func (z facts) refine(n *a.Expr, nb bounds, tm *t.Map) (bounds, error) {
+// reindex rebuilds the indexes from z.list, also removing any duplicates that
+// an update created.
+func (z *facts) reindex() {
+	list := z.list
+	z.list = list[:0]
+	z.byHash = nil
+	z.byOperand = nil
+	for _, x := range list {
+		if !z.contains(x) {
+			if z.log != nil {
+				z.log.reestablish(x)
+			}
+			z.add(x)
+		} else if z.log != nil {
+			z.log.dropDuplicate(x)
+		}
+	}
+	for j := len(z.list); j < len(list); j++ {
+		list[j] = nil
+	}
+}
+
+func (z *facts) refine(n *a.Expr, nb bounds, tm *t.Map) (bounds, error) {
 	if nb[0] == nil || nb[1] == nil {
 		return nb, nil
 	}
 
-	for _, x := range z {
+	for _, x := range z.about(n) {
 		op, other := otherHandSide(x, n)
 		if op == 0 {
 			continue
@@ -164,6 +311,9 @@ func (z facts) refine(n *a.Expr, nb bounds, tm *t.Map) (bounds, error) {
 		}
 	}
 
+	if db := z.refineDiff(n, nb); db[0].Cmp(db[1]) <= 0 {
+		nb = db
+	}
 	return nb, nil
 }
 
@@ -261,12 +411,17 @@ func proveBinaryOpConstValues(op t.ID, lb bounds, rb bounds) (ok bool) {
 }
 
 func (q *checker) proveBinaryOp(op t.ID, lhs *a.Expr, rhs *a.Expr) error {
+	return q.proveBinaryOp1(op, lhs, rhs, 0)
+}
+
+func (q *checker) proveBinaryOp1(op t.ID, lhs *a.Expr, rhs *a.Expr, depth uint32) error {
 	lcv := lhs.ConstValue()
 	if lcv != nil {
 		rb, err := q.bcheckExpr(rhs, 0)
 		if err != nil {
 			return err
 		}
+		q.explainStep("%q has bounds %v", rhs.Str(q.tm), rb)
 		if proveBinaryOpConstValues(op, bounds{lcv, lcv}, rb) {
 			return nil
 		}
@@ -277,22 +432,34 @@ func (q *checker) proveBinaryOp(op t.ID, lhs *a.Expr, rhs *a.Expr) error {
 		if err != nil {
 			return err
 		}
+		q.explainStep("%q has bounds %v", lhs.Str(q.tm), lb)
 		if proveBinaryOpConstValues(op, lb, bounds{rcv, rcv}) {
 			return nil
 		}
 	}
 
-	for _, x := range q.facts {
+	for _, x := range q.facts.about(lhs) {
 		if !x.LHS().AsExpr().Eq(lhs) {
 			continue
 		}
 		factOp := x.Operator()
 		if opImpliesOp(factOp, op) && x.RHS().AsExpr().Eq(rhs) {
+			q.explainStep("the fact %q implies it", x.Str(q.tm))
 			return nil
 		}
+		// For integers, "lhs < (rhs + 1)" implies "lhs <= rhs". Such facts
+		// arise from incrementing lhs after a "lhs < rhs" loop condition.
+		if (factOp == t.IDXBinaryLessThan) && (op == t.IDXBinaryLessEq) {
+			if fOp, fLHS, fRHS := parseBinaryOp(x.RHS().AsExpr()); (fOp == t.IDXBinaryPlus) &&
+				fLHS.Eq(rhs) && (fRHS.ConstValue() != nil) && (fRHS.ConstValue().Cmp(one) == 0) {
+				q.explainStep("the fact %q implies it", x.Str(q.tm))
+				return nil
+			}
+		}
 
 		if factOp == t.IDXBinaryEqEq && rcv != nil {
 			if factCV := x.RHS().AsExpr().ConstValue(); factCV != nil {
+				q.explainStep("the fact %q gives a constant", x.Str(q.tm))
 				switch op {
 				case t.IDXBinaryNotEq:
 					return errFailedOrNil(factCV.Cmp(rcv) != 0)
@@ -310,9 +477,290 @@ func (q *checker) proveBinaryOp(op t.ID, lhs *a.Expr, rhs *a.Expr) error {
 			}
 		}
 	}
+
+	if q.proveDifference(op, lhs, rhs) {
+		q.explainStep("a chain of facts (difference bounds) proves it")
+		return nil
+	}
+	if q.proveCongruence(op, lhs, rhs) {
+		q.explainStep("congruence (modular arithmetic) proves it")
+		return nil
+	}
+	if q.proveBitTrick(op, lhs, rhs, depth) {
+		q.explainStep("a bit manipulation idiom proves it")
+		return nil
+	}
+	if q.proveNonlinear(op, lhs, rhs, depth) {
+		q.explainStep("multiplication or division cancellation proves it")
+		return nil
+	}
+	if q.proveSatPlus(op, lhs, rhs, depth) {
+		q.explainStep("saturating addition of a non-negative value proves it")
+		return nil
+	}
+	if q.proveMonotone(op, lhs, rhs, depth) {
+		q.explainStep("monotonicity (of an operator or function) proves it")
+		return nil
+	}
+	q.explainStep("no fact about %q implies it", lhs.Str(q.tm))
 	return errFailed
 }
 
+// proveSatPlus proves "x <= y" (or "y >= x") given a fact "y == x ~sat+ z"
+// (or "y == z ~sat+ x") where "z >= 0". Saturating addition of a non-negative
+// value never decreases the other operand. Such facts arise from recording
+// where a chunk ends, e.g. "end = args.src.position() ~sat+ chunk_length".
+func (q *checker) proveSatPlus(op t.ID, lhs *a.Expr, rhs *a.Expr, depth uint32) bool {
+	if depth >= maxNonlinearDepth {
+		return false
+	}
+	depth++
+
+	switch op {
+	case t.IDXBinaryLessEq:
+		// No-op.
+	case t.IDXBinaryGreaterEq:
+		lhs, rhs = rhs, lhs
+	default:
+		return false
+	}
+
+	for _, x := range q.facts.about(rhs) {
+		fOp, fLHS, fRHS := parseBinaryOp(x)
+		if (fOp != t.IDXBinaryEqEq) || !fLHS.Eq(rhs) {
+			continue
+		}
+		sOp, sLHS, sRHS := parseBinaryOp(fRHS)
+		if sOp != t.IDXBinaryTildeSatPlus {
+			continue
+		}
+		for _, s := range [2][2]*a.Expr{{sLHS, sRHS}, {sRHS, sLHS}} {
+			if s[0].Eq(lhs) && (q.proveBinaryOp1(t.IDXBinaryGreaterEq, s[1], zeroExpr, depth) == nil) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maxNonlinearDepth bounds how often proveNonlinear recurses, as it proves
+// side conditions (such as "y <= z") with proveBinaryOp1.
+const maxNonlinearDepth = 8
+
+// proveNonlinear proves "lhs op rhs" for some common multiplication and
+// division patterns, where the operands' interval bounds are too coarse on
+// their own. Such patterns arise in e.g. table stride and block size
+// computations. The patterns are:
+//   - "((x / c) * c) <= r" if "x <= r", "x >= 0" and "c > 0". Rounding down to
+//     a multiple of c never increases x. Likewise for "<" (if "x < r"), for
+//     "(c * (x / c))" and for the mirrored ">=" and ">" forms.
+//   - "(x * y) op (x * z)" if "y op z" and "x >= 0", where op is one of "<",
+//     "<=", ">=" or ">". A strict op also needs "x > 0". The common factor x
+//     may be either operand of each multiplication.
+func (q *checker) proveNonlinear(op t.ID, lhs *a.Expr, rhs *a.Expr, depth uint32) bool {
+	if depth >= maxNonlinearDepth {
+		return false
+	}
+	depth++
+
+	switch op {
+	case t.IDXBinaryLessEq, t.IDXBinaryLessThan:
+		if q.proveRoundDown(op, lhs, rhs, depth) {
+			return true
+		}
+	case t.IDXBinaryGreaterEq:
+		if q.proveRoundDown(t.IDXBinaryLessEq, rhs, lhs, depth) {
+			return true
+		}
+	case t.IDXBinaryGreaterThan:
+		if q.proveRoundDown(t.IDXBinaryLessThan, rhs, lhs, depth) {
+			return true
+		}
+	default:
+		return false
+	}
+
+	lOp, lLHS, lRHS := parseBinaryOp(lhs)
+	rOp, rLHS, rRHS := parseBinaryOp(rhs)
+	if (lOp != t.IDXBinaryStar) || (rOp != t.IDXBinaryStar) {
+		return false
+	}
+	signOp := t.IDXBinaryGreaterEq
+	if (op == t.IDXBinaryLessThan) || (op == t.IDXBinaryGreaterThan) {
+		signOp = t.IDXBinaryGreaterThan
+	}
+	for _, l := range [2][2]*a.Expr{{lLHS, lRHS}, {lRHS, lLHS}} {
+		for _, r := range [2][2]*a.Expr{{rLHS, rRHS}, {rRHS, rLHS}} {
+			if l[0].Eq(r[0]) &&
+				(q.proveBinaryOp1(signOp, l[0], zeroExpr, depth) == nil) &&
+				(q.proveBinaryOp1(op, l[1], r[1], depth) == nil) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// proveRoundDown proves "lhs op rhs", where op is "<" or "<=" and lhs is
+// "(x / c) * c" or "c * (x / c)", by proving "x op rhs".
+func (q *checker) proveRoundDown(op t.ID, lhs *a.Expr, rhs *a.Expr, depth uint32) bool {
+	lOp, lLHS, lRHS := parseBinaryOp(lhs)
+	if lOp != t.IDXBinaryStar {
+		return false
+	}
+	for _, l := range [2][2]*a.Expr{{lLHS, lRHS}, {lRHS, lLHS}} {
+		dOp, x, c := parseBinaryOp(l[0])
+		if (dOp != t.IDXBinarySlash) || !c.Eq(l[1]) {
+			continue
+		}
+		if (q.proveBinaryOp1(t.IDXBinaryGreaterEq, x, zeroExpr, depth) != nil) ||
+			(q.proveBinaryOp1(t.IDXBinaryGreaterThan, c, zeroExpr, depth) != nil) {
+			continue
+		}
+		if x.Eq(rhs) {
+			if op == t.IDXBinaryLessEq {
+				return true
+			}
+			continue
+		}
+		if q.proveBinaryOp1(op, x, rhs, depth) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// maxBitTrickDepth bounds how often proveBitTrick recurses, as it can follow
+// facts (such as "y == (x & 7)") as well as sub-expressions.
+const maxBitTrickDepth = 8
+
+// proveBitTrick proves "lhs op rhs" for some classic bit manipulation idioms,
+// where lhs (or, given a fact "lhs == etc", that etc) is a bitwise-and whose
+// operands are both non-negative. With signed operands, "&" can increase a
+// negative value (such as "-8 & 7" being 0), so these idioms do not apply.
+// The idioms are:
+//   - "(p & q) <= r" if "p <= r" or "q <= r". For example, clearing the lowest
+//     set bit, "x & (x - 1)", or rounding down to a multiple of 8,
+//     "x & 0xFFFF_FFF8", never increases x.
+//   - "(p & q) < r" if "p < r" or "q < r". For example, if n is a power of 2
+//     then "i & (n - 1)" is less than n, and "x & (x - 1)" is less than x.
+//   - "((p + c) & m) >= p" if c and m are constants such that m clears only
+//     bits that c sets. This is rounding up, such as "(x + 7) & 0xFFFF_FFF8"
+//     rounding up to a multiple of 8.
+//   - "((p & m) & k) == 0" if m and k are constants such that "m & k" is zero.
+//     For example, rounding (up or down) to a multiple of 8 means that the
+//     low 3 bits are zero.
+func (q *checker) proveBitTrick(op t.ID, lhs *a.Expr, rhs *a.Expr, depth uint32) bool {
+	if depth >= maxBitTrickDepth {
+		return false
+	}
+	depth++
+
+	if lhs.Operator() != t.IDXBinaryAmp {
+		for _, x := range q.facts.about(lhs) {
+			if (x.Operator() == t.IDXBinaryEqEq) && x.LHS().AsExpr().Eq(lhs) &&
+				(x.RHS().AsExpr().Operator() == t.IDXBinaryAmp) &&
+				q.proveBitTrick(op, x.RHS().AsExpr(), rhs, depth) {
+				return true
+			}
+		}
+		return false
+	}
+	p, m := lhs.LHS().AsExpr(), lhs.RHS().AsExpr()
+	if !q.bitTrickOperandsAreNonNegative(p, m) {
+		return false
+	}
+
+	switch op {
+	case t.IDXBinaryLessEq, t.IDXBinaryLessThan:
+		return q.proveBitTrickOperand(op, p, rhs, depth) ||
+			q.proveBitTrickOperand(op, m, rhs, depth)
+
+	case t.IDXBinaryGreaterEq:
+		mcv := m.ConstValue()
+		if mcv == nil {
+			return false
+		}
+		pOp, pLHS, pRHS := parseBinaryOp(p)
+		if (pOp != t.IDXBinaryPlus) || !pLHS.Eq(rhs) {
+			return false
+		}
+		ccv := pRHS.ConstValue()
+		if (ccv == nil) || (big.NewInt(0).And(ccv, mcv).Sign() != 0) {
+			return false
+		}
+		pb, err := q.bcheckExpr(p, 0)
+		if err != nil {
+			return false
+		}
+		// Every bit of (p + c) that m clears must be one that c sets.
+		cm := big.NewInt(0).Or(ccv, mcv)
+		all := bitMask(pb[1].BitLen())
+		return big.NewInt(0).And(cm, all).Cmp(all) == 0
+
+	case t.IDXBinaryEqEq:
+		if kcv := m.ConstValue(); kcv != nil {
+			if rcv := rhs.ConstValue(); (rcv != nil) && (rcv.Sign() == 0) {
+				return q.proveBitTrickMaskedZero(p, kcv, depth)
+			}
+		}
+	}
+	return false
+}
+
+// bitTrickOperandsAreNonNegative returns whether the (already bounds checked)
+// operands of a bitwise-and are both known to be non-negative.
+func (q *checker) bitTrickOperandsAreNonNegative(p *a.Expr, m *a.Expr) bool {
+	for _, o := range [2]*a.Expr{p, m} {
+		ob, err := q.bcheckExpr(o, 0)
+		if (err != nil) || (ob[0] == nil) || (ob[0].Sign() < 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// proveBitTrickOperand proves "o op r", where op is "<" or "<=". It is like
+// proveBinaryOp1 but it also knows that "(r - c) < r" for a positive constant
+// c, as o (part of an expression that has already been bounds checked) cannot
+// underflow.
+func (q *checker) proveBitTrickOperand(op t.ID, o *a.Expr, r *a.Expr, depth uint32) bool {
+	if o.Eq(r) {
+		return op == t.IDXBinaryLessEq
+	}
+	if oOp, oLHS, oRHS := parseBinaryOp(o); (oOp == t.IDXBinaryMinus) && oLHS.Eq(r) {
+		if cv := oRHS.ConstValue(); cv != nil {
+			return (cv.Sign() > 0) || ((cv.Sign() == 0) && (op == t.IDXBinaryLessEq))
+		}
+	}
+	return q.proveBinaryOp1(op, o, r, depth) == nil
+}
+
+// proveBitTrickMaskedZero proves "(p & k) == 0", for a constant k.
+func (q *checker) proveBitTrickMaskedZero(p *a.Expr, k *big.Int, depth uint32) bool {
+	if depth >= maxBitTrickDepth {
+		return false
+	}
+	depth++
+
+	if p.Operator() != t.IDXBinaryAmp {
+		for _, x := range q.facts.about(p) {
+			if (x.Operator() == t.IDXBinaryEqEq) && x.LHS().AsExpr().Eq(p) &&
+				(x.RHS().AsExpr().Operator() == t.IDXBinaryAmp) &&
+				q.proveBitTrickMaskedZero(x.RHS().AsExpr(), k, depth) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, o := range [2]*a.Expr{p.LHS().AsExpr(), p.RHS().AsExpr()} {
+		if mcv := o.ConstValue(); (mcv != nil) && (big.NewInt(0).And(mcv, k).Sign() == 0) {
+			return true
+		}
+	}
+	return false
+}
+
 // opImpliesOp returns whether the first op implies the second. For example,
 // knowing "x < y" implies that "x != y" and "x <= y".
 func opImpliesOp(op0 t.ID, op1 t.ID) bool {
@@ -342,8 +790,11 @@ func proveReasonRequirement(q *checker, op t.ID, lhs *a.Expr, rhs *a.Expr) error
 		return fmt.Errorf(
 			"check: internal error: proveReasonRequirement token (0x%X) is not an XBinaryOp", op)
 	}
-	if err := q.proveBinaryOp(op, lhs, rhs); err != nil {
-		n := a.NewExpr(0, op, 0, lhs.AsNode(), nil, rhs.AsNode(), nil)
+	q.explainBegin()
+	err := q.proveBinaryOp(op, lhs, rhs)
+	n := a.NewExpr(0, op, 0, lhs.AsNode(), nil, rhs.AsNode(), nil)
+	q.explainEnd("requirement", n, err)
+	if err != nil {
 		return fmt.Errorf("cannot prove %q: %v", n.Str(q.tm), err)
 	}
 	return nil
@@ -352,14 +803,16 @@ func proveReasonRequirement(q *checker, op t.ID, lhs *a.Expr, rhs *a.Expr) error
 func proveReasonRequirementForRHSLength(q *checker, op t.ID, lhs *a.Expr, rhs *a.Expr) error {
 	if err := proveReasonRequirement(q, op, lhs, rhs); err != nil {
 		if (op == t.IDXBinaryLessThan) || (op == t.IDXBinaryLessEq) {
-			for _, x := range q.facts {
+			for _, x := range q.facts.about(rhs) {
 				// Try to prove "lhs op rhs" by proving "lhs op const", given a
 				// fact x of the form "rhs >= const".
 				if (x.Operator() == t.IDXBinaryGreaterEq) && x.LHS().AsExpr().Eq(rhs) &&
-					(x.RHS().AsExpr().ConstValue() != nil) &&
-					(proveReasonRequirement(q, op, lhs, x.RHS().AsExpr()) == nil) {
+					(x.RHS().AsExpr().ConstValue() != nil) {
 
-					return nil
+					q.explainStep("trying the fact %q", x.Str(q.tm))
+					if proveReasonRequirement(q, op, lhs, x.RHS().AsExpr()) == nil {
+						return nil
+					}
 				}
 			}
 		}
@@ -30,6 +30,10 @@ import (
 type bounds = interval.IntRange
 
 var numShiftBounds = [...]bounds{
+	t.IDI8:  {zero, big.NewInt(7)},
+	t.IDI16: {zero, big.NewInt(15)},
+	t.IDI32: {zero, big.NewInt(31)},
+	t.IDI64: {zero, big.NewInt(63)},
 	t.IDU8:  {zero, big.NewInt(7)},
 	t.IDU16: {zero, big.NewInt(15)},
 	t.IDU32: {zero, big.NewInt(31)},
@@ -70,13 +74,17 @@ var (
 
 	maxIntBits = big.NewInt(t.MaxIntBits)
 
-	zeroExpr = a.NewExpr(0, 0, t.ID0, nil, nil, nil, nil)
+	// zeroExpr, like the typeExprEtc values, is shared by every Checker and
+	// must not be modified after it is created.
+	zeroExpr = makeZeroExpr()
 )
 
-func init() {
-	zeroExpr.SetConstValue(zero)
-	zeroExpr.SetMBounds(bounds{zero, zero})
-	zeroExpr.SetMType(typeExprIdeal)
+func makeZeroExpr() *a.Expr {
+	n := a.NewExpr(0, 0, t.ID0, nil, nil, nil, nil)
+	n.SetConstValue(zero)
+	n.SetMBounds(bounds{zero, zero})
+	n.SetMType(typeExprIdeal)
+	return n
 }
 
 func isErrorStatus(literal t.ID, tm *t.Map) bool {
@@ -117,6 +125,24 @@ func max(i, j *big.Int) *big.Int {
 	return j
 }
 
+// mulQRound returns ((i * j) + (1 << (shift - 1))) >> shift, which is the
+// product of i and j, in Q-format fixed point with shift fractional bits,
+// rounded to nearest (with ties rounding up). Both i and j must be
+// non-negative.
+func mulQRound(i, j *big.Int, shift uint) *big.Int {
+	z := big.NewInt(0).Mul(i, j)
+	z.Add(z, big.NewInt(0).Lsh(one, shift-1))
+	return z.Rsh(z, shift)
+}
+
+// ceilDivPow2 returns i divided by (1 << j), rounding up. Both i and j must be
+// non-negative and j must fit in a uint.
+func ceilDivPow2(i, j *big.Int) *big.Int {
+	shift := uint(j.Uint64())
+	z := big.NewInt(0).Add(i, bitMask(int(shift)))
+	return z.Rsh(z, shift)
+}
+
 // bitMask returns (1<<nBits - 1) as a big integer.
 func bitMask(nBits int) *big.Int {
 	switch nBits {
@@ -197,8 +223,9 @@ func invert(tm *t.Map, n *a.Expr) (*a.Expr, error) {
 	return o, nil
 }
 
-func updateFactsForSuspension(x *a.Expr) (*a.Expr, error) {
-	if x.Mentions(exprArgs) || x.Mentions(exprThis) {
+func (q *checker) updateFactsForSuspension(x *a.Expr) (*a.Expr, error) {
+	if x.Mentions(exprArgs) || x.Mentions(exprThis) || isQuantifiedFact(x) ||
+		q.mentionsIOPosition(x) {
 		return nil, nil
 	}
 	// TODO: drop any facts involving ptr-typed local variables?
@@ -206,12 +233,21 @@ func updateFactsForSuspension(x *a.Expr) (*a.Expr, error) {
 }
 
 func (q *checker) bcheckBlock(block []*a.Node) error {
+	if q.facts.log != nil {
+		// Attribute any fact changes after this block, such as when unifying
+		// an if's branches or at a loop's exit, to the enclosing statement.
+		defer func(line uint32) { q.facts.log.line = line }(q.facts.log.line)
+	}
 	unreachable := false
 	for _, o := range block {
-		q.errFilename, q.errLine = o.AsRaw().FilenameLine()
+		q.setErrNode(o)
 		if unreachable {
 			return fmt.Errorf("check: unreachable code")
 		}
+		if q.facts.log != nil {
+			q.facts.log.line = q.errLine
+		}
+		q.recordQuery(o)
 		if err := q.bcheckStatement(o); err != nil {
 			return err
 		}
@@ -223,7 +259,7 @@ func (q *checker) bcheckBlock(block []*a.Node) error {
 			// No-op.
 		case a.KRet:
 			if o.AsRet().Keyword() == t.IDYield {
-				if err := q.facts.update(updateFactsForSuspension); err != nil {
+				if err := q.facts.update(q.updateFactsForSuspension); err != nil {
 					return err
 				}
 				continue
@@ -231,18 +267,22 @@ func (q *checker) bcheckBlock(block []*a.Node) error {
 		}
 		unreachable = true
 	}
-	return nil
+	return q.dropOutOfScopeFacts(block)
 }
 
 func (q *checker) bcheckStatement(n *a.Node) error {
 	switch n.Kind() {
 	case a.KAssert:
+		if n.AsAssert() == q.omittedAssert {
+			break
+		}
 		if err := q.bcheckAssert(n.AsAssert()); err != nil {
 			return err
 		}
 
 	case a.KAssign:
 		n := n.AsAssign()
+		q.warnRedundantStore(n)
 		if err := q.bcheckAssignment(n.LHS(), n.Operator(), n.RHS()); err != nil {
 			return err
 		}
@@ -251,17 +291,9 @@ func (q *checker) bcheckStatement(n *a.Node) error {
 		// No-op.
 
 	case a.KIOBind:
-		n := n.AsIOBind()
-		if _, err := q.bcheckExpr(n.IO(), 0); err != nil {
-			return err
-		}
-		if _, err := q.bcheckExpr(n.Arg1(), 0); err != nil {
+		if err := q.bcheckIOBind(n.AsIOBind()); err != nil {
 			return err
 		}
-		if err := q.bcheckBlock(n.Body()); err != nil {
-			return err
-		}
-		// TODO: invalidate any facts regarding the io_bind expressions.
 
 	case a.KIf:
 		if err := q.bcheckIf(n.AsIf()); err != nil {
@@ -269,41 +301,19 @@ func (q *checker) bcheckStatement(n *a.Node) error {
 		}
 
 	case a.KIterate:
-		n := n.AsIterate()
-		if _, err := q.bcheckExpr(n.UnrollAsExpr(), 0); err != nil {
+		decreases := q.decreasesFacts()
+		if err := q.bcheckIterate(n.AsIterate()); err != nil {
 			return err
 		}
-		for _, o := range n.Assigns() {
-			o := o.AsAssign()
-			if err := q.bcheckAssignment(o.LHS(), o.Operator(), o.RHS()); err != nil {
-				return err
-			}
-		}
-		// TODO: this isn't right, as the body is a loop, not an
-		// execute-exactly-once block. We should have pre / inv / post
-		// conditions, a la bcheckWhile.
-
-		assigns := n.Assigns()
-		for ; n != nil; n = n.ElseIterate() {
-			if _, err := q.bcheckExpr(n.UnrollAsExpr(), 0); err != nil {
-				return err
-			}
-			q.facts = q.facts[:0]
-			for _, o := range assigns {
-				lhs := o.AsAssign().LHS()
-				lhsExpr := a.NewExpr(0, 0, lhs.Ident(), nil, nil, nil, nil)
-				lhsExpr.SetMType(lhs.MType())
-				q.facts = append(q.facts, q.makeSliceLengthEqEq(lhsExpr, n.Length()))
-			}
-			if err := q.bcheckBlock(n.Body()); err != nil {
-				return err
-			}
-		}
-
-		q.facts = q.facts[:0]
+		q.restoreDecreasesFacts(n, decreases)
 
 	case a.KJump:
 		n := n.AsJump()
+		if n.JumpTarget().Keyword() == t.IDIterate {
+			// TODO: support break and continue in iterate loops. Note that the
+			// C code generator doesn't support them yet either.
+			return fmt.Errorf("check: %s inside an iterate loop is not supported yet", n.Keyword().Str(q.tm))
+		}
 		skip := t.IDPost
 		if n.Keyword() == t.IDBreak {
 			skip = t.IDPre
@@ -316,7 +326,13 @@ func (q *checker) bcheckStatement(n *a.Node) error {
 				return err
 			}
 		}
-		q.facts = q.facts[:0]
+		if w, ok := n.JumpTarget().(*a.While); ok && (n.Keyword() == t.IDContinue) && (w.Decreases() != nil) {
+			if err := q.proveDecreases(w); err != nil {
+				return err
+			}
+		}
+		q.recordLoopExit(n)
+		q.facts.clear()
 
 	case a.KRet:
 		n := n.AsRet()
@@ -326,9 +342,24 @@ func (q *checker) bcheckStatement(n *a.Node) error {
 		} else if lTyp == nil {
 			lTyp = typeExprEmptyStruct
 		}
-		if _, err := q.bcheckAssignment1(nil, lTyp, t.IDEq, n.Value()); err != nil {
+		rb, err := q.bcheckAssignment1(nil, lTyp, t.IDEq, n.Value())
+		if err != nil {
 			return err
 		}
+		if q.resultBounds[0] == nil {
+			q.resultBounds = rb
+		} else {
+			q.resultBounds = bounds{
+				min(q.resultBounds[0], rb[0]),
+				max(q.resultBounds[1], rb[1]),
+			}
+		}
+
+		if (n.Keyword() == t.IDReturn) && !q.astFunc.Effect().Coroutine() {
+			if err := q.bcheckFuncPostConditions(n.Value()); err != nil {
+				return err
+			}
+		}
 
 		if lTyp.IsStatus() {
 			if v := n.Value(); (v.Operator() == 0) || (v.Operator() == a.ExprOperatorSelector) {
@@ -337,6 +368,9 @@ func (q *checker) bcheckStatement(n *a.Node) error {
 				}
 			}
 		}
+		if err := q.recordTokensNeeded(n); err != nil {
+			return err
+		}
 
 	case a.KVar:
 		if err := q.bcheckVar(n.AsVar()); err != nil {
@@ -344,9 +378,11 @@ func (q *checker) bcheckStatement(n *a.Node) error {
 		}
 
 	case a.KWhile:
+		decreases := q.decreasesFacts()
 		if err := q.bcheckWhile(n.AsWhile()); err != nil {
 			return err
 		}
+		q.restoreDecreasesFacts(n, decreases)
 
 	default:
 		return fmt.Errorf("check: unrecognized ast.Kind (%s) for bcheckStatement", n.Kind())
@@ -355,7 +391,7 @@ func (q *checker) bcheckStatement(n *a.Node) error {
 }
 
 func (q *checker) hasIsErrorFact(id t.ID) bool {
-	for _, x := range q.facts {
+	for _, x := range q.facts.exprs() {
 		if lhs, meth, args, _ := x.IsMethodCall(); (meth != t.IDIsError) || (len(args) != 0) ||
 			(lhs.Operator() != 0) || (lhs.Ident() != id) {
 			continue
@@ -374,10 +410,38 @@ func (q *checker) bcheckFuncAssert(n *a.Assert) error {
 		cond.RHS().AsExpr().SetMBounds(b)
 		return nil
 	}
-	return fmt.Errorf("check: function assertions are not supported yet")
+	if _, ok := monotoneParam(q.tm, n); ok {
+		n.Condition().SetMBounds(bounds{zero, one})
+		return nil
+	}
+	if _, err := q.bcheckExpr(n.Condition(), 0); err != nil {
+		return err
+	}
+	for _, o := range n.Args() {
+		if _, err := q.bcheckExpr(o.AsArg().Value(), 0); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (q *checker) bcheckAssert(n *a.Assert) error {
+	if err := q.bcheckAssertCondition(n); err != nil {
+		return err
+	}
+	if q.facts.contains(n.Condition()) {
+		return nil
+	}
+	o, err := simplify(q.tm, n.Condition())
+	if err != nil {
+		return err
+	}
+	return q.appendCondition(o)
+}
+
+// bcheckAssertCondition is like bcheckAssert but it does not add the proven
+// condition to the facts.
+func (q *checker) bcheckAssertCondition(n *a.Assert) error {
 	if err := n.DropExprCachedMBounds(); err != nil {
 		return err
 	}
@@ -392,27 +456,31 @@ func (q *checker) bcheckAssert(n *a.Assert) error {
 		}
 	}
 
-	for _, x := range q.facts {
-		if x.Eq(condition) {
-			return nil
-		}
-	}
+	q.explainBegin()
 	err := errFailed
 
-	if cv := condition.ConstValue(); cv != nil {
+	if q.facts.contains(condition) {
+		q.explainStep("it is already a fact")
+		err = nil
+	} else if cv := condition.ConstValue(); cv != nil {
+		q.explainStep("it is the constant %v", cv)
 		if cv.Cmp(one) == 0 {
 			err = nil
 		}
 	} else if reasonID := n.Reason(); reasonID != 0 {
 		if reasonFunc := q.reasonMap[reasonID]; reasonFunc != nil {
+			q.explainStep("via %s", reasonID.Str(q.tm))
 			err = reasonFunc(q, n)
 		} else {
 			err = fmt.Errorf("check: no such reason %s", reasonID.Str(q.tm))
 		}
+	} else if isQuantifiedFact(condition) {
+		err = q.proveAllLE(condition)
 	} else if condition.Operator().IsBinaryOp() && condition.Operator() != t.IDAs {
 		err = q.proveBinaryOp(condition.Operator(),
 			condition.LHS().AsExpr(), condition.RHS().AsExpr())
 	}
+	q.explainEnd(n.Keyword().Str(q.tm), condition, err)
 
 	if err != nil {
 		if err == errFailed {
@@ -420,21 +488,26 @@ func (q *checker) bcheckAssert(n *a.Assert) error {
 		}
 		return fmt.Errorf("check: cannot prove %q: %v", condition.Str(q.tm), err)
 	}
-	o, err := simplify(q.tm, condition)
-	if err != nil {
-		return err
-	}
-	q.facts.appendFact(o)
 	return nil
 }
 
 func (q *checker) bcheckAssignment(lhs *a.Expr, op t.ID, rhs *a.Expr) error {
 	oldFacts := (map[*a.Expr]struct{})(nil)
+	advanced := []*a.Expr(nil)
 	if (rhs.Operator() == a.ExprOperatorCall) && rhs.Effect().Impure() {
 		oldFacts = map[*a.Expr]struct{}{}
-		for _, x := range q.facts {
+		for _, x := range q.facts.exprs() {
 			oldFacts[x] = struct{}{}
 		}
+
+		// A "=?" call might not have advanced an io_reader's position, or
+		// not by the full amount.
+		if op != t.IDEqQuestion {
+			var err error
+			if advanced, err = q.advancedPositionFacts(rhs); err != nil {
+				return err
+			}
+		}
 	}
 
 	lTyp := (*a.TypeExpr)(nil)
@@ -452,7 +525,7 @@ func (q *checker) bcheckAssignment(lhs *a.Expr, op t.ID, rhs *a.Expr) error {
 
 	if (rhs.Operator() == a.ExprOperatorCall) && rhs.Effect().Impure() {
 		if rhs.Effect().Coroutine() && (op != t.IDEqQuestion) {
-			if err := q.facts.update(updateFactsForSuspension); err != nil {
+			if err := q.facts.update(q.updateFactsForSuspension); err != nil {
 				return err
 			}
 		}
@@ -462,6 +535,11 @@ func (q *checker) bcheckAssignment(lhs *a.Expr, op t.ID, rhs *a.Expr) error {
 			if _, ok := oldFacts[x]; !ok {
 				// No-op. Don't drop any newly minted facts.
 			} else {
+				// Drop any old facts about slice contents, which the call
+				// could have modified.
+				if isQuantifiedFact(x) {
+					return nil, nil
+				}
 				// Drop any old facts involving the receiver.
 				if x.Mentions(recv) {
 					return nil, nil
@@ -485,13 +563,29 @@ func (q *checker) bcheckAssignment(lhs *a.Expr, op t.ID, rhs *a.Expr) error {
 		}); err != nil {
 			return err
 		}
+
+		for _, x := range advanced {
+			q.facts.appendFact(x)
+		}
 	}
 
 	if lhs == nil {
-		return nil
+		return q.appendCallPostConditions(nil, rhs)
+	}
+	if err := q.suggestAssignment(lhs, nb); err != nil {
+		return err
+	}
+
+	if _, _, ok := lhs.IsIndex(); ok {
+		// Drop any facts about slice contents, as lhs could alias them.
+		if err := q.facts.update(dropQuantifiedFacts); err != nil {
+			return err
+		}
 	}
 
 	if op == t.IDEq {
+		q.notePositionVar(lhs, rhs)
+
 		// Drop any facts involving lhs.
 		if err := q.facts.update(func(x *a.Expr) (*a.Expr, error) {
 			if x.Mentions(lhs) {
@@ -515,6 +609,13 @@ func (q *checker) bcheckAssignment(lhs *a.Expr, op t.ID, rhs *a.Expr) error {
 					}
 				}
 			}
+		} else if isToU32Checked(rhs) {
+			// See appendCondition for how "lhs.is_ok()" uses this fact.
+			q.facts.appendBinaryOpFact(t.IDXBinaryEqEq, lhs, rhs)
+		}
+
+		if err := q.appendCallPostConditions(lhs, rhs); err != nil {
+			return err
 		}
 
 		// Look for "lhs = x[i .. j]" where i and j are constants.
@@ -538,19 +639,34 @@ func (q *checker) bcheckAssignment(lhs *a.Expr, op t.ID, rhs *a.Expr) error {
 					return err
 				}
 				// TODO: dupe lhs before making a new fact referencing it?
-				q.facts = append(q.facts, q.makeSliceLengthEqEq(lhs, id))
+				q.facts.appendFact(q.makeSliceLengthEqEq(lhs, id))
 			}
 		}
 
 	} else {
 		// Update any facts involving lhs.
 		if err := q.facts.update(func(x *a.Expr) (*a.Expr, error) {
+			if isDecreasesFact(x) && x.Mentions(lhs) {
+				return q.shiftDecreasesFact(x, lhs, op, rhs)
+			}
 			xOp, xLHS, xRHS := parseBinaryOp(x)
 			if xOp == 0 || !xLHS.Eq(lhs) {
-				if x.Mentions(lhs) {
-					return nil, nil
+				if !x.Mentions(lhs) {
+					return x, nil
 				}
-				return x, nil
+				// Rewrite facts like "s[i] <= k" in terms of the new lhs,
+				// e.g. "s[i - 1] <= k" after "i += 1".
+				if ((op == t.IDPlusEq) || (op == t.IDMinusEq)) &&
+					(rhs.ConstValue() != nil) && isShiftableFact(x) {
+					oldOp := t.IDXBinaryMinus
+					if op == t.IDMinusEq {
+						oldOp = t.IDXBinaryPlus
+					}
+					old := a.NewExpr(0, oldOp, 0, lhs.AsNode(), nil, rhs.AsNode(), nil)
+					old.SetMType(lhs.MType())
+					return replaceExpr(x, lhs, old), nil
+				}
+				return nil, nil
 			}
 			if xRHS.Mentions(lhs) {
 				return nil, nil
@@ -624,9 +740,11 @@ func (q *checker) bcheckAssignment1(lhs *a.Expr, lTyp *a.TypeExpr, op t.ID, rhs
 
 	if (lTyp != nil) && ((rb[0].Cmp(lb[0]) < 0) || (rb[1].Cmp(lb[1]) > 0)) {
 		if op == t.IDEq {
-			return bounds{}, fmt.Errorf("check: expression %q bounds %v is not within bounds %v",
-				rhs.Str(q.tm), rb, lb)
+			q.explainBoundsFailure(rhs, rb, rb, lb)
+			return bounds{}, errorAtExpr(rhs, fmt.Errorf("check: expression %q bounds %v is not within bounds %v",
+				rhs.Str(q.tm), rb, lb))
 		} else {
+			q.explainBoundsFailure(a.NewExpr(0, op.BinaryForm(), 0, lhs.AsNode(), nil, rhs.AsNode(), nil), rb, rb, lb)
 			return bounds{}, fmt.Errorf("check: assignment %q bounds %v is not within bounds %v",
 				lhs.Str(q.tm)+" "+op.Str(q.tm)+" "+rhs.Str(q.tm), rb, lb)
 		}
@@ -669,11 +787,11 @@ func snapshot(facts []*a.Expr) []*a.Expr {
 }
 
 func (q *checker) unify(branches [][]*a.Expr) error {
-	q.facts = q.facts[:0]
+	q.facts.clear()
 	if len(branches) == 0 {
 		return nil
 	}
-	q.facts = append(q.facts[:0], branches[0]...)
+	q.facts.reset(branches[0])
 	if len(branches) == 1 {
 		return nil
 	}
@@ -681,25 +799,108 @@ func (q *checker) unify(branches [][]*a.Expr) error {
 		return fmt.Errorf("check: too many if-else branches")
 	}
 
-	m := map[string]int{}
-	for _, b := range branches {
-		for _, f := range b {
-			m[f.Str(q.tm)]++
-		}
+	others := make([]facts, len(branches)-1)
+	for i, b := range branches[1:] {
+		others[i].reset(b)
 	}
 
 	return q.facts.update(func(n *a.Expr) (*a.Expr, error) {
-		if m[n.Str(q.tm)] == len(branches) {
-			return n, nil
+		for i := range others {
+			if !others[i].contains(n) {
+				return nil, nil
+			}
 		}
-		return nil, nil
+		return n, nil
+	})
+}
+
+func (q *checker) bcheckIOBind(n *a.IOBind) error {
+	io := n.IO()
+	if _, err := q.bcheckExpr(io, 0); err != nil {
+		return err
+	}
+	if _, err := q.bcheckExpr(n.Arg1(), 0); err != nil {
+		return err
+	}
+
+	// Inside the body, io refers to a different (io_bind) or narrower
+	// (io_limit) buffer, so facts about io from outside the body don't hold.
+	// Rather than dropping those facts, hide them by replacing io with a
+	// placeholder that no Wuffs code can refer to. The hidden facts are still
+	// subject to the usual invalidation (e.g. assigning to a variable that
+	// they mention, or suspending a coroutine) while checking the body.
+	placeholder := ioBindPlaceholder(io)
+	hidden := []*a.Expr(nil)
+	if err := q.facts.update(func(x *a.Expr) (*a.Expr, error) {
+		if !x.Mentions(io) {
+			return x, nil
+		}
+		x = replaceExpr(x, io, placeholder)
+		hidden = append(hidden, x)
+		return x, nil
+	}); err != nil {
+		return err
+	}
+
+	if err := q.bcheckBlock(n.Body()); err != nil {
+		return err
+	}
+
+	// Facts about io from inside the body don't hold outside of it. After an
+	// io_bind, io is restored to its original buffer, untouched by the body,
+	// so any surviving hidden facts are re-established. After an io_limit,
+	// the body may have consumed some of io, so the hidden facts are stale.
+	restore := n.Keyword() == t.IDIOBind
+	return q.facts.update(func(x *a.Expr) (*a.Expr, error) {
+		if x.Mentions(io) {
+			return nil, nil
+		}
+		for _, h := range hidden {
+			if x.Eq(h) {
+				if !restore {
+					return nil, nil
+				}
+				return replaceExpr(x, placeholder, io), nil
+			}
+		}
+		return x, nil
+	})
+}
+
+// ioBindPlaceholder returns an expression that stands in for io, in facts
+// that are hidden while checking an io_bind or io_limit body. If io is a
+// "this.foo" or "args.foo" expression, the placeholder is also a "this.etc" or
+// "args.etc" expression, so that such facts are still dropped by
+// updateFactsForSuspension.
+func ioBindPlaceholder(io *a.Expr) *a.Expr {
+	ret := (*a.Expr)(nil)
+	if io.Operator() == a.ExprOperatorSelector {
+		ret = a.NewExpr(io.AsNode().AsRaw().Flags(), a.ExprOperatorSelector, t.IDIOBind,
+			io.LHS(), nil, nil, nil)
+	} else {
+		ret = a.NewExpr(0, 0, t.IDIOBind, nil, nil, nil, nil)
+	}
+	ret.SetMType(io.MType())
+	return ret
+}
+
+// replaceExpr returns a copy of n with every sub-expression equal to from
+// replaced by to.
+func replaceExpr(n *a.Expr, from *a.Expr, to *a.Expr) *a.Expr {
+	return n.Substitute(func(x *a.Expr) *a.Expr {
+		if x.Eq(from) {
+			return to
+		} else if !x.Mentions(from) {
+			return x
+		}
+		return nil
 	})
 }
 
 func (q *checker) bcheckIf(n *a.If) error {
 	branches := [][]*a.Expr(nil)
 	for n != nil {
-		snap := snapshot(q.facts)
+		snap := snapshot(q.facts.exprs())
 		// Check the if condition.
 		if _, err := q.bcheckExpr(n.Condition(), 0); err != nil {
 			return err
@@ -707,22 +908,24 @@ func (q *checker) bcheckIf(n *a.If) error {
 
 		// Check the if-true branch, assuming the if condition.
 		if n.Condition().ConstValue() == nil {
-			q.facts.appendFact(n.Condition())
+			if err := q.appendCondition(n.Condition()); err != nil {
+				return err
+			}
 		}
 		if err := q.bcheckBlock(n.BodyIfTrue()); err != nil {
 			return err
 		}
 		if !a.Terminates(n.BodyIfTrue()) {
-			branches = append(branches, snapshot(q.facts))
+			branches = append(branches, snapshot(q.facts.exprs()))
 		}
 
 		// Check the if-false branch, assuming the inverted if condition.
-		q.facts = append(q.facts[:0], snap...)
+		q.facts.reset(snap)
 		if n.Condition().ConstValue() == nil {
 			if inverse, err := invert(q.tm, n.Condition()); err != nil {
 				return err
-			} else {
-				q.facts.appendFact(inverse)
+			} else if err := q.appendCondition(inverse); err != nil {
+				return err
 			}
 		}
 		if bif := n.BodyIfFalse(); len(bif) > 0 {
@@ -730,13 +933,13 @@ func (q *checker) bcheckIf(n *a.If) error {
 				return err
 			}
 			if !a.Terminates(bif) {
-				branches = append(branches, snapshot(q.facts))
+				branches = append(branches, snapshot(q.facts.exprs()))
 			}
 			break
 		}
 		n = n.ElseIf()
 		if n == nil {
-			branches = append(branches, snapshot(q.facts))
+			branches = append(branches, snapshot(q.facts.exprs()))
 			break
 		}
 	}
@@ -754,13 +957,29 @@ func (q *checker) bcheckWhile(n *a.While) error {
 		}
 	}
 
-	// Check the while condition.
+	// Check the while condition and the decreases expression, if any.
 	if _, err := q.bcheckExpr(n.Condition(), 0); err != nil {
 		return err
 	}
+	if dec := n.Decreases(); dec != nil {
+		if _, err := q.bcheckVariant(dec, 0); err != nil {
+			return err
+		}
+	}
+
+	// Infer the local variables' bounds at the start of each iteration. See
+	// widen.go.
+	s, err := q.inferLoopState(n)
+	if err != nil {
+		return err
+	}
+	// exit is the local variables' bounds after the loop, united over the
+	// natural exit and every break, or nil if none of those is reachable.
+	exit := []bounds(nil)
 
 	// Check the post conditions on exit, assuming only the pre and inv
-	// (invariant) conditions and the inverted while condition.
+	// (invariant) conditions, the inferred bounds and the inverted while
+	// condition.
 	//
 	// We don't need to check the inv conditions, even though we add them to
 	// the facts after the while loop, since we have already proven each inv
@@ -771,7 +990,7 @@ func (q *checker) bcheckWhile(n *a.While) error {
 		// prove the post conditions here, since we won't ever exit the while
 		// loop naturally. We only exit on an explicit break.
 	} else {
-		q.facts = q.facts[:0]
+		q.facts.clear()
 		for _, o := range n.Asserts() {
 			if o.AsAssert().Keyword() == t.IDPost {
 				continue
@@ -780,8 +999,13 @@ func (q *checker) bcheckWhile(n *a.While) error {
 		}
 		if inverse, err := invert(q.tm, n.Condition()); err != nil {
 			return err
-		} else {
-			q.facts.appendFact(inverse)
+		} else if err := q.appendCondition(inverse); err != nil {
+			return err
+		}
+		if consistent, err := q.appendLoopFacts(s.vars, s.bounds); err != nil {
+			return err
+		} else if consistent {
+			exit, _ = q.varBounds(s.vars)
 		}
 		for _, o := range n.Asserts() {
 			if o.AsAssert().Keyword() == t.IDPost {
@@ -796,24 +1020,141 @@ func (q *checker) bcheckWhile(n *a.While) error {
 		// We effectively have a "while false { etc }" loop. There's no need to
 		// check the body.
 	} else {
-		// Assume the pre and inv conditions...
-		q.facts = q.facts[:0]
+		// Assume the pre and inv conditions, the while condition and the
+		// inferred bounds, and check that the decreases expression, if any,
+		// is non-negative.
+		if err := q.enterWhileBody(n, s); err != nil {
+			return err
+		}
+		// Check the body, recording the bounds at each break.
+		if q.loops == nil {
+			q.loops = map[*a.While]*loopState{}
+		}
+		q.loops[n] = s
+		err := q.bcheckBlock(n.Body())
+		delete(q.loops, n)
+		if err != nil {
+			return err
+		}
+		exit = unite(exit, s.breaks)
+		// Check the pre and inv conditions, and that the decreases expression
+		// decreased, on the implicit continue after the body.
+		if !a.Terminates(n.Body()) {
+			if n.Decreases() != nil {
+				if err := q.proveDecreases(n); err != nil {
+					return err
+				}
+			}
+			for _, o := range n.Asserts() {
+				if o.AsAssert().Keyword() == t.IDPost {
+					continue
+				}
+				if err := q.bcheckAssert(o.AsAssert()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Assume the inv and post conditions, and the inferred bounds on exit.
+	q.facts.clear()
+	for _, o := range n.Asserts() {
+		if o.AsAssert().Keyword() == t.IDPre {
+			continue
+		}
+		q.facts.appendFact(o.AsAssert().Condition())
+	}
+	if exit == nil {
+		// There is no reachable exit, so the code after the loop is
+		// unreachable, and any facts apply.
+		exit = s.bounds
+	}
+	_, err = q.appendLoopFacts(s.vars, exit)
+	return err
+}
+
+func (q *checker) bcheckIterate(n *a.Iterate) error {
+	if _, err := q.bcheckExpr(n.UnrollAsExpr(), 0); err != nil {
+		return err
+	}
+	assigns := n.Assigns()
+	for _, o := range assigns {
+		o := o.AsAssign()
+		if err := q.bcheckAssignment(o.LHS(), o.Operator(), o.RHS()); err != nil {
+			return err
+		}
+	}
+
+	// Each round (the iterate loop and any else-iterate loops) is like a while
+	// loop whose condition is "there is enough remaining data". Within the
+	// body, the iterate variables are sub-slices of a fixed length. Outside of
+	// the body, they are not, so the pre, inv and post conditions cannot
+	// mention them.
+	for ; n != nil; n = n.ElseIterate() {
+		for _, o := range n.Asserts() {
+			cond := o.AsAssert().Condition()
+			for _, x := range assigns {
+				if lhs := x.AsAssign().LHS(); cond.Mentions(lhs) {
+					return fmt.Errorf("check: iterate condition %q mentions the iterate variable %q",
+						cond.Str(q.tm), lhs.Str(q.tm))
+				}
+			}
+		}
+
+		if _, err := q.bcheckExpr(n.UnrollAsExpr(), 0); err != nil {
+			return err
+		}
+
+		// Check the pre and inv conditions on entry.
+		for _, o := range n.Asserts() {
+			if o.AsAssert().Keyword() == t.IDPost {
+				continue
+			}
+			if err := q.bcheckAssert(o.AsAssert()); err != nil {
+				return err
+			}
+		}
+
+		// Check the post conditions on exit, assuming only the pre and inv
+		// conditions. The round ends when the iterate variables run out of
+		// data, which says nothing about any other variable.
+		q.facts.clear()
 		for _, o := range n.Asserts() {
 			if o.AsAssert().Keyword() == t.IDPost {
 				continue
 			}
 			q.facts.appendFact(o.AsAssert().Condition())
 		}
-		// ...and the while condition, unless it is the redundant "true".
-		if cv == nil {
-			q.facts.appendFact(n.Condition())
+		for _, o := range n.Asserts() {
+			if o.AsAssert().Keyword() == t.IDPost {
+				if err := q.bcheckAssert(o.AsAssert()); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Assume the pre and inv conditions, and the iterate variables'
+		// lengths, and check the body.
+		q.facts.clear()
+		for _, o := range n.Asserts() {
+			if o.AsAssert().Keyword() == t.IDPost {
+				continue
+			}
+			q.facts.appendFact(o.AsAssert().Condition())
+		}
+		for _, o := range assigns {
+			lhs := o.AsAssign().LHS()
+			lhsExpr := a.NewExpr(0, 0, lhs.Ident(), nil, nil, nil, nil)
+			lhsExpr.SetMType(lhs.MType())
+			q.facts.appendFact(q.makeSliceLengthEqEq(lhsExpr, n.Length()))
 		}
-		// Check the body.
 		if err := q.bcheckBlock(n.Body()); err != nil {
 			return err
 		}
+
 		// Check the pre and inv conditions on the implicit continue after the
-		// body.
+		// body. This is what makes them hold on every iteration, not just the
+		// first one.
 		if !a.Terminates(n.Body()) {
 			for _, o := range n.Asserts() {
 				if o.AsAssert().Keyword() == t.IDPost {
@@ -824,15 +1165,16 @@ func (q *checker) bcheckWhile(n *a.While) error {
 				}
 			}
 		}
-	}
 
-	// Assume the inv and post conditions.
-	q.facts = q.facts[:0]
-	for _, o := range n.Asserts() {
-		if o.AsAssert().Keyword() == t.IDPre {
-			continue
+		// Assume the inv and post conditions, for the next round (if any) or
+		// for after the iterate loop.
+		q.facts.clear()
+		for _, o := range n.Asserts() {
+			if o.AsAssert().Keyword() == t.IDPre {
+				continue
+			}
+			q.facts.appendFact(o.AsAssert().Condition())
 		}
-		q.facts.appendFact(o.AsAssert().Condition())
 	}
 	return nil
 }
@@ -841,6 +1183,9 @@ func (q *checker) bcheckVar(n *a.Var) error {
 	if _, err := q.bcheckTypeExpr(n.XType()); err != nil {
 		return err
 	}
+	if err := q.suggestVar(n); err != nil {
+		return err
+	}
 
 	lhs := a.NewExpr(0, 0, n.Name(), nil, nil, nil, nil)
 	lhs.SetMType(n.XType())
@@ -864,11 +1209,11 @@ func (q *checker) bcheckExpr(n *a.Expr, depth uint32) (bounds, error) {
 		return bcheckExprConstValue(n)
 	}
 
-	nb, err := q.bcheckExpr1(n, depth)
+	ob, err := q.bcheckExpr1(n, depth)
 	if err != nil {
 		return bounds{}, err
 	}
-	nb, err = q.facts.refine(n, nb, q.tm)
+	nb, err := q.facts.refine(n, ob, q.tm)
 	if err != nil {
 		return bounds{}, err
 	}
@@ -878,8 +1223,9 @@ func (q *checker) bcheckExpr(n *a.Expr, depth uint32) (bounds, error) {
 	}
 
 	if (nb[0].Cmp(tb[0]) < 0) || (nb[1].Cmp(tb[1]) > 0) {
-		return bounds{}, fmt.Errorf("check: expression %q bounds %v is not within bounds %v",
-			n.Str(q.tm), nb, tb)
+		q.explainBoundsFailure(n, ob, nb, tb)
+		return bounds{}, errorAtExpr(n, fmt.Errorf("check: expression %q bounds %v is not within bounds %v",
+			n.Str(q.tm), nb, tb))
 	}
 
 	n.SetMBounds(nb)
@@ -922,6 +1268,9 @@ func (q *checker) bcheckExpr1(n *a.Expr, depth uint32) (bounds, error) {
 		return q.bcheckExprUnaryOp(n, depth)
 	case op.IsXBinaryOp():
 		if op == t.IDXBinaryAs {
+			if n.AsExclam() {
+				return q.bcheckExprAsExclam(n, depth)
+			}
 			return q.bcheckExpr(n.LHS().AsExpr(), depth)
 		}
 		return q.bcheckExprBinaryOp(op, n.LHS().AsExpr(), n.RHS().AsExpr(), depth)
@@ -932,16 +1281,35 @@ func (q *checker) bcheckExpr1(n *a.Expr, depth uint32) (bounds, error) {
 	return q.bcheckExprOther(n, depth)
 }
 
+// bcheckExprAsExclam returns the bounds of "x as! T": the intersection of x's
+// bounds and T's bounds. Unlike "x as T", x's bounds do not have to be within
+// T's bounds, as the generated code checks the conversion at run time,
+// returning a "#conversion out of range" error if that check fails. The
+// generated code relies on n's MBounds being exactly that intersection.
+func (q *checker) bcheckExprAsExclam(n *a.Expr, depth uint32) (bounds, error) {
+	lhs := n.LHS().AsExpr()
+	lb, err := q.bcheckExpr(lhs, depth)
+	if err != nil {
+		return bounds{}, err
+	}
+	tb, err := q.bcheckTypeExpr(n.MType())
+	if err != nil {
+		return bounds{}, err
+	}
+	if (lb[1].Cmp(tb[0]) < 0) || (lb[0].Cmp(tb[1]) > 0) {
+		return bounds{}, errorAtExpr(n, fmt.Errorf("check: expression %q bounds %v is never within bounds %v",
+			n.Str(q.tm), lb, tb))
+	}
+	return bounds{max(lb[0], tb[0]), min(lb[1], tb[1])}, nil
+}
+
 func (q *checker) bcheckExprOther(n *a.Expr, depth uint32) (bounds, error) {
 	switch n.Operator() {
 	case 0:
-		// Look for named consts.
-		//
-		// TODO: look up "foo[i]" const expressions.
-		//
-		// TODO: allow imported consts, "foo.bar", not just "bar"?
-		qid := t.QID{0, n.Ident()}
-		if c, ok := q.c.consts[qid]; ok {
+		// Look for named consts. Indexed consts, "foo[i]", are handled by
+		// the t.IDOpenBracket case below. Imported consts, "foo.bar", are
+		// handled by the t.IDDot case below.
+		if c := q.constDecl(n); c != nil {
 			if cv := c.Value().ConstValue(); cv != nil {
 				return bounds{cv, cv}, nil
 			}
@@ -960,6 +1328,11 @@ func (q *checker) bcheckExprOther(n *a.Expr, depth uint32) (bounds, error) {
 		} else if err != errNotASpecialCase {
 			return bounds{}, err
 		}
+		if nb, ok, err := q.inferResultBounds(n); err != nil {
+			return bounds{}, err
+		} else if ok {
+			return nb, nil
+		}
 
 	case t.IDOpenBracket:
 		lhs := n.LHS().AsExpr()
@@ -967,7 +1340,8 @@ func (q *checker) bcheckExprOther(n *a.Expr, depth uint32) (bounds, error) {
 			return bounds{}, err
 		}
 		rhs := n.RHS().AsExpr()
-		if _, err := q.bcheckExpr(rhs, depth); err != nil {
+		rb, err := q.bcheckExpr(rhs, depth)
+		if err != nil {
 			return bounds{}, err
 		}
 
@@ -985,6 +1359,18 @@ func (q *checker) bcheckExprOther(n *a.Expr, depth uint32) (bounds, error) {
 			return bounds{}, err
 		}
 
+		if elems := q.constArrayElements(lhs); elems != nil {
+			if nb, ok := constElementBounds(elems, rb); ok {
+				return nb, nil
+			}
+		}
+
+		nb, err := q.bcheckTypeExpr(n.MType())
+		if err != nil {
+			return bounds{}, err
+		}
+		return q.quantifiedElementBounds(n, nb), nil
+
 	case t.IDDotDot:
 		lhs := n.LHS().AsExpr()
 		if _, err := q.bcheckExpr(lhs, depth); err != nil {
@@ -1040,6 +1426,13 @@ func (q *checker) bcheckExprOther(n *a.Expr, depth uint32) (bounds, error) {
 			return bounds{}, err
 		}
 
+		if c := q.constDecl(n); c != nil {
+			if cv := c.Value().ConstValue(); cv != nil {
+				return bounds{cv, cv}, nil
+			}
+			return q.bcheckTypeExpr(n.MType())
+		}
+
 		// TODO: delete this hack that only matches "args".
 		if n.LHS().AsExpr().Ident() == t.IDArgs {
 			for _, o := range q.astFunc.In().Fields() {
@@ -1066,8 +1459,79 @@ func (q *checker) bcheckExprOther(n *a.Expr, depth uint32) (bounds, error) {
 	return q.bcheckTypeExpr(n.MType())
 }
 
+// constDecl returns the const declaration that n names: "bar" for a const in
+// this package or "foo.bar" for a const in the used package "foo". Otherwise,
+// it returns nil.
+func (q *checker) constDecl(n *a.Expr) *a.Const {
+	switch n.Operator() {
+	case 0:
+		if n.GlobalIdent() {
+			return q.c.consts[t.QID{0, n.Ident()}]
+		}
+	case t.IDDot:
+		if lhs := n.LHS().AsExpr(); lhs.MType() == typeExprPackage {
+			return q.c.consts[t.QID{lhs.Ident(), n.Ident()}]
+		}
+	}
+	return nil
+}
+
+// constArrayElements returns the elements of n, if n is a named const array
+// ("bar" or "foo.bar") or an element of one that is itself an array
+// ("bar[2]"). Otherwise, it returns nil.
+func (q *checker) constArrayElements(n *a.Expr) []*a.Node {
+	switch n.Operator() {
+	case 0, t.IDDot:
+		if c := q.constDecl(n); (c != nil) && c.XType().IsArrayType() {
+			if args, ok := c.Value().IsList(); ok {
+				return args
+			}
+		}
+
+	case t.IDOpenBracket:
+		elems := q.constArrayElements(n.LHS().AsExpr())
+		if cv := n.RHS().AsExpr().ConstValue(); (elems != nil) && (cv != nil) &&
+			(cv.Sign() >= 0) && (cv.Cmp(big.NewInt(int64(len(elems)))) < 0) {
+			if args, ok := elems[cv.Int64()].AsExpr().IsList(); ok {
+				return args
+			}
+		}
+	}
+	return nil
+}
+
+// constElementBounds returns the bounds of the elements of a const array whose
+// index is within indexBounds. It returns false if those elements are not all
+// numeric constants, such as when they are themselves arrays.
+func constElementBounds(elems []*a.Node, indexBounds bounds) (bounds, bool) {
+	lo, hi := int64(0), int64(len(elems)-1)
+	if indexBounds[0].IsInt64() && (lo < indexBounds[0].Int64()) {
+		lo = indexBounds[0].Int64()
+	}
+	if indexBounds[1].IsInt64() && (hi > indexBounds[1].Int64()) {
+		hi = indexBounds[1].Int64()
+	}
+	if lo > hi {
+		return bounds{}, false
+	}
+
+	ret := bounds{}
+	for _, o := range elems[lo : hi+1] {
+		cv := o.AsExpr().ConstValue()
+		if cv == nil {
+			return bounds{}, false
+		}
+		if (ret[0] == nil) || (ret[0].Cmp(cv) > 0) {
+			ret[0] = cv
+		}
+		if (ret[1] == nil) || (ret[1].Cmp(cv) < 0) {
+			ret[1] = cv
+		}
+	}
+	return ret, true
+}
+
 func (q *checker) bcheckExprCall(n *a.Expr, depth uint32) error {
-	// TODO: handle func pre/post conditions.
 	lhs := n.LHS().AsExpr()
 	f, err := q.c.resolveFunc(lhs.MType())
 	if err != nil {
@@ -1083,13 +1547,21 @@ func (q *checker) bcheckExprCall(n *a.Expr, depth uint32) error {
 			return err
 		}
 	}
+	if err := q.bcheckCallPreConditions(f, n); err != nil {
+		return err
+	}
+	if (f == q.astFunc) && f.Recursive() {
+		if err := q.bcheckRecursiveCall(f, n); err != nil {
+			return err
+		}
+	}
 
 	recv := lhs.LHS().AsExpr()
 	if recv.MType().Decorator() != t.IDNptr {
 		return nil
 	}
 	// Check that q.facts contain "recv != nullptr".
-	for _, x := range q.facts {
+	for _, x := range q.facts.exprs() {
 		if x.Operator() != t.IDXBinaryNotEq {
 			continue
 		}
@@ -1103,6 +1575,36 @@ func (q *checker) bcheckExprCall(n *a.Expr, depth uint32) error {
 	return fmt.Errorf("check: cannot prove %q", recv.Str(q.tm)+" != nullptr")
 }
 
+// inferResultBounds returns the bounds of what the call n returns, if it
+// calls a private pure function in this package whose body has been checked:
+// the union of the bounds of that function's return values. Those bounds can
+// be tighter than the function's declared return type.
+//
+// If that function's body has not been checked yet, it is checked now. Mutual
+// recursion means that a function can still be being checked, in which case
+// inferResultBounds returns false and n's bounds are those of its type.
+func (q *checker) inferResultBounds(n *a.Expr) (bounds, bool, error) {
+	f, err := q.c.resolveFunc(n.LHS().AsExpr().MType())
+	if err != nil {
+		return bounds{}, false, err
+	}
+	qqid := f.QQID()
+	if (qqid[0] != 0) || f.Public() || !f.Effect().Pure() || (q.c.funcs[qqid] != f) {
+		return bounds{}, false, nil
+	}
+	if q.c.funcBodyStates[qqid] == funcBodyUnchecked {
+		if err := q.c.checkFuncBody(f.AsNode()); err != nil {
+			// With Options.MaxErrors, the callee's error does not also fail
+			// the caller, which carries on without the inferred bounds.
+			if !q.c.recordError(err) {
+				return bounds{}, false, err
+			}
+		}
+	}
+	nb, ok := q.c.resultBounds[qqid]
+	return nb, ok, nil
+}
+
 var errNotASpecialCase = errors.New("not a special case")
 
 func (q *checker) bcheckExprCallSpecialCases(n *a.Expr, depth uint32) (bounds, error) {
@@ -1152,6 +1654,85 @@ func (q *checker) bcheckExprCallSpecialCases(n *a.Expr, depth uint32) (bounds, e
 					max(lb[1], ab[1]),
 				}, nil
 			}
+
+		case t.IDMulQ16Round, t.IDMulQ8Round:
+			shift := uint(16)
+			if method == t.IDMulQ8Round {
+				shift = 8
+			}
+			lb, err := q.bcheckExpr(lhs.LHS().AsExpr(), depth)
+			if err != nil {
+				return bounds{}, err
+			}
+			ab, err := q.bcheckExpr(n.Args()[0].AsArg().Value(), depth)
+			if err != nil {
+				return bounds{}, err
+			}
+			// The receiver and argument are unsigned, so the result's bounds
+			// are the rounded products of their bounds. The C code computes
+			// the full-width product (it does not overflow) but the result
+			// has to fit in the receiver's type.
+			nb := bounds{
+				mulQRound(lb[0], ab[0], shift),
+				mulQRound(lb[1], ab[1], shift),
+			}
+			tb, err := q.bcheckTypeExpr(n.MType())
+			if err != nil {
+				return bounds{}, err
+			}
+			if nb[1].Cmp(tb[1]) > 0 {
+				return bounds{}, fmt.Errorf("check: %q bounds %v is not within bounds %v",
+					n.Str(q.tm), nb, tb)
+			}
+			return nb, nil
+
+		case t.IDFloorLog2:
+			lb, err := q.bcheckExpr(lhs.LHS().AsExpr(), depth)
+			if err != nil {
+				return bounds{}, err
+			}
+			// The log of zero is undefined.
+			if lb[0].Sign() <= 0 {
+				return bounds{}, fmt.Errorf("check: floor_log2 receiver %q is possibly zero",
+					recv.Str(q.tm))
+			}
+			return bounds{
+				big.NewInt(int64(lb[0].BitLen() - 1)),
+				big.NewInt(int64(lb[1].BitLen() - 1)),
+			}, nil
+
+		case t.IDCeilDivPow2:
+			lb, err := q.bcheckExpr(lhs.LHS().AsExpr(), depth)
+			if err != nil {
+				return bounds{}, err
+			}
+			ab, err := q.bcheckExpr(n.Args()[0].AsArg().Value(), depth)
+			if err != nil {
+				return bounds{}, err
+			}
+			// The result shrinks as the argument n grows, so the lower bound
+			// pairs the receiver's lower bound with n's upper bound.
+			return bounds{
+				ceilDivPow2(lb[0], ab[1]),
+				ceilDivPow2(lb[1], ab[0]),
+			}, nil
+		}
+
+	} else if (method == t.IDSetMetadata) && recvTyp.IsPointerType() &&
+		(recvTyp.Inner().QID() == t.QID{t.IDBase, t.IDMoreInformation}) {
+		args := n.Args()
+		if len(args) != 3 {
+			return bounds{}, fmt.Errorf("check: internal error: bad set_metadata arguments")
+		}
+		minIncl := args[1].AsArg().Value()
+		maxExcl := args[2].AsArg().Value()
+		if minIncl.Eq(maxExcl) {
+			// No-op. Proving "x <= x" is trivial.
+		} else if err := q.proveBinaryOp(t.IDXBinaryLessEq, minIncl, maxExcl); err == errFailed {
+			return bounds{}, fmt.Errorf("check: could not prove set_metadata pre-condition: %s <= %s",
+				minIncl.Str(q.tm), maxExcl.Str(q.tm))
+		} else if err != nil {
+			return bounds{}, err
 		}
 
 	} else if recvTyp.IsIOTokenType() {
@@ -1229,6 +1810,10 @@ func (q *checker) bcheckExprCallSpecialCases(n *a.Expr, depth uint32) (bounds, e
 				advance = thirtyTwo
 			case strings.HasSuffix(s, "_slice512"): // 512 bits is 64 bytes.
 				advance = sixtyFour
+			case strings.HasSuffix(s, "_slicevl"):
+				// No pre-condition. The ARM SVE or RISC-V V vector length is
+				// only known at run time, so these methods load or store
+				// min(a.length(), that length) bytes.
 			}
 		}
 	}
@@ -1257,7 +1842,7 @@ func (q *checker) bcheckExprCallSpecialCases(n *a.Expr, depth uint32) (bounds, e
 }
 
 func (q *checker) canUndoByte(recv *a.Expr) error {
-	for _, x := range q.facts {
+	for _, x := range q.facts.exprs() {
 		if lhs, meth, args, _ := x.IsMethodCall(); (meth != t.IDCanUndoByte) || (len(args) != 0) ||
 			!lhs.Eq(recv) {
 			continue
@@ -1289,7 +1874,7 @@ func (q *checker) canLimitedCopyU32FromHistoryFast(recv *a.Expr, args []*a.Node,
 	// Check "upTo <= this.length()".
 check0:
 	for {
-		for _, x := range q.facts {
+		for _, x := range q.facts.exprs() {
 			if x.Operator() != t.IDXBinaryLessEq {
 				continue
 			}
@@ -1337,7 +1922,7 @@ check0:
 	// Check "distance >= minDistance".
 check1:
 	for {
-		for _, x := range q.facts {
+		for _, x := range q.facts.exprs() {
 			if x.Operator() != t.IDXBinaryGreaterEq {
 				continue
 			}
@@ -1355,7 +1940,7 @@ check1:
 	// Check "distance <= this.history_length()".
 check2:
 	for {
-		for _, x := range q.facts {
+		for _, x := range q.facts.exprs() {
 			if x.Operator() != t.IDXBinaryLessEq {
 				continue
 			}
@@ -1525,9 +2110,30 @@ func (q *checker) bcheckExprXBinaryPlus(lhs *a.Expr, lb bounds, rhs *a.Expr, rb
 
 func (q *checker) bcheckExprXBinaryMinus(lhs *a.Expr, lb bounds, rhs *a.Expr, rb bounds) (bounds, error) {
 	nb := lb.Sub(rb)
-	for _, x := range q.facts {
+	for _, x := range q.facts.about(lhs) {
 		xOp, xLHS, xRHS := parseBinaryOp(x)
-		if !lhs.Eq(xLHS) || !rhs.Eq(xRHS) {
+		if !lhs.Eq(xLHS) {
+			continue
+		} else if !rhs.Eq(xRHS) {
+			// Look for "lhs op (rhs + c)", such as the "r.position() == x +
+			// 4" facts from advancing an io_reader, where c is a constant.
+			cOp, cLHS, cRHS := parseBinaryOp(xRHS)
+			if (cOp != t.IDXBinaryPlus) || !rhs.Eq(cLHS) || (cRHS.ConstValue() == nil) {
+				continue
+			}
+			c := cRHS.ConstValue()
+			switch xOp {
+			case t.IDXBinaryLessThan:
+				nb[1] = min(nb[1], sub1(c))
+			case t.IDXBinaryLessEq:
+				nb[1] = min(nb[1], c)
+			case t.IDXBinaryEqEq:
+				nb[0], nb[1] = max(nb[0], c), min(nb[1], c)
+			case t.IDXBinaryGreaterEq:
+				nb[0] = max(nb[0], c)
+			case t.IDXBinaryGreaterThan:
+				nb[0] = max(nb[0], add1(c))
+			}
 			continue
 		}
 		switch xOp {
@@ -1541,6 +2147,11 @@ func (q *checker) bcheckExprXBinaryMinus(lhs *a.Expr, lb bounds, rhs *a.Expr, rb
 			nb[0] = max(nb[0], one)
 		}
 	}
+	// Without such a fact, "f(x: j) - f(x: i)" is still non-negative when f
+	// is monotone in x and "i <= j".
+	if (nb[0].Sign() < 0) && (nb[1].Sign() >= 0) && q.proveMonotone(t.IDXBinaryGreaterEq, lhs, rhs, 0) {
+		nb[0] = zero
+	}
 	return nb, nil
 }
 
@@ -1552,6 +2163,22 @@ func (q *checker) bcheckExprBinaryOp(op t.ID, lhs *a.Expr, rhs *a.Expr, depth ui
 	return q.bcheckExprBinaryOp1(op, lhs, lb, rhs, depth)
 }
 
+// bcheckRoundDown returns the bounds of x if one of lhs and rhs is "x / c" and
+// the other is c, and x is non-negative. Bounds checking "x / c" has already
+// ensured that c is positive.
+func (q *checker) bcheckRoundDown(lhs *a.Expr, rhs *a.Expr, depth uint32) (xb bounds, ok bool, err error) {
+	for _, o := range [2][2]*a.Expr{{lhs, rhs}, {rhs, lhs}} {
+		if dOp, x, c := parseBinaryOp(o[0]); (dOp == t.IDXBinarySlash) && c.Eq(o[1]) {
+			xb, err := q.bcheckExpr(x, depth)
+			if err != nil {
+				return bounds{}, false, err
+			}
+			return xb, xb[0].Sign() >= 0, nil
+		}
+	}
+	return bounds{}, false, nil
+}
+
 func (q *checker) bcheckExprBinaryOp1(op t.ID, lhs *a.Expr, lb bounds, rhs *a.Expr, depth uint32) (bounds, error) {
 	rb, err := q.bcheckExpr(rhs, depth)
 	if err != nil {
@@ -1566,13 +2193,22 @@ func (q *checker) bcheckExprBinaryOp1(op t.ID, lhs *a.Expr, lb bounds, rhs *a.Ex
 		return q.bcheckExprXBinaryMinus(lhs, lb, rhs, rb)
 
 	case t.IDXBinaryStar:
-		return lb.Mul(rb), nil
+		nb := lb.Mul(rb)
+		// Rounding down to a multiple of c, "(x / c) * c", is at most x.
+		if xb, ok, err := q.bcheckRoundDown(lhs, rhs, depth); err != nil {
+			return bounds{}, err
+		} else if ok {
+			nb[1] = min(nb[1], xb[1])
+		}
+		return nb, nil
 
 	case t.IDXBinarySlash, t.IDXBinaryPercent:
-		// Prohibit division by zero.
-		if lb[0].Sign() < 0 {
+		// Like C, division truncates towards zero and the modulus has the
+		// sign of the dividend. Only a signed dividend can be negative.
+		if (lb[0].Sign() < 0) && !binaryOpIsSigned(lhs, rhs) {
 			return bounds{}, fmt.Errorf("check: divide/modulus op argument %q is possibly negative", lhs.Str(q.tm))
 		}
+		// Prohibit division by zero.
 		if rb[0].Sign() <= 0 {
 			return bounds{}, fmt.Errorf("check: divide/modulus op argument %q is possibly non-positive", rhs.Str(q.tm))
 		}
@@ -1580,12 +2216,19 @@ func (q *checker) bcheckExprBinaryOp1(op t.ID, lhs *a.Expr, lb bounds, rhs *a.Ex
 			nb, _ := lb.TryQuo(rb)
 			return nb, nil
 		}
-		return bounds{
+		nb := bounds{
 			zero,
 			big.NewInt(0).Sub(rb[1], one),
-		}, nil
+		}
+		if lb[0].Sign() < 0 {
+			nb[0] = max(lb[0], big.NewInt(0).Neg(nb[1]))
+			if lb[1].Sign() < 0 {
+				nb[1] = zero
+			}
+		}
+		return nb, nil
 
-	case t.IDXBinaryShiftL, t.IDXBinaryTildeModShiftL, t.IDXBinaryShiftR:
+	case t.IDXBinaryShiftL, t.IDXBinaryTildeModShiftL, t.IDXBinaryShiftR, t.IDXBinaryTildeModShiftR:
 		shiftBounds := bounds{}
 		typeBounds := bounds{}
 		if lTyp := lhs.MType(); lTyp.IsNumType() {
@@ -1598,8 +2241,28 @@ func (q *checker) bcheckExprBinaryOp1(op t.ID, lhs *a.Expr, lb bounds, rhs *a.Ex
 			}
 		}
 		if shiftBounds[0] == nil {
-			return bounds{}, fmt.Errorf("check: shift op argument %q of type %q does not have unsigned integer type",
+			return bounds{}, fmt.Errorf("check: shift op argument %q of type %q does not have integer type",
 				lhs.Str(q.tm), lhs.MType().Str(q.tm))
+		}
+
+		// The tilde-mod shift ops allow shifting by the type's bit width or
+		// more, giving zero. Clamping rb to that bit width gives the same
+		// result, and keeps the big.Int shifts small. For signed types, ">>"
+		// is an arithmetic shift and shifting right by the bit width or more
+		// gives the sign fill, the same as shifting by one less than that.
+		if (op == t.IDXBinaryTildeModShiftL) || (op == t.IDXBinaryTildeModShiftR) {
+			if rb[0].Sign() < 0 {
+				return bounds{}, fmt.Errorf("check: shift op argument %q is possibly negative", rhs.Str(q.tm))
+			}
+			if (op == t.IDXBinaryTildeModShiftR) && lhs.MType().IsSignedInteger() {
+				rb = bounds{min(rb[0], shiftBounds[1]), min(rb[1], shiftBounds[1])}
+			} else {
+				width := big.NewInt(0).Add(shiftBounds[1], one)
+				if rb[0].Cmp(width) >= 0 {
+					return bounds{zero, zero}, nil
+				}
+				rb = bounds{rb[0], min(rb[1], width)}
+			}
 		} else if !shiftBounds.ContainsIntRange(rb) {
 			return bounds{}, fmt.Errorf("check: shift op argument %q is outside the range %s", rhs.Str(q.tm), shiftBounds)
 		}
@@ -1610,7 +2273,14 @@ func (q *checker) bcheckExprBinaryOp1(op t.ID, lhs *a.Expr, lb bounds, rhs *a.Ex
 			return nb, nil
 		case t.IDXBinaryTildeModShiftL:
 			nb, _ := lb.TryLsh(rb)
-			nb[1] = min(nb[1], typeBounds[1])
+			if !typeBounds.ContainsIntRange(nb) {
+				// Some values could wrap around, so the result could be
+				// anything.
+				return typeBounds, nil
+			}
+			return nb, nil
+		case t.IDXBinaryTildeModShiftR:
+			nb, _ := lb.TryRsh(rb)
 			return nb, nil
 		case t.IDXBinaryShiftR:
 			nb, _ := lb.TryRsh(rb)
@@ -1618,43 +2288,81 @@ func (q *checker) bcheckExprBinaryOp1(op t.ID, lhs *a.Expr, lb bounds, rhs *a.Ex
 		}
 
 	case t.IDXBinaryAmp, t.IDXBinaryPipe, t.IDXBinaryHat:
-		// TODO: should type-checking ensure that bitwise ops only apply to
-		// *unsigned* integer types?
-		if lb[0].Sign() < 0 {
-			return bounds{}, fmt.Errorf("check: bitwise op argument %q is possibly negative", lhs.Str(q.tm))
-		}
-		if rb[0].Sign() < 0 {
-			return bounds{}, fmt.Errorf("check: bitwise op argument %q is possibly negative", rhs.Str(q.tm))
+		// Only signed integers' bitwise ops can have negative (two's
+		// complement) arguments.
+		if !binaryOpIsSigned(lhs, rhs) {
+			if lb[0].Sign() < 0 {
+				return bounds{}, fmt.Errorf("check: bitwise op argument %q is possibly negative", lhs.Str(q.tm))
+			}
+			if rb[0].Sign() < 0 {
+				return bounds{}, fmt.Errorf("check: bitwise op argument %q is possibly negative", rhs.Str(q.tm))
+			}
 		}
+		nb := bounds{}
 		switch op {
 		case t.IDXBinaryAmp:
-			return lb.And(rb), nil
+			nb = lb.And(rb)
 		case t.IDXBinaryPipe:
-			return lb.Or(rb), nil
+			nb = lb.Or(rb)
 		case t.IDXBinaryHat:
+			if (lb[0].Sign() < 0) || (rb[0].Sign() < 0) {
+				// Start with [-(m+1), m] for m being a power-of-2-minus-1
+				// such that both arguments are in that range too.
+				m := big.NewInt(0)
+				for _, x := range [4]*big.Int{lb[0], lb[1], rb[0], rb[1]} {
+					if x.Sign() < 0 {
+						x = big.NewInt(0).Not(x)
+					}
+					m = max(m, bitMask(x.BitLen()))
+				}
+				nb = bounds{
+					big.NewInt(0).Not(m),
+					m,
+				}
+				break
+			}
 			z := max(lb[1], rb[1])
-			// Return [0, z rounded up to the next power-of-2-minus-1]. This is
-			// conservative, but works fine in practice.
-			return bounds{
+			// Start with [0, z rounded up to the next power-of-2-minus-1].
+			nb = bounds{
 				zero,
 				bitMask(z.BitLen()),
-			}, nil
+			}
+		}
+		nb = q.bcheckExprBitwiseOp(op, lhs, rhs, nb)
+		// An argument that wrapped around, such as "x ~mod+ 1" for x in [0
+		// ..= 255], can have tighter wrap-around bounds than plain ones.
+		if (op != t.IDXBinaryHat) && !binaryOpIsSigned(lhs, rhs) && (isTildeModAddSub(lhs) || isTildeModAddSub(rhs)) {
+			if bits := numTypeBits(widerNumType(lhs.MType(), rhs.MType())); bits != 0 {
+				lw, rw := q.wrapRange(lhs, lb, bits), q.wrapRange(rhs, rb, bits)
+				w := lw.And(rw)
+				if op == t.IDXBinaryPipe {
+					w = lw.Or(rw)
+				}
+				nb = nb.Intersect(w.UnsignedIntRange())
+			}
 		}
+		return nb, nil
 
 	case t.IDXBinaryTildeModPlus, t.IDXBinaryTildeModMinus, t.IDXBinaryTildeModStar:
-		typ := lhs.MType()
-		if typ.IsIdeal() {
-			typ = rhs.MType()
-		}
+		typ := widerNumType(lhs.MType(), rhs.MType())
 		if qid := typ.QID(); qid[0] == t.IDBase {
-			return numTypeBounds[qid[1]], nil
+			bits := numTypeBits(typ)
+			if (op == t.IDXBinaryTildeModStar) || (bits == 0) {
+				return numTypeBounds[qid[1]], nil
+			}
+			lw, rw := q.wrapRange(lhs, lb, bits), q.wrapRange(rhs, rb, bits)
+			w := lw.Add(rw)
+			if op == t.IDXBinaryTildeModMinus {
+				w = lw.Sub(rw)
+			}
+			if typ.IsSignedInteger() {
+				return w.SignedIntRange(), nil
+			}
+			return w.UnsignedIntRange(), nil
 		}
 
 	case t.IDXBinaryTildeSatPlus, t.IDXBinaryTildeSatMinus:
-		typ := lhs.MType()
-		if typ.IsIdeal() {
-			typ = rhs.MType()
-		}
+		typ := widerNumType(lhs.MType(), rhs.MType())
 		if qid := typ.QID(); qid[0] == t.IDBase {
 			b := numTypeBounds[qid[1]]
 
@@ -1667,14 +2375,12 @@ func (q *checker) bcheckExprBinaryOp1(op t.ID, lhs *a.Expr, lb bounds, rhs *a.Ex
 				return bounds{}, err
 			}
 
-			if op == t.IDXBinaryTildeSatPlus {
-				nb[0] = min(nb[0], b[1])
-				nb[1] = min(nb[1], b[1])
-			} else {
-				nb[0] = max(nb[0], b[0])
-				nb[1] = max(nb[1], b[0])
-			}
-			return nb, nil
+			// Saturate at both ends, as adding or subtracting a negative
+			// (signed) value can overflow in the other direction.
+			return bounds{
+				max(min(nb[0], b[1]), b[0]),
+				max(min(nb[1], b[1]), b[0]),
+			}, nil
 		}
 
 	case t.IDXBinaryNotEq, t.IDXBinaryLessThan, t.IDXBinaryLessEq, t.IDXBinaryEqEq,
@@ -1687,6 +2393,62 @@ func (q *checker) bcheckExprBinaryOp1(op t.ID, lhs *a.Expr, lb bounds, rhs *a.Ex
 	return bounds{}, fmt.Errorf("check: unrecognized token (0x%X) for bcheckExprBinaryOp", op)
 }
 
+// binaryOpIsSigned returns whether "lhs op rhs" has signed integer type. As
+// a signed integer type never widens to an unsigned one, that is whether
+// either of lhs and rhs has signed integer type.
+func binaryOpIsSigned(lhs *a.Expr, rhs *a.Expr) bool {
+	return lhs.MType().IsSignedInteger() || rhs.MType().IsSignedInteger()
+}
+
+// numTypeBits returns the width, in bits, of the integer type typ, such as 8
+// for base.u8 or base.i8. It returns 0 if typ is not a sized integer type.
+func numTypeBits(typ *a.TypeExpr) uint32 {
+	qid := typ.QID()
+	if (qid[0] != t.IDBase) || (int(qid[1]) >= len(numTypeBounds)) {
+		return 0
+	}
+	b := numTypeBounds[qid[1]]
+	if b[1] == nil {
+		return 0
+	} else if b[0].Sign() < 0 {
+		return uint32(b[1].BitLen()) + 1
+	}
+	return uint32(b[1].BitLen())
+}
+
+func isTildeModAddSub(n *a.Expr) bool {
+	op := n.Operator()
+	return (op == t.IDXBinaryTildeModPlus) || (op == t.IDXBinaryTildeModMinus)
+}
+
+// wrapRange returns n's values, modulo (1 << bits), given its bounds nb. For
+// a "~mod+" or "~mod-" of that width, whose arguments have already been
+// bounds checked, it recomputes them from the arguments' wrap-around bounds.
+// Those can be tighter than nb, which cannot represent a range that wraps
+// around, such as "[250 ..= 5] mod 256", and so widens it to the full range.
+func (q *checker) wrapRange(n *a.Expr, nb bounds, bits uint32) interval.WrapRange {
+	w := interval.MakeWrapRange(nb, bits)
+	if !isTildeModAddSub(n) || (numTypeBits(n.MType()) != bits) {
+		return w
+	}
+	lhs, rhs := n.LHS().AsExpr(), n.RHS().AsExpr()
+	lb, rb := lhs.MBounds(), rhs.MBounds()
+	if (lb[0] == nil) || (rb[0] == nil) {
+		return w
+	}
+	lw, rw := q.wrapRange(lhs, lb, bits), q.wrapRange(rhs, rb, bits)
+	v := lw.Add(rw)
+	if n.Operator() == t.IDXBinaryTildeModMinus {
+		v = lw.Sub(rw)
+	}
+	// Both w and v are sound. Prefer v if it is tighter, but nb (and hence w)
+	// may have been refined by facts.
+	if w.ContainsWrapRange(v) {
+		return v
+	}
+	return w
+}
+
 func (q *checker) bcheckExprAssociativeOp(n *a.Expr, depth uint32) (bounds, error) {
 	op := n.Operator().AmbiguousForm().BinaryForm()
 	if op == 0 {
@@ -1701,12 +2463,15 @@ func (q *checker) bcheckExprAssociativeOp(n *a.Expr, depth uint32) (bounds, erro
 	if err != nil {
 		return bounds{}, err
 	}
+	lTyp := args[0].AsExpr().MType()
 	for i, o := range args {
 		if i == 0 {
 			continue
 		}
 		lhs := a.NewExpr(n.AsNode().AsRaw().Flags(),
 			n.Operator(), n.Ident(), n.LHS(), n.MHS(), n.RHS(), args[:i])
+		lhs.SetMType(lTyp)
+		lTyp = widerNumType(lTyp, o.AsExpr().MType())
 		lb, err = q.bcheckExprBinaryOp1(op, lhs, lb, o.AsExpr(), depth)
 		if err != nil {
 			return bounds{}, err
@@ -0,0 +1,520 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file implements a persistent cache of which function bodies have
+// already been bounds checked, so that re-checking a large package after
+// editing one function does not re-prove every other function.
+//
+// A cache entry's key is a hash of:
+//   - the checker itself (see checkerDigest) and the custom reasons' names,
+//   - the package's declarations, other than function bodies, but including
+//     the bodies of private pure functions (whose inferred result bounds can
+//     be used by their callers) and the source of any used packages, and
+//   - the function's own declaration and body.
+//
+// Type checking is cheap and it annotates the AST (e.g. with MType) for the
+// code generators, so it always runs. Only the bounds checking and dead store
+// analysis are skipped on a cache hit, whose entry records the side effects
+// that bounds checking would otherwise have had. Only functions that were
+// checked without any warnings are cached.
+//
+// The cache can also be shared with other machines. See remotecache.go.
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Options are optional arguments to Check. A nil *Options is valid and means
+// the zero value.
+type Options struct {
+	// CacheDir, if non-empty, is the directory that persists which function
+	// bodies have already been bounds checked, between Check calls.
+	CacheDir string
+
+	// CacheURL, if non-empty, is the base URL of a remote cache, shared with
+	// other machines, that is consulted after (and filled as well as) the
+	// CacheDir. See remotecache.go.
+	CacheURL string
+
+	// CacheVersion, if non-empty, identifies the checker for the CacheURL's
+	// entries, such as a release version or a commit hash. If empty, it is a
+	// hash of the running executable's contents.
+	CacheVersion string
+
+	// Suggest is whether to collect suggested refinements. See the
+	// Checker.Suggestions method. Suggesting needs every function body to be
+	// bounds checked, so it ignores (but still updates) the cache.
+	Suggest bool
+
+	// Explain, if non-nil, is where to write an explanation of the prover's
+	// reasoning for each proof obligation. Like Suggest, it ignores the cache.
+	Explain io.Writer
+
+	// TrackFacts is whether to record where each fact was established or
+	// dropped, for a failing function's Error.FactEvents. See WriteHTMLReport.
+	TrackFacts bool
+
+	// FactTrace, if non-nil, is where to write a trace of every fact that
+	// bounds checking inserts, drops or refines. See trace.go. Like Explain,
+	// it ignores the cache.
+	FactTrace io.Writer
+
+	// AssertCoverage is whether to report which assert statements are needed.
+	// See the Checker.AssertCoverage method. Like Suggest, it ignores the
+	// cache.
+	AssertCoverage bool
+
+	// Reasons are custom reasons, keyed by their names without the double
+	// quotes, such as "a < b: b > a". See the Reason type.
+	Reasons map[string]Reason
+
+	// Interrupt, if non-nil, is called before each top level declaration is
+	// checked. Checking stops early if it returns a non-nil error, which Check
+	// then returns. For example, it can return a context.Context's Err, so
+	// that a long Check can be cancelled.
+	Interrupt func() error
+
+	// FuncBodyChecked, if non-nil, is called after each function body has
+	// been bounds checked (or found in the cache), with how many of the
+	// package's function bodies have been so far, out of the total. Bounds
+	// checking is usually the slowest part of Check, so this can report its
+	// progress.
+	FuncBodyChecked func(n *a.Func, done int, total int)
+
+	// Arena, if non-nil, allocates the AST nodes of used packages, such as
+	// "std/crc32", parsed while checking.
+	Arena *a.Arena
+
+	// MaxErrors, if greater than one, is how many errors to report before
+	// giving up. A function body (or test) that fails to check does not stop
+	// the others from being checked and, if there were any errors, Check
+	// returns them as a diagnostic.ErrorList. Zero or one means to stop at
+	// the first error.
+	MaxErrors int
+
+	// Query, if non-nil, asks what the checker knows at a source position.
+	// Check fills in its results. Like Suggest, it ignores the cache.
+	Query *Query
+}
+
+// cacheEntry is what is persisted, as JSON, per cached function.
+type cacheEntry struct {
+	// RetsError lists which of the function's return statements, numbered in
+	// a.Node.Walk order, have RetsError set.
+	RetsError []int `json:",omitempty"`
+
+	// TokensNeeded maps those return statements, numbered likewise, that have
+	// a TokensNeeded to it, as a decimal string.
+	TokensNeeded map[int]string `json:",omitempty"`
+
+	// ResultBounds, if non-empty, holds the inferred result bounds, as
+	// decimal strings.
+	ResultBounds []string `json:",omitempty"`
+
+	// Warnings are the function's warnings, such as for dead stores, whose
+	// line numbers are relative to the function's.
+	Warnings []cacheWarning `json:",omitempty"`
+}
+
+type cacheWarning struct {
+	Message   string
+	Line      int64
+	Column    uint32 `json:",omitempty"`
+	EndColumn uint32 `json:",omitempty"`
+}
+
+var (
+	checkerDigestOnce  sync.Once
+	checkerDigestValue []byte
+)
+
+// checkerDigest identifies the running executable, so that a changed checker
+// does not trust what a previous version has cached. Hashing the whole
+// executable would cost more than the checking that the cache saves, so it
+// uses the executable's path, size and modification time, which change when
+// it is rebuilt. It returns nil if the executable cannot be found.
+func checkerDigest() []byte {
+	checkerDigestOnce.Do(func() {
+		exe, err := os.Executable()
+		if err != nil {
+			return
+		}
+		fi, err := os.Stat(exe)
+		if err != nil {
+			return
+		}
+		h := sha256.New()
+		fmt.Fprintf(h, "%s\x00%d\x00%d", exe, fi.Size(), fi.ModTime().UnixNano())
+		checkerDigestValue = h.Sum(nil)
+	})
+	return checkerDigestValue
+}
+
+type checkCache struct {
+	dir string
+	tm  *t.Map
+
+	// remote is nil if Options.CacheURL is empty.
+	remote *remoteCache
+
+	// pkgHash accumulates the package digest until pkgDigest is computed, on
+	// the first lookup.
+	pkgHash   hash.Hash
+	pkgDigest []byte
+
+	// funcDigests are computed before any phase runs, as checking a function
+	// body modifies its AST nodes (e.g. SetRetsError).
+	funcDigests map[*a.Func][]byte
+
+	// hits counts the successful lookups.
+	hits int
+}
+
+// newCheckCache returns nil if the cache is disabled.
+func newCheckCache(tm *t.Map, files []*a.File, opts *Options) *checkCache {
+	if (opts == nil) || ((opts.CacheDir == "") && (opts.CacheURL == "")) {
+		return nil
+	}
+	cd := []byte(nil)
+	remote := (*remoteCache)(nil)
+	if opts.CacheURL == "" {
+		cd = checkerDigest()
+	} else {
+		cd = versionDigest(opts.CacheVersion)
+		remote = newRemoteCache(opts.CacheURL)
+	}
+	if cd == nil {
+		return nil
+	}
+	z := &checkCache{
+		dir:         opts.CacheDir,
+		tm:          tm,
+		remote:      remote,
+		pkgHash:     sha256.New(),
+		funcDigests: map[*a.Func][]byte{},
+	}
+	z.pkgHash.Write(cd)
+
+	// The custom reasons' implementations are part of the executable, but
+	// which of them are registered can vary from one Check call to the next.
+	reasonNames := []string(nil)
+	for name := range opts.Reasons {
+		reasonNames = append(reasonNames, name)
+	}
+	sort.Strings(reasonNames)
+	for _, name := range reasonNames {
+		z.pkgHash.Write(appendString(nil, name))
+	}
+
+	buf := []byte(nil)
+	for _, f := range files {
+		for _, n := range f.TopLevelDecls() {
+			if n.Kind() != a.KFunc {
+				buf = z.appendNode(buf[:0], n)
+				z.pkgHash.Write(buf)
+				continue
+			}
+			fn := n.AsFunc()
+			buf = z.appendNode(buf[:0], n)
+			fd := sha256.Sum256(buf)
+			z.funcDigests[fn] = fd[:]
+			if !fn.Public() && fn.Effect().Pure() {
+				z.pkgHash.Write(fd[:])
+			} else {
+				buf = z.appendFuncSignature(buf[:0], fn)
+				z.pkgHash.Write(buf)
+			}
+		}
+	}
+	return z
+}
+
+// addUse adds a used package's source to the package digest.
+func (z *checkCache) addUse(filename string, src []byte) {
+	if (z == nil) || (z.pkgDigest != nil) {
+		return
+	}
+	z.pkgHash.Write(appendString(nil, filename))
+	z.pkgHash.Write(appendUint(nil, uint64(len(src))))
+	z.pkgHash.Write(src)
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(appendUint(b, uint64(len(s))), s...)
+}
+
+func appendUint(b []byte, x uint64) []byte {
+	buf := [binary.MaxVarintLen64]byte{}
+	return append(b, buf[:binary.PutUvarint(buf[:], x)]...)
+}
+
+// appendNode appends a canonical form of n, which uses names instead of token
+// IDs, as those depend on tokenization order. It omits filenames and line
+// numbers, so that moving a function does not invalidate its cache entry,
+// and the annotations (such as MType) that the checker adds.
+func (z *checkCache) appendNode(b []byte, n *a.Node) []byte {
+	if n == nil {
+		return appendUint(b, 0)
+	}
+	r := n.AsRaw()
+	b = appendUint(b, uint64(n.Kind()))
+	b = appendUint(b, uint64(r.Flags()))
+	for _, id := range r.IDs() {
+		b = appendString(b, id.Str(z.tm))
+	}
+	for _, o := range r.SubNodes() {
+		b = z.appendNode(b, o)
+	}
+	for _, l := range r.SubLists() {
+		b = appendUint(b, uint64(len(l)))
+		for _, o := range l {
+			b = z.appendNode(b, o)
+		}
+	}
+	return b
+}
+
+func (z *checkCache) appendFuncSignature(b []byte, n *a.Func) []byte {
+	r := n.AsNode().AsRaw()
+	b = appendUint(b, uint64(a.KFunc))
+	b = appendUint(b, uint64(r.Flags()))
+	for _, id := range r.IDs() {
+		b = appendString(b, id.Str(z.tm))
+	}
+	b = z.appendNode(b, n.In().AsNode())
+	b = z.appendNode(b, n.Out().AsNode())
+	b = appendUint(b, uint64(len(n.Asserts())))
+	for _, o := range n.Asserts() {
+		b = z.appendNode(b, o)
+	}
+	return b
+}
+
+// key returns n's cache key: a hex-encoded hash. It is also the filename, in
+// the cache directory, and the last element of the remote cache's URL.
+func (z *checkCache) key(n *a.Func) string {
+	fd := z.funcDigests[n]
+	if fd == nil {
+		return ""
+	}
+	if z.pkgDigest == nil {
+		z.pkgDigest = z.pkgHash.Sum(nil)
+	}
+	h := sha256.New()
+	h.Write(z.pkgDigest)
+	h.Write(fd)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// lookup returns the cache entry for n, if there is one. It looks in the
+// cache directory and then the remote cache, copying the latter's entries to
+// the former.
+func (z *checkCache) lookup(n *a.Func) (cacheEntry, bool) {
+	if z == nil {
+		return cacheEntry{}, false
+	}
+	key := z.key(n)
+	if key == "" {
+		return cacheEntry{}, false
+	}
+	e := cacheEntry{}
+	if z.dir != "" {
+		if data, err := ioutil.ReadFile(filepath.Join(z.dir, key)); err == nil {
+			if err := json.Unmarshal(data, &e); err == nil {
+				z.hits++
+				return e, true
+			}
+		}
+	}
+	if data := z.remote.get(key); data != nil {
+		if err := json.Unmarshal(data, &e); err == nil {
+			z.writeFile(key, data)
+			z.hits++
+			return e, true
+		}
+	}
+	return cacheEntry{}, false
+}
+
+// store records that n's body has been checked. Failing to write to the
+// cache is not an error, as the cache is only an optimization.
+func (z *checkCache) store(n *a.Func, resultBounds bounds, warnings []*Warning) {
+	if z == nil {
+		return
+	}
+	key := z.key(n)
+	if key == "" {
+		return
+	}
+
+	e := cacheEntry{}
+	i := 0
+	for _, o := range n.Body() {
+		o.Walk(func(o *a.Node) error {
+			if o.Kind() == a.KRet {
+				if o.AsRet().RetsError() {
+					e.RetsError = append(e.RetsError, i)
+				}
+				if tn := o.AsRet().TokensNeeded(); tn != nil {
+					if e.TokensNeeded == nil {
+						e.TokensNeeded = map[int]string{}
+					}
+					e.TokensNeeded[i] = tn.String()
+				}
+				i++
+			}
+			return nil
+		})
+	}
+	if resultBounds[0] != nil {
+		e.ResultBounds = []string{resultBounds[0].String(), resultBounds[1].String()}
+	}
+	for _, w := range warnings {
+		e.Warnings = append(e.Warnings, cacheWarning{
+			Message:   w.Err.Error(),
+			Line:      int64(w.Line) - int64(n.Line()),
+			Column:    w.Column,
+			EndColumn: w.EndColumn,
+		})
+	}
+	data, err := json.Marshal(&e)
+	if err != nil {
+		return
+	}
+	z.writeFile(key, data)
+	z.remote.put(key, data)
+}
+
+// writeFile writes data to the cache directory, if there is one, as key.
+func (z *checkCache) writeFile(key string, data []byte) {
+	if z.dir == "" {
+		return
+	}
+	if err := os.MkdirAll(z.dir, 0755); err != nil {
+		return
+	}
+	// Write to a temporary file and rename it, so that concurrent readers
+	// never see a partially written entry.
+	f, err := ioutil.TempFile(z.dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(z.dir, key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// applyCacheEntry re-applies the side effects that bounds checking n's body
+// would have had: setting RetsError and TokensNeeded, the inferred result
+// bounds, the warnings and every expression's MBounds. As the body was
+// previously proven to be within its types' bounds, each expression's MBounds
+// is simply its type's bounds.
+func (q *checker) applyCacheEntry(n *a.Func, e cacheEntry) error {
+	if len(e.ResultBounds) == 2 {
+		lo, ok0 := big.NewInt(0).SetString(e.ResultBounds[0], 10)
+		hi, ok1 := big.NewInt(0).SetString(e.ResultBounds[1], 10)
+		if ok0 && ok1 {
+			q.resultBounds = bounds{lo, hi}
+		}
+	}
+
+	for _, w := range e.Warnings {
+		q.c.funcWarnings = append(q.c.funcWarnings, &Warning{
+			Err:       errors.New(w.Message),
+			Filename:  n.Filename(),
+			Line:      uint32(int64(n.Line()) + w.Line),
+			Column:    w.Column,
+			EndColumn: w.EndColumn,
+		})
+	}
+
+	retsError := map[int]bool{}
+	for _, i := range e.RetsError {
+		retsError[i] = true
+	}
+	i := 0
+	for _, o := range n.Body() {
+		if err := o.Walk(func(o *a.Node) error {
+			switch o.Kind() {
+			case a.KRet:
+				if retsError[i] {
+					o.AsRet().SetRetsError()
+				}
+				if tn, ok := e.TokensNeeded[i]; ok {
+					if x, ok := big.NewInt(0).SetString(tn, 10); ok {
+						o.AsRet().SetTokensNeeded(x)
+					}
+				}
+				i++
+			default:
+				return q.setBoundsFromType(o)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setBoundsFromType sets n's MBounds, if n is an expression or type
+// expression, to its constant value or else its type's bounds, without
+// proving anything about it.
+func (q *checker) setBoundsFromType(n *a.Node) error {
+	switch n.Kind() {
+	case a.KExpr:
+		n := n.AsExpr()
+		if n.ConstValue() != nil {
+			if _, err := bcheckExprConstValue(n); err != nil {
+				return err
+			}
+		} else if b := n.MBounds(); b[0] == nil {
+			b, err := q.bcheckTypeExpr(n.MType())
+			if err != nil {
+				return err
+			}
+			n.SetMBounds(b)
+		}
+	case a.KTypeExpr:
+		if _, err := q.bcheckTypeExpr(n.AsTypeExpr()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
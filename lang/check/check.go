@@ -23,6 +23,7 @@ import (
 	"sort"
 
 	"github.com/google/wuffs/lang/builtin"
+	"github.com/google/wuffs/lang/diagnostic"
 	"github.com/google/wuffs/lang/parse"
 
 	a "github.com/google/wuffs/lang/ast"
@@ -34,12 +35,24 @@ type Error struct {
 	Filename string
 	Line     uint32
 
+	// Column and EndColumn, if non-zero, narrow the location to part of the
+	// Line, such as the sub-expression that failed a bounds check. They are
+	// 1-based byte offsets and EndColumn is exclusive. EndColumn is zero if
+	// the span continues past the Line.
+	Column    uint32
+	EndColumn uint32
+
 	TMap  *t.Map
 	Facts []*a.Expr
+
+	// FactEvents is nil unless Options.TrackFacts was set. If non-nil, it
+	// holds, in order, the Facts' events and then those of the facts that
+	// were dropped before the error.
+	FactEvents []FactEvent
 }
 
 func (e *Error) Error() string {
-	s := fmt.Sprintf("%s at %s:%d", e.Err, e.Filename, e.Line)
+	s := fmt.Sprintf("%s at %s", e.Err, position(e.Filename, e.Line, e.Column))
 	if e.TMap == nil {
 		return s
 	}
@@ -52,7 +65,11 @@ func (e *Error) Error() string {
 	return string(b)
 }
 
-func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte, error)) (*Checker, error) {
+// Check type and bounds checks a package's files, which were parsed using tm.
+//
+// Check can be called concurrently, provided that each call has its own tm and
+// files.
+func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte, error), opts *Options) (*Checker, error) {
 	for _, f := range files {
 		if f == nil {
 			return nil, errors.New("check: Check given a nil *ast.File")
@@ -69,6 +86,11 @@ func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte,
 		}
 	}
 
+	specializedArgs, err := specialize(tm, files)
+	if err != nil {
+		return nil, err
+	}
+
 	rMap := reasonMap{}
 	for _, r := range reasons {
 		if id := tm.ByName(r.s); id != 0 {
@@ -85,12 +107,16 @@ func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte,
 		},
 
 		consts:   map[t.QID]*a.Const{},
+		features: map[t.QID]*a.Feature{},
 		statuses: map[t.QID]*a.Status{},
 		structs:  map[t.QID]*a.Struct{},
 
 		funcs:     map[t.QQID]*a.Func{},
 		localVars: map[t.QQID]typeMap{},
 
+		funcBodyStates: map[t.QQID]funcBodyState{},
+		resultBounds:   map[t.QQID]bounds{},
+
 		builtInSliceFuncs:   map[t.QQID]*a.Func{},
 		builtInSliceU8Funcs: map[t.QQID]*a.Func{},
 		builtInTableFuncs:   map[t.QQID]*a.Func{},
@@ -98,6 +124,53 @@ func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte,
 		builtInInterfaces:     map[t.QID][]t.QQID{},
 		builtInInterfaceFuncs: map[t.QQID]*a.Func{},
 		unseenInterfaceImpls:  map[t.QQID]*a.Func{},
+
+		strictnesses: map[string]strictness{},
+
+		probeFuncs:    map[t.QID]*a.Func{},
+		seekableFuncs: map[t.QID]*a.Func{},
+
+		specializedArgs: specializedArgs,
+
+		constOrder: newDeclOrder("const", constName, constDeps),
+		lemmaOrder: newDeclOrder("lemma", lemmaName, lemmaDeps),
+
+		cache: newCheckCache(tm, files, opts),
+	}
+	for _, f := range files {
+		for _, n := range f.TopLevelDecls() {
+			switch n.Kind() {
+			case a.KConst:
+				c.constOrder.add(n)
+			case a.KLemma:
+				c.lemmaOrder.add(n)
+			case a.KFunc:
+				if len(n.AsFunc().Body()) > 0 {
+					c.numFuncBodies++
+				}
+			}
+		}
+	}
+	if (opts != nil) && opts.Suggest {
+		c.suggester = &suggester{ranges: map[suggestKey]*suggestRange{}}
+	}
+	if (opts != nil) && (opts.Explain != nil) {
+		c.explainer = &explainer{w: opts.Explain}
+	}
+	c.trackFacts = (opts != nil) && opts.TrackFacts
+	if (opts != nil) && (opts.FactTrace != nil) {
+		c.factTracer = &factTracer{w: opts.FactTrace, tm: tm}
+	}
+	c.coverAsserts = (opts != nil) && opts.AssertCoverage
+	if opts != nil {
+		if err := c.addReasons(opts.Reasons); err != nil {
+			return nil, err
+		}
+		c.interrupt = opts.Interrupt
+		c.funcBodyChecked = opts.FuncBodyChecked
+		c.arena = opts.Arena
+		c.maxErrors = opts.MaxErrors
+		c.query = opts.Query
 	}
 
 	for _, funcs := range builtin.Funcs {
@@ -133,15 +206,15 @@ func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte,
 		if err != nil {
 			return nil, err
 		}
-		xType := (*a.TypeExpr)(nil)
+		// Checking the const sets its type's MType, so the type must not be
+		// a typeExprEtc value shared with other, concurrent, Checkers.
 		switch z.Type {
-		case t.IDU32:
-			xType = typeExprU32
-		case t.IDU64:
-			xType = typeExprU64
+		case t.IDU32, t.IDU64:
+			// No-op.
 		default:
 			return nil, fmt.Errorf("check: unsupported built-in const type %q", z.Type.Str(tm))
 		}
+		xType := a.NewTypeExpr(0, t.IDBase, z.Type, nil, nil, nil)
 		value, err := tm.Insert(z.Value)
 		if err != nil {
 			return nil, err
@@ -164,8 +237,11 @@ func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte,
 	for _, phase := range phases {
 		for _, f := range files {
 			if phase.kind == a.KInvalid {
+				if err := c.checkInterrupt(); err != nil {
+					return nil, c.errorList(err)
+				}
 				if err := phase.check(c, nil); err != nil {
-					return nil, err
+					return nil, c.errorList(err)
 				}
 				continue
 			}
@@ -173,34 +249,65 @@ func Check(tm *t.Map, files []*a.File, resolveUse func(usePath string) ([]byte,
 				if n.Kind() != phase.kind {
 					continue
 				}
+				if err := c.checkInterrupt(); err != nil {
+					return nil, c.errorList(err)
+				}
 				if err := phase.check(c, n); err != nil {
-					return nil, err
+					if !phase.recoverable || !c.recordError(err) {
+						return nil, c.errorList(err)
+					}
 				}
 			}
 			setPlaceholderMBoundsMType(f.AsNode())
 		}
+		// Later phases assume that the earlier ones succeeded.
+		if len(c.errs) > 0 {
+			return nil, c.errs.Err()
+		}
 	}
 
 	return c, nil
 }
 
+func (c *Checker) checkInterrupt() error {
+	if c.interrupt == nil {
+		return nil
+	}
+	return c.interrupt()
+}
+
+// phases are the steps of Check. The recoverable ones check each function
+// body (or test) independently, so that, with Options.MaxErrors, one failing
+// does not stop the others from being checked.
 var phases = [...]struct {
-	kind  a.Kind
-	check func(*Checker, *a.Node) error
+	kind        a.Kind
+	check       func(*Checker, *a.Node) error
+	recoverable bool
 }{
-	{a.KUse, (*Checker).checkUse},
-	{a.KStatus, (*Checker).checkStatus},
-	{a.KConst, (*Checker).checkConst},
-	{a.KStruct, (*Checker).checkStructDecl},
-	{a.KInvalid, (*Checker).checkStructCycles},
-	{a.KStruct, (*Checker).checkStructFields},
-	{a.KFunc, (*Checker).checkFuncSignature},
-	{a.KFunc, (*Checker).checkFuncContract},
-	{a.KFunc, (*Checker).checkFuncImplements},
-	{a.KFunc, (*Checker).checkFuncBody},
-	{a.KInvalid, (*Checker).checkInterfacesSatisfied},
-	{a.KStruct, (*Checker).checkFieldMethodCollisions},
-	{a.KInvalid, (*Checker).checkAllTypeChecked},
+	{a.KPragma, (*Checker).checkPragma, false},
+	{a.KUse, (*Checker).checkUse, false},
+	{a.KFeature, (*Checker).checkFeature, false},
+	{a.KStatus, (*Checker).checkStatus, false},
+	{a.KConst, (*Checker).checkConst, false},
+	{a.KStruct, (*Checker).checkStructDecl, false},
+	{a.KInvalid, (*Checker).checkStructCycles, false},
+	{a.KStruct, (*Checker).checkStructFields, false},
+	{a.KLemma, (*Checker).checkLemma, false},
+	{a.KFunc, (*Checker).checkFuncSignature, false},
+	{a.KFunc, (*Checker).checkFuncContract, false},
+	{a.KFunc, (*Checker).checkFuncImplements, false},
+	{a.KFunc, (*Checker).checkFuncBody, true},
+	{a.KFunc, (*Checker).checkFuncProbe, false},
+	{a.KFunc, (*Checker).checkFuncSeekable, false},
+	{a.KFunc, (*Checker).checkFuncWorkbufLess, false},
+	{a.KFunc, (*Checker).checkFuncRecursion, false},
+	{a.KFunc, (*Checker).checkFuncTaint, true},
+	{a.KTest, (*Checker).checkTest, true},
+	{a.KInvalid, (*Checker).checkInterfacesSatisfied, false},
+	{a.KStruct, (*Checker).checkFieldMethodCollisions, false},
+	{a.KStruct, (*Checker).checkStructPubFields, false},
+	{a.KInvalid, (*Checker).checkAllTypeChecked, false},
+	{a.KInvalid, (*Checker).checkStrictWarnings, false},
 }
 
 type reason func(q *checker, n *a.Assert) error
@@ -218,8 +325,10 @@ type Checker struct {
 	// For `use "foo/bar"`, the name is the base name: "bar".
 	topLevelNames map[t.ID]a.Kind
 
-	// These maps are keyed by the const/status/struct name (QID).
+	// These maps are keyed by the const/feature/status/struct name (QID).
+	// Features are in their own namespace, not in topLevelNames.
 	consts   map[t.QID]*a.Const
+	features map[t.QID]*a.Feature
 	statuses map[t.QID]*a.Status
 	structs  map[t.QID]*a.Struct
 
@@ -227,6 +336,12 @@ type Checker struct {
 	funcs     map[t.QQID]*a.Func
 	localVars map[t.QQID]typeMap
 
+	// funcBodyStates and resultBounds are also keyed by the func name. The
+	// resultBounds map holds the inferred bounds of what private pure
+	// functions return, which can be tighter than the declared return type.
+	funcBodyStates map[t.QQID]funcBodyState
+	resultBounds   map[t.QQID]bounds
+
 	builtInSliceFuncs   map[t.QQID]*a.Func
 	builtInSliceU8Funcs map[t.QQID]*a.Func
 	builtInTableFuncs   map[t.QQID]*a.Func
@@ -236,6 +351,206 @@ type Checker struct {
 	unseenInterfaceImpls  map[t.QQID]*a.Func
 
 	unsortedStructs []*a.Struct
+
+	// constOrder and lemmaOrder check consts and lemmas in dependency order,
+	// not declaration order. See order.go.
+	constOrder *declOrder
+	lemmaOrder *declOrder
+
+	// strictnesses is keyed by filename. Files without a "pragma strictness"
+	// are strictnessStandard.
+	strictnesses map[string]strictness
+
+	// termination is the package's "pragma termination required", if any.
+	// Unlike strictness, it applies to every file in the package, requiring
+	// each while loop to have a decreases clause.
+	termination *a.Pragma
+
+	// taint is the package's "pragma taint required", if any. Like
+	// termination, it applies to every file in the package. taintAnalysis is
+	// computed when first needed. See taint.go.
+	taint         *a.Pragma
+	taintAnalysis *taintAnalysis
+
+	tests []*a.Test
+
+	// probeFuncs is keyed by the receiver (QID) of each probe function. See
+	// probe.go.
+	probeFuncs map[t.QID]*a.Func
+
+	// seekableFuncs is keyed by the receiver (QID) of each seekable function.
+	// See seekable.go.
+	seekableFuncs map[t.QID]*a.Func
+
+	warnings []*Warning
+
+	// funcWarnings are the warnings for the function body being checked.
+	// They are appended to warnings once it has been checked. A function body
+	// can be checked out of order, during another one's (see
+	// inferResultBounds), so that they can be cached per function.
+	funcWarnings []*Warning
+
+	// specializedArgs are the constant arguments of each specialized copy of
+	// a function. See specialize.go.
+	specializedArgs map[*a.Func][]specializedArg
+
+	// cache is nil if Options.CacheDir is empty.
+	cache *checkCache
+
+	// suggester is nil if Options.Suggest is false.
+	suggester *suggester
+
+	// explainer is nil if Options.Explain is nil.
+	explainer *explainer
+
+	// query is Options.Query. See query.go.
+	query *Query
+
+	trackFacts bool
+
+	// factTracer is nil if Options.FactTrace is nil. See trace.go.
+	factTracer *factTracer
+
+	// coverAsserts is Options.AssertCoverage. See coverage.go.
+	coverAsserts   bool
+	assertCoverage []*AssertCoverage
+
+	// interrupt and funcBodyChecked are Options.Interrupt and
+	// Options.FuncBodyChecked. The latter's done and total arguments are
+	// numFuncBodiesChecked and numFuncBodies.
+	interrupt            func() error
+	funcBodyChecked      func(n *a.Func, done int, total int)
+	numFuncBodies        int
+	numFuncBodiesChecked int
+
+	// arena is Options.Arena.
+	arena *a.Arena
+
+	// errs are the errors recorded so far, up to Options.MaxErrors, from
+	// the recoverable phases. See recordError.
+	errs      diagnostic.ErrorList
+	maxErrors int
+}
+
+// recordError records err, a function body's (or test's) failure, so that
+// checking can carry on with the next one. It returns false, recording
+// nothing, if Check should instead return now, as err is some other sort of
+// error or the error limit is reached.
+func (c *Checker) recordError(err error) bool {
+	if _, ok := err.(*Error); !ok || (len(c.errs)+1 >= c.maxErrors) {
+		return false
+	}
+	c.errs = append(c.errs, err)
+	return true
+}
+
+// errorList returns err after any previously recorded errors.
+func (c *Checker) errorList(err error) error {
+	if len(c.errs) == 0 {
+		return err
+	}
+	return append(c.errs, err)
+}
+
+// Warnings returns the non-fatal diagnostics, such as dead stores, found while
+// checking.
+func (c *Checker) Warnings() []*Warning { return c.warnings }
+
+// strictness is a per-file checker profile, selected by a "pragma strictness
+// etc" top-level declaration, so that new checks can be adopted gradually:
+//   - legacy files get no warnings.
+//   - standard files (the default) get warnings, such as for dead stores.
+//   - strict files get those warnings as errors.
+type strictness uint8
+
+const (
+	strictnessStandard = strictness(0)
+	strictnessLegacy   = strictness(1)
+	strictnessStrict   = strictness(2)
+)
+
+var strictnessesByName = map[string]strictness{
+	"legacy":   strictnessLegacy,
+	"standard": strictnessStandard,
+	"strict":   strictnessStrict,
+}
+
+func (c *Checker) checkPragma(node *a.Node) error {
+	n := node.AsPragma()
+	switch key := n.Key().Str(c.tm); key {
+	case "strictness":
+		value := n.Value().Str(c.tm)
+		s, ok := strictnessesByName[value]
+		if !ok {
+			return &Error{
+				Err:      fmt.Errorf("check: unknown strictness %q", value),
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		}
+		if _, ok := c.strictnesses[n.Filename()]; ok {
+			return &Error{
+				Err:      fmt.Errorf("check: duplicate pragma strictness"),
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		}
+		c.strictnesses[n.Filename()] = s
+	case "termination":
+		if value := n.Value().Str(c.tm); value != "required" {
+			return &Error{
+				Err:      fmt.Errorf("check: unknown termination %q", value),
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		}
+		if c.termination != nil {
+			return &Error{
+				Err:      fmt.Errorf("check: duplicate pragma termination"),
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		}
+		c.termination = n
+	case "taint":
+		if value := n.Value().Str(c.tm); value != "required" {
+			return &Error{
+				Err:      fmt.Errorf("check: unknown taint %q", value),
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		}
+		if c.taint != nil {
+			return &Error{
+				Err:      fmt.Errorf("check: duplicate pragma taint"),
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		}
+		c.taint = n
+	default:
+		return &Error{
+			Err:      fmt.Errorf("check: unknown pragma %q", key),
+			Filename: n.Filename(),
+			Line:     n.Line(),
+		}
+	}
+	return nil
+}
+
+func (c *Checker) checkStrictWarnings(node *a.Node) error {
+	for _, w := range c.warnings {
+		if c.strictnesses[w.Filename] == strictnessStrict {
+			return &Error{
+				Err:       w.Err,
+				Filename:  w.Filename,
+				Line:      w.Line,
+				Column:    w.Column,
+				EndColumn: w.EndColumn,
+			}
+		}
+	}
+	return nil
 }
 
 func (c *Checker) checkUse(node *a.Node) error {
@@ -263,12 +578,14 @@ func (c *Checker) checkUse(node *a.Node) error {
 	if err != nil {
 		return err
 	}
+	c.cache.addUse(filename, src)
 	tokens, _, err := t.Tokenize(c.tm, filename, src)
 	if err != nil {
 		return err
 	}
 	f, err := parse.Parse(c.tm, filename, tokens, &parse.Options{
 		AllowDoubleUnderscoreNames: true,
+		Arena:                      c.arena,
 	})
 	if err != nil {
 		return err
@@ -284,6 +601,10 @@ func (c *Checker) checkUse(node *a.Node) error {
 			if err := c.checkConst(n); err != nil {
 				return err
 			}
+		case a.KFeature:
+			if err := c.checkFeature(n); err != nil {
+				return err
+			}
 		case a.KFunc:
 			if err := c.checkFuncSignature(n); err != nil {
 				return err
@@ -303,6 +624,21 @@ func (c *Checker) checkUse(node *a.Node) error {
 	return nil
 }
 
+func (c *Checker) checkFeature(node *a.Node) error {
+	n := node.AsFeature()
+	qid := n.QID()
+	if c.features[qid] != nil {
+		return &Error{
+			Err:      fmt.Errorf("check: duplicate feature %q", qid.Str(c.tm)),
+			Filename: n.Filename(),
+			Line:     n.Line(),
+		}
+	}
+	c.features[qid] = n
+	setPlaceholderMBoundsMType(n.AsNode())
+	return nil
+}
+
 func (c *Checker) checkStatus(node *a.Node) error {
 	n := node.AsStatus()
 	qid := n.QID()
@@ -324,11 +660,38 @@ func (c *Checker) checkStatus(node *a.Node) error {
 	}
 	c.statuses[qid] = n
 
+	if class := n.Class(); class != 0 {
+		if err := c.checkStatusClass(n, class); err != nil {
+			return &Error{
+				Err:      err,
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		}
+	}
+
 	setPlaceholderMBoundsMType(n.AsNode())
 	return nil
 }
 
+func (c *Checker) checkStatusClass(n *a.Status, class t.ID) error {
+	msg, _ := t.Unescape(n.QID()[1].Str(c.tm))
+	if (msg == "") || (msg[0] != '#') {
+		return fmt.Errorf("check: status %s is not an error but has a class", n.QID()[1].Str(c.tm))
+	}
+	for _, z := range builtin.StatusClasses {
+		if class.Str(c.tm) == z.Name {
+			return nil
+		}
+	}
+	return fmt.Errorf("check: unrecognized status class %q", class.Str(c.tm))
+}
+
 func (c *Checker) checkConst(node *a.Node) error {
+	return c.constOrder.visit(c.tm, node, c.checkConst1)
+}
+
+func (c *Checker) checkConst1(node *a.Node) error {
 	n := node.AsConst()
 	qid := n.QID()
 	if qid[0] == 0 {
@@ -643,8 +1006,11 @@ func (c *Checker) checkFuncContract(node *a.Node) error {
 		return nil
 	}
 	q := &checker{
-		c:  c,
-		tm: c.tm,
+		c:         c,
+		tm:        c.tm,
+		reasonMap: c.reasonMap,
+		astFunc:   n,
+		localVars: c.localVars[n.QQID()],
 	}
 	for _, o := range n.Asserts() {
 		setPlaceholderMBoundsMType(o)
@@ -689,11 +1055,31 @@ func (c *Checker) checkFuncImplements(node *a.Node) error {
 	return nil
 }
 
+// funcBodyState tracks whether checkFuncBody has run for a function. It can
+// run out of declaration order, when inferring a private pure function's
+// result bounds for one of its callers (see inferResultBounds).
+type funcBodyState uint8
+
+const (
+	funcBodyUnchecked = funcBodyState(0)
+	funcBodyChecking  = funcBodyState(1)
+	funcBodyChecked   = funcBodyState(2)
+)
+
 func (c *Checker) checkFuncBody(node *a.Node) error {
 	n := node.AsFunc()
 	if len(n.Body()) == 0 {
 		return nil
 	}
+	qqid := n.QQID()
+	if c.funcBodyStates[qqid] != funcBodyUnchecked {
+		return nil
+	}
+	c.funcBodyStates[qqid] = funcBodyChecking
+
+	outerFuncWarnings := c.funcWarnings
+	c.funcWarnings = nil
+	defer func() { c.funcWarnings = outerFuncWarnings }()
 
 	q := &checker{
 		c:         c,
@@ -705,35 +1091,114 @@ func (c *Checker) checkFuncBody(node *a.Node) error {
 
 	// Fill in the TypeMap with all local variables.
 	if err := q.tcheckVars(calcCPUArchBits(q.astFunc), n.Body()); err != nil {
-		return &Error{
-			Err:      err,
-			Filename: q.errFilename,
-			Line:     q.errLine,
-		}
+		return q.newError(err)
 	}
 
 	// TODO: check that variables are never used before they're initialized.
 
 	for _, o := range n.Body() {
 		if err := q.tcheckStatement(o); err != nil {
+			return q.newError(err)
+		}
+	}
+
+	for _, o := range c.specializedArgs[n] {
+		if err := q.tcheckExpr(o.value, 0); err != nil {
+			return &Error{Err: err, Filename: o.filename, Line: o.line}
+		}
+		if _, err := q.bcheckExpr(o.value, 0); err != nil {
+			return &Error{Err: err, Filename: o.filename, Line: o.line}
+		}
+	}
+
+	bounded := map[*a.Node]bool(nil)
+	if c.coverAsserts {
+		bounded = boundedExprs(n)
+	}
+
+	if e, ok := c.cache.lookup(n); ok && (c.suggester == nil) && (c.explainer == nil) && (c.query == nil) && !c.coverAsserts &&
+		(c.factTracer == nil) {
+		if err := q.applyCacheEntry(n, e); err != nil {
 			return &Error{
 				Err:      err,
-				Filename: q.errFilename,
-				Line:     q.errLine,
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		}
+	} else if err := c.checkFuncBodyBounds(q, n); err != nil {
+		return err
+	} else {
+		if c.coverAsserts {
+			if err := c.checkAssertCoverage(q, n, bounded); err != nil {
+				return err
 			}
 		}
+		c.cache.store(n, q.resultBounds, c.funcWarnings)
+	}
+
+	if !n.Public() && n.Effect().Pure() && (q.resultBounds[0] != nil) {
+		c.resultBounds[qqid] = q.resultBounds
 	}
+	c.warnings = append(c.warnings, c.funcWarnings...)
+	c.funcBodyStates[qqid] = funcBodyChecked
+	if c.funcBodyChecked != nil {
+		c.numFuncBodiesChecked++
+		c.funcBodyChecked(n, c.numFuncBodiesChecked, c.numFuncBodies)
+	}
+	return nil
+}
 
+// checkFuncBodyBounds bounds checks n's body, after it has been type checked,
+// and looks for dead stores.
+func (c *Checker) checkFuncBodyBounds(q *checker, n *a.Func) error {
+	q.scopeEnds = findScopeEnds(n.Body())
+	if c.trackFacts || (c.factTracer != nil) {
+		q.facts.log = newFactLog(n.Line())
+		if c.factTracer != nil {
+			q.facts.log.tracer = c.factTracer
+			q.facts.log.traceFunc = c.factTracer.beginFunc(n)
+		}
+	}
+	q.assumeFuncPreConditions()
 	if err := q.bcheckBlock(n.Body()); err != nil {
+		if e, ok := err.(*Error); ok {
+			// The error is from checking another function's body, out of
+			// order. See inferResultBounds.
+			return e
+		}
+		e := q.newError(err)
+		e.TMap = c.tm
+		e.Facts = q.facts.exprs()
+		e.FactEvents = q.factEvents()
+		return e
+	}
+	if !a.Terminates(n.Body()) {
+		if err := q.bcheckFuncPostConditions(nil); err != nil {
+			return &Error{
+				Err:        err,
+				Filename:   n.Filename(),
+				Line:       n.Line(),
+				TMap:       c.tm,
+				Facts:      q.facts.exprs(),
+				FactEvents: q.factEvents(),
+			}
+		}
+	}
+	if err := q.verifyMonotone(); err != nil {
 		return &Error{
 			Err:      err,
-			Filename: q.errFilename,
-			Line:     q.errLine,
-			TMap:     c.tm,
-			Facts:    q.facts,
+			Filename: n.Filename(),
+			Line:     n.Line(),
 		}
 	}
 
+	if err := c.findDeadStores(n, q.localVars); err != nil {
+		return &Error{
+			Err:      err,
+			Filename: n.Filename(),
+			Line:     n.Line(),
+		}
+	}
 	return nil
 }
 
@@ -799,6 +1264,11 @@ func (c *Checker) checkAllTypeChecked(node *a.Node) error {
 			return err
 		}
 	}
+	for _, v := range c.tests {
+		if err := allTypeChecked(c.tm, v.AsNode()); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -863,9 +1333,33 @@ type checker struct {
 	reasonMap reasonMap
 	astFunc   *a.Func
 	localVars typeMap
+	scopeEnds scopeEnds
+
+	// omittedAssert, if non-nil, is an assert statement to skip, when checking
+	// assert coverage.
+	omittedAssert *a.Assert
 
 	errFilename string
 	errLine     uint32
+	errSpan     t.Span
 
 	facts facts
+
+	// inAssert is whether the expression being type checked is an assertion
+	// condition, the only place where quantified facts may be written.
+	inAssert bool
+
+	// resultBounds is the union of the bounds of the function's return
+	// values, so far.
+	resultBounds bounds
+
+	// loops holds the while loops whose breaks and continues are being
+	// recorded, and speculations counts the speculative checks of their
+	// bodies. See widen.go.
+	loops        map[*a.While]*loopState
+	speculations int
+
+	// positionVars holds the local variables assigned from an io_reader's
+	// position, whose facts are dropped at suspension points. See position.go.
+	positionVars map[t.ID]struct{}
 }
@@ -17,13 +17,20 @@ package check
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/google/wuffs/lang/builtin"
+	"github.com/google/wuffs/lang/diagnostic"
 	"github.com/google/wuffs/lang/parse"
 	"github.com/google/wuffs/lang/render"
 
@@ -56,6 +63,98 @@ func compareToWuffsfmt(tm *t.Map, tokens []t.Token, comments []string, src strin
 	return nil
 }
 
+// checkTestCase is a single file package's source code and the error (if any)
+// that checking it, and then running its test blocks, should produce.
+type checkTestCase struct {
+	src string
+	// wantErr is empty if there should be no error. Otherwise, the error
+	// message should contain it.
+	wantErr string
+}
+
+// checkSource tokenizes, parses and checks src, a single file package, and
+// then runs its test blocks. Tokenize and parse errors are returned as is.
+func checkSource(tt *testing.T, src string) error {
+	tt.Helper()
+	z, err := checkSourceWith(src, nil, nil)
+	if err != nil {
+		return err
+	}
+	return z.runTests()
+}
+
+// checkedSource is the result of checkSourceWith.
+type checkedSource struct {
+	tm   *t.Map
+	file *a.File
+	c    *Checker
+}
+
+// checkSourceWith tokenizes, parses and checks src, a single file package
+// named "test.wuffs", passing resolveUse and opts to Check. Unlike
+// checkSource, it does not run test blocks.
+func checkSourceWith(src string, resolveUse func(usePath string) ([]byte, error), opts *Options) (z checkedSource, err error) {
+	const filename = "test.wuffs"
+	z.tm = &t.Map{}
+	tokens, _, err := t.Tokenize(z.tm, filename, []byte(src))
+	if err != nil {
+		return z, err
+	}
+	if z.file, err = parse.Parse(z.tm, filename, tokens, nil); err != nil {
+		return z, err
+	}
+	z.c, err = Check(z.tm, []*a.File{z.file}, resolveUse, opts)
+	return z, err
+}
+
+// runTests runs the checked source's test blocks.
+func (z checkedSource) runTests() error {
+	for _, n := range z.c.Tests() {
+		if err := z.c.RunTest(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runCheckTestCases runs checkSource on each test case, with its src
+// prefixed by prefix, and compares the resultant error with wantErr.
+func runCheckTestCases(tt *testing.T, prefix string, testCases []checkTestCase) {
+	tt.Helper()
+	runCheckTestCasesWith(tt, prefix, testCases, nil, nil)
+}
+
+// runCheckTestCasesWith is like runCheckTestCases but it also takes Check's
+// resolveUse and opts arguments.
+func runCheckTestCasesWith(tt *testing.T, prefix string, testCases []checkTestCase,
+	resolveUse func(usePath string) ([]byte, error), opts *Options) {
+
+	tt.Helper()
+	for i, tc := range testCases {
+		src := strings.TrimSpace(prefix+tc.src) + "\n"
+		z, err := checkSourceWith(src, resolveUse, opts)
+		if err == nil {
+			err = z.runTests()
+		}
+		compareCheckErr(tt, i, err, tc.wantErr)
+	}
+}
+
+// compareCheckErr reports a test failure if the err from test case #i does not
+// match wantErr, in the sense of checkTestCase.wantErr.
+func compareCheckErr(tt *testing.T, i int, err error, wantErr string) {
+	tt.Helper()
+	if wantErr == "" {
+		if err != nil {
+			tt.Errorf("tc #%d: %v", i, err)
+		}
+	} else if err == nil {
+		tt.Errorf("tc #%d: got nil error, want %q", i, wantErr)
+	} else if !strings.Contains(err.Error(), wantErr) {
+		tt.Errorf("tc #%d: got %q, want %q", i, err, wantErr)
+	}
+}
+
 func TestCheck(tt *testing.T) {
 	const filename = "test.wuffs"
 	src := strings.TrimSpace(`
@@ -110,7 +209,7 @@ func TestCheck(tt *testing.T) {
 		tt.Fatalf("compareToWuffsfmt: %v", err)
 	}
 
-	c, err := Check(tm, []*a.File{file}, nil)
+	c, err := Check(tm, []*a.File{file}, nil, nil)
 	if err != nil {
 		tt.Fatalf("Check: %v", err)
 	}
@@ -224,7 +323,7 @@ func TestConstValues(tt *testing.T) {
 			continue
 		}
 
-		c, err := Check(tm, []*a.File{file}, nil)
+		c, err := Check(tm, []*a.File{file}, nil, nil)
 		if err != nil {
 			tt.Errorf("%q: Check: %v", s, err)
 			continue
@@ -270,56 +369,3933 @@ func TestConstValues(tt *testing.T) {
 	}
 }
 
-func TestBitMask(tt *testing.T) {
-	testCases := [][2]uint64{
-		{0, 0},
-		{1, 1},
-		{2, 3},
-		{3, 3},
-		{4, 7},
-		{5, 7},
-		{50, 63},
-		{500, 511},
-		{5000, 8191},
-		{50000, 65535},
-		{500000, 524287},
-		{1<<7 - 2, 1<<7 - 1},
-		{1<<7 - 1, 1<<7 - 1},
-		{1<<7 + 0, 1<<8 - 1},
-		{1<<7 + 1, 1<<8 - 1},
-		{1<<8 - 2, 1<<8 - 1},
-		{1<<8 - 1, 1<<8 - 1},
-		{1<<8 + 0, 1<<9 - 1},
-		{1<<8 + 1, 1<<9 - 1},
-		{1<<32 - 2, 1<<32 - 1},
-		{1<<32 - 1, 1<<32 - 1},
-		{1<<32 + 0, 1<<33 - 1},
-		{1<<32 + 1, 1<<33 - 1},
-		{1<<64 - 2, 1<<64 - 1},
-		{1<<64 - 1, 1<<64 - 1},
+func TestWarnings(tt *testing.T) {
+	src := strings.TrimSpace(`
+		pri func foo(n : base.u32[..= 100]) base.u32 {
+			var i : base.u32
+			var j : base.u32
+			var k : base.u32
+			var x : base.u32
+
+			i = 0
+			j = 7
+			j = args.n
+			while i < 10 {
+				x = i
+				i += 1
+			} endwhile
+			k = 3
+			if j > 5 {
+				k = 4
+			}
+			return k
+		}
+	`) + "\n"
+
+	z, err := checkSourceWith(src, nil, nil)
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+
+	got := []string(nil)
+	for _, w := range z.c.Warnings() {
+		got = append(got, w.String())
+	}
+	want := []string{
+		`check: redundant assignment to "i": the facts already imply "i == 0" at test.wuffs:7:4`,
+		`check: value assigned to "j" is never used at test.wuffs:8:4`,
+		`check: value assigned to "x" is never used at test.wuffs:11:5`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		tt.Fatalf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestStrictness(tt *testing.T) {
+	const body = `
+		pri func foo() base.u32 {
+			var j : base.u32
+			j = 7
+			j = 8
+			return j
+		}
+	`
+	testCases := []struct {
+		pragma      string
+		wantErr     string
+		wantWarning string
+	}{{
+		pragma:      "",
+		wantWarning: `check: value assigned to "j" is never used at test.wuffs:4:4`,
+	}, {
+		pragma: "pragma strictness legacy",
+	}, {
+		pragma:      "pragma strictness standard",
+		wantWarning: `check: value assigned to "j" is never used at test.wuffs:4:4`,
+	}, {
+		pragma:  "pragma strictness strict",
+		wantErr: `check: value assigned to "j" is never used at test.wuffs:4:4`,
+	}, {
+		pragma:  "pragma strictness lenient",
+		wantErr: `check: unknown strictness "lenient" at test.wuffs:1`,
+	}, {
+		pragma:  "pragma verbosity strict",
+		wantErr: `check: unknown pragma "verbosity" at test.wuffs:1`,
+	}, {
+		pragma:  "pragma strictness legacy\npragma strictness strict",
+		wantErr: `check: duplicate pragma strictness at test.wuffs:2`,
+	}}
+
+	for i, tc := range testCases {
+		src := tc.pragma + "\n" + strings.TrimSpace(body) + "\n"
+		z, err := checkSourceWith(src, nil, nil)
+		if tc.wantErr != "" {
+			if (err == nil) || (err.Error() != tc.wantErr) {
+				tt.Errorf("tc #%d: Check: got %v, want %q", i, err, tc.wantErr)
+			}
+			continue
+		} else if err != nil {
+			tt.Errorf("tc #%d: Check: %v", i, err)
+			continue
+		}
+
+		gotWarning := ""
+		for _, w := range z.c.Warnings() {
+			gotWarning = w.String()
+		}
+		if gotWarning != tc.wantWarning {
+			tt.Errorf("tc #%d: warning: got %q, want %q", i, gotWarning, tc.wantWarning)
+		}
+	}
+}
+
+func TestConcurrentCheckers(tt *testing.T) {
+	pkgs := []string{"adler32", "crc32", "deflate", "lzw"}
+	srcs := map[string][][]byte{}
+	for _, pkg := range pkgs {
+		filenames, err := filepath.Glob(filepath.Join("..", "..", "std", pkg, "*.wuffs"))
+		if err != nil {
+			tt.Fatalf("%s: Glob: %v", pkg, err)
+		} else if len(filenames) == 0 {
+			tt.Fatalf("%s: no .wuffs files", pkg)
+		}
+		for _, filename := range filenames {
+			src, err := ioutil.ReadFile(filename)
+			if err != nil {
+				tt.Fatalf("%s: ReadFile: %v", pkg, err)
+			}
+			srcs[pkg] = append(srcs[pkg], src)
+		}
+	}
+
+	// Every checker has its own token map and AST, but they share the
+	// package-level values such as typeExprU32 and zeroExpr. Running them
+	// concurrently (under "go test -race") checks that that is safe.
+	errs := make(chan error, 2*len(pkgs))
+	for i := 0; i < 2; i++ {
+		for _, pkg := range pkgs {
+			go func(pkg string) {
+				tm := &t.Map{}
+				files := []*a.File(nil)
+				for j, src := range srcs[pkg] {
+					filename := fmt.Sprintf("%s/%d.wuffs", pkg, j)
+					tokens, _, err := t.Tokenize(tm, filename, src)
+					if err != nil {
+						errs <- fmt.Errorf("%s: Tokenize: %v", pkg, err)
+						return
+					}
+					file, err := parse.Parse(tm, filename, tokens, nil)
+					if err != nil {
+						errs <- fmt.Errorf("%s: Parse: %v", pkg, err)
+						return
+					}
+					files = append(files, file)
+				}
+				if _, err := Check(tm, files, nil, nil); err != nil {
+					errs <- fmt.Errorf("%s: Check: %v", pkg, err)
+					return
+				}
+				errs <- nil
+			}(pkg)
+		}
+	}
+	for i := 0; i < 2*len(pkgs); i++ {
+		if err := <-errs; err != nil {
+			tt.Error(err)
+		}
+	}
+}
+
+func TestCheckCache(tt *testing.T) {
+	const bar = `
+		pri struct foo()
+		pri func foo.bar(x : base.u32) {
+			var a : array[256] base.u8
+			var j : base.u32
+			a[this.low(x: args.x)] = 0
+			j = 7
+			j = 8
+		}
+	`
+	const low = `
+		pri func foo.low(x : base.u32) base.u32 {
+			return args.x & 0xFF
+		}
+	`
+	const badLow = `
+		pri func foo.low(x : base.u32) base.u32 {
+			if args.x > 10 {
+				return 300
+			}
+			return 3
+		}
+	`
+
+	cacheDir, err := ioutil.TempDir("", "wuffs-check-cache-")
+	if err != nil {
+		tt.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	testCases := []struct {
+		src         string
+		wantErr     string
+		wantWarning string
+		wantHits    int
+	}{{
+		src:         bar + low,
+		wantWarning: `check: value assigned to "j" is never used at test.wuffs:8:4`,
+		wantHits:    0,
+	}, {
+		src:         bar + low,
+		wantWarning: `check: value assigned to "j" is never used at test.wuffs:8:4`,
+		wantHits:    2,
+	}, {
+		// Moving the functions keeps their cache entries, but not their
+		// warnings' line numbers.
+		src:         "\n\n" + bar + low,
+		wantWarning: `check: value assigned to "j" is never used at test.wuffs:10:4`,
+		wantHits:    2,
+	}, {
+		// Changing foo.low invalidates foo.bar, which uses its inferred
+		// result bounds, even though foo.bar's body is unchanged.
+		src:     bar + badLow,
+		wantErr: `cannot prove "this.low(x: args.x) < 256"`,
+	}}
+
+	for i, tc := range testCases {
+		z, err := checkSourceWith(tc.src, nil, &Options{CacheDir: cacheDir})
+		if tc.wantErr != "" {
+			if (err == nil) || !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("tc #%d: Check: got %v, want %q", i, err, tc.wantErr)
+			}
+			continue
+		} else if err != nil {
+			tt.Errorf("tc #%d: Check: %v", i, err)
+			continue
+		}
+
+		gotWarning := ""
+		for _, w := range z.c.Warnings() {
+			gotWarning = w.String()
+		}
+		if gotWarning != tc.wantWarning {
+			tt.Errorf("tc #%d: warning: got %q, want %q", i, gotWarning, tc.wantWarning)
+		}
+		if z.c.cache.hits != tc.wantHits {
+			tt.Errorf("tc #%d: hits: got %d, want %d", i, z.c.cache.hits, tc.wantHits)
+		}
+	}
+}
+
+func TestCheckRemoteCache(tt *testing.T) {
+	const src = `
+		pri struct foo()
+		pri func foo.bar(x : base.u32) {
+			var a : array[256] base.u8
+			a[args.x & 0xFF] = 0
+		}
+	`
+
+	mu := sync.Mutex{}
+	entries := map[string][]byte{}
+	numPuts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.HasPrefix(r.URL.Path, "/broken/") {
+			http.Error(w, "broken", http.StatusInternalServerError)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if data, ok := entries[r.URL.Path]; ok {
+				w.Write(data)
+			} else {
+				http.NotFound(w, r)
+			}
+		case http.MethodPut:
+			data, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			entries[r.URL.Path] = data
+			numPuts++
+		default:
+			http.Error(w, "bad method", http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		url      string
+		version  string
+		wantHits int
+		wantPuts int
+	}{
+		{url: server.URL, version: "v1", wantHits: 0, wantPuts: 1},
+		// A different machine, with an empty cache directory, shares the
+		// first one's entry.
+		{url: server.URL, version: "v1", wantHits: 1, wantPuts: 1},
+		// A different checker version does not.
+		{url: server.URL, version: "v2", wantHits: 0, wantPuts: 2},
+		// A failing remote cache is not an error.
+		{url: server.URL + "/broken", version: "v3", wantHits: 0, wantPuts: 2},
+	}
+
+	for i, tc := range testCases {
+		cacheDir, err := ioutil.TempDir("", "wuffs-check-cache-")
+		if err != nil {
+			tt.Fatalf("TempDir: %v", err)
+		}
+		defer os.RemoveAll(cacheDir)
+
+		z, err := checkSourceWith(src, nil, &Options{
+			CacheDir:     cacheDir,
+			CacheURL:     tc.url,
+			CacheVersion: tc.version,
+		})
+		if err != nil {
+			tt.Errorf("tc #%d: Check: %v", i, err)
+			continue
+		}
+		if z.c.cache.hits != tc.wantHits {
+			tt.Errorf("tc #%d: hits: got %d, want %d", i, z.c.cache.hits, tc.wantHits)
+		}
+		mu.Lock()
+		gotPuts := numPuts
+		mu.Unlock()
+		if gotPuts != tc.wantPuts {
+			tt.Errorf("tc #%d: puts: got %d, want %d", i, gotPuts, tc.wantPuts)
+		}
+	}
+}
+
+func TestSuggestions(tt *testing.T) {
+	const src = `pri struct foo(
+	n : base.u32,
+	m : base.u32,
+)
+
+pri func foo.bar!(x : base.u32) {
+	var i : base.u32
+	var j : base.u32
+	var k : base.u8[..= 100]
+	var l : base.u32
+	i = args.x & 0xFF
+	j = args.x
+	k = 3
+	if args.x > 0 {
+		l = args.x - 1
+	}
+	this.n = args.x & 0x0F
+	this.m = args.x
+}
+`
+
+	z, err := checkSourceWith(src, nil, &Options{Suggest: true})
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+
+	got := []string(nil)
+	for _, s := range z.c.Suggestions() {
+		got = append(got, s.String())
+	}
+	want := []string{
+		`check: "foo.n" could be refined from base.u32 to base.u32[..= 15] at test.wuffs:2`,
+		`check: "i" could be refined from base.u32 to base.u32[..= 255] at test.wuffs:7`,
+		`check: "k" could be refined from base.u8[..= 100] to base.u8[..= 3] at test.wuffs:9`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		tt.Fatalf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestSpecialize(tt *testing.T) {
+	const srcFmt = `pri struct foo(
+	a : array[16] base.u8,
+)
+
+pri func foo.run!(x : base.u32[..= 3]) {
+	this.bar!(n: const %s, x: args.x)
+}
+
+pri func foo.bar!(n : base.u32[..= 16], x : base.u32[..= 3]) {
+	this.a[args.x + args.n + 8] = 0
+}
+`
+
+	testCases := []struct {
+		n       string
+		wantErr string
+	}{
+		{"4", ""},
+		{"5", `cannot prove "(args.x + (5 as base.u32[..= 16]) + 8) < 16": failed at test.wuffs:10`},
+		{"17", `check: expression "17 as base.u32[..= 16]" bounds [17 ..= 17] is not within bounds [0 ..= 16] at test.wuffs:5`},
 	}
 
 	for _, tc := range testCases {
-		got := bitMask(big.NewInt(0).SetUint64(tc[0]).BitLen())
-		want := big.NewInt(0).SetUint64(tc[1])
-		if got.Cmp(want) != 0 {
-			tt.Errorf("roundUpToPowerOf2Minus1(%v): got %v, want %v", tc[0], got, tc[1])
+		src := fmt.Sprintf(srcFmt, tc.n)
+		z, err := checkSourceWith(src, nil, nil)
+		if tc.wantErr != "" {
+			if (err == nil) || !strings.HasPrefix(err.Error(), tc.wantErr) {
+				tt.Fatalf("%s: Check: got %v, want prefix %q", tc.n, err, tc.wantErr)
+			}
+			continue
+		} else if err != nil {
+			tt.Fatalf("%s: Check: %v", tc.n, err)
+		}
+
+		got := []string(nil)
+		for _, o := range z.file.TopLevelDecls() {
+			if o.Kind() == a.KFunc {
+				got = append(got, o.AsFunc().FuncName().Str(z.tm))
+			}
+		}
+		want := []string{"run", "bar__n_4"}
+		if !reflect.DeepEqual(got, want) {
+			tt.Fatalf("%s: funcs: got %q, want %q", tc.n, got, want)
 		}
 	}
 }
 
-func TestBuiltInTypeMap(tt *testing.T) {
-	if got, want := len(builtInTypeMap), len(builtin.Types); got != want {
-		tt.Fatalf("lengths: got %d, want %d", got, want)
+func TestTestBlocks(tt *testing.T) {
+	const src = `pri const K : base.u32 = 10
+
+test "arithmetic" {
+	var x : base.u32
+	var y : base.u8
+	x = K + 5
+	x *= 2
+	y = 250
+	y ~mod+= 10
+	assert x == 30
+	assert (y == 4) and ((x >> 1) == 15)
+	y ~sat-= 7
+	assert y == 0
+}
+
+test "wrong" {
+	var x : base.u32
+	x = 7
+	assert x < 5
+}
+
+test "overflow" {
+	var y : base.u8[..= 100]
+	y = 60
+	y += y
+}
+`
+
+	z, err := checkSourceWith(src, nil, nil)
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
 	}
-	tm := t.Map{}
-	for _, s := range builtin.Types {
-		id := tm.ByName(s)
-		if id == 0 {
-			tt.Fatalf("ID(%q): got 0, want non-0", s)
+
+	got := []string(nil)
+	for _, n := range z.c.Tests() {
+		s := n.Name().Str(z.tm) + ": "
+		if err := z.c.RunTest(n); err != nil {
+			s += err.Error()
+		} else {
+			s += "ok"
 		}
-		if _, ok := builtInTypeMap[id]; !ok {
-			tt.Fatalf("no builtInTypeMap entry for %q", s)
+		got = append(got, s)
+	}
+	want := []string{
+		`"arithmetic": ok`,
+		`"wrong": check: test "wrong" failed: assertion "x < 5" does not hold at test.wuffs:19`,
+		`"overflow": check: test "overflow" failed: y value 120 is not within bounds [0 ..= 100] at test.wuffs:25`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		tt.Fatalf("\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestContracts(tt *testing.T) {
+	const callee = `
+		pri struct foo()
+
+		pri func foo.double(x : base.u32) base.u32,
+			pre args.x < 100,
+			post result <= 200,
+		{
+			return args.x * 2
+		}
+	`
+	testCases := []checkTestCase{{
+		src: callee + `
+		pri func foo.bar() {
+			var y : base.u32
+			var z : base.u32[..= 1000]
+			y = this.double(x: 50)
+			z = y + 800
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: callee + `
+		pri func foo.bar() {
+			var y : base.u32
+			y = this.double(x: 100)
+		}
+		`,
+		wantErr: `check: cannot prove "100 < 100" (for the foo.double pre-condition "args.x < 100")`,
+	}, {
+		src: `
+		pri func triple(x : base.u32) base.u32,
+			pre args.x < 100,
+			post result <= 200,
+		{
+			return args.x * 3
+		}
+		`,
+		wantErr: `(for the post-condition "result <= 200")`,
+	}, {
+		src: `
+		pub func double(x : base.u32) base.u32,
+			pre args.x < 100,
+		{
+			return args.x * 2
+		}
+		`,
+		wantErr: "check: public function double cannot have pre-conditions",
+	}, {
+		// foo.f sets this.z to zero, so the post-condition is about the old
+		// this.z, not the new one.
+		src: `
+		pri struct foo(z : base.u32)
+
+		pri func foo.f!(x : base.u32) base.u32,
+			post result <= args.x,
+		{
+			var r : base.u32
+			r = args.x
+			this.z = 0
+			return r
+		}
+
+		pri func foo.bar!() {
+			var r : base.u32
+			var y : base.u32[..= 0]
+			this.z = 5
+			r = this.f!(x: this.z)
+			if this.z == 0 {
+				y = r
+			}
+		}
+		`,
+		wantErr: `check: expression "r" bounds [0 ..= 4294967295] is not within bounds [0 ..= 0]`,
+	}, {
+		// A local variable, passed by value, is unchanged by the call.
+		src: `
+		pri struct foo(z : base.u32)
+
+		pri func foo.f!(x : base.u32) base.u32,
+			post result <= args.x,
+		{
+			var r : base.u32
+			r = args.x
+			this.z = 0
+			return r
+		}
+
+		pri func foo.bar!() {
+			var r : base.u32
+			var x : base.u32
+			var y : base.u32[..= 0]
+			r = this.f!(x: x)
+			if x == 0 {
+				y = r
+			}
+		}
+		`,
+		wantErr: "",
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestIterateConditions(tt *testing.T) {
+	const prefix = `
+	pri func bar(x: slice base.u8) {
+		var p : slice base.u8
+		var n : base.u32[..= 1000]
+		var m : base.u32[..= 200]
+		n = 0
+	`
+	testCases := []checkTestCase{{
+		src: `
+			iterate (p = args.x)(length: 1, advance: 1, unroll: 1),
+				pre m == 0,
+				inv n <= 100,
+				post n <= 100,
+			{
+				if n < 100 {
+					n += 1
+				}
+			}
+			m = n + 100
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+			iterate (p = args.x)(length: 1, advance: 1, unroll: 1),
+				inv n <= 100,
+			{
+				n += 1
+			}
 		}
+		`,
+		wantErr: `check: cannot prove "n <= 100"`,
+	}, {
+		src: `
+			iterate (p = args.x)(length: 1, advance: 1, unroll: 1),
+				inv n <= 100,
+				post n == 5,
+			{
+				if n < 100 {
+					n += 1
+				}
+			}
+		}
+		`,
+		wantErr: `check: cannot prove "n == 5"`,
+	}, {
+		src: `
+			iterate (p = args.x)(length: 1, advance: 1, unroll: 1),
+				inv p.length() == 1,
+			{
+			}
+		}
+		`,
+		wantErr: `check: iterate condition "p.length() == 1" mentions the iterate variable "p"`,
+	}}
+
+	runCheckTestCases(tt, prefix, testCases)
+}
+
+func TestIOBind(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pri func bar(buf : slice base.u8) {
+			var r : base.io_reader
+			var x : base.u8
+			if r.length() >= 1 {
+				io_bind (io: r, data: args.buf) {
+					x = r.peek_u8()
+				}
+			}
+		}
+		`,
+		wantErr: "check: could not prove peek_u8 pre-condition: r.length() >= 1",
+	}, {
+		src: `
+		pri func bar(buf : slice base.u8) {
+			var r : base.io_reader
+			var x : base.u8
+			if r.length() >= 1 {
+				io_bind (io: r, data: args.buf) {
+				}
+				x = r.peek_u8()
+			}
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar?(buf : slice base.u8) {
+			var r : base.io_reader
+			var x : base.u8
+			io_bind (io: r, data: args.buf) {
+				if r.length() < 1 {
+					return ok
+				}
+			}
+			x = r.peek_u8()
+		}
+		`,
+		wantErr: "check: could not prove peek_u8 pre-condition: r.length() >= 1",
+	}, {
+		src: `
+		pri func bar(src : base.io_reader, n : base.u64) {
+			var x : base.u8
+			if args.src.length() >= 1 {
+				io_limit (io: args.src, limit: args.n) {
+				}
+				x = args.src.peek_u8()
+			}
+		}
+		`,
+		wantErr: "check: could not prove peek_u8 pre-condition: args.src.length() >= 1",
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestConstArrayIndex(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pri const TAB : array[4] base.u8 = [1, 2, 3, 9]
+		pri func bar(i : base.u32[..= 2]) {
+			var a : array[4] base.u8
+			a[TAB[args.i]] = 0
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri const TAB : array[4] base.u8 = [1, 2, 3, 9]
+		pri func bar(i : base.u32[..= 3]) {
+			var a : array[4] base.u8
+			a[TAB[args.i]] = 0
+		}
+		`,
+		wantErr: `cannot prove "TAB[args.i] < 4"`,
+	}, {
+		src: `
+		pri const TAB : array[2] array[3] base.u8 = [[7, 8, 9], [0, 1, 2]]
+		pri func bar(i : base.u32[..= 2]) {
+			var a : array[3] base.u8
+			a[TAB[1][args.i]] = 0
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri const TAB : array[2] array[3] base.u8 = [[7, 8, 9], [0, 1, 2]]
+		pri func bar(i : base.u32[..= 2]) {
+			var a : array[3] base.u8
+			a[TAB[0][args.i]] = 0
+		}
+		`,
+		wantErr: `cannot prove "TAB[0][args.i] < 3"`,
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestUsedConsts(tt *testing.T) {
+	const fooSrc = `
+		pub const MAX : base.u32 = 100
+		pub const TAB : array[4] base.u8 = [1, 2, 3, 9]
+	`
+	resolveUse := func(usePath string) ([]byte, error) {
+		if usePath != "std/foo.wuffs" {
+			return nil, fmt.Errorf("cannot resolve %q", usePath)
+		}
+		return []byte(strings.TrimSpace(fooSrc) + "\n"), nil
+	}
+
+	testCases := []checkTestCase{{
+		src: `
+		use "std/foo"
+		pri func bar(x : base.u32[..= foo.MAX]) {
+			var a : array[101] base.u8
+			a[args.x] = 0
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		use "std/foo"
+		pri func bar(x : base.u32[..= 2]) {
+			var a : array[4] base.u8
+			a[foo.TAB[args.x]] = 0
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		use "std/foo"
+		pri func bar(x : base.u32[..= 3]) {
+			var a : array[4] base.u8
+			a[foo.TAB[args.x]] = 0
+		}
+		`,
+		wantErr: `cannot prove "foo.TAB[args.x] < 4"`,
+	}}
+
+	runCheckTestCasesWith(tt, "", testCases, resolveUse, nil)
+}
+
+func TestUsedFeatures(tt *testing.T) {
+	const fooSrc = `
+		pub feature progressive
+	`
+	resolveUse := func(usePath string) ([]byte, error) {
+		if usePath != "std/foo.wuffs" {
+			return nil, fmt.Errorf("cannot resolve %q", usePath)
+		}
+		return []byte(strings.TrimSpace(fooSrc) + "\n"), nil
+	}
+
+	testCases := []checkTestCase{{
+		src: `
+		use "std/foo"
+		pri func bar() {
+			assert feature foo.progressive
+			assert not feature foo.exif
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		use "std/foo"
+		pri func bar() {
+			assert feature foo.exif
+		}
+		`,
+		wantErr: `cannot prove "feature foo.exif"`,
+	}, {
+		src: `
+		pub feature exif
+		pri func bar() {
+			assert feature exif
+			assert not feature progressive
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar() {
+			assert not feature qux.progressive
+		}
+		`,
+		wantErr: `"qux" is not a used package`,
+	}, {
+		src: `
+		pub feature exif
+		pub feature exif
+		`,
+		wantErr: `duplicate feature "exif"`,
+	}}
+
+	runCheckTestCasesWith(tt, "", testCases, resolveUse, nil)
+}
+
+func TestMulQRound(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pri func bar(x : base.u32[..= 1000], y : base.u32[..= 0x10000]) {
+			var a : array[1001] base.u8
+			a[args.x.mul_q16_round(a: args.y)] = 0
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.u32[..= 1000], y : base.u32[..= 0x10100]) {
+			var a : array[1001] base.u8
+			a[args.x.mul_q16_round(a: args.y)] = 0
+		}
+		`,
+		wantErr: `cannot prove "args.x.mul_q16_round(a: args.y) < 1001"`,
+	}, {
+		src: `
+		pri func bar(x : base.u16[..= 0x7F], y : base.u16[..= 0x100]) {
+			var a : array[128] base.u8
+			a[args.x.mul_q8_round(a: args.y)] = 0
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.u16, y : base.u16) {
+			var z : base.u16
+			z = args.x.mul_q8_round(a: args.y)
+		}
+		`,
+		wantErr: `check: "args.x.mul_q8_round(a: args.y)" bounds [0 ..= 16776704] is not within bounds [0 ..= 65535]`,
+	}, {
+		src: `
+		pri func bar(x : base.u8, y : base.u8) {
+			var z : base.u8[..= 254]
+			z = args.x.mul_q8_round(a: args.y)
+		}
+		`,
+		wantErr: "",
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestFloorLog2AndCeilDivPow2(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pri func bar(x : base.u32[1 ..= 1023]) {
+			var a : array[10] base.u8
+			a[args.x.floor_log2()] = 0
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.u32[1 ..= 1024]) {
+			var a : array[10] base.u8
+			a[args.x.floor_log2()] = 0
+		}
+		`,
+		wantErr: `cannot prove "args.x.floor_log2() < 10"`,
+	}, {
+		src: `
+		pri func bar(x : base.u64) {
+			var z : base.u32
+			z = args.x.floor_log2()
+		}
+		`,
+		wantErr: `check: floor_log2 receiver "args.x" is possibly zero`,
+	}, {
+		src: `
+		pri func bar(x : base.u64) {
+			var z : base.u32[..= 63]
+			if args.x > 0 {
+				z = args.x.floor_log2()
+			}
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.u32[8 ..= 0x0FFF], n : base.u32[2 ..= 3]) {
+			var a : array[1024] base.u8
+			a[args.x.ceil_div_pow2(n: args.n) - 1] = 0
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.u32[..= 0x1001]) {
+			var a : array[1024] base.u8
+			a[args.x.ceil_div_pow2(n: 2)] = 0
+		}
+		`,
+		wantErr: `cannot prove "args.x.ceil_div_pow2(n: 2) < 1024"`,
+	}, {
+		src: `
+		pri func bar(x : base.u8) {
+			var z : base.u8
+			z = args.x.ceil_div_pow2(n: 8)
+		}
+		`,
+		wantErr: `check: expression "8" bounds [8 ..= 8] is not within bounds [0 ..= 7]`,
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestInferResultBounds(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pri struct foo()
+		pri func foo.low(x : base.u32) base.u32 {
+			return args.x & 0xFF
+		}
+		pri func foo.bar(x : base.u32) {
+			var a : array[256] base.u8
+			a[this.low(x: args.x)] = 0
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri struct foo()
+		pri func foo.bar(x : base.u32) {
+			var a : array[256] base.u8
+			a[this.low(x: args.x)] = 0
+		}
+		pri func foo.low(x : base.u32) base.u32 {
+			return args.x & 0xFF
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri struct foo()
+		pri func foo.bar(x : base.u32) {
+			var a : array[256] base.u8
+			a[this.low(x: args.x)] = 0
+		}
+		pri func foo.low(x : base.u32) base.u32 {
+			if args.x > 10 {
+				return 300
+			}
+			return 3
+		}
+		`,
+		wantErr: `cannot prove "this.low(x: args.x) < 256"`,
+	}, {
+		src: `
+		pub struct foo?()
+		pri func foo.bar(x : base.u32) {
+			var a : array[256] base.u8
+			a[this.low(x: args.x)] = 0
+		}
+		pub func foo.low(x : base.u32) base.u32 {
+			return args.x & 0xFF
+		}
+		`,
+		wantErr: `cannot prove "this.low(x: args.x) < 256"`,
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestBitTricks(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pri func bar(x : base.u32[1 ..= 0xFFFF]) {
+			assert (args.x & (args.x - 1)) <= args.x
+			assert (args.x & (args.x - 1)) < args.x
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(i : base.u32, n : base.u32[1 ..= 0xFFFF_FFFF]) {
+			assert (args.i & (args.n - 1)) < args.n
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.u32[..= 0xFFFF]) {
+			var y : base.u32
+			assert (args.x & 0xFFF8) <= args.x
+			y = (args.x + 7) & 0x1FFF8
+			assert y >= args.x
+			assert (y & 7) == 0
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.u32[..= 0xFFFF]) {
+			var y : base.u32
+			y = (args.x + 7) & 0xFFF8
+			assert y >= args.x
+		}
+		`,
+		wantErr: `cannot prove "y >= args.x"`,
+	}, {
+		src: `
+		pri func bar(x : base.u32[..= 0xFFFF]) {
+			var y : base.u32
+			y = (args.x + 7) & 0x1FFF8
+			assert (y & 15) == 0
+		}
+		`,
+		wantErr: `cannot prove "(y & 15) == 0"`,
+	}, {
+		src: `
+		pri func bar(x : base.u32, y : base.u32) {
+			assert (args.x & args.y) < args.x
+		}
+		`,
+		wantErr: `cannot prove "(args.x & args.y) < args.x"`,
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestNonlinear(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pri func bar(x : base.u32, c : base.u32[1 ..= 64]) {
+			assert ((args.x / 4) * 4) <= args.x
+			assert (4 * (args.x / 4)) <= args.x
+			assert args.x >= ((args.x / args.c) * args.c)
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.u32, n : base.u32) {
+			if args.x < args.n {
+				assert ((args.x / 8) * 8) < args.n
+			}
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.u32[..= 0xFFFF], y : base.u32[..= 0xFFFF], z : base.u32[..= 0xFFFF]) {
+			if args.y <= args.z {
+				assert (args.x * args.y) <= (args.x * args.z)
+				assert (args.y * args.x) <= (args.z * args.x)
+			}
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.u32[1 ..= 0xFFFF], y : base.u32[..= 0xFFFF], z : base.u32[..= 0xFFFF]) {
+			if args.y < args.z {
+				assert (args.y * args.x) < (args.x * args.z)
+			}
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.u32[..= 0xFFFF], y : base.u32[..= 0xFFFF], z : base.u32[..= 0xFFFF]) {
+			if args.y < args.z {
+				assert (args.x * args.y) < (args.x * args.z)
+			}
+		}
+		`,
+		wantErr: `cannot prove "(args.x * args.y) < (args.x * args.z)"`,
+	}, {
+		src: `
+		pri func bar(x : base.u32[..= 0xFFFF], y : base.u32[..= 0xFFFF], z : base.u32[..= 0xFFFF]) {
+			assert (args.x * args.y) <= (args.x * args.z)
+		}
+		`,
+		wantErr: `cannot prove "(args.x * args.y) <= (args.x * args.z)"`,
+	}, {
+		src: `
+		pri func bar(x : base.u32[..= 0xFFFF]) {
+			assert ((args.x / 4) * 8) <= args.x
+		}
+		`,
+		wantErr: `cannot prove "((args.x / 4) * 8) <= args.x"`,
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestMonotone(tt *testing.T) {
+	const prelude = `
+		pri struct foo(
+			a : array[101] base.u8,
+		)
+
+		pri func foo.clamp(x : base.u32) base.u32[..= 100],
+			post "monotone in x",
+		{
+			if args.x > 100 {
+				return 100
+			}
+			return args.x
+		}
+	`
+	testCases := []checkTestCase{{
+		src: `
+		pri func foo.bar!(i : base.u32, j : base.u32) {
+			var n : base.u32
+			if args.i <= args.j {
+				n = this.clamp(x: args.j) - this.clamp(x: args.i)
+				this.a[n] = 0
+			}
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func foo.half(x : base.u32, s : base.u32[..= 31]) base.u32,
+			post "monotone in x",
+		{
+			assert args.s <= 31
+			return (this.clamp(x: args.x) >> args.s) + 1
+		}
+
+		pri func foo.bar!(i : base.u32, j : base.u32) {
+			if args.i >= args.j {
+				assert this.half(x: args.i, s: 3) >= this.half(x: args.j, s: 3)
+			}
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func foo.bar!(i : base.u32, j : base.u32) {
+			assert this.clamp(x: args.i) <= this.clamp(x: args.j)
+		}
+		`,
+		wantErr: `cannot prove "this.clamp(x: args.i) <= this.clamp(x: args.j)"`,
+	}, {
+		src: `
+		pri func foo.flip(x : base.u32[..= 100]) base.u32,
+			post "monotone in x",
+		{
+			if args.x > 50 {
+				return 100 - args.x
+			}
+			return args.x
+		}
+		`,
+		wantErr: `cannot verify that foo.flip is monotone in x`,
+	}, {
+		src: `
+		pri func foo.flip(x : base.u32[..= 100]) base.u32,
+			post "monotone in x",
+		{
+			var y : base.u32
+			y = args.x
+			return y
+		}
+		`,
+		wantErr: `its body is not only if-else and return statements`,
+	}, {
+		src: `
+		pri func foo.flip(x : base.u32) base.u32,
+			post "monotone in y",
+		{
+			return args.x
+		}
+		`,
+		wantErr: `cannot be monotone in y: no such in-param`,
+	}, {
+		src: `
+		pri func foo.flip(x : base.u32) base.u32,
+			pre "monotone in x",
+		{
+			return args.x
+		}
+		`,
+		wantErr: `is not a post condition`,
+	}}
+
+	runCheckTestCases(tt, prelude, testCases)
+}
+
+func TestRefinedFields(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pub struct foo?(
+			w : base.u32[..= 0xFFFF],
+			a : array[4] base.u8[..= 3],
+		)
+
+		pub func foo.bar!(x : base.u32[..= 0xFFFF]) {
+			var y : base.u32[..= 0xFFFF]
+			var z : base.u8[..= 3]
+			y = this.w
+			this.w = args.x
+			z = this.a[1]
+			this.a[2] = z
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pub struct foo?(
+			w : base.u32[..= 0xFFFF],
+		)
+
+		pub func foo.bar!(x : base.u32) {
+			this.w = args.x
+		}
+		`,
+		wantErr: `expression "args.x" bounds [0 ..= 4294967295] is not within bounds [0 ..= 65535]`,
+	}, {
+		src: `
+		pub struct foo?(
+			w : base.u32[..= 0xFFFF],
+		)
+
+		pub func foo.bar!() {
+			this.w += 1
+		}
+		`,
+		wantErr: `assignment "this.w += 1" bounds [1 ..= 65536] is not within bounds [0 ..= 65535]`,
+	}, {
+		src: `
+		pub struct foo?(
+			a : array[4] base.u8[..= 3],
+		)
+
+		pub func foo.bar!() {
+			this.a[0] = 4
+		}
+		`,
+		wantErr: `expression "4" bounds [4 ..= 4] is not within bounds [0 ..= 3]`,
+	}, {
+		src: `
+		pub struct foo?(
+			a : array[4] base.u8[..= 3],
+		)
+
+		pub func foo.bar!(s : slice base.u8) {
+			this.a[..].copy_from_slice!(s: args.s)
+		}
+		`,
+		wantErr: `this.a[..] is a slice expression but this.a has refined element type base.u8[..= 3]`,
+	}, {
+		src: `
+		pub struct foo?(
+			w : base.u32[1 ..= 0xFFFF],
+		)
+		`,
+		wantErr: `default zero value is not within bounds [1 ..= 65535] for field "w"`,
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestStatusClasses(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pub status "#bad header" as corrupt
+		pub status "#unsupported file" as unsupported
+		pri status "#too big" as resource_limit
+		pub status "#bad argument"
+		pub status "@note"
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pub status "#bad header" as broken
+		`,
+		wantErr: `unrecognized status class "broken"`,
+	}, {
+		src: `
+		pub status "$short read" as corrupt
+		`,
+		wantErr: `status "$short read" is not an error but has a class`,
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestModShifts(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pri func bar(x : base.u32, n : base.u32) {
+			var y : base.u32
+			y = args.x ~mod<< args.n
+			y = args.x ~mod>> args.n
+			y ~mod<<= args.n
+			y ~mod>>= 99
+			assert (args.x ~mod>> 32) == 0
+			assert (args.x ~mod<< 40) == 0
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.u32[..= 0xFF], n : base.u64) {
+			var y : base.u32[..= 0xFF]
+			y = args.x ~mod>> args.n
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.u8[0x80 ..= 0xFF]) {
+			assert (args.x ~mod<< 1) >= 0x80
+		}
+		`,
+		wantErr: `cannot prove "(args.x ~mod<< 1) >= 0x80"`,
+	}, {
+		src: `
+		pri func bar(x : base.u32, n : base.u32) {
+			var y : base.u32
+			y = args.x >> args.n
+		}
+		`,
+		wantErr: `shift op argument "args.n" is outside the range [0 ..= 31]`,
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestSetMetadata(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pri struct foo(
+			end : base.u64,
+		)
+		pri func foo.bar!(minfo : nptr base.more_information, src : base.io_reader, n : base.u64) {
+			this.end = args.src.position() ~sat+ args.n
+			if args.minfo <> nullptr {
+				args.minfo.set_metadata!(fourcc: 0x49434350, min_incl: args.src.position(), max_excl: this.end)
+			}
+			if args.minfo <> nullptr {
+				args.minfo.set_metadata!(fourcc: 0x49434350, min_incl: this.end, max_excl: this.end)
+			}
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar!(minfo : nptr base.more_information, x : base.u64, y : base.u64) {
+			if (args.minfo <> nullptr) and (args.x <= args.y) {
+				args.minfo.set_metadata!(fourcc: 0x584D5020, min_incl: args.x, max_excl: args.y)
+			}
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar!(minfo : nptr base.more_information, x : base.u64, y : base.u64) {
+			if args.minfo <> nullptr {
+				args.minfo.set_metadata!(fourcc: 0x584D5020, min_incl: args.x, max_excl: args.y)
+			}
+		}
+		`,
+		wantErr: "could not prove set_metadata pre-condition: args.x <= args.y",
+	}, {
+		src: `
+		pri func bar!(minfo : nptr base.more_information, src : base.io_reader, n : base.u64) {
+			var end : base.u64
+			end = args.src.position() ~sat- args.n
+			if args.minfo <> nullptr {
+				args.minfo.set_metadata!(fourcc: 0x584D5020, min_incl: args.src.position(), max_excl: end)
+			}
+		}
+		`,
+		wantErr: "could not prove set_metadata pre-condition",
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestSignedArithmetic(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pri func bar(x : base.i32, y : base.i32, n : base.u32) base.i32 {
+			var z : base.i32
+			z = (args.x & args.y) | (args.x ^ 7)
+			z = args.x >> 3
+			z = args.x ~mod+ args.y
+			z ~mod-= args.y
+			z ~mod*= -3
+			z ~sat+= args.x
+			z ~sat-= 0x7FFF_FFFF
+			z = args.x ~mod<< args.n
+			z ~mod>>= args.n
+			return z.min(a: 5).max(a: -5)
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.i16[-1000 ..= 1000], y : base.i16[1 ..= 10]) {
+			var z : base.i16[-1000 ..= 1000]
+			z = args.x / args.y
+			z = args.x % args.y
+			z = (args.x << 4) >> 4
+			z = (args.x & -16) >> 4
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.i8) {
+			assert (args.x ~mod>> 99) < 0
+		}
+		`,
+		wantErr: `cannot prove "(args.x ~mod>> 99) < 0"`,
+	}, {
+		src: `
+		pri func bar(x : base.i8[-100 ..= -1]) {
+			assert (args.x ~mod>> 99) < 0
+			assert (args.x ~sat- 100) <= -101
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.i32) base.i32 {
+			return args.x << 31
+		}
+		`,
+		wantErr: `is not within bounds`,
+	}, {
+		src: `
+		pri func bar(x : base.u32, y : base.i32) base.u32 {
+			return args.x & (args.y as base.u32)
+		}
+		`,
+		wantErr: `is not within bounds`,
+	}, {
+		src: `
+		pri func bar(x : base.i32[-8 ..= -8]) {
+			assert (args.x & 7) <= args.x
+		}
+		`,
+		wantErr: `cannot prove "(args.x & 7) <= args.x"`,
+	}, {
+		src: `
+		pri func bar(x : base.i32[-1 ..= 0]) base.u8 {
+			var a : array[4] base.u8
+			var i : base.i32
+			i = args.x & 255
+			return a[i]
+		}
+		`,
+		wantErr: `cannot prove "i < 4"`,
+	}, {
+		src: `
+		test "signed" {
+			var x : base.i8
+			x = 120
+			x ~mod+= 10
+			assert x == -126
+			x ~mod>>= 99
+			assert x == -1
+			x ~sat-= 200
+			assert x == -128
+			x = x ~mod* -1
+			assert x == -128
+			x = -7
+			assert ((x / 2) == -3) and ((x % 2) == -1) and ((x >> 1) == -4)
+		}
+		`,
+		wantErr: "",
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestProbe(tt *testing.T) {
+	const prelude = `
+	pub struct foo?(
+		width : base.u32,
+		util  : base.utility,
+	)
+	pub func foo.workbuf_len() base.range_ii_u64 {
+		return this.util.make_range_ii_u64(min_incl: 0, max_incl: 0)
+	}
+	pri func foo.fill!(workbuf: slice base.u8) {
+	}
+	pri func foo.read_width?(src: base.io_reader) {
+		this.width = args.src.read_u32le?()
+	}
+	`
+	testCases := []checkTestCase{{
+		src: `
+		pub func foo.decode_config?(src: base.io_reader),
+			probe,
+		{
+			this.read_width?(src: args.src)
+		}
+		pub func foo.decode_data?(src: base.io_reader, workbuf: slice base.u8) {
+			this.read_width?(src: args.src)
+			this.fill!(workbuf: args.workbuf)
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pub func foo.decode_config?(src: base.io_reader, workbuf: slice base.u8),
+			probe,
+		{
+		}
+		`,
+		wantErr: `probe function "foo.decode_config" cannot have a workbuf argument`,
+	}, {
+		src: `
+		pub func foo.decode_config?(src: base.io_reader),
+			probe,
+		{
+			this.helper?(src: args.src)
+		}
+		pri func foo.helper?(src: base.io_reader) {
+			this.read_width?(src: args.src)
+			this.fill!(workbuf: this.util.empty_slice_u8())
+		}
+		`,
+		wantErr: `probe function "foo.decode_config" cannot (via "foo.helper") call "foo.fill"`,
+	}, {
+		src: `
+		pub func foo.decode_config?(src: base.io_reader),
+			probe,
+		{
+		}
+		pub func foo.decode_header?(src: base.io_reader),
+			probe,
+		{
+		}
+		`,
+		wantErr: `"foo" has more than one probe function`,
+	}, {
+		src: `
+		pri func foo.decode_config?(src: base.io_reader),
+			probe,
+		{
+		}
+		`,
+		wantErr: `probe function must be pub`,
+	}, {
+		src: `
+		pub func foo.decode_config!(src: base.io_reader),
+			probe,
+		{
+		}
+		`,
+		wantErr: `probe function must be a coroutine`,
+	}, {
+		src: `
+		pub struct bar?()
+		pub func bar.decode_config?(src: base.io_reader),
+			probe,
+		{
+		}
+		`,
+		wantErr: `probe function "bar.decode_config"'s receiver has no "pub func bar.workbuf_len() base.range_ii_u64" method`,
+	}}
+
+	runCheckTestCases(tt, prelude, testCases)
+}
+
+func TestWorkbufLess(tt *testing.T) {
+	const prelude = `
+	pub struct foo?(
+		width : base.u32,
+		util  : base.utility,
+	)
+	pub func foo.workbuf_len() base.range_ii_u64 {
+		return this.util.make_range_ii_u64(min_incl: 0, max_incl: 4096)
+	}
+	pri func foo.fill!(workbuf: slice base.u8) {
+	}
+	pub func foo.decode_data?(src: base.io_reader, workbuf: slice base.u8) {
+		this.width = args.src.read_u32le?()
+		this.fill!(workbuf: args.workbuf)
+	}
+	`
+	testCases := []checkTestCase{{
+		src: `
+		pub func foo.decode_data_workbuf_less?(src: base.io_reader),
+			workbuf_less,
+		{
+			this.width = args.src.read_u32le?()
+			this.fill!(workbuf: this.util.empty_slice_u8())
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pub func foo.decode_data_workbuf_less?(src: base.io_reader),
+			workbuf_less,
+		{
+			this.helper?(src: args.src)
+		}
+		pri func foo.helper?(src: base.io_reader) {
+			this.decode_data?(src: args.src, workbuf: this.util.empty_slice_u8())
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pub func foo.decode_data_workbuf_less?(src: base.io_reader),
+			workbuf_less,
+		{
+			var w : slice base.u8
+			this.helper!(w: w)
+		}
+		pri func foo.helper!(w: slice base.u8) {
+			this.fill!(workbuf: args.w)
+		}
+		`,
+		wantErr: `workbuf_less function "foo.decode_data_workbuf_less" cannot (via "foo.helper") call "foo.fill" with a non-empty workbuf`,
+	}, {
+		src: `
+		pub func foo.decode_data_workbuf_less?(src: base.io_reader, workbuf: slice base.u8),
+			workbuf_less,
+		{
+		}
+		`,
+		wantErr: `workbuf_less function "foo.decode_data_workbuf_less"'s signature does not match "foo.decode_data"'s`,
+	}, {
+		src: `
+		pub func foo.decode_data_workbuf_less!(src: base.io_reader),
+			workbuf_less,
+		{
+		}
+		`,
+		wantErr: `workbuf_less function "foo.decode_data_workbuf_less"'s signature does not match "foo.decode_data"'s`,
+	}, {
+		src: `
+		pub func foo.decode_more_workbuf_less?(src: base.io_reader),
+			workbuf_less,
+		{
+		}
+		`,
+		wantErr: `workbuf_less function "foo.decode_more_workbuf_less" has no public counterpart "foo.decode_more" with a workbuf argument`,
+	}, {
+		src: `
+		pub func foo.decode_small?(src: base.io_reader),
+			workbuf_less,
+		{
+		}
+		`,
+		wantErr: `workbuf_less function "foo.decode_small"'s name does not end with "_workbuf_less"`,
+	}, {
+		src: `
+		pub func foo.decode_data_workbuf_less?(src: base.io_reader),
+			workbuf_less,
+		{
+		}
+		pub func foo.decode_more?(workbuf: slice base.u8) {
+		}
+		`,
+		wantErr: `"foo" has a workbuf_less function but "foo.decode_more" has no workbuf_less variant`,
+	}, {
+		src: `
+		pri func foo.decode_data_workbuf_less?(src: base.io_reader),
+			workbuf_less,
+		{
+		}
+		`,
+		wantErr: `workbuf_less function must be pub`,
+	}, {
+		src: `
+		pub struct bar?()
+		pub func bar.decode_data?(src: base.io_reader, workbuf: slice base.u8) {
+		}
+		pub func bar.decode_data_workbuf_less?(src: base.io_reader),
+			workbuf_less,
+		{
+		}
+		`,
+		wantErr: `workbuf_less function "bar.decode_data_workbuf_less"'s receiver has no "pub func bar.workbuf_len() base.range_ii_u64" method`,
+	}}
+
+	runCheckTestCases(tt, prelude, testCases)
+}
+
+func TestRecursive(tt *testing.T) {
+	const prelude = `
+	pri status "#too much nesting"
+	pub struct foo?(
+		n : base.u32,
+	)
+	`
+	testCases := []checkTestCase{{
+		src: `
+		pri func foo.walk?(src: base.io_reader, depth: base.u32[..= 3]),
+			recursive,
+		{
+			var x : base.u8
+			x = args.src.read_u8?()
+			if x == 0 {
+				return ok
+			} else if args.depth >= 3 {
+				return "#too much nesting"
+			}
+			this.walk?(src: args.src, depth: args.depth + 1)
+			this.n ~mod+= (x as base.u32)
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func foo.walk?(src: base.io_reader, depth: base.u32[..= 3]),
+			recursive,
+		{
+			var x : base.u8
+			x = args.src.read_u8?()
+			if x <> 0 {
+				this.walk?(src: args.src, depth: args.depth + 1)
+			}
+		}
+		`,
+		wantErr: `is not within bounds [0 ..= 3]`,
+	}, {
+		src: `
+		pri func foo.walk?(src: base.io_reader, depth: base.u32[..= 3]),
+			recursive,
+		{
+			var x : base.u8
+			x = args.src.read_u8?()
+			if x <> 0 {
+				this.walk?(src: args.src, depth: args.depth)
+			}
+		}
+		`,
+		wantErr: `recursive call to "foo.walk" does not increase the depth`,
+	}, {
+		src: `
+		pri func foo.walk?(src: base.io_reader) {
+			var x : base.u8
+			x = args.src.read_u8?()
+			if x <> 0 {
+				this.walk?(src: args.src)
+			}
+		}
+		`,
+		wantErr: `coroutine "foo.walk" calls itself but is not recursive`,
+	}, {
+		src: `
+		pri func foo.walk?(src: base.io_reader) {
+			var x : base.u8
+			x = args.src.read_u8?()
+			if x <> 0 {
+				this.hop?(src: args.src)
+			}
+		}
+		pri func foo.hop?(src: base.io_reader) {
+			this.walk?(src: args.src)
+		}
+		`,
+		wantErr: `coroutine "foo.walk" cannot call itself via "foo.hop"`,
+	}, {
+		src: `
+		pri func foo.walk?(src: base.io_reader, depth: base.u32),
+			recursive,
+		{
+		}
+		`,
+		wantErr: `recursive function "foo.walk" does not have a "depth: base.u32[..= N]"`,
+	}, {
+		src: `
+		pub func foo.walk?(src: base.io_reader, depth: base.u32[..= 3]),
+			recursive,
+		{
+		}
+		`,
+		wantErr: `recursive function cannot be pub`,
+	}}
+
+	runCheckTestCases(tt, prelude, testCases)
+}
+
+func TestSeekable(tt *testing.T) {
+	const prelude = `
+	pub struct foo?(
+		index       : base.u64,
+		io_position : base.u64,
+	)
+	pub func foo.decode_frame_config?(dst: nptr base.frame_config, src: base.io_reader) {
+	}
+	`
+	testCases := []checkTestCase{{
+		src: `
+		pub func foo.restart_frame!(index: base.u64, io_position: base.u64) base.status,
+			seekable,
+		{
+			this.index = args.index
+			if args.io_position > 0 {
+				this.io_position = args.io_position
+			}
+			return ok
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pub func foo.restart_frame!(index: base.u64, io_position: base.u64) base.status,
+			seekable,
+		{
+			if args.index <> 0 {
+				return base."#bad argument"
+			}
+			this.io_position = args.io_position
+			return ok
+		}
+		`,
+		wantErr: `seekable function "foo.restart_frame" does not store args.index in a field of "this"`,
+	}, {
+		src: `
+		pub func foo.restart_frame!(index: base.u64) base.status,
+			seekable,
+		{
+			this.index = args.index
+			return ok
+		}
+		`,
+		wantErr: `seekable function "foo.restart_frame" does not have the signature`,
+	}, {
+		src: `
+		pub func foo.restart_frame!(index: base.u64, io_position: base.u64) base.status,
+			seekable,
+		{
+			this.index = args.index
+			this.io_position = args.io_position
+			return ok
+		}
+		pub func foo.restart_too!(index: base.u64, io_position: base.u64) base.status,
+			seekable,
+		{
+			this.index = args.index
+			this.io_position = args.io_position
+			return ok
+		}
+		`,
+		wantErr: `"foo" has more than one seekable function`,
+	}, {
+		src: `
+		pri func foo.restart_frame!(index: base.u64, io_position: base.u64) base.status,
+			seekable,
+		{
+			return ok
+		}
+		`,
+		wantErr: `seekable function must be pub`,
+	}, {
+		src: `
+		pub func foo.restart_frame?(index: base.u64, io_position: base.u64),
+			seekable,
+		{
+		}
+		`,
+		wantErr: `seekable function cannot be a coroutine`,
+	}, {
+		src: `
+		pub struct bar?(
+			index : base.u64,
+		)
+		pub func bar.restart_frame!(index: base.u64, io_position: base.u64) base.status,
+			seekable,
+		{
+			this.index = args.index ~mod+ args.io_position
+			return ok
+		}
+		`,
+		wantErr: `seekable function "bar.restart_frame"'s receiver has no ` +
+			`"pub func bar.decode_frame_config?(dst: nptr base.frame_config, src: base.io_reader)" method`,
+	}}
+
+	runCheckTestCases(tt, prelude, testCases)
+}
+
+func TestPubFields(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pub struct foo?(
+			pub width  : base.u32[..= 0xFF_FFFF],
+			pub opaque : base.bool,
+			pub delta  : base.i16,
+			other      : base.u8,
+		)
+		pub func foo.set_width!(w: base.u32) base.status {
+			if args.w > 0xFF_FFFF {
+				return base."#bad argument"
+			}
+			this.width = args.w
+			return ok
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pub struct foo?(
+			pub width : base.u32[..= 0xFF_FFFF],
+		)
+		pub func foo.set_width!(w: base.u32) {
+			this.width = args.w
+		}
+		`,
+		wantErr: `check: expression "args.w" bounds [0 ..= 4294967295] is not within bounds [0 ..= 16777215]`,
+	}, {
+		src: `
+		pri struct foo?(
+			pub width : base.u32,
+		)
+		`,
+		wantErr: `check: pub field "width" in non-pub struct "foo"`,
+	}, {
+		src: `
+		pub struct foo?(
+			pub widths : array[4] base.u32,
+		)
+		`,
+		wantErr: `check: pub field "widths" has type "array[4] base.u32", not a numeric or bool type`,
+	}, {
+		src: `
+		pub struct foo?(
+			pub width : base.u32,
+		)
+		pub func foo.get_width() base.u32 {
+			return this.width
+		}
+		`,
+		wantErr: `check: struct "foo" has both a pub field "width" and a method named "get_width"`,
+	}, {
+		src: `
+		pub func f(pub x: base.u32) {
+		}
+		`,
+		wantErr: `parse: expected identifier`,
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestTokensNeeded(tt *testing.T) {
+	const prelude = `
+	pub struct foo?(
+		dummy : base.u8,
+	)
+	`
+	testCases := []struct {
+		src     string
+		want    string
+		wantErr string
+	}{{
+		src: `
+		pub func foo.decode_tokens?(dst: base.token_writer, src: base.io_reader) {
+			while true {
+				if args.dst.length() <= 1 {
+					yield? base."$short write"
+					continue
+				}
+				args.dst.write_simple_token_fast!(
+					value_major: 0, value_minor: 0, continued: 0, length: 0)
+				args.dst.write_simple_token_fast!(
+					value_major: 0, value_minor: 0, continued: 0, length: 0)
+			} endwhile
+		}
+		`,
+		want: "2",
+	}, {
+		src: `
+		pub func foo.decode_tokens?(dst: base.token_writer, src: base.io_reader) {
+			while args.dst.length() < 3,
+				post args.dst.length() >= 3,
+			{
+				yield? base."$short write"
+			} endwhile
+		}
+		`,
+		want: "3",
+	}, {
+		src: `
+		pub func foo.decode_tokens?(dst: base.token_writer, src: base.io_reader) {
+			if args.src.length() <= 0 {
+				yield? base."$short read"
+			}
+		}
+		`,
+		want: "",
+	}, {
+		src: `
+		pub func foo.decode_tokens?(dst: base.token_writer, src: base.io_reader) {
+			yield? base."$short write"
+		}
+		`,
+		wantErr: `cannot tell how many tokens this "$short write" needs: ` +
+			`guard it with a condition such as "args.dst.length() <= N"`,
+	}, {
+		src: `
+		pub func foo.transform?(dst: base.io_writer, tokens: base.token_writer, src: base.io_reader) {
+			yield? base."$short write"
+		}
+		`,
+		want: "",
+	}}
+
+	for i, tc := range testCases {
+		src := strings.TrimSpace(prelude+tc.src) + "\n"
+		z, err := checkSourceWith(src, nil, nil)
+		if tc.wantErr != "" {
+			if err == nil {
+				tt.Errorf("tc #%d: Check: got nil error, want %q", i, tc.wantErr)
+			} else if !strings.Contains(err.Error(), tc.wantErr) {
+				tt.Errorf("tc #%d: Check: got %q, want %q", i, err, tc.wantErr)
+			}
+			continue
+		} else if err != nil {
+			tt.Errorf("tc #%d: Check: %v", i, err)
+			continue
+		}
+
+		got := ""
+		for _, tld := range z.file.TopLevelDecls() {
+			if tld.Kind() != a.KFunc {
+				continue
+			}
+			for _, o := range tld.AsFunc().Body() {
+				o.Walk(func(o *a.Node) error {
+					if o.Kind() == a.KRet {
+						if tn := o.AsRet().TokensNeeded(); tn != nil {
+							got = tn.String()
+						}
+					}
+					return nil
+				})
+			}
+		}
+		if got != tc.want {
+			tt.Errorf("tc #%d: TokensNeeded: got %q, want %q", i, got, tc.want)
+		}
+	}
+}
+
+func TestScalableVectors(tt *testing.T) {
+	const prelude = `
+	pri struct foo?(
+		dummy : base.u8,
+	)
+	`
+	testCases := []checkTestCase{{
+		src: `
+		pri func foo.up_arm_sve!(x: slice base.u8),
+			choose cpu_arch >= arm_sve,
+		{
+			var util : base.arm_sve_utility
+			var v    : base.arm_sve_u8
+			var n    : base.u16
+			n = util.length_u8() as base.u16
+			v = util.make_u8_slicevl(a: args.x)
+			v = v.svadd_u8(b: util.make_u8_repeat(a: 1))
+			v.store_slicevl!(a: args.x)
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func foo.up_riscv_v!(x: slice base.u8),
+			choose cpu_arch >= riscv_v,
+		{
+			var util : base.riscv_v_utility
+			var v    : base.riscv_v_u8
+			if args.x.length() > 0 {
+				v = util.make_u8_slicevl(a: args.x[1 ..])
+				v = v.vmaxu_vv_u8m1(b: util.make_u8_repeat(a: 0x80))
+				v.store_slicevl!(a: args.x)
+			}
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func foo.up!(x: slice base.u8) {
+			var v : base.arm_sve_u8
+		}
+		`,
+		wantErr: `missing cpu_arch for "base.arm_sve_u8"`,
+	}, {
+		src: `
+		pri func foo.up_arm_sve!(x: slice base.u8),
+			choose cpu_arch >= arm_neon,
+		{
+			var v : base.arm_sve_u8
+		}
+		`,
+		wantErr: `missing cpu_arch for "base.arm_sve_u8"`,
+	}, {
+		src: `
+		pri func foo.up_riscv_v!(x: slice base.u8),
+			choose cpu_arch >= riscv_v,
+		{
+			var v : array[2] base.riscv_v_u8
+		}
+		`,
+		wantErr: `scalable cpu_arch type "base.riscv_v_u8" not allowed in "array[2] base.riscv_v_u8"`,
+	}, {
+		src: `
+		pri func foo.up_riscv_v?(x: slice base.u8),
+			choose cpu_arch >= riscv_v,
+		{
+			var v : base.riscv_v_u8
+		}
+		`,
+		wantErr: `scalable cpu_arch type "base.riscv_v_u8" not allowed in coroutine foo.up_riscv_v`,
+	}}
+
+	runCheckTestCases(tt, prelude, testCases)
+}
+
+func TestCheckedConversions(tt *testing.T) {
+	const prelude = `
+	pub struct foo?(
+		v8  : base.u8,
+		v16 : base.u16,
+	)
+	`
+	testCases := []checkTestCase{{
+		src: `
+		pri func foo.f?(x: base.i32) {
+			var y : base.u16
+			y = args.x as! base.u16
+			this.v16 = y
+			this.v8 = args.x as! base.u8
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func foo.f?(x: base.u32[..= 300]) {
+			this.v16 = (args.x as base.u16) + 1
+			this.v8 = args.x as! base.u8
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func foo.f?(x: base.i32) {
+			this.v8 = args.x as base.u8
+		}
+		`,
+		wantErr: `expression "args.x as base.u8" bounds [-2147483648 ..= 2147483647] is not within bounds [0 ..= 255]`,
+	}, {
+		src: `
+		pri func foo.f?(x: base.u32[1000 ..= 2000]) {
+			this.v8 = args.x as! base.u8
+		}
+		`,
+		wantErr: `expression "args.x as! base.u8" bounds [1000 ..= 2000] is never within bounds [0 ..= 255]`,
+	}, {
+		src: `
+		pri func foo.f!(x: base.i32) {
+			this.v8 = args.x as! base.u8
+		}
+		`,
+		wantErr: `"as!" within non-coroutine`,
+	}, {
+		src: `
+		pri func foo.f?(x: base.i32) {
+			this.v16 = (args.x as! base.u8) as base.u16
+		}
+		`,
+		wantErr: `has an effect-ful sub-expression`,
+	}, {
+		src: `
+		pri func foo.f?(x: base.i32) {
+			args.x as! base.u8
+		}
+		`,
+		wantErr: `"as!" value "args.x as! base.u8" is not assigned`,
+	}}
+
+	runCheckTestCases(tt, prelude, testCases)
+}
+
+func TestToU32Checked(tt *testing.T) {
+	const prelude = `
+	pub status "#too large"
+
+	pub struct foo?(
+		v32 : base.u32,
+	)
+	`
+	testCases := []checkTestCase{{
+		src: `
+		pri func foo.f!(x: base.u64) {
+			var o : base.optional_u32
+			o = args.x.to_u32_checked()
+			if o.is_ok() {
+				this.v32 = args.x as base.u32
+				assert o.value() == args.x
+			}
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func foo.f!(x: base.u64) base.status {
+			var o : base.optional_u32
+			o = args.x.to_u32_checked()
+			if not o.is_ok() {
+				assert args.x > 0xFFFF_FFFF
+				assert o.value() == 0
+				return "#too large"
+			}
+			this.v32 = args.x as base.u32
+			return ok
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func foo.f!(x: base.u64, y: base.u64) {
+			var o : base.optional_u32
+			o = args.x.to_u32_checked()
+			if o.is_ok() and (args.y > 0) {
+				this.v32 = args.x as base.u32
+			}
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func foo.f!(x: base.u64) {
+			var o : base.optional_u32
+			o = args.x.to_u32_checked()
+			if not o.is_ok() {
+				this.v32 = args.x as base.u32
+			}
+		}
+		`,
+		wantErr: `expression "args.x as base.u32" bounds [4294967296 ..= 18446744073709551615] is not within bounds`,
+	}, {
+		src: `
+		pri func foo.f!(x: base.u64) {
+			var y : base.u64
+			var o : base.optional_u32
+			y = args.x
+			o = y.to_u32_checked()
+			y = args.x
+			if o.is_ok() {
+				this.v32 = y as base.u32
+			}
+		}
+		`,
+		wantErr: `expression "y as base.u32" bounds [0 ..= 18446744073709551615] is not within bounds`,
+	}, {
+		src: `
+		pri func foo.f!(x: base.u64, p: base.optional_u32) {
+			if args.p.is_ok() {
+				this.v32 = args.x as base.u32
+			}
+		}
+		`,
+		wantErr: `expression "args.x as base.u32" bounds [0 ..= 18446744073709551615] is not within bounds`,
+	}}
+
+	runCheckTestCases(tt, prelude, testCases)
+}
+
+func TestImplicitWidening(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pri func f(x: base.u32, y: base.u64[..= 0xFFFF_FFFF]) base.u64 {
+			return args.x * args.y
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func f(x: base.u8, y: base.u16, z: base.u32[..= 0xFFFF]) base.u32 {
+			return args.x + args.y + args.z
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func f(x: base.u8, y: base.i16) base.i16 {
+			return (args.y / 2) - args.x
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func f(x: base.i32, y: base.u8) base.i32 {
+			return args.x & args.y
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func f(x: base.u32, y: base.i64) base.u32 {
+			if args.x < args.y {
+				return 1
+			}
+			return 0
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func f(x: base.u32) base.u64 {
+			var z : base.u64
+			z ~mod+= args.x
+			return z
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func f(x: base.u32, y: base.i32) base.i32 {
+			return args.x + args.y
+		}
+		`,
+		wantErr: `binary "+": "args.x" and "args.y", of types "base.u32" and "base.i32", do not have compatible types`,
+	}, {
+		src: `
+		pri func f(x: base.u64, y: base.i64) base.bool {
+			return args.x < args.y
+		}
+		`,
+		wantErr: `binary "<": "args.x" and "args.y", of types "base.u64" and "base.i64", do not have compatible types`,
+	}, {
+		src: `
+		pri func f(x: base.u8, y: base.u16, z: base.i16) base.i16 {
+			return args.x + args.y + args.z
+		}
+		`,
+		wantErr: `associative "+": "args.y" and "args.z", of types "base.u16" and "base.i16", do not have compatible types`,
+	}, {
+		src: `
+		pri func f(x: base.u32) base.u8 {
+			var z : base.u8
+			z ~mod+= args.x
+			return z
+		}
+		`,
+		wantErr: `assignment "~mod+=": "z" and "args.x", of types "base.u8" and "base.u32", do not have compatible types`,
+	}, {
+		src: `
+		pri func f(x: base.u32) base.u64 {
+			var z : base.u64
+			z = args.x
+			return z
+		}
+		`,
+		wantErr: `cannot assign "args.x" of type "base.u32" to "z" of type "base.u64"`,
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestScopeEnds(tt *testing.T) {
+	src := strings.TrimSpace(`
+pri func foo() {
+	var i : base.u32
+	var j : base.u32
+	var k : base.u32
+	var n : base.u32
+	while i < 10 {
+		i += 1
+		j = 0
+		while j < 3 {
+			k = j + 1
+			j += 1
+		} endwhile
+		if i < 5 {
+			n = 1
+		} else {
+			n = 2
+		}
+	} endwhile
+	n = 3
+}
+`) + "\n"
+
+	z, err := checkSourceWith(src, nil, nil)
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	foo := z.c.funcs[t.QQID{0, 0, z.tm.ByName("foo")}]
+	if foo == nil {
+		tt.Fatalf("c.funcs: no entry for foo")
+	}
+
+	// Each local variable's scope is identified by the line of its block's
+	// first statement. The i and n variables' scope is the whole function
+	// body, so that facts about them are never dropped.
+	got := []string(nil)
+	for key, vars := range findScopeEnds(foo.Body()) {
+		_, line := key.AsRaw().FilenameLine()
+		for _, v := range vars {
+			got = append(got, fmt.Sprintf("%s:%d", v.Str(z.tm), line))
+		}
+	}
+	sort.Strings(got)
+	want := []string{"j:7", "k:10"}
+	if !reflect.DeepEqual(got, want) {
+		tt.Fatalf("\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func TestCongruences(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pri func bar(x : base.u32[..= 0xFFFF], n : base.u32[..= 0xFFFF]) {
+			if ((args.x % 4) == 0) and ((args.n % 4) == 0) and (args.x < args.n) {
+				assert (args.x + 4) <= args.n
+				assert (args.x + 3) < args.n
+			}
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.u32[..= 0xFFFF], n : base.u32[..= 0xFFFF]) {
+			if ((args.x & 3) == 0) and ((args.n & 3) == 2) and (args.x < args.n) {
+				assert (args.x + 2) <= args.n
+			}
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.u32[..= 0xFFFF], n : base.u32[..= 0xFFFF]) {
+			if ((args.x & 3) == 0) and ((args.n & 3) == 2) and (args.x < args.n) {
+				assert (args.x + 3) <= args.n
+			}
+		}
+		`,
+		wantErr: `cannot prove "(args.x + 3) <= args.n"`,
+	}, {
+		src: `
+		pri func bar(x : base.u32[..= 0xFFFF], n : base.u32[..= 0xFFFF]) {
+			if ((args.x % 4) == 0) and (args.x < args.n) {
+				assert (args.x + 4) <= args.n
+			}
+		}
+		`,
+		wantErr: `cannot prove "(args.x + 4) <= args.n"`,
+	}, {
+		src: `
+		pri func bar(x : base.u32[..= 0xFFFF]) {
+			var y : base.u32
+			y = (args.x << 3) + 16
+			assert (y % 8) == 0
+			assert (y & 7) == 0
+			assert (y % 16) <> 4
+			assert ((args.x * 12) % 4) == 0
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.u32[..= 0xFFFF]) {
+			var y : base.u32
+			y = (args.x << 3) + 16
+			assert (y % 16) == 0
+		}
+		`,
+		wantErr: `cannot prove "(y % 16) == 0"`,
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestKnownBits(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pri func bar(x : base.u8, y : base.u8) {
+			assert ((args.x | 0x80) & 0xF0) >= 0x80
+			assert ((args.x & 0x0F) ^ 0x10) >= 0x10
+			assert ((args.x & 0x0F) ^ 0x10) <= 0x1F
+			assert ((args.x & 0xF0) | (args.y & 0x0F)) <= 0xFF
+			assert (((args.x >> 4) & 0x0F) | 0x30) >= 0x30
+			assert ((args.x & 0x7F) ^ 0x80) >= 0x80
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(c : base.u16) {
+			var a : array[32] base.u8
+			a[((args.c & 0x1F) ^ 0x20) - 0x20] = 0
+			a[((args.c >> 11) ^ 0x3E0) & 0x1F] = 0
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func bar(x : base.u8) {
+			assert ((args.x & 0x0F) ^ 0x10) >= 0x11
+		}
+		`,
+		wantErr: `cannot prove "((args.x & 0x0F) ^ 0x10) >= 0x11"`,
+	}, {
+		src: `
+		pri func bar(x : base.u8) {
+			assert ((args.x | 0x80) & 0xF0) >= 0x81
+		}
+		`,
+		wantErr: `cannot prove "((args.x | 0x80) & 0xF0) >= 0x81"`,
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestBitMask(tt *testing.T) {
+	testCases := [][2]uint64{
+		{0, 0},
+		{1, 1},
+		{2, 3},
+		{3, 3},
+		{4, 7},
+		{5, 7},
+		{50, 63},
+		{500, 511},
+		{5000, 8191},
+		{50000, 65535},
+		{500000, 524287},
+		{1<<7 - 2, 1<<7 - 1},
+		{1<<7 - 1, 1<<7 - 1},
+		{1<<7 + 0, 1<<8 - 1},
+		{1<<7 + 1, 1<<8 - 1},
+		{1<<8 - 2, 1<<8 - 1},
+		{1<<8 - 1, 1<<8 - 1},
+		{1<<8 + 0, 1<<9 - 1},
+		{1<<8 + 1, 1<<9 - 1},
+		{1<<32 - 2, 1<<32 - 1},
+		{1<<32 - 1, 1<<32 - 1},
+		{1<<32 + 0, 1<<33 - 1},
+		{1<<32 + 1, 1<<33 - 1},
+		{1<<64 - 2, 1<<64 - 1},
+		{1<<64 - 1, 1<<64 - 1},
+	}
+
+	for _, tc := range testCases {
+		got := bitMask(big.NewInt(0).SetUint64(tc[0]).BitLen())
+		want := big.NewInt(0).SetUint64(tc[1])
+		if got.Cmp(want) != 0 {
+			tt.Errorf("roundUpToPowerOf2Minus1(%v): got %v, want %v", tc[0], got, tc[1])
+		}
+	}
+}
+
+func TestBuiltInTypeMap(tt *testing.T) {
+	if got, want := len(builtInTypeMap), len(builtin.Types); got != want {
+		tt.Fatalf("lengths: got %d, want %d", got, want)
+	}
+	tm := t.Map{}
+	for _, s := range builtin.Types {
+		id := tm.ByName(s)
+		if id == 0 {
+			tt.Fatalf("ID(%q): got 0, want non-0", s)
+		}
+		if _, ok := builtInTypeMap[id]; !ok {
+			tt.Fatalf("no builtInTypeMap entry for %q", s)
+		}
+	}
+}
+
+func TestQuantifiedFacts(tt *testing.T) {
+	const srcFmt = `pri struct foo(
+	lut   : array[128] base.u8,
+	other : array[4] base.u8,
+)
+
+pri func foo.ascii!(s : slice base.u8, j : base.u64) base.u8 {
+	var i : base.u64
+
+	i = 0
+	assert i <= args.s.length() via "a <= b: a == c; c <= b"(c: 0)
+	while i < args.s.length(),
+		inv i <= args.s.length(),
+		inv args.s[.. i].all_le(bound: 0x7F),
+	{
+		%s
+		assert i < 0xFFFF_FFFF_FFFF_FFFF via "a < b: a < c; c <= b"(c: args.s.length())
+		i += 1
+	} endwhile
+	if args.j < i {
+		assert args.j < args.s.length() via "a < b: a < c; c <= b"(c: i)
+		return this.lut[args.s[args.j]]
+	}
+	return 0
+}
+`
+
+	testCases := []struct {
+		body    string
+		wantErr string
+	}{
+		{"if args.s[i] > 0x7F {\n\t\t\treturn 0\n\t\t}", ""},
+		{"if args.s[i] >= 0x80 {\n\t\t\treturn 0\n\t\t}", ""},
+		{"if args.s[i] > 0x80 {\n\t\t\treturn 0\n\t\t}", `check: cannot prove "args.s[.. i].all_le(bound: 0x7F)"`},
+		{"if args.s[i] > 0x7F {\n\t\t\treturn 0\n\t\t}\n\t\targs.s[i] = 0xFF", `check: cannot prove "args.s[.. i].all_le(bound: 0x7F)"`},
+		{"assert true", `check: cannot prove "args.s[.. i].all_le(bound: 0x7F)"`},
+	}
+
+	for _, tc := range testCases {
+		src := fmt.Sprintf(srcFmt, tc.body)
+		_, err := checkSourceWith(src, nil, nil)
+		if tc.wantErr != "" {
+			if (err == nil) || !strings.HasPrefix(err.Error(), tc.wantErr) {
+				tt.Fatalf("%q: Check: got %v, want prefix %q", tc.body, err, tc.wantErr)
+			}
+		} else if err != nil {
+			tt.Fatalf("%q: Check: %v", tc.body, err)
+		}
+	}
+}
+
+func TestIOPositionFacts(tt *testing.T) {
+	const prefix = `
+pri struct foo?(
+	a : array[8] base.u8,
+)
+`
+
+	testCases := []checkTestCase{{
+		src: `
+		pri func foo.header?(src : base.io_reader) {
+			var start : base.u64
+			var n     : base.u64
+
+			start = args.src.position()
+			if args.src.length() < 3 {
+				return ok
+			}
+			args.src.skip_u32_fast!(actual: 3, worst_case: 3)
+			if args.src.length() < 4 {
+				return ok
+			}
+			args.src.skip_u32_fast!(actual: 4, worst_case: 4)
+			n = args.src.position() - start
+			this.a[n] = 0
+		}
+		`,
+	}, {
+		src: `
+		pri func foo.header?(src : base.io_reader) {
+			var start : base.u64
+			var n     : base.u64
+
+			start = args.src.position()
+			if args.src.length() < 4 {
+				return ok
+			}
+			args.src.skip_u32_fast!(actual: 4, worst_case: 4)
+			if not args.src.can_undo_byte() {
+				return ok
+			}
+			args.src.undo_byte!()
+			n = args.src.position() - start
+			this.a[n] = 0
+		}
+		`,
+	}, {
+		src: `
+		pri func foo.header?(src : base.io_reader) {
+			var start : base.u64
+			var n     : base.u64
+
+			start = args.src.position()
+			if args.src.length() < 8 {
+				return ok
+			}
+			args.src.skip_u32_fast!(actual: 8, worst_case: 8)
+			n = args.src.position() - start
+			this.a[n] = 0
+		}
+		`,
+		wantErr: `cannot prove "n < 8"`,
+	}, {
+		src: `
+		pri func foo.header?(src : base.io_reader) {
+			var start : base.u64
+			var n     : base.u64
+
+			start = args.src.position()
+			if args.src.length() < 3 {
+				return ok
+			}
+			args.src.skip_u32_fast!(actual: 3, worst_case: 3)
+			start = 0
+			n = args.src.position() - start
+			this.a[n] = 0
+		}
+		`,
+		wantErr: `cannot prove "n < 8"`,
+	}, {
+		// The caller controls the io_reader's position while the callee is
+		// suspended, so a read or skip that can suspend carries no facts.
+		src: `
+		pri func foo.header?(src : base.io_reader) {
+			var start : base.u64
+			var n     : base.u64
+
+			start = args.src.position()
+			args.src.read_u32le?()
+			args.src.skip_u32?(n: 3)
+			n = args.src.position() - start
+			this.a[n] = 0xAB
+		}
+		`,
+		wantErr: `check: expression "args.src.position() - start" bounds`,
+	}}
+
+	runCheckTestCases(tt, prefix, testCases)
+}
+
+func TestLemmas(tt *testing.T) {
+	const srcFmt = `lemma "lt trans"(x: base.u32, y: base.u32, z: base.u32),
+	pre x < y,
+	pre y < z,
+	post x < z,
+{
+	assert x < z via "a < b: a < c; c < b"(c: y)
+}
+
+%s
+
+pri func foo(a: base.u32, b: base.u32, c: base.u32[..= 100]) base.u32 {
+	if (args.a < args.b) and (args.b < args.c) {
+		%s
+	}
+	return 0
+}
+`
+
+	testCases := []struct {
+		lemma   string
+		body    string
+		wantErr string
+	}{
+		{"", `assert args.a < args.c via "lt trans"(x: args.a, y: args.b, z: args.c)`, ""},
+		{"lemma \"small\"(x: base.u8),\n\tpost x <= 255,\n{\n}", `assert args.a <= 255 via "small"(x: args.a)`,
+			`check: cannot prove "args.a <= 255": argument x, "args.a", has bounds [0 ..= 4294967295], not within [0 ..= 255]`},
+		{"lemma \"small\"(x: base.u8),\n\tpost x <= 255,\n{\n}", `assert args.c <= 255 via "small"(x: args.c)`, ""},
+		{"", `assert args.a < args.c via "lt trans"(x: args.a, z: args.c)`,
+			`check: cannot prove "args.a < args.c": missing argument y`},
+		{"", `assert args.a < args.c via "lt trans"(x: args.a, y: args.a, z: args.c)`,
+			`check: cannot prove "args.a < args.c": cannot prove "args.a < args.a"`},
+		{"", `assert args.a <= args.c via "lt trans"(x: args.a, y: args.b, z: args.c)`,
+			`check: cannot prove "args.a <= args.c" at`},
+		{"", `assert args.a < args.c via "lt trans"(x: args.a, y: args.b, z: args.c, w: 0)`,
+			`check: cannot prove "args.a < args.c": lemma "lt trans" has no parameter w`},
+		{"lemma \"bad\"(x: base.u8),\n\tpost x < 100,\n{\n}", "",
+			`check: cannot prove "x < 100" (for the lemma "bad" post-condition)`},
+		{"lemma \"lt trans\"(x: base.u8),\n\tpost x <= 255,\n{\n}", "",
+			`check: duplicate reason "lt trans"`},
+		{"lemma \"a < b: b > a\"(x: base.u8),\n\tpost x <= 255,\n{\n}", "",
+			`check: duplicate reason "a < b: b > a"`},
+		{"lemma \"no post\"(x: base.u8),\n\tpre x < 9,\n{\n}", "",
+			`check: lemma "no post" has no post condition`},
+	}
+
+	for _, tc := range testCases {
+		src := fmt.Sprintf(srcFmt, tc.lemma, tc.body)
+		_, err := checkSourceWith(src, nil, nil)
+		if tc.wantErr != "" {
+			if (err == nil) || !strings.HasPrefix(err.Error(), tc.wantErr) {
+				tt.Fatalf("%q %q: Check: got %v, want prefix %q", tc.lemma, tc.body, err, tc.wantErr)
+			}
+		} else if err != nil {
+			tt.Fatalf("%q %q: Check: %v", tc.lemma, tc.body, err)
+		}
+	}
+}
+
+func TestExplain(tt *testing.T) {
+	const src = `pri struct foo(
+	a : array[4] base.u8,
+)
+
+pri func foo.bar!(x : base.u32[..= 9], y : base.u32) {
+	if args.y < 4 {
+		this.a[args.y] = 0
+	}
+	assert args.x < 10
+	this.a[args.x] = 0
+}
+`
+
+	buf := &bytes.Buffer{}
+	if _, err := checkSourceWith(src, nil, &Options{Explain: buf}); err == nil {
+		tt.Fatalf("Check: got nil error, want non-nil")
+	}
+
+	got := buf.String()
+	want := `test.wuffs:7: requirement "0 <= args.y": ok
+	"args.y" has bounds [0 ..= 3]
+test.wuffs:7: requirement "args.y < 4": ok
+	"args.y" has bounds [0 ..= 3]
+test.wuffs:9: assert "args.x < 10": ok
+	"args.x" has bounds [0 ..= 9]
+test.wuffs:10: requirement "0 <= args.x": ok
+	"args.x" has bounds [0 ..= 9]
+test.wuffs:10: requirement "args.x < 4": failed
+	"args.x" has bounds [0 ..= 9]
+	no fact about "args.x" implies it
+	facts:
+		args.x < 10
+`
+	if got != want {
+		tt.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestAssertCoverage(tt *testing.T) {
+	const src = `pri struct foo(
+	a : array[4] base.u8,
+)
+
+pri func foo.bar!(x : base.u32, y : base.u32) {
+	if args.y <= 2 {
+		if args.x < (args.y * 2) {
+			assert args.x < (args.y * 2)
+			assert args.x < 4 via "a < b: a < c; c <= b"(c: args.y * 2)
+			this.a[args.x] = 0
+		}
+	}
+}
+`
+
+	z, err := checkSourceWith(src, nil, &Options{AssertCoverage: true})
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+
+	got := []string(nil)
+	for _, v := range z.c.AssertCoverage() {
+		got = append(got, v.String())
+	}
+	want := []string{
+		`check: assert "args.x < (args.y * 2)" in foo.bar is not needed at test.wuffs:8`,
+		`check: assert "args.x < 4" in foo.bar is needed at test.wuffs:9`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		tt.Fatalf("\ngot  %q\nwant %q", got, want)
+	}
+
+	gotSummary := SummarizeAssertCoverage(z.c.AssertCoverage()).String()
+	wantSummary := "1 of 2 asserts needed, 1 not needed\n" +
+		"\tfoo.bar: 1 of 2 asserts needed, 1 not needed\n"
+	if gotSummary != wantSummary {
+		tt.Fatalf("summary:\ngot  %q\nwant %q", gotSummary, wantSummary)
+	}
+}
+
+func TestTrackFacts(tt *testing.T) {
+	const src = `pri struct foo(
+	a : array[8] base.u8,
+)
+
+pri func foo.bar!(n : base.u32) {
+	var i : base.u32
+	var j : base.u32
+
+	j = 3
+	i = args.n
+	if i < 8 {
+		j = i
+		i = 9
+	}
+	i = 5
+	this.a[j] = 0
+}
+`
+
+	z, err := checkSourceWith(src, nil, &Options{TrackFacts: true})
+	e, ok := err.(*Error)
+	if !ok {
+		tt.Fatalf("Check: got %v, want an *Error", err)
+	}
+
+	got := []string(nil)
+	for _, v := range e.FactEvents {
+		got = append(got, fmt.Sprintf("%s:%d:%d", v.Fact.Str(z.tm), v.Established, v.Dropped))
+	}
+	want := []string{
+		"i == 5:15:0",
+		"j == 0:7:9",
+		"i == 0:6:10",
+		"i < 8:11:13",
+		"j == i:12:13",
+		"j == 3:9:11",
+		"i == args.n:10:11",
+		"i >= 8:11:11",
+		"j <= 7:12:11",
+		"i == 9:13:11",
+	}
+	if !reflect.DeepEqual(got, want) {
+		tt.Fatalf("\ngot  %q\nwant %q", got, want)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteHTMLReport(buf, e, []byte(src)); err != nil {
+		tt.Fatalf("WriteHTMLReport: %v", err)
+	}
+	html := buf.String()
+	for _, w := range []string{
+		`<span id="L16" class="fail">`,
+		`<td class="fact">i == 5</td><td><a href="#L15">line 15</a></td>`,
+		`<td class="fact">j == i</td><td><a href="#L12">line 12</a></td><td><a href="#L13">line 13</a></td>`,
+	} {
+		if !strings.Contains(html, w) {
+			tt.Errorf("WriteHTMLReport: output does not contain %q", w)
+		}
+	}
+}
+
+func TestFactTrace(tt *testing.T) {
+	const src = `pri func f(n : base.u32[..= 100]) base.u32 {
+	var i : base.u32
+
+	i = args.n
+	if i < 8 {
+		i += 1
+	}
+	i = 5
+	return i
+}
+`
+
+	trace := &bytes.Buffer{}
+	if _, err := checkSourceWith(src, nil, &Options{FactTrace: trace}); err != nil {
+		tt.Fatalf("Check: %v", err)
+	}
+	if got, want := strings.SplitN(trace.String(), "\n", 2)[0],
+		`{"op":"func","fn":"f","file":"test.wuffs","line":1}`; got != want {
+		tt.Fatalf("first line: got %q, want %q", got, want)
+	}
+
+	events, err := ReadFactTrace(trace)
+	if err != nil {
+		tt.Fatalf("ReadFactTrace: %v", err)
+	}
+	if got, want := FactTraceFuncs(events), []string{"f"}; !reflect.DeepEqual(got, want) {
+		tt.Fatalf("FactTraceFuncs: got %q, want %q", got, want)
+	}
+	steps, err := ReplayFactTrace(events, "f")
+	if err != nil {
+		tt.Fatalf("ReplayFactTrace: %v", err)
+	}
+
+	got := []string(nil)
+	for _, s := range steps {
+		e := s.Event
+		if (e.Line == 5) && (e.Op != FactTraceFunc) {
+			// Skip unifying the if's branches.
+			continue
+		}
+		got = append(got, fmt.Sprintf("%d %s %s|%s|%s", e.Line, e.Op, e.Fact, e.From, strings.Join(s.Facts, ", ")))
+	}
+	want := []string{
+		"1 func ||",
+		"2 insert i == 0||i == 0",
+		"4 drop i == 0||",
+		"4 insert i == args.n||i == args.n",
+		"4 insert i <= 100||i == args.n, i <= 100",
+		"6 refine i == (args.n + 1)|i == args.n|i <= 100, i < 8, i == (args.n + 1)",
+		"6 refine i <= 101|i <= 100|i < 8, i == (args.n + 1), i <= 101",
+		"6 refine i < 9|i < 8|i == (args.n + 1), i <= 101, i < 9",
+		"6 insert i >= 1||i == (args.n + 1), i <= 101, i < 9, i >= 1",
+		"6 insert i <= 8||i == (args.n + 1), i <= 101, i < 9, i >= 1, i <= 8",
+		"8 insert i == 5||i == 5",
+	}
+	if !reflect.DeepEqual(got, want) {
+		tt.Fatalf("\ngot  %q\nwant %q", got, want)
+	}
+
+	if _, err := ReplayFactTrace(events, "g"); err == nil {
+		tt.Fatalf("ReplayFactTrace: got nil error for a missing function")
+	}
+	if _, err := ReadFactTrace(strings.NewReader(`{"op":"jump"}`)); err == nil {
+		tt.Fatalf("ReadFactTrace: got nil error for an unknown op")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteHTMLFactTrace(buf, steps, []byte(src)); err != nil {
+		tt.Fatalf("WriteHTMLFactTrace: %v", err)
+	}
+	html := buf.String()
+	for _, w := range []string{
+		`<title>Wuffs fact trace: f</title>`,
+		`<span id="L6"><span class="num">6</span>		i &#43;= 1</span>`,
+		`"from":"i \u003c 8"`,
+	} {
+		if !strings.Contains(html, w) {
+			tt.Errorf("WriteHTMLFactTrace: output does not contain %q", w)
+		}
+	}
+}
+
+func TestErrorPositions(tt *testing.T) {
+	testCases := []struct {
+		src  string
+		want string
+	}{{
+		src: "pri func f() {\n" +
+			"\tvar x : base.u32\n" +
+			"\tx = (1 + 2\n" +
+			"}\n",
+		want: `parse: expected ")", got ";" at test.wuffs:3:12`,
+	}, {
+		src: "pri func f(x : base.u32) base.u8 {\n" +
+			"\tvar y : base.u8\n" +
+			"\ty = (args.x as base.u8) + 1\n" +
+			"\treturn y\n" +
+			"}\n",
+		want: `check: expression "args.x as base.u8" bounds [0 ..= 4294967295] ` +
+			`is not within bounds [0 ..= 255] at test.wuffs:3:7 (3:7-24)`,
+	}, {
+		src: "pri func f(x : base.u32) base.u32 {\n" +
+			"\tvar y : base.u32[..= 255]\n" +
+			"\ty = 1 +\n" +
+			"\t\t(args.x & 0xFF)\n" +
+			"\treturn y\n" +
+			"}\n",
+		want: `check: expression "1 + (args.x & 0xFF)" bounds [1 ..= 256] ` +
+			`is not within bounds [0 ..= 255] at test.wuffs:3:6 (3:6-0)`,
+	}, {
+		src: "pragma strictness strict\n" +
+			"pri func f(x : base.u32) base.u32 {\n" +
+			"\tvar y : base.u32\n" +
+			"\ty = 1\n" +
+			"\ty = args.x\n" +
+			"\treturn y\n" +
+			"}\n",
+		want: `check: value assigned to "y" is never used at test.wuffs:4:2 (4:2-7)`,
+	}}
+
+	for i, tc := range testCases {
+		_, err := checkSourceWith(tc.src, nil, nil)
+		got := ""
+		if e, ok := err.(*Error); ok {
+			got = fmt.Sprintf("%v at %s:%d:%d (%d:%d-%d)", e.Err, e.Filename, e.Line, e.Column,
+				e.Line, e.Column, e.EndColumn)
+		} else if err != nil {
+			got = err.Error()
+		}
+		if got != tc.want {
+			tt.Errorf("tc #%d:\ngot  %s\nwant %s", i, got, tc.want)
+		}
+	}
+}
+
+func TestMaxErrors(tt *testing.T) {
+	const filename = "test.wuffs"
+	const checkSrc = "pri func f(x : base.u32) base.u32 {\n" +
+		"\treturn args.x + 1\n" +
+		"}\n" +
+		"pri func g(x : base.u32) base.u32 {\n" +
+		"\treturn args.x\n" +
+		"}\n" +
+		"pri func h(x : base.u8) base.u8 {\n" +
+		"\treturn args.x + 1\n" +
+		"}\n" +
+		"pri func k(x : base.u8) base.u8 {\n" +
+		"\treturn args.x * 2\n" +
+		"}\n"
+	const parseSrc = "pri func f() {\n" +
+		"\tvar x : base.u32\n" +
+		"\tx = (1 + 2\n" +
+		"\twhile true {\n" +
+		"\t\tx = ]\n" +
+		"\t} endwhile\n" +
+		"\tx = 3\n" +
+		"}\n" +
+		"pri func g() {\n" +
+		"\tvar y : base.u32\n" +
+		"\ty = )\n" +
+		"}\n"
+
+	testCases := []struct {
+		src       string
+		maxErrors int
+		want      []string
+	}{{
+		src:       checkSrc,
+		maxErrors: 0,
+		want:      []string{`"args.x + 1" at 2`},
+	}, {
+		src:       checkSrc,
+		maxErrors: 1,
+		want:      []string{`"args.x + 1" at 2`},
+	}, {
+		src:       checkSrc,
+		maxErrors: 2,
+		want:      []string{`"args.x + 1" at 2`, `"args.x + 1" at 8`},
+	}, {
+		src:       checkSrc,
+		maxErrors: 10,
+		want:      []string{`"args.x + 1" at 2`, `"args.x + 1" at 8`, `"args.x * 2" at 11`},
+	}, {
+		src:       parseSrc,
+		maxErrors: 0,
+		want:      []string{`parse: expected ")", got ";" at test.wuffs:3:12`},
+	}, {
+		src:       parseSrc,
+		maxErrors: 10,
+		want: []string{
+			`parse: expected ")", got ";" at test.wuffs:3:12`,
+			`parse: expected identifier, got "]" at test.wuffs:5:7`,
+			`parse: expected identifier, got ")" at test.wuffs:11:6`,
+		},
+	}}
+
+	for i, tc := range testCases {
+		tm := &t.Map{}
+		tokens, _, err := t.Tokenize(tm, filename, []byte(tc.src))
+		if err != nil {
+			tt.Errorf("tc #%d: Tokenize: %v", i, err)
+			continue
+		}
+		file, err := parse.Parse(tm, filename, tokens, &parse.Options{MaxErrors: tc.maxErrors})
+		if err == nil {
+			_, err = Check(tm, []*a.File{file}, nil, &Options{MaxErrors: tc.maxErrors})
+		}
+		if err == nil {
+			tt.Errorf("tc #%d: got nil error", i)
+			continue
+		}
+		got := []string(nil)
+		for _, err := range diagnostic.Split(err) {
+			if e, ok := err.(*Error); ok {
+				got = append(got, fmt.Sprintf("%s at %d", quoted(e.Err.Error()), e.Line))
+			} else {
+				got = append(got, err.Error())
+			}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			tt.Errorf("tc #%d:\ngot  %q\nwant %q", i, got, tc.want)
+		}
+	}
+}
+
+// quoted returns the first double-quoted part of s, including the quotes.
+func quoted(s string) string {
+	if i := strings.IndexByte(s, '"'); i >= 0 {
+		if j := strings.IndexByte(s[i+1:], '"'); j >= 0 {
+			return s[i : i+j+2]
+		}
+	}
+	return s
+}
+
+func TestDiagnostic(tt *testing.T) {
+	const filename = "test.wuffs"
+	const src = `pri func warn(x : base.u32[..= 100]) base.u32 {
+	var w : base.u32
+	w = 3
+	w = 4
+	return args.x + w
+}
+
+pri func fail(x : base.u32[..= 100]) base.u32 {
+	var y : base.u32
+	var z : base.u32[..= 10]
+	y = args.x
+	z = y + 1
+	return z
+}
+`
+
+	tm := &t.Map{}
+	tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	file, err := parse.Parse(tm, filename, tokens, nil)
+	if err != nil {
+		tt.Fatalf("Parse: %v", err)
+	}
+
+	// Check fails on the fail function, so check the warn function alone for
+	// its warning.
+	warnFile := a.NewFile(filename, file.TopLevelDecls()[:1])
+	c, err := Check(tm, []*a.File{warnFile}, nil, nil)
+	if err != nil {
+		tt.Fatalf("Check: %v", err)
+	} else if len(c.Warnings()) != 1 {
+		tt.Fatalf("Warnings: got %d, want 1", len(c.Warnings()))
+	}
+	w := c.Warnings()[0].Diagnostic()
+	w.SetSpan([]byte(src))
+	if got, want := fmt.Sprintf("%s %s %d:%d-%d", w.Severity, w.Code, w.Line, w.Column, w.EndColumn),
+		"warning check.dead_store 3:2-7"; got != want {
+		tt.Errorf("warning: got %q, want %q", got, want)
+	}
+
+	_, err = Check(tm, []*a.File{file}, nil, &Options{TrackFacts: true})
+	e, ok := err.(*Error)
+	if !ok {
+		tt.Fatalf("Check: got %v, want an *Error", err)
+	}
+	d := e.Diagnostic()
+	d.SetSpan([]byte(src))
+	if got, want := fmt.Sprintf("%s %s %d:%d-%d", d.Severity, d.Code, d.Line, d.Column, d.EndColumn),
+		"error check.bounds 12:6-11"; got != want {
+		tt.Errorf("error: got %q, want %q", got, want)
+	}
+	got := []string(nil)
+	for _, r := range d.Related {
+		got = append(got, fmt.Sprintf("%s:%d", r.Message, r.Line))
+	}
+	want := []string{
+		"fact: z == 0:10",
+		"fact: y == args.x:11",
+		"fact: y <= 100:11",
+		"dropped fact: y == 0:11",
+	}
+	if !reflect.DeepEqual(got, want) {
+		tt.Fatalf("Related:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestDecreases(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pri func foo(x: base.u32, k: base.u32) {
+			var n : base.u32
+			var i : base.u32
+			var j : base.u32
+			n = args.x
+			while n > 0,
+				decreases n,
+			{
+				n -= 1
+			} endwhile
+			while i < 100,
+				decreases 100 - i,
+			{
+				j = 0
+				while j < 10,
+					decreases 10 - j,
+					inv i < 100,
+				{
+					j += 1
+				} endwhile
+				if i > 50 {
+					i += 2
+					continue
+				}
+				i += 1
+			} endwhile
+			n = args.x
+			if args.k > 0 {
+				while n >= args.k,
+					decreases n,
+					inv args.k > 0,
+				{
+					n -= args.k
+				} endwhile
+			}
+		}
+		`,
+		wantErr: "",
+	}, {
+		src: `
+		pri func foo(x: base.u32) {
+			var n : base.u32
+			n = args.x
+			while n > 0,
+				decreases n,
+			{
+				n = n - 1
+			} endwhile
+		}
+		`,
+		wantErr: `decreases expression "n" decreases: its starting value was forgotten`,
+	}, {
+		src: `
+		pri func foo(x: base.u32, k: base.u32) {
+			var n : base.u32
+			n = args.x
+			while n >= args.k,
+				decreases n,
+			{
+				n -= args.k
+			} endwhile
+		}
+		`,
+		wantErr: `decreases expression "n" decreases: it started at or above "n + 0"`,
+	}, {
+		src: `
+		pri func foo() {
+			var i : base.u32
+			while i < 100,
+				decreases 100 - i,
+			{
+				i += 1
+				if i == 50 {
+					continue
+				}
+				i -= 1
+			} endwhile
+		}
+		`,
+		wantErr: `decreases expression "100 - i" decreases: it started at or above "100 - ((i + 1) - 1)"`,
+	}, {
+		src: `
+		pri func foo(x: base.u32) {
+			var i : base.u32
+			while i < 100,
+				decreases args.x - i,
+			{
+				i += 1
+			} endwhile
+		}
+		`,
+		wantErr: `decreases expression "args.x - i" is non-negative`,
+	}, {
+		src: `
+		pragma termination required
+		pri func foo() {
+			while true {
+			} endwhile
+		}
+		`,
+		wantErr: `while loop has no decreases clause, as required by the pragma termination at test.wuffs:1`,
+	}}
+
+	runCheckTestCases(tt, "", testCases)
+}
+
+func TestCustomReasons(tt *testing.T) {
+	reasons := map[string]Reason{
+		// A masked value is less than any constant greater than the mask.
+		"a < b: a is masked": func(p *Prover, n *a.Assert) error {
+			op, xa, xb := parseBinaryOp(n.Condition())
+			if (op != t.IDXBinaryLessThan) || (xa.Operator() != t.IDXBinaryAmp) {
+				return errFailed
+			}
+			mask, limit := xa.RHS().AsExpr().ConstValue(), xb.ConstValue()
+			if (mask == nil) || (limit == nil) || (mask.Cmp(limit) >= 0) {
+				return fmt.Errorf("the mask is not less than %s", xb.Str(p.TMap()))
+			}
+			return nil
+		},
+
+		"a < b: a < c; c <= b, via a plugin": func(p *Prover, n *a.Assert) error {
+			op, xa, xb := parseBinaryOp(n.Condition())
+			xc := p.Arg(n, "c")
+			if (op != t.IDXBinaryLessThan) || (xc == nil) {
+				return errFailed
+			}
+			if err := p.Prove(t.IDXBinaryLessThan, xa, xc); err != nil {
+				return err
+			}
+			return p.Prove(t.IDXBinaryLessEq, xc, xb)
+		},
+	}
+
+	testCases := []struct {
+		src     string
+		reasons map[string]Reason
+		wantErr string
+	}{{
+		src: `
+		pri func foo(x: base.u32) {
+			assert (args.x & 0xFF) < 300 via "a < b: a is masked"()
+		}
+		`,
+		reasons: reasons,
+	}, {
+		src: `
+		pri func foo(x: base.u32) {
+			assert (args.x & 0xFF) < 200 via "a < b: a is masked"()
+		}
+		`,
+		reasons: reasons,
+		wantErr: `cannot prove "(args.x & 0xFF) < 200": the mask is not less than 200`,
+	}, {
+		src: `
+		pri func foo(x: base.u32, y: base.u32) {
+			if (args.x < args.y) and (args.y <= 4) {
+				assert args.x < 4 via "a < b: a < c; c <= b, via a plugin"(c: args.y)
+			}
+		}
+		`,
+		reasons: reasons,
+	}, {
+		src: `
+		pri func foo(x: base.u32, y: base.u32) {
+			if args.x < args.y {
+				assert args.x < 4 via "a < b: a < c; c <= b, via a plugin"(c: args.y)
+			}
+		}
+		`,
+		reasons: reasons,
+		wantErr: `cannot prove "args.y <= 4"`,
+	}, {
+		src: `
+		pri func foo(x: base.u32) {
+			assert (args.x & 0xFF) < 300 via "a < b: a is masked"()
+		}
+		`,
+		wantErr: `no such reason "a < b: a is masked"`,
+	}, {
+		src: `
+		pri func foo(x: base.u32) {
+			assert args.x < 1 via "a < b: b > a"()
+		}
+		`,
+		reasons: map[string]Reason{
+			"a < b: b > a": reasons["a < b: a is masked"],
+		},
+		wantErr: `duplicate reason "a < b: b > a"`,
+	}, {
+		src: `
+		lemma "a < b: a is masked"(x: base.u32),
+			post (x & 0xFF) < 300,
+		{
+		}
+		`,
+		reasons: reasons,
+		wantErr: `duplicate reason "a < b: a is masked"`,
+	}}
+
+	for i, tc := range testCases {
+		src := strings.TrimSpace(tc.src) + "\n"
+		_, err := checkSourceWith(src, nil, &Options{Reasons: tc.reasons})
+		compareCheckErr(tt, i, err, tc.wantErr)
+	}
+}
+
+func TestDeclOrder(tt *testing.T) {
+	testCases := []struct {
+		srcs    []string
+		wantErr string
+	}{{
+		srcs: []string{`
+		pri const A : base.u32 = B + 1
+		pri const B : base.u32 = C * 2
+		pri const C : base.u32 = 3
+		`},
+	}, {
+		srcs: []string{`
+		pri const A : array[N] base.u8 = [0, 0, 0, 0]
+		`, `
+		pri const N : base.u32 = 4
+		`},
+	}, {
+		srcs: []string{`
+		pri const A : base.u32 = B
+		`, `
+		pri const B : base.u32 = C
+		pri const C : base.u32 = A
+		`},
+		wantErr: `check: cyclical const definitions: A -> B -> C -> A at a.wuffs:1`,
+	}, {
+		srcs: []string{`
+		pri const A : base.u32 = A + 1
+		`},
+		wantErr: `check: cyclical const definitions: A -> A at a.wuffs:1`,
+	}, {
+		srcs: []string{`
+		pri const A : base.u32 = 1
+		`, `
+		pri const B : base.u32 = A
+		pri const A : base.u32 = 2
+		`},
+		wantErr: `check: duplicate top level name "A"`,
+	}, {
+		srcs: []string{`
+		lemma "lt trans"(x: base.u32, y: base.u32, z: base.u32),
+			pre x < y,
+			pre y < z,
+			post x < z,
+		{
+			assert x < z via "lt"(a: x, b: y, c: z)
+		}
+		`, `
+		lemma "lt"(a: base.u32, b: base.u32, c: base.u32),
+			pre a < b,
+			pre b < c,
+			post a < c,
+		{
+			assert a < c via "a < b: a < c; c < b"(c: b)
+		}
+		`},
+	}, {
+		srcs: []string{`
+		lemma "p"(x: base.u32),
+			post x <= 0xFFFF_FFFF,
+		{
+			assert x <= 0xFFFF_FFFF via "q"(x: x)
+		}
+		`, `
+		lemma "q"(x: base.u32),
+			post x <= 0xFFFF_FFFF,
+		{
+			assert x <= 0xFFFF_FFFF via "p"(x: x)
+		}
+		`},
+		wantErr: `check: cyclical lemma definitions: "p" -> "q" -> "p" at a.wuffs:1`,
+	}}
+
+	for i, tc := range testCases {
+		tm := &t.Map{}
+		files := []*a.File(nil)
+		for j, src := range tc.srcs {
+			filename := string(rune('a'+j)) + ".wuffs"
+			src = strings.TrimSpace(src) + "\n"
+			tokens, _, err := t.Tokenize(tm, filename, []byte(src))
+			if err != nil {
+				tt.Fatalf("tc #%d: Tokenize: %v", i, err)
+			}
+			file, err := parse.Parse(tm, filename, tokens, nil)
+			if err != nil {
+				tt.Fatalf("tc #%d: Parse: %v", i, err)
+			}
+			files = append(files, file)
+		}
+
+		_, err := Check(tm, files, nil, nil)
+		if tc.wantErr == "" {
+			if err != nil {
+				tt.Errorf("tc #%d: Check: %v", i, err)
+			}
+		} else if err == nil {
+			tt.Errorf("tc #%d: Check: got nil error, want %q", i, tc.wantErr)
+		} else if !strings.Contains(err.Error(), tc.wantErr) {
+			tt.Errorf("tc #%d: Check: got %q, want %q", i, err, tc.wantErr)
+		}
+	}
+}
+
+func TestWrapAroundBounds(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pri func foo.bar!(x: base.u8) {
+			if args.x >= 250 {
+				this.a[args.x ~mod+ 10] = 0
+			}
+		}
+		`,
+	}, {
+		src: `
+		pri func foo.bar!(x: base.u8) {
+			if args.x >= 250 {
+				this.a[(args.x ~mod+ 3) ~mod- 250] = 0
+			}
+		}
+		`,
+	}, {
+		src: `
+		pri func foo.bar!(x: base.i8) {
+			if args.x >= 120 {
+				this.a[((args.x ~mod+ 10) ~mod+ 126) as base.u32] = 0
+			}
+		}
+		`,
+	}, {
+		src: `
+		pri func foo.bar!(x: base.u8) {
+			if args.x >= 240 {
+				this.a[args.x ~mod+ 10] = 0
+			}
+		}
+		`,
+		wantErr: `cannot prove "(args.x ~mod+ 10) < 10"`,
+	}}
+
+	runCheckTestCases(tt, "pri struct foo(\n\ta : array[10] base.u8,\n)\n\n", testCases)
+}
+
+func TestDifferenceBounds(tt *testing.T) {
+	testCases := []checkTestCase{{
+		src: `
+		pri func foo.bar!(s: slice base.u8, i: base.u64, j: base.u64) {
+			if args.i <= args.j {
+				if args.j < args.s.length() {
+					args.s[args.i] = 0
+				}
+			}
+		}
+		`,
+	}, {
+		src: `
+		pri func foo.bar!(i: base.u32, j: base.u32) {
+			if (args.j < 10) and (args.i <= args.j) {
+				this.a[args.i] = 0
+			}
+		}
+		`,
+	}, {
+		src: `
+		pri func foo.bar!(i: base.u32, j: base.u32, k: base.u32) {
+			if args.j < 100 {
+				if (args.k <= 7) and (args.k == (args.j + 1)) and (args.i < (args.j + 3)) {
+					this.a[args.i] = 0
+				}
+			}
+		}
+		`,
+	}, {
+		src: `
+		pri func foo.bar!(i: base.u32, j: base.u32) {
+			if args.j < 10 {
+				if args.i <= (args.j + 1) {
+					this.a[args.i] = 0
+				}
+			}
+		}
+		`,
+		wantErr: `cannot prove "args.i < 10"`,
+	}}
+
+	runCheckTestCases(tt, "pri struct foo(\n\ta : array[10] base.u8,\n)\n\n", testCases)
+}
+
+func TestWidening(tt *testing.T) {
+	testCases := []checkTestCase{{
+		// A geometric counter: n is in [1000 ..= 1998] after the loop.
+		src: `
+		pri func foo.bar!() {
+			var n : base.u32
+			n = 1
+			while n < 1000 {
+				n = n * 2
+			} endwhile
+			this.a[n - 1000] = 0
+		}
+		`,
+	}, {
+		// A non-unit stride: i is in [100 ..= 102] after the loop.
+		src: `
+		pri func foo.bar!() {
+			var i : base.u32
+			while i < 100 {
+				this.a[i] = 0
+				i += 3
+			} endwhile
+			this.b[i - 100] = 0
+		}
+		`,
+	}, {
+		// The bounds of j, which the loop does not modify, survive it.
+		src: `
+		pri func foo.bar!() {
+			var i : base.u32
+			var j : base.u32
+			j = 7
+			while i < 100 {
+				i += 1
+			} endwhile
+			this.b[j - 5] = 0
+		}
+		`,
+	}, {
+		// An explicit break: i is 7 after the loop.
+		src: `
+		pri func foo.bar!() {
+			var i : base.u32
+			while true {
+				if i >= 7 {
+					break
+				}
+				i += 1
+			} endwhile
+			this.b[i - 5] = 0
+		}
+		`,
+	}, {
+		// Nested loops, with a labeled continue.
+		src: `
+		pri func foo.bar!() {
+			var i : base.u32
+			var j : base.u32
+			while.outer i < 10 {
+				i += 2
+				j = 1
+				while j < 50 {
+					j *= 3
+					if j > 20 {
+						continue.outer
+					}
+				} endwhile
+			} endwhile.outer
+			this.a[(i * 10) + j] = 0
+		}
+		`,
+	}, {
+		// Nothing bounds n from above after the loop.
+		src: `
+		pri func foo.bar!(x: base.u32) {
+			var n : base.u32
+			n = args.x
+			while n < 1000 {
+				n = n * 2
+			} endwhile
+			this.a[n - 1000] = 0
+		}
+		`,
+		wantErr: `cannot prove "(n - 1000) < 1000"`,
+	}}
+
+	runCheckTestCases(tt, "pri struct foo(\n\ta : array[1000] base.u8,\n\tb : array[3] base.u8,\n)\n\n", testCases)
+}
+
+func TestQuery(tt *testing.T) {
+	const filename = "test.wuffs"
+	const src = `pri struct foo(
+	a : array[8] base.u8,
+)
+
+pri func foo.bar!(n : base.u32[..= 100]) {
+	var i : base.u32
+	var j : base.u32
+
+	i = args.n
+	if i < 8 {
+		j = i + 1
+		this.a[j] = 0
+	}
+}
+`
+
+	testCases := []struct {
+		line, column uint32
+		want         string
+	}{
+		// The "+" in "i + 1", before the assignment to j.
+		{11, 9, "i + 1: base.u32 [1 ..= 8]; i < 8, i <= 100, i == args.n, j == 0"},
+		// The "i" in "i + 1", which is innermost.
+		{11, 7, "i: base.u32 [0 ..= 7]; i < 8, i <= 100, i == args.n, j == 0"},
+		// The "j" in the statement whose proof fails.
+		{12, 10, "j: base.u32 [1 ..= 8]; i < 8, i <= 100, i == args.n, j <= 8, j == (i + 1), j >= 1"},
+		// The "args.n" in the assignment before the if.
+		{9, 11, "args.n: base.u32[..= 100] [0 ..= 100]; i == 0, j == 0"},
+		// The blank line between the vars and the assignment.
+		{8, 1, "no statement"},
+	}
+
+	for _, tc := range testCases {
+		z := &Query{Filename: filename, Line: tc.line, Column: tc.column}
+		cs, err := checkSourceWith(src, nil, &Options{Query: z})
+		if err == nil {
+			tt.Fatalf("Check: got nil error, want non-nil")
+		}
+		tm := cs.tm
+
+		got := "no statement"
+		if z.Stmt != nil {
+			facts := []string(nil)
+			for _, x := range z.Facts {
+				facts = append(facts, x.Str(tm))
+			}
+			sort.Strings(facts)
+			got = fmt.Sprintf("%s: %s %v; %s", z.Expr.Str(tm), z.Expr.MType().Str(tm), z.Expr.MBounds(),
+				strings.Join(facts, ", "))
+		}
+		if got != tc.want {
+			tt.Errorf("%d:%d: got %q, want %q", tc.line, tc.column, got, tc.want)
+		}
+	}
+}
+
+func TestTaint(tt *testing.T) {
+	const decl = `
+		pri struct foo?(
+			a : array[256] base.u8,
+			n : base.u8,
+		)
+	`
+
+	testCases := []struct {
+		pragma  bool
+		src     string
+		wantErr string
+	}{{
+		pragma: false,
+		src: `
+		pri func foo.bar?(src: base.io_reader) {
+			var x : base.u8
+			x = args.src.read_u8?()
+			this.a[x] = 0
+		}
+		`,
+	}, {
+		pragma: true,
+		src: `
+		pri func foo.bar?(src: base.io_reader) {
+			var x : base.u8
+			x = args.src.read_u8?()
+			this.a[x] = 0
+		}
+		`,
+		wantErr: `index "x" is derived from input bytes and is not clamped, ` +
+			`as required by the pragma taint at test.wuffs:1 at test.wuffs:9:11`,
+	}, {
+		pragma: true,
+		src: `
+		pri func foo.bar?(src: base.io_reader) {
+			var x : base.u8
+			x = args.src.read_u8?()
+			this.a[x & 0x7F] = 0
+			this.a[x.min(a: 10)] = 0
+			x = 3
+			this.a[x] = 0
+		}
+		`,
+	}, {
+		pragma: true,
+		src: `
+		pri func foo.bar?(src: base.io_reader) {
+			var x : base.u8
+			x = args.src.read_u8?()
+			if x < 100 {
+				this.a[x] = 0
+			}
+			if x >= 200 {
+			} else {
+				this.a[x] = 0
+			}
+		}
+		`,
+	}, {
+		pragma: true,
+		src: `
+		pri func foo.bar?(src: base.io_reader) {
+			var x : base.u8
+			var y : base.u8
+			x = args.src.read_u8?()
+			y = args.src.read_u8?()
+			if x < y {
+				this.a[x] = 0
+			}
+		}
+		`,
+		wantErr: `index "x" is derived from input bytes`,
+	}, {
+		pragma: true,
+		src: `
+		pri func foo.bar?(src: base.io_reader) {
+			this.n = args.src.read_u8?()
+		}
+
+		pri func foo.baz!() {
+			this.a[this.n] = 0
+		}
+		`,
+		wantErr: `index "this.n" is derived from input bytes`,
+	}, {
+		pragma: true,
+		src: `
+		pri func foo.bar?(src: base.io_reader) {
+			var x : base.u8
+			x = args.src.read_u8?()
+			this.set!(i: x)
+		}
+
+		pri func foo.set!(i: base.u8) {
+			this.a[args.i] = 0
+		}
+		`,
+		wantErr: `index "args.i" is derived from input bytes`,
+	}, {
+		pragma: true,
+		src: `
+		pub func foo.bar!(x: slice base.u8) {
+			var p : slice base.u8
+			iterate (p = args.x)(length: 1, advance: 1, unroll: 1) {
+				this.a[p[0]] = 0
+			}
+		}
+		`,
+		wantErr: `index "p[0]" is derived from input bytes`,
+	}, {
+		pragma: true,
+		src: `
+		pri func foo.bar!(x: slice base.u8) {
+			var p : slice base.u8
+			iterate (p = args.x)(length: 1, advance: 1, unroll: 1) {
+				this.a[p[0]] = 0
+			}
+		}
+		`,
+	}}
+
+	for i, tc := range testCases {
+		src := strings.TrimSpace(decl) + "\n" + strings.TrimSpace(tc.src) + "\n"
+		if tc.pragma {
+			src = "pragma taint required\n" + src
+		} else {
+			src = "\n" + src
+		}
+
+		_, err := checkSourceWith(src, nil, nil)
+		compareCheckErr(tt, i, err, tc.wantErr)
 	}
 }
@@ -0,0 +1,306 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file implements a congruence (modular arithmetic) domain, alongside the
+// interval domain (the bounds type). It lets the prover use facts like "x % 4
+// == 0" to verify alignment-based fast paths, such as proving "x + 4 <= n"
+// from "x < n" when both x and n are multiples of 4.
+
+import (
+	"math/big"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// maxCongruenceDepth bounds how often congruenceOf recurses, as it can follow
+// facts (such as "x == y + 4") as well as sub-expressions.
+const maxCongruenceDepth = 8
+
+// congruence means that an integer x satisfies "x ≡ r (mod m)". The modulus
+// m is non-negative. A zero m means that x is exactly r. A one m means that
+// nothing is known. Otherwise, r is in the range [0, m).
+type congruence struct {
+	m *big.Int
+	r *big.Int
+}
+
+var congruenceUnknown = congruence{one, zero}
+
+func newCongruence(m *big.Int, r *big.Int) congruence {
+	if m.Sign() == 0 {
+		return congruence{m, r}
+	}
+	return congruence{m, big.NewInt(0).Mod(r, m)}
+}
+
+func (c congruence) exact() bool { return c.m.Sign() == 0 }
+
+// contains returns whether v satisfies c.
+func (c congruence) contains(v *big.Int) bool {
+	if c.exact() {
+		return c.r.Cmp(v) == 0
+	}
+	return big.NewInt(0).Mod(v, c.m).Cmp(c.r) == 0
+}
+
+// meet returns a congruence satisfied by anything that satisfies both c and
+// d. It prefers the more precise one, but it does not apply the Chinese
+// remainder theorem in general.
+func (c congruence) meet(d congruence) congruence {
+	switch {
+	case c.exact():
+		return c
+	case d.exact():
+		return d
+	case big.NewInt(0).Mod(d.m, c.m).Sign() == 0:
+		return d
+	case big.NewInt(0).Mod(c.m, d.m).Sign() == 0:
+		return c
+	case d.m.Cmp(c.m) > 0:
+		return d
+	}
+	return c
+}
+
+func (c congruence) add(d congruence) congruence {
+	return newCongruence(gcd(c.m, d.m), big.NewInt(0).Add(c.r, d.r))
+}
+
+func (c congruence) sub(d congruence) congruence {
+	return newCongruence(gcd(c.m, d.m), big.NewInt(0).Sub(c.r, d.r))
+}
+
+// mul uses "(r + m*i) * (s + n*j) = r*s + r*n*j + s*m*i + m*n*i*j".
+func (c congruence) mul(d congruence) congruence {
+	m := gcd(big.NewInt(0).Mul(c.r, d.m), big.NewInt(0).Mul(d.r, c.m))
+	m = gcd(m, big.NewInt(0).Mul(c.m, d.m))
+	return newCongruence(m, big.NewInt(0).Mul(c.r, d.r))
+}
+
+// powerOf2Modulus returns the largest j such that 2**j divides c.m, capped at
+// maxBits (for the exact case, where c.m is zero).
+func (c congruence) powerOf2Modulus(maxBits int) int {
+	if c.exact() {
+		return maxBits
+	}
+	j := int(c.m.TrailingZeroBits())
+	if j > maxBits {
+		j = maxBits
+	}
+	return j
+}
+
+// gcd returns the greatest common divisor of |x| and |y|, where gcd(0, y) is
+// |y|.
+func gcd(x *big.Int, y *big.Int) *big.Int {
+	if x.Sign() == 0 {
+		return big.NewInt(0).Abs(y)
+	}
+	if y.Sign() == 0 {
+		return big.NewInt(0).Abs(x)
+	}
+	return big.NewInt(0).GCD(nil, nil, big.NewInt(0).Abs(x), big.NewInt(0).Abs(y))
+}
+
+// congruenceOf returns what is known about n modulo some m, based on n's
+// sub-expressions and on facts like "n % 8 == 0", "(n & 3) == 1" or "n ==
+// etc".
+func (q *checker) congruenceOf(n *a.Expr, depth uint32) congruence {
+	if cv := n.ConstValue(); cv != nil {
+		return congruence{zero, cv}
+	}
+	if depth >= maxCongruenceDepth {
+		return congruenceUnknown
+	}
+	depth++
+
+	c := q.congruenceOfOperator(n, depth)
+	if c.exact() {
+		return c
+	}
+
+	for _, x := range q.facts.exprs() {
+		if x.Operator() != t.IDXBinaryEqEq {
+			continue
+		}
+		for i := 0; i < 2; i++ {
+			lhs, rhs := x.LHS().AsExpr(), x.RHS().AsExpr()
+			if i != 0 {
+				lhs, rhs = rhs, lhs
+			}
+
+			if lhs.Eq(n) {
+				if !rhs.Eq(n) {
+					c = c.meet(q.congruenceOf(rhs, depth))
+				}
+				continue
+			}
+
+			// Look for "n % k == r" or "(n & (k - 1)) == r", where k is a
+			// power of 2 for the latter.
+			r := rhs.ConstValue()
+			if (r == nil) || (r.Sign() < 0) {
+				continue
+			}
+			op, p, k := parseBinaryOp(lhs)
+			if (k == nil) || !p.Eq(n) {
+				continue
+			}
+			kcv := k.ConstValue()
+			if (kcv == nil) || (kcv.Sign() <= 0) {
+				continue
+			}
+			switch op {
+			case t.IDXBinaryPercent:
+				if r.Cmp(kcv) < 0 {
+					c = c.meet(newCongruence(kcv, r))
+				}
+			case t.IDXBinaryAmp:
+				if m := big.NewInt(0).Add(kcv, one); (m.BitLen() == int(m.TrailingZeroBits())+1) &&
+					(r.Cmp(m) < 0) {
+					c = c.meet(newCongruence(m, r))
+				}
+			}
+		}
+	}
+	return c
+}
+
+func (q *checker) congruenceOfOperator(n *a.Expr, depth uint32) congruence {
+	op, lhs, rhs := parseBinaryOp(n)
+	if lhs == nil {
+		return congruenceUnknown
+	}
+
+	switch op {
+	case t.IDXBinaryPlus:
+		return q.congruenceOf(lhs, depth).add(q.congruenceOf(rhs, depth))
+
+	case t.IDXBinaryMinus:
+		return q.congruenceOf(lhs, depth).sub(q.congruenceOf(rhs, depth))
+
+	case t.IDXBinaryStar:
+		return q.congruenceOf(lhs, depth).mul(q.congruenceOf(rhs, depth))
+
+	case t.IDXBinaryShiftL:
+		if s := rhs.ConstValue(); (s != nil) && (s.Sign() >= 0) && s.IsUint64() && (s.Uint64() < 256) {
+			p := big.NewInt(0).Lsh(one, uint(s.Uint64()))
+			return q.congruenceOf(lhs, depth).mul(congruence{zero, p})
+		}
+
+	case t.IDXBinaryPercent:
+		// The bounds checker has already proven that lhs is non-negative and
+		// that rhs is positive. For "lhs ≡ r (mod m)" and a constant rhs k,
+		// "lhs % k" (which is "lhs - (k * etc)") is congruent to r modulo
+		// gcd(m, k), and is exactly "r % k" if k divides m.
+		k := rhs.ConstValue()
+		if (k == nil) || (k.Sign() <= 0) {
+			break
+		}
+		c := q.congruenceOf(lhs, depth)
+		if c.exact() || (big.NewInt(0).Mod(c.m, k).Sign() == 0) {
+			return congruence{zero, big.NewInt(0).Mod(c.r, k)}
+		}
+		return newCongruence(gcd(c.m, k), c.r)
+
+	case t.IDXBinaryAmp:
+		// Bitwise operands are never negative. For a constant mask k, the low
+		// bits of "lhs & k" are known where either k's bit is zero or lhs's
+		// bit is known (modulo 2**j).
+		k, other := rhs.ConstValue(), lhs
+		if k == nil {
+			k, other = lhs.ConstValue(), rhs
+		}
+		if (k == nil) || (k.Sign() < 0) {
+			break
+		}
+		c := q.congruenceOf(other, depth)
+		j := c.powerOf2Modulus(k.BitLen())
+		lowBits := big.NewInt(0).And(c.r, bitMask(j))
+		known := j
+		for (known < k.BitLen()) && (k.Bit(known) == 0) {
+			known++
+		}
+		if known >= k.BitLen() {
+			return congruence{zero, big.NewInt(0).And(lowBits, k)}
+		}
+		return newCongruence(big.NewInt(0).Lsh(one, uint(known)), big.NewInt(0).And(lowBits, k))
+	}
+	return congruenceUnknown
+}
+
+// proveCongruence proves "lhs op rhs" using the congruence domain. It handles:
+//   - "lhs == r" and "lhs != r", for a constant r, where lhs (e.g. "x % 4")
+//     is known modulo some m.
+//   - "p + c <= b" and "p + c < b", for a constant c, given a fact "p < b" or
+//     "p <= b". If "b - p" is known modulo m, its smallest possible value
+//     (which is at least 1 or 0 respectively) is what c is compared to. For
+//     example, if x and n are both multiples of 4 and "x < n" then "x + 4 <=
+//     n".
+func (q *checker) proveCongruence(op t.ID, lhs *a.Expr, rhs *a.Expr) bool {
+	switch op {
+	case t.IDXBinaryEqEq, t.IDXBinaryNotEq:
+		r := rhs.ConstValue()
+		if r == nil {
+			return false
+		}
+		c := q.congruenceOf(lhs, 0)
+		if op == t.IDXBinaryEqEq {
+			return c.exact() && (c.r.Cmp(r) == 0)
+		}
+		return !c.contains(r)
+
+	case t.IDXBinaryLessEq, t.IDXBinaryLessThan:
+		// Split lhs into "p + c".
+		p, c := lhs, zero
+		if lOp, lLHS, lRHS := parseBinaryOp(lhs); lOp == t.IDXBinaryPlus {
+			if cv := lRHS.ConstValue(); cv != nil {
+				p, c = lLHS, cv
+			}
+		}
+		if op == t.IDXBinaryLessThan {
+			c = big.NewInt(0).Add(c, one)
+		}
+
+		for _, x := range q.facts.about(p) {
+			factOp, other := otherHandSide(x, p)
+			if (factOp != t.IDXBinaryLessThan) && (factOp != t.IDXBinaryLessEq) {
+				continue
+			} else if !other.Eq(rhs) {
+				continue
+			}
+
+			// diff is "rhs - p", which the fact says is at least minDiff.
+			diff := q.congruenceOf(rhs, 0).sub(q.congruenceOf(p, 0))
+			minDiff := zero
+			if factOp == t.IDXBinaryLessThan {
+				minDiff = one
+			}
+			if diff.exact() {
+				minDiff = diff.r
+			} else if diff.r.Cmp(minDiff) < 0 {
+				minDiff = big.NewInt(0).Add(diff.r, diff.m)
+			} else {
+				minDiff = diff.r
+			}
+			if c.Cmp(minDiff) <= 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,235 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file deals with function contracts: the pre, inv and post conditions
+// on a function declaration, such as:
+//
+//   pri func foo(x : base.u32) base.u32,
+//       pre args.x < 100,
+//       post result <= 200,
+//   {
+//       return args.x * 2
+//   }
+//
+// Pre conditions are proven at every call site (after substituting the call's
+// arguments for "args.etc") and assumed on entry to the function body. Post
+// conditions are proven at every return (after substituting the returned
+// value for "result") and, at call sites like "y = foo(x: z)", become facts
+// about y after the call returns. An inv condition is both a pre and a post
+// condition.
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+var exprResult = a.NewExpr(0, 0, t.IDResult, nil, nil, nil, nil)
+
+// substituteContract returns a copy of n with every "args.foo" replaced by a
+// copy of args[foo] and every "result" replaced by a copy of result. A nil
+// result, or a foo key missing from args, means to leave those
+// sub-expressions as is.
+func substituteContract(n *a.Expr, args map[t.ID]*a.Expr, result *a.Expr) *a.Expr {
+	return n.Substitute(func(x *a.Expr) *a.Expr {
+		if foo := x.IsArgsDotFoo(); foo != 0 {
+			if v, ok := args[foo]; ok {
+				return v.Substitute(nil)
+			}
+		}
+		if (x.Operator() == 0) && (x.Ident() == t.IDResult) && (result != nil) {
+			return result.Substitute(nil)
+		}
+		return nil
+	})
+}
+
+// substituteContractAssert is like substituteContract, but for an assertion
+// and its reason arguments.
+func substituteContractAssert(n *a.Assert, args map[t.ID]*a.Expr, result *a.Expr) *a.Assert {
+	reasonArgs := []*a.Node(nil)
+	for _, o := range n.Args() {
+		o := o.AsArg()
+		reasonArgs = append(reasonArgs, a.NewArg(o.Name(), substituteContract(o.Value(), args, result)).AsNode())
+	}
+	return a.NewAssert(t.IDAssert, substituteContract(n.Condition(), args, result), n.Reason(), reasonArgs)
+}
+
+// mentionsResult returns whether n, or its reason arguments, mention "result".
+func mentionsResult(n *a.Assert) bool {
+	if n.Condition().Mentions(exprResult) {
+		return true
+	}
+	for _, o := range n.Args() {
+		if o.AsArg().Value().Mentions(exprResult) {
+			return true
+		}
+	}
+	return false
+}
+
+// callArgs maps a call's argument names to their (pure) values. It returns
+// nil if any argument value is impure.
+func callArgs(call *a.Expr) map[t.ID]*a.Expr {
+	ret := map[t.ID]*a.Expr{}
+	for _, o := range call.Args() {
+		o := o.AsArg()
+		if !o.Value().Effect().Pure() {
+			return nil
+		}
+		ret[o.Name()] = o.Value()
+	}
+	return ret
+}
+
+// mentionsChangeableArg returns whether n mentions an "args.foo" whose call
+// argument value, args[foo], an impure call could change. Substituting such a
+// value into a post condition would make a fact about its new value, when the
+// callee's post condition was about its old one.
+func mentionsChangeableArg(n *a.Expr, args map[t.ID]*a.Expr) bool {
+	for foo, v := range args {
+		if !unchangeableByCall(v) && n.Mentions(a.NewExpr(0, t.IDDot, foo, exprArgs.AsNode(), nil, nil, nil)) {
+			return true
+		}
+	}
+	return false
+}
+
+// unchangeableByCall returns whether v, a call argument value, reads the same
+// after an impure call as before it: a constant, or something that reads only
+// local variables and arguments passed by value. Anything that reads "this",
+// a pointer or a slice's contents could be changed by the callee.
+func unchangeableByCall(v *a.Expr) bool {
+	if v.ConstValue() != nil {
+		return true
+	} else if v.Mentions(exprThis) {
+		return false
+	}
+	ok := true
+	v.AsNode().Walk(func(o *a.Node) error {
+		if o.Kind() != a.KExpr {
+			return nil
+		}
+		x := o.AsExpr()
+		if typ := x.MType(); (typ != nil) && typ.IsPointerType() {
+			ok = false
+		} else if arr, _, isIndex := x.IsIndex(); isIndex && !arr.MType().IsArrayType() {
+			ok = false
+		}
+		return nil
+	})
+	return ok
+}
+
+// assumeFuncPreConditions adds the current function's pre (and inv)
+// conditions to the facts.
+func (q *checker) assumeFuncPreConditions() {
+	for _, o := range q.astFunc.Asserts() {
+		if o := o.AsAssert(); (o.Keyword() == t.IDPre) || (o.Keyword() == t.IDInv) {
+			q.facts.appendFact(o.Condition())
+		}
+	}
+}
+
+// bcheckFuncPostConditions proves the current function's post (and inv)
+// conditions when it returns value, which may be nil for the implicit return
+// at the end of a function body.
+func (q *checker) bcheckFuncPostConditions(value *a.Expr) error {
+	for _, o := range q.astFunc.Asserts() {
+		o := o.AsAssert()
+		if (o.Keyword() != t.IDPost) && (o.Keyword() != t.IDInv) {
+			continue
+		} else if _, ok := monotoneParam(q.tm, o); ok {
+			continue
+		}
+		if mentionsResult(o) && ((value == nil) || !value.Effect().Pure()) {
+			return fmt.Errorf("check: cannot prove post-condition %q: the return value is not pure",
+				o.Condition().Str(q.tm))
+		}
+		if err := q.bcheckAssertCondition(substituteContractAssert(o, nil, value)); err != nil {
+			return fmt.Errorf("%v (for the post-condition %q)", err, o.Condition().Str(q.tm))
+		}
+	}
+	return nil
+}
+
+// bcheckCallPreConditions proves the pre (and inv) conditions of f, the
+// function called by the call expression.
+func (q *checker) bcheckCallPreConditions(f *a.Func, call *a.Expr) error {
+	args := (map[t.ID]*a.Expr)(nil)
+	for _, o := range f.Asserts() {
+		o := o.AsAssert()
+		if (o.Keyword() != t.IDPre) && (o.Keyword() != t.IDInv) {
+			continue
+		}
+		if args == nil {
+			if args = callArgs(call); args == nil {
+				return fmt.Errorf("check: cannot prove %s pre-condition %q: an argument is not pure",
+					f.QQID().Str(q.tm), o.Condition().Str(q.tm))
+			}
+		}
+		if err := q.bcheckAssertCondition(substituteContractAssert(o, args, nil)); err != nil {
+			return fmt.Errorf("%v (for the %s pre-condition %q)", err, f.QQID().Str(q.tm), o.Condition().Str(q.tm))
+		}
+	}
+	return nil
+}
+
+// appendCallPostConditions adds the post (and inv) conditions of the function
+// called by rhs to the facts, after "lhs = rhs" was evaluated.
+func (q *checker) appendCallPostConditions(lhs *a.Expr, rhs *a.Expr) error {
+	if rhs.Operator() != a.ExprOperatorCall {
+		return nil
+	}
+	lTyp := rhs.LHS().AsExpr().MType()
+	if !lTyp.IsFuncType() {
+		return nil
+	}
+	f, err := q.c.resolveFunc(lTyp)
+	if err != nil {
+		return err
+	}
+
+	args := (map[t.ID]*a.Expr)(nil)
+	for _, o := range f.Asserts() {
+		o := o.AsAssert()
+		if (o.Keyword() != t.IDPost) && (o.Keyword() != t.IDInv) {
+			continue
+		} else if _, ok := monotoneParam(q.tm, o); ok {
+			continue
+		}
+		if args == nil {
+			if args = callArgs(rhs); args == nil {
+				return nil
+			}
+			// Facts about an argument that mentions lhs would be about lhs'
+			// old value, not its new one.
+			for _, v := range args {
+				if (lhs != nil) && v.Mentions(lhs) {
+					return nil
+				}
+			}
+		}
+		if (lhs == nil) && mentionsResult(o) {
+			continue
+		} else if rhs.Effect().Impure() && mentionsChangeableArg(o.Condition(), args) {
+			continue
+		}
+		q.facts.appendFact(substituteContract(o.Condition(), args, lhs))
+	}
+	return nil
+}
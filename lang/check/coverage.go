@@ -0,0 +1,235 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file reports assertion coverage: which of a function body's assert
+// statements are needed by later proofs. An assert is needed if bounds
+// checking the function body fails without it, neither proving its condition
+// nor adding that condition to the facts.
+//
+// Leaving one assert out at a time means that two asserts that each imply the
+// other are both reported as not needed, even though removing both would fail.
+// Pruning asserts should therefore be done one at a time, re-checking after
+// each.
+//
+// Only assert statements are covered. While loops' pre, inv and post
+// conditions, and functions' contracts, are not optional in the same way.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// AssertCoverage is whether an assert statement is needed by later proofs.
+type AssertCoverage struct {
+	Filename string
+	Line     uint32
+
+	// Func is the function's name, such as "decoder.decode_frame".
+	Func string
+
+	// Assert is the assert's condition, such as "n < 256".
+	Assert string
+
+	Needed bool
+}
+
+func (v *AssertCoverage) String() string {
+	needed := "is needed"
+	if !v.Needed {
+		needed = "is not needed"
+	}
+	return fmt.Sprintf("check: assert %q in %s %s at %s:%d",
+		v.Assert, v.Func, needed, v.Filename, v.Line)
+}
+
+// AssertCoverage returns the assert statements' coverage, if
+// Options.AssertCoverage was set, sorted by filename and line.
+func (c *Checker) AssertCoverage() []*AssertCoverage {
+	ret := append([]*AssertCoverage(nil), c.assertCoverage...)
+	sort.SliceStable(ret, func(i int, j int) bool {
+		if ret[i].Filename != ret[j].Filename {
+			return ret[i].Filename < ret[j].Filename
+		}
+		return ret[i].Line < ret[j].Line
+	})
+	return ret
+}
+
+// AssertCoverageSummary counts a package's needed and not needed assert
+// statements, in total and per function.
+type AssertCoverageSummary struct {
+	Needed    int
+	NotNeeded int
+
+	// Funcs are the per-function counts, sorted by function name.
+	Funcs []AssertCoverageFuncSummary
+}
+
+// AssertCoverageFuncSummary counts one function's needed and not needed
+// assert statements.
+type AssertCoverageFuncSummary struct {
+	Func      string
+	Needed    int
+	NotNeeded int
+}
+
+// SummarizeAssertCoverage summarizes vs, the result of the
+// Checker.AssertCoverage method.
+func SummarizeAssertCoverage(vs []*AssertCoverage) *AssertCoverageSummary {
+	ret := &AssertCoverageSummary{}
+	indexes := map[string]int{}
+	for _, v := range vs {
+		i, ok := indexes[v.Func]
+		if !ok {
+			i = len(ret.Funcs)
+			indexes[v.Func] = i
+			ret.Funcs = append(ret.Funcs, AssertCoverageFuncSummary{Func: v.Func})
+		}
+		if v.Needed {
+			ret.Needed++
+			ret.Funcs[i].Needed++
+		} else {
+			ret.NotNeeded++
+			ret.Funcs[i].NotNeeded++
+		}
+	}
+	sort.Slice(ret.Funcs, func(i int, j int) bool {
+		return ret.Funcs[i].Func < ret.Funcs[j].Func
+	})
+	return ret
+}
+
+// String returns a multi-line report: the totals and then, for every function
+// that has a not needed assert, that function's counts. Those functions are
+// the ones to look at when pruning asserts, such as after the prover improves.
+func (s *AssertCoverageSummary) String() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%d of %d asserts needed, %d not needed\n",
+		s.Needed, s.Needed+s.NotNeeded, s.NotNeeded)
+	for _, f := range s.Funcs {
+		if f.NotNeeded > 0 {
+			fmt.Fprintf(b, "\t%s: %d of %d asserts needed, %d not needed\n",
+				f.Func, f.Needed, f.Needed+f.NotNeeded, f.NotNeeded)
+		}
+	}
+	return b.String()
+}
+
+// boundedExprs returns the expressions in n's body whose MBounds are already
+// set before bounds checking, such as constants.
+func boundedExprs(n *a.Func) map[*a.Node]bool {
+	return boundedExprsIn(n.Body())
+}
+
+func boundedExprsIn(block []*a.Node) map[*a.Node]bool {
+	ret := map[*a.Node]bool{}
+	for _, o := range block {
+		o.Walk(func(o *a.Node) error {
+			if (o.Kind() == a.KExpr) && (o.MBounds()[0] != nil) {
+				ret[o] = true
+			}
+			return nil
+		})
+	}
+	return ret
+}
+
+// dropCachedMBounds undoes bounds checking n's body, other than for constants
+// and the bounded expressions. Like a.Assert.DropExprCachedMBounds, it leaves
+// constants be, as their bounds cannot change. Bounds checking an expression with cached MBounds is a
+// no-op, which would otherwise skip e.g. a method call's effect on the facts.
+func dropCachedMBounds(n *a.Func, bounded map[*a.Node]bool) {
+	dropCachedMBoundsIn(n.Body(), bounded)
+}
+
+func dropCachedMBoundsIn(block []*a.Node, bounded map[*a.Node]bool) {
+	for _, o := range block {
+		o.Walk(func(o *a.Node) error {
+			if (o.Kind() == a.KExpr) && (o.AsExpr().ConstValue() == nil) && !bounded[o] {
+				o.SetMBounds(bounds{})
+			}
+			return nil
+		})
+	}
+}
+
+// checkAssertCoverage re-checks n's body, which has already been bounds
+// checked successfully, once per assert statement, leaving that assert out.
+// Finally, it re-checks n's body with every assert, so that the expressions'
+// MBounds are as if the assert coverage was never checked.
+//
+// The bounded argument is the boundedExprs(n) from before the first check.
+func (c *Checker) checkAssertCoverage(q *checker, n *a.Func, bounded map[*a.Node]bool) error {
+	asserts := []*a.Assert(nil)
+	for _, o := range n.Body() {
+		o.Walk(func(o *a.Node) error {
+			if (o.Kind() == a.KAssert) && (o.AsAssert().Keyword() == t.IDAssert) {
+				asserts = append(asserts, o.AsAssert())
+			}
+			return nil
+		})
+	}
+	if len(asserts) == 0 {
+		return nil
+	}
+
+	// The re-checks should not suggest, explain, answer queries, trace facts
+	// or warn about anything.
+	suggester, explainer, query, trackFacts, factTracer, funcWarnings :=
+		c.suggester, c.explainer, c.query, c.trackFacts, c.factTracer, c.funcWarnings
+	c.suggester, c.explainer, c.query, c.trackFacts, c.factTracer = nil, nil, nil, false, nil
+	defer func() {
+		c.suggester, c.explainer, c.query, c.trackFacts, c.factTracer, c.funcWarnings =
+			suggester, explainer, query, trackFacts, factTracer, funcWarnings
+	}()
+
+	funcName := n.FuncName().Str(c.tm)
+	if r := n.Receiver(); r[1] != 0 {
+		funcName = r[1].Str(c.tm) + "." + funcName
+	}
+	for _, o := range asserts {
+		q1 := q.clone()
+		q1.omittedAssert = o
+		dropCachedMBounds(n, bounded)
+		err := c.checkFuncBodyBounds(q1, n)
+		filename, line := o.AsNode().AsRaw().FilenameLine()
+		c.assertCoverage = append(c.assertCoverage, &AssertCoverage{
+			Filename: filename,
+			Line:     line,
+			Func:     funcName,
+			Assert:   o.Condition().Str(c.tm),
+			Needed:   err != nil,
+		})
+	}
+	dropCachedMBounds(n, bounded)
+	return c.checkFuncBodyBounds(q.clone(), n)
+}
+
+// clone returns a fresh checker for the same function as q, for bounds
+// checking its (already type checked) body again.
+func (q *checker) clone() *checker {
+	return &checker{
+		c:         q.c,
+		tm:        q.tm,
+		reasonMap: q.reasonMap,
+		astFunc:   q.astFunc,
+		localVars: q.localVars,
+	}
+}
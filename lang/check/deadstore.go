@@ -0,0 +1,459 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file deals with dead stores: assignments to local variables whose
+// values are never observed. Such stores are not errors, but they are often
+// left behind after refactoring a decode loop, so they are reported as
+// warnings.
+//
+// There are two complementary analyses. The first (see warnRedundantStore)
+// runs during bounds checking and uses the facts: "x = y" is redundant if the
+// facts already prove that "x == y". The second (see findDeadStores) runs
+// after bounds checking, as a forward dataflow pass over the function body.
+// It tracks, for each local variable, the set of pending stores: those
+// assignments whose value might still be read. A read of a variable marks its
+// pending stores as observed. A plain "x = etc" assignment replaces x's
+// pending stores. Reconciling multiple code paths takes the union, and loops
+// are repeated until a steady state is reached, similar to the liveness
+// analysis in the C code generator.
+//
+// Only numeric and boolean local variables are tracked, and only stores whose
+// right hand side is pure are reported: dropping an impure expression would
+// also drop its side effects.
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Warning is a suspicious construct, such as a dead store, that is not an
+// error. Unlike an Error, it does not stop checking.
+type Warning struct {
+	Err      error
+	Filename string
+	Line     uint32
+
+	// Column and EndColumn are as for Error.
+	Column    uint32
+	EndColumn uint32
+}
+
+func (w *Warning) String() string {
+	return fmt.Sprintf("%s at %s", w.Err, position(w.Filename, w.Line, w.Column))
+}
+
+func (c *Checker) warn(n *a.Node, err error) {
+	filename, line := n.AsRaw().FilenameLine()
+	if c.strictnesses[filename] == strictnessLegacy {
+		return
+	}
+	column, endColumn := spanColumns(n.AsRaw().Span())
+	c.funcWarnings = append(c.funcWarnings, &Warning{
+		Err:       err,
+		Filename:  filename,
+		Line:      line,
+		Column:    column,
+		EndColumn: endColumn,
+	})
+}
+
+// deadStoreTrackable returns whether the dead store analyses apply to a local
+// variable of the given type.
+func deadStoreTrackable(typ *a.TypeExpr) bool {
+	return (typ != nil) && (typ.IsNumType() || typ.IsBool())
+}
+
+// warnRedundantStore warns if the facts already imply that n's LHS equals its
+// RHS, so that the assignment has no effect.
+func (q *checker) warnRedundantStore(n *a.Assign) {
+	lhs, rhs := n.LHS(), n.RHS()
+	if (n.Operator() != t.IDEq) || (lhs == nil) || (lhs.Operator() != 0) || !rhs.Effect().Pure() {
+		return
+	}
+	if !q.isLocalVar(lhs.Ident()) || !deadStoreTrackable(lhs.MType()) {
+		return
+	}
+	for _, x := range q.facts.exprs() {
+		if x.Operator() != t.IDXBinaryEqEq {
+			continue
+		}
+		xLHS, xRHS := x.LHS().AsExpr(), x.RHS().AsExpr()
+		if (xLHS.Eq(lhs) && xRHS.Eq(rhs)) || (xLHS.Eq(rhs) && xRHS.Eq(lhs)) {
+			q.c.warn(n.AsNode(), fmt.Errorf("check: redundant assignment to %q: the facts already imply %q",
+				lhs.Str(q.tm), x.Str(q.tm)))
+			return
+		}
+	}
+}
+
+// isLocalVar returns whether name is a local variable declared by a "var"
+// statement, as opposed to an implicit one like "args" or "this".
+func (q *checker) isLocalVar(name t.ID) bool {
+	if (q.astFunc == nil) || (name == t.IDArgs) || (name == t.IDThis) || (name == t.IDCoroutineResumed) {
+		return false
+	}
+	_, ok := q.localVars[name]
+	return ok
+}
+
+// pendingStores maps from a local variable to the stores whose value might
+// still be read. A nil pendingStores means that the code is unreachable, e.g.
+// after a return or break.
+type pendingStores map[t.ID][]*a.Assign
+
+func (p pendingStores) clone() pendingStores {
+	if p == nil {
+		return nil
+	}
+	ret := make(pendingStores, len(p))
+	for k, v := range p {
+		ret[k] = append([]*a.Assign(nil), v...)
+	}
+	return ret
+}
+
+// reconcile returns the union of p and s, and whether that union differs from
+// p.
+func (p pendingStores) reconcile(s pendingStores) (ret pendingStores, changed bool) {
+	if s == nil {
+		return p, false
+	} else if p == nil {
+		return s.clone(), true
+	}
+	for k, v := range s {
+	outer:
+		for _, x := range v {
+			for _, y := range p[k] {
+				if x == y {
+					continue outer
+				}
+			}
+			p[k] = append(p[k], x)
+			changed = true
+		}
+	}
+	return p, changed
+}
+
+type loopPendingStores struct {
+	breaks    pendingStores
+	continues pendingStores
+}
+
+type deadStoreHelper struct {
+	tm       *t.Map
+	vars     map[t.ID]bool
+	loops    map[a.Loop]*loopPendingStores
+	visited  []*a.Assign
+	observed map[*a.Assign]bool
+}
+
+func (c *Checker) findDeadStores(f *a.Func, localVars typeMap) error {
+	h := &deadStoreHelper{
+		tm:       c.tm,
+		vars:     map[t.ID]bool{},
+		loops:    map[a.Loop]*loopPendingStores{},
+		observed: map[*a.Assign]bool{},
+	}
+	for _, o := range f.Body() {
+		if o.Kind() != a.KVar {
+			break
+		}
+		if name := o.AsVar().Name(); deadStoreTrackable(localVars[name]) {
+			h.vars[name] = true
+		}
+	}
+	if len(h.vars) == 0 {
+		return nil
+	}
+
+	if _, err := h.doBlock(pendingStores{}, f.Body(), 0); err != nil {
+		return err
+	}
+
+	for _, o := range h.visited {
+		if !h.observed[o] {
+			c.warn(o.AsNode(), fmt.Errorf("check: value assigned to %q is never used",
+				o.LHS().Ident().Str(c.tm)))
+		}
+	}
+	return nil
+}
+
+func (h *deadStoreHelper) doBlock(p pendingStores, block []*a.Node, depth uint32) (pendingStores, error) {
+	if depth > a.MaxBodyDepth {
+		return nil, fmt.Errorf("check: body recursion depth too large")
+	}
+	depth++
+
+	for _, o := range block {
+		if p == nil {
+			break
+		}
+		err := error(nil)
+		switch o.Kind() {
+		case a.KAssert:
+			err = h.doAssert(p, o.AsAssert())
+
+		case a.KAssign:
+			err = h.doAssign(p, o.AsAssign(), true)
+
+		case a.KExpr:
+			err = h.doExpr(p, o.AsExpr(), 0)
+
+		case a.KIOBind:
+			o := o.AsIOBind()
+			if err = h.doExpr(p, o.IO(), 0); err != nil {
+				break
+			}
+			if err = h.doExpr(p, o.Arg1(), 0); err != nil {
+				break
+			}
+			p, err = h.doBlock(p, o.Body(), depth)
+
+		case a.KIf:
+			p, err = h.doIf(p, o.AsIf(), depth)
+
+		case a.KIterate:
+			p, err = h.doIterate(p, o.AsIterate(), depth)
+
+		case a.KJump:
+			err = h.doJump(p, o.AsJump())
+			p = nil
+
+		case a.KRet:
+			o := o.AsRet()
+			if err = h.doExpr(p, o.Value(), 0); err != nil {
+				break
+			}
+			if o.Keyword() == t.IDReturn {
+				p = nil
+			}
+
+		case a.KWhile:
+			p, err = h.doWhile(p, o.AsWhile(), depth)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (h *deadStoreHelper) doAssert(p pendingStores, n *a.Assert) error {
+	if err := h.doExpr(p, n.Condition(), 0); err != nil {
+		return err
+	}
+	for _, o := range n.Args() {
+		if err := h.doExpr(p, o.AsArg().Value(), 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *deadStoreHelper) doAssign(p pendingStores, n *a.Assign, reportable bool) error {
+	if err := h.doExpr(p, n.RHS(), 0); err != nil {
+		return err
+	}
+
+	lhs := n.LHS()
+	if lhs == nil {
+		return nil
+	}
+
+	// If the LHS is not a local variable (e.g. "this.foo[bar] = etc"), or if
+	// the LHS is implicitly also on the RHS (e.g. for a += or *= operator),
+	// walk the LHS Expr.
+	if lhs.Operator() != 0 || (n.Operator() != t.IDEq && n.Operator() != t.IDEqQuestion) {
+		if err := h.doExpr(p, lhs, 0); err != nil {
+			return err
+		}
+	}
+
+	if (lhs.Operator() == 0) && h.vars[lhs.Ident()] {
+		if reportable && n.RHS().Effect().Pure() {
+			p[lhs.Ident()] = []*a.Assign{n}
+			h.visit(n)
+		} else {
+			delete(p, lhs.Ident())
+		}
+	}
+	return nil
+}
+
+func (h *deadStoreHelper) visit(n *a.Assign) {
+	for _, o := range h.visited {
+		if o == n {
+			return
+		}
+	}
+	h.visited = append(h.visited, n)
+}
+
+func (h *deadStoreHelper) doExpr(p pendingStores, n *a.Expr, depth uint32) error {
+	if n == nil {
+		return nil
+	}
+	if depth > a.MaxExprDepth {
+		return fmt.Errorf("check: expression recursion depth too large")
+	}
+	depth++
+
+	for _, o := range n.AsNode().AsRaw().SubNodes() {
+		if o != nil && o.Kind() == a.KExpr {
+			if err := h.doExpr(p, o.AsExpr(), depth); err != nil {
+				return err
+			}
+		}
+	}
+	for _, o := range n.Args() {
+		e := (*a.Expr)(nil)
+		switch o.Kind() {
+		case a.KArg:
+			e = o.AsArg().Value()
+		case a.KExpr:
+			e = o.AsExpr()
+		default:
+			return fmt.Errorf("check: unrecognized arg kind")
+		}
+		if err := h.doExpr(p, e, depth); err != nil {
+			return err
+		}
+	}
+
+	if (n.Operator() == 0) && h.vars[n.Ident()] {
+		for _, o := range p[n.Ident()] {
+			h.observed[o] = true
+		}
+	}
+	return nil
+}
+
+func (h *deadStoreHelper) doIf(p pendingStores, n *a.If, depth uint32) (pendingStores, error) {
+	if err := h.doExpr(p, n.Condition(), 0); err != nil {
+		return nil, err
+	}
+
+	ifTrue, err := h.doBlock(p.clone(), n.BodyIfTrue(), depth)
+	if err != nil {
+		return nil, err
+	}
+
+	ifFalse := pendingStores(nil)
+	if n.ElseIf() != nil {
+		ifFalse, err = h.doIf(p, n.ElseIf(), depth)
+	} else {
+		ifFalse, err = h.doBlock(p, n.BodyIfFalse(), depth)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ret, _ := ifFalse.reconcile(ifTrue)
+	return ret, nil
+}
+
+func (h *deadStoreHelper) doIterate(p pendingStores, n *a.Iterate, depth uint32) (pendingStores, error) {
+	for _, o := range n.Assigns() {
+		if err := h.doAssign(p, o.AsAssign(), false); err != nil {
+			return nil, err
+		}
+	}
+
+	// Every round of an iterate loop, including the else-iterate rounds, runs
+	// its body zero or more times.
+	ret := pendingStores(nil)
+	for ; n != nil; n = n.ElseIterate() {
+		before := p.clone()
+		for _, o := range n.Asserts() {
+			if err := h.doAssert(before, o.AsAssert()); err != nil {
+				return nil, err
+			}
+		}
+		l := &loopPendingStores{}
+		h.loops[n] = l
+		for changed := true; changed; {
+			r, err := h.doBlock(before.clone(), n.Body(), depth)
+			if err != nil {
+				return nil, err
+			}
+			r, _ = r.reconcile(l.continues)
+			before, changed = before.reconcile(r)
+		}
+		ret, _ = ret.reconcile(before)
+		ret, _ = ret.reconcile(l.breaks)
+	}
+	return ret, nil
+}
+
+func (h *deadStoreHelper) doJump(p pendingStores, n *a.Jump) error {
+	l := h.loops[n.JumpTarget()]
+	if l == nil {
+		return fmt.Errorf("check: unrecognized jump target")
+	}
+	switch n.Keyword() {
+	case t.IDBreak:
+		l.breaks, _ = l.breaks.reconcile(p)
+	case t.IDContinue:
+		l.continues, _ = l.continues.reconcile(p)
+	default:
+		return fmt.Errorf("check: unrecognized ast.Jump keyword")
+	}
+	return nil
+}
+
+func (h *deadStoreHelper) doWhile(p pendingStores, n *a.While, depth uint32) (pendingStores, error) {
+	l := &loopPendingStores{}
+	h.loops[n] = l
+
+	// The loop's asserts (pre-, inv- and post-conditions), decreases
+	// expression and condition are evaluated at the top of every iteration.
+	before := p
+	after := pendingStores(nil)
+	for changed := true; changed; {
+		after = before.clone()
+		for _, o := range n.Asserts() {
+			if err := h.doAssert(after, o.AsAssert()); err != nil {
+				return nil, err
+			}
+		}
+		if dec := n.Decreases(); dec != nil {
+			if err := h.doExpr(after, dec, 0); err != nil {
+				return nil, err
+			}
+		}
+		if err := h.doExpr(after, n.Condition(), 0); err != nil {
+			return nil, err
+		}
+
+		r, err := h.doBlock(after.clone(), n.Body(), depth)
+		if err != nil {
+			return nil, err
+		}
+		r, _ = r.reconcile(l.continues)
+		before, changed = before.reconcile(r)
+	}
+
+	ret := pendingStores(nil)
+	if !n.IsWhileTrue() {
+		ret = after
+	}
+	ret, _ = ret.reconcile(l.breaks)
+	return ret, nil
+}
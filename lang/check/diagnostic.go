@@ -0,0 +1,99 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"strings"
+
+	"github.com/google/wuffs/lang/diagnostic"
+)
+
+// diagnosticCode refines diagnostic.Code for the checker's messages.
+func diagnosticCode(message string) string {
+	code := diagnostic.Code(message)
+	if code != "check" {
+		return code
+	}
+	switch {
+	case strings.Contains(message, "redundant assignment"):
+		return "check.redundant_assignment"
+	case strings.Contains(message, "is never used"):
+		return "check.dead_store"
+	case strings.Contains(message, "cannot prove"),
+		strings.Contains(message, " bounds "),
+		strings.Contains(message, "out of bounds"):
+		return "check.bounds"
+	}
+	return code
+}
+
+// Diagnostic implements diagnostic.Diagnoser. Its Related locations are the
+// facts: where each live fact was established and where each dropped fact was
+// dropped, if Options.TrackFacts was set, or just the live facts otherwise.
+func (e *Error) Diagnostic() diagnostic.Diagnostic {
+	msg := e.Err.Error()
+	ret := diagnostic.Diagnostic{
+		Severity:  diagnostic.SeverityError,
+		Code:      diagnosticCode(msg),
+		Message:   msg,
+		Filename:  e.Filename,
+		Line:      e.Line,
+		Column:    int(e.Column),
+		EndColumn: int(e.EndColumn),
+	}
+	if e.TMap == nil {
+		return ret
+	}
+
+	if e.FactEvents == nil {
+		for _, f := range e.Facts {
+			ret.Related = append(ret.Related, diagnostic.Related{
+				Message:  "fact: " + f.Str(e.TMap),
+				Filename: e.Filename,
+			})
+		}
+		return ret
+	}
+	for _, v := range e.FactEvents {
+		r := diagnostic.Related{
+			Message:  "fact: " + v.Fact.Str(e.TMap),
+			Filename: e.Filename,
+			Line:     v.Established,
+		}
+		if v.Dropped != 0 {
+			r.Message = "dropped fact: " + v.Fact.Str(e.TMap)
+			r.Line = v.Dropped
+		}
+		if r.Line == 0 {
+			r.Filename = ""
+		}
+		ret.Related = append(ret.Related, r)
+	}
+	return ret
+}
+
+// Diagnostic returns w as a diagnostic.Diagnostic.
+func (w *Warning) Diagnostic() diagnostic.Diagnostic {
+	msg := w.Err.Error()
+	return diagnostic.Diagnostic{
+		Severity:  diagnostic.SeverityWarning,
+		Code:      diagnosticCode(msg),
+		Message:   msg,
+		Filename:  w.Filename,
+		Line:      w.Line,
+		Column:    int(w.Column),
+		EndColumn: int(w.EndColumn),
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file implements a difference bounds domain (see lib/interval's
+// DiffBounds), alongside the interval domain (the bounds type). It combines
+// chains of facts, such as "i <= j" and "j < args.s.length()", so that the
+// prover can prove "i < args.s.length()" without an explicit assert. It also
+// refines bounds: the facts "i <= j" and "j < 10" imply "i <= 8".
+
+import (
+	"math/big"
+
+	"github.com/google/wuffs/lib/interval"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// diffTerms numbers the expressions that the facts compare, after splitting
+// off any constant addend, and holds the difference bounds between them.
+// Number 0 is the constant zero.
+type diffTerms struct {
+	exprs  []*a.Expr
+	byHash map[uint64][]int
+	dbm    interval.DiffBounds
+}
+
+// newDiffTerms records each "lhs op rhs" fact in facts, where op is a
+// comparison other than "<>", as difference constraints.
+func newDiffTerms(facts []*a.Expr) *diffTerms {
+	z := &diffTerms{
+		exprs:  []*a.Expr{nil},
+		byHash: map[uint64][]int{},
+	}
+	for _, x := range facts {
+		op, lhs, rhs := parseBinaryOp(x)
+		switch op {
+		case t.IDXBinaryLessThan, t.IDXBinaryLessEq, t.IDXBinaryEqEq,
+			t.IDXBinaryGreaterEq, t.IDXBinaryGreaterThan:
+		default:
+			continue
+		}
+		if op == t.IDXBinaryGreaterEq || op == t.IDXBinaryGreaterThan {
+			op, lhs, rhs = flipComparison(op), rhs, lhs
+		}
+
+		// "l + lk op r + rk" is "l - r op rk - lk".
+		l, lk := splitAddend(lhs)
+		r, rk := splitAddend(rhs)
+		li, ri := z.id(l, true), z.id(r, true)
+		c := big.NewInt(0).Sub(rk, lk)
+		switch op {
+		case t.IDXBinaryLessThan:
+			z.dbm.Constrain(li, ri, c.Sub(c, one))
+		case t.IDXBinaryLessEq:
+			z.dbm.Constrain(li, ri, c)
+		case t.IDXBinaryEqEq:
+			z.dbm.Constrain(li, ri, c)
+			z.dbm.Constrain(ri, li, big.NewInt(0).Neg(c))
+		}
+	}
+	return z
+}
+
+func flipComparison(op t.ID) t.ID {
+	switch op {
+	case t.IDXBinaryLessThan:
+		return t.IDXBinaryGreaterThan
+	case t.IDXBinaryLessEq:
+		return t.IDXBinaryGreaterEq
+	case t.IDXBinaryGreaterEq:
+		return t.IDXBinaryLessEq
+	case t.IDXBinaryGreaterThan:
+		return t.IDXBinaryLessThan
+	}
+	return op
+}
+
+// splitAddend splits n into "e + k", for a constant k. A nil e means the
+// constant zero. For example, "x + 1" splits into (x, 1), "x - 2" into (x,
+// -2) and "7" into (nil, 7). Only the plain (not tilde) "+" and "-" operators
+// split, as the facts are about mathematical integers.
+func splitAddend(n *a.Expr) (e *a.Expr, k *big.Int) {
+	if cv := n.ConstValue(); cv != nil {
+		return nil, cv
+	}
+	switch op, lhs, rhs := parseBinaryOp(n); op {
+	case t.IDXBinaryPlus:
+		if cv := rhs.ConstValue(); cv != nil {
+			return lhs, cv
+		} else if cv := lhs.ConstValue(); cv != nil {
+			return rhs, cv
+		}
+	case t.IDXBinaryMinus:
+		if cv := rhs.ConstValue(); cv != nil {
+			return lhs, big.NewInt(0).Neg(cv)
+		}
+	}
+	return n, zero
+}
+
+// id returns n's number, or -1 if n has not been numbered and add is false.
+func (z *diffTerms) id(n *a.Expr, add bool) int {
+	if n == nil {
+		return 0
+	}
+	h := n.Hash()
+	for _, i := range z.byHash[h] {
+		if z.exprs[i].Eq(n) {
+			return i
+		}
+	}
+	if !add {
+		return -1
+	}
+	i := len(z.exprs)
+	z.exprs = append(z.exprs, n)
+	z.byHash[h] = append(z.byHash[h], i)
+	return i
+}
+
+// upper returns the smallest c such that the facts imply "lhs - rhs <= c", or
+// nil if they imply no such c (or are inconsistent).
+func (z *diffTerms) upper(lhs *a.Expr, rhs *a.Expr) *big.Int {
+	l, lk := splitAddend(lhs)
+	r, rk := splitAddend(rhs)
+	li, ri := z.id(l, false), z.id(r, false)
+	if (li < 0) || (ri < 0) || !z.dbm.Consistent() {
+		return nil
+	}
+	u := z.dbm.Upper(li, ri)
+	if u == nil {
+		return nil
+	}
+	// "lhs - rhs" is "l - r + lk - rk".
+	ret := big.NewInt(0).Add(u, lk)
+	return ret.Sub(ret, rk)
+}
+
+// diffTerms returns the difference bounds implied by the facts, building them
+// if the facts have changed since the last call.
+func (z *facts) diffTerms() *diffTerms {
+	if z.diffs == nil {
+		z.diffs = newDiffTerms(z.list)
+	}
+	return z.diffs
+}
+
+// relatesNonConst returns whether one of the facts compares n to a
+// non-constant expression. Only then can the difference bounds refine n's
+// bounds any further than the facts comparing n to constants do.
+func (z *facts) relatesNonConst(n *a.Expr) bool {
+	for _, x := range z.about(n) {
+		if op, other := otherHandSide(x, n); (op != 0) && (other.ConstValue() == nil) {
+			return true
+		}
+	}
+	return false
+}
+
+// refineDiff refines nb, n's bounds, given the difference bounds between n
+// and the constant zero.
+func (z *facts) refineDiff(n *a.Expr, nb bounds) bounds {
+	if !z.relatesNonConst(n) {
+		return nb
+	}
+	d := z.diffTerms()
+	if hi := d.upper(n, zeroExpr); (hi != nil) && (nb[1].Cmp(hi) > 0) {
+		nb[1] = hi
+	}
+	if lo := d.upper(zeroExpr, n); lo != nil {
+		if lo = big.NewInt(0).Neg(lo); nb[0].Cmp(lo) < 0 {
+			nb[0] = lo
+		}
+	}
+	return nb
+}
+
+// proveDifference proves "lhs op rhs" using the difference bounds.
+func (q *checker) proveDifference(op t.ID, lhs *a.Expr, rhs *a.Expr) bool {
+	if op == t.IDXBinaryGreaterEq || op == t.IDXBinaryGreaterThan {
+		op, lhs, rhs = flipComparison(op), rhs, lhs
+	}
+	d := q.facts.diffTerms()
+	switch op {
+	case t.IDXBinaryLessThan:
+		u := d.upper(lhs, rhs)
+		return (u != nil) && (u.Sign() < 0)
+	case t.IDXBinaryLessEq:
+		u := d.upper(lhs, rhs)
+		return (u != nil) && (u.Sign() <= 0)
+	case t.IDXBinaryEqEq:
+		u0, u1 := d.upper(lhs, rhs), d.upper(rhs, lhs)
+		return (u0 != nil) && (u0.Sign() <= 0) && (u1 != nil) && (u1.Sign() <= 0)
+	case t.IDXBinaryNotEq:
+		if u := d.upper(lhs, rhs); (u != nil) && (u.Sign() < 0) {
+			return true
+		}
+		u := d.upper(rhs, lhs)
+		return (u != nil) && (u.Sign() < 0)
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file explains the prover's reasoning, for debugging "cannot prove"
+// failures. When Options.Explain is set, every proof obligation (an explicit
+// assert, inv, pre or post condition, or an implicit requirement such as an
+// index being in bounds) is written as a line like:
+//
+//	foo.wuffs:12: assert "i < n": ok
+//
+// followed by the steps that the prover took, one per indented line. An
+// obligation's sub-obligations, such as a reason's requirements, are nested
+// one indent further. A failed obligation also lists the facts at that point.
+//
+// Expressions whose bounds (from interval arithmetic and facts) are within
+// their type's bounds are far too numerous to explain, so only those that
+// fail are, as a "bounds" obligation.
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+)
+
+type explanation struct {
+	lines []string
+}
+
+type explainer struct {
+	w     io.Writer
+	stack []*explanation
+}
+
+// explainBegin starts explaining a proof obligation. Every call must be
+// matched by a call to explainEnd.
+func (q *checker) explainBegin() {
+	if z := q.c.explainer; z != nil {
+		z.stack = append(z.stack, &explanation{})
+	}
+}
+
+// explainEnd finishes explaining an obligation of the given kind (such as
+// "assert"), whose proof failed if err is non-nil.
+func (q *checker) explainEnd(kind string, goal *a.Expr, err error) {
+	z := q.c.explainer
+	if z == nil {
+		return
+	}
+	e := z.stack[len(z.stack)-1]
+	z.stack = z.stack[:len(z.stack)-1]
+
+	result := "ok"
+	if err != nil {
+		result = "failed"
+		e.lines = append(e.lines, "facts:")
+		for _, x := range q.facts.exprs() {
+			e.lines = append(e.lines, "\t"+x.Str(q.tm))
+		}
+	}
+	lines := make([]string, 0, 1+len(e.lines))
+	lines = append(lines, fmt.Sprintf("%s:%d: %s %q: %s", q.errFilename, q.errLine, kind, goal.Str(q.tm), result))
+	for _, s := range e.lines {
+		lines = append(lines, "\t"+s)
+	}
+
+	if len(z.stack) > 0 {
+		parent := z.stack[len(z.stack)-1]
+		parent.lines = append(parent.lines, lines...)
+		return
+	}
+	fmt.Fprintln(z.w, strings.Join(lines, "\n"))
+}
+
+// explainStep adds a step to the obligation being explained.
+func (q *checker) explainStep(format string, args ...interface{}) {
+	if z := q.c.explainer; (z != nil) && (len(z.stack) > 0) {
+		e := z.stack[len(z.stack)-1]
+		e.lines = append(e.lines, fmt.Sprintf(format, args...))
+	}
+}
+
+// explainBoundsFailure explains that n's bounds, nb, are not within tb. The
+// refined bounds are nb after applying any facts about n.
+func (q *checker) explainBoundsFailure(n *a.Expr, nb bounds, refined bounds, tb bounds) {
+	if q.c.explainer == nil {
+		return
+	}
+	q.explainBegin()
+	for _, o := range n.AsNode().AsRaw().SubNodes() {
+		if (o == nil) || (o.Kind() != a.KExpr) {
+			continue
+		} else if b := o.AsExpr().MBounds(); b[0] != nil {
+			q.explainStep("operand %q has bounds %v", o.AsExpr().Str(q.tm), b)
+		}
+	}
+	q.explainStep("interval arithmetic gives bounds %v", nb)
+	if (refined[0].Cmp(nb[0]) != 0) || (refined[1].Cmp(nb[1]) != 0) {
+		q.explainStep("facts refine that to %v", refined)
+	}
+	q.explainStep("type bounds are %v", tb)
+	q.explainEnd("bounds", n, errFailed)
+}
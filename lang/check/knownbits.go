@@ -0,0 +1,164 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file implements a known-bits (tri-state bitmask) domain, alongside the
+// interval domain (the bounds type), for the bitwise operators. Interval
+// arithmetic alone loses precision when combining masked values: the bounds of
+// "(x | 0x80) & 0xF0" are [0x80, 0xF0], but the bounds' And method only gives
+// [0x00, 0xF0], and the "^" operator's bounds are a conservative
+// power-of-2-minus-1.
+
+import (
+	"math/big"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// knownBits describes a non-negative integer x, bit by bit. A bit of x is
+// unknown if it is set in u. Otherwise, it is known to be the corresponding
+// bit of v. The v and u bits are disjoint, and all bits above their bit
+// lengths are known to be zero.
+type knownBits struct {
+	v *big.Int
+	u *big.Int
+}
+
+// knownBitsFromBounds returns what is known about the bits of any x in the
+// range [b[0], b[1]]: everything above the highest bit that differs between
+// b[0] and b[1] is known.
+func knownBitsFromBounds(b bounds) (knownBits, bool) {
+	if (b[0] == nil) || (b[1] == nil) || (b[0].Sign() < 0) || (b[0].Cmp(b[1]) > 0) {
+		return knownBits{}, false
+	}
+	u := bitMask(big.NewInt(0).Xor(b[0], b[1]).BitLen())
+	return knownBits{big.NewInt(0).AndNot(b[0], u), u}, true
+}
+
+// meet returns what is known about x when both k and l describe x.
+func (k knownBits) meet(l knownBits) knownBits {
+	u := big.NewInt(0).And(k.u, l.u)
+	v := big.NewInt(0).Or(k.v, l.v)
+	return knownBits{v.AndNot(v, u), u}
+}
+
+func (k knownBits) and(l knownBits) knownBits {
+	v := big.NewInt(0).And(k.v, l.v)
+	u := big.NewInt(0).And(big.NewInt(0).Or(k.v, k.u), big.NewInt(0).Or(l.v, l.u))
+	return knownBits{v, u.AndNot(u, v)}
+}
+
+func (k knownBits) or(l knownBits) knownBits {
+	v := big.NewInt(0).Or(k.v, l.v)
+	u := big.NewInt(0).Or(k.u, l.u)
+	return knownBits{v, u.AndNot(u, v)}
+}
+
+func (k knownBits) xor(l knownBits) knownBits {
+	u := big.NewInt(0).Or(k.u, l.u)
+	v := big.NewInt(0).Xor(k.v, l.v)
+	return knownBits{v.AndNot(v, u), u}
+}
+
+// bounds returns the smallest and largest x consistent with k: the unknown
+// bits are all zeroes or all ones.
+func (k knownBits) bounds() bounds {
+	return bounds{
+		big.NewInt(0).Set(k.v),
+		big.NewInt(0).Or(k.v, k.u),
+	}
+}
+
+// knownBitsOf returns what is known about the bits of n, an expression that
+// has already been bounds checked, so that n.MBounds() is set. It combines
+// n's bounds with what is known about n's sub-expressions' bits.
+func (q *checker) knownBitsOf(n *a.Expr, depth uint32) (knownBits, bool) {
+	nb := n.MBounds()
+	if cv := n.ConstValue(); cv != nil {
+		nb = bounds{cv, cv}
+	}
+	k, ok := knownBitsFromBounds(nb)
+	if !ok || (depth > a.MaxExprDepth) {
+		return k, ok
+	}
+	depth++
+
+	op, lhs, rhs := parseBinaryOp(n)
+	if lhs == nil {
+		return k, true
+	}
+	switch op {
+	case t.IDXBinaryAmp, t.IDXBinaryPipe, t.IDXBinaryHat:
+		l, lok := q.knownBitsOf(lhs, depth)
+		r, rok := q.knownBitsOf(rhs, depth)
+		if !lok || !rok {
+			return k, true
+		}
+		switch op {
+		case t.IDXBinaryAmp:
+			return k.meet(l.and(r)), true
+		case t.IDXBinaryPipe:
+			return k.meet(l.or(r)), true
+		}
+		return k.meet(l.xor(r)), true
+
+	case t.IDXBinaryShiftL, t.IDXBinaryShiftR:
+		s := rhs.ConstValue()
+		if (s == nil) || (s.Sign() < 0) || !s.IsUint64() || (s.Uint64() >= 256) {
+			return k, true
+		}
+		l, lok := q.knownBitsOf(lhs, depth)
+		if !lok {
+			return k, true
+		}
+		if op == t.IDXBinaryShiftL {
+			l.v = big.NewInt(0).Lsh(l.v, uint(s.Uint64()))
+			l.u = big.NewInt(0).Lsh(l.u, uint(s.Uint64()))
+		} else {
+			l.v = big.NewInt(0).Rsh(l.v, uint(s.Uint64()))
+			l.u = big.NewInt(0).Rsh(l.u, uint(s.Uint64()))
+		}
+		return k.meet(l), true
+	}
+	return k, true
+}
+
+// bcheckExprBitwiseOp refines nb, the interval bounds of "lhs op rhs", where
+// op is "&", "|" or "^", by using the known-bits domain.
+func (q *checker) bcheckExprBitwiseOp(op t.ID, lhs *a.Expr, rhs *a.Expr, nb bounds) bounds {
+	l, ok := q.knownBitsOf(lhs, 0)
+	if !ok {
+		return nb
+	}
+	r, ok := q.knownBitsOf(rhs, 0)
+	if !ok {
+		return nb
+	}
+
+	k := knownBits{}
+	switch op {
+	case t.IDXBinaryAmp:
+		k = l.and(r)
+	case t.IDXBinaryPipe:
+		k = l.or(r)
+	case t.IDXBinaryHat:
+		k = l.xor(r)
+	default:
+		return nb
+	}
+	kb := k.bounds()
+	return bounds{max(nb[0], kb[0]), min(nb[1], kb[1])}
+}
@@ -0,0 +1,221 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file implements lemmas: top-level declarations of reusable, named
+// implications, such as:
+//
+//   lemma "x + 1 <= n: x < n"(x: base.u64, n: base.u64),
+//       pre x < n,
+//       post (x + 1) <= n,
+//   {
+//   }
+//
+// A lemma's body holds only assert statements. The checker proves each post
+// condition once, assuming the pre conditions and nothing else about the
+// parameters (other than their types' bounds). A lemma can then be used as an
+// assert's reason, like the built-in reasons in data.go:
+//
+//   assert (i + 1) <= len via "x + 1 <= n: x < n"(x: i, n: len)
+//
+// Every parameter must be given as an argument. The assert proves that the
+// arguments are within their parameters' bounds, and the pre conditions
+// (with the arguments substituted for the parameters), and then that its
+// condition is one of the similarly substituted post conditions.
+//
+// A lemma is only registered as a reason after its own proof succeeds. The
+// lemmas that it uses are checked first, wherever they are declared (see
+// order.go), so lemmas cannot be used to prove each other circularly.
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func (c *Checker) checkLemma(node *a.Node) error {
+	return c.lemmaOrder.visit(c.tm, node, c.checkLemma1)
+}
+
+func (c *Checker) checkLemma1(node *a.Node) error {
+	n := node.AsLemma()
+	q := &checker{
+		c:           c,
+		tm:          c.tm,
+		reasonMap:   c.reasonMap,
+		localVars:   typeMap{},
+		errFilename: n.Filename(),
+		errLine:     n.Line(),
+	}
+	if err := q.checkLemma(n); err != nil {
+		return q.newError(err)
+	}
+	c.reasonMap[n.Name()] = lemmaReason(n)
+	return nil
+}
+
+func (q *checker) checkLemma(n *a.Lemma) error {
+	name := n.Name().Str(q.tm)
+	if q.reasonMap[n.Name()] != nil {
+		return fmt.Errorf("check: duplicate reason %s", name)
+	}
+
+	for _, o := range n.Params() {
+		o := o.AsField()
+		if _, ok := q.localVars[o.Name()]; ok {
+			return fmt.Errorf("check: lemma %s: duplicate parameter %s", name, o.Name().Str(q.tm))
+		}
+		if err := q.tcheckTypeExpr(o.XType(), 0); err != nil {
+			return err
+		}
+		if !o.XType().IsNumType() {
+			return fmt.Errorf("check: lemma %s: parameter %s does not have a numeric type",
+				name, o.Name().Str(q.tm))
+		}
+		q.localVars[o.Name()] = o.XType()
+	}
+
+	hasPost := false
+	for _, o := range n.Asserts() {
+		o := o.AsAssert()
+		if err := q.tcheckAssert(o); err != nil {
+			return err
+		}
+		switch o.Condition().Operator() {
+		case t.IDXBinaryNotEq, t.IDXBinaryLessThan, t.IDXBinaryLessEq,
+			t.IDXBinaryEqEq, t.IDXBinaryGreaterEq, t.IDXBinaryGreaterThan:
+		default:
+			return fmt.Errorf("check: lemma %s: condition %q is not a comparison",
+				name, o.Condition().Str(q.tm))
+		}
+		hasPost = hasPost || (o.Keyword() == t.IDPost)
+	}
+	if !hasPost {
+		return fmt.Errorf("check: lemma %s has no post condition", name)
+	}
+
+	for _, o := range n.Body() {
+		if (o.Kind() != a.KAssert) || (o.AsAssert().Keyword() != t.IDAssert) {
+			q.setErrNode(o)
+			return fmt.Errorf("check: lemma %s: only assert statements are allowed", name)
+		}
+		if err := q.tcheckStatement(o); err != nil {
+			return err
+		}
+	}
+
+	// Prove the post conditions, assuming only the pre conditions.
+	for _, o := range n.Asserts() {
+		if o := o.AsAssert(); o.Keyword() == t.IDPre {
+			if _, err := q.bcheckExpr(o.Condition(), 0); err != nil {
+				return err
+			}
+			q.facts.appendFact(o.Condition())
+		}
+	}
+	for _, o := range n.Body() {
+		q.setErrNode(o)
+		if err := q.bcheckStatement(o); err != nil {
+			return err
+		}
+	}
+	q.setErrNode(n.AsNode())
+	for _, o := range n.Asserts() {
+		if o := o.AsAssert(); o.Keyword() == t.IDPost {
+			if err := q.bcheckAssertCondition(o); err != nil {
+				return fmt.Errorf("%v (for the lemma %s post-condition)", err, name)
+			}
+		}
+	}
+
+	return n.AsNode().Walk(func(o *a.Node) error {
+		switch o.Kind() {
+		case a.KExpr, a.KTypeExpr:
+			return q.setBoundsFromType(o)
+		}
+		setPlaceholderMBoundsMType(o)
+		return nil
+	})
+}
+
+// lemmaReason returns the reason that applies the lemma n.
+func lemmaReason(n *a.Lemma) reason {
+	return func(q *checker, o *a.Assert) error {
+		args := map[t.ID]*a.Expr{}
+		for _, p := range n.Params() {
+			args[p.AsField().Name()] = nil
+		}
+		for _, arg := range o.Args() {
+			arg := arg.AsArg()
+			if v, ok := args[arg.Name()]; !ok {
+				return fmt.Errorf("lemma %s has no parameter %s", n.Name().Str(q.tm), arg.Name().Str(q.tm))
+			} else if v != nil {
+				return fmt.Errorf("duplicate argument %s", arg.Name().Str(q.tm))
+			}
+			args[arg.Name()] = arg.Value()
+		}
+
+		for _, p := range n.Params() {
+			p := p.AsField()
+			v := args[p.Name()]
+			if v == nil {
+				return fmt.Errorf("missing argument %s", p.Name().Str(q.tm))
+			}
+			tb, err := q.bcheckTypeExpr(p.XType())
+			if err != nil {
+				return err
+			}
+			vb, err := q.bcheckExpr(v, 0)
+			if err != nil {
+				return err
+			}
+			if (vb[0].Cmp(tb[0]) < 0) || (vb[1].Cmp(tb[1]) > 0) {
+				return fmt.Errorf("argument %s, %q, has bounds %v, not within %v",
+					p.Name().Str(q.tm), v.Str(q.tm), vb, tb)
+			}
+		}
+
+		for _, x := range n.Asserts() {
+			if x := x.AsAssert(); x.Keyword() == t.IDPre {
+				op, lhs, rhs := parseBinaryOp(substituteLemma(x.Condition(), args))
+				if err := proveReasonRequirement(q, op, lhs, rhs); err != nil {
+					return err
+				}
+			}
+		}
+		for _, x := range n.Asserts() {
+			if x := x.AsAssert(); x.Keyword() == t.IDPost {
+				if substituteLemma(x.Condition(), args).Eq(o.Condition()) {
+					return nil
+				}
+			}
+		}
+		return errFailed
+	}
+}
+
+// substituteLemma returns a copy of n with every lemma parameter replaced by a
+// copy of its argument, args[name].
+func substituteLemma(n *a.Expr, args map[t.ID]*a.Expr) *a.Expr {
+	return n.Substitute(func(x *a.Expr) *a.Expr {
+		if (x.Operator() == 0) && (x.ConstValue() == nil) {
+			if v := args[x.Ident()]; v != nil {
+				return v.Substitute(nil)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,365 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file deals with monotonicity declarations: post conditions, on a pure
+// function with a numeric result, such as:
+//
+//   pri func clamp(x : base.u32) base.u32[..= 100],
+//       post "monotone in x",
+//   {
+//       if args.x > 100 {
+//           return 100
+//       }
+//       return args.x
+//   }
+//
+// which says that the result never decreases when the x argument increases
+// (and the other arguments stay the same). At a call site, that proves e.g.
+// "clamp(x: i) <= clamp(x: j)" from "i <= j", which interval bounds (and the
+// post conditions about "result") cannot, without inlining the function.
+//
+// The declaration is verified once, when the function body is bounds checked.
+// That body must be if-else and return statements (and assertions). Each
+// return statement's value, with the if conditions that lead to it, is a
+// piece. For every pair of pieces (including a piece paired with itself), the
+// checker proves that the first piece's value for "x_lo" is no more than the
+// second piece's value for "x_hi", assuming both pieces' conditions and
+// "x_lo <= x_hi", unless those assumptions contradict each other. Those
+// proofs can use the monotonicity of operators such as "+" and ">>" and of
+// other functions' calls.
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+const monotonePrefix = `"monotone in `
+
+// maxMonotonePieces bounds how many pieces a function body can be split into.
+const maxMonotonePieces = 64
+
+// monotoneParam returns whether n is a monotonicity declaration, such as
+// `post "monotone in x"`, and if so, the named in-param. That name is zero if
+// the declaration is not in that form.
+func monotoneParam(tm *t.Map, n *a.Assert) (param t.ID, ok bool) {
+	cond := n.Condition()
+	if (cond.Operator() != 0) || !cond.Ident().IsDQStrLiteral(tm) {
+		return 0, false
+	}
+	s := cond.Ident().Str(tm)
+	if (len(s) <= len(monotonePrefix)+1) || (s[:len(monotonePrefix)] != monotonePrefix) {
+		return 0, true
+	}
+	return tm.ByName(s[len(monotonePrefix) : len(s)-1]), true
+}
+
+// monotoneParams returns the in-params that f is declared to be monotone in.
+func monotoneParams(tm *t.Map, f *a.Func) (ret map[t.ID]bool) {
+	for _, o := range f.Asserts() {
+		if param, ok := monotoneParam(tm, o.AsAssert()); ok && (param != 0) {
+			if ret == nil {
+				ret = map[t.ID]bool{}
+			}
+			ret[param] = true
+		}
+	}
+	return ret
+}
+
+func (q *checker) tcheckMonotoneAssert(n *a.Assert, param t.ID) error {
+	f := q.astFunc
+	if param == 0 {
+		return fmt.Errorf("check: function assertion %s is not of the form \"monotone in x\"",
+			n.Condition().Str(q.tm))
+	}
+	if n.Keyword() != t.IDPost {
+		return fmt.Errorf("check: monotonicity declaration %s is not a post condition",
+			n.Condition().Str(q.tm))
+	}
+	if !f.Effect().Pure() || (f.Out() == nil) || !f.Out().IsNumType() {
+		return fmt.Errorf("check: function %s cannot be monotone: it is not pure with a numeric result",
+			f.QQID().Str(q.tm))
+	}
+	if typ := findInParam(f, param); typ == nil {
+		return fmt.Errorf("check: function %s cannot be monotone in %s: no such in-param",
+			f.QQID().Str(q.tm), param.Str(q.tm))
+	} else if !typ.IsNumType() {
+		return fmt.Errorf("check: function %s cannot be monotone in %s: it is not numeric",
+			f.QQID().Str(q.tm), param.Str(q.tm))
+	}
+	n.Condition().SetMType(typeExprBool)
+	return nil
+}
+
+// findInParam returns the type of f's in-param named name, or nil if there is
+// no such in-param.
+func findInParam(f *a.Func, name t.ID) *a.TypeExpr {
+	for _, o := range f.In().Fields() {
+		if o := o.AsField(); o.Name() == name {
+			return o.XType()
+		}
+	}
+	return nil
+}
+
+// monotonePiece is a return statement's value and the conditions under which
+// that return statement is reached.
+type monotonePiece struct {
+	guards []*a.Expr
+	value  *a.Expr
+}
+
+// verifyMonotone proves the current function's monotonicity declarations, if
+// any, after its body has been bounds checked.
+func (q *checker) verifyMonotone() error {
+	f := q.astFunc
+	params := monotoneParams(q.tm, f)
+	if len(params) == 0 {
+		return nil
+	}
+	pieces, err := q.monotonePieces(nil, f.Body(), nil)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range f.In().Fields() {
+		o := o.AsField()
+		if !params[o.Name()] {
+			continue
+		}
+		for _, pi := range pieces {
+			for _, pj := range pieces {
+				if err := q.verifyMonotonePair(o, pi, pj); err != nil {
+					return fmt.Errorf("check: cannot verify that %s is monotone in %s: %v",
+						f.QQID().Str(q.tm), o.Name().Str(q.tm), err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// monotonePieces appends to pieces the pieces of the block, reached under the
+// guards conditions.
+func (q *checker) monotonePieces(pieces []monotonePiece, block []*a.Node, guards []*a.Expr) ([]monotonePiece, error) {
+	for i, o := range block {
+		switch o.Kind() {
+		case a.KAssert:
+			continue
+
+		case a.KRet:
+			n := o.AsRet()
+			if (n.Keyword() != t.IDReturn) || (n.Value() == nil) {
+				break
+			}
+			if len(pieces) >= maxMonotonePieces {
+				return nil, fmt.Errorf("check: its body has too many branches")
+			}
+			return append(pieces, monotonePiece{guards, n.Value()}), nil
+
+		case a.KIf:
+			return q.monotoneIfPieces(pieces, o.AsIf(), block[i+1:], guards)
+		}
+		return nil, fmt.Errorf("check: its body is not only if-else and return statements")
+	}
+	return nil, fmt.Errorf("check: its body does not end with a return statement")
+}
+
+// monotoneIfPieces is like monotonePieces for an if statement, n, followed by
+// the rest of its block.
+func (q *checker) monotoneIfPieces(pieces []monotonePiece, n *a.If, rest []*a.Node, guards []*a.Expr) ([]monotonePiece, error) {
+	err := error(nil)
+	for n != nil {
+		cond := n.Condition()
+		trueGuards, falseGuards := guards, guards
+		if cond.ConstValue() == nil {
+			inverse, err := invert(q.tm, cond)
+			if err != nil {
+				return nil, err
+			}
+			trueGuards = append(guards[:len(guards):len(guards)], cond)
+			falseGuards = append(guards[:len(guards):len(guards)], inverse)
+		}
+		pieces, err = q.monotonePieces(pieces, concatBlocks(n.BodyIfTrue(), rest), trueGuards)
+		if err != nil {
+			return nil, err
+		}
+
+		guards = falseGuards
+		if bif := n.BodyIfFalse(); len(bif) > 0 {
+			return q.monotonePieces(pieces, concatBlocks(bif, rest), guards)
+		}
+		n = n.ElseIf()
+	}
+	return q.monotonePieces(pieces, rest, guards)
+}
+
+func concatBlocks(x []*a.Node, y []*a.Node) []*a.Node {
+	return append(x[:len(x):len(x)], y...)
+}
+
+// verifyMonotonePair proves that pi's value, for the in-param x being x_lo, is
+// no more than pj's value, for x being x_hi, given "x_lo <= x_hi".
+func (q *checker) verifyMonotonePair(x *a.Field, pi monotonePiece, pj monotonePiece) error {
+	lo, hi, q2, err := q.newMonotoneChecker(x)
+	if err != nil {
+		return err
+	}
+	loArgs := map[t.ID]*a.Expr{x.Name(): lo}
+	hiArgs := map[t.ID]*a.Expr{x.Name(): hi}
+
+	for _, g := range pi.guards {
+		if err := q2.assumeMonotoneCondition(substituteContract(g, loArgs, nil)); err != nil {
+			return err
+		}
+	}
+	for _, g := range pj.guards {
+		if err := q2.assumeMonotoneCondition(substituteContract(g, hiArgs, nil)); err != nil {
+			return err
+		}
+	}
+	loLEHi := a.NewExpr(0, t.IDXBinaryLessEq, 0, lo.AsNode(), nil, hi.AsNode(), nil)
+	loLEHi.SetMType(typeExprBool)
+	if err := q2.assumeMonotoneCondition(loLEHi); err != nil {
+		return err
+	}
+	if !q2.facts.diffTerms().dbm.Consistent() {
+		// The pieces' conditions contradict "x_lo <= x_hi", such as for
+		// "x_lo > 100" and "x_hi <= 100": there is nothing to prove.
+		return nil
+	}
+
+	goal := a.NewExpr(0, t.IDXBinaryLessEq, 0,
+		substituteContract(pi.value, loArgs, nil).AsNode(), nil,
+		substituteContract(pj.value, hiArgs, nil).AsNode(), nil)
+	goal.SetMType(typeExprBool)
+	return q2.bcheckAssertCondition(a.NewAssert(t.IDAssert, goal, 0, nil))
+}
+
+// newMonotoneChecker returns a checker, for proving the current function's
+// monotonicity in x, with two more local variables, x_lo and x_hi, of x's
+// type. The function body has no other local variables (other than args and
+// this), as it is only if-else and return statements.
+func (q *checker) newMonotoneChecker(x *a.Field) (lo *a.Expr, hi *a.Expr, q2 *checker, err error) {
+	localVars := typeMap{}
+	for k, v := range q.localVars {
+		localVars[k] = v
+	}
+	ids := [2]t.ID{}
+	for i, suffix := range [2]string{"_lo", "_hi"} {
+		if ids[i], err = q.tm.Insert(x.Name().Str(q.tm) + suffix); err != nil {
+			return nil, nil, nil, err
+		}
+		localVars[ids[i]] = x.XType()
+	}
+	lo = a.NewExpr(0, 0, ids[0], nil, nil, nil, nil)
+	lo.SetMType(x.XType())
+	hi = a.NewExpr(0, 0, ids[1], nil, nil, nil, nil)
+	hi.SetMType(x.XType())
+	return lo, hi, &checker{
+		c:         q.c,
+		tm:        q.tm,
+		reasonMap: q.reasonMap,
+		astFunc:   q.astFunc,
+		localVars: localVars,
+	}, nil
+}
+
+func (q *checker) assumeMonotoneCondition(cond *a.Expr) error {
+	if _, err := q.bcheckExpr(cond, 0); err != nil {
+		return err
+	}
+	return q.appendCondition(cond)
+}
+
+// proveMonotone proves "lhs <= rhs" (or "rhs >= lhs") when both sides apply
+// the same monotone operator or function call, such as "f(x: a) <= f(x: b)",
+// to operands that are pairwise equal or, where monotone, provably "<=". For
+// "-" and "~sat-", the right operands compare the other way around.
+func (q *checker) proveMonotone(op t.ID, lhs *a.Expr, rhs *a.Expr, depth uint32) bool {
+	if depth >= maxNonlinearDepth {
+		return false
+	}
+	depth++
+
+	switch op {
+	case t.IDXBinaryLessEq:
+		// No-op.
+	case t.IDXBinaryGreaterEq:
+		lhs, rhs = rhs, lhs
+	default:
+		return false
+	}
+	if lhs.Operator() != rhs.Operator() {
+		return false
+	}
+
+	le := func(x *a.Expr, y *a.Expr) bool {
+		return x.Eq(y) || (q.proveBinaryOp1(t.IDXBinaryLessEq, x, y, depth) == nil)
+	}
+	lL, lR := lhs.LHS().AsExpr(), lhs.RHS().AsExpr()
+	rL, rR := rhs.LHS().AsExpr(), rhs.RHS().AsExpr()
+
+	switch lhs.Operator() {
+	case t.IDXBinaryPlus, t.IDXBinaryTildeSatPlus:
+		return le(lL, rL) && le(lR, rR)
+	case t.IDXBinaryMinus, t.IDXBinaryTildeSatMinus:
+		return le(lL, rL) && le(rR, lR)
+	case t.IDXBinaryShiftR:
+		return lR.Eq(rR) && le(lL, rL)
+	case t.IDXBinarySlash:
+		return lR.Eq(rR) && (q.proveBinaryOp1(t.IDXBinaryGreaterThan, lR, zeroExpr, depth) == nil) &&
+			le(lL, rL)
+	case a.ExprOperatorCall:
+		return q.proveMonotoneCall(lhs, rhs, le)
+	}
+	return false
+}
+
+func (q *checker) proveMonotoneCall(lhs *a.Expr, rhs *a.Expr, le func(*a.Expr, *a.Expr) bool) bool {
+	lFunc, rFunc := lhs.LHS().AsExpr(), rhs.LHS().AsExpr()
+	if !lFunc.Eq(rFunc) || (lFunc.MType() == nil) || !lFunc.MType().IsFuncType() {
+		return false
+	}
+	f, err := q.c.resolveFunc(lFunc.MType())
+	if err != nil {
+		return false
+	}
+	params := monotoneParams(q.tm, f)
+	if len(params) == 0 {
+		return false
+	}
+
+	lArgs, rArgs := lhs.Args(), rhs.Args()
+	if len(lArgs) != len(rArgs) {
+		return false
+	}
+	for i := range lArgs {
+		l, r := lArgs[i].AsArg(), rArgs[i].AsArg()
+		if l.Name() != r.Name() {
+			return false
+		}
+		if l.Value().Eq(r.Value()) {
+			continue
+		}
+		if !params[l.Name()] || !le(l.Value(), r.Value()) {
+			return false
+		}
+	}
+	return true
+}
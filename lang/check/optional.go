@@ -0,0 +1,134 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file implements the facts for checked down-conversions, such as:
+//
+//	o = x.to_u32_checked()
+//	if o.is_ok() {
+//		// The facts include "x <= 0xFFFF_FFFF" and "o.value() == x".
+//	}
+//
+// The assignment adds the fact "o == x.to_u32_checked()", which is dropped
+// (like any other fact) when o or x is re-assigned. A condition "o.is_ok()",
+// or its inverse, then refines what is known about x.
+
+import (
+	"math/big"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+var maxU32 = big.NewInt(0xFFFFFFFF)
+
+// isToU32Checked returns whether n is "x.to_u32_checked()".
+func isToU32Checked(n *a.Expr) bool {
+	if n.Operator() != a.ExprOperatorCall {
+		return false
+	}
+	typ := n.LHS().AsExpr().MType()
+	return typ.IsFuncType() && typ.Receiver().IsNumType() && (typ.FuncName() == t.IDToU32Checked)
+}
+
+// isOptionalIsOK returns whether n is "o.is_ok()" for an optional_u32 o,
+// returning that o.
+func isOptionalIsOK(n *a.Expr) (o *a.Expr, ok bool) {
+	if n.Operator() != a.ExprOperatorCall {
+		return nil, false
+	}
+	method := n.LHS().AsExpr()
+	if method.Operator() != t.IDDot || method.Ident() != t.IDIsOK {
+		return nil, false
+	}
+	o = method.LHS().AsExpr()
+	if typ := o.MType(); (typ.Decorator() != 0) || (typ.QID() != t.QID{t.IDBase, t.IDOptionalU32}) {
+		return nil, false
+	}
+	return o, true
+}
+
+// appendCondition is like q.facts.appendFact(cond), for a condition (such as
+// an if condition or its inverse) that is assumed to be true, but it also
+// adds the facts implied by any "o.is_ok()" or "not o.is_ok()" in cond.
+func (q *checker) appendCondition(cond *a.Expr) error {
+	q.facts.appendFact(cond)
+	return q.appendOptionalFacts(cond)
+}
+
+func (q *checker) appendOptionalFacts(cond *a.Expr) error {
+	switch cond.Operator() {
+	case t.IDXBinaryAnd:
+		if err := q.appendOptionalFacts(cond.LHS().AsExpr()); err != nil {
+			return err
+		}
+		return q.appendOptionalFacts(cond.RHS().AsExpr())
+	case t.IDXAssociativeAnd:
+		for _, o := range cond.Args() {
+			if err := q.appendOptionalFacts(o.AsExpr()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	isOK := true
+	if cond.Operator() == t.IDXUnaryNot {
+		isOK, cond = false, cond.RHS().AsExpr()
+	}
+	o, ok := isOptionalIsOK(cond)
+	if !ok {
+		return nil
+	}
+
+	// Find the "o == x.to_u32_checked()" fact.
+	x := (*a.Expr)(nil)
+	for _, f := range q.facts.about(o) {
+		if op, other := otherHandSide(f, o); (op == t.IDXBinaryEqEq) && isToU32Checked(other) {
+			x = other.LHS().AsExpr().LHS().AsExpr()
+			break
+		}
+	}
+	if x == nil {
+		return nil
+	}
+
+	max, err := makeConstValueExpr(q.tm, maxU32)
+	if err != nil {
+		return err
+	}
+	if !isOK {
+		q.facts.appendBinaryOpFact(t.IDXBinaryGreaterThan, x, max)
+		q.facts.appendBinaryOpFact(t.IDXBinaryEqEq, makeOptionalValue(cond, o), zeroExpr)
+		return nil
+	}
+	q.facts.appendBinaryOpFact(t.IDXBinaryLessEq, x, max)
+	q.facts.appendBinaryOpFact(t.IDXBinaryEqEq, makeOptionalValue(cond, o), x)
+	return nil
+}
+
+// makeOptionalValue returns "o.value()", given isOK, the "o.is_ok()" call.
+// The new nodes copy isOK's flags, so that they are Eq to the parsed and
+// type-checked "o.value()".
+func makeOptionalValue(isOK *a.Expr, o *a.Expr) *a.Expr {
+	method := isOK.LHS().AsExpr()
+	x := a.NewExpr(method.AsNode().AsRaw().Flags(), t.IDDot, t.IDValue, o.AsNode(), nil, nil, nil)
+	x.SetMBounds(bounds{one, one})
+	x.SetMType(a.NewTypeExpr(t.IDFunc, 0, t.IDValue, o.MType().AsNode(), nil, nil))
+	x = a.NewExpr(isOK.AsNode().AsRaw().Flags(), t.IDOpenParen, 0, x.AsNode(), nil, nil, nil)
+	x.SetMBounds(bounds{zero, maxU32})
+	x.SetMType(typeExprU32)
+	return x
+}
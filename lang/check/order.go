@@ -0,0 +1,148 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file makes checking a package's top level declarations independent of
+// the order of its files, and of the declarations within each file.
+//
+// Most kinds of declaration are already order independent, as every one of
+// them is gathered (e.g. checkStructDecl, checkFuncSignature) in an earlier
+// phase than any of them is used (e.g. checkStructFields, checkFuncBody). Two
+// kinds refer to others of the same kind, within the same phase:
+//   - a const's type and value can refer to other consts, and
+//   - a lemma's body can use other lemmas, as reasons.
+// Each of those is checked after the declarations that it refers to, in a
+// depth-first search over the package's declarations, regardless of which
+// file they are in. A cycle, such as a const defined in terms of itself, is
+// an error that lists the declarations involved.
+
+import (
+	"fmt"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+const (
+	declUnmarked   = 0
+	declInProgress = 1
+	declDone       = 2
+)
+
+// declOrder orders the checking of one kind of declaration.
+type declOrder struct {
+	// kind is "const" or "lemma", for error messages.
+	kind string
+
+	// decls holds the package's declarations, keyed by name. If there are
+	// duplicates, the first one is held and checking the others will fail.
+	decls map[t.ID]*a.Node
+
+	marks map[*a.Node]uint8
+	stack []*a.Node
+
+	name func(*a.Node) t.ID
+	deps func(*a.Node) []t.ID
+}
+
+func newDeclOrder(kind string, name func(*a.Node) t.ID, deps func(*a.Node) []t.ID) *declOrder {
+	return &declOrder{
+		kind:  kind,
+		decls: map[t.ID]*a.Node{},
+		marks: map[*a.Node]uint8{},
+		name:  name,
+		deps:  deps,
+	}
+}
+
+func (z *declOrder) add(n *a.Node) {
+	if name := z.name(n); z.decls[name] == nil {
+		z.decls[name] = n
+	}
+}
+
+// visit calls check(n) unless it has already been called, but first visits
+// the declarations that n refers to.
+func (z *declOrder) visit(tm *t.Map, n *a.Node, check func(*a.Node) error) error {
+	switch z.marks[n] {
+	case declInProgress:
+		names := []string(nil)
+		for i := len(z.stack) - 1; i >= 0; i-- {
+			names = append(names, z.name(z.stack[i]).Str(tm))
+			if z.stack[i] == n {
+				break
+			}
+		}
+		for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+			names[i], names[j] = names[j], names[i]
+		}
+		names = append(names, z.name(n).Str(tm))
+		filename, line := n.AsRaw().FilenameLine()
+		return &Error{
+			Err: fmt.Errorf("check: cyclical %s definitions: %s",
+				z.kind, strings.Join(names, " -> ")),
+			Filename: filename,
+			Line:     line,
+		}
+	case declDone:
+		return nil
+	}
+
+	z.marks[n] = declInProgress
+	z.stack = append(z.stack, n)
+	for _, dep := range z.deps(n) {
+		if o := z.decls[dep]; o != nil {
+			if err := z.visit(tm, o, check); err != nil {
+				return err
+			}
+		}
+	}
+	z.stack = z.stack[:len(z.stack)-1]
+	z.marks[n] = declDone
+	return check(n)
+}
+
+func constName(n *a.Node) t.ID { return n.AsConst().QID()[1] }
+
+// constDeps returns the names that a const's type and value refer to, some of
+// which may be other consts in the same package.
+func constDeps(n *a.Node) []t.ID {
+	ret := []t.ID(nil)
+	n.Walk(func(o *a.Node) error {
+		if (o.Kind() == a.KExpr) && (o.AsExpr().Operator() == 0) {
+			ret = append(ret, o.AsExpr().Ident())
+		}
+		return nil
+	})
+	return ret
+}
+
+func lemmaName(n *a.Node) t.ID { return n.AsLemma().Name() }
+
+// lemmaDeps returns the reasons that a lemma's asserts use, some of which may
+// be other lemmas in the same package.
+func lemmaDeps(n *a.Node) []t.ID {
+	ret := []t.ID(nil)
+	n.Walk(func(o *a.Node) error {
+		if o.Kind() == a.KAssert {
+			if r := o.AsAssert().Reason(); r != 0 {
+				ret = append(ret, r)
+			}
+		}
+		return nil
+	})
+	return ret
+}
@@ -0,0 +1,220 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file tracks an io_reader's position across the reads and skips that
+// advance it by a known amount. Like any other impure call, such a read drops
+// the facts that mention the io_reader, but facts like "r.position() == x"
+// are first carried forward as "r.position() == x + n", where n is the number
+// of bytes read or skipped. Together with bcheckExprXBinaryMinus, this lets
+// code prove that "r.position() - x" does not underflow, for an x that was
+// an earlier position.
+//
+// Only calls that cannot suspend, such as "r.skip_u32_fast!(etc)", carry these
+// facts forward. A coroutine's caller controls the io_buffer's meta.pos while
+// the coroutine is suspended, so the position after resuming need not relate
+// to the position before. Every suspension point therefore drops every fact
+// that mentions an io_reader's position, or a local variable assigned from
+// one, including facts that mention neither "args" nor "this".
+
+import (
+	"math/big"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// ioReaderReadSizes are the number of bytes that each io_reader read method
+// advances the position by.
+var ioReaderReadSizes = map[t.ID]int64{
+	t.IDReadU8:         1,
+	t.IDReadU16BE:      2,
+	t.IDReadU16LE:      2,
+	t.IDReadU8AsU32:    1,
+	t.IDReadU16BEAsU32: 2,
+	t.IDReadU16LEAsU32: 2,
+	t.IDReadU24BEAsU32: 3,
+	t.IDReadU24LEAsU32: 3,
+	t.IDReadU32BE:      4,
+	t.IDReadU32LE:      4,
+	t.IDReadU8AsU64:    1,
+	t.IDReadU16BEAsU64: 2,
+	t.IDReadU16LEAsU64: 2,
+	t.IDReadU24BEAsU64: 3,
+	t.IDReadU24LEAsU64: 3,
+	t.IDReadU32BEAsU64: 4,
+	t.IDReadU32LEAsU64: 4,
+	t.IDReadU40BEAsU64: 5,
+	t.IDReadU40LEAsU64: 5,
+	t.IDReadU48BEAsU64: 6,
+	t.IDReadU48LEAsU64: 6,
+	t.IDReadU56BEAsU64: 7,
+	t.IDReadU56LEAsU64: 7,
+	t.IDReadU64BE:      8,
+	t.IDReadU64LE:      8,
+	t.IDUndoByte:       -1,
+}
+
+// makeIOPosition returns "r.position()".
+func makeIOPosition(r *a.Expr) *a.Expr {
+	x := a.NewExpr(0, t.IDDot, t.IDPosition, r.AsNode(), nil, nil, nil)
+	x.SetMBounds(bounds{one, one})
+	x.SetMType(a.NewTypeExpr(t.IDFunc, 0, t.IDPosition, r.MType().AsNode(), nil, nil))
+	x = a.NewExpr(0, t.IDOpenParen, 0, x.AsNode(), nil, nil, nil)
+	x.SetMType(typeExprU64)
+	return x
+}
+
+// ioReaderAdvance returns the io_reader receiver of the call n and the amount
+// that the call advances its position by, if that is known. The amount is
+// either a constant or one of the call's arguments.
+func (q *checker) ioReaderAdvance(n *a.Expr) (recv *a.Expr, delta *a.Expr, err error) {
+	if n.Operator() != a.ExprOperatorCall {
+		return nil, nil, nil
+	}
+	method := n.LHS().AsExpr()
+	recv = method.LHS().AsExpr()
+	if !recv.MType().Eq(typeExprIOReader) {
+		return nil, nil, nil
+	}
+
+	argName := ""
+	switch method.Ident() {
+	case t.IDSkip, t.IDSkipU32:
+		argName = "n"
+	case t.IDSkipU32Fast:
+		argName = "actual"
+	default:
+		if size, ok := ioReaderReadSizes[method.Ident()]; ok {
+			delta, err = makeConstValueExpr(q.tm, big.NewInt(size))
+			return recv, delta, err
+		}
+		return nil, nil, nil
+	}
+
+	for _, o := range n.Args() {
+		if o := o.AsArg(); o.Name().Str(q.tm) == argName {
+			if v := o.Value(); v.Effect().Pure() && !v.Mentions(recv) {
+				return recv, v, nil
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+// advancedPositionFacts returns the facts about the position of the io_reader
+// that the call n advances, rewritten for after the call.
+func (q *checker) advancedPositionFacts(n *a.Expr) ([]*a.Expr, error) {
+	recv, delta, err := q.ioReaderAdvance(n)
+	if (err != nil) || (delta == nil) {
+		return nil, err
+	}
+	if n.Effect().Coroutine() {
+		return nil, nil
+	}
+
+	pos := makeIOPosition(recv)
+	ret := []*a.Expr(nil)
+	for _, x := range q.facts.about(pos) {
+		op, other := otherHandSide(x, pos)
+		if (op == 0) || other.Mentions(recv) {
+			continue
+		}
+		o, err := q.addToExpr(other, delta)
+		if err != nil {
+			return nil, err
+		}
+		o = a.NewExpr(0, op, 0, pos.AsNode(), nil, o.AsNode(), nil)
+		o.SetMBounds(bounds{zero, one})
+		o.SetMType(typeExprBool)
+		ret = append(ret, o)
+	}
+	return ret, nil
+}
+
+// mentionsIOPosition returns whether x mentions an io_reader's position, or a
+// local variable that was assigned from one.
+func (q *checker) mentionsIOPosition(x *a.Expr) bool {
+	found := false
+	x.AsNode().Walk(func(o *a.Node) error {
+		if found || (o.Kind() != a.KExpr) {
+			return nil
+		}
+		switch o := o.AsExpr(); o.Operator() {
+		case 0:
+			_, found = q.positionVars[o.Ident()]
+		case t.IDOpenParen:
+			if m := o.LHS().AsExpr(); (m.Operator() == t.IDDot) && (m.Ident() == t.IDPosition) {
+				found = m.LHS().AsExpr().MType().Eq(typeExprIOReader)
+			}
+		}
+		return nil
+	})
+	return found
+}
+
+// notePositionVar records whether the local variable lhs was just assigned
+// from an expression that mentions an io_reader's position.
+func (q *checker) notePositionVar(lhs *a.Expr, rhs *a.Expr) {
+	if (lhs.Operator() != 0) || (q.localVars[lhs.Ident()] == nil) {
+		return
+	} else if !q.mentionsIOPosition(rhs) {
+		delete(q.positionVars, lhs.Ident())
+		return
+	}
+	if q.positionVars == nil {
+		q.positionVars = map[t.ID]struct{}{}
+	}
+	q.positionVars[lhs.Ident()] = struct{}{}
+}
+
+// addToExpr returns "x + delta", folding constants so that repeated reads
+// produce "x + 8" instead of "(x + 4) + 4".
+func (q *checker) addToExpr(x *a.Expr, delta *a.Expr) (*a.Expr, error) {
+	dcv := delta.ConstValue()
+	if dcv == nil {
+		o := a.NewExpr(0, t.IDXBinaryPlus, 0, x.AsNode(), nil, delta.AsNode(), nil)
+		o.SetMType(typeExprIdeal)
+		return o, nil
+	}
+
+	if xcv := x.ConstValue(); xcv != nil {
+		return makeConstValueExpr(q.tm, big.NewInt(0).Add(xcv, dcv))
+	}
+	sum := dcv
+	if op, xLHS, xRHS := parseBinaryOp(x); (xRHS != nil) && (xRHS.ConstValue() != nil) {
+		switch op {
+		case t.IDXBinaryPlus:
+			x, sum = xLHS, big.NewInt(0).Add(dcv, xRHS.ConstValue())
+		case t.IDXBinaryMinus:
+			x, sum = xLHS, big.NewInt(0).Sub(dcv, xRHS.ConstValue())
+		}
+	}
+
+	op := t.IDXBinaryPlus
+	switch sum.Sign() {
+	case 0:
+		return x, nil
+	case -1:
+		op, sum = t.IDXBinaryMinus, big.NewInt(0).Neg(sum)
+	}
+	c, err := makeConstValueExpr(q.tm, sum)
+	if err != nil {
+		return nil, err
+	}
+	o := a.NewExpr(0, op, 0, x.AsNode(), nil, c.AsNode(), nil)
+	o.SetMType(typeExprIdeal)
+	return o, nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file implements probe functions: the header-only part of a decoder,
+// marked by a "probe" annotation, such as:
+//
+//   pub func decoder.decode_image_config?(dst: nptr base.image_config, src: base.io_reader),
+//       probe,
+//   {
+//       etc
+//   }
+//
+// The C code generator then adds a wuffs_foo__decoder__probe function that
+// calls it and, if it completes, also reports the workbuf_len. Callers can use
+// that to plan (and allocate for) the rest of the decoding, the second pass.
+//
+// A probe function has to be able to run before the caller has a workbuf. The
+// checker verifies that it does not take a workbuf argument and that it never
+// calls a function that does, directly or indirectly (via this package's
+// other functions). Its receiver also needs a workbuf_len method.
+//
+// Each receiver has at most one probe function.
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func (c *Checker) checkFuncProbe(node *a.Node) error {
+	n := node.AsFunc()
+	if !n.Probe() {
+		return nil
+	}
+	if err := c.checkFuncProbe1(n); err != nil {
+		if _, ok := err.(*Error); ok {
+			return err
+		}
+		return &Error{
+			Err:      err,
+			Filename: n.Filename(),
+			Line:     n.Line(),
+		}
+	}
+	return nil
+}
+
+func (c *Checker) checkFuncProbe1(n *a.Func) error {
+	qqid := n.QQID()
+	recv := n.Receiver()
+	if recv.IsZero() {
+		return fmt.Errorf("check: probe function %q has no receiver", qqid.Str(c.tm))
+	}
+	if other := c.probeFuncs[recv]; other != nil {
+		return fmt.Errorf("check: %q has more than one probe function: %q and %q",
+			recv.Str(c.tm), other.QQID().Str(c.tm), qqid.Str(c.tm))
+	}
+	c.probeFuncs[recv] = n
+
+	workbuf := c.tm.ByName("workbuf")
+	if hasInParam(n, workbuf) {
+		return fmt.Errorf("check: probe function %q cannot have a workbuf argument", qqid.Str(c.tm))
+	}
+	workbufLen := c.tm.ByName("workbuf_len")
+	if f := c.funcs[t.QQID{recv[0], recv[1], workbufLen}]; (workbufLen == 0) || (f == nil) ||
+		!f.Public() || !f.Effect().Pure() || (len(f.In().Fields()) != 0) ||
+		(f.Out() == nil) || !f.Out().Eq(typeExprRangeIIU64) {
+		return fmt.Errorf("check: probe function %q's receiver has no "+
+			"\"pub func %s.workbuf_len() base.range_ii_u64\" method",
+			qqid.Str(c.tm), recv[1].Str(c.tm))
+	}
+
+	return c.walkCallGraph(n, func(caller *a.Func, callee *a.Func, call *a.Expr) (bool, error) {
+		if hasInParam(callee, workbuf) {
+			return false, fmt.Errorf("check: probe function %q cannot (via %q) call %q, "+
+				"which has a workbuf argument",
+				qqid.Str(c.tm), caller.QQID().Str(c.tm), callee.QQID().Str(c.tm))
+		}
+		return true, nil
+	})
+}
+
+// walkCallGraph walks the call graph, breadth first, from n, calling f for
+// every call (of callee, by caller) that it finds. If f returns true, the walk
+// continues into callee, provided that it is this package's function (and not
+// e.g. a built-in) and has not already been walked. An error returned by f is
+// annotated with the call's filename and line.
+func (c *Checker) walkCallGraph(n *a.Func,
+	f func(caller *a.Func, callee *a.Func, call *a.Expr) (bool, error)) error {
+
+	seen := map[*a.Func]bool{n: true}
+	worklist := []*a.Func{n}
+	for len(worklist) > 0 {
+		caller := worklist[0]
+		worklist = worklist[1:]
+		filename, line := caller.Filename(), caller.Line()
+		for _, o := range caller.Body() {
+			if err := o.Walk(func(o *a.Node) error {
+				if fn, l := o.AsRaw().FilenameLine(); fn != "" {
+					filename, line = fn, l
+				}
+				if (o.Kind() != a.KExpr) || (o.AsExpr().Operator() != a.ExprOperatorCall) {
+					return nil
+				}
+				lTyp := o.AsExpr().LHS().AsExpr().MType()
+				if !lTyp.IsFuncType() {
+					return nil
+				}
+				callee, err := c.resolveFunc(lTyp)
+				if err != nil {
+					return err
+				}
+				follow, err := f(caller, callee, o.AsExpr())
+				if err != nil {
+					return &Error{
+						Err:      err,
+						Filename: filename,
+						Line:     line,
+					}
+				}
+				if follow && !seen[callee] && (callee.Receiver()[0] == 0) && (len(callee.Body()) > 0) {
+					seen[callee] = true
+					worklist = append(worklist, callee)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hasInParam(f *a.Func, name t.ID) bool {
+	if name == 0 {
+		return false
+	}
+	for _, o := range f.In().Fields() {
+		if o.AsField().Name() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file implements public struct fields, marked by a "pub" modifier, such
+// as:
+//
+//   pub struct decoder?(
+//       pub width  : base.u32[..= 0xFF_FFFF],
+//       pub height : base.u32[..= 0xFF_FFFF],
+//       etc
+//   )
+//
+// Structs are otherwise opaque: their layout is not part of the stable API.
+// For each public field, the C code generator emits a getter function (and a
+// C++ method), such as wuffs_foo__decoder__get_width, whose name and result
+// type are stable and whose result is documented to be within the field's
+// refinement bounds. The checker already proves that every assignment to the
+// field stays within those bounds and that the zero value (the getter's result
+// for a NULL or uninitialized receiver) is also within them, so the
+// documentation cannot lie.
+//
+// Only numeric and bool fields of public structs can be public. A struct with
+// a "pub foo" field cannot also have a "get_foo" method.
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func (c *Checker) checkStructPubFields(node *a.Node) error {
+	n := node.AsStruct()
+	nQID := n.QID()
+	for _, o := range n.Fields() {
+		o := o.AsField()
+		if !o.Public() {
+			continue
+		}
+		if !n.Public() {
+			return &Error{
+				Err: fmt.Errorf("check: pub field %q in non-pub struct %q",
+					o.Name().Str(c.tm), nQID.Str(c.tm)),
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		}
+		if typ := o.XType(); (typ.Decorator() != 0) || (typ.QID()[0] != t.IDBase) ||
+			(!typ.IsNumType() && !typ.IsBool()) {
+			return &Error{
+				Err: fmt.Errorf("check: pub field %q has type %q, not a numeric or bool type",
+					o.Name().Str(c.tm), typ.Str(c.tm)),
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		}
+		getter := c.tm.ByName("get_" + o.Name().Str(c.tm))
+		if _, ok := c.funcs[t.QQID{nQID[0], nQID[1], getter}]; ok && (getter != 0) {
+			return &Error{
+				Err: fmt.Errorf("check: struct %q has both a pub field %q and a method named %q",
+					nQID.Str(c.tm), o.Name().Str(c.tm), getter.Str(c.tm)),
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file implements quantified facts about slice contents. The only form
+// is "s[.. n].all_le(bound: k)", for a constant k, which means that, for all
+// i < n, "s[i] <= k". Such a fact can only be written in an assertion (such
+// as a loop invariant), where it is proven by one of:
+//   - n is zero.
+//   - a fact "s[.. m].all_le(bound: j)" where n <= m and j <= k.
+//   - a fact "s[.. m].all_le(bound: j)" where n == m + 1 and j <= k, and "s[m]
+//     <= k" is known. This extends the fact by one element, as a verified loop
+//     over s does on each iteration.
+//
+// Once proven, the fact bounds "s[i]" by k whenever "i < n" can be proven.
+//
+// Facts about a slice's contents are otherwise fragile: any element
+// assignment, impure call or suspension could modify the elements (possibly
+// through another slice of the same memory), so all quantified facts are
+// dropped when any of those happen.
+
+import (
+	"math/big"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// parseAllLE returns the s, n and k of an "s[.. n].all_le(bound: k)"
+// expression, where k is a constant.
+func parseAllLE(x *a.Expr) (s *a.Expr, n *a.Expr, k *big.Int, ok bool) {
+	if x.Operator() != a.ExprOperatorCall {
+		return nil, nil, nil, false
+	}
+	method := x.LHS().AsExpr()
+	if (method.Operator() != t.IDDot) || (method.Ident() != t.IDAllLE) {
+		return nil, nil, nil, false
+	}
+	args := x.Args()
+	if len(args) != 1 {
+		return nil, nil, nil, false
+	}
+	k = args[0].AsArg().Value().ConstValue()
+	if k == nil {
+		return nil, nil, nil, false
+	}
+	s, lo, n, ok := method.LHS().AsExpr().IsSlice()
+	if !ok || (lo != nil) || (n == nil) {
+		return nil, nil, nil, false
+	}
+	return s, n, k, true
+}
+
+func isQuantifiedFact(x *a.Expr) bool {
+	_, _, _, ok := parseAllLE(x)
+	return ok
+}
+
+func dropQuantifiedFacts(x *a.Expr) (*a.Expr, error) {
+	if isQuantifiedFact(x) {
+		return nil, nil
+	}
+	return x, nil
+}
+
+// isShiftableFact returns whether x, a fact that mentions a variable that is
+// being incremented or decremented, can be rewritten in terms of that
+// variable's new value instead of being dropped. Those facts are quantified
+// facts and facts like "s[i] <= k", about a slice element.
+func isShiftableFact(x *a.Expr) bool {
+	if isQuantifiedFact(x) {
+		return true
+	}
+	op, lhs, rhs := parseBinaryOp(x)
+	if (op == 0) || (rhs.ConstValue() == nil) {
+		return false
+	}
+	_, _, ok := lhs.IsIndex()
+	return ok
+}
+
+func (q *checker) proveAllLE(x *a.Expr) error {
+	s, n, k, ok := parseAllLE(x)
+	if !ok {
+		return errFailed
+	}
+	if q.proveBinaryOp(t.IDXBinaryLessEq, n, zeroExpr) == nil {
+		return nil
+	}
+
+	oneExpr, err := makeConstValueExpr(q.tm, one)
+	if err != nil {
+		return err
+	}
+	nMinus1 := a.NewExpr(0, t.IDXBinaryMinus, 0, n.AsNode(), nil, oneExpr.AsNode(), nil)
+	for _, f := range q.facts.exprs() {
+		fs, m, j, ok := parseAllLE(f)
+		if !ok || (j.Cmp(k) > 0) || !fs.Eq(s) {
+			continue
+		}
+		if m.Eq(n) || (q.proveBinaryOp(t.IDXBinaryLessEq, n, m) == nil) {
+			return nil
+		}
+
+		mPlus1 := a.NewExpr(0, t.IDXBinaryPlus, 0, m.AsNode(), nil, oneExpr.AsNode(), nil)
+		if !m.Eq(nMinus1) && !n.Eq(mPlus1) {
+			continue
+		}
+		elem := a.NewExpr(0, t.IDOpenBracket, 0, s.AsNode(), nil, m.AsNode(), nil)
+		elem.SetMType(s.MType().Inner())
+		eb, err := q.bcheckTypeExpr(elem.MType())
+		if err != nil {
+			return err
+		}
+		if eb, err = q.facts.refine(elem, eb, q.tm); err != nil {
+			return err
+		}
+		if eb[1].Cmp(k) <= 0 {
+			return nil
+		}
+	}
+	return errFailed
+}
+
+// quantifiedElementBounds returns the bounds of n, an "s[i]" expression whose
+// type has bounds nb, narrowed by any quantified facts about s.
+func (q *checker) quantifiedElementBounds(n *a.Expr, nb bounds) bounds {
+	s, i := n.LHS().AsExpr(), n.RHS().AsExpr()
+	for _, f := range q.facts.exprs() {
+		fs, m, k, ok := parseAllLE(f)
+		if !ok || (k.Cmp(nb[1]) >= 0) || !fs.Eq(s) {
+			continue
+		}
+		if q.proveBinaryOp(t.IDXBinaryLessThan, i, m) == nil {
+			nb[1] = k
+		}
+	}
+	return nb
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file answers queries about what the bounds checker knows at a source
+// position, as per the "wuffs query bounds" command. The facts are recorded
+// when the bounds checker reaches the statement that contains the position.
+// The expression's MType and MBounds are simply what checking leaves in the
+// AST.
+
+import (
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// Query asks what the checker knows at a source position. Pass it as
+// Options.Query and Check fills in the Stmt, Expr and Facts fields, even if it
+// fails, such as when that position is where a proof fails.
+type Query struct {
+	// Filename, Line and Column are the position. Lines and columns are
+	// 1-based, and columns count bytes, like error messages.
+	Filename string
+	Line     uint32
+	Column   uint32
+
+	// Stmt is the innermost statement, in a function body, that contains the
+	// position. It is nil if there is none or if bounds checking did not reach
+	// it, such as when an earlier statement failed.
+	Stmt *a.Node
+
+	// Expr is the innermost expression, in Stmt, that contains the position,
+	// or nil if there is none. Its MType and MBounds are the checker's type and
+	// bounds for it. Its MBounds are zero if bounds checking did not reach it.
+	Expr *a.Expr
+
+	// Facts are the facts at the start of Stmt.
+	Facts []*a.Expr
+}
+
+// recordQuery records the facts at the start of n, if it contains the queried
+// position. The innermost statement is checked last, after any that enclose
+// it, so it overwrites what they recorded.
+func (q *checker) recordQuery(n *a.Node) {
+	z := q.c.query
+	if z == nil {
+		return
+	}
+	if filename, _ := n.AsRaw().FilenameLine(); filename != z.Filename {
+		return
+	}
+	if !n.AsRaw().Span().Contains(z.Line, z.Column) {
+		return
+	}
+	z.Stmt = n
+	z.Expr = nil
+	z.Facts = snapshot(q.facts.exprs())
+
+	// Walk visits a node before its children, and a node's children are
+	// within its span, so the last expression found is the innermost one.
+	n.Walk(func(o *a.Node) error {
+		if (o.Kind() == a.KExpr) && o.AsRaw().Span().Contains(z.Line, z.Column) {
+			z.Expr = o.AsExpr()
+		}
+		return nil
+	})
+}
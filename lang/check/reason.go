@@ -0,0 +1,100 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file lets programs that embed the checker register their own reasons,
+// alongside the built-in reasons in data.go and the lemmas in lemma.go, so
+// that they can add domain-specific proof rules without forking this package.
+// For example, a custom reason could prove that a value looked up in a CRC
+// table is less than the table's length:
+//
+//   assert x < 256 via "x < 256: crc table entry"(i: idx)
+//
+// is proved by Options.Reasons["x < 256: crc table entry"], if registered.
+
+import (
+	"fmt"
+	"sort"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Reason is a custom proof rule, registered via Options.Reasons. It is called
+// to prove an assert statement (or a pre, inv or post condition) that names it
+// after "via". It returns nil if n's condition holds, given p's facts.
+//
+// The condition and the arguments have already been type and bounds checked.
+// A Reason should not modify n or its sub-expressions.
+type Reason func(p *Prover, n *a.Assert) error
+
+// Prover is the state available to a Reason. It is only valid for the
+// duration of that Reason call.
+type Prover struct {
+	q *checker
+}
+
+// TMap returns the token map that n's identifiers refer to.
+func (p *Prover) TMap() *t.Map { return p.q.tm }
+
+// Facts returns the facts known at the assert statement. The caller should not
+// modify the returned slice.
+func (p *Prover) Facts() []*a.Expr { return p.q.facts.exprs() }
+
+// Arg returns the value of n's named argument, such as the "i" in
+// `via "etc"(i: idx)`, or nil if there is no such argument.
+func (p *Prover) Arg(n *a.Assert, name string) *a.Expr {
+	return argValue(p.q.tm, n.Args(), name)
+}
+
+// Prove proves that "lhs op rhs" holds, the same way that the built-in
+// reasons prove their requirements. The op must be a comparison XBinaryOp,
+// such as t.IDXBinaryLessThan.
+func (p *Prover) Prove(op t.ID, lhs *a.Expr, rhs *a.Expr) error {
+	return proveReasonRequirement(p.q, op, lhs, rhs)
+}
+
+// addReasons adds the custom reasons to c.reasonMap. Like the built-in
+// reasons, those whose names are not in c.tm cannot be referred to, and are
+// skipped.
+func (c *Checker) addReasons(custom map[string]Reason) error {
+	builtIns := map[string]bool{}
+	for _, r := range reasons {
+		builtIns[r.s] = true
+	}
+
+	names := []string(nil)
+	for name := range custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		r := custom[name]
+		if r == nil {
+			return fmt.Errorf("check: nil reason %q", name)
+		}
+		quoted := `"` + name + `"`
+		if builtIns[quoted] {
+			return fmt.Errorf("check: duplicate reason %s", quoted)
+		}
+		if id := c.tm.ByName(quoted); id != 0 {
+			c.reasonMap[id] = func(q *checker, n *a.Assert) error {
+				return r(&Prover{q: q}, n)
+			}
+		}
+	}
+	return nil
+}
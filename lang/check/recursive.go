@@ -0,0 +1,164 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file implements recursive coroutines, marked by a "recursive"
+// annotation, such as:
+//
+//   pri func decoder.decode_box?(src: base.io_reader, depth: base.u32[..= 3]),
+//       recursive,
+//   {
+//       etc
+//       if args.depth >= 3 {
+//           return "#too much nesting"
+//       }
+//       this.decode_box?(src: args.src, depth: args.depth + 1)
+//       etc
+//   }
+//
+// for nested formats, like ICC profiles inside PNG, where a container holds
+// other containers. A coroutine's suspension point and local variables are
+// saved in its receiver, one copy per stack frame. The depth in-param's upper
+// bound declares how many stack frames (4, in the example above) there can be
+// at once, and the C code generator indexes those copies by args.depth.
+//
+// The checker verifies that every recursive call passes a depth greater than
+// args.depth, so that a stack frame never shares its copy with a caller's.
+// That depth's refinement (like any argument's) is proven at the call site,
+// bounding the recursion. Only direct recursion is allowed: a coroutine cannot
+// call itself via other coroutines, with or without the annotation.
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func (c *Checker) checkFuncRecursion(node *a.Node) error {
+	n := node.AsFunc()
+	if !n.Effect().Coroutine() {
+		return nil
+	}
+	if err := c.checkFuncRecursion1(n); err != nil {
+		if _, ok := err.(*Error); ok {
+			return err
+		}
+		return &Error{
+			Err:      err,
+			Filename: n.Filename(),
+			Line:     n.Line(),
+		}
+	}
+	return nil
+}
+
+func (c *Checker) checkFuncRecursion1(n *a.Func) error {
+	qqid := n.QQID()
+	if n.Recursive() {
+		if n.Receiver().IsZero() {
+			return fmt.Errorf("check: recursive function %q has no receiver", qqid.Str(c.tm))
+		} else if n.RecursionDepth(c.tm) == 0 {
+			return fmt.Errorf("check: recursive function %q does not have a "+
+				"\"depth: base.u32[..= N]\" (or other unsigned integer type) in-param, "+
+				"with N less than %d", qqid.Str(c.tm), a.MaxRecursionDepth)
+		}
+	}
+
+	// Walk the coroutine call graph, breadth first, from n.
+	seen := map[*a.Func]bool{}
+	worklist := []*a.Func{n}
+	for len(worklist) > 0 {
+		caller := worklist[0]
+		worklist = worklist[1:]
+		filename, line := caller.Filename(), caller.Line()
+		for _, o := range caller.Body() {
+			if err := o.Walk(func(o *a.Node) error {
+				if fn, l := o.AsRaw().FilenameLine(); fn != "" {
+					filename, line = fn, l
+				}
+				if (o.Kind() != a.KExpr) || (o.AsExpr().Operator() != a.ExprOperatorCall) {
+					return nil
+				}
+				lTyp := o.AsExpr().LHS().AsExpr().MType()
+				if !lTyp.IsFuncType() {
+					return nil
+				}
+				callee, err := c.resolveFunc(lTyp)
+				if err != nil {
+					return err
+				}
+				if !callee.Effect().Coroutine() {
+					return nil
+				}
+				if callee == n {
+					if caller != n {
+						return &Error{
+							Err: fmt.Errorf("check: coroutine %q cannot call itself via %q",
+								qqid.Str(c.tm), caller.QQID().Str(c.tm)),
+							Filename: filename,
+							Line:     line,
+						}
+					} else if !n.Recursive() {
+						return &Error{
+							Err: fmt.Errorf("check: coroutine %q calls itself but is not recursive",
+								qqid.Str(c.tm)),
+							Filename: filename,
+							Line:     line,
+						}
+					}
+					return nil
+				}
+				if !seen[callee] && (callee.Receiver()[0] == 0) && (len(callee.Body()) > 0) {
+					seen[callee] = true
+					worklist = append(worklist, callee)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// bcheckRecursiveCall proves that the call n, from the recursive coroutine f
+// to itself, increases the depth.
+func (q *checker) bcheckRecursiveCall(f *a.Func, n *a.Expr) error {
+	depth := q.tm.ByName("depth")
+	for _, o := range n.Args() {
+		o := o.AsArg()
+		if o.Name() != depth {
+			continue
+		}
+		if !o.Value().Effect().Pure() {
+			return fmt.Errorf("check: recursive call to %q has an impure depth", f.QQID().Str(q.tm))
+		}
+
+		args := a.NewExpr(0, 0, t.IDArgs, nil, nil, nil, nil)
+		args.SetMType(q.localVars[t.IDArgs])
+		argsDepth := a.NewExpr(0, t.IDDot, depth, args.AsNode(), nil, nil, nil)
+		argsDepth.SetMType(findInParam(f, depth))
+		cond := a.NewExpr(0, t.IDXBinaryGreaterThan, 0,
+			substituteContract(o.Value(), nil, nil).AsNode(), nil, argsDepth.AsNode(), nil)
+		cond.SetMType(typeExprBool)
+		if err := q.bcheckAssertCondition(a.NewAssert(t.IDAssert, cond, 0, nil)); err != nil {
+			return fmt.Errorf("check: recursive call to %q does not increase the depth: %v",
+				f.QQID().Str(q.tm), err)
+		}
+		return nil
+	}
+	return fmt.Errorf("check: recursive call to %q has no depth argument", f.QQID().Str(q.tm))
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file implements the remote cache, which shares the persistent cache's
+// entries (see cache.go) between machines, such as a CI farm's, so that only
+// one of them has to bounds check an unchanged package, like a build cache
+// does for compiled code.
+//
+// The protocol is content-addressed GET and PUT over HTTP. An entry's URL is
+// the Options.CacheURL, a slash and the entry's key (a hex-encoded SHA-256
+// hash). A GET of that URL returns the entry's JSON with a 200 OK status, or
+// a 404 Not Found status if there is no such entry. A PUT of that URL, whose
+// body is the entry's JSON, stores it. The URL can hold a user name and
+// password for HTTP basic authentication.
+//
+// The local cache's keys identify the checker by the executable's path, size
+// and modification time, which differ from machine to machine. The remote
+// cache's keys instead identify it by a version stamp, the Options.CacheVersion
+// or, if that is empty, a hash of the executable's contents. Either way, the
+// keys also cover remoteCacheFormat, which changes whenever cacheEntry does.
+//
+// A cache hit skips bounds checking, so the remote cache has to be trusted as
+// much as the checker itself: it could otherwise vouch for unproven code.
+//
+// The cache is only an optimization. A remote cache that fails (as opposed to
+// not having an entry) is not consulted again for the rest of the Check call.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// remoteCacheFormat is part of every remote cache key. Change it whenever the
+// cacheEntry type, or how the checker interprets it, changes.
+const remoteCacheFormat = "wuffs-check-cache-v1"
+
+// remoteCacheMaxEntrySize is the largest remote cache entry that is accepted.
+const remoteCacheMaxEntrySize = 1 << 20
+
+// remoteCacheTimeout bounds each remote cache request.
+const remoteCacheTimeout = 10 * time.Second
+
+var (
+	executableDigestOnce  sync.Once
+	executableDigestValue []byte
+)
+
+// versionDigest identifies the checker for the remote cache: by the version
+// stamp, if non-empty, or else by the running executable's contents. It
+// returns nil if the executable cannot be read.
+func versionDigest(version string) []byte {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", remoteCacheFormat)
+	if version != "" {
+		fmt.Fprintf(h, "version\x00%s", version)
+		return h.Sum(nil)
+	}
+
+	executableDigestOnce.Do(func() {
+		exe, err := os.Executable()
+		if err != nil {
+			return
+		}
+		f, err := os.Open(exe)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		eh := sha256.New()
+		if _, err := io.Copy(eh, f); err != nil {
+			return
+		}
+		executableDigestValue = eh.Sum(nil)
+	})
+	if executableDigestValue == nil {
+		return nil
+	}
+	fmt.Fprintf(h, "executable\x00")
+	h.Write(executableDigestValue)
+	return h.Sum(nil)
+}
+
+type remoteCache struct {
+	baseURL string
+	client  *http.Client
+	failed  bool
+}
+
+func newRemoteCache(baseURL string) *remoteCache {
+	return &remoteCache{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: remoteCacheTimeout},
+	}
+}
+
+// get returns the entry for key, or nil if there is none.
+func (r *remoteCache) get(key string) []byte {
+	if (r == nil) || r.failed {
+		return nil
+	}
+	resp, err := r.client.Get(r.baseURL + "/" + key)
+	if err != nil {
+		r.failed = true
+		return nil
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// No-op.
+	case http.StatusNotFound:
+		return nil
+	default:
+		r.failed = true
+		return nil
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, remoteCacheMaxEntrySize+1))
+	if (err != nil) || (len(data) > remoteCacheMaxEntrySize) {
+		return nil
+	}
+	return data
+}
+
+// put stores data as the entry for key.
+func (r *remoteCache) put(key string, data []byte) {
+	if (r == nil) || r.failed {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPut, r.baseURL+"/"+key, bytes.NewReader(data))
+	if err != nil {
+		r.failed = true
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		r.failed = true
+		return
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if (resp.StatusCode < 200) || (299 < resp.StatusCode) {
+		r.failed = true
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file renders a check failure as a standalone HTML report, such as for
+// attaching to a continuous integration run. The report shows the failing
+// obligation, an excerpt of the source code and the facts at the point of
+// failure. When Options.TrackFacts is set, each fact links to the source line
+// where it was established, and the report also lists the facts that were
+// dropped (e.g. by an assignment or at a loop boundary) before the failure.
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// FactEvent records where, within the failing function, a fact was
+// established and, for a fact no longer live, dropped. A zero line number
+// means that the line is unknown.
+type FactEvent struct {
+	Fact        *a.Expr
+	Established uint32
+	Dropped     uint32
+}
+
+// factLog tracks FactEvents during bounds checking. Facts are identified by
+// pointer when established, since snapshots and resets re-add the same
+// *a.Expr values, and by structural equality when dropped.
+type factLog struct {
+	line        uint32
+	established map[*a.Expr]uint32
+	dropped     []FactEvent
+
+	// tracer is nil unless Options.FactTrace is set. See trace.go.
+	tracer    *factTracer
+	traceFunc string
+}
+
+func newFactLog(line uint32) *factLog {
+	return &factLog{
+		line:        line,
+		established: map[*a.Expr]uint32{},
+	}
+}
+
+func (g *factLog) establish(x *a.Expr) {
+	if g.tracer != nil {
+		g.traceEvent(FactTraceInsert, x, nil)
+	}
+	g.reestablish(x)
+}
+
+// reestablish is like establish, but for a fact that is not new, such as one
+// kept when the facts are re-indexed.
+func (g *factLog) reestablish(x *a.Expr) {
+	if _, ok := g.established[x]; !ok {
+		g.established[x] = g.line
+	}
+}
+
+// dropDuplicate records that x was dropped for being equal to another fact,
+// which is still live.
+func (g *factLog) dropDuplicate(x *a.Expr) {
+	if g.tracer != nil {
+		g.traceEvent(FactTraceDrop, x, nil)
+	}
+}
+
+func (g *factLog) drop(x *a.Expr) {
+	if g.tracer != nil {
+		g.traceEvent(FactTraceDrop, x, nil)
+	}
+	g.recordDrop(x)
+}
+
+// replace records that the fact x was replaced by y, such as by an
+// assignment, or dropped if y is nil.
+func (g *factLog) replace(x *a.Expr, y *a.Expr) {
+	if y == nil {
+		g.drop(x)
+		return
+	}
+	if g.tracer != nil {
+		g.traceEvent(FactTraceRefine, y, x)
+	}
+	g.recordDrop(x)
+}
+
+func (g *factLog) recordDrop(x *a.Expr) {
+	g.dropped = append(g.dropped, FactEvent{
+		Fact:        x,
+		Established: g.established[x],
+		Dropped:     g.line,
+	})
+}
+
+// factEvents returns the FactEvents for an Error, or nil if facts are not
+// being tracked.
+func (q *checker) factEvents() []FactEvent {
+	if (q.facts.log == nil) || !q.c.trackFacts {
+		return nil
+	}
+	return q.facts.log.events(q.facts.exprs())
+}
+
+// events returns the live facts' events, in order, followed by the events of
+// the dropped facts that are not live. Facts dropped more than once (such as
+// on every loop boundary) are listed once, by their last drop.
+func (g *factLog) events(live []*a.Expr) []FactEvent {
+	ret := make([]FactEvent, 0, len(live))
+	seen := map[uint64][]*a.Expr{}
+	isSeen := func(x *a.Expr) bool {
+		for _, y := range seen[x.Hash()] {
+			if x.Eq(y) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, x := range live {
+		ret = append(ret, FactEvent{Fact: x, Established: g.established[x]})
+		seen[x.Hash()] = append(seen[x.Hash()], x)
+	}
+
+	numLive := len(ret)
+	for i := len(g.dropped) - 1; i >= 0; i-- {
+		e := g.dropped[i]
+		if isSeen(e.Fact) {
+			continue
+		}
+		ret = append(ret, e)
+		seen[e.Fact.Hash()] = append(seen[e.Fact.Hash()], e.Fact)
+	}
+	// Restore the dropped events to drop order.
+	for i, j := numLive, len(ret)-1; i < j; i, j = i+1, j-1 {
+		ret[i], ret[j] = ret[j], ret[i]
+	}
+	return ret
+}
+
+// reportContextLines is the number of source lines to show before and after
+// the lines that a report refers to.
+const reportContextLines = 3
+
+// WriteHTMLReport writes e, a check failure, as a standalone HTML document.
+// The src argument is the contents of the e.Filename file. It may be nil, in
+// which case the report has no source excerpt.
+func WriteHTMLReport(w io.Writer, e *Error, src []byte) error {
+	r := &htmlReport{
+		Err:      e.Err.Error(),
+		Filename: e.Filename,
+		Line:     e.Line,
+	}
+
+	lo, hi := e.Line, e.Line
+	refer := func(line uint32) {
+		if line == 0 {
+			return
+		} else if (lo == 0) || (lo > line) {
+			lo = line
+		}
+		if hi < line {
+			hi = line
+		}
+	}
+
+	events := e.FactEvents
+	if events == nil {
+		for _, x := range e.Facts {
+			events = append(events, FactEvent{Fact: x})
+		}
+	}
+	refs := map[uint32]bool{}
+	for _, v := range events {
+		f := htmlReportFact{
+			Fact:        "?",
+			Established: v.Established,
+			Dropped:     v.Dropped,
+		}
+		if e.TMap != nil {
+			f.Fact = v.Fact.Str(e.TMap)
+		}
+		if v.Dropped == 0 {
+			r.Facts = append(r.Facts, f)
+		} else {
+			r.Dropped = append(r.Dropped, f)
+		}
+		refer(v.Established)
+		refer(v.Dropped)
+		refs[v.Established] = true
+		refs[v.Dropped] = true
+	}
+	r.Tracked = e.FactEvents != nil
+
+	if (src != nil) && (lo != 0) {
+		lo = subtractClamp(lo, reportContextLines)
+		hi += reportContextLines
+		for i, line := uint32(1), src; len(line) > 0; i++ {
+			s := line
+			if j := bytes.IndexByte(line, '\n'); j >= 0 {
+				s, line = line[:j], line[j+1:]
+			} else {
+				line = nil
+			}
+			if i < lo {
+				continue
+			} else if i > hi {
+				break
+			}
+			class := ""
+			if i == e.Line {
+				class = "fail"
+			} else if refs[i] {
+				class = "ref"
+			}
+			r.Source = append(r.Source, htmlReportLine{
+				Number: i,
+				Text:   string(s),
+				Class:  class,
+			})
+		}
+	}
+
+	return htmlReportTemplate.Execute(w, r)
+}
+
+func subtractClamp(x uint32, y uint32) uint32 {
+	if x <= y {
+		return 1
+	}
+	return x - y
+}
+
+type htmlReport struct {
+	Err      string
+	Filename string
+	Line     uint32
+	Tracked  bool
+	Facts    []htmlReportFact
+	Dropped  []htmlReportFact
+	Source   []htmlReportLine
+}
+
+type htmlReportFact struct {
+	Fact        string
+	Established uint32
+	Dropped     uint32
+}
+
+type htmlReportLine struct {
+	Number uint32
+	Text   string
+	Class  string
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Wuffs check failure: {{.Filename}}:{{.Line}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+code, pre, td.fact { font-family: monospace; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+pre { border: 1px solid #ccc; padding: 0.5em 0; }
+pre span { display: block; padding: 0 0.5em; }
+pre span:target { outline: 2px solid #36c; }
+.fail { background: #fdd; }
+.ref { background: #eef; }
+.num { color: #888; display: inline-block; width: 4em; text-align: right; margin-right: 1em; }
+</style>
+</head>
+<body>
+<h1>Wuffs check failure</h1>
+<p><a href="#L{{.Line}}">{{.Filename}}:{{.Line}}</a></p>
+<h2>Failing obligation</h2>
+<pre class="fail"><span>{{.Err}}</span></pre>
+{{- if .Source}}
+<h2>Source</h2>
+<pre>
+{{- range .Source -}}
+<span id="L{{.Number}}"{{if .Class}} class="{{.Class}}"{{end}}><a class="num" href="#L{{.Number}}">{{.Number}}</a>{{.Text}}</span>
+{{- end -}}
+</pre>
+{{- end}}
+<h2>Facts</h2>
+{{- if .Facts}}
+<table>
+<tr><th>Fact</th>{{if .Tracked}}<th>Established</th>{{end}}</tr>
+{{- range .Facts}}
+<tr><td class="fact">{{.Fact}}</td>{{if $.Tracked}}<td>{{template "line" .Established}}</td>{{end}}</tr>
+{{- end}}
+</table>
+{{- else}}
+<p>None.</p>
+{{- end}}
+{{- if .Dropped}}
+<h2>Dropped facts</h2>
+<table>
+<tr><th>Fact</th><th>Established</th><th>Dropped</th></tr>
+{{- range .Dropped}}
+<tr><td class="fact">{{.Fact}}</td><td>{{template "line" .Established}}</td><td>{{template "line" .Dropped}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+{{define "line"}}{{if .}}<a href="#L{{.}}">line {{.}}</a>{{else}}-{{end}}{{end}}`))
@@ -56,6 +56,8 @@ var (
 	typeExprRectIEU32  = a.NewTypeExpr(0, t.IDBase, t.IDRectIEU32, nil, nil, nil)
 	typeExprRectIIU32  = a.NewTypeExpr(0, t.IDBase, t.IDRectIIU32, nil, nil, nil)
 
+	typeExprOptionalU32 = a.NewTypeExpr(0, t.IDBase, t.IDOptionalU32, nil, nil, nil)
+
 	typeExprMoreInformation = a.NewTypeExpr(0, t.IDBase, t.IDMoreInformation, nil, nil, nil)
 
 	typeExprStatus = a.NewTypeExpr(0, t.IDBase, t.IDStatus, nil, nil, nil)
@@ -88,6 +90,12 @@ var (
 	typeExprARMNeonU32x4   = a.NewTypeExpr(0, t.IDBase, t.IDARMNeonU32x4, nil, nil, nil)
 	typeExprARMNeonU64x2   = a.NewTypeExpr(0, t.IDBase, t.IDARMNeonU64x2, nil, nil, nil)
 
+	typeExprARMSVEUtility = a.NewTypeExpr(0, t.IDBase, t.IDARMSVEUtility, nil, nil, nil)
+	typeExprARMSVEU8      = a.NewTypeExpr(0, t.IDBase, t.IDARMSVEU8, nil, nil, nil)
+
+	typeExprRISCVVUtility = a.NewTypeExpr(0, t.IDBase, t.IDRISCVVUtility, nil, nil, nil)
+	typeExprRISCVVU8      = a.NewTypeExpr(0, t.IDBase, t.IDRISCVVU8, nil, nil, nil)
+
 	typeExprX86SSE42Utility = a.NewTypeExpr(0, t.IDBase, t.IDX86SSE42Utility, nil, nil, nil)
 	typeExprX86M128I        = a.NewTypeExpr(0, t.IDBase, t.IDX86M128I, nil, nil, nil)
 
@@ -120,6 +128,8 @@ var builtInTypeMap = typeMap{
 	t.IDRectIEU32:  typeExprRectIEU32,
 	t.IDRectIIU32:  typeExprRectIIU32,
 
+	t.IDOptionalU32: typeExprOptionalU32,
+
 	t.IDMoreInformation: typeExprMoreInformation,
 
 	t.IDStatus: typeExprStatus,
@@ -152,12 +162,47 @@ var builtInTypeMap = typeMap{
 	t.IDARMNeonU32x4:   typeExprARMNeonU32x4,
 	t.IDARMNeonU64x2:   typeExprARMNeonU64x2,
 
+	t.IDARMSVEUtility: typeExprARMSVEUtility,
+	t.IDARMSVEU8:      typeExprARMSVEU8,
+
+	t.IDRISCVVUtility: typeExprRISCVVUtility,
+	t.IDRISCVVU8:      typeExprRISCVVU8,
+
 	t.IDX86SSE42Utility: typeExprX86SSE42Utility,
 	t.IDX86M128I:        typeExprX86M128I,
 }
 
+// The typeExprEtc values are shared by every Checker, and Checkers can run
+// concurrently, so they must not be modified after this package is
+// initialized. bcheckTypeExpr caches a type's bounds in its MBounds, so that
+// is done here, once, instead of lazily.
+func init() {
+	q := &checker{}
+	shared := []*a.TypeExpr{
+		typeExprGeneric1,
+		typeExprGeneric2,
+		typeExprIdeal,
+		typeExprList,
+		typeExprNonNullptr,
+		typeExprNullptr,
+		typeExprPackage,
+		typeExprPlaceholder,
+		typeExprTypeExpr,
+		typeExprSliceU8,
+		typeExprTableU8,
+	}
+	for _, typ := range builtInTypeMap {
+		shared = append(shared, typ)
+	}
+	for _, typ := range shared {
+		if _, err := q.bcheckTypeExpr(typ); err != nil {
+			panic(err)
+		}
+	}
+}
+
 func (c *Checker) parseBuiltInFuncs(m map[t.QQID]*a.Func, ss []string) error {
-	return builtin.ParseFuncs(c.tm, ss, func(f *a.Func) error {
+	return builtin.ParseFuncs(c.tm, c.arena, ss, func(f *a.Func) error {
 		if err := c.checkFuncSignature1(f.AsNode(), false); err != nil {
 			return err
 		}
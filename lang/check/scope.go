@@ -0,0 +1,179 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file implements dropping dead facts: facts that mention a local
+// variable that the rest of the function body no longer mentions.
+//
+// Wuffs' var statements are all at the top of a function, but many local
+// variables (such as iterate variables or loop counters) are only used within
+// a nested block, such as an if, io_bind, iterate or while body. That block is
+// the variable's scope: the innermost block that contains every mention of
+// the variable. Once the bounds checker leaves that block, no later statement
+// can mention the variable, so facts about it are dead weight: they slow down
+// matching (see facts.about) and can make otherwise equivalent if-else
+// branches' facts differ when unifying them.
+//
+// Dropping facts is always sound, as it only weakens what the bounds checker
+// assumes. Variables whose scope is the whole function body are not dropped,
+// as there is no later statement to speed up.
+
+import (
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// scopeEnds maps a block, keyed by its first statement, to the local variables
+// whose scope is that block.
+type scopeEnds map[*a.Node][]*a.Expr
+
+// findScopeEnds returns the scopeEnds for the function body.
+func findScopeEnds(body []*a.Node) scopeEnds {
+	f := &scopeFinder{
+		paths: map[t.ID][]*a.Node{},
+		seen:  map[t.ID]bool{},
+	}
+	for _, o := range body {
+		if o.Kind() != a.KVar {
+			break
+		}
+		f.paths[o.AsVar().Name()] = nil
+	}
+	if len(f.paths) == 0 {
+		return nil
+	}
+	f.doBlock(nil, body, 0)
+
+	ret := scopeEnds{}
+	for _, o := range body {
+		if o.Kind() != a.KVar {
+			break
+		}
+		name := o.AsVar().Name()
+		if path := f.paths[name]; len(path) > 1 {
+			key := path[len(path)-1]
+			ret[key] = append(ret[key], a.NewExpr(0, 0, name, nil, nil, nil, nil))
+		}
+	}
+	return ret
+}
+
+// scopeFinder tracks, for each local variable, the path (from the function
+// body, outermost first) of the blocks that contain every mention seen so far
+// of that variable. Each block is identified by its first statement.
+type scopeFinder struct {
+	paths map[t.ID][]*a.Node
+	seen  map[t.ID]bool
+}
+
+func (f *scopeFinder) doBlock(path []*a.Node, block []*a.Node, depth uint32) {
+	if (len(block) == 0) || (depth > a.MaxBodyDepth) {
+		return
+	}
+	depth++
+	path = append(path[:len(path):len(path)], block[0])
+
+	for _, o := range block {
+		switch o.Kind() {
+		case a.KVar:
+			// No-op. A var statement is not a mention.
+
+		case a.KIf:
+			for n := o.AsIf(); n != nil; n = n.ElseIf() {
+				f.doNode(path, n.Condition().AsNode())
+				f.doBlock(path, n.BodyIfTrue(), depth)
+				f.doBlock(path, n.BodyIfFalse(), depth)
+			}
+
+		case a.KIOBind:
+			n := o.AsIOBind()
+			f.doNode(path, n.IO().AsNode())
+			f.doNode(path, n.Arg1().AsNode())
+			f.doBlock(path, n.Body(), depth)
+
+		case a.KIterate:
+			for n := o.AsIterate(); n != nil; n = n.ElseIterate() {
+				for _, x := range n.Assigns() {
+					f.doNode(path, x)
+				}
+				for _, x := range n.Asserts() {
+					f.doNode(path, x)
+				}
+				f.doBlock(path, n.Body(), depth)
+			}
+
+		case a.KWhile:
+			n := o.AsWhile()
+			f.doNode(path, n.Condition().AsNode())
+			if dec := n.Decreases(); dec != nil {
+				f.doNode(path, dec.AsNode())
+			}
+			for _, x := range n.Asserts() {
+				f.doNode(path, x)
+			}
+			f.doBlock(path, n.Body(), depth)
+
+		default:
+			f.doNode(path, o)
+		}
+	}
+}
+
+// doNode records the mentions of local variables within n, a node that does
+// not contain a block.
+func (f *scopeFinder) doNode(path []*a.Node, n *a.Node) {
+	n.Walk(func(o *a.Node) error {
+		if (o.Kind() != a.KExpr) || (o.AsExpr().Operator() != 0) {
+			return nil
+		}
+		name := o.AsExpr().Ident()
+		old, ok := f.paths[name]
+		if !ok {
+			return nil
+		}
+		if !f.seen[name] {
+			f.seen[name] = true
+			f.paths[name] = path
+			return nil
+		}
+		// Keep the longest common prefix of old and path.
+		i := 0
+		for (i < len(old)) && (i < len(path)) && (old[i] == path[i]) {
+			i++
+		}
+		f.paths[name] = old[:i]
+		return nil
+	})
+}
+
+// dropOutOfScopeFacts drops the facts that mention any of the local variables
+// whose scope is block, after bounds checking it.
+func (q *checker) dropOutOfScopeFacts(block []*a.Node) error {
+	if len(block) == 0 {
+		return nil
+	}
+	vars := q.scopeEnds[block[0]]
+	if len(vars) == 0 {
+		return nil
+	}
+	return q.facts.update(func(x *a.Expr) (*a.Expr, error) {
+		for _, v := range vars {
+			if x.Mentions(v) {
+				return nil, nil
+			}
+		}
+		return x, nil
+	})
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file implements seekable functions: an animation decoder's
+// restart_frame method, marked by a "seekable" annotation, such as:
+//
+//   pub func decoder.restart_frame!(index: base.u64, io_position: base.u64) base.status,
+//       seekable,
+//   {
+//       etc
+//   }
+//
+// The annotation declares that the decoder's frames are independent: given
+// the index and io_position that decode_frame_config reported for any frame,
+// not just the first one, restart_frame can resume decoding from that frame.
+// The C code generator then adds a table of those io_positions, filled in by
+// decode_frame_config, and a wuffs_foo__decoder__seek_frame function that
+// looks a frame up in that table and calls restart_frame.
+//
+// The checker verifies the signature, that the receiver has a
+// decode_frame_config method and, as the state reset, that restart_frame
+// stores both of its arguments in the receiver's fields. It cannot suspend,
+// as it is not a coroutine, so that reset happens all at once.
+//
+// Each receiver has at most one seekable function.
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func (c *Checker) checkFuncSeekable(node *a.Node) error {
+	n := node.AsFunc()
+	if !n.Seekable() {
+		return nil
+	}
+	if err := c.checkFuncSeekable1(n); err != nil {
+		if _, ok := err.(*Error); ok {
+			return err
+		}
+		return &Error{
+			Err:      err,
+			Filename: n.Filename(),
+			Line:     n.Line(),
+		}
+	}
+	return nil
+}
+
+func (c *Checker) checkFuncSeekable1(n *a.Func) error {
+	qqid := n.QQID()
+	recv := n.Receiver()
+	if recv.IsZero() {
+		return fmt.Errorf("check: seekable function %q has no receiver", qqid.Str(c.tm))
+	}
+	if other := c.seekableFuncs[recv]; other != nil {
+		return fmt.Errorf("check: %q has more than one seekable function: %q and %q",
+			recv.Str(c.tm), other.QQID().Str(c.tm), qqid.Str(c.tm))
+	}
+	c.seekableFuncs[recv] = n
+
+	index := c.tm.ByName("index")
+	ioPosition := c.tm.ByName("io_position")
+	if in := n.In().Fields(); (n.Effect() != a.EffectImpure) ||
+		(len(in) != 2) || (index == 0) || (ioPosition == 0) ||
+		(in[0].AsField().Name() != index) || !in[0].AsField().XType().Eq(typeExprU64) ||
+		(in[1].AsField().Name() != ioPosition) || !in[1].AsField().XType().Eq(typeExprU64) ||
+		(n.Out() == nil) || !n.Out().Eq(typeExprStatus) {
+		return fmt.Errorf("check: seekable function %q does not have the signature "+
+			"\"!(index: base.u64, io_position: base.u64) base.status\"", qqid.Str(c.tm))
+	}
+
+	decodeFrameConfig := c.tm.ByName("decode_frame_config")
+	if f := c.funcs[t.QQID{recv[0], recv[1], decodeFrameConfig}]; (decodeFrameConfig == 0) ||
+		(f == nil) || !f.Public() || !f.Effect().Coroutine() || (len(f.In().Fields()) != 2) ||
+		(f.In().Fields()[0].AsField().XType().Decorator() != t.IDNptr) ||
+		!f.In().Fields()[0].AsField().XType().Inner().Eq(typeExprFrameConfig) {
+		return fmt.Errorf("check: seekable function %q's receiver has no "+
+			"\"pub func %s.decode_frame_config?(dst: nptr base.frame_config, src: base.io_reader)\" method",
+			qqid.Str(c.tm), recv[1].Str(c.tm))
+	}
+
+	for _, arg := range [2]t.ID{index, ioPosition} {
+		if !storesArg(n, arg) {
+			return fmt.Errorf("check: seekable function %q does not store args.%s in a field of \"this\"",
+				qqid.Str(c.tm), arg.Str(c.tm))
+		}
+	}
+	return nil
+}
+
+// storesArg returns whether f's body has an assignment, to a field of "this",
+// whose right hand side refers to the named argument.
+func storesArg(f *a.Func, name t.ID) bool {
+	found := false
+	for _, o := range f.Body() {
+		o.Walk(func(o *a.Node) error {
+			if found || (o.Kind() != a.KAssign) {
+				return nil
+			}
+			lhs := o.AsAssign().LHS()
+			if (lhs == nil) || (lhs.Operator() != t.IDDot) ||
+				(lhs.LHS().AsExpr().Operator() != 0) || (lhs.LHS().AsExpr().Ident() != t.IDThis) {
+				return nil
+			}
+			o.AsAssign().RHS().AsNode().Walk(func(o *a.Node) error {
+				if o.Kind() != a.KExpr {
+					return nil
+				}
+				if e := o.AsExpr(); (e.Operator() == t.IDDot) && (e.Ident() == name) &&
+					(e.LHS().AsExpr().Operator() == 0) && (e.LHS().AsExpr().Ident() == t.IDArgs) {
+					found = true
+				}
+				return nil
+			})
+			return nil
+		})
+	}
+	return found
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// position formats a location as "filename:line:column", or as
+// "filename:line" if the column is unknown.
+func position(filename string, line uint32, column uint32) string {
+	if column == 0 {
+		return fmt.Sprintf("%s:%d", filename, line)
+	}
+	return fmt.Sprintf("%s:%d:%d", filename, line, column)
+}
+
+// spanColumns returns the columns of the part of s's first line that s
+// covers. The endColumn is zero if s continues past that line.
+func spanColumns(s t.Span) (column uint32, endColumn uint32) {
+	if s.EndLine == s.Line {
+		return s.Column, s.EndColumn
+	}
+	return s.Column, 0
+}
+
+// spanError is an error about a sub-expression, whose span is more precise
+// than that of the statement being checked.
+type spanError struct {
+	err  error
+	span t.Span
+}
+
+func (e *spanError) Error() string { return e.err.Error() }
+func (e *spanError) Unwrap() error { return e.err }
+
+// errorAtExpr annotates err with n's span, if known.
+func errorAtExpr(n *a.Expr, err error) error {
+	if s := n.AsNode().AsRaw().Span(); s.Column != 0 {
+		return &spanError{err: err, span: s}
+	}
+	return err
+}
+
+// setErrNode records n as the statement (or other node) being checked, whose
+// location is used for any error.
+func (q *checker) setErrNode(n *a.Node) {
+	q.errFilename, q.errLine = n.AsRaw().FilenameLine()
+	q.errSpan = n.AsRaw().Span()
+}
+
+// newError returns err annotated with the location of the node being checked
+// or, for a spanError, that of its sub-expression.
+func (q *checker) newError(err error) *Error {
+	ret := &Error{
+		Err:      err,
+		Filename: q.errFilename,
+		Line:     q.errLine,
+	}
+	span := q.errSpan
+	if e, ok := err.(*spanError); ok {
+		ret.Err, span = e.err, e.span
+		ret.Line = span.Line
+	}
+	if span.Line == ret.Line {
+		ret.Column, ret.EndColumn = spanColumns(span)
+	}
+	return ret
+}
@@ -0,0 +1,296 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file implements specializing a private method on a constant argument.
+// A call like "this.f(bpp: const 4, x: y)" is rewritten, before any checking,
+// to "this.f__bpp_4(x: y)", where f__bpp_4 is a copy of f with that in-param
+// removed and every "args.bpp" replaced by "(4 as T)", T being the in-param's
+// type. The copy is then type and bounds checked (and code generated) like any
+// other function, so its body is proven under the constant. Programmers can
+// not declare double-underscore function names, so the copy's name cannot
+// conflict with theirs.
+//
+// The original function is removed if it is no longer called.
+
+import (
+	"fmt"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// specializedArg is a "(4 as T)" expression, replacing a removed in-param,
+// that has to be checked against that in-param's type even if the specialized
+// function body does not use it.
+type specializedArg struct {
+	value    *a.Expr
+	filename string
+	line     uint32
+}
+
+type specializer struct {
+	tm    *t.Map
+	files []*a.File
+
+	// funcs maps a receiver and function name to its declaration and the file
+	// that declares it.
+	funcs     map[t.QQID]*a.Func
+	funcFiles map[*a.Func]*a.File
+
+	// args are the arguments that each specialized copy has to check.
+	args map[*a.Func][]specializedArg
+
+	// worklist holds the functions whose bodies are yet to be scanned.
+	worklist []*a.Func
+}
+
+// specialize rewrites files' calls that have "const" arguments. It returns,
+// for each specialized copy, the arguments to check.
+func specialize(tm *t.Map, files []*a.File) (map[*a.Func][]specializedArg, error) {
+	z := &specializer{
+		tm:        tm,
+		files:     files,
+		funcs:     map[t.QQID]*a.Func{},
+		funcFiles: map[*a.Func]*a.File{},
+	}
+	for _, f := range files {
+		for _, n := range f.TopLevelDecls() {
+			if n.Kind() == a.KFunc {
+				fn := n.AsFunc()
+				z.funcs[fn.QQID()] = fn
+				z.funcFiles[fn] = f
+				z.worklist = append(z.worklist, fn)
+			}
+		}
+	}
+
+	specialized := map[*a.Func]bool{}
+	for len(z.worklist) > 0 {
+		fn := z.worklist[0]
+		z.worklist = z.worklist[1:]
+		for _, o := range fn.Body() {
+			if err := o.Walk(func(o *a.Node) error {
+				if o.Kind() != a.KExpr {
+					return nil
+				}
+				callee, err := z.specializeCall(fn, o.AsExpr())
+				if callee != nil {
+					specialized[callee] = true
+				}
+				return err
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(specialized) > 0 {
+		z.removeUncalled(specialized)
+	}
+	return z.args, nil
+}
+
+// specializeCall rewrites n, if it is a call with "const" arguments, and
+// returns the original callee.
+func (z *specializer) specializeCall(caller *a.Func, n *a.Expr) (*a.Func, error) {
+	if n.Operator() != t.IDOpenParen {
+		return nil, nil
+	}
+	numSpecialized := 0
+	for _, o := range n.Args() {
+		if o.AsArg().Specialized() {
+			numSpecialized++
+		}
+	}
+	if numSpecialized == 0 {
+		return nil, nil
+	}
+
+	lhs := n.LHS().AsExpr()
+	if (lhs.Operator() != t.IDDot) || (lhs.LHS().AsExpr().Operator() != 0) ||
+		(lhs.LHS().AsExpr().Ident() != t.IDThis) {
+		return nil, fmt.Errorf(`check: const args require a "this.method" call, not %q at %s:%d`,
+			n.Str(z.tm), caller.Filename(), caller.Line())
+	}
+	callee := z.funcs[t.QQID{0, caller.Receiver()[1], lhs.Ident()}]
+	if callee == nil {
+		return nil, fmt.Errorf(`check: cannot specialize %q: no such method at %s:%d`,
+			n.Str(z.tm), caller.Filename(), caller.Line())
+	} else if callee.Public() {
+		return nil, fmt.Errorf(`check: cannot specialize %q: %q is public at %s:%d`,
+			n.Str(z.tm), callee.FuncName().Str(z.tm), caller.Filename(), caller.Line())
+	} else if callee.Choosy() {
+		return nil, fmt.Errorf(`check: cannot specialize %q: %q is choosy at %s:%d`,
+			n.Str(z.tm), callee.FuncName().Str(z.tm), caller.Filename(), caller.Line())
+	}
+
+	// Split the args and name the copy.
+	name := strings.Builder{}
+	name.WriteString(callee.FuncName().Str(z.tm))
+	consts := map[t.ID]t.ID{}
+	remaining := []*a.Node(nil)
+	for _, o := range n.Args() {
+		o := o.AsArg()
+		if !o.Specialized() {
+			remaining = append(remaining, o.AsNode())
+			continue
+		}
+		consts[o.Name()] = o.Value().Ident()
+		name.WriteString("__")
+		name.WriteString(o.Name().Str(z.tm))
+		name.WriteString("_")
+		name.WriteString(o.Value().Ident().Str(z.tm))
+	}
+	nameID, err := z.tm.Insert(name.String())
+	if err != nil {
+		return nil, err
+	}
+
+	qqid := t.QQID{0, callee.Receiver()[1], nameID}
+	if z.funcs[qqid] == nil {
+		if err := z.copyFunc(callee, qqid, consts, caller); err != nil {
+			return nil, err
+		}
+	}
+
+	newLHS := a.NewExpr(lhs.AsNode().AsRaw().Flags(), t.IDDot, nameID, lhs.LHS(), nil, nil, nil)
+	n.AsNode().AsRaw().SetSubNodes([3]*a.Node{newLHS.AsNode(), nil, nil})
+	n.AsNode().AsRaw().SetSubLists([3][]*a.Node{remaining, nil, nil})
+	return callee, nil
+}
+
+// copyFunc adds a copy of callee, named by qqid, whose in-params named by
+// consts' keys are replaced by consts' values.
+func (z *specializer) copyFunc(callee *a.Func, qqid t.QQID, consts map[t.ID]t.ID, caller *a.Func) error {
+	fields := []*a.Node(nil)
+	types := map[t.ID]*a.TypeExpr{}
+	for _, o := range callee.In().Fields() {
+		o := o.AsField()
+		if _, ok := consts[o.Name()]; ok {
+			types[o.Name()] = o.XType()
+		} else {
+			fields = append(fields, o.AsNode())
+		}
+	}
+	if len(types) != len(consts) {
+		return fmt.Errorf(`check: cannot specialize %q: no matching in-param at %s:%d`,
+			callee.FuncName().Str(z.tm), caller.Filename(), caller.Line())
+	}
+
+	asValue := func(name t.ID) *a.Expr {
+		return a.NewExpr(0, t.IDXBinaryAs, 0,
+			a.NewExpr(0, 0, consts[name], nil, nil, nil, nil).AsNode(),
+			nil, types[name].AsNode().Clone(nil), nil)
+	}
+	replace := func(o *a.Node) *a.Node {
+		if o.Kind() != a.KExpr {
+			return nil
+		}
+		e := o.AsExpr()
+		if (e.Operator() != t.IDDot) || (e.LHS().AsExpr().Operator() != 0) ||
+			(e.LHS().AsExpr().Ident() != t.IDArgs) {
+			return nil
+		}
+		if _, ok := consts[e.Ident()]; !ok {
+			return nil
+		}
+		return asValue(e.Ident()).AsNode()
+	}
+
+	asserts := []*a.Node(nil)
+	for _, o := range callee.Asserts() {
+		// Being monotone in a removed in-param is moot.
+		if param, ok := monotoneParam(z.tm, o.AsAssert()); ok {
+			if _, ok := consts[param]; ok {
+				continue
+			}
+		}
+		asserts = append(asserts, o.Clone(replace))
+	}
+	body := make([]*a.Node, len(callee.Body()))
+	for i, o := range callee.Body() {
+		body[i] = o.Clone(replace)
+	}
+	in := a.NewStruct(0, callee.In().Filename(), callee.In().Line(), t.IDArgs, nil, fields)
+	fn := a.NewFunc(callee.AsNode().AsRaw().Flags(), callee.Filename(), callee.Line(),
+		qqid[1], qqid[2], in, callee.Out(), asserts, body)
+
+	if z.args == nil {
+		z.args = map[*a.Func][]specializedArg{}
+	}
+	for _, o := range callee.In().Fields() {
+		name := o.AsField().Name()
+		if _, ok := consts[name]; !ok {
+			continue
+		}
+		z.args[fn] = append(z.args[fn], specializedArg{
+			value:    asValue(name),
+			filename: caller.Filename(),
+			line:     caller.Line(),
+		})
+	}
+
+	f := z.funcFiles[callee]
+	z.appendDecl(f, fn.AsNode())
+	z.funcs[qqid] = fn
+	z.funcFiles[fn] = f
+	z.worklist = append(z.worklist, fn)
+	return nil
+}
+
+func (z *specializer) appendDecl(f *a.File, n *a.Node) {
+	r := f.AsNode().AsRaw()
+	l := r.SubLists()
+	l[0] = append(l[0], n)
+	r.SetSubLists(l)
+}
+
+// removeUncalled removes those specialized functions that are no longer
+// referred to.
+func (z *specializer) removeUncalled(specialized map[*a.Func]bool) {
+	referred := map[t.QQID]bool{}
+	for _, f := range z.files {
+		for _, n := range f.TopLevelDecls() {
+			if n.Kind() != a.KFunc {
+				continue
+			}
+			fn := n.AsFunc()
+			for _, o := range fn.Body() {
+				o.Walk(func(o *a.Node) error {
+					if (o.Kind() == a.KExpr) && (o.AsExpr().Operator() == t.IDDot) {
+						referred[t.QQID{0, fn.Receiver()[1], o.AsExpr().Ident()}] = true
+					}
+					return nil
+				})
+			}
+		}
+	}
+
+	for _, f := range z.files {
+		r := f.AsNode().AsRaw()
+		l := r.SubLists()
+		decls := l[0][:0]
+		for _, n := range l[0] {
+			if (n.Kind() == a.KFunc) && specialized[n.AsFunc()] && !referred[n.AsFunc().QQID()] {
+				continue
+			}
+			decls = append(decls, n)
+		}
+		l[0] = decls
+		r.SetSubLists(l)
+	}
+}
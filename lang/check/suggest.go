@@ -0,0 +1,221 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file suggests refinements: when every value that a numeric local
+// variable or struct field is ever assigned is provably within a range that
+// is tighter than its declared type, the type can be refined to that range.
+// Doing so documents the range and lets later code rely on it without
+// re-proving it.
+//
+// Local variables and fields both start at zero. The union of zero and the
+// bounds of every assignment's new value (as computed by bcheckAssignment) is
+// therefore the tightest range that the checker knows of. Fields can be
+// assigned by any of their struct's methods, so their suggestions are only
+// made after every function body has been checked.
+
+import (
+	"fmt"
+	"sort"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Suggestion is a refinement that the checker suggests adding to the type of
+// a local variable or struct field.
+type Suggestion struct {
+	Filename string
+	Line     uint32
+
+	// Name is the variable's name, such as "x", or the field's struct and
+	// name, such as "decoder.width".
+	Name string
+
+	// OldType and NewType are the declared and suggested types, such as
+	// "base.u32" and "base.u32[..= 255]".
+	OldType string
+	NewType string
+}
+
+func (s *Suggestion) String() string {
+	return fmt.Sprintf("check: %q could be refined from %s to %s at %s:%d",
+		s.Name, s.OldType, s.NewType, s.Filename, s.Line)
+}
+
+// suggestKey identifies a local variable (its function's QQID and its name)
+// or a field (its struct's QID, a zero ID and its name).
+type suggestKey struct {
+	qqid t.QQID
+	name t.ID
+}
+
+type suggestRange struct {
+	filename  string
+	line      uint32
+	name      string
+	typ       *a.TypeExpr
+	typBounds bounds
+
+	// b is the union of every assigned value's bounds.
+	b bounds
+}
+
+type suggester struct {
+	ranges map[suggestKey]*suggestRange
+}
+
+// Suggestions returns the suggested refinements, if Options.Suggest was set,
+// sorted by filename and line.
+func (c *Checker) Suggestions() []*Suggestion {
+	if c.suggester == nil {
+		return nil
+	}
+	ret := []*Suggestion(nil)
+	for _, r := range c.suggester.ranges {
+		// A single value could be a const instead.
+		if r.b[0].Cmp(r.b[1]) == 0 {
+			continue
+		}
+		// Only suggest ranges that need fewer bits than the type does, so
+		// that e.g. "x = y - 1", for a base.u32 y, does not suggest
+		// base.u32[..= 4294967294].
+		if magnitudeBitLen(r.b) >= magnitudeBitLen(r.typBounds) {
+			continue
+		}
+		ret = append(ret, &Suggestion{
+			Filename: r.filename,
+			Line:     r.line,
+			Name:     r.name,
+			OldType:  r.typ.Str(c.tm),
+			NewType:  refinedTypeStr(c.tm, r.typ, r.b),
+		})
+	}
+	sort.Slice(ret, func(i int, j int) bool {
+		if ret[i].Filename != ret[j].Filename {
+			return ret[i].Filename < ret[j].Filename
+		}
+		if ret[i].Line != ret[j].Line {
+			return ret[i].Line < ret[j].Line
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+func magnitudeBitLen(b bounds) int {
+	if n0, n1 := b[0].BitLen(), b[1].BitLen(); n0 > n1 {
+		return n0
+	} else {
+		return n1
+	}
+}
+
+func refinedTypeStr(tm *t.Map, typ *a.TypeExpr, b bounds) string {
+	s := typ.QID().Str(tm)
+	if b[0].Sign() == 0 {
+		return fmt.Sprintf("%s[..= %v]", s, b[1])
+	}
+	return fmt.Sprintf("%s[%v ..= %v]", s, b[0], b[1])
+}
+
+func (z *suggester) union(key suggestKey, b bounds) {
+	if r := z.ranges[key]; r != nil {
+		r.b = bounds{min(r.b[0], b[0]), max(r.b[1], b[1])}
+	}
+}
+
+// suggestVar starts tracking a local variable. Its implicit "= 0" assignment
+// is then recorded by suggestAssignment, like any other.
+func (q *checker) suggestVar(n *a.Var) error {
+	z := q.c.suggester
+	if (z == nil) || (q.astFunc == nil) || !n.XType().IsNumType() {
+		return nil
+	}
+	key := suggestKey{q.astFunc.QQID(), n.Name()}
+	if _, ok := z.ranges[key]; ok {
+		return nil
+	}
+	tb, err := q.bcheckTypeExpr(n.XType())
+	if err != nil {
+		return err
+	}
+	z.ranges[key] = &suggestRange{
+		filename:  n.Filename(),
+		line:      n.Line(),
+		name:      n.Name().Str(q.tm),
+		typ:       n.XType(),
+		typBounds: tb,
+		b:         bounds{zero, zero},
+	}
+	return nil
+}
+
+// suggestAssignment records that lhs is assigned a value within nb.
+func (q *checker) suggestAssignment(lhs *a.Expr, nb bounds) error {
+	z := q.c.suggester
+	if (z == nil) || (nb[0] == nil) || !lhs.MType().IsNumType() {
+		return nil
+	}
+
+	switch lhs.Operator() {
+	case 0:
+		if q.astFunc != nil {
+			z.union(suggestKey{q.astFunc.QQID(), lhs.Ident()}, nb)
+		}
+
+	case t.IDDot:
+		typ := lhs.LHS().AsExpr().MType()
+		if (typ.Decorator() == t.IDPtr) || (typ.Decorator() == t.IDNptr) {
+			typ = typ.Inner()
+		}
+		if typ.Decorator() != 0 {
+			return nil
+		}
+		qid := typ.QID()
+		s := q.c.structs[qid]
+		if (s == nil) || (qid[0] != 0) {
+			return nil
+		}
+		key := suggestKey{t.QQID{qid[0], qid[1], 0}, lhs.Ident()}
+		if _, ok := z.ranges[key]; !ok {
+			for _, f := range s.Fields() {
+				f := f.AsField()
+				if (f.Name() != lhs.Ident()) || f.PrivateData() || !f.XType().IsNumType() {
+					continue
+				}
+				tb, err := q.bcheckTypeExpr(f.XType())
+				if err != nil {
+					return err
+				}
+				filename, line := f.AsNode().AsRaw().FilenameLine()
+				if filename == "" {
+					filename, line = s.Filename(), s.Line()
+				}
+				z.ranges[key] = &suggestRange{
+					filename:  filename,
+					line:      line,
+					name:      qid[1].Str(q.tm) + "." + f.Name().Str(q.tm),
+					typ:       f.XType(),
+					typBounds: tb,
+					b:         bounds{zero, zero},
+				}
+				break
+			}
+		}
+		z.union(key, nb)
+	}
+	return nil
+}
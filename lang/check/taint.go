@@ -0,0 +1,710 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file deals with taint tracking, an opt-in hardening profile selected by
+// a "pragma taint required" top-level declaration. Under it, every value
+// derived from untrusted input bytes (a tainted value) must be explicitly
+// clamped before it is used as an array or slice index, even if the bounds
+// checker can already prove that the index is in range. That explicit clamp is
+// a second, run-time line of defense, independent of the prover.
+//
+// The sources of taint are:
+//   - io_reader methods that read bytes, such as read_u8 and peek_u32le, and
+//     the io_reader.since slice.
+//   - the elements of a public function's "slice base.u8" arguments.
+//
+// Taint flows through most arithmetic and through assignments, including to
+// struct fields, array elements and other functions' arguments and results.
+// A tainted value is clamped (no longer tainted) by:
+//   - "x & m", "x % m" or "x.min(a: m)", where m is not tainted.
+//   - an "if x < m" or "if x <= m" check (or "while" condition), within the
+//     guarded block, where x is a local variable or argument and m is not
+//     tainted. Similarly, "if x >= m" clamps x in the "else" block.
+//
+// Asserts and refinement types do not clamp, as they rely on the prover.
+//
+// Local variables and arguments are tracked per statement, with a forward
+// dataflow pass over the function body, similar to findDeadStores. Struct
+// fields, which outlive a function call, and each function's arguments (on
+// entry) and result are tracked per package: a field is tainted if any
+// assignment to it is, and the analysis repeats over all of the package's
+// functions until that reaches a steady state.
+
+import (
+	"fmt"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// taintAnalysis is the per-package taint state.
+type taintAnalysis struct {
+	// args holds, for each function, which arguments can be tainted on entry.
+	args map[*a.Func]map[t.ID]bool
+	// fields is keyed by the struct's QID and the field's name.
+	fields map[t.QQID]bool
+	// results holds which functions can return a tainted value.
+	results map[*a.Func]bool
+
+	changed bool
+}
+
+func (z *taintAnalysis) setArg(f *a.Func, name t.ID) {
+	m := z.args[f]
+	if m == nil {
+		m = map[t.ID]bool{}
+		z.args[f] = m
+	}
+	if !m[name] {
+		m[name] = true
+		z.changed = true
+	}
+}
+
+func (z *taintAnalysis) setField(key t.QQID) {
+	if !z.fields[key] {
+		z.fields[key] = true
+		z.changed = true
+	}
+}
+
+func (z *taintAnalysis) setResult(f *a.Func) {
+	if !z.results[f] {
+		z.results[f] = true
+		z.changed = true
+	}
+}
+
+// taintVar is a local variable or, if arg is true, an argument.
+type taintVar struct {
+	arg  bool
+	name t.ID
+}
+
+// taintState holds which local variables and arguments are tainted. A nil
+// taintState means that the code is unreachable, e.g. after a return or
+// break.
+type taintState map[taintVar]bool
+
+func (p taintState) clone() taintState {
+	if p == nil {
+		return nil
+	}
+	ret := make(taintState, len(p))
+	for k, v := range p {
+		ret[k] = v
+	}
+	return ret
+}
+
+// reconcile returns the union of p and s, and whether that union differs from
+// p.
+func (p taintState) reconcile(s taintState) (ret taintState, changed bool) {
+	if s == nil {
+		return p, false
+	} else if p == nil {
+		return s.clone(), true
+	}
+	for k, v := range s {
+		if v && !p[k] {
+			p[k] = true
+			changed = true
+		}
+	}
+	return p, changed
+}
+
+type loopTaintStates struct {
+	breaks    taintState
+	continues taintState
+}
+
+type taintHelper struct {
+	c     *Checker
+	z     *taintAnalysis
+	f     *a.Func
+	loops map[a.Loop]*loopTaintStates
+
+	// report is whether to return an error for the first tainted index,
+	// instead of only updating z.
+	report bool
+}
+
+// checkFuncTaint checks, if the package has a "pragma taint required", that
+// no index in n's body is tainted.
+func (c *Checker) checkFuncTaint(node *a.Node) error {
+	if c.taint == nil {
+		return nil
+	}
+	n := node.AsFunc()
+	if c.taintAnalysis == nil {
+		z, err := c.analyzeTaint()
+		if err != nil {
+			return &Error{
+				Err:      err,
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		}
+		c.taintAnalysis = z
+	}
+
+	h := &taintHelper{c: c, z: c.taintAnalysis, f: n, report: true}
+	if err := h.doFunc(); err != nil {
+		if _, ok := err.(*Error); ok {
+			return err
+		}
+		return &Error{
+			Err:      err,
+			Filename: n.Filename(),
+			Line:     n.Line(),
+		}
+	}
+	return nil
+}
+
+// analyzeTaint repeatedly analyzes the package's functions until which
+// fields, arguments and results can be tainted reaches a steady state.
+func (c *Checker) analyzeTaint() (*taintAnalysis, error) {
+	z := &taintAnalysis{
+		args:    map[*a.Func]map[t.ID]bool{},
+		fields:  map[t.QQID]bool{},
+		results: map[*a.Func]bool{},
+	}
+	for z.changed = true; z.changed; {
+		z.changed = false
+		for qqid, f := range c.funcs {
+			if qqid[0] != 0 {
+				// Skip built-in and used packages' functions.
+				continue
+			}
+			h := &taintHelper{c: c, z: z, f: f}
+			if err := h.doFunc(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return z, nil
+}
+
+func (h *taintHelper) doFunc() error {
+	h.loops = map[a.Loop]*loopTaintStates{}
+	p := taintState{}
+	for _, o := range h.f.In().Fields() {
+		o := o.AsField()
+		if h.z.args[h.f][o.Name()] || (h.f.Public() && o.XType().Eq(typeExprSliceU8)) {
+			p[taintVar{arg: true, name: o.Name()}] = true
+		}
+	}
+	_, err := h.doBlock(p, h.f.Body(), 0)
+	return err
+}
+
+func (h *taintHelper) doBlock(p taintState, block []*a.Node, depth uint32) (taintState, error) {
+	if depth > a.MaxBodyDepth {
+		return nil, fmt.Errorf("check: body recursion depth too large")
+	}
+	depth++
+
+	for _, o := range block {
+		if p == nil {
+			break
+		}
+		err := error(nil)
+		switch o.Kind() {
+		case a.KAssert:
+			o := o.AsAssert()
+			if _, err = h.doExpr(p, o.Condition(), 0); err != nil {
+				break
+			}
+			for _, arg := range o.Args() {
+				if _, err = h.doExpr(p, arg.AsArg().Value(), 0); err != nil {
+					break
+				}
+			}
+
+		case a.KAssign:
+			err = h.doAssign(p, o.AsAssign())
+
+		case a.KExpr:
+			_, err = h.doExpr(p, o.AsExpr(), 0)
+
+		case a.KIOBind:
+			o := o.AsIOBind()
+			if _, err = h.doExpr(p, o.IO(), 0); err != nil {
+				break
+			}
+			if _, err = h.doExpr(p, o.Arg1(), 0); err != nil {
+				break
+			}
+			p, err = h.doBlock(p, o.Body(), depth)
+
+		case a.KIf:
+			p, err = h.doIf(p, o.AsIf(), depth)
+
+		case a.KIterate:
+			p, err = h.doIterate(p, o.AsIterate(), depth)
+
+		case a.KJump:
+			err = h.doJump(p, o.AsJump())
+			p = nil
+
+		case a.KRet:
+			o := o.AsRet()
+			tainted := false
+			if tainted, err = h.doExpr(p, o.Value(), 0); err != nil {
+				break
+			}
+			if tainted {
+				h.z.setResult(h.f)
+			}
+			if o.Keyword() == t.IDReturn {
+				p = nil
+			}
+
+		case a.KVar:
+			delete(p, taintVar{name: o.AsVar().Name()})
+
+		case a.KWhile:
+			p, err = h.doWhile(p, o.AsWhile(), depth)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (h *taintHelper) doAssign(p taintState, n *a.Assign) error {
+	tainted, err := h.doExpr(p, n.RHS(), 0)
+	if err != nil {
+		return err
+	}
+	lhs := n.LHS()
+	if lhs == nil {
+		return nil
+	}
+	if (lhs.Operator() != 0) || ((n.Operator() != t.IDEq) && (n.Operator() != t.IDEqQuestion)) {
+		// Check any index on the LHS, such as "this.a[i] = etc", and the LHS
+		// value itself for an operator like "+=".
+		lTainted, err := h.doExpr(p, lhs, 0)
+		if err != nil {
+			return err
+		}
+		switch n.Operator() {
+		case t.IDEq, t.IDEqQuestion:
+			// No-op.
+		case t.IDAmpEq, t.IDPercentEq:
+			tainted = tainted && lTainted
+		default:
+			tainted = tainted || lTainted
+		}
+	}
+
+	if v, ok := taintVarOf(lhs); ok {
+		if taintRootOf(lhs) == lhs {
+			// The whole local variable or argument is overwritten.
+			p[v] = tainted
+		} else if tainted {
+			p[v] = true
+		}
+	} else if tainted {
+		h.taintRoot(p, lhs)
+	}
+	return nil
+}
+
+// taintRoot taints the variable, argument or field that n is part of, such as
+// "this.buf" for "this.buf[i .. j]".
+func (h *taintHelper) taintRoot(p taintState, n *a.Expr) {
+	r := taintRootOf(n)
+	if r == nil {
+		return
+	}
+	if v, ok := taintVarOf(r); ok {
+		p[v] = true
+	} else if key, ok := h.fieldKey(r); ok {
+		h.z.setField(key)
+	}
+}
+
+// taintRootOf returns the variable, argument or field that n is part of, or
+// nil if there is none, such as for the result of a function call.
+func taintRootOf(n *a.Expr) *a.Expr {
+	for {
+		switch n.Operator() {
+		case 0:
+			return n
+		case a.ExprOperatorSelector:
+			if lhs := n.LHS().AsExpr(); (lhs.Operator() == 0) &&
+				((lhs.Ident() == t.IDThis) || (lhs.Ident() == t.IDArgs)) {
+				return n
+			}
+			n = n.LHS().AsExpr()
+		case a.ExprOperatorIndex, a.ExprOperatorSlice:
+			n = n.LHS().AsExpr()
+		default:
+			return nil
+		}
+	}
+}
+
+// taintVarOf returns the local variable or argument that n is part of.
+func taintVarOf(n *a.Expr) (taintVar, bool) {
+	r := taintRootOf(n)
+	if r == nil {
+		return taintVar{}, false
+	}
+	if r.Operator() == 0 {
+		switch r.Ident() {
+		case t.IDThis, t.IDArgs, t.IDCoroutineResumed:
+			return taintVar{}, false
+		}
+		return taintVar{name: r.Ident()}, true
+	}
+	if r.LHS().AsExpr().Ident() == t.IDArgs {
+		return taintVar{arg: true, name: r.Ident()}, true
+	}
+	return taintVar{}, false
+}
+
+// fieldKey returns the key, in taintAnalysis.fields, of a "this.etc" field.
+func (h *taintHelper) fieldKey(n *a.Expr) (t.QQID, bool) {
+	if (n.Operator() != a.ExprOperatorSelector) || (n.LHS().AsExpr().Ident() != t.IDThis) {
+		return t.QQID{}, false
+	}
+	recv := h.f.Receiver()
+	return t.QQID{recv[0], recv[1], n.Ident()}, true
+}
+
+// doExpr returns whether n is tainted. In report mode, it also returns an
+// error if n, or a sub-expression, has a tainted index.
+func (h *taintHelper) doExpr(p taintState, n *a.Expr, depth uint32) (bool, error) {
+	if n == nil {
+		return false, nil
+	}
+	if depth > a.MaxExprDepth {
+		return false, fmt.Errorf("check: expression recursion depth too large")
+	}
+	depth++
+
+	switch op := n.Operator(); op {
+	case 0:
+		if v, ok := taintVarOf(n); ok {
+			return p[v], nil
+		}
+		return false, nil
+
+	case a.ExprOperatorCall:
+		return h.doCall(p, n, depth)
+
+	case a.ExprOperatorIndex:
+		lTainted, err := h.doExpr(p, n.LHS().AsExpr(), depth)
+		if err != nil {
+			return false, err
+		}
+		index := n.RHS().AsExpr()
+		iTainted, err := h.doExpr(p, index, depth)
+		if err != nil {
+			return false, err
+		}
+		if iTainted && h.report {
+			filename, line := index.AsNode().AsRaw().FilenameLine()
+			column, endColumn := spanColumns(index.AsNode().AsRaw().Span())
+			return false, &Error{
+				Err: fmt.Errorf("check: index %q is derived from input bytes and is not clamped, "+
+					"as required by the pragma taint at %s:%d",
+					index.Str(h.c.tm), h.c.taint.Filename(), h.c.taint.Line()),
+				Filename:  filename,
+				Line:      line,
+				Column:    column,
+				EndColumn: endColumn,
+			}
+		}
+		return lTainted, nil
+
+	case a.ExprOperatorSelector:
+		if v, ok := taintVarOf(n); ok && (taintRootOf(n) == n) {
+			return p[v], nil
+		}
+		if key, ok := h.fieldKey(n); ok {
+			return h.z.fields[key], nil
+		}
+		return h.doExpr(p, n.LHS().AsExpr(), depth)
+
+	case t.IDXBinaryAmp, t.IDXBinaryPercent, t.IDXAssociativeAmp:
+		// Masking with, or taking the modulus of, an untainted value clamps.
+		return h.doOperands(p, n, depth, true)
+
+	case t.IDXBinaryNotEq, t.IDXBinaryLessThan, t.IDXBinaryLessEq, t.IDXBinaryEqEq,
+		t.IDXBinaryGreaterEq, t.IDXBinaryGreaterThan,
+		t.IDXBinaryAnd, t.IDXBinaryOr, t.IDXAssociativeAnd, t.IDXAssociativeOr, t.IDXUnaryNot:
+		// Booleans are not indexes.
+		_, err := h.doOperands(p, n, depth, false)
+		return false, err
+	}
+	return h.doOperands(p, n, depth, false)
+}
+
+// doOperands returns whether any (or, if all is true, every) one of n's
+// operands is tainted.
+func (h *taintHelper) doOperands(p taintState, n *a.Expr, depth uint32, all bool) (bool, error) {
+	operands := []*a.Expr(nil)
+	for _, o := range []*a.Node{n.LHS(), n.MHS(), n.RHS()} {
+		if (o != nil) && (o.Kind() == a.KExpr) {
+			operands = append(operands, o.AsExpr())
+		}
+	}
+	for _, o := range n.Args() {
+		if o.Kind() == a.KExpr {
+			operands = append(operands, o.AsExpr())
+		}
+	}
+
+	ret := all && (len(operands) > 0)
+	for _, o := range operands {
+		tainted, err := h.doExpr(p, o, depth)
+		if err != nil {
+			return false, err
+		}
+		if all {
+			ret = ret && tainted
+		} else {
+			ret = ret || tainted
+		}
+	}
+	return ret, nil
+}
+
+func (h *taintHelper) doCall(p taintState, n *a.Expr, depth uint32) (bool, error) {
+	method := n.LHS().AsExpr()
+	if (method.Operator() != a.ExprOperatorSelector) || (method.LHS().AsExpr().MType() == nil) {
+		return h.doOperands(p, n, depth, false)
+	}
+	recv := method.LHS().AsExpr()
+	rTainted, err := h.doExpr(p, recv, depth)
+	if err != nil {
+		return false, err
+	}
+
+	argsTainted := false
+	taintedArgs := map[t.ID]*a.Expr{}
+	for _, o := range n.Args() {
+		o := o.AsArg()
+		tainted, err := h.doExpr(p, o.Value(), depth)
+		if err != nil {
+			return false, err
+		}
+		if tainted {
+			argsTainted = true
+			taintedArgs[o.Name()] = o.Value()
+		}
+	}
+
+	rTyp := recv.MType()
+	name := method.Ident()
+	nameStr := name.Str(h.c.tm)
+
+	if (rTyp.Decorator() == 0) && (rTyp.QID() == t.QID{t.IDBase, t.IDIOReader}) {
+		switch {
+		case strings.HasPrefix(nameStr, "read_u"), strings.HasPrefix(nameStr, "peek_u"), name == t.IDSince:
+			return true, nil
+		case name == t.IDLimitedCopyU32ToSlice:
+			for _, o := range n.Args() {
+				if o := o.AsArg(); o.Name().Str(h.c.tm) == "s" {
+					h.taintRoot(p, o.Value())
+				}
+			}
+		}
+		return argsTainted, nil
+	}
+
+	if rTyp.IsSliceType() || rTyp.IsArrayType() {
+		if name == t.IDCopyFromSlice {
+			if argsTainted {
+				h.taintRoot(p, recv)
+			}
+			return false, nil
+		}
+		if strings.HasPrefix(nameStr, "peek_") {
+			return rTainted, nil
+		}
+		return argsTainted, nil
+	}
+
+	if rTyp.IsNumType() {
+		if name == t.IDMin {
+			return rTainted && argsTainted, nil
+		}
+		return rTainted || argsTainted, nil
+	}
+
+	f, err := h.c.resolveFunc(method.MType())
+	if (err != nil) || (f.QQID()[0] != 0) {
+		// A built-in or used package's function.
+		return argsTainted, nil
+	}
+	for name := range taintedArgs {
+		h.z.setArg(f, name)
+	}
+	return h.z.results[f], nil
+}
+
+func (h *taintHelper) doIf(p taintState, n *a.If, depth uint32) (taintState, error) {
+	if _, err := h.doExpr(p, n.Condition(), 0); err != nil {
+		return nil, err
+	}
+
+	ifTrue, err := h.doBlock(h.clamp(p.clone(), n.Condition(), true), n.BodyIfTrue(), depth)
+	if err != nil {
+		return nil, err
+	}
+
+	ifFalse := taintState(nil)
+	if n.ElseIf() != nil {
+		ifFalse, err = h.doIf(h.clamp(p, n.Condition(), false), n.ElseIf(), depth)
+	} else {
+		ifFalse, err = h.doBlock(h.clamp(p, n.Condition(), false), n.BodyIfFalse(), depth)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ret, _ := ifFalse.reconcile(ifTrue)
+	return ret, nil
+}
+
+// clamp marks the variables that cond clamps, when cond is (or, if ifTrue is
+// false, is not) true, as no longer tainted. It modifies and returns p.
+func (h *taintHelper) clamp(p taintState, cond *a.Expr, ifTrue bool) taintState {
+	if p == nil {
+		return nil
+	}
+	switch op := cond.Operator(); op {
+	case t.IDXBinaryAnd, t.IDXBinaryOr:
+		if (op == t.IDXBinaryAnd) == ifTrue {
+			h.clamp(p, cond.LHS().AsExpr(), ifTrue)
+			h.clamp(p, cond.RHS().AsExpr(), ifTrue)
+		}
+		return p
+	case t.IDXAssociativeAnd, t.IDXAssociativeOr:
+		if (op == t.IDXAssociativeAnd) == ifTrue {
+			for _, o := range cond.Args() {
+				h.clamp(p, o.AsExpr(), ifTrue)
+			}
+		}
+		return p
+	case t.IDXUnaryNot:
+		return h.clamp(p, cond.RHS().AsExpr(), !ifTrue)
+	}
+
+	// Find the "x" that is less than (or equal to) the untainted "m".
+	x, m := (*a.Expr)(nil), (*a.Expr)(nil)
+	switch cond.Operator() {
+	case t.IDXBinaryLessThan, t.IDXBinaryLessEq:
+		x, m = cond.LHS().AsExpr(), cond.RHS().AsExpr()
+	case t.IDXBinaryGreaterThan, t.IDXBinaryGreaterEq:
+		x, m = cond.RHS().AsExpr(), cond.LHS().AsExpr()
+	default:
+		return p
+	}
+	if !ifTrue {
+		x, m = m, x
+	}
+	v, ok := taintVarOf(x)
+	if !ok || (taintRootOf(x) != x) {
+		return p
+	}
+	// The condition has already been checked, so this cannot fail.
+	saved := h.report
+	h.report = false
+	mTainted, _ := h.doExpr(p, m, 0)
+	h.report = saved
+	if !mTainted {
+		p[v] = false
+	}
+	return p
+}
+
+func (h *taintHelper) doIterate(p taintState, n *a.Iterate, depth uint32) (taintState, error) {
+	for _, o := range n.Assigns() {
+		if err := h.doAssign(p, o.AsAssign()); err != nil {
+			return nil, err
+		}
+	}
+
+	// Every round of an iterate loop, including the else-iterate rounds, runs
+	// its body zero or more times.
+	ret := taintState(nil)
+	for ; n != nil; n = n.ElseIterate() {
+		before := p.clone()
+		l := &loopTaintStates{}
+		h.loops[n] = l
+		for changed := true; changed; {
+			r, err := h.doBlock(before.clone(), n.Body(), depth)
+			if err != nil {
+				return nil, err
+			}
+			r, _ = r.reconcile(l.continues)
+			before, changed = before.reconcile(r)
+		}
+		ret, _ = ret.reconcile(before)
+		ret, _ = ret.reconcile(l.breaks)
+	}
+	return ret, nil
+}
+
+func (h *taintHelper) doJump(p taintState, n *a.Jump) error {
+	l := h.loops[n.JumpTarget()]
+	if l == nil {
+		return fmt.Errorf("check: unrecognized jump target")
+	}
+	switch n.Keyword() {
+	case t.IDBreak:
+		l.breaks, _ = l.breaks.reconcile(p)
+	case t.IDContinue:
+		l.continues, _ = l.continues.reconcile(p)
+	default:
+		return fmt.Errorf("check: unrecognized ast.Jump keyword")
+	}
+	return nil
+}
+
+func (h *taintHelper) doWhile(p taintState, n *a.While, depth uint32) (taintState, error) {
+	l := &loopTaintStates{}
+	h.loops[n] = l
+
+	before := p
+	for changed := true; changed; {
+		if _, err := h.doExpr(before, n.Condition(), 0); err != nil {
+			return nil, err
+		}
+		r, err := h.doBlock(h.clamp(before.clone(), n.Condition(), true), n.Body(), depth)
+		if err != nil {
+			return nil, err
+		}
+		r, _ = r.reconcile(l.continues)
+		before, changed = before.reconcile(r)
+	}
+
+	ret := taintState(nil)
+	if !n.IsWhileTrue() {
+		ret = h.clamp(before.clone(), n.Condition(), false)
+	}
+	ret, _ = ret.reconcile(l.breaks)
+	return ret, nil
+}
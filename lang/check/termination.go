@@ -0,0 +1,366 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file proves that while loops terminate. A while loop can have a
+// decreases clause, such as:
+//
+//	while n > 0,
+//		decreases n,
+//	{
+//		etc
+//		n -= 1
+//	} endwhile
+//
+// The decreases expression (the variant) must be non-negative at the start of
+// each iteration and, on each continue (implicit or explicit), strictly less
+// than it was at the start of that iteration. As it is an integer, the loop
+// cannot iterate forever.
+//
+// The variant's value at the start of the iteration is a ghost value, named
+// "decreases", that no Wuffs code can refer to. Entering the loop body adds
+// the ghost fact "decreases >= variant". Like other facts, it is dropped when
+// assigning to anything that it mentions, except that "+=" and "-=" rewrite
+// it. For example, "n -= 1" turns "decreases >= n" into "decreases >= n + 1".
+// Subtracting a non-constant, such as "n -= k", uses the bounds of k at that
+// statement: if k is at least 2 then "decreases >= n" becomes "decreases >= n
+// + 2". Either way, the ghost fact's right hand side is always the variant
+// shifted by constants, so proving "variant < decreases" only needs constant
+// arithmetic, treating both sides as linear combinations of terms.
+//
+// Facts are reset at the start of a loop body, so only the innermost loop's
+// ghost fact is live. An inner loop resets the facts on exit too, but the
+// outer loop's ghost fact is restored afterwards, if nothing within the inner
+// loop can modify what the ghost fact mentions.
+
+import (
+	"fmt"
+	"math/big"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+var exprDecreases = newDecreasesGhost()
+
+func newDecreasesGhost() *a.Expr {
+	x := a.NewExpr(0, 0, t.IDDecreases, nil, nil, nil, nil)
+	x.SetMBounds(bounds{zero, maxIdeal})
+	x.SetMType(typeExprIdeal)
+	return x
+}
+
+// isDecreasesFact returns whether x is a "decreases >= etc" ghost fact.
+func isDecreasesFact(x *a.Expr) bool {
+	return (x.Operator() == t.IDXBinaryGreaterEq) && x.LHS().AsExpr().Eq(exprDecreases)
+}
+
+// bcheckVariant is like bcheckExpr, but the variant's arithmetic (addition,
+// subtraction and multiplication) is on ideal (arbitrary precision) integers.
+// For example, "args.length - i" does not need to prove "i <= args.length"
+// just to bounds check the subtraction, since it is never evaluated at run
+// time.
+func (q *checker) bcheckVariant(n *a.Expr, depth uint32) (bounds, error) {
+	if depth > a.MaxExprDepth {
+		return bounds{}, fmt.Errorf("check: expression recursion depth too large")
+	}
+	depth++
+
+	if b := n.MBounds(); b[0] != nil {
+		return b, nil
+	}
+	switch n.Operator() {
+	case t.IDXBinaryPlus, t.IDXBinaryMinus, t.IDXBinaryStar:
+		if _, err := q.bcheckVariant(n.LHS().AsExpr(), depth); err != nil {
+			return bounds{}, err
+		}
+		if _, err := q.bcheckVariant(n.RHS().AsExpr(), depth); err != nil {
+			return bounds{}, err
+		}
+	case t.IDXUnaryPlus, t.IDXUnaryMinus:
+		if _, err := q.bcheckVariant(n.RHS().AsExpr(), depth); err != nil {
+			return bounds{}, err
+		}
+	case t.IDXAssociativePlus, t.IDXAssociativeStar:
+		for _, o := range n.Args() {
+			if _, err := q.bcheckVariant(o.AsExpr(), depth); err != nil {
+				return bounds{}, err
+			}
+		}
+	default:
+		return q.bcheckExpr(n, depth)
+	}
+
+	// The operands' bounds are now cached, so bcheckExpr1 only combines them.
+	nb, err := q.bcheckExpr1(n, depth)
+	if err != nil {
+		return bounds{}, err
+	}
+	n.SetMBounds(nb)
+	return nb, nil
+}
+
+// bcheckDecreasesEntry proves that n's variant is non-negative and adds the
+// ghost fact, assuming the facts at the start of n's body.
+func (q *checker) bcheckDecreasesEntry(n *a.While) error {
+	dec := n.Decreases()
+	if err := dec.DropCachedMBounds(); err != nil {
+		return err
+	}
+	if _, err := q.bcheckVariant(dec, 0); err != nil {
+		return err
+	}
+
+	ok := q.proveBinaryOp(t.IDXBinaryGreaterEq, dec, zeroExpr) == nil
+	if op, lhs, rhs := parseBinaryOp(dec); !ok && (op == t.IDXBinaryMinus) {
+		// "x - y >= 0" is equivalent to "y <= x", which is more likely to be
+		// a fact, such as a loop condition.
+		ok = (q.proveBinaryOp(t.IDXBinaryLessEq, rhs, lhs) == nil) ||
+			(q.proveBinaryOp(t.IDXBinaryGreaterEq, lhs, rhs) == nil)
+	}
+	if !ok {
+		return fmt.Errorf("check: cannot prove that the decreases expression %q is non-negative",
+			dec.Str(q.tm))
+	}
+
+	q.facts.appendBinaryOpFact(t.IDXBinaryGreaterEq, newDecreasesGhost(), dec)
+	return nil
+}
+
+// proveDecreases proves that n's variant is less than the ghost value, on a
+// continue (implicit or explicit) of n.
+func (q *checker) proveDecreases(n *a.While) error {
+	dec := n.Decreases()
+	for _, x := range q.facts.exprs() {
+		if !isDecreasesFact(x) {
+			continue
+		}
+		start := x.RHS().AsExpr()
+		l, err := subtractLinear(start, dec)
+		if err != nil {
+			return err
+		}
+		if l.isConst() && (l.k.Sign() > 0) {
+			return nil
+		}
+		return fmt.Errorf("check: cannot prove that the decreases expression %q decreases: "+
+			"it started at or above %q", dec.Str(q.tm), start.Str(q.tm))
+	}
+	return fmt.Errorf("check: cannot prove that the decreases expression %q decreases: "+
+		"its starting value was forgotten, e.g. by an \"=\" assignment instead of \"-=\"",
+		dec.Str(q.tm))
+}
+
+// shiftDecreasesFact returns the ghost fact x, "decreases >= etc", rewritten
+// after "lhs += rhs" or "lhs -= rhs", or nil if it cannot be rewritten. The
+// rhs has already been bounds checked.
+func (q *checker) shiftDecreasesFact(x *a.Expr, lhs *a.Expr, op t.ID, rhs *a.Expr) (*a.Expr, error) {
+	if ((op != t.IDPlusEq) && (op != t.IDMinusEq)) || rhs.Effect().Impure() || rhs.Mentions(lhs) {
+		return nil, nil
+	}
+	start := x.RHS().AsExpr()
+	l := &linear{k: big.NewInt(0)}
+	if err := l.add(start, one, 0); err != nil {
+		return nil, err
+	}
+	coeff := (*big.Int)(nil)
+	for i, o := range l.terms {
+		if o.Eq(lhs) {
+			coeff = l.coeffs[i]
+		} else if o.Mentions(lhs) {
+			// The start mentions lhs non-linearly, such as "lhs / 2".
+			return nil, nil
+		}
+	}
+	if coeff == nil {
+		return nil, nil
+	}
+
+	// The old lhs is the new lhs minus rhs (for "+=") or plus rhs (for "-=").
+	// Use whichever of rhs's bounds makes the start smallest, as the ghost
+	// fact's right hand side is a lower bound.
+	rb := rhs.MBounds()
+	if cv := rhs.ConstValue(); cv != nil {
+		rb = bounds{cv, cv}
+	} else if (rb[0] == nil) || (rb[1] == nil) {
+		return nil, nil
+	}
+	delta := rb[0]
+	if (coeff.Sign() > 0) == (op == t.IDPlusEq) {
+		delta = rb[1]
+	}
+	deltaExpr, err := makeConstValueExpr(q.tm, delta)
+	if err != nil {
+		return nil, err
+	}
+	oldOp := t.IDXBinaryMinus
+	if op == t.IDMinusEq {
+		oldOp = t.IDXBinaryPlus
+	}
+	old := a.NewExpr(0, oldOp, 0, lhs.AsNode(), nil, deltaExpr.AsNode(), nil)
+	old.SetMType(lhs.MType())
+	return replaceExpr(x, lhs, old), nil
+}
+
+// decreasesFacts returns the live ghost facts, if any, so that they can be
+// restored after a nested loop.
+func (q *checker) decreasesFacts() []*a.Expr {
+	ret := []*a.Expr(nil)
+	for _, x := range q.facts.exprs() {
+		if isDecreasesFact(x) {
+			ret = append(ret, x)
+		}
+	}
+	return ret
+}
+
+// restoreDecreasesFacts restores the ghost facts after the loop n, other than
+// those mentioning something that n could modify.
+func (q *checker) restoreDecreasesFacts(n *a.Node, facts []*a.Expr) {
+	for _, x := range facts {
+		if !mayModify(n, x) {
+			q.facts.appendFact(x)
+		}
+	}
+}
+
+// mayModify returns whether n, a statement, could modify the value of the
+// expression x.
+func mayModify(n *a.Node, x *a.Expr) bool {
+	mentionsIndex := false
+	x.AsNode().Walk(func(o *a.Node) error {
+		if o.Kind() == a.KExpr {
+			if _, _, ok := o.AsExpr().IsIndex(); ok {
+				mentionsIndex = true
+			}
+		}
+		return nil
+	})
+	suspendable := x.Mentions(exprArgs) || x.Mentions(exprThis)
+
+	ret := false
+	n.Walk(func(o *a.Node) error {
+		switch o.Kind() {
+		case a.KAssign:
+			if lhs := o.AsAssign().LHS(); lhs != nil {
+				_, _, isIndex := lhs.IsIndex()
+				ret = ret || x.Mentions(lhs) || (isIndex && mentionsIndex)
+			}
+		case a.KExpr:
+			o := o.AsExpr()
+			if (o.Operator() != a.ExprOperatorCall) || o.Effect().Pure() {
+				break
+			}
+			if o.Effect().Coroutine() && suspendable {
+				ret = true
+			}
+			ret = ret || x.Mentions(o.LHS().AsExpr().LHS().AsExpr())
+			for _, arg := range o.Args() {
+				ret = ret || x.Mentions(arg.AsArg().Value())
+			}
+		case a.KIOBind:
+			ret = ret || x.Mentions(o.AsIOBind().IO())
+		case a.KRet:
+			if o.AsRet().Keyword() == t.IDYield {
+				ret = ret || suspendable
+			}
+		}
+		return nil
+	})
+	return ret
+}
+
+// linear is a linear combination of terms, plus a constant. Equivalent terms
+// (per a.Expr.Eq) share a coefficient.
+type linear struct {
+	terms  []*a.Expr
+	coeffs []*big.Int
+	k      *big.Int
+}
+
+func (l *linear) add(x *a.Expr, m *big.Int, depth uint32) error {
+	if depth > a.MaxExprDepth {
+		return fmt.Errorf("check: expression recursion depth too large")
+	}
+	depth++
+
+	if cv := x.ConstValue(); cv != nil {
+		l.k.Add(l.k, big.NewInt(0).Mul(m, cv))
+		return nil
+	}
+	switch op, lhs, rhs := parseBinaryOp(x); op {
+	case t.IDXBinaryPlus:
+		if err := l.add(lhs, m, depth); err != nil {
+			return err
+		}
+		return l.add(rhs, m, depth)
+	case t.IDXBinaryMinus:
+		if err := l.add(lhs, m, depth); err != nil {
+			return err
+		}
+		return l.add(rhs, big.NewInt(0).Neg(m), depth)
+	case t.IDXBinaryStar:
+		if cv := lhs.ConstValue(); cv != nil {
+			return l.add(rhs, big.NewInt(0).Mul(m, cv), depth)
+		} else if cv := rhs.ConstValue(); cv != nil {
+			return l.add(lhs, big.NewInt(0).Mul(m, cv), depth)
+		}
+	}
+	switch x.Operator() {
+	case t.IDXUnaryPlus:
+		return l.add(x.RHS().AsExpr(), m, depth)
+	case t.IDXUnaryMinus:
+		return l.add(x.RHS().AsExpr(), big.NewInt(0).Neg(m), depth)
+	case t.IDXAssociativePlus:
+		for _, o := range x.Args() {
+			if err := l.add(o.AsExpr(), m, depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i, o := range l.terms {
+		if o.Eq(x) {
+			l.coeffs[i].Add(l.coeffs[i], m)
+			return nil
+		}
+	}
+	l.terms = append(l.terms, x)
+	l.coeffs = append(l.coeffs, big.NewInt(0).Set(m))
+	return nil
+}
+
+// isConst returns whether all of l's terms cancel out.
+func (l *linear) isConst() bool {
+	for _, c := range l.coeffs {
+		if c.Sign() != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// subtractLinear returns (x - y) as a linear combination.
+func subtractLinear(x *a.Expr, y *a.Expr) (*linear, error) {
+	l := &linear{k: big.NewInt(0)}
+	if err := l.add(x, one, 0); err != nil {
+		return nil, err
+	}
+	if err := l.add(y, minusOne, 0); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
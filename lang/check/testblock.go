@@ -0,0 +1,337 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file implements test blocks: top-level `test "name" { etc }`
+// declarations whose straight-line bodies (var, assignment and assert
+// statements) are type checked like a function body but, instead of being
+// bounds checked, are evaluated by RunTest. An assert that does not hold, or
+// a value that does not fit in its type (where a function body would fail to
+// bounds check), fails the test. Test blocks do not generate any code.
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+func (c *Checker) checkTest(node *a.Node) error {
+	n := node.AsTest()
+	for _, o := range c.tests {
+		if o.Name() == n.Name() {
+			return &Error{
+				Err:      fmt.Errorf("check: duplicate test %s", n.Name().Str(c.tm)),
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		}
+	}
+
+	for _, o := range n.Body() {
+		ok := false
+		switch o.Kind() {
+		case a.KAssert:
+			ok = o.AsAssert().Keyword() == t.IDAssert
+		case a.KAssign:
+			ok = (o.AsAssign().LHS() != nil) && (o.AsAssign().Operator() != t.IDEqQuestion)
+		case a.KVar:
+			ok = true
+		}
+		if !ok {
+			filename, line := o.AsRaw().FilenameLine()
+			return &Error{
+				Err:      fmt.Errorf("check: test %s: only var, assignment and assert statements are allowed", n.Name().Str(c.tm)),
+				Filename: filename,
+				Line:     line,
+			}
+		}
+	}
+
+	q := &checker{
+		c:         c,
+		tm:        c.tm,
+		reasonMap: c.reasonMap,
+		localVars: typeMap{},
+	}
+	if err := q.tcheckVars(0, n.Body()); err != nil {
+		return q.newError(err)
+	}
+	for _, o := range n.Body() {
+		if err := q.tcheckStatement(o); err != nil {
+			return q.newError(err)
+		}
+	}
+
+	// The body is not bounds checked, but later passes (such as
+	// checkAllTypeChecked) expect every node to have bounds.
+	for _, o := range n.Body() {
+		if err := o.Walk(q.setBoundsFromType); err != nil {
+			return &Error{
+				Err:      err,
+				Filename: n.Filename(),
+				Line:     n.Line(),
+			}
+		}
+	}
+	setPlaceholderMBoundsMType(n.AsNode())
+
+	c.tests = append(c.tests, n)
+	return nil
+}
+
+// Tests returns the checked package's test blocks, in source order.
+func (c *Checker) Tests() []*a.Test {
+	return c.tests
+}
+
+// RunTest evaluates a test block's body. It returns nil if the test passes.
+func (c *Checker) RunTest(n *a.Test) error {
+	r := &testRunner{
+		q: &checker{
+			c:         c,
+			tm:        c.tm,
+			reasonMap: c.reasonMap,
+		},
+		vars: map[t.ID]*big.Int{},
+	}
+	for _, o := range n.Body() {
+		if err := r.runStatement(o); err != nil {
+			filename, line := o.AsRaw().FilenameLine()
+			return &Error{
+				Err:      fmt.Errorf("check: test %s failed: %v", n.Name().Str(c.tm), err),
+				Filename: filename,
+				Line:     line,
+			}
+		}
+	}
+	return nil
+}
+
+type testRunner struct {
+	q    *checker
+	vars map[t.ID]*big.Int
+}
+
+func (r *testRunner) runStatement(n *a.Node) error {
+	switch n.Kind() {
+	case a.KAssert:
+		cond := n.AsAssert().Condition()
+		v, err := r.eval(cond)
+		if err != nil {
+			return err
+		}
+		if v.Sign() == 0 {
+			return fmt.Errorf("assertion %q does not hold", cond.Str(r.q.tm))
+		}
+		return nil
+
+	case a.KAssign:
+		n := n.AsAssign()
+		lhs := n.LHS()
+		if lhs.Operator() != 0 {
+			return fmt.Errorf("cannot assign to %q", lhs.Str(r.q.tm))
+		}
+		v, err := r.eval(n.RHS())
+		if err != nil {
+			return err
+		}
+		if op := n.Operator(); op != t.IDEq {
+			l, err := r.eval(lhs)
+			if err != nil {
+				return err
+			}
+			v, err = r.evalBinaryOp(op.BinaryForm(), lhs.MType(), l, v)
+			if err != nil {
+				return err
+			}
+		}
+		if err := r.fits(v, lhs.MType(), lhs.Str(r.q.tm)); err != nil {
+			return err
+		}
+		r.vars[lhs.Ident()] = v
+		return nil
+
+	case a.KVar:
+		r.vars[n.AsVar().Name()] = zero
+		return nil
+	}
+	return fmt.Errorf("cannot run a %s statement", n.Kind())
+}
+
+// fits returns an error if v is outside of typ's bounds.
+func (r *testRunner) fits(v *big.Int, typ *a.TypeExpr, what string) error {
+	if typ.IsIdeal() || typ.IsBool() {
+		return nil
+	}
+	b, err := r.q.bcheckTypeExpr(typ)
+	if err != nil {
+		return err
+	}
+	if (v.Cmp(b[0]) < 0) || (v.Cmp(b[1]) > 0) {
+		return fmt.Errorf("%s value %v is not within bounds %v", what, v, b)
+	}
+	return nil
+}
+
+func (r *testRunner) eval(n *a.Expr) (*big.Int, error) {
+	if cv := n.ConstValue(); cv != nil {
+		return cv, nil
+	}
+
+	v, err := r.eval1(n)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.fits(v, n.MType(), fmt.Sprintf("expression %q", n.Str(r.q.tm))); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (r *testRunner) eval1(n *a.Expr) (*big.Int, error) {
+	switch op := n.Operator(); {
+	case op == 0:
+		if v := r.vars[n.Ident()]; v != nil {
+			return v, nil
+		}
+
+	case op == t.IDXBinaryAs:
+		return r.eval(n.LHS().AsExpr())
+
+	case op.IsXUnaryOp():
+		v, err := r.eval(n.RHS().AsExpr())
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case t.IDXUnaryPlus:
+			return v, nil
+		case t.IDXUnaryMinus:
+			return big.NewInt(0).Neg(v), nil
+		case t.IDXUnaryNot:
+			return btoi(v.Sign() == 0), nil
+		}
+
+	case op.IsXBinaryOp():
+		l, err := r.eval(n.LHS().AsExpr())
+		if err != nil {
+			return nil, err
+		}
+		// Short-circuit the logical operators.
+		if (op == t.IDXBinaryAnd) && (l.Sign() == 0) {
+			return zero, nil
+		} else if (op == t.IDXBinaryOr) && (l.Sign() != 0) {
+			return one, nil
+		}
+		rhs, err := r.eval(n.RHS().AsExpr())
+		if err != nil {
+			return nil, err
+		}
+		return r.evalBinaryOp(op, n.LHS().AsExpr().MType(), l, rhs)
+
+	case op.IsXAssociativeOp():
+		args := n.Args()
+		v, err := r.eval(args[0].AsExpr())
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range args[1:] {
+			if (op == t.IDXAssociativeAnd) && (v.Sign() == 0) {
+				return zero, nil
+			} else if (op == t.IDXAssociativeOr) && (v.Sign() != 0) {
+				return one, nil
+			}
+			w, err := r.eval(o.AsExpr())
+			if err != nil {
+				return nil, err
+			}
+			v, err = r.evalBinaryOp(op.AmbiguousForm().BinaryForm(), n.MType(), v, w)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("cannot evaluate %q", n.Str(r.q.tm))
+}
+
+// evalBinaryOp evaluates "l op r", where typ is l's type, which the tilde
+// operators wrap or saturate to.
+func (r *testRunner) evalBinaryOp(op t.ID, typ *a.TypeExpr, l *big.Int, rhs *big.Int) (*big.Int, error) {
+	switch op {
+	case t.IDXBinarySlash, t.IDXBinaryPercent:
+		if rhs.Sign() == 0 {
+			return nil, errors.New("division by zero")
+		}
+	case t.IDXBinaryShiftL, t.IDXBinaryShiftR:
+		if (rhs.Sign() < 0) || (rhs.Cmp(ffff) > 0) {
+			return nil, fmt.Errorf("shift %v out of range", rhs)
+		}
+	case t.IDXBinaryTildeModPlus, t.IDXBinaryTildeModMinus,
+		t.IDXBinaryTildeModStar, t.IDXBinaryTildeModShiftL, t.IDXBinaryTildeModShiftR,
+		t.IDXBinaryTildeSatPlus, t.IDXBinaryTildeSatMinus:
+
+		if !typ.IsNumType() {
+			return nil, errors.New("cannot apply tilde-operators to ideal numbers")
+		}
+		b, err := r.q.bcheckTypeExpr(typ.Unrefined())
+		if err != nil {
+			return nil, err
+		}
+		// The type's range is [b[0], b[1]], which has 2**width elements.
+		width := b[1].BitLen()
+		if b[0].Sign() < 0 {
+			width++
+		}
+		v := big.NewInt(0)
+		switch op {
+		case t.IDXBinaryTildeModPlus, t.IDXBinaryTildeSatPlus:
+			v.Add(l, rhs)
+		case t.IDXBinaryTildeModMinus, t.IDXBinaryTildeSatMinus:
+			v.Sub(l, rhs)
+		case t.IDXBinaryTildeModStar:
+			v.Mul(l, rhs)
+		case t.IDXBinaryTildeModShiftL, t.IDXBinaryTildeModShiftR:
+			// Shifting by the type's bit width or more gives zero, other than
+			// a signed (arithmetic) right shift, which gives the sign fill.
+			if rhs.Sign() < 0 {
+				return nil, fmt.Errorf("shift %v out of range", rhs)
+			} else if rhs.Cmp(big.NewInt(int64(width))) < 0 {
+				if op == t.IDXBinaryTildeModShiftL {
+					v.Lsh(l, uint(rhs.Uint64()))
+				} else {
+					v.Rsh(l, uint(rhs.Uint64()))
+				}
+			} else if op == t.IDXBinaryTildeModShiftL {
+				return zero, nil
+			} else {
+				v.Rsh(l, uint(width))
+			}
+		}
+		if (op == t.IDXBinaryTildeSatPlus) || (op == t.IDXBinaryTildeSatMinus) {
+			return min(max(v, b[0]), b[1]), nil
+		}
+		// Wrap v around to be within [b[0], b[1]]. For unsigned types, b[0]
+		// is zero.
+		v.Sub(v, b[0])
+		v.Mod(v, big.NewInt(0).Lsh(one, uint(width)))
+		return v.Add(v, b[0]), nil
+	}
+
+	return evalConstValueBinaryOp(r.q.tm, a.NewExpr(0, op, 0, nil, nil, nil, nil), l, rhs)
+}
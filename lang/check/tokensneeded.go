@@ -0,0 +1,135 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file derives how many tokens a token decoder needs room for when it
+// suspends with a "$short write". Token decoders guard each such suspension
+// by the destination's length, such as:
+//
+//   if args.dst.length() <= 1 {
+//       yield? base."$short write"
+//       continue.loop
+//   }
+//   // Write two tokens.
+//
+// where the code after the guard relies on "args.dst.length() > 1". Inside
+// the guard, that requirement's negation, "args.dst.length() <= 1", is a fact,
+// from which the checker derives that the decoder needs room for 2 tokens.
+// It records that on the yield statement (see ast.Ret.TokensNeeded), and the
+// C code generator reports it to the caller, who can then compact or grow the
+// token buffer by enough, instead of guessing and retrying.
+//
+// In a coroutine whose only writers are base.token_writer arguments, every
+// "$short write" yield must be guarded so. With a base.io_writer argument as
+// well, an unguarded "$short write" can be about that io_writer instead.
+
+import (
+	"fmt"
+	"math/big"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// recordTokensNeeded sets n's TokensNeeded if n yields a "$short write" in a
+// coroutine with base.token_writer arguments.
+func (q *checker) recordTokensNeeded(n *a.Ret) error {
+	if (n.Keyword() != t.IDYield) || !isShortWrite(n.Value(), q.tm) {
+		return nil
+	}
+	tokenWriters, firstTokenWriter, hasIOWriter := map[t.ID]bool{}, t.ID(0), false
+	for _, o := range q.astFunc.In().Fields() {
+		o := o.AsField()
+		if o.XType().Eq(typeExprTokenWriter) {
+			tokenWriters[o.Name()] = true
+			if firstTokenWriter == 0 {
+				firstTokenWriter = o.Name()
+			}
+		} else if o.XType().Eq(typeExprIOWriter) {
+			hasIOWriter = true
+		}
+	}
+	if len(tokenWriters) == 0 {
+		return nil
+	}
+
+	needed := (*big.Int)(nil)
+	for _, x := range q.facts.exprs() {
+		if v := tokenWriterLengthNeeded(x, tokenWriters); (v != nil) && ((needed == nil) || (needed.Cmp(v) < 0)) {
+			needed = v
+		}
+	}
+	if needed == nil {
+		if hasIOWriter {
+			return nil
+		}
+		return fmt.Errorf("check: cannot tell how many tokens this \"$short write\" needs: "+
+			"guard it with a condition such as \"args.%s.length() <= N\"", firstTokenWriter.Str(q.tm))
+	}
+	if prev := n.TokensNeeded(); (prev != nil) && (prev.Cmp(needed) > 0) {
+		needed = prev
+	}
+	n.SetTokensNeeded(needed)
+	return nil
+}
+
+// tokenWriterLengthNeeded returns, if the fact x is an upper bound, such as
+// "args.dst.length() <= N", on the length of one of the tokenWriters
+// arguments, the smallest length that x rules out: N+1 in that example.
+func tokenWriterLengthNeeded(x *a.Expr, tokenWriters map[t.ID]bool) *big.Int {
+	op, lhs, rhs := x.Operator(), x.LHS().AsExpr(), x.RHS().AsExpr()
+	if (lhs == nil) || (rhs == nil) {
+		return nil
+	}
+	// Canonicalize "N >= etc" as "etc <= N", and likewise for ">" and "==".
+	if lhs.ConstValue() != nil {
+		switch op {
+		case t.IDXBinaryGreaterEq:
+			op = t.IDXBinaryLessEq
+		case t.IDXBinaryGreaterThan:
+			op = t.IDXBinaryLessThan
+		case t.IDXBinaryEqEq:
+			// No-op.
+		default:
+			return nil
+		}
+		lhs, rhs = rhs, lhs
+	}
+
+	cv := rhs.ConstValue()
+	if cv == nil {
+		return nil
+	}
+	recv, meth, args, ok := lhs.IsMethodCall()
+	if !ok || (meth != t.IDLength) || (len(args) != 0) || (recv.Operator() != t.IDDot) ||
+		(recv.LHS().AsExpr().Ident() != t.IDArgs) || !tokenWriters[recv.Ident()] {
+		return nil
+	}
+
+	switch op {
+	case t.IDXBinaryLessEq, t.IDXBinaryEqEq:
+		return add1(cv)
+	case t.IDXBinaryLessThan:
+		return cv
+	}
+	return nil
+}
+
+// isShortWrite returns whether n is base."$short write".
+func isShortWrite(n *a.Expr, tm *t.Map) bool {
+	lhs, field, ok := n.IsSelector()
+	return ok && (lhs.Operator() == 0) && (lhs.Ident() == t.IDBase) &&
+		(field.Str(tm) == `"$short write"`)
+}
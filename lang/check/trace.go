@@ -0,0 +1,333 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file records the fact engine's decisions, for debugging "why did my
+// fact disappear" after the fact. When Options.FactTrace is set, bounds
+// checking writes a trace, one JSON object (a FactTraceEvent) per line:
+//
+//	{"op":"func","fn":"decoder.decode","file":"std/foo/decode_foo.wuffs","line":20}
+//	{"op":"insert","fn":"decoder.decode","line":23,"fact":"i < n"}
+//	{"op":"refine","fn":"decoder.decode","line":24,"fact":"i < (n + 1)","from":"i < n"}
+//	{"op":"drop","fn":"decoder.decode","line":30,"fact":"i < (n + 1)"}
+//
+// A "func" event starts a function body, with an empty set of facts. Every
+// other event inserts a fact into, drops a fact from or (for an assignment,
+// such as "i += 1") replaces a fact in that function's set. Each event's line
+// is that of the statement that triggered it. A snapshot being restored (such
+// as when unifying an if's branches) is a drop of every fact followed by an
+// insert of every restored fact.
+//
+// Replaying a function's events, in order, therefore gives its facts after
+// every step. ReadFactTrace and ReplayFactTrace do that and WriteHTMLFactTrace
+// renders the result as a standalone HTML page that steps through it, like a
+// reverse debugger for the prover. The "wuffs trace" command is a terminal
+// equivalent.
+//
+// Like Options.Explain, tracing ignores the cache, as cached function bodies
+// are not bounds checked.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Fact trace event operations.
+const (
+	FactTraceFunc   = "func"
+	FactTraceInsert = "insert"
+	FactTraceDrop   = "drop"
+	FactTraceRefine = "refine"
+)
+
+// FactTraceEvent is one line of a fact trace. File is only set for "func"
+// events and From is only set for "refine" events, which replace the From
+// fact with the Fact fact.
+type FactTraceEvent struct {
+	Op   string `json:"op"`
+	Func string `json:"fn"`
+	File string `json:"file,omitempty"`
+	Line uint32 `json:"line"`
+	Fact string `json:"fact,omitempty"`
+	From string `json:"from,omitempty"`
+}
+
+// factTracer writes a fact trace. Once a write fails, the rest of the trace
+// is discarded, as the trace is only a debugging aid.
+type factTracer struct {
+	w   io.Writer
+	tm  *t.Map
+	err error
+}
+
+func (z *factTracer) write(e *FactTraceEvent) {
+	if z.err != nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err == nil {
+		_, err = z.w.Write(append(data, '\n'))
+	}
+	z.err = err
+}
+
+// beginFunc writes n's "func" event and returns the name that its other
+// events refer to it by.
+func (z *factTracer) beginFunc(n *a.Func) string {
+	name := n.QQID().Str(z.tm)
+	z.write(&FactTraceEvent{
+		Op:   FactTraceFunc,
+		Func: name,
+		File: n.Filename(),
+		Line: n.Line(),
+	})
+	return name
+}
+
+func (g *factLog) traceEvent(op string, x *a.Expr, from *a.Expr) {
+	e := &FactTraceEvent{
+		Op:   op,
+		Func: g.traceFunc,
+		Line: g.line,
+		Fact: x.Str(g.tracer.tm),
+	}
+	if from != nil {
+		e.From = from.Str(g.tracer.tm)
+	}
+	g.tracer.write(e)
+}
+
+// ReadFactTrace reads a fact trace, as written by Check with the
+// Options.FactTrace option.
+func ReadFactTrace(r io.Reader) ([]FactTraceEvent, error) {
+	ret := []FactTraceEvent(nil)
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		e := FactTraceEvent{}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			return nil, fmt.Errorf("check: fact trace line %d: %v", lineNum, err)
+		}
+		switch e.Op {
+		case FactTraceFunc, FactTraceInsert, FactTraceDrop, FactTraceRefine:
+			// No-op.
+		default:
+			return nil, fmt.Errorf("check: fact trace line %d: unknown op %q", lineNum, e.Op)
+		}
+		ret = append(ret, e)
+	}
+	return ret, s.Err()
+}
+
+// FactTraceFuncs returns the names of the functions in a fact trace, in order
+// of their first "func" event.
+func FactTraceFuncs(events []FactTraceEvent) []string {
+	ret := []string(nil)
+	seen := map[string]bool{}
+	for _, e := range events {
+		if (e.Op == FactTraceFunc) && !seen[e.Func] {
+			seen[e.Func] = true
+			ret = append(ret, e.Func)
+		}
+	}
+	return ret
+}
+
+// FactTraceStep is one step of replaying a function's fact trace: an event
+// and the facts after it.
+type FactTraceStep struct {
+	Event FactTraceEvent
+	File  string
+	Facts []string
+}
+
+// ReplayFactTrace replays the named function's events in a fact trace,
+// returning the facts after each one. If the function was bounds checked more
+// than once, only the last check is replayed.
+func ReplayFactTrace(events []FactTraceEvent, funcName string) ([]FactTraceStep, error) {
+	ret := []FactTraceStep(nil)
+	file, facts := "", []string(nil)
+	for _, e := range events {
+		if e.Func != funcName {
+			continue
+		}
+		switch e.Op {
+		case FactTraceFunc:
+			ret, file, facts = ret[:0], e.File, nil
+		case FactTraceInsert:
+			facts = append(facts, e.Fact)
+		case FactTraceDrop:
+			facts = removeFactString(facts, e.Fact)
+		case FactTraceRefine:
+			facts = removeFactString(facts, e.From)
+			facts = append(facts, e.Fact)
+		}
+		ret = append(ret, FactTraceStep{
+			Event: e,
+			File:  file,
+			Facts: append([]string{}, facts...),
+		})
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("check: fact trace has no function %q", funcName)
+	}
+	return ret, nil
+}
+
+func removeFactString(facts []string, fact string) []string {
+	for i, x := range facts {
+		if x == fact {
+			return append(facts[:i:i], facts[i+1:]...)
+		}
+	}
+	return facts
+}
+
+// WriteHTMLFactTrace writes a replayed fact trace (see ReplayFactTrace) as a
+// standalone HTML document that steps through it. The src argument is the
+// contents of the function's file. It may be nil, in which case the document
+// has no source listing.
+func WriteHTMLFactTrace(w io.Writer, steps []FactTraceStep, src []byte) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("check: empty fact trace")
+	}
+	r := &htmlTrace{
+		Func: steps[0].Event.Func,
+		File: steps[0].File,
+	}
+	if src != nil {
+		lines := strings.Split(strings.TrimSuffix(string(src), "\n"), "\n")
+		for i, s := range lines {
+			r.Source = append(r.Source, htmlReportLine{Number: uint32(i + 1), Text: s})
+		}
+	}
+	data, err := json.Marshal(steps)
+	if err != nil {
+		return err
+	}
+	r.Steps = template.JS(data)
+	return htmlTraceTemplate.Execute(w, r)
+}
+
+type htmlTrace struct {
+	Func   string
+	File   string
+	Source []htmlReportLine
+	Steps  template.JS
+}
+
+var htmlTraceTemplate = template.Must(template.New("trace").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Wuffs fact trace: {{.Func}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+code, pre, li { font-family: monospace; }
+pre { border: 1px solid #ccc; padding: 0.5em 0; max-height: 40em; overflow: auto; }
+pre span { display: block; padding: 0 0.5em; }
+.curr { background: #ffd; }
+.insert { background: #dfd; }
+.drop { background: #fdd; text-decoration: line-through; }
+.refine { background: #eef; }
+.num { color: #888; display: inline-block; width: 4em; text-align: right; margin-right: 1em; }
+#panes { display: flex; gap: 2em; }
+#panes > div { flex: 1; min-width: 0; }
+</style>
+</head>
+<body>
+<h1>Wuffs fact trace</h1>
+<p><code>{{.Func}}</code> in {{.File}}</p>
+<p>
+<button id="first">|&lt;</button>
+<button id="prev">&lt;</button>
+<button id="next">&gt;</button>
+<button id="last">&gt;|</button>
+Step <span id="stepnum"></span>. Use the arrow keys to step.
+</p>
+<p id="event"></p>
+<div id="panes">
+<div>
+<h2>Facts</h2>
+<ul id="facts"></ul>
+</div>
+{{- if .Source}}
+<div>
+<h2>Source</h2>
+<pre id="source">
+{{- range .Source -}}
+<span id="L{{.Number}}"><span class="num">{{.Number}}</span>{{.Text}}</span>
+{{- end -}}
+</pre>
+</div>
+{{- end}}
+</div>
+<script>
+var steps = {{.Steps}};
+var i = 0;
+function text(s) { return document.createTextNode(s); }
+function show() {
+  var step = steps[i], e = step.Event;
+  document.getElementById("stepnum").textContent = (i + 1) + " / " + steps.length;
+  var ev = document.getElementById("event");
+  ev.textContent = "line " + e.line + ": " + e.op + (e.fact ? " " + e.fact : "") +
+    (e.from ? " (was " + e.from + ")" : "");
+  ev.className = e.op;
+  var ul = document.getElementById("facts");
+  ul.innerHTML = "";
+  step.Facts.forEach(function(f) {
+    var li = document.createElement("li");
+    li.appendChild(text(f));
+    if ((f === e.fact) && (e.op !== "drop")) { li.className = e.op; }
+    ul.appendChild(li);
+  });
+  if (e.op === "drop") {
+    var li = document.createElement("li");
+    li.appendChild(text(e.fact));
+    li.className = "drop";
+    ul.appendChild(li);
+  }
+  var old = document.querySelector("#source .curr");
+  if (old) { old.className = ""; }
+  var line = document.getElementById("L" + e.line);
+  if (line) {
+    line.className = "curr";
+    line.scrollIntoView({block: "nearest"});
+  }
+}
+function go(j) { i = Math.max(0, Math.min(steps.length - 1, j)); show(); }
+document.getElementById("first").onclick = function() { go(0); };
+document.getElementById("prev").onclick = function() { go(i - 1); };
+document.getElementById("next").onclick = function() { go(i + 1); };
+document.getElementById("last").onclick = function() { go(steps.length - 1); };
+document.onkeydown = function(ev) {
+  if (ev.key === "ArrowLeft") { go(i - 1); } else if (ev.key === "ArrowRight") { go(i + 1); }
+};
+show();
+</script>
+</body>
+</html>
+`))
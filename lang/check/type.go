@@ -28,6 +28,8 @@ const (
 	cpuArchBitsARMCRC32 = cpuArchBits(0x00000001)
 	cpuArchBitsARMNeon  = cpuArchBits(0x00000002)
 	cpuArchBitsX86SSE42 = cpuArchBits(0x00000004)
+	cpuArchBitsARMSVE   = cpuArchBits(0x00000008)
+	cpuArchBitsRISCVV   = cpuArchBits(0x00000010)
 )
 
 func calcCPUArchBits(n *a.Func) (ret cpuArchBits) {
@@ -41,6 +43,10 @@ func calcCPUArchBits(n *a.Func) (ret cpuArchBits) {
 			ret |= cpuArchBitsARMCRC32
 		case t.IDARMNeon:
 			ret |= cpuArchBitsARMNeon
+		case t.IDARMSVE:
+			ret |= cpuArchBitsARMSVE
+		case t.IDRISCVV:
+			ret |= cpuArchBitsRISCVV
 		case t.IDX86SSE42:
 			ret |= cpuArchBitsX86SSE42
 		}
@@ -58,6 +64,10 @@ func (q *checker) tcheckCPUArchBits(cab cpuArchBits, typ *a.TypeExpr) error {
 			t.IDARMNeonU8x8, t.IDARMNeonU16x4, t.IDARMNeonU32x2, t.IDARMNeonU64x1,
 			t.IDARMNeonU8x16, t.IDARMNeonU16x8, t.IDARMNeonU32x4, t.IDARMNeonU64x2:
 			need = cpuArchBitsARMNeon
+		case t.IDARMSVEUtility, t.IDARMSVEU8:
+			need = cpuArchBitsARMSVE
+		case t.IDRISCVVUtility, t.IDRISCVVU8:
+			need = cpuArchBitsRISCVV
 		case t.IDX86SSE42Utility, t.IDX86M128I:
 			need = cpuArchBitsX86SSE42
 		}
@@ -68,13 +78,22 @@ func (q *checker) tcheckCPUArchBits(cab cpuArchBits, typ *a.TypeExpr) error {
 	return nil
 }
 
+// isScalableCPUArchType returns whether typ is an ARM SVE or RISC-V V type,
+// whose size is only known at run time.
+func isScalableCPUArchType(typ *a.TypeExpr) bool {
+	if qid := typ.Innermost().QID(); qid[0] == t.IDBase {
+		return (qid[1] == t.IDARMSVEU8) || (qid[1] == t.IDRISCVVU8)
+	}
+	return false
+}
+
 func (q *checker) tcheckVars(cab cpuArchBits, block []*a.Node) error {
 	for _, o := range block {
 		if o.Kind() != a.KVar {
 			break
 		}
 
-		q.errFilename, q.errLine = o.AsRaw().FilenameLine()
+		q.setErrNode(o)
 
 		o := o.AsVar()
 		name := o.Name()
@@ -93,13 +112,24 @@ func (q *checker) tcheckVars(cab cpuArchBits, block []*a.Node) error {
 		if err := q.tcheckCPUArchBits(cab, o.XType()); err != nil {
 			return err
 		}
+		if isScalableCPUArchType(o.XType()) {
+			// C arrays and struct fields need a fixed size, and a coroutine's
+			// locals can be saved in the receiver's struct across suspensions.
+			if o.XType().Decorator() != 0 {
+				return fmt.Errorf("check: scalable cpu_arch type %q not allowed in %q",
+					o.XType().Innermost().Str(q.tm), o.XType().Str(q.tm))
+			} else if q.astFunc.Effect().Coroutine() {
+				return fmt.Errorf("check: scalable cpu_arch type %q not allowed in coroutine %s",
+					o.XType().Str(q.tm), q.astFunc.QQID().Str(q.tm))
+			}
+		}
 		q.localVars[name] = o.XType()
 	}
 	return nil
 }
 
 func (q *checker) tcheckStatement(n *a.Node) error {
-	q.errFilename, q.errLine = n.AsRaw().FilenameLine()
+	q.setErrNode(n)
 
 	switch n.Kind() {
 	case a.KAssert:
@@ -243,6 +273,9 @@ func (q *checker) tcheckStatement(n *a.Node) error {
 			return fmt.Errorf("check: for-loop condition %q, of type %q, does not have a boolean type",
 				cond.Str(q.tm), cond.MType().Str(q.tm))
 		}
+		if err := q.tcheckDecreases(n); err != nil {
+			return err
+		}
 		if err := q.tcheckLoop(n); err != nil {
 			return err
 		}
@@ -263,12 +296,46 @@ func (q *checker) tcheckFuncAssert(n *a.Assert) error {
 		cond.RHS().AsExpr().SetMType(typeExprU32)
 		return nil
 	}
-	return fmt.Errorf("check: function assertions are not supported yet")
+	if param, ok := monotoneParam(q.tm, n); ok {
+		return q.tcheckMonotoneAssert(n, param)
+	}
+
+	f := q.astFunc
+	switch n.Keyword() {
+	case t.IDPre, t.IDInv, t.IDPost:
+	default:
+		return fmt.Errorf("check: function assertion %q is not a choose, pre, inv or post condition",
+			n.Condition().Str(q.tm))
+	}
+	if (n.Keyword() != t.IDPost) && f.Public() {
+		// Public functions can be called from outside of Wuffs code, where
+		// nothing would prove the pre-conditions.
+		return fmt.Errorf("check: public function %s cannot have pre-conditions", f.QQID().Str(q.tm))
+	}
+	if (n.Keyword() != t.IDPre) && f.Effect().Coroutine() {
+		return fmt.Errorf("check: coroutine %s cannot have post-conditions", f.QQID().Str(q.tm))
+	}
+
+	// Contracts can only refer to the args and, for post-conditions, the
+	// result. In particular, they cannot refer to "this".
+	localVars := q.localVars
+	q.localVars = typeMap{
+		t.IDArgs: localVars[t.IDArgs],
+	}
+	if (n.Keyword() == t.IDPost) && (f.Out() != nil) {
+		q.localVars[t.IDResult] = f.Out()
+	}
+	defer func() { q.localVars = localVars }()
+
+	return q.tcheckAssert(n)
 }
 
 func (q *checker) tcheckAssert(n *a.Assert) error {
 	cond := n.Condition()
-	if err := q.tcheckExpr(cond, 0); err != nil {
+	q.inAssert = true
+	err := q.tcheckExpr(cond, 0)
+	q.inAssert = false
+	if err != nil {
 		return err
 	}
 	if !cond.MType().IsBool() {
@@ -285,6 +352,29 @@ func (q *checker) tcheckAssert(n *a.Assert) error {
 	return nil
 }
 
+func (q *checker) tcheckDecreases(n *a.While) error {
+	dec := n.Decreases()
+	if dec == nil {
+		if q.c.termination != nil {
+			return fmt.Errorf("check: while loop has no decreases clause, "+
+				"as required by the pragma termination at %s:%d",
+				q.c.termination.Filename(), q.c.termination.Line())
+		}
+		return nil
+	}
+	q.inAssert = true
+	err := q.tcheckExpr(dec, 0)
+	q.inAssert = false
+	if err != nil {
+		return err
+	}
+	if !dec.MType().IsNumTypeOrIdeal() {
+		return fmt.Errorf("check: decreases expression %q, of type %q, does not have an integer type",
+			dec.Str(q.tm), dec.MType().Str(q.tm))
+	}
+	return nil
+}
+
 func (q *checker) tcheckEq(lID t.ID, lhs *a.Expr, lTyp *a.TypeExpr, rhs *a.Expr, rTyp *a.TypeExpr) error {
 	if (rTyp.IsIdeal() && lTyp.IsNumType()) ||
 		(rTyp.EqIgnoringRefinements(lTyp)) ||
@@ -329,7 +419,7 @@ func (q *checker) tcheckAssign(n *a.Assign) error {
 	}
 
 	switch n.Operator() {
-	case t.IDShiftLEq, t.IDShiftREq, t.IDTildeModShiftLEq:
+	case t.IDShiftLEq, t.IDShiftREq, t.IDTildeModShiftLEq, t.IDTildeModShiftREq:
 		if !rTyp.IsNumTypeOrIdeal() {
 			return fmt.Errorf("check: assignment %q: shift %q, of type %q, does not have numeric type",
 				n.Operator().Str(q.tm), rhs.Str(q.tm), rTyp.Str(q.tm))
@@ -339,13 +429,14 @@ func (q *checker) tcheckAssign(n *a.Assign) error {
 	case t.IDTildeModPlusEq, t.IDTildeModMinusEq, t.IDTildeModStarEq,
 		t.IDTildeSatPlusEq, t.IDTildeSatMinusEq:
 
-		if !lTyp.IsUnsignedInteger() {
-			return fmt.Errorf("check: assignment %q: %q, of type %q, does not have unsigned integer type",
+		if !lTyp.IsNumType() {
+			return fmt.Errorf("check: assignment %q: %q, of type %q, does not have integer type",
 				n.Operator().Str(q.tm), lhs.Str(q.tm), lTyp.Str(q.tm))
 		}
 	}
 
-	if !(rTyp.IsIdeal() && lTyp.IsNumType()) && !lTyp.EqIgnoringRefinements(rTyp) {
+	// Like "x = x + y", "x += y" can implicitly widen y but not x.
+	if w := widerNumType(lTyp, rTyp); (w == nil) || !lTyp.EqIgnoringRefinements(w) {
 		return fmt.Errorf("check: assignment %q: %q and %q, of types %q and %q, do not have compatible types",
 			n.Operator().Str(q.tm),
 			lhs.Str(q.tm), rhs.Str(q.tm),
@@ -536,6 +627,13 @@ func (q *checker) tcheckExprOther(n *a.Expr, depth uint32) error {
 			return fmt.Errorf("check: %s is a slice expression but %s has type %s, not an array or slice type",
 				n.Str(q.tm), lhs.Str(q.tm), lTyp.Str(q.tm))
 		case t.IDArray:
+			// A slice's elements can be written without being bounds checked
+			// against their array's element type, such as by the
+			// copy_from_slice method, so that element type cannot be refined.
+			if lTyp.Innermost().IsRefined() {
+				return fmt.Errorf("check: %s is a slice expression but %s has refined element type %s",
+					n.Str(q.tm), lhs.Str(q.tm), lTyp.Inner().Str(q.tm))
+			}
 			n.SetMType(a.NewTypeExpr(t.IDSlice, 0, 0, nil, nil, lTyp.Inner()))
 		case t.IDSlice:
 			n.SetMType(lTyp)
@@ -545,6 +643,29 @@ func (q *checker) tcheckExprOther(n *a.Expr, depth uint32) error {
 	case t.IDDot:
 		return q.tcheckDot(n, depth)
 
+	case t.IDFeature:
+		// n is a feature query, whose value is whether the package (another
+		// package that this one uses, or this one) declares that feature.
+		pkg := t.ID(0)
+		if lhs := n.LHS().AsExpr(); lhs != nil {
+			pkg = lhs.Ident()
+			if q.c.topLevelNames[pkg] != a.KUse {
+				return fmt.Errorf("check: %q is not a used package in %q", pkg.Str(q.tm), n.Str(q.tm))
+			} else if err := q.tcheckExpr(lhs, depth); err != nil {
+				return err
+			}
+			// The query is a constant, so bounds checking n will not visit
+			// the package.
+			lhs.SetMBounds(bounds{zero, zero})
+		}
+		if q.c.features[t.QID{pkg, n.Ident()}] != nil {
+			n.SetConstValue(one)
+		} else {
+			n.SetConstValue(zero)
+		}
+		n.SetMType(typeExprBool)
+		return nil
+
 	case t.IDComma:
 		for _, o := range n.Args() {
 			o := o.AsExpr()
@@ -674,6 +795,13 @@ func (q *checker) tcheckDot(n *a.Expr, depth uint32) error {
 		qqid[1] = t.IDDagger1
 		if (q.c.builtInSliceFuncs[qqid] != nil) ||
 			((q.c.builtInSliceU8Funcs[qqid] != nil) && lTyp.Eq(typeExprSliceU8)) {
+			if n.Ident() == t.IDAllLE {
+				if !q.inAssert {
+					return fmt.Errorf("check: slice method %q is only valid in assertions", n.Ident().Str(q.tm))
+				} else if !lTyp.Inner().IsNumType() {
+					return fmt.Errorf("check: slice method %q is only valid for slices of numbers", n.Ident().Str(q.tm))
+				}
+			}
 			n.SetMType(a.NewTypeExpr(t.IDFunc, 0, n.Ident(), lTyp.AsNode(), nil, nil))
 			return nil
 		}
@@ -826,14 +954,14 @@ func (q *checker) tcheckExprBinaryOp(n *a.Expr, depth uint32) error {
 		if pointerComparison {
 			break
 		}
-		if !lTyp.EqIgnoringRefinements(rTyp) && !lTyp.IsIdeal() && !rTyp.IsIdeal() {
+		if widerNumType(lTyp, rTyp) == nil {
 			return fmt.Errorf("check: binary %q: %q and %q, of types %q and %q, do not have compatible types",
 				op.AmbiguousForm().Str(q.tm),
 				lhs.Str(q.tm), rhs.Str(q.tm),
 				lTyp.Str(q.tm), rTyp.Str(q.tm),
 			)
 		}
-	case t.IDXBinaryShiftL, t.IDXBinaryShiftR, t.IDXBinaryTildeModShiftL:
+	case t.IDXBinaryShiftL, t.IDXBinaryShiftR, t.IDXBinaryTildeModShiftL, t.IDXBinaryTildeModShiftR:
 		if lTyp.IsIdeal() && !rTyp.IsIdeal() {
 			return fmt.Errorf("check: binary %q: %q and %q, of types %q and %q; "+
 				"cannot shift an ideal number by a non-ideal number",
@@ -848,19 +976,16 @@ func (q *checker) tcheckExprBinaryOp(n *a.Expr, depth uint32) error {
 	case t.IDXBinaryTildeModPlus, t.IDXBinaryTildeModMinus, t.IDXBinaryTildeModStar,
 		t.IDXBinaryTildeSatPlus, t.IDXBinaryTildeSatMinus:
 
-		typ := lTyp
+		typ := widerNumType(lTyp, rTyp)
 		if typ.IsIdeal() {
-			typ = rTyp
-			if typ.IsIdeal() {
-				return fmt.Errorf("check: binary %q: %q and %q, of types %q and %q, do not have non-ideal types",
-					op.AmbiguousForm().Str(q.tm),
-					lhs.Str(q.tm), rhs.Str(q.tm),
-					lTyp.Str(q.tm), rTyp.Str(q.tm),
-				)
-			}
+			return fmt.Errorf("check: binary %q: %q and %q, of types %q and %q, do not have non-ideal types",
+				op.AmbiguousForm().Str(q.tm),
+				lhs.Str(q.tm), rhs.Str(q.tm),
+				lTyp.Str(q.tm), rTyp.Str(q.tm),
+			)
 		}
-		if !typ.IsUnsignedInteger() {
-			return fmt.Errorf("check: binary %q: %q and %q, of types %q and %q, do not have unsigned integer types",
+		if !typ.IsNumType() {
+			return fmt.Errorf("check: binary %q: %q and %q, of types %q and %q, do not have integer types",
 				op.AmbiguousForm().Str(q.tm),
 				lhs.Str(q.tm), rhs.Str(q.tm),
 				lTyp.Str(q.tm), rTyp.Str(q.tm),
@@ -876,17 +1001,47 @@ func (q *checker) tcheckExprBinaryOp(n *a.Expr, depth uint32) error {
 		n.SetConstValue(ncv)
 	}
 
-	if (op < t.ID(len(comparisonOps))) && comparisonOps[op] {
-		n.SetMType(typeExprBool)
-	} else if !lTyp.IsIdeal() {
+	switch op {
+	case t.IDXBinaryShiftL, t.IDXBinaryShiftR, t.IDXBinaryTildeModShiftL, t.IDXBinaryTildeModShiftR:
+		// A shift's type is its lhs' type, even if its rhs' type is wider.
 		n.SetMType(lTyp.Unrefined())
-	} else {
-		n.SetMType(rTyp.Unrefined())
+	default:
+		if (op < t.ID(len(comparisonOps))) && comparisonOps[op] {
+			n.SetMType(typeExprBool)
+		} else {
+			n.SetMType(widerNumType(lTyp, rTyp))
+		}
 	}
 
 	return nil
 }
 
+// widerNumType returns the type that x and y are both implicitly widened to,
+// when mixing them in a binary or associative op, or nil if there is no such
+// type. Widening never narrows: an unsigned integer type widens to a larger
+// unsigned or signed integer type, a signed integer type widens to a larger
+// signed integer type and an ideal type widens to any other type.
+//
+// In C terms, the usual arithmetic conversions (and integer promotions) of
+// the generated code then compute the same result, as each widening there is
+// also value-preserving.
+func widerNumType(x *a.TypeExpr, y *a.TypeExpr) *a.TypeExpr {
+	if x.IsIdeal() {
+		return y.Unrefined()
+	} else if y.IsIdeal() || x.EqIgnoringRefinements(y) {
+		return x.Unrefined()
+	} else if !x.IsNumType() || !y.IsNumType() {
+		return nil
+	}
+	xb, yb := numTypeBounds[x.QID()[1]], numTypeBounds[y.QID()[1]]
+	if yb.ContainsIntRange(xb) {
+		return y.Unrefined()
+	} else if xb.ContainsIntRange(yb) {
+		return x.Unrefined()
+	}
+	return nil
+}
+
 func evalConstValueBinaryOp(tm *t.Map, n *a.Expr, l *big.Int, r *big.Int) (*big.Int, error) {
 	switch n.Operator() {
 	case t.IDXBinaryPlus:
@@ -899,9 +1054,9 @@ func evalConstValueBinaryOp(tm *t.Map, n *a.Expr, l *big.Int, r *big.Int) (*big.
 		if r.Sign() == 0 {
 			return nil, fmt.Errorf("check: division by zero in const expression %q", n.Str(tm))
 		}
-		// TODO: decide on Euclidean division vs other definitions. See "go doc
-		// math/big int.divmod" for details.
-		return big.NewInt(0).Div(l, r), nil
+		// Like C, division truncates towards zero (it is not Euclidean
+		// division). See "go doc math/big int.quorem" for details.
+		return big.NewInt(0).Quo(l, r), nil
 	case t.IDXBinaryShiftL:
 		if r.Sign() < 0 || r.Cmp(ffff) > 0 {
 			return nil, fmt.Errorf("check: shift %q out of range in const expression %q",
@@ -924,7 +1079,7 @@ func evalConstValueBinaryOp(tm *t.Map, n *a.Expr, l *big.Int, r *big.Int) (*big.
 		if r.Sign() == 0 {
 			return nil, fmt.Errorf("check: division by zero in const expression %q", n.Str(tm))
 		}
-		return big.NewInt(0).Mod(l, r), nil
+		return big.NewInt(0).Rem(l, r), nil
 	case t.IDXBinaryNotEq:
 		return btoi(l.Cmp(r) != 0), nil
 	case t.IDXBinaryLessThan:
@@ -943,7 +1098,7 @@ func evalConstValueBinaryOp(tm *t.Map, n *a.Expr, l *big.Int, r *big.Int) (*big.
 		return btoi((l.Sign() != 0) || (r.Sign() != 0)), nil
 
 	case t.IDXBinaryTildeModPlus, t.IDXBinaryTildeModMinus,
-		t.IDXBinaryTildeModStar, t.IDXBinaryTildeModShiftL,
+		t.IDXBinaryTildeModStar, t.IDXBinaryTildeModShiftL, t.IDXBinaryTildeModShiftR,
 		t.IDXBinaryTildeSatPlus, t.IDXBinaryTildeSatMinus:
 
 		return nil, fmt.Errorf("check: cannot apply tilde-operators to ideal numbers")
@@ -974,12 +1129,15 @@ func (q *checker) tcheckExprAssociativeOp(n *a.Expr, depth uint32) error {
 				expr, typ = o, oTyp.Unrefined()
 				continue
 			}
-			if !typ.EqIgnoringRefinements(oTyp) {
+			wider := widerNumType(typ, oTyp)
+			if wider == nil {
 				return fmt.Errorf("check: associative %q: %q and %q, of types %q and %q, "+
 					"do not have compatible types",
 					n.Operator().AmbiguousForm().Str(q.tm),
 					expr.Str(q.tm), o.Str(q.tm),
 					expr.MType().Str(q.tm), o.MType().Str(q.tm))
+			} else if !wider.Eq(typ) {
+				expr, typ = o, wider
 			}
 		}
 		if typ == nil {
@@ -0,0 +1,378 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file infers the bounds of local variables at the start of each while
+// loop iteration, by abstract interpretation, so that loops whose counters
+// take non-unit strides or grow geometrically don't need hand-written inv or
+// post conditions. For example, in:
+//
+//	n = 1
+//	while n < 1000 {
+//		n = n * 2
+//	} endwhile
+//
+// n is in [1 ..= 1998] at the start of each iteration and in [1000 ..= 1998]
+// after the loop.
+//
+// The abstract state maps each numeric local variable to an interval. Those
+// that the loop cannot modify keep their bounds from before the loop. For the
+// others, starting from their bounds before the loop, the loop body is
+// speculatively bounds checked assuming that state (as well as the explicit
+// pre and inv conditions and the while condition), and the bounds at each
+// implicit or explicit continue are united with the state. A bound that still
+// changes is widened to that of the variable's type, so that this terminates.
+// Narrowing passes then recover the precision lost by widening, as the while
+// condition typically bounds what a counter can be at the end of the body.
+//
+// Each state that is used, other than the initial one, has been confirmed to
+// be a fixpoint: checking the body assuming it does not lead to a continue
+// outside of it. If no such state can be found, e.g. because a speculative
+// check fails, the modified variables are left unbounded, as they were before
+// this inference was implemented.
+//
+// Speculative checks have no side effects other than the MBounds that they
+// cache on the body's expressions, which are dropped afterwards. Each function
+// has a budget of speculative checks, so that deeply nested loops do not take
+// exponential time. Once it is spent, loops are checked as if every variable
+// that they modify could have any value of its type.
+
+import (
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+const (
+	// maxWideningPasses and maxNarrowingPasses are per loop.
+	maxWideningPasses  = 8
+	maxNarrowingPasses = 2
+
+	// speculationBudget is per function.
+	speculationBudget = 256
+)
+
+// loopState is the inferred state of a while loop's local variables. An
+// element of bounds is nil for a variable whose bounds are unknown, other
+// than those of its type.
+type loopState struct {
+	vars   []*a.Expr
+	bounds []bounds
+
+	// continues and breaks are the united states at the continues (explicit
+	// or implicit) and breaks seen so far, or nil if there are none.
+	continues []bounds
+	breaks    []bounds
+}
+
+// localNumVars returns the function's numeric local variables, as expressions
+// with their MType set, in declaration order.
+func (q *checker) localNumVars() []*a.Expr {
+	ret := []*a.Expr(nil)
+	for _, o := range q.astFunc.Body() {
+		if o.Kind() != a.KVar {
+			break
+		}
+		if typ := o.AsVar().XType(); typ.IsNumType() {
+			ret = append(ret, newVarExpr(o.AsVar().Name(), typ))
+		}
+	}
+	return ret
+}
+
+func newVarExpr(name t.ID, typ *a.TypeExpr) *a.Expr {
+	x := a.NewExpr(0, 0, name, nil, nil, nil, nil)
+	x.SetMType(typ)
+	return x
+}
+
+// varBounds returns the bounds, per the current facts, of each variable. It
+// returns false if the facts are inconsistent, such as "x < 3" and "x > 5",
+// which means that the current statement is unreachable.
+func (q *checker) varBounds(vars []*a.Expr) ([]bounds, bool) {
+	ret := make([]bounds, len(vars))
+	for i, v := range vars {
+		// bcheckExpr caches the bounds in the expression, so use a copy.
+		nb, err := q.bcheckExpr(newVarExpr(v.Ident(), v.MType()), 0)
+		if err != nil {
+			return nil, false
+		}
+		ret[i] = nb
+	}
+	return ret, true
+}
+
+// unite returns the element-wise union of x and y, either of which may be nil
+// for an unreachable state.
+func unite(x []bounds, y []bounds) []bounds {
+	if x == nil {
+		return y
+	} else if y == nil {
+		return x
+	}
+	ret := make([]bounds, len(x))
+	for i := range x {
+		if (x[i][0] == nil) || (y[i][0] == nil) {
+			continue
+		}
+		ret[i] = bounds{min(x[i][0], y[i][0]), max(x[i][1], y[i][1])}
+	}
+	return ret
+}
+
+// recordLoopExit records the state at a break or continue of a while loop
+// whose state is being inferred.
+func (q *checker) recordLoopExit(n *a.Jump) {
+	w, ok := n.JumpTarget().(*a.While)
+	if !ok {
+		return
+	}
+	s := q.loops[w]
+	if s == nil {
+		return
+	}
+	b, ok := q.varBounds(s.vars)
+	if !ok {
+		return
+	}
+	if n.Keyword() == t.IDBreak {
+		s.breaks = unite(s.breaks, b)
+	} else {
+		s.continues = unite(s.continues, b)
+	}
+}
+
+// appendLoopFacts adds facts for each variable whose bounds are tighter than
+// those of its type. If that makes the facts inconsistent, such as for a loop
+// condition that is never true on entry, it adds none of them and returns
+// false, as the code that they apply to is unreachable and was, before this
+// inference, checked without them.
+func (q *checker) appendLoopFacts(vars []*a.Expr, state []bounds) (consistent bool, retErr error) {
+	oldFacts := snapshot(q.facts.exprs())
+	oldLen := len(oldFacts)
+	for i, v := range vars {
+		if state[i][0] == nil {
+			continue
+		}
+		tb, err := q.bcheckTypeExpr(v.MType())
+		if err != nil {
+			return false, err
+		}
+		if lo := state[i][0]; lo.Cmp(tb[0]) > 0 {
+			cv, err := makeConstValueExpr(q.tm, lo)
+			if err != nil {
+				return false, err
+			}
+			q.facts.appendBinaryOpFact(t.IDXBinaryGreaterEq, newVarExpr(v.Ident(), v.MType()), cv)
+		}
+		if hi := state[i][1]; hi.Cmp(tb[1]) < 0 {
+			cv, err := makeConstValueExpr(q.tm, hi)
+			if err != nil {
+				return false, err
+			}
+			q.facts.appendBinaryOpFact(t.IDXBinaryLessEq, newVarExpr(v.Ident(), v.MType()), cv)
+		}
+	}
+	if len(q.facts.exprs()) != oldLen {
+		if _, ok := q.varBounds(vars); !ok {
+			q.facts.reset(oldFacts)
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// inferLoopState returns the state at the start of each iteration of n. The
+// facts are those that hold before the loop.
+func (q *checker) inferLoopState(n *a.While) (*loopState, error) {
+	vars := q.localNumVars()
+	entry, ok := q.varBounds(vars)
+	if !ok {
+		// The loop is unreachable.
+		return &loopState{vars: vars, bounds: make([]bounds, len(vars))}, nil
+	}
+
+	modified := make([]bool, len(vars))
+	anyModified := false
+	for i, v := range vars {
+		modified[i] = mayModify(n.AsNode(), v)
+		anyModified = anyModified || modified[i]
+	}
+	// forget sets the modified variables' bounds to unknown.
+	forget := func(state []bounds) *loopState {
+		for i := range state {
+			if modified[i] {
+				state[i] = bounds{}
+			}
+		}
+		return &loopState{vars: vars, bounds: state}
+	}
+
+	state := append([]bounds(nil), entry...)
+	if !anyModified {
+		return &loopState{vars: vars, bounds: state}, nil
+	}
+
+	// Widen until the state is a fixpoint: until uniting the entry state with
+	// the state at each continue no longer grows it. Bounds that grow are
+	// widened to those of the variable's type.
+	next := []bounds(nil)
+	for pass := 0; ; pass++ {
+		if pass == maxWideningPasses {
+			return forget(state), nil
+		}
+		cont, ok, err := q.speculateLoop(n, vars, state)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			return forget(state), nil
+		}
+		next = unite(entry, cont)
+
+		grew := false
+		for i := range state {
+			if !modified[i] {
+				continue
+			}
+			tb, err := q.bcheckTypeExpr(vars[i].MType())
+			if err != nil {
+				return nil, err
+			}
+			if next[i][0].Cmp(state[i][0]) < 0 {
+				state[i][0], grew = tb[0], true
+			}
+			if next[i][1].Cmp(state[i][1]) > 0 {
+				state[i][1], grew = tb[1], true
+			}
+		}
+		if !grew {
+			break
+		}
+	}
+
+	// Narrow, keeping the most recent state that was confirmed to be a
+	// fixpoint. The next slice holds the united state that state leads to.
+	for pass := 0; pass < maxNarrowingPasses; pass++ {
+		narrower := make([]bounds, len(state))
+		changed := false
+		for i := range state {
+			narrower[i] = state[i]
+			if modified[i] && !state[i].Eq(next[i]) {
+				narrower[i] = state[i].Intersect(next[i])
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+		cont, ok, err := q.speculateLoop(n, vars, narrower)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			break
+		}
+		narrowerNext := unite(entry, cont)
+		fixpoint := true
+		for i := range narrower {
+			fixpoint = fixpoint && narrower[i].ContainsIntRange(narrowerNext[i])
+		}
+		if !fixpoint {
+			break
+		}
+		state, next = narrower, narrowerNext
+	}
+	return &loopState{vars: vars, bounds: state}, nil
+}
+
+// speculateLoop bounds checks n's body, assuming the given state, and returns
+// the united state at its continues, which is nil if there are none. It
+// returns false if the check fails or if the speculation budget is spent.
+func (q *checker) speculateLoop(n *a.While, vars []*a.Expr, state []bounds) (cont []bounds, ok bool, retErr error) {
+	if q.speculations >= speculationBudget {
+		return nil, false, nil
+	}
+	q.speculations++
+
+	// Save everything that bounds checking the body can change.
+	oldFacts := snapshot(q.facts.exprs())
+	oldLog := q.facts.log
+	oldLoops := q.loops
+	oldResultBounds := q.resultBounds
+	oldErrFilename, oldErrLine, oldErrSpan := q.errFilename, q.errLine, q.errSpan
+	oldSuggester, oldExplainer, oldQuery := q.c.suggester, q.c.explainer, q.c.query
+	oldNumFuncWarnings := len(q.c.funcWarnings)
+	bounded := boundedExprsIn(n.Body())
+
+	q.facts.log = nil
+	q.loops = map[*a.While]*loopState{}
+	q.c.suggester, q.c.explainer, q.c.query = nil, nil, nil
+	defer func() {
+		dropCachedMBoundsIn(n.Body(), bounded)
+		q.facts.reset(oldFacts)
+		q.facts.log = oldLog
+		q.loops = oldLoops
+		q.resultBounds = oldResultBounds
+		q.errFilename, q.errLine, q.errSpan = oldErrFilename, oldErrLine, oldErrSpan
+		q.c.suggester, q.c.explainer, q.c.query = oldSuggester, oldExplainer, oldQuery
+		q.c.funcWarnings = q.c.funcWarnings[:oldNumFuncWarnings]
+	}()
+
+	s := &loopState{vars: vars, bounds: state}
+	q.loops[n] = s
+	if err := q.enterWhileBody(n, s); err != nil {
+		return nil, false, nil
+	}
+	if err := q.bcheckBlock(n.Body()); err != nil {
+		if _, ok := err.(*Error); ok {
+			// An error from checking another function, such as a callee
+			// whose result bounds are inferred, is not speculative.
+			return nil, false, err
+		}
+		return nil, false, nil
+	}
+	if !a.Terminates(n.Body()) {
+		if b, ok := q.varBounds(vars); ok {
+			s.continues = unite(s.continues, b)
+		}
+	}
+	return s.continues, true, nil
+}
+
+// enterWhileBody resets the facts to those at the start of n's body: the pre
+// and inv conditions, the while condition (unless it is the redundant "true")
+// and the inferred state.
+func (q *checker) enterWhileBody(n *a.While, s *loopState) error {
+	q.facts.clear()
+	for _, o := range n.Asserts() {
+		if o.AsAssert().Keyword() == t.IDPost {
+			continue
+		}
+		q.facts.appendFact(o.AsAssert().Condition())
+	}
+	if n.Condition().ConstValue() == nil {
+		if err := q.appendCondition(n.Condition()); err != nil {
+			return err
+		}
+	}
+	if _, err := q.appendLoopFacts(s.vars, s.bounds); err != nil {
+		return err
+	}
+	// Check that the decreases expression, if any, is non-negative.
+	if n.Decreases() != nil {
+		if err := q.bcheckDecreasesEntry(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
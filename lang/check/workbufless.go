@@ -0,0 +1,175 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+// This file implements workbuf_less functions: variants of a public method
+// that takes a workbuf, that do without one (perhaps more slowly, or with
+// fewer features), marked by a "workbuf_less" annotation, such as:
+//
+//   pub func decoder.decode_frame?(dst: ptr base.pixel_buffer, etc, workbuf: slice base.u8, etc) {
+//       etc
+//   }
+//
+//   pub func decoder.decode_frame_workbuf_less?(dst: ptr base.pixel_buffer, etc, etc),
+//       workbuf_less,
+//   {
+//       etc
+//   }
+//
+// Memory-constrained callers can then pass WUFFS_INITIALIZE__WORKBUF_LESS to
+// the initialize function. The C code generator makes the workbuf_len method
+// return zero and the decode_frame method (which ignores its workbuf
+// argument) call decode_frame_workbuf_less, in that mode.
+//
+// The checker verifies that the variant's name is its counterpart's name plus
+// a "_workbuf_less" suffix and that its arguments are its counterpart's, minus
+// the workbuf, and that it never calls a function that takes a workbuf,
+// directly or indirectly (via this package's other functions), other than
+// with an empty one (this.util.empty_slice_u8()). Both variants are otherwise
+// checked (e.g. bounds checked) independently, like any other function.
+//
+// If a receiver has any workbuf_less functions then each of its public
+// methods that take a workbuf needs one, and it needs a workbuf_len method.
+
+import (
+	"fmt"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+const workbufLessSuffix = "_workbuf_less"
+
+func (c *Checker) checkFuncWorkbufLess(node *a.Node) error {
+	n := node.AsFunc()
+	if !n.WorkbufLess() {
+		return nil
+	}
+	if err := c.checkFuncWorkbufLess1(n); err != nil {
+		if _, ok := err.(*Error); ok {
+			return err
+		}
+		return &Error{
+			Err:      err,
+			Filename: n.Filename(),
+			Line:     n.Line(),
+		}
+	}
+	return nil
+}
+
+func (c *Checker) checkFuncWorkbufLess1(n *a.Func) error {
+	qqid := n.QQID()
+	recv := n.Receiver()
+	if recv.IsZero() {
+		return fmt.Errorf("check: workbuf_less function %q has no receiver", qqid.Str(c.tm))
+	}
+	name := n.FuncName().Str(c.tm)
+	if !strings.HasSuffix(name, workbufLessSuffix) {
+		return fmt.Errorf("check: workbuf_less function %q's name does not end with %q",
+			qqid.Str(c.tm), workbufLessSuffix)
+	}
+
+	workbuf := c.tm.ByName("workbuf")
+	other := (*a.Func)(nil)
+	if id := c.tm.ByName(strings.TrimSuffix(name, workbufLessSuffix)); id != 0 {
+		other = c.funcs[t.QQID{recv[0], recv[1], id}]
+	}
+	if (other == nil) || !other.Public() || other.WorkbufLess() || !hasInParam(other, workbuf) {
+		return fmt.Errorf("check: workbuf_less function %q has no public counterpart "+
+			"\"%s.%s\" with a workbuf argument",
+			qqid.Str(c.tm), recv[1].Str(c.tm), strings.TrimSuffix(name, workbufLessSuffix))
+	}
+	if !workbufLessSignatureMatches(n, other, workbuf) {
+		return fmt.Errorf("check: workbuf_less function %q's signature does not match %q's, "+
+			"minus the workbuf argument", qqid.Str(c.tm), other.QQID().Str(c.tm))
+	}
+
+	workbufLen := c.tm.ByName("workbuf_len")
+	if f := c.funcs[t.QQID{recv[0], recv[1], workbufLen}]; (workbufLen == 0) || (f == nil) ||
+		!f.Public() || !f.Effect().Pure() || (len(f.In().Fields()) != 0) ||
+		(f.Out() == nil) || !f.Out().Eq(typeExprRangeIIU64) {
+		return fmt.Errorf("check: workbuf_less function %q's receiver has no "+
+			"\"pub func %s.workbuf_len() base.range_ii_u64\" method",
+			qqid.Str(c.tm), recv[1].Str(c.tm))
+	}
+
+	// In workbuf-less mode, workbuf_len returns zero, so every method that
+	// takes a workbuf needs a variant.
+	for _, f := range c.funcs {
+		if (f.Receiver() != recv) || !f.Public() || !hasInParam(f, workbuf) {
+			continue
+		}
+		id := c.tm.ByName(f.FuncName().Str(c.tm) + workbufLessSuffix)
+		if g := c.funcs[t.QQID{recv[0], recv[1], id}]; (id == 0) || (g == nil) || !g.WorkbufLess() {
+			return fmt.Errorf("check: %q has a workbuf_less function but %q has no "+
+				"workbuf_less variant", recv.Str(c.tm), f.QQID().Str(c.tm))
+		}
+	}
+
+	emptySliceU8 := c.tm.ByName("empty_slice_u8")
+	return c.walkCallGraph(n, func(caller *a.Func, callee *a.Func, call *a.Expr) (bool, error) {
+		if !hasInParam(callee, workbuf) {
+			return true, nil
+		}
+		for _, o := range call.Args() {
+			o := o.AsArg()
+			if (o.Name() == workbuf) && isEmptySliceU8Call(o.Value(), emptySliceU8) {
+				// The callee has no workbuf, so there's no need to walk it.
+				return false, nil
+			}
+		}
+		return false, fmt.Errorf("check: workbuf_less function %q cannot (via %q) call %q "+
+			"with a non-empty workbuf",
+			qqid.Str(c.tm), caller.QQID().Str(c.tm), callee.QQID().Str(c.tm))
+	})
+}
+
+// workbufLessSignatureMatches returns whether n's effect, arguments and return
+// type are other's, minus other's workbuf argument.
+func workbufLessSignatureMatches(n *a.Func, other *a.Func, workbuf t.ID) bool {
+	if (n.Effect() != other.Effect()) || !n.Out().Eq(other.Out()) {
+		return false
+	}
+
+	nIn := n.In().Fields()
+	for _, o := range other.In().Fields() {
+		o := o.AsField()
+		if o.Name() == workbuf {
+			continue
+		}
+		if len(nIn) == 0 {
+			return false
+		}
+		p := nIn[0].AsField()
+		nIn = nIn[1:]
+		if (p.Name() != o.Name()) || !p.XType().Eq(o.XType()) {
+			return false
+		}
+	}
+	return len(nIn) == 0
+}
+
+// isEmptySliceU8Call returns whether x is a "this.util.empty_slice_u8()"
+// call (or the equivalent for any other base.utility value).
+func isEmptySliceU8Call(x *a.Expr, emptySliceU8 t.ID) bool {
+	if (emptySliceU8 == 0) || (x.Operator() != a.ExprOperatorCall) {
+		return false
+	}
+	lTyp := x.LHS().AsExpr().MType()
+	return lTyp.IsFuncType() && (lTyp.FuncName() == emptySliceU8) &&
+		(lTyp.Receiver().QID() == t.QID{t.IDBase, t.IDUtility})
+}
@@ -0,0 +1,275 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package diagnostic provides machine-readable diagnostics (errors and
+// warnings), for editors and CI bots to show Wuffs errors next to the source
+// code that caused them.
+//
+// Diagnostics are written as JSON, one object per line. For example:
+//
+//	{"severity":"error","code":"check.bounds","message":"check: cannot prove \"x < 10\": failed","filename":"std/foo/foo.wuffs","line":12,"column":9,"end_column":15}
+package diagnostic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrReported is returned by a command whose errors have already been written
+// as diagnostics. The command's caller should not print it again, but should
+// still treat it as a failure.
+var ErrReported = errors.New("diagnostic: errors were reported as JSON")
+
+// ErrorList is a list of errors, such as the errors in each of a package's
+// function bodies, when the parser or checker carries on after the first one.
+type ErrorList []error
+
+// Error returns the errors' messages, one per line.
+func (l ErrorList) Error() string {
+	b := []byte(nil)
+	for i, err := range l {
+		if i > 0 {
+			b = append(b, '\n')
+		}
+		b = append(b, err.Error()...)
+	}
+	return string(b)
+}
+
+// Err returns nil if l is empty, l's only element if it has one, and l
+// otherwise. Callers that expect at most one error can therefore still use a
+// type assertion, such as err.(*check.Error).
+func (l ErrorList) Err() error {
+	switch len(l) {
+	case 0:
+		return nil
+	case 1:
+		return l[0]
+	}
+	return l
+}
+
+// Split returns err's elements, if it is an ErrorList, or just err otherwise.
+func Split(err error) []error {
+	if l, ok := err.(ErrorList); ok {
+		return l
+	}
+	return []error{err}
+}
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is an error or warning about Wuffs source code.
+type Diagnostic struct {
+	// Severity is SeverityError or SeverityWarning.
+	Severity string `json:"severity"`
+
+	// Code classifies the diagnostic, such as "parse", "check.bounds" or
+	// "cgen". The part before any "." names the compiler stage.
+	Code string `json:"code"`
+
+	// Message is the human-readable message, without the location.
+	Message string `json:"message"`
+
+	// Filename and Line are where the diagnostic applies. A zero Line means
+	// that the location is unknown.
+	Filename string `json:"filename,omitempty"`
+	Line     uint32 `json:"line,omitempty"`
+
+	// Column and EndColumn, if non-zero, are the span within the Line, as
+	// 1-based byte offsets. EndColumn is exclusive. See SetSpan.
+	Column    int `json:"column,omitempty"`
+	EndColumn int `json:"end_column,omitempty"`
+
+	// Related are other locations relevant to the diagnostic, such as where
+	// each of the facts were established, for a failed proof.
+	Related []Related `json:"related,omitempty"`
+}
+
+// Related is a location related to a Diagnostic.
+type Related struct {
+	Message  string `json:"message"`
+	Filename string `json:"filename,omitempty"`
+	Line     uint32 `json:"line,omitempty"`
+}
+
+// Diagnoser is implemented by errors, such as *check.Error, that can describe
+// themselves as a Diagnostic.
+type Diagnoser interface {
+	Diagnostic() Diagnostic
+}
+
+// locationSuffix matches the " at filename:line:column" or " at
+// filename:line" that the tokenizer and parser append to their error
+// messages.
+var locationSuffix = regexp.MustCompile(`^(?s)(.*) at (\S+?):(\d+)(?::(\d+))?$`)
+
+// FromError converts err to a Diagnostic. If err (or an error that it wraps)
+// is a Diagnoser, its Diagnostic is used. Otherwise, the location is parsed
+// from the end of err's message, if present, and the code is the message's
+// prefix (such as "parse" for "parse: expected etc") if that names a compiler
+// stage.
+func FromError(err error) Diagnostic {
+	if d := Diagnoser(nil); errors.As(err, &d) {
+		return d.Diagnostic()
+	}
+	ret := Diagnostic{
+		Severity: SeverityError,
+		Code:     Code(err.Error()),
+		Message:  err.Error(),
+	}
+	if m := locationSuffix.FindStringSubmatch(ret.Message); m != nil {
+		if line, err := strconv.ParseUint(m[3], 10, 32); err == nil {
+			ret.Message, ret.Filename, ret.Line = m[1], m[2], uint32(line)
+			if column, err := strconv.ParseUint(m[4], 10, 31); err == nil {
+				ret.Column = int(column)
+			}
+		}
+	}
+	return ret
+}
+
+// Code returns the code for a message, based on its "stage: " prefix, such as
+// "cgen" or "parse", and whether it is an internal error. It returns "error"
+// if the message has no such prefix.
+func Code(message string) string {
+	code := "error"
+	for _, stage := range [...]string{"cgen", "check", "parse", "token"} {
+		if strings.HasPrefix(message, stage+":") {
+			code = stage
+			break
+		}
+	}
+	if (code != "error") && strings.Contains(message, "internal error") {
+		code += ".internal"
+	}
+	return code
+}
+
+// SetSpan sets d's Column and EndColumn, if not already known, given src, the
+// contents of d's Filename.
+//
+// If d's Column is known but its EndColumn is not, such as for a parse error
+// at a given token, the span ends after the quoted fragment of d's Message
+// that appears verbatim at that Column, or else at the end of the line.
+//
+// If neither is known, the span is that of the first quoted fragment of d's
+// Message, such as the "x < 10" in `cannot prove "x < 10"`, if that appears
+// verbatim on d's Line. Otherwise, it is the whole line. Either way, leading
+// and trailing white space is not part of the span.
+func (d *Diagnostic) SetSpan(src []byte) {
+	if (d.Line == 0) || ((d.Column != 0) && (d.EndColumn != 0)) {
+		return
+	}
+	line := []byte(nil)
+	for n := uint32(1); ; n++ {
+		i := bytes.IndexByte(src, '\n')
+		if n == d.Line {
+			if i >= 0 {
+				line = src[:i]
+			} else {
+				line = src
+			}
+			break
+		} else if i < 0 {
+			return
+		}
+		src = src[i+1:]
+	}
+
+	i, j := 0, len(line)
+	for (i < j) && isSpace(line[i]) {
+		i++
+	}
+	for (i < j) && isSpace(line[j-1]) {
+		j--
+	}
+
+	if d.Column != 0 {
+		rest := []byte(nil)
+		if d.Column <= len(line) {
+			rest = line[d.Column-1:]
+		}
+		for _, q := range quoted(d.Message) {
+			if (q != "") && bytes.HasPrefix(rest, []byte(q)) {
+				d.EndColumn = d.Column + len(q)
+				return
+			}
+		}
+		if d.Column <= j {
+			d.EndColumn = j + 1
+		}
+		return
+	}
+
+	if q := quoted(d.Message); (len(q) > 0) && (q[0] != "") {
+		if k := bytes.Index(line, []byte(q[0])); k >= 0 {
+			d.Column, d.EndColumn = k+1, k+1+len(q[0])
+			return
+		}
+	}
+	if i < j {
+		d.Column, d.EndColumn = i+1, j+1
+	}
+}
+
+// quoted returns the unquoted contents of the Go-quoted strings in s, in
+// order. It stops at the first malformed one.
+func quoted(s string) (ret []string) {
+	for {
+		i := strings.IndexByte(s, '"')
+		if i < 0 {
+			return ret
+		}
+		j := i + 1
+		for ; (j < len(s)) && (s[j] != '"'); j++ {
+			if s[j] == '\\' {
+				j++
+			}
+		}
+		if j >= len(s) {
+			return ret
+		}
+		u, err := strconv.Unquote(s[i : j+1])
+		if err != nil {
+			return ret
+		}
+		ret = append(ret, u)
+		s = s[j+1:]
+	}
+}
+
+func isSpace(c byte) bool {
+	return (c == ' ') || (c == '\t') || (c == '\r')
+}
+
+// Write writes ds to w as JSON, one Diagnostic per line.
+func Write(w io.Writer, ds ...Diagnostic) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, d := range ds {
+		if err := enc.Encode(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagnostic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+const testSrc = `pri func f() {
+	var x : base.u32
+	x = "abc" + 1
+}
+`
+
+type testDiagnoser struct{}
+
+func (testDiagnoser) Error() string { return "test" }
+
+func (testDiagnoser) Diagnostic() Diagnostic {
+	return Diagnostic{Severity: SeverityWarning, Code: "test", Message: "test"}
+}
+
+func TestFromError(tt *testing.T) {
+	testCases := []struct {
+		err  error
+		want string
+	}{{
+		errors.New("parse: expected identifier at a.wuffs:3"),
+		`error parse "parse: expected identifier" a.wuffs:3 2-15`,
+	}, {
+		errors.New(`parse: expected "\"abc\"" at a.wuffs:3`),
+		`error parse "parse: expected \"\\\"abc\\\"\"" a.wuffs:3 6-11`,
+	}, {
+		errors.New(`parse: expected ")", got "\"abc\"" at a.wuffs:3:6`),
+		`error parse "parse: expected \")\", got \"\\\"abc\\\"\"" a.wuffs:3 6-11`,
+	}, {
+		errors.New("parse: unexpected token at a.wuffs:3:4"),
+		`error parse "parse: unexpected token" a.wuffs:3 4-15`,
+	}, {
+		errors.New("cgen: internal error: oops at a.wuffs:2"),
+		`error cgen.internal "cgen: internal error: oops" a.wuffs:2 2-18`,
+	}, {
+		errors.New("token: no location"),
+		`error token "token: no location" :0 0-0`,
+	}, {
+		errors.New("something else at a.wuffs:99"),
+		`error error "something else" a.wuffs:99 0-0`,
+	}, {
+		fmt.Errorf("wrapped: %w", testDiagnoser{}),
+		`warning test "test" :0 0-0`,
+	}}
+
+	for _, tc := range testCases {
+		d := FromError(tc.err)
+		d.SetSpan([]byte(testSrc))
+		got := fmt.Sprintf("%s %s %q %s:%d %d-%d",
+			d.Severity, d.Code, d.Message, d.Filename, d.Line, d.Column, d.EndColumn)
+		if got != tc.want {
+			tt.Errorf("%v:\ngot  %s\nwant %s", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestWrite(tt *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := Write(buf, Diagnostic{
+		Severity: SeverityError,
+		Code:     "check.bounds",
+		Message:  `check: cannot prove "x < y"`,
+		Filename: "a.wuffs",
+		Line:     2,
+		Related:  []Related{{Message: "fact: x <= 9"}},
+	}, Diagnostic{
+		Severity: SeverityWarning,
+		Code:     "check.dead_store",
+		Message:  "check: value assigned to \"x\" is never used",
+	}); err != nil {
+		tt.Fatalf("Write: %v", err)
+	}
+	got := buf.String()
+	want := `{"severity":"error","code":"check.bounds","message":"check: cannot prove \"x < y\"",` +
+		`"filename":"a.wuffs","line":2,"related":[{"message":"fact: x <= 9"}]}` + "\n" +
+		`{"severity":"warning","code":"check.dead_store","message":"check: value assigned to \"x\" is never used"}` + "\n"
+	if got != want {
+		tt.Errorf("\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestErrorList(tt *testing.T) {
+	e0 := errors.New("parse: oops at a.wuffs:3")
+	e1 := errors.New("parse: oops at a.wuffs:7")
+
+	if got := ErrorList(nil).Err(); got != nil {
+		tt.Errorf("empty list: got %v, want nil", got)
+	}
+	if got := (ErrorList{e0}).Err(); got != e0 {
+		tt.Errorf("one-element list: got %v, want %v", got, e0)
+	}
+	err := (ErrorList{e0, e1}).Err()
+	if got, want := err.Error(), "parse: oops at a.wuffs:3\nparse: oops at a.wuffs:7"; got != want {
+		tt.Errorf("two-element list:\ngot  %q\nwant %q", got, want)
+	}
+
+	if got := Split(err); (len(got) != 2) || (got[0] != e0) || (got[1] != e1) {
+		tt.Errorf("Split(list): got %v", got)
+	}
+	if got := Split(e0); (len(got) != 1) || (got[0] != e0) {
+		tt.Errorf("Split(e0): got %v", got)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package format implements the standard formatting of Wuffs source code, as
+// per the wuffsfmt command.
+//
+// Besides the Source function, for Go programs, the Serve function implements
+// a long-running protocol, for editor plugins that would otherwise run a
+// wuffsfmt process every time that they format a file.
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/google/wuffs/lang/diagnostic"
+	"github.com/google/wuffs/lang/parse"
+	"github.com/google/wuffs/lang/render"
+
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Options are optional arguments to Source. A nil *Options is valid and means
+// the zero value.
+type Options struct {
+	// SkipParse is whether to format src without parsing it first. By
+	// default, Source rejects syntax errors, like wuffsfmt does, but an
+	// editor can format incomplete code, provided that it tokenizes.
+	SkipParse bool
+}
+
+// Source formats src, the contents of the named file. The filename is only
+// used in error messages.
+func Source(filename string, src []byte, opts *Options) ([]byte, error) {
+	tm := &t.Map{}
+	tokens, comments, err := t.Tokenize(tm, filename, src)
+	if err != nil {
+		return nil, err
+	}
+	// We don't need the AST node to pretty-print, but it's worth rejecting
+	// syntax errors early. This is just a parse, not a full type check.
+	if (opts == nil) || !opts.SkipParse {
+		if _, err := parse.Parse(tm, filename, tokens, &parse.Options{
+			AllowDoubleUnderscoreNames: true,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := render.Render(buf, tm, tokens, comments); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Request is a request to format one file, read by Serve as one line of JSON.
+// For example:
+//
+//	{"id":1,"filename":"std/foo/foo.wuffs","src":"pri func f() {\n}\n"}
+type Request struct {
+	// ID is copied to the Response, so that a client can match them up.
+	ID int64 `json:"id"`
+
+	// Filename is only used in error messages.
+	Filename string `json:"filename,omitempty"`
+
+	// Src is the source code to format.
+	Src string `json:"src"`
+
+	// SkipParse is the Options field of the same name.
+	SkipParse bool `json:"skip_parse,omitempty"`
+}
+
+// Response is Serve's response to a Request, written as one line of JSON.
+// For example:
+//
+//	{"id":1,"dst":"pri func f() {\n}\n"}
+type Response struct {
+	ID int64 `json:"id"`
+
+	// Dst is the formatted source code. It is empty if there is an Error.
+	Dst string `json:"dst,omitempty"`
+
+	// Changed is whether Dst differs from the Request's Src. An editor can
+	// leave its buffer (and undo history) alone when nothing changed.
+	Changed bool `json:"changed,omitempty"`
+
+	// Error, if non-nil, is why the source code could not be formatted, such
+	// as a syntax error.
+	Error *diagnostic.Diagnostic `json:"error,omitempty"`
+}
+
+// Serve reads Requests from r and writes Responses to w, one per line and in
+// the same order, until r reaches EOF, which is not an error. A malformed
+// Request stops Serve, but a Request whose source code cannot be formatted
+// just gets a Response with an Error.
+func Serve(r io.Reader, w io.Writer) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for {
+		req := Request{}
+		if err := dec.Decode(&req); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		resp := Response{ID: req.ID}
+		dst, err := Source(req.Filename, []byte(req.Src), &Options{SkipParse: req.SkipParse})
+		if err != nil {
+			d := diagnostic.FromError(err)
+			d.SetSpan([]byte(req.Src))
+			resp.Error = &d
+		} else {
+			resp.Dst = string(dst)
+			resp.Changed = resp.Dst != req.Src
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const (
+	unformatted = "pri func f() {\nvar x : base.u32\n   x = 1\n}\n"
+	formatted   = "pri func f() {\n\tvar x : base.u32\n\tx = 1\n}\n"
+)
+
+func TestSource(tt *testing.T) {
+	testCases := []struct {
+		src       string
+		skipParse bool
+		want      string
+		wantErr   string
+	}{{
+		src:  unformatted,
+		want: formatted,
+	}, {
+		src:  formatted,
+		want: formatted,
+	}, {
+		src:     "pri func f() {\nx = (1 + 2\n}\n",
+		wantErr: `parse: expected ")", got ";" at a.wuffs:2:11`,
+	}, {
+		src:       "pri func f() {\nx = (1 + 2\n}\n",
+		skipParse: true,
+		want:      "pri func f() {\n\tx = (1 + 2\n}\n",
+	}, {
+		src:       "pri func f() {\nx = \"abc\n}\n",
+		skipParse: true,
+		wantErr:   `token: expected final " in string at a.wuffs:2:5`,
+	}}
+
+	for i, tc := range testCases {
+		got, err := Source("a.wuffs", []byte(tc.src), &Options{SkipParse: tc.skipParse})
+		if tc.wantErr != "" {
+			if (err == nil) || !strings.HasPrefix(err.Error(), tc.wantErr) {
+				tt.Errorf("tc #%d: got error %v, want %q", i, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			tt.Errorf("tc #%d: %v", i, err)
+		} else if string(got) != tc.want {
+			tt.Errorf("tc #%d:\ngot  %q\nwant %q", i, got, tc.want)
+		}
+	}
+}
+
+func TestServe(tt *testing.T) {
+	r := strings.NewReader(
+		`{"id":1,"filename":"a.wuffs","src":"pri func f() {\nvar x : base.u32\n   x = 1\n}\n"}` + "\n" +
+			`{"id":2,"src":"pri func f() {\n\tvar x : base.u32\n\tx = 1\n}\n"}` + "\n" +
+			`{"id":3,"filename":"b.wuffs","src":"pri func f() {\n\tx = (1 + 2\n}\n"}` + "\n")
+	w := &bytes.Buffer{}
+	if err := Serve(r, w); err != nil {
+		tt.Fatalf("Serve: %v", err)
+	}
+	got := w.String()
+	want := `{"id":1,"dst":"pri func f() {\n\tvar x : base.u32\n\tx = 1\n}\n","changed":true}` + "\n" +
+		`{"id":2,"dst":"pri func f() {\n\tvar x : base.u32\n\tx = 1\n}\n"}` + "\n" +
+		`{"id":3,"error":{"severity":"error","code":"parse","message":"parse: expected \")\", got \";\"",` +
+		`"filename":"b.wuffs","line":2,"column":12}}` + "\n"
+	if got != want {
+		tt.Errorf("\ngot  %s\nwant %s", got, want)
+	}
+
+	if err := Serve(strings.NewReader("{oops\n"), &bytes.Buffer{}); err == nil {
+		tt.Errorf("Serve(malformed): got nil error, want non-nil")
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"sync"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Package is a parsed and checked Wuffs package, a Backend's input. For the
+// base package, Name is "base" and there are no Files.
+type Package struct {
+	Name  string
+	TM    *t.Map
+	Files []*a.File
+}
+
+// Backend generates code, in one target language, for a Package.
+//
+// DoBackend calls Header, Impl and then AuxFiles, in that order and with the
+// same *Package, so that a Backend that generates everything in one pass can
+// do that work in Header and remember its results.
+type Backend interface {
+	// FileExtension is the target language's file extension, such as "c" or
+	// "go". It is also that language's name in "wuffs gen -langs".
+	FileExtension() string
+
+	// Header returns the declarations that other code needs to use the
+	// package. It may return nil, such as for a target language (like Go)
+	// that has no separate declarations or for a Backend that puts them and
+	// the implementation in the same file.
+	Header(p *Package) ([]byte, error)
+
+	// Impl returns the package's implementation.
+	Impl(p *Package) ([]byte, error)
+
+	// AuxFiles returns any other files to write, keyed by filename, such as a
+	// symbol map or a build file. A relative filename is relative to the
+	// -auxdir flag's directory.
+	AuxFiles(p *Package) (map[string][]byte, error)
+}
+
+// NewBackend returns a new Backend. The Backend's flags, if any, are added to
+// flags, and the Backend can read their values once they're parsed, when its
+// methods are called.
+type NewBackend func(flags *flag.FlagSet) Backend
+
+var registry struct {
+	mu          sync.Mutex
+	newBackends map[string]NewBackend
+}
+
+// Register makes a Backend available to Lookup and Main, keyed by its
+// FileExtension. Like the standard library's image.RegisterFormat, it is
+// typically called from an init function. It panics if that FileExtension is
+// invalid or already registered.
+func Register(newBackend NewBackend) {
+	ext := newBackend(&flag.FlagSet{}).FileExtension()
+	if !validFileExtension(ext) {
+		panic(fmt.Sprintf("generate: invalid backend file extension %q", ext))
+	}
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if _, ok := registry.newBackends[ext]; ok {
+		panic(fmt.Sprintf("generate: duplicate backend for file extension %q", ext))
+	}
+	if registry.newBackends == nil {
+		registry.newBackends = map[string]NewBackend{}
+	}
+	registry.newBackends[ext] = newBackend
+}
+
+// Lookup returns the registered NewBackend for the file extension, or nil if
+// there is none.
+func Lookup(fileExtension string) NewBackend {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return registry.newBackends[fileExtension]
+}
+
+// FileExtensions returns the registered Backends' file extensions, sorted.
+func FileExtensions() []string {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	ret := make([]string, 0, len(registry.newBackends))
+	for k := range registry.newBackends {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Main runs the registered Backend for the file extension as a command, like
+// "wuffs-c gen", that "wuffs gen -langs=ext" can run as "wuffs-ext gen". The
+// args are the command line arguments after the "gen".
+//
+// A program in another repository can plug in a new target language by
+// registering its Backend and calling Main from its main function, reusing
+// Wuffs' parsing, checking and flag handling.
+func Main(fileExtension string, args []string) error {
+	newBackend := Lookup(fileExtension)
+	if newBackend == nil {
+		return fmt.Errorf("generate: no backend registered for file extension %q", fileExtension)
+	}
+	flags := flag.FlagSet{}
+	return DoBackend(&flags, args, newBackend(&flags))
+}
+
+// validFileExtension is whether s is a valid "wuffs gen -langs" name.
+func validFileExtension(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; (c < '0' || '9' < c) && (c < 'a' || 'z' < c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Generator is a Backend in the form of a single function, which returns the
+// whole of the generated code. As a Backend, that code is its Impl and it has
+// no Header, AuxFiles or FileExtension, so it cannot be registered.
+type Generator func(packageName string, tm *t.Map, files []*a.File) ([]byte, error)
+
+func (g Generator) FileExtension() string                          { return "" }
+func (g Generator) Header(p *Package) ([]byte, error)              { return nil, nil }
+func (g Generator) Impl(p *Package) ([]byte, error)                { return g(p.Name, p.TM, p.Files) }
+func (g Generator) AuxFiles(p *Package) (map[string][]byte, error) { return nil, nil }
@@ -0,0 +1,89 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import (
+	"flag"
+	"testing"
+)
+
+type testBackend struct {
+	ext      string
+	greeting *string
+}
+
+func (b *testBackend) FileExtension() string                          { return b.ext }
+func (b *testBackend) Header(p *Package) ([]byte, error)              { return nil, nil }
+func (b *testBackend) Impl(p *Package) ([]byte, error)                { return []byte(*b.greeting), nil }
+func (b *testBackend) AuxFiles(p *Package) (map[string][]byte, error) { return nil, nil }
+
+func newTestBackend(ext string) NewBackend {
+	return func(flags *flag.FlagSet) Backend {
+		return &testBackend{
+			ext:      ext,
+			greeting: flags.String("greeting", "hello", "what to generate"),
+		}
+	}
+}
+
+func TestRegister(tt *testing.T) {
+	Register(newTestBackend("testa"))
+	Register(newTestBackend("testb"))
+
+	found := 0
+	for _, ext := range FileExtensions() {
+		if (ext == "testa") || (ext == "testb") {
+			found++
+		}
+	}
+	if found != 2 {
+		tt.Fatalf("FileExtensions: got %q, want testa and testb", FileExtensions())
+	}
+	if Lookup("testc") != nil {
+		tt.Fatalf("Lookup(testc): got non-nil, want nil")
+	}
+
+	// A NewBackend's flags are registered on, and parsed by, the FlagSet.
+	flags := flag.FlagSet{}
+	b := Lookup("testa")(&flags)
+	if err := flags.Parse([]string{"-greeting=hi"}); err != nil {
+		tt.Fatalf("Parse: %v", err)
+	}
+	if got, err := b.Impl(&Package{Name: "base"}); err != nil {
+		tt.Fatalf("Impl: %v", err)
+	} else if string(got) != "hi" {
+		tt.Fatalf("Impl: got %q, want %q", got, "hi")
+	}
+}
+
+func TestRegisterPanics(tt *testing.T) {
+	Register(newTestBackend("testd"))
+	testCases := []string{
+		"testd",
+		"",
+		"Test",
+		"te.st",
+	}
+	for _, tc := range testCases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					tt.Errorf("%q: Register did not panic", tc)
+				}
+			}()
+			Register(newTestBackend(tc))
+		}()
+	}
+}
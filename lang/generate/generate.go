@@ -15,14 +15,17 @@
 package generate
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/diagnostic"
 	"github.com/google/wuffs/lang/parse"
 	"github.com/google/wuffs/lang/wuffsroot"
 
@@ -30,49 +33,160 @@ import (
 	t "github.com/google/wuffs/lang/token"
 )
 
-type Generator func(packageName string, tm *t.Map, files []*a.File) ([]byte, error)
-
+// Do is DoBackend for a single function Generator.
 func Do(flags *flag.FlagSet, args []string, g Generator) error {
+	return DoBackend(flags, args, g)
+}
+
+// DoBackend parses the flags and args, then parses and checks the Wuffs
+// package that they name and generates b's code for it. The Header and Impl
+// are written to stdout, in that order, and any AuxFiles to the -auxdir flag's
+// directory.
+//
+// The args list the package's Wuffs files. If there are none, the package is
+// read from stdin, unless the -package_name flag is "base".
+func DoBackend(flags *flag.FlagSet, args []string, b Backend) error {
 	packageName := flags.String("package_name", "", "the package name of the Wuffs input code")
+	checkcachedir := flags.String("checkcachedir", "",
+		"if non-empty, the directory in which to cache which functions have already been bounds checked")
+	checkcacheurl := flags.String("checkcacheurl", "",
+		"if non-empty, the base URL of a remote (HTTP GET/PUT) cache of which functions have already been bounds checked, shared between machines")
+	checkcacheversion := flags.String("checkcacheversion", "",
+		"if non-empty, the version stamp identifying this checker for the -checkcacheurl cache; empty means a hash of this executable")
+	checkreport := flags.String("checkreport", "",
+		"if non-empty, the filename to write an HTML report of any check failure to")
+	jsonErrors := flags.Bool("json-errors", false,
+		"whether to write errors and warnings to stderr as JSON diagnostics, one per line")
+	failfast := flags.Bool("failfast", false,
+		"whether to stop at the first parse or check error, instead of carrying on to report more")
+	maxerrors := flags.Int("maxerrors", 10,
+		"the maximum number of parse or check errors to report")
+	auxdir := flags.String("auxdir", "",
+		"the directory to write auxiliary files (such as a symbol map) to, if the target language has any; empty means the current directory")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
-	out := []byte(nil)
+	if *failfast {
+		*maxerrors = 1
+	}
+	p := &Package{}
 
-	if *packageName == "base" && len(flags.Args()) == 0 {
-		var err error
-		out, err = g("base", nil, nil)
-		if err != nil {
+	// With -json-errors, an error is written as a diagnostic and replaced by
+	// diagnostic.ErrReported, so that it isn't printed twice.
+	stdin := []byte(nil)
+	report := func(err error) error {
+		if (err == nil) || !*jsonErrors {
 			return err
 		}
+		for _, e := range diagnostic.Split(err) {
+			d := diagnostic.FromError(e)
+			d.SetSpan(readSource(d.Filename, stdin))
+			if wErr := diagnostic.Write(os.Stderr, d); wErr != nil {
+				return wErr
+			}
+		}
+		return diagnostic.ErrReported
+	}
+
+	if *packageName == "base" && len(flags.Args()) == 0 {
+		p.Name = "base"
 
 	} else {
-		pkgName := checkPackageName(*packageName)
+		pkgName := CheckPackageName(*packageName)
 		if pkgName == "" {
-			return fmt.Errorf("prohibited package name %q", *packageName)
+			return report(fmt.Errorf("prohibited package name %q", *packageName))
 		}
 
+		// The AST nodes are all garbage once the code is generated, so they
+		// can share an arena.
+		arena := a.NewArena()
 		tm := &t.Map{}
-		files, err := parseFiles(tm, flags.Args())
+		files := []*a.File(nil)
+		var err error
+		parseOpts := &parse.Options{
+			Arena:     arena,
+			MaxErrors: *maxerrors,
+		}
+		files, stdin, err = parseFiles(tm, parseOpts, flags.Args())
 		if err != nil {
-			return err
+			return report(err)
 		}
 
-		if _, err := check.Check(tm, files, resolveUse); err != nil {
-			return err
+		c, err := check.Check(tm, files, ResolveUse, &check.Options{
+			CacheDir:     *checkcachedir,
+			CacheURL:     *checkcacheurl,
+			CacheVersion: *checkcacheversion,
+			TrackFacts:   (*checkreport != "") || *jsonErrors,
+			Arena:        arena,
+			MaxErrors:    *maxerrors,
+		})
+		if err != nil {
+			// The HTML report is of the first error.
+			if e, ok := diagnostic.Split(err)[0].(*check.Error); ok && (*checkreport != "") {
+				if rErr := writeCheckReport(*checkreport, e, stdin); rErr != nil {
+					return rErr
+				}
+			}
+			return report(err)
+		}
+		if *jsonErrors {
+			for _, w := range c.Warnings() {
+				d := w.Diagnostic()
+				d.SetSpan(readSource(d.Filename, stdin))
+				if err := diagnostic.Write(os.Stderr, d); err != nil {
+					return err
+				}
+			}
 		}
 
-		out, err = g(pkgName, tm, files)
-		if err != nil {
+		p.Name, p.TM, p.Files = pkgName, tm, files
+	}
+
+	header, err := b.Header(p)
+	if err != nil {
+		return report(err)
+	}
+	impl, err := b.Impl(p)
+	if err != nil {
+		return report(err)
+	}
+	auxFiles, err := b.AuxFiles(p)
+	if err != nil {
+		return report(err)
+	}
+	if _, err := os.Stdout.Write(header); err != nil {
+		return err
+	}
+	if _, err := os.Stdout.Write(impl); err != nil {
+		return err
+	}
+	return writeAuxFiles(*auxdir, auxFiles)
+}
+
+// writeAuxFiles writes a Backend's AuxFiles, in sorted order. Relative
+// filenames are relative to auxdir.
+func writeAuxFiles(auxdir string, auxFiles map[string][]byte) error {
+	filenames := make([]string, 0, len(auxFiles))
+	for k := range auxFiles {
+		filenames = append(filenames, k)
+	}
+	sort.Strings(filenames)
+	for _, k := range filenames {
+		filename := k
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(auxdir, filename)
+		}
+		if err := ioutil.WriteFile(filename, auxFiles[k], 0644); err != nil {
 			return err
 		}
 	}
-
-	_, err := os.Stdout.Write(out)
-	return err
+	return nil
 }
 
-func checkPackageName(s string) string {
+// CheckPackageName returns s, lower-cased, if it is a valid name for a
+// package's generated code, such as "gif". It returns "" otherwise, including
+// for names, such as "config", that the generated code reserves.
+func CheckPackageName(s string) string {
 	allUnderscores := true
 	for i := 0; i < len(s); i++ {
 		c := s[i]
@@ -95,24 +209,49 @@ func checkPackageName(s string) string {
 	return s
 }
 
-func parseFiles(tm *t.Map, filenames []string) (files []*a.File, err error) {
+// parseFiles is like ParseFiles but, if there are no filenames, parses stdin,
+// also returning its contents (even if parsing fails).
+func parseFiles(tm *t.Map, opts *parse.Options, filenames []string) (files []*a.File, stdin []byte, err error) {
 	if len(filenames) == 0 {
 		const filename = "stdin"
 		src, err := ioutil.ReadAll(os.Stdin)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		tokens, _, err := t.Tokenize(tm, filename, src)
 		if err != nil {
-			return nil, err
+			return nil, src, err
 		}
-		f, err := parse.Parse(tm, filename, tokens, nil)
+		f, err := parse.Parse(tm, filename, tokens, opts)
 		if err != nil {
-			return nil, err
+			return nil, src, err
 		}
-		return []*a.File{f}, nil
+		return []*a.File{f}, src, nil
+	}
+	files, err = ParseFiles(tm, filenames, opts)
+	return files, nil, err
+}
+
+// readSource returns the contents of the named source file, or stdin when
+// parsing from stdin. A missing source file returns nil, which only omits the
+// parts of reports and diagnostics that need the source.
+func readSource(filename string, stdin []byte) []byte {
+	if stdin != nil {
+		return stdin
+	}
+	src, _ := ioutil.ReadFile(filename)
+	return src
+}
+
+// writeCheckReport writes e as an HTML report to the named file. The stdin
+// argument is the source code when parsing from stdin.
+func writeCheckReport(filename string, e *check.Error, stdin []byte) error {
+	src := readSource(e.Filename, stdin)
+	buf := &bytes.Buffer{}
+	if err := check.WriteHTMLReport(buf, e, src); err != nil {
+		return err
 	}
-	return ParseFiles(tm, filenames, nil)
+	return ioutil.WriteFile(filename, buf.Bytes(), 0644)
 }
 
 func ParseFiles(tm *t.Map, filenames []string, opts *parse.Options) (files []*a.File, err error) {
@@ -134,7 +273,10 @@ func ParseFiles(tm *t.Map, filenames []string, opts *parse.Options) (files []*a.
 	return files, nil
 }
 
-func resolveUse(usePath string) ([]byte, error) {
+// ResolveUse is the default resolveUse argument to check.Check. It reads the
+// generated "gen/wuffs" summary of the used package, under the Wuffs root
+// directory.
+func ResolveUse(usePath string) ([]byte, error) {
 	wuffsRoot, err := wuffsroot.Value()
 	if err != nil {
 		return nil, err
@@ -0,0 +1,101 @@
+// Copyright 2017 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import (
+	"bytes"
+	"fmt"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Summarize returns the "gen/wuffs" summary of a package: its public
+// declarations, without function bodies, which is what ResolveUse returns
+// for packages that use it.
+func Summarize(tm *t.Map, files []*a.File) ([]byte, error) {
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "// Code generated by running \"wuffs gen\". DO NOT EDIT.\n\n")
+
+	for _, f := range files {
+		for _, n := range f.TopLevelDecls() {
+			switch n.Kind() {
+			case a.KConst:
+				n := n.AsConst()
+				if !n.Public() {
+					continue
+				}
+				fmt.Fprintf(out, "pub const %s : %s = %v\n",
+					n.QID().Str(tm), n.XType().Str(tm), n.Value().Str(tm))
+
+			case a.KFeature:
+				fmt.Fprintf(out, "pub feature %s\n", n.AsFeature().QID().Str(tm))
+
+			case a.KFunc:
+				n := n.AsFunc()
+				if !n.Public() {
+					continue
+				}
+				if n.Receiver().IsZero() {
+					return nil, fmt.Errorf("TODO: genWuffs for a free-standing function")
+				}
+				// TODO: look at n.Asserts().
+				fmt.Fprintf(out, "pub func %s.%s%v(", n.Receiver().Str(tm), n.FuncName().Str(tm), n.Effect())
+				for i, field := range n.In().Fields() {
+					field := field.AsField()
+					if i > 0 {
+						fmt.Fprintf(out, ", ")
+					}
+					// TODO: what happens if the XType is from another package?
+					// Similarly for the out-param.
+					fmt.Fprintf(out, "%s: %s", field.Name().Str(tm), field.XType().Str(tm))
+				}
+				fmt.Fprintf(out, ") ")
+				if o := n.Out(); o != nil {
+					fmt.Fprintf(out, "%s", o.Str(tm))
+				}
+				fmt.Fprintf(out, " { }\n")
+
+			case a.KStatus:
+				n := n.AsStatus()
+				if !n.Public() {
+					continue
+				}
+				fmt.Fprintf(out, "pub status %s\n", n.QID().Str(tm))
+
+			case a.KStruct:
+				n := n.AsStruct()
+				if !n.Public() {
+					continue
+				}
+				fmt.Fprintf(out, "pub struct %s", n.QID().Str(tm))
+				if n.Classy() {
+					fmt.Fprintf(out, "?")
+				}
+				if imps := n.Implements(); len(imps) > 0 {
+					fmt.Fprintf(out, " implements ")
+					for i, imp := range imps {
+						if i > 0 {
+							fmt.Fprintf(out, ", ")
+						}
+						fmt.Fprintf(out, "%s", imp.AsTypeExpr().Str(tm))
+					}
+				}
+				fmt.Fprintf(out, "()\n")
+			}
+		}
+	}
+	return out.Bytes(), nil
+}
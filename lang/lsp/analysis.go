@@ -0,0 +1,237 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/diagnostic"
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// pkg is the result of parsing and checking a package: the *.wuffs files in a
+// directory, with any open documents' unsaved contents.
+type pkg struct {
+	tm        *t.Map
+	filenames []string
+	srcs      map[string][]byte
+	files     map[string]*a.File
+	diags     map[string][]diagnostic.Diagnostic
+
+	// wuffsRoot and used are for finding the declarations of used packages,
+	// such as "std/crc32". The used map is keyed by the use path and is filled
+	// in lazily.
+	wuffsRoot string
+	used      map[string]*usedPkg
+}
+
+type usedPkg struct {
+	tm    *t.Map
+	files []*a.File
+}
+
+// analyze parses and checks the package in the given directory. Any errors
+// without a location, such as a failure to read a used package's summary,
+// are reported against the named file, the one that changed.
+func (s *server) analyze(dir string, filename string) *pkg {
+	p := &pkg{
+		tm:        &t.Map{},
+		srcs:      map[string][]byte{},
+		files:     map[string]*a.File{},
+		diags:     map[string][]diagnostic.Diagnostic{},
+		wuffsRoot: s.opts.WuffsRoot,
+		used:      map[string]*usedPkg{},
+	}
+	p.filenames = s.listDir(dir)
+
+	report := func(err error) {
+		for _, e := range diagnostic.Split(err) {
+			d := diagnostic.FromError(e)
+			if _, ok := p.srcs[d.Filename]; !ok {
+				d.Filename, d.Line, d.Column, d.EndColumn = filename, 0, 0, 0
+			}
+			d.SetSpan(p.srcs[d.Filename])
+			p.diags[d.Filename] = append(p.diags[d.Filename], d)
+		}
+	}
+
+	files := []*a.File(nil)
+	for _, f := range p.filenames {
+		src, ok := s.docs[f]
+		if !ok {
+			var err error
+			if src, err = ioutil.ReadFile(f); err != nil {
+				report(err)
+				continue
+			}
+		}
+		p.srcs[f] = src
+		tokens, _, err := t.Tokenize(p.tm, f, src)
+		if err != nil {
+			report(err)
+			continue
+		}
+		file, err := parse.Parse(p.tm, f, tokens, &parse.Options{MaxErrors: s.opts.Check.MaxErrors})
+		if err != nil {
+			report(err)
+			continue
+		}
+		p.files[f] = file
+		files = append(files, file)
+	}
+	if len(files) < len(p.filenames) {
+		return p
+	}
+
+	c, err := check.Check(p.tm, files, s.resolveUse, &s.opts.Check)
+	if err != nil {
+		report(err)
+		return p
+	}
+	for _, w := range c.Warnings() {
+		d := w.Diagnostic()
+		d.SetSpan(p.srcs[d.Filename])
+		p.diags[d.Filename] = append(p.diags[d.Filename], d)
+	}
+	return p
+}
+
+// listDir returns the package's filenames, sorted: the *.wuffs files in dir
+// and any open documents there that have not yet been saved.
+func (s *server) listDir(dir string) []string {
+	m := map[string]bool{}
+	if infos, err := ioutil.ReadDir(dir); err == nil {
+		for _, o := range infos {
+			if name := o.Name(); !o.IsDir() && strings.HasSuffix(name, ".wuffs") {
+				m[filepath.Join(dir, name)] = true
+			}
+		}
+	}
+	for f := range s.docs {
+		if filepath.Dir(f) == dir {
+			m[f] = true
+		}
+	}
+	ret := make([]string, 0, len(m))
+	for f := range m {
+		ret = append(ret, f)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// resolveUse is the check.Check argument. Like the "wuffs gen" command's, it
+// reads the generated "gen/wuffs" summary of the used package.
+func (s *server) resolveUse(usePath string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(s.opts.WuffsRoot, "gen", "wuffs", filepath.FromSlash(usePath)))
+}
+
+// lspDiagnostics returns the named file's diagnostics in LSP form.
+func (p *pkg) lspDiagnostics(filename string) []lspDiagnostic {
+	src := p.srcs[filename]
+	ret := []lspDiagnostic{}
+	for _, d := range p.diags[filename] {
+		x := lspDiagnostic{
+			Range:    spanRange(src, d.Line, uint32(d.Column), uint32(d.EndColumn)),
+			Severity: severityError,
+			Code:     d.Code,
+			Source:   "wuffs",
+			Message:  d.Message,
+		}
+		if d.Severity == diagnostic.SeverityWarning {
+			x.Severity = severityWarning
+		}
+		for _, r := range d.Related {
+			if (r.Filename == "") || (r.Line == 0) {
+				continue
+			}
+			x.RelatedInformation = append(x.RelatedInformation, diagnosticRelatedInformation{
+				Location: location{
+					URI:   filenameToURI(r.Filename),
+					Range: spanRange(p.srcs[r.Filename], r.Line, 0, 0),
+				},
+				Message: r.Message,
+			})
+		}
+		ret = append(ret, x)
+	}
+	return ret
+}
+
+// usePath returns the path, such as "std/crc32", of the package used under
+// the given name, such as "crc32", or "" if there is no such package.
+func (p *pkg) usePath(name string) string {
+	for _, f := range p.files {
+		for _, n := range f.TopLevelDecls() {
+			if n.Kind() != a.KUse {
+				continue
+			}
+			s, err := strconv.Unquote(n.AsUse().Path().Str(p.tm))
+			if (err == nil) && (path.Base(s) == name) {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// usedPkg returns the parsed source code of the package used under the given
+// name, or nil if it cannot be found or parsed.
+func (p *pkg) usedPkg(name string) *usedPkg {
+	usePath := p.usePath(name)
+	if usePath == "" {
+		return nil
+	}
+	if u, ok := p.used[usePath]; ok {
+		return u
+	}
+	u := &usedPkg{tm: &t.Map{}}
+	p.used[usePath] = nil
+	dir := filepath.Join(p.wuffsRoot, filepath.FromSlash(usePath))
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	for _, o := range infos {
+		if name := o.Name(); o.IsDir() || !strings.HasSuffix(name, ".wuffs") {
+			continue
+		}
+		filename := filepath.Join(dir, o.Name())
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil
+		}
+		tokens, _, err := t.Tokenize(u.tm, filename, src)
+		if err != nil {
+			return nil
+		}
+		f, err := parse.Parse(u.tm, filename, tokens, nil)
+		if err != nil {
+			return nil
+		}
+		u.files = append(u.files, f)
+	}
+	p.used[usePath] = u
+	return u
+}
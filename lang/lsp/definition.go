@@ -0,0 +1,246 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+// This file implements go-to-definition and hover, which both start by finding
+// the AST node at a position.
+
+import (
+	"fmt"
+	"strings"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// declAt returns the top level declaration, in f, that contains the 1-based
+// line and byte column, or nil.
+func declAt(f *a.File, line uint32, column uint32) *a.Node {
+	for _, n := range f.TopLevelDecls() {
+		if n.AsRaw().Span().Contains(line, column) {
+			return n
+		}
+	}
+	return nil
+}
+
+// nodeAt returns the innermost node, in decl, that contains the 1-based line
+// and byte column, or nil.
+func nodeAt(decl *a.Node, line uint32, column uint32) (ret *a.Node) {
+	// Walk visits a node before its children, and a node's children are
+	// within its span, so the last node found is the innermost one.
+	decl.Walk(func(n *a.Node) error {
+		if n.AsRaw().Span().Contains(line, column) {
+			ret = n
+		}
+		return nil
+	})
+	return ret
+}
+
+// definition returns the declaration of what is at the 1-based line and byte
+// column of f, or nil.
+func (p *pkg) definition(f *a.File, line uint32, column uint32) *a.Node {
+	decl := declAt(f, line, column)
+	if decl == nil {
+		return nil
+	}
+	n := nodeAt(decl, line, column)
+	if n == nil {
+		return nil
+	}
+	switch n.Kind() {
+	case a.KExpr:
+		return p.exprDefinition(decl, n.AsExpr())
+	case a.KTypeExpr:
+		qid := n.AsTypeExpr().QID()
+		return p.findDecl(qid[0], a.KStruct, "", qid[1].Str(p.tm))
+	}
+	return nil
+}
+
+func (p *pkg) exprDefinition(decl *a.Node, n *a.Expr) *a.Node {
+	switch n.Operator() {
+	case 0:
+		id := n.Ident()
+		if id.IsDQStrLiteral(p.tm) {
+			return p.findDecl(0, a.KStatus, "", id.Str(p.tm))
+		}
+		if decl.Kind() == a.KFunc {
+			if v := findVar(decl.AsFunc().Body(), id); v != nil {
+				return v
+			}
+		}
+		return p.findDecl(0, a.KConst, "", id.Str(p.tm))
+
+	case t.IDDot:
+		lhs := n.LHS().AsExpr()
+		name := n.Ident().Str(p.tm)
+		if lhs.Operator() == 0 {
+			switch id := lhs.Ident(); id {
+			case t.IDArgs:
+				if decl.Kind() == a.KFunc {
+					return findField(decl.AsFunc().In().Fields(), p.tm, name)
+				}
+				return nil
+			case t.IDThis:
+				// No-op. The receiver's type is handled below.
+			default:
+				// A used package's const, status or struct, such as
+				// "crc32.ieee_hasher".
+				if !id.IsIdent(p.tm) {
+					break
+				}
+				kind := a.KConst
+				if n.Ident().IsDQStrLiteral(p.tm) {
+					kind = a.KStatus
+				}
+				if d := p.findDecl(id, kind, "", name); d != nil {
+					return d
+				}
+			}
+		}
+
+		// A method, such as "this.decode_frame".
+		if typ := n.MType(); (typ != nil) && typ.IsFuncType() {
+			if recv := typ.Receiver(); recv != nil {
+				qid := recv.QID()
+				return p.findDecl(qid[0], a.KFunc, qid[1].Str(p.tm), name)
+			}
+			return nil
+		}
+
+		// A struct field, such as "this.width".
+		if typ := lhs.MType(); typ != nil {
+			qid := typ.Pointee().QID()
+			if s := p.findDecl(qid[0], a.KStruct, "", qid[1].Str(p.tm)); s != nil {
+				return findField(s.AsStruct().Fields(), p.declTMap(qid[0]), name)
+			}
+		}
+	}
+	return nil
+}
+
+// declTMap returns the t.Map of the package that the given package name
+// refers to, where zero means this package.
+func (p *pkg) declTMap(pkgName t.ID) *t.Map {
+	if pkgName == 0 {
+		return p.tm
+	}
+	if u := p.usedPkg(pkgName.Str(p.tm)); u != nil {
+		return u.tm
+	}
+	return p.tm
+}
+
+// findDecl returns the top level declaration of the given kind and name, in
+// this package or, for a non-zero pkgName, in the package used under that
+// name. For a func, the receiver is the name of the receiver's type, or "" for
+// a function without one.
+func (p *pkg) findDecl(pkgName t.ID, kind a.Kind, receiver string, name string) *a.Node {
+	if pkgName == t.IDBase {
+		return nil
+	}
+	tm, files := p.tm, []*a.File(nil)
+	if pkgName == 0 {
+		for _, f := range p.filenames {
+			if file := p.files[f]; file != nil {
+				files = append(files, file)
+			}
+		}
+	} else if u := p.usedPkg(pkgName.Str(p.tm)); u != nil {
+		tm, files = u.tm, u.files
+	}
+
+	for _, f := range files {
+		for _, n := range f.TopLevelDecls() {
+			if n.Kind() != kind {
+				continue
+			}
+			switch kind {
+			case a.KConst:
+				if n.AsConst().QID()[1].Str(tm) == name {
+					return n
+				}
+			case a.KStatus:
+				if n.AsStatus().QID()[1].Str(tm) == name {
+					return n
+				}
+			case a.KStruct:
+				if n.AsStruct().QID()[1].Str(tm) == name {
+					return n
+				}
+			case a.KFunc:
+				fn := n.AsFunc()
+				if (fn.Receiver()[1].Str(tm) == receiver) && (fn.FuncName().Str(tm) == name) {
+					return n
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// findVar returns the var statement, in a function body, for the given name.
+func findVar(body []*a.Node, name t.ID) *a.Node {
+	for _, o := range body {
+		if (o.Kind() == a.KVar) && (o.AsVar().Name() == name) {
+			return o
+		}
+	}
+	return nil
+}
+
+// findField returns the field, out of fields (parsed using tm), with the given
+// name.
+func findField(fields []*a.Node, tm *t.Map, name string) *a.Node {
+	for _, o := range fields {
+		if o.AsField().Name().Str(tm) == name {
+			return o
+		}
+	}
+	return nil
+}
+
+// hover returns a description of the expression or type at the 1-based line
+// and byte column of f, along with that node, or "" if there is nothing to
+// describe. An expression's description includes its type and, if it is a
+// number, the bounds inferred by the checker.
+func (p *pkg) hover(f *a.File, line uint32, column uint32) (string, *a.Node) {
+	decl := declAt(f, line, column)
+	if decl == nil {
+		return "", nil
+	}
+	n := nodeAt(decl, line, column)
+	if n == nil {
+		return "", nil
+	}
+	switch n.Kind() {
+	case a.KExpr:
+		x := n.AsExpr()
+		b := &strings.Builder{}
+		fmt.Fprintf(b, "```wuffs\n%s\n```\n", x.Str(p.tm))
+		if typ := x.MType(); typ != nil {
+			fmt.Fprintf(b, "\ntype: `%s`\n", typ.Str(p.tm))
+			if bounds := x.MBounds(); typ.IsNumTypeOrIdeal() && (bounds[0] != nil) && (bounds[1] != nil) {
+				fmt.Fprintf(b, "\nbounds: `%v`\n", bounds)
+			}
+		}
+		return b.String(), n
+	case a.KTypeExpr:
+		return fmt.Sprintf("```wuffs\n%s\n```\n", n.AsTypeExpr().Str(p.tm)), n
+	}
+	return "", nil
+}
@@ -0,0 +1,336 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lsp implements a Language Server Protocol server for Wuffs, as per
+// the "wuffs lsp" command, so that editors can show Wuffs diagnostics, jump to
+// definitions, show inferred bounds and format code.
+//
+// The server supports these requests and notifications:
+//   - textDocument/didOpen, didChange, didSave and didClose, after which the
+//     document's package (all of the *.wuffs files in its directory) is parsed
+//     and checked, and its errors and warnings are published as diagnostics.
+//   - textDocument/definition, for the declaration of a const, status, struct,
+//     func, field or local variable, including those of a used package, such
+//     as "std/crc32".
+//   - textDocument/hover, for an expression's type and, for a number, the
+//     bounds that the checker inferred.
+//   - textDocument/formatting, the same as the wuffsfmt command.
+//
+// Documents must be synchronized in full (not incrementally) and positions
+// are in UTF-16 code units, as per the protocol's defaults.
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/format"
+
+	a "github.com/google/wuffs/lang/ast"
+)
+
+// Options are optional arguments to Serve. A nil *Options is valid and means
+// the zero value.
+type Options struct {
+	// WuffsRoot is the Wuffs root directory. A used package, such as
+	// "std/crc32", has its source code in the "std/crc32" directory under
+	// that root and its summary, generated by "wuffs gen" and needed by the
+	// checker, in "gen/wuffs/std/crc32.wuffs".
+	WuffsRoot string
+
+	// Check are the checker's options. If its MaxErrors field is zero, Serve
+	// uses 10, so that editors show more than just the first failure.
+	Check check.Options
+}
+
+// Serve reads requests and notifications from r and writes the responses and
+// notifications to w, until r reaches EOF or the client sends an "exit"
+// notification, neither of which is an error.
+func Serve(r io.Reader, w io.Writer, opts *Options) error {
+	s := &server{
+		w:    w,
+		docs: map[string][]byte{},
+		pkgs: map[string]*pkg{},
+	}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.Check.MaxErrors == 0 {
+		s.opts.Check.MaxErrors = 10
+	}
+
+	br := bufio.NewReader(r)
+	for !s.exited {
+		body, err := readMessage(br)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := s.handle(body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type server struct {
+	opts Options
+	w    io.Writer
+
+	// docs holds the open documents' contents, keyed by filename.
+	docs map[string][]byte
+
+	// pkgs holds the most recent analysis of each package, keyed by its
+	// directory.
+	pkgs map[string]*pkg
+
+	exited bool
+}
+
+// handle handles one message. It only returns an error if the server should
+// stop, such as when it can no longer write to the client.
+func (s *server) handle(body []byte) error {
+	req := request{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return writeMessage(s.w, &errorResponse{
+			JSONRPC: "2.0",
+			ID:      json.RawMessage("null"),
+			Error:   &rpcError{Code: codeParseError, Message: err.Error()},
+		})
+	}
+
+	result, err := s.dispatch(req.Method, req.Params)
+	if req.ID == nil {
+		// Notifications have no response, even if they fail.
+		return nil
+	}
+	if err != nil {
+		e, ok := err.(*rpcError)
+		if !ok {
+			e = &rpcError{Code: codeInternalError, Message: err.Error()}
+		}
+		return writeMessage(s.w, &errorResponse{JSONRPC: "2.0", ID: *req.ID, Error: e})
+	}
+	return writeMessage(s.w, &response{JSONRPC: "2.0", ID: *req.ID, Result: result})
+}
+
+func (s *server) dispatch(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		ret := &initializeResult{}
+		ret.Capabilities = serverCapabilities{
+			TextDocumentSync:           textDocumentSyncFull,
+			DefinitionProvider:         true,
+			HoverProvider:              true,
+			DocumentFormattingProvider: true,
+		}
+		ret.ServerInfo.Name = "wuffs"
+		return ret, nil
+
+	case "initialized", "$/cancelRequest", "$/setTrace":
+		return nil, nil
+
+	case "shutdown":
+		return nil, nil
+
+	case "exit":
+		s.exited = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		x := didOpenParams{}
+		filename, err := s.unmarshal(params, &x, &x.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		s.docs[filename] = []byte(x.TextDocument.Text)
+		return nil, s.update(filename)
+
+	case "textDocument/didChange":
+		x := didChangeParams{}
+		filename, err := s.unmarshal(params, &x, &x.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(x.ContentChanges); n > 0 {
+			s.docs[filename] = []byte(x.ContentChanges[n-1].Text)
+		}
+		return nil, s.update(filename)
+
+	case "textDocument/didSave":
+		x := didSaveOrCloseParams{}
+		filename, err := s.unmarshal(params, &x, &x.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.update(filename)
+
+	case "textDocument/didClose":
+		x := didSaveOrCloseParams{}
+		filename, err := s.unmarshal(params, &x, &x.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		delete(s.docs, filename)
+		return nil, s.update(filename)
+
+	case "textDocument/definition":
+		x := textDocumentPositionParams{}
+		filename, err := s.unmarshal(params, &x, &x.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		p, f, line, column := s.locate(filename, x.Position)
+		if f == nil {
+			return nil, nil
+		}
+		d := p.definition(f, line, column)
+		if d == nil {
+			return nil, nil
+		}
+		return s.location(d), nil
+
+	case "textDocument/hover":
+		x := textDocumentPositionParams{}
+		filename, err := s.unmarshal(params, &x, &x.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		p, f, line, column := s.locate(filename, x.Position)
+		if f == nil {
+			return nil, nil
+		}
+		text, n := p.hover(f, line, column)
+		if text == "" {
+			return nil, nil
+		}
+		span := n.AsRaw().Span()
+		r := spanRange(p.srcs[filename], span.Line, span.Column, span.EndColumn)
+		if span.EndLine != span.Line {
+			r.End = makePosition(p.srcs[filename], span.EndLine, span.EndColumn)
+		}
+		return &hover{Contents: markupContent{Kind: "markdown", Value: text}, Range: &r}, nil
+
+	case "textDocument/formatting":
+		x := documentFormattingParams{}
+		filename, err := s.unmarshal(params, &x, &x.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		return s.formatting(filename), nil
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("lsp: unsupported method %q", method)}
+}
+
+// unmarshal decodes params into x, returning the filename of the document
+// that uri (which points into x) identifies.
+func (s *server) unmarshal(params json.RawMessage, x interface{}, uri *string) (string, error) {
+	if err := json.Unmarshal(params, x); err != nil {
+		return "", &rpcError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	filename, err := uriToFilename(*uri)
+	if err != nil {
+		return "", &rpcError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return filename, nil
+}
+
+// update re-analyzes the named file's package and publishes the diagnostics
+// for each of its files, including empty ones, to clear those of a previous
+// analysis.
+func (s *server) update(filename string) error {
+	dir := filepath.Dir(filename)
+	p := s.analyze(dir, filename)
+	s.pkgs[dir] = p
+
+	filenames := p.filenames
+	if _, ok := p.srcs[filename]; !ok {
+		// The file was closed and deleted, so it is no longer in the package.
+		filenames = append(filenames, filename)
+	}
+	for _, f := range filenames {
+		if err := writeMessage(s.w, &notification{
+			JSONRPC: "2.0",
+			Method:  "textDocument/publishDiagnostics",
+			Params: &publishDiagnosticsParams{
+				URI:         filenameToURI(f),
+				Diagnostics: p.lspDiagnostics(f),
+			},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// locate returns the package and parsed file for the named file, along with
+// pos as a 1-based line and byte column. The file is nil if it did not parse.
+func (s *server) locate(filename string, pos position) (p *pkg, f *a.File, line uint32, column uint32) {
+	dir := filepath.Dir(filename)
+	p = s.pkgs[dir]
+	if p == nil {
+		p = s.analyze(dir, filename)
+		s.pkgs[dir] = p
+	}
+	b := lineAt(p.srcs[filename], uint32(pos.Line)+1)
+	return p, p.files[filename], uint32(pos.Line) + 1, uint32(byteOffset(b, pos.Character)) + 1
+}
+
+// location returns where the declaration n is: its span, if that is on one
+// line, or else where it starts.
+func (s *server) location(n *a.Node) *location {
+	filename, line := n.AsRaw().FilenameLine()
+	span := n.AsRaw().Span()
+	src, ok := s.docs[filename]
+	if !ok {
+		src, _ = ioutil.ReadFile(filename)
+	}
+	endColumn := span.Column
+	if span.EndLine == span.Line {
+		endColumn = span.EndColumn
+	}
+	return &location{
+		URI:   filenameToURI(filename),
+		Range: spanRange(src, line, span.Column, endColumn),
+	}
+}
+
+// formatting returns the edits that format the named document: none if it is
+// already formatted or it cannot be formatted, such as for a syntax error,
+// which is reported as a diagnostic instead.
+func (s *server) formatting(filename string) []textEdit {
+	src, ok := s.docs[filename]
+	if !ok {
+		return []textEdit{}
+	}
+	dst, err := format.Source(filename, src, nil)
+	if (err != nil) || bytes.Equal(dst, src) {
+		return []textEdit{}
+	}
+	lines := bytes.Count(src, []byte{'\n'})
+	last := src[bytes.LastIndexByte(src, '\n')+1:]
+	return []textEdit{{
+		Range: lspRange{
+			End: position{Line: lines, Character: utf16Len(last)},
+		},
+		NewText: string(dst),
+	}}
+}
@@ -0,0 +1,292 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const fooSrc = `pub status "#bad foo"
+
+pub const LIMIT : base.u32 = 100
+
+pub struct thing?(
+	n : base.u32,
+)
+
+pub func thing.get() base.u32 {
+	return this.n
+}
+`
+
+// fooSummary is what "wuffs gen" would write to "gen/wuffs/std/foo.wuffs".
+const fooSummary = `pub status "#bad foo"
+pub const LIMIT : base.u32 = 100
+pub struct thing?()
+pub func thing.get() base.u32 { }
+`
+
+const barSrc = `use "std/foo"
+
+pub status "#bad bar"
+
+pri const MAX : base.u32 = 255
+
+pub struct decoder?(
+	width : base.u32[..= 255],
+	t     : foo.thing,
+)
+
+pri func decoder.f(x: base.u32[..= 10]) base.u32 {
+	var y : base.u32
+	y = args.x + this.width
+	return y + MAX + foo.LIMIT
+}
+
+pub func decoder.g?() {
+	this.width = this.f(x: 3) & 0xFF
+	return "#bad bar"
+}
+`
+
+// badBarSrc has a bounds check failure in decoder.f and in decoder.g.
+var badBarSrc = strings.Replace(strings.Replace(barSrc,
+	"return y + MAX", "return y + 0xFFFF_FFFF", 1),
+	"this.f(x: 3) & 0xFF", "this.f(x: 3)", 1)
+
+// message is a response or notification written by the server.
+type message struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type testClient struct {
+	in     bytes.Buffer
+	nextID int
+}
+
+func (c *testClient) send(method string, id int, params interface{}) {
+	m := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	if id != 0 {
+		m["id"] = id
+	}
+	if err := writeMessage(&c.in, m); err != nil {
+		panic(err)
+	}
+}
+
+func (c *testClient) request(method string, params interface{}) int {
+	c.nextID++
+	c.send(method, c.nextID, params)
+	return c.nextID
+}
+
+func (c *testClient) notify(method string, params interface{}) {
+	c.send(method, 0, params)
+}
+
+// positionOf returns the position of the first occurrence of substr in src,
+// plus offset.
+func positionOf(src string, substr string, offset int) position {
+	i := strings.Index(src, substr)
+	if i < 0 {
+		panic("no " + substr)
+	}
+	i += offset
+	line := strings.Count(src[:i], "\n")
+	return position{Line: line, Character: i - (strings.LastIndexByte(src[:i], '\n') + 1)}
+}
+
+func TestServe(tt *testing.T) {
+	root, err := ioutil.TempDir("", "wuffs-lsp-test")
+	if err != nil {
+		tt.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(root)
+	fooFilename := filepath.Join(root, "std", "foo", "foo.wuffs")
+	barFilename := filepath.Join(root, "std", "bar", "bar.wuffs")
+	for _, x := range []struct{ filename, contents string }{
+		{fooFilename, fooSrc},
+		{filepath.Join(root, "gen", "wuffs", "std", "foo.wuffs"), fooSummary},
+		{barFilename, barSrc},
+	} {
+		if err := os.MkdirAll(filepath.Dir(x.filename), 0755); err != nil {
+			tt.Fatalf("MkdirAll: %v", err)
+		}
+		if err := ioutil.WriteFile(x.filename, []byte(x.contents), 0644); err != nil {
+			tt.Fatalf("WriteFile: %v", err)
+		}
+	}
+	barURI := filenameToURI(barFilename)
+	doc := map[string]string{"uri": barURI}
+
+	c := &testClient{}
+	idInitialize := c.request("initialize", map[string]interface{}{})
+	c.notify("initialized", map[string]interface{}{})
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": barURI, "languageId": "wuffs", "version": 1, "text": badBarSrc},
+	})
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": barURI, "version": 2},
+		"contentChanges": []map[string]string{{"text": barSrc}},
+	})
+
+	definitions := []struct {
+		pos  position
+		want string
+	}{
+		{positionOf(barSrc, "MAX + foo", 0), "bar.wuffs:4:0-4:30"},
+		{positionOf(barSrc, "y + MAX", 0), "bar.wuffs:12:1-12:17"},
+		{positionOf(barSrc, "args.x +", 5), "bar.wuffs:11:19-11:38"},
+		{positionOf(barSrc, "this.width", 6), "bar.wuffs:7:1-7:26"},
+		{positionOf(barSrc, "foo.LIMIT", 5), "foo.wuffs:2:0-2:32"},
+		{positionOf(barSrc, "foo.thing", 5), "foo.wuffs:4:0-4:0"},
+		{positionOf(barSrc, "this.f(", 5), "bar.wuffs:11:0-11:0"},
+		{positionOf(barSrc, `return "#bad bar"`, 8), "bar.wuffs:2:0-2:21"},
+		{positionOf(barSrc, "var y", 1), "null"},
+	}
+	idDefinitions := []int(nil)
+	for _, d := range definitions {
+		idDefinitions = append(idDefinitions, c.request("textDocument/definition",
+			map[string]interface{}{"textDocument": doc, "position": d.pos}))
+	}
+
+	idHover := c.request("textDocument/hover", map[string]interface{}{
+		"textDocument": doc, "position": positionOf(barSrc, "+ this.width", 0),
+	})
+	idUnformatted := c.request("textDocument/formatting", map[string]interface{}{"textDocument": doc})
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": barURI, "version": 3},
+		"contentChanges": []map[string]string{{"text": strings.Replace(barSrc, "\tvar y", "var y", 1)}},
+	})
+	idFormatting := c.request("textDocument/formatting", map[string]interface{}{"textDocument": doc})
+	idUnknown := c.request("textDocument/unknown", map[string]interface{}{})
+	idShutdown := c.request("shutdown", nil)
+	c.notify("exit", nil)
+
+	out := &bytes.Buffer{}
+	if err := Serve(&c.in, out, &Options{WuffsRoot: root}); err != nil {
+		tt.Fatalf("Serve: %v", err)
+	}
+
+	responses := map[int]*message{}
+	diagnostics := []publishDiagnosticsParams(nil)
+	for r := bufio.NewReader(out); ; {
+		body, err := readMessage(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			tt.Fatalf("readMessage: %v", err)
+		}
+		m := &message{}
+		if err := json.Unmarshal(body, m); err != nil {
+			tt.Fatalf("Unmarshal: %v", err)
+		}
+		if m.ID != nil {
+			responses[*m.ID] = m
+		} else if m.Method == "textDocument/publishDiagnostics" {
+			p := publishDiagnosticsParams{}
+			if err := json.Unmarshal(m.Params, &p); err != nil {
+				tt.Fatalf("Unmarshal: %v", err)
+			}
+			diagnostics = append(diagnostics, p)
+		}
+	}
+
+	if m := responses[idInitialize]; (m == nil) || !strings.Contains(string(m.Result), `"definitionProvider":true`) {
+		tt.Errorf("initialize: got %+v", m)
+	}
+
+	// There are three updates: the didOpen and the two didChanges.
+	if len(diagnostics) != 3 {
+		tt.Fatalf("publishDiagnostics: got %d, want 3", len(diagnostics))
+	}
+	got := []string(nil)
+	for _, d := range diagnostics[0].Diagnostics {
+		got = append(got, fmt.Sprintf("%d:%d-%d:%d %d %s", d.Range.Start.Line, d.Range.Start.Character,
+			d.Range.End.Line, d.Range.End.Character, d.Severity, d.Code))
+	}
+	if want := []string{"14:8-14:35 1 check.bounds", "18:14-18:26 1 check.bounds"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		tt.Errorf("publishDiagnostics: got %q, want %q", got, want)
+	}
+	if (diagnostics[0].URI != barURI) || (len(diagnostics[1].Diagnostics) != 0) {
+		tt.Errorf("publishDiagnostics: got %+v", diagnostics)
+	}
+
+	for i, d := range definitions {
+		m := responses[idDefinitions[i]]
+		if m == nil {
+			tt.Errorf("definition #%d: no response", i)
+			continue
+		}
+		got := string(m.Result)
+		if got != "null" {
+			loc := location{}
+			if err := json.Unmarshal(m.Result, &loc); err != nil {
+				tt.Errorf("definition #%d: %v", i, err)
+				continue
+			}
+			got = fmt.Sprintf("%s:%d:%d-%d:%d", filepath.Base(loc.URI),
+				loc.Range.Start.Line, loc.Range.Start.Character, loc.Range.End.Line, loc.Range.End.Character)
+		}
+		if got != d.want {
+			tt.Errorf("definition #%d: got %s, want %s", i, got, d.want)
+		}
+	}
+
+	if m := responses[idHover]; m == nil {
+		tt.Errorf("hover: no response")
+	} else {
+		h := hover{}
+		if err := json.Unmarshal(m.Result, &h); err != nil {
+			tt.Errorf("hover: %v", err)
+		} else if want := "```wuffs\nargs.x + this.width\n```\n\ntype: `base.u32`\n\nbounds: `[0 ..= 265]`\n"; h.Contents.Value != want {
+			tt.Errorf("hover:\ngot  %q\nwant %q", h.Contents.Value, want)
+		}
+	}
+
+	if m := responses[idUnformatted]; (m == nil) || (string(m.Result) != "[]") {
+		tt.Errorf("formatting (already formatted): got %+v", m)
+	}
+	if m := responses[idFormatting]; m == nil {
+		tt.Errorf("formatting: no response")
+	} else {
+		edits := []textEdit(nil)
+		if err := json.Unmarshal(m.Result, &edits); err != nil {
+			tt.Errorf("formatting: %v", err)
+		} else if (len(edits) != 1) || (edits[0].NewText != barSrc) || (edits[0].Range.End.Line != 21) {
+			tt.Errorf("formatting: got %+v", edits)
+		}
+	}
+
+	if m := responses[idUnknown]; (m == nil) || (m.Error == nil) || (m.Error.Code != codeMethodNotFound) {
+		tt.Errorf("unknown method: got %+v", m)
+	}
+	if m := responses[idShutdown]; (m == nil) || (string(m.Result) != "null") {
+		tt.Errorf("shutdown: got %+v", m)
+	}
+}
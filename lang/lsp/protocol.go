@@ -0,0 +1,230 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+// This file declares the subset of the Language Server Protocol's types that
+// the server uses. Their JSON field names are per the specification.
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+const (
+	severityError   = 1
+	severityWarning = 2
+
+	// textDocumentSyncFull means that the client sends a document's whole
+	// contents on every change.
+	textDocumentSyncFull = 1
+)
+
+// position is a zero-based line and a zero-based character offset, in UTF-16
+// code units, within that line.
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type location struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type textDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     position               `json:"position"`
+}
+
+type didOpenParams struct {
+	TextDocument textDocumentItem `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type didSaveOrCloseParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type documentFormattingParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type serverCapabilities struct {
+	TextDocumentSync           int  `json:"textDocumentSync"`
+	DefinitionProvider         bool `json:"definitionProvider"`
+	HoverProvider              bool `json:"hoverProvider"`
+	DocumentFormattingProvider bool `json:"documentFormattingProvider"`
+}
+
+type initializeResult struct {
+	Capabilities serverCapabilities `json:"capabilities"`
+	ServerInfo   struct {
+		Name string `json:"name"`
+	} `json:"serverInfo"`
+}
+
+type lspDiagnostic struct {
+	Range              lspRange                       `json:"range"`
+	Severity           int                            `json:"severity"`
+	Code               string                         `json:"code,omitempty"`
+	Source             string                         `json:"source"`
+	Message            string                         `json:"message"`
+	RelatedInformation []diagnosticRelatedInformation `json:"relatedInformation,omitempty"`
+}
+
+type diagnosticRelatedInformation struct {
+	Location location `json:"location"`
+	Message  string   `json:"message"`
+}
+
+type publishDiagnosticsParams struct {
+	URI         string          `json:"uri"`
+	Diagnostics []lspDiagnostic `json:"diagnostics"`
+}
+
+type markupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type hover struct {
+	Contents markupContent `json:"contents"`
+	Range    *lspRange     `json:"range,omitempty"`
+}
+
+type textEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+// uriToFilename converts a "file:" URI to a filename.
+func uriToFilename(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("lsp: unsupported URI %q", uri)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+func filenameToURI(filename string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filename)}).String()
+}
+
+// lineAt returns the n'th line of src, without its "\n". Lines are numbered
+// from 1, like Wuffs' token positions.
+func lineAt(src []byte, n uint32) []byte {
+	for ; n > 1; n-- {
+		i := bytes.IndexByte(src, '\n')
+		if i < 0 {
+			return nil
+		}
+		src = src[i+1:]
+	}
+	if i := bytes.IndexByte(src, '\n'); i >= 0 {
+		return src[:i]
+	}
+	return src
+}
+
+// utf16Len returns how many UTF-16 code units encode b, which is how LSP
+// positions count characters.
+func utf16Len(b []byte) (n int) {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		b = b[size:]
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// byteOffset returns the byte offset, in line, of the character that is u
+// UTF-16 code units from its start.
+func byteOffset(line []byte, u int) (i int) {
+	for (i < len(line)) && (u > 0) {
+		r, size := utf8.DecodeRune(line[i:])
+		i += size
+		if r >= 0x10000 {
+			u -= 2
+		} else {
+			u--
+		}
+	}
+	return i
+}
+
+// makePosition converts a 1-based line and 1-based byte column to a position.
+// A zero column means the start of the line and a column past the end of the
+// line means its end.
+func makePosition(src []byte, line uint32, column uint32) position {
+	if line == 0 {
+		return position{}
+	}
+	b := lineAt(src, line)
+	if column == 0 {
+		column = 1
+	} else if int(column) > len(b)+1 {
+		column = uint32(len(b)) + 1
+	}
+	return position{Line: int(line) - 1, Character: utf16Len(b[:column-1])}
+}
+
+// spanRange converts a 1-based line and a [column, endColumn) byte span to
+// a lspRange. A zero column means the whole line and a zero endColumn means
+// the rest of the line.
+func spanRange(src []byte, line uint32, column uint32, endColumn uint32) lspRange {
+	b := lineAt(src, line)
+	if column == 0 {
+		column, endColumn = 1, 0
+	}
+	if endColumn == 0 {
+		endColumn = uint32(len(b)) + 1
+	}
+	return lspRange{
+		Start: makePosition(src, line, column),
+		End:   makePosition(src, line, endColumn),
+	}
+}
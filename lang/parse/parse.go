@@ -19,6 +19,8 @@ package parse
 import (
 	"fmt"
 
+	"github.com/google/wuffs/lang/diagnostic"
+
 	a "github.com/google/wuffs/lang/ast"
 	t "github.com/google/wuffs/lang/token"
 )
@@ -26,6 +28,15 @@ import (
 type Options struct {
 	AllowBuiltInNames          bool
 	AllowDoubleUnderscoreNames bool
+
+	// Arena, if non-nil, allocates the AST nodes.
+	Arena *a.Arena
+
+	// MaxErrors, if greater than one, is how many errors to report before
+	// giving up. After an error, parsing resumes at the next statement (or
+	// top level declaration) and, if there were any errors, Parse returns them
+	// as a diagnostic.ErrorList. Zero or one means to stop at the first error.
+	MaxErrors int
 }
 
 func validConstName(s string) bool {
@@ -65,6 +76,7 @@ func Parse(tm *t.Map, filename string, src []t.Token, opts *Options) (*a.File, e
 	p := &parser{
 		tm:       tm,
 		filename: filename,
+		tokens:   src,
 		src:      src,
 	}
 	if len(src) > 0 {
@@ -72,14 +84,23 @@ func Parse(tm *t.Map, filename string, src []t.Token, opts *Options) (*a.File, e
 	}
 	if opts != nil {
 		p.opts = *opts
+		p.arena = opts.Arena
+	}
+	f, err := p.parseFile()
+	if err != nil {
+		p.errs = append(p.errs, err)
+	}
+	if len(p.errs) > 0 {
+		return nil, p.errs.Err()
 	}
-	return p.parseFile()
+	return f, nil
 }
 
 func ParseExpr(tm *t.Map, filename string, src []t.Token, opts *Options) (*a.Expr, error) {
 	p := &parser{
 		tm:       tm,
 		filename: filename,
+		tokens:   src,
 		src:      src,
 	}
 	if len(src) > 0 {
@@ -87,6 +108,7 @@ func ParseExpr(tm *t.Map, filename string, src []t.Token, opts *Options) (*a.Exp
 	}
 	if opts != nil {
 		p.opts = *opts
+		p.arena = opts.Arena
 	}
 	return p.parseExpr()
 }
@@ -94,12 +116,15 @@ func ParseExpr(tm *t.Map, filename string, src []t.Token, opts *Options) (*a.Exp
 type parser struct {
 	tm         *t.Map
 	filename   string
+	tokens     []t.Token
 	src        []t.Token
 	opts       Options
+	arena      *a.Arena
 	lastLine   uint32
 	funcEffect a.Effect
 	loops      a.LoopStack
 	allowVar   bool
+	errs       diagnostic.ErrorList
 }
 
 func (p *parser) line() uint32 {
@@ -109,6 +134,27 @@ func (p *parser) line() uint32 {
 	return p.lastLine
 }
 
+// column returns the column of the next token or, if there are none left, the
+// column just after the last one.
+func (p *parser) column() uint32 {
+	if len(p.src) != 0 {
+		return p.src[0].Column
+	}
+	if len(p.tokens) != 0 {
+		return t.SpanOf(p.tm, p.tokens[len(p.tokens)-1], p.tokens[len(p.tokens)-1]).EndColumn
+	}
+	return 0
+}
+
+// setSpan sets n's filename and its source span, from start, the first token
+// of n, to the most recently consumed token.
+func (p *parser) setSpan(n *a.Node, start t.Token) {
+	if i := len(p.tokens) - len(p.src); i > 0 {
+		n.AsRaw().SetFilenameLine(p.filename, start.Line)
+		n.AsRaw().SetSpan(t.SpanOf(p.tm, start, p.tokens[i-1]))
+	}
+}
+
 func (p *parser) peek1() t.ID {
 	if len(p.src) > 0 {
 		return p.src[0].ID
@@ -116,36 +162,169 @@ func (p *parser) peek1() t.ID {
 	return 0
 }
 
+// recover records err, so that parsing can resume after it. It returns false,
+// recording nothing, if the caller should instead return err, as the error
+// limit is reached.
+func (p *parser) recover(err error) bool {
+	if len(p.errs)+1 >= p.opts.MaxErrors {
+		return false
+	}
+	p.errs = append(p.errs, err)
+	return true
+}
+
+// skipStatement skips to just after the next ";" that isn't nested in
+// brackets, or to just before the unmatched closing bracket, end, which ends
+// the enclosing block. It always makes progress unless the next token is end.
+func (p *parser) skipStatement(end t.ID) {
+	depth := 0
+	for len(p.src) > 0 {
+		switch x := p.src[0].ID; x {
+		case t.IDOpenParen, t.IDOpenBracket, t.IDOpenCurly, t.IDOpenDoubleCurly:
+			depth++
+		case t.IDCloseParen, t.IDCloseBracket, t.IDCloseCurly, t.IDCloseDoubleCurly:
+			if depth > 0 {
+				depth--
+			} else if x == end {
+				return
+			}
+		case t.IDSemicolon:
+			if depth == 0 {
+				p.src = p.src[1:]
+				return
+			}
+		}
+		p.src = p.src[1:]
+	}
+}
+
+// skipTopLevelDecl skips at least one token and then to the start of the next
+// top level declaration.
+func (p *parser) skipTopLevelDecl() {
+	for len(p.src) > 0 {
+		p.src = p.src[1:]
+		switch p.peek1() {
+		case t.IDLemma, t.IDPragma, t.IDPri, t.IDPub, t.IDTest, t.IDUse:
+			return
+		}
+	}
+}
+
 func (p *parser) parseFile() (*a.File, error) {
 	topLevelDecls := []*a.Node(nil)
 	for len(p.src) > 0 {
+		start := p.src[0]
 		d, err := p.parseTopLevelDecl()
 		if err != nil {
-			return nil, err
+			if !p.recover(err) {
+				return nil, err
+			}
+			p.funcEffect, p.loops, p.allowVar = 0, nil, false
+			p.skipTopLevelDecl()
+			continue
 		}
+		p.setSpan(d, start)
 		topLevelDecls = append(topLevelDecls, d)
 	}
-	return a.NewFile(p.filename, topLevelDecls), nil
+	return p.arena.NewFile(p.filename, topLevelDecls), nil
 }
 
 func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 	flags := a.Flags(0)
-	line := p.src[0].Line
+	line, column := p.src[0].Line, p.src[0].Column
 	switch k := p.peek1(); k {
 	case t.IDUse:
 		p.src = p.src[1:]
 		path := p.peek1()
 		if !path.IsDQStrLiteral(p.tm) {
 			got := p.tm.ByID(path)
-			return nil, fmt.Errorf(`parse: expected "-string literal, got %q at %s:%d`, got, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected "-string literal, got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
+		}
+		p.src = p.src[1:]
+		if x := p.peek1(); x != t.IDSemicolon {
+			got := p.tm.ByID(x)
+			return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
+		}
+		p.src = p.src[1:]
+		return p.arena.NewUse(p.filename, line, path).AsNode(), nil
+
+	case t.IDPragma:
+		p.src = p.src[1:]
+		key, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		value, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		if x := p.peek1(); x != t.IDSemicolon {
+			got := p.tm.ByID(x)
+			return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
+		}
+		p.src = p.src[1:]
+		return p.arena.NewPragma(p.filename, line, key, value).AsNode(), nil
+
+	case t.IDTest:
+		p.src = p.src[1:]
+		name := p.peek1()
+		if !name.IsDQStrLiteral(p.tm) {
+			got := p.tm.ByID(name)
+			return nil, fmt.Errorf(`parse: expected "-string literal, got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 		}
 		p.src = p.src[1:]
+		p.allowVar = true
+		body, err := p.parseBlock(false)
+		if err != nil {
+			return nil, err
+		}
+		p.allowVar = false
+		if x := p.peek1(); x != t.IDSemicolon {
+			got := p.tm.ByID(x)
+			return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
+		}
+		p.src = p.src[1:]
+		return p.arena.NewTest(p.filename, line, name, body).AsNode(), nil
+
+	case t.IDLemma:
+		p.src = p.src[1:]
+		name := p.peek1()
+		if !name.IsDQStrLiteral(p.tm) {
+			got := p.tm.ByID(name)
+			return nil, fmt.Errorf(`parse: expected "-string literal, got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
+		}
+		p.src = p.src[1:]
+		params, err := p.parseList(t.IDCloseParen, (*parser).parseFieldNode)
+		if err != nil {
+			return nil, err
+		}
+		asserts := []*a.Node(nil)
+		if p.peek1() == t.IDComma {
+			p.src = p.src[1:]
+			asserts, err = p.parseList(t.IDOpenCurly, (*parser).parseAssertNode)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.assertsSorted(asserts, false); err != nil {
+				return nil, err
+			}
+			for _, o := range asserts {
+				if o.AsAssert().Keyword() == t.IDInv {
+					return nil, fmt.Errorf(`parse: lemma cannot have an "inv" condition at %s:%d:%d`,
+						p.filename, p.line(), p.column())
+				}
+			}
+		}
+		body, err := p.parseBlock(false)
+		if err != nil {
+			return nil, err
+		}
 		if x := p.peek1(); x != t.IDSemicolon {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 		}
 		p.src = p.src[1:]
-		return a.NewUse(p.filename, line, path).AsNode(), nil
+		return p.arena.NewLemma(p.filename, line, name, params, asserts, body).AsNode(), nil
 
 	case t.IDPub:
 		flags |= a.FlagsPublic
@@ -160,13 +339,13 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 				return nil, err
 			}
 			if !validConstName(p.tm.ByID(id)) {
-				return nil, fmt.Errorf(`parse: invalid const name %q at %s:%d`,
-					p.tm.ByID(id), p.filename, p.line())
+				return nil, fmt.Errorf(`parse: invalid const name %q at %s:%d:%d`,
+					p.tm.ByID(id), p.filename, p.line(), p.column())
 			}
 
 			if x := p.peek1(); x != t.IDColon {
 				got := p.tm.ByID(x)
-				return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 			}
 			p.src = p.src[1:]
 
@@ -175,8 +354,8 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 				return nil, err
 			}
 			if p.peek1() != t.IDEq {
-				return nil, fmt.Errorf(`parse: const %q has no value at %s:%d`,
-					p.tm.ByID(id), p.filename, p.line())
+				return nil, fmt.Errorf(`parse: const %q has no value at %s:%d:%d`,
+					p.tm.ByID(id), p.filename, p.line(), p.column())
 			}
 			p.src = p.src[1:]
 			value, err := p.parsePossibleListExpr()
@@ -185,10 +364,10 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			}
 			if x := p.peek1(); x != t.IDSemicolon {
 				got := p.tm.ByID(x)
-				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 			}
 			p.src = p.src[1:]
-			return a.NewConst(flags, p.filename, line, id, typ, value).AsNode(), nil
+			return p.arena.NewConst(flags, p.filename, line, id, typ, value).AsNode(), nil
 
 		case t.IDFunc:
 			p.src = p.src[1:]
@@ -199,15 +378,15 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			if !p.opts.AllowBuiltInNames {
 				switch id1 {
 				case t.IDInitialize, t.IDReset:
-					return nil, fmt.Errorf(`parse: cannot have a method named %q at %s:%d`,
-						id1.Str(p.tm), p.filename, p.line())
+					return nil, fmt.Errorf(`parse: cannot have a method named %q at %s:%d:%d`,
+						id1.Str(p.tm), p.filename, p.line(), p.column())
 				}
 			}
 			// TODO: should we require id0 != 0? In other words, always methods
 			// (attached to receivers) and never free standing functions?
 			if !p.opts.AllowDoubleUnderscoreNames && containsDoubleUnderscore(p.tm.ByID(id1)) {
-				return nil, fmt.Errorf(`parse: double-underscore %q used for func name at %s:%d`,
-					p.tm.ByID(id1), p.filename, p.line())
+				return nil, fmt.Errorf(`parse: double-underscore %q used for func name at %s:%d:%d`,
+					p.tm.ByID(id1), p.filename, p.line(), p.column())
 			}
 
 			p.funcEffect = p.parseEffect()
@@ -226,20 +405,68 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			asserts := []*a.Node(nil)
 			if p.peek1() == t.IDComma {
 				p.src = p.src[1:]
-				if p.peek1() == t.IDChoosy {
+				if x := p.peek1(); (x == t.IDChoosy) || (x == t.IDProbe) || (x == t.IDSeekable) ||
+					(x == t.IDRecursive) || (x == t.IDWorkbufLess) {
 					p.src = p.src[1:]
-					if (flags & a.FlagsPublic) != 0 {
-						return nil, fmt.Errorf(`parse: choosy function cannot be pub at %s:%d`,
-							p.filename, p.line())
+					if x == t.IDWorkbufLess {
+						// A workbuf_less function is a variant of a public
+						// method that takes a workbuf, for callers that
+						// initialize with WUFFS_INITIALIZE__WORKBUF_LESS.
+						// See lang/check/workbufless.go.
+						if (flags & a.FlagsPublic) == 0 {
+							return nil, fmt.Errorf(`parse: workbuf_less function must be pub at %s:%d:%d`,
+								p.filename, p.line(), p.column())
+						}
+						flags |= a.FlagsWorkbufLess
+					} else if x == t.IDRecursive {
+						// A recursive function is a coroutine that can call
+						// itself, up to a maximum depth. See
+						// lang/check/recursive.go.
+						if (flags & a.FlagsPublic) != 0 {
+							return nil, fmt.Errorf(`parse: recursive function cannot be pub at %s:%d:%d`,
+								p.filename, p.line(), p.column())
+						} else if !p.funcEffect.Coroutine() {
+							return nil, fmt.Errorf(`parse: recursive function must be a coroutine at %s:%d:%d`,
+								p.filename, p.line(), p.column())
+						}
+						flags |= a.FlagsRecursive
+					} else if x == t.IDSeekable {
+						// A seekable function is a decoder's restart_frame
+						// method, for decoders whose frames can be decoded
+						// independently. See lang/check/seekable.go.
+						if (flags & a.FlagsPublic) == 0 {
+							return nil, fmt.Errorf(`parse: seekable function must be pub at %s:%d:%d`,
+								p.filename, p.line(), p.column())
+						} else if p.funcEffect.Coroutine() {
+							return nil, fmt.Errorf(`parse: seekable function cannot be a coroutine at %s:%d:%d`,
+								p.filename, p.line(), p.column())
+						}
+						flags |= a.FlagsSeekable
+					} else if x == t.IDProbe {
+						// A probe function is the header-only part of a
+						// decoder, such as decode_image_config. See
+						// lang/check/probe.go.
+						if (flags & a.FlagsPublic) == 0 {
+							return nil, fmt.Errorf(`parse: probe function must be pub at %s:%d:%d`,
+								p.filename, p.line(), p.column())
+						} else if !p.funcEffect.Coroutine() {
+							return nil, fmt.Errorf(`parse: probe function must be a coroutine at %s:%d:%d`,
+								p.filename, p.line(), p.column())
+						}
+						flags |= a.FlagsProbe
+					} else if (flags & a.FlagsPublic) != 0 {
+						return nil, fmt.Errorf(`parse: choosy function cannot be pub at %s:%d:%d`,
+							p.filename, p.line(), p.column())
 					} else if p.funcEffect.Coroutine() {
-						return nil, fmt.Errorf(`parse: choosy function cannot be a coroutine at %s:%d`,
-							p.filename, p.line())
+						return nil, fmt.Errorf(`parse: choosy function cannot be a coroutine at %s:%d:%d`,
+							p.filename, p.line(), p.column())
+					} else {
+						flags |= a.FlagsChoosy
 					}
-					flags |= a.FlagsChoosy
 					if p.peek1() != t.IDOpenCurly {
 						if x := p.peek1(); x != t.IDComma {
-							return nil, fmt.Errorf(`parse: expected ",", got %q at %s:%d`,
-								p.tm.ByID(x), p.filename, p.line())
+							return nil, fmt.Errorf(`parse: expected ",", got %q at %s:%d:%d`,
+								p.tm.ByID(x), p.filename, p.line(), p.column())
 						}
 						p.src = p.src[1:]
 					}
@@ -259,8 +486,8 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 					} else if o.IsChooseCPUArch() {
 						flags |= a.FlagsHasChooseCPUArch
 					} else {
-						return nil, fmt.Errorf(`parse: invalid "choose" condition at %s:%d`,
-							p.filename, p.line())
+						return nil, fmt.Errorf(`parse: invalid "choose" condition at %s:%d:%d`,
+							p.filename, p.line(), p.column())
 					}
 				}
 			}
@@ -274,23 +501,39 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 
 			if x := p.peek1(); x != t.IDSemicolon {
 				got := p.tm.ByID(x)
-				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 			}
 			p.src = p.src[1:]
 
 			if (flags & a.FlagsHasChooseCPUArch) != 0 {
 				if (flags & a.FlagsPublic) != 0 {
-					return nil, fmt.Errorf(`parse: cpu_arch function cannot be public at %s:%d`,
-						p.filename, p.line())
+					return nil, fmt.Errorf(`parse: cpu_arch function cannot be public at %s:%d:%d`,
+						p.filename, p.line(), p.column())
 				}
 				if (flags & a.FlagsChoosy) != 0 {
-					return nil, fmt.Errorf(`parse: cpu_arch function cannot be choosy at %s:%d`,
-						p.filename, p.line())
+					return nil, fmt.Errorf(`parse: cpu_arch function cannot be choosy at %s:%d:%d`,
+						p.filename, p.line(), p.column())
 				}
 			}
 			p.funcEffect = 0
-			in := a.NewStruct(0, p.filename, line, t.IDArgs, nil, argFields)
-			return a.NewFunc(flags, p.filename, line, id0, id1, in, out, asserts, body).AsNode(), nil
+			in := p.arena.NewStruct(0, p.filename, line, t.IDArgs, nil, argFields)
+			return p.arena.NewFunc(flags, p.filename, line, id0, id1, in, out, asserts, body).AsNode(), nil
+
+		case t.IDFeature:
+			p.src = p.src[1:]
+			if flags&a.FlagsPublic == 0 {
+				return nil, fmt.Errorf(`parse: feature must be pub at %s:%d:%d`, p.filename, p.line(), p.column())
+			}
+			name, err := p.parseIdent()
+			if err != nil {
+				return nil, err
+			}
+			if x := p.peek1(); x != t.IDSemicolon {
+				got := p.tm.ByID(x)
+				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
+			}
+			p.src = p.src[1:]
+			return p.arena.NewFeature(flags, p.filename, line, name).AsNode(), nil
 
 		case t.IDStatus:
 			p.src = p.src[1:]
@@ -298,19 +541,28 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			message := p.peek1()
 			if !message.IsDQStrLiteral(p.tm) {
 				got := p.tm.ByID(message)
-				return nil, fmt.Errorf(`parse: expected "-string literal, got %q at %s:%d`, got, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected "-string literal, got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 			}
 			if s, _ := t.Unescape(p.tm.ByID(message)); !isStatusMessage(s) {
 				return nil, fmt.Errorf(`parse: status message %q does not start with `+
-					`@, # or $ at %s:%d`, s, p.filename, p.line())
+					`@, # or $ at %s:%d:%d`, s, p.filename, p.line(), p.column())
 			}
 			p.src = p.src[1:]
+			class := t.ID(0)
+			if p.peek1() == t.IDAs {
+				p.src = p.src[1:]
+				c, err := p.parseIdent()
+				if err != nil {
+					return nil, err
+				}
+				class = c
+			}
 			if x := p.peek1(); x != t.IDSemicolon {
 				got := p.tm.ByID(x)
-				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 			}
 			p.src = p.src[1:]
-			return a.NewStatus(flags, p.filename, line, message).AsNode(), nil
+			return p.arena.NewStatus(flags, p.filename, line, message, class).AsNode(), nil
 
 		case t.IDStruct:
 			p.src = p.src[1:]
@@ -319,8 +571,8 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 				return nil, err
 			}
 			if !p.opts.AllowDoubleUnderscoreNames && containsDoubleUnderscore(p.tm.ByID(name)) {
-				return nil, fmt.Errorf(`parse: double-underscore %q used for struct name at %s:%d`,
-					p.tm.ByID(name), p.filename, p.line())
+				return nil, fmt.Errorf(`parse: double-underscore %q used for struct name at %s:%d:%d`,
+					p.tm.ByID(name), p.filename, p.line(), p.column())
 			}
 
 			if p.peek1() == t.IDQuestion {
@@ -336,11 +588,11 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 					return nil, err
 				}
 				if len(implements) > a.MaxImplements {
-					return nil, fmt.Errorf(`parse: too many implements listed at %s:%d`, p.filename, p.line())
+					return nil, fmt.Errorf(`parse: too many implements listed at %s:%d:%d`, p.filename, p.line(), p.column())
 				}
 			}
 
-			fields, err := p.parseList(t.IDCloseParen, (*parser).parseFieldNode)
+			fields, err := p.parseList(t.IDCloseParen, (*parser).parseStructFieldNode)
 			if err != nil {
 				return nil, err
 			}
@@ -353,13 +605,13 @@ func (p *parser) parseTopLevelDecl() (*a.Node, error) {
 			}
 			if x := p.peek1(); x != t.IDSemicolon {
 				got := p.tm.ByID(x)
-				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 			}
 			p.src = p.src[1:]
-			return a.NewStruct(flags, p.filename, line, name, implements, fields).AsNode(), nil
+			return p.arena.NewStruct(flags, p.filename, line, name, implements, fields).AsNode(), nil
 		}
 	}
-	return nil, fmt.Errorf(`parse: unrecognized top level declaration at %s:%d`, p.filename, line)
+	return nil, fmt.Errorf(`parse: unrecognized top level declaration at %s:%d:%d`, p.filename, line, column)
 }
 
 func (p *parser) parseQualifiedIdentAsTypeExprNode() (*a.Node, error) {
@@ -367,7 +619,7 @@ func (p *parser) parseQualifiedIdentAsTypeExprNode() (*a.Node, error) {
 	if err != nil {
 		return nil, err
 	}
-	return a.NewTypeExpr(0, pkg, name, nil, nil, nil).AsNode(), nil
+	return p.arena.NewTypeExpr(0, pkg, name, nil, nil, nil).AsNode(), nil
 }
 
 // parseQualifiedIdent parses "foo.bar" or "bar".
@@ -394,17 +646,17 @@ func (p *parser) parseIdentAsExprNode() (*a.Node, error) {
 	if err != nil {
 		return nil, err
 	}
-	return a.NewExpr(0, 0, id, nil, nil, nil, nil).AsNode(), nil
+	return p.arena.NewExpr(0, 0, id, nil, nil, nil, nil).AsNode(), nil
 }
 
 func (p *parser) parseIdent() (t.ID, error) {
 	if len(p.src) == 0 {
-		return 0, fmt.Errorf(`parse: expected identifier at %s:%d`, p.filename, p.line())
+		return 0, fmt.Errorf(`parse: expected identifier at %s:%d:%d`, p.filename, p.line(), p.column())
 	}
 	x := p.src[0]
 	if !x.ID.IsIdent(p.tm) {
 		got := p.tm.ByID(x.ID)
-		return 0, fmt.Errorf(`parse: expected identifier, got %q at %s:%d`, got, p.filename, p.line())
+		return 0, fmt.Errorf(`parse: expected identifier, got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 	return x.ID, nil
@@ -413,8 +665,8 @@ func (p *parser) parseIdent() (t.ID, error) {
 func (p *parser) parseList(stop t.ID, parseElem func(*parser) (*a.Node, error)) ([]*a.Node, error) {
 	if stop == t.IDCloseParen {
 		if x := p.peek1(); x != t.IDOpenParen {
-			return nil, fmt.Errorf(`parse: expected "(", got %q at %s:%d`,
-				p.tm.ByID(x), p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected "(", got %q at %s:%d:%d`,
+				p.tm.ByID(x), p.filename, p.line(), p.column())
 		}
 		p.src = p.src[1:]
 	}
@@ -445,17 +697,28 @@ func (p *parser) parseList(stop t.ID, parseElem func(*parser) (*a.Node, error))
 		case t.IDComma:
 			p.src = p.src[1:]
 		default:
-			return nil, fmt.Errorf(`parse: expected %q, got %q at %s:%d`,
-				p.tm.ByID(stop), p.tm.ByID(x), p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected %q, got %q at %s:%d:%d`,
+				p.tm.ByID(stop), p.tm.ByID(x), p.filename, p.line(), p.column())
 		}
 	}
-	return nil, fmt.Errorf(`parse: expected %q at %s:%d`, p.tm.ByID(stop), p.filename, p.line())
+	return nil, fmt.Errorf(`parse: expected %q at %s:%d:%d`, p.tm.ByID(stop), p.filename, p.line(), p.column())
 }
 
 func (p *parser) parseFieldNode() (*a.Node, error) {
 	return p.parseFieldNode1(0)
 }
 
+// parseStructFieldNode parses a struct field, which (unlike a function
+// argument or an extra field) can be marked "pub" for a generated getter. See
+// lang/check/pubfield.go.
+func (p *parser) parseStructFieldNode() (*a.Node, error) {
+	if p.peek1() == t.IDPub {
+		p.src = p.src[1:]
+		return p.parseFieldNode1(a.FlagsPublic)
+	}
+	return p.parseFieldNode1(0)
+}
+
 func (p *parser) parseExtraFieldNode() (*a.Node, error) {
 	n, err := p.parseFieldNode1(a.FlagsPrivateData)
 	if err != nil {
@@ -468,20 +731,24 @@ func (p *parser) parseExtraFieldNode() (*a.Node, error) {
 	if (typ.Decorator() != 0) ||
 		(typ.QID()[0] == t.IDBase) && (!typ.IsNumType() || typ.IsRefined()) {
 
-		return nil, fmt.Errorf(`parse: invalid extra-field type %q at %s:%d`,
-			n.AsField().XType().Str(p.tm), p.filename, p.line())
+		return nil, fmt.Errorf(`parse: invalid extra-field type %q at %s:%d:%d`,
+			n.AsField().XType().Str(p.tm), p.filename, p.line(), p.column())
 	}
 	return n, nil
 }
 
 func (p *parser) parseFieldNode1(flags a.Flags) (*a.Node, error) {
+	start := t.Token{}
+	if len(p.src) > 0 {
+		start = p.src[0]
+	}
 	name, err := p.parseIdent()
 	if err != nil {
 		return nil, err
 	}
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 	typ, err := p.parseTypeExpr()
@@ -491,7 +758,9 @@ func (p *parser) parseFieldNode1(flags a.Flags) (*a.Node, error) {
 	if pkg := typ.Innermost().QID()[0]; (pkg != 0) && (pkg != t.IDBase) {
 		flags |= a.FlagsPrivateData
 	}
-	return a.NewField(flags, name, typ).AsNode(), nil
+	n := p.arena.NewField(flags, name, typ).AsNode()
+	p.setSpan(n, start)
+	return n, nil
 }
 
 func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
@@ -501,7 +770,7 @@ func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
 		if err != nil {
 			return nil, err
 		}
-		return a.NewTypeExpr(x, 0, 0, nil, nil, rhs), nil
+		return p.arena.NewTypeExpr(x, 0, 0, nil, nil, rhs), nil
 	}
 
 	decorator, arrayLength := t.ID(0), (*a.Expr)(nil)
@@ -512,7 +781,7 @@ func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
 
 		if x := p.peek1(); x != t.IDOpenBracket {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected "[", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected "[", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 		}
 		p.src = p.src[1:]
 
@@ -524,7 +793,7 @@ func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
 
 		if x := p.peek1(); x != t.IDCloseBracket {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected "]", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected "]", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 		}
 		p.src = p.src[1:]
 
@@ -542,9 +811,13 @@ func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
 		if err != nil {
 			return nil, err
 		}
-		return a.NewTypeExpr(decorator, 0, 0, arrayLength.AsNode(), nil, rhs), nil
+		return p.arena.NewTypeExpr(decorator, 0, 0, arrayLength.AsNode(), nil, rhs), nil
 	}
 
+	start := t.Token{}
+	if len(p.src) > 0 {
+		start = p.src[0]
+	}
 	pkg, name, err := p.parseQualifiedIdent()
 	if err != nil {
 		return nil, err
@@ -560,11 +833,13 @@ func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
 			((pkg == t.IDBase) || ((pkg == 0) && p.opts.AllowBuiltInNames)) {
 			// No-op.
 		} else {
-			return nil, fmt.Errorf(`parse: cannot refine non-numeric type at %s:%d`, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: cannot refine non-numeric type at %s:%d:%d`, p.filename, p.line(), p.column())
 		}
 	}
 
-	return a.NewTypeExpr(0, pkg, name, lhs.AsNode(), mhs, nil), nil
+	n := p.arena.NewTypeExpr(0, pkg, name, lhs.AsNode(), mhs, nil)
+	p.setSpan(n.AsNode(), start)
+	return n, nil
 }
 
 // parseBracket parses "[i .. j]", "[i ..]", "[.. j]" and "[..]". A "..="
@@ -574,7 +849,7 @@ func (p *parser) parseTypeExpr() (*a.TypeExpr, error) {
 func (p *parser) parseBracket(sep t.ID) (op t.ID, ei *a.Expr, ej *a.Expr, err error) {
 	if x := p.peek1(); x != t.IDOpenBracket {
 		got := p.tm.ByID(x)
-		return 0, nil, nil, fmt.Errorf(`parse: expected "[", got %q at %s:%d`, got, p.filename, p.line())
+		return 0, nil, nil, fmt.Errorf(`parse: expected "[", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
@@ -599,8 +874,8 @@ func (p *parser) parseBracket(sep t.ID) (op t.ID, ei *a.Expr, ej *a.Expr, err er
 			extra = ` or "]"`
 		}
 		got := p.tm.ByID(x)
-		return 0, nil, nil, fmt.Errorf(`parse: expected %q%s, got %q at %s:%d`,
-			p.tm.ByID(sep), extra, got, p.filename, p.line())
+		return 0, nil, nil, fmt.Errorf(`parse: expected %q%s, got %q at %s:%d:%d`,
+			p.tm.ByID(sep), extra, got, p.filename, p.line(), p.column())
 	}
 
 	if p.peek1() != t.IDCloseBracket {
@@ -612,7 +887,7 @@ func (p *parser) parseBracket(sep t.ID) (op t.ID, ei *a.Expr, ej *a.Expr, err er
 
 	if x := p.peek1(); x != t.IDCloseBracket {
 		got := p.tm.ByID(x)
-		return 0, nil, nil, fmt.Errorf(`parse: expected "]", got %q at %s:%d`, got, p.filename, p.line())
+		return 0, nil, nil, fmt.Errorf(`parse: expected "]", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
@@ -620,15 +895,17 @@ func (p *parser) parseBracket(sep t.ID) (op t.ID, ei *a.Expr, ej *a.Expr, err er
 }
 
 func (p *parser) parseBlock(doubleCurly bool) ([]*a.Node, error) {
+	end := t.IDCloseCurly
 	if doubleCurly {
+		end = t.IDCloseDoubleCurly
 		if x := p.peek1(); x != t.IDOpenDoubleCurly {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected "{{", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected "{{", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 		}
 	} else {
 		if x := p.peek1(); x != t.IDOpenCurly {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected "{", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected "{", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 		}
 	}
 	p.src = p.src[1:]
@@ -636,30 +913,32 @@ func (p *parser) parseBlock(doubleCurly bool) ([]*a.Node, error) {
 	block := []*a.Node(nil)
 	for {
 		if len(p.src) == 0 {
-			return nil, fmt.Errorf(`parse: expected "}" or "}}" at %s:%d`, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected "}" or "}}" at %s:%d:%d`, p.filename, p.line(), p.column())
 		}
 
-		if doubleCurly {
-			if p.src[0].ID == t.IDCloseDoubleCurly {
-				break
-			}
-		} else {
-			if p.src[0].ID == t.IDCloseCurly {
-				break
-			}
+		if p.src[0].ID == end {
+			break
 		}
 
+		numLoops := len(p.loops)
 		s, err := p.parseStatement()
+		if err == nil {
+			if x := p.peek1(); x != t.IDSemicolon {
+				got := p.tm.ByID(x)
+				err = fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
+			} else {
+				p.src = p.src[1:]
+			}
+		}
 		if err != nil {
-			return nil, err
+			if !p.recover(err) {
+				return nil, err
+			}
+			p.loops = p.loops[:numLoops]
+			p.skipStatement(end)
+			continue
 		}
 		block = append(block, s)
-
-		if x := p.peek1(); x != t.IDSemicolon {
-			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected (implicit) ";", got %q at %s:%d`, got, p.filename, p.line())
-		}
-		p.src = p.src[1:]
 	}
 
 	p.src = p.src[1:]
@@ -672,10 +951,10 @@ func (p *parser) assertsSorted(asserts []*a.Node, allowChoose bool) error {
 		switch o.AsAssert().Keyword() {
 		case t.IDAssert:
 			return fmt.Errorf(`parse: assertion chain cannot contain "assert", `+
-				`only "pre", "inv" and "post" at %s:%d`, p.filename, p.line())
+				`only "pre", "inv" and "post" at %s:%d:%d`, p.filename, p.line(), p.column())
 		case t.IDChoose:
 			if !allowChoose {
-				return fmt.Errorf(`parse: invalid "choose" at %s:%d`, p.filename, p.line())
+				return fmt.Errorf(`parse: invalid "choose" at %s:%d:%d`, p.filename, p.line(), p.column())
 			}
 			if seenPre || seenPost || seenInv {
 				break
@@ -697,8 +976,8 @@ func (p *parser) assertsSorted(asserts []*a.Node, allowChoose bool) error {
 			seenPost = true
 			continue
 		}
-		return fmt.Errorf(`parse: assertion chain not in "choose", "pre", "inv", "post" order at %s:%d`,
-			p.filename, p.line())
+		return fmt.Errorf(`parse: assertion chain not in "choose", "pre", "inv", "post" order at %s:%d:%d`,
+			p.filename, p.line(), p.column())
 	}
 	return nil
 }
@@ -712,8 +991,8 @@ func (p *parser) parseAssertNode() (*a.Node, error) {
 			return nil, err
 		}
 		if condition.Effect() != 0 {
-			return nil, fmt.Errorf(`parse: assert-condition %q is not effect-free at %s:%d`,
-				condition.Str(p.tm), p.filename, p.line())
+			return nil, fmt.Errorf(`parse: assert-condition %q is not effect-free at %s:%d:%d`,
+				condition.Str(p.tm), p.filename, p.line(), p.column())
 		}
 		reason, args := t.ID(0), []*a.Node(nil)
 		if p.peek1() == t.IDVia {
@@ -721,7 +1000,7 @@ func (p *parser) parseAssertNode() (*a.Node, error) {
 			reason = p.peek1()
 			if !reason.IsDQStrLiteral(p.tm) {
 				got := p.tm.ByID(reason)
-				return nil, fmt.Errorf(`parse: expected "-string literal, got %q at %s:%d`, got, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected "-string literal, got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 			}
 			p.src = p.src[1:]
 			args, err = p.parseList(t.IDCloseParen, (*parser).parseArgNode)
@@ -729,22 +1008,22 @@ func (p *parser) parseAssertNode() (*a.Node, error) {
 				return nil, err
 			}
 		}
-		return a.NewAssert(x, condition, reason, args).AsNode(), nil
+		return p.arena.NewAssert(x, condition, reason, args).AsNode(), nil
 	}
-	return nil, fmt.Errorf(`parse: expected "assert", "pre" or "post" at %s:%d`, p.filename, p.line())
+	return nil, fmt.Errorf(`parse: expected "assert", "pre" or "post" at %s:%d:%d`, p.filename, p.line(), p.column())
 }
 
 func (p *parser) parseStatement() (*a.Node, error) {
-	line := uint32(0)
+	start := t.Token{}
 	if len(p.src) > 0 {
-		line = p.src[0].Line
+		start = p.src[0]
 	}
 	n, err := p.parseStatement1()
 	if n != nil {
-		n.AsRaw().SetFilenameLine(p.filename, line)
+		p.setSpan(n, start)
 		if n.Kind() == a.KIterate {
 			for _, o := range n.AsIterate().Assigns() {
-				o.AsRaw().SetFilenameLine(p.filename, line)
+				o.AsRaw().SetFilenameLine(p.filename, start.Line)
 			}
 		}
 	}
@@ -781,8 +1060,8 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 	x := p.peek1()
 	if x == t.IDVar {
 		if !p.allowVar {
-			return nil, fmt.Errorf(`parse: var statement not at the top of a function at %s:%d`,
-				p.filename, p.line())
+			return nil, fmt.Errorf(`parse: var statement not at the top of a function at %s:%d:%d`,
+				p.filename, p.line(), p.column())
 		}
 		p.src = p.src[1:]
 		return p.parseVarNode()
@@ -806,8 +1085,8 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 		} else if label == 0 {
 			loop = p.loops[len(p.loops)-1]
 			if loop.Label() != 0 {
-				return nil, fmt.Errorf(`parse: unlabeled %s for labeled %s.%s at %s:%d`,
-					x.Str(p.tm), loop.Keyword().Str(p.tm), loop.Label().Str(p.tm), p.filename, p.line())
+				return nil, fmt.Errorf(`parse: unlabeled %s for labeled %s.%s at %s:%d:%d`,
+					x.Str(p.tm), loop.Keyword().Str(p.tm), loop.Label().Str(p.tm), p.filename, p.line(), p.column())
 			}
 		} else {
 			for i := len(p.loops) - 1; i >= 0; i-- {
@@ -822,8 +1101,8 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 			if label != 0 {
 				sepStr, labelStr = ".", label.Str(p.tm)
 			}
-			return nil, fmt.Errorf(`parse: no matching while/iterate statement for %s%s%s at %s:%d`,
-				x.Str(p.tm), sepStr, labelStr, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: no matching while/iterate statement for %s%s%s at %s:%d:%d`,
+				x.Str(p.tm), sepStr, labelStr, p.filename, p.line(), p.column())
 		}
 
 		if x == t.IDBreak {
@@ -831,14 +1110,14 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 		} else {
 			loop.SetHasContinue()
 		}
-		n := a.NewJump(x, label)
+		n := p.arena.NewJump(x, label)
 		n.SetJumpTarget(loop)
 		return n.AsNode(), nil
 
 	case t.IDChoose:
 		p.src = p.src[1:]
 		if p.funcEffect.Pure() {
-			return nil, fmt.Errorf(`parse: choose within pure function at %s:%d`, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: choose within pure function at %s:%d:%d`, p.filename, p.line(), p.column())
 		}
 		name, err := p.parseIdent()
 		if err != nil {
@@ -846,19 +1125,19 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 		}
 		if x := p.peek1(); x != t.IDEq {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected "=", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected "=", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 		}
 		p.src = p.src[1:]
 		if x := p.peek1(); x != t.IDOpenBracket {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected "[", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected "[", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 		}
 		p.src = p.src[1:]
 		args, err := p.parseList(t.IDCloseBracket, (*parser).parseIdentAsExprNode)
 		if err != nil {
 			return nil, err
 		}
-		return a.NewChoose(name, args).AsNode(), nil
+		return p.arena.NewChoose(name, args).AsNode(), nil
 
 	case t.IDIOBind, t.IDIOLimit:
 		return p.parseIOBindNode()
@@ -874,10 +1153,10 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 		p.src = p.src[1:]
 		if x == t.IDYield {
 			if !p.funcEffect.Coroutine() {
-				return nil, fmt.Errorf(`parse: yield within non-coroutine at %s:%d`, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: yield within non-coroutine at %s:%d:%d`, p.filename, p.line(), p.column())
 			}
 			if p.peek1() != t.IDQuestion {
-				return nil, fmt.Errorf(`parse: yield not followed by '?' at %s:%d`, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: yield not followed by '?' at %s:%d:%d`, p.filename, p.line(), p.column())
 			}
 			p.src = p.src[1:]
 		}
@@ -886,15 +1165,15 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 			return nil, err
 		}
 		if value.Effect().Impure() {
-			return nil, fmt.Errorf(`parse: %s an impure expression at %s:%d`,
-				x.Str(p.tm), p.filename, p.line())
+			return nil, fmt.Errorf(`parse: %s an impure expression at %s:%d:%d`,
+				x.Str(p.tm), p.filename, p.line(), p.column())
 		}
 		if (x == t.IDReturn) && (value.Operator() == 0) {
 			if s := p.tm.ByID(value.Ident()); (len(s) > 1) && (s[0] == '"') && (s[1] == '$') {
-				return nil, fmt.Errorf(`parse: cannot return a suspension at %s:%d`, p.filename, p.line())
+				return nil, fmt.Errorf(`parse: cannot return a suspension at %s:%d:%d`, p.filename, p.line(), p.column())
 			}
 		}
-		return a.NewRet(x, value).AsNode(), nil
+		return p.arena.NewRet(x, value).AsNode(), nil
 
 	case t.IDWhile:
 		p.src = p.src[1:]
@@ -907,23 +1186,27 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 			return nil, err
 		}
 		if condition.Effect() != 0 {
-			return nil, fmt.Errorf(`parse: while-condition %q is not effect-free at %s:%d`,
-				condition.Str(p.tm), p.filename, p.line())
+			return nil, fmt.Errorf(`parse: while-condition %q is not effect-free at %s:%d:%d`,
+				condition.Str(p.tm), p.filename, p.line(), p.column())
+		}
+		decreases, err := p.parseDecreases()
+		if err != nil {
+			return nil, err
 		}
 		asserts, err := p.parseAsserts()
 		if err != nil {
 			return nil, err
 		}
 
-		n := a.NewWhile(label, condition, asserts)
+		n := p.arena.NewWhile(label, condition, decreases, asserts)
 		if !p.loops.Push(n) {
-			return nil, fmt.Errorf(`parse: duplicate loop label %s at %s:%d`,
-				label.Str(p.tm), p.filename, p.line())
+			return nil, fmt.Errorf(`parse: duplicate loop label %s at %s:%d:%d`,
+				label.Str(p.tm), p.filename, p.line(), p.column())
 		}
 		doubleCurly := p.peek1() == t.IDOpenDoubleCurly
 		if doubleCurly && !n.IsWhileTrue() {
-			return nil, fmt.Errorf(`parse: double {{ }} while loop condition isn't "true" at %s:%d`,
-				p.filename, p.line())
+			return nil, fmt.Errorf(`parse: double {{ }} while loop condition isn't "true" at %s:%d:%d`,
+				p.filename, p.line(), p.column())
 		}
 		body, err := p.parseBlock(doubleCurly)
 		if err != nil {
@@ -937,17 +1220,17 @@ func (p *parser) parseStatement1() (*a.Node, error) {
 			if label != 0 {
 				dotLabel = "." + label.Str(p.tm)
 			}
-			return nil, fmt.Errorf(`parse: expected endwhile%s at %s:%d`,
-				dotLabel, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected endwhile%s at %s:%d:%d`,
+				dotLabel, p.filename, p.line(), p.column())
 		}
 		if !doubleCurly {
 			// No-op.
 		} else if n.HasContinue() {
-			return nil, fmt.Errorf(`parse: double {{ }} while loop has explicit continue at %s:%d`,
-				p.filename, p.line())
+			return nil, fmt.Errorf(`parse: double {{ }} while loop has explicit continue at %s:%d:%d`,
+				p.filename, p.line(), p.column())
 		} else if !a.Terminates(body) {
-			return nil, fmt.Errorf(`parse: double {{ }} while loop doesn't terminate at %s:%d`,
-				p.filename, p.line())
+			return nil, fmt.Errorf(`parse: double {{ }} while loop doesn't terminate at %s:%d:%d`,
+				p.filename, p.line(), p.column())
 		}
 		return n.AsNode(), nil
 	}
@@ -966,31 +1249,31 @@ func (p *parser) parseAssignNode() (*a.Node, error) {
 		p.src = p.src[1:]
 		lhs = rhs
 		if lhs.Effect() != 0 {
-			return nil, fmt.Errorf(`parse: assignment LHS %q is not effect-free at %s:%d`,
-				lhs.Str(p.tm), p.filename, p.line())
+			return nil, fmt.Errorf(`parse: assignment LHS %q is not effect-free at %s:%d:%d`,
+				lhs.Str(p.tm), p.filename, p.line(), p.column())
 		}
 
 		for l := lhs; l != nil; l = l.LHS().AsExpr() {
 			switch l.Operator() {
 			case 0:
 				if id := l.Ident(); id.IsLiteral(p.tm) {
-					return nil, fmt.Errorf(`parse: assignment LHS %q is a literal at %s:%d`,
-						l.Str(p.tm), p.filename, p.line())
+					return nil, fmt.Errorf(`parse: assignment LHS %q is a literal at %s:%d:%d`,
+						l.Str(p.tm), p.filename, p.line(), p.column())
 				} else if id.IsCannotAssignTo() {
 					if l == lhs {
-						return nil, fmt.Errorf(`parse: cannot assign to %q at %s:%d`,
-							id.Str(p.tm), p.filename, p.line())
+						return nil, fmt.Errorf(`parse: cannot assign to %q at %s:%d:%d`,
+							id.Str(p.tm), p.filename, p.line(), p.column())
 					}
 					if !p.funcEffect.Impure() {
-						return nil, fmt.Errorf(`parse: cannot assign to %q in a pure function at %s:%d`,
-							lhs.Str(p.tm), p.filename, p.line())
+						return nil, fmt.Errorf(`parse: cannot assign to %q in a pure function at %s:%d:%d`,
+							lhs.Str(p.tm), p.filename, p.line(), p.column())
 					}
 				}
 			case t.IDDot, t.IDOpenBracket:
 				// No-op.
 			default:
-				return nil, fmt.Errorf(`parse: invalid assignment LHS %q at %s:%d`,
-					lhs.Str(p.tm), p.filename, p.line())
+				return nil, fmt.Errorf(`parse: invalid assignment LHS %q at %s:%d:%d`,
+					lhs.Str(p.tm), p.filename, p.line(), p.column())
 			}
 		}
 
@@ -1001,20 +1284,24 @@ func (p *parser) parseAssignNode() (*a.Node, error) {
 
 		if op == t.IDEqQuestion {
 			if (rhs.Operator() != a.ExprOperatorCall) || (!rhs.Effect().Coroutine()) {
-				return nil, fmt.Errorf(`parse: expected ?-function call after "=?", got %q at %s:%d`,
-					rhs.Str(p.tm), p.filename, p.line())
+				return nil, fmt.Errorf(`parse: expected ?-function call after "=?", got %q at %s:%d:%d`,
+					rhs.Str(p.tm), p.filename, p.line(), p.column())
 			}
 		}
 	} else {
+		if (rhs.Operator() == t.IDXBinaryAs) && rhs.AsExclam() {
+			return nil, fmt.Errorf(`parse: "as!" value %q is not assigned at %s:%d:%d`,
+				rhs.Str(p.tm), p.filename, p.line(), p.column())
+		}
 		op = t.IDEq
 	}
 
 	if p.funcEffect.WeakerThan(rhs.Effect()) {
-		return nil, fmt.Errorf(`parse: value %q's effect %q is stronger than the func's effect %q at %s:%d`,
-			rhs.Str(p.tm), rhs.Effect(), p.funcEffect, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: value %q's effect %q is stronger than the func's effect %q at %s:%d:%d`,
+			rhs.Str(p.tm), rhs.Effect(), p.funcEffect, p.filename, p.line(), p.column())
 	}
 
-	return a.NewAssign(op, lhs, rhs).AsNode(), nil
+	return p.arena.NewAssign(op, lhs, rhs).AsNode(), nil
 }
 
 func (p *parser) parseIterateAssignNode() (*a.Node, error) {
@@ -1024,17 +1311,33 @@ func (p *parser) parseIterateAssignNode() (*a.Node, error) {
 	}
 	o := n.AsAssign()
 	if op := o.Operator(); op != t.IDEq {
-		return nil, fmt.Errorf(`parse: expected "=", got %q at %s:%d`, op.Str(p.tm), p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected "=", got %q at %s:%d:%d`, op.Str(p.tm), p.filename, p.line(), p.column())
 	}
 	if lhs := o.LHS(); lhs.Operator() != 0 {
-		return nil, fmt.Errorf(`parse: expected variable, got %q at %s:%d`, lhs.Str(p.tm), p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected variable, got %q at %s:%d:%d`, lhs.Str(p.tm), p.filename, p.line(), p.column())
 	}
 	if rhs := o.RHS(); rhs.Effect() != 0 {
-		return nil, fmt.Errorf(`parse: value %q is not effect-free at %s:%d`, rhs.Str(p.tm), p.filename, p.line())
+		return nil, fmt.Errorf(`parse: value %q is not effect-free at %s:%d:%d`, rhs.Str(p.tm), p.filename, p.line(), p.column())
 	}
 	return o.AsNode(), nil
 }
 
+func (p *parser) parseDecreases() (*a.Expr, error) {
+	if (len(p.src) < 2) || (p.src[0].ID != t.IDComma) || (p.src[1].ID != t.IDDecreases) {
+		return nil, nil
+	}
+	p.src = p.src[2:]
+	decreases, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if decreases.Effect() != 0 {
+		return nil, fmt.Errorf(`parse: decreases-expression %q is not effect-free at %s:%d:%d`,
+			decreases.Str(p.tm), p.filename, p.line(), p.column())
+	}
+	return decreases, nil
+}
+
 func (p *parser) parseAsserts() ([]*a.Node, error) {
 	asserts := []*a.Node(nil)
 	if p.peek1() == t.IDComma {
@@ -1056,19 +1359,19 @@ func (p *parser) parseIOBindNode() (*a.Node, error) {
 
 	if x := p.peek1(); x != t.IDOpenParen {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "(", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected "(", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDIO {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "io", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected "io", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
@@ -1077,40 +1380,40 @@ func (p *parser) parseIOBindNode() (*a.Node, error) {
 		return nil, err
 	}
 	if io.Effect() != 0 {
-		return nil, fmt.Errorf(`parse: argument %q is not effect-free at %s:%d`,
-			io.Str(p.tm), p.filename, p.line())
+		return nil, fmt.Errorf(`parse: argument %q is not effect-free at %s:%d:%d`,
+			io.Str(p.tm), p.filename, p.line(), p.column())
 	}
 
 	arg1Name := t.ID(0)
 	if keyword == t.IDIOBind {
 		arg1Name = t.IDData
 		if io.Operator() != 0 {
-			return nil, fmt.Errorf(`parse: invalid %s argument %q at %s:%d`,
-				keyword.Str(p.tm), io.Str(p.tm), p.filename, p.line())
+			return nil, fmt.Errorf(`parse: invalid %s argument %q at %s:%d:%d`,
+				keyword.Str(p.tm), io.Str(p.tm), p.filename, p.line(), p.column())
 		}
 	} else {
 		arg1Name = t.IDLimit
 		if (io.Operator() != 0) && (io.IsArgsDotFoo() == 0) {
-			return nil, fmt.Errorf(`parse: invalid %s argument %q at %s:%d`,
-				keyword.Str(p.tm), io.Str(p.tm), p.filename, p.line())
+			return nil, fmt.Errorf(`parse: invalid %s argument %q at %s:%d:%d`,
+				keyword.Str(p.tm), io.Str(p.tm), p.filename, p.line(), p.column())
 		}
 	}
 
 	if x := p.peek1(); x != t.IDComma {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ",", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ",", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != arg1Name {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected %q, got %q at %s:%d`, arg1Name.Str(p.tm), got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected %q, got %q at %s:%d:%d`, arg1Name.Str(p.tm), got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
@@ -1119,13 +1422,13 @@ func (p *parser) parseIOBindNode() (*a.Node, error) {
 		return nil, err
 	}
 	if arg1.Effect() != 0 {
-		return nil, fmt.Errorf(`parse: argument %q is not effect-free at %s:%d`,
-			io.Str(p.tm), p.filename, p.line())
+		return nil, fmt.Errorf(`parse: argument %q is not effect-free at %s:%d:%d`,
+			io.Str(p.tm), p.filename, p.line(), p.column())
 	}
 
 	if x := p.peek1(); x != t.IDCloseParen {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ")", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ")", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
@@ -1134,13 +1437,13 @@ func (p *parser) parseIOBindNode() (*a.Node, error) {
 		return nil, err
 	}
 
-	return a.NewIOBind(keyword, io, arg1, body).AsNode(), nil
+	return p.arena.NewIOBind(keyword, io, arg1, body).AsNode(), nil
 }
 
 func (p *parser) parseIf() (*a.If, error) {
 	if x := p.peek1(); x != t.IDIf {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "if", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected "if", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 	condition, err := p.parseExpr()
@@ -1148,8 +1451,8 @@ func (p *parser) parseIf() (*a.If, error) {
 		return nil, err
 	}
 	if condition.Effect() != 0 {
-		return nil, fmt.Errorf(`parse: if-condition %q is not effect-free at %s:%d`,
-			condition.Str(p.tm), p.filename, p.line())
+		return nil, fmt.Errorf(`parse: if-condition %q is not effect-free at %s:%d:%d`,
+			condition.Str(p.tm), p.filename, p.line(), p.column())
 	}
 	bodyIfTrue, err := p.parseBlock(false)
 	if err != nil {
@@ -1170,13 +1473,13 @@ func (p *parser) parseIf() (*a.If, error) {
 			}
 		}
 	}
-	return a.NewIf(condition, bodyIfTrue, bodyIfFalse, elseIf), nil
+	return p.arena.NewIf(condition, bodyIfTrue, bodyIfFalse, elseIf), nil
 }
 
 func (p *parser) parseIterateNode() (*a.Node, error) {
 	if x := p.peek1(); x != t.IDIterate {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "iterate", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected "iterate", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 	label, err := p.parseLabel()
@@ -1197,87 +1500,87 @@ func (p *parser) parseIterateNode() (*a.Node, error) {
 func (p *parser) parseIterateBlock(label t.ID, assigns []*a.Node) (*a.Iterate, error) {
 	if x := p.peek1(); x != t.IDOpenParen {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "(", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected "(", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDLength {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "length", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected "length", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
 	length := p.peek1()
 	lengthInt := asSmallPositiveInt256(p.tm, length)
 	if lengthInt == 0 {
-		return nil, fmt.Errorf(`parse: expected length count in [1 ..= 256], got %q at %s:%d`,
-			p.tm.ByID(length), p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected length count in [1 ..= 256], got %q at %s:%d:%d`,
+			p.tm.ByID(length), p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDComma {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ",", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ",", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDAdvance {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "advance", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected "advance", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
 	advance := p.peek1()
 	advanceInt := asSmallPositiveInt256(p.tm, advance)
 	if advanceInt == 0 {
-		return nil, fmt.Errorf(`parse: expected advance count in [1 ..= 256], got %q at %s:%d`,
-			p.tm.ByID(advance), p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected advance count in [1 ..= 256], got %q at %s:%d:%d`,
+			p.tm.ByID(advance), p.filename, p.line(), p.column())
 	} else if advanceInt > lengthInt {
-		return nil, fmt.Errorf(`parse: advance %d is larger than length %d at %s:%d`,
-			advanceInt, lengthInt, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: advance %d is larger than length %d at %s:%d:%d`,
+			advanceInt, lengthInt, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDComma {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ",", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ",", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDUnroll {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected "unroll", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected "unroll", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
 	unroll := p.peek1()
 	if asSmallPositiveInt256(p.tm, unroll) == 0 {
-		return nil, fmt.Errorf(`parse: expected unroll count in [1 ..= 256], got %q at %s:%d`,
-			p.tm.ByID(unroll), p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected unroll count in [1 ..= 256], got %q at %s:%d:%d`,
+			p.tm.ByID(unroll), p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
 	if x := p.peek1(); x != t.IDCloseParen {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ")", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ")", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 
@@ -1285,11 +1588,11 @@ func (p *parser) parseIterateBlock(label t.ID, assigns []*a.Node) (*a.Iterate, e
 	if err != nil {
 		return nil, err
 	}
-	n := a.NewIterate(label, assigns, length, advance, unroll, asserts)
+	n := p.arena.NewIterate(label, assigns, length, advance, unroll, asserts)
 	// TODO: decide how break/continue work with iterate loops.
 	if !p.loops.Push(n) {
-		return nil, fmt.Errorf(`parse: duplicate loop label %s at %s:%d`,
-			label.Str(p.tm), p.filename, p.line())
+		return nil, fmt.Errorf(`parse: duplicate loop label %s at %s:%d:%d`,
+			label.Str(p.tm), p.filename, p.line(), p.column())
 	}
 	body, err := p.parseBlock(false)
 	if err != nil {
@@ -1340,18 +1643,31 @@ func (p *parser) parseArgNode() (*a.Node, error) {
 	}
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
+	specialized := false
+	if p.peek1() == t.IDConst {
+		p.src = p.src[1:]
+		specialized = true
+	}
 	value, err := p.parseExpr()
 	if err != nil {
 		return nil, err
 	}
 	if value.Effect() != 0 {
-		return nil, fmt.Errorf(`parse: arg-value %q is not effect-free at %s:%d`,
-			value.Str(p.tm), p.filename, p.line())
+		return nil, fmt.Errorf(`parse: arg-value %q is not effect-free at %s:%d:%d`,
+			value.Str(p.tm), p.filename, p.line(), p.column())
 	}
-	return a.NewArg(name, value).AsNode(), nil
+	if specialized && ((value.Operator() != 0) || !value.Ident().IsNumLiteral(p.tm)) {
+		return nil, fmt.Errorf(`parse: const arg-value %q is not a numeric literal at %s:%d:%d`,
+			value.Str(p.tm), p.filename, p.line(), p.column())
+	}
+	arg := p.arena.NewArg(name, value)
+	if specialized {
+		arg.SetSpecialized()
+	}
+	return arg.AsNode(), nil
 }
 
 func (p *parser) parseIOBindExprNode() (*a.Node, error) {
@@ -1367,7 +1683,7 @@ func (p *parser) parseIOBindExprNode() (*a.Node, error) {
 			return e.AsNode(), nil
 		}
 	}
-	return nil, fmt.Errorf(`parse: expected "args.something", got %q at %s:%d`, e.Str(p.tm), p.filename, p.line())
+	return nil, fmt.Errorf(`parse: expected "args.something", got %q at %s:%d:%d`, e.Str(p.tm), p.filename, p.line(), p.column())
 }
 
 func (p *parser) parseVarNode() (*a.Node, error) {
@@ -1377,14 +1693,14 @@ func (p *parser) parseVarNode() (*a.Node, error) {
 	}
 	if x := p.peek1(); x != t.IDColon {
 		got := p.tm.ByID(x)
-		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d`, got, p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expected ":", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 	}
 	p.src = p.src[1:]
 	typ, err := p.parseTypeExpr()
 	if err != nil {
 		return nil, err
 	}
-	return a.NewVar(id, typ).AsNode(), nil
+	return p.arena.NewVar(id, typ).AsNode(), nil
 }
 
 func (p *parser) parsePossibleListExprNode() (*a.Node, error) {
@@ -1405,7 +1721,7 @@ func (p *parser) parsePossibleListExpr() (*a.Expr, error) {
 	if err != nil {
 		return nil, err
 	}
-	return a.NewExpr(0, a.ExprOperatorList, 0, nil, nil, nil, args), nil
+	return p.arena.NewExpr(0, a.ExprOperatorList, 0, nil, nil, nil, args), nil
 }
 
 func (p *parser) parseExpr() (*a.Expr, error) {
@@ -1414,21 +1730,32 @@ func (p *parser) parseExpr() (*a.Expr, error) {
 		return nil, err
 	}
 	if e.SubExprHasEffect() {
-		return nil, fmt.Errorf(`parse: expression %q has an effect-ful sub-expression at %s:%d`,
-			e.Str(p.tm), p.filename, p.line())
+		return nil, fmt.Errorf(`parse: expression %q has an effect-ful sub-expression at %s:%d:%d`,
+			e.Str(p.tm), p.filename, p.line(), p.column())
 	}
 	return e, nil
 }
 
 func (p *parser) parseExpr1() (*a.Expr, error) {
+	start := t.Token{}
+	if len(p.src) > 0 {
+		start = p.src[0]
+	}
 	lhs, err := p.parseOperand()
 	if err != nil {
 		return nil, err
 	}
 	if x := p.peek1(); x.IsBinaryOp() {
 		p.src = p.src[1:]
-		rhs := (*a.Node)(nil)
+		flags, rhs := a.Flags(0), (*a.Node)(nil)
 		if x == t.IDAs {
+			if p.peek1() == t.IDExclam {
+				p.src = p.src[1:]
+				if !p.funcEffect.Coroutine() {
+					return nil, fmt.Errorf(`parse: "as!" within non-coroutine at %s:%d:%d`, p.filename, p.line(), p.column())
+				}
+				flags = a.EffectImpure.AsFlags() | a.FlagsAsExclam
+			}
 			o, err := p.parseTypeExpr()
 			if err != nil {
 				return nil, err
@@ -1447,7 +1774,9 @@ func (p *parser) parseExpr1() (*a.Expr, error) {
 			if op == 0 {
 				return nil, fmt.Errorf(`parse: internal error: no binary form for token 0x%02X`, x)
 			}
-			return a.NewExpr(0, op, 0, lhs.AsNode(), nil, rhs, nil), nil
+			n := p.arena.NewExpr(flags, op, 0, lhs.AsNode(), nil, rhs, nil)
+			p.setSpan(n.AsNode(), start)
+			return n, nil
 		}
 
 		args := []*a.Node{lhs.AsNode(), rhs}
@@ -1463,12 +1792,19 @@ func (p *parser) parseExpr1() (*a.Expr, error) {
 		if op == 0 {
 			return nil, fmt.Errorf(`parse: internal error: no associative form for token 0x%02X`, x)
 		}
-		return a.NewExpr(0, op, 0, nil, nil, nil, args), nil
+		n := p.arena.NewExpr(0, op, 0, nil, nil, nil, args)
+		p.setSpan(n.AsNode(), start)
+		return n, nil
 	}
 	return lhs, nil
 }
 
 func (p *parser) parseOperand() (*a.Expr, error) {
+	start := t.Token{}
+	if len(p.src) > 0 {
+		start = p.src[0]
+	}
+
 	switch x := p.peek1(); {
 	case x.IsUnaryOp():
 		p.src = p.src[1:]
@@ -1480,11 +1816,15 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 		if op == 0 {
 			return nil, fmt.Errorf(`parse: internal error: no unary form for token 0x%02X`, x)
 		}
-		return a.NewExpr(0, op, 0, nil, nil, rhs.AsNode(), nil), nil
+		n := p.arena.NewExpr(0, op, 0, nil, nil, rhs.AsNode(), nil)
+		p.setSpan(n.AsNode(), start)
+		return n, nil
 
 	case x.IsLiteral(p.tm):
 		p.src = p.src[1:]
-		return a.NewExpr(0, 0, x, nil, nil, nil, nil), nil
+		n := p.arena.NewExpr(0, 0, x, nil, nil, nil, nil)
+		p.setSpan(n.AsNode(), start)
+		return n, nil
 
 	case x == t.IDOpenParen:
 		p.src = p.src[1:]
@@ -1494,17 +1834,39 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 		}
 		if x := p.peek1(); x != t.IDCloseParen {
 			got := p.tm.ByID(x)
-			return nil, fmt.Errorf(`parse: expected ")", got %q at %s:%d`, got, p.filename, p.line())
+			return nil, fmt.Errorf(`parse: expected ")", got %q at %s:%d:%d`, got, p.filename, p.line(), p.column())
 		}
 		p.src = p.src[1:]
 		return expr, nil
+
+	case x == t.IDFeature:
+		// A feature query is "feature pkg.name" or, for the package's own
+		// features, "feature name".
+		p.src = p.src[1:]
+		name, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		pkg := (*a.Expr)(nil)
+		if p.peek1() == t.IDDot {
+			p.src = p.src[1:]
+			pkg = p.arena.NewExpr(0, 0, name, nil, nil, nil, nil)
+			name, err = p.parseIdent()
+			if err != nil {
+				return nil, err
+			}
+		}
+		n := p.arena.NewExpr(0, t.IDFeature, name, pkg.AsNode(), nil, nil, nil)
+		p.setSpan(n.AsNode(), start)
+		return n, nil
 	}
 
 	id, err := p.parseIdent()
 	if err != nil {
 		return nil, err
 	}
-	lhs := a.NewExpr(0, 0, id, nil, nil, nil, nil)
+	lhs := p.arena.NewExpr(0, 0, id, nil, nil, nil, nil)
+	p.setSpan(lhs.AsNode(), start)
 
 	for first := true; ; first = false {
 		flags := a.Flags(0)
@@ -1521,14 +1883,16 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 			if err != nil {
 				return nil, err
 			}
-			lhs = a.NewExpr(flags, a.ExprOperatorCall, 0, lhs.AsNode(), nil, nil, args)
+			lhs = p.arena.NewExpr(flags, a.ExprOperatorCall, 0, lhs.AsNode(), nil, nil, args)
+			p.setSpan(lhs.AsNode(), start)
 
 		case t.IDOpenBracket:
 			id0, mhs, rhs, err := p.parseBracket(t.IDDotDot)
 			if err != nil {
 				return nil, err
 			}
-			lhs = a.NewExpr(0, id0, 0, lhs.AsNode(), mhs.AsNode(), rhs.AsNode(), nil)
+			lhs = p.arena.NewExpr(0, id0, 0, lhs.AsNode(), mhs.AsNode(), rhs.AsNode(), nil)
+			p.setSpan(lhs.AsNode(), start)
 
 		case t.IDDot:
 			p.src = p.src[1:]
@@ -1541,7 +1905,8 @@ func (p *parser) parseOperand() (*a.Expr, error) {
 					return nil, err
 				}
 			}
-			lhs = a.NewExpr(0, a.ExprOperatorSelector, selector, lhs.AsNode(), nil, nil, nil)
+			lhs = p.arena.NewExpr(0, a.ExprOperatorSelector, selector, lhs.AsNode(), nil, nil, nil)
+			p.setSpan(lhs.AsNode(), start)
 		}
 	}
 }
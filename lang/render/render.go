@@ -188,6 +188,9 @@ func Render(w io.Writer, tm *t.Map, src []t.Token, comments []string) (err error
 				// Token-based (not ast.Node-based) heuristic for whether the
 				// operator looks unary instead of binary.
 				prevIsTightRight = !isCloseIdentLiteral(tm, prevID)
+			} else if (tok.ID == t.IDExclam) && (prevID == t.IDAs) {
+				// The "!" in "x as! T" is not tight-right, unlike in "f!()".
+				prevIsTightRight = false
 			}
 
 			prevID = tok.ID
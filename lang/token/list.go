@@ -139,6 +139,8 @@ func (x ID) IsEtcUtility() bool {
 		switch x {
 		case IDARMCRC32Utility,
 			IDARMNeonUtility,
+			IDARMSVEUtility,
+			IDRISCVVUtility,
 			IDX86SSE42Utility,
 			IDX86AVX2Utility:
 			return true
@@ -194,10 +196,47 @@ func (x QQID) Str(m *Map) string {
 	return m.ByID(x[2])
 }
 
-// Token combines an ID and the line number it was seen.
+// Token combines an ID and the line number and column it was seen.
+//
+// Column is the 1-based byte offset of the token's first byte within that
+// line. A token's source text is always its ID's string form, so its end
+// (exclusive) column is its Column plus the length of m.ByID(ID). An implicit
+// semicolon's Column is that of the '\n' that ended its line.
 type Token struct {
-	ID   ID
-	Line uint32
+	ID     ID
+	Line   uint32
+	Column uint32
+}
+
+// Span is a range of source code, from the start of one token to the end of
+// the same or a later token. Lines and columns are 1-based, and columns count
+// bytes, not runes. EndColumn is exclusive. A zero Line means that the span
+// is unknown.
+type Span struct {
+	Line      uint32
+	Column    uint32
+	EndLine   uint32
+	EndColumn uint32
+}
+
+// SpanOf returns the span from the start of x to the end of y.
+func SpanOf(m *Map, x Token, y Token) Span {
+	return Span{
+		Line:      x.Line,
+		Column:    x.Column,
+		EndLine:   y.Line,
+		EndColumn: y.Column + uint32(len(m.ByID(y.ID))),
+	}
+}
+
+// Contains returns whether s contains the 1-based line and byte column. A
+// span without a column contains nothing.
+func (s Span) Contains(line uint32, column uint32) bool {
+	if (s.Column == 0) || (line < s.Line) || (line > s.EndLine) {
+		return false
+	}
+	return ((line > s.Line) || (column >= s.Column)) &&
+		((line < s.EndLine) || (column < s.EndColumn))
 }
 
 // nBuiltInIDs is the number of built-in IDs. The packing is:
@@ -268,6 +307,7 @@ const (
 	IDTildeModMinusEq  = ID(0x31)
 	IDTildeModStarEq   = ID(0x32)
 	IDTildeModShiftLEq = ID(0x34)
+	IDTildeModShiftREq = ID(0x35)
 
 	IDTildeSatPlusEq  = ID(0x38)
 	IDTildeSatMinusEq = ID(0x39)
@@ -299,6 +339,7 @@ const (
 	IDTildeModMinus  = ID(0x51)
 	IDTildeModStar   = ID(0x52)
 	IDTildeModShiftL = ID(0x54)
+	IDTildeModShiftR = ID(0x55)
 
 	IDTildeSatPlus  = ID(0x58)
 	IDTildeSatMinus = ID(0x59)
@@ -334,6 +375,7 @@ const (
 	IDXBinaryTildeModMinus  = ID(0x81)
 	IDXBinaryTildeModStar   = ID(0x82)
 	IDXBinaryTildeModShiftL = ID(0x84)
+	IDXBinaryTildeModShiftR = ID(0x85)
 
 	IDXBinaryTildeSatPlus  = ID(0x88)
 	IDXBinaryTildeSatMinus = ID(0x89)
@@ -392,6 +434,12 @@ const (
 	IDVia        = ID(0xC7)
 	IDWhile      = ID(0xC8)
 	IDYield      = ID(0xC9)
+	IDPragma     = ID(0xCA)
+	IDTest       = ID(0xCB)
+	IDLemma      = ID(0xCC)
+	IDProbe      = ID(0xCD)
+	IDFeature    = ID(0xCE)
+	IDDecreases  = ID(0xCF)
 )
 
 const (
@@ -435,6 +483,7 @@ const (
 	IDArgs             = ID(0x100)
 	IDCoroutineResumed = ID(0x101)
 	IDThis             = ID(0x102)
+	IDResult           = ID(0x103)
 
 	IDT1      = ID(0x104)
 	IDT2      = ID(0x105)
@@ -480,6 +529,8 @@ const (
 	IDRectIEU32  = ID(0x134)
 	IDRectIIU32  = ID(0x135)
 
+	IDOptionalU32 = ID(0x136)
+
 	IDFrameConfig   = ID(0x150)
 	IDImageConfig   = ID(0x151)
 	IDPixelBlend    = ID(0x152)
@@ -649,6 +700,10 @@ const (
 	IDSet            = ID(0x206)
 	IDUnroll         = ID(0x207)
 	IDUpdate         = ID(0x208)
+	IDSetMetadata    = ID(0x209)
+	IDSeekable       = ID(0x20A)
+	IDRecursive      = ID(0x20B)
+	IDWorkbufLess    = ID(0x20C)
 
 	// TODO: range/rect methods like intersection and contains?
 
@@ -657,6 +712,14 @@ const (
 	IDMax      = ID(0x222)
 	IDMin      = ID(0x223)
 
+	IDMulQ16Round = ID(0x224)
+	IDMulQ8Round  = ID(0x225)
+
+	IDToU32Checked = ID(0x226)
+
+	IDCeilDivPow2 = ID(0x227)
+	IDFloorLog2   = ID(0x228)
+
 	IDIsError      = ID(0x230)
 	IDIsOK         = ID(0x231)
 	IDIsSuspension = ID(0x232)
@@ -673,6 +736,10 @@ const (
 	IDValidUTF8Length  = ID(0x249)
 	IDWidth            = ID(0x24A)
 
+	IDValue = ID(0x24B)
+
+	IDAllLE = ID(0x250)
+
 	IDLimitedSwizzleU32InterleavedFromReader = ID(0x280)
 	IDSwizzleInterleavedFromReader           = ID(0x281)
 
@@ -690,6 +757,13 @@ const (
 
 	IDARMCRC32U32 = ID(0x302)
 
+	// ARM SVE (Scalable Vector Extension) types. Their length, a multiple of
+	// 128 bits, is only known at run time.
+	IDARMSVE        = ID(0x304)
+	IDARMSVEUtility = ID(0x305)
+
+	IDARMSVEU8 = ID(0x306)
+
 	IDARMNeon        = ID(0x30E)
 	IDARMNeonUtility = ID(0x30F)
 
@@ -711,6 +785,13 @@ const (
 	IDX86AVX2Utility  = ID(0x393)
 
 	IDX86M128I = ID(0x3A0)
+
+	// RISC-V V (Vector Extension) types. Like ARM SVE, their length is only
+	// known at run time.
+	IDRISCVV        = ID(0x3A8)
+	IDRISCVVUtility = ID(0x3A9)
+
+	IDRISCVVU8 = ID(0x3AA)
 )
 
 var builtInsByID = [nBuiltInIDs]string{
@@ -748,6 +829,7 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDTildeModMinusEq:  "~mod-=",
 	IDTildeModStarEq:   "~mod*=",
 	IDTildeModShiftLEq: "~mod<<=",
+	IDTildeModShiftREq: "~mod>>=",
 
 	IDTildeSatPlusEq:  "~sat+=",
 	IDTildeSatMinusEq: "~sat-=",
@@ -770,6 +852,7 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDTildeModMinus:  "~mod-",
 	IDTildeModStar:   "~mod*",
 	IDTildeModShiftL: "~mod<<",
+	IDTildeModShiftR: "~mod>>",
 
 	IDTildeSatPlus:  "~sat+",
 	IDTildeSatMinus: "~sat-",
@@ -813,6 +896,12 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDVia:        "via",
 	IDWhile:      "while",
 	IDYield:      "yield",
+	IDPragma:     "pragma",
+	IDTest:       "test",
+	IDLemma:      "lemma",
+	IDProbe:      "probe",
+	IDFeature:    "feature",
+	IDDecreases:  "decreases",
 
 	IDArray: "array",
 	IDNptr:  "nptr",
@@ -833,6 +922,7 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDArgs:             "args",
 	IDCoroutineResumed: "coroutine_resumed",
 	IDThis:             "this",
+	IDResult:           "result",
 
 	// Some of the next few IDs are never returned by the tokenizer, as it
 	// rejects non-ASCII input. The string representations "¶", "ℤ" etc. are
@@ -904,6 +994,8 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDRectIEU32:  "rect_ie_u32",
 	IDRectIIU32:  "rect_ii_u32",
 
+	IDOptionalU32: "optional_u32",
+
 	IDFrameConfig:   "frame_config",
 	IDImageConfig:   "image_config",
 	IDPixelBlend:    "pixel_blend",
@@ -1071,12 +1163,24 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDSet:            "set",
 	IDUnroll:         "unroll",
 	IDUpdate:         "update",
+	IDSetMetadata:    "set_metadata",
+	IDSeekable:       "seekable",
+	IDRecursive:      "recursive",
+	IDWorkbufLess:    "workbuf_less",
 
 	IDHighBits: "high_bits",
 	IDLowBits:  "low_bits",
 	IDMax:      "max",
 	IDMin:      "min",
 
+	IDMulQ16Round: "mul_q16_round",
+	IDMulQ8Round:  "mul_q8_round",
+
+	IDToU32Checked: "to_u32_checked",
+
+	IDCeilDivPow2: "ceil_div_pow2",
+	IDFloorLog2:   "floor_log2",
+
 	IDIsError:      "is_error",
 	IDIsOK:         "is_ok",
 	IDIsSuspension: "is_suspension",
@@ -1093,6 +1197,10 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDValidUTF8Length:  "valid_utf_8_length",
 	IDWidth:            "width",
 
+	IDValue: "value",
+
+	IDAllLE: "all_le",
+
 	IDLimitedSwizzleU32InterleavedFromReader: "limited_swizzle_u32_interleaved_from_reader",
 	IDSwizzleInterleavedFromReader:           "swizzle_interleaved_from_reader",
 
@@ -1103,6 +1211,11 @@ var builtInsByID = [nBuiltInIDs]string{
 
 	IDARMCRC32U32: "arm_crc32_u32",
 
+	IDARMSVE:        "arm_sve",
+	IDARMSVEUtility: "arm_sve_utility",
+
+	IDARMSVEU8: "arm_sve_u8",
+
 	IDARMNeon:        "arm_neon",
 	IDARMNeonUtility: "arm_neon_utility",
 
@@ -1122,6 +1235,11 @@ var builtInsByID = [nBuiltInIDs]string{
 	IDX86AVX2Utility:  "x86_avx2_utility",
 
 	IDX86M128I: "x86_m128i",
+
+	IDRISCVV:        "riscv_v",
+	IDRISCVVUtility: "riscv_v_utility",
+
+	IDRISCVVU8: "riscv_v_u8",
 }
 
 var builtInsByName = map[string]ID{}
@@ -1225,6 +1343,8 @@ var lexers = [256][]suffixLexer{
 	'~': {
 		{"mod<<=", IDTildeModShiftLEq},
 		{"mod<<", IDTildeModShiftL},
+		{"mod>>=", IDTildeModShiftREq},
+		{"mod>>", IDTildeModShiftR},
 		{"mod+=", IDTildeModPlusEq},
 		{"mod+", IDTildeModPlus},
 		{"mod-=", IDTildeModMinusEq},
@@ -1253,6 +1373,7 @@ var ambiguousForms = [nBuiltInSymbolicIDs]ID{
 	IDXBinaryTildeModMinus:  IDTildeModMinus,
 	IDXBinaryTildeModStar:   IDTildeModStar,
 	IDXBinaryTildeModShiftL: IDTildeModShiftL,
+	IDXBinaryTildeModShiftR: IDTildeModShiftR,
 	IDXBinaryTildeSatPlus:   IDTildeSatPlus,
 	IDXBinaryTildeSatMinus:  IDTildeSatMinus,
 	IDXBinaryNotEq:          IDNotEq,
@@ -1319,6 +1440,7 @@ var binaryForms = [nBuiltInSymbolicIDs]ID{
 	IDTildeModMinusEq:  IDXBinaryTildeModMinus,
 	IDTildeModStarEq:   IDXBinaryTildeModStar,
 	IDTildeModShiftLEq: IDXBinaryTildeModShiftL,
+	IDTildeModShiftREq: IDXBinaryTildeModShiftR,
 	IDTildeSatPlusEq:   IDXBinaryTildeSatPlus,
 	IDTildeSatMinusEq:  IDXBinaryTildeSatMinus,
 
@@ -1336,6 +1458,7 @@ var binaryForms = [nBuiltInSymbolicIDs]ID{
 	IDTildeModMinus:  IDXBinaryTildeModMinus,
 	IDTildeModStar:   IDXBinaryTildeModStar,
 	IDTildeModShiftL: IDXBinaryTildeModShiftL,
+	IDTildeModShiftR: IDXBinaryTildeModShiftR,
 	IDTildeSatPlus:   IDXBinaryTildeSatPlus,
 	IDTildeSatMinus:  IDXBinaryTildeSatMinus,
 
@@ -17,6 +17,8 @@ package token
 import (
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"unicode/utf8"
 )
 
@@ -137,9 +139,26 @@ func Unescape(s string) (unescaped string, ok bool) {
 	return string(b), true
 }
 
+// Map maps names to IDs and back. Its methods are safe for concurrent use, so
+// that multiple goroutines (e.g. parsing separate files) can share a Map. The
+// zero value is an empty Map ready to use. A Map must not be copied after
+// first use.
+//
+// Looking up a name or ID, including inserting an already present name, does
+// not take a lock. Only inserting a new name does.
+//
+// The IDs of non-built-in names depend on insertion order, which is not
+// deterministic under concurrent use, but a name's ID never changes once
+// inserted.
 type Map struct {
-	byName map[string]ID
-	byID   []string
+	mu sync.Mutex
+
+	// byName maps from string to ID.
+	byName sync.Map
+
+	// byID holds a []string. It is replaced, not modified, by Insert, other
+	// than appending past the previous length.
+	byID atomic.Value
 }
 
 func (m *Map) Insert(name string) (ID, error) {
@@ -149,19 +168,23 @@ func (m *Map) Insert(name string) (ID, error) {
 	if id, ok := builtInsByName[name]; ok {
 		return id, nil
 	}
-	if m.byName == nil {
-		m.byName = map[string]ID{}
+	if id, ok := m.byName.Load(name); ok {
+		return id.(ID), nil
 	}
-	if id, ok := m.byName[name]; ok {
-		return id, nil
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id, ok := m.byName.Load(name); ok {
+		return id.(ID), nil
 	}
 
-	id := nBuiltInIDs + ID(len(m.byID))
+	byID, _ := m.byID.Load().([]string)
+	id := nBuiltInIDs + ID(len(byID))
 	if id > maxID {
 		return 0, errors.New("token: too many distinct tokens")
 	}
-	m.byName[name] = id
-	m.byID = append(m.byID, name)
+	m.byID.Store(append(byID, name))
+	m.byName.Store(name, id)
 	return id, nil
 }
 
@@ -169,8 +192,8 @@ func (m *Map) ByName(name string) ID {
 	if id, ok := builtInsByName[name]; ok {
 		return id
 	}
-	if m.byName != nil {
-		return m.byName[name]
+	if id, ok := m.byName.Load(name); ok {
+		return id.(ID)
 	}
 	return 0
 }
@@ -180,8 +203,9 @@ func (m *Map) ByID(x ID) string {
 		return builtInsByID[x]
 	}
 	x -= nBuiltInIDs
-	if uint(x) < uint(len(m.byID)) {
-		return m.byID[x]
+	byID, _ := m.byID.Load().([]string)
+	if uint(x) < uint(len(byID)) {
+		return byID[x]
 	}
 	return ""
 }
@@ -252,20 +276,21 @@ func checkNumericUnderscores(a []byte) bool {
 }
 
 func Tokenize(m *Map, filename string, src []byte) (tokens []Token, comments []string, retErr error) {
-	line := uint32(1)
+	line, lineStart := uint32(1), 0
 loop:
 	for i := 0; i < len(src); {
 		c := src[i]
+		column := uint32(i-lineStart) + 1
 
 		if c <= ' ' {
 			if c == '\n' {
 				if len(tokens) > 0 && tokens[len(tokens)-1].ID.IsImplicitSemicolon(m) {
-					tokens = append(tokens, Token{IDSemicolon, line})
+					tokens = append(tokens, Token{IDSemicolon, line, column})
 				}
 				if line == maxLine {
 					return nil, nil, fmt.Errorf("token: too many lines in %q", filename)
 				}
-				line++
+				line, lineStart = line+1, i+1
 			}
 			i++
 			continue
@@ -281,12 +306,12 @@ loop:
 					break
 				} else if c == '\\' {
 					if quote == '"' {
-						return nil, nil, fmt.Errorf("token: backslash in \"-string at %s:%d", filename, line)
+						return nil, nil, fmt.Errorf("token: backslash in \"-string at %s:%d:%d", filename, line, column)
 					}
 				} else if c == '\n' {
-					return nil, nil, fmt.Errorf("token: expected final %c in string at %s:%d", quote, filename, line)
+					return nil, nil, fmt.Errorf("token: expected final %c in string at %s:%d:%d", quote, filename, line, column)
 				} else if c < ' ' {
-					return nil, nil, fmt.Errorf("token: control character in string at %s:%d", filename, line)
+					return nil, nil, fmt.Errorf("token: control character in string at %s:%d:%d", filename, line, column)
 				}
 			}
 
@@ -298,14 +323,14 @@ loop:
 			}
 
 			if j-i > maxTokenSize {
-				return nil, nil, fmt.Errorf("token: string too long at %s:%d", filename, line)
+				return nil, nil, fmt.Errorf("token: string too long at %s:%d:%d", filename, line, column)
 			}
 			s := string(src[i:j])
 			if quote == '\'' {
 				if unescaped, ok := Unescape(s); !ok {
-					return nil, nil, fmt.Errorf("token: invalid '-string at %s:%d", filename, line)
+					return nil, nil, fmt.Errorf("token: invalid '-string at %s:%d:%d", filename, line, column)
 				} else if (len(unescaped) > 1) && !hasEndian {
-					return nil, nil, fmt.Errorf("token: multi-byte '-string needs be or le suffix at %s:%d", filename, line)
+					return nil, nil, fmt.Errorf("token: multi-byte '-string needs be or le suffix at %s:%d:%d", filename, line, column)
 				}
 			}
 
@@ -313,7 +338,7 @@ loop:
 			if err != nil {
 				return nil, nil, err
 			}
-			tokens = append(tokens, Token{id, line})
+			tokens = append(tokens, Token{id, line, column})
 			i = j
 			continue
 		}
@@ -322,14 +347,14 @@ loop:
 			j := i + 1
 			for ; j < len(src) && alphaNumeric(src[j]); j++ {
 				if j-i == maxTokenSize {
-					return nil, nil, fmt.Errorf("token: identifier too long at %s:%d", filename, line)
+					return nil, nil, fmt.Errorf("token: identifier too long at %s:%d:%d", filename, line, column)
 				}
 			}
 			id, err := m.Insert(string(src[i:j]))
 			if err != nil {
 				return nil, nil, err
 			}
-			tokens = append(tokens, Token{id, line})
+			tokens = append(tokens, Token{id, line, column})
 			i = j
 			continue
 		}
@@ -343,22 +368,22 @@ loop:
 				} else if next == 'b' || next == 'B' {
 					j, isDigit = j+1, zeroOneUnderscore
 				} else if numeric(next) {
-					return nil, nil, fmt.Errorf("token: legacy octal syntax at %s:%d", filename, line)
+					return nil, nil, fmt.Errorf("token: legacy octal syntax at %s:%d:%d", filename, line, column)
 				}
 			}
 			for ; j < len(src) && isDigit(src[j]); j++ {
 				if j-i == maxTokenSize {
-					return nil, nil, fmt.Errorf("token: constant too long at %s:%d", filename, line)
+					return nil, nil, fmt.Errorf("token: constant too long at %s:%d:%d", filename, line, column)
 				}
 			}
 			if !checkNumericUnderscores(src[i:j]) {
-				return nil, nil, fmt.Errorf("token: invalid numeric literal at %s:%d", filename, line)
+				return nil, nil, fmt.Errorf("token: invalid numeric literal at %s:%d:%d", filename, line, column)
 			}
 			id, err := m.Insert(string(src[i:j]))
 			if err != nil {
 				return nil, nil, err
 			}
-			tokens = append(tokens, Token{id, line})
+			tokens = append(tokens, Token{id, line, column})
 			i = j
 			continue
 		}
@@ -377,13 +402,13 @@ loop:
 
 		if id := squiggles[c]; id != 0 {
 			i++
-			tokens = append(tokens, Token{id, line})
+			tokens = append(tokens, Token{id, line, column})
 			continue
 		}
 		for _, x := range lexers[c] {
 			if hasPrefix(src[i+1:], x.suffix) {
 				i += len(x.suffix) + 1
-				tokens = append(tokens, Token{x.id, line})
+				tokens = append(tokens, Token{x.id, line, column})
 				continue loop
 			}
 		}
@@ -394,7 +419,7 @@ loop:
 		} else {
 			msg = fmt.Sprintf("non-ASCII byte '\\x%02X'", c)
 		}
-		return nil, nil, fmt.Errorf("token: unrecognized %s at %s:%d", msg, filename, line)
+		return nil, nil, fmt.Errorf("token: unrecognized %s at %s:%d:%d", msg, filename, line, column)
 	}
 	return tokens, comments, nil
 }
@@ -0,0 +1,133 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestMapConcurrentInsert(tt *testing.T) {
+	const (
+		nGoroutines = 8
+		nNames      = 1000
+	)
+
+	m := &Map{}
+	ids := [nGoroutines][nNames]ID{}
+	wg := sync.WaitGroup{}
+	for g := 0; g < nGoroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < nNames; i++ {
+				// Each goroutine inserts the same names, in a different order.
+				j := (i + (g * 137)) % nNames
+				id, err := m.Insert(fmt.Sprintf("name%d", j))
+				if err != nil {
+					tt.Errorf("Insert: %v", err)
+					return
+				}
+				ids[g][j] = id
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	seen := map[ID]bool{}
+	for j := 0; j < nNames; j++ {
+		name := fmt.Sprintf("name%d", j)
+		id := ids[0][j]
+		for g := 1; g < nGoroutines; g++ {
+			if ids[g][j] != id {
+				tt.Fatalf("%q: goroutines %d and 0 got different IDs", name, g)
+			}
+		}
+		if seen[id] {
+			tt.Fatalf("%q: duplicate ID 0x%X", name, id)
+		}
+		seen[id] = true
+		if got := m.ByName(name); got != id {
+			tt.Fatalf("ByName(%q): got 0x%X, want 0x%X", name, got, id)
+		}
+		if got := m.ByID(id); got != name {
+			tt.Fatalf("ByID(0x%X): got %q, want %q", id, got, name)
+		}
+	}
+}
+
+func TestTokenizeColumns(tt *testing.T) {
+	const src = "" +
+		"x = y +\n" +
+		"\t\"abc\" // comment\n" +
+		"  0x10 <<= 'a'be\n"
+
+	m := &Map{}
+	tokens, _, err := Tokenize(m, "test.wuffs", []byte(src))
+	if err != nil {
+		tt.Fatalf("Tokenize: %v", err)
+	}
+	got := []string(nil)
+	for _, x := range tokens {
+		s := SpanOf(m, x, x)
+		got = append(got, fmt.Sprintf("%q@%d:%d-%d", m.ByID(x.ID), s.Line, s.Column, s.EndColumn))
+	}
+	want := []string{
+		`"x"@1:1-2`,
+		`"="@1:3-4`,
+		`"y"@1:5-6`,
+		`"+"@1:7-8`,
+		`"\"abc\""@2:2-7`,
+		`";"@2:18-19`,
+		`"0x10"@3:3-7`,
+		`"<<="@3:8-11`,
+		`"'a'be"@3:12-17`,
+		`";"@3:17-18`,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		tt.Fatalf("\ngot  %q\nwant %q", got, want)
+	}
+
+	if _, _, err := Tokenize(m, "test.wuffs", []byte("x = 1\n  y $ 2\n")); err == nil {
+		tt.Fatalf("Tokenize: got nil error, want non-nil")
+	} else if got, want := err.Error(), "token: unrecognized byte '\\x24' ('$') at test.wuffs:2:5"; got != want {
+		tt.Fatalf("Tokenize: got %q, want %q", got, want)
+	}
+}
+
+func TestSpanContains(tt *testing.T) {
+	s := Span{Line: 2, Column: 5, EndLine: 4, EndColumn: 3}
+	testCases := []struct {
+		line, column uint32
+		want         bool
+	}{
+		{1, 9, false},
+		{2, 4, false},
+		{2, 5, true},
+		{3, 1, true},
+		{4, 2, true},
+		{4, 3, false},
+		{5, 1, false},
+	}
+	for _, tc := range testCases {
+		if got := s.Contains(tc.line, tc.column); got != tc.want {
+			tt.Errorf("Contains(%d, %d): got %t, want %t", tc.line, tc.column, got, tc.want)
+		}
+	}
+	if (Span{}).Contains(1, 1) {
+		tt.Errorf("Contains: got true for an unknown span")
+	}
+}
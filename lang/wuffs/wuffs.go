@@ -0,0 +1,222 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wuffs is the Go API for the whole Wuffs pipeline: parsing, checking
+// and generating C code for a Wuffs package. It does the same work as the
+// "wuffs-c gen" command, for programs such as build servers and IDEs that
+// embed Wuffs instead of running that command.
+//
+// A Compile call can be cancelled, or given a deadline, via its
+// context.Context, and can report its progress, so that those programs can
+// cleanly abort a long compilation instead of killing a process.
+package wuffs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/google/wuffs/internal/cgen"
+	"github.com/google/wuffs/lang/check"
+	"github.com/google/wuffs/lang/generate"
+	"github.com/google/wuffs/lang/parse"
+
+	a "github.com/google/wuffs/lang/ast"
+	t "github.com/google/wuffs/lang/token"
+)
+
+// Stage is a stage of the Compile pipeline.
+type Stage uint8
+
+const (
+	StageParse    = Stage(1)
+	StageCheck    = Stage(2)
+	StageGenerate = Stage(3)
+)
+
+func (s Stage) String() string {
+	switch s {
+	case StageParse:
+		return "parse"
+	case StageCheck:
+		return "check"
+	case StageGenerate:
+		return "generate"
+	}
+	return fmt.Sprintf("Stage(%d)", uint8(s))
+}
+
+// Progress is passed to Options.Progress as Compile makes progress.
+type Progress struct {
+	Stage Stage
+
+	// Done and Total count, for that Stage, the files parsed, the function
+	// bodies bounds checked or the packages generated (which is always 1).
+	Done  int
+	Total int
+
+	// Name is what was just done: a filename for StageParse, a function name,
+	// such as "decoder.decode_frame", for StageCheck and a package name for
+	// StageGenerate.
+	Name string
+}
+
+// Options are the arguments to Compile.
+type Options struct {
+	// PackageName is the name of the Wuffs package, such as "gif". For the
+	// base package, it is "base" and there are no Filenames.
+	PackageName string
+
+	// Filenames are the package's Wuffs source files.
+	Filenames []string
+
+	// Sources, if non-nil, holds the contents of some or all of the
+	// Filenames, such as an IDE's unsaved edits. Those are not read from the
+	// file system.
+	Sources map[string][]byte
+
+	// ResolveUse, if non-nil, returns the summary of a used package, such as
+	// "std/crc32", as generated by "wuffs gen". If nil, it reads that summary
+	// from the Wuffs root directory, like the "wuffs-c gen" command does.
+	ResolveUse func(usePath string) ([]byte, error)
+
+	// Check are the checker's options. Compile sets its Interrupt,
+	// FuncBodyChecked and Arena fields.
+	Check check.Options
+
+	// Autovec, Genlinenum, Hdronly and SymbolMap are the "wuffs-c gen" flags
+	// of the same names.
+	Autovec    bool
+	Genlinenum bool
+	Hdronly    bool
+	SymbolMap  bool
+
+	// NoArena is whether to allocate each AST node separately, instead of
+	// from an a.Arena that lives for just this Compile call. It is mostly
+	// useful for measuring the arena's effect.
+	NoArena bool
+
+	// Progress, if non-nil, is called as Compile makes progress. It is called
+	// on the same goroutine that called Compile.
+	Progress func(Progress)
+}
+
+// Result is the result of Compile.
+type Result struct {
+	// C is the generated C code, as "wuffs-c gen" would write to stdout.
+	C []byte
+
+	// SymbolMap is the JSON map from generated C symbols to their Wuffs
+	// declarations, if Options.SymbolMap was set.
+	SymbolMap []byte
+
+	// Warnings are the checker's non-fatal diagnostics.
+	Warnings []*check.Warning
+}
+
+// Compile parses, checks and generates C code for a Wuffs package.
+//
+// If ctx is cancelled or its deadline passes, Compile stops early and returns
+// ctx.Err(). Otherwise, errors from checking are of type *check.Error.
+func Compile(ctx context.Context, opts *Options) (*Result, error) {
+	if opts == nil {
+		return nil, fmt.Errorf("wuffs: Compile given a nil *Options")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cOpts := &cgen.Options{
+		Autovec:    opts.Autovec,
+		Genlinenum: opts.Genlinenum,
+		Hdronly:    opts.Hdronly,
+		SymbolMap:  opts.SymbolMap,
+		Interrupt:  ctx.Err,
+	}
+
+	if (opts.PackageName == "base") && (len(opts.Filenames) == 0) {
+		out, symbolMap, err := cgen.Generate("base", nil, nil, cOpts)
+		if err != nil {
+			return nil, err
+		}
+		opts.progress(StageGenerate, 1, 1, "base")
+		return &Result{C: out, SymbolMap: symbolMap}, nil
+	}
+
+	pkgName := generate.CheckPackageName(opts.PackageName)
+	if pkgName == "" {
+		return nil, fmt.Errorf("wuffs: prohibited package name %q", opts.PackageName)
+	}
+
+	arena := (*a.Arena)(nil)
+	if !opts.NoArena {
+		arena = a.NewArena()
+	}
+
+	tm := &t.Map{}
+	files := make([]*a.File, 0, len(opts.Filenames))
+	for i, filename := range opts.Filenames {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		f, err := opts.parseFile(tm, arena, filename)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		opts.progress(StageParse, i+1, len(opts.Filenames), filename)
+	}
+
+	resolveUse := opts.ResolveUse
+	if resolveUse == nil {
+		resolveUse = generate.ResolveUse
+	}
+	checkOpts := opts.Check
+	checkOpts.Interrupt = ctx.Err
+	checkOpts.Arena = arena
+	checkOpts.FuncBodyChecked = func(n *a.Func, done int, total int) {
+		opts.progress(StageCheck, done, total, n.QQID().Str(tm))
+	}
+	c, err := check.Check(tm, files, resolveUse, &checkOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	out, symbolMap, err := cgen.Generate(pkgName, tm, files, cOpts)
+	if err != nil {
+		return nil, err
+	}
+	opts.progress(StageGenerate, 1, 1, pkgName)
+	return &Result{C: out, SymbolMap: symbolMap, Warnings: c.Warnings()}, nil
+}
+
+func (opts *Options) progress(stage Stage, done int, total int, name string) {
+	if opts.Progress != nil {
+		opts.Progress(Progress{Stage: stage, Done: done, Total: total, Name: name})
+	}
+}
+
+func (opts *Options) parseFile(tm *t.Map, arena *a.Arena, filename string) (*a.File, error) {
+	src, ok := opts.Sources[filename]
+	if !ok {
+		var err error
+		if src, err = ioutil.ReadFile(filename); err != nil {
+			return nil, err
+		}
+	}
+	tokens, _, err := t.Tokenize(tm, filename, src)
+	if err != nil {
+		return nil, err
+	}
+	return parse.Parse(tm, filename, tokens, &parse.Options{Arena: arena})
+}
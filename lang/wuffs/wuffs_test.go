@@ -0,0 +1,150 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wuffs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/wuffs/lang/check"
+)
+
+const testSrc = `
+pub struct hasher?(
+	sum : base.u32,
+)
+
+pub func hasher.update!(x: base.u32) {
+	this.sum = args.x
+}
+
+pri func hasher.get() base.u32 {
+	return this.sum
+}
+`
+
+func testOptions() *Options {
+	return &Options{
+		PackageName: "demo",
+		Filenames:   []string{"demo.wuffs"},
+		Sources:     map[string][]byte{"demo.wuffs": []byte(testSrc)},
+		SymbolMap:   true,
+	}
+}
+
+func TestCompile(tt *testing.T) {
+	progress := []string(nil)
+	opts := testOptions()
+	opts.Progress = func(p Progress) {
+		progress = append(progress, fmt.Sprintf("%v %s %d %d", p.Stage, p.Name, p.Done, p.Total))
+	}
+
+	res, err := Compile(context.Background(), opts)
+	if err != nil {
+		tt.Fatalf("Compile: %v", err)
+	}
+	if !bytes.Contains(res.C, []byte("wuffs_demo__hasher__update(")) {
+		tt.Errorf("C: missing wuffs_demo__hasher__update")
+	}
+	if !bytes.Contains(res.SymbolMap, []byte(`"decl": "hasher.update"`)) {
+		tt.Errorf("SymbolMap: missing hasher.update")
+	}
+
+	got := strings.Join(progress, "\n")
+	want := strings.Join([]string{
+		"parse demo.wuffs 1 1",
+		"check hasher.update 1 2",
+		"check hasher.get 2 2",
+		"generate demo 1 1",
+	}, "\n")
+	if got != want {
+		tt.Errorf("progress:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCompileCancel(tt *testing.T) {
+	// Cancel the context after the first function body has been checked.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := testOptions()
+	opts.Progress = func(p Progress) {
+		if p.Stage == StageCheck {
+			cancel()
+		}
+	}
+
+	if _, err := Compile(ctx, opts); !errors.Is(err, context.Canceled) {
+		tt.Fatalf("Compile: got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestCompileCheckError(tt *testing.T) {
+	opts := testOptions()
+	opts.Sources["demo.wuffs"] = []byte(strings.Replace(testSrc, "args.x", "args.y", 1))
+
+	_, err := Compile(context.Background(), opts)
+	if _, ok := err.(*check.Error); !ok {
+		tt.Fatalf("Compile: got %v (%T), want a *check.Error", err, err)
+	}
+}
+
+func BenchmarkCompileArena(b *testing.B)   { benchmarkCompile(b, false) }
+func BenchmarkCompileNoArena(b *testing.B) { benchmarkCompile(b, true) }
+
+// benchmarkCompile compiles std/deflate, the largest package that does not use
+// another package. Along with the allocations, it reports the garbage
+// collector's pause time and number of cycles, per op.
+func benchmarkCompile(b *testing.B, noArena bool) {
+	filenames, err := filepath.Glob("../../std/deflate/*.wuffs")
+	if err != nil {
+		b.Fatal(err)
+	} else if len(filenames) == 0 {
+		b.Skip("no std/deflate source files")
+	}
+	opts := &Options{
+		PackageName: "deflate",
+		Filenames:   filenames,
+		Sources:     map[string][]byte{},
+		NoArena:     noArena,
+	}
+	for _, filename := range filenames {
+		if opts.Sources[filename], err = ioutil.ReadFile(filename); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportAllocs()
+	runtime.GC()
+	m0 := runtime.MemStats{}
+	runtime.ReadMemStats(&m0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Compile(context.Background(), opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	m1 := runtime.MemStats{}
+	runtime.ReadMemStats(&m1)
+	b.ReportMetric(float64(m1.PauseTotalNs-m0.PauseTotalNs)/float64(b.N), "gc-pause-ns/op")
+	b.ReportMetric(float64(m1.NumGC-m0.NumGC)/float64(b.N), "gcs/op")
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interval
+
+// This file provides a relational domain, to complement the (non-relational)
+// IntRange domain: a conjunction of difference constraints "x - y <= c", also
+// known as a difference bound matrix.
+//
+// Bounding each variable separately cannot combine "i <= j" and "j < n" into
+// "i < n", unless the bounds on i, j and n happen to be tight enough. Tracking
+// the bounds on their differences can: "i - j <= 0" and "j - n <= -1" imply
+// "i - n <= -1".
+
+import (
+	"math/big"
+)
+
+// DiffBounds is a conjunction of difference constraints "x - y <= c", over
+// variables numbered 0, 1, 2, etc. A constraint on a single variable, such as
+// "x <= 10", can be expressed by reserving a variable, conventionally number
+// 0, to mean the constant zero: "x - 0 <= 10".
+//
+// The zero value is valid and has no constraints.
+type DiffBounds struct {
+	// upper[x][y] is the smallest c known so far such that "x - y <= c", or
+	// nil if there is no such c.
+	upper [][]*big.Int
+
+	// closed is whether upper is transitively closed, so that upper[x][y] is
+	// the smallest c implied by all of the constraints.
+	closed bool
+
+	// inconsistent is whether the constraints cannot all be satisfied. It is
+	// only valid if closed.
+	inconsistent bool
+}
+
+// NumVars returns one more than the largest variable number passed to
+// Constrain, or zero if Constrain has not been called.
+func (d *DiffBounds) NumVars() int { return len(d.upper) }
+
+func (d *DiffBounds) grow(n int) {
+	for len(d.upper) < n {
+		d.upper = append(d.upper, nil)
+	}
+	for i := range d.upper {
+		for len(d.upper[i]) < n {
+			d.upper[i] = append(d.upper[i], nil)
+		}
+	}
+}
+
+// Constrain adds the constraint "x - y <= c". The variable numbers must be
+// non-negative.
+func (d *DiffBounds) Constrain(x int, y int, c *big.Int) {
+	if (x < 0) || (y < 0) {
+		panic("interval: negative DiffBounds variable")
+	}
+	n := x + 1
+	if n <= y {
+		n = y + 1
+	}
+	d.grow(n)
+	if u := d.upper[x][y]; (u == nil) || (u.Cmp(c) > 0) {
+		d.upper[x][y] = bigIntNewSet(c)
+		d.closed = false
+	}
+}
+
+// close applies the Floyd-Warshall algorithm: "x - k <= c0" and "k - y <= c1"
+// imply "x - y <= c0 + c1".
+func (d *DiffBounds) close() {
+	if d.closed {
+		return
+	}
+	d.closed = true
+	n := len(d.upper)
+	for k := 0; k < n; k++ {
+		for x := 0; x < n; x++ {
+			xk := d.upper[x][k]
+			if xk == nil {
+				continue
+			}
+			for y := 0; y < n; y++ {
+				ky := d.upper[k][y]
+				if ky == nil {
+					continue
+				}
+				if xy := d.upper[x][y]; xy == nil {
+					d.upper[x][y] = big.NewInt(0).Add(xk, ky)
+				} else if s := big.NewInt(0).Add(xk, ky); xy.Cmp(s) > 0 {
+					d.upper[x][y] = s
+				}
+			}
+		}
+	}
+
+	d.inconsistent = false
+	for x := 0; x < n; x++ {
+		if u := d.upper[x][x]; (u != nil) && (u.Sign() < 0) {
+			d.inconsistent = true
+			break
+		}
+	}
+}
+
+// Consistent returns whether the constraints can all be satisfied. They
+// cannot if they imply "x - x <= c" for a negative c.
+func (d *DiffBounds) Consistent() bool {
+	d.close()
+	return !d.inconsistent
+}
+
+// Upper returns the smallest c such that the constraints imply "x - y <= c",
+// or nil if they imply no such c. The result is meaningless (but not nil) if
+// the constraints are not Consistent. The caller should not modify the
+// returned *big.Int.
+func (d *DiffBounds) Upper(x int, y int) *big.Int {
+	d.close()
+	if x == y {
+		if d.inconsistent {
+			return big.NewInt(-1)
+		}
+		return big.NewInt(0)
+	} else if (x < 0) || (y < 0) || (x >= len(d.upper)) || (y >= len(d.upper)) {
+		return nil
+	}
+	return d.upper[x][y]
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interval
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func TestDiffBoundsMotivatingExample(tt *testing.T) {
+	const (
+		i = 1
+		j = 2
+		n = 3
+	)
+	d := DiffBounds{}
+	// i <= j, i.e. i - j <= 0.
+	d.Constrain(i, j, big.NewInt(0))
+	// j < n, i.e. j - n <= -1.
+	d.Constrain(j, n, big.NewInt(-1))
+
+	if !d.Consistent() {
+		tt.Fatalf("Consistent: got false, want true")
+	}
+	if got := d.Upper(i, n); (got == nil) || (got.Cmp(big.NewInt(-1)) != 0) {
+		tt.Fatalf("Upper(i, n): got %v, want -1", got)
+	}
+	if got := d.Upper(n, i); got != nil {
+		tt.Fatalf("Upper(n, i): got %v, want nil", got)
+	}
+
+	// n <= i + 0 contradicts i < n.
+	d.Constrain(n, i, big.NewInt(0))
+	if d.Consistent() {
+		tt.Fatalf("Consistent: got true, want false")
+	}
+}
+
+// TestDiffBoundsBruteForce checks, for random constraints on a few small
+// variables, that DiffBounds agrees with trying every possible assignment.
+func TestDiffBoundsBruteForce(tt *testing.T) {
+	const (
+		numVars = 4 // Not counting the zero variable.
+		radius  = 3
+		width   = (2 * radius) + 1
+	)
+	rng := rand.New(rand.NewSource(1))
+
+	for trial := 0; trial < 200; trial++ {
+		d := DiffBounds{}
+		type constraint struct{ x, y, c int }
+		constraints := []constraint(nil)
+		// Every variable is in the range [-radius ..= +radius].
+		for v := 1; v <= numVars; v++ {
+			constraints = append(constraints, constraint{v, 0, radius}, constraint{0, v, radius})
+		}
+		for k := rng.Intn(6); k > 0; k-- {
+			constraints = append(constraints,
+				constraint{rng.Intn(numVars + 1), rng.Intn(numVars + 1), rng.Intn(width) - radius})
+		}
+		for _, c := range constraints {
+			d.Constrain(c.x, c.y, big.NewInt(int64(c.c)))
+		}
+
+		// upper[x][y] is the largest (x - y) over all satisfying assignments.
+		found := false
+		upper := [numVars + 1][numVars + 1]int{}
+		vals := [numVars + 1]int{}
+		total := 1
+		for v := 0; v < numVars; v++ {
+			total *= width
+		}
+	loop:
+		for a := 0; a < total; a++ {
+			for v, r := 1, a; v <= numVars; v, r = v+1, r/width {
+				vals[v] = (r % width) - radius
+			}
+			for _, c := range constraints {
+				if vals[c.x]-vals[c.y] > c.c {
+					continue loop
+				}
+			}
+			for x := range vals {
+				for y := range vals {
+					if diff := vals[x] - vals[y]; !found || (upper[x][y] < diff) {
+						upper[x][y] = diff
+					}
+				}
+			}
+			found = true
+		}
+
+		if got := d.Consistent(); got != found {
+			tt.Fatalf("trial %d: Consistent: got %t, want %t", trial, got, found)
+		} else if !found {
+			continue
+		}
+		for x := range vals {
+			for y := range vals {
+				if got := d.Upper(x, y); (got == nil) || (got.Int64() != int64(upper[x][y])) {
+					tt.Fatalf("trial %d: Upper(%d, %d): got %v, want %d", trial, x, y, got, upper[x][y])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interval
+
+// This file provides wrap-around (circular) intervals, for modular arithmetic
+// such as C's unsigned integer arithmetic.
+//
+// An IntRange cannot represent "x is in [250 ..= 5] mod 256", meaning that x
+// is one of 250, 251, ..., 255, 0, 1, ..., 5. Its tightest IntRange is [0 ..=
+// 255], so that computing (x + 10) mod 256 from that IntRange gives [0 ..=
+// 255] again, instead of the tighter [4 ..= 15].
+
+import (
+	"math/big"
+)
+
+// WrapRange is a circular interval of the integers modulo (1 << Bits). Its
+// elements are those visited when starting from the first element and
+// repeatedly adding one (wrapping around from ((1 << Bits) - 1) to 0) until
+// reaching the last element.
+//
+// For example, with 8 Bits, [250 ..= 5] contains 12 elements and [5 ..= 250]
+// contains 246 elements.
+//
+// The zero value is an empty interval.
+type WrapRange struct {
+	// lo and hi are both nil (for an empty interval) or both in the range [0
+	// ..= ((1 << bits) - 1)]. A full interval has (lo == 0) and (hi == m - 1),
+	// where m is (1 << bits).
+	lo   *big.Int
+	hi   *big.Int
+	bits uint32
+}
+
+// MakeWrapRange returns the WrapRange, modulo (1 << bits), of x's elements.
+// It is full if x has an infinite bound or at least (1 << bits) elements. The
+// bits must be positive.
+func MakeWrapRange(x IntRange, bits uint32) WrapRange {
+	if x.Empty() {
+		return WrapRange{bits: bits}
+	}
+	if (x[0] == nil) || (x[1] == nil) {
+		return makeFullWrapRange(bits)
+	}
+	n := big.NewInt(0).Sub(x[1], x[0])
+	return makeWrapRangeFromCount(x[0], n.Add(n, one), wrapModulus(bits), bits)
+}
+
+func wrapModulus(bits uint32) *big.Int {
+	return big.NewInt(0).Lsh(one, uint(bits))
+}
+
+func makeFullWrapRange(bits uint32) WrapRange {
+	m := wrapModulus(bits)
+	return WrapRange{big.NewInt(0), m.Sub(m, one), bits}
+}
+
+// makeWrapRangeFromCount returns the n elements starting at lo, modulo m.
+func makeWrapRangeFromCount(lo *big.Int, n *big.Int, m *big.Int, bits uint32) WrapRange {
+	if n.Cmp(m) >= 0 {
+		return makeFullWrapRange(bits)
+	}
+	hi := big.NewInt(0).Add(lo, n)
+	hi.Sub(hi, one)
+	return WrapRange{
+		big.NewInt(0).Mod(lo, m),
+		hi.Mod(hi, m),
+		bits,
+	}
+}
+
+// String returns a string representation of x.
+func (x WrapRange) String() string {
+	m := wrapModulus(x.bits).String()
+	if x.Empty() {
+		return "[empty] mod " + m
+	}
+	return "[" + x.lo.String() + " ..= " + x.hi.String() + "] mod " + m
+}
+
+// Bits returns the number of bits of x's modulus.
+func (x WrapRange) Bits() uint32 { return x.bits }
+
+// Empty returns whether x contains no elements.
+func (x WrapRange) Empty() bool { return x.lo == nil }
+
+// Full returns whether x contains every element.
+func (x WrapRange) Full() bool {
+	if x.Empty() {
+		return false
+	}
+	m := wrapModulus(x.bits)
+	return x.offset(x.hi).Cmp(m.Sub(m, one)) == 0
+}
+
+// count returns the number of x's elements.
+func (x WrapRange) count() *big.Int {
+	if x.Empty() {
+		return big.NewInt(0)
+	}
+	n := x.offset(x.hi)
+	return n.Add(n, one)
+}
+
+// offset returns how far i (which is in the range [0 ..= m - 1]) is from x's
+// first element, moving forwards, modulo m.
+func (x WrapRange) offset(i *big.Int) *big.Int {
+	z := big.NewInt(0).Sub(i, x.lo)
+	return z.Mod(z, wrapModulus(x.bits))
+}
+
+// ContainsInt returns whether x contains i, after reducing i modulo (1 <<
+// Bits).
+func (x WrapRange) ContainsInt(i *big.Int) bool {
+	if x.Empty() {
+		return false
+	}
+	i = big.NewInt(0).Mod(i, wrapModulus(x.bits))
+	return x.offset(i).Cmp(x.offset(x.hi)) <= 0
+}
+
+// ContainsWrapRange returns whether x contains every element of y. The two
+// must have the same Bits.
+func (x WrapRange) ContainsWrapRange(y WrapRange) bool {
+	if y.Empty() {
+		return true
+	} else if x.Empty() {
+		return false
+	} else if x.Full() {
+		return true
+	} else if y.Full() {
+		return false
+	}
+	return x.ContainsInt(y.lo) && x.ContainsInt(y.hi) &&
+		(x.offset(y.lo).Cmp(x.offset(y.hi)) <= 0)
+}
+
+// Unite returns the smallest WrapRange that contains every element of x and
+// y. The two must have the same Bits.
+//
+// Unlike IntRange.Unite, there can be two candidates, going either way around
+// the circle, and it picks the one with fewer elements.
+func (x WrapRange) Unite(y WrapRange) (z WrapRange) {
+	if x.Empty() {
+		return y
+	} else if y.Empty() || x.ContainsWrapRange(y) {
+		return x
+	} else if y.ContainsWrapRange(x) {
+		return y
+	}
+	z = makeFullWrapRange(x.bits)
+	for _, c := range [2]WrapRange{
+		{x.lo, y.hi, x.bits},
+		{y.lo, x.hi, x.bits},
+	} {
+		if c.ContainsWrapRange(x) && c.ContainsWrapRange(y) && (c.count().Cmp(z.count()) < 0) {
+			z = c
+		}
+	}
+	return z
+}
+
+// Add returns z = (x + y) mod (1 << Bits). The two must have the same Bits.
+func (x WrapRange) Add(y WrapRange) (z WrapRange) {
+	if x.Empty() || y.Empty() {
+		return WrapRange{bits: x.bits}
+	}
+	lo := big.NewInt(0).Add(x.lo, y.lo)
+	n := big.NewInt(0).Add(x.count(), y.count())
+	return makeWrapRangeFromCount(lo, n.Sub(n, one), wrapModulus(x.bits), x.bits)
+}
+
+// Sub returns z = (x - y) mod (1 << Bits). The two must have the same Bits.
+func (x WrapRange) Sub(y WrapRange) (z WrapRange) {
+	if x.Empty() || y.Empty() {
+		return WrapRange{bits: x.bits}
+	}
+	lo := big.NewInt(0).Sub(x.lo, y.hi)
+	n := big.NewInt(0).Add(x.count(), y.count())
+	return makeWrapRangeFromCount(lo, n.Sub(n, one), wrapModulus(x.bits), x.bits)
+}
+
+// And returns z = x & y, treating the elements as unsigned Bits-bit integers.
+// The two must have the same Bits.
+func (x WrapRange) And(y WrapRange) (z WrapRange) {
+	return x.bitwise(y, IntRange.And)
+}
+
+// Or returns z = x | y, treating the elements as unsigned Bits-bit integers.
+// The two must have the same Bits.
+func (x WrapRange) Or(y WrapRange) (z WrapRange) {
+	return x.bitwise(y, IntRange.Or)
+}
+
+// bitwise applies f, an IntRange bitwise op, to every pair of x's and y's
+// non-wrapping pieces, uniting the results.
+func (x WrapRange) bitwise(y WrapRange, f func(IntRange, IntRange) IntRange) (z WrapRange) {
+	z = WrapRange{bits: x.bits}
+	for _, xp := range x.pieces() {
+		for _, yp := range y.pieces() {
+			z = z.Unite(MakeWrapRange(f(xp, yp), x.bits))
+		}
+	}
+	return z
+}
+
+// pieces splits x into at most two non-wrapping IntRange's, all of whose
+// elements are in the range [0 ..= m - 1].
+func (x WrapRange) pieces() []IntRange {
+	if x.Empty() {
+		return nil
+	} else if x.lo.Cmp(x.hi) <= 0 {
+		return []IntRange{{x.lo, x.hi}}
+	}
+	m := wrapModulus(x.bits)
+	return []IntRange{
+		{x.lo, m.Sub(m, one)},
+		{big.NewInt(0), x.hi},
+	}
+}
+
+// UnsignedIntRange returns the smallest IntRange that contains x's elements,
+// as unsigned integers in the range [0 ..= (1 << Bits) - 1].
+func (x WrapRange) UnsignedIntRange() IntRange {
+	if x.Empty() {
+		return makeEmptyRange()
+	} else if x.lo.Cmp(x.hi) <= 0 {
+		return IntRange{bigIntNewSet(x.lo), bigIntNewSet(x.hi)}
+	}
+	m := wrapModulus(x.bits)
+	return IntRange{big.NewInt(0), m.Sub(m, one)}
+}
+
+// SignedIntRange returns the smallest IntRange that contains x's elements, as
+// two's complement signed integers in the range [-(1 << (Bits-1)) ..= (1 <<
+// (Bits-1)) - 1].
+func (x WrapRange) SignedIntRange() IntRange {
+	if x.Empty() {
+		return makeEmptyRange()
+	}
+	half := big.NewInt(0).Lsh(one, uint(x.bits-1))
+	// The signed integers wrap around between (half - 1) and half.
+	if x.ContainsInt(half) && (x.lo.Cmp(half) != 0) {
+		return IntRange{big.NewInt(0).Neg(half), half.Sub(half, one)}
+	}
+	toSigned := func(i *big.Int) *big.Int {
+		if i.Cmp(half) >= 0 {
+			return big.NewInt(0).Sub(i, wrapModulus(x.bits))
+		}
+		return bigIntNewSet(i)
+	}
+	return IntRange{toSigned(x.lo), toSigned(x.hi)}
+}
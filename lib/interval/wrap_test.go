@@ -0,0 +1,166 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interval
+
+import (
+	"math/big"
+	"testing"
+)
+
+func makeWrapRange8(lo int64, hi int64) WrapRange {
+	return WrapRange{big.NewInt(lo), big.NewInt(hi), 8}
+}
+
+func TestWrapRangeMotivatingExample(tt *testing.T) {
+	x := makeWrapRange8(250, 5)
+	ten := MakeWrapRange(IntRange{big.NewInt(10), big.NewInt(10)}, 8)
+	if got, want := x.Add(ten).String(), "[4 ..= 15] mod 256"; got != want {
+		tt.Fatalf("Add: got %q, want %q", got, want)
+	}
+	if got, want := x.UnsignedIntRange().String(), "[0 ..= 255]"; got != want {
+		tt.Fatalf("UnsignedIntRange: got %q, want %q", got, want)
+	}
+	if got, want := x.SignedIntRange().String(), "[-6 ..= 5]"; got != want {
+		tt.Fatalf("SignedIntRange: got %q, want %q", got, want)
+	}
+}
+
+func TestMakeWrapRange(tt *testing.T) {
+	testCases := []struct {
+		x    IntRange
+		want string
+	}{
+		{IntRange{big.NewInt(3), big.NewInt(9)}, "[3 ..= 9] mod 256"},
+		{IntRange{big.NewInt(-6), big.NewInt(5)}, "[250 ..= 5] mod 256"},
+		{IntRange{big.NewInt(256), big.NewInt(261)}, "[0 ..= 5] mod 256"},
+		{IntRange{big.NewInt(0), big.NewInt(255)}, "[0 ..= 255] mod 256"},
+		{IntRange{big.NewInt(7), big.NewInt(262)}, "[0 ..= 255] mod 256"},
+		{IntRange{nil, big.NewInt(0)}, "[0 ..= 255] mod 256"},
+		{IntRange{big.NewInt(1), big.NewInt(0)}, "[empty] mod 256"},
+	}
+	for _, tc := range testCases {
+		if got := MakeWrapRange(tc.x, 8).String(); got != tc.want {
+			tt.Errorf("%v: got %q, want %q", tc.x, got, tc.want)
+		}
+	}
+}
+
+func TestWrapRangeUnite(tt *testing.T) {
+	testCases := []struct {
+		x, y WrapRange
+		want string
+	}{
+		{makeWrapRange8(250, 255), makeWrapRange8(0, 5), "[250 ..= 5] mod 256"},
+		{makeWrapRange8(0, 5), makeWrapRange8(250, 255), "[250 ..= 5] mod 256"},
+		{makeWrapRange8(0, 5), makeWrapRange8(10, 20), "[0 ..= 20] mod 256"},
+		{makeWrapRange8(250, 5), makeWrapRange8(3, 4), "[250 ..= 5] mod 256"},
+		{makeWrapRange8(250, 5), makeWrapRange8(100, 120), "[250 ..= 120] mod 256"},
+		{makeWrapRange8(0, 100), makeWrapRange8(128, 228), "[0 ..= 228] mod 256"},
+		{makeWrapRange8(200, 100), makeWrapRange8(90, 210), "[0 ..= 255] mod 256"},
+	}
+	for _, tc := range testCases {
+		if got := tc.x.Unite(tc.y).String(); got != tc.want {
+			tt.Errorf("%v ∪ %v: got %q, want %q", tc.x, tc.y, got, tc.want)
+		}
+	}
+}
+
+// TestWrapRangeBruteForce checks, for every pair of 3-bit WrapRange's, that
+// each op's result contains every element of the brute force result, and
+// that Add and Sub results have no extra elements.
+func TestWrapRangeBruteForce(tt *testing.T) {
+	const bits = 3
+	const m = 1 << bits
+
+	elements := func(x WrapRange) (ret []int64) {
+		for i := int64(0); i < m; i++ {
+			if x.ContainsInt(big.NewInt(i)) {
+				ret = append(ret, i)
+			}
+		}
+		return ret
+	}
+
+	ops := []struct {
+		name  string
+		f     func(WrapRange, WrapRange) WrapRange
+		g     func(int64, int64) int64
+		exact bool
+	}{
+		{"+", WrapRange.Add, func(i, j int64) int64 { return (i + j) & (m - 1) }, true},
+		{"-", WrapRange.Sub, func(i, j int64) int64 { return (i - j) & (m - 1) }, true},
+		{"&", WrapRange.And, func(i, j int64) int64 { return i & j }, false},
+		{"|", WrapRange.Or, func(i, j int64) int64 { return i | j }, false},
+		{"∪", WrapRange.Unite, nil, false},
+	}
+
+	for xlo := int64(0); xlo < m; xlo++ {
+		for xhi := int64(0); xhi < m; xhi++ {
+			x := WrapRange{big.NewInt(xlo), big.NewInt(xhi), bits}
+			xs := elements(x)
+			for ylo := int64(0); ylo < m; ylo++ {
+				for yhi := int64(0); yhi < m; yhi++ {
+					y := WrapRange{big.NewInt(ylo), big.NewInt(yhi), bits}
+					ys := elements(y)
+
+					for _, op := range ops {
+						z := op.f(x, y)
+						brute := map[int64]bool{}
+						if op.g == nil {
+							for _, i := range xs {
+								brute[i] = true
+							}
+							for _, j := range ys {
+								brute[j] = true
+							}
+						} else {
+							for _, i := range xs {
+								for _, j := range ys {
+									brute[op.g(i, j)] = true
+								}
+							}
+						}
+						for k := range brute {
+							if !z.ContainsInt(big.NewInt(k)) {
+								tt.Fatalf("%v %s %v: got %v, which does not contain %d", x, op.name, y, z, k)
+							}
+						}
+						if op.exact && (int64(len(elements(z))) != int64(len(brute))) {
+							tt.Fatalf("%v %s %v: got %v, want %d elements", x, op.name, y, z, len(brute))
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestWrapRangeSignedIntRange(tt *testing.T) {
+	testCases := []struct {
+		x    WrapRange
+		want string
+	}{
+		{makeWrapRange8(0, 127), "[0 ..= 127]"},
+		{makeWrapRange8(128, 255), "[-128 ..= -1]"},
+		{makeWrapRange8(128, 127), "[-128 ..= 127]"},
+		{makeWrapRange8(120, 130), "[-128 ..= 127]"},
+		{makeWrapRange8(200, 10), "[-56 ..= 10]"},
+	}
+	for _, tc := range testCases {
+		if got := tc.x.SignedIntRange().String(); got != tc.want {
+			tt.Errorf("%v: got %q, want %q", tc.x, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2020 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rac
+
+const (
+	numWBuffersPerWorker = 2
+)
+
+// wWork is a unit of work for concurrent writing: one chunk's uncompressed
+// bytes, sent by the concWriter to a Worker, and the result of compressing
+// them, sent back.
+type wWork struct {
+	// dSize is the chunk's size in DSpace. It can be larger than
+	// len(uncompressed), as trailing zeroes are implicit.
+	dSize uint64
+
+	// uncompressed is a copy of the chunk's (explicit) bytes. The Writer's own
+	// buffer, and the slice passed to Writer.Write, are not retained.
+	uncompressed []byte
+
+	// These fields are set by the Worker goroutine. compressed is a copy of
+	// what CodecWriter.Compress returned, as that can be re-used (and
+	// overwritten) by the next Compress call.
+	codec          Codec
+	compressed     []byte
+	index2, index3 int
+	err            error
+
+	// resc is where the Worker sends the completed work. It has a buffer of
+	// 1, so that a Worker never waits for the concWriter.
+	resc chan *wWork
+}
+
+// concWriter co-ordinates multiple Worker goroutines compressing a Writer's
+// chunks.
+//
+// The Writer's goroutine still decides the chunk boundaries, uses shared
+// resources and writes the compressed chunks, in DSpace order, so that the
+// output is identical to a non-concurrent Writer's. Only the
+// CodecWriter.Compress calls run concurrently.
+type concWriter struct {
+	// reqc is the Work-Request channel, from the concWriter to the Workers.
+	reqc chan *wWork
+
+	// pending holds the works sent to the Workers, in DSpace order. Works may
+	// complete out of order, but they are written in this order.
+	pending []*wWork
+
+	// recycled holds completed works, whose buffers can be re-used.
+	recycled []*wWork
+
+	// maxPending bounds len(pending), and therefore the memory used: roughly
+	// maxPending times the sum of the uncompressed and compressed chunk size.
+	maxPending int
+}
+
+func (c *concWriter) initialize(racWriter *Writer) {
+	if (racWriter.Concurrency <= 1) || (racWriter.dChunkSize == 0) {
+		return
+	}
+	numWorkers := racWriter.Concurrency
+	if numWorkers > 65536 {
+		numWorkers = 65536
+	}
+	c.maxPending = numWorkers * numWBuffersPerWorker
+	c.reqc = make(chan *wWork, c.maxPending)
+
+	for i := 0; i < numWorkers; i++ {
+		go runWWorker(c.reqc, racWriter.CodecWriter.Clone(), racWriter.ResourcesData)
+	}
+}
+
+func (c *concWriter) ready() bool {
+	return c.reqc != nil
+}
+
+// close shuts down the Workers. Any pending works are discarded.
+func (c *concWriter) close() {
+	if c.reqc != nil {
+		close(c.reqc)
+		c.reqc = nil
+	}
+	c.pending = nil
+	c.recycled = nil
+}
+
+// submit sends the concatenation of p and q, a chunk of size dSize in DSpace,
+// to the Workers. If there are already maxPending works in flight, it first
+// waits for, and writes, the oldest one.
+func (c *concWriter) submit(racWriter *Writer, dSize uint64, p []byte, q []byte) error {
+	if len(c.pending) >= c.maxPending {
+		if err := c.writeOldest(racWriter); err != nil {
+			return err
+		}
+	}
+
+	work := (*wWork)(nil)
+	if n := len(c.recycled); n > 0 {
+		work, c.recycled = c.recycled[n-1], c.recycled[:n-1]
+	} else {
+		work = &wWork{resc: make(chan *wWork, 1)}
+	}
+	work.dSize = dSize
+	work.uncompressed = append(append(work.uncompressed[:0], p...), q...)
+
+	c.pending = append(c.pending, work)
+	// This never blocks, as reqc's buffer holds maxPending works.
+	c.reqc <- work
+	return nil
+}
+
+// flush waits for, and writes, every pending work.
+func (c *concWriter) flush(racWriter *Writer) error {
+	for len(c.pending) > 0 {
+		if err := c.writeOldest(racWriter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *concWriter) writeOldest(racWriter *Writer) error {
+	work := <-c.pending[0].resc
+	n := copy(c.pending, c.pending[1:])
+	c.pending[n] = nil
+	c.pending = c.pending[:n]
+	defer func() {
+		c.recycled = append(c.recycled, work)
+	}()
+
+	if work.err != nil {
+		racWriter.err = work.err
+		return work.err
+	}
+	res2, err := racWriter.useResource(work.index2)
+	if err != nil {
+		return err
+	}
+	res3, err := racWriter.useResource(work.index3)
+	if err != nil {
+		return err
+	}
+	if err := racWriter.chunkWriter.AddChunk(work.dSize, work.codec, work.compressed, res2, res3); err != nil {
+		racWriter.err = err
+		return err
+	}
+	return nil
+}
+
+func runWWorker(reqc <-chan *wWork, codecWriter CodecWriter, resourcesData [][]byte) {
+	defer codecWriter.Close()
+
+	for work := range reqc {
+		codec, compressed, index2, index3, err :=
+			codecWriter.Compress(work.uncompressed, nil, resourcesData)
+		work.codec = codec
+		work.compressed = append(work.compressed[:0], compressed...)
+		work.index2 = index2
+		work.index3 = index3
+		work.err = err
+		work.resc <- work
+	}
+}
@@ -311,6 +311,23 @@ type Writer struct {
 	// https://github.com/google/brotli/blob/master/research/dictionary_generator.cc
 	ResourcesData [][]byte
 
+	// Concurrency is how many worker goroutines are used to compress RAC
+	// chunks. Bigger values often lead to faster throughput, up to a
+	// hardware-dependent point, but also larger memory requirements: up to
+	// 2*Concurrency chunks can be buffered at any one time.
+	//
+	// The output does not depend on Concurrency: it is the same as a
+	// non-concurrent Writer's output.
+	//
+	// Concurrency only applies when chunks have a fixed DChunkSize (including
+	// the default DChunkSize). With a CChunkSize, each chunk's DSpace size
+	// depends on compressing it, so chunks are compressed one at a time.
+	//
+	// Non-positive values (including zero) mean a non-concurrent
+	// (single-goroutine) writer. If positive, Close must be called to stop the
+	// worker goroutines, even if Write returned an error.
+	Concurrency int
+
 	// resourcesIDs is the OptResource for each ResourcesData element. Zero
 	// means that corresponding resource is not yet used (and not yet written
 	// to the RAC file).
@@ -329,6 +346,9 @@ type Writer struct {
 	// chunkWriter is the low-level chunk writer.
 	chunkWriter ChunkWriter
 
+	// concWriter co-ordinates the worker goroutines, if Concurrency > 1.
+	concWriter concWriter
+
 	// uncompressed are the uncompressed bytes that have been given to this
 	// (via the Write method) but not yet compressed as a chunk.
 	uncompressed writeBuffer
@@ -374,6 +394,7 @@ func (w *Writer) initialize() error {
 	w.chunkWriter.IndexLocation = w.IndexLocation
 	w.chunkWriter.TempFile = w.TempFile
 	w.chunkWriter.CPageSize = w.CPageSize
+	w.concWriter.initialize(w)
 	return nil
 }
 
@@ -444,6 +465,14 @@ func (w *Writer) writeDChunks(eof bool) error {
 			peek0 = stripTrailingZeroes(peek0)
 		}
 
+		if w.concWriter.ready() {
+			if err := w.concWriter.submit(w, dSize, peek0, peek1); err != nil {
+				return err
+			}
+			w.uncompressed.advance(dSize)
+			continue
+		}
+
 		codec, cBytes, index2, index3, err :=
 			w.CodecWriter.Compress(peek0, peek1, w.ResourcesData)
 		if err != nil {
@@ -587,6 +616,10 @@ func (w *Writer) Close() error {
 	if w.err == nil {
 		w.err = w.write(true)
 	}
+	if w.err == nil {
+		w.err = w.concWriter.flush(w)
+	}
+	w.concWriter.close()
 	if w.err == nil {
 		w.err = w.chunkWriter.Close()
 	}
@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
+	"io/ioutil"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -58,7 +60,7 @@ const (
 		"\x66"
 )
 
-func racCompress(original []byte, cChunkSize uint64, dChunkSize uint64, resourcesData [][]byte) ([]byte, error) {
+func racCompress(original []byte, cChunkSize uint64, dChunkSize uint64, resourcesData [][]byte, concurrency int) ([]byte, error) {
 	buf := &bytes.Buffer{}
 	w := &rac.Writer{
 		Writer:        buf,
@@ -66,6 +68,7 @@ func racCompress(original []byte, cChunkSize uint64, dChunkSize uint64, resource
 		CChunkSize:    cChunkSize,
 		DChunkSize:    dChunkSize,
 		ResourcesData: resourcesData,
+		Concurrency:   concurrency,
 	}
 	if _, err := w.Write(original); err != nil {
 		return nil, fmt.Errorf("Write: %v", err)
@@ -197,7 +200,7 @@ func TestZeroedBytes(tt *testing.T) {
 			dChunkSize = 8
 		}
 
-		compressed, err := racCompress(original, cChunkSize, dChunkSize, nil)
+		compressed, err := racCompress(original, cChunkSize, dChunkSize, nil, 0)
 		if err != nil {
 			tt.Fatalf("i=%d: racCompress: %v", i, err)
 		}
@@ -256,7 +259,7 @@ func TestSharedDictionary(tt *testing.T) {
 		}
 
 		// Compress.
-		compressed, err := racCompress(original, 0, n, resourcesData)
+		compressed, err := racCompress(original, 0, n, resourcesData, 0)
 		if err != nil {
 			tt.Fatalf("i=%d: racCompress: %v", i, err)
 		}
@@ -283,6 +286,46 @@ func TestSharedDictionary(tt *testing.T) {
 	}
 }
 
+func TestConcurrentWriter(tt *testing.T) {
+	// Make some data that spans many chunks, some of which are all zeroes
+	// or end with zeroes. Also make a shared dictionary that only some chunks
+	// use.
+	const n = 1000
+	dictionary := []byte(decodedSheep)
+	original := []byte(nil)
+	for i := 0; len(original) < 100*n; i++ {
+		switch i % 4 {
+		case 0:
+			original = append(original, dictionary...)
+		case 1:
+			original = append(original, make([]byte, n)...)
+		default:
+			original = append(original, fmt.Sprintf("%d sheep.\n", i*i)...)
+		}
+	}
+
+	want, err := racCompress(original, 0, n, [][]byte{dictionary}, 0)
+	if err != nil {
+		tt.Fatalf("racCompress: %v", err)
+	}
+	for _, concurrency := range []int{1, 2, 3, 16} {
+		got, err := racCompress(original, 0, n, [][]byte{dictionary}, concurrency)
+		if err != nil {
+			tt.Fatalf("concurrency=%d: racCompress: %v", concurrency, err)
+		}
+		if !bytes.Equal(got, want) {
+			tt.Fatalf("concurrency=%d: output differs from the non-concurrent output", concurrency)
+		}
+		decompressed, err := racDecompress(got, 0)
+		if err != nil {
+			tt.Fatalf("concurrency=%d: racDecompress: %v", concurrency, err)
+		}
+		if !bytes.Equal(decompressed, original) {
+			tt.Fatalf("concurrency=%d: racDecompress: round trip did not match original", concurrency)
+		}
+	}
+}
+
 // rsSansReadAt wraps a strings.Reader to have only Read and Seek methods.
 type rsSansReadAt struct {
 	r *strings.Reader
@@ -328,3 +371,64 @@ func TestReadSeekerSansReadAt(tt *testing.T) {
 func TestReadSeekerWithReadAt(tt *testing.T) {
 	testReadSeeker(tt, &rsWithReadAt{strings.NewReader(encodedSheep)})
 }
+
+// sheepReader generates n bytes of text, like decodedSheep but with many more
+// (pseudo-randomly numbered) sheep.
+type sheepReader struct {
+	n    int64
+	x    uint32
+	line []byte
+	buf  [32]byte
+}
+
+func (r *sheepReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	n := 0
+	for n < len(p) {
+		if len(r.line) == 0 {
+			// A linear congruential generator picks the numbers, so that the
+			// text is neither trivially compressible nor incompressible.
+			r.x = (r.x * 1664525) + 1013904223
+			r.line = append(strconv.AppendUint(r.buf[:0], uint64(r.x>>8), 10), " sheep.\n"...)
+		}
+		m := copy(p[n:], r.line)
+		r.line = r.line[m:]
+		n += m
+	}
+	r.n -= int64(n)
+	return n, nil
+}
+
+// benchmarkWriter compresses size bytes of sheepReader text. That input is
+// streamed, not held in memory, and the Writer buffers a bounded number of
+// chunks, so that size can be multiple GiB.
+func benchmarkWriter(b *testing.B, size int64, concurrency int) {
+	b.SetBytes(size)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w := &rac.Writer{
+			Writer:      ioutil.Discard,
+			CodecWriter: &CodecWriter{},
+			Concurrency: concurrency,
+		}
+		if _, err := io.Copy(w, &sheepReader{n: size}); err != nil {
+			b.Fatalf("Copy: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			b.Fatalf("Close: %v", err)
+		}
+	}
+}
+
+func BenchmarkWriter64MiBConcurrency0(b *testing.B) { benchmarkWriter(b, 64<<20, 0) }
+func BenchmarkWriter64MiBConcurrency8(b *testing.B) { benchmarkWriter(b, 64<<20, 8) }
+
+// The multi-GiB benchmarks can take minutes per iteration. Run them with
+// "-bench=GiB -benchtime=1x -timeout=1h".
+func BenchmarkWriter2GiBConcurrency0(b *testing.B) { benchmarkWriter(b, 2<<30, 0) }
+func BenchmarkWriter2GiBConcurrency8(b *testing.B) { benchmarkWriter(b, 2<<30, 8) }
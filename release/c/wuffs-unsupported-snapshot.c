@@ -36,6 +36,7 @@
 // limitations under the License.
 
 #include <stdbool.h>
+#include <stddef.h>
 #include <stdint.h>
 #include <stdlib.h>
 #include <string.h>
@@ -111,8 +112,20 @@ extern "C" {
 #include <arm_neon.h>
 #define WUFFS_BASE__CPU_ARCH__ARM_NEON
 #endif  // defined(__ARM_NEON)
+#if defined(__ARM_FEATURE_SVE)
+#include <arm_sve.h>
+#define WUFFS_BASE__CPU_ARCH__ARM_SVE
+#endif  // defined(__ARM_FEATURE_SVE)
 #endif  // defined(__ARM_FEATURE_UNALIGNED) etc
 
+// "cpu_arch >= riscv_v" requires the ratified (v1.0) vector extension and the
+// "__riscv_"-prefixed (v0.12 or later) intrinsics.
+#if defined(__riscv_vector) && defined(__riscv_v_intrinsic) && \
+    (__riscv_v_intrinsic >= 12000)
+#include <riscv_vector.h>
+#define WUFFS_BASE__CPU_ARCH__RISCV_V
+#endif  // defined(__riscv_vector) etc
+
 // Similarly, "cpu_arch >= x86_sse42" requires SSE4.2 but also PCLMUL and
 // POPCNT. This is checked at runtime via cpuid, not at compile time.
 #if defined(__x86_64__)
@@ -167,6 +180,141 @@ extern "C" {
 #define WUFFS_BASE__MAYBE_STATIC
 #endif  // defined(WUFFS_CONFIG__STATIC_FUNCTIONS)
 
+// --------
+
+// Define WUFFS_CONFIG__STATUS_MAPPINGS to declare (and define) each package's
+// wuffs_foo__status_http_code and wuffs_foo__status_errno functions. They map
+// that package's error statuses that were declared with a class, such as
+// corrupt, to suggested HTTP response status codes and errno values, such as
+// 422 and EBADMSG. Other statuses map to zero.
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+#include <errno.h>
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+// --------
+
+// Define WUFFS_CONFIG__STATUS_ENUMS to declare (and define) each package's
+// WUFFS_FOO__STATUS_ENUM__ETC macros, numbering that package's statuses from
+// 1, and its wuffs_foo__status__from_enum and wuffs_foo__status__to_enum
+// functions, converting between those numbers and status reprs. Zero means a
+// status that is not that package's, such as ok.
+
+// --------
+
+// Define WUFFS_CONFIG__THREAD_SAFETY_ANNOTATIONS to annotate the generated
+// code for Clang's -Wthread-safety analysis. Wuffs structs (such as
+// wuffs_foo__decoder) are not thread-safe: concurrent calls on the same struct
+// must be externally synchronized. With this macro, each public struct is a
+// capability and each public method requires holding its receiver, exclusively
+// (or, for const methods, shared). Callers tell the analysis how they hold it,
+// by annotating their own locking functions, such as with
+// __attribute__((acquire_capability(dec))), or with assert_capability.
+//
+// The macro has no effect on other compilers, or on the base package's
+// interface functions (such as wuffs_base__image_decoder__decode_frame).
+#if defined(WUFFS_CONFIG__THREAD_SAFETY_ANNOTATIONS) && defined(__clang__)
+#define WUFFS_BASE__CAPABILITY __attribute__((capability("wuffs_struct")))
+#define WUFFS_BASE__REQUIRES(x) __attribute__((requires_capability(x)))
+#define WUFFS_BASE__REQUIRES_SHARED(x) \
+  __attribute__((requires_shared_capability(x)))
+#define WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS \
+  __attribute__((no_thread_safety_analysis))
+#else
+#define WUFFS_BASE__CAPABILITY
+#define WUFFS_BASE__REQUIRES(x)
+#define WUFFS_BASE__REQUIRES_SHARED(x)
+#define WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
+#endif  // defined(WUFFS_CONFIG__THREAD_SAFETY_ANNOTATIONS) && etc
+
+// --------
+
+// Define WUFFS_CONFIG__TELEMETRY to collect each struct's wuffs_base__telemetry
+// counters, such as the number of bytes consumed and of error statuses
+// returned, readable via each package's wuffs_foo__bar__telemetry functions.
+
+// --------
+
+// Define WUFFS_CONFIG__AUTOVEC to shape the base package's portable copy loops
+// (those that copy from an io_writer's history) for compilers'
+// auto-vectorizers. The std packages' portable loops are shaped by the wuffs
+// gen -autovec flag instead, as that code is generated.
+
+// --------
+
+// Code generated with the wuffs gen -instrument flag calls these hooks when a
+// coroutine suspends, when a function returns a status and at the start of
+// each while loop iteration. Define them (before #include'ing this file) to
+// observe a decoder's progress, e.g. for fuzzer feedback or profiling. The
+// self argument is the receiver (or NULL) and func is the C function name, as
+// a string literal. Otherwise, they expand to nothing.
+#if !defined(WUFFS_BASE__INSTRUMENT__SUSPEND)
+#define WUFFS_BASE__INSTRUMENT__SUSPEND(self, func, point, status) ((void)0)
+#endif
+#if !defined(WUFFS_BASE__INSTRUMENT__RETURN)
+#define WUFFS_BASE__INSTRUMENT__RETURN(self, func, status) ((void)0)
+#endif
+#if !defined(WUFFS_BASE__INSTRUMENT__LOOP)
+#define WUFFS_BASE__INSTRUMENT__LOOP(self, func, line) ((void)0)
+#endif
+
+// --------
+
+// Define WUFFS_CONFIG__MEMCPY_PEEK_POKE to make the wuffs_base__peek_etc and
+// wuffs_base__poke_etc functions access memory only via fixed-size memcpy
+// calls (to or from a local array), never by dereferencing a pointer.
+// Compilers typically optimize those memcpy calls to single loads or stores,
+// and sanitizers (such as UBSan's -fsanitize=alignment) see no unaligned or
+// type-punned accesses.
+
+// ---------------- Static Assertions
+
+// WUFFS_BASE__STATIC_ASSERT(cond, name) fails to compile if cond, an integer
+// constant expression, is false. The name is a C identifier, unique within the
+// header that uses it, that older compilers (those without static_assert)
+// show in their error message.
+#if defined(__cplusplus) && ((__cplusplus >= 201103L) || defined(_MSC_VER))
+#define WUFFS_BASE__STATIC_ASSERT(cond, name) static_assert(cond, #name)
+#elif defined(__STDC_VERSION__) && (__STDC_VERSION__ >= 201112L)
+#define WUFFS_BASE__STATIC_ASSERT(cond, name) _Static_assert(cond, #name)
+#else
+#define WUFFS_BASE__STATIC_ASSERT(cond, name) \
+  typedef char wuffs_base__static_assert__##name[(cond) ? 1 : -1]
+#endif
+
+// WUFFS_BASE__ABI_HASH identifies the layout of the base package's public
+// types. Each generated package's header asserts that it matches the value
+// that the package was generated with. Mixing a package with a wuffs-base.c
+// from an incompatible Wuffs version then fails at compile time, instead of at
+// run time (such as with "#base: bad sizeof receiver") or not at all.
+//
+#define WUFFS_BASE__ABI_HASH 0xA5155465
+
+// The CPU-architecture-specific code (see WUFFS_BASE__CPU_ARCH__ETC) assumes a
+// little-endian CPU.
+#if (defined(WUFFS_BASE__CPU_ARCH__ARM_CRC32) ||  \
+     defined(WUFFS_BASE__CPU_ARCH__ARM_NEON) ||   \
+     defined(WUFFS_BASE__CPU_ARCH__ARM_SVE) ||    \
+     defined(WUFFS_BASE__CPU_ARCH__RISCV_V) ||    \
+     defined(WUFFS_BASE__CPU_ARCH__X86_64)) &&    \
+    defined(__BYTE_ORDER__) && defined(__ORDER_LITTLE_ENDIAN__)
+WUFFS_BASE__STATIC_ASSERT(__BYTE_ORDER__ == __ORDER_LITTLE_ENDIAN__,
+                          cpu_arch_is_little_endian);
+#endif
+
+// WUFFS_BASE__INLINE is C99's inline keyword, spelled so that it also works
+// for older C compilers, which support it as an extension. Code generated with
+// the wuffs gen -ctarget=c89 (or -ctarget=msvc) flag uses it.
+#if defined(__cplusplus) || \
+    (defined(__STDC_VERSION__) && (__STDC_VERSION__ >= 199901L))
+#define WUFFS_BASE__INLINE inline
+#elif defined(__GNUC__)
+#define WUFFS_BASE__INLINE __inline__
+#elif defined(_MSC_VER)
+#define WUFFS_BASE__INLINE __inline
+#else
+#define WUFFS_BASE__INLINE
+#endif
+
 // ---------------- CPU Architecture
 
 static inline bool  //
@@ -187,6 +335,24 @@ wuffs_base__cpu_arch__have_arm_neon() {
 #endif  // defined(WUFFS_BASE__CPU_ARCH__ARM_NEON)
 }
 
+static inline bool  //
+wuffs_base__cpu_arch__have_arm_sve() {
+#if defined(WUFFS_BASE__CPU_ARCH__ARM_SVE)
+  return true;
+#else
+  return false;
+#endif  // defined(WUFFS_BASE__CPU_ARCH__ARM_SVE)
+}
+
+static inline bool  //
+wuffs_base__cpu_arch__have_riscv_v() {
+#if defined(WUFFS_BASE__CPU_ARCH__RISCV_V)
+  return true;
+#else
+  return false;
+#endif  // defined(WUFFS_BASE__CPU_ARCH__RISCV_V)
+}
+
 static inline bool  //
 wuffs_base__cpu_arch__have_x86_sse42() {
 #if defined(WUFFS_BASE__CPU_ARCH__X86_64)
@@ -236,6 +402,16 @@ wuffs_base__cpu_arch__have_x86_sse42() {
 #define WUFFS_BASE__WARN_UNUSED_RESULT
 #endif
 
+// WUFFS_BASE__RESTRICT is C99's restrict qualifier, spelled so that it also
+// works for C++ compilers, which support it as an extension.
+#if defined(__GNUC__)
+#define WUFFS_BASE__RESTRICT __restrict__
+#elif defined(_MSC_VER)
+#define WUFFS_BASE__RESTRICT __restrict
+#else
+#define WUFFS_BASE__RESTRICT
+#endif
+
 // --------
 
 // Options (bitwise or'ed together) for wuffs_foo__bar__initialize functions.
@@ -258,6 +434,36 @@ wuffs_base__cpu_arch__have_x86_sse42() {
 #define WUFFS_INITIALIZE__LEAVE_INTERNAL_BUFFERS_UNINITIALIZED \
   ((uint32_t)0x00000002)
 
+// WUFFS_INITIALIZE__WORKBUF_LESS means that the caller will not provide a work
+// buffer: workbuf_len will return zero and methods that take a workbuf will
+// ignore it, running a workbuf-less variant instead. That variant might be
+// slower, or support fewer features, than the default.
+//
+// Only some structs support this. Those that do not (but otherwise take a
+// workbuf) will fail to initialize, returning
+// wuffs_base__error__unsupported_option, and the caller can then initialize
+// again without this option (and provide a work buffer). Structs that never
+// take a workbuf will accept and ignore it.
+#define WUFFS_INITIALIZE__WORKBUF_LESS ((uint32_t)0x00000004)
+
+// WUFFS_INITIALIZE__AVOID_CPU_ARCH__ETC means that choosy functions (those
+// with CPU-architecture-specific variants, such as SIMD implementations) will
+// not choose that CPU architecture's variants, even if the CPU supports them.
+// Sub-structs (such as a PNG decoder's zlib decoder) are initialized with the
+// same options.
+//
+// Setting all of them (WUFFS_INITIALIZE__AVOID_CPU_ARCH) means always using
+// the portable variants. Comparing the output of differently initialized
+// structs, on the same input, is differential testing: it catches a variant
+// that diverges from the others (see fuzz/c/std/cpu_arch_fuzzer.c), which
+// ordinary fuzzing would attribute to whichever variant the CPU dispatched to.
+#define WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_CRC32 ((uint32_t)0x00000100)
+#define WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_NEON ((uint32_t)0x00000200)
+#define WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_SVE ((uint32_t)0x00000400)
+#define WUFFS_INITIALIZE__AVOID_CPU_ARCH__RISCV_V ((uint32_t)0x00000800)
+#define WUFFS_INITIALIZE__AVOID_CPU_ARCH__X86_SSE42 ((uint32_t)0x00001000)
+#define WUFFS_INITIALIZE__AVOID_CPU_ARCH ((uint32_t)0x00001F00)
+
 // --------
 
 // wuffs_base__empty_struct is used when a Wuffs function returns an empty
@@ -340,6 +546,7 @@ extern const char wuffs_base__error__bad_vtable[];
 extern const char wuffs_base__error__bad_workbuf_length[];
 extern const char wuffs_base__error__bad_wuffs_version[];
 extern const char wuffs_base__error__cannot_return_a_suspension[];
+extern const char wuffs_base__error__conversion_out_of_range[];
 extern const char wuffs_base__error__disabled_by_previous_error[];
 extern const char wuffs_base__error__initialize_falsely_claimed_already_zeroed[];
 extern const char wuffs_base__error__initialize_not_called[];
@@ -431,6 +638,35 @@ wuffs_base__status::message() const {
 
 // --------
 
+// wuffs_base__telemetry holds a struct's counters, summed over its public
+// coroutine method calls (such as a decoder's decode_frame) since it was
+// initialized, so that services can export decoder health metrics. They are
+// only collected if WUFFS_CONFIG__TELEMETRY is defined. Otherwise, they cost
+// nothing and the wuffs_foo__bar__telemetry functions return all zeroes.
+//
+// bytes_consumed and bytes_produced count the bytes read from io_reader
+// arguments (such as src) and written to io_writer arguments (such as dst).
+// suspensions and errors count the calls that returned a suspension status
+// (such as "$short read") and an error status.
+typedef struct wuffs_base__telemetry__struct {
+  uint64_t bytes_consumed;
+  uint64_t bytes_produced;
+  uint64_t suspensions;
+  uint64_t errors;
+} wuffs_base__telemetry;
+
+static inline wuffs_base__telemetry  //
+wuffs_base__empty_telemetry() {
+  wuffs_base__telemetry ret;
+  ret.bytes_consumed = 0;
+  ret.bytes_produced = 0;
+  ret.suspensions = 0;
+  ret.errors = 0;
+  return ret;
+}
+
+// --------
+
 // WUFFS_BASE__RESULT is a result type: either a status (an error) or a value.
 //
 // A result with all fields NULL or zero is as valid as a zero-valued T.
@@ -773,6 +1009,203 @@ wuffs_base__u64__sat_sub(uint64_t x, uint64_t y) {
   return res;
 }
 
+// The signed sat_add and sat_sub functions also work on the unsigned
+// (modular) bit patterns. Addition overflows if and only if x and y have the
+// same sign but res has a different sign. Subtraction overflows if and only if
+// x and y have different signs and res's sign differs from x's. On overflow,
+// the result saturates towards x's sign: ((ux >> (N-1)) + INTN_MAX) is
+// INTN_MAX for non-negative x and INTN_MIN for negative x.
+
+static inline int8_t  //
+wuffs_base__i8__sat_add(int8_t x, int8_t y) {
+  uint8_t ux = (uint8_t)x;
+  uint8_t uy = (uint8_t)y;
+  uint8_t res = (uint8_t)(ux + uy);
+  if ((int8_t)((ux ^ res) & (uy ^ res)) < 0) {
+    return (int8_t)((uint8_t)(ux >> 7) + INT8_MAX);
+  }
+  return (int8_t)res;
+}
+
+static inline int8_t  //
+wuffs_base__i8__sat_sub(int8_t x, int8_t y) {
+  uint8_t ux = (uint8_t)x;
+  uint8_t uy = (uint8_t)y;
+  uint8_t res = (uint8_t)(ux - uy);
+  if ((int8_t)((ux ^ uy) & (ux ^ res)) < 0) {
+    return (int8_t)((uint8_t)(ux >> 7) + INT8_MAX);
+  }
+  return (int8_t)res;
+}
+
+static inline int16_t  //
+wuffs_base__i16__sat_add(int16_t x, int16_t y) {
+  uint16_t ux = (uint16_t)x;
+  uint16_t uy = (uint16_t)y;
+  uint16_t res = (uint16_t)(ux + uy);
+  if ((int16_t)((ux ^ res) & (uy ^ res)) < 0) {
+    return (int16_t)((uint16_t)(ux >> 15) + INT16_MAX);
+  }
+  return (int16_t)res;
+}
+
+static inline int16_t  //
+wuffs_base__i16__sat_sub(int16_t x, int16_t y) {
+  uint16_t ux = (uint16_t)x;
+  uint16_t uy = (uint16_t)y;
+  uint16_t res = (uint16_t)(ux - uy);
+  if ((int16_t)((ux ^ uy) & (ux ^ res)) < 0) {
+    return (int16_t)((uint16_t)(ux >> 15) + INT16_MAX);
+  }
+  return (int16_t)res;
+}
+
+static inline int32_t  //
+wuffs_base__i32__sat_add(int32_t x, int32_t y) {
+  uint32_t ux = (uint32_t)x;
+  uint32_t uy = (uint32_t)y;
+  uint32_t res = (uint32_t)(ux + uy);
+  if ((int32_t)((ux ^ res) & (uy ^ res)) < 0) {
+    return (int32_t)((uint32_t)(ux >> 31) + INT32_MAX);
+  }
+  return (int32_t)res;
+}
+
+static inline int32_t  //
+wuffs_base__i32__sat_sub(int32_t x, int32_t y) {
+  uint32_t ux = (uint32_t)x;
+  uint32_t uy = (uint32_t)y;
+  uint32_t res = (uint32_t)(ux - uy);
+  if ((int32_t)((ux ^ uy) & (ux ^ res)) < 0) {
+    return (int32_t)((uint32_t)(ux >> 31) + INT32_MAX);
+  }
+  return (int32_t)res;
+}
+
+static inline int64_t  //
+wuffs_base__i64__sat_add(int64_t x, int64_t y) {
+  uint64_t ux = (uint64_t)x;
+  uint64_t uy = (uint64_t)y;
+  uint64_t res = (uint64_t)(ux + uy);
+  if ((int64_t)((ux ^ res) & (uy ^ res)) < 0) {
+    return (int64_t)((uint64_t)(ux >> 63) + INT64_MAX);
+  }
+  return (int64_t)res;
+}
+
+static inline int64_t  //
+wuffs_base__i64__sat_sub(int64_t x, int64_t y) {
+  uint64_t ux = (uint64_t)x;
+  uint64_t uy = (uint64_t)y;
+  uint64_t res = (uint64_t)(ux - uy);
+  if ((int64_t)((ux ^ uy) & (ux ^ res)) < 0) {
+    return (int64_t)((uint64_t)(ux >> 63) + INT64_MAX);
+  }
+  return (int64_t)res;
+}
+
+// --------
+
+// The mod_shift functions return (x << n) or (x >> n), modulo the type's
+// range. Unlike C's "<<" and ">>" operators, their behavior is defined for
+// every n: n at or above the type's bit width gives zero. The shift is masked
+// to be less than that bit width and then the result is masked to be zero if
+// the original n was too large, which avoids any branches.
+
+static inline uint8_t  //
+wuffs_base__u8__mod_shift_left(uint8_t x, uint64_t n) {
+  uint8_t mask = (uint8_t)(-(uint32_t)(n < 8));
+  return (uint8_t)(((uint8_t)(x << (n & 7))) & mask);
+}
+
+static inline uint8_t  //
+wuffs_base__u8__mod_shift_right(uint8_t x, uint64_t n) {
+  uint8_t mask = (uint8_t)(-(uint32_t)(n < 8));
+  return (uint8_t)(((uint8_t)(x >> (n & 7))) & mask);
+}
+
+static inline uint16_t  //
+wuffs_base__u16__mod_shift_left(uint16_t x, uint64_t n) {
+  uint16_t mask = (uint16_t)(-(uint32_t)(n < 16));
+  return (uint16_t)(((uint16_t)(x << (n & 15))) & mask);
+}
+
+static inline uint16_t  //
+wuffs_base__u16__mod_shift_right(uint16_t x, uint64_t n) {
+  uint16_t mask = (uint16_t)(-(uint32_t)(n < 16));
+  return (uint16_t)(((uint16_t)(x >> (n & 15))) & mask);
+}
+
+static inline uint32_t  //
+wuffs_base__u32__mod_shift_left(uint32_t x, uint64_t n) {
+  uint32_t mask = -(uint32_t)(n < 32);
+  return (x << (n & 31)) & mask;
+}
+
+static inline uint32_t  //
+wuffs_base__u32__mod_shift_right(uint32_t x, uint64_t n) {
+  uint32_t mask = -(uint32_t)(n < 32);
+  return (x >> (n & 31)) & mask;
+}
+
+static inline uint64_t  //
+wuffs_base__u64__mod_shift_left(uint64_t x, uint64_t n) {
+  uint64_t mask = -(uint64_t)(n < 64);
+  return (x << (n & 63)) & mask;
+}
+
+static inline uint64_t  //
+wuffs_base__u64__mod_shift_right(uint64_t x, uint64_t n) {
+  uint64_t mask = -(uint64_t)(n < 64);
+  return (x >> (n & 63)) & mask;
+}
+
+// The signed mod_shift_left functions shift the unsigned (two's complement)
+// bit pattern. The signed mod_shift_right functions are arithmetic shifts: n
+// at or above the type's bit width gives the sign fill (0 or -1). Like the
+// generated code for the ">>" operator, they assume that the C compiler's
+// ">>" on a negative signed integer is an arithmetic shift.
+
+static inline int8_t  //
+wuffs_base__i8__mod_shift_left(int8_t x, uint64_t n) {
+  return (int8_t)wuffs_base__u8__mod_shift_left((uint8_t)x, n);
+}
+
+static inline int8_t  //
+wuffs_base__i8__mod_shift_right(int8_t x, uint64_t n) {
+  return (int8_t)(x >> ((n < 7) ? n : 7));
+}
+
+static inline int16_t  //
+wuffs_base__i16__mod_shift_left(int16_t x, uint64_t n) {
+  return (int16_t)wuffs_base__u16__mod_shift_left((uint16_t)x, n);
+}
+
+static inline int16_t  //
+wuffs_base__i16__mod_shift_right(int16_t x, uint64_t n) {
+  return (int16_t)(x >> ((n < 15) ? n : 15));
+}
+
+static inline int32_t  //
+wuffs_base__i32__mod_shift_left(int32_t x, uint64_t n) {
+  return (int32_t)wuffs_base__u32__mod_shift_left((uint32_t)x, n);
+}
+
+static inline int32_t  //
+wuffs_base__i32__mod_shift_right(int32_t x, uint64_t n) {
+  return (int32_t)(x >> ((n < 31) ? n : 31));
+}
+
+static inline int64_t  //
+wuffs_base__i64__mod_shift_left(int64_t x, uint64_t n) {
+  return (int64_t)wuffs_base__u64__mod_shift_left((uint64_t)x, n);
+}
+
+static inline int64_t  //
+wuffs_base__i64__mod_shift_right(int64_t x, uint64_t n) {
+  return (int64_t)(x >> ((n < 63) ? n : 63));
+}
+
 // --------
 
 typedef struct wuffs_base__multiply_u64__output__struct {
@@ -811,6 +1244,92 @@ wuffs_base__multiply_u64(uint64_t x, uint64_t y) {
 
 // --------
 
+// The mul_qN_round functions return ((x * y) / (1 << N)), rounded to nearest
+// (with ties rounding up): the product of x and y in Q-format fixed point,
+// with N fractional bits. The intermediate product does not overflow, but the
+// result is truncated to the return type. Wuffs code that calls these
+// functions has proved that that truncation is a no-op.
+
+static inline uint8_t  //
+wuffs_base__u8__mul_q8_round(uint8_t x, uint8_t y) {
+  return (uint8_t)(((((uint32_t)x) * ((uint32_t)y)) + 0x80) >> 8);
+}
+
+static inline uint16_t  //
+wuffs_base__u16__mul_q8_round(uint16_t x, uint16_t y) {
+  return (uint16_t)(((((uint32_t)x) * ((uint32_t)y)) + 0x80) >> 8);
+}
+
+static inline uint16_t  //
+wuffs_base__u16__mul_q16_round(uint16_t x, uint16_t y) {
+  return (uint16_t)(((((uint32_t)x) * ((uint32_t)y)) + 0x8000) >> 16);
+}
+
+static inline uint32_t  //
+wuffs_base__u32__mul_q8_round(uint32_t x, uint32_t y) {
+  return (uint32_t)(((((uint64_t)x) * ((uint64_t)y)) + 0x80) >> 8);
+}
+
+static inline uint32_t  //
+wuffs_base__u32__mul_q16_round(uint32_t x, uint32_t y) {
+  return (uint32_t)(((((uint64_t)x) * ((uint64_t)y)) + 0x8000) >> 16);
+}
+
+static inline uint64_t  //
+wuffs_base__u64__mul_q8_round(uint64_t x, uint64_t y) {
+  wuffs_base__multiply_u64__output o = wuffs_base__multiply_u64(x, y);
+  uint64_t lo = o.lo + 0x80;
+  uint64_t hi = o.hi + (lo < 0x80);
+  return (lo >> 8) | (hi << 56);
+}
+
+static inline uint64_t  //
+wuffs_base__u64__mul_q16_round(uint64_t x, uint64_t y) {
+  wuffs_base__multiply_u64__output o = wuffs_base__multiply_u64(x, y);
+  uint64_t lo = o.lo + 0x8000;
+  uint64_t hi = o.hi + (lo < 0x8000);
+  return (lo >> 16) | (hi << 48);
+}
+
+// --------
+
+// wuffs_base__optional_u32 is a u32 value that may or may not be present. If
+// ok is false then value is zero.
+typedef struct wuffs_base__optional_u32__struct {
+  uint32_t value;
+  bool ok;
+} wuffs_base__optional_u32;
+
+static inline wuffs_base__optional_u32  //
+wuffs_base__empty_optional_u32() {
+  wuffs_base__optional_u32 ret;
+  ret.value = 0;
+  ret.ok = false;
+  return ret;
+}
+
+static inline bool  //
+wuffs_base__optional_u32__is_ok(const wuffs_base__optional_u32* o) {
+  return o->ok;
+}
+
+static inline uint32_t  //
+wuffs_base__optional_u32__value(const wuffs_base__optional_u32* o) {
+  return o->value;
+}
+
+// wuffs_base__u64__to_u32_checked returns x as an optional u32, which is ok
+// if and only if x fits in a uint32_t.
+static inline wuffs_base__optional_u32  //
+wuffs_base__u64__to_u32_checked(uint64_t x) {
+  wuffs_base__optional_u32 ret;
+  ret.ok = x <= 0xFFFFFFFF;
+  ret.value = ret.ok ? ((uint32_t)x) : 0;
+  return ret;
+}
+
+// --------
+
 #if defined(__GNUC__) && (__SIZEOF_LONG__ == 8)
 
 static inline uint32_t  //
@@ -859,6 +1378,79 @@ wuffs_base__count_leading_zeroes_u64(uint64_t u) {
 
 // --------
 
+// The floor_log2 functions return the index of x's highest set bit. Wuffs code
+// that calls these functions has proved that x is non-zero.
+
+static inline uint32_t  //
+wuffs_base__u8__floor_log2(uint8_t x) {
+  return 63 - wuffs_base__count_leading_zeroes_u64((uint64_t)x);
+}
+
+static inline uint32_t  //
+wuffs_base__u16__floor_log2(uint16_t x) {
+  return 63 - wuffs_base__count_leading_zeroes_u64((uint64_t)x);
+}
+
+static inline uint32_t  //
+wuffs_base__u32__floor_log2(uint32_t x) {
+  return 63 - wuffs_base__count_leading_zeroes_u64((uint64_t)x);
+}
+
+static inline uint32_t  //
+wuffs_base__u64__floor_log2(uint64_t x) {
+  return 63 - wuffs_base__count_leading_zeroes_u64((uint64_t)x);
+}
+
+// The ceil_div_pow2 functions return (x / (1 << n)), rounded up. Unlike
+// ((x + (1 << n) - 1) >> n), there is no intermediate overflow. Wuffs code
+// that calls these functions has proved that n is less than x's bit width.
+
+static inline uint8_t  //
+wuffs_base__u8__ceil_div_pow2(uint8_t x, uint32_t n) {
+  return (uint8_t)((x >> n) + ((x & ((((uint32_t)1) << n) - 1)) != 0));
+}
+
+static inline uint16_t  //
+wuffs_base__u16__ceil_div_pow2(uint16_t x, uint32_t n) {
+  return (uint16_t)((x >> n) + ((x & ((((uint32_t)1) << n) - 1)) != 0));
+}
+
+static inline uint32_t  //
+wuffs_base__u32__ceil_div_pow2(uint32_t x, uint32_t n) {
+  return (uint32_t)((x >> n) + ((x & ((((uint32_t)1) << n) - 1)) != 0));
+}
+
+static inline uint64_t  //
+wuffs_base__u64__ceil_div_pow2(uint64_t x, uint32_t n) {
+  return (uint64_t)((x >> n) + ((x & ((((uint64_t)1) << n) - 1)) != 0));
+}
+
+// --------
+
+// The peek and poke functions read and write N-bit unsigned integers, in
+// big-endian (be) or little-endian (le) order, without bounds checking. The
+// caller must ensure that the N/8 bytes starting at p are valid.
+//
+// Only the "primitive" 8, 16, 32 and 64 bit functions touch that memory. The
+// other widths (24, 40, 48 and 56 bits) are combinations of primitives, each
+// of which accesses exactly its own bytes. Those primitives are where
+// WUFFS_CONFIG__MEMCPY_PEEK_POKE applies.
+#if defined(WUFFS_CONFIG__MEMCPY_PEEK_POKE)
+#define WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(n) \
+  uint8_t peek_poke_array[n];                 \
+  memcpy(peek_poke_array, p, n);              \
+  p = peek_poke_array
+#define WUFFS_BASE__PEEK_POKE__BEGIN_POKE(n) \
+  uint8_t peek_poke_array[n];                 \
+  uint8_t* peek_poke_dst = p;                 \
+  p = peek_poke_array
+#define WUFFS_BASE__PEEK_POKE__END_POKE(n) memcpy(peek_poke_dst, p, n)
+#else
+#define WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(n)
+#define WUFFS_BASE__PEEK_POKE__BEGIN_POKE(n)
+#define WUFFS_BASE__PEEK_POKE__END_POKE(n)
+#endif  // defined(WUFFS_CONFIG__MEMCPY_PEEK_POKE)
+
 #define wuffs_base__peek_u8be__no_bounds_check \
   wuffs_base__peek_u8__no_bounds_check
 #define wuffs_base__peek_u8le__no_bounds_check \
@@ -866,101 +1458,100 @@ wuffs_base__count_leading_zeroes_u64(uint64_t u) {
 
 static inline uint8_t  //
 wuffs_base__peek_u8__no_bounds_check(const uint8_t* p) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(1);
   return p[0];
 }
 
 static inline uint16_t  //
 wuffs_base__peek_u16be__no_bounds_check(const uint8_t* p) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(2);
   return (uint16_t)(((uint16_t)(p[0]) << 8) | ((uint16_t)(p[1]) << 0));
 }
 
 static inline uint16_t  //
 wuffs_base__peek_u16le__no_bounds_check(const uint8_t* p) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(2);
   return (uint16_t)(((uint16_t)(p[0]) << 0) | ((uint16_t)(p[1]) << 8));
 }
 
-static inline uint32_t  //
-wuffs_base__peek_u24be__no_bounds_check(const uint8_t* p) {
-  return ((uint32_t)(p[0]) << 16) | ((uint32_t)(p[1]) << 8) |
-         ((uint32_t)(p[2]) << 0);
-}
-
-static inline uint32_t  //
-wuffs_base__peek_u24le__no_bounds_check(const uint8_t* p) {
-  return ((uint32_t)(p[0]) << 0) | ((uint32_t)(p[1]) << 8) |
-         ((uint32_t)(p[2]) << 16);
-}
-
 static inline uint32_t  //
 wuffs_base__peek_u32be__no_bounds_check(const uint8_t* p) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(4);
   return ((uint32_t)(p[0]) << 24) | ((uint32_t)(p[1]) << 16) |
          ((uint32_t)(p[2]) << 8) | ((uint32_t)(p[3]) << 0);
 }
 
 static inline uint32_t  //
 wuffs_base__peek_u32le__no_bounds_check(const uint8_t* p) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(4);
   return ((uint32_t)(p[0]) << 0) | ((uint32_t)(p[1]) << 8) |
          ((uint32_t)(p[2]) << 16) | ((uint32_t)(p[3]) << 24);
 }
 
 static inline uint64_t  //
-wuffs_base__peek_u40be__no_bounds_check(const uint8_t* p) {
-  return ((uint64_t)(p[0]) << 32) | ((uint64_t)(p[1]) << 24) |
-         ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 8) |
-         ((uint64_t)(p[4]) << 0);
+wuffs_base__peek_u64be__no_bounds_check(const uint8_t* p) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(8);
+  return ((uint64_t)(p[0]) << 56) | ((uint64_t)(p[1]) << 48) |
+         ((uint64_t)(p[2]) << 40) | ((uint64_t)(p[3]) << 32) |
+         ((uint64_t)(p[4]) << 24) | ((uint64_t)(p[5]) << 16) |
+         ((uint64_t)(p[6]) << 8) | ((uint64_t)(p[7]) << 0);
 }
 
 static inline uint64_t  //
-wuffs_base__peek_u40le__no_bounds_check(const uint8_t* p) {
+wuffs_base__peek_u64le__no_bounds_check(const uint8_t* p) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_PEEK(8);
   return ((uint64_t)(p[0]) << 0) | ((uint64_t)(p[1]) << 8) |
          ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 24) |
-         ((uint64_t)(p[4]) << 32);
+         ((uint64_t)(p[4]) << 32) | ((uint64_t)(p[5]) << 40) |
+         ((uint64_t)(p[6]) << 48) | ((uint64_t)(p[7]) << 56);
+}
+
+static inline uint32_t  //
+wuffs_base__peek_u24be__no_bounds_check(const uint8_t* p) {
+  return ((uint32_t)(wuffs_base__peek_u16be__no_bounds_check(p)) << 8) |
+         ((uint32_t)(wuffs_base__peek_u8be__no_bounds_check(p + 2)) << 0);
+}
+
+static inline uint32_t  //
+wuffs_base__peek_u24le__no_bounds_check(const uint8_t* p) {
+  return ((uint32_t)(wuffs_base__peek_u16le__no_bounds_check(p)) << 0) |
+         ((uint32_t)(wuffs_base__peek_u8le__no_bounds_check(p + 2)) << 16);
 }
 
 static inline uint64_t  //
-wuffs_base__peek_u48be__no_bounds_check(const uint8_t* p) {
-  return ((uint64_t)(p[0]) << 40) | ((uint64_t)(p[1]) << 32) |
-         ((uint64_t)(p[2]) << 24) | ((uint64_t)(p[3]) << 16) |
-         ((uint64_t)(p[4]) << 8) | ((uint64_t)(p[5]) << 0);
+wuffs_base__peek_u40be__no_bounds_check(const uint8_t* p) {
+  return ((uint64_t)(wuffs_base__peek_u32be__no_bounds_check(p)) << 8) |
+         ((uint64_t)(wuffs_base__peek_u8be__no_bounds_check(p + 4)) << 0);
 }
 
 static inline uint64_t  //
-wuffs_base__peek_u48le__no_bounds_check(const uint8_t* p) {
-  return ((uint64_t)(p[0]) << 0) | ((uint64_t)(p[1]) << 8) |
-         ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 24) |
-         ((uint64_t)(p[4]) << 32) | ((uint64_t)(p[5]) << 40);
+wuffs_base__peek_u40le__no_bounds_check(const uint8_t* p) {
+  return ((uint64_t)(wuffs_base__peek_u32le__no_bounds_check(p)) << 0) |
+         ((uint64_t)(wuffs_base__peek_u8le__no_bounds_check(p + 4)) << 32);
 }
 
 static inline uint64_t  //
-wuffs_base__peek_u56be__no_bounds_check(const uint8_t* p) {
-  return ((uint64_t)(p[0]) << 48) | ((uint64_t)(p[1]) << 40) |
-         ((uint64_t)(p[2]) << 32) | ((uint64_t)(p[3]) << 24) |
-         ((uint64_t)(p[4]) << 16) | ((uint64_t)(p[5]) << 8) |
-         ((uint64_t)(p[6]) << 0);
+wuffs_base__peek_u48be__no_bounds_check(const uint8_t* p) {
+  return ((uint64_t)(wuffs_base__peek_u32be__no_bounds_check(p)) << 16) |
+         ((uint64_t)(wuffs_base__peek_u16be__no_bounds_check(p + 4)) << 0);
 }
 
 static inline uint64_t  //
-wuffs_base__peek_u56le__no_bounds_check(const uint8_t* p) {
-  return ((uint64_t)(p[0]) << 0) | ((uint64_t)(p[1]) << 8) |
-         ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 24) |
-         ((uint64_t)(p[4]) << 32) | ((uint64_t)(p[5]) << 40) |
-         ((uint64_t)(p[6]) << 48);
+wuffs_base__peek_u48le__no_bounds_check(const uint8_t* p) {
+  return ((uint64_t)(wuffs_base__peek_u32le__no_bounds_check(p)) << 0) |
+         ((uint64_t)(wuffs_base__peek_u16le__no_bounds_check(p + 4)) << 32);
 }
 
 static inline uint64_t  //
-wuffs_base__peek_u64be__no_bounds_check(const uint8_t* p) {
-  return ((uint64_t)(p[0]) << 56) | ((uint64_t)(p[1]) << 48) |
-         ((uint64_t)(p[2]) << 40) | ((uint64_t)(p[3]) << 32) |
-         ((uint64_t)(p[4]) << 24) | ((uint64_t)(p[5]) << 16) |
-         ((uint64_t)(p[6]) << 8) | ((uint64_t)(p[7]) << 0);
+wuffs_base__peek_u56be__no_bounds_check(const uint8_t* p) {
+  return ((uint64_t)(wuffs_base__peek_u32be__no_bounds_check(p)) << 24) |
+         ((uint64_t)(wuffs_base__peek_u24be__no_bounds_check(p + 4)) << 0);
 }
 
 static inline uint64_t  //
-wuffs_base__peek_u64le__no_bounds_check(const uint8_t* p) {
-  return ((uint64_t)(p[0]) << 0) | ((uint64_t)(p[1]) << 8) |
-         ((uint64_t)(p[2]) << 16) | ((uint64_t)(p[3]) << 24) |
-         ((uint64_t)(p[4]) << 32) | ((uint64_t)(p[5]) << 40) |
-         ((uint64_t)(p[6]) << 48) | ((uint64_t)(p[7]) << 56);
+wuffs_base__peek_u56le__no_bounds_check(const uint8_t* p) {
+  return ((uint64_t)(wuffs_base__peek_u32le__no_bounds_check(p)) << 0) |
+         ((uint64_t)(wuffs_base__peek_u24le__no_bounds_check(p + 4)) << 32);
 }
 
 // --------
@@ -972,13 +1563,17 @@ wuffs_base__peek_u64le__no_bounds_check(const uint8_t* p) {
 
 static inline void  //
 wuffs_base__poke_u8__no_bounds_check(uint8_t* p, uint8_t x) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(1);
   p[0] = x;
+  WUFFS_BASE__PEEK_POKE__END_POKE(1);
 }
 
 static inline void  //
 wuffs_base__poke_u16be__no_bounds_check(uint8_t* p, uint16_t x) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(2);
   p[0] = (uint8_t)(x >> 8);
   p[1] = (uint8_t)(x >> 0);
+  WUFFS_BASE__PEEK_POKE__END_POKE(2);
 }
 
 static inline void  //
@@ -988,31 +1583,21 @@ wuffs_base__poke_u16le__no_bounds_check(uint8_t* p, uint16_t x) {
   // defines "__GNUC__".
   memcpy(p, &x, 2);
 #else
+  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(2);
   p[0] = (uint8_t)(x >> 0);
   p[1] = (uint8_t)(x >> 8);
+  WUFFS_BASE__PEEK_POKE__END_POKE(2);
 #endif
 }
 
-static inline void  //
-wuffs_base__poke_u24be__no_bounds_check(uint8_t* p, uint32_t x) {
-  p[0] = (uint8_t)(x >> 16);
-  p[1] = (uint8_t)(x >> 8);
-  p[2] = (uint8_t)(x >> 0);
-}
-
-static inline void  //
-wuffs_base__poke_u24le__no_bounds_check(uint8_t* p, uint32_t x) {
-  p[0] = (uint8_t)(x >> 0);
-  p[1] = (uint8_t)(x >> 8);
-  p[2] = (uint8_t)(x >> 16);
-}
-
 static inline void  //
 wuffs_base__poke_u32be__no_bounds_check(uint8_t* p, uint32_t x) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(4);
   p[0] = (uint8_t)(x >> 24);
   p[1] = (uint8_t)(x >> 16);
   p[2] = (uint8_t)(x >> 8);
   p[3] = (uint8_t)(x >> 0);
+  WUFFS_BASE__PEEK_POKE__END_POKE(4);
 }
 
 static inline void  //
@@ -1022,75 +1607,18 @@ wuffs_base__poke_u32le__no_bounds_check(uint8_t* p, uint32_t x) {
   // defines "__GNUC__".
   memcpy(p, &x, 4);
 #else
+  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(4);
   p[0] = (uint8_t)(x >> 0);
   p[1] = (uint8_t)(x >> 8);
   p[2] = (uint8_t)(x >> 16);
   p[3] = (uint8_t)(x >> 24);
+  WUFFS_BASE__PEEK_POKE__END_POKE(4);
 #endif
 }
 
-static inline void  //
-wuffs_base__poke_u40be__no_bounds_check(uint8_t* p, uint64_t x) {
-  p[0] = (uint8_t)(x >> 32);
-  p[1] = (uint8_t)(x >> 24);
-  p[2] = (uint8_t)(x >> 16);
-  p[3] = (uint8_t)(x >> 8);
-  p[4] = (uint8_t)(x >> 0);
-}
-
-static inline void  //
-wuffs_base__poke_u40le__no_bounds_check(uint8_t* p, uint64_t x) {
-  p[0] = (uint8_t)(x >> 0);
-  p[1] = (uint8_t)(x >> 8);
-  p[2] = (uint8_t)(x >> 16);
-  p[3] = (uint8_t)(x >> 24);
-  p[4] = (uint8_t)(x >> 32);
-}
-
-static inline void  //
-wuffs_base__poke_u48be__no_bounds_check(uint8_t* p, uint64_t x) {
-  p[0] = (uint8_t)(x >> 40);
-  p[1] = (uint8_t)(x >> 32);
-  p[2] = (uint8_t)(x >> 24);
-  p[3] = (uint8_t)(x >> 16);
-  p[4] = (uint8_t)(x >> 8);
-  p[5] = (uint8_t)(x >> 0);
-}
-
-static inline void  //
-wuffs_base__poke_u48le__no_bounds_check(uint8_t* p, uint64_t x) {
-  p[0] = (uint8_t)(x >> 0);
-  p[1] = (uint8_t)(x >> 8);
-  p[2] = (uint8_t)(x >> 16);
-  p[3] = (uint8_t)(x >> 24);
-  p[4] = (uint8_t)(x >> 32);
-  p[5] = (uint8_t)(x >> 40);
-}
-
-static inline void  //
-wuffs_base__poke_u56be__no_bounds_check(uint8_t* p, uint64_t x) {
-  p[0] = (uint8_t)(x >> 48);
-  p[1] = (uint8_t)(x >> 40);
-  p[2] = (uint8_t)(x >> 32);
-  p[3] = (uint8_t)(x >> 24);
-  p[4] = (uint8_t)(x >> 16);
-  p[5] = (uint8_t)(x >> 8);
-  p[6] = (uint8_t)(x >> 0);
-}
-
-static inline void  //
-wuffs_base__poke_u56le__no_bounds_check(uint8_t* p, uint64_t x) {
-  p[0] = (uint8_t)(x >> 0);
-  p[1] = (uint8_t)(x >> 8);
-  p[2] = (uint8_t)(x >> 16);
-  p[3] = (uint8_t)(x >> 24);
-  p[4] = (uint8_t)(x >> 32);
-  p[5] = (uint8_t)(x >> 40);
-  p[6] = (uint8_t)(x >> 48);
-}
-
 static inline void  //
 wuffs_base__poke_u64be__no_bounds_check(uint8_t* p, uint64_t x) {
+  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(8);
   p[0] = (uint8_t)(x >> 56);
   p[1] = (uint8_t)(x >> 48);
   p[2] = (uint8_t)(x >> 40);
@@ -1099,6 +1627,7 @@ wuffs_base__poke_u64be__no_bounds_check(uint8_t* p, uint64_t x) {
   p[5] = (uint8_t)(x >> 16);
   p[6] = (uint8_t)(x >> 8);
   p[7] = (uint8_t)(x >> 0);
+  WUFFS_BASE__PEEK_POKE__END_POKE(8);
 }
 
 static inline void  //
@@ -1108,6 +1637,7 @@ wuffs_base__poke_u64le__no_bounds_check(uint8_t* p, uint64_t x) {
   // defines "__GNUC__".
   memcpy(p, &x, 8);
 #else
+  WUFFS_BASE__PEEK_POKE__BEGIN_POKE(8);
   p[0] = (uint8_t)(x >> 0);
   p[1] = (uint8_t)(x >> 8);
   p[2] = (uint8_t)(x >> 16);
@@ -1116,9 +1646,95 @@ wuffs_base__poke_u64le__no_bounds_check(uint8_t* p, uint64_t x) {
   p[5] = (uint8_t)(x >> 40);
   p[6] = (uint8_t)(x >> 48);
   p[7] = (uint8_t)(x >> 56);
+  WUFFS_BASE__PEEK_POKE__END_POKE(8);
 #endif
 }
 
+static inline void  //
+wuffs_base__poke_u24be__no_bounds_check(uint8_t* p, uint32_t x) {
+  wuffs_base__poke_u16be__no_bounds_check(p, (uint16_t)(x >> 8));
+  wuffs_base__poke_u8be__no_bounds_check(p + 2, (uint8_t)(x >> 0));
+}
+
+static inline void  //
+wuffs_base__poke_u24le__no_bounds_check(uint8_t* p, uint32_t x) {
+  wuffs_base__poke_u16le__no_bounds_check(p, (uint16_t)(x >> 0));
+  wuffs_base__poke_u8le__no_bounds_check(p + 2, (uint8_t)(x >> 16));
+}
+
+static inline void  //
+wuffs_base__poke_u40be__no_bounds_check(uint8_t* p, uint64_t x) {
+  wuffs_base__poke_u32be__no_bounds_check(p, (uint32_t)(x >> 8));
+  wuffs_base__poke_u8be__no_bounds_check(p + 4, (uint8_t)(x >> 0));
+}
+
+static inline void  //
+wuffs_base__poke_u40le__no_bounds_check(uint8_t* p, uint64_t x) {
+  wuffs_base__poke_u32le__no_bounds_check(p, (uint32_t)(x >> 0));
+  wuffs_base__poke_u8le__no_bounds_check(p + 4, (uint8_t)(x >> 32));
+}
+
+static inline void  //
+wuffs_base__poke_u48be__no_bounds_check(uint8_t* p, uint64_t x) {
+  wuffs_base__poke_u32be__no_bounds_check(p, (uint32_t)(x >> 16));
+  wuffs_base__poke_u16be__no_bounds_check(p + 4, (uint16_t)(x >> 0));
+}
+
+static inline void  //
+wuffs_base__poke_u48le__no_bounds_check(uint8_t* p, uint64_t x) {
+  wuffs_base__poke_u32le__no_bounds_check(p, (uint32_t)(x >> 0));
+  wuffs_base__poke_u16le__no_bounds_check(p + 4, (uint16_t)(x >> 32));
+}
+
+static inline void  //
+wuffs_base__poke_u56be__no_bounds_check(uint8_t* p, uint64_t x) {
+  wuffs_base__poke_u32be__no_bounds_check(p, (uint32_t)(x >> 24));
+  wuffs_base__poke_u24be__no_bounds_check(p + 4, (uint32_t)(x >> 0));
+}
+
+static inline void  //
+wuffs_base__poke_u56le__no_bounds_check(uint8_t* p, uint64_t x) {
+  wuffs_base__poke_u32le__no_bounds_check(p, (uint32_t)(x >> 0));
+  wuffs_base__poke_u24le__no_bounds_check(p + 4, (uint32_t)(x >> 32));
+}
+
+// --------
+
+// With C11, the wuffs_base__peek_be__no_bounds_check (and _le) macros pick the
+// width from a type, one of uint8_t, uint16_t, uint32_t or uint64_t, and the
+// wuffs_base__poke_be__no_bounds_check (and _le) macros pick the width from
+// the type of x. Other types, including int, fail to compile. For example:
+//
+//  uint32_t x = wuffs_base__peek_le__no_bounds_check(p, uint32_t);
+//  wuffs_base__poke_be__no_bounds_check(q, x);
+#if defined(__STDC_VERSION__) && (__STDC_VERSION__ >= 201112L) && \
+    !defined(__cplusplus)
+#define wuffs_base__peek_be__no_bounds_check(p, T)               \
+  _Generic((T)0,                                                 \
+           uint8_t: wuffs_base__peek_u8be__no_bounds_check,      \
+           uint16_t: wuffs_base__peek_u16be__no_bounds_check,    \
+           uint32_t: wuffs_base__peek_u32be__no_bounds_check,    \
+           uint64_t: wuffs_base__peek_u64be__no_bounds_check)(p)
+#define wuffs_base__peek_le__no_bounds_check(p, T)               \
+  _Generic((T)0,                                                 \
+           uint8_t: wuffs_base__peek_u8le__no_bounds_check,      \
+           uint16_t: wuffs_base__peek_u16le__no_bounds_check,    \
+           uint32_t: wuffs_base__peek_u32le__no_bounds_check,    \
+           uint64_t: wuffs_base__peek_u64le__no_bounds_check)(p)
+#define wuffs_base__poke_be__no_bounds_check(p, x)                  \
+  _Generic((x),                                                     \
+           uint8_t: wuffs_base__poke_u8be__no_bounds_check,         \
+           uint16_t: wuffs_base__poke_u16be__no_bounds_check,       \
+           uint32_t: wuffs_base__poke_u32be__no_bounds_check,       \
+           uint64_t: wuffs_base__poke_u64be__no_bounds_check)(p, x)
+#define wuffs_base__poke_le__no_bounds_check(p, x)                  \
+  _Generic((x),                                                     \
+           uint8_t: wuffs_base__poke_u8le__no_bounds_check,         \
+           uint16_t: wuffs_base__poke_u16le__no_bounds_check,       \
+           uint32_t: wuffs_base__poke_u32le__no_bounds_check,       \
+           uint64_t: wuffs_base__poke_u64le__no_bounds_check)(p, x)
+#endif  // __STDC_VERSION__ >= 201112L && !defined(__cplusplus)
+
 // --------
 
 // Load and Store functions are deprecated. Use Peek and Poke instead.
@@ -1222,6 +1838,18 @@ typedef WUFFS_BASE__TABLE(uint16_t) wuffs_base__table_u16;
 typedef WUFFS_BASE__TABLE(uint32_t) wuffs_base__table_u32;
 typedef WUFFS_BASE__TABLE(uint64_t) wuffs_base__table_u64;
 
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__slice_u8, ptr) == 0,
+                          slice_u8_ptr_offset);
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__slice_u8, len) ==
+                              sizeof(uint8_t*),
+                          slice_u8_len_offset);
+WUFFS_BASE__STATIC_ASSERT(sizeof(wuffs_base__slice_u8) ==
+                              (sizeof(uint8_t*) + sizeof(size_t)),
+                          slice_u8_sizeof);
+WUFFS_BASE__STATIC_ASSERT(sizeof(wuffs_base__table_u8) ==
+                              (sizeof(uint8_t*) + (3 * sizeof(size_t))),
+                          table_u8_sizeof);
+
 static inline wuffs_base__slice_u8  //
 wuffs_base__make_slice_u8(uint8_t* ptr, size_t len) {
   wuffs_base__slice_u8 ret;
@@ -2302,6 +2930,9 @@ typedef struct wuffs_base__more_information__struct {
   inline uint64_t io_seek__position() const;
   inline uint32_t metadata__fourcc() const;
   inline wuffs_base__range_ie_u64 metadata__range() const;
+  inline void set_metadata(uint32_t fourcc_arg,
+                           uint64_t min_incl_arg,
+                           uint64_t max_excl_arg);
 #endif  // __cplusplus
 
 } wuffs_base__more_information;
@@ -2338,6 +2969,19 @@ wuffs_base__more_information__set(wuffs_base__more_information* m,
   m->z = z;
 }
 
+// wuffs_base__more_information__set_metadata is equivalent to
+// wuffs_base__more_information__set with the METADATA flavor. The metadata's
+// bytes are those in the half-open I/O position range [min_incl, max_excl).
+static inline void  //
+wuffs_base__more_information__set_metadata(wuffs_base__more_information* m,
+                                           uint32_t fourcc,
+                                           uint64_t min_incl,
+                                           uint64_t max_excl) {
+  wuffs_base__more_information__set(
+      m, WUFFS_BASE__MORE_INFORMATION__FLAVOR__METADATA, fourcc, 0, min_incl,
+      max_excl);
+}
+
 static inline uint32_t  //
 wuffs_base__more_information__io_redirect__fourcc(
     const wuffs_base__more_information* m) {
@@ -2411,6 +3055,14 @@ wuffs_base__more_information::metadata__range() const {
   return wuffs_base__more_information__metadata__range(this);
 }
 
+inline void  //
+wuffs_base__more_information::set_metadata(uint32_t fourcc_arg,
+                                           uint64_t min_incl_arg,
+                                           uint64_t max_excl_arg) {
+  wuffs_base__more_information__set_metadata(this, fourcc_arg, min_incl_arg,
+                                             max_excl_arg);
+}
+
 #endif  // __cplusplus
 
 // ---------------- I/O
@@ -2454,6 +3106,27 @@ typedef struct wuffs_base__io_buffer__struct {
 
 } wuffs_base__io_buffer;
 
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer_meta, wi) == 0,
+                          io_buffer_meta_wi_offset);
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer_meta, ri) ==
+                              sizeof(size_t),
+                          io_buffer_meta_ri_offset);
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer_meta, pos) ==
+                              (2 * sizeof(size_t)),
+                          io_buffer_meta_pos_offset);
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer_meta, closed) ==
+                              ((2 * sizeof(size_t)) + sizeof(uint64_t)),
+                          io_buffer_meta_closed_offset);
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer, data) == 0,
+                          io_buffer_data_offset);
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__io_buffer, meta) ==
+                              sizeof(wuffs_base__slice_u8),
+                          io_buffer_meta_offset);
+WUFFS_BASE__STATIC_ASSERT(sizeof(wuffs_base__io_buffer) ==
+                              (sizeof(wuffs_base__slice_u8) +
+                               sizeof(wuffs_base__io_buffer_meta)),
+                          io_buffer_sizeof);
+
 static inline wuffs_base__io_buffer  //
 wuffs_base__make_io_buffer(wuffs_base__slice_u8 data,
                            wuffs_base__io_buffer_meta meta) {
@@ -2694,6 +3367,252 @@ wuffs_base__io_buffer::writer_slice() const {
 
 #endif  // __cplusplus
 
+// ---------------- I/O Read Callbacks
+
+// wuffs_base__io_read_func is the type of a pull-style callback that supplies
+// input bytes in place, such as the next mapped window of a memory-mapped
+// file or the next contiguous run of a ring buffer, instead of the caller
+// copying them into an io_buffer. It returns those bytes, which must remain
+// valid and unmodified until the next call, and sets *closed to whether no
+// further bytes follow them. Returning an empty slice, with *closed false,
+// means that no bytes are available yet.
+typedef wuffs_base__slice_u8 (*wuffs_base__io_read_func)(void* context,
+                                                         bool* closed);
+
+// wuffs_base__io_read_callback is a wuffs_base__io_read_func and its context,
+// plus the state for wuffs_base__io_buffer__refill. Make one with
+// wuffs_base__make_io_read_callback.
+//
+// The stitch slice, owned by the caller, is only used when a decoder suspends
+// with unread bytes, such as the first half of a multi-byte field at the end
+// of one run of bytes. Those are joined with the start of the next run, which
+// is otherwise returned to the decoder in place. The stitch length bounds how
+// many unread bytes can be carried over. A few dozen bytes is typically
+// enough but a longer stitch means fewer, larger copies.
+typedef struct wuffs_base__io_read_callback__struct {
+  wuffs_base__io_read_func func;
+  void* context;
+  wuffs_base__slice_u8 stitch;
+
+  // Do not access the private_impl's fields directly. There is no API/ABI
+  // compatibility or safety guarantee if you do so.
+  struct {
+    // pending holds the bytes returned by func but not yet passed on.
+    wuffs_base__slice_u8 pending;
+    bool closed;
+  } private_impl;
+} wuffs_base__io_read_callback;
+
+static inline wuffs_base__io_read_callback  //
+wuffs_base__make_io_read_callback(wuffs_base__io_read_func func,
+                                  void* context,
+                                  wuffs_base__slice_u8 stitch) {
+  wuffs_base__io_read_callback ret;
+  ret.func = func;
+  ret.context = context;
+  ret.stitch = stitch;
+  ret.private_impl.pending = wuffs_base__empty_slice_u8();
+  ret.private_impl.closed = false;
+  return ret;
+}
+
+// wuffs_base__io_buffer__refill gives buf, a source io_buffer that a decoder
+// has (partially) read, more bytes from cb. Call it after a "$short read"
+// suspension and then call the decoder again, with the same buf.
+//
+// If buf has no unread bytes then it is re-pointed at cb's next bytes, without
+// copying them. Otherwise, its unread bytes and (as many as fit) the next
+// bytes are copied into cb's stitch slice and buf is re-pointed at that.
+// Either way, buf's reader position is unchanged.
+//
+// It returns a "$short read" suspension if cb had no further bytes (and is not
+// closed) and a "#bad argument (length too short)" error if buf's unread
+// bytes do not fit in the stitch slice with room to spare.
+static inline wuffs_base__status  //
+wuffs_base__io_buffer__refill(wuffs_base__io_buffer* buf,
+                              wuffs_base__io_read_callback* cb) {
+  if (!buf || !cb || !cb->func) {
+    return wuffs_base__make_status(wuffs_base__error__bad_argument);
+  }
+  size_t n = buf->meta.wi - buf->meta.ri;
+  uint64_t pos = wuffs_base__u64__sat_add(buf->meta.pos, buf->meta.ri);
+
+  // Copy any unread bytes before calling cb->func, which can invalidate them.
+  if (n > 0) {
+    if (n >= cb->stitch.len) {
+      return wuffs_base__make_status(
+          wuffs_base__error__bad_argument_length_too_short);
+    }
+    memmove(cb->stitch.ptr, buf->data.ptr + buf->meta.ri, n);
+  }
+
+  wuffs_base__slice_u8* pending = &cb->private_impl.pending;
+  if ((pending->len == 0) && !cb->private_impl.closed) {
+    *pending = (*cb->func)(cb->context, &cb->private_impl.closed);
+  }
+
+  size_t m = pending->len;
+  if (n == 0) {
+    buf->data = *pending;
+  } else {
+    if (m > (cb->stitch.len - n)) {
+      m = cb->stitch.len - n;
+    }
+    if (m > 0) {
+      memcpy(cb->stitch.ptr + n, pending->ptr, m);
+    }
+    buf->data = cb->stitch;
+  }
+  *pending = wuffs_base__slice_u8__subslice_i(*pending, m);
+
+  bool closed = cb->private_impl.closed && (pending->len == 0);
+  buf->meta = wuffs_base__make_io_buffer_meta(n + m, 0, pos, closed);
+  if ((m == 0) && !closed) {
+    return wuffs_base__make_status(wuffs_base__suspension__short_read);
+  }
+  return wuffs_base__make_status(NULL);
+}
+
+// ---------------- Metadata Chunks
+
+// wuffs_base__metadata_chunk_func is the type of a callback that receives
+// metadata (such as an ICC profile or XMP) in chunks, as it is decoded. The
+// fourcc identifies the metadata and io_position is the I/O position of the
+// chunk's first byte. Returning a non-OK status stops the visit and that
+// status is passed back to the visitor's caller.
+//
+// The chunk's bytes are only valid for the duration of the call.
+typedef wuffs_base__status (*wuffs_base__metadata_chunk_func)(
+    void* context,
+    uint32_t fourcc,
+    uint64_t io_position,
+    wuffs_base__slice_u8 chunk);
+
+// wuffs_base__more_information__deliver_metadata passes the bytes of src that
+// lie within m's range to callback, advancing src's read index past them. It
+// does nothing if m does not have the METADATA flavor or if src's reader
+// position is outside of m's range.
+//
+// It returns OK once it reaches the end of the range, or a "$short read"
+// suspension (or, if src is closed, a "#not enough data" error) if src runs
+// out of bytes first. The caller can re-fill src and call it again, as m is
+// not modified: progress is tracked by src's reader position.
+//
+// This is typically called by a generated wuffs_foo__bar__visit_metadata
+// function, which alternates it with calls to wuffs_foo__bar__tell_me_more.
+static inline wuffs_base__status  //
+wuffs_base__more_information__deliver_metadata(
+    const wuffs_base__more_information* m,
+    wuffs_base__io_buffer* src,
+    wuffs_base__metadata_chunk_func callback,
+    void* context) {
+  if (!m || (m->flavor != WUFFS_BASE__MORE_INFORMATION__FLAVOR__METADATA) ||
+      !src) {
+    return wuffs_base__make_status(NULL);
+  }
+  if (!callback) {
+    return wuffs_base__make_status(wuffs_base__error__bad_argument);
+  }
+  while (true) {
+    uint64_t pos = wuffs_base__io_buffer__reader_position(src);
+    if ((pos < m->y) || (pos >= m->z)) {
+      return wuffs_base__make_status(NULL);
+    }
+    size_t n = wuffs_base__io_buffer__reader_length(src);
+    if (n == 0) {
+      return wuffs_base__make_status(src->meta.closed
+                                         ? wuffs_base__error__not_enough_data
+                                         : wuffs_base__suspension__short_read);
+    }
+    if (n > (m->z - pos)) {
+      n = (size_t)(m->z - pos);
+    }
+    wuffs_base__status status = (*callback)(
+        context, m->w, pos,
+        wuffs_base__make_slice_u8(wuffs_base__io_buffer__reader_pointer(src),
+                                  n));
+    if (status.repr) {
+      return status;
+    }
+    src->meta.ri += n;
+  }
+}
+
+// wuffs_base__metadata_reader is a pull-style alternative to a
+// wuffs_base__metadata_chunk_func callback. A generated
+// wuffs_foo__bar__read_metadata_chunk function sets its fourcc, io_position
+// and chunk fields to the next chunk of metadata. The chunk's bytes alias src
+// (no memory is allocated) and are only valid until src is next modified.
+//
+// The minfo field holds the tell_me_more state. Callers should not modify it,
+// other than to read an "I/O seek" position after a "$mispositioned read".
+typedef struct wuffs_base__metadata_reader__struct {
+  uint32_t fourcc;
+  uint64_t io_position;
+  wuffs_base__slice_u8 chunk;
+  wuffs_base__more_information minfo;
+} wuffs_base__metadata_reader;
+
+static inline wuffs_base__metadata_reader  //
+wuffs_base__empty_metadata_reader() {
+  wuffs_base__metadata_reader ret;
+  ret.fourcc = 0;
+  ret.io_position = 0;
+  ret.chunk = wuffs_base__empty_slice_u8();
+  ret.minfo = wuffs_base__empty_more_information();
+  return ret;
+}
+
+// wuffs_base__metadata_reader__next_chunk advances src's read index past r's
+// previous chunk, if src still holds it, and then sets r's chunk to the bytes
+// of src that lie within r's minfo's range. The chunk is empty if r's minfo
+// does not have the METADATA flavor or if src's reader position is outside of
+// that range.
+//
+// Like wuffs_base__more_information__deliver_metadata, it returns a "$short
+// read" suspension (or, if src is closed, a "#not enough data" error) if src
+// has no bytes (within that range) left.
+//
+// This is typically called by a generated wuffs_foo__bar__read_metadata_chunk
+// function, which alternates it with calls to wuffs_foo__bar__tell_me_more.
+static inline wuffs_base__status  //
+wuffs_base__metadata_reader__next_chunk(wuffs_base__metadata_reader* r,
+                                        wuffs_base__io_buffer* src) {
+  if (!r) {
+    return wuffs_base__make_status(wuffs_base__error__bad_argument);
+  } else if (!src) {
+    return wuffs_base__make_status(NULL);
+  }
+  if ((r->chunk.len > 0) &&
+      (wuffs_base__io_buffer__reader_position(src) == r->io_position) &&
+      (r->chunk.len <= wuffs_base__io_buffer__reader_length(src))) {
+    src->meta.ri += r->chunk.len;
+  }
+  r->chunk = wuffs_base__empty_slice_u8();
+
+  if (r->minfo.flavor != WUFFS_BASE__MORE_INFORMATION__FLAVOR__METADATA) {
+    return wuffs_base__make_status(NULL);
+  }
+  uint64_t pos = wuffs_base__io_buffer__reader_position(src);
+  if ((pos < r->minfo.y) || (pos >= r->minfo.z)) {
+    return wuffs_base__make_status(NULL);
+  }
+  size_t n = wuffs_base__io_buffer__reader_length(src);
+  if (n == 0) {
+    return wuffs_base__make_status(src->meta.closed
+                                       ? wuffs_base__error__not_enough_data
+                                       : wuffs_base__suspension__short_read);
+  }
+  if (n > (r->minfo.z - pos)) {
+    n = (size_t)(r->minfo.z - pos);
+  }
+  r->fourcc = r->minfo.w;
+  r->io_position = pos;
+  r->chunk =
+      wuffs_base__make_slice_u8(wuffs_base__io_buffer__reader_pointer(src), n);
+  return wuffs_base__make_status(NULL);
+}
+
 // ---------------- Tokens
 
 // wuffs_base__token is an element of a byte stream's tokenization.
@@ -2716,6 +3635,9 @@ typedef struct wuffs_base__token__struct {
 
 } wuffs_base__token;
 
+WUFFS_BASE__STATIC_ASSERT(sizeof(wuffs_base__token) == sizeof(uint64_t),
+                          token_sizeof);
+
 static inline wuffs_base__token  //
 wuffs_base__make_token(uint64_t repr) {
   wuffs_base__token ret;
@@ -3015,6 +3937,14 @@ typedef struct wuffs_base__token_buffer__struct {
 
 } wuffs_base__token_buffer;
 
+WUFFS_BASE__STATIC_ASSERT(offsetof(wuffs_base__token_buffer, meta) ==
+                              sizeof(wuffs_base__slice_token),
+                          token_buffer_meta_offset);
+WUFFS_BASE__STATIC_ASSERT(sizeof(wuffs_base__token_buffer) ==
+                              (sizeof(wuffs_base__slice_token) +
+                               sizeof(wuffs_base__token_buffer_meta)),
+                          token_buffer_sizeof);
+
 static inline wuffs_base__token_buffer  //
 wuffs_base__make_token_buffer(wuffs_base__slice_token data,
                               wuffs_base__token_buffer_meta meta) {
@@ -3271,6 +4201,84 @@ wuffs_base__malloc_slice_u64(void* (*malloc_func)(size_t), uint64_t num_u64) {
   return wuffs_base__make_slice_u64(NULL, 0);
 }
 
+// --------
+
+// wuffs_base__allocator is a memory allocator: a pair of function pointers
+// and the userdata passed to them. It lets embedded users supply arena or pool
+// allocators to the wuffs_foo__bar__alloc_with functions, which wuffs-c
+// generates when given the -allocator flag.
+//
+// The alloc function returns a pointer to len bytes (or NULL on failure).
+// That memory does not have to be zeroed. The free function releases what
+// alloc returned, and is never passed a NULL ptr.
+typedef struct wuffs_base__allocator__struct {
+  void* (*alloc)(void* userdata, size_t len);
+  void (*free)(void* userdata, void* ptr);
+  void* userdata;
+} wuffs_base__allocator;
+
+static inline void*  //
+wuffs_base__default_allocator__alloc(void* userdata, size_t len) {
+  return malloc(len);
+}
+
+static inline void  //
+wuffs_base__default_allocator__free(void* userdata, void* ptr) {
+  free(ptr);
+}
+
+// wuffs_base__default_allocator returns an allocator that calls the C
+// stdlib's malloc and free. A NULL allocator argument to the functions below,
+// or to the generated alloc_with functions, means this default allocator.
+static inline const wuffs_base__allocator*  //
+wuffs_base__default_allocator() {
+  static const wuffs_base__allocator a = {
+      &wuffs_base__default_allocator__alloc,
+      &wuffs_base__default_allocator__free,
+      NULL,
+  };
+  return &a;
+}
+
+static inline void*  //
+wuffs_base__allocator__alloc(const wuffs_base__allocator* a, size_t len) {
+  if (!a) {
+    a = wuffs_base__default_allocator();
+  }
+  return (*a->alloc)(a->userdata, len);
+}
+
+// wuffs_base__allocator__free frees ptr, which must have been returned by the
+// same allocator (or by an alloc_with function given that allocator). It is a
+// no-op if ptr is NULL.
+static inline void  //
+wuffs_base__allocator__free(const wuffs_base__allocator* a, void* ptr) {
+  if (!ptr) {
+    return;
+  }
+  if (!a) {
+    a = wuffs_base__default_allocator();
+  }
+  (*a->free)(a->userdata, ptr);
+}
+
+#if defined(__cplusplus) && defined(WUFFS_BASE__HAVE_UNIQUE_PTR)
+// wuffs_base__allocator__deleter is a std::unique_ptr deleter that frees via
+// a wuffs_base__allocator. The C++ alloc_with methods return a
+// std::unique_ptr<T, wuffs_base__allocator__deleter>.
+struct wuffs_base__allocator__deleter {
+  explicit wuffs_base__allocator__deleter(
+      const wuffs_base__allocator* allocator = nullptr)
+      : m_allocator(allocator) {}
+
+  void operator()(void* ptr) const {
+    wuffs_base__allocator__free(m_allocator, ptr);
+  }
+
+  const wuffs_base__allocator* m_allocator;
+};
+#endif  // defined(__cplusplus) && defined(WUFFS_BASE__HAVE_UNIQUE_PTR)
+
 // ---------------- Images
 
 // wuffs_base__color_u32_argb_premul is an 8 bit per channel premultiplied
@@ -5897,12 +6905,35 @@ struct wuffs_base__token_decoder__struct {
 }  // extern "C"
 #endif
 
+// ---------------- ABI Checks
+
+#if !defined(WUFFS_BASE__ABI_HASH)
+#error "wuffs_adler32 needs a newer wuffs_base"
+#endif
+WUFFS_BASE__STATIC_ASSERT(WUFFS_BASE__ABI_HASH == 0xA5155465,
+    adler32_base_abi_hash);
+
 // ---------------- Status Codes
 
 // ---------------- Public Consts
 
 // ---------------- Struct Declarations
 
+// Memory ownership: Wuffs structs never hold pointers to caller-owned
+// memory between calls, as their fields cannot be pointers, slices, tables
+// or I/O types. Instead, the caller owns every buffer and each method
+// borrows its pointer-containing arguments, listed below per struct, for:
+//  - "until return": the duration of that one call.
+//  - "until complete": for a coroutine, until it returns a status that is
+//    not a suspension. Resuming a suspended coroutine must pass the same
+//    memory (e.g. the same workbuf, with its contents unmodified).
+//
+// I/O and token buffers are always borrowed "until return": a suspended
+// coroutine can be resumed with different buffers, as long as any data not
+// yet read is still there.
+
+// Memory ownership of wuffs_adler32__hasher:
+//  - update_u32: x until return.
 typedef struct wuffs_adler32__hasher__struct wuffs_adler32__hasher;
 
 #ifdef __cplusplus
@@ -5917,14 +6948,14 @@ extern "C" {
 // Pass sizeof(*self) and WUFFS_VERSION for sizeof_star_self and wuffs_version.
 // Pass 0 (or some combination of WUFFS_INITIALIZE__XXX) for options.
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_adler32__hasher__initialize(
     wuffs_adler32__hasher* self,
     size_t sizeof_star_self,
     uint64_t wuffs_version,
     uint32_t options);
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_adler32__hasher();
 
 // ---------------- Allocs
@@ -5935,7 +6966,7 @@ sizeof__wuffs_adler32__hasher();
 // calling free on the returned pointer. That pointer is effectively a C++
 // std::unique_ptr<T, decltype(&free)>.
 
-wuffs_adler32__hasher*
+WUFFS_BASE__MAYBE_STATIC wuffs_adler32__hasher*
 wuffs_adler32__hasher__alloc();
 
 static inline wuffs_base__hasher_u32*
@@ -5957,12 +6988,14 @@ WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_adler32__hasher__set_quirk_enabled(
     wuffs_adler32__hasher* self,
     uint32_t a_quirk,
-    bool a_enabled);
+    bool a_enabled)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC uint32_t
 wuffs_adler32__hasher__update_u32(
     wuffs_adler32__hasher* self,
-    wuffs_base__slice_u8 a_x);
+    wuffs_base__slice_u8 a_x)
+WUFFS_BASE__REQUIRES(self);
 
 #ifdef __cplusplus
 }  // extern "C"
@@ -5977,7 +7010,7 @@ wuffs_adler32__hasher__update_u32(
 
 #if defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
-struct wuffs_adler32__hasher__struct {
+struct WUFFS_BASE__CAPABILITY wuffs_adler32__hasher__struct {
   // Do not access the private_impl's or private_data's fields directly. There
   // is no API/ABI compatibility or safety guarantee if you do so. Instead, use
   // the wuffs_foo__bar__baz functions.
@@ -5990,6 +7023,7 @@ struct wuffs_adler32__hasher__struct {
     uint32_t active_coroutine;
     wuffs_base__vtable vtable_for__wuffs_base__hasher_u32;
     wuffs_base__vtable null_vtable;
+    uint32_t avoid_cpu_arch;
 
     uint32_t f_state;
     bool f_started;
@@ -6064,13 +7098,13 @@ struct wuffs_adler32__hasher__struct {
   inline wuffs_base__empty_struct
   set_quirk_enabled(
       uint32_t a_quirk,
-      bool a_enabled) {
+      bool a_enabled) WUFFS_BASE__REQUIRES(this) {
     return wuffs_adler32__hasher__set_quirk_enabled(this, a_quirk, a_enabled);
   }
 
   inline uint32_t
   update_u32(
-      wuffs_base__slice_u8 a_x) {
+      wuffs_base__slice_u8 a_x) WUFFS_BASE__REQUIRES(this) {
     return wuffs_adler32__hasher__update_u32(this, a_x);
   }
 
@@ -6079,6 +7113,14 @@ struct wuffs_adler32__hasher__struct {
 
 #endif  // defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
+// ---------------- ABI Checks
+
+#if !defined(WUFFS_BASE__ABI_HASH)
+#error "wuffs_bmp needs a newer wuffs_base"
+#endif
+WUFFS_BASE__STATIC_ASSERT(WUFFS_BASE__ABI_HASH == 0xA5155465,
+    bmp_base_abi_hash);
+
 // ---------------- Status Codes
 
 extern const char wuffs_bmp__error__bad_header[];
@@ -6091,6 +7133,24 @@ extern const char wuffs_bmp__error__unsupported_bmp_file[];
 
 // ---------------- Struct Declarations
 
+// Memory ownership: Wuffs structs never hold pointers to caller-owned
+// memory between calls, as their fields cannot be pointers, slices, tables
+// or I/O types. Instead, the caller owns every buffer and each method
+// borrows its pointer-containing arguments, listed below per struct, for:
+//  - "until return": the duration of that one call.
+//  - "until complete": for a coroutine, until it returns a status that is
+//    not a suspension. Resuming a suspended coroutine must pass the same
+//    memory (e.g. the same workbuf, with its contents unmodified).
+//
+// I/O and token buffers are always borrowed "until return": a suspended
+// coroutine can be resumed with different buffers, as long as any data not
+// yet read is still there.
+
+// Memory ownership of wuffs_bmp__decoder:
+//  - decode_image_config: dst until complete; src until return.
+//  - decode_frame_config: dst until complete; src until return.
+//  - decode_frame: dst, workbuf, opts until complete; src until return.
+//  - tell_me_more: minfo until complete; dst, src until return.
 typedef struct wuffs_bmp__decoder__struct wuffs_bmp__decoder;
 
 #ifdef __cplusplus
@@ -6105,14 +7165,14 @@ extern "C" {
 // Pass sizeof(*self) and WUFFS_VERSION for sizeof_star_self and wuffs_version.
 // Pass 0 (or some combination of WUFFS_INITIALIZE__XXX) for options.
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_bmp__decoder__initialize(
     wuffs_bmp__decoder* self,
     size_t sizeof_star_self,
     uint64_t wuffs_version,
     uint32_t options);
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_bmp__decoder();
 
 // ---------------- Allocs
@@ -6123,7 +7183,7 @@ sizeof__wuffs_bmp__decoder();
 // calling free on the returned pointer. That pointer is effectively a C++
 // std::unique_ptr<T, decltype(&free)>.
 
-wuffs_bmp__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_bmp__decoder*
 wuffs_bmp__decoder__alloc();
 
 static inline wuffs_base__image_decoder*
@@ -6145,19 +7205,22 @@ WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_bmp__decoder__set_quirk_enabled(
     wuffs_bmp__decoder* self,
     uint32_t a_quirk,
-    bool a_enabled);
+    bool a_enabled)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_bmp__decoder__decode_image_config(
     wuffs_bmp__decoder* self,
     wuffs_base__image_config* a_dst,
-    wuffs_base__io_buffer* a_src);
+    wuffs_base__io_buffer* a_src)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_bmp__decoder__decode_frame_config(
     wuffs_bmp__decoder* self,
     wuffs_base__frame_config* a_dst,
-    wuffs_base__io_buffer* a_src);
+    wuffs_base__io_buffer* a_src)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_bmp__decoder__decode_frame(
@@ -6166,45 +7229,153 @@ wuffs_bmp__decoder__decode_frame(
     wuffs_base__io_buffer* a_src,
     wuffs_base__pixel_blend a_blend,
     wuffs_base__slice_u8 a_workbuf,
-    wuffs_base__decode_frame_options* a_opts);
+    wuffs_base__decode_frame_options* a_opts)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__rect_ie_u32
 wuffs_bmp__decoder__frame_dirty_rect(
-    const wuffs_bmp__decoder* self);
+    const wuffs_bmp__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC uint32_t
 wuffs_bmp__decoder__num_animation_loops(
-    const wuffs_bmp__decoder* self);
+    const wuffs_bmp__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_bmp__decoder__num_decoded_frame_configs(
-    const wuffs_bmp__decoder* self);
+    const wuffs_bmp__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_bmp__decoder__num_decoded_frames(
-    const wuffs_bmp__decoder* self);
+    const wuffs_bmp__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_bmp__decoder__restart_frame(
     wuffs_bmp__decoder* self,
     uint64_t a_index,
-    uint64_t a_io_position);
+    uint64_t a_io_position)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_bmp__decoder__set_report_metadata(
     wuffs_bmp__decoder* self,
     uint32_t a_fourcc,
-    bool a_report);
+    bool a_report)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_bmp__decoder__tell_me_more(
     wuffs_bmp__decoder* self,
     wuffs_base__io_buffer* a_dst,
     wuffs_base__more_information* a_minfo,
-    wuffs_base__io_buffer* a_src);
+    wuffs_base__io_buffer* a_src)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_bmp__decoder__workbuf_len(
+    const wuffs_bmp__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
+
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+// wuffs_bmp__status_http_code returns a suggested HTTP response status code
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_bmp__status_http_code(const char* repr);
+
+// wuffs_bmp__status_errno returns a suggested errno value
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_bmp__status_errno(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+#define WUFFS_BMP__STATUS_ENUM__MAX_INCL 4
+
+#define WUFFS_BMP__STATUS_ENUM__ERROR__BAD_HEADER 1
+#define WUFFS_BMP__STATUS_ENUM__ERROR__BAD_RLE_COMPRESSION 2
+#define WUFFS_BMP__STATUS_ENUM__ERROR__UNSUPPORTED_BMP_FILE 3
+#define WUFFS_BMP__STATUS_ENUM__NOTE__INTERNAL_NOTE_SHORT_READ 4
+
+// wuffs_bmp__status__from_enum returns the status repr for one of the
+// WUFFS_BMP__STATUS_ENUM__ETC values, or NULL if e is out of range.
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_bmp__status__from_enum(uint32_t e);
+
+// wuffs_bmp__status__to_enum returns the WUFFS_BMP__STATUS_ENUM__ETC value
+// for a string equal to one of this package's status reprs, or 0.
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_bmp__status__to_enum(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+// ---------------- Metadata Visitors
+
+// wuffs_foo__bar__visit_metadata passes the metadata that
+// wuffs_foo__bar__tell_me_more reports, such as an ICC profile or XMP, to
+// callback in chunks, as the metadata is decoded. Call it after a decode
+// method returns a "@metadata reported" note, with a minfo that starts as
+// wuffs_base__empty_more_information(). It returns OK once that metadata is
+// exhausted. Like tell_me_more, it can also return a suspension status (such
+// as "$short read") and, after the caller addresses it (such as by
+// re-filling src or, for "$mispositioned read", seeking to the minfo's I/O
+// position), it should be called again with the same minfo.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_bmp__decoder__visit_metadata(
+    wuffs_bmp__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__more_information* a_minfo,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__metadata_chunk_func a_callback,
+    void* a_context);
+
+// wuffs_foo__bar__read_metadata_chunk sets reader's chunk to the next chunk
+// of the metadata that wuffs_foo__bar__tell_me_more reports. Call it after a
+// decode method returns a "@metadata reported" note, with a reader that
+// starts as wuffs_base__empty_metadata_reader(), and keep calling it (without
+// otherwise reading from src) while it returns OK with a non-empty chunk. OK
+// with an empty chunk means that that metadata is exhausted. Like
+// visit_metadata, it can also return a suspension status and, after the
+// caller addresses it, it should be called again with the same reader.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_bmp__decoder__read_metadata_chunk(
+    wuffs_bmp__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__metadata_reader* a_reader,
+    wuffs_base__io_buffer* a_src);
+
+// ---------------- Probes
+
+// wuffs_foo__bar__probe is the first pass of a two-pass decode. It calls the
+// header-only method (the Wuffs code's "probe" method, such as
+// decode_image_config) that needs no workbuf. Once that returns OK, it also
+// sets *a_workbuf_len (if a_workbuf_len is non-NULL) to the workbuf_len, so
+// that the caller can allocate the workbuf for the second pass. Like that
+// method, it can return a suspension status (such as "$short read") and,
+// after the caller addresses it, it should be called again.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_bmp__decoder__probe(
+    wuffs_bmp__decoder* self,
+    wuffs_base__image_config* a_dst,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__range_ii_u64* a_workbuf_len);
+
+// ---------------- Telemetry
+
+// wuffs_foo__bar__telemetry returns the counters, summed over all of the
+// public coroutine method calls since self was initialized. They are all
+// zero unless WUFFS_CONFIG__TELEMETRY is defined. See wuffs_base__telemetry.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_bmp__decoder__telemetry(
     const wuffs_bmp__decoder* self);
 
 #ifdef __cplusplus
@@ -6220,7 +7391,7 @@ wuffs_bmp__decoder__workbuf_len(
 
 #if defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
-struct wuffs_bmp__decoder__struct {
+struct WUFFS_BASE__CAPABILITY wuffs_bmp__decoder__struct {
   // Do not access the private_impl's or private_data's fields directly. There
   // is no API/ABI compatibility or safety guarantee if you do so. Instead, use
   // the wuffs_foo__bar__baz functions.
@@ -6233,6 +7404,9 @@ struct wuffs_bmp__decoder__struct {
     uint32_t active_coroutine;
     wuffs_base__vtable vtable_for__wuffs_base__image_decoder;
     wuffs_base__vtable null_vtable;
+#if defined(WUFFS_CONFIG__TELEMETRY)
+    wuffs_base__telemetry telemetry;
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
 
     uint32_t f_width;
     uint32_t f_height;
@@ -6348,21 +7522,21 @@ struct wuffs_bmp__decoder__struct {
   inline wuffs_base__empty_struct
   set_quirk_enabled(
       uint32_t a_quirk,
-      bool a_enabled) {
+      bool a_enabled) WUFFS_BASE__REQUIRES(this) {
     return wuffs_bmp__decoder__set_quirk_enabled(this, a_quirk, a_enabled);
   }
 
   inline wuffs_base__status
   decode_image_config(
       wuffs_base__image_config* a_dst,
-      wuffs_base__io_buffer* a_src) {
+      wuffs_base__io_buffer* a_src) WUFFS_BASE__REQUIRES(this) {
     return wuffs_bmp__decoder__decode_image_config(this, a_dst, a_src);
   }
 
   inline wuffs_base__status
   decode_frame_config(
       wuffs_base__frame_config* a_dst,
-      wuffs_base__io_buffer* a_src) {
+      wuffs_base__io_buffer* a_src) WUFFS_BASE__REQUIRES(this) {
     return wuffs_bmp__decoder__decode_frame_config(this, a_dst, a_src);
   }
 
@@ -6372,41 +7546,41 @@ struct wuffs_bmp__decoder__struct {
       wuffs_base__io_buffer* a_src,
       wuffs_base__pixel_blend a_blend,
       wuffs_base__slice_u8 a_workbuf,
-      wuffs_base__decode_frame_options* a_opts) {
+      wuffs_base__decode_frame_options* a_opts) WUFFS_BASE__REQUIRES(this) {
     return wuffs_bmp__decoder__decode_frame(this, a_dst, a_src, a_blend, a_workbuf, a_opts);
   }
 
   inline wuffs_base__rect_ie_u32
-  frame_dirty_rect() const {
+  frame_dirty_rect() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_bmp__decoder__frame_dirty_rect(this);
   }
 
   inline uint32_t
-  num_animation_loops() const {
+  num_animation_loops() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_bmp__decoder__num_animation_loops(this);
   }
 
   inline uint64_t
-  num_decoded_frame_configs() const {
+  num_decoded_frame_configs() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_bmp__decoder__num_decoded_frame_configs(this);
   }
 
   inline uint64_t
-  num_decoded_frames() const {
+  num_decoded_frames() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_bmp__decoder__num_decoded_frames(this);
   }
 
   inline wuffs_base__status
   restart_frame(
       uint64_t a_index,
-      uint64_t a_io_position) {
+      uint64_t a_io_position) WUFFS_BASE__REQUIRES(this) {
     return wuffs_bmp__decoder__restart_frame(this, a_index, a_io_position);
   }
 
   inline wuffs_base__empty_struct
   set_report_metadata(
       uint32_t a_fourcc,
-      bool a_report) {
+      bool a_report) WUFFS_BASE__REQUIRES(this) {
     return wuffs_bmp__decoder__set_report_metadata(this, a_fourcc, a_report);
   }
 
@@ -6414,20 +7588,62 @@ struct wuffs_bmp__decoder__struct {
   tell_me_more(
       wuffs_base__io_buffer* a_dst,
       wuffs_base__more_information* a_minfo,
-      wuffs_base__io_buffer* a_src) {
+      wuffs_base__io_buffer* a_src) WUFFS_BASE__REQUIRES(this) {
     return wuffs_bmp__decoder__tell_me_more(this, a_dst, a_minfo, a_src);
   }
 
   inline wuffs_base__range_ii_u64
-  workbuf_len() const {
+  workbuf_len() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_bmp__decoder__workbuf_len(this);
   }
 
+  inline wuffs_base__status
+  visit_metadata(
+      wuffs_base__io_buffer* a_dst,
+      wuffs_base__more_information* a_minfo,
+      wuffs_base__io_buffer* a_src,
+      wuffs_base__metadata_chunk_func a_callback,
+      void* a_context) {
+    return wuffs_bmp__decoder__visit_metadata(
+        this, a_dst, a_minfo, a_src, a_callback, a_context);
+  }
+
+  inline wuffs_base__status
+  read_metadata_chunk(
+      wuffs_base__io_buffer* a_dst,
+      wuffs_base__metadata_reader* a_reader,
+      wuffs_base__io_buffer* a_src) {
+    return wuffs_bmp__decoder__read_metadata_chunk(
+        this, a_dst, a_reader, a_src);
+  }
+
+  inline wuffs_base__telemetry
+  telemetry() const {
+    return wuffs_bmp__decoder__telemetry(this);
+  }
+
+  inline wuffs_base__status
+  probe(
+      wuffs_base__image_config* a_dst,
+      wuffs_base__io_buffer* a_src,
+      wuffs_base__range_ii_u64* a_workbuf_len) {
+    return wuffs_bmp__decoder__probe(
+        this, a_dst, a_src, a_workbuf_len);
+  }
+
 #endif  // __cplusplus
 };  // struct wuffs_bmp__decoder__struct
 
 #endif  // defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
+// ---------------- ABI Checks
+
+#if !defined(WUFFS_BASE__ABI_HASH)
+#error "wuffs_cbor needs a newer wuffs_base"
+#endif
+WUFFS_BASE__STATIC_ASSERT(WUFFS_BASE__ABI_HASH == 0xA5155465,
+    cbor_base_abi_hash);
+
 // ---------------- Status Codes
 
 extern const char wuffs_cbor__error__bad_input[];
@@ -6455,6 +7671,21 @@ extern const char wuffs_cbor__error__unsupported_recursion_depth[];
 
 // ---------------- Struct Declarations
 
+// Memory ownership: Wuffs structs never hold pointers to caller-owned
+// memory between calls, as their fields cannot be pointers, slices, tables
+// or I/O types. Instead, the caller owns every buffer and each method
+// borrows its pointer-containing arguments, listed below per struct, for:
+//  - "until return": the duration of that one call.
+//  - "until complete": for a coroutine, until it returns a status that is
+//    not a suspension. Resuming a suspended coroutine must pass the same
+//    memory (e.g. the same workbuf, with its contents unmodified).
+//
+// I/O and token buffers are always borrowed "until return": a suspended
+// coroutine can be resumed with different buffers, as long as any data not
+// yet read is still there.
+
+// Memory ownership of wuffs_cbor__decoder:
+//  - decode_tokens: workbuf until complete; dst, src until return.
 typedef struct wuffs_cbor__decoder__struct wuffs_cbor__decoder;
 
 #ifdef __cplusplus
@@ -6469,14 +7700,14 @@ extern "C" {
 // Pass sizeof(*self) and WUFFS_VERSION for sizeof_star_self and wuffs_version.
 // Pass 0 (or some combination of WUFFS_INITIALIZE__XXX) for options.
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_cbor__decoder__initialize(
     wuffs_cbor__decoder* self,
     size_t sizeof_star_self,
     uint64_t wuffs_version,
     uint32_t options);
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_cbor__decoder();
 
 // ---------------- Allocs
@@ -6487,7 +7718,7 @@ sizeof__wuffs_cbor__decoder();
 // calling free on the returned pointer. That pointer is effectively a C++
 // std::unique_ptr<T, decltype(&free)>.
 
-wuffs_cbor__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_cbor__decoder*
 wuffs_cbor__decoder__alloc();
 
 static inline wuffs_base__token_decoder*
@@ -6509,18 +7740,83 @@ WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_cbor__decoder__set_quirk_enabled(
     wuffs_cbor__decoder* self,
     uint32_t a_quirk,
-    bool a_enabled);
+    bool a_enabled)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_cbor__decoder__workbuf_len(
-    const wuffs_cbor__decoder* self);
+    const wuffs_cbor__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_cbor__decoder__decode_tokens(
     wuffs_cbor__decoder* self,
     wuffs_base__token_buffer* a_dst,
     wuffs_base__io_buffer* a_src,
-    wuffs_base__slice_u8 a_workbuf);
+    wuffs_base__slice_u8 a_workbuf)
+WUFFS_BASE__REQUIRES(self);
+
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+// wuffs_cbor__status_http_code returns a suggested HTTP response status code
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_cbor__status_http_code(const char* repr);
+
+// wuffs_cbor__status_errno returns a suggested errno value
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_cbor__status_errno(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+#define WUFFS_CBOR__STATUS_ENUM__MAX_INCL 4
+
+#define WUFFS_CBOR__STATUS_ENUM__ERROR__BAD_INPUT 1
+#define WUFFS_CBOR__STATUS_ENUM__ERROR__UNSUPPORTED_RECURSION_DEPTH 2
+#define WUFFS_CBOR__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_I_O 3
+#define WUFFS_CBOR__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_TOKEN_LENGTH 4
+
+// wuffs_cbor__status__from_enum returns the status repr for one of the
+// WUFFS_CBOR__STATUS_ENUM__ETC values, or NULL if e is out of range.
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_cbor__status__from_enum(uint32_t e);
+
+// wuffs_cbor__status__to_enum returns the WUFFS_CBOR__STATUS_ENUM__ETC value
+// for a string equal to one of this package's status reprs, or 0.
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_cbor__status__to_enum(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+// ---------------- Token Batches
+
+// wuffs_foo__bar__decode_tokens_batch is like decode_tokens but, when it
+// returns a "$short write" suspension, it also sets *a_tokens_needed (if
+// a_tokens_needed is non-NULL) to how many tokens the decoder needs room for
+// (in a_dst->data.len - a_dst->meta.wi) to make progress. The caller can then
+// compact or grow a_dst by enough before calling it again, instead of
+// guessing. For other statuses, it sets *a_tokens_needed to zero.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_cbor__decoder__decode_tokens_batch(
+    wuffs_cbor__decoder* self,
+    wuffs_base__token_buffer* a_dst,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__slice_u8 a_workbuf,
+    uint64_t* a_tokens_needed);
+
+// ---------------- Telemetry
+
+// wuffs_foo__bar__telemetry returns the counters, summed over all of the
+// public coroutine method calls since self was initialized. They are all
+// zero unless WUFFS_CONFIG__TELEMETRY is defined. See wuffs_base__telemetry.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_cbor__decoder__telemetry(
+    const wuffs_cbor__decoder* self);
 
 #ifdef __cplusplus
 }  // extern "C"
@@ -6535,7 +7831,7 @@ wuffs_cbor__decoder__decode_tokens(
 
 #if defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
-struct wuffs_cbor__decoder__struct {
+struct WUFFS_BASE__CAPABILITY wuffs_cbor__decoder__struct {
   // Do not access the private_impl's or private_data's fields directly. There
   // is no API/ABI compatibility or safety guarantee if you do so. Instead, use
   // the wuffs_foo__bar__baz functions.
@@ -6548,6 +7844,10 @@ struct wuffs_cbor__decoder__struct {
     uint32_t active_coroutine;
     wuffs_base__vtable vtable_for__wuffs_base__token_decoder;
     wuffs_base__vtable null_vtable;
+#if defined(WUFFS_CONFIG__TELEMETRY)
+    wuffs_base__telemetry telemetry;
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
+    uint64_t tokens_needed;
 
     bool f_end_of_data;
 
@@ -6632,12 +7932,12 @@ struct wuffs_cbor__decoder__struct {
   inline wuffs_base__empty_struct
   set_quirk_enabled(
       uint32_t a_quirk,
-      bool a_enabled) {
+      bool a_enabled) WUFFS_BASE__REQUIRES(this) {
     return wuffs_cbor__decoder__set_quirk_enabled(this, a_quirk, a_enabled);
   }
 
   inline wuffs_base__range_ii_u64
-  workbuf_len() const {
+  workbuf_len() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_cbor__decoder__workbuf_len(this);
   }
 
@@ -6645,21 +7945,59 @@ struct wuffs_cbor__decoder__struct {
   decode_tokens(
       wuffs_base__token_buffer* a_dst,
       wuffs_base__io_buffer* a_src,
-      wuffs_base__slice_u8 a_workbuf) {
+      wuffs_base__slice_u8 a_workbuf) WUFFS_BASE__REQUIRES(this) {
     return wuffs_cbor__decoder__decode_tokens(this, a_dst, a_src, a_workbuf);
   }
 
+  inline wuffs_base__telemetry
+  telemetry() const {
+    return wuffs_cbor__decoder__telemetry(this);
+  }
+
+  inline wuffs_base__status
+  decode_tokens_batch(
+      wuffs_base__token_buffer* a_dst,
+      wuffs_base__io_buffer* a_src,
+      wuffs_base__slice_u8 a_workbuf,
+      uint64_t* a_tokens_needed) {
+    return wuffs_cbor__decoder__decode_tokens_batch(
+        this, a_dst, a_src, a_workbuf, a_tokens_needed);
+  }
+
 #endif  // __cplusplus
 };  // struct wuffs_cbor__decoder__struct
 
 #endif  // defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
+// ---------------- ABI Checks
+
+#if !defined(WUFFS_BASE__ABI_HASH)
+#error "wuffs_crc32 needs a newer wuffs_base"
+#endif
+WUFFS_BASE__STATIC_ASSERT(WUFFS_BASE__ABI_HASH == 0xA5155465,
+    crc32_base_abi_hash);
+
 // ---------------- Status Codes
 
 // ---------------- Public Consts
 
 // ---------------- Struct Declarations
 
+// Memory ownership: Wuffs structs never hold pointers to caller-owned
+// memory between calls, as their fields cannot be pointers, slices, tables
+// or I/O types. Instead, the caller owns every buffer and each method
+// borrows its pointer-containing arguments, listed below per struct, for:
+//  - "until return": the duration of that one call.
+//  - "until complete": for a coroutine, until it returns a status that is
+//    not a suspension. Resuming a suspended coroutine must pass the same
+//    memory (e.g. the same workbuf, with its contents unmodified).
+//
+// I/O and token buffers are always borrowed "until return": a suspended
+// coroutine can be resumed with different buffers, as long as any data not
+// yet read is still there.
+
+// Memory ownership of wuffs_crc32__ieee_hasher:
+//  - update_u32: x until return.
 typedef struct wuffs_crc32__ieee_hasher__struct wuffs_crc32__ieee_hasher;
 
 #ifdef __cplusplus
@@ -6674,14 +8012,14 @@ extern "C" {
 // Pass sizeof(*self) and WUFFS_VERSION for sizeof_star_self and wuffs_version.
 // Pass 0 (or some combination of WUFFS_INITIALIZE__XXX) for options.
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_crc32__ieee_hasher__initialize(
     wuffs_crc32__ieee_hasher* self,
     size_t sizeof_star_self,
     uint64_t wuffs_version,
     uint32_t options);
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_crc32__ieee_hasher();
 
 // ---------------- Allocs
@@ -6692,7 +8030,7 @@ sizeof__wuffs_crc32__ieee_hasher();
 // calling free on the returned pointer. That pointer is effectively a C++
 // std::unique_ptr<T, decltype(&free)>.
 
-wuffs_crc32__ieee_hasher*
+WUFFS_BASE__MAYBE_STATIC wuffs_crc32__ieee_hasher*
 wuffs_crc32__ieee_hasher__alloc();
 
 static inline wuffs_base__hasher_u32*
@@ -6714,12 +8052,14 @@ WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_crc32__ieee_hasher__set_quirk_enabled(
     wuffs_crc32__ieee_hasher* self,
     uint32_t a_quirk,
-    bool a_enabled);
+    bool a_enabled)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC uint32_t
 wuffs_crc32__ieee_hasher__update_u32(
     wuffs_crc32__ieee_hasher* self,
-    wuffs_base__slice_u8 a_x);
+    wuffs_base__slice_u8 a_x)
+WUFFS_BASE__REQUIRES(self);
 
 #ifdef __cplusplus
 }  // extern "C"
@@ -6734,7 +8074,7 @@ wuffs_crc32__ieee_hasher__update_u32(
 
 #if defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
-struct wuffs_crc32__ieee_hasher__struct {
+struct WUFFS_BASE__CAPABILITY wuffs_crc32__ieee_hasher__struct {
   // Do not access the private_impl's or private_data's fields directly. There
   // is no API/ABI compatibility or safety guarantee if you do so. Instead, use
   // the wuffs_foo__bar__baz functions.
@@ -6747,6 +8087,7 @@ struct wuffs_crc32__ieee_hasher__struct {
     uint32_t active_coroutine;
     wuffs_base__vtable vtable_for__wuffs_base__hasher_u32;
     wuffs_base__vtable null_vtable;
+    uint32_t avoid_cpu_arch;
 
     uint32_t f_state;
 
@@ -6820,13 +8161,13 @@ struct wuffs_crc32__ieee_hasher__struct {
   inline wuffs_base__empty_struct
   set_quirk_enabled(
       uint32_t a_quirk,
-      bool a_enabled) {
+      bool a_enabled) WUFFS_BASE__REQUIRES(this) {
     return wuffs_crc32__ieee_hasher__set_quirk_enabled(this, a_quirk, a_enabled);
   }
 
   inline uint32_t
   update_u32(
-      wuffs_base__slice_u8 a_x) {
+      wuffs_base__slice_u8 a_x) WUFFS_BASE__REQUIRES(this) {
     return wuffs_crc32__ieee_hasher__update_u32(this, a_x);
   }
 
@@ -6835,6 +8176,14 @@ struct wuffs_crc32__ieee_hasher__struct {
 
 #endif  // defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
+// ---------------- ABI Checks
+
+#if !defined(WUFFS_BASE__ABI_HASH)
+#error "wuffs_deflate needs a newer wuffs_base"
+#endif
+WUFFS_BASE__STATIC_ASSERT(WUFFS_BASE__ABI_HASH == 0xA5155465,
+    deflate_base_abi_hash);
+
 // ---------------- Status Codes
 
 extern const char wuffs_deflate__error__bad_huffman_code_over_subscribed[];
@@ -6857,6 +8206,22 @@ extern const char wuffs_deflate__error__no_huffman_codes[];
 
 // ---------------- Struct Declarations
 
+// Memory ownership: Wuffs structs never hold pointers to caller-owned
+// memory between calls, as their fields cannot be pointers, slices, tables
+// or I/O types. Instead, the caller owns every buffer and each method
+// borrows its pointer-containing arguments, listed below per struct, for:
+//  - "until return": the duration of that one call.
+//  - "until complete": for a coroutine, until it returns a status that is
+//    not a suspension. Resuming a suspended coroutine must pass the same
+//    memory (e.g. the same workbuf, with its contents unmodified).
+//
+// I/O and token buffers are always borrowed "until return": a suspended
+// coroutine can be resumed with different buffers, as long as any data not
+// yet read is still there.
+
+// Memory ownership of wuffs_deflate__decoder:
+//  - add_history: hist until return.
+//  - transform_io: workbuf until complete; dst, src until return.
 typedef struct wuffs_deflate__decoder__struct wuffs_deflate__decoder;
 
 #ifdef __cplusplus
@@ -6871,14 +8236,14 @@ extern "C" {
 // Pass sizeof(*self) and WUFFS_VERSION for sizeof_star_self and wuffs_version.
 // Pass 0 (or some combination of WUFFS_INITIALIZE__XXX) for options.
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_deflate__decoder__initialize(
     wuffs_deflate__decoder* self,
     size_t sizeof_star_self,
     uint64_t wuffs_version,
     uint32_t options);
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_deflate__decoder();
 
 // ---------------- Allocs
@@ -6889,7 +8254,7 @@ sizeof__wuffs_deflate__decoder();
 // calling free on the returned pointer. That pointer is effectively a C++
 // std::unique_ptr<T, decltype(&free)>.
 
-wuffs_deflate__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_deflate__decoder*
 wuffs_deflate__decoder__alloc();
 
 static inline wuffs_base__io_transformer*
@@ -6910,24 +8275,86 @@ wuffs_deflate__decoder__upcast_as__wuffs_base__io_transformer(
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_deflate__decoder__add_history(
     wuffs_deflate__decoder* self,
-    wuffs_base__slice_u8 a_hist);
+    wuffs_base__slice_u8 a_hist)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_deflate__decoder__set_quirk_enabled(
     wuffs_deflate__decoder* self,
     uint32_t a_quirk,
-    bool a_enabled);
+    bool a_enabled)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_deflate__decoder__workbuf_len(
-    const wuffs_deflate__decoder* self);
+    const wuffs_deflate__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_deflate__decoder__transform_io(
     wuffs_deflate__decoder* self,
     wuffs_base__io_buffer* a_dst,
     wuffs_base__io_buffer* a_src,
-    wuffs_base__slice_u8 a_workbuf);
+    wuffs_base__slice_u8 a_workbuf)
+WUFFS_BASE__REQUIRES(self);
+
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+// wuffs_deflate__status_http_code returns a suggested HTTP response status code
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_deflate__status_http_code(const char* repr);
+
+// wuffs_deflate__status_errno returns a suggested errno value
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_deflate__status_errno(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+#define WUFFS_DEFLATE__STATUS_ENUM__MAX_INCL 17
+
+#define WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_HUFFMAN_CODE_OVER_SUBSCRIBED 1
+#define WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_HUFFMAN_CODE_UNDER_SUBSCRIBED 2
+#define WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_HUFFMAN_CODE_LENGTH_COUNT 3
+#define WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_HUFFMAN_CODE_LENGTH_REPETITION 4
+#define WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_HUFFMAN_CODE 5
+#define WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_HUFFMAN_MINIMUM_CODE_LENGTH 6
+#define WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_BLOCK 7
+#define WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_DISTANCE 8
+#define WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_DISTANCE_CODE_COUNT 9
+#define WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_LITERAL_LENGTH_CODE_COUNT 10
+#define WUFFS_DEFLATE__STATUS_ENUM__ERROR__INCONSISTENT_STORED_BLOCK_LENGTH 11
+#define WUFFS_DEFLATE__STATUS_ENUM__ERROR__MISSING_END_OF_BLOCK_CODE 12
+#define WUFFS_DEFLATE__STATUS_ENUM__ERROR__NO_HUFFMAN_CODES 13
+#define WUFFS_DEFLATE__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_HUFFMAN_DECODER_STATE 14
+#define WUFFS_DEFLATE__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_I_O 15
+#define WUFFS_DEFLATE__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_DISTANCE 16
+#define WUFFS_DEFLATE__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_N_BITS 17
+
+// wuffs_deflate__status__from_enum returns the status repr for one of the
+// WUFFS_DEFLATE__STATUS_ENUM__ETC values, or NULL if e is out of range.
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_deflate__status__from_enum(uint32_t e);
+
+// wuffs_deflate__status__to_enum returns the WUFFS_DEFLATE__STATUS_ENUM__ETC value
+// for a string equal to one of this package's status reprs, or 0.
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_deflate__status__to_enum(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+// ---------------- Telemetry
+
+// wuffs_foo__bar__telemetry returns the counters, summed over all of the
+// public coroutine method calls since self was initialized. They are all
+// zero unless WUFFS_CONFIG__TELEMETRY is defined. See wuffs_base__telemetry.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_deflate__decoder__telemetry(
+    const wuffs_deflate__decoder* self);
 
 #ifdef __cplusplus
 }  // extern "C"
@@ -6942,7 +8369,7 @@ wuffs_deflate__decoder__transform_io(
 
 #if defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
-struct wuffs_deflate__decoder__struct {
+struct WUFFS_BASE__CAPABILITY wuffs_deflate__decoder__struct {
   // Do not access the private_impl's or private_data's fields directly. There
   // is no API/ABI compatibility or safety guarantee if you do so. Instead, use
   // the wuffs_foo__bar__baz functions.
@@ -6955,6 +8382,9 @@ struct wuffs_deflate__decoder__struct {
     uint32_t active_coroutine;
     wuffs_base__vtable vtable_for__wuffs_base__io_transformer;
     wuffs_base__vtable null_vtable;
+#if defined(WUFFS_CONFIG__TELEMETRY)
+    wuffs_base__telemetry telemetry;
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
 
     uint32_t f_bits;
     uint32_t f_n_bits;
@@ -7075,19 +8505,19 @@ struct wuffs_deflate__decoder__struct {
 
   inline wuffs_base__empty_struct
   add_history(
-      wuffs_base__slice_u8 a_hist) {
+      wuffs_base__slice_u8 a_hist) WUFFS_BASE__REQUIRES(this) {
     return wuffs_deflate__decoder__add_history(this, a_hist);
   }
 
   inline wuffs_base__empty_struct
   set_quirk_enabled(
       uint32_t a_quirk,
-      bool a_enabled) {
+      bool a_enabled) WUFFS_BASE__REQUIRES(this) {
     return wuffs_deflate__decoder__set_quirk_enabled(this, a_quirk, a_enabled);
   }
 
   inline wuffs_base__range_ii_u64
-  workbuf_len() const {
+  workbuf_len() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_deflate__decoder__workbuf_len(this);
   }
 
@@ -7095,15 +8525,28 @@ struct wuffs_deflate__decoder__struct {
   transform_io(
       wuffs_base__io_buffer* a_dst,
       wuffs_base__io_buffer* a_src,
-      wuffs_base__slice_u8 a_workbuf) {
+      wuffs_base__slice_u8 a_workbuf) WUFFS_BASE__REQUIRES(this) {
     return wuffs_deflate__decoder__transform_io(this, a_dst, a_src, a_workbuf);
   }
 
+  inline wuffs_base__telemetry
+  telemetry() const {
+    return wuffs_deflate__decoder__telemetry(this);
+  }
+
 #endif  // __cplusplus
 };  // struct wuffs_deflate__decoder__struct
 
 #endif  // defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
+// ---------------- ABI Checks
+
+#if !defined(WUFFS_BASE__ABI_HASH)
+#error "wuffs_lzw needs a newer wuffs_base"
+#endif
+WUFFS_BASE__STATIC_ASSERT(WUFFS_BASE__ABI_HASH == 0xA5155465,
+    lzw_base_abi_hash);
+
 // ---------------- Status Codes
 
 extern const char wuffs_lzw__error__bad_code[];
@@ -7114,6 +8557,21 @@ extern const char wuffs_lzw__error__bad_code[];
 
 // ---------------- Struct Declarations
 
+// Memory ownership: Wuffs structs never hold pointers to caller-owned
+// memory between calls, as their fields cannot be pointers, slices, tables
+// or I/O types. Instead, the caller owns every buffer and each method
+// borrows its pointer-containing arguments, listed below per struct, for:
+//  - "until return": the duration of that one call.
+//  - "until complete": for a coroutine, until it returns a status that is
+//    not a suspension. Resuming a suspended coroutine must pass the same
+//    memory (e.g. the same workbuf, with its contents unmodified).
+//
+// I/O and token buffers are always borrowed "until return": a suspended
+// coroutine can be resumed with different buffers, as long as any data not
+// yet read is still there.
+
+// Memory ownership of wuffs_lzw__decoder:
+//  - transform_io: workbuf until complete; dst, src until return.
 typedef struct wuffs_lzw__decoder__struct wuffs_lzw__decoder;
 
 #ifdef __cplusplus
@@ -7128,14 +8586,14 @@ extern "C" {
 // Pass sizeof(*self) and WUFFS_VERSION for sizeof_star_self and wuffs_version.
 // Pass 0 (or some combination of WUFFS_INITIALIZE__XXX) for options.
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_lzw__decoder__initialize(
     wuffs_lzw__decoder* self,
     size_t sizeof_star_self,
     uint64_t wuffs_version,
     uint32_t options);
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_lzw__decoder();
 
 // ---------------- Allocs
@@ -7146,7 +8604,7 @@ sizeof__wuffs_lzw__decoder();
 // calling free on the returned pointer. That pointer is effectively a C++
 // std::unique_ptr<T, decltype(&free)>.
 
-wuffs_lzw__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_lzw__decoder*
 wuffs_lzw__decoder__alloc();
 
 static inline wuffs_base__io_transformer*
@@ -7168,27 +8626,75 @@ WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_lzw__decoder__set_quirk_enabled(
     wuffs_lzw__decoder* self,
     uint32_t a_quirk,
-    bool a_enabled);
+    bool a_enabled)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_lzw__decoder__set_literal_width(
     wuffs_lzw__decoder* self,
-    uint32_t a_lw);
+    uint32_t a_lw)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_lzw__decoder__workbuf_len(
-    const wuffs_lzw__decoder* self);
+    const wuffs_lzw__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_lzw__decoder__transform_io(
     wuffs_lzw__decoder* self,
     wuffs_base__io_buffer* a_dst,
     wuffs_base__io_buffer* a_src,
-    wuffs_base__slice_u8 a_workbuf);
+    wuffs_base__slice_u8 a_workbuf)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__slice_u8
 wuffs_lzw__decoder__flush(
-    wuffs_lzw__decoder* self);
+    wuffs_lzw__decoder* self)
+WUFFS_BASE__REQUIRES(self);
+
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+// wuffs_lzw__status_http_code returns a suggested HTTP response status code
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_lzw__status_http_code(const char* repr);
+
+// wuffs_lzw__status_errno returns a suggested errno value
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_lzw__status_errno(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+#define WUFFS_LZW__STATUS_ENUM__MAX_INCL 2
+
+#define WUFFS_LZW__STATUS_ENUM__ERROR__BAD_CODE 1
+#define WUFFS_LZW__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_I_O 2
+
+// wuffs_lzw__status__from_enum returns the status repr for one of the
+// WUFFS_LZW__STATUS_ENUM__ETC values, or NULL if e is out of range.
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_lzw__status__from_enum(uint32_t e);
+
+// wuffs_lzw__status__to_enum returns the WUFFS_LZW__STATUS_ENUM__ETC value
+// for a string equal to one of this package's status reprs, or 0.
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_lzw__status__to_enum(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+// ---------------- Telemetry
+
+// wuffs_foo__bar__telemetry returns the counters, summed over all of the
+// public coroutine method calls since self was initialized. They are all
+// zero unless WUFFS_CONFIG__TELEMETRY is defined. See wuffs_base__telemetry.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_lzw__decoder__telemetry(
+    const wuffs_lzw__decoder* self);
 
 #ifdef __cplusplus
 }  // extern "C"
@@ -7203,7 +8709,7 @@ wuffs_lzw__decoder__flush(
 
 #if defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
-struct wuffs_lzw__decoder__struct {
+struct WUFFS_BASE__CAPABILITY wuffs_lzw__decoder__struct {
   // Do not access the private_impl's or private_data's fields directly. There
   // is no API/ABI compatibility or safety guarantee if you do so. Instead, use
   // the wuffs_foo__bar__baz functions.
@@ -7216,6 +8722,9 @@ struct wuffs_lzw__decoder__struct {
     uint32_t active_coroutine;
     wuffs_base__vtable vtable_for__wuffs_base__io_transformer;
     wuffs_base__vtable null_vtable;
+#if defined(WUFFS_CONFIG__TELEMETRY)
+    wuffs_base__telemetry telemetry;
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
 
     uint32_t f_set_literal_width_arg;
     uint32_t f_literal_width;
@@ -7306,18 +8815,18 @@ struct wuffs_lzw__decoder__struct {
   inline wuffs_base__empty_struct
   set_quirk_enabled(
       uint32_t a_quirk,
-      bool a_enabled) {
+      bool a_enabled) WUFFS_BASE__REQUIRES(this) {
     return wuffs_lzw__decoder__set_quirk_enabled(this, a_quirk, a_enabled);
   }
 
   inline wuffs_base__empty_struct
   set_literal_width(
-      uint32_t a_lw) {
+      uint32_t a_lw) WUFFS_BASE__REQUIRES(this) {
     return wuffs_lzw__decoder__set_literal_width(this, a_lw);
   }
 
   inline wuffs_base__range_ii_u64
-  workbuf_len() const {
+  workbuf_len() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_lzw__decoder__workbuf_len(this);
   }
 
@@ -7325,20 +8834,33 @@ struct wuffs_lzw__decoder__struct {
   transform_io(
       wuffs_base__io_buffer* a_dst,
       wuffs_base__io_buffer* a_src,
-      wuffs_base__slice_u8 a_workbuf) {
+      wuffs_base__slice_u8 a_workbuf) WUFFS_BASE__REQUIRES(this) {
     return wuffs_lzw__decoder__transform_io(this, a_dst, a_src, a_workbuf);
   }
 
   inline wuffs_base__slice_u8
-  flush() {
+  flush() WUFFS_BASE__REQUIRES(this) {
     return wuffs_lzw__decoder__flush(this);
   }
 
+  inline wuffs_base__telemetry
+  telemetry() const {
+    return wuffs_lzw__decoder__telemetry(this);
+  }
+
 #endif  // __cplusplus
 };  // struct wuffs_lzw__decoder__struct
 
 #endif  // defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
+// ---------------- ABI Checks
+
+#if !defined(WUFFS_BASE__ABI_HASH)
+#error "wuffs_gif needs a newer wuffs_base"
+#endif
+WUFFS_BASE__STATIC_ASSERT(WUFFS_BASE__ABI_HASH == 0xA5155465,
+    gif_base_abi_hash);
+
 // ---------------- Status Codes
 
 extern const char wuffs_gif__error__bad_extension_label[];
@@ -7368,6 +8890,24 @@ extern const char wuffs_gif__error__bad_palette[];
 
 // ---------------- Struct Declarations
 
+// Memory ownership: Wuffs structs never hold pointers to caller-owned
+// memory between calls, as their fields cannot be pointers, slices, tables
+// or I/O types. Instead, the caller owns every buffer and each method
+// borrows its pointer-containing arguments, listed below per struct, for:
+//  - "until return": the duration of that one call.
+//  - "until complete": for a coroutine, until it returns a status that is
+//    not a suspension. Resuming a suspended coroutine must pass the same
+//    memory (e.g. the same workbuf, with its contents unmodified).
+//
+// I/O and token buffers are always borrowed "until return": a suspended
+// coroutine can be resumed with different buffers, as long as any data not
+// yet read is still there.
+
+// Memory ownership of wuffs_gif__decoder:
+//  - decode_image_config: dst until complete; src until return.
+//  - tell_me_more: minfo until complete; dst, src until return.
+//  - decode_frame_config: dst until complete; src until return.
+//  - decode_frame: dst, workbuf, opts until complete; src until return.
 typedef struct wuffs_gif__decoder__struct wuffs_gif__decoder;
 
 #ifdef __cplusplus
@@ -7382,14 +8922,14 @@ extern "C" {
 // Pass sizeof(*self) and WUFFS_VERSION for sizeof_star_self and wuffs_version.
 // Pass 0 (or some combination of WUFFS_INITIALIZE__XXX) for options.
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_gif__decoder__initialize(
     wuffs_gif__decoder* self,
     size_t sizeof_star_self,
     uint64_t wuffs_version,
     uint32_t options);
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_gif__decoder();
 
 // ---------------- Allocs
@@ -7400,7 +8940,7 @@ sizeof__wuffs_gif__decoder();
 // calling free on the returned pointer. That pointer is effectively a C++
 // std::unique_ptr<T, decltype(&free)>.
 
-wuffs_gif__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_gif__decoder*
 wuffs_gif__decoder__alloc();
 
 static inline wuffs_base__image_decoder*
@@ -7422,58 +8962,69 @@ WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_gif__decoder__set_quirk_enabled(
     wuffs_gif__decoder* self,
     uint32_t a_quirk,
-    bool a_enabled);
+    bool a_enabled)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_gif__decoder__decode_image_config(
     wuffs_gif__decoder* self,
     wuffs_base__image_config* a_dst,
-    wuffs_base__io_buffer* a_src);
+    wuffs_base__io_buffer* a_src)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_gif__decoder__set_report_metadata(
     wuffs_gif__decoder* self,
     uint32_t a_fourcc,
-    bool a_report);
+    bool a_report)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_gif__decoder__tell_me_more(
     wuffs_gif__decoder* self,
     wuffs_base__io_buffer* a_dst,
     wuffs_base__more_information* a_minfo,
-    wuffs_base__io_buffer* a_src);
+    wuffs_base__io_buffer* a_src)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC uint32_t
 wuffs_gif__decoder__num_animation_loops(
-    const wuffs_gif__decoder* self);
+    const wuffs_gif__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_gif__decoder__num_decoded_frame_configs(
-    const wuffs_gif__decoder* self);
+    const wuffs_gif__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_gif__decoder__num_decoded_frames(
-    const wuffs_gif__decoder* self);
+    const wuffs_gif__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__rect_ie_u32
 wuffs_gif__decoder__frame_dirty_rect(
-    const wuffs_gif__decoder* self);
+    const wuffs_gif__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_gif__decoder__workbuf_len(
-    const wuffs_gif__decoder* self);
+    const wuffs_gif__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_gif__decoder__restart_frame(
     wuffs_gif__decoder* self,
     uint64_t a_index,
-    uint64_t a_io_position);
+    uint64_t a_io_position)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_gif__decoder__decode_frame_config(
     wuffs_gif__decoder* self,
     wuffs_base__frame_config* a_dst,
-    wuffs_base__io_buffer* a_src);
+    wuffs_base__io_buffer* a_src)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_gif__decoder__decode_frame(
@@ -7482,7 +9033,134 @@ wuffs_gif__decoder__decode_frame(
     wuffs_base__io_buffer* a_src,
     wuffs_base__pixel_blend a_blend,
     wuffs_base__slice_u8 a_workbuf,
-    wuffs_base__decode_frame_options* a_opts);
+    wuffs_base__decode_frame_options* a_opts)
+WUFFS_BASE__REQUIRES(self);
+
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+// wuffs_gif__status_http_code returns a suggested HTTP response status code
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_gif__status_http_code(const char* repr);
+
+// wuffs_gif__status_errno returns a suggested errno value
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_gif__status_errno(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+#define WUFFS_GIF__STATUS_ENUM__MAX_INCL 7
+
+#define WUFFS_GIF__STATUS_ENUM__ERROR__BAD_EXTENSION_LABEL 1
+#define WUFFS_GIF__STATUS_ENUM__ERROR__BAD_FRAME_SIZE 2
+#define WUFFS_GIF__STATUS_ENUM__ERROR__BAD_GRAPHIC_CONTROL 3
+#define WUFFS_GIF__STATUS_ENUM__ERROR__BAD_HEADER 4
+#define WUFFS_GIF__STATUS_ENUM__ERROR__BAD_LITERAL_WIDTH 5
+#define WUFFS_GIF__STATUS_ENUM__ERROR__BAD_PALETTE 6
+#define WUFFS_GIF__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_RI_WI 7
+
+// wuffs_gif__status__from_enum returns the status repr for one of the
+// WUFFS_GIF__STATUS_ENUM__ETC values, or NULL if e is out of range.
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_gif__status__from_enum(uint32_t e);
+
+// wuffs_gif__status__to_enum returns the WUFFS_GIF__STATUS_ENUM__ETC value
+// for a string equal to one of this package's status reprs, or 0.
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_gif__status__to_enum(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+// ---------------- Metadata Visitors
+
+// wuffs_foo__bar__visit_metadata passes the metadata that
+// wuffs_foo__bar__tell_me_more reports, such as an ICC profile or XMP, to
+// callback in chunks, as the metadata is decoded. Call it after a decode
+// method returns a "@metadata reported" note, with a minfo that starts as
+// wuffs_base__empty_more_information(). It returns OK once that metadata is
+// exhausted. Like tell_me_more, it can also return a suspension status (such
+// as "$short read") and, after the caller addresses it (such as by
+// re-filling src or, for "$mispositioned read", seeking to the minfo's I/O
+// position), it should be called again with the same minfo.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_gif__decoder__visit_metadata(
+    wuffs_gif__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__more_information* a_minfo,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__metadata_chunk_func a_callback,
+    void* a_context);
+
+// wuffs_foo__bar__read_metadata_chunk sets reader's chunk to the next chunk
+// of the metadata that wuffs_foo__bar__tell_me_more reports. Call it after a
+// decode method returns a "@metadata reported" note, with a reader that
+// starts as wuffs_base__empty_metadata_reader(), and keep calling it (without
+// otherwise reading from src) while it returns OK with a non-empty chunk. OK
+// with an empty chunk means that that metadata is exhausted. Like
+// visit_metadata, it can also return a suspension status and, after the
+// caller addresses it, it should be called again with the same reader.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_gif__decoder__read_metadata_chunk(
+    wuffs_gif__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__metadata_reader* a_reader,
+    wuffs_base__io_buffer* a_src);
+
+// ---------------- Probes
+
+// wuffs_foo__bar__probe is the first pass of a two-pass decode. It calls the
+// header-only method (the Wuffs code's "probe" method, such as
+// decode_image_config) that needs no workbuf. Once that returns OK, it also
+// sets *a_workbuf_len (if a_workbuf_len is non-NULL) to the workbuf_len, so
+// that the caller can allocate the workbuf for the second pass. Like that
+// method, it can return a suspension status (such as "$short read") and,
+// after the caller addresses it, it should be called again.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_gif__decoder__probe(
+    wuffs_gif__decoder* self,
+    wuffs_base__image_config* a_dst,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__range_ii_u64* a_workbuf_len);
+
+// ---------------- Frame Seeking
+
+// wuffs_foo__bar__set_frame_io_positions gives a seekable decoder a table,
+// owned by the caller, that each successful decode_frame_config call fills in,
+// mapping the frame's index to its io_position. It marks every element as
+// unknown (UINT64_MAX). Passing an empty table stops the recording.
+//
+// wuffs_foo__bar__seek_frame looks up the frame's io_position in that table
+// and, if it is known, calls restart_frame with it and, on success, sets
+// *a_io_position (if a_io_position is non-NULL) to it. The caller should then
+// reposition its source io_buffer to that position before calling
+// decode_frame_config again. An unknown frame is a "#base: bad argument".
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
+wuffs_gif__decoder__set_frame_io_positions(
+    wuffs_gif__decoder* self,
+    wuffs_base__slice_u64 a_table);
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_gif__decoder__seek_frame(
+    wuffs_gif__decoder* self,
+    uint64_t a_index,
+    uint64_t* a_io_position);
+
+// ---------------- Telemetry
+
+// wuffs_foo__bar__telemetry returns the counters, summed over all of the
+// public coroutine method calls since self was initialized. They are all
+// zero unless WUFFS_CONFIG__TELEMETRY is defined. See wuffs_base__telemetry.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_gif__decoder__telemetry(
+    const wuffs_gif__decoder* self);
 
 #ifdef __cplusplus
 }  // extern "C"
@@ -7497,7 +9175,7 @@ wuffs_gif__decoder__decode_frame(
 
 #if defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
-struct wuffs_gif__decoder__struct {
+struct WUFFS_BASE__CAPABILITY wuffs_gif__decoder__struct {
   // Do not access the private_impl's or private_data's fields directly. There
   // is no API/ABI compatibility or safety guarantee if you do so. Instead, use
   // the wuffs_foo__bar__baz functions.
@@ -7510,6 +9188,10 @@ struct wuffs_gif__decoder__struct {
     uint32_t active_coroutine;
     wuffs_base__vtable vtable_for__wuffs_base__image_decoder;
     wuffs_base__vtable null_vtable;
+#if defined(WUFFS_CONFIG__TELEMETRY)
+    wuffs_base__telemetry telemetry;
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
+    wuffs_base__slice_u64 frame_io_positions;
 
     uint32_t f_width;
     uint32_t f_height;
@@ -7684,21 +9366,21 @@ struct wuffs_gif__decoder__struct {
   inline wuffs_base__empty_struct
   set_quirk_enabled(
       uint32_t a_quirk,
-      bool a_enabled) {
+      bool a_enabled) WUFFS_BASE__REQUIRES(this) {
     return wuffs_gif__decoder__set_quirk_enabled(this, a_quirk, a_enabled);
   }
 
   inline wuffs_base__status
   decode_image_config(
       wuffs_base__image_config* a_dst,
-      wuffs_base__io_buffer* a_src) {
+      wuffs_base__io_buffer* a_src) WUFFS_BASE__REQUIRES(this) {
     return wuffs_gif__decoder__decode_image_config(this, a_dst, a_src);
   }
 
   inline wuffs_base__empty_struct
   set_report_metadata(
       uint32_t a_fourcc,
-      bool a_report) {
+      bool a_report) WUFFS_BASE__REQUIRES(this) {
     return wuffs_gif__decoder__set_report_metadata(this, a_fourcc, a_report);
   }
 
@@ -7706,46 +9388,46 @@ struct wuffs_gif__decoder__struct {
   tell_me_more(
       wuffs_base__io_buffer* a_dst,
       wuffs_base__more_information* a_minfo,
-      wuffs_base__io_buffer* a_src) {
+      wuffs_base__io_buffer* a_src) WUFFS_BASE__REQUIRES(this) {
     return wuffs_gif__decoder__tell_me_more(this, a_dst, a_minfo, a_src);
   }
 
   inline uint32_t
-  num_animation_loops() const {
+  num_animation_loops() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_gif__decoder__num_animation_loops(this);
   }
 
   inline uint64_t
-  num_decoded_frame_configs() const {
+  num_decoded_frame_configs() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_gif__decoder__num_decoded_frame_configs(this);
   }
 
   inline uint64_t
-  num_decoded_frames() const {
+  num_decoded_frames() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_gif__decoder__num_decoded_frames(this);
   }
 
   inline wuffs_base__rect_ie_u32
-  frame_dirty_rect() const {
+  frame_dirty_rect() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_gif__decoder__frame_dirty_rect(this);
   }
 
   inline wuffs_base__range_ii_u64
-  workbuf_len() const {
+  workbuf_len() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_gif__decoder__workbuf_len(this);
   }
 
   inline wuffs_base__status
   restart_frame(
       uint64_t a_index,
-      uint64_t a_io_position) {
+      uint64_t a_io_position) WUFFS_BASE__REQUIRES(this) {
     return wuffs_gif__decoder__restart_frame(this, a_index, a_io_position);
   }
 
   inline wuffs_base__status
   decode_frame_config(
       wuffs_base__frame_config* a_dst,
-      wuffs_base__io_buffer* a_src) {
+      wuffs_base__io_buffer* a_src) WUFFS_BASE__REQUIRES(this) {
     return wuffs_gif__decoder__decode_frame_config(this, a_dst, a_src);
   }
 
@@ -7755,15 +9437,70 @@ struct wuffs_gif__decoder__struct {
       wuffs_base__io_buffer* a_src,
       wuffs_base__pixel_blend a_blend,
       wuffs_base__slice_u8 a_workbuf,
-      wuffs_base__decode_frame_options* a_opts) {
+      wuffs_base__decode_frame_options* a_opts) WUFFS_BASE__REQUIRES(this) {
     return wuffs_gif__decoder__decode_frame(this, a_dst, a_src, a_blend, a_workbuf, a_opts);
   }
 
+  inline wuffs_base__status
+  visit_metadata(
+      wuffs_base__io_buffer* a_dst,
+      wuffs_base__more_information* a_minfo,
+      wuffs_base__io_buffer* a_src,
+      wuffs_base__metadata_chunk_func a_callback,
+      void* a_context) {
+    return wuffs_gif__decoder__visit_metadata(
+        this, a_dst, a_minfo, a_src, a_callback, a_context);
+  }
+
+  inline wuffs_base__status
+  read_metadata_chunk(
+      wuffs_base__io_buffer* a_dst,
+      wuffs_base__metadata_reader* a_reader,
+      wuffs_base__io_buffer* a_src) {
+    return wuffs_gif__decoder__read_metadata_chunk(
+        this, a_dst, a_reader, a_src);
+  }
+
+  inline wuffs_base__telemetry
+  telemetry() const {
+    return wuffs_gif__decoder__telemetry(this);
+  }
+
+  inline wuffs_base__status
+  probe(
+      wuffs_base__image_config* a_dst,
+      wuffs_base__io_buffer* a_src,
+      wuffs_base__range_ii_u64* a_workbuf_len) {
+    return wuffs_gif__decoder__probe(
+        this, a_dst, a_src, a_workbuf_len);
+  }
+
+  inline wuffs_base__empty_struct
+  set_frame_io_positions(
+      wuffs_base__slice_u64 a_table) {
+    return wuffs_gif__decoder__set_frame_io_positions(this, a_table);
+  }
+
+  inline wuffs_base__status
+  seek_frame(
+      uint64_t a_index,
+      uint64_t* a_io_position) {
+    return wuffs_gif__decoder__seek_frame(this, a_index, a_io_position);
+  }
+
 #endif  // __cplusplus
 };  // struct wuffs_gif__decoder__struct
 
 #endif  // defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
+// ---------------- ABI Checks
+
+#if !defined(WUFFS_BASE__ABI_HASH)
+#error "wuffs_gzip needs a newer wuffs_base"
+#endif
+WUFFS_BASE__STATIC_ASSERT(WUFFS_BASE__ABI_HASH == 0xA5155465,
+    gzip_base_abi_hash);
+
 // ---------------- Status Codes
 
 extern const char wuffs_gzip__error__bad_checksum[];
@@ -7777,6 +9514,21 @@ extern const char wuffs_gzip__error__bad_header[];
 
 // ---------------- Struct Declarations
 
+// Memory ownership: Wuffs structs never hold pointers to caller-owned
+// memory between calls, as their fields cannot be pointers, slices, tables
+// or I/O types. Instead, the caller owns every buffer and each method
+// borrows its pointer-containing arguments, listed below per struct, for:
+//  - "until return": the duration of that one call.
+//  - "until complete": for a coroutine, until it returns a status that is
+//    not a suspension. Resuming a suspended coroutine must pass the same
+//    memory (e.g. the same workbuf, with its contents unmodified).
+//
+// I/O and token buffers are always borrowed "until return": a suspended
+// coroutine can be resumed with different buffers, as long as any data not
+// yet read is still there.
+
+// Memory ownership of wuffs_gzip__decoder:
+//  - transform_io: workbuf until complete; dst, src until return.
 typedef struct wuffs_gzip__decoder__struct wuffs_gzip__decoder;
 
 #ifdef __cplusplus
@@ -7791,14 +9543,14 @@ extern "C" {
 // Pass sizeof(*self) and WUFFS_VERSION for sizeof_star_self and wuffs_version.
 // Pass 0 (or some combination of WUFFS_INITIALIZE__XXX) for options.
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_gzip__decoder__initialize(
     wuffs_gzip__decoder* self,
     size_t sizeof_star_self,
     uint64_t wuffs_version,
     uint32_t options);
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_gzip__decoder();
 
 // ---------------- Allocs
@@ -7809,7 +9561,7 @@ sizeof__wuffs_gzip__decoder();
 // calling free on the returned pointer. That pointer is effectively a C++
 // std::unique_ptr<T, decltype(&free)>.
 
-wuffs_gzip__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_gzip__decoder*
 wuffs_gzip__decoder__alloc();
 
 static inline wuffs_base__io_transformer*
@@ -7831,18 +9583,66 @@ WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_gzip__decoder__set_quirk_enabled(
     wuffs_gzip__decoder* self,
     uint32_t a_quirk,
-    bool a_enabled);
+    bool a_enabled)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_gzip__decoder__workbuf_len(
-    const wuffs_gzip__decoder* self);
+    const wuffs_gzip__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_gzip__decoder__transform_io(
     wuffs_gzip__decoder* self,
     wuffs_base__io_buffer* a_dst,
     wuffs_base__io_buffer* a_src,
-    wuffs_base__slice_u8 a_workbuf);
+    wuffs_base__slice_u8 a_workbuf)
+WUFFS_BASE__REQUIRES(self);
+
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+// wuffs_gzip__status_http_code returns a suggested HTTP response status code
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_gzip__status_http_code(const char* repr);
+
+// wuffs_gzip__status_errno returns a suggested errno value
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_gzip__status_errno(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+#define WUFFS_GZIP__STATUS_ENUM__MAX_INCL 4
+
+#define WUFFS_GZIP__STATUS_ENUM__ERROR__BAD_CHECKSUM 1
+#define WUFFS_GZIP__STATUS_ENUM__ERROR__BAD_COMPRESSION_METHOD 2
+#define WUFFS_GZIP__STATUS_ENUM__ERROR__BAD_ENCODING_FLAGS 3
+#define WUFFS_GZIP__STATUS_ENUM__ERROR__BAD_HEADER 4
+
+// wuffs_gzip__status__from_enum returns the status repr for one of the
+// WUFFS_GZIP__STATUS_ENUM__ETC values, or NULL if e is out of range.
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_gzip__status__from_enum(uint32_t e);
+
+// wuffs_gzip__status__to_enum returns the WUFFS_GZIP__STATUS_ENUM__ETC value
+// for a string equal to one of this package's status reprs, or 0.
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_gzip__status__to_enum(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+// ---------------- Telemetry
+
+// wuffs_foo__bar__telemetry returns the counters, summed over all of the
+// public coroutine method calls since self was initialized. They are all
+// zero unless WUFFS_CONFIG__TELEMETRY is defined. See wuffs_base__telemetry.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_gzip__decoder__telemetry(
+    const wuffs_gzip__decoder* self);
 
 #ifdef __cplusplus
 }  // extern "C"
@@ -7857,7 +9657,7 @@ wuffs_gzip__decoder__transform_io(
 
 #if defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
-struct wuffs_gzip__decoder__struct {
+struct WUFFS_BASE__CAPABILITY wuffs_gzip__decoder__struct {
   // Do not access the private_impl's or private_data's fields directly. There
   // is no API/ABI compatibility or safety guarantee if you do so. Instead, use
   // the wuffs_foo__bar__baz functions.
@@ -7870,6 +9670,9 @@ struct wuffs_gzip__decoder__struct {
     uint32_t active_coroutine;
     wuffs_base__vtable vtable_for__wuffs_base__io_transformer;
     wuffs_base__vtable null_vtable;
+#if defined(WUFFS_CONFIG__TELEMETRY)
+    wuffs_base__telemetry telemetry;
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
 
     bool f_ignore_checksum;
 
@@ -7954,12 +9757,12 @@ struct wuffs_gzip__decoder__struct {
   inline wuffs_base__empty_struct
   set_quirk_enabled(
       uint32_t a_quirk,
-      bool a_enabled) {
+      bool a_enabled) WUFFS_BASE__REQUIRES(this) {
     return wuffs_gzip__decoder__set_quirk_enabled(this, a_quirk, a_enabled);
   }
 
   inline wuffs_base__range_ii_u64
-  workbuf_len() const {
+  workbuf_len() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_gzip__decoder__workbuf_len(this);
   }
 
@@ -7967,15 +9770,28 @@ struct wuffs_gzip__decoder__struct {
   transform_io(
       wuffs_base__io_buffer* a_dst,
       wuffs_base__io_buffer* a_src,
-      wuffs_base__slice_u8 a_workbuf) {
+      wuffs_base__slice_u8 a_workbuf) WUFFS_BASE__REQUIRES(this) {
     return wuffs_gzip__decoder__transform_io(this, a_dst, a_src, a_workbuf);
   }
 
+  inline wuffs_base__telemetry
+  telemetry() const {
+    return wuffs_gzip__decoder__telemetry(this);
+  }
+
 #endif  // __cplusplus
 };  // struct wuffs_gzip__decoder__struct
 
 #endif  // defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
+// ---------------- ABI Checks
+
+#if !defined(WUFFS_BASE__ABI_HASH)
+#error "wuffs_json needs a newer wuffs_base"
+#endif
+WUFFS_BASE__STATIC_ASSERT(WUFFS_BASE__ABI_HASH == 0xA5155465,
+    json_base_abi_hash);
+
 // ---------------- Status Codes
 
 extern const char wuffs_json__error__bad_c0_control_code[];
@@ -8039,6 +9855,21 @@ extern const char wuffs_json__error__unsupported_recursion_depth[];
 
 // ---------------- Struct Declarations
 
+// Memory ownership: Wuffs structs never hold pointers to caller-owned
+// memory between calls, as their fields cannot be pointers, slices, tables
+// or I/O types. Instead, the caller owns every buffer and each method
+// borrows its pointer-containing arguments, listed below per struct, for:
+//  - "until return": the duration of that one call.
+//  - "until complete": for a coroutine, until it returns a status that is
+//    not a suspension. Resuming a suspended coroutine must pass the same
+//    memory (e.g. the same workbuf, with its contents unmodified).
+//
+// I/O and token buffers are always borrowed "until return": a suspended
+// coroutine can be resumed with different buffers, as long as any data not
+// yet read is still there.
+
+// Memory ownership of wuffs_json__decoder:
+//  - decode_tokens: workbuf until complete; dst, src until return.
 typedef struct wuffs_json__decoder__struct wuffs_json__decoder;
 
 #ifdef __cplusplus
@@ -8053,14 +9884,14 @@ extern "C" {
 // Pass sizeof(*self) and WUFFS_VERSION for sizeof_star_self and wuffs_version.
 // Pass 0 (or some combination of WUFFS_INITIALIZE__XXX) for options.
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_json__decoder__initialize(
     wuffs_json__decoder* self,
     size_t sizeof_star_self,
     uint64_t wuffs_version,
     uint32_t options);
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_json__decoder();
 
 // ---------------- Allocs
@@ -8071,7 +9902,7 @@ sizeof__wuffs_json__decoder();
 // calling free on the returned pointer. That pointer is effectively a C++
 // std::unique_ptr<T, decltype(&free)>.
 
-wuffs_json__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_json__decoder*
 wuffs_json__decoder__alloc();
 
 static inline wuffs_base__token_decoder*
@@ -8093,18 +9924,88 @@ WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_json__decoder__set_quirk_enabled(
     wuffs_json__decoder* self,
     uint32_t a_quirk,
-    bool a_enabled);
+    bool a_enabled)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_json__decoder__workbuf_len(
-    const wuffs_json__decoder* self);
+    const wuffs_json__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_json__decoder__decode_tokens(
     wuffs_json__decoder* self,
     wuffs_base__token_buffer* a_dst,
     wuffs_base__io_buffer* a_src,
-    wuffs_base__slice_u8 a_workbuf);
+    wuffs_base__slice_u8 a_workbuf)
+WUFFS_BASE__REQUIRES(self);
+
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+// wuffs_json__status_http_code returns a suggested HTTP response status code
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_json__status_http_code(const char* repr);
+
+// wuffs_json__status_errno returns a suggested errno value
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_json__status_errno(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+#define WUFFS_JSON__STATUS_ENUM__MAX_INCL 9
+
+#define WUFFS_JSON__STATUS_ENUM__ERROR__BAD_C0_CONTROL_CODE 1
+#define WUFFS_JSON__STATUS_ENUM__ERROR__BAD_UTF_8 2
+#define WUFFS_JSON__STATUS_ENUM__ERROR__BAD_BACKSLASH_ESCAPE 3
+#define WUFFS_JSON__STATUS_ENUM__ERROR__BAD_INPUT 4
+#define WUFFS_JSON__STATUS_ENUM__ERROR__BAD_NEW_LINE_IN_A_STRING 5
+#define WUFFS_JSON__STATUS_ENUM__ERROR__BAD_QUIRK_COMBINATION 6
+#define WUFFS_JSON__STATUS_ENUM__ERROR__UNSUPPORTED_NUMBER_LENGTH 7
+#define WUFFS_JSON__STATUS_ENUM__ERROR__UNSUPPORTED_RECURSION_DEPTH 8
+#define WUFFS_JSON__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_I_O 9
+
+// wuffs_json__status__from_enum returns the status repr for one of the
+// WUFFS_JSON__STATUS_ENUM__ETC values, or NULL if e is out of range.
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_json__status__from_enum(uint32_t e);
+
+// wuffs_json__status__to_enum returns the WUFFS_JSON__STATUS_ENUM__ETC value
+// for a string equal to one of this package's status reprs, or 0.
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_json__status__to_enum(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+// ---------------- Token Batches
+
+// wuffs_foo__bar__decode_tokens_batch is like decode_tokens but, when it
+// returns a "$short write" suspension, it also sets *a_tokens_needed (if
+// a_tokens_needed is non-NULL) to how many tokens the decoder needs room for
+// (in a_dst->data.len - a_dst->meta.wi) to make progress. The caller can then
+// compact or grow a_dst by enough before calling it again, instead of
+// guessing. For other statuses, it sets *a_tokens_needed to zero.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_json__decoder__decode_tokens_batch(
+    wuffs_json__decoder* self,
+    wuffs_base__token_buffer* a_dst,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__slice_u8 a_workbuf,
+    uint64_t* a_tokens_needed);
+
+// ---------------- Telemetry
+
+// wuffs_foo__bar__telemetry returns the counters, summed over all of the
+// public coroutine method calls since self was initialized. They are all
+// zero unless WUFFS_CONFIG__TELEMETRY is defined. See wuffs_base__telemetry.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_json__decoder__telemetry(
+    const wuffs_json__decoder* self);
 
 #ifdef __cplusplus
 }  // extern "C"
@@ -8119,7 +10020,7 @@ wuffs_json__decoder__decode_tokens(
 
 #if defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
-struct wuffs_json__decoder__struct {
+struct WUFFS_BASE__CAPABILITY wuffs_json__decoder__struct {
   // Do not access the private_impl's or private_data's fields directly. There
   // is no API/ABI compatibility or safety guarantee if you do so. Instead, use
   // the wuffs_foo__bar__baz functions.
@@ -8132,6 +10033,10 @@ struct wuffs_json__decoder__struct {
     uint32_t active_coroutine;
     wuffs_base__vtable vtable_for__wuffs_base__token_decoder;
     wuffs_base__vtable null_vtable;
+#if defined(WUFFS_CONFIG__TELEMETRY)
+    wuffs_base__telemetry telemetry;
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
+    uint64_t tokens_needed;
 
     bool f_quirks[21];
     bool f_allow_leading_ars;
@@ -8225,12 +10130,12 @@ struct wuffs_json__decoder__struct {
   inline wuffs_base__empty_struct
   set_quirk_enabled(
       uint32_t a_quirk,
-      bool a_enabled) {
+      bool a_enabled) WUFFS_BASE__REQUIRES(this) {
     return wuffs_json__decoder__set_quirk_enabled(this, a_quirk, a_enabled);
   }
 
   inline wuffs_base__range_ii_u64
-  workbuf_len() const {
+  workbuf_len() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_json__decoder__workbuf_len(this);
   }
 
@@ -8238,15 +10143,38 @@ struct wuffs_json__decoder__struct {
   decode_tokens(
       wuffs_base__token_buffer* a_dst,
       wuffs_base__io_buffer* a_src,
-      wuffs_base__slice_u8 a_workbuf) {
+      wuffs_base__slice_u8 a_workbuf) WUFFS_BASE__REQUIRES(this) {
     return wuffs_json__decoder__decode_tokens(this, a_dst, a_src, a_workbuf);
   }
 
+  inline wuffs_base__telemetry
+  telemetry() const {
+    return wuffs_json__decoder__telemetry(this);
+  }
+
+  inline wuffs_base__status
+  decode_tokens_batch(
+      wuffs_base__token_buffer* a_dst,
+      wuffs_base__io_buffer* a_src,
+      wuffs_base__slice_u8 a_workbuf,
+      uint64_t* a_tokens_needed) {
+    return wuffs_json__decoder__decode_tokens_batch(
+        this, a_dst, a_src, a_workbuf, a_tokens_needed);
+  }
+
 #endif  // __cplusplus
 };  // struct wuffs_json__decoder__struct
 
 #endif  // defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
+// ---------------- ABI Checks
+
+#if !defined(WUFFS_BASE__ABI_HASH)
+#error "wuffs_nie needs a newer wuffs_base"
+#endif
+WUFFS_BASE__STATIC_ASSERT(WUFFS_BASE__ABI_HASH == 0xA5155465,
+    nie_base_abi_hash);
+
 // ---------------- Status Codes
 
 extern const char wuffs_nie__error__bad_header[];
@@ -8258,6 +10186,24 @@ extern const char wuffs_nie__error__unsupported_nie_file[];
 
 // ---------------- Struct Declarations
 
+// Memory ownership: Wuffs structs never hold pointers to caller-owned
+// memory between calls, as their fields cannot be pointers, slices, tables
+// or I/O types. Instead, the caller owns every buffer and each method
+// borrows its pointer-containing arguments, listed below per struct, for:
+//  - "until return": the duration of that one call.
+//  - "until complete": for a coroutine, until it returns a status that is
+//    not a suspension. Resuming a suspended coroutine must pass the same
+//    memory (e.g. the same workbuf, with its contents unmodified).
+//
+// I/O and token buffers are always borrowed "until return": a suspended
+// coroutine can be resumed with different buffers, as long as any data not
+// yet read is still there.
+
+// Memory ownership of wuffs_nie__decoder:
+//  - decode_image_config: dst until complete; src until return.
+//  - decode_frame_config: dst until complete; src until return.
+//  - decode_frame: dst, workbuf, opts until complete; src until return.
+//  - tell_me_more: minfo until complete; dst, src until return.
 typedef struct wuffs_nie__decoder__struct wuffs_nie__decoder;
 
 #ifdef __cplusplus
@@ -8272,14 +10218,14 @@ extern "C" {
 // Pass sizeof(*self) and WUFFS_VERSION for sizeof_star_self and wuffs_version.
 // Pass 0 (or some combination of WUFFS_INITIALIZE__XXX) for options.
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_nie__decoder__initialize(
     wuffs_nie__decoder* self,
     size_t sizeof_star_self,
     uint64_t wuffs_version,
     uint32_t options);
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_nie__decoder();
 
 // ---------------- Allocs
@@ -8290,7 +10236,7 @@ sizeof__wuffs_nie__decoder();
 // calling free on the returned pointer. That pointer is effectively a C++
 // std::unique_ptr<T, decltype(&free)>.
 
-wuffs_nie__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_nie__decoder*
 wuffs_nie__decoder__alloc();
 
 static inline wuffs_base__image_decoder*
@@ -8312,19 +10258,22 @@ WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_nie__decoder__set_quirk_enabled(
     wuffs_nie__decoder* self,
     uint32_t a_quirk,
-    bool a_enabled);
+    bool a_enabled)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_nie__decoder__decode_image_config(
     wuffs_nie__decoder* self,
     wuffs_base__image_config* a_dst,
-    wuffs_base__io_buffer* a_src);
+    wuffs_base__io_buffer* a_src)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_nie__decoder__decode_frame_config(
     wuffs_nie__decoder* self,
     wuffs_base__frame_config* a_dst,
-    wuffs_base__io_buffer* a_src);
+    wuffs_base__io_buffer* a_src)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_nie__decoder__decode_frame(
@@ -8333,45 +10282,152 @@ wuffs_nie__decoder__decode_frame(
     wuffs_base__io_buffer* a_src,
     wuffs_base__pixel_blend a_blend,
     wuffs_base__slice_u8 a_workbuf,
-    wuffs_base__decode_frame_options* a_opts);
+    wuffs_base__decode_frame_options* a_opts)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__rect_ie_u32
 wuffs_nie__decoder__frame_dirty_rect(
-    const wuffs_nie__decoder* self);
+    const wuffs_nie__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC uint32_t
 wuffs_nie__decoder__num_animation_loops(
-    const wuffs_nie__decoder* self);
+    const wuffs_nie__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_nie__decoder__num_decoded_frame_configs(
-    const wuffs_nie__decoder* self);
+    const wuffs_nie__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_nie__decoder__num_decoded_frames(
-    const wuffs_nie__decoder* self);
+    const wuffs_nie__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_nie__decoder__restart_frame(
     wuffs_nie__decoder* self,
     uint64_t a_index,
-    uint64_t a_io_position);
+    uint64_t a_io_position)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_nie__decoder__set_report_metadata(
     wuffs_nie__decoder* self,
     uint32_t a_fourcc,
-    bool a_report);
+    bool a_report)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_nie__decoder__tell_me_more(
     wuffs_nie__decoder* self,
     wuffs_base__io_buffer* a_dst,
     wuffs_base__more_information* a_minfo,
-    wuffs_base__io_buffer* a_src);
+    wuffs_base__io_buffer* a_src)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_nie__decoder__workbuf_len(
+    const wuffs_nie__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
+
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+// wuffs_nie__status_http_code returns a suggested HTTP response status code
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_nie__status_http_code(const char* repr);
+
+// wuffs_nie__status_errno returns a suggested errno value
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_nie__status_errno(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+#define WUFFS_NIE__STATUS_ENUM__MAX_INCL 3
+
+#define WUFFS_NIE__STATUS_ENUM__ERROR__BAD_HEADER 1
+#define WUFFS_NIE__STATUS_ENUM__ERROR__UNSUPPORTED_NIE_FILE 2
+#define WUFFS_NIE__STATUS_ENUM__NOTE__INTERNAL_NOTE_SHORT_READ 3
+
+// wuffs_nie__status__from_enum returns the status repr for one of the
+// WUFFS_NIE__STATUS_ENUM__ETC values, or NULL if e is out of range.
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_nie__status__from_enum(uint32_t e);
+
+// wuffs_nie__status__to_enum returns the WUFFS_NIE__STATUS_ENUM__ETC value
+// for a string equal to one of this package's status reprs, or 0.
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_nie__status__to_enum(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+// ---------------- Metadata Visitors
+
+// wuffs_foo__bar__visit_metadata passes the metadata that
+// wuffs_foo__bar__tell_me_more reports, such as an ICC profile or XMP, to
+// callback in chunks, as the metadata is decoded. Call it after a decode
+// method returns a "@metadata reported" note, with a minfo that starts as
+// wuffs_base__empty_more_information(). It returns OK once that metadata is
+// exhausted. Like tell_me_more, it can also return a suspension status (such
+// as "$short read") and, after the caller addresses it (such as by
+// re-filling src or, for "$mispositioned read", seeking to the minfo's I/O
+// position), it should be called again with the same minfo.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_nie__decoder__visit_metadata(
+    wuffs_nie__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__more_information* a_minfo,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__metadata_chunk_func a_callback,
+    void* a_context);
+
+// wuffs_foo__bar__read_metadata_chunk sets reader's chunk to the next chunk
+// of the metadata that wuffs_foo__bar__tell_me_more reports. Call it after a
+// decode method returns a "@metadata reported" note, with a reader that
+// starts as wuffs_base__empty_metadata_reader(), and keep calling it (without
+// otherwise reading from src) while it returns OK with a non-empty chunk. OK
+// with an empty chunk means that that metadata is exhausted. Like
+// visit_metadata, it can also return a suspension status and, after the
+// caller addresses it, it should be called again with the same reader.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_nie__decoder__read_metadata_chunk(
+    wuffs_nie__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__metadata_reader* a_reader,
+    wuffs_base__io_buffer* a_src);
+
+// ---------------- Probes
+
+// wuffs_foo__bar__probe is the first pass of a two-pass decode. It calls the
+// header-only method (the Wuffs code's "probe" method, such as
+// decode_image_config) that needs no workbuf. Once that returns OK, it also
+// sets *a_workbuf_len (if a_workbuf_len is non-NULL) to the workbuf_len, so
+// that the caller can allocate the workbuf for the second pass. Like that
+// method, it can return a suspension status (such as "$short read") and,
+// after the caller addresses it, it should be called again.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_nie__decoder__probe(
+    wuffs_nie__decoder* self,
+    wuffs_base__image_config* a_dst,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__range_ii_u64* a_workbuf_len);
+
+// ---------------- Telemetry
+
+// wuffs_foo__bar__telemetry returns the counters, summed over all of the
+// public coroutine method calls since self was initialized. They are all
+// zero unless WUFFS_CONFIG__TELEMETRY is defined. See wuffs_base__telemetry.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_nie__decoder__telemetry(
     const wuffs_nie__decoder* self);
 
 #ifdef __cplusplus
@@ -8387,7 +10443,7 @@ wuffs_nie__decoder__workbuf_len(
 
 #if defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
-struct wuffs_nie__decoder__struct {
+struct WUFFS_BASE__CAPABILITY wuffs_nie__decoder__struct {
   // Do not access the private_impl's or private_data's fields directly. There
   // is no API/ABI compatibility or safety guarantee if you do so. Instead, use
   // the wuffs_foo__bar__baz functions.
@@ -8400,6 +10456,9 @@ struct wuffs_nie__decoder__struct {
     uint32_t active_coroutine;
     wuffs_base__vtable vtable_for__wuffs_base__image_decoder;
     wuffs_base__vtable null_vtable;
+#if defined(WUFFS_CONFIG__TELEMETRY)
+    wuffs_base__telemetry telemetry;
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
 
     uint32_t f_pixfmt;
     uint32_t f_width;
@@ -8485,21 +10544,21 @@ struct wuffs_nie__decoder__struct {
   inline wuffs_base__empty_struct
   set_quirk_enabled(
       uint32_t a_quirk,
-      bool a_enabled) {
+      bool a_enabled) WUFFS_BASE__REQUIRES(this) {
     return wuffs_nie__decoder__set_quirk_enabled(this, a_quirk, a_enabled);
   }
 
   inline wuffs_base__status
   decode_image_config(
       wuffs_base__image_config* a_dst,
-      wuffs_base__io_buffer* a_src) {
+      wuffs_base__io_buffer* a_src) WUFFS_BASE__REQUIRES(this) {
     return wuffs_nie__decoder__decode_image_config(this, a_dst, a_src);
   }
 
   inline wuffs_base__status
   decode_frame_config(
       wuffs_base__frame_config* a_dst,
-      wuffs_base__io_buffer* a_src) {
+      wuffs_base__io_buffer* a_src) WUFFS_BASE__REQUIRES(this) {
     return wuffs_nie__decoder__decode_frame_config(this, a_dst, a_src);
   }
 
@@ -8509,41 +10568,41 @@ struct wuffs_nie__decoder__struct {
       wuffs_base__io_buffer* a_src,
       wuffs_base__pixel_blend a_blend,
       wuffs_base__slice_u8 a_workbuf,
-      wuffs_base__decode_frame_options* a_opts) {
+      wuffs_base__decode_frame_options* a_opts) WUFFS_BASE__REQUIRES(this) {
     return wuffs_nie__decoder__decode_frame(this, a_dst, a_src, a_blend, a_workbuf, a_opts);
   }
 
   inline wuffs_base__rect_ie_u32
-  frame_dirty_rect() const {
+  frame_dirty_rect() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_nie__decoder__frame_dirty_rect(this);
   }
 
   inline uint32_t
-  num_animation_loops() const {
+  num_animation_loops() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_nie__decoder__num_animation_loops(this);
   }
 
   inline uint64_t
-  num_decoded_frame_configs() const {
+  num_decoded_frame_configs() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_nie__decoder__num_decoded_frame_configs(this);
   }
 
   inline uint64_t
-  num_decoded_frames() const {
+  num_decoded_frames() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_nie__decoder__num_decoded_frames(this);
   }
 
   inline wuffs_base__status
   restart_frame(
       uint64_t a_index,
-      uint64_t a_io_position) {
+      uint64_t a_io_position) WUFFS_BASE__REQUIRES(this) {
     return wuffs_nie__decoder__restart_frame(this, a_index, a_io_position);
   }
 
   inline wuffs_base__empty_struct
   set_report_metadata(
       uint32_t a_fourcc,
-      bool a_report) {
+      bool a_report) WUFFS_BASE__REQUIRES(this) {
     return wuffs_nie__decoder__set_report_metadata(this, a_fourcc, a_report);
   }
 
@@ -8551,20 +10610,62 @@ struct wuffs_nie__decoder__struct {
   tell_me_more(
       wuffs_base__io_buffer* a_dst,
       wuffs_base__more_information* a_minfo,
-      wuffs_base__io_buffer* a_src) {
+      wuffs_base__io_buffer* a_src) WUFFS_BASE__REQUIRES(this) {
     return wuffs_nie__decoder__tell_me_more(this, a_dst, a_minfo, a_src);
   }
 
   inline wuffs_base__range_ii_u64
-  workbuf_len() const {
+  workbuf_len() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_nie__decoder__workbuf_len(this);
   }
 
+  inline wuffs_base__status
+  visit_metadata(
+      wuffs_base__io_buffer* a_dst,
+      wuffs_base__more_information* a_minfo,
+      wuffs_base__io_buffer* a_src,
+      wuffs_base__metadata_chunk_func a_callback,
+      void* a_context) {
+    return wuffs_nie__decoder__visit_metadata(
+        this, a_dst, a_minfo, a_src, a_callback, a_context);
+  }
+
+  inline wuffs_base__status
+  read_metadata_chunk(
+      wuffs_base__io_buffer* a_dst,
+      wuffs_base__metadata_reader* a_reader,
+      wuffs_base__io_buffer* a_src) {
+    return wuffs_nie__decoder__read_metadata_chunk(
+        this, a_dst, a_reader, a_src);
+  }
+
+  inline wuffs_base__telemetry
+  telemetry() const {
+    return wuffs_nie__decoder__telemetry(this);
+  }
+
+  inline wuffs_base__status
+  probe(
+      wuffs_base__image_config* a_dst,
+      wuffs_base__io_buffer* a_src,
+      wuffs_base__range_ii_u64* a_workbuf_len) {
+    return wuffs_nie__decoder__probe(
+        this, a_dst, a_src, a_workbuf_len);
+  }
+
 #endif  // __cplusplus
 };  // struct wuffs_nie__decoder__struct
 
 #endif  // defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
+// ---------------- ABI Checks
+
+#if !defined(WUFFS_BASE__ABI_HASH)
+#error "wuffs_zlib needs a newer wuffs_base"
+#endif
+WUFFS_BASE__STATIC_ASSERT(WUFFS_BASE__ABI_HASH == 0xA5155465,
+    zlib_base_abi_hash);
+
 // ---------------- Status Codes
 
 extern const char wuffs_zlib__note__dictionary_required[];
@@ -8580,6 +10681,22 @@ extern const char wuffs_zlib__error__incorrect_dictionary[];
 
 // ---------------- Struct Declarations
 
+// Memory ownership: Wuffs structs never hold pointers to caller-owned
+// memory between calls, as their fields cannot be pointers, slices, tables
+// or I/O types. Instead, the caller owns every buffer and each method
+// borrows its pointer-containing arguments, listed below per struct, for:
+//  - "until return": the duration of that one call.
+//  - "until complete": for a coroutine, until it returns a status that is
+//    not a suspension. Resuming a suspended coroutine must pass the same
+//    memory (e.g. the same workbuf, with its contents unmodified).
+//
+// I/O and token buffers are always borrowed "until return": a suspended
+// coroutine can be resumed with different buffers, as long as any data not
+// yet read is still there.
+
+// Memory ownership of wuffs_zlib__decoder:
+//  - add_dictionary: dict until return.
+//  - transform_io: workbuf until complete; dst, src until return.
 typedef struct wuffs_zlib__decoder__struct wuffs_zlib__decoder;
 
 #ifdef __cplusplus
@@ -8594,14 +10711,14 @@ extern "C" {
 // Pass sizeof(*self) and WUFFS_VERSION for sizeof_star_self and wuffs_version.
 // Pass 0 (or some combination of WUFFS_INITIALIZE__XXX) for options.
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_zlib__decoder__initialize(
     wuffs_zlib__decoder* self,
     size_t sizeof_star_self,
     uint64_t wuffs_version,
     uint32_t options);
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_zlib__decoder();
 
 // ---------------- Allocs
@@ -8612,7 +10729,7 @@ sizeof__wuffs_zlib__decoder();
 // calling free on the returned pointer. That pointer is effectively a C++
 // std::unique_ptr<T, decltype(&free)>.
 
-wuffs_zlib__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_zlib__decoder*
 wuffs_zlib__decoder__alloc();
 
 static inline wuffs_base__io_transformer*
@@ -8632,29 +10749,81 @@ wuffs_zlib__decoder__upcast_as__wuffs_base__io_transformer(
 
 WUFFS_BASE__MAYBE_STATIC uint32_t
 wuffs_zlib__decoder__dictionary_id(
-    const wuffs_zlib__decoder* self);
+    const wuffs_zlib__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_zlib__decoder__add_dictionary(
     wuffs_zlib__decoder* self,
-    wuffs_base__slice_u8 a_dict);
+    wuffs_base__slice_u8 a_dict)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_zlib__decoder__set_quirk_enabled(
     wuffs_zlib__decoder* self,
     uint32_t a_quirk,
-    bool a_enabled);
+    bool a_enabled)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_zlib__decoder__workbuf_len(
-    const wuffs_zlib__decoder* self);
+    const wuffs_zlib__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_zlib__decoder__transform_io(
     wuffs_zlib__decoder* self,
     wuffs_base__io_buffer* a_dst,
     wuffs_base__io_buffer* a_src,
-    wuffs_base__slice_u8 a_workbuf);
+    wuffs_base__slice_u8 a_workbuf)
+WUFFS_BASE__REQUIRES(self);
+
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+// wuffs_zlib__status_http_code returns a suggested HTTP response status code
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_zlib__status_http_code(const char* repr);
+
+// wuffs_zlib__status_errno returns a suggested errno value
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_zlib__status_errno(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+#define WUFFS_ZLIB__STATUS_ENUM__MAX_INCL 6
+
+#define WUFFS_ZLIB__STATUS_ENUM__NOTE__DICTIONARY_REQUIRED 1
+#define WUFFS_ZLIB__STATUS_ENUM__ERROR__BAD_CHECKSUM 2
+#define WUFFS_ZLIB__STATUS_ENUM__ERROR__BAD_COMPRESSION_METHOD 3
+#define WUFFS_ZLIB__STATUS_ENUM__ERROR__BAD_COMPRESSION_WINDOW_SIZE 4
+#define WUFFS_ZLIB__STATUS_ENUM__ERROR__BAD_PARITY_CHECK 5
+#define WUFFS_ZLIB__STATUS_ENUM__ERROR__INCORRECT_DICTIONARY 6
+
+// wuffs_zlib__status__from_enum returns the status repr for one of the
+// WUFFS_ZLIB__STATUS_ENUM__ETC values, or NULL if e is out of range.
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_zlib__status__from_enum(uint32_t e);
+
+// wuffs_zlib__status__to_enum returns the WUFFS_ZLIB__STATUS_ENUM__ETC value
+// for a string equal to one of this package's status reprs, or 0.
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_zlib__status__to_enum(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+// ---------------- Telemetry
+
+// wuffs_foo__bar__telemetry returns the counters, summed over all of the
+// public coroutine method calls since self was initialized. They are all
+// zero unless WUFFS_CONFIG__TELEMETRY is defined. See wuffs_base__telemetry.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_zlib__decoder__telemetry(
+    const wuffs_zlib__decoder* self);
 
 #ifdef __cplusplus
 }  // extern "C"
@@ -8669,7 +10838,7 @@ wuffs_zlib__decoder__transform_io(
 
 #if defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
-struct wuffs_zlib__decoder__struct {
+struct WUFFS_BASE__CAPABILITY wuffs_zlib__decoder__struct {
   // Do not access the private_impl's or private_data's fields directly. There
   // is no API/ABI compatibility or safety guarantee if you do so. Instead, use
   // the wuffs_foo__bar__baz functions.
@@ -8682,6 +10851,9 @@ struct wuffs_zlib__decoder__struct {
     uint32_t active_coroutine;
     wuffs_base__vtable vtable_for__wuffs_base__io_transformer;
     wuffs_base__vtable null_vtable;
+#if defined(WUFFS_CONFIG__TELEMETRY)
+    wuffs_base__telemetry telemetry;
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
 
     bool f_bad_call_sequence;
     bool f_header_complete;
@@ -8768,25 +10940,25 @@ struct wuffs_zlib__decoder__struct {
   }
 
   inline uint32_t
-  dictionary_id() const {
+  dictionary_id() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_zlib__decoder__dictionary_id(this);
   }
 
   inline wuffs_base__empty_struct
   add_dictionary(
-      wuffs_base__slice_u8 a_dict) {
+      wuffs_base__slice_u8 a_dict) WUFFS_BASE__REQUIRES(this) {
     return wuffs_zlib__decoder__add_dictionary(this, a_dict);
   }
 
   inline wuffs_base__empty_struct
   set_quirk_enabled(
       uint32_t a_quirk,
-      bool a_enabled) {
+      bool a_enabled) WUFFS_BASE__REQUIRES(this) {
     return wuffs_zlib__decoder__set_quirk_enabled(this, a_quirk, a_enabled);
   }
 
   inline wuffs_base__range_ii_u64
-  workbuf_len() const {
+  workbuf_len() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_zlib__decoder__workbuf_len(this);
   }
 
@@ -8794,15 +10966,28 @@ struct wuffs_zlib__decoder__struct {
   transform_io(
       wuffs_base__io_buffer* a_dst,
       wuffs_base__io_buffer* a_src,
-      wuffs_base__slice_u8 a_workbuf) {
+      wuffs_base__slice_u8 a_workbuf) WUFFS_BASE__REQUIRES(this) {
     return wuffs_zlib__decoder__transform_io(this, a_dst, a_src, a_workbuf);
   }
 
+  inline wuffs_base__telemetry
+  telemetry() const {
+    return wuffs_zlib__decoder__telemetry(this);
+  }
+
 #endif  // __cplusplus
 };  // struct wuffs_zlib__decoder__struct
 
 #endif  // defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
+// ---------------- ABI Checks
+
+#if !defined(WUFFS_BASE__ABI_HASH)
+#error "wuffs_png needs a newer wuffs_base"
+#endif
+WUFFS_BASE__STATIC_ASSERT(WUFFS_BASE__ABI_HASH == 0xA5155465,
+    png_base_abi_hash);
+
 // ---------------- Status Codes
 
 extern const char wuffs_png__error__bad_checksum[];
@@ -8818,6 +11003,24 @@ extern const char wuffs_png__error__unsupported_png_file[];
 
 // ---------------- Struct Declarations
 
+// Memory ownership: Wuffs structs never hold pointers to caller-owned
+// memory between calls, as their fields cannot be pointers, slices, tables
+// or I/O types. Instead, the caller owns every buffer and each method
+// borrows its pointer-containing arguments, listed below per struct, for:
+//  - "until return": the duration of that one call.
+//  - "until complete": for a coroutine, until it returns a status that is
+//    not a suspension. Resuming a suspended coroutine must pass the same
+//    memory (e.g. the same workbuf, with its contents unmodified).
+//
+// I/O and token buffers are always borrowed "until return": a suspended
+// coroutine can be resumed with different buffers, as long as any data not
+// yet read is still there.
+
+// Memory ownership of wuffs_png__decoder:
+//  - decode_image_config: dst until complete; src until return.
+//  - decode_frame_config: dst until complete; src until return.
+//  - decode_frame: dst, workbuf, opts until complete; src until return.
+//  - tell_me_more: minfo until complete; dst, src until return.
 typedef struct wuffs_png__decoder__struct wuffs_png__decoder;
 
 #ifdef __cplusplus
@@ -8832,14 +11035,14 @@ extern "C" {
 // Pass sizeof(*self) and WUFFS_VERSION for sizeof_star_self and wuffs_version.
 // Pass 0 (or some combination of WUFFS_INITIALIZE__XXX) for options.
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_png__decoder__initialize(
     wuffs_png__decoder* self,
     size_t sizeof_star_self,
     uint64_t wuffs_version,
     uint32_t options);
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_png__decoder();
 
 // ---------------- Allocs
@@ -8850,7 +11053,7 @@ sizeof__wuffs_png__decoder();
 // calling free on the returned pointer. That pointer is effectively a C++
 // std::unique_ptr<T, decltype(&free)>.
 
-wuffs_png__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_png__decoder*
 wuffs_png__decoder__alloc();
 
 static inline wuffs_base__image_decoder*
@@ -8872,19 +11075,22 @@ WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_png__decoder__set_quirk_enabled(
     wuffs_png__decoder* self,
     uint32_t a_quirk,
-    bool a_enabled);
+    bool a_enabled)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_png__decoder__decode_image_config(
     wuffs_png__decoder* self,
     wuffs_base__image_config* a_dst,
-    wuffs_base__io_buffer* a_src);
+    wuffs_base__io_buffer* a_src)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_png__decoder__decode_frame_config(
     wuffs_png__decoder* self,
     wuffs_base__frame_config* a_dst,
-    wuffs_base__io_buffer* a_src);
+    wuffs_base__io_buffer* a_src)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_png__decoder__decode_frame(
@@ -8893,45 +11099,157 @@ wuffs_png__decoder__decode_frame(
     wuffs_base__io_buffer* a_src,
     wuffs_base__pixel_blend a_blend,
     wuffs_base__slice_u8 a_workbuf,
-    wuffs_base__decode_frame_options* a_opts);
+    wuffs_base__decode_frame_options* a_opts)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__rect_ie_u32
 wuffs_png__decoder__frame_dirty_rect(
-    const wuffs_png__decoder* self);
+    const wuffs_png__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC uint32_t
 wuffs_png__decoder__num_animation_loops(
-    const wuffs_png__decoder* self);
+    const wuffs_png__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_png__decoder__num_decoded_frame_configs(
-    const wuffs_png__decoder* self);
+    const wuffs_png__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_png__decoder__num_decoded_frames(
-    const wuffs_png__decoder* self);
+    const wuffs_png__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_png__decoder__restart_frame(
     wuffs_png__decoder* self,
     uint64_t a_index,
-    uint64_t a_io_position);
+    uint64_t a_io_position)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_png__decoder__set_report_metadata(
     wuffs_png__decoder* self,
     uint32_t a_fourcc,
-    bool a_report);
+    bool a_report)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_png__decoder__tell_me_more(
     wuffs_png__decoder* self,
     wuffs_base__io_buffer* a_dst,
     wuffs_base__more_information* a_minfo,
-    wuffs_base__io_buffer* a_src);
+    wuffs_base__io_buffer* a_src)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_png__decoder__workbuf_len(
+    const wuffs_png__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
+
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+// wuffs_png__status_http_code returns a suggested HTTP response status code
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_png__status_http_code(const char* repr);
+
+// wuffs_png__status_errno returns a suggested errno value
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_png__status_errno(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+#define WUFFS_PNG__STATUS_ENUM__MAX_INCL 8
+
+#define WUFFS_PNG__STATUS_ENUM__ERROR__BAD_CHECKSUM 1
+#define WUFFS_PNG__STATUS_ENUM__ERROR__BAD_CHUNK 2
+#define WUFFS_PNG__STATUS_ENUM__ERROR__BAD_FILTER 3
+#define WUFFS_PNG__STATUS_ENUM__ERROR__BAD_HEADER 4
+#define WUFFS_PNG__STATUS_ENUM__ERROR__MISSING_PALETTE 5
+#define WUFFS_PNG__STATUS_ENUM__ERROR__UNSUPPORTED_PNG_FILE 6
+#define WUFFS_PNG__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_WORKBUF_LENGTH 7
+#define WUFFS_PNG__STATUS_ENUM__ERROR__INTERNAL_ERROR_ZLIB_DECODER_DID_NOT_EXHAUST_ITS_INPUT 8
+
+// wuffs_png__status__from_enum returns the status repr for one of the
+// WUFFS_PNG__STATUS_ENUM__ETC values, or NULL if e is out of range.
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_png__status__from_enum(uint32_t e);
+
+// wuffs_png__status__to_enum returns the WUFFS_PNG__STATUS_ENUM__ETC value
+// for a string equal to one of this package's status reprs, or 0.
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_png__status__to_enum(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+// ---------------- Metadata Visitors
+
+// wuffs_foo__bar__visit_metadata passes the metadata that
+// wuffs_foo__bar__tell_me_more reports, such as an ICC profile or XMP, to
+// callback in chunks, as the metadata is decoded. Call it after a decode
+// method returns a "@metadata reported" note, with a minfo that starts as
+// wuffs_base__empty_more_information(). It returns OK once that metadata is
+// exhausted. Like tell_me_more, it can also return a suspension status (such
+// as "$short read") and, after the caller addresses it (such as by
+// re-filling src or, for "$mispositioned read", seeking to the minfo's I/O
+// position), it should be called again with the same minfo.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_png__decoder__visit_metadata(
+    wuffs_png__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__more_information* a_minfo,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__metadata_chunk_func a_callback,
+    void* a_context);
+
+// wuffs_foo__bar__read_metadata_chunk sets reader's chunk to the next chunk
+// of the metadata that wuffs_foo__bar__tell_me_more reports. Call it after a
+// decode method returns a "@metadata reported" note, with a reader that
+// starts as wuffs_base__empty_metadata_reader(), and keep calling it (without
+// otherwise reading from src) while it returns OK with a non-empty chunk. OK
+// with an empty chunk means that that metadata is exhausted. Like
+// visit_metadata, it can also return a suspension status and, after the
+// caller addresses it, it should be called again with the same reader.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_png__decoder__read_metadata_chunk(
+    wuffs_png__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__metadata_reader* a_reader,
+    wuffs_base__io_buffer* a_src);
+
+// ---------------- Probes
+
+// wuffs_foo__bar__probe is the first pass of a two-pass decode. It calls the
+// header-only method (the Wuffs code's "probe" method, such as
+// decode_image_config) that needs no workbuf. Once that returns OK, it also
+// sets *a_workbuf_len (if a_workbuf_len is non-NULL) to the workbuf_len, so
+// that the caller can allocate the workbuf for the second pass. Like that
+// method, it can return a suspension status (such as "$short read") and,
+// after the caller addresses it, it should be called again.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_png__decoder__probe(
+    wuffs_png__decoder* self,
+    wuffs_base__image_config* a_dst,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__range_ii_u64* a_workbuf_len);
+
+// ---------------- Telemetry
+
+// wuffs_foo__bar__telemetry returns the counters, summed over all of the
+// public coroutine method calls since self was initialized. They are all
+// zero unless WUFFS_CONFIG__TELEMETRY is defined. See wuffs_base__telemetry.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_png__decoder__telemetry(
     const wuffs_png__decoder* self);
 
 #ifdef __cplusplus
@@ -8947,7 +11265,7 @@ wuffs_png__decoder__workbuf_len(
 
 #if defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
-struct wuffs_png__decoder__struct {
+struct WUFFS_BASE__CAPABILITY wuffs_png__decoder__struct {
   // Do not access the private_impl's or private_data's fields directly. There
   // is no API/ABI compatibility or safety guarantee if you do so. Instead, use
   // the wuffs_foo__bar__baz functions.
@@ -8960,6 +11278,10 @@ struct wuffs_png__decoder__struct {
     uint32_t active_coroutine;
     wuffs_base__vtable vtable_for__wuffs_base__image_decoder;
     wuffs_base__vtable null_vtable;
+#if defined(WUFFS_CONFIG__TELEMETRY)
+    wuffs_base__telemetry telemetry;
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
+    uint32_t avoid_cpu_arch;
 
     uint32_t f_width;
     uint32_t f_height;
@@ -9104,21 +11426,21 @@ struct wuffs_png__decoder__struct {
   inline wuffs_base__empty_struct
   set_quirk_enabled(
       uint32_t a_quirk,
-      bool a_enabled) {
+      bool a_enabled) WUFFS_BASE__REQUIRES(this) {
     return wuffs_png__decoder__set_quirk_enabled(this, a_quirk, a_enabled);
   }
 
   inline wuffs_base__status
   decode_image_config(
       wuffs_base__image_config* a_dst,
-      wuffs_base__io_buffer* a_src) {
+      wuffs_base__io_buffer* a_src) WUFFS_BASE__REQUIRES(this) {
     return wuffs_png__decoder__decode_image_config(this, a_dst, a_src);
   }
 
   inline wuffs_base__status
   decode_frame_config(
       wuffs_base__frame_config* a_dst,
-      wuffs_base__io_buffer* a_src) {
+      wuffs_base__io_buffer* a_src) WUFFS_BASE__REQUIRES(this) {
     return wuffs_png__decoder__decode_frame_config(this, a_dst, a_src);
   }
 
@@ -9128,41 +11450,41 @@ struct wuffs_png__decoder__struct {
       wuffs_base__io_buffer* a_src,
       wuffs_base__pixel_blend a_blend,
       wuffs_base__slice_u8 a_workbuf,
-      wuffs_base__decode_frame_options* a_opts) {
+      wuffs_base__decode_frame_options* a_opts) WUFFS_BASE__REQUIRES(this) {
     return wuffs_png__decoder__decode_frame(this, a_dst, a_src, a_blend, a_workbuf, a_opts);
   }
 
   inline wuffs_base__rect_ie_u32
-  frame_dirty_rect() const {
+  frame_dirty_rect() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_png__decoder__frame_dirty_rect(this);
   }
 
   inline uint32_t
-  num_animation_loops() const {
+  num_animation_loops() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_png__decoder__num_animation_loops(this);
   }
 
   inline uint64_t
-  num_decoded_frame_configs() const {
+  num_decoded_frame_configs() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_png__decoder__num_decoded_frame_configs(this);
   }
 
   inline uint64_t
-  num_decoded_frames() const {
+  num_decoded_frames() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_png__decoder__num_decoded_frames(this);
   }
 
   inline wuffs_base__status
   restart_frame(
       uint64_t a_index,
-      uint64_t a_io_position) {
+      uint64_t a_io_position) WUFFS_BASE__REQUIRES(this) {
     return wuffs_png__decoder__restart_frame(this, a_index, a_io_position);
   }
 
   inline wuffs_base__empty_struct
   set_report_metadata(
       uint32_t a_fourcc,
-      bool a_report) {
+      bool a_report) WUFFS_BASE__REQUIRES(this) {
     return wuffs_png__decoder__set_report_metadata(this, a_fourcc, a_report);
   }
 
@@ -9170,20 +11492,62 @@ struct wuffs_png__decoder__struct {
   tell_me_more(
       wuffs_base__io_buffer* a_dst,
       wuffs_base__more_information* a_minfo,
-      wuffs_base__io_buffer* a_src) {
+      wuffs_base__io_buffer* a_src) WUFFS_BASE__REQUIRES(this) {
     return wuffs_png__decoder__tell_me_more(this, a_dst, a_minfo, a_src);
   }
 
   inline wuffs_base__range_ii_u64
-  workbuf_len() const {
+  workbuf_len() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_png__decoder__workbuf_len(this);
   }
 
+  inline wuffs_base__status
+  visit_metadata(
+      wuffs_base__io_buffer* a_dst,
+      wuffs_base__more_information* a_minfo,
+      wuffs_base__io_buffer* a_src,
+      wuffs_base__metadata_chunk_func a_callback,
+      void* a_context) {
+    return wuffs_png__decoder__visit_metadata(
+        this, a_dst, a_minfo, a_src, a_callback, a_context);
+  }
+
+  inline wuffs_base__status
+  read_metadata_chunk(
+      wuffs_base__io_buffer* a_dst,
+      wuffs_base__metadata_reader* a_reader,
+      wuffs_base__io_buffer* a_src) {
+    return wuffs_png__decoder__read_metadata_chunk(
+        this, a_dst, a_reader, a_src);
+  }
+
+  inline wuffs_base__telemetry
+  telemetry() const {
+    return wuffs_png__decoder__telemetry(this);
+  }
+
+  inline wuffs_base__status
+  probe(
+      wuffs_base__image_config* a_dst,
+      wuffs_base__io_buffer* a_src,
+      wuffs_base__range_ii_u64* a_workbuf_len) {
+    return wuffs_png__decoder__probe(
+        this, a_dst, a_src, a_workbuf_len);
+  }
+
 #endif  // __cplusplus
 };  // struct wuffs_png__decoder__struct
 
 #endif  // defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
+// ---------------- ABI Checks
+
+#if !defined(WUFFS_BASE__ABI_HASH)
+#error "wuffs_wbmp needs a newer wuffs_base"
+#endif
+WUFFS_BASE__STATIC_ASSERT(WUFFS_BASE__ABI_HASH == 0xA5155465,
+    wbmp_base_abi_hash);
+
 // ---------------- Status Codes
 
 extern const char wuffs_wbmp__error__bad_header[];
@@ -9194,6 +11558,24 @@ extern const char wuffs_wbmp__error__bad_header[];
 
 // ---------------- Struct Declarations
 
+// Memory ownership: Wuffs structs never hold pointers to caller-owned
+// memory between calls, as their fields cannot be pointers, slices, tables
+// or I/O types. Instead, the caller owns every buffer and each method
+// borrows its pointer-containing arguments, listed below per struct, for:
+//  - "until return": the duration of that one call.
+//  - "until complete": for a coroutine, until it returns a status that is
+//    not a suspension. Resuming a suspended coroutine must pass the same
+//    memory (e.g. the same workbuf, with its contents unmodified).
+//
+// I/O and token buffers are always borrowed "until return": a suspended
+// coroutine can be resumed with different buffers, as long as any data not
+// yet read is still there.
+
+// Memory ownership of wuffs_wbmp__decoder:
+//  - decode_image_config: dst until complete; src until return.
+//  - decode_frame_config: dst until complete; src until return.
+//  - decode_frame: dst, workbuf, opts until complete; src until return.
+//  - tell_me_more: minfo until complete; dst, src until return.
 typedef struct wuffs_wbmp__decoder__struct wuffs_wbmp__decoder;
 
 #ifdef __cplusplus
@@ -9208,14 +11590,14 @@ extern "C" {
 // Pass sizeof(*self) and WUFFS_VERSION for sizeof_star_self and wuffs_version.
 // Pass 0 (or some combination of WUFFS_INITIALIZE__XXX) for options.
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_wbmp__decoder__initialize(
     wuffs_wbmp__decoder* self,
     size_t sizeof_star_self,
     uint64_t wuffs_version,
     uint32_t options);
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_wbmp__decoder();
 
 // ---------------- Allocs
@@ -9226,7 +11608,7 @@ sizeof__wuffs_wbmp__decoder();
 // calling free on the returned pointer. That pointer is effectively a C++
 // std::unique_ptr<T, decltype(&free)>.
 
-wuffs_wbmp__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_wbmp__decoder*
 wuffs_wbmp__decoder__alloc();
 
 static inline wuffs_base__image_decoder*
@@ -9248,19 +11630,22 @@ WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_wbmp__decoder__set_quirk_enabled(
     wuffs_wbmp__decoder* self,
     uint32_t a_quirk,
-    bool a_enabled);
+    bool a_enabled)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_wbmp__decoder__decode_image_config(
     wuffs_wbmp__decoder* self,
     wuffs_base__image_config* a_dst,
-    wuffs_base__io_buffer* a_src);
+    wuffs_base__io_buffer* a_src)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_wbmp__decoder__decode_frame_config(
     wuffs_wbmp__decoder* self,
     wuffs_base__frame_config* a_dst,
-    wuffs_base__io_buffer* a_src);
+    wuffs_base__io_buffer* a_src)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_wbmp__decoder__decode_frame(
@@ -9269,45 +11654,150 @@ wuffs_wbmp__decoder__decode_frame(
     wuffs_base__io_buffer* a_src,
     wuffs_base__pixel_blend a_blend,
     wuffs_base__slice_u8 a_workbuf,
-    wuffs_base__decode_frame_options* a_opts);
+    wuffs_base__decode_frame_options* a_opts)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__rect_ie_u32
 wuffs_wbmp__decoder__frame_dirty_rect(
-    const wuffs_wbmp__decoder* self);
+    const wuffs_wbmp__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC uint32_t
 wuffs_wbmp__decoder__num_animation_loops(
-    const wuffs_wbmp__decoder* self);
+    const wuffs_wbmp__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_wbmp__decoder__num_decoded_frame_configs(
-    const wuffs_wbmp__decoder* self);
+    const wuffs_wbmp__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_wbmp__decoder__num_decoded_frames(
-    const wuffs_wbmp__decoder* self);
+    const wuffs_wbmp__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_wbmp__decoder__restart_frame(
     wuffs_wbmp__decoder* self,
     uint64_t a_index,
-    uint64_t a_io_position);
+    uint64_t a_io_position)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_wbmp__decoder__set_report_metadata(
     wuffs_wbmp__decoder* self,
     uint32_t a_fourcc,
-    bool a_report);
+    bool a_report)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_wbmp__decoder__tell_me_more(
     wuffs_wbmp__decoder* self,
     wuffs_base__io_buffer* a_dst,
     wuffs_base__more_information* a_minfo,
-    wuffs_base__io_buffer* a_src);
+    wuffs_base__io_buffer* a_src)
+WUFFS_BASE__REQUIRES(self);
 
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_wbmp__decoder__workbuf_len(
+    const wuffs_wbmp__decoder* self)
+WUFFS_BASE__REQUIRES_SHARED(self);
+
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+// wuffs_wbmp__status_http_code returns a suggested HTTP response status code
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_wbmp__status_http_code(const char* repr);
+
+// wuffs_wbmp__status_errno returns a suggested errno value
+// (or 0) for one of this package's error statuses.
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_wbmp__status_errno(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+#define WUFFS_WBMP__STATUS_ENUM__MAX_INCL 1
+
+#define WUFFS_WBMP__STATUS_ENUM__ERROR__BAD_HEADER 1
+
+// wuffs_wbmp__status__from_enum returns the status repr for one of the
+// WUFFS_WBMP__STATUS_ENUM__ETC values, or NULL if e is out of range.
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_wbmp__status__from_enum(uint32_t e);
+
+// wuffs_wbmp__status__to_enum returns the WUFFS_WBMP__STATUS_ENUM__ETC value
+// for a string equal to one of this package's status reprs, or 0.
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_wbmp__status__to_enum(const char* repr);
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+// ---------------- Metadata Visitors
+
+// wuffs_foo__bar__visit_metadata passes the metadata that
+// wuffs_foo__bar__tell_me_more reports, such as an ICC profile or XMP, to
+// callback in chunks, as the metadata is decoded. Call it after a decode
+// method returns a "@metadata reported" note, with a minfo that starts as
+// wuffs_base__empty_more_information(). It returns OK once that metadata is
+// exhausted. Like tell_me_more, it can also return a suspension status (such
+// as "$short read") and, after the caller addresses it (such as by
+// re-filling src or, for "$mispositioned read", seeking to the minfo's I/O
+// position), it should be called again with the same minfo.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_wbmp__decoder__visit_metadata(
+    wuffs_wbmp__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__more_information* a_minfo,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__metadata_chunk_func a_callback,
+    void* a_context);
+
+// wuffs_foo__bar__read_metadata_chunk sets reader's chunk to the next chunk
+// of the metadata that wuffs_foo__bar__tell_me_more reports. Call it after a
+// decode method returns a "@metadata reported" note, with a reader that
+// starts as wuffs_base__empty_metadata_reader(), and keep calling it (without
+// otherwise reading from src) while it returns OK with a non-empty chunk. OK
+// with an empty chunk means that that metadata is exhausted. Like
+// visit_metadata, it can also return a suspension status and, after the
+// caller addresses it, it should be called again with the same reader.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_wbmp__decoder__read_metadata_chunk(
+    wuffs_wbmp__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__metadata_reader* a_reader,
+    wuffs_base__io_buffer* a_src);
+
+// ---------------- Probes
+
+// wuffs_foo__bar__probe is the first pass of a two-pass decode. It calls the
+// header-only method (the Wuffs code's "probe" method, such as
+// decode_image_config) that needs no workbuf. Once that returns OK, it also
+// sets *a_workbuf_len (if a_workbuf_len is non-NULL) to the workbuf_len, so
+// that the caller can allocate the workbuf for the second pass. Like that
+// method, it can return a suspension status (such as "$short read") and,
+// after the caller addresses it, it should be called again.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_wbmp__decoder__probe(
+    wuffs_wbmp__decoder* self,
+    wuffs_base__image_config* a_dst,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__range_ii_u64* a_workbuf_len);
+
+// ---------------- Telemetry
+
+// wuffs_foo__bar__telemetry returns the counters, summed over all of the
+// public coroutine method calls since self was initialized. They are all
+// zero unless WUFFS_CONFIG__TELEMETRY is defined. See wuffs_base__telemetry.
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_wbmp__decoder__telemetry(
     const wuffs_wbmp__decoder* self);
 
 #ifdef __cplusplus
@@ -9323,7 +11813,7 @@ wuffs_wbmp__decoder__workbuf_len(
 
 #if defined(__cplusplus) || defined(WUFFS_IMPLEMENTATION)
 
-struct wuffs_wbmp__decoder__struct {
+struct WUFFS_BASE__CAPABILITY wuffs_wbmp__decoder__struct {
   // Do not access the private_impl's or private_data's fields directly. There
   // is no API/ABI compatibility or safety guarantee if you do so. Instead, use
   // the wuffs_foo__bar__baz functions.
@@ -9336,6 +11826,9 @@ struct wuffs_wbmp__decoder__struct {
     uint32_t active_coroutine;
     wuffs_base__vtable vtable_for__wuffs_base__image_decoder;
     wuffs_base__vtable null_vtable;
+#if defined(WUFFS_CONFIG__TELEMETRY)
+    wuffs_base__telemetry telemetry;
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
 
     uint32_t f_width;
     uint32_t f_height;
@@ -9427,21 +11920,21 @@ struct wuffs_wbmp__decoder__struct {
   inline wuffs_base__empty_struct
   set_quirk_enabled(
       uint32_t a_quirk,
-      bool a_enabled) {
+      bool a_enabled) WUFFS_BASE__REQUIRES(this) {
     return wuffs_wbmp__decoder__set_quirk_enabled(this, a_quirk, a_enabled);
   }
 
   inline wuffs_base__status
   decode_image_config(
       wuffs_base__image_config* a_dst,
-      wuffs_base__io_buffer* a_src) {
+      wuffs_base__io_buffer* a_src) WUFFS_BASE__REQUIRES(this) {
     return wuffs_wbmp__decoder__decode_image_config(this, a_dst, a_src);
   }
 
   inline wuffs_base__status
   decode_frame_config(
       wuffs_base__frame_config* a_dst,
-      wuffs_base__io_buffer* a_src) {
+      wuffs_base__io_buffer* a_src) WUFFS_BASE__REQUIRES(this) {
     return wuffs_wbmp__decoder__decode_frame_config(this, a_dst, a_src);
   }
 
@@ -9451,41 +11944,41 @@ struct wuffs_wbmp__decoder__struct {
       wuffs_base__io_buffer* a_src,
       wuffs_base__pixel_blend a_blend,
       wuffs_base__slice_u8 a_workbuf,
-      wuffs_base__decode_frame_options* a_opts) {
+      wuffs_base__decode_frame_options* a_opts) WUFFS_BASE__REQUIRES(this) {
     return wuffs_wbmp__decoder__decode_frame(this, a_dst, a_src, a_blend, a_workbuf, a_opts);
   }
 
   inline wuffs_base__rect_ie_u32
-  frame_dirty_rect() const {
+  frame_dirty_rect() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_wbmp__decoder__frame_dirty_rect(this);
   }
 
   inline uint32_t
-  num_animation_loops() const {
+  num_animation_loops() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_wbmp__decoder__num_animation_loops(this);
   }
 
   inline uint64_t
-  num_decoded_frame_configs() const {
+  num_decoded_frame_configs() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_wbmp__decoder__num_decoded_frame_configs(this);
   }
 
   inline uint64_t
-  num_decoded_frames() const {
+  num_decoded_frames() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_wbmp__decoder__num_decoded_frames(this);
   }
 
   inline wuffs_base__status
   restart_frame(
       uint64_t a_index,
-      uint64_t a_io_position) {
+      uint64_t a_io_position) WUFFS_BASE__REQUIRES(this) {
     return wuffs_wbmp__decoder__restart_frame(this, a_index, a_io_position);
   }
 
   inline wuffs_base__empty_struct
   set_report_metadata(
       uint32_t a_fourcc,
-      bool a_report) {
+      bool a_report) WUFFS_BASE__REQUIRES(this) {
     return wuffs_wbmp__decoder__set_report_metadata(this, a_fourcc, a_report);
   }
 
@@ -9493,15 +11986,49 @@ struct wuffs_wbmp__decoder__struct {
   tell_me_more(
       wuffs_base__io_buffer* a_dst,
       wuffs_base__more_information* a_minfo,
-      wuffs_base__io_buffer* a_src) {
+      wuffs_base__io_buffer* a_src) WUFFS_BASE__REQUIRES(this) {
     return wuffs_wbmp__decoder__tell_me_more(this, a_dst, a_minfo, a_src);
   }
 
   inline wuffs_base__range_ii_u64
-  workbuf_len() const {
+  workbuf_len() const WUFFS_BASE__REQUIRES_SHARED(this) {
     return wuffs_wbmp__decoder__workbuf_len(this);
   }
 
+  inline wuffs_base__status
+  visit_metadata(
+      wuffs_base__io_buffer* a_dst,
+      wuffs_base__more_information* a_minfo,
+      wuffs_base__io_buffer* a_src,
+      wuffs_base__metadata_chunk_func a_callback,
+      void* a_context) {
+    return wuffs_wbmp__decoder__visit_metadata(
+        this, a_dst, a_minfo, a_src, a_callback, a_context);
+  }
+
+  inline wuffs_base__status
+  read_metadata_chunk(
+      wuffs_base__io_buffer* a_dst,
+      wuffs_base__metadata_reader* a_reader,
+      wuffs_base__io_buffer* a_src) {
+    return wuffs_wbmp__decoder__read_metadata_chunk(
+        this, a_dst, a_reader, a_src);
+  }
+
+  inline wuffs_base__telemetry
+  telemetry() const {
+    return wuffs_wbmp__decoder__telemetry(this);
+  }
+
+  inline wuffs_base__status
+  probe(
+      wuffs_base__image_config* a_dst,
+      wuffs_base__io_buffer* a_src,
+      wuffs_base__range_ii_u64* a_workbuf_len) {
+    return wuffs_wbmp__decoder__probe(
+        this, a_dst, a_src, a_workbuf_len);
+  }
+
 #endif  // __cplusplus
 };  // struct wuffs_wbmp__decoder__struct
 
@@ -9947,6 +12474,7 @@ DecodeJson(DecodeJsonCallbacks& callbacks,
 extern "C" {
 #endif
 
+// ‼ WUFFS MULTI-FILE SECTION +shared
 // ---------------- Fundamentals
 
 // WUFFS_BASE__MAGIC is a magic number to check that initializers are called.
@@ -10003,6 +12531,36 @@ extern "C" {
 #define WUFFS_BASE__UNLIKELY(expr) (expr)
 #endif
 
+// WUFFS_BASE__TELEMETRY__BEGIN and WUFFS_BASE__TELEMETRY__END bracket each
+// public coroutine method call, given the total I/O positions of its io_reader
+// and io_writer arguments. Unless WUFFS_CONFIG__TELEMETRY is defined, they
+// expand to nothing, so that telemetry costs nothing.
+#if defined(WUFFS_CONFIG__TELEMETRY)
+#define WUFFS_BASE__TELEMETRY__BEGIN(consumed, produced) \
+  uint64_t telemetry_consumed = (consumed);              \
+  uint64_t telemetry_produced = (produced);
+#define WUFFS_BASE__TELEMETRY__END(t, consumed, produced, status) \
+  wuffs_base__telemetry__record(t, (consumed)-telemetry_consumed, \
+                                (produced)-telemetry_produced, status);
+#else
+#define WUFFS_BASE__TELEMETRY__BEGIN(consumed, produced)
+#define WUFFS_BASE__TELEMETRY__END(t, consumed, produced, status)
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
+
+static inline void  //
+wuffs_base__telemetry__record(wuffs_base__telemetry* t,
+                              uint64_t consumed,
+                              uint64_t produced,
+                              const wuffs_base__status* status) {
+  t->bytes_consumed += consumed;
+  t->bytes_produced += produced;
+  if (wuffs_base__status__is_suspension(status)) {
+    t->suspensions++;
+  } else if (wuffs_base__status__is_error(status)) {
+    t->errors++;
+  }
+}
+
 // --------
 
 static inline wuffs_base__empty_struct  //
@@ -10114,6 +12672,48 @@ wuffs_base__u64__sat_sub_indirect(uint64_t* x, uint64_t y) {
   *x = wuffs_base__u64__sat_sub(*x, y);
 }
 
+// --------
+
+static inline void  //
+wuffs_base__u8__mod_shift_left_indirect(uint8_t* x, uint64_t n) {
+  *x = wuffs_base__u8__mod_shift_left(*x, n);
+}
+
+static inline void  //
+wuffs_base__u8__mod_shift_right_indirect(uint8_t* x, uint64_t n) {
+  *x = wuffs_base__u8__mod_shift_right(*x, n);
+}
+
+static inline void  //
+wuffs_base__u16__mod_shift_left_indirect(uint16_t* x, uint64_t n) {
+  *x = wuffs_base__u16__mod_shift_left(*x, n);
+}
+
+static inline void  //
+wuffs_base__u16__mod_shift_right_indirect(uint16_t* x, uint64_t n) {
+  *x = wuffs_base__u16__mod_shift_right(*x, n);
+}
+
+static inline void  //
+wuffs_base__u32__mod_shift_left_indirect(uint32_t* x, uint64_t n) {
+  *x = wuffs_base__u32__mod_shift_left(*x, n);
+}
+
+static inline void  //
+wuffs_base__u32__mod_shift_right_indirect(uint32_t* x, uint64_t n) {
+  *x = wuffs_base__u32__mod_shift_right(*x, n);
+}
+
+static inline void  //
+wuffs_base__u64__mod_shift_left_indirect(uint64_t* x, uint64_t n) {
+  *x = wuffs_base__u64__mod_shift_left(*x, n);
+}
+
+static inline void  //
+wuffs_base__u64__mod_shift_right_indirect(uint64_t* x, uint64_t n) {
+  *x = wuffs_base__u64__mod_shift_right(*x, n);
+}
+
 // ---------------- Slices and Tables
 
 // wuffs_base__slice_u8__prefix returns up to the first up_to bytes of s.
@@ -10366,6 +12966,35 @@ wuffs_base__io_writer__limit(uint8_t** ptr_io2_w,
   }
 }
 
+#if defined(WUFFS_CONFIG__AUTOVEC)
+// wuffs_base__io_writer__autovec_copy copies n bytes from src to dst, which
+// must not overlap. It is shaped for compilers' auto-vectorizers: byte copies
+// until dst is 8-byte aligned, then a loop unrolled by 8, then the tail.
+static inline void  //
+wuffs_base__io_writer__autovec_copy(uint8_t* WUFFS_BASE__RESTRICT dst,
+                                    const uint8_t* WUFFS_BASE__RESTRICT src,
+                                    size_t n) {
+  for (; (n > 0) && (((uintptr_t)(dst)) & 7); n--) {
+    *dst++ = *src++;
+  }
+  for (; n >= 8; n -= 8) {
+    dst[0] = src[0];
+    dst[1] = src[1];
+    dst[2] = src[2];
+    dst[3] = src[3];
+    dst[4] = src[4];
+    dst[5] = src[5];
+    dst[6] = src[6];
+    dst[7] = src[7];
+    dst += 8;
+    src += 8;
+  }
+  for (; n > 0; n--) {
+    *dst++ = *src++;
+  }
+}
+#endif  // defined(WUFFS_CONFIG__AUTOVEC)
+
 static inline uint32_t  //
 wuffs_base__io_writer__limited_copy_u32_from_history(uint8_t** ptr_iop_w,
                                                      uint8_t* io1_w,
@@ -10386,6 +13015,13 @@ wuffs_base__io_writer__limited_copy_u32_from_history(uint8_t** ptr_iop_w,
   } else {
     n = (size_t)(length);
   }
+#if defined(WUFFS_CONFIG__AUTOVEC)
+  if ((size_t)(distance) >= n) {
+    wuffs_base__io_writer__autovec_copy(p, q, n);
+    *ptr_iop_w = p + n;
+    return length;
+  }
+#endif  // defined(WUFFS_CONFIG__AUTOVEC)
   // TODO: unrolling by 3 seems best for the std/deflate benchmarks, but that
   // is mostly because 3 is the minimum length for the deflate format. This
   // function implementation shouldn't overfit to that one format. Perhaps the
@@ -10423,6 +13059,13 @@ wuffs_base__io_writer__limited_copy_u32_from_history_fast(uint8_t** ptr_iop_w,
   uint8_t* p = *ptr_iop_w;
   uint8_t* q = p - distance;
   uint32_t n = length;
+#if defined(WUFFS_CONFIG__AUTOVEC)
+  if (distance >= n) {
+    wuffs_base__io_writer__autovec_copy(p, q, n);
+    *ptr_iop_w = p + n;
+    return length;
+  }
+#endif  // defined(WUFFS_CONFIG__AUTOVEC)
   for (; n >= 3; n -= 3) {
     *p++ = *q++;
     *p++ = *q++;
@@ -10581,6 +13224,7 @@ wuffs_base__pixel_swizzler__swizzle_interleaved_transparent_black(
 // ---------------- String Conversions
 
 // ---------------- Unicode and UTF-8
+// ‼ WUFFS MULTI-FILE SECTION -shared
 
 // ----------------
 
@@ -10655,6 +13299,7 @@ const char wuffs_base__error__bad_vtable[] = "#base: bad vtable";
 const char wuffs_base__error__bad_workbuf_length[] = "#base: bad workbuf length";
 const char wuffs_base__error__bad_wuffs_version[] = "#base: bad wuffs version";
 const char wuffs_base__error__cannot_return_a_suspension[] = "#base: cannot return a suspension";
+const char wuffs_base__error__conversion_out_of_range[] = "#base: conversion out of range";
 const char wuffs_base__error__disabled_by_previous_error[] = "#base: disabled by previous error";
 const char wuffs_base__error__initialize_falsely_claimed_already_zeroed[] = "#base: initialize falsely claimed already zeroed";
 const char wuffs_base__error__initialize_not_called[] = "#base: initialize not called";
@@ -20404,8 +23049,11 @@ wuffs_base__ascii__longest_valid_prefix(const uint8_t* s_ptr, size_t s_len) {
 
 // ---------------- Status Codes Implementations
 
+// ‼ WUFFS MULTI-FILE SECTION +shared
 // ---------------- Private Consts
 
+// ‼ WUFFS MULTI-FILE SECTION -shared
+
 // ---------------- Private Initializer Prototypes
 
 // ---------------- Private Function Prototypes
@@ -20447,7 +23095,7 @@ wuffs_adler32__hasher__func_ptrs_for__wuffs_base__hasher_u32 = {
 
 // ---------------- Initializer Implementations
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_adler32__hasher__initialize(
     wuffs_adler32__hasher* self,
     size_t sizeof_star_self,
@@ -20486,7 +23134,18 @@ wuffs_adler32__hasher__initialize(
     }
   }
 
+  self->private_impl.avoid_cpu_arch = options & WUFFS_INITIALIZE__AVOID_CPU_ARCH;
   self->private_impl.choosy_up = &wuffs_adler32__hasher__up__choosy_default;
+  self->private_impl.choosy_up = (
+#if defined(WUFFS_BASE__CPU_ARCH__ARM_NEON)
+      (((self->private_impl.avoid_cpu_arch & WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_NEON) == 0) &&
+      wuffs_base__cpu_arch__have_arm_neon()) ? &wuffs_adler32__hasher__up_arm_neon :
+#endif
+#if defined(WUFFS_BASE__CPU_ARCH__X86_64)
+      (((self->private_impl.avoid_cpu_arch & WUFFS_INITIALIZE__AVOID_CPU_ARCH__X86_SSE42) == 0) &&
+      wuffs_base__cpu_arch__have_x86_sse42()) ? &wuffs_adler32__hasher__up_x86_sse42 :
+#endif
+      self->private_impl.choosy_up);
 
   self->private_impl.magic = WUFFS_BASE__MAGIC;
   self->private_impl.vtable_for__wuffs_base__hasher_u32.vtable_name =
@@ -20496,7 +23155,7 @@ wuffs_adler32__hasher__initialize(
   return wuffs_base__make_status(NULL);
 }
 
-wuffs_adler32__hasher*
+WUFFS_BASE__MAYBE_STATIC wuffs_adler32__hasher*
 wuffs_adler32__hasher__alloc() {
   wuffs_adler32__hasher* x =
       (wuffs_adler32__hasher*)(calloc(sizeof(wuffs_adler32__hasher), 1));
@@ -20511,7 +23170,7 @@ wuffs_adler32__hasher__alloc() {
   return x;
 }
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_adler32__hasher() {
   return sizeof(wuffs_adler32__hasher);
 }
@@ -20520,6 +23179,7 @@ sizeof__wuffs_adler32__hasher() {
 
 // -------- func adler32.hasher.set_quirk_enabled
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_adler32__hasher__set_quirk_enabled(
     wuffs_adler32__hasher* self,
@@ -20530,6 +23190,7 @@ wuffs_adler32__hasher__set_quirk_enabled(
 
 // -------- func adler32.hasher.update_u32
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint32_t
 wuffs_adler32__hasher__update_u32(
     wuffs_adler32__hasher* self,
@@ -20544,14 +23205,7 @@ wuffs_adler32__hasher__update_u32(
   if ( ! self->private_impl.f_started) {
     self->private_impl.f_started = true;
     self->private_impl.f_state = 1;
-    self->private_impl.choosy_up = (
-#if defined(WUFFS_BASE__CPU_ARCH__ARM_NEON)
-        wuffs_base__cpu_arch__have_arm_neon() ? &wuffs_adler32__hasher__up_arm_neon :
-#endif
-#if defined(WUFFS_BASE__CPU_ARCH__X86_64)
-        wuffs_base__cpu_arch__have_x86_sse42() ? &wuffs_adler32__hasher__up_x86_sse42 :
-#endif
-        self->private_impl.choosy_up);
+    // choose up: done once, by the initialize function.
   }
   wuffs_adler32__hasher__up(self, a_x);
   return self->private_impl.f_state;
@@ -20559,6 +23213,7 @@ wuffs_adler32__hasher__update_u32(
 
 // -------- func adler32.hasher.up
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_adler32__hasher__up(
     wuffs_adler32__hasher* self,
@@ -20566,6 +23221,7 @@ wuffs_adler32__hasher__up(
   return (*self->private_impl.choosy_up)(self, a_x);
 }
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_adler32__hasher__up__choosy_default(
     wuffs_adler32__hasher* self,
@@ -20635,6 +23291,7 @@ wuffs_adler32__hasher__up__choosy_default(
 // -------- func adler32.hasher.up_arm_neon
 
 #if defined(WUFFS_BASE__CPU_ARCH__ARM_NEON)
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_adler32__hasher__up_arm_neon(
     wuffs_adler32__hasher* self,
@@ -20742,6 +23399,7 @@ wuffs_adler32__hasher__up_arm_neon(
 
 #if defined(WUFFS_BASE__CPU_ARCH__X86_64)
 WUFFS_BASE__MAYBE_ATTRIBUTE_TARGET("pclmul,popcnt,sse4.2")
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_adler32__hasher__up_x86_sse42(
     wuffs_adler32__hasher* self,
@@ -20840,6 +23498,94 @@ const char wuffs_bmp__error__bad_rle_compression[] = "#bmp: bad RLE compression"
 const char wuffs_bmp__error__unsupported_bmp_file[] = "#bmp: unsupported BMP file";
 const char wuffs_bmp__note__internal_note_short_read[] = "@bmp: internal note: short read";
 
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_bmp__status_http_code(const char* repr) {
+  if (repr == wuffs_bmp__error__bad_header) {
+    return 422;
+  }
+  if (repr == wuffs_bmp__error__bad_rle_compression) {
+    return 422;
+  }
+  if (repr == wuffs_bmp__error__unsupported_bmp_file) {
+    return 415;
+  }
+  return 0;
+}
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_bmp__status_errno(const char* repr) {
+  if (repr == wuffs_bmp__error__bad_header) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_bmp__error__bad_rle_compression) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_bmp__error__unsupported_bmp_file) {
+    return ENOTSUP;
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+static const char* const wuffs_bmp__status__enum_table[] = {
+  wuffs_bmp__error__bad_header,
+  wuffs_bmp__error__bad_rle_compression,
+  wuffs_bmp__error__unsupported_bmp_file,
+  wuffs_bmp__note__internal_note_short_read,
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_bmp__status__enum_table) / sizeof(wuffs_bmp__status__enum_table[0])) == WUFFS_BMP__STATUS_ENUM__MAX_INCL,
+    wuffs_bmp__status__enum_table_is_complete);
+
+static const uint8_t wuffs_bmp__status__enum_sorted[] = {
+  2,  // WUFFS_BMP__STATUS_ENUM__ERROR__BAD_RLE_COMPRESSION
+  1,  // WUFFS_BMP__STATUS_ENUM__ERROR__BAD_HEADER
+  3,  // WUFFS_BMP__STATUS_ENUM__ERROR__UNSUPPORTED_BMP_FILE
+  4,  // WUFFS_BMP__STATUS_ENUM__NOTE__INTERNAL_NOTE_SHORT_READ
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_bmp__status__enum_sorted) / sizeof(wuffs_bmp__status__enum_sorted[0])) == WUFFS_BMP__STATUS_ENUM__MAX_INCL,
+    wuffs_bmp__status__enum_sorted_is_complete);
+
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_bmp__status__from_enum(uint32_t e) {
+  if ((e == 0) || (e > WUFFS_BMP__STATUS_ENUM__MAX_INCL)) {
+    return NULL;
+  }
+  return wuffs_bmp__status__enum_table[e - 1];
+}
+
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_bmp__status__to_enum(const char* repr) {
+  uint32_t lo = 0;
+  uint32_t hi = WUFFS_BMP__STATUS_ENUM__MAX_INCL;
+  if (!repr) {
+    return 0;
+  }
+  while (lo < hi) {
+    uint32_t mid = lo + ((hi - lo) / 2);
+    uint32_t e = wuffs_bmp__status__enum_sorted[mid];
+    int c = strcmp(repr, wuffs_bmp__status__enum_table[e - 1]);
+    if (c == 0) {
+      return e;
+    } else if (c < 0) {
+      hi = mid;
+    } else {
+      lo = mid + 1;
+    }
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
 // ---------------- Private Consts
 
 #define WUFFS_BMP__COMPRESSION_NONE 0
@@ -20945,7 +23691,7 @@ wuffs_bmp__decoder__func_ptrs_for__wuffs_base__image_decoder = {
 
 // ---------------- Initializer Implementations
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_bmp__decoder__initialize(
     wuffs_bmp__decoder* self,
     size_t sizeof_star_self,
@@ -20984,6 +23730,10 @@ wuffs_bmp__decoder__initialize(
     }
   }
 
+  if ((options & WUFFS_INITIALIZE__WORKBUF_LESS) != 0) {
+    return wuffs_base__make_status(wuffs_base__error__unsupported_option);
+  }
+
   self->private_impl.magic = WUFFS_BASE__MAGIC;
   self->private_impl.vtable_for__wuffs_base__image_decoder.vtable_name =
       wuffs_base__image_decoder__vtable_name;
@@ -20992,7 +23742,7 @@ wuffs_bmp__decoder__initialize(
   return wuffs_base__make_status(NULL);
 }
 
-wuffs_bmp__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_bmp__decoder*
 wuffs_bmp__decoder__alloc() {
   wuffs_bmp__decoder* x =
       (wuffs_bmp__decoder*)(calloc(sizeof(wuffs_bmp__decoder), 1));
@@ -21007,7 +23757,7 @@ wuffs_bmp__decoder__alloc() {
   return x;
 }
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_bmp__decoder() {
   return sizeof(wuffs_bmp__decoder);
 }
@@ -21016,6 +23766,7 @@ sizeof__wuffs_bmp__decoder() {
 
 // -------- func bmp.decoder.set_quirk_enabled
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_bmp__decoder__set_quirk_enabled(
     wuffs_bmp__decoder* self,
@@ -21026,6 +23777,7 @@ wuffs_bmp__decoder__set_quirk_enabled(
 
 // -------- func bmp.decoder.decode_image_config
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_bmp__decoder__decode_image_config(
     wuffs_bmp__decoder* self,
@@ -21051,6 +23803,9 @@ wuffs_bmp__decoder__decode_image_config(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      0)
 
   uint32_t v_magic = 0;
   uint32_t v_width = 0;
@@ -21157,7 +23912,7 @@ wuffs_bmp__decoder__decode_image_config(
       goto exit;
     }
     self->private_impl.f_padding -= 14;
-    self->private_impl.f_io_redirect_pos = wuffs_base__u64__sat_add(((uint64_t)(self->private_impl.f_padding)), wuffs_base__u64__sat_add(a_src->meta.pos, ((uint64_t)(iop_a_src - io0_a_src))));
+    self->private_impl.f_io_redirect_pos = wuffs_base__u64__sat_add(self->private_impl.f_padding, wuffs_base__u64__sat_add(a_src->meta.pos, ((uint64_t)(iop_a_src - io0_a_src))));
     {
       WUFFS_BASE__COROUTINE_SUSPENSION_POINT(6);
       uint32_t t_2;
@@ -21889,13 +24644,13 @@ wuffs_bmp__decoder__decode_image_config(
       goto exit;
     }
     if (self->private_impl.f_bits_per_pixel == 1) {
-      v_byte_width = ((self->private_impl.f_width >> 3) + (((self->private_impl.f_width & 7) + 7) >> 3));
+      v_byte_width = wuffs_base__u32__ceil_div_pow2(self->private_impl.f_width, 3);
       self->private_impl.f_pad_per_row = ((4 - (v_byte_width & 3)) & 3);
     } else if (self->private_impl.f_bits_per_pixel == 2) {
-      v_byte_width = ((self->private_impl.f_width >> 2) + (((self->private_impl.f_width & 3) + 3) >> 2));
+      v_byte_width = wuffs_base__u32__ceil_div_pow2(self->private_impl.f_width, 2);
       self->private_impl.f_pad_per_row = ((4 - (v_byte_width & 3)) & 3);
     } else if (self->private_impl.f_bits_per_pixel == 4) {
-      v_byte_width = ((self->private_impl.f_width >> 1) + (self->private_impl.f_width & 1));
+      v_byte_width = wuffs_base__u32__ceil_div_pow2(self->private_impl.f_width, 1);
       self->private_impl.f_pad_per_row = ((4 - (v_byte_width & 3)) & 3);
     } else if (self->private_impl.f_bits_per_pixel == 8) {
       self->private_impl.f_pad_per_row = ((4 - (self->private_impl.f_width & 3)) & 3);
@@ -21943,6 +24698,11 @@ wuffs_bmp__decoder__decode_image_config(
     a_src->meta.ri = ((size_t)(iop_a_src - a_src->data.ptr));
   }
 
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      0,
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -21951,6 +24711,7 @@ wuffs_bmp__decoder__decode_image_config(
 
 // -------- func bmp.decoder.decode_frame_config
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_bmp__decoder__decode_frame_config(
     wuffs_bmp__decoder* self,
@@ -21976,6 +24737,9 @@ wuffs_bmp__decoder__decode_frame_config(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      0)
 
   const uint8_t* iop_a_src = NULL;
   const uint8_t* io0_a_src WUFFS_BASE__POTENTIALLY_UNUSED = NULL;
@@ -22052,6 +24816,11 @@ wuffs_bmp__decoder__decode_frame_config(
     a_src->meta.ri = ((size_t)(iop_a_src - a_src->data.ptr));
   }
 
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      0,
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -22060,6 +24829,7 @@ wuffs_bmp__decoder__decode_frame_config(
 
 // -------- func bmp.decoder.decode_frame
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_bmp__decoder__decode_frame(
     wuffs_bmp__decoder* self,
@@ -22088,6 +24858,9 @@ wuffs_bmp__decoder__decode_frame(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      0)
 
   wuffs_base__status v_status = wuffs_base__make_status(NULL);
 
@@ -22241,6 +25014,11 @@ wuffs_bmp__decoder__decode_frame(
     a_src->meta.ri = ((size_t)(iop_a_src - a_src->data.ptr));
   }
 
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      0,
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -22249,6 +25027,7 @@ wuffs_bmp__decoder__decode_frame(
 
 // -------- func bmp.decoder.swizzle_none
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_bmp__decoder__swizzle_none(
     wuffs_bmp__decoder* self,
@@ -22284,7 +25063,7 @@ wuffs_bmp__decoder__swizzle_none(
     goto exit;
   }
   v_dst_bytes_per_pixel = ((uint64_t)((v_dst_bits_per_pixel / 8)));
-  v_dst_bytes_per_row = (((uint64_t)(self->private_impl.f_width)) * v_dst_bytes_per_pixel);
+  v_dst_bytes_per_row = (self->private_impl.f_width * v_dst_bytes_per_pixel);
   v_dst_palette = wuffs_base__pixel_buffer__palette_or_else(a_dst, wuffs_base__make_slice_u8((self->private_data.f_scratch) + 1024, 1024));
   v_tab = wuffs_base__pixel_buffer__plane(a_dst, 0);
   label__outer__continue:;
@@ -22316,7 +25095,7 @@ wuffs_bmp__decoder__swizzle_none(
       if (v_dst_bytes_per_row < ((uint64_t)(v_dst.len))) {
         v_dst = wuffs_base__slice_u8__subslice_j(v_dst, v_dst_bytes_per_row);
       }
-      v_i = (((uint64_t)(self->private_impl.f_dst_x)) * v_dst_bytes_per_pixel);
+      v_i = (self->private_impl.f_dst_x * v_dst_bytes_per_pixel);
       if (v_i >= ((uint64_t)(v_dst.len))) {
         goto label__inner__continue;
       }
@@ -22350,6 +25129,7 @@ wuffs_bmp__decoder__swizzle_none(
 
 // -------- func bmp.decoder.swizzle_rle
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_bmp__decoder__swizzle_rle(
     wuffs_bmp__decoder* self,
@@ -22392,7 +25172,7 @@ wuffs_bmp__decoder__swizzle_rle(
     goto exit;
   }
   v_dst_bytes_per_pixel = ((uint64_t)((v_dst_bits_per_pixel / 8)));
-  v_dst_bytes_per_row = (((uint64_t)(self->private_impl.f_width)) * v_dst_bytes_per_pixel);
+  v_dst_bytes_per_row = (self->private_impl.f_width * v_dst_bytes_per_pixel);
   v_dst_palette = wuffs_base__pixel_buffer__palette_or_else(a_dst, wuffs_base__make_slice_u8((self->private_data.f_scratch) + 1024, 1024));
   v_tab = wuffs_base__pixel_buffer__plane(a_dst, 0);
   v_rle_state = self->private_impl.f_rle_state;
@@ -22404,7 +25184,7 @@ wuffs_bmp__decoder__swizzle_rle(
     }
     label__middle__continue:;
     while (true) {
-      v_i = (((uint64_t)(self->private_impl.f_dst_x)) * v_dst_bytes_per_pixel);
+      v_i = (self->private_impl.f_dst_x * v_dst_bytes_per_pixel);
       if (v_i <= ((uint64_t)(v_row.len))) {
         v_dst = wuffs_base__slice_u8__subslice_i(v_row, v_i);
       } else {
@@ -22491,7 +25271,7 @@ wuffs_bmp__decoder__swizzle_rle(
               wuffs_base__u32__sat_add_indirect(&self->private_impl.f_dst_x, ((uint32_t)((v_n & 4294967295))));
               wuffs_base__u32__sat_sub_indirect(&self->private_impl.f_rle_length, ((uint32_t)((v_n & 4294967295))));
             } else {
-              v_chunk_count = ((self->private_impl.f_rle_length + 3) / 4);
+              v_chunk_count = wuffs_base__u32__ceil_div_pow2(self->private_impl.f_rle_length, 2);
               v_p0 = 0;
               while ((v_chunk_count > 0) && (((uint64_t)(io2_a_src - iop_a_src)) >= 2)) {
                 v_chunk_bits = ((uint32_t)(wuffs_base__peek_u16be__no_bounds_check(iop_a_src)));
@@ -22613,6 +25393,7 @@ wuffs_bmp__decoder__swizzle_rle(
 
 // -------- func bmp.decoder.swizzle_bitfields
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_bmp__decoder__swizzle_bitfields(
     wuffs_bmp__decoder* self,
@@ -22655,7 +25436,7 @@ wuffs_bmp__decoder__swizzle_bitfields(
     goto exit;
   }
   v_dst_bytes_per_pixel = ((uint64_t)((v_dst_bits_per_pixel / 8)));
-  v_dst_bytes_per_row = (((uint64_t)(self->private_impl.f_width)) * v_dst_bytes_per_pixel);
+  v_dst_bytes_per_row = (self->private_impl.f_width * v_dst_bytes_per_pixel);
   v_dst_palette = wuffs_base__pixel_buffer__palette_or_else(a_dst, wuffs_base__make_slice_u8((self->private_data.f_scratch) + 1024, 1024));
   v_tab = wuffs_base__pixel_buffer__plane(a_dst, 0);
   label__outer__continue:;
@@ -22709,7 +25490,7 @@ wuffs_bmp__decoder__swizzle_bitfields(
             v_c = ((v_c32 & self->private_impl.f_channel_masks[v_channel]) >> self->private_impl.f_channel_shifts[v_channel]);
             v_num_bits = ((uint32_t)(self->private_impl.f_channel_num_bits[v_channel]));
             while (v_num_bits < 16) {
-              v_c |= ((uint32_t)(v_c << v_num_bits));
+              v_c |= wuffs_base__u32__mod_shift_left(v_c, v_num_bits);
               v_num_bits *= 2;
             }
             v_c >>= (v_num_bits - 16);
@@ -22725,7 +25506,7 @@ wuffs_bmp__decoder__swizzle_bitfields(
       if (v_dst_bytes_per_row < ((uint64_t)(v_dst.len))) {
         v_dst = wuffs_base__slice_u8__subslice_j(v_dst, v_dst_bytes_per_row);
       }
-      v_i = (((uint64_t)(self->private_impl.f_dst_x)) * v_dst_bytes_per_pixel);
+      v_i = (self->private_impl.f_dst_x * v_dst_bytes_per_pixel);
       if (v_i >= ((uint64_t)(v_dst.len))) {
         goto label__inner__continue;
       }
@@ -22754,6 +25535,7 @@ wuffs_bmp__decoder__swizzle_bitfields(
 
 // -------- func bmp.decoder.swizzle_low_bit_depth
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_bmp__decoder__swizzle_low_bit_depth(
     wuffs_bmp__decoder* self,
@@ -22792,7 +25574,7 @@ wuffs_bmp__decoder__swizzle_low_bit_depth(
     goto exit;
   }
   v_dst_bytes_per_pixel = ((uint64_t)((v_dst_bits_per_pixel / 8)));
-  v_dst_bytes_per_row = (((uint64_t)(self->private_impl.f_width)) * v_dst_bytes_per_pixel);
+  v_dst_bytes_per_row = (self->private_impl.f_width * v_dst_bytes_per_pixel);
   v_dst_palette = wuffs_base__pixel_buffer__palette_or_else(a_dst, wuffs_base__make_slice_u8((self->private_data.f_scratch) + 1024, 1024));
   v_tab = wuffs_base__pixel_buffer__plane(a_dst, 0);
   label__loop__continue:;
@@ -22808,7 +25590,7 @@ wuffs_bmp__decoder__swizzle_low_bit_depth(
     if (v_dst_bytes_per_row < ((uint64_t)(v_dst.len))) {
       v_dst = wuffs_base__slice_u8__subslice_j(v_dst, v_dst_bytes_per_row);
     }
-    v_i = (((uint64_t)(self->private_impl.f_dst_x)) * v_dst_bytes_per_pixel);
+    v_i = (self->private_impl.f_dst_x * v_dst_bytes_per_pixel);
     if (v_i >= ((uint64_t)(v_dst.len))) {
       goto label__loop__continue;
     }
@@ -22923,6 +25705,7 @@ wuffs_bmp__decoder__swizzle_low_bit_depth(
 
 // -------- func bmp.decoder.frame_dirty_rect
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__rect_ie_u32
 wuffs_bmp__decoder__frame_dirty_rect(
     const wuffs_bmp__decoder* self) {
@@ -22943,6 +25726,7 @@ wuffs_bmp__decoder__frame_dirty_rect(
 
 // -------- func bmp.decoder.num_animation_loops
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint32_t
 wuffs_bmp__decoder__num_animation_loops(
     const wuffs_bmp__decoder* self) {
@@ -22959,6 +25743,7 @@ wuffs_bmp__decoder__num_animation_loops(
 
 // -------- func bmp.decoder.num_decoded_frame_configs
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_bmp__decoder__num_decoded_frame_configs(
     const wuffs_bmp__decoder* self) {
@@ -22978,6 +25763,7 @@ wuffs_bmp__decoder__num_decoded_frame_configs(
 
 // -------- func bmp.decoder.num_decoded_frames
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_bmp__decoder__num_decoded_frames(
     const wuffs_bmp__decoder* self) {
@@ -22997,6 +25783,7 @@ wuffs_bmp__decoder__num_decoded_frames(
 
 // -------- func bmp.decoder.restart_frame
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_bmp__decoder__restart_frame(
     wuffs_bmp__decoder* self,
@@ -23025,6 +25812,7 @@ wuffs_bmp__decoder__restart_frame(
 
 // -------- func bmp.decoder.set_report_metadata
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_bmp__decoder__set_report_metadata(
     wuffs_bmp__decoder* self,
@@ -23035,6 +25823,7 @@ wuffs_bmp__decoder__set_report_metadata(
 
 // -------- func bmp.decoder.tell_me_more
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_bmp__decoder__tell_me_more(
     wuffs_bmp__decoder* self,
@@ -23061,6 +25850,9 @@ wuffs_bmp__decoder__tell_me_more(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst))
 
   if (self->private_impl.f_io_redirect_fourcc <= 1) {
     status = wuffs_base__make_status(wuffs_base__error__no_more_information);
@@ -23080,6 +25872,11 @@ wuffs_bmp__decoder__tell_me_more(
   ok:
   goto exit;
   exit:
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst),
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -23088,6 +25885,7 @@ wuffs_bmp__decoder__tell_me_more(
 
 // -------- func bmp.decoder.workbuf_len
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_bmp__decoder__workbuf_len(
     const wuffs_bmp__decoder* self) {
@@ -23104,6 +25902,7 @@ wuffs_bmp__decoder__workbuf_len(
 
 // -------- func bmp.decoder.read_palette
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_bmp__decoder__read_palette(
     wuffs_bmp__decoder* self,
@@ -23240,6 +26039,7 @@ wuffs_bmp__decoder__read_palette(
 
 // -------- func bmp.decoder.process_masks
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_bmp__decoder__process_masks(
     wuffs_bmp__decoder* self) {
@@ -23258,16 +26058,11 @@ wuffs_bmp__decoder__process_masks(
         v_mask >>= 1;
       }
       self->private_impl.f_channel_shifts[v_i] = ((uint8_t)((v_n & 31)));
-      v_n = 0;
-      while ((v_mask & 1) == 1) {
-        v_n += 1;
-        v_mask >>= 1;
-      }
-      if ((v_mask != 0) || (v_n > 32)) {
+      if ((v_mask == 0) || ((v_mask & ((uint32_t)(v_mask + 1))) != 0)) {
         status = wuffs_base__make_status(wuffs_bmp__error__bad_header);
         goto exit;
       }
-      self->private_impl.f_channel_num_bits[v_i] = ((uint8_t)(v_n));
+      self->private_impl.f_channel_num_bits[v_i] = ((uint8_t)((wuffs_base__u32__floor_log2(v_mask) + 1)));
     } else if (v_i != 3) {
       status = wuffs_base__make_status(wuffs_bmp__error__bad_header);
       goto exit;
@@ -23282,6 +26077,77 @@ wuffs_bmp__decoder__process_masks(
   return status;
 }
 
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_bmp__decoder__visit_metadata(
+    wuffs_bmp__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__more_information* a_minfo,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__metadata_chunk_func a_callback,
+    void* a_context) {
+  if (!a_minfo) {
+    return wuffs_base__make_status(wuffs_base__error__bad_argument);
+  }
+  while (true) {
+    wuffs_base__status status = wuffs_base__more_information__deliver_metadata(
+        a_minfo, a_src, a_callback, a_context);
+    if (status.repr) {
+      return status;
+    }
+    status = wuffs_bmp__decoder__tell_me_more(self, a_dst, a_minfo, a_src);
+    if (status.repr != wuffs_base__suspension__even_more_information) {
+      return status;
+    }
+  }
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_bmp__decoder__read_metadata_chunk(
+    wuffs_bmp__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__metadata_reader* a_reader,
+    wuffs_base__io_buffer* a_src) {
+  if (!a_reader) {
+    return wuffs_base__make_status(wuffs_base__error__bad_argument);
+  }
+  while (true) {
+    wuffs_base__status status = wuffs_base__metadata_reader__next_chunk(a_reader, a_src);
+    if (status.repr || (a_reader->chunk.len > 0)) {
+      return status;
+    }
+    status = wuffs_bmp__decoder__tell_me_more(self, a_dst, &a_reader->minfo, a_src);
+    if (status.repr != wuffs_base__suspension__even_more_information) {
+      return status;
+    }
+  }
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_bmp__decoder__probe(
+    wuffs_bmp__decoder* self,
+    wuffs_base__image_config* a_dst,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__range_ii_u64* a_workbuf_len) {
+  wuffs_base__status status = wuffs_bmp__decoder__decode_image_config(self, a_dst, a_src);
+  if (!status.repr && a_workbuf_len) {
+    *a_workbuf_len = wuffs_bmp__decoder__workbuf_len(self);
+  }
+  return status;
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_bmp__decoder__telemetry(
+    const wuffs_bmp__decoder* self) {
+#if defined(WUFFS_CONFIG__TELEMETRY)
+  if (self &&
+      ((self->private_impl.magic == WUFFS_BASE__MAGIC) ||
+      (self->private_impl.magic == WUFFS_BASE__DISABLED))) {
+    return self->private_impl.telemetry;
+  }
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
+  return wuffs_base__empty_telemetry();
+}
+
 #endif  // !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__BMP)
 
 #if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__CBOR)
@@ -23293,6 +26159,88 @@ const char wuffs_cbor__error__unsupported_recursion_depth[] = "#cbor: unsupporte
 const char wuffs_cbor__error__internal_error_inconsistent_i_o[] = "#cbor: internal error: inconsistent I/O";
 const char wuffs_cbor__error__internal_error_inconsistent_token_length[] = "#cbor: internal error: inconsistent token length";
 
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_cbor__status_http_code(const char* repr) {
+  if (repr == wuffs_cbor__error__bad_input) {
+    return 422;
+  }
+  if (repr == wuffs_cbor__error__unsupported_recursion_depth) {
+    return 413;
+  }
+  return 0;
+}
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_cbor__status_errno(const char* repr) {
+  if (repr == wuffs_cbor__error__bad_input) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_cbor__error__unsupported_recursion_depth) {
+    return EFBIG;
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+static const char* const wuffs_cbor__status__enum_table[] = {
+  wuffs_cbor__error__bad_input,
+  wuffs_cbor__error__unsupported_recursion_depth,
+  wuffs_cbor__error__internal_error_inconsistent_i_o,
+  wuffs_cbor__error__internal_error_inconsistent_token_length,
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_cbor__status__enum_table) / sizeof(wuffs_cbor__status__enum_table[0])) == WUFFS_CBOR__STATUS_ENUM__MAX_INCL,
+    wuffs_cbor__status__enum_table_is_complete);
+
+static const uint8_t wuffs_cbor__status__enum_sorted[] = {
+  1,  // WUFFS_CBOR__STATUS_ENUM__ERROR__BAD_INPUT
+  3,  // WUFFS_CBOR__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_I_O
+  4,  // WUFFS_CBOR__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_TOKEN_LENGTH
+  2,  // WUFFS_CBOR__STATUS_ENUM__ERROR__UNSUPPORTED_RECURSION_DEPTH
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_cbor__status__enum_sorted) / sizeof(wuffs_cbor__status__enum_sorted[0])) == WUFFS_CBOR__STATUS_ENUM__MAX_INCL,
+    wuffs_cbor__status__enum_sorted_is_complete);
+
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_cbor__status__from_enum(uint32_t e) {
+  if ((e == 0) || (e > WUFFS_CBOR__STATUS_ENUM__MAX_INCL)) {
+    return NULL;
+  }
+  return wuffs_cbor__status__enum_table[e - 1];
+}
+
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_cbor__status__to_enum(const char* repr) {
+  uint32_t lo = 0;
+  uint32_t hi = WUFFS_CBOR__STATUS_ENUM__MAX_INCL;
+  if (!repr) {
+    return 0;
+  }
+  while (lo < hi) {
+    uint32_t mid = lo + ((hi - lo) / 2);
+    uint32_t e = wuffs_cbor__status__enum_sorted[mid];
+    int c = strcmp(repr, wuffs_cbor__status__enum_table[e - 1]);
+    if (c == 0) {
+      return e;
+    } else if (c < 0) {
+      hi = mid;
+    } else {
+      lo = mid + 1;
+    }
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
 // ---------------- Private Consts
 
 static const uint32_t
@@ -23328,7 +26276,7 @@ wuffs_cbor__decoder__func_ptrs_for__wuffs_base__token_decoder = {
 
 // ---------------- Initializer Implementations
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_cbor__decoder__initialize(
     wuffs_cbor__decoder* self,
     size_t sizeof_star_self,
@@ -23367,6 +26315,10 @@ wuffs_cbor__decoder__initialize(
     }
   }
 
+  if ((options & WUFFS_INITIALIZE__WORKBUF_LESS) != 0) {
+    return wuffs_base__make_status(wuffs_base__error__unsupported_option);
+  }
+
   self->private_impl.magic = WUFFS_BASE__MAGIC;
   self->private_impl.vtable_for__wuffs_base__token_decoder.vtable_name =
       wuffs_base__token_decoder__vtable_name;
@@ -23375,7 +26327,7 @@ wuffs_cbor__decoder__initialize(
   return wuffs_base__make_status(NULL);
 }
 
-wuffs_cbor__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_cbor__decoder*
 wuffs_cbor__decoder__alloc() {
   wuffs_cbor__decoder* x =
       (wuffs_cbor__decoder*)(calloc(sizeof(wuffs_cbor__decoder), 1));
@@ -23390,7 +26342,7 @@ wuffs_cbor__decoder__alloc() {
   return x;
 }
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_cbor__decoder() {
   return sizeof(wuffs_cbor__decoder);
 }
@@ -23399,6 +26351,7 @@ sizeof__wuffs_cbor__decoder() {
 
 // -------- func cbor.decoder.set_quirk_enabled
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_cbor__decoder__set_quirk_enabled(
     wuffs_cbor__decoder* self,
@@ -23409,6 +26362,7 @@ wuffs_cbor__decoder__set_quirk_enabled(
 
 // -------- func cbor.decoder.workbuf_len
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_cbor__decoder__workbuf_len(
     const wuffs_cbor__decoder* self) {
@@ -23425,6 +26379,7 @@ wuffs_cbor__decoder__workbuf_len(
 
 // -------- func cbor.decoder.decode_tokens
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_cbor__decoder__decode_tokens(
     wuffs_cbor__decoder* self,
@@ -23451,6 +26406,9 @@ wuffs_cbor__decoder__decode_tokens(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      0)
 
   uint64_t v_string_length = 0;
   uint64_t v_n64 = 0;
@@ -23513,6 +26471,7 @@ wuffs_cbor__decoder__decode_tokens(
         while (true) {
           if (((uint64_t)(io2_a_dst - iop_a_dst)) <= 1) {
             status = wuffs_base__make_status(wuffs_base__suspension__short_write);
+            self->private_impl.tokens_needed = 2;
             WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(1);
             goto label__outer__continue;
           }
@@ -23662,6 +26621,7 @@ wuffs_cbor__decoder__decode_tokens(
             while (true) {
               if (((uint64_t)(io2_a_dst - iop_a_dst)) <= 0) {
                 status = wuffs_base__make_status(wuffs_base__suspension__short_write);
+                self->private_impl.tokens_needed = 1;
                 WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(4);
                 goto label__0__continue;
               }
@@ -23728,6 +26688,7 @@ wuffs_cbor__decoder__decode_tokens(
             while (true) {
               if (((uint64_t)(io2_a_dst - iop_a_dst)) <= 0) {
                 status = wuffs_base__make_status(wuffs_base__suspension__short_write);
+                self->private_impl.tokens_needed = 1;
                 WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(6);
                 goto label__1__continue;
               }
@@ -23965,6 +26926,7 @@ wuffs_cbor__decoder__decode_tokens(
         label__2__continue:;
         while (((uint64_t)(io2_a_dst - iop_a_dst)) <= 0) {
           status = wuffs_base__make_status(wuffs_base__suspension__short_write);
+          self->private_impl.tokens_needed = 1;
           WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(8);
           goto label__2__continue;
         }
@@ -24021,18 +26983,54 @@ wuffs_cbor__decoder__decode_tokens(
     a_src->meta.ri = ((size_t)(iop_a_src - a_src->data.ptr));
   }
 
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      0,
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
   return status;
 }
 
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_cbor__decoder__decode_tokens_batch(
+    wuffs_cbor__decoder* self,
+    wuffs_base__token_buffer* a_dst,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__slice_u8 a_workbuf,
+    uint64_t* a_tokens_needed) {
+  wuffs_base__status status = wuffs_cbor__decoder__decode_tokens(self, a_dst, a_src, a_workbuf);
+  if (a_tokens_needed) {
+    *a_tokens_needed = 0;
+    if (self && (status.repr == wuffs_base__suspension__short_write)) {
+      *a_tokens_needed = self->private_impl.tokens_needed;
+    }
+  }
+  return status;
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_cbor__decoder__telemetry(
+    const wuffs_cbor__decoder* self) {
+#if defined(WUFFS_CONFIG__TELEMETRY)
+  if (self &&
+      ((self->private_impl.magic == WUFFS_BASE__MAGIC) ||
+      (self->private_impl.magic == WUFFS_BASE__DISABLED))) {
+    return self->private_impl.telemetry;
+  }
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
+  return wuffs_base__empty_telemetry();
+}
+
 #endif  // !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__CBOR)
 
 #if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__CRC32)
 
 // ---------------- Status Codes Implementations
 
+// ‼ WUFFS MULTI-FILE SECTION +shared
 // ---------------- Private Consts
 
 static const uint32_t
@@ -24593,6 +27591,8 @@ WUFFS_CRC32__IEEE_X86_SSE42_PXMU[16] WUFFS_BASE__POTENTIALLY_UNUSED = {
   65, 22, 1, 247, 1, 0, 0, 0,
 };
 
+// ‼ WUFFS MULTI-FILE SECTION -shared
+
 // ---------------- Private Initializer Prototypes
 
 // ---------------- Private Function Prototypes
@@ -24634,7 +27634,7 @@ wuffs_crc32__ieee_hasher__func_ptrs_for__wuffs_base__hasher_u32 = {
 
 // ---------------- Initializer Implementations
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_crc32__ieee_hasher__initialize(
     wuffs_crc32__ieee_hasher* self,
     size_t sizeof_star_self,
@@ -24673,7 +27673,18 @@ wuffs_crc32__ieee_hasher__initialize(
     }
   }
 
+  self->private_impl.avoid_cpu_arch = options & WUFFS_INITIALIZE__AVOID_CPU_ARCH;
   self->private_impl.choosy_up = &wuffs_crc32__ieee_hasher__up__choosy_default;
+  self->private_impl.choosy_up = (
+#if defined(WUFFS_BASE__CPU_ARCH__ARM_CRC32)
+      (((self->private_impl.avoid_cpu_arch & WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_CRC32) == 0) &&
+      wuffs_base__cpu_arch__have_arm_crc32()) ? &wuffs_crc32__ieee_hasher__up_arm_crc32 :
+#endif
+#if defined(WUFFS_BASE__CPU_ARCH__X86_64)
+      (((self->private_impl.avoid_cpu_arch & WUFFS_INITIALIZE__AVOID_CPU_ARCH__X86_SSE42) == 0) &&
+      wuffs_base__cpu_arch__have_x86_sse42()) ? &wuffs_crc32__ieee_hasher__up_x86_sse42 :
+#endif
+      self->private_impl.choosy_up);
 
   self->private_impl.magic = WUFFS_BASE__MAGIC;
   self->private_impl.vtable_for__wuffs_base__hasher_u32.vtable_name =
@@ -24683,7 +27694,7 @@ wuffs_crc32__ieee_hasher__initialize(
   return wuffs_base__make_status(NULL);
 }
 
-wuffs_crc32__ieee_hasher*
+WUFFS_BASE__MAYBE_STATIC wuffs_crc32__ieee_hasher*
 wuffs_crc32__ieee_hasher__alloc() {
   wuffs_crc32__ieee_hasher* x =
       (wuffs_crc32__ieee_hasher*)(calloc(sizeof(wuffs_crc32__ieee_hasher), 1));
@@ -24698,7 +27709,7 @@ wuffs_crc32__ieee_hasher__alloc() {
   return x;
 }
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_crc32__ieee_hasher() {
   return sizeof(wuffs_crc32__ieee_hasher);
 }
@@ -24707,6 +27718,7 @@ sizeof__wuffs_crc32__ieee_hasher() {
 
 // -------- func crc32.ieee_hasher.set_quirk_enabled
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_crc32__ieee_hasher__set_quirk_enabled(
     wuffs_crc32__ieee_hasher* self,
@@ -24717,6 +27729,7 @@ wuffs_crc32__ieee_hasher__set_quirk_enabled(
 
 // -------- func crc32.ieee_hasher.update_u32
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint32_t
 wuffs_crc32__ieee_hasher__update_u32(
     wuffs_crc32__ieee_hasher* self,
@@ -24729,14 +27742,7 @@ wuffs_crc32__ieee_hasher__update_u32(
   }
 
   if (self->private_impl.f_state == 0) {
-    self->private_impl.choosy_up = (
-#if defined(WUFFS_BASE__CPU_ARCH__ARM_CRC32)
-        wuffs_base__cpu_arch__have_arm_crc32() ? &wuffs_crc32__ieee_hasher__up_arm_crc32 :
-#endif
-#if defined(WUFFS_BASE__CPU_ARCH__X86_64)
-        wuffs_base__cpu_arch__have_x86_sse42() ? &wuffs_crc32__ieee_hasher__up_x86_sse42 :
-#endif
-        self->private_impl.choosy_up);
+    // choose up: done once, by the initialize function.
   }
   wuffs_crc32__ieee_hasher__up(self, a_x);
   return self->private_impl.f_state;
@@ -24744,6 +27750,7 @@ wuffs_crc32__ieee_hasher__update_u32(
 
 // -------- func crc32.ieee_hasher.up
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_crc32__ieee_hasher__up(
     wuffs_crc32__ieee_hasher* self,
@@ -24751,6 +27758,7 @@ wuffs_crc32__ieee_hasher__up(
   return (*self->private_impl.choosy_up)(self, a_x);
 }
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_crc32__ieee_hasher__up__choosy_default(
     wuffs_crc32__ieee_hasher* self,
@@ -24849,6 +27857,7 @@ wuffs_crc32__ieee_hasher__up__choosy_default(
 // -------- func crc32.ieee_hasher.up_arm_crc32
 
 #if defined(WUFFS_BASE__CPU_ARCH__ARM_CRC32)
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_crc32__ieee_hasher__up_arm_crc32(
     wuffs_crc32__ieee_hasher* self,
@@ -24925,6 +27934,7 @@ wuffs_crc32__ieee_hasher__up_arm_crc32(
 
 #if defined(WUFFS_BASE__CPU_ARCH__X86_64)
 WUFFS_BASE__MAYBE_ATTRIBUTE_TARGET("pclmul,popcnt,sse4.2")
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_crc32__ieee_hasher__up_x86_sse42(
     wuffs_crc32__ieee_hasher* self,
@@ -25063,6 +28073,180 @@ const char wuffs_deflate__error__internal_error_inconsistent_i_o[] = "#deflate:
 const char wuffs_deflate__error__internal_error_inconsistent_distance[] = "#deflate: internal error: inconsistent distance";
 const char wuffs_deflate__error__internal_error_inconsistent_n_bits[] = "#deflate: internal error: inconsistent n_bits";
 
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_deflate__status_http_code(const char* repr) {
+  if (repr == wuffs_deflate__error__bad_huffman_code_over_subscribed) {
+    return 422;
+  }
+  if (repr == wuffs_deflate__error__bad_huffman_code_under_subscribed) {
+    return 422;
+  }
+  if (repr == wuffs_deflate__error__bad_huffman_code_length_count) {
+    return 422;
+  }
+  if (repr == wuffs_deflate__error__bad_huffman_code_length_repetition) {
+    return 422;
+  }
+  if (repr == wuffs_deflate__error__bad_huffman_code) {
+    return 422;
+  }
+  if (repr == wuffs_deflate__error__bad_huffman_minimum_code_length) {
+    return 422;
+  }
+  if (repr == wuffs_deflate__error__bad_block) {
+    return 422;
+  }
+  if (repr == wuffs_deflate__error__bad_distance) {
+    return 422;
+  }
+  if (repr == wuffs_deflate__error__bad_distance_code_count) {
+    return 422;
+  }
+  if (repr == wuffs_deflate__error__bad_literal_length_code_count) {
+    return 422;
+  }
+  if (repr == wuffs_deflate__error__inconsistent_stored_block_length) {
+    return 422;
+  }
+  if (repr == wuffs_deflate__error__missing_end_of_block_code) {
+    return 422;
+  }
+  if (repr == wuffs_deflate__error__no_huffman_codes) {
+    return 422;
+  }
+  return 0;
+}
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_deflate__status_errno(const char* repr) {
+  if (repr == wuffs_deflate__error__bad_huffman_code_over_subscribed) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_deflate__error__bad_huffman_code_under_subscribed) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_deflate__error__bad_huffman_code_length_count) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_deflate__error__bad_huffman_code_length_repetition) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_deflate__error__bad_huffman_code) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_deflate__error__bad_huffman_minimum_code_length) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_deflate__error__bad_block) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_deflate__error__bad_distance) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_deflate__error__bad_distance_code_count) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_deflate__error__bad_literal_length_code_count) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_deflate__error__inconsistent_stored_block_length) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_deflate__error__missing_end_of_block_code) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_deflate__error__no_huffman_codes) {
+    return EBADMSG;
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+static const char* const wuffs_deflate__status__enum_table[] = {
+  wuffs_deflate__error__bad_huffman_code_over_subscribed,
+  wuffs_deflate__error__bad_huffman_code_under_subscribed,
+  wuffs_deflate__error__bad_huffman_code_length_count,
+  wuffs_deflate__error__bad_huffman_code_length_repetition,
+  wuffs_deflate__error__bad_huffman_code,
+  wuffs_deflate__error__bad_huffman_minimum_code_length,
+  wuffs_deflate__error__bad_block,
+  wuffs_deflate__error__bad_distance,
+  wuffs_deflate__error__bad_distance_code_count,
+  wuffs_deflate__error__bad_literal_length_code_count,
+  wuffs_deflate__error__inconsistent_stored_block_length,
+  wuffs_deflate__error__missing_end_of_block_code,
+  wuffs_deflate__error__no_huffman_codes,
+  wuffs_deflate__error__internal_error_inconsistent_huffman_decoder_state,
+  wuffs_deflate__error__internal_error_inconsistent_i_o,
+  wuffs_deflate__error__internal_error_inconsistent_distance,
+  wuffs_deflate__error__internal_error_inconsistent_n_bits,
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_deflate__status__enum_table) / sizeof(wuffs_deflate__status__enum_table[0])) == WUFFS_DEFLATE__STATUS_ENUM__MAX_INCL,
+    wuffs_deflate__status__enum_table_is_complete);
+
+static const uint8_t wuffs_deflate__status__enum_sorted[] = {
+  5,  // WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_HUFFMAN_CODE
+  1,  // WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_HUFFMAN_CODE_OVER_SUBSCRIBED
+  2,  // WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_HUFFMAN_CODE_UNDER_SUBSCRIBED
+  3,  // WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_HUFFMAN_CODE_LENGTH_COUNT
+  4,  // WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_HUFFMAN_CODE_LENGTH_REPETITION
+  6,  // WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_HUFFMAN_MINIMUM_CODE_LENGTH
+  7,  // WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_BLOCK
+  8,  // WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_DISTANCE
+  9,  // WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_DISTANCE_CODE_COUNT
+  10,  // WUFFS_DEFLATE__STATUS_ENUM__ERROR__BAD_LITERAL_LENGTH_CODE_COUNT
+  11,  // WUFFS_DEFLATE__STATUS_ENUM__ERROR__INCONSISTENT_STORED_BLOCK_LENGTH
+  14,  // WUFFS_DEFLATE__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_HUFFMAN_DECODER_STATE
+  15,  // WUFFS_DEFLATE__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_I_O
+  16,  // WUFFS_DEFLATE__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_DISTANCE
+  17,  // WUFFS_DEFLATE__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_N_BITS
+  12,  // WUFFS_DEFLATE__STATUS_ENUM__ERROR__MISSING_END_OF_BLOCK_CODE
+  13,  // WUFFS_DEFLATE__STATUS_ENUM__ERROR__NO_HUFFMAN_CODES
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_deflate__status__enum_sorted) / sizeof(wuffs_deflate__status__enum_sorted[0])) == WUFFS_DEFLATE__STATUS_ENUM__MAX_INCL,
+    wuffs_deflate__status__enum_sorted_is_complete);
+
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_deflate__status__from_enum(uint32_t e) {
+  if ((e == 0) || (e > WUFFS_DEFLATE__STATUS_ENUM__MAX_INCL)) {
+    return NULL;
+  }
+  return wuffs_deflate__status__enum_table[e - 1];
+}
+
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_deflate__status__to_enum(const char* repr) {
+  uint32_t lo = 0;
+  uint32_t hi = WUFFS_DEFLATE__STATUS_ENUM__MAX_INCL;
+  if (!repr) {
+    return 0;
+  }
+  while (lo < hi) {
+    uint32_t mid = lo + ((hi - lo) / 2);
+    uint32_t e = wuffs_deflate__status__enum_sorted[mid];
+    int c = strcmp(repr, wuffs_deflate__status__enum_table[e - 1]);
+    if (c == 0) {
+      return e;
+    } else if (c < 0) {
+      hi = mid;
+    } else {
+      lo = mid + 1;
+    }
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
 // ---------------- Private Consts
 
 static const uint8_t
@@ -25195,7 +28379,7 @@ wuffs_deflate__decoder__func_ptrs_for__wuffs_base__io_transformer = {
 
 // ---------------- Initializer Implementations
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_deflate__decoder__initialize(
     wuffs_deflate__decoder* self,
     size_t sizeof_star_self,
@@ -25234,6 +28418,10 @@ wuffs_deflate__decoder__initialize(
     }
   }
 
+  if ((options & WUFFS_INITIALIZE__WORKBUF_LESS) != 0) {
+    return wuffs_base__make_status(wuffs_base__error__unsupported_option);
+  }
+
   self->private_impl.magic = WUFFS_BASE__MAGIC;
   self->private_impl.vtable_for__wuffs_base__io_transformer.vtable_name =
       wuffs_base__io_transformer__vtable_name;
@@ -25242,7 +28430,7 @@ wuffs_deflate__decoder__initialize(
   return wuffs_base__make_status(NULL);
 }
 
-wuffs_deflate__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_deflate__decoder*
 wuffs_deflate__decoder__alloc() {
   wuffs_deflate__decoder* x =
       (wuffs_deflate__decoder*)(calloc(sizeof(wuffs_deflate__decoder), 1));
@@ -25257,7 +28445,7 @@ wuffs_deflate__decoder__alloc() {
   return x;
 }
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_deflate__decoder() {
   return sizeof(wuffs_deflate__decoder);
 }
@@ -25266,6 +28454,7 @@ sizeof__wuffs_deflate__decoder() {
 
 // -------- func deflate.decoder.add_history
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_deflate__decoder__add_history(
     wuffs_deflate__decoder* self,
@@ -25306,6 +28495,7 @@ wuffs_deflate__decoder__add_history(
 
 // -------- func deflate.decoder.set_quirk_enabled
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_deflate__decoder__set_quirk_enabled(
     wuffs_deflate__decoder* self,
@@ -25316,6 +28506,7 @@ wuffs_deflate__decoder__set_quirk_enabled(
 
 // -------- func deflate.decoder.workbuf_len
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_deflate__decoder__workbuf_len(
     const wuffs_deflate__decoder* self) {
@@ -25332,6 +28523,7 @@ wuffs_deflate__decoder__workbuf_len(
 
 // -------- func deflate.decoder.transform_io
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_deflate__decoder__transform_io(
     wuffs_deflate__decoder* self,
@@ -25358,6 +28550,9 @@ wuffs_deflate__decoder__transform_io(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst))
 
   uint64_t v_mark = 0;
   wuffs_base__status v_status = wuffs_base__make_status(NULL);
@@ -25424,6 +28619,11 @@ wuffs_deflate__decoder__transform_io(
     a_dst->meta.wi = ((size_t)(iop_a_dst - a_dst->data.ptr));
   }
 
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst),
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -25432,6 +28632,7 @@ wuffs_deflate__decoder__transform_io(
 
 // -------- func deflate.decoder.decode_blocks
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_deflate__decoder__decode_blocks(
     wuffs_deflate__decoder* self,
@@ -25587,6 +28788,7 @@ wuffs_deflate__decoder__decode_blocks(
 
 // -------- func deflate.decoder.decode_uncompressed
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_deflate__decoder__decode_uncompressed(
     wuffs_deflate__decoder* self,
@@ -25710,6 +28912,7 @@ wuffs_deflate__decoder__decode_uncompressed(
 
 // -------- func deflate.decoder.init_fixed_huffman
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_deflate__decoder__init_fixed_huffman(
     wuffs_deflate__decoder* self) {
@@ -25757,6 +28960,7 @@ wuffs_deflate__decoder__init_fixed_huffman(
 
 // -------- func deflate.decoder.init_dynamic_huffman
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_deflate__decoder__init_dynamic_huffman(
     wuffs_deflate__decoder* self,
@@ -26017,6 +29221,7 @@ wuffs_deflate__decoder__init_dynamic_huffman(
 
 // -------- func deflate.decoder.init_huff
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_deflate__decoder__init_huff(
     wuffs_deflate__decoder* self,
@@ -26270,6 +29475,7 @@ wuffs_deflate__decoder__init_huff(
 
 // -------- func deflate.decoder.decode_huffman_fast32
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_deflate__decoder__decode_huffman_fast32(
     wuffs_deflate__decoder* self,
@@ -26520,6 +29726,7 @@ wuffs_deflate__decoder__decode_huffman_fast32(
 
 // -------- func deflate.decoder.decode_huffman_fast64
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_deflate__decoder__decode_huffman_fast64(
     wuffs_deflate__decoder* self,
@@ -26722,6 +29929,7 @@ wuffs_deflate__decoder__decode_huffman_fast64(
 
 // -------- func deflate.decoder.decode_huffman_slow
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_deflate__decoder__decode_huffman_slow(
     wuffs_deflate__decoder* self,
@@ -27089,6 +30297,19 @@ wuffs_deflate__decoder__decode_huffman_slow(
   return status;
 }
 
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_deflate__decoder__telemetry(
+    const wuffs_deflate__decoder* self) {
+#if defined(WUFFS_CONFIG__TELEMETRY)
+  if (self &&
+      ((self->private_impl.magic == WUFFS_BASE__MAGIC) ||
+      (self->private_impl.magic == WUFFS_BASE__DISABLED))) {
+    return self->private_impl.telemetry;
+  }
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
+  return wuffs_base__empty_telemetry();
+}
+
 #endif  // !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__DEFLATE)
 
 #if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__LZW)
@@ -27098,6 +30319,78 @@ wuffs_deflate__decoder__decode_huffman_slow(
 const char wuffs_lzw__error__bad_code[] = "#lzw: bad code";
 const char wuffs_lzw__error__internal_error_inconsistent_i_o[] = "#lzw: internal error: inconsistent I/O";
 
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_lzw__status_http_code(const char* repr) {
+  if (repr == wuffs_lzw__error__bad_code) {
+    return 422;
+  }
+  return 0;
+}
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_lzw__status_errno(const char* repr) {
+  if (repr == wuffs_lzw__error__bad_code) {
+    return EBADMSG;
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+static const char* const wuffs_lzw__status__enum_table[] = {
+  wuffs_lzw__error__bad_code,
+  wuffs_lzw__error__internal_error_inconsistent_i_o,
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_lzw__status__enum_table) / sizeof(wuffs_lzw__status__enum_table[0])) == WUFFS_LZW__STATUS_ENUM__MAX_INCL,
+    wuffs_lzw__status__enum_table_is_complete);
+
+static const uint8_t wuffs_lzw__status__enum_sorted[] = {
+  1,  // WUFFS_LZW__STATUS_ENUM__ERROR__BAD_CODE
+  2,  // WUFFS_LZW__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_I_O
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_lzw__status__enum_sorted) / sizeof(wuffs_lzw__status__enum_sorted[0])) == WUFFS_LZW__STATUS_ENUM__MAX_INCL,
+    wuffs_lzw__status__enum_sorted_is_complete);
+
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_lzw__status__from_enum(uint32_t e) {
+  if ((e == 0) || (e > WUFFS_LZW__STATUS_ENUM__MAX_INCL)) {
+    return NULL;
+  }
+  return wuffs_lzw__status__enum_table[e - 1];
+}
+
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_lzw__status__to_enum(const char* repr) {
+  uint32_t lo = 0;
+  uint32_t hi = WUFFS_LZW__STATUS_ENUM__MAX_INCL;
+  if (!repr) {
+    return 0;
+  }
+  while (lo < hi) {
+    uint32_t mid = lo + ((hi - lo) / 2);
+    uint32_t e = wuffs_lzw__status__enum_sorted[mid];
+    int c = strcmp(repr, wuffs_lzw__status__enum_table[e - 1]);
+    if (c == 0) {
+      return e;
+    } else if (c < 0) {
+      hi = mid;
+    } else {
+      lo = mid + 1;
+    }
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
 // ---------------- Private Consts
 
 // ---------------- Private Initializer Prototypes
@@ -27130,7 +30423,7 @@ wuffs_lzw__decoder__func_ptrs_for__wuffs_base__io_transformer = {
 
 // ---------------- Initializer Implementations
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_lzw__decoder__initialize(
     wuffs_lzw__decoder* self,
     size_t sizeof_star_self,
@@ -27169,6 +30462,10 @@ wuffs_lzw__decoder__initialize(
     }
   }
 
+  if ((options & WUFFS_INITIALIZE__WORKBUF_LESS) != 0) {
+    return wuffs_base__make_status(wuffs_base__error__unsupported_option);
+  }
+
   self->private_impl.magic = WUFFS_BASE__MAGIC;
   self->private_impl.vtable_for__wuffs_base__io_transformer.vtable_name =
       wuffs_base__io_transformer__vtable_name;
@@ -27177,7 +30474,7 @@ wuffs_lzw__decoder__initialize(
   return wuffs_base__make_status(NULL);
 }
 
-wuffs_lzw__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_lzw__decoder*
 wuffs_lzw__decoder__alloc() {
   wuffs_lzw__decoder* x =
       (wuffs_lzw__decoder*)(calloc(sizeof(wuffs_lzw__decoder), 1));
@@ -27192,7 +30489,7 @@ wuffs_lzw__decoder__alloc() {
   return x;
 }
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_lzw__decoder() {
   return sizeof(wuffs_lzw__decoder);
 }
@@ -27201,6 +30498,7 @@ sizeof__wuffs_lzw__decoder() {
 
 // -------- func lzw.decoder.set_quirk_enabled
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_lzw__decoder__set_quirk_enabled(
     wuffs_lzw__decoder* self,
@@ -27211,6 +30509,7 @@ wuffs_lzw__decoder__set_quirk_enabled(
 
 // -------- func lzw.decoder.set_literal_width
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_lzw__decoder__set_literal_width(
     wuffs_lzw__decoder* self,
@@ -27232,6 +30531,7 @@ wuffs_lzw__decoder__set_literal_width(
 
 // -------- func lzw.decoder.workbuf_len
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_lzw__decoder__workbuf_len(
     const wuffs_lzw__decoder* self) {
@@ -27248,6 +30548,7 @@ wuffs_lzw__decoder__workbuf_len(
 
 // -------- func lzw.decoder.transform_io
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_lzw__decoder__transform_io(
     wuffs_lzw__decoder* self,
@@ -27274,6 +30575,9 @@ wuffs_lzw__decoder__transform_io(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst))
 
   uint32_t v_i = 0;
 
@@ -27340,6 +30644,11 @@ wuffs_lzw__decoder__transform_io(
 
   goto exit;
   exit:
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst),
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -27348,6 +30657,7 @@ wuffs_lzw__decoder__transform_io(
 
 // -------- func lzw.decoder.read_from
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_lzw__decoder__read_from(
     wuffs_lzw__decoder* self,
@@ -27523,6 +30833,7 @@ wuffs_lzw__decoder__read_from(
 
 // -------- func lzw.decoder.write_to
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_lzw__decoder__write_to(
     wuffs_lzw__decoder* self,
@@ -27592,6 +30903,7 @@ wuffs_lzw__decoder__write_to(
 
 // -------- func lzw.decoder.flush
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__slice_u8
 wuffs_lzw__decoder__flush(
     wuffs_lzw__decoder* self) {
@@ -27615,6 +30927,19 @@ wuffs_lzw__decoder__flush(
   return v_s;
 }
 
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_lzw__decoder__telemetry(
+    const wuffs_lzw__decoder* self) {
+#if defined(WUFFS_CONFIG__TELEMETRY)
+  if (self &&
+      ((self->private_impl.magic == WUFFS_BASE__MAGIC) ||
+      (self->private_impl.magic == WUFFS_BASE__DISABLED))) {
+    return self->private_impl.telemetry;
+  }
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
+  return wuffs_base__empty_telemetry();
+}
+
 #endif  // !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__LZW)
 
 #if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__GIF)
@@ -27629,6 +30954,118 @@ const char wuffs_gif__error__bad_literal_width[] = "#gif: bad literal width";
 const char wuffs_gif__error__bad_palette[] = "#gif: bad palette";
 const char wuffs_gif__error__internal_error_inconsistent_ri_wi[] = "#gif: internal error: inconsistent ri/wi";
 
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_gif__status_http_code(const char* repr) {
+  if (repr == wuffs_gif__error__bad_extension_label) {
+    return 422;
+  }
+  if (repr == wuffs_gif__error__bad_frame_size) {
+    return 422;
+  }
+  if (repr == wuffs_gif__error__bad_graphic_control) {
+    return 422;
+  }
+  if (repr == wuffs_gif__error__bad_header) {
+    return 422;
+  }
+  if (repr == wuffs_gif__error__bad_literal_width) {
+    return 422;
+  }
+  if (repr == wuffs_gif__error__bad_palette) {
+    return 422;
+  }
+  return 0;
+}
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_gif__status_errno(const char* repr) {
+  if (repr == wuffs_gif__error__bad_extension_label) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_gif__error__bad_frame_size) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_gif__error__bad_graphic_control) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_gif__error__bad_header) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_gif__error__bad_literal_width) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_gif__error__bad_palette) {
+    return EBADMSG;
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+static const char* const wuffs_gif__status__enum_table[] = {
+  wuffs_gif__error__bad_extension_label,
+  wuffs_gif__error__bad_frame_size,
+  wuffs_gif__error__bad_graphic_control,
+  wuffs_gif__error__bad_header,
+  wuffs_gif__error__bad_literal_width,
+  wuffs_gif__error__bad_palette,
+  wuffs_gif__error__internal_error_inconsistent_ri_wi,
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_gif__status__enum_table) / sizeof(wuffs_gif__status__enum_table[0])) == WUFFS_GIF__STATUS_ENUM__MAX_INCL,
+    wuffs_gif__status__enum_table_is_complete);
+
+static const uint8_t wuffs_gif__status__enum_sorted[] = {
+  1,  // WUFFS_GIF__STATUS_ENUM__ERROR__BAD_EXTENSION_LABEL
+  2,  // WUFFS_GIF__STATUS_ENUM__ERROR__BAD_FRAME_SIZE
+  3,  // WUFFS_GIF__STATUS_ENUM__ERROR__BAD_GRAPHIC_CONTROL
+  4,  // WUFFS_GIF__STATUS_ENUM__ERROR__BAD_HEADER
+  5,  // WUFFS_GIF__STATUS_ENUM__ERROR__BAD_LITERAL_WIDTH
+  6,  // WUFFS_GIF__STATUS_ENUM__ERROR__BAD_PALETTE
+  7,  // WUFFS_GIF__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_RI_WI
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_gif__status__enum_sorted) / sizeof(wuffs_gif__status__enum_sorted[0])) == WUFFS_GIF__STATUS_ENUM__MAX_INCL,
+    wuffs_gif__status__enum_sorted_is_complete);
+
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_gif__status__from_enum(uint32_t e) {
+  if ((e == 0) || (e > WUFFS_GIF__STATUS_ENUM__MAX_INCL)) {
+    return NULL;
+  }
+  return wuffs_gif__status__enum_table[e - 1];
+}
+
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_gif__status__to_enum(const char* repr) {
+  uint32_t lo = 0;
+  uint32_t hi = WUFFS_GIF__STATUS_ENUM__MAX_INCL;
+  if (!repr) {
+    return 0;
+  }
+  while (lo < hi) {
+    uint32_t mid = lo + ((hi - lo) / 2);
+    uint32_t e = wuffs_gif__status__enum_sorted[mid];
+    int c = strcmp(repr, wuffs_gif__status__enum_table[e - 1]);
+    if (c == 0) {
+      return e;
+    } else if (c < 0) {
+      hi = mid;
+    } else {
+      lo = mid + 1;
+    }
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
 // ---------------- Private Consts
 
 static const uint32_t
@@ -27785,7 +31222,7 @@ wuffs_gif__decoder__func_ptrs_for__wuffs_base__image_decoder = {
 
 // ---------------- Initializer Implementations
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_gif__decoder__initialize(
     wuffs_gif__decoder* self,
     size_t sizeof_star_self,
@@ -27824,6 +31261,10 @@ wuffs_gif__decoder__initialize(
     }
   }
 
+  if ((options & WUFFS_INITIALIZE__WORKBUF_LESS) != 0) {
+    return wuffs_base__make_status(wuffs_base__error__unsupported_option);
+  }
+
   {
     wuffs_base__status z = wuffs_lzw__decoder__initialize(
         &self->private_data.f_lzw, sizeof(self->private_data.f_lzw), WUFFS_VERSION, options);
@@ -27839,7 +31280,7 @@ wuffs_gif__decoder__initialize(
   return wuffs_base__make_status(NULL);
 }
 
-wuffs_gif__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_gif__decoder*
 wuffs_gif__decoder__alloc() {
   wuffs_gif__decoder* x =
       (wuffs_gif__decoder*)(calloc(sizeof(wuffs_gif__decoder), 1));
@@ -27854,7 +31295,7 @@ wuffs_gif__decoder__alloc() {
   return x;
 }
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_gif__decoder() {
   return sizeof(wuffs_gif__decoder);
 }
@@ -27863,6 +31304,7 @@ sizeof__wuffs_gif__decoder() {
 
 // -------- func gif.decoder.set_quirk_enabled
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_gif__decoder__set_quirk_enabled(
     wuffs_gif__decoder* self,
@@ -27886,6 +31328,7 @@ wuffs_gif__decoder__set_quirk_enabled(
 
 // -------- func gif.decoder.decode_image_config
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_gif__decoder__decode_image_config(
     wuffs_gif__decoder* self,
@@ -27911,6 +31354,9 @@ wuffs_gif__decoder__decode_image_config(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      0)
 
   bool v_ffio = false;
 
@@ -27976,6 +31422,11 @@ wuffs_gif__decoder__decode_image_config(
 
   goto exit;
   exit:
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      0,
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -27984,6 +31435,7 @@ wuffs_gif__decoder__decode_image_config(
 
 // -------- func gif.decoder.set_report_metadata
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_gif__decoder__set_report_metadata(
     wuffs_gif__decoder* self,
@@ -28006,6 +31458,7 @@ wuffs_gif__decoder__set_report_metadata(
 
 // -------- func gif.decoder.tell_me_more
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_gif__decoder__tell_me_more(
     wuffs_gif__decoder* self,
@@ -28032,6 +31485,9 @@ wuffs_gif__decoder__tell_me_more(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst))
 
   uint64_t v_chunk_length = 0;
 
@@ -28102,24 +31558,14 @@ wuffs_gif__decoder__tell_me_more(
       }
       self->private_impl.f_metadata_io_position = wuffs_base__u64__sat_add(wuffs_base__u64__sat_add(a_src->meta.pos, ((uint64_t)(iop_a_src - io0_a_src))), v_chunk_length);
       if (a_minfo != NULL) {
-        wuffs_base__more_information__set(a_minfo,
-            3,
-            self->private_impl.f_metadata_fourcc,
-            0,
-            wuffs_base__u64__sat_add(a_src->meta.pos, ((uint64_t)(iop_a_src - io0_a_src))),
-            self->private_impl.f_metadata_io_position);
+        wuffs_base__more_information__set_metadata(a_minfo, self->private_impl.f_metadata_fourcc, wuffs_base__u64__sat_add(a_src->meta.pos, ((uint64_t)(iop_a_src - io0_a_src))), self->private_impl.f_metadata_io_position);
       }
       status = wuffs_base__make_status(wuffs_base__suspension__even_more_information);
       WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(3);
     }
     label__1__break:;
     if (a_minfo != NULL) {
-      wuffs_base__more_information__set(a_minfo,
-          3,
-          self->private_impl.f_metadata_fourcc,
-          0,
-          self->private_impl.f_metadata_io_position,
-          self->private_impl.f_metadata_io_position);
+      wuffs_base__more_information__set_metadata(a_minfo, self->private_impl.f_metadata_fourcc, self->private_impl.f_metadata_io_position, self->private_impl.f_metadata_io_position);
     }
     self->private_impl.f_call_sequence = 2;
     self->private_impl.f_metadata_fourcc = 0;
@@ -28144,6 +31590,11 @@ wuffs_gif__decoder__tell_me_more(
     a_src->meta.ri = ((size_t)(iop_a_src - a_src->data.ptr));
   }
 
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst),
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -28152,6 +31603,7 @@ wuffs_gif__decoder__tell_me_more(
 
 // -------- func gif.decoder.num_animation_loops
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint32_t
 wuffs_gif__decoder__num_animation_loops(
     const wuffs_gif__decoder* self) {
@@ -28171,6 +31623,7 @@ wuffs_gif__decoder__num_animation_loops(
 
 // -------- func gif.decoder.num_decoded_frame_configs
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_gif__decoder__num_decoded_frame_configs(
     const wuffs_gif__decoder* self) {
@@ -28187,6 +31640,7 @@ wuffs_gif__decoder__num_decoded_frame_configs(
 
 // -------- func gif.decoder.num_decoded_frames
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_gif__decoder__num_decoded_frames(
     const wuffs_gif__decoder* self) {
@@ -28203,6 +31657,7 @@ wuffs_gif__decoder__num_decoded_frames(
 
 // -------- func gif.decoder.frame_dirty_rect
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__rect_ie_u32
 wuffs_gif__decoder__frame_dirty_rect(
     const wuffs_gif__decoder* self) {
@@ -28223,6 +31678,7 @@ wuffs_gif__decoder__frame_dirty_rect(
 
 // -------- func gif.decoder.workbuf_len
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_gif__decoder__workbuf_len(
     const wuffs_gif__decoder* self) {
@@ -28239,6 +31695,7 @@ wuffs_gif__decoder__workbuf_len(
 
 // -------- func gif.decoder.restart_frame
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_gif__decoder__restart_frame(
     wuffs_gif__decoder* self,
@@ -28269,6 +31726,7 @@ wuffs_gif__decoder__restart_frame(
 
 // -------- func gif.decoder.decode_frame_config
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_gif__decoder__decode_frame_config(
     wuffs_gif__decoder* self,
@@ -28294,6 +31752,9 @@ wuffs_gif__decoder__decode_frame_config(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      0)
 
   uint32_t v_background_color = 0;
   uint8_t v_flags = 0;
@@ -28413,6 +31874,17 @@ wuffs_gif__decoder__decode_frame_config(
     a_src->meta.ri = ((size_t)(iop_a_src - a_src->data.ptr));
   }
 
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      0,
+      &status)
+  if (!status.repr && a_dst) {
+    uint64_t i = wuffs_base__frame_config__index(a_dst);
+    if (i < self->private_impl.frame_io_positions.len) {
+      self->private_impl.frame_io_positions.ptr[i] = wuffs_base__frame_config__io_position(a_dst);
+    }
+  }
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -28421,6 +31893,7 @@ wuffs_gif__decoder__decode_frame_config(
 
 // -------- func gif.decoder.skip_frame
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_gif__decoder__skip_frame(
     wuffs_gif__decoder* self,
@@ -28517,6 +31990,7 @@ wuffs_gif__decoder__skip_frame(
 
 // -------- func gif.decoder.decode_frame
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_gif__decoder__decode_frame(
     wuffs_gif__decoder* self,
@@ -28545,6 +32019,9 @@ wuffs_gif__decoder__decode_frame(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      0)
 
   uint32_t coro_susp_point = self->private_impl.p_decode_frame[0];
   switch (coro_susp_point) {
@@ -28588,6 +32065,11 @@ wuffs_gif__decoder__decode_frame(
 
   goto exit;
   exit:
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      0,
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -28596,6 +32078,7 @@ wuffs_gif__decoder__decode_frame(
 
 // -------- func gif.decoder.reset_gc
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_gif__decoder__reset_gc(
     wuffs_gif__decoder* self) {
@@ -28609,6 +32092,7 @@ wuffs_gif__decoder__reset_gc(
 
 // -------- func gif.decoder.decode_up_to_id_part1
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_gif__decoder__decode_up_to_id_part1(
     wuffs_gif__decoder* self,
@@ -28713,6 +32197,7 @@ wuffs_gif__decoder__decode_up_to_id_part1(
 
 // -------- func gif.decoder.decode_header
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_gif__decoder__decode_header(
     wuffs_gif__decoder* self,
@@ -28786,6 +32271,7 @@ wuffs_gif__decoder__decode_header(
 
 // -------- func gif.decoder.decode_lsd
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_gif__decoder__decode_lsd(
     wuffs_gif__decoder* self,
@@ -28988,6 +32474,7 @@ wuffs_gif__decoder__decode_lsd(
 
 // -------- func gif.decoder.decode_extension
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_gif__decoder__decode_extension(
     wuffs_gif__decoder* self,
@@ -29082,6 +32569,7 @@ wuffs_gif__decoder__decode_extension(
 
 // -------- func gif.decoder.skip_blocks
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_gif__decoder__skip_blocks(
     wuffs_gif__decoder* self,
@@ -29151,6 +32639,7 @@ wuffs_gif__decoder__skip_blocks(
 
 // -------- func gif.decoder.decode_ae
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_gif__decoder__decode_ae(
     wuffs_gif__decoder* self,
@@ -29375,6 +32864,7 @@ wuffs_gif__decoder__decode_ae(
 
 // -------- func gif.decoder.decode_gc
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_gif__decoder__decode_gc(
     wuffs_gif__decoder* self,
@@ -29505,6 +32995,7 @@ wuffs_gif__decoder__decode_gc(
 
 // -------- func gif.decoder.decode_id_part0
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_gif__decoder__decode_id_part0(
     wuffs_gif__decoder* self,
@@ -29672,6 +33163,7 @@ wuffs_gif__decoder__decode_id_part0(
 
 // -------- func gif.decoder.decode_id_part1
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_gif__decoder__decode_id_part1(
     wuffs_gif__decoder* self,
@@ -29843,6 +33335,7 @@ wuffs_gif__decoder__decode_id_part1(
 
 // -------- func gif.decoder.decode_id_part2
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_gif__decoder__decode_id_part2(
     wuffs_gif__decoder* self,
@@ -30050,6 +33543,7 @@ wuffs_gif__decoder__decode_id_part2(
 
 // -------- func gif.decoder.copy_to_image_buffer
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_gif__decoder__copy_to_image_buffer(
     wuffs_gif__decoder* self,
@@ -30173,6 +33667,112 @@ wuffs_gif__decoder__copy_to_image_buffer(
   return wuffs_base__make_status(NULL);
 }
 
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_gif__decoder__visit_metadata(
+    wuffs_gif__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__more_information* a_minfo,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__metadata_chunk_func a_callback,
+    void* a_context) {
+  if (!a_minfo) {
+    return wuffs_base__make_status(wuffs_base__error__bad_argument);
+  }
+  while (true) {
+    wuffs_base__status status = wuffs_base__more_information__deliver_metadata(
+        a_minfo, a_src, a_callback, a_context);
+    if (status.repr) {
+      return status;
+    }
+    status = wuffs_gif__decoder__tell_me_more(self, a_dst, a_minfo, a_src);
+    if (status.repr != wuffs_base__suspension__even_more_information) {
+      return status;
+    }
+  }
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_gif__decoder__read_metadata_chunk(
+    wuffs_gif__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__metadata_reader* a_reader,
+    wuffs_base__io_buffer* a_src) {
+  if (!a_reader) {
+    return wuffs_base__make_status(wuffs_base__error__bad_argument);
+  }
+  while (true) {
+    wuffs_base__status status = wuffs_base__metadata_reader__next_chunk(a_reader, a_src);
+    if (status.repr || (a_reader->chunk.len > 0)) {
+      return status;
+    }
+    status = wuffs_gif__decoder__tell_me_more(self, a_dst, &a_reader->minfo, a_src);
+    if (status.repr != wuffs_base__suspension__even_more_information) {
+      return status;
+    }
+  }
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_gif__decoder__probe(
+    wuffs_gif__decoder* self,
+    wuffs_base__image_config* a_dst,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__range_ii_u64* a_workbuf_len) {
+  wuffs_base__status status = wuffs_gif__decoder__decode_image_config(self, a_dst, a_src);
+  if (!status.repr && a_workbuf_len) {
+    *a_workbuf_len = wuffs_gif__decoder__workbuf_len(self);
+  }
+  return status;
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
+wuffs_gif__decoder__set_frame_io_positions(
+    wuffs_gif__decoder* self,
+    wuffs_base__slice_u64 a_table) {
+  if (!self) {
+    return wuffs_base__make_empty_struct();
+  }
+  size_t i;
+  for (i = 0; i < a_table.len; i++) {
+    a_table.ptr[i] = UINT64_MAX;
+  }
+  self->private_impl.frame_io_positions = a_table;
+  return wuffs_base__make_empty_struct();
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_gif__decoder__seek_frame(
+    wuffs_gif__decoder* self,
+    uint64_t a_index,
+    uint64_t* a_io_position) {
+  if (!self) {
+    return wuffs_base__make_status(wuffs_base__error__bad_receiver);
+  }
+  if ((a_index >= self->private_impl.frame_io_positions.len) ||
+      (self->private_impl.frame_io_positions.ptr[a_index] == UINT64_MAX)) {
+    return wuffs_base__make_status(wuffs_base__error__bad_argument);
+  }
+  uint64_t io_position = self->private_impl.frame_io_positions.ptr[a_index];
+  wuffs_base__status status = wuffs_gif__decoder__restart_frame(self, a_index, io_position);
+  if (!status.repr && a_io_position) {
+    *a_io_position = io_position;
+  }
+  return status;
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_gif__decoder__telemetry(
+    const wuffs_gif__decoder* self) {
+#if defined(WUFFS_CONFIG__TELEMETRY)
+  if (self &&
+      ((self->private_impl.magic == WUFFS_BASE__MAGIC) ||
+      (self->private_impl.magic == WUFFS_BASE__DISABLED))) {
+    return self->private_impl.telemetry;
+  }
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
+  return wuffs_base__empty_telemetry();
+}
+
 #endif  // !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__GIF)
 
 #if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__GZIP)
@@ -30184,6 +33784,100 @@ const char wuffs_gzip__error__bad_compression_method[] = "#gzip: bad compression
 const char wuffs_gzip__error__bad_encoding_flags[] = "#gzip: bad encoding flags";
 const char wuffs_gzip__error__bad_header[] = "#gzip: bad header";
 
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_gzip__status_http_code(const char* repr) {
+  if (repr == wuffs_gzip__error__bad_checksum) {
+    return 422;
+  }
+  if (repr == wuffs_gzip__error__bad_compression_method) {
+    return 422;
+  }
+  if (repr == wuffs_gzip__error__bad_encoding_flags) {
+    return 422;
+  }
+  if (repr == wuffs_gzip__error__bad_header) {
+    return 422;
+  }
+  return 0;
+}
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_gzip__status_errno(const char* repr) {
+  if (repr == wuffs_gzip__error__bad_checksum) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_gzip__error__bad_compression_method) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_gzip__error__bad_encoding_flags) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_gzip__error__bad_header) {
+    return EBADMSG;
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+static const char* const wuffs_gzip__status__enum_table[] = {
+  wuffs_gzip__error__bad_checksum,
+  wuffs_gzip__error__bad_compression_method,
+  wuffs_gzip__error__bad_encoding_flags,
+  wuffs_gzip__error__bad_header,
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_gzip__status__enum_table) / sizeof(wuffs_gzip__status__enum_table[0])) == WUFFS_GZIP__STATUS_ENUM__MAX_INCL,
+    wuffs_gzip__status__enum_table_is_complete);
+
+static const uint8_t wuffs_gzip__status__enum_sorted[] = {
+  1,  // WUFFS_GZIP__STATUS_ENUM__ERROR__BAD_CHECKSUM
+  2,  // WUFFS_GZIP__STATUS_ENUM__ERROR__BAD_COMPRESSION_METHOD
+  3,  // WUFFS_GZIP__STATUS_ENUM__ERROR__BAD_ENCODING_FLAGS
+  4,  // WUFFS_GZIP__STATUS_ENUM__ERROR__BAD_HEADER
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_gzip__status__enum_sorted) / sizeof(wuffs_gzip__status__enum_sorted[0])) == WUFFS_GZIP__STATUS_ENUM__MAX_INCL,
+    wuffs_gzip__status__enum_sorted_is_complete);
+
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_gzip__status__from_enum(uint32_t e) {
+  if ((e == 0) || (e > WUFFS_GZIP__STATUS_ENUM__MAX_INCL)) {
+    return NULL;
+  }
+  return wuffs_gzip__status__enum_table[e - 1];
+}
+
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_gzip__status__to_enum(const char* repr) {
+  uint32_t lo = 0;
+  uint32_t hi = WUFFS_GZIP__STATUS_ENUM__MAX_INCL;
+  if (!repr) {
+    return 0;
+  }
+  while (lo < hi) {
+    uint32_t mid = lo + ((hi - lo) / 2);
+    uint32_t e = wuffs_gzip__status__enum_sorted[mid];
+    int c = strcmp(repr, wuffs_gzip__status__enum_table[e - 1]);
+    if (c == 0) {
+      return e;
+    } else if (c < 0) {
+      hi = mid;
+    } else {
+      lo = mid + 1;
+    }
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
 // ---------------- Private Consts
 
 // ---------------- Private Initializer Prototypes
@@ -30206,7 +33900,7 @@ wuffs_gzip__decoder__func_ptrs_for__wuffs_base__io_transformer = {
 
 // ---------------- Initializer Implementations
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_gzip__decoder__initialize(
     wuffs_gzip__decoder* self,
     size_t sizeof_star_self,
@@ -30245,6 +33939,10 @@ wuffs_gzip__decoder__initialize(
     }
   }
 
+  if ((options & WUFFS_INITIALIZE__WORKBUF_LESS) != 0) {
+    return wuffs_base__make_status(wuffs_base__error__unsupported_option);
+  }
+
   {
     wuffs_base__status z = wuffs_crc32__ieee_hasher__initialize(
         &self->private_data.f_checksum, sizeof(self->private_data.f_checksum), WUFFS_VERSION, options);
@@ -30267,7 +33965,7 @@ wuffs_gzip__decoder__initialize(
   return wuffs_base__make_status(NULL);
 }
 
-wuffs_gzip__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_gzip__decoder*
 wuffs_gzip__decoder__alloc() {
   wuffs_gzip__decoder* x =
       (wuffs_gzip__decoder*)(calloc(sizeof(wuffs_gzip__decoder), 1));
@@ -30282,7 +33980,7 @@ wuffs_gzip__decoder__alloc() {
   return x;
 }
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_gzip__decoder() {
   return sizeof(wuffs_gzip__decoder);
 }
@@ -30291,6 +33989,7 @@ sizeof__wuffs_gzip__decoder() {
 
 // -------- func gzip.decoder.set_quirk_enabled
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_gzip__decoder__set_quirk_enabled(
     wuffs_gzip__decoder* self,
@@ -30311,6 +34010,7 @@ wuffs_gzip__decoder__set_quirk_enabled(
 
 // -------- func gzip.decoder.workbuf_len
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_gzip__decoder__workbuf_len(
     const wuffs_gzip__decoder* self) {
@@ -30327,6 +34027,7 @@ wuffs_gzip__decoder__workbuf_len(
 
 // -------- func gzip.decoder.transform_io
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_gzip__decoder__transform_io(
     wuffs_gzip__decoder* self,
@@ -30353,6 +34054,9 @@ wuffs_gzip__decoder__transform_io(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst))
 
   uint8_t v_c = 0;
   uint8_t v_flags = 0;
@@ -30660,12 +34364,30 @@ wuffs_gzip__decoder__transform_io(
     a_src->meta.ri = ((size_t)(iop_a_src - a_src->data.ptr));
   }
 
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst),
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
   return status;
 }
 
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_gzip__decoder__telemetry(
+    const wuffs_gzip__decoder* self) {
+#if defined(WUFFS_CONFIG__TELEMETRY)
+  if (self &&
+      ((self->private_impl.magic == WUFFS_BASE__MAGIC) ||
+      (self->private_impl.magic == WUFFS_BASE__DISABLED))) {
+    return self->private_impl.telemetry;
+  }
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
+  return wuffs_base__empty_telemetry();
+}
+
 #endif  // !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__GZIP)
 
 #if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__JSON)
@@ -30682,6 +34404,128 @@ const char wuffs_json__error__unsupported_number_length[] = "#json: unsupported
 const char wuffs_json__error__unsupported_recursion_depth[] = "#json: unsupported recursion depth";
 const char wuffs_json__error__internal_error_inconsistent_i_o[] = "#json: internal error: inconsistent I/O";
 
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_json__status_http_code(const char* repr) {
+  if (repr == wuffs_json__error__bad_c0_control_code) {
+    return 422;
+  }
+  if (repr == wuffs_json__error__bad_utf_8) {
+    return 422;
+  }
+  if (repr == wuffs_json__error__bad_backslash_escape) {
+    return 422;
+  }
+  if (repr == wuffs_json__error__bad_input) {
+    return 422;
+  }
+  if (repr == wuffs_json__error__bad_new_line_in_a_string) {
+    return 422;
+  }
+  if (repr == wuffs_json__error__unsupported_number_length) {
+    return 413;
+  }
+  if (repr == wuffs_json__error__unsupported_recursion_depth) {
+    return 413;
+  }
+  return 0;
+}
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_json__status_errno(const char* repr) {
+  if (repr == wuffs_json__error__bad_c0_control_code) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_json__error__bad_utf_8) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_json__error__bad_backslash_escape) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_json__error__bad_input) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_json__error__bad_new_line_in_a_string) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_json__error__unsupported_number_length) {
+    return EFBIG;
+  }
+  if (repr == wuffs_json__error__unsupported_recursion_depth) {
+    return EFBIG;
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+static const char* const wuffs_json__status__enum_table[] = {
+  wuffs_json__error__bad_c0_control_code,
+  wuffs_json__error__bad_utf_8,
+  wuffs_json__error__bad_backslash_escape,
+  wuffs_json__error__bad_input,
+  wuffs_json__error__bad_new_line_in_a_string,
+  wuffs_json__error__bad_quirk_combination,
+  wuffs_json__error__unsupported_number_length,
+  wuffs_json__error__unsupported_recursion_depth,
+  wuffs_json__error__internal_error_inconsistent_i_o,
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_json__status__enum_table) / sizeof(wuffs_json__status__enum_table[0])) == WUFFS_JSON__STATUS_ENUM__MAX_INCL,
+    wuffs_json__status__enum_table_is_complete);
+
+static const uint8_t wuffs_json__status__enum_sorted[] = {
+  1,  // WUFFS_JSON__STATUS_ENUM__ERROR__BAD_C0_CONTROL_CODE
+  2,  // WUFFS_JSON__STATUS_ENUM__ERROR__BAD_UTF_8
+  3,  // WUFFS_JSON__STATUS_ENUM__ERROR__BAD_BACKSLASH_ESCAPE
+  4,  // WUFFS_JSON__STATUS_ENUM__ERROR__BAD_INPUT
+  5,  // WUFFS_JSON__STATUS_ENUM__ERROR__BAD_NEW_LINE_IN_A_STRING
+  6,  // WUFFS_JSON__STATUS_ENUM__ERROR__BAD_QUIRK_COMBINATION
+  9,  // WUFFS_JSON__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_I_O
+  7,  // WUFFS_JSON__STATUS_ENUM__ERROR__UNSUPPORTED_NUMBER_LENGTH
+  8,  // WUFFS_JSON__STATUS_ENUM__ERROR__UNSUPPORTED_RECURSION_DEPTH
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_json__status__enum_sorted) / sizeof(wuffs_json__status__enum_sorted[0])) == WUFFS_JSON__STATUS_ENUM__MAX_INCL,
+    wuffs_json__status__enum_sorted_is_complete);
+
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_json__status__from_enum(uint32_t e) {
+  if ((e == 0) || (e > WUFFS_JSON__STATUS_ENUM__MAX_INCL)) {
+    return NULL;
+  }
+  return wuffs_json__status__enum_table[e - 1];
+}
+
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_json__status__to_enum(const char* repr) {
+  uint32_t lo = 0;
+  uint32_t hi = WUFFS_JSON__STATUS_ENUM__MAX_INCL;
+  if (!repr) {
+    return 0;
+  }
+  while (lo < hi) {
+    uint32_t mid = lo + ((hi - lo) / 2);
+    uint32_t e = wuffs_json__status__enum_sorted[mid];
+    int c = strcmp(repr, wuffs_json__status__enum_table[e - 1]);
+    if (c == 0) {
+      return e;
+    } else if (c < 0) {
+      hi = mid;
+    } else {
+      lo = mid + 1;
+    }
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
 // ---------------- Private Consts
 
 #define WUFFS_JSON__DECODER_NUMBER_LENGTH_MAX_INCL 99
@@ -30977,7 +34821,7 @@ wuffs_json__decoder__func_ptrs_for__wuffs_base__token_decoder = {
 
 // ---------------- Initializer Implementations
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_json__decoder__initialize(
     wuffs_json__decoder* self,
     size_t sizeof_star_self,
@@ -31016,6 +34860,10 @@ wuffs_json__decoder__initialize(
     }
   }
 
+  if ((options & WUFFS_INITIALIZE__WORKBUF_LESS) != 0) {
+    return wuffs_base__make_status(wuffs_base__error__unsupported_option);
+  }
+
   self->private_impl.magic = WUFFS_BASE__MAGIC;
   self->private_impl.vtable_for__wuffs_base__token_decoder.vtable_name =
       wuffs_base__token_decoder__vtable_name;
@@ -31024,7 +34872,7 @@ wuffs_json__decoder__initialize(
   return wuffs_base__make_status(NULL);
 }
 
-wuffs_json__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_json__decoder*
 wuffs_json__decoder__alloc() {
   wuffs_json__decoder* x =
       (wuffs_json__decoder*)(calloc(sizeof(wuffs_json__decoder), 1));
@@ -31039,7 +34887,7 @@ wuffs_json__decoder__alloc() {
   return x;
 }
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_json__decoder() {
   return sizeof(wuffs_json__decoder);
 }
@@ -31048,6 +34896,7 @@ sizeof__wuffs_json__decoder() {
 
 // -------- func json.decoder.set_quirk_enabled
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_json__decoder__set_quirk_enabled(
     wuffs_json__decoder* self,
@@ -31071,6 +34920,7 @@ wuffs_json__decoder__set_quirk_enabled(
 
 // -------- func json.decoder.workbuf_len
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_json__decoder__workbuf_len(
     const wuffs_json__decoder* self) {
@@ -31087,6 +34937,7 @@ wuffs_json__decoder__workbuf_len(
 
 // -------- func json.decoder.decode_tokens
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_json__decoder__decode_tokens(
     wuffs_json__decoder* self,
@@ -31113,6 +34964,9 @@ wuffs_json__decoder__decode_tokens(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      0)
 
   uint32_t v_vminor = 0;
   uint32_t v_number_length = 0;
@@ -31210,6 +35064,7 @@ wuffs_json__decoder__decode_tokens(
       while (true) {
         if (((uint64_t)(io2_a_dst - iop_a_dst)) <= 0) {
           status = wuffs_base__make_status(wuffs_base__suspension__short_write);
+          self->private_impl.tokens_needed = 1;
           WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(2);
           goto label__outer__continue;
         }
@@ -31272,6 +35127,7 @@ wuffs_json__decoder__decode_tokens(
           while (true) {
             if (((uint64_t)(io2_a_dst - iop_a_dst)) <= 0) {
               status = wuffs_base__make_status(wuffs_base__suspension__short_write);
+              self->private_impl.tokens_needed = 1;
               WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(4);
               goto label__string_loop_outer__continue;
             }
@@ -31763,6 +35619,7 @@ wuffs_json__decoder__decode_tokens(
             }
             if (((uint64_t)(io2_a_dst - iop_a_dst)) <= 0) {
               status = wuffs_base__make_status(wuffs_base__suspension__short_write);
+              self->private_impl.tokens_needed = 1;
               WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(15);
               goto label__1__continue;
             }
@@ -31865,6 +35722,7 @@ wuffs_json__decoder__decode_tokens(
               WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(17);
               while (((uint64_t)(io2_a_dst - iop_a_dst)) <= 0) {
                 status = wuffs_base__make_status(wuffs_base__suspension__short_write);
+                self->private_impl.tokens_needed = 1;
                 WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(18);
               }
             }
@@ -32116,6 +35974,11 @@ wuffs_json__decoder__decode_tokens(
     a_src->meta.ri = ((size_t)(iop_a_src - a_src->data.ptr));
   }
 
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      0,
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -32124,6 +35987,7 @@ wuffs_json__decoder__decode_tokens(
 
 // -------- func json.decoder.decode_number
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static uint32_t
 wuffs_json__decoder__decode_number(
     wuffs_json__decoder* self,
@@ -32259,6 +36123,7 @@ wuffs_json__decoder__decode_number(
 
 // -------- func json.decoder.decode_digits
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static uint32_t
 wuffs_json__decoder__decode_digits(
     wuffs_json__decoder* self,
@@ -32309,6 +36174,7 @@ wuffs_json__decoder__decode_digits(
 
 // -------- func json.decoder.decode_leading
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_json__decoder__decode_leading(
     wuffs_json__decoder* self,
@@ -32353,6 +36219,7 @@ wuffs_json__decoder__decode_leading(
     while (self->private_impl.f_allow_leading_ars || self->private_impl.f_allow_leading_ubom) {
       if (((uint64_t)(io2_a_dst - iop_a_dst)) <= 0) {
         status = wuffs_base__make_status(wuffs_base__suspension__short_write);
+        self->private_impl.tokens_needed = 1;
         WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(1);
         goto label__0__continue;
       }
@@ -32419,6 +36286,7 @@ wuffs_json__decoder__decode_leading(
 
 // -------- func json.decoder.decode_comment
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_json__decoder__decode_comment(
     wuffs_json__decoder* self,
@@ -32463,6 +36331,7 @@ wuffs_json__decoder__decode_comment(
     while ((((uint64_t)(io2_a_dst - iop_a_dst)) <= 0) || (((uint64_t)(io2_a_src - iop_a_src)) <= 1)) {
       if (((uint64_t)(io2_a_dst - iop_a_dst)) <= 0) {
         status = wuffs_base__make_status(wuffs_base__suspension__short_write);
+        self->private_impl.tokens_needed = 1;
         WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(1);
         goto label__0__continue;
       }
@@ -32481,6 +36350,7 @@ wuffs_json__decoder__decode_comment(
       while (true) {
         if (((uint64_t)(io2_a_dst - iop_a_dst)) <= 0) {
           status = wuffs_base__make_status(wuffs_base__suspension__short_write);
+          self->private_impl.tokens_needed = 1;
           WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(3);
           v_length = 0;
           goto label__comment_block__continue;
@@ -32531,6 +36401,7 @@ wuffs_json__decoder__decode_comment(
       while (true) {
         if (((uint64_t)(io2_a_dst - iop_a_dst)) <= 0) {
           status = wuffs_base__make_status(wuffs_base__suspension__short_write);
+          self->private_impl.tokens_needed = 1;
           WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(5);
           v_length = 0;
           goto label__comment_line__continue;
@@ -32600,6 +36471,7 @@ wuffs_json__decoder__decode_comment(
 
 // -------- func json.decoder.decode_inf_nan
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_json__decoder__decode_inf_nan(
     wuffs_json__decoder* self,
@@ -32645,6 +36517,7 @@ wuffs_json__decoder__decode_inf_nan(
     while (true) {
       if (((uint64_t)(io2_a_dst - iop_a_dst)) <= 0) {
         status = wuffs_base__make_status(wuffs_base__suspension__short_write);
+        self->private_impl.tokens_needed = 1;
         WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(1);
         goto label__0__continue;
       }
@@ -32762,6 +36635,7 @@ wuffs_json__decoder__decode_inf_nan(
 
 // -------- func json.decoder.decode_trailer
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_json__decoder__decode_trailer(
     wuffs_json__decoder* self,
@@ -32809,6 +36683,7 @@ wuffs_json__decoder__decode_trailer(
     while (true) {
       if (((uint64_t)(io2_a_dst - iop_a_dst)) <= 0) {
         status = wuffs_base__make_status(wuffs_base__suspension__short_write);
+        self->private_impl.tokens_needed = 1;
         WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(1);
         v_whitespace_length = 0;
         goto label__outer__continue;
@@ -32905,6 +36780,36 @@ wuffs_json__decoder__decode_trailer(
   return status;
 }
 
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_json__decoder__decode_tokens_batch(
+    wuffs_json__decoder* self,
+    wuffs_base__token_buffer* a_dst,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__slice_u8 a_workbuf,
+    uint64_t* a_tokens_needed) {
+  wuffs_base__status status = wuffs_json__decoder__decode_tokens(self, a_dst, a_src, a_workbuf);
+  if (a_tokens_needed) {
+    *a_tokens_needed = 0;
+    if (self && (status.repr == wuffs_base__suspension__short_write)) {
+      *a_tokens_needed = self->private_impl.tokens_needed;
+    }
+  }
+  return status;
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_json__decoder__telemetry(
+    const wuffs_json__decoder* self) {
+#if defined(WUFFS_CONFIG__TELEMETRY)
+  if (self &&
+      ((self->private_impl.magic == WUFFS_BASE__MAGIC) ||
+      (self->private_impl.magic == WUFFS_BASE__DISABLED))) {
+    return self->private_impl.telemetry;
+  }
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
+  return wuffs_base__empty_telemetry();
+}
+
 #endif  // !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__JSON)
 
 #if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__NIE)
@@ -32915,6 +36820,86 @@ const char wuffs_nie__error__bad_header[] = "#nie: bad header";
 const char wuffs_nie__error__unsupported_nie_file[] = "#nie: unsupported NIE file";
 const char wuffs_nie__note__internal_note_short_read[] = "@nie: internal note: short read";
 
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_nie__status_http_code(const char* repr) {
+  if (repr == wuffs_nie__error__bad_header) {
+    return 422;
+  }
+  if (repr == wuffs_nie__error__unsupported_nie_file) {
+    return 415;
+  }
+  return 0;
+}
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_nie__status_errno(const char* repr) {
+  if (repr == wuffs_nie__error__bad_header) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_nie__error__unsupported_nie_file) {
+    return ENOTSUP;
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+static const char* const wuffs_nie__status__enum_table[] = {
+  wuffs_nie__error__bad_header,
+  wuffs_nie__error__unsupported_nie_file,
+  wuffs_nie__note__internal_note_short_read,
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_nie__status__enum_table) / sizeof(wuffs_nie__status__enum_table[0])) == WUFFS_NIE__STATUS_ENUM__MAX_INCL,
+    wuffs_nie__status__enum_table_is_complete);
+
+static const uint8_t wuffs_nie__status__enum_sorted[] = {
+  1,  // WUFFS_NIE__STATUS_ENUM__ERROR__BAD_HEADER
+  2,  // WUFFS_NIE__STATUS_ENUM__ERROR__UNSUPPORTED_NIE_FILE
+  3,  // WUFFS_NIE__STATUS_ENUM__NOTE__INTERNAL_NOTE_SHORT_READ
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_nie__status__enum_sorted) / sizeof(wuffs_nie__status__enum_sorted[0])) == WUFFS_NIE__STATUS_ENUM__MAX_INCL,
+    wuffs_nie__status__enum_sorted_is_complete);
+
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_nie__status__from_enum(uint32_t e) {
+  if ((e == 0) || (e > WUFFS_NIE__STATUS_ENUM__MAX_INCL)) {
+    return NULL;
+  }
+  return wuffs_nie__status__enum_table[e - 1];
+}
+
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_nie__status__to_enum(const char* repr) {
+  uint32_t lo = 0;
+  uint32_t hi = WUFFS_NIE__STATUS_ENUM__MAX_INCL;
+  if (!repr) {
+    return 0;
+  }
+  while (lo < hi) {
+    uint32_t mid = lo + ((hi - lo) / 2);
+    uint32_t e = wuffs_nie__status__enum_sorted[mid];
+    int c = strcmp(repr, wuffs_nie__status__enum_table[e - 1]);
+    if (c == 0) {
+      return e;
+    } else if (c < 0) {
+      hi = mid;
+    } else {
+      lo = mid + 1;
+    }
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
 // ---------------- Private Consts
 
 // ---------------- Private Initializer Prototypes
@@ -32965,7 +36950,7 @@ wuffs_nie__decoder__func_ptrs_for__wuffs_base__image_decoder = {
 
 // ---------------- Initializer Implementations
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_nie__decoder__initialize(
     wuffs_nie__decoder* self,
     size_t sizeof_star_self,
@@ -33004,6 +36989,10 @@ wuffs_nie__decoder__initialize(
     }
   }
 
+  if ((options & WUFFS_INITIALIZE__WORKBUF_LESS) != 0) {
+    return wuffs_base__make_status(wuffs_base__error__unsupported_option);
+  }
+
   self->private_impl.magic = WUFFS_BASE__MAGIC;
   self->private_impl.vtable_for__wuffs_base__image_decoder.vtable_name =
       wuffs_base__image_decoder__vtable_name;
@@ -33012,7 +37001,7 @@ wuffs_nie__decoder__initialize(
   return wuffs_base__make_status(NULL);
 }
 
-wuffs_nie__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_nie__decoder*
 wuffs_nie__decoder__alloc() {
   wuffs_nie__decoder* x =
       (wuffs_nie__decoder*)(calloc(sizeof(wuffs_nie__decoder), 1));
@@ -33027,7 +37016,7 @@ wuffs_nie__decoder__alloc() {
   return x;
 }
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_nie__decoder() {
   return sizeof(wuffs_nie__decoder);
 }
@@ -33036,6 +37025,7 @@ sizeof__wuffs_nie__decoder() {
 
 // -------- func nie.decoder.set_quirk_enabled
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_nie__decoder__set_quirk_enabled(
     wuffs_nie__decoder* self,
@@ -33046,6 +37036,7 @@ wuffs_nie__decoder__set_quirk_enabled(
 
 // -------- func nie.decoder.decode_image_config
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_nie__decoder__decode_image_config(
     wuffs_nie__decoder* self,
@@ -33071,6 +37062,9 @@ wuffs_nie__decoder__decode_image_config(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      0)
 
   uint32_t v_a = 0;
 
@@ -33266,6 +37260,11 @@ wuffs_nie__decoder__decode_image_config(
     a_src->meta.ri = ((size_t)(iop_a_src - a_src->data.ptr));
   }
 
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      0,
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -33274,6 +37273,7 @@ wuffs_nie__decoder__decode_image_config(
 
 // -------- func nie.decoder.decode_frame_config
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_nie__decoder__decode_frame_config(
     wuffs_nie__decoder* self,
@@ -33299,6 +37299,9 @@ wuffs_nie__decoder__decode_frame_config(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      0)
 
   const uint8_t* iop_a_src = NULL;
   const uint8_t* io0_a_src WUFFS_BASE__POTENTIALLY_UNUSED = NULL;
@@ -33375,6 +37378,11 @@ wuffs_nie__decoder__decode_frame_config(
     a_src->meta.ri = ((size_t)(iop_a_src - a_src->data.ptr));
   }
 
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      0,
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -33383,6 +37391,7 @@ wuffs_nie__decoder__decode_frame_config(
 
 // -------- func nie.decoder.decode_frame
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_nie__decoder__decode_frame(
     wuffs_nie__decoder* self,
@@ -33411,6 +37420,9 @@ wuffs_nie__decoder__decode_frame(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      0)
 
   wuffs_base__status v_status = wuffs_base__make_status(NULL);
 
@@ -33480,6 +37492,11 @@ wuffs_nie__decoder__decode_frame(
 
   goto exit;
   exit:
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      0,
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -33488,6 +37505,7 @@ wuffs_nie__decoder__decode_frame(
 
 // -------- func nie.decoder.swizzle
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_nie__decoder__swizzle(
     wuffs_nie__decoder* self,
@@ -33522,7 +37540,7 @@ wuffs_nie__decoder__swizzle(
     goto exit;
   }
   v_dst_bytes_per_pixel = ((uint64_t)((v_dst_bits_per_pixel / 8)));
-  v_dst_bytes_per_row = (((uint64_t)(self->private_impl.f_width)) * v_dst_bytes_per_pixel);
+  v_dst_bytes_per_row = (self->private_impl.f_width * v_dst_bytes_per_pixel);
   v_tab = wuffs_base__pixel_buffer__plane(a_dst, 0);
   label__0__continue:;
   while (true) {
@@ -33537,7 +37555,7 @@ wuffs_nie__decoder__swizzle(
     if (v_dst_bytes_per_row < ((uint64_t)(v_dst.len))) {
       v_dst = wuffs_base__slice_u8__subslice_j(v_dst, v_dst_bytes_per_row);
     }
-    v_i = (((uint64_t)(self->private_impl.f_dst_x)) * v_dst_bytes_per_pixel);
+    v_i = (self->private_impl.f_dst_x * v_dst_bytes_per_pixel);
     if (v_i >= ((uint64_t)(v_dst.len))) {
       goto label__0__continue;
     }
@@ -33570,6 +37588,7 @@ wuffs_nie__decoder__swizzle(
 
 // -------- func nie.decoder.frame_dirty_rect
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__rect_ie_u32
 wuffs_nie__decoder__frame_dirty_rect(
     const wuffs_nie__decoder* self) {
@@ -33590,6 +37609,7 @@ wuffs_nie__decoder__frame_dirty_rect(
 
 // -------- func nie.decoder.num_animation_loops
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint32_t
 wuffs_nie__decoder__num_animation_loops(
     const wuffs_nie__decoder* self) {
@@ -33606,6 +37626,7 @@ wuffs_nie__decoder__num_animation_loops(
 
 // -------- func nie.decoder.num_decoded_frame_configs
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_nie__decoder__num_decoded_frame_configs(
     const wuffs_nie__decoder* self) {
@@ -33625,6 +37646,7 @@ wuffs_nie__decoder__num_decoded_frame_configs(
 
 // -------- func nie.decoder.num_decoded_frames
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_nie__decoder__num_decoded_frames(
     const wuffs_nie__decoder* self) {
@@ -33644,6 +37666,7 @@ wuffs_nie__decoder__num_decoded_frames(
 
 // -------- func nie.decoder.restart_frame
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_nie__decoder__restart_frame(
     wuffs_nie__decoder* self,
@@ -33671,6 +37694,7 @@ wuffs_nie__decoder__restart_frame(
 
 // -------- func nie.decoder.set_report_metadata
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_nie__decoder__set_report_metadata(
     wuffs_nie__decoder* self,
@@ -33681,6 +37705,7 @@ wuffs_nie__decoder__set_report_metadata(
 
 // -------- func nie.decoder.tell_me_more
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_nie__decoder__tell_me_more(
     wuffs_nie__decoder* self,
@@ -33707,6 +37732,9 @@ wuffs_nie__decoder__tell_me_more(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst))
 
   status = wuffs_base__make_status(wuffs_base__error__no_more_information);
   goto exit;
@@ -33715,6 +37743,11 @@ wuffs_nie__decoder__tell_me_more(
   ok:
   goto exit;
   exit:
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst),
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -33723,6 +37756,7 @@ wuffs_nie__decoder__tell_me_more(
 
 // -------- func nie.decoder.workbuf_len
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_nie__decoder__workbuf_len(
     const wuffs_nie__decoder* self) {
@@ -33737,6 +37771,77 @@ wuffs_nie__decoder__workbuf_len(
   return wuffs_base__utility__make_range_ii_u64(0, 0);
 }
 
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_nie__decoder__visit_metadata(
+    wuffs_nie__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__more_information* a_minfo,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__metadata_chunk_func a_callback,
+    void* a_context) {
+  if (!a_minfo) {
+    return wuffs_base__make_status(wuffs_base__error__bad_argument);
+  }
+  while (true) {
+    wuffs_base__status status = wuffs_base__more_information__deliver_metadata(
+        a_minfo, a_src, a_callback, a_context);
+    if (status.repr) {
+      return status;
+    }
+    status = wuffs_nie__decoder__tell_me_more(self, a_dst, a_minfo, a_src);
+    if (status.repr != wuffs_base__suspension__even_more_information) {
+      return status;
+    }
+  }
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_nie__decoder__read_metadata_chunk(
+    wuffs_nie__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__metadata_reader* a_reader,
+    wuffs_base__io_buffer* a_src) {
+  if (!a_reader) {
+    return wuffs_base__make_status(wuffs_base__error__bad_argument);
+  }
+  while (true) {
+    wuffs_base__status status = wuffs_base__metadata_reader__next_chunk(a_reader, a_src);
+    if (status.repr || (a_reader->chunk.len > 0)) {
+      return status;
+    }
+    status = wuffs_nie__decoder__tell_me_more(self, a_dst, &a_reader->minfo, a_src);
+    if (status.repr != wuffs_base__suspension__even_more_information) {
+      return status;
+    }
+  }
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_nie__decoder__probe(
+    wuffs_nie__decoder* self,
+    wuffs_base__image_config* a_dst,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__range_ii_u64* a_workbuf_len) {
+  wuffs_base__status status = wuffs_nie__decoder__decode_image_config(self, a_dst, a_src);
+  if (!status.repr && a_workbuf_len) {
+    *a_workbuf_len = wuffs_nie__decoder__workbuf_len(self);
+  }
+  return status;
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_nie__decoder__telemetry(
+    const wuffs_nie__decoder* self) {
+#if defined(WUFFS_CONFIG__TELEMETRY)
+  if (self &&
+      ((self->private_impl.magic == WUFFS_BASE__MAGIC) ||
+      (self->private_impl.magic == WUFFS_BASE__DISABLED))) {
+    return self->private_impl.telemetry;
+  }
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
+  return wuffs_base__empty_telemetry();
+}
+
 #endif  // !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__NIE)
 
 #if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__ZLIB)
@@ -33750,6 +37855,110 @@ const char wuffs_zlib__error__bad_compression_window_size[] = "#zlib: bad compre
 const char wuffs_zlib__error__bad_parity_check[] = "#zlib: bad parity check";
 const char wuffs_zlib__error__incorrect_dictionary[] = "#zlib: incorrect dictionary";
 
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_zlib__status_http_code(const char* repr) {
+  if (repr == wuffs_zlib__error__bad_checksum) {
+    return 422;
+  }
+  if (repr == wuffs_zlib__error__bad_compression_method) {
+    return 422;
+  }
+  if (repr == wuffs_zlib__error__bad_compression_window_size) {
+    return 422;
+  }
+  if (repr == wuffs_zlib__error__bad_parity_check) {
+    return 422;
+  }
+  if (repr == wuffs_zlib__error__incorrect_dictionary) {
+    return 422;
+  }
+  return 0;
+}
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_zlib__status_errno(const char* repr) {
+  if (repr == wuffs_zlib__error__bad_checksum) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_zlib__error__bad_compression_method) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_zlib__error__bad_compression_window_size) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_zlib__error__bad_parity_check) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_zlib__error__incorrect_dictionary) {
+    return EBADMSG;
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+static const char* const wuffs_zlib__status__enum_table[] = {
+  wuffs_zlib__note__dictionary_required,
+  wuffs_zlib__error__bad_checksum,
+  wuffs_zlib__error__bad_compression_method,
+  wuffs_zlib__error__bad_compression_window_size,
+  wuffs_zlib__error__bad_parity_check,
+  wuffs_zlib__error__incorrect_dictionary,
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_zlib__status__enum_table) / sizeof(wuffs_zlib__status__enum_table[0])) == WUFFS_ZLIB__STATUS_ENUM__MAX_INCL,
+    wuffs_zlib__status__enum_table_is_complete);
+
+static const uint8_t wuffs_zlib__status__enum_sorted[] = {
+  2,  // WUFFS_ZLIB__STATUS_ENUM__ERROR__BAD_CHECKSUM
+  3,  // WUFFS_ZLIB__STATUS_ENUM__ERROR__BAD_COMPRESSION_METHOD
+  4,  // WUFFS_ZLIB__STATUS_ENUM__ERROR__BAD_COMPRESSION_WINDOW_SIZE
+  5,  // WUFFS_ZLIB__STATUS_ENUM__ERROR__BAD_PARITY_CHECK
+  6,  // WUFFS_ZLIB__STATUS_ENUM__ERROR__INCORRECT_DICTIONARY
+  1,  // WUFFS_ZLIB__STATUS_ENUM__NOTE__DICTIONARY_REQUIRED
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_zlib__status__enum_sorted) / sizeof(wuffs_zlib__status__enum_sorted[0])) == WUFFS_ZLIB__STATUS_ENUM__MAX_INCL,
+    wuffs_zlib__status__enum_sorted_is_complete);
+
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_zlib__status__from_enum(uint32_t e) {
+  if ((e == 0) || (e > WUFFS_ZLIB__STATUS_ENUM__MAX_INCL)) {
+    return NULL;
+  }
+  return wuffs_zlib__status__enum_table[e - 1];
+}
+
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_zlib__status__to_enum(const char* repr) {
+  uint32_t lo = 0;
+  uint32_t hi = WUFFS_ZLIB__STATUS_ENUM__MAX_INCL;
+  if (!repr) {
+    return 0;
+  }
+  while (lo < hi) {
+    uint32_t mid = lo + ((hi - lo) / 2);
+    uint32_t e = wuffs_zlib__status__enum_sorted[mid];
+    int c = strcmp(repr, wuffs_zlib__status__enum_table[e - 1]);
+    if (c == 0) {
+      return e;
+    } else if (c < 0) {
+      hi = mid;
+    } else {
+      lo = mid + 1;
+    }
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
 // ---------------- Private Consts
 
 // ---------------- Private Initializer Prototypes
@@ -33772,7 +37981,7 @@ wuffs_zlib__decoder__func_ptrs_for__wuffs_base__io_transformer = {
 
 // ---------------- Initializer Implementations
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_zlib__decoder__initialize(
     wuffs_zlib__decoder* self,
     size_t sizeof_star_self,
@@ -33811,6 +38020,10 @@ wuffs_zlib__decoder__initialize(
     }
   }
 
+  if ((options & WUFFS_INITIALIZE__WORKBUF_LESS) != 0) {
+    return wuffs_base__make_status(wuffs_base__error__unsupported_option);
+  }
+
   {
     wuffs_base__status z = wuffs_adler32__hasher__initialize(
         &self->private_data.f_checksum, sizeof(self->private_data.f_checksum), WUFFS_VERSION, options);
@@ -33840,7 +38053,7 @@ wuffs_zlib__decoder__initialize(
   return wuffs_base__make_status(NULL);
 }
 
-wuffs_zlib__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_zlib__decoder*
 wuffs_zlib__decoder__alloc() {
   wuffs_zlib__decoder* x =
       (wuffs_zlib__decoder*)(calloc(sizeof(wuffs_zlib__decoder), 1));
@@ -33855,7 +38068,7 @@ wuffs_zlib__decoder__alloc() {
   return x;
 }
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_zlib__decoder() {
   return sizeof(wuffs_zlib__decoder);
 }
@@ -33864,6 +38077,7 @@ sizeof__wuffs_zlib__decoder() {
 
 // -------- func zlib.decoder.dictionary_id
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint32_t
 wuffs_zlib__decoder__dictionary_id(
     const wuffs_zlib__decoder* self) {
@@ -33880,6 +38094,7 @@ wuffs_zlib__decoder__dictionary_id(
 
 // -------- func zlib.decoder.add_dictionary
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_zlib__decoder__add_dictionary(
     wuffs_zlib__decoder* self,
@@ -33903,6 +38118,7 @@ wuffs_zlib__decoder__add_dictionary(
 
 // -------- func zlib.decoder.set_quirk_enabled
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_zlib__decoder__set_quirk_enabled(
     wuffs_zlib__decoder* self,
@@ -33923,6 +38139,7 @@ wuffs_zlib__decoder__set_quirk_enabled(
 
 // -------- func zlib.decoder.workbuf_len
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_zlib__decoder__workbuf_len(
     const wuffs_zlib__decoder* self) {
@@ -33939,6 +38156,7 @@ wuffs_zlib__decoder__workbuf_len(
 
 // -------- func zlib.decoder.transform_io
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_zlib__decoder__transform_io(
     wuffs_zlib__decoder* self,
@@ -33965,6 +38183,9 @@ wuffs_zlib__decoder__transform_io(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst))
 
   uint16_t v_x = 0;
   uint32_t v_checksum_got = 0;
@@ -34178,12 +38399,30 @@ wuffs_zlib__decoder__transform_io(
     a_src->meta.ri = ((size_t)(iop_a_src - a_src->data.ptr));
   }
 
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst),
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
   return status;
 }
 
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_zlib__decoder__telemetry(
+    const wuffs_zlib__decoder* self) {
+#if defined(WUFFS_CONFIG__TELEMETRY)
+  if (self &&
+      ((self->private_impl.magic == WUFFS_BASE__MAGIC) ||
+      (self->private_impl.magic == WUFFS_BASE__DISABLED))) {
+    return self->private_impl.telemetry;
+  }
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
+  return wuffs_base__empty_telemetry();
+}
+
 #endif  // !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__ZLIB)
 
 #if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__PNG)
@@ -34199,6 +38438,121 @@ const char wuffs_png__error__unsupported_png_file[] = "#png: unsupported PNG fil
 const char wuffs_png__error__internal_error_inconsistent_workbuf_length[] = "#png: internal error: inconsistent workbuf length";
 const char wuffs_png__error__internal_error_zlib_decoder_did_not_exhaust_its_input[] = "#png: internal error: zlib decoder did not exhaust its input";
 
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_png__status_http_code(const char* repr) {
+  if (repr == wuffs_png__error__bad_checksum) {
+    return 422;
+  }
+  if (repr == wuffs_png__error__bad_chunk) {
+    return 422;
+  }
+  if (repr == wuffs_png__error__bad_filter) {
+    return 422;
+  }
+  if (repr == wuffs_png__error__bad_header) {
+    return 422;
+  }
+  if (repr == wuffs_png__error__missing_palette) {
+    return 422;
+  }
+  if (repr == wuffs_png__error__unsupported_png_file) {
+    return 415;
+  }
+  return 0;
+}
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_png__status_errno(const char* repr) {
+  if (repr == wuffs_png__error__bad_checksum) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_png__error__bad_chunk) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_png__error__bad_filter) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_png__error__bad_header) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_png__error__missing_palette) {
+    return EBADMSG;
+  }
+  if (repr == wuffs_png__error__unsupported_png_file) {
+    return ENOTSUP;
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+static const char* const wuffs_png__status__enum_table[] = {
+  wuffs_png__error__bad_checksum,
+  wuffs_png__error__bad_chunk,
+  wuffs_png__error__bad_filter,
+  wuffs_png__error__bad_header,
+  wuffs_png__error__missing_palette,
+  wuffs_png__error__unsupported_png_file,
+  wuffs_png__error__internal_error_inconsistent_workbuf_length,
+  wuffs_png__error__internal_error_zlib_decoder_did_not_exhaust_its_input,
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_png__status__enum_table) / sizeof(wuffs_png__status__enum_table[0])) == WUFFS_PNG__STATUS_ENUM__MAX_INCL,
+    wuffs_png__status__enum_table_is_complete);
+
+static const uint8_t wuffs_png__status__enum_sorted[] = {
+  1,  // WUFFS_PNG__STATUS_ENUM__ERROR__BAD_CHECKSUM
+  2,  // WUFFS_PNG__STATUS_ENUM__ERROR__BAD_CHUNK
+  3,  // WUFFS_PNG__STATUS_ENUM__ERROR__BAD_FILTER
+  4,  // WUFFS_PNG__STATUS_ENUM__ERROR__BAD_HEADER
+  7,  // WUFFS_PNG__STATUS_ENUM__ERROR__INTERNAL_ERROR_INCONSISTENT_WORKBUF_LENGTH
+  8,  // WUFFS_PNG__STATUS_ENUM__ERROR__INTERNAL_ERROR_ZLIB_DECODER_DID_NOT_EXHAUST_ITS_INPUT
+  5,  // WUFFS_PNG__STATUS_ENUM__ERROR__MISSING_PALETTE
+  6,  // WUFFS_PNG__STATUS_ENUM__ERROR__UNSUPPORTED_PNG_FILE
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_png__status__enum_sorted) / sizeof(wuffs_png__status__enum_sorted[0])) == WUFFS_PNG__STATUS_ENUM__MAX_INCL,
+    wuffs_png__status__enum_sorted_is_complete);
+
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_png__status__from_enum(uint32_t e) {
+  if ((e == 0) || (e > WUFFS_PNG__STATUS_ENUM__MAX_INCL)) {
+    return NULL;
+  }
+  return wuffs_png__status__enum_table[e - 1];
+}
+
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_png__status__to_enum(const char* repr) {
+  uint32_t lo = 0;
+  uint32_t hi = WUFFS_PNG__STATUS_ENUM__MAX_INCL;
+  if (!repr) {
+    return 0;
+  }
+  while (lo < hi) {
+    uint32_t mid = lo + ((hi - lo) / 2);
+    uint32_t e = wuffs_png__status__enum_sorted[mid];
+    int c = strcmp(repr, wuffs_png__status__enum_table[e - 1]);
+    if (c == 0) {
+      return e;
+    } else if (c < 0) {
+      hi = mid;
+    } else {
+      lo = mid + 1;
+    }
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+// ‼ WUFFS MULTI-FILE SECTION +shared
 // ---------------- Private Consts
 
 static const uint8_t
@@ -34237,6 +38591,8 @@ WUFFS_PNG__NUM_CHANNELS[8] WUFFS_BASE__POTENTIALLY_UNUSED = {
   1, 0, 3, 1, 2, 0, 4, 0,
 };
 
+// ‼ WUFFS MULTI-FILE SECTION -shared
+
 // ---------------- Private Initializer Prototypes
 
 // ---------------- Private Function Prototypes
@@ -34472,7 +38828,7 @@ wuffs_png__decoder__func_ptrs_for__wuffs_base__image_decoder = {
 
 // ---------------- Initializer Implementations
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_png__decoder__initialize(
     wuffs_png__decoder* self,
     size_t sizeof_star_self,
@@ -34511,6 +38867,11 @@ wuffs_png__decoder__initialize(
     }
   }
 
+  if ((options & WUFFS_INITIALIZE__WORKBUF_LESS) != 0) {
+    return wuffs_base__make_status(wuffs_base__error__unsupported_option);
+  }
+
+  self->private_impl.avoid_cpu_arch = options & WUFFS_INITIALIZE__AVOID_CPU_ARCH;
   self->private_impl.choosy_filter_1 = &wuffs_png__decoder__filter_1__choosy_default;
   self->private_impl.choosy_filter_3 = &wuffs_png__decoder__filter_3__choosy_default;
   self->private_impl.choosy_filter_4 = &wuffs_png__decoder__filter_4__choosy_default;
@@ -34538,7 +38899,7 @@ wuffs_png__decoder__initialize(
   return wuffs_base__make_status(NULL);
 }
 
-wuffs_png__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_png__decoder*
 wuffs_png__decoder__alloc() {
   wuffs_png__decoder* x =
       (wuffs_png__decoder*)(calloc(sizeof(wuffs_png__decoder), 1));
@@ -34553,7 +38914,7 @@ wuffs_png__decoder__alloc() {
   return x;
 }
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_png__decoder() {
   return sizeof(wuffs_png__decoder);
 }
@@ -34564,6 +38925,7 @@ sizeof__wuffs_png__decoder() {
 // -------- func png.decoder.filter_1_distance_4_arm_neon
 
 #if defined(WUFFS_BASE__CPU_ARCH__ARM_NEON)
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_1_distance_4_arm_neon(
     wuffs_png__decoder* self,
@@ -34609,6 +38971,7 @@ wuffs_png__decoder__filter_1_distance_4_arm_neon(
 // -------- func png.decoder.filter_3_distance_4_arm_neon
 
 #if defined(WUFFS_BASE__CPU_ARCH__ARM_NEON)
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_3_distance_4_arm_neon(
     wuffs_png__decoder* self,
@@ -34700,6 +39063,7 @@ wuffs_png__decoder__filter_3_distance_4_arm_neon(
 // -------- func png.decoder.filter_4_distance_3_arm_neon
 
 #if defined(WUFFS_BASE__CPU_ARCH__ARM_NEON)
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_4_distance_3_arm_neon(
     wuffs_png__decoder* self,
@@ -34820,6 +39184,7 @@ wuffs_png__decoder__filter_4_distance_3_arm_neon(
 // -------- func png.decoder.filter_4_distance_4_arm_neon
 
 #if defined(WUFFS_BASE__CPU_ARCH__ARM_NEON)
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_4_distance_4_arm_neon(
     wuffs_png__decoder* self,
@@ -34918,6 +39283,7 @@ wuffs_png__decoder__filter_4_distance_4_arm_neon(
 
 // -------- func png.decoder.filter_1
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_1(
     wuffs_png__decoder* self,
@@ -34925,6 +39291,7 @@ wuffs_png__decoder__filter_1(
   return (*self->private_impl.choosy_filter_1)(self, a_curr);
 }
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_1__choosy_default(
     wuffs_png__decoder* self,
@@ -34951,6 +39318,7 @@ wuffs_png__decoder__filter_1__choosy_default(
 
 // -------- func png.decoder.filter_1_distance_3_fallback
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_1_distance_3_fallback(
     wuffs_png__decoder* self,
@@ -34999,6 +39367,7 @@ wuffs_png__decoder__filter_1_distance_3_fallback(
 
 // -------- func png.decoder.filter_1_distance_4_fallback
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_1_distance_4_fallback(
     wuffs_png__decoder* self,
@@ -35032,6 +39401,7 @@ wuffs_png__decoder__filter_1_distance_4_fallback(
 
 // -------- func png.decoder.filter_2
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_2(
     wuffs_png__decoder* self,
@@ -35051,6 +39421,7 @@ wuffs_png__decoder__filter_2(
 
 // -------- func png.decoder.filter_3
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_3(
     wuffs_png__decoder* self,
@@ -35059,6 +39430,7 @@ wuffs_png__decoder__filter_3(
   return (*self->private_impl.choosy_filter_3)(self, a_curr, a_prev);
 }
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_3__choosy_default(
     wuffs_png__decoder* self,
@@ -35093,6 +39465,7 @@ wuffs_png__decoder__filter_3__choosy_default(
 
 // -------- func png.decoder.filter_3_distance_3_fallback
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_3_distance_3_fallback(
     wuffs_png__decoder* self,
@@ -35189,6 +39562,7 @@ wuffs_png__decoder__filter_3_distance_3_fallback(
 
 // -------- func png.decoder.filter_3_distance_4_fallback
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_3_distance_4_fallback(
     wuffs_png__decoder* self,
@@ -35251,6 +39625,7 @@ wuffs_png__decoder__filter_3_distance_4_fallback(
 
 // -------- func png.decoder.filter_4
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_4(
     wuffs_png__decoder* self,
@@ -35259,6 +39634,7 @@ wuffs_png__decoder__filter_4(
   return (*self->private_impl.choosy_filter_4)(self, a_curr, a_prev);
 }
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_4__choosy_default(
     wuffs_png__decoder* self,
@@ -35314,6 +39690,7 @@ wuffs_png__decoder__filter_4__choosy_default(
 
 // -------- func png.decoder.filter_4_distance_3_fallback
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_4_distance_3_fallback(
     wuffs_png__decoder* self,
@@ -35433,6 +39810,7 @@ wuffs_png__decoder__filter_4_distance_3_fallback(
 
 // -------- func png.decoder.filter_4_distance_4_fallback
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_4_distance_4_fallback(
     wuffs_png__decoder* self,
@@ -35585,6 +39963,7 @@ wuffs_png__decoder__filter_4_distance_4_fallback(
 
 #if defined(WUFFS_BASE__CPU_ARCH__X86_64)
 WUFFS_BASE__MAYBE_ATTRIBUTE_TARGET("pclmul,popcnt,sse4.2")
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_1_distance_4_x86_sse42(
     wuffs_png__decoder* self,
@@ -35631,6 +40010,7 @@ wuffs_png__decoder__filter_1_distance_4_x86_sse42(
 
 #if defined(WUFFS_BASE__CPU_ARCH__X86_64)
 WUFFS_BASE__MAYBE_ATTRIBUTE_TARGET("pclmul,popcnt,sse4.2")
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_3_distance_4_x86_sse42(
     wuffs_png__decoder* self,
@@ -35736,6 +40116,7 @@ wuffs_png__decoder__filter_3_distance_4_x86_sse42(
 
 #if defined(WUFFS_BASE__CPU_ARCH__X86_64)
 WUFFS_BASE__MAYBE_ATTRIBUTE_TARGET("pclmul,popcnt,sse4.2")
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_4_distance_3_x86_sse42(
     wuffs_png__decoder* self,
@@ -35862,6 +40243,7 @@ wuffs_png__decoder__filter_4_distance_3_x86_sse42(
 
 #if defined(WUFFS_BASE__CPU_ARCH__X86_64)
 WUFFS_BASE__MAYBE_ATTRIBUTE_TARGET("pclmul,popcnt,sse4.2")
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__filter_4_distance_4_x86_sse42(
     wuffs_png__decoder* self,
@@ -35963,6 +40345,7 @@ wuffs_png__decoder__filter_4_distance_4_x86_sse42(
 
 // -------- func png.decoder.set_quirk_enabled
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_png__decoder__set_quirk_enabled(
     wuffs_png__decoder* self,
@@ -35984,6 +40367,7 @@ wuffs_png__decoder__set_quirk_enabled(
 
 // -------- func png.decoder.decode_image_config
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_png__decoder__decode_image_config(
     wuffs_png__decoder* self,
@@ -36009,6 +40393,9 @@ wuffs_png__decoder__decode_image_config(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      0)
 
   uint64_t v_magic = 0;
   uint64_t v_mark = 0;
@@ -36327,6 +40714,11 @@ wuffs_png__decoder__decode_image_config(
     a_src->meta.ri = ((size_t)(iop_a_src - a_src->data.ptr));
   }
 
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      0,
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -36335,6 +40727,7 @@ wuffs_png__decoder__decode_image_config(
 
 // -------- func png.decoder.decode_ihdr
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_png__decoder__decode_ihdr(
     wuffs_png__decoder* self,
@@ -36512,7 +40905,7 @@ wuffs_png__decoder__decode_ihdr(
       status = wuffs_base__make_status(wuffs_png__error__unsupported_png_file);
       goto exit;
     }
-    self->private_impl.f_overall_workbuf_length = (((uint64_t)(self->private_impl.f_height)) * (1 + wuffs_png__decoder__calculate_bytes_per_row(self, self->private_impl.f_width)));
+    self->private_impl.f_overall_workbuf_length = (self->private_impl.f_height * (1 + wuffs_png__decoder__calculate_bytes_per_row(self, self->private_impl.f_width)));
     wuffs_png__decoder__choose_filter_implementations(self);
 
     goto ok;
@@ -36536,6 +40929,7 @@ wuffs_png__decoder__decode_ihdr(
 
 // -------- func png.decoder.assign_filter_distance
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__assign_filter_distance(
     wuffs_png__decoder* self) {
@@ -36612,6 +41006,7 @@ wuffs_png__decoder__assign_filter_distance(
 
 // -------- func png.decoder.calculate_bytes_per_row
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static uint64_t
 wuffs_png__decoder__calculate_bytes_per_row(
     const wuffs_png__decoder* self,
@@ -36619,18 +41014,19 @@ wuffs_png__decoder__calculate_bytes_per_row(
   uint64_t v_bytes_per_channel = 0;
 
   if (self->private_impl.f_depth == 1) {
-    return ((uint64_t)(((a_width + 7) / 8)));
+    return ((uint64_t)(wuffs_base__u32__ceil_div_pow2(a_width, 3)));
   } else if (self->private_impl.f_depth == 2) {
-    return ((uint64_t)(((a_width + 3) / 4)));
+    return ((uint64_t)(wuffs_base__u32__ceil_div_pow2(a_width, 2)));
   } else if (self->private_impl.f_depth == 4) {
-    return ((uint64_t)(((a_width + 1) / 2)));
+    return ((uint64_t)(wuffs_base__u32__ceil_div_pow2(a_width, 1)));
   }
   v_bytes_per_channel = ((uint64_t)((self->private_impl.f_depth >> 3)));
-  return (((uint64_t)(a_width)) * v_bytes_per_channel * ((uint64_t)(WUFFS_PNG__NUM_CHANNELS[self->private_impl.f_color_type])));
+  return (((uint64_t)(a_width)) * v_bytes_per_channel * WUFFS_PNG__NUM_CHANNELS[self->private_impl.f_color_type]);
 }
 
 // -------- func png.decoder.choose_filter_implementations
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__empty_struct
 wuffs_png__decoder__choose_filter_implementations(
     wuffs_png__decoder* self) {
@@ -36641,35 +41037,43 @@ wuffs_png__decoder__choose_filter_implementations(
         &wuffs_png__decoder__filter_3_distance_3_fallback);
     self->private_impl.choosy_filter_4 = (
 #if defined(WUFFS_BASE__CPU_ARCH__ARM_NEON)
-        wuffs_base__cpu_arch__have_arm_neon() ? &wuffs_png__decoder__filter_4_distance_3_arm_neon :
+        (((self->private_impl.avoid_cpu_arch & WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_NEON) == 0) &&
+        wuffs_base__cpu_arch__have_arm_neon()) ? &wuffs_png__decoder__filter_4_distance_3_arm_neon :
 #endif
 #if defined(WUFFS_BASE__CPU_ARCH__X86_64)
-        wuffs_base__cpu_arch__have_x86_sse42() ? &wuffs_png__decoder__filter_4_distance_3_x86_sse42 :
+        (((self->private_impl.avoid_cpu_arch & WUFFS_INITIALIZE__AVOID_CPU_ARCH__X86_SSE42) == 0) &&
+        wuffs_base__cpu_arch__have_x86_sse42()) ? &wuffs_png__decoder__filter_4_distance_3_x86_sse42 :
 #endif
         &wuffs_png__decoder__filter_4_distance_3_fallback);
   } else if (self->private_impl.f_filter_distance == 4) {
     self->private_impl.choosy_filter_1 = (
 #if defined(WUFFS_BASE__CPU_ARCH__ARM_NEON)
-        wuffs_base__cpu_arch__have_arm_neon() ? &wuffs_png__decoder__filter_1_distance_4_arm_neon :
+        (((self->private_impl.avoid_cpu_arch & WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_NEON) == 0) &&
+        wuffs_base__cpu_arch__have_arm_neon()) ? &wuffs_png__decoder__filter_1_distance_4_arm_neon :
 #endif
 #if defined(WUFFS_BASE__CPU_ARCH__X86_64)
-        wuffs_base__cpu_arch__have_x86_sse42() ? &wuffs_png__decoder__filter_1_distance_4_x86_sse42 :
+        (((self->private_impl.avoid_cpu_arch & WUFFS_INITIALIZE__AVOID_CPU_ARCH__X86_SSE42) == 0) &&
+        wuffs_base__cpu_arch__have_x86_sse42()) ? &wuffs_png__decoder__filter_1_distance_4_x86_sse42 :
 #endif
         &wuffs_png__decoder__filter_1_distance_4_fallback);
     self->private_impl.choosy_filter_3 = (
 #if defined(WUFFS_BASE__CPU_ARCH__ARM_NEON)
-        wuffs_base__cpu_arch__have_arm_neon() ? &wuffs_png__decoder__filter_3_distance_4_arm_neon :
+        (((self->private_impl.avoid_cpu_arch & WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_NEON) == 0) &&
+        wuffs_base__cpu_arch__have_arm_neon()) ? &wuffs_png__decoder__filter_3_distance_4_arm_neon :
 #endif
 #if defined(WUFFS_BASE__CPU_ARCH__X86_64)
-        wuffs_base__cpu_arch__have_x86_sse42() ? &wuffs_png__decoder__filter_3_distance_4_x86_sse42 :
+        (((self->private_impl.avoid_cpu_arch & WUFFS_INITIALIZE__AVOID_CPU_ARCH__X86_SSE42) == 0) &&
+        wuffs_base__cpu_arch__have_x86_sse42()) ? &wuffs_png__decoder__filter_3_distance_4_x86_sse42 :
 #endif
         &wuffs_png__decoder__filter_3_distance_4_fallback);
     self->private_impl.choosy_filter_4 = (
 #if defined(WUFFS_BASE__CPU_ARCH__ARM_NEON)
-        wuffs_base__cpu_arch__have_arm_neon() ? &wuffs_png__decoder__filter_4_distance_4_arm_neon :
+        (((self->private_impl.avoid_cpu_arch & WUFFS_INITIALIZE__AVOID_CPU_ARCH__ARM_NEON) == 0) &&
+        wuffs_base__cpu_arch__have_arm_neon()) ? &wuffs_png__decoder__filter_4_distance_4_arm_neon :
 #endif
 #if defined(WUFFS_BASE__CPU_ARCH__X86_64)
-        wuffs_base__cpu_arch__have_x86_sse42() ? &wuffs_png__decoder__filter_4_distance_4_x86_sse42 :
+        (((self->private_impl.avoid_cpu_arch & WUFFS_INITIALIZE__AVOID_CPU_ARCH__X86_SSE42) == 0) &&
+        wuffs_base__cpu_arch__have_x86_sse42()) ? &wuffs_png__decoder__filter_4_distance_4_x86_sse42 :
 #endif
         &wuffs_png__decoder__filter_4_distance_4_fallback);
   }
@@ -36678,6 +41082,7 @@ wuffs_png__decoder__choose_filter_implementations(
 
 // -------- func png.decoder.decode_other_chunk
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_png__decoder__decode_other_chunk(
     wuffs_png__decoder* self,
@@ -36766,6 +41171,7 @@ wuffs_png__decoder__decode_other_chunk(
 
 // -------- func png.decoder.decode_plte
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_png__decoder__decode_plte(
     wuffs_png__decoder* self,
@@ -36868,6 +41274,7 @@ wuffs_png__decoder__decode_plte(
 
 // -------- func png.decoder.decode_trns
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_png__decoder__decode_trns(
     wuffs_png__decoder* self,
@@ -36951,6 +41358,7 @@ wuffs_png__decoder__decode_trns(
 
 // -------- func png.decoder.decode_frame_config
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_png__decoder__decode_frame_config(
     wuffs_png__decoder* self,
@@ -36976,6 +41384,9 @@ wuffs_png__decoder__decode_frame_config(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      0)
 
   const uint8_t* iop_a_src = NULL;
   const uint8_t* io0_a_src WUFFS_BASE__POTENTIALLY_UNUSED = NULL;
@@ -37052,6 +41463,11 @@ wuffs_png__decoder__decode_frame_config(
     a_src->meta.ri = ((size_t)(iop_a_src - a_src->data.ptr));
   }
 
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      0,
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -37060,6 +41476,7 @@ wuffs_png__decoder__decode_frame_config(
 
 // -------- func png.decoder.decode_frame
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_png__decoder__decode_frame(
     wuffs_png__decoder* self,
@@ -37088,6 +41505,9 @@ wuffs_png__decoder__decode_frame(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      0)
 
   wuffs_base__status v_status = wuffs_base__make_status(NULL);
   uint32_t v_pass_width = 0;
@@ -37129,7 +41549,7 @@ wuffs_png__decoder__decode_frame(
       v_pass_height = (16777215 & ((((uint32_t)(WUFFS_PNG__INTERLACING[self->private_impl.f_interlace_pass][4])) + self->private_impl.f_height) >> WUFFS_PNG__INTERLACING[self->private_impl.f_interlace_pass][3]));
       if ((v_pass_width > 0) && (v_pass_height > 0)) {
         self->private_impl.f_pass_bytes_per_row = wuffs_png__decoder__calculate_bytes_per_row(self, v_pass_width);
-        self->private_impl.f_pass_workbuf_length = (((uint64_t)(v_pass_height)) * (1 + self->private_impl.f_pass_bytes_per_row));
+        self->private_impl.f_pass_workbuf_length = (v_pass_height * (1 + self->private_impl.f_pass_bytes_per_row));
         WUFFS_BASE__COROUTINE_SUSPENSION_POINT(2);
         status = wuffs_png__decoder__decode_pass(self, a_src, a_workbuf);
         if (status.repr) {
@@ -37175,6 +41595,11 @@ wuffs_png__decoder__decode_frame(
 
   goto exit;
   exit:
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      0,
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -37183,6 +41608,7 @@ wuffs_png__decoder__decode_frame(
 
 // -------- func png.decoder.decode_pass
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_png__decoder__decode_pass(
     wuffs_png__decoder* self,
@@ -37483,6 +41909,7 @@ wuffs_png__decoder__decode_pass(
 
 // -------- func png.decoder.frame_dirty_rect
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__rect_ie_u32
 wuffs_png__decoder__frame_dirty_rect(
     const wuffs_png__decoder* self) {
@@ -37503,6 +41930,7 @@ wuffs_png__decoder__frame_dirty_rect(
 
 // -------- func png.decoder.num_animation_loops
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint32_t
 wuffs_png__decoder__num_animation_loops(
     const wuffs_png__decoder* self) {
@@ -37519,6 +41947,7 @@ wuffs_png__decoder__num_animation_loops(
 
 // -------- func png.decoder.num_decoded_frame_configs
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_png__decoder__num_decoded_frame_configs(
     const wuffs_png__decoder* self) {
@@ -37538,6 +41967,7 @@ wuffs_png__decoder__num_decoded_frame_configs(
 
 // -------- func png.decoder.num_decoded_frames
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_png__decoder__num_decoded_frames(
     const wuffs_png__decoder* self) {
@@ -37557,6 +41987,7 @@ wuffs_png__decoder__num_decoded_frames(
 
 // -------- func png.decoder.restart_frame
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_png__decoder__restart_frame(
     wuffs_png__decoder* self,
@@ -37588,6 +42019,7 @@ wuffs_png__decoder__restart_frame(
 
 // -------- func png.decoder.set_report_metadata
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_png__decoder__set_report_metadata(
     wuffs_png__decoder* self,
@@ -37598,6 +42030,7 @@ wuffs_png__decoder__set_report_metadata(
 
 // -------- func png.decoder.tell_me_more
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_png__decoder__tell_me_more(
     wuffs_png__decoder* self,
@@ -37624,6 +42057,9 @@ wuffs_png__decoder__tell_me_more(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst))
 
   status = wuffs_base__make_status(wuffs_base__error__no_more_information);
   goto exit;
@@ -37632,6 +42068,11 @@ wuffs_png__decoder__tell_me_more(
   ok:
   goto exit;
   exit:
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst),
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -37640,6 +42081,7 @@ wuffs_png__decoder__tell_me_more(
 
 // -------- func png.decoder.workbuf_len
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_png__decoder__workbuf_len(
     const wuffs_png__decoder* self) {
@@ -37656,6 +42098,7 @@ wuffs_png__decoder__workbuf_len(
 
 // -------- func png.decoder.filter_and_swizzle
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_png__decoder__filter_and_swizzle(
     wuffs_png__decoder* self,
@@ -37664,6 +42107,7 @@ wuffs_png__decoder__filter_and_swizzle(
   return (*self->private_impl.choosy_filter_and_swizzle)(self, a_dst, a_workbuf);
 }
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_png__decoder__filter_and_swizzle__choosy_default(
     wuffs_png__decoder* self,
@@ -37687,7 +42131,7 @@ wuffs_png__decoder__filter_and_swizzle__choosy_default(
     return wuffs_base__make_status(wuffs_base__error__unsupported_option);
   }
   v_dst_bytes_per_pixel = ((uint64_t)((v_dst_bits_per_pixel / 8)));
-  v_dst_bytes_per_row = (((uint64_t)(self->private_impl.f_width)) * v_dst_bytes_per_pixel);
+  v_dst_bytes_per_row = (self->private_impl.f_width * v_dst_bytes_per_pixel);
   v_dst_palette = wuffs_base__pixel_buffer__palette_or_else(a_dst, wuffs_base__make_slice_u8(self->private_data.f_dst_palette, 1024));
   v_tab = wuffs_base__pixel_buffer__plane(a_dst, 0);
   while (v_y < self->private_impl.f_height) {
@@ -37726,6 +42170,7 @@ wuffs_png__decoder__filter_and_swizzle__choosy_default(
 
 // -------- func png.decoder.filter_and_swizzle_tricky
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 static wuffs_base__status
 wuffs_png__decoder__filter_and_swizzle_tricky(
     wuffs_png__decoder* self,
@@ -37758,12 +42203,12 @@ wuffs_png__decoder__filter_and_swizzle_tricky(
     return wuffs_base__make_status(wuffs_base__error__unsupported_option);
   }
   v_dst_bytes_per_pixel = ((uint64_t)((v_dst_bits_per_pixel / 8)));
-  v_dst_bytes_per_row = (((uint64_t)(self->private_impl.f_width)) * v_dst_bytes_per_pixel);
+  v_dst_bytes_per_row = (self->private_impl.f_width * v_dst_bytes_per_pixel);
   v_dst_palette = wuffs_base__pixel_buffer__palette_or_else(a_dst, wuffs_base__make_slice_u8(self->private_data.f_dst_palette, 1024));
   v_tab = wuffs_base__pixel_buffer__plane(a_dst, 0);
   v_src_bytes_per_pixel = 1;
   if (self->private_impl.f_depth >= 8) {
-    v_src_bytes_per_pixel = (((uint64_t)(WUFFS_PNG__NUM_CHANNELS[self->private_impl.f_color_type])) * ((uint64_t)((self->private_impl.f_depth >> 3))));
+    v_src_bytes_per_pixel = (WUFFS_PNG__NUM_CHANNELS[self->private_impl.f_color_type] * ((uint64_t)((self->private_impl.f_depth >> 3))));
   }
   v_bits_unpacked[0] = 255;
   v_bits_unpacked[1] = 255;
@@ -37805,7 +42250,7 @@ wuffs_png__decoder__filter_and_swizzle_tricky(
     v_x = ((uint32_t)(WUFFS_PNG__INTERLACING[self->private_impl.f_interlace_pass][2]));
     if (self->private_impl.f_depth == 8) {
       while (v_x < self->private_impl.f_width) {
-        v_i = (((uint64_t)(v_x)) * v_dst_bytes_per_pixel);
+        v_i = (v_x * v_dst_bytes_per_pixel);
         if (v_i <= ((uint64_t)(v_dst.len))) {
           if (self->private_impl.f_color_type == 4) {
             if (2 <= ((uint64_t)(v_s.len))) {
@@ -37831,7 +42276,7 @@ wuffs_png__decoder__filter_and_swizzle_tricky(
       v_shift = ((8 - self->private_impl.f_depth) & 7);
       v_packs_remaining = 0;
       while (v_x < self->private_impl.f_width) {
-        v_i = (((uint64_t)(v_x)) * v_dst_bytes_per_pixel);
+        v_i = (v_x * v_dst_bytes_per_pixel);
         if (v_i <= ((uint64_t)(v_dst.len))) {
           if ((v_packs_remaining == 0) && (1 <= ((uint64_t)(v_s.len)))) {
             v_packs_remaining = WUFFS_PNG__LOW_BIT_DEPTH_NUM_PACKS[self->private_impl.f_depth];
@@ -37839,7 +42284,7 @@ wuffs_png__decoder__filter_and_swizzle_tricky(
             v_s = wuffs_base__slice_u8__subslice_i(v_s, 1);
           }
           v_bits_unpacked[0] = ((uint8_t)((v_bits_packed >> v_shift) * v_multiplier));
-          v_bits_packed = ((uint8_t)(v_bits_packed << self->private_impl.f_depth));
+          v_bits_packed = wuffs_base__u8__mod_shift_left(v_bits_packed, self->private_impl.f_depth);
           v_packs_remaining = ((uint8_t)(v_packs_remaining - 1));
           wuffs_base__pixel_swizzler__swizzle_interleaved_from_slice(&self->private_impl.f_swizzler, wuffs_base__slice_u8__subslice_i(v_dst, v_i), v_dst_palette, wuffs_base__make_slice_u8(v_bits_unpacked, 1));
         }
@@ -37847,7 +42292,7 @@ wuffs_png__decoder__filter_and_swizzle_tricky(
       }
     } else {
       while (v_x < self->private_impl.f_width) {
-        v_i = (((uint64_t)(v_x)) * v_dst_bytes_per_pixel);
+        v_i = (v_x * v_dst_bytes_per_pixel);
         if (v_i <= ((uint64_t)(v_dst.len))) {
           if (self->private_impl.f_color_type == 0) {
             if (2 <= ((uint64_t)(v_s.len))) {
@@ -37905,6 +42350,77 @@ wuffs_png__decoder__filter_and_swizzle_tricky(
   return wuffs_base__make_status(NULL);
 }
 
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_png__decoder__visit_metadata(
+    wuffs_png__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__more_information* a_minfo,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__metadata_chunk_func a_callback,
+    void* a_context) {
+  if (!a_minfo) {
+    return wuffs_base__make_status(wuffs_base__error__bad_argument);
+  }
+  while (true) {
+    wuffs_base__status status = wuffs_base__more_information__deliver_metadata(
+        a_minfo, a_src, a_callback, a_context);
+    if (status.repr) {
+      return status;
+    }
+    status = wuffs_png__decoder__tell_me_more(self, a_dst, a_minfo, a_src);
+    if (status.repr != wuffs_base__suspension__even_more_information) {
+      return status;
+    }
+  }
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_png__decoder__read_metadata_chunk(
+    wuffs_png__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__metadata_reader* a_reader,
+    wuffs_base__io_buffer* a_src) {
+  if (!a_reader) {
+    return wuffs_base__make_status(wuffs_base__error__bad_argument);
+  }
+  while (true) {
+    wuffs_base__status status = wuffs_base__metadata_reader__next_chunk(a_reader, a_src);
+    if (status.repr || (a_reader->chunk.len > 0)) {
+      return status;
+    }
+    status = wuffs_png__decoder__tell_me_more(self, a_dst, &a_reader->minfo, a_src);
+    if (status.repr != wuffs_base__suspension__even_more_information) {
+      return status;
+    }
+  }
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_png__decoder__probe(
+    wuffs_png__decoder* self,
+    wuffs_base__image_config* a_dst,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__range_ii_u64* a_workbuf_len) {
+  wuffs_base__status status = wuffs_png__decoder__decode_image_config(self, a_dst, a_src);
+  if (!status.repr && a_workbuf_len) {
+    *a_workbuf_len = wuffs_png__decoder__workbuf_len(self);
+  }
+  return status;
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_png__decoder__telemetry(
+    const wuffs_png__decoder* self) {
+#if defined(WUFFS_CONFIG__TELEMETRY)
+  if (self &&
+      ((self->private_impl.magic == WUFFS_BASE__MAGIC) ||
+      (self->private_impl.magic == WUFFS_BASE__DISABLED))) {
+    return self->private_impl.telemetry;
+  }
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
+  return wuffs_base__empty_telemetry();
+}
+
 #endif  // !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__PNG)
 
 #if !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__WBMP)
@@ -37913,6 +42429,76 @@ wuffs_png__decoder__filter_and_swizzle_tricky(
 
 const char wuffs_wbmp__error__bad_header[] = "#wbmp: bad header";
 
+#if defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_wbmp__status_http_code(const char* repr) {
+  if (repr == wuffs_wbmp__error__bad_header) {
+    return 422;
+  }
+  return 0;
+}
+
+WUFFS_BASE__MAYBE_STATIC int32_t  //
+wuffs_wbmp__status_errno(const char* repr) {
+  if (repr == wuffs_wbmp__error__bad_header) {
+    return EBADMSG;
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_MAPPINGS)
+
+#if defined(WUFFS_CONFIG__STATUS_ENUMS)
+
+static const char* const wuffs_wbmp__status__enum_table[] = {
+  wuffs_wbmp__error__bad_header,
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_wbmp__status__enum_table) / sizeof(wuffs_wbmp__status__enum_table[0])) == WUFFS_WBMP__STATUS_ENUM__MAX_INCL,
+    wuffs_wbmp__status__enum_table_is_complete);
+
+static const uint8_t wuffs_wbmp__status__enum_sorted[] = {
+  1,  // WUFFS_WBMP__STATUS_ENUM__ERROR__BAD_HEADER
+};
+
+WUFFS_BASE__STATIC_ASSERT(
+    (sizeof(wuffs_wbmp__status__enum_sorted) / sizeof(wuffs_wbmp__status__enum_sorted[0])) == WUFFS_WBMP__STATUS_ENUM__MAX_INCL,
+    wuffs_wbmp__status__enum_sorted_is_complete);
+
+WUFFS_BASE__MAYBE_STATIC const char*  //
+wuffs_wbmp__status__from_enum(uint32_t e) {
+  if ((e == 0) || (e > WUFFS_WBMP__STATUS_ENUM__MAX_INCL)) {
+    return NULL;
+  }
+  return wuffs_wbmp__status__enum_table[e - 1];
+}
+
+WUFFS_BASE__MAYBE_STATIC uint32_t  //
+wuffs_wbmp__status__to_enum(const char* repr) {
+  uint32_t lo = 0;
+  uint32_t hi = WUFFS_WBMP__STATUS_ENUM__MAX_INCL;
+  if (!repr) {
+    return 0;
+  }
+  while (lo < hi) {
+    uint32_t mid = lo + ((hi - lo) / 2);
+    uint32_t e = wuffs_wbmp__status__enum_sorted[mid];
+    int c = strcmp(repr, wuffs_wbmp__status__enum_table[e - 1]);
+    if (c == 0) {
+      return e;
+    } else if (c < 0) {
+      hi = mid;
+    } else {
+      lo = mid + 1;
+    }
+  }
+  return 0;
+}
+
+#endif  // defined(WUFFS_CONFIG__STATUS_ENUMS)
+
 // ---------------- Private Consts
 
 // ---------------- Private Initializer Prototypes
@@ -37957,7 +42543,7 @@ wuffs_wbmp__decoder__func_ptrs_for__wuffs_base__image_decoder = {
 
 // ---------------- Initializer Implementations
 
-wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status WUFFS_BASE__WARN_UNUSED_RESULT
 wuffs_wbmp__decoder__initialize(
     wuffs_wbmp__decoder* self,
     size_t sizeof_star_self,
@@ -37996,6 +42582,10 @@ wuffs_wbmp__decoder__initialize(
     }
   }
 
+  if ((options & WUFFS_INITIALIZE__WORKBUF_LESS) != 0) {
+    return wuffs_base__make_status(wuffs_base__error__unsupported_option);
+  }
+
   self->private_impl.magic = WUFFS_BASE__MAGIC;
   self->private_impl.vtable_for__wuffs_base__image_decoder.vtable_name =
       wuffs_base__image_decoder__vtable_name;
@@ -38004,7 +42594,7 @@ wuffs_wbmp__decoder__initialize(
   return wuffs_base__make_status(NULL);
 }
 
-wuffs_wbmp__decoder*
+WUFFS_BASE__MAYBE_STATIC wuffs_wbmp__decoder*
 wuffs_wbmp__decoder__alloc() {
   wuffs_wbmp__decoder* x =
       (wuffs_wbmp__decoder*)(calloc(sizeof(wuffs_wbmp__decoder), 1));
@@ -38019,7 +42609,7 @@ wuffs_wbmp__decoder__alloc() {
   return x;
 }
 
-size_t
+WUFFS_BASE__MAYBE_STATIC size_t
 sizeof__wuffs_wbmp__decoder() {
   return sizeof(wuffs_wbmp__decoder);
 }
@@ -38028,6 +42618,7 @@ sizeof__wuffs_wbmp__decoder() {
 
 // -------- func wbmp.decoder.set_quirk_enabled
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_wbmp__decoder__set_quirk_enabled(
     wuffs_wbmp__decoder* self,
@@ -38038,6 +42629,7 @@ wuffs_wbmp__decoder__set_quirk_enabled(
 
 // -------- func wbmp.decoder.decode_image_config
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_wbmp__decoder__decode_image_config(
     wuffs_wbmp__decoder* self,
@@ -38063,6 +42655,9 @@ wuffs_wbmp__decoder__decode_image_config(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      0)
 
   uint8_t v_c = 0;
   uint32_t v_i = 0;
@@ -38173,6 +42768,11 @@ wuffs_wbmp__decoder__decode_image_config(
     a_src->meta.ri = ((size_t)(iop_a_src - a_src->data.ptr));
   }
 
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      0,
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -38181,6 +42781,7 @@ wuffs_wbmp__decoder__decode_image_config(
 
 // -------- func wbmp.decoder.decode_frame_config
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_wbmp__decoder__decode_frame_config(
     wuffs_wbmp__decoder* self,
@@ -38206,6 +42807,9 @@ wuffs_wbmp__decoder__decode_frame_config(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      0)
 
   const uint8_t* iop_a_src = NULL;
   const uint8_t* io0_a_src WUFFS_BASE__POTENTIALLY_UNUSED = NULL;
@@ -38282,6 +42886,11 @@ wuffs_wbmp__decoder__decode_frame_config(
     a_src->meta.ri = ((size_t)(iop_a_src - a_src->data.ptr));
   }
 
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      0,
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -38290,6 +42899,7 @@ wuffs_wbmp__decoder__decode_frame_config(
 
 // -------- func wbmp.decoder.decode_frame
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_wbmp__decoder__decode_frame(
     wuffs_wbmp__decoder* self,
@@ -38318,6 +42928,9 @@ wuffs_wbmp__decoder__decode_frame(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      0)
 
   wuffs_base__status v_status = wuffs_base__make_status(NULL);
   wuffs_base__pixel_format v_dst_pixfmt = {0};
@@ -38405,7 +43018,7 @@ wuffs_wbmp__decoder__decode_frame(
               WUFFS_BASE__COROUTINE_SUSPENSION_POINT_MAYBE_SUSPEND(2);
               v_tab = wuffs_base__pixel_buffer__plane(a_dst, 0);
               v_dst = wuffs_base__table_u8__row(v_tab, v_dst_y);
-              v_dst_x_in_bytes = (((uint64_t)(v_dst_x)) * v_dst_bytes_per_pixel);
+              v_dst_x_in_bytes = (v_dst_x * v_dst_bytes_per_pixel);
               if (v_dst_x_in_bytes <= ((uint64_t)(v_dst.len))) {
                 v_dst = wuffs_base__slice_u8__subslice_i(v_dst, v_dst_x_in_bytes);
               }
@@ -38452,6 +43065,11 @@ wuffs_wbmp__decoder__decode_frame(
     a_src->meta.ri = ((size_t)(iop_a_src - a_src->data.ptr));
   }
 
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      0,
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -38460,6 +43078,7 @@ wuffs_wbmp__decoder__decode_frame(
 
 // -------- func wbmp.decoder.frame_dirty_rect
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__rect_ie_u32
 wuffs_wbmp__decoder__frame_dirty_rect(
     const wuffs_wbmp__decoder* self) {
@@ -38480,6 +43099,7 @@ wuffs_wbmp__decoder__frame_dirty_rect(
 
 // -------- func wbmp.decoder.num_animation_loops
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint32_t
 wuffs_wbmp__decoder__num_animation_loops(
     const wuffs_wbmp__decoder* self) {
@@ -38496,6 +43116,7 @@ wuffs_wbmp__decoder__num_animation_loops(
 
 // -------- func wbmp.decoder.num_decoded_frame_configs
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_wbmp__decoder__num_decoded_frame_configs(
     const wuffs_wbmp__decoder* self) {
@@ -38515,6 +43136,7 @@ wuffs_wbmp__decoder__num_decoded_frame_configs(
 
 // -------- func wbmp.decoder.num_decoded_frames
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC uint64_t
 wuffs_wbmp__decoder__num_decoded_frames(
     const wuffs_wbmp__decoder* self) {
@@ -38534,6 +43156,7 @@ wuffs_wbmp__decoder__num_decoded_frames(
 
 // -------- func wbmp.decoder.restart_frame
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_wbmp__decoder__restart_frame(
     wuffs_wbmp__decoder* self,
@@ -38562,6 +43185,7 @@ wuffs_wbmp__decoder__restart_frame(
 
 // -------- func wbmp.decoder.set_report_metadata
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__empty_struct
 wuffs_wbmp__decoder__set_report_metadata(
     wuffs_wbmp__decoder* self,
@@ -38572,6 +43196,7 @@ wuffs_wbmp__decoder__set_report_metadata(
 
 // -------- func wbmp.decoder.tell_me_more
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__status
 wuffs_wbmp__decoder__tell_me_more(
     wuffs_wbmp__decoder* self,
@@ -38598,6 +43223,9 @@ wuffs_wbmp__decoder__tell_me_more(
   }
   self->private_impl.active_coroutine = 0;
   wuffs_base__status status = wuffs_base__make_status(NULL);
+  WUFFS_BASE__TELEMETRY__BEGIN(
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst))
 
   status = wuffs_base__make_status(wuffs_base__error__no_more_information);
   goto exit;
@@ -38606,6 +43234,11 @@ wuffs_wbmp__decoder__tell_me_more(
   ok:
   goto exit;
   exit:
+  WUFFS_BASE__TELEMETRY__END(
+      &self->private_impl.telemetry,
+      wuffs_base__io_buffer__reader_position(a_src),
+      wuffs_base__io_buffer__writer_position(a_dst),
+      &status)
   if (wuffs_base__status__is_error(&status)) {
     self->private_impl.magic = WUFFS_BASE__DISABLED;
   }
@@ -38614,6 +43247,7 @@ wuffs_wbmp__decoder__tell_me_more(
 
 // -------- func wbmp.decoder.workbuf_len
 
+WUFFS_BASE__NO_THREAD_SAFETY_ANALYSIS
 WUFFS_BASE__MAYBE_STATIC wuffs_base__range_ii_u64
 wuffs_wbmp__decoder__workbuf_len(
     const wuffs_wbmp__decoder* self) {
@@ -38628,6 +43262,77 @@ wuffs_wbmp__decoder__workbuf_len(
   return wuffs_base__utility__make_range_ii_u64(0, 0);
 }
 
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_wbmp__decoder__visit_metadata(
+    wuffs_wbmp__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__more_information* a_minfo,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__metadata_chunk_func a_callback,
+    void* a_context) {
+  if (!a_minfo) {
+    return wuffs_base__make_status(wuffs_base__error__bad_argument);
+  }
+  while (true) {
+    wuffs_base__status status = wuffs_base__more_information__deliver_metadata(
+        a_minfo, a_src, a_callback, a_context);
+    if (status.repr) {
+      return status;
+    }
+    status = wuffs_wbmp__decoder__tell_me_more(self, a_dst, a_minfo, a_src);
+    if (status.repr != wuffs_base__suspension__even_more_information) {
+      return status;
+    }
+  }
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_wbmp__decoder__read_metadata_chunk(
+    wuffs_wbmp__decoder* self,
+    wuffs_base__io_buffer* a_dst,
+    wuffs_base__metadata_reader* a_reader,
+    wuffs_base__io_buffer* a_src) {
+  if (!a_reader) {
+    return wuffs_base__make_status(wuffs_base__error__bad_argument);
+  }
+  while (true) {
+    wuffs_base__status status = wuffs_base__metadata_reader__next_chunk(a_reader, a_src);
+    if (status.repr || (a_reader->chunk.len > 0)) {
+      return status;
+    }
+    status = wuffs_wbmp__decoder__tell_me_more(self, a_dst, &a_reader->minfo, a_src);
+    if (status.repr != wuffs_base__suspension__even_more_information) {
+      return status;
+    }
+  }
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__status
+wuffs_wbmp__decoder__probe(
+    wuffs_wbmp__decoder* self,
+    wuffs_base__image_config* a_dst,
+    wuffs_base__io_buffer* a_src,
+    wuffs_base__range_ii_u64* a_workbuf_len) {
+  wuffs_base__status status = wuffs_wbmp__decoder__decode_image_config(self, a_dst, a_src);
+  if (!status.repr && a_workbuf_len) {
+    *a_workbuf_len = wuffs_wbmp__decoder__workbuf_len(self);
+  }
+  return status;
+}
+
+WUFFS_BASE__MAYBE_STATIC wuffs_base__telemetry
+wuffs_wbmp__decoder__telemetry(
+    const wuffs_wbmp__decoder* self) {
+#if defined(WUFFS_CONFIG__TELEMETRY)
+  if (self &&
+      ((self->private_impl.magic == WUFFS_BASE__MAGIC) ||
+      (self->private_impl.magic == WUFFS_BASE__DISABLED))) {
+    return self->private_impl.telemetry;
+  }
+#endif  // defined(WUFFS_CONFIG__TELEMETRY)
+  return wuffs_base__empty_telemetry();
+}
+
 #endif  // !defined(WUFFS_CONFIG__MODULES) || defined(WUFFS_CONFIG__MODULE__WBMP)
 
 #if defined(__cplusplus) && defined(WUFFS_BASE__HAVE_UNIQUE_PTR)
@@ -138,13 +138,16 @@ test_wuffs_crc32_ieee_golden() {
     });
     CHECK_STRING(read_file(&src, test_cases[tc].filename));
 
+    // Bit 0 of j is whether to update in fragments. Bit 1 of j is whether to
+    // use only the portable (not the CPU-architecture-specific) variants.
     int j;
-    for (j = 0; j < 2; j++) {
+    for (j = 0; j < 4; j++) {
       wuffs_crc32__ieee_hasher checksum;
       CHECK_STATUS("initialize",
                    wuffs_crc32__ieee_hasher__initialize(
                        &checksum, sizeof checksum, WUFFS_VERSION,
-                       WUFFS_INITIALIZE__LEAVE_INTERNAL_BUFFERS_UNINITIALIZED));
+                       WUFFS_INITIALIZE__LEAVE_INTERNAL_BUFFERS_UNINITIALIZED |
+                           ((j & 2) ? WUFFS_INITIALIZE__AVOID_CPU_ARCH : 0)));
 
       uint32_t have = 0;
       size_t num_fragments = 0;
@@ -155,7 +158,7 @@ test_wuffs_crc32_ieee_golden() {
             .len = src.meta.wi - num_bytes,
         });
         size_t limit = 101 + 103 * num_fragments;
-        if ((j > 0) && (data.len > limit)) {
+        if ((j & 1) && (data.len > limit)) {
           data.len = limit;
         }
         have = wuffs_crc32__ieee_hasher__update_u32(&checksum, data);
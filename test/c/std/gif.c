@@ -59,6 +59,9 @@ the first "./a.out" with "./a.out -bench". Combine these changes with the
 #define WUFFS_CONFIG__MODULE__GIF
 #define WUFFS_CONFIG__MODULE__LZW
 
+// Declare the wuffs_gif__status__from_enum and to_enum functions.
+#define WUFFS_CONFIG__STATUS_ENUMS
+
 // If building this program in an environment that doesn't easily accommodate
 // relative includes, you can use the script/inline-c-relative-includes.go
 // program to generate a stand-alone C file.
@@ -1455,6 +1458,84 @@ test_wuffs_gif_decode_metadata_full() {
   return do_test_wuffs_gif_decode_metadata(true);
 }
 
+const char*  //
+test_wuffs_gif_decode_metadata_read_chunks() {
+  CHECK_FOCUS(__func__);
+  wuffs_base__io_buffer src = ((wuffs_base__io_buffer){
+      .data = g_src_slice_u8,
+  });
+  CHECK_STRING(read_file(&src, "test/data/artificial/gif-metadata-full.gif"));
+
+  wuffs_gif__decoder dec;
+  CHECK_STATUS("initialize",
+               wuffs_gif__decoder__initialize(
+                   &dec, sizeof dec, WUFFS_VERSION,
+                   WUFFS_INITIALIZE__LEAVE_INTERNAL_BUFFERS_UNINITIALIZED));
+  wuffs_gif__decoder__set_report_metadata(&dec, WUFFS_BASE__FOURCC__ICCP, true);
+  wuffs_gif__decoder__set_report_metadata(&dec, WUFFS_BASE__FOURCC__XMP, true);
+
+  int num_reported = 0;
+  wuffs_base__image_config ic = ((wuffs_base__image_config){});
+  while (true) {
+    wuffs_base__status status =
+        wuffs_gif__decoder__decode_image_config(&dec, &ic, &src);
+    if (wuffs_base__status__is_ok(&status)) {
+      break;
+    } else if (status.repr != wuffs_base__note__metadata_reported) {
+      RETURN_FAIL("decode_image_config: have \"%s\", want \"%s\"",
+                  status.repr, wuffs_base__note__metadata_reported);
+    }
+    num_reported++;
+
+    char have_buffer[100];
+    size_t have_length = 0;
+    uint32_t have_fourcc = 0;
+    wuffs_base__io_buffer empty = wuffs_base__empty_io_buffer();
+    wuffs_base__metadata_reader reader = wuffs_base__empty_metadata_reader();
+    while (true) {
+      CHECK_STATUS("read_metadata_chunk",
+                   wuffs_gif__decoder__read_metadata_chunk(&dec, &empty,
+                                                           &reader, &src));
+      if (reader.chunk.len == 0) {
+        break;
+      } else if (reader.chunk.len > (sizeof(have_buffer) - have_length)) {
+        RETURN_FAIL("read_metadata_chunk: too much metadata");
+      }
+      memcpy(have_buffer + have_length, reader.chunk.ptr, reader.chunk.len);
+      have_length += reader.chunk.len;
+      have_fourcc = reader.fourcc;
+    }
+
+    const char* want = "";
+    switch (have_fourcc) {
+      case WUFFS_BASE__FOURCC__ICCP:
+        want = "\x16\x26\x36\x46\x56\x76\x86\x96";
+        break;
+      case WUFFS_BASE__FOURCC__XMP:
+        want = "\x05\x17\x27\x37\x47\x57\x03\x77\x87\x97";
+        break;
+      default:
+        RETURN_FAIL("read_metadata_chunk: unexpected FourCC 0x%08" PRIX32,
+                    have_fourcc);
+    }
+    size_t want_length = strlen(want);
+    if ((have_length != want_length) ||
+        memcmp(have_buffer, want, want_length)) {
+      RETURN_FAIL("metadata: fourcc=0x%08" PRIX32 ": values differed",
+                  have_fourcc);
+    }
+  }
+
+  if (num_reported != 2) {
+    RETURN_FAIL("num_reported: have %d, want 2", num_reported);
+  }
+  uint64_t have = wuffs_base__image_config__first_frame_io_position(&ic);
+  if (have != 25) {
+    RETURN_FAIL("first_frame_io_position: have %" PRIu64 ", want 25", have);
+  }
+  return NULL;
+}
+
 const char*  //
 test_wuffs_gif_decode_missing_two_src_bytes() {
   CHECK_FOCUS(__func__);
@@ -1932,6 +2013,88 @@ test_wuffs_gif_io_position_two_chunks() {
   return do_test_wuffs_gif_io_position(true);
 }
 
+const char*  //
+test_wuffs_gif_seek_frame() {
+  CHECK_FOCUS(__func__);
+  wuffs_base__io_buffer src = ((wuffs_base__io_buffer){
+      .data = g_src_slice_u8,
+  });
+  CHECK_STRING(read_file(&src, "test/data/animated-red-blue.gif"));
+
+  wuffs_gif__decoder dec;
+  CHECK_STATUS("initialize",
+               wuffs_gif__decoder__initialize(
+                   &dec, sizeof dec, WUFFS_VERSION,
+                   WUFFS_INITIALIZE__LEAVE_INTERNAL_BUFFERS_UNINITIALIZED));
+
+  uint64_t table[8];
+  wuffs_gif__decoder__set_frame_io_positions(
+      &dec, wuffs_base__make_slice_u64(table, 8));
+
+  uint64_t io_position = 0;
+  wuffs_base__status status = wuffs_gif__decoder__seek_frame(&dec, 0, NULL);
+  if (status.repr != wuffs_base__error__bad_argument) {
+    RETURN_FAIL("seek_frame (before decoding): have \"%s\", want \"%s\"",
+                status.repr, wuffs_base__error__bad_argument);
+  }
+
+  CHECK_STATUS("decode_image_config",
+               wuffs_gif__decoder__decode_image_config(&dec, NULL, &src));
+  uint64_t pos_wants[4] = {781, 2126, 2187, 2542};
+  int i;
+  for (i = 0; i < 4; i++) {
+    CHECK_STATUS("decode_frame_config",
+                 wuffs_gif__decoder__decode_frame_config(&dec, NULL, &src));
+    if (table[i] != UINT64_MAX) {
+      RETURN_FAIL("table[%d] (without a frame_config): have %" PRIu64
+                  ", want UINT64_MAX",
+                  i, table[i]);
+    }
+  }
+
+  // Decoding to a non-NULL frame_config records the io_positions.
+  src.meta.ri = pos_wants[0];
+  CHECK_STATUS("restart_frame",
+               wuffs_gif__decoder__restart_frame(&dec, 0, pos_wants[0]));
+  for (i = 0; i < 4; i++) {
+    wuffs_base__frame_config fc = ((wuffs_base__frame_config){});
+    CHECK_STATUS("decode_frame_config",
+                 wuffs_gif__decoder__decode_frame_config(&dec, &fc, &src));
+    if (table[i] != pos_wants[i]) {
+      RETURN_FAIL("table[%d]: have %" PRIu64 ", want %" PRIu64, i, table[i],
+                  pos_wants[i]);
+    }
+  }
+  if (table[4] != UINT64_MAX) {
+    RETURN_FAIL("table[4]: have %" PRIu64 ", want UINT64_MAX", table[4]);
+  }
+
+  for (i = 3; i >= 0; i--) {
+    CHECK_STATUS("seek_frame",
+                 wuffs_gif__decoder__seek_frame(&dec, i, &io_position));
+    if (io_position != pos_wants[i]) {
+      RETURN_FAIL("io_position #%d: have %" PRIu64 ", want %" PRIu64, i,
+                  io_position, pos_wants[i]);
+    }
+    src.meta.ri = io_position;
+
+    wuffs_base__frame_config fc = ((wuffs_base__frame_config){});
+    CHECK_STATUS("decode_frame_config",
+                 wuffs_gif__decoder__decode_frame_config(&dec, &fc, &src));
+    if (wuffs_base__frame_config__index(&fc) != (uint64_t)i) {
+      RETURN_FAIL("index #%d: have %" PRIu64, i,
+                  wuffs_base__frame_config__index(&fc));
+    }
+  }
+
+  status = wuffs_gif__decoder__seek_frame(&dec, 4, NULL);
+  if (status.repr != wuffs_base__error__bad_argument) {
+    RETURN_FAIL("seek_frame #4: have \"%s\", want \"%s\"", status.repr,
+                wuffs_base__error__bad_argument);
+  }
+  return NULL;
+}
+
 const char*  //
 test_wuffs_gif_small_frame_interlaced() {
   CHECK_FOCUS(__func__);
@@ -1987,6 +2150,66 @@ test_wuffs_gif_small_frame_interlaced() {
   return NULL;
 }
 
+const char*  //
+test_wuffs_gif_status_enums() {
+  CHECK_FOCUS(__func__);
+  if (WUFFS_GIF__STATUS_ENUM__MAX_INCL != 7) {
+    RETURN_FAIL("MAX_INCL: have %d, want 7", WUFFS_GIF__STATUS_ENUM__MAX_INCL);
+  }
+
+  uint32_t e;
+  for (e = 1; e <= WUFFS_GIF__STATUS_ENUM__MAX_INCL; e++) {
+    const char* repr = wuffs_gif__status__from_enum(e);
+    if (!repr) {
+      RETURN_FAIL("from_enum(%" PRIu32 "): have NULL", e);
+    }
+    uint32_t have = wuffs_gif__status__to_enum(repr);
+    if (have != e) {
+      RETURN_FAIL("to_enum(\"%s\"): have %" PRIu32 ", want %" PRIu32, repr,
+                  have, e);
+    }
+  }
+
+  if (wuffs_gif__status__from_enum(WUFFS_GIF__STATUS_ENUM__ERROR__BAD_HEADER) !=
+      wuffs_gif__error__bad_header) {
+    RETURN_FAIL("from_enum(ERROR__BAD_HEADER): have \"%s\", want \"%s\"",
+                wuffs_gif__status__from_enum(
+                    WUFFS_GIF__STATUS_ENUM__ERROR__BAD_HEADER),
+                wuffs_gif__error__bad_header);
+  }
+  if (wuffs_gif__status__from_enum(0) ||
+      wuffs_gif__status__from_enum(WUFFS_GIF__STATUS_ENUM__MAX_INCL + 1)) {
+    RETURN_FAIL("from_enum(out of range): have non-NULL");
+  }
+
+  // Strings that aren't the canonical repr pointer, but are equal to it, also
+  // convert. Other strings convert to zero.
+  char buf[64];
+  strcpy(buf, wuffs_gif__error__bad_palette);
+  const struct {
+    const char* repr;
+    uint32_t want;
+  } test_cases[] = {
+      {buf, WUFFS_GIF__STATUS_ENUM__ERROR__BAD_PALETTE},
+      {"#gif: bad extension label",
+       WUFFS_GIF__STATUS_ENUM__ERROR__BAD_EXTENSION_LABEL},
+      {NULL, 0},
+      {"", 0},
+      {"#gif: bad", 0},
+      {"#gif: bad palettes", 0},
+      {wuffs_base__error__bad_argument, 0},
+  };
+  int tc;
+  for (tc = 0; tc < WUFFS_TESTLIB_ARRAY_SIZE(test_cases); tc++) {
+    uint32_t have = wuffs_gif__status__to_enum(test_cases[tc].repr);
+    if (have != test_cases[tc].want) {
+      RETURN_FAIL("tc=%d: to_enum: have %" PRIu32 ", want %" PRIu32, tc, have,
+                  test_cases[tc].want);
+    }
+  }
+  return NULL;
+}
+
 // ---------------- Mimic Tests
 
 #ifdef WUFFS_MIMIC
@@ -2336,6 +2559,7 @@ proc g_tests[] = {
     test_wuffs_gif_decode_interlaced_truncated,
     test_wuffs_gif_decode_metadata_empty,
     test_wuffs_gif_decode_metadata_full,
+    test_wuffs_gif_decode_metadata_read_chunks,
     test_wuffs_gif_decode_missing_two_src_bytes,
     test_wuffs_gif_decode_multiple_graphic_controls,
     test_wuffs_gif_decode_multiple_loop_counts,
@@ -2355,7 +2579,9 @@ proc g_tests[] = {
     test_wuffs_gif_num_decoded_frames,
     test_wuffs_gif_io_position_one_chunk,
     test_wuffs_gif_io_position_two_chunks,
+    test_wuffs_gif_seek_frame,
     test_wuffs_gif_small_frame_interlaced,
+    test_wuffs_gif_status_enums,
 
 #ifdef WUFFS_MIMIC
 
@@ -138,6 +138,133 @@ test_wuffs_core_multiply_u64() {
   return NULL;
 }
 
+const char*  //
+test_wuffs_core_peek_poke() {
+  CHECK_FOCUS(__func__);
+
+  const uint8_t src[8] = {0x01, 0x23, 0x45, 0x67, 0x89, 0xAB, 0xCD, 0xEF};
+  uint64_t have_be[8] = {
+      wuffs_base__peek_u8be__no_bounds_check(src),
+      wuffs_base__peek_u16be__no_bounds_check(src),
+      wuffs_base__peek_u24be__no_bounds_check(src),
+      wuffs_base__peek_u32be__no_bounds_check(src),
+      wuffs_base__peek_u40be__no_bounds_check(src),
+      wuffs_base__peek_u48be__no_bounds_check(src),
+      wuffs_base__peek_u56be__no_bounds_check(src),
+      wuffs_base__peek_u64be__no_bounds_check(src),
+  };
+  uint64_t have_le[8] = {
+      wuffs_base__peek_u8le__no_bounds_check(src),
+      wuffs_base__peek_u16le__no_bounds_check(src),
+      wuffs_base__peek_u24le__no_bounds_check(src),
+      wuffs_base__peek_u32le__no_bounds_check(src),
+      wuffs_base__peek_u40le__no_bounds_check(src),
+      wuffs_base__peek_u48le__no_bounds_check(src),
+      wuffs_base__peek_u56le__no_bounds_check(src),
+      wuffs_base__peek_u64le__no_bounds_check(src),
+  };
+
+  int i;
+  for (i = 0; i < 8; i++) {
+    uint64_t want_be = 0;
+    uint64_t want_le = 0;
+    int j;
+    for (j = 0; j <= i; j++) {
+      want_be = (want_be << 8) | src[j];
+      want_le |= ((uint64_t)(src[j])) << (8 * j);
+    }
+    if (have_be[i] != want_be) {
+      RETURN_FAIL("peek_u%dbe: have 0x%" PRIX64 ", want 0x%" PRIX64,
+                  8 * (i + 1), have_be[i], want_be);
+    }
+    if (have_le[i] != want_le) {
+      RETURN_FAIL("peek_u%dle: have 0x%" PRIX64 ", want 0x%" PRIX64,
+                  8 * (i + 1), have_le[i], want_le);
+    }
+
+    // Poke into the middle of a buffer, checking that the neighboring bytes
+    // are untouched.
+    uint8_t dst[10];
+    memset(dst, 0x77, 10);
+    switch (i) {
+      case 0:
+        wuffs_base__poke_u8be__no_bounds_check(dst + 1, (uint8_t)want_be);
+        break;
+      case 1:
+        wuffs_base__poke_u16be__no_bounds_check(dst + 1, (uint16_t)want_be);
+        break;
+      case 2:
+        wuffs_base__poke_u24be__no_bounds_check(dst + 1, (uint32_t)want_be);
+        break;
+      case 3:
+        wuffs_base__poke_u32be__no_bounds_check(dst + 1, (uint32_t)want_be);
+        break;
+      case 4:
+        wuffs_base__poke_u40be__no_bounds_check(dst + 1, want_be);
+        break;
+      case 5:
+        wuffs_base__poke_u48be__no_bounds_check(dst + 1, want_be);
+        break;
+      case 6:
+        wuffs_base__poke_u56be__no_bounds_check(dst + 1, want_be);
+        break;
+      case 7:
+        wuffs_base__poke_u64be__no_bounds_check(dst + 1, want_be);
+        break;
+    }
+    if ((dst[0] != 0x77) || memcmp(dst + 1, src, i + 1) ||
+        (dst[i + 2] != 0x77)) {
+      RETURN_FAIL("poke_u%dbe: bytes differ", 8 * (i + 1));
+    }
+
+    memset(dst, 0x77, 10);
+    switch (i) {
+      case 0:
+        wuffs_base__poke_u8le__no_bounds_check(dst + 1, (uint8_t)want_le);
+        break;
+      case 1:
+        wuffs_base__poke_u16le__no_bounds_check(dst + 1, (uint16_t)want_le);
+        break;
+      case 2:
+        wuffs_base__poke_u24le__no_bounds_check(dst + 1, (uint32_t)want_le);
+        break;
+      case 3:
+        wuffs_base__poke_u32le__no_bounds_check(dst + 1, (uint32_t)want_le);
+        break;
+      case 4:
+        wuffs_base__poke_u40le__no_bounds_check(dst + 1, want_le);
+        break;
+      case 5:
+        wuffs_base__poke_u48le__no_bounds_check(dst + 1, want_le);
+        break;
+      case 6:
+        wuffs_base__poke_u56le__no_bounds_check(dst + 1, want_le);
+        break;
+      case 7:
+        wuffs_base__poke_u64le__no_bounds_check(dst + 1, want_le);
+        break;
+    }
+    if ((dst[0] != 0x77) || memcmp(dst + 1, src, i + 1) ||
+        (dst[i + 2] != 0x77)) {
+      RETURN_FAIL("poke_u%dle: bytes differ", 8 * (i + 1));
+    }
+  }
+
+#if defined(__STDC_VERSION__) && (__STDC_VERSION__ >= 201112L) && \
+    !defined(__cplusplus)
+  if (wuffs_base__peek_be__no_bounds_check(src, uint32_t) != 0x01234567) {
+    RETURN_FAIL("_Generic peek_be: bad result");
+  }
+  uint8_t dst[8] = {0};
+  wuffs_base__poke_le__no_bounds_check(dst, (uint16_t)0x2301);
+  if (memcmp(dst, src, 2)) {
+    RETURN_FAIL("_Generic poke_le: bytes differ");
+  }
+#endif
+
+  return NULL;
+}
+
 // ---------------- String Conversions Tests
 
 // wuffs_base__private_implementation__high_prec_dec__to_debug_string converts
@@ -2622,6 +2749,65 @@ wuffs_json_decode(wuffs_base__token_buffer* tok,
   }
 }
 
+const char*  //
+test_wuffs_json_decode_tokens_batch() {
+  CHECK_FOCUS(__func__);
+
+  const char* src_str = "[1, \"ab\", {\"c\": [true, null]}, -2.5e3]";
+  size_t src_len = strlen(src_str);
+
+  // Decode once with plenty of room, to count the tokens.
+  wuffs_json__decoder dec;
+  CHECK_STATUS("initialize",
+               wuffs_json__decoder__initialize(
+                   &dec, sizeof dec, WUFFS_VERSION,
+                   WUFFS_INITIALIZE__LEAVE_INTERNAL_BUFFERS_UNINITIALIZED));
+  wuffs_base__token_buffer tok =
+      wuffs_base__slice_token__writer(g_have_slice_token);
+  wuffs_base__io_buffer src =
+      wuffs_base__ptr_u8__reader((uint8_t*)src_str, src_len, true);
+  uint64_t tokens_needed = 123;
+  CHECK_STATUS("decode_tokens_batch",
+               wuffs_json__decoder__decode_tokens_batch(
+                   &dec, &tok, &src, g_work_slice_u8, &tokens_needed));
+  if (tokens_needed != 0) {
+    RETURN_FAIL("tokens_needed: have %" PRIu64 ", want 0", tokens_needed);
+  }
+  size_t want_wi = tok.meta.wi;
+
+  // Decode again, starting with no room and then, on each "$short write",
+  // making exactly as much room as the decoder asks for. Each call should
+  // make progress: there is no guessing and retrying.
+  CHECK_STATUS("initialize",
+               wuffs_json__decoder__initialize(
+                   &dec, sizeof dec, WUFFS_VERSION,
+                   WUFFS_INITIALIZE__LEAVE_INTERNAL_BUFFERS_UNINITIALIZED));
+  tok = wuffs_base__slice_token__writer(g_have_slice_token);
+  tok.data.len = 0;
+  src = wuffs_base__ptr_u8__reader((uint8_t*)src_str, src_len, true);
+  while (true) {
+    size_t old_wi = tok.meta.wi;
+    wuffs_base__status status = wuffs_json__decoder__decode_tokens_batch(
+        &dec, &tok, &src, g_work_slice_u8, &tokens_needed);
+    if (wuffs_base__status__is_ok(&status)) {
+      break;
+    } else if (status.repr != wuffs_base__suspension__short_write) {
+      RETURN_FAIL("decode_tokens_batch: \"%s\"", status.repr);
+    } else if (tokens_needed == 0) {
+      RETURN_FAIL("tokens_needed: have 0, want > 0");
+    } else if ((old_wi > 0) && (tok.meta.wi == old_wi)) {
+      RETURN_FAIL("decode_tokens_batch: no progress at wi=%zu", old_wi);
+    } else if ((tok.meta.wi + tokens_needed) > g_have_slice_token.len) {
+      RETURN_FAIL("tokens_needed: %" PRIu64 " is too large", tokens_needed);
+    }
+    tok.data.len = tok.meta.wi + tokens_needed;
+  }
+  if (tok.meta.wi != want_wi) {
+    RETURN_FAIL("tok.meta.wi: have %zu, want %zu", tok.meta.wi, want_wi);
+  }
+  return NULL;
+}
+
 const char*  //
 test_wuffs_json_decode_end_of_data() {
   CHECK_FOCUS(__func__);
@@ -4205,6 +4391,7 @@ proc g_tests[] = {
     // good as any other place.
     test_wuffs_core_count_leading_zeroes_u64,
     test_wuffs_core_multiply_u64,
+    test_wuffs_core_peek_poke,
     test_wuffs_strconv_base_16,
     test_wuffs_strconv_base_64,
     test_wuffs_strconv_hpd_rounded_integer,
@@ -4235,6 +4422,7 @@ proc g_tests[] = {
     test_wuffs_json_decode_quirk_replace_invalid_unicode,
     test_wuffs_json_decode_src_io_buffer_length,
     test_wuffs_json_decode_string,
+    test_wuffs_json_decode_tokens_batch,
     test_wuffs_json_decode_unicode4_escapes,
 
 #ifdef WUFFS_MIMIC
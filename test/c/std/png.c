@@ -472,6 +472,21 @@ test_wuffs_png_decode_frame_config() {
   return NULL;
 }
 
+const char*  //
+test_wuffs_png_initialize_workbuf_less() {
+  CHECK_FOCUS(__func__);
+  // The png decoder has no workbuf_less variants, so it cannot run without a
+  // work buffer.
+  wuffs_png__decoder dec;
+  wuffs_base__status status = wuffs_png__decoder__initialize(
+      &dec, sizeof dec, WUFFS_VERSION, WUFFS_INITIALIZE__WORKBUF_LESS);
+  if (status.repr != wuffs_base__error__unsupported_option) {
+    RETURN_FAIL("initialize: have \"%s\", want \"%s\"", status.repr,
+                wuffs_base__error__unsupported_option);
+  }
+  return NULL;
+}
+
 // ---------------- Mimic Tests
 
 #ifdef WUFFS_MIMIC
@@ -811,6 +826,7 @@ proc g_tests[] = {
     test_wuffs_png_decode_filters_round_trip,
     test_wuffs_png_decode_frame_config,
     test_wuffs_png_decode_interface,
+    test_wuffs_png_initialize_workbuf_less,
 
 #ifdef WUFFS_MIMIC
 
@@ -241,6 +241,78 @@ test_wuffs_zlib_decode_pi() {
                             UINT64_MAX);
 }
 
+// read_window is a wuffs_base__io_read_func that returns its context's bytes
+// in small runs, like a ring buffer would.
+typedef struct {
+  wuffs_base__slice_u8 remaining;
+  size_t window;
+} read_window_context;
+
+wuffs_base__slice_u8  //
+read_window(void* context, bool* closed) {
+  read_window_context* c = (read_window_context*)context;
+  size_t n = c->remaining.len < c->window ? c->remaining.len : c->window;
+  wuffs_base__slice_u8 ret = wuffs_base__make_slice_u8(c->remaining.ptr, n);
+  c->remaining = wuffs_base__slice_u8__subslice_i(c->remaining, n);
+  *closed = c->remaining.len == 0;
+  return ret;
+}
+
+const char*  //
+test_wuffs_zlib_decode_io_read_callback() {
+  CHECK_FOCUS(__func__);
+
+  wuffs_base__io_buffer src = ((wuffs_base__io_buffer){
+      .data = g_src_slice_u8,
+  });
+  wuffs_base__io_buffer want = ((wuffs_base__io_buffer){
+      .data = g_want_slice_u8,
+  });
+  CHECK_STRING(read_file(&src, g_zlib_midsummer_gt.src_filename));
+  CHECK_STRING(read_file(&want, g_zlib_midsummer_gt.want_filename));
+
+  size_t windows[] = {1, 7, 100, 1000000};
+  int tc;
+  for (tc = 0; tc < WUFFS_TESTLIB_ARRAY_SIZE(windows); tc++) {
+    wuffs_zlib__decoder dec;
+    CHECK_STATUS("initialize",
+                 wuffs_zlib__decoder__initialize(
+                     &dec, sizeof dec, WUFFS_VERSION,
+                     WUFFS_INITIALIZE__LEAVE_INTERNAL_BUFFERS_UNINITIALIZED));
+
+    read_window_context context = {
+        .remaining = wuffs_base__make_slice_u8(src.data.ptr, src.meta.wi),
+        .window = windows[tc],
+    };
+    uint8_t stitch[64];
+    wuffs_base__io_read_callback cb = wuffs_base__make_io_read_callback(
+        &read_window, &context, wuffs_base__make_slice_u8(stitch, 64));
+
+    wuffs_base__io_buffer have = ((wuffs_base__io_buffer){
+        .data = g_have_slice_u8,
+    });
+    wuffs_base__io_buffer dec_src = wuffs_base__empty_io_buffer();
+    while (true) {
+      wuffs_base__status status = wuffs_zlib__decoder__transform_io(
+          &dec, &have, &dec_src, g_work_slice_u8);
+      if (status.repr != wuffs_base__suspension__short_read) {
+        CHECK_STATUS("transform_io", status);
+        break;
+      }
+      CHECK_STATUS("refill", wuffs_base__io_buffer__refill(&dec_src, &cb));
+    }
+
+    if (dec_src.meta.pos + dec_src.meta.ri != src.meta.wi) {
+      RETURN_FAIL("window=%zu: reader position: have %" PRIu64
+                  ", want %zu",
+                  windows[tc], dec_src.meta.pos + dec_src.meta.ri,
+                  src.meta.wi);
+    }
+    CHECK_STRING(check_io_buffers_equal("", &have, &want));
+  }
+  return NULL;
+}
+
 const char*  //
 test_wuffs_zlib_decode_sheep() {
   CHECK_FOCUS(__func__);
@@ -376,6 +448,7 @@ proc g_tests[] = {
     test_wuffs_zlib_checksum_verify_bad3,
     test_wuffs_zlib_checksum_verify_good,
     test_wuffs_zlib_decode_interface,
+    test_wuffs_zlib_decode_io_read_callback,
     test_wuffs_zlib_decode_midsummer,
     test_wuffs_zlib_decode_pi,
     test_wuffs_zlib_decode_sheep,
@@ -14,6 +14,7 @@
 
 #include <errno.h>
 #include <inttypes.h>
+#include <stdarg.h>
 #include <stdio.h>
 #include <stdlib.h>
 #include <string.h>
@@ -136,6 +137,7 @@ struct {
   const char* focus;
   uint64_t iterscale;
   int reps;
+  const char* snapshot;
 } g_flags = {0};
 
 const char*  //
@@ -190,6 +192,14 @@ parse_flags(int argc, char** argv) {
       continue;
     }
 
+    if (!strncmp(arg, "snapshot=", 9)) {
+      g_flags.snapshot = arg + 9;
+      if (!*g_flags.snapshot) {
+        return "missing -snapshot=FILENAME value";
+      }
+      continue;
+    }
+
     if (!strncmp(arg, "reps=", 5)) {
       arg += 5;
       if (!*arg) {
@@ -268,9 +278,19 @@ check_focus() {
         p += 9;
       }
 
+      // A trailing '$' means that the [p, q) string has to match all of
+      // g_proc_func_name, not just a prefix. "wuffs bench -flamegraph" uses
+      // this to run one benchmark at a time, as "bench_foo_10k" is otherwise
+      // a prefix of "bench_foo_100k".
+      bool exact = (q > p) && (q[-1] == '$');
+      if (exact) {
+        q--;
+      }
+
       // See if g_proc_func_name (with or without a "test_" or "bench_" prefix)
-      // starts with the [p, q) string.
-      if ((n >= q - p) && !strncmp(g_proc_func_name, p, q - p)) {
+      // starts with (or, if exact, equals) the [p, q) string.
+      if ((n >= q - p) && !strncmp(g_proc_func_name, p, q - p) &&
+          (!exact || (n == q - p))) {
         return true;
       }
       const char* unprefixed_proc_func_name = NULL;
@@ -283,7 +303,8 @@ check_focus() {
         unprefixed_n = n - 6;
       }
       if (unprefixed_proc_func_name && (unprefixed_n >= q - p) &&
-          !strncmp(unprefixed_proc_func_name, p, q - p)) {
+          !strncmp(unprefixed_proc_func_name, p, q - p) &&
+          (!exact || (unprefixed_n == q - p))) {
         return true;
       }
     }
@@ -296,6 +317,52 @@ check_focus() {
   return false;
 }
 
+// --------
+
+// g_snapshot_file, if non-NULL, receives the observable behavior (such as
+// hashes of the decoded output, the statuses returned and the workbuf length)
+// of the do_test__etc helper functions, one "func_name key value" line per
+// observation. The "wuffs test -snapshot" command compares this against a
+// golden file, to catch regressions that the coarser checks (such as only
+// looking at the final pixel) would miss.
+FILE* g_snapshot_file = NULL;
+
+void  //
+snapshot_recordf(const char* key, const char* format, ...) {
+  if (!g_snapshot_file) {
+    return;
+  }
+  fprintf(g_snapshot_file, "%s %s ", g_proc_func_name, key);
+  va_list args;
+  va_start(args, format);
+  vfprintf(g_snapshot_file, format, args);
+  va_end(args);
+  fprintf(g_snapshot_file, "\n");
+}
+
+void  //
+snapshot_record_status(const char* key, wuffs_base__status status) {
+  snapshot_recordf(key, "%s", status.repr ? status.repr : "ok");
+}
+
+void  //
+snapshot_record_bytes(const char* key, const uint8_t* ptr, size_t len) {
+  // This is the 64-bit FNV-1a hash.
+  uint64_t hash = 0xCBF29CE484222325;
+  size_t i;
+  for (i = 0; i < len; i++) {
+    hash ^= ptr[i];
+    hash *= 0x00000100000001B3;
+  }
+  snapshot_recordf(key, "%zu bytes, fnv1a64 0x%016" PRIX64, len, hash);
+}
+
+void  //
+snapshot_record_workbuf_len(wuffs_base__range_ii_u64 workbuf_len) {
+  snapshot_recordf("workbuf_len", "[%" PRIu64 " ..= %" PRIu64 "]",
+                   workbuf_len.min_incl, workbuf_len.max_incl);
+}
+
 // https://www.guyrutenberg.com/2008/12/20/expanding-macros-into-string-constants-in-c/
 #define WUFFS_TESTLIB_QUOTE_EXPAND(x) #x
 #define WUFFS_TESTLIB_QUOTE(x) WUFFS_TESTLIB_QUOTE_EXPAND(x)
@@ -411,6 +478,18 @@ test_main(int argc, char** argv, proc* tests, proc* benches) {
     return 1;
   }
 
+  if (g_flags.snapshot) {
+    if (g_flags.bench) {
+      fprintf(stderr, "cannot combine -bench and -snapshot\n");
+      return 1;
+    }
+    g_snapshot_file = fopen(g_flags.snapshot, "w");
+    if (!g_snapshot_file) {
+      fprintf(stderr, "could not open -snapshot file: %s\n", strerror(errno));
+      return 1;
+    }
+  }
+
   int reps = 1;
   proc* procs = tests;
   if (g_flags.bench) {
@@ -458,6 +537,10 @@ test_main(int argc, char** argv, proc* tests, proc* benches) {
              g_tests_run);
     }
   }
+  if (g_snapshot_file && fclose(g_snapshot_file)) {
+    fprintf(stderr, "could not close -snapshot file: %s\n", strerror(errno));
+    return 1;
+  }
   return 0;
 }
 
@@ -908,6 +991,8 @@ proc_io_buffers(const char* (*codec_func)(wuffs_base__io_buffer*,
     return NULL;
   }
 
+  snapshot_record_bytes("dst", have.data.ptr, have.meta.wi);
+
   if (!gt->want_filename) {
     want.meta.closed = true;
   } else {
@@ -1163,6 +1248,7 @@ do_test__wuffs_base__hasher_u32(wuffs_base__hasher_u32* b,
              .ptr = (uint8_t*)(src.data.ptr + src.meta.ri),
              .len = (size_t)(src.meta.wi - src.meta.ri),
          }));
+  snapshot_recordf("hash", "0x%08" PRIX32, have);
   if (have != want) {
     RETURN_FAIL("have 0x%08" PRIX32 ", want 0x%08" PRIX32, have, want);
   }
@@ -1188,8 +1274,10 @@ do_test__wuffs_base__image_decoder(
       .data = g_src_slice_u8,
   });
   CHECK_STRING(read_file_fragment(&src, src_filename, src_ri, src_wi));
-  CHECK_STATUS("decode_image_config",
-               wuffs_base__image_decoder__decode_image_config(b, &ic, &src));
+  wuffs_base__status status =
+      wuffs_base__image_decoder__decode_image_config(b, &ic, &src);
+  snapshot_record_status("decode_image_config", status);
+  CHECK_STATUS("decode_image_config", status);
 
   uint32_t have_width = wuffs_base__pixel_config__width(&ic.pixcfg);
   if (have_width != want_width) {
@@ -1208,11 +1296,16 @@ do_test__wuffs_base__image_decoder(
   wuffs_base__pixel_buffer pb = ((wuffs_base__pixel_buffer){});
   CHECK_STATUS("set_from_slice", wuffs_base__pixel_buffer__set_from_slice(
                                      &pb, &ic.pixcfg, g_pixel_slice_u8));
-  CHECK_STATUS("decode_frame", wuffs_base__image_decoder__decode_frame(
-                                   b, &pb, &src, WUFFS_BASE__PIXEL_BLEND__SRC,
-                                   g_work_slice_u8, NULL));
+  snapshot_record_workbuf_len(wuffs_base__image_decoder__workbuf_len(b));
+  status = wuffs_base__image_decoder__decode_frame(
+      b, &pb, &src, WUFFS_BASE__PIXEL_BLEND__SRC, g_work_slice_u8, NULL);
+  snapshot_record_status("decode_frame", status);
+  CHECK_STATUS("decode_frame", status);
 
   uint64_t n = wuffs_base__pixel_config__pixbuf_len(&ic.pixcfg);
+  if (n <= PIXEL_BUFFER_ARRAY_SIZE) {
+    snapshot_record_bytes("pixels", g_pixel_array_u8, n);
+  }
   if (n < 4) {
     RETURN_FAIL("pixbuf_len too small");
   } else if (n > PIXEL_BUFFER_ARRAY_SIZE) {
@@ -1256,6 +1349,7 @@ do_test__wuffs_base__io_transformer(wuffs_base__io_transformer* b,
   if (workbuf_len.max_incl > IO_BUFFER_ARRAY_SIZE) {
     return "workbuf_len is too large";
   }
+  snapshot_record_workbuf_len(workbuf_len);
 
   wuffs_base__io_buffer have = ((wuffs_base__io_buffer){
       .data = g_have_slice_u8,
@@ -1264,8 +1358,11 @@ do_test__wuffs_base__io_transformer(wuffs_base__io_transformer* b,
       .data = g_src_slice_u8,
   });
   CHECK_STRING(read_file_fragment(&src, src_filename, src_ri, src_wi));
-  CHECK_STATUS("transform_io", wuffs_base__io_transformer__transform_io(
-                                   b, &have, &src, g_work_slice_u8));
+  wuffs_base__status status = wuffs_base__io_transformer__transform_io(
+      b, &have, &src, g_work_slice_u8);
+  snapshot_record_status("transform_io", status);
+  CHECK_STATUS("transform_io", status);
+  snapshot_record_bytes("dst", have.data.ptr, have.meta.wi);
   if (have.meta.wi != want_wi) {
     RETURN_FAIL("dst wi: have %zu, want %zu", have.meta.wi, want_wi);
   }
@@ -1301,8 +1398,11 @@ do_test__wuffs_base__token_decoder(wuffs_base__token_decoder* b,
     src.meta.closed = true;
   }
 
-  CHECK_STATUS("decode_tokens", wuffs_base__token_decoder__decode_tokens(
-                                    b, &tok, &src, g_work_slice_u8));
+  snapshot_record_workbuf_len(wuffs_base__token_decoder__workbuf_len(b));
+  wuffs_base__status status = wuffs_base__token_decoder__decode_tokens(
+      b, &tok, &src, g_work_slice_u8);
+  snapshot_record_status("decode_tokens", status);
+  CHECK_STATUS("decode_tokens", status);
 
   uint64_t pos = 0;
   while (tok.meta.ri < tok.meta.wi) {
@@ -1347,6 +1447,8 @@ do_test__wuffs_base__token_decoder(wuffs_base__token_decoder* b,
     }
   }
 
+  snapshot_record_bytes("tokens", have.data.ptr, have.meta.wi);
+
   if (gt->want_filename) {
     CHECK_STRING(read_file(&want, gt->want_filename));
   } else {